@@ -48,11 +48,18 @@ func (c *Client) NewAccessKey(ctx context.Context, rawXpubKey string, opts ...Mo
 }
 
 // GetAccessKey will get an existing access key from the Datastore
+//
+// xPubID is the xPub ID (or the raw public xPub)
 func (c *Client) GetAccessKey(ctx context.Context, xPubID, id string) (*AccessKey, error) {
 
 	// Check for existing NewRelic transaction
 	ctx = c.GetOrStartTxn(ctx, "get_access_key")
 
+	xPubID, err := resolveXpubID(xPubID)
+	if err != nil {
+		return nil, err
+	}
+
 	// Get the access key
 	accessKey, err := getAccessKey(
 		ctx, id,
@@ -111,15 +118,42 @@ func (c *Client) GetAccessKeysCount(ctx context.Context, metadataConditions *Met
 	return count, nil
 }
 
+// GetAccessKeysPaged will get a page of access keys and the total count of access keys matching the conditions
+func (c *Client) GetAccessKeysPaged(ctx context.Context, metadataConditions *Metadata,
+	conditions *map[string]interface{}, queryParams *datastore.QueryParams, opts ...ModelOps,
+) (*PagedResult[*AccessKey], error) {
+	// Check for existing NewRelic transaction
+	ctx = c.GetOrStartTxn(ctx, "get_access_keys_paged")
+
+	// Get the page and the total count using the same conditions
+	return getPagedResult(conditions, queryParams,
+		func(dbConditions *map[string]interface{}) ([]*AccessKey, error) {
+			return c.GetAccessKeys(ctx, metadataConditions, dbConditions, queryParams, opts...)
+		},
+		func(dbConditions *map[string]interface{}) (int64, error) {
+			return c.GetAccessKeysCount(ctx, metadataConditions, dbConditions, opts...)
+		},
+	)
+}
+
 // GetAccessKeysByXPubID will get all existing access keys from the Datastore
 //
 // metadataConditions is the metadata to match to the access keys being returned
+//
+// conditions can include "revoked" (bool) for the revoked or active keys and a "created_at" date range
+//
+// xPubID is the xPub ID (or the raw public xPub)
 func (c *Client) GetAccessKeysByXPubID(ctx context.Context, xPubID string, metadataConditions *Metadata,
 	conditions *map[string]interface{}, queryParams *datastore.QueryParams, opts ...ModelOps) ([]*AccessKey, error) {
 
 	// Check for existing NewRelic transaction
 	ctx = c.GetOrStartTxn(ctx, "get_access_keys")
 
+	xPubID, err := resolveXpubID(xPubID)
+	if err != nil {
+		return nil, err
+	}
+
 	// Get the access key
 	accessKeys, err := getAccessKeysByXPubID(
 		ctx,
@@ -140,12 +174,21 @@ func (c *Client) GetAccessKeysByXPubID(ctx context.Context, xPubID string, metad
 }
 
 // GetAccessKeysByXPubIDCount will get a count of all existing access keys from the Datastore
+//
+// conditions can include "revoked" (bool) for the revoked or active keys and a "created_at" date range
+//
+// xPubID is the xPub ID (or the raw public xPub)
 func (c *Client) GetAccessKeysByXPubIDCount(ctx context.Context, xPubID string, metadataConditions *Metadata,
 	conditions *map[string]interface{}, opts ...ModelOps) (int64, error) {
 
 	// Check for existing NewRelic transaction
 	ctx = c.GetOrStartTxn(ctx, "get_access_keys")
 
+	xPubID, err := resolveXpubID(xPubID)
+	if err != nil {
+		return 0, err
+	}
+
 	// Get the access key
 	count, err := getAccessKeysByXPubIDCount(
 		ctx,
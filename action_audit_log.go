@@ -0,0 +1,94 @@
+package bux
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/mrz1836/go-datastore"
+)
+
+const (
+	auditChainPageSize = 100 // Number of entries read per query when verifying the chain
+)
+
+// GetAuditLog will get the entries of the audit log by conditions (admin)
+//
+// The entries are ordered by their position in the chain (sequence) unless the query params set an order
+func (c *Client) GetAuditLog(ctx context.Context, conditions *map[string]interface{},
+	queryParams *datastore.QueryParams,
+) ([]*AuditLog, error) {
+
+	// Check for existing NewRelic transaction
+	ctx = c.GetOrStartTxn(ctx, "get_audit_log")
+
+	return getAuditLogs(ctx, conditions, queryParams, c.DefaultModelOptions()...)
+}
+
+// VerifyAuditChain will verify the hash chain of the audit log from and to the positions (sequence, inclusive)
+//
+// A from of 0 starts at the first entry, a to of 0 ends at the last entry. Returns ErrAuditChainBroken if an
+// entry is missing, was changed or is not linked to the previous entry.
+func (c *Client) VerifyAuditChain(ctx context.Context, from, to uint64) error {
+
+	// Check for existing NewRelic transaction
+	ctx = c.GetOrStartTxn(ctx, "verify_audit_chain")
+
+	if from == 0 {
+		from = 1
+	}
+	if to > 0 && from > to {
+		return fmt.Errorf("%w: invalid range %d to %d", ErrAuditChainBroken, from, to)
+	}
+
+	// The first entry of the range is linked to the entry before the range
+	opts := c.DefaultModelOptions()
+	previousHash := ""
+	if from > 1 {
+		previous, err := getAuditLogBySequence(ctx, from-1, opts...)
+		if err != nil {
+			return err
+		} else if previous == nil {
+			return fmt.Errorf("%w: entry %d is missing", ErrAuditChainBroken, from-1)
+		}
+		previousHash = previous.ID
+	}
+
+	conditions := map[string]interface{}{sequenceField: map[string]interface{}{"$gte": from}}
+	if to > 0 {
+		conditions[sequenceField] = map[string]interface{}{"$gte": from, "$lte": to}
+	}
+
+	signingKey := c.options.auditSigningKey
+	next := from
+	for page := 1; ; page++ {
+		entries, err := getAuditLogs(ctx, &conditions, &datastore.QueryParams{
+			OrderByField:  sequenceField,
+			Page:          page,
+			PageSize:      auditChainPageSize,
+			SortDirection: datastore.SortAsc,
+		}, opts...)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if entry.Sequence != next {
+				return fmt.Errorf("%w: entry %d is missing", ErrAuditChainBroken, next)
+			} else if entry.PreviousHash != previousHash {
+				return fmt.Errorf("%w: entry %d is not linked to the previous entry", ErrAuditChainBroken, next)
+			} else if entry.computeHash(signingKey) != entry.ID {
+				return fmt.Errorf("%w: entry %d does not match its hash", ErrAuditChainBroken, next)
+			}
+			previousHash = entry.ID
+			next++
+		}
+		if len(entries) < auditChainPageSize {
+			break
+		}
+	}
+
+	// The range must be complete (the last entries were not removed)
+	if to > 0 && next <= to {
+		return fmt.Errorf("%w: entry %d is missing", ErrAuditChainBroken, next)
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package bux
+
+import (
+	"context"
+
+	"github.com/mrz1836/go-datastore"
+)
+
+// GetBalanceEvents will get the balance events of the xPub (oldest first by default)
+//
+// xPubID is the xPub ID (or the raw public xPub)
+func (c *Client) GetBalanceEvents(ctx context.Context, xPubID string,
+	queryParams *datastore.QueryParams,
+) ([]*BalanceEvent, error) {
+
+	// Check for existing NewRelic transaction
+	ctx = c.GetOrStartTxn(ctx, "get_balance_events")
+
+	xPubID, err := resolveXpubID(xPubID)
+	if err != nil {
+		return nil, err
+	}
+
+	return getBalanceEvents(ctx, xPubID, queryParams, c.DefaultModelOptions()...)
+}
+
+// CheckBalanceEvents will check that the resulting balance of the last balance event is the balance of the xPub
+//
+// Returns ErrBalanceEventsMismatch (with both balances) if the balance drifted
+func (c *Client) CheckBalanceEvents(ctx context.Context, xPubID string) error {
+
+	// Check for existing NewRelic transaction
+	ctx = c.GetOrStartTxn(ctx, "check_balance_events")
+
+	xPubID, err := resolveXpubID(xPubID)
+	if err != nil {
+		return err
+	}
+
+	// Get the current balance (not cached)
+	var xPub *Xpub
+	if xPub, err = getXpubByID(ctx, xPubID, c.DefaultModelOptions()...); err != nil {
+		return err
+	} else if xPub == nil {
+		return ErrMissingXpub
+	}
+
+	return checkBalanceEvents(ctx, xPub, c.DefaultModelOptions()...)
+}
@@ -114,3 +114,29 @@ func (c *Client) GetBlockHeaderByHeight(ctx context.Context, height uint32) (*Bl
 	// Get the block header by height
 	return getBlockHeaderByHeight(ctx, height, c.DefaultModelOptions()...)
 }
+
+// SyncBlockHeaders will fetch the missing block headers from the provider (see WithBlockHeaderSync)
+//
+// The headers after the last block header are validated and saved, a reorg at the tip is truncated
+// and fetched again. Only one instance syncs at a time (ErrBlockHeaderSyncDisabled if not configured)
+func (c *Client) SyncBlockHeaders(ctx context.Context) (*BlockHeaderSyncResult, error) {
+
+	// Check for existing NewRelic transaction
+	ctx = c.GetOrStartTxn(ctx, "sync_block_headers")
+
+	if !c.IsBlockHeaderSyncEnabled() {
+		return nil, ErrBlockHeaderSyncDisabled
+	}
+
+	// Create the lock and set the release for after the function completes
+	network := getClientNetwork(c)
+	unlock, err := newWriteLock(
+		ctx, fmt.Sprintf(lockKeySyncBlockHeaders, network), c.Cachestore(),
+	)
+	defer unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	return c.options.blockHeaderSync.syncBlockHeaders(ctx, network, c.DefaultModelOptions()...)
+}
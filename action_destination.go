@@ -3,8 +3,10 @@ package bux
 import (
 	"context"
 	"database/sql"
+	"fmt"
 	"time"
 
+	"github.com/BuxOrg/bux/utils"
 	"github.com/mrz1836/go-datastore"
 	customTypes "github.com/mrz1836/go-datastore/custom_types"
 )
@@ -30,38 +32,217 @@ func (c *Client) NewDestination(ctx context.Context, xPubKey string, chain uint3
 		return nil, ErrMissingXpub
 	}
 
-	// Get/create a new destination
+	// Get/create a new destination (retry with the next index if the chain/num is already used)
 	var destination *Destination
-	if destination, err = xPub.getNewDestination(
-		ctx, chain, destinationType,
-		append(opts, c.DefaultModelOptions()...)..., // Passing down the Datastore and client information into the model
+	for retry := 0; ; retry++ {
+		if destination, err = xPub.getNewDestination(
+			ctx, chain, destinationType,
+			append(opts, c.DefaultModelOptions()...)..., // Passing down the Datastore and client information into the model
+		); err != nil {
+			return nil, err
+		}
+
+		if monitor {
+			destination.Monitor = customTypes.NullTime{NullTime: sql.NullTime{
+				Valid: true,
+				Time:  time.Now(),
+			}}
+		}
+
+		// Save the destination
+		if err = destination.Save(ctx); err == nil {
+			break
+		} else if !isUniqueConstraintError(err) || retry >= defaultDestinationIndexRetries {
+			return nil, err
+		}
+		c.Logger().Warn(ctx, fmt.Sprintf(
+			"destination index collision for xpub %s: chain %d num %d is already used, retrying",
+			xPub.ID, destination.Chain, destination.Num,
+		))
+	}
+
+	// Return the model
+	return destination, nil
+}
+
+// DestinationIndexCorrection is a correction of a destination index collision (see FixDestinationIndexCollisions)
+type DestinationIndexCorrection struct {
+	Chain            uint32 `json:"chain" toml:"chain" yaml:"chain" bson:"chain"`
+	DestinationID    string `json:"destination_id" toml:"destination_id" yaml:"destination_id" bson:"destination_id"`
+	Funded           bool   `json:"funded" toml:"funded" yaml:"funded" bson:"funded"`
+	NewDestinationID string `json:"new_destination_id,omitempty" toml:"new_destination_id" yaml:"new_destination_id" bson:"new_destination_id,omitempty"`
+	NewNum           uint32 `json:"new_num" toml:"new_num" yaml:"new_num" bson:"new_num"`
+	OldNum           uint32 `json:"old_num" toml:"old_num" yaml:"old_num" bson:"old_num"`
+}
+
+// FixDestinationIndexCollisions will detect destinations of an xPub using the same chain/num and
+// detach the destination(s) that are not derived at that chain/num from the index
+//
+// xPubKey is the raw public xPub (the replacement destinations are derived from it)
+//
+// The destination derived at the chain/num keeps the index (the oldest destination if none is). The locking script
+// of a destination cannot change: the other destinations are revoked (without a derivation path) and replaced by
+// new destinations derived at a fresh num. The utxos of a funded destination are not moved (see Funded).
+// The unique index is created once all collisions are fixed.
+func (c *Client) FixDestinationIndexCollisions(ctx context.Context,
+	xPubKey string) ([]*DestinationIndexCorrection, error) {
+
+	// Check for existing NewRelic transaction
+	ctx = c.GetOrStartTxn(ctx, "fix_destination_index_collisions")
+
+	// Get the xPub (by key - converts to id)
+	xPub, err := getXpubWithCache(ctx, c, xPubKey, "", c.DefaultModelOptions()...)
+	if err != nil {
+		return nil, err
+	} else if xPub == nil {
+		return nil, ErrMissingXpub
+	}
+
+	// Lock the xPub (no new destinations while fixing)
+	unlock, err := newWaitWriteLock(ctx, fmt.Sprintf(lockKeyProcessXpub, xPub.ID), c.Cachestore())
+	defer unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	// Get all the destinations (oldest first)
+	var destinations []*Destination
+	if destinations, err = getDestinationsByXpubID(
+		ctx, xPub.ID, nil, nil, &datastore.QueryParams{
+			OrderByField:  createdAtField,
+			SortDirection: datastore.SortAsc,
+		}, c.DefaultModelOptions()...,
 	); err != nil {
 		return nil, err
 	}
 
-	if monitor {
-		destination.Monitor = customTypes.NullTime{NullTime: sql.NullTime{
-			Valid: true,
-			Time:  time.Now(),
-		}}
+	// Group the derived destinations by chain/num
+	indexKey := func(chain, num uint32) string {
+		return fmt.Sprintf("%d/%d", chain, num)
+	}
+	indexes := make([]string, 0)
+	destinationsByIndex := make(map[string][]*Destination)
+	for _, destination := range destinations {
+		if len(destination.FullDerivationPath) == 0 {
+			continue // Not a derived destination (IE: locking script destination)
+		}
+		key := indexKey(destination.Chain, destination.Num)
+		if _, ok := destinationsByIndex[key]; !ok {
+			indexes = append(indexes, key)
+		}
+		destinationsByIndex[key] = append(destinationsByIndex[key], destination)
 	}
 
-	// Save the destination
+	corrections := make([]*DestinationIndexCorrection, 0)
+	for _, key := range indexes {
+		collided := destinationsByIndex[key]
+		if len(collided) < 2 {
+			continue
+		}
+
+		// The destination derived at the chain/num keeps the index
+		var derived *Destination
+		if derived, err = newAddress(
+			xPub.rawXpubKey, collided[0].Chain, collided[0].Num, c.DefaultModelOptions()...,
+		); err != nil {
+			return corrections, err
+		}
+		keep := 0
+		for index, destination := range collided {
+			if destination.ID == derived.ID {
+				keep = index
+				break
+			}
+		}
+
+		for index, destination := range collided {
+			if index == keep {
+				continue
+			}
+			var correction *DestinationIndexCorrection
+			if correction, err = c.fixDestinationIndexCollision(ctx, xPub, destination); err != nil {
+				return corrections, err
+			}
+			corrections = append(corrections, correction)
+		}
+	}
+
+	// Create the unique index (failed on startup if there were collisions)
+	if len(corrections) > 0 {
+		if err = newDestination(
+			"", "", c.DefaultModelOptions()...,
+		).migrateIndexUniqueness(c.Datastore()); err != nil {
+			return corrections, err
+		}
+	}
+
+	return corrections, nil
+}
+
+// fixDestinationIndexCollision will revoke the destination and replace it by a new destination derived at a fresh num
+//
+// The destination is detached from the index (no derivation path), the utxos of a funded destination are not moved
+func (c *Client) fixDestinationIndexCollision(ctx context.Context, xPub *Xpub,
+	destination *Destination) (*DestinationIndexCorrection, error) {
+
+	funded, err := getUtxosCount(ctx, nil, &map[string]interface{}{
+		scriptPubKeyField: destination.LockingScript,
+	}, c.DefaultModelOptions()...)
+	if err != nil {
+		return nil, err
+	}
+
+	// Derive the replacement destination at a fresh num
+	var replacement *Destination
+	if replacement, err = xPub.getNewDestination(
+		ctx, destination.Chain, utils.ScriptTypePubKeyHash, c.DefaultModelOptions()...,
+	); err != nil {
+		return nil, err
+	}
+	replacement.Metadata = destination.Metadata
+	replacement.Monitor = destination.Monitor
+	if err = replacement.Save(ctx); err != nil {
+		return nil, err
+	}
+
+	// Revoke the collided destination (no new funds are accepted)
+	destination.FullDerivationPath = ""
+	destination.RevokedAt = customTypes.NullTime{NullTime: sql.NullTime{
+		Valid: true,
+		Time:  time.Now().UTC(),
+	}}
 	if err = destination.Save(ctx); err != nil {
 		return nil, err
 	}
 
-	// Return the model
-	return destination, nil
+	c.Logger().Warn(ctx, fmt.Sprintf(
+		"fixed destination index collision for xpub %s: destination %s at chain %d num %d (funded: %t) was revoked and replaced by %s at num %d",
+		xPub.ID, destination.ID, destination.Chain, destination.Num, funded > 0, replacement.ID, replacement.Num,
+	))
+	return &DestinationIndexCorrection{
+		Chain:            destination.Chain,
+		DestinationID:    destination.ID,
+		Funded:           funded > 0,
+		NewDestinationID: replacement.ID,
+		NewNum:           replacement.Num,
+		OldNum:           destination.Num,
+	}, nil
 }
 
 // NewDestinationForLockingScript will create a new destination based on a locking script
+//
+// xPubID is the xPub ID (or the raw public xPub)
 func (c *Client) NewDestinationForLockingScript(ctx context.Context, xPubID, lockingScript string,
 	monitor bool, opts ...ModelOps) (*Destination, error) {
 
 	// Check for existing NewRelic transaction
 	ctx = c.GetOrStartTxn(ctx, "new_destination_for_locking_script")
 
+	xPubID, err := resolveXpubID(xPubID)
+	if err != nil {
+		return nil, err
+	}
+
 	// Ensure locking script isn't empty
 	if len(lockingScript) == 0 {
 		return nil, ErrMissingLockingScript
@@ -133,15 +314,40 @@ func (c *Client) GetDestinationsCount(ctx context.Context, metadataConditions *M
 	return count, nil
 }
 
+// GetDestinationsPaged will get a page of destinations and the total count of destinations matching the conditions
+func (c *Client) GetDestinationsPaged(ctx context.Context, metadataConditions *Metadata,
+	conditions *map[string]interface{}, queryParams *datastore.QueryParams, opts ...ModelOps,
+) (*PagedResult[*Destination], error) {
+	// Check for existing NewRelic transaction
+	ctx = c.GetOrStartTxn(ctx, "get_destinations_paged")
+
+	// Get the page and the total count using the same conditions
+	return getPagedResult(conditions, queryParams,
+		func(dbConditions *map[string]interface{}) ([]*Destination, error) {
+			return c.GetDestinations(ctx, metadataConditions, dbConditions, queryParams, opts...)
+		},
+		func(dbConditions *map[string]interface{}) (int64, error) {
+			return c.GetDestinationsCount(ctx, metadataConditions, dbConditions, opts...)
+		},
+	)
+}
+
 // GetDestinationsByXpubID will get destinations based on an xPub
 //
 // metadataConditions are the search criteria used to find destinations
+//
+// xPubID is the xPub ID (or the raw public xPub)
 func (c *Client) GetDestinationsByXpubID(ctx context.Context, xPubID string, metadataConditions *Metadata,
 	conditions *map[string]interface{}, queryParams *datastore.QueryParams) ([]*Destination, error) {
 
 	// Check for existing NewRelic transaction
 	ctx = c.GetOrStartTxn(ctx, "get_destinations")
 
+	xPubID, err := resolveXpubID(xPubID)
+	if err != nil {
+		return nil, err
+	}
+
 	// Get the destinations
 	destinations, err := getDestinationsByXpubID(
 		ctx, xPubID, metadataConditions, conditions, queryParams, c.DefaultModelOptions()...,
@@ -154,12 +360,19 @@ func (c *Client) GetDestinationsByXpubID(ctx context.Context, xPubID string, met
 }
 
 // GetDestinationsByXpubIDCount will get a count of all destinations based on an xPub
+//
+// xPubID is the xPub ID (or the raw public xPub)
 func (c *Client) GetDestinationsByXpubIDCount(ctx context.Context, xPubID string, metadataConditions *Metadata,
 	conditions *map[string]interface{}) (int64, error) {
 
 	// Check for existing NewRelic transaction
 	ctx = c.GetOrStartTxn(ctx, "get_destinations")
 
+	xPubID, err := resolveXpubID(xPubID)
+	if err != nil {
+		return 0, err
+	}
+
 	// Get the count
 	count, err := getDestinationsCountByXPubID(
 		ctx, xPubID, metadataConditions, conditions, c.DefaultModelOptions()...,
@@ -172,11 +385,18 @@ func (c *Client) GetDestinationsByXpubIDCount(ctx context.Context, xPubID string
 }
 
 // GetDestinationByID will get a destination by id
+//
+// xPubID is the xPub ID (or the raw public xPub)
 func (c *Client) GetDestinationByID(ctx context.Context, xPubID, id string) (*Destination, error) {
 
 	// Check for existing NewRelic transaction
 	ctx = c.GetOrStartTxn(ctx, "get_destination_by_id")
 
+	xPubID, err := resolveXpubID(xPubID)
+	if err != nil {
+		return nil, err
+	}
+
 	// Get the destination
 	destination, err := getDestinationWithCache(
 		ctx, c, id, "", "", c.DefaultModelOptions()...,
@@ -194,11 +414,18 @@ func (c *Client) GetDestinationByID(ctx context.Context, xPubID, id string) (*De
 }
 
 // GetDestinationByLockingScript will get a destination for a locking script
+//
+// xPubID is the xPub ID (or the raw public xPub)
 func (c *Client) GetDestinationByLockingScript(ctx context.Context, xPubID, lockingScript string) (*Destination, error) {
 
 	// Check for existing NewRelic transaction
 	ctx = c.GetOrStartTxn(ctx, "get_destination_by_locking_script")
 
+	xPubID, err := resolveXpubID(xPubID)
+	if err != nil {
+		return nil, err
+	}
+
 	// Get the destination
 	destination, err := getDestinationWithCache(
 		ctx, c, "", "", lockingScript, c.DefaultModelOptions()...,
@@ -216,11 +443,18 @@ func (c *Client) GetDestinationByLockingScript(ctx context.Context, xPubID, lock
 }
 
 // GetDestinationByAddress will get a destination for an address
+//
+// xPubID is the xPub ID (or the raw public xPub)
 func (c *Client) GetDestinationByAddress(ctx context.Context, xPubID, address string) (*Destination, error) {
 
 	// Check for existing NewRelic transaction
 	ctx = c.GetOrStartTxn(ctx, "get_destination_by_address")
 
+	xPubID, err := resolveXpubID(xPubID)
+	if err != nil {
+		return nil, err
+	}
+
 	// Get the destination
 	destination, err := getDestinationWithCache(
 		ctx, c, "", address, "", c.DefaultModelOptions()...,
@@ -238,12 +472,19 @@ func (c *Client) GetDestinationByAddress(ctx context.Context, xPubID, address st
 }
 
 // UpdateDestinationMetadataByID will update the metadata in an existing destination by id
+//
+// xPubID is the xPub ID (or the raw public xPub)
 func (c *Client) UpdateDestinationMetadataByID(ctx context.Context, xPubID, id string,
 	metadata Metadata) (*Destination, error) {
 
 	// Check for existing NewRelic transaction
 	ctx = c.GetOrStartTxn(ctx, "update_destination_by_id")
 
+	xPubID, err := resolveXpubID(xPubID)
+	if err != nil {
+		return nil, err
+	}
+
 	// Get the destination
 	destination, err := c.GetDestinationByID(ctx, xPubID, id)
 	if err != nil {
@@ -251,8 +492,9 @@ func (c *Client) UpdateDestinationMetadataByID(ctx context.Context, xPubID, id s
 	}
 
 	// Update and save the model
+	entry := newAuditLog(ctx, AuditOperationUpdateMetadata, destination, c.DefaultModelOptions(New())...)
 	destination.UpdateMetadata(metadata)
-	if err = destination.Save(ctx); err != nil {
+	if err = saveWithAudit(ctx, destination, entry); err != nil {
 		return nil, err
 	}
 
@@ -260,12 +502,19 @@ func (c *Client) UpdateDestinationMetadataByID(ctx context.Context, xPubID, id s
 }
 
 // UpdateDestinationMetadataByLockingScript will update the metadata in an existing destination by locking script
+//
+// xPubID is the xPub ID (or the raw public xPub)
 func (c *Client) UpdateDestinationMetadataByLockingScript(ctx context.Context, xPubID,
 	lockingScript string, metadata Metadata) (*Destination, error) {
 
 	// Check for existing NewRelic transaction
 	ctx = c.GetOrStartTxn(ctx, "update_destination_by_locking_script")
 
+	xPubID, err := resolveXpubID(xPubID)
+	if err != nil {
+		return nil, err
+	}
+
 	// Get the destination
 	destination, err := c.GetDestinationByLockingScript(ctx, xPubID, lockingScript)
 	if err != nil {
@@ -273,8 +522,9 @@ func (c *Client) UpdateDestinationMetadataByLockingScript(ctx context.Context, x
 	}
 
 	// Update and save the metadata
+	entry := newAuditLog(ctx, AuditOperationUpdateMetadata, destination, c.DefaultModelOptions(New())...)
 	destination.UpdateMetadata(metadata)
-	if err = destination.Save(ctx); err != nil {
+	if err = saveWithAudit(ctx, destination, entry); err != nil {
 		return nil, err
 	}
 
@@ -282,12 +532,19 @@ func (c *Client) UpdateDestinationMetadataByLockingScript(ctx context.Context, x
 }
 
 // UpdateDestinationMetadataByAddress will update the metadata in an existing destination by address
+//
+// xPubID is the xPub ID (or the raw public xPub)
 func (c *Client) UpdateDestinationMetadataByAddress(ctx context.Context, xPubID, address string,
 	metadata Metadata) (*Destination, error) {
 
 	// Check for existing NewRelic transaction
 	ctx = c.GetOrStartTxn(ctx, "update_destination_by_address")
 
+	xPubID, err := resolveXpubID(xPubID)
+	if err != nil {
+		return nil, err
+	}
+
 	// Get the destination
 	destination, err := c.GetDestinationByAddress(ctx, xPubID, address)
 	if err != nil {
@@ -295,7 +552,74 @@ func (c *Client) UpdateDestinationMetadataByAddress(ctx context.Context, xPubID,
 	}
 
 	// Update and save the metadata
+	entry := newAuditLog(ctx, AuditOperationUpdateMetadata, destination, c.DefaultModelOptions(New())...)
 	destination.UpdateMetadata(metadata)
+	if err = saveWithAudit(ctx, destination, entry); err != nil {
+		return nil, err
+	}
+
+	return destination, nil
+}
+
+// RevokeDestination will revoke a destination (no new funds are accepted)
+//
+// Revoked destinations are never used for change or handed out by the paymail P2P endpoint,
+// incoming funds are still recorded (and notified using EventTypeRevokedDestinationPayment)
+//
+// xPubID is the xPub ID (or the raw public xPub)
+func (c *Client) RevokeDestination(ctx context.Context, xPubID, id string) (*Destination, error) {
+
+	// Check for existing NewRelic transaction
+	ctx = c.GetOrStartTxn(ctx, "revoke_destination")
+
+	xPubID, err := resolveXpubID(xPubID)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.setDestinationRevoked(ctx, xPubID, id, true)
+}
+
+// UnrevokeDestination will re-enable a revoked destination
+//
+// xPubID is the xPub ID (or the raw public xPub)
+func (c *Client) UnrevokeDestination(ctx context.Context, xPubID, id string) (*Destination, error) {
+
+	// Check for existing NewRelic transaction
+	ctx = c.GetOrStartTxn(ctx, "unrevoke_destination")
+
+	xPubID, err := resolveXpubID(xPubID)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.setDestinationRevoked(ctx, xPubID, id, false)
+}
+
+// setDestinationRevoked will set (or clear) the revoked flag of the destination
+func (c *Client) setDestinationRevoked(ctx context.Context, xPubID, id string, revoked bool) (*Destination, error) {
+
+	// Get the destination
+	destination, err := c.GetDestinationByID(ctx, xPubID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	// Nothing to change
+	if destination.IsRevoked() == revoked {
+		return destination, nil
+	}
+
+	if revoked {
+		destination.RevokedAt = customTypes.NullTime{NullTime: sql.NullTime{
+			Valid: true,
+			Time:  time.Now().UTC(),
+		}}
+	} else {
+		destination.RevokedAt = customTypes.NullTime{}
+	}
+
+	// Save the model
 	if err = destination.Save(ctx); err != nil {
 		return nil, err
 	}
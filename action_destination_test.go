@@ -2,9 +2,13 @@ package bux
 
 import (
 	"context"
+	"database/sql"
 	"testing"
+	"time"
 
 	"github.com/BuxOrg/bux/utils"
+	"github.com/bitcoin-sv/go-paymail"
+	customTypes "github.com/mrz1836/go-datastore/custom_types"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -389,3 +393,227 @@ func (ts *EmbeddedDBTestSuite) TestClient_UpdateDestinationMetadata() {
 		})
 	}
 }
+
+// TestClient_FixDestinationIndexCollisions will test the method FixDestinationIndexCollisions()
+func TestClient_FixDestinationIndexCollisions(t *testing.T) {
+	t.Parallel()
+
+	collidedLockingScript := "76a91447868e6b13de36e2739d8f2a9e0e0a323ad9b8ff88ac"
+
+	newCollidedDestination := func(client ClientInterface) *Destination {
+		destination := newDestination(testXPubID, collidedLockingScript, append(client.DefaultModelOptions(), New())...)
+		destination.Chain = utils.ChainExternal
+		destination.Num = 0
+		destination.FullDerivationPath = "m/0/0"
+		return destination
+	}
+
+	t.Run("unique index prevents collisions", func(t *testing.T) {
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, false, WithCustomTaskManager(&taskManagerMockBase{}))
+		defer deferMe()
+
+		_, err := client.NewXpub(ctx, testXPub, client.DefaultModelOptions()...)
+		require.NoError(t, err)
+		_, err = client.NewDestination(ctx, testXPub, utils.ChainExternal, utils.ScriptTypePubKeyHash, false)
+		require.NoError(t, err)
+
+		err = newCollidedDestination(client).Save(ctx)
+		require.Error(t, err)
+		assert.True(t, isUniqueConstraintError(err))
+	})
+
+	// Simulate an existing collision (created before the unique index)
+	newCollision := func(t *testing.T, ctx context.Context, client ClientInterface) (*Destination, *Destination) {
+		_, err := client.NewXpub(ctx, testXPub, client.DefaultModelOptions()...)
+		require.NoError(t, err)
+
+		var first *Destination
+		first, err = client.NewDestination(ctx, testXPub, utils.ChainExternal, utils.ScriptTypePubKeyHash, false)
+		require.NoError(t, err)
+		require.Equal(t, uint32(0), first.Num)
+
+		tableName := client.Datastore().GetTableName(tableDestinations)
+		tx := client.Datastore().Execute(`DROP INDEX IF EXISTS "idx_` + tableName + `_xpub_chain_num"`)
+		require.NoError(t, tx.Error)
+		collided := newCollidedDestination(client)
+		collided.Metadata = Metadata{"label": "collided"}
+		require.NoError(t, collided.Save(ctx))
+		return first, collided
+	}
+
+	t.Run("revoke and replace the collided destination", func(t *testing.T) {
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, false, WithCustomTaskManager(&taskManagerMockBase{}))
+		defer deferMe()
+
+		first, collided := newCollision(t, ctx, client)
+
+		corrections, err := client.FixDestinationIndexCollisions(ctx, testXPub)
+		require.NoError(t, err)
+		require.Len(t, corrections, 1)
+		assert.Equal(t, collided.ID, corrections[0].DestinationID)
+		assert.Equal(t, utils.ChainExternal, corrections[0].Chain)
+		assert.Equal(t, uint32(0), corrections[0].OldNum)
+		assert.Equal(t, uint32(1), corrections[0].NewNum)
+		assert.False(t, corrections[0].Funded)
+
+		// The replacement is derived at the new num
+		var derived *Destination
+		derived, err = newAddress(testXPub, utils.ChainExternal, 1, client.DefaultModelOptions()...)
+		require.NoError(t, err)
+		assert.Equal(t, derived.ID, corrections[0].NewDestinationID)
+
+		var replacement *Destination
+		replacement, err = getDestinationByID(ctx, derived.ID, client.DefaultModelOptions()...)
+		require.NoError(t, err)
+		require.NotNil(t, replacement)
+		assert.Equal(t, derived.LockingScript, replacement.LockingScript)
+		assert.Equal(t, "m/0/1", replacement.FullDerivationPath)
+		assert.Equal(t, "collided", replacement.Metadata["label"])
+
+		// The collided destination is revoked and detached, the derived destination keeps the index
+		var destination *Destination
+		destination, err = getDestinationByID(ctx, collided.ID, client.DefaultModelOptions()...)
+		require.NoError(t, err)
+		require.NotNil(t, destination)
+		assert.Equal(t, collidedLockingScript, destination.LockingScript)
+		assert.True(t, destination.IsRevoked())
+		assert.Empty(t, destination.FullDerivationPath)
+
+		destination, err = getDestinationByID(ctx, first.ID, client.DefaultModelOptions()...)
+		require.NoError(t, err)
+		assert.False(t, destination.IsRevoked())
+		assert.Equal(t, "m/0/0", destination.FullDerivationPath)
+
+		// Nothing left to fix, the unique index is created
+		corrections, err = client.FixDestinationIndexCollisions(ctx, testXPub)
+		require.NoError(t, err)
+		assert.Len(t, corrections, 0)
+
+		err = newCollidedDestination(client).Save(ctx)
+		require.Error(t, err)
+		assert.True(t, isUniqueConstraintError(err))
+	})
+
+	t.Run("funded destination is not moved", func(t *testing.T) {
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, false, WithCustomTaskManager(&taskManagerMockBase{}))
+		defer deferMe()
+
+		_, collided := newCollision(t, ctx, client)
+		utxo := newUtxo(testXPubID, testTxID, collidedLockingScript, 0, 1000, append(client.DefaultModelOptions(), New())...)
+		require.NoError(t, utxo.Save(ctx))
+
+		corrections, err := client.FixDestinationIndexCollisions(ctx, testXPub)
+		require.NoError(t, err)
+		require.Len(t, corrections, 1)
+		assert.True(t, corrections[0].Funded)
+		assert.Equal(t, collided.ID, corrections[0].DestinationID)
+
+		// The utxo stays on the collided destination
+		var got *Utxo
+		got, err = getUtxo(ctx, testTxID, 0, client.DefaultModelOptions()...)
+		require.NoError(t, err)
+		require.NotNil(t, got)
+		assert.Equal(t, collidedLockingScript, got.ScriptPubKey)
+	})
+
+	t.Run("missing xpub", func(t *testing.T) {
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, false, WithCustomTaskManager(&taskManagerMockBase{}))
+		defer deferMe()
+
+		_, err := client.FixDestinationIndexCollisions(ctx, testXPubID)
+		assert.ErrorIs(t, err, ErrMissingXpub)
+	})
+}
+
+// TestClient_RevokeDestination will test the methods RevokeDestination() and UnrevokeDestination()
+func TestClient_RevokeDestination(t *testing.T) {
+	t.Parallel()
+
+	t.Run("revoke and re-enable", func(t *testing.T) {
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, false, WithCustomTaskManager(&taskManagerMockBase{}))
+		defer deferMe()
+
+		_, err := client.NewXpub(ctx, testXPub, client.DefaultModelOptions()...)
+		require.NoError(t, err)
+
+		var destination *Destination
+		destination, err = client.NewDestination(ctx, testXPub, utils.ChainExternal, utils.ScriptTypePubKeyHash, false)
+		require.NoError(t, err)
+		assert.False(t, destination.IsRevoked())
+
+		destination, err = client.RevokeDestination(ctx, testXPubID, destination.ID)
+		require.NoError(t, err)
+		assert.True(t, destination.IsRevoked())
+
+		var revoked bool
+		revoked, err = isDestinationRevoked(ctx, destination.LockingScript, client.DefaultModelOptions()...)
+		require.NoError(t, err)
+		assert.True(t, revoked)
+
+		destination, err = client.UnrevokeDestination(ctx, testXPubID, destination.ID)
+		require.NoError(t, err)
+		assert.False(t, destination.IsRevoked())
+
+		revoked, err = isDestinationRevoked(ctx, destination.LockingScript, client.DefaultModelOptions()...)
+		require.NoError(t, err)
+		assert.False(t, revoked)
+	})
+
+	t.Run("revoked key is skipped by the paymail provider", func(t *testing.T) {
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, false,
+			WithCustomTaskManager(&taskManagerMockBase{}),
+			WithAutoMigrate(&PaymailAddress{}),
+		)
+		defer deferMe()
+
+		opts := client.DefaultModelOptions()
+		_, err := client.NewXpub(ctx, testXPub, opts...)
+		require.NoError(t, err)
+
+		var paymailAddress *PaymailAddress
+		paymailAddress, err = client.NewPaymailAddress(ctx, testXPub, testPaymail, testPublicName, testAvatar, opts...)
+		require.NoError(t, err)
+
+		// lockingScriptAt will return the locking script of the external key of the paymail
+		lockingScriptAt := func(num uint32) string {
+			externalXpub, keyErr := paymailAddress.GetExternalXpub()
+			require.NoError(t, keyErr)
+			pubKey, keyErr := deriveKey(externalXpub.String(), num)
+			require.NoError(t, keyErr)
+			lockingScript, keyErr := createLockingScript(pubKey.ecPubKey)
+			require.NoError(t, keyErr)
+			return lockingScript
+		}
+
+		// The next key of the paymail is revoked
+		revoked := newDestination(testXPubID, lockingScriptAt(0), append(opts, New())...)
+		revoked.Chain = utils.ChainExternal
+		revoked.RevokedAt = customTypes.NullTime{NullTime: sql.NullTime{Valid: true, Time: time.Now().UTC()}}
+		require.NoError(t, revoked.Save(ctx))
+
+		provider := &PaymailDefaultServiceProvider{client: client}
+		var payload *paymail.PaymentDestinationPayload
+		payload, err = provider.CreateP2PDestinationResponse(ctx, paymailAddress.Alias, paymailAddress.Domain, 1000, nil)
+		require.NoError(t, err)
+		require.Len(t, payload.Outputs, 1)
+		assert.Equal(t, lockingScriptAt(1), payload.Outputs[0].Script)
+	})
+
+	t.Run("xpub mismatch", func(t *testing.T) {
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, false, WithCustomTaskManager(&taskManagerMockBase{}))
+		defer deferMe()
+
+		_, err := client.NewXpub(ctx, testXPub, client.DefaultModelOptions()...)
+		require.NoError(t, err)
+
+		var destination *Destination
+		destination, err = client.NewDestination(ctx, testXPub, utils.ChainExternal, utils.ScriptTypePubKeyHash, false)
+		require.NoError(t, err)
+
+		_, err = client.RevokeDestination(ctx, utils.Hash("other-xpub"), destination.ID)
+		assert.ErrorIs(t, err, ErrXpubIDMisMatch)
+
+		_, err = client.RevokeDestination(ctx, "bad-xpub-id", destination.ID)
+		assert.ErrorIs(t, err, utils.ErrInvalidXpubReference)
+	})
+}
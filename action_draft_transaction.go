@@ -60,3 +60,31 @@ func (c *Client) GetDraftTransactionsCount(ctx context.Context, metadataConditio
 
 	return count, nil
 }
+
+// GetSigningInstructions will get the signing instructions (derivation paths, scripts, etc.) for a draft transaction
+//
+// The instructions are serializable and can be passed to an external signer (hardware or HSM)
+//
+// xPubID is the xPub ID (or the raw public xPub)
+func (c *Client) GetSigningInstructions(ctx context.Context, xPubID, draftID string) (*SigningInstructions, error) {
+
+	// Check for existing NewRelic transaction
+	ctx = c.GetOrStartTxn(ctx, "get_signing_instructions")
+
+	xPubID, err := resolveXpubID(xPubID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Get the draft transaction
+	draftTransaction, err := getDraftTransactionID(
+		ctx, xPubID, draftID, c.DefaultModelOptions()...,
+	)
+	if err != nil {
+		return nil, err
+	} else if draftTransaction == nil {
+		return nil, ErrDraftNotFound
+	}
+
+	return draftTransaction.getSigningInstructions(), nil
+}
@@ -0,0 +1,91 @@
+package bux
+
+import (
+	"context"
+	"time"
+
+	"github.com/BuxOrg/bux/notifications"
+	"github.com/mrz1836/go-datastore"
+)
+
+// GetNotificationDeliveries will get the delivery receipts of the notification events about a model (IE: a transaction)
+//
+// Every event has a stable ID (ULID) that is included in the webhook payload (event_id). The receipts are kept
+// for the notification retention (see WithNotificationRetention)
+func (c *Client) GetNotificationDeliveries(ctx context.Context, modelID string,
+	queryParams *datastore.QueryParams,
+) ([]*NotificationDelivery, error) {
+
+	// Check for existing NewRelic transaction
+	ctx = c.GetOrStartTxn(ctx, "get_notification_deliveries")
+
+	return getNotificationDeliveries(ctx, modelID, queryParams, c.DefaultModelOptions()...)
+}
+
+// GetDeadLetteredNotifications will get the notification events that exhausted the webhook retries (oldest first)
+//
+// The dead letters keep the delivered payload (see RedeliverNotification) and are kept for the dead letter
+// retention (see WithNotificationDeadLetterRetention)
+func (c *Client) GetDeadLetteredNotifications(ctx context.Context,
+	queryParams *datastore.QueryParams,
+) ([]*NotificationDelivery, error) {
+
+	// Check for existing NewRelic transaction
+	ctx = c.GetOrStartTxn(ctx, "get_dead_lettered_notifications")
+
+	return getDeadLetteredNotifications(ctx, queryParams, c.DefaultModelOptions()...)
+}
+
+// RedeliverNotification will deliver a dead-lettered notification event again (IE: after the receiver is fixed)
+//
+// A single attempt to the current webhook endpoint with the same payload (and event ID). The event stays
+// dead-lettered if the delivery fails again, the updated delivery receipt is returned in both cases
+func (c *Client) RedeliverNotification(ctx context.Context, eventID string) (*NotificationDelivery, error) {
+
+	// Check for existing NewRelic transaction
+	ctx = c.GetOrStartTxn(ctx, "redeliver_notification")
+
+	// Get the dead letter
+	delivery, err := getNotificationDeliveryByID(ctx, eventID, c.DefaultModelOptions()...)
+	if err != nil {
+		return nil, err
+	} else if delivery == nil {
+		return nil, ErrMissingNotificationDelivery
+	} else if !delivery.DeadLetteredAt.Valid || len(delivery.Payload) == 0 {
+		return nil, ErrNotificationNotDeadLettered
+	}
+
+	n := c.Notifications()
+	if n == nil {
+		return nil, notifications.ErrMissingEndpoint
+	}
+	return delivery, delivery.redeliver(ctx, n)
+}
+
+// MuteNotifications will mute the notifications of the xPub until the given time (IE: during a planned maintenance)
+//
+// The events are dropped or spooled for the delivery after the mute (see WithMutedNotificationsMode). The notifications
+// are unmuted automatically at expiry, the mute window is displayed on the xPub (notifications_muted_until).
+//
+// xPubID is the xPub ID (or the raw public xPub)
+func (c *Client) MuteNotifications(ctx context.Context, xPubID string, until time.Time) (*Xpub, error) {
+
+	// Check for existing NewRelic transaction
+	ctx = c.GetOrStartTxn(ctx, "mute_notifications")
+
+	if until.IsZero() {
+		return nil, ErrMissingMuteUntil
+	}
+	return muteNotifications(ctx, c, xPubID, until)
+}
+
+// UnmuteNotifications will unmute the notifications of the xPub (before the mute window expires)
+//
+// xPubID is the xPub ID (or the raw public xPub)
+func (c *Client) UnmuteNotifications(ctx context.Context, xPubID string) (*Xpub, error) {
+
+	// Check for existing NewRelic transaction
+	ctx = c.GetOrStartTxn(ctx, "unmute_notifications")
+
+	return muteNotifications(ctx, c, xPubID, time.Time{})
+}
@@ -2,11 +2,12 @@ package bux
 
 import (
 	"context"
-	"errors"
+	"database/sql"
 	"time"
 
 	"github.com/BuxOrg/bux/utils"
 	"github.com/mrz1836/go-datastore"
+	customTypes "github.com/mrz1836/go-datastore/custom_types"
 )
 
 // GetPaymailAddress will get a paymail address model
@@ -26,6 +27,17 @@ func (c *Client) GetPaymailAddress(ctx context.Context, address string, opts ...
 	return paymailAddress, nil
 }
 
+// GetPaymailAddressDisplay will get the paymail address filtered for display with the profile (see DisplayFor)
+func (c *Client) GetPaymailAddressDisplay(ctx context.Context, address, profile string,
+	opts ...ModelOps,
+) (interface{}, error) {
+	paymailAddress, err := c.GetPaymailAddress(ctx, address, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return paymailAddress.DisplayFor(profile), nil
+}
+
 // GetPaymailAddresses will get all the paymail addresses from the Datastore
 func (c *Client) GetPaymailAddresses(ctx context.Context, metadataConditions *Metadata,
 	conditions *map[string]interface{}, queryParams *datastore.QueryParams, opts ...ModelOps) ([]*PaymailAddress, error) {
@@ -64,13 +76,38 @@ func (c *Client) GetPaymailAddressesCount(ctx context.Context, metadataCondition
 	return count, nil
 }
 
+// GetPaymailAddressesPaged will get a page of paymail addresses and the total count of paymail addresses matching the conditions
+func (c *Client) GetPaymailAddressesPaged(ctx context.Context, metadataConditions *Metadata,
+	conditions *map[string]interface{}, queryParams *datastore.QueryParams, opts ...ModelOps,
+) (*PagedResult[*PaymailAddress], error) {
+	// Check for existing NewRelic transaction
+	ctx = c.GetOrStartTxn(ctx, "get_paymail_addresses_paged")
+
+	// Get the page and the total count using the same conditions
+	return getPagedResult(conditions, queryParams,
+		func(dbConditions *map[string]interface{}) ([]*PaymailAddress, error) {
+			return c.GetPaymailAddresses(ctx, metadataConditions, dbConditions, queryParams, opts...)
+		},
+		func(dbConditions *map[string]interface{}) (int64, error) {
+			return c.GetPaymailAddressesCount(ctx, metadataConditions, dbConditions, opts...)
+		},
+	)
+}
+
 // GetPaymailAddressesByXPubID will get all the paymail addresses for an xPubID from the Datastore
+//
+// xPubID is the xPub ID (or the raw public xPub)
 func (c *Client) GetPaymailAddressesByXPubID(ctx context.Context, xPubID string, metadataConditions *Metadata,
 	conditions *map[string]interface{}, queryParams *datastore.QueryParams) ([]*PaymailAddress, error) {
 
 	// Check for existing NewRelic transaction
 	ctx = c.GetOrStartTxn(ctx, "get_paymail_by_xpub")
 
+	xPubID, err := resolveXpubID(xPubID)
+	if err != nil {
+		return nil, err
+	}
+
 	if conditions == nil {
 		*conditions = make(map[string]interface{})
 	}
@@ -102,10 +139,20 @@ func (c *Client) NewPaymailAddress(ctx context.Context, xPubKey, address, public
 		return nil, err
 	}
 
-	// Check if the paymail address already exists
+	// Validate the alias (before it is normalized)
+	if err = c.validatePaymailAlias(address); err != nil {
+		return nil, err
+	}
+
+	// Validate the public profile fields
+	if publicName, err = c.validatePaymailProfile(ctx, publicName, avatar); err != nil {
+		return nil, err
+	}
+
+	// Check if the paymail address already exists (the alias is case-insensitive)
 	paymail, err := getPaymailAddress(ctx, address, opts...)
 	if paymail != nil {
-		return nil, errors.New("paymail address already exists")
+		return nil, ErrPaymailAddressExists
 	}
 	if err != nil {
 		return nil, err
@@ -124,10 +171,60 @@ func (c *Client) NewPaymailAddress(ctx context.Context, xPubKey, address, public
 	paymailAddress.Avatar = avatar
 	paymailAddress.PublicName = publicName
 
+	// Pending until the registrant proves the control of the xPub (see ActivatePaymailAddress)
+	if window := c.PaymailActivationWindow(); window > 0 {
+		if paymailAddress.ActivationChallenge, err = utils.RandomHex(32); err != nil {
+			return nil, err
+		}
+		paymailAddress.ActivationExpiresAt = customTypes.NullTime{NullTime: sql.NullTime{
+			Time:  time.Now().UTC().Add(window),
+			Valid: true,
+		}}
+	}
+
+	// Save the model
+	if err = paymailAddress.Save(ctx); err != nil {
+		return nil, err
+	}
+	return paymailAddress, nil
+}
+
+// ActivatePaymailAddress will activate a pending paymail address (see WithPaymailActivation)
+//
+// The signature is the Bitcoin Signed Message of the activation challenge by the identity key of the paymail
+// (the key served by the PKI, derived from the registered xPub)
+func (c *Client) ActivatePaymailAddress(ctx context.Context, address, signature string,
+	opts ...ModelOps) (*PaymailAddress, error) {
+
+	// Check for existing NewRelic transaction
+	ctx = c.GetOrStartTxn(ctx, "activate_paymail_address")
+
+	// Get the paymail address
+	paymailAddress, err := getPaymailAddress(ctx, address, append(opts, c.DefaultModelOptions()...)...)
+	if err != nil {
+		return nil, err
+	} else if paymailAddress == nil {
+		return nil, ErrMissingPaymail
+	} else if !paymailAddress.IsPending() {
+		return nil, ErrPaymailNotPending
+	} else if paymailAddress.ActivationExpiresAt.Valid && time.Now().UTC().After(paymailAddress.ActivationExpiresAt.Time) {
+		return nil, ErrPaymailActivationExpired
+	}
+
+	// Verify the signature of the challenge
+	if err = paymailAddress.verifyActivation(signature); err != nil {
+		return nil, err
+	}
+
+	// Activate the paymail
+	paymailAddress.ActivationChallenge = ""
+	paymailAddress.ActivationExpiresAt.Valid = false
+
 	// Save the model
 	if err = paymailAddress.Save(ctx); err != nil {
 		return nil, err
 	}
+
 	return paymailAddress, nil
 }
 
@@ -145,21 +242,14 @@ func (c *Client) DeletePaymailAddress(ctx context.Context, address string, opts
 		return ErrMissingPaymail
 	}
 
-	// todo: make a better approach for deleting paymail addresses?
-	var randomString string
-	if randomString, err = utils.RandomHex(16); err != nil {
+	// Audit the deletion (the state before the change)
+	entry := newAuditLog(ctx, AuditOperationDeletePaymail, paymailAddress, c.DefaultModelOptions(New())...)
+
+	if err = paymailAddress.softDelete(); err != nil {
 		return err
 	}
 
-	// We will do a soft delete to make sure we still have the history for this address
-	// setting the Domain to a random string solved the problem of the unique index on Alias/Domain
-	// todo: figure out a different approach - history table?
-	paymailAddress.Alias = paymailAddress.Alias + "@" + paymailAddress.Domain
-	paymailAddress.Domain = randomString
-	paymailAddress.DeletedAt.Valid = true
-	paymailAddress.DeletedAt.Time = time.Now()
-
-	return paymailAddress.Save(ctx)
+	return saveWithAudit(ctx, paymailAddress, entry)
 }
 
 // UpdatePaymailAddressMetadata will update the metadata in an existing paymail address
@@ -178,10 +268,11 @@ func (c *Client) UpdatePaymailAddressMetadata(ctx context.Context, address strin
 	}
 
 	// Update the metadata
+	entry := newAuditLog(ctx, AuditOperationUpdateMetadata, paymailAddress, c.DefaultModelOptions(New())...)
 	paymailAddress.UpdateMetadata(metadata)
 
-	// Save the model
-	if err = paymailAddress.Save(ctx); err != nil {
+	// Save the model (and the audit entry)
+	if err = saveWithAudit(ctx, paymailAddress, entry); err != nil {
 		return nil, err
 	}
 
@@ -203,6 +294,11 @@ func (c *Client) UpdatePaymailAddress(ctx context.Context, address, publicName,
 		return nil, ErrMissingPaymail
 	}
 
+	// Validate the public profile fields
+	if publicName, err = c.validatePaymailProfile(ctx, publicName, avatar); err != nil {
+		return nil, err
+	}
+
 	// Update the public name
 	if paymailAddress.PublicName != publicName {
 		paymailAddress.PublicName = publicName
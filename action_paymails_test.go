@@ -1,8 +1,15 @@
 package bux
 
 import (
+	"context"
+	"encoding/hex"
 	"testing"
+	"time"
 
+	"github.com/BuxOrg/bux/utils"
+	"github.com/bitcoinschema/go-bitcoin/v2"
+	"github.com/libsv/go-bk/bec"
+	"github.com/libsv/go-bk/bip32"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -213,3 +220,117 @@ func (ts *EmbeddedDBTestSuite) TestClient_UpdatePaymailAddress() {
 		})
 	}
 }
+
+// TestClient_ActivatePaymailAddress will test the method ActivatePaymailAddress() and the pending paymails
+func TestClient_ActivatePaymailAddress(t *testing.T) {
+	t.Parallel()
+
+	newPending := func(t *testing.T, window time.Duration) (context.Context, ClientInterface, *Fixtures,
+		*PaymailAddress) {
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, true,
+			WithCustomTaskManager(&taskManagerMockBase{}),
+			WithAutoMigrate(&PaymailAddress{}),
+			WithPaymailActivation(window),
+		)
+		t.Cleanup(deferMe)
+
+		fixtures := NewFixtures(t, client).WithXpub(0)
+		paymailAddress, err := client.NewPaymailAddress(
+			ctx, fixtures.RawXpub, testPaymail, testPublicName, testAvatar, client.DefaultModelOptions()...,
+		)
+		require.NoError(t, err)
+		require.True(t, paymailAddress.IsPending())
+		assert.Len(t, paymailAddress.ActivationChallenge, 64)
+		assert.True(t, paymailAddress.ActivationExpiresAt.Valid)
+		return ctx, client, fixtures, paymailAddress
+	}
+
+	// signChallenge will sign the challenge with the identity key of the paymail (derived from the xPriv)
+	signChallenge := func(t *testing.T, hdKey *bip32.ExtendedKey, challenge string) string {
+		external, err := bitcoin.GetHDKeyChild(hdKey, utils.ChainExternal)
+		require.NoError(t, err)
+		var identity *bip32.ExtendedKey
+		identity, err = bitcoin.GetHDKeyChild(external, uint32(utils.MaxInt32))
+		require.NoError(t, err)
+		var privateKey *bec.PrivateKey
+		privateKey, err = bitcoin.GetPrivateKeyFromHDKey(identity)
+		require.NoError(t, err)
+		var signature string
+		signature, err = bitcoin.SignMessage(hex.EncodeToString(privateKey.Serialise()), challenge, true)
+		require.NoError(t, err)
+		return signature
+	}
+
+	t.Run("valid signature", func(t *testing.T) {
+		ctx, client, fixtures, paymailAddress := newPending(t, time.Hour)
+		provider := &PaymailDefaultServiceProvider{client: client}
+
+		// Pending paymails are not served
+		information, err := provider.GetPaymailByAlias(ctx, paymailAddress.Alias, paymailAddress.Domain, nil)
+		require.NoError(t, err)
+		assert.Nil(t, information)
+		_, err = provider.CreateP2PDestinationResponse(ctx, paymailAddress.Alias, paymailAddress.Domain, 1000, nil)
+		require.ErrorIs(t, err, ErrMissingPaymail)
+
+		// Signed by another key
+		other, err := bitcoin.GenerateHDKey(bitcoin.SecureSeedLength)
+		require.NoError(t, err)
+		_, err = client.ActivatePaymailAddress(
+			ctx, testPaymail, signChallenge(t, other, paymailAddress.ActivationChallenge),
+		)
+		require.ErrorIs(t, err, ErrPaymailActivationSignatureInvalid)
+
+		var activated *PaymailAddress
+		activated, err = client.ActivatePaymailAddress(
+			ctx, testPaymail, signChallenge(t, fixtures.HDKey, paymailAddress.ActivationChallenge),
+		)
+		require.NoError(t, err)
+		assert.False(t, activated.IsPending())
+		assert.False(t, activated.ActivationExpiresAt.Valid)
+
+		information, err = provider.GetPaymailByAlias(ctx, paymailAddress.Alias, paymailAddress.Domain, nil)
+		require.NoError(t, err)
+		require.NotNil(t, information)
+		assert.Equal(t, paymailAddress.Alias, information.Alias)
+
+		_, err = client.ActivatePaymailAddress(ctx, testPaymail, "signature")
+		require.ErrorIs(t, err, ErrPaymailNotPending)
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		ctx, client, fixtures, paymailAddress := newPending(t, time.Millisecond)
+		time.Sleep(10 * time.Millisecond)
+
+		_, err := client.ActivatePaymailAddress(
+			ctx, testPaymail, signChallenge(t, fixtures.HDKey, paymailAddress.ActivationChallenge),
+		)
+		require.ErrorIs(t, err, ErrPaymailActivationExpired)
+
+		// The pending paymail is deleted (the alias is released)
+		require.NoError(t, taskCleanupPendingPaymails(ctx, client.Logger(), client.DefaultModelOptions()...))
+		_, err = client.GetPaymailAddress(ctx, testPaymail)
+		require.ErrorIs(t, err, ErrMissingPaymail)
+		_, err = client.NewPaymailAddress(
+			ctx, fixtures.RawXpub, testPaymail, testPublicName, testAvatar, client.DefaultModelOptions()...,
+		)
+		require.NoError(t, err)
+	})
+
+	t.Run("activation disabled", func(t *testing.T) {
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, true,
+			WithCustomTaskManager(&taskManagerMockBase{}),
+			WithAutoMigrate(&PaymailAddress{}),
+		)
+		defer deferMe()
+
+		fixtures := NewFixtures(t, client).WithXpub(0)
+		paymailAddress, err := client.NewPaymailAddress(
+			ctx, fixtures.RawXpub, testPaymail, testPublicName, testAvatar, client.DefaultModelOptions()...,
+		)
+		require.NoError(t, err)
+		assert.False(t, paymailAddress.IsPending())
+
+		_, err = client.ActivatePaymailAddress(ctx, testPaymail, "signature")
+		require.ErrorIs(t, err, ErrPaymailNotPending)
+	})
+}
@@ -0,0 +1,183 @@
+package bux
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/BuxOrg/bux/utils"
+)
+
+// recordTransactionsBatchSize is the number of transactions recorded between the checks of the context
+const recordTransactionsBatchSize = 100
+
+// RecordTransactionResult is the result of one of the transactions given to RecordTransactions
+type RecordTransactionResult struct {
+	Error       error        `json:"-"`           // The transaction was not recorded
+	Index       int          `json:"index"`       // Position of the hex in the request
+	Transaction *Transaction `json:"transaction"` // Recorded transaction (nil on error)
+	TxID        string       `json:"tx_id"`       // ID of the transaction (empty if the hex is invalid)
+}
+
+// RecordTransactions will record already signed (historical) transactions of the xPub, IE: a migration from another wallet
+//
+// The transactions are recorded in dependency order (parents before children), regardless of the order of hexes.
+// Every hex has a result (same order as the hexes), a transaction that fails does not stop the others -
+// except for its children in the same request (ErrParentTransactionNotRecorded).
+// Already recorded transactions are returned as recorded.
+//
+// The transactions are not broadcast and not sent to paymail providers, only synced on-chain
+// (override using the WithSyncConfig() option)
+//
+// xPubKey is the raw public xPub
+// hexes are the raw transaction hexes
+// opts are model options and can include "metadata"
+func (c *Client) RecordTransactions(ctx context.Context, xPubKey string, hexes []string,
+	opts ...ModelOps,
+) ([]*RecordTransactionResult, error) {
+	// Check for existing NewRelic transaction
+	ctx = c.GetOrStartTxn(ctx, "record_transactions")
+
+	// The xPub must exist
+	if _, err := utils.ValidateXPub(xPubKey); err != nil {
+		return nil, err
+	}
+	xPub, err := getXpubByID(ctx, utils.Hash(xPubKey), c.DefaultModelOptions()...)
+	if err != nil {
+		return nil, err
+	} else if xPub == nil {
+		return nil, ErrMissingXpub
+	}
+
+	// Parse & validate the transactions
+	newOpts := c.DefaultModelOptions(append(opts, WithXPub(xPubKey), New())...)
+	results := make([]*RecordTransactionResult, len(hexes))
+	resultByID := make(map[string]*RecordTransactionResult, len(hexes))
+	transactions := make([]*Transaction, 0, len(hexes))
+	for index, txHex := range hexes {
+		result := &RecordTransactionResult{Index: index}
+		results[index] = result
+
+		transaction := newTransaction(txHex, newOpts...)
+		if len(txHex) == 0 {
+			result.Error = ErrMissingTxHex
+			continue
+		} else if result.Error = transaction.setID(); result.Error != nil {
+			continue
+		}
+		result.TxID = transaction.ID
+		if _, ok := resultByID[transaction.ID]; ok {
+			result.Error = ErrDuplicateTransactionHex
+			continue
+		}
+		transaction.historical = true
+		resultByID[transaction.ID] = result
+		transactions = append(transactions, transaction)
+	}
+
+	// Record the parents first
+	if transactions, err = kahnTopologicalSortTransactions(transactions); err != nil {
+		return nil, err
+	}
+	syncConfig := NewBaseModel(ModelNameEmpty, newOpts...).syncConfig
+	for start := 0; start < len(transactions); start += recordTransactionsBatchSize {
+		end := start + recordTransactionsBatchSize
+		if end > len(transactions) {
+			end = len(transactions)
+		}
+
+		// Stop between the batches if the context was canceled (the rest is not recorded)
+		if err = ctx.Err(); err != nil {
+			for _, transaction := range transactions[start:] {
+				resultByID[transaction.ID].Error = err
+			}
+			break
+		}
+		c.recordHistoricalBatch(ctx, xPub.ID, transactions[start:end], resultByID, syncConfig)
+	}
+
+	return results, nil
+}
+
+// recordHistoricalBatch will lock the batch of transactions, load the already recorded ones (one query)
+// and record the others
+func (c *Client) recordHistoricalBatch(ctx context.Context, xPubID string, transactions []*Transaction,
+	resultByID map[string]*RecordTransactionResult, syncConfig *SyncConfig,
+) {
+	// Create the locks and set the release for after the batch completes
+	ids := make([]string, 0, len(transactions))
+	for _, transaction := range transactions {
+		unlock, err := newWriteLock(
+			ctx, fmt.Sprintf(lockKeyRecordTx, transaction.ID), c.Cachestore(),
+		)
+		defer unlock()
+		if err != nil {
+			resultByID[transaction.ID].Error = err
+			continue
+		}
+		ids = append(ids, transaction.ID)
+	}
+
+	// Already recorded (IE: a repeated migration)
+	existing, err := getTransactionsByIDs(ctx, ids, c.DefaultModelOptions()...)
+	for _, transaction := range transactions {
+		result := resultByID[transaction.ID]
+		if result.Error != nil {
+			continue
+		} else if err != nil {
+			result.Error = err
+			continue
+		}
+
+		// A child can only be recorded if the parents (in the request) were recorded
+		for _, input := range sortableInputs(transaction) {
+			if parent, ok := resultByID[input.TransactionID]; ok && parent.Error != nil {
+				result.Error = ErrParentTransactionNotRecorded
+				break
+			}
+		}
+		if result.Error != nil {
+			continue
+		} else if result.Transaction = existing[transaction.ID]; result.Transaction == nil {
+			result.Transaction, result.Error = c.recordHistoricalTransaction(ctx, xPubID, transaction, syncConfig)
+		}
+	}
+}
+
+// recordHistoricalTransaction will record the transaction of the xPub with its sync transaction (one datastore
+// transaction, the caller holds the lock)
+func (c *Client) recordHistoricalTransaction(ctx context.Context, xPubID string, transaction *Transaction,
+	syncConfig *SyncConfig,
+) (*Transaction, error) {
+
+	// The transaction must spend or pay to the xPub
+	err := transaction.BeforeCreating(ctx)
+	if err != nil {
+		return nil, err
+	} else if !utils.StringInSlice(xPubID, transaction.XpubInIDs) &&
+		!utils.StringInSlice(xPubID, transaction.XpubOutIDs) {
+		return nil, ErrTransactionUnknown
+	}
+
+	// Historical transactions are only synced (already broadcast)
+	if syncConfig == nil {
+		syncConfig = &SyncConfig{SyncOnChain: true}
+	}
+	if _, err = GetSyncTransactionByID(ctx, transaction.ID, c.DefaultModelOptions()...); err != nil {
+		if !errors.Is(err, ErrSyncTransactionNotFound) {
+			return nil, err
+		}
+		sync := newSyncTransaction(transaction.ID, syncConfig, transaction.GetOptions(true)...)
+		sync.Metadata = transaction.Metadata
+
+		// If all the options are skipped, do not make a new model (ignore the record)
+		if !sync.isSkipped() {
+			transaction.syncTransaction = sync
+		}
+	}
+
+	if err = transaction.Save(ctx); err != nil {
+		return nil, err
+	}
+	return transaction, nil
+}
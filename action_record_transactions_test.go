@@ -0,0 +1,132 @@
+package bux
+
+import (
+	"context"
+	"testing"
+
+	"github.com/BuxOrg/bux/utils"
+	"github.com/libsv/go-bt/v2"
+	"github.com/libsv/go-bt/v2/bscript"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// spendingTxHex will return the hex of a (unsigned) transaction spending the output and paying the satoshis to the locking script
+func spendingTxHex(t *testing.T, prevTxID string, prevIndex uint32, prevScript string, prevSatoshis uint64,
+	lockingScript string, satoshis uint64,
+) string {
+	tx := bt.NewTx()
+	require.NoError(t, tx.From(prevTxID, prevIndex, prevScript, prevSatoshis))
+	script, err := bscript.NewFromHexString(lockingScript)
+	require.NoError(t, err)
+	tx.AddOutput(&bt.Output{LockingScript: script, Satoshis: satoshis})
+	return tx.String()
+}
+
+// TestClient_RecordTransactions will test the method RecordTransactions()
+func TestClient_RecordTransactions(t *testing.T) {
+	t.Parallel()
+
+	newClient := func(t *testing.T) (context.Context, ClientInterface, *Fixtures, func()) {
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, true, WithCustomTaskManager(&taskManagerMockBase{}))
+		return ctx, client, NewFixtures(t, client).WithXpub(0).WithUtxos(10000), deferMe
+	}
+
+	t.Run("recorded in dependency order", func(t *testing.T) {
+		ctx, client, fixtures, deferMe := newClient(t)
+		defer deferMe()
+
+		lockingScript := fixtures.Destinations[0].LockingScript
+		parentHex := spendingTxHex(t, fixtures.Utxos[0].TransactionID, 0, lockingScript, 10000, lockingScript, 9000)
+		parentID, err := utils.GetTransactionIDFromHex(parentHex)
+		require.NoError(t, err)
+		childHex := spendingTxHex(t, parentID, 0, lockingScript, 9000, testLockingScript, 8000)
+		unknownHex := spendingTxHex(t, testTxID, 0, testLockingScript, 10000, testLockingScript, 9000)
+
+		// Children first
+		results, err := client.RecordTransactions(ctx, fixtures.RawXpub, []string{
+			childHex, parentHex, "", "not-a-tx", parentHex, unknownHex,
+		})
+		require.NoError(t, err)
+		require.Len(t, results, 6)
+		for index, result := range results {
+			assert.Equal(t, index, result.Index)
+		}
+
+		require.NoError(t, results[0].Error)
+		require.NoError(t, results[1].Error)
+		assert.Equal(t, parentID, results[1].TxID)
+		assert.Equal(t, parentID, results[1].Transaction.ID)
+		assert.ErrorIs(t, results[2].Error, ErrMissingTxHex)
+		assert.Error(t, results[3].Error)
+		assert.ErrorIs(t, results[4].Error, ErrDuplicateTransactionHex)
+		assert.ErrorIs(t, results[5].Error, ErrTransactionUnknown)
+		assert.Nil(t, results[5].Transaction)
+
+		// The utxos are spent in order
+		utxo, err := client.GetUtxoByTransactionID(ctx, fixtures.Utxos[0].TransactionID, 0)
+		require.NoError(t, err)
+		assert.Equal(t, parentID, utxo.SpendingTxID.String)
+		utxo, err = client.GetUtxoByTransactionID(ctx, parentID, 0)
+		require.NoError(t, err)
+		assert.Equal(t, results[0].TxID, utxo.SpendingTxID.String)
+
+		xPub, err := getXpubByID(ctx, fixtures.Xpub.ID, client.DefaultModelOptions()...)
+		require.NoError(t, err)
+		assert.Equal(t, uint64(0), xPub.CurrentBalance)
+
+		// Historical: not broadcast, only synced
+		sync, err := GetSyncTransactionByID(ctx, parentID, client.DefaultModelOptions()...)
+		require.NoError(t, err)
+		assert.Equal(t, SyncStatusSkipped, sync.BroadcastStatus)
+		assert.Equal(t, SyncStatusSkipped, sync.P2PStatus)
+		assert.Equal(t, SyncStatusReady, sync.SyncStatus)
+
+		// Repeated
+		results, err = client.RecordTransactions(ctx, fixtures.RawXpub, []string{parentHex})
+		require.NoError(t, err)
+		require.NoError(t, results[0].Error)
+		assert.Equal(t, parentID, results[0].Transaction.ID)
+	})
+
+	t.Run("parent not recorded", func(t *testing.T) {
+		ctx, client, fixtures, deferMe := newClient(t)
+		defer deferMe()
+
+		parentHex := spendingTxHex(t, testTxID, 0, testLockingScript, 10000, testLockingScript, 9000)
+		parentID, err := utils.GetTransactionIDFromHex(parentHex)
+		require.NoError(t, err)
+		childHex := spendingTxHex(t, parentID, 0, testLockingScript, 9000, fixtures.Destinations[0].LockingScript, 8000)
+
+		results, err := client.RecordTransactions(ctx, fixtures.RawXpub, []string{childHex, parentHex})
+		require.NoError(t, err)
+		assert.ErrorIs(t, results[0].Error, ErrParentTransactionNotRecorded)
+		assert.ErrorIs(t, results[1].Error, ErrTransactionUnknown)
+	})
+
+	t.Run("sync config option", func(t *testing.T) {
+		ctx, client, fixtures, deferMe := newClient(t)
+		defer deferMe()
+
+		lockingScript := fixtures.Destinations[0].LockingScript
+		txHex := spendingTxHex(t, fixtures.Utxos[0].TransactionID, 0, lockingScript, 10000, testLockingScript, 9000)
+
+		results, err := client.RecordTransactions(ctx, fixtures.RawXpub, []string{txHex},
+			WithSyncConfig(&SyncConfig{Broadcast: true, SyncOnChain: true}),
+		)
+		require.NoError(t, err)
+		require.NoError(t, results[0].Error)
+
+		sync, err := GetSyncTransactionByID(ctx, results[0].TxID, client.DefaultModelOptions()...)
+		require.NoError(t, err)
+		assert.Equal(t, SyncStatusReady, sync.BroadcastStatus)
+	})
+
+	t.Run("unknown xpub", func(t *testing.T) {
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, true, WithCustomTaskManager(&taskManagerMockBase{}))
+		defer deferMe()
+
+		_, err := client.RecordTransactions(ctx, testXPub, nil)
+		assert.ErrorIs(t, err, ErrMissingXpub)
+	})
+}
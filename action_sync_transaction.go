@@ -0,0 +1,377 @@
+package bux
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/libsv/go-bt/v2"
+	"github.com/mrz1836/go-datastore"
+)
+
+// SyncConfigChanges are the toggles of the sync configuration of a recorded transaction (nil = unchanged)
+type SyncConfigChanges struct {
+	Broadcast   *bool `json:"broadcast,omitempty"`     // Transaction should be broadcasted
+	PaymailP2P  *bool `json:"paymail_p2p,omitempty"`   // Transaction will be sent to the related paymail providers
+	SyncOnChain *bool `json:"sync_on_chain,omitempty"` // Transaction should be checked that it's on-chain
+}
+
+// UpdateSyncTransactionConfig will change the sync configuration of a recorded transaction
+//
+// Turning off an action skips it (Pending, Ready or Error become Skipped), an action that already ran is never
+// touched. Re-enabling a skipped action makes it ready again, re-enabling a completed action returns
+// ErrSyncActionComplete. The change is documented in the sync results.
+func (c *Client) UpdateSyncTransactionConfig(ctx context.Context, txID string,
+	changes *SyncConfigChanges,
+) (*SyncTransaction, error) {
+
+	// Check for existing NewRelic transaction
+	ctx = c.GetOrStartTxn(ctx, "update_sync_transaction_config")
+
+	// Wait for the processing of the record (broadcast, p2p and sync) to finish
+	for _, lockKey := range []string{lockKeyProcessBroadcastTx, lockKeyProcessP2PTx, lockKeyProcessSyncTx} {
+		unlock, err := newWaitWriteLock(ctx, fmt.Sprintf(lockKey, txID), c.Cachestore())
+		defer unlock()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Get the sync transaction (after the locks, the record is current)
+	syncTx, err := GetSyncTransactionByID(ctx, txID, c.DefaultModelOptions()...)
+	if err != nil {
+		return nil, err
+	} else if changes == nil {
+		return syncTx, nil
+	}
+
+	// Validate all the changes before changing the record
+	config := syncTx.Configuration
+	broadcastStatus, p2pStatus, syncStatus := syncTx.BroadcastStatus, syncTx.P2PStatus, syncTx.SyncStatus
+	var messages []string
+	if changes.Broadcast != nil {
+		config.Broadcast = *changes.Broadcast
+		if broadcastStatus, err = toggleSyncStatus(
+			syncTx.BroadcastStatus, config.Broadcast, SyncStatusReady,
+		); err != nil {
+			return nil, fmt.Errorf("%w: %s", err, syncActionBroadcast)
+		}
+		messages = append(messages, fmt.Sprintf("broadcast=%t", config.Broadcast))
+	}
+	if changes.PaymailP2P != nil {
+		config.PaymailP2P = *changes.PaymailP2P
+
+		// P2P waits for the broadcast (if the transaction will be broadcast)
+		enabledStatus := SyncStatusPending
+		if broadcastStatus == SyncStatusSeen || broadcastStatus == SyncStatusComplete ||
+			broadcastStatus == SyncStatusSkipped {
+			enabledStatus = SyncStatusReady
+		}
+		if p2pStatus, err = toggleSyncStatus(
+			syncTx.P2PStatus, config.PaymailP2P, enabledStatus,
+		); err != nil {
+			return nil, fmt.Errorf("%w: %s", err, syncActionP2P)
+		}
+		messages = append(messages, fmt.Sprintf("paymail_p2p=%t", config.PaymailP2P))
+	}
+	if changes.SyncOnChain != nil {
+		config.SyncOnChain = *changes.SyncOnChain
+		if syncStatus, err = toggleSyncStatus(
+			syncTx.SyncStatus, config.SyncOnChain, SyncStatusReady,
+		); err != nil {
+			return nil, fmt.Errorf("%w: %s", err, syncActionSync)
+		}
+		messages = append(messages, fmt.Sprintf("sync_on_chain=%t", config.SyncOnChain))
+	}
+	if len(messages) == 0 {
+		return syncTx, nil
+	}
+
+	// P2P waiting for a broadcast that is turned off would never run
+	if broadcastStatus == SyncStatusSkipped && p2pStatus == SyncStatusPending {
+		p2pStatus = SyncStatusReady
+	}
+
+	// Update the sync information
+	message := "configuration changed: " + strings.Join(messages, ", ")
+	syncTx.Configuration = config
+	syncTx.BroadcastStatus = broadcastStatus
+	syncTx.P2PStatus = p2pStatus
+	syncTx.SyncStatus = syncStatus
+	syncTx.Results.LastMessage = message
+	addManualSyncResult(syncTx, syncActionConfig, message)
+
+	if err = syncTx.Save(ctx); err != nil {
+		return nil, err
+	}
+	return syncTx, nil
+}
+
+// GetBroadcastReceipts will get the receipts (provider response envelopes) of the broadcasts of the transaction (admin)
+//
+// The mAPI receipts are signed by the miner, use VerifyBroadcastReceipt to check the proof of submission
+func (c *Client) GetBroadcastReceipts(ctx context.Context, txID string) ([]*BroadcastReceipt, error) {
+
+	// Check for existing NewRelic transaction
+	ctx = c.GetOrStartTxn(ctx, "get_broadcast_receipts")
+
+	return getBroadcastReceipts(ctx, txID, c.DefaultModelOptions()...)
+}
+
+// GetSyncTransactionsPaged will get a page of sync transactions and the total count matching the conditions (admin)
+func (c *Client) GetSyncTransactionsPaged(ctx context.Context, conditions *map[string]interface{},
+	queryParams *datastore.QueryParams,
+) (*PagedResult[*SyncTransaction], error) {
+
+	// Check for existing NewRelic transaction
+	ctx = c.GetOrStartTxn(ctx, "get_sync_transactions_paged")
+
+	// Get the page and the total count using the same conditions
+	opts := c.DefaultModelOptions()
+	return getPagedResult(conditions, queryParams,
+		func(dbConditions *map[string]interface{}) ([]*SyncTransaction, error) {
+			if dbConditions == nil {
+				dbConditions = &map[string]interface{}{}
+			}
+			return getSyncTransactionsByConditions(ctx, *dbConditions, queryParams, opts...)
+		},
+		func(dbConditions *map[string]interface{}) (int64, error) {
+			return getModelCountByConditions(
+				ctx, ModelSyncTransaction, SyncTransaction{}, nil, dbConditions, opts...,
+			)
+		},
+	)
+}
+
+// RequeueSyncTransaction will make the errored actions (broadcast, p2p or sync) of a sync transaction ready again
+//
+// Returns ErrSyncTransactionNotErrored if no action is in the error status. The requeue is documented in
+// the sync results.
+func (c *Client) RequeueSyncTransaction(ctx context.Context, txID string) (*SyncTransaction, error) {
+
+	// Check for existing NewRelic transaction
+	ctx = c.GetOrStartTxn(ctx, "requeue_sync_transaction")
+
+	// Wait for the processing of the record (broadcast, p2p and sync) to finish
+	for _, lockKey := range []string{lockKeyProcessBroadcastTx, lockKeyProcessP2PTx, lockKeyProcessSyncTx} {
+		unlock, err := newWaitWriteLock(ctx, fmt.Sprintf(lockKey, txID), c.Cachestore())
+		defer unlock()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Get the sync transaction (after the locks, the record is current)
+	syncTx, err := GetSyncTransactionByID(ctx, txID, c.DefaultModelOptions()...)
+	if err != nil {
+		return nil, err
+	}
+
+	entry := newAuditLog(ctx, AuditOperationRequeueSync, syncTx, c.DefaultModelOptions(New())...)
+	var actions []string
+	if syncTx.BroadcastStatus == SyncStatusError {
+		syncTx.BroadcastStatus = SyncStatusReady
+		actions = append(actions, syncActionBroadcast)
+	}
+	if syncTx.P2PStatus == SyncStatusError {
+
+		// P2P waits for the broadcast (if the transaction will be broadcast)
+		syncTx.P2PStatus = SyncStatusPending
+		if syncTx.BroadcastStatus == SyncStatusSeen || syncTx.BroadcastStatus == SyncStatusComplete ||
+			syncTx.BroadcastStatus == SyncStatusSkipped {
+			syncTx.P2PStatus = SyncStatusReady
+		}
+		actions = append(actions, syncActionP2P)
+	}
+	if syncTx.SyncStatus == SyncStatusError {
+		syncTx.SyncStatus = SyncStatusReady
+		actions = append(actions, syncActionSync)
+	}
+	if len(actions) == 0 {
+		return nil, ErrSyncTransactionNotErrored
+	}
+
+	message := "requeued: " + strings.Join(actions, ", ")
+	syncTx.Results.LastMessage = message
+	addManualSyncResult(syncTx, syncActionRequeue, message)
+
+	if err = saveWithAudit(ctx, syncTx, entry); err != nil {
+		return nil, err
+	}
+	return syncTx, nil
+}
+
+// CompleteSyncWithProof will complete the sync of a transaction using a merkle proof from an external source (admin)
+//
+// For the transactions confirmed on-chain that the providers keep returning as not found. The proof is validated
+// against the stored block header (ErrMissingBlockHeader until the header is synced), an invalid proof is rejected
+// before anything is changed. The source (IE: a block explorer) is documented in the sync results.
+func (c *Client) CompleteSyncWithProof(ctx context.Context, txID, blockHash string, blockHeight uint64,
+	proof *MerkleProof, source string,
+) (*SyncTransaction, error) {
+
+	// Check for existing NewRelic transaction
+	ctx = c.GetOrStartTxn(ctx, "complete_sync_with_proof")
+
+	if len(blockHash) == 0 {
+		return nil, ErrMissingBlockHash
+	} else if proof == nil {
+		return nil, fmt.Errorf("%w: missing the proof", ErrInvalidMerkleProof)
+	}
+
+	// Wait for the processing of the record (broadcast, p2p and sync) to finish
+	for _, lockKey := range []string{lockKeyProcessBroadcastTx, lockKeyProcessP2PTx, lockKeyProcessSyncTx} {
+		unlock, err := newWaitWriteLock(ctx, fmt.Sprintf(lockKey, txID), c.Cachestore())
+		defer unlock()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Get the sync transaction (after the locks, the record is current)
+	syncTx, err := GetSyncTransactionByID(ctx, txID, c.DefaultModelOptions()...)
+	if err != nil {
+		return nil, err
+	} else if syncTx.SyncStatus == SyncStatusComplete {
+		return nil, fmt.Errorf("%w: %s", ErrSyncActionComplete, syncActionSync)
+	} else if syncTx.SyncStatus == SyncStatusCanceled {
+		return nil, ErrSyncTransactionCanceled
+	}
+
+	var transaction *Transaction
+	if transaction, err = getTransactionByID(ctx, "", txID, c.DefaultModelOptions()...); err != nil {
+		return nil, err
+	} else if transaction == nil {
+		return nil, ErrMissingTransaction
+	}
+
+	// Validate the proof before changing anything
+	if err = c.verifyExternalMerkleProof(ctx, txID, blockHash, blockHeight, proof); err != nil {
+		return nil, err
+	}
+
+	// Apply the proof to the transaction (the update fires the notification and confirms the balances)
+	if _, err = saveWithReload(ctx, transaction,
+		func(ctx context.Context) (*Transaction, error) {
+			reloaded, reloadErr := getTransactionByID(ctx, "", txID, c.DefaultModelOptions()...)
+			if reloadErr == nil && reloaded == nil {
+				reloadErr = ErrMissingTransaction
+			}
+			return reloaded, reloadErr
+		},
+		func(transaction *Transaction) {
+			transaction.setBlockInfo(blockHash, blockHeight)
+			transaction.setMinedAt(ctx)
+			transaction.MerkleProof = *proof
+		},
+	); err != nil {
+		return nil, err
+	}
+
+	// Complete the sync (found on-chain also confirms a seen broadcast)
+	message := "sync completed manually with an external proof"
+	if len(source) > 0 {
+		message += " from " + source
+	}
+	syncTx.SyncStatus = SyncStatusComplete
+	if syncTx.BroadcastStatus == SyncStatusSeen {
+		syncTx.BroadcastStatus = SyncStatusComplete
+	}
+	syncTx.Results.LastMessage = message
+	addManualSyncResult(syncTx, syncActionSync, message)
+
+	if err = syncTx.Save(ctx); err != nil {
+		return nil, err
+	}
+	return syncTx, nil
+}
+
+// verifyExternalMerkleProof will check the merkle proof of the transaction proves it is in the block
+//
+// The merkle root is compared to the stored block header, if the header is not stored the merkle root is
+// confirmed by the header service (chainstate)
+func (c *Client) verifyExternalMerkleProof(ctx context.Context, txID, blockHash string, blockHeight uint64,
+	proof *MerkleProof,
+) error {
+
+	// The proof is of the transaction (the txid or the raw transaction)
+	if len(proof.TxOrID) > 0 && !strings.EqualFold(proof.TxOrID, txID) {
+		tx, err := bt.NewTxFromString(proof.TxOrID)
+		if err != nil || tx.TxID() != txID {
+			return fmt.Errorf("%w: the proof is not of the transaction %s", ErrInvalidMerkleProof, txID)
+		}
+	}
+
+	merkleRoot, err := proof.merkleRoot(txID)
+	if err != nil {
+		return err
+	}
+
+	// The target of the proof (if any) is the block (hash or merkle root)
+	if len(proof.Target) > 0 {
+		target := blockHash
+		if proof.TargetType == "merkleRoot" {
+			target = merkleRoot
+		}
+		if !strings.EqualFold(proof.Target, target) {
+			return fmt.Errorf("%w: the target %s is not the block %s", ErrInvalidMerkleProof, proof.Target, blockHash)
+		}
+	}
+
+	var blockHeader *BlockHeader
+	if blockHeader, err = getBlockHeaderByHash(ctx, blockHash, c.DefaultModelOptions()...); err != nil {
+		return err
+	} else if blockHeader == nil { // The block and height can only be verified with the header
+		return fmt.Errorf("%w: block %s (retry once the header is synced)", ErrMissingBlockHeader, blockHash)
+	}
+
+	if uint64(blockHeader.Height) != blockHeight {
+		return fmt.Errorf(
+			"%w: block %s is at height %d, not %d", ErrInvalidMerkleProof, blockHash, blockHeader.Height, blockHeight,
+		)
+	} else if !strings.EqualFold(blockHeader.HashMerkleRoot, merkleRoot) {
+		return fmt.Errorf(
+			"%w: merkle root %s is not the merkle root of the block %s", ErrInvalidMerkleProof, merkleRoot, blockHash,
+		)
+	}
+	return nil
+}
+
+// addManualSyncResult will add the result of a manual change to the sync results (keeps the last 20)
+func addManualSyncResult(syncTx *SyncTransaction, action, message string) {
+	if len(syncTx.Results.Results) >= 19 {
+		syncTx.Results.Results = syncTx.Results.Results[1:]
+	}
+
+	syncTx.Results.Results = append(syncTx.Results.Results, &SyncResult{
+		Action:        action,
+		ExecutedAt:    time.Now().UTC(),
+		Provider:      "manual",
+		StatusMessage: message,
+	})
+}
+
+// toggleSyncStatus will return the new status of a sync action that is turned on or off
+func toggleSyncStatus(status SyncStatus, enabled bool, enabledStatus SyncStatus) (SyncStatus, error) {
+	switch status {
+	case SyncStatusCanceled:
+		return status, ErrSyncTransactionCanceled
+	case SyncStatusComplete, SyncStatusSeen:
+		// Already ran, turning it off does not change anything
+		if enabled {
+			return status, ErrSyncActionComplete
+		}
+		return status, nil
+	case SyncStatusSkipped:
+		if enabled {
+			return enabledStatus, nil
+		}
+		return status, nil
+	case SyncStatusPending, SyncStatusReady, SyncStatusProcessing, SyncStatusError:
+		if !enabled {
+			return SyncStatusSkipped, nil
+		}
+	}
+	return status, nil
+}
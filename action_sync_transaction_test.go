@@ -0,0 +1,329 @@
+package bux
+
+import (
+	"context"
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/libsv/go-bc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestClient_UpdateSyncTransactionConfig will test the method UpdateSyncTransactionConfig()
+func TestClient_UpdateSyncTransactionConfig(t *testing.T) {
+	t.Parallel()
+
+	enabled, disabled := true, false
+
+	newSyncTx := func(ctx context.Context, t *testing.T, client ClientInterface) *SyncTransaction {
+		syncTx := newSyncTransaction(testTxID, &SyncConfig{
+			Broadcast:   true,
+			PaymailP2P:  true,
+			SyncOnChain: true,
+		}, append(client.DefaultModelOptions(), New())...)
+		require.NoError(t, syncTx.Save(ctx))
+		return syncTx
+	}
+
+	t.Run("turn off p2p", func(t *testing.T) {
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, true, WithCustomTaskManager(&taskManagerMockBase{}))
+		defer deferMe()
+		newSyncTx(ctx, t, client)
+
+		syncTx, err := client.UpdateSyncTransactionConfig(ctx, testTxID, &SyncConfigChanges{PaymailP2P: &disabled})
+		require.NoError(t, err)
+		assert.False(t, syncTx.Configuration.PaymailP2P)
+		assert.Equal(t, SyncStatusSkipped, syncTx.P2PStatus)
+		assert.Equal(t, SyncStatusReady, syncTx.BroadcastStatus)
+		require.Len(t, syncTx.Results.Results, 1)
+		assert.Equal(t, syncActionConfig, syncTx.Results.Results[0].Action)
+		assert.Equal(t, "configuration changed: paymail_p2p=false", syncTx.Results.LastMessage)
+
+		// Stored
+		syncTx, err = GetSyncTransactionByID(ctx, testTxID, client.DefaultModelOptions()...)
+		require.NoError(t, err)
+		assert.Equal(t, SyncStatusSkipped, syncTx.P2PStatus)
+		assert.False(t, syncTx.Configuration.PaymailP2P)
+	})
+
+	t.Run("turn off the broadcast", func(t *testing.T) {
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, true, WithCustomTaskManager(&taskManagerMockBase{}))
+		defer deferMe()
+		newSyncTx(ctx, t, client)
+
+		// The p2p waiting for the broadcast is ready
+		syncTx, err := client.UpdateSyncTransactionConfig(ctx, testTxID, &SyncConfigChanges{Broadcast: &disabled})
+		require.NoError(t, err)
+		assert.Equal(t, SyncStatusSkipped, syncTx.BroadcastStatus)
+		assert.Equal(t, SyncStatusReady, syncTx.P2PStatus)
+	})
+
+	t.Run("completed action is not touched", func(t *testing.T) {
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, true, WithCustomTaskManager(&taskManagerMockBase{}))
+		defer deferMe()
+		syncTx := newSyncTx(ctx, t, client)
+		syncTx.BroadcastStatus = SyncStatusComplete
+		syncTx.P2PStatus = SyncStatusComplete
+		require.NoError(t, syncTx.Save(ctx))
+
+		var err error
+		syncTx, err = client.UpdateSyncTransactionConfig(ctx, testTxID, &SyncConfigChanges{
+			Broadcast:  &disabled,
+			PaymailP2P: &disabled,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, SyncStatusComplete, syncTx.BroadcastStatus)
+		assert.Equal(t, SyncStatusComplete, syncTx.P2PStatus)
+	})
+
+	t.Run("re-enable a skipped action", func(t *testing.T) {
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, true, WithCustomTaskManager(&taskManagerMockBase{}))
+		defer deferMe()
+		newSyncTx(ctx, t, client)
+
+		_, err := client.UpdateSyncTransactionConfig(ctx, testTxID, &SyncConfigChanges{PaymailP2P: &disabled})
+		require.NoError(t, err)
+
+		var syncTx *SyncTransaction
+		syncTx, err = client.UpdateSyncTransactionConfig(ctx, testTxID, &SyncConfigChanges{PaymailP2P: &enabled})
+		require.NoError(t, err)
+		assert.True(t, syncTx.Configuration.PaymailP2P)
+		assert.Equal(t, SyncStatusPending, syncTx.P2PStatus)
+		assert.Len(t, syncTx.Results.Results, 2)
+	})
+
+	t.Run("re-enable a completed action", func(t *testing.T) {
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, true, WithCustomTaskManager(&taskManagerMockBase{}))
+		defer deferMe()
+		syncTx := newSyncTx(ctx, t, client)
+		syncTx.SyncStatus = SyncStatusComplete
+		require.NoError(t, syncTx.Save(ctx))
+
+		// Nothing is changed (validated before saving)
+		_, err := client.UpdateSyncTransactionConfig(ctx, testTxID, &SyncConfigChanges{
+			Broadcast:   &disabled,
+			SyncOnChain: &enabled,
+		})
+		require.ErrorIs(t, err, ErrSyncActionComplete)
+
+		syncTx, err = GetSyncTransactionByID(ctx, testTxID, client.DefaultModelOptions()...)
+		require.NoError(t, err)
+		assert.Equal(t, SyncStatusReady, syncTx.BroadcastStatus)
+		assert.True(t, syncTx.Configuration.Broadcast)
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, true, WithCustomTaskManager(&taskManagerMockBase{}))
+		defer deferMe()
+		syncTx := newSyncTx(ctx, t, client)
+		syncTx.BroadcastStatus = SyncStatusCanceled
+		require.NoError(t, syncTx.Save(ctx))
+
+		_, err := client.UpdateSyncTransactionConfig(ctx, testTxID, &SyncConfigChanges{Broadcast: &enabled})
+		require.ErrorIs(t, err, ErrSyncTransactionCanceled)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, true, WithCustomTaskManager(&taskManagerMockBase{}))
+		defer deferMe()
+
+		_, err := client.UpdateSyncTransactionConfig(ctx, testTxID, &SyncConfigChanges{Broadcast: &enabled})
+		require.ErrorIs(t, err, ErrSyncTransactionNotFound)
+	})
+}
+
+// TestClient_RequeueSyncTransaction will test the method RequeueSyncTransaction()
+func TestClient_RequeueSyncTransaction(t *testing.T) {
+	t.Parallel()
+
+	newSyncTx := func(ctx context.Context, t *testing.T, client ClientInterface,
+		broadcastStatus, p2pStatus, syncStatus SyncStatus,
+	) {
+		syncTx := newSyncTransaction(testTxID, &SyncConfig{
+			Broadcast:   true,
+			PaymailP2P:  true,
+			SyncOnChain: true,
+		}, append(client.DefaultModelOptions(), New())...)
+		syncTx.BroadcastStatus = broadcastStatus
+		syncTx.P2PStatus = p2pStatus
+		syncTx.SyncStatus = syncStatus
+		require.NoError(t, syncTx.Save(ctx))
+	}
+
+	t.Run("errored broadcast", func(t *testing.T) {
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, true, WithCustomTaskManager(&taskManagerMockBase{}))
+		defer deferMe()
+		newSyncTx(ctx, t, client, SyncStatusError, SyncStatusError, SyncStatusPending)
+
+		syncTx, err := client.RequeueSyncTransaction(ctx, testTxID)
+		require.NoError(t, err)
+		assert.Equal(t, SyncStatusReady, syncTx.BroadcastStatus)
+		assert.Equal(t, SyncStatusPending, syncTx.P2PStatus) // Waits for the broadcast
+		assert.Equal(t, SyncStatusPending, syncTx.SyncStatus)
+		require.Len(t, syncTx.Results.Results, 1)
+		assert.Equal(t, syncActionRequeue, syncTx.Results.Results[0].Action)
+		assert.Equal(t, "requeued: broadcast, p2p", syncTx.Results.LastMessage)
+
+		// Stored
+		syncTx, err = GetSyncTransactionByID(ctx, testTxID, client.DefaultModelOptions()...)
+		require.NoError(t, err)
+		assert.Equal(t, SyncStatusReady, syncTx.BroadcastStatus)
+	})
+
+	t.Run("errored sync after the broadcast", func(t *testing.T) {
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, true, WithCustomTaskManager(&taskManagerMockBase{}))
+		defer deferMe()
+		newSyncTx(ctx, t, client, SyncStatusComplete, SyncStatusError, SyncStatusError)
+
+		syncTx, err := client.RequeueSyncTransaction(ctx, testTxID)
+		require.NoError(t, err)
+		assert.Equal(t, SyncStatusComplete, syncTx.BroadcastStatus)
+		assert.Equal(t, SyncStatusReady, syncTx.P2PStatus)
+		assert.Equal(t, SyncStatusReady, syncTx.SyncStatus)
+	})
+
+	t.Run("nothing errored", func(t *testing.T) {
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, true, WithCustomTaskManager(&taskManagerMockBase{}))
+		defer deferMe()
+		newSyncTx(ctx, t, client, SyncStatusReady, SyncStatusPending, SyncStatusPending)
+
+		_, err := client.RequeueSyncTransaction(ctx, testTxID)
+		require.ErrorIs(t, err, ErrSyncTransactionNotErrored)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, true, WithCustomTaskManager(&taskManagerMockBase{}))
+		defer deferMe()
+
+		_, err := client.RequeueSyncTransaction(ctx, testTxID)
+		require.ErrorIs(t, err, ErrSyncTransactionNotFound)
+	})
+}
+
+// TestClient_CompleteSyncWithProof will test the method CompleteSyncWithProof()
+func TestClient_CompleteSyncWithProof(t *testing.T) {
+	t.Parallel()
+
+	proof := &MerkleProof{
+		Index:  1,
+		TxOrID: testTxID,
+		Nodes: []string{
+			"b9ef07a62553ef8b0898a79c291b92c60f7932260888bde0dab2dd2610d8668e",
+			"0fc1c12fb1b57b38140442927fbadb3d1e5a5039a5d6db355ea25486374f104d",
+		},
+	}
+	merkleRoot, err := bc.MerkleRootFromBranches(testTxID, int(proof.Index), proof.Nodes)
+	require.NoError(t, err)
+
+	// newSyncedClient will return a client with the transaction (not found by the providers) and the block header
+	newSyncedClient := func(t *testing.T) (context.Context, ClientInterface) {
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, true, WithCustomTaskManager(&taskManagerMockBase{}))
+		t.Cleanup(deferMe)
+		opts := append(client.DefaultModelOptions(), New())
+
+		require.NoError(t, newTransaction(testTxHex, opts...).Save(ctx))
+		syncTx := newSyncTransaction(testTxID, &SyncConfig{Broadcast: true, SyncOnChain: true}, opts...)
+		syncTx.BroadcastStatus = SyncStatusSeen
+		syncTx.SyncStatus = SyncStatusReady
+		require.NoError(t, syncTx.Save(ctx))
+
+		root, rootErr := hex.DecodeString(merkleRoot)
+		require.NoError(t, rootErr)
+		blockHeader := newBlockHeader(testBlockHash, 100, bc.BlockHeader{
+			Bits:           []byte{},
+			HashPrevBlock:  []byte{},
+			HashMerkleRoot: root,
+			Time:           uint32(time.Date(2022, 4, 1, 12, 0, 0, 0, time.UTC).Unix()),
+		}, opts...)
+		require.NoError(t, blockHeader.Save(ctx))
+		return ctx, client
+	}
+
+	t.Run("valid proof", func(t *testing.T) {
+		ctx, client := newSyncedClient(t)
+
+		syncTx, err := client.CompleteSyncWithProof(ctx, testTxID, testBlockHash, 100, proof, "whatsonchain.com")
+		require.NoError(t, err)
+		assert.Equal(t, SyncStatusComplete, syncTx.SyncStatus)
+		assert.Equal(t, SyncStatusComplete, syncTx.BroadcastStatus)
+		result := syncTx.Results.LastForAction(syncActionSync)
+		require.NotNil(t, result)
+		assert.Equal(t, "manual", result.Provider)
+		assert.Equal(t, "sync completed manually with an external proof from whatsonchain.com", result.StatusMessage)
+
+		var transaction *Transaction
+		transaction, err = getTransactionByID(ctx, "", testTxID, client.DefaultModelOptions()...)
+		require.NoError(t, err)
+		assert.Equal(t, testBlockHash, transaction.BlockHash)
+		assert.Equal(t, uint64(100), transaction.BlockHeight)
+		assert.Equal(t, proof.Nodes, transaction.MerkleProof.Nodes)
+		assert.True(t, transaction.MinedAt.Valid)
+
+		// Already complete
+		_, err = client.CompleteSyncWithProof(ctx, testTxID, testBlockHash, 100, proof, "whatsonchain.com")
+		require.ErrorIs(t, err, ErrSyncActionComplete)
+	})
+
+	t.Run("invalid proofs are rejected", func(t *testing.T) {
+		ctx, client := newSyncedClient(t)
+
+		wrongIndex := *proof
+		wrongIndex.Index = 0
+		otherTx := *proof
+		otherTx.TxOrID = testBlockHash
+		wrongTarget := *proof
+		wrongTarget.Target = merkleRoot
+
+		for name, test := range map[string]struct {
+			blockHeight uint64
+			proof       *MerkleProof
+		}{
+			"wrong index":  {blockHeight: 100, proof: &wrongIndex},
+			"other tx":     {blockHeight: 100, proof: &otherTx},
+			"wrong target": {blockHeight: 100, proof: &wrongTarget},
+			"wrong height": {blockHeight: 101, proof: proof},
+		} {
+			_, err := client.CompleteSyncWithProof(ctx, testTxID, testBlockHash, test.blockHeight, test.proof, "")
+			require.ErrorIs(t, err, ErrInvalidMerkleProof, name)
+		}
+
+		_, err := client.CompleteSyncWithProof(ctx, testTxID, testBlockHash, 100, nil, "")
+		require.ErrorIs(t, err, ErrInvalidMerkleProof)
+		_, err = client.CompleteSyncWithProof(ctx, testTxID, "", 100, proof, "")
+		require.ErrorIs(t, err, ErrMissingBlockHash)
+
+		// Nothing was changed
+		syncTx, err := GetSyncTransactionByID(ctx, testTxID, client.DefaultModelOptions()...)
+		require.NoError(t, err)
+		assert.Equal(t, SyncStatusReady, syncTx.SyncStatus)
+		assert.Empty(t, syncTx.Results.Results)
+
+		var transaction *Transaction
+		transaction, err = getTransactionByID(ctx, "", testTxID, client.DefaultModelOptions()...)
+		require.NoError(t, err)
+		assert.Empty(t, transaction.BlockHash)
+	})
+
+	t.Run("unknown block header", func(t *testing.T) {
+		ctx, client := newSyncedClient(t)
+
+		otherBlockHash := "0000000000000000015122781ab51d57b26a09518630b882f67f1b08d841979d"
+		_, err := client.CompleteSyncWithProof(ctx, testTxID, otherBlockHash, 100, proof, "")
+		require.ErrorIs(t, err, ErrMissingBlockHeader)
+
+		var transaction *Transaction
+		transaction, err = getTransactionByID(ctx, "", testTxID, client.DefaultModelOptions()...)
+		require.NoError(t, err)
+		assert.Empty(t, transaction.BlockHash)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, true, WithCustomTaskManager(&taskManagerMockBase{}))
+		defer deferMe()
+
+		_, err := client.CompleteSyncWithProof(ctx, testTxID, testBlockHash, 100, proof, "")
+		require.ErrorIs(t, err, ErrSyncTransactionNotFound)
+	})
+}
@@ -9,7 +9,10 @@ import (
 
 	"github.com/BuxOrg/bux/chainstate"
 	"github.com/BuxOrg/bux/utils"
+	"github.com/bitcoinschema/go-bitcoin/v2"
+	"github.com/libsv/go-bk/bip32"
 	"github.com/libsv/go-bt"
+	"github.com/libsv/go-bt/v2/bscript"
 	"github.com/mrz1836/go-datastore"
 )
 
@@ -36,6 +39,61 @@ func (c *Client) RecordTransaction(ctx context.Context, xPubKey, txHex, draftID
 		txHex, draftID, newOpts...,
 	)
 
+	return c.recordTransaction(ctx, transaction, txHex, newOpts)
+}
+
+// RecordSignedDraft will record the signed transaction of a draft (see DraftTransaction.SigningPayload)
+//
+// The signed transaction must have the same inputs and outputs as the draft, it is then recorded like RecordTransaction
+// (ErrSignedDraftMismatch otherwise)
+//
+// xPubID is the xPub ID (or the raw public xPub)
+func (c *Client) RecordSignedDraft(ctx context.Context, xPubID, draftID, signedHex string,
+	opts ...ModelOps,
+) (*Transaction, error) {
+	// Check for existing NewRelic transaction
+	ctx = c.GetOrStartTxn(ctx, "record_signed_draft")
+
+	xPubID, err := resolveXpubID(xPubID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Get the draft transaction
+	var draftTransaction *DraftTransaction
+	if draftTransaction, err = getDraftTransactionID(
+		ctx, xPubID, draftID, c.DefaultModelOptions()...,
+	); err != nil {
+		return nil, err
+	} else if draftTransaction == nil {
+		return nil, ErrDraftNotFound
+	}
+
+	// Check the signed transaction against the payload of the draft
+	var payload *SigningPayload
+	if payload, err = draftTransaction.SigningPayload(); err != nil {
+		return nil, err
+	}
+	if err = payload.checkSignedHex(
+		signedHex, draftTransaction.Configuration.AllowExternalInputs,
+	); err != nil {
+		return nil, err
+	}
+
+	// Create the model & set the default options (gives options from client->model)
+	newOpts := c.DefaultModelOptions(append(opts, New())...)
+	transaction := newTransactionWithDraftID(
+		signedHex, draftID, newOpts...,
+	)
+	transaction.XPubID = xPubID
+
+	return c.recordTransaction(ctx, transaction, signedHex, newOpts)
+}
+
+// recordTransaction will record the (new) transaction model, see RecordTransaction
+func (c *Client) recordTransaction(ctx context.Context, transaction *Transaction, txHex string,
+	newOpts []ModelOps,
+) (*Transaction, error) {
 	// Ensure that we have a transaction id (created from the txHex)
 	id := transaction.GetID()
 	if len(id) == 0 {
@@ -60,45 +118,76 @@ func (c *Client) RecordTransaction(ctx context.Context, xPubKey, txHex, draftID
 	}
 	defer unlock()
 
-	// OPTION: check incoming transactions (if enabled, will add to queue for checking on-chain)
-	if !c.IsITCEnabled() {
+	// The P2P targets (see WithP2PTargets) are only notified for the transactions recorded without a draft
+	// (the sync transaction is saved with the transaction, or with the incoming transaction)
+	if len(transaction.p2pTargets) > 0 {
+		if len(transaction.DraftID) > 0 {
+			transaction.p2pTargets = nil
+		} else if err = validateP2PTargets(
+			transaction.p2pTargets, transaction.TransactionBase.parsedTx,
+		); err != nil {
+			return nil, err
+		} else {
+			transaction.syncTransaction = newP2PTargetsSyncTransaction(transaction)
+		}
+	}
+
+	// OPTION: verify the outgoing transaction before any utxo is marked as spent
+	if c.options.preBroadcastCheck && len(transaction.DraftID) > 0 {
+		if err = validateBeforeBroadcast(ctx, transaction); err != nil {
+			return nil, err
+		}
+	}
+
+	// OPTION: check incoming transactions (if enabled for the xPub, will add to queue for checking on-chain)
+	// The xPub receiving an incoming transaction (the owner of the matched destinations) or the registering xPub
+	if !xpubITCEnabled(ctx, c, transaction.itcXpubID(ctx)) {
 		transaction.DebugLog("incoming transaction check is disabled")
 	} else {
 
 		// Incoming (external/unknown) transaction (no draft id was given)
 		if len(transaction.DraftID) == 0 {
 
-			// Process & save the model
-			incomingTx := newIncomingTransaction(
+			// Process & save the model (or merge into the record of another instance)
+			var incomingTx *IncomingTransaction
+			if incomingTx, err = saveIncomingTransaction(ctx, newIncomingTransaction(
 				transaction.ID, txHex, newOpts...,
-			)
-			if err = incomingTx.Save(ctx); err != nil {
+			)); err != nil {
 				return nil, err
 			}
 
 			// Check if sync transaction exist. And if not, we should create it
-			if syncTx, _ := GetSyncTransactionByID(ctx, transaction.ID, transaction.client.DefaultModelOptions()...); syncTx == nil {
-				// Create the sync transaction model
-				sync := newSyncTransaction(
-					transaction.GetID(),
-					transaction.Client().DefaultSyncConfig(),
-					transaction.GetOptions(true)...,
-				)
-
-				// Skip broadcasting and skip P2P (incoming tx should have been broadcasted already)
-				sync.BroadcastStatus = SyncStatusSkipped // todo: this is an assumption
-				sync.P2PStatus = SyncStatusSkipped       // The owner of the Tx should have already notified paymail providers
+			if _, err = GetSyncTransactionByID(ctx, transaction.ID, transaction.client.DefaultModelOptions()...); err != nil {
+				if !errors.Is(err, ErrSyncTransactionNotFound) {
+					return nil, err
+				}
 
-				// Use the same metadata
-				sync.Metadata = transaction.Metadata
+				// Create the sync transaction model (unless the P2P targets were given, the recorder is the owner)
+				sync := transaction.syncTransaction
+				if sync == nil {
+					sync = newSyncTransaction(
+						transaction.GetID(),
+						transaction.Client().DefaultSyncConfig(),
+						transaction.GetOptions(true)...,
+					)
+
+					// Skip broadcasting and skip P2P (incoming tx should have been broadcasted already)
+					sync.BroadcastStatus = SyncStatusSkipped // todo: this is an assumption
+					sync.P2PStatus = SyncStatusSkipped       // The owner of the Tx should have already notified paymail providers
+
+					// Use the same metadata
+					sync.Metadata = transaction.Metadata
+				}
 
 				// If all the options are skipped, do not make a new model (ignore the record)
+				// (another instance might have created it in the meantime)
 				if !sync.isSkipped() {
-					if err = sync.Save(ctx); err != nil {
+					if err = sync.Save(ctx); err != nil && !errors.Is(err, ErrDuplicateSyncTransaction) {
 						return nil, err
 					}
 				}
 			}
+
 			// Added to queue
 			return newTransactionFromIncomingTransaction(incomingTx), nil
 		}
@@ -141,6 +230,7 @@ func (c *Client) RecordRawTransaction(ctx context.Context, txHex string,
 // RecordMonitoredTransaction will parse the transaction and save it into the Datastore
 //
 // This function will try to record the transaction directly, without checking draft ids etc.
+// Transactions that only pay dust to our destinations are skipped (nil transaction, see WithMonitorMinimumSatoshis).
 //
 //nolint:nolintlint,unparam,gci // opts is the way, but not yet being used
 func recordMonitoredTransaction(ctx context.Context, client ClientInterface, txHex string,
@@ -149,12 +239,42 @@ func recordMonitoredTransaction(ctx context.Context, client ClientInterface, txH
 	// Check for existing NewRelic transaction
 	ctx = client.GetOrStartTxn(ctx, "record_monitored_transaction")
 
+	// Reject the transactions exceeding the limits (before any other work)
+	if checker, ok := client.(incomingTransactionChecker); ok {
+		if err := checker.checkIncomingTransaction(ctx, txHex, incomingSourceMonitor); err != nil {
+			return nil, err
+		}
+	}
+
+	// Do not record the dust sent to our destinations (can be imported using ImportTransactionByID)
+	if filter, ok := client.(monitoredDustFilter); ok {
+		if skipped, err := filter.skipMonitoredDust(ctx, txHex); err != nil {
+			return nil, err
+		} else if skipped {
+			return nil, nil
+		}
+	}
+
+	return recordMonitoredTxHex(ctx, client, txHex, opts...)
+}
+
+// recordMonitoredTxHex will record the monitored transaction and create the sync transaction (if not mined)
+func recordMonitoredTxHex(ctx context.Context, client ClientInterface, txHex string,
+	opts ...ModelOps,
+) (*Transaction, error) {
 	transaction, err := client.recordTxHex(ctx, txHex, opts...)
 	if err != nil {
 		return nil, err
 	}
 
 	if transaction.BlockHash == "" {
+		// The monitor has seen the transaction in the mempool
+		if transaction.setFirstSeen(time.Now().UTC()) {
+			if err = transaction.Save(ctx); err != nil {
+				return nil, err
+			}
+		}
+
 		// Create the sync transaction model
 		sync := newSyncTransaction(
 			transaction.GetID(),
@@ -222,6 +342,41 @@ func (c *Client) recordTxHex(ctx context.Context, txHex string, opts ...ModelOps
 	return transaction, nil
 }
 
+// ImportTransactionByID will record a monitored transaction that was skipped (matched outputs below the minimum)
+//
+// The recently skipped transactions are kept (see GetMonitorStatus), the others are fetched from the raw
+// transaction providers of chainstate (see WithWhatsOnChain). A transaction that is already recorded
+// is returned as is (importing twice is safe, also across instances)
+func (c *Client) ImportTransactionByID(ctx context.Context, txID string, opts ...ModelOps) (*Transaction, error) {
+	// Check for existing NewRelic transaction
+	ctx = c.GetOrStartTxn(ctx, "import_transaction_by_id")
+
+	// Already recorded (by this or another instance): nothing to import
+	transaction, err := getTransactionByID(ctx, "", txID, c.DefaultModelOptions()...)
+	if err != nil {
+		return nil, err
+	} else if transaction != nil {
+		c.options.monitorFilter.removeSkipped(txID)
+		return transaction, nil
+	}
+
+	txHex := c.options.monitorFilter.skippedHex(txID)
+	if len(txHex) == 0 {
+		if txHex, err = c.Chainstate().GetRawTransaction(ctx, txID); errors.Is(err, chainstate.ErrTransactionNotFound) ||
+			errors.Is(err, chainstate.ErrMissingRawTransactionProviders) {
+			return nil, ErrSkippedTransactionNotFound
+		} else if err != nil {
+			return nil, err
+		}
+	}
+
+	if transaction, err = recordMonitoredTxHex(ctx, c, txHex, opts...); err != nil {
+		return nil, err
+	}
+	c.options.monitorFilter.removeSkipped(txID)
+	return transaction, nil
+}
+
 // NewTransaction will create a new draft transaction and return it
 //
 // ctx is the context
@@ -259,16 +414,324 @@ func (c *Client) NewTransaction(ctx context.Context, rawXpubKey string, config *
 	return draftTransaction, nil
 }
 
+// metadataKeyInternalTransfer is the xPub ID of the other side of an internal transfer (draft and destination)
+const metadataKeyInternalTransfer = "internal_transfer_xpub_id"
+
+// NewInternalTransferDraft will create a new draft transaction paying another xPub of this instance
+//
+// The draft pays a fresh destination of the receiving xPub directly (no paymail resolution), recording the
+// signed draft credits the utxos and balances of both xPubs (the broadcast uses the normal sync pipeline).
+//
+// The destination is derived from the external xPub of a paymail address of the receiver (the same keys as a
+// paymail payment, the raw xPub key of the receiver is not needed). The destination is only created (and the
+// index of the receiver claimed) once the draft was created, a failed draft leaves the receiver untouched.
+//
+// ctx is the context
+// fromXpubKey is the raw xPub key of the sender (derives the change destinations, see NewTransaction)
+// toXpubID is the xPub ID of the receiver (or the raw public xPub), it needs an active paymail address
+// satoshis is the amount to transfer
+// opts are additional model options to be applied (to the draft)
+func (c *Client) NewInternalTransferDraft(ctx context.Context, fromXpubKey, toXpubID string, satoshis uint64,
+	opts ...ModelOps,
+) (*DraftTransaction, error) {
+	// Check for existing NewRelic draftTransaction
+	ctx = c.GetOrStartTxn(ctx, "new_internal_transfer_draft")
+
+	toXpubID, err := resolveXpubID(toXpubID)
+	if err != nil {
+		return nil, err
+	} else if satoshis == 0 {
+		return nil, ErrMissingFieldSatoshis
+	} else if utils.Hash(fromXpubKey) == toXpubID {
+		return nil, ErrInternalTransferSameXpub
+	}
+
+	// Both xPubs must be on this instance
+	for _, xPubID := range []string{utils.Hash(fromXpubKey), toXpubID} {
+		var xPub *Xpub
+		if xPub, err = getXpubWithCache(ctx, c, "", xPubID, c.DefaultModelOptions()...); err != nil {
+			return nil, err
+		} else if xPub == nil {
+			return nil, ErrMissingXpub
+		}
+	}
+
+	// The receiving keys are derived from the paymail of the receiver
+	var paymailAddress *PaymailAddress
+	if paymailAddress, err = getInternalTransferPaymail(ctx, toXpubID, c.DefaultModelOptions()...); err != nil {
+		return nil, err
+	}
+
+	// Revoked keys are skipped, the next key is used if the index was taken while the draft was created
+	for retry := 0; ; retry++ {
+		var draftTransaction *DraftTransaction
+		var claimed bool
+		if draftTransaction, claimed, err = c.newInternalTransferAttempt(
+			ctx, fromXpubKey, paymailAddress, satoshis, opts...,
+		); err != nil || claimed {
+			return draftTransaction, err
+		} else if retry >= defaultDestinationIndexRetries {
+			return nil, ErrDestinationIndexCollision
+		}
+	}
+}
+
+// newInternalTransferAttempt will create the draft paying the next external key of the receiver, then claim the
+// index of the key and create the destination
+//
+// Returns false (without a draft) if the key is revoked or if the index was taken by another destination
+func (c *Client) newInternalTransferAttempt(ctx context.Context, fromXpubKey string, paymailAddress *PaymailAddress,
+	satoshis uint64, opts ...ModelOps,
+) (*DraftTransaction, bool, error) {
+
+	// The next external key of the receiver (not claimed yet)
+	xPub, err := getXpubByID(ctx, paymailAddress.XpubID, c.DefaultModelOptions()...)
+	if err != nil {
+		return nil, false, err
+	} else if xPub == nil {
+		return nil, false, ErrMissingXpub
+	}
+
+	var externalXpub *bip32.ExtendedKey
+	if externalXpub, err = paymailAddress.GetExternalXpub(); err != nil {
+		return nil, false, err
+	}
+
+	var pubKey *derivedPubKey
+	if pubKey, err = deriveKey(externalXpub.String(), xPub.NextExternalNum); err != nil {
+		return nil, false, err
+	}
+
+	var address *bscript.Address
+	if address, err = bitcoin.GetAddressFromPubKey(pubKey.ecPubKey, true); err != nil {
+		return nil, false, err
+	}
+
+	var lockingScript string
+	if lockingScript, err = createLockingScript(pubKey.ecPubKey); err != nil {
+		return nil, false, err
+	}
+
+	var revoked bool
+	if revoked, err = isDestinationRevoked(ctx, lockingScript, c.DefaultModelOptions()...); err != nil {
+		return nil, false, err
+	} else if revoked {
+		_, err = xPub.incrementNextNum(ctx, utils.ChainExternal)
+		return nil, false, err
+	}
+
+	// Create the draft (nothing of the receiver is changed if it fails)
+	var draftTransaction *DraftTransaction
+	if draftTransaction, err = c.NewTransaction(ctx, fromXpubKey, &TransactionConfig{
+		Outputs: []*TransactionOutput{{
+			To:       address.AddressString,
+			Satoshis: satoshis,
+		}},
+	}, append(opts, WithMetadata(metadataKeyInternalTransfer, paymailAddress.XpubID))...); err != nil {
+		return nil, false, err
+	}
+
+	// Claim the index and create the destination (the draft is canceled on failure)
+	var num uint32
+	if num, err = xPub.incrementNextNum(ctx, utils.ChainExternal); err == nil && num != pubKey.chainNum {
+		c.cancelDraft(ctx, draftTransaction)
+		return nil, false, nil
+	} else if err == nil {
+		_, err = createDestination(ctx, paymailAddress, pubKey, false, c.DefaultModelOptions(
+			WithMetadata(metadataKeyInternalTransfer, draftTransaction.XpubID),
+		)...)
+	}
+	if err != nil {
+		c.cancelDraft(ctx, draftTransaction)
+		return nil, false, err
+	}
+	return draftTransaction, true, nil
+}
+
+// getInternalTransferPaymail will return the first active paymail address of the xPub (receiver of an internal
+// transfer)
+func getInternalTransferPaymail(ctx context.Context, xPubID string, opts ...ModelOps) (*PaymailAddress, error) {
+	paymailAddresses, err := getPaymailAddresses(ctx, nil, &map[string]interface{}{
+		xPubIDField:  xPubID,
+		"deleted_at": nil,
+	}, &datastore.QueryParams{
+		OrderByField:  createdAtField,
+		SortDirection: datastore.SortAsc,
+	}, opts...)
+	if err != nil {
+		return nil, err
+	}
+	for _, paymailAddress := range paymailAddresses {
+		if !paymailAddress.IsPending() {
+			return paymailAddress, nil
+		}
+	}
+	return nil, ErrMissingPaymail
+}
+
+// TransactionSigner signs the transaction of a draft (see SendToRecipients) and returns the signed transaction (hex)
+type TransactionSigner func(payload SigningPayload) (signedHex string, err error)
+
+// SendToRecipients will create a draft paying the recipients (default options), sign it using the signer and
+// record the signed transaction
+//
+// The signed transaction must match the draft and the signatures must be valid, otherwise (or if the signer
+// fails) the draft is canceled and the reserved utxos are released.
+//
+// ctx is the context
+// xPubKey is the raw xPub key of the sender (derives the change destinations)
+// recipients are the outputs of the transaction
+// signer signs the transaction (IE: using the xPriv held by the caller)
+// opts are additional model options to be applied (to the draft and the transaction)
+func (c *Client) SendToRecipients(ctx context.Context, xPubKey string, recipients []*TransactionOutput,
+	signer TransactionSigner, opts ...ModelOps,
+) (*Transaction, error) {
+	// Check for existing NewRelic transaction
+	ctx = c.GetOrStartTxn(ctx, "send_to_recipients")
+
+	if signer == nil {
+		return nil, ErrMissingSigner
+	} else if len(recipients) == 0 {
+		return nil, ErrMissingTransactionOutputs
+	}
+
+	// Create the draft (reserves the utxos)
+	draftTransaction, err := c.NewTransaction(ctx, xPubKey, &TransactionConfig{
+		Outputs: recipients,
+	}, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	// Sign the draft (the signed transaction is checked before recording)
+	var transaction *Transaction
+	if transaction, err = c.signAndRecordDraft(ctx, xPubKey, draftTransaction, signer, opts...); err != nil {
+		c.cancelDraft(ctx, draftTransaction)
+		return nil, err
+	}
+	return transaction, nil
+}
+
+// signAndRecordDraft will sign the draft using the signer, verify the signatures and record the signed transaction
+func (c *Client) signAndRecordDraft(ctx context.Context, xPubKey string, draftTransaction *DraftTransaction,
+	signer TransactionSigner, opts ...ModelOps,
+) (*Transaction, error) {
+	payload, err := draftTransaction.SigningPayload()
+	if err != nil {
+		return nil, err
+	}
+
+	var signedHex string
+	if signedHex, err = signer(*payload); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrSignerFailed, err.Error())
+	}
+
+	// Same inputs and outputs as the draft, and valid signatures
+	if err = payload.checkSignedHex(signedHex, false); err != nil {
+		return nil, err
+	} else if err = payload.verifySignedHex(signedHex); err != nil {
+		return nil, err
+	}
+
+	return c.RecordSignedDraft(ctx, xPubKey, draftTransaction.ID, signedHex, opts...)
+}
+
+// cancelDraft will cancel the draft (the reserved utxos are released, see DraftTransaction.AfterUpdated)
+//
+// The context is detached from the caller (the clean-up also runs when the caller is canceled) and bounded by
+// defaultCancelDraftTimeout. Failures are logged, the draft expires anyway (draft clean up task)
+func (c *Client) cancelDraft(ctx context.Context, draftTransaction *DraftTransaction) {
+	detached := context.Background()
+	if isNotifySkipped(ctx, nil) {
+		detached = WithoutNotificationsContext(detached)
+	}
+	ctx, cancel := context.WithTimeout(detached, defaultCancelDraftTimeout)
+	defer cancel()
+
+	// Reload the draft (it is only canceled if it was not recorded)
+	current, err := getDraftTransactionID(
+		ctx, draftTransaction.XpubID, draftTransaction.ID, c.DefaultModelOptions()...,
+	)
+	if err == nil && current == nil {
+		err = ErrDraftNotFound
+	}
+	if err == nil && current.Status == DraftStatusDraft {
+		current.Status = DraftStatusCanceled
+		err = current.Save(ctx)
+	}
+	if err != nil {
+		c.Logger().Error(ctx, "failed canceling draft "+draftTransaction.ID+": "+err.Error())
+	}
+}
+
+// ResolveOutput will detect and resolve an output destination without creating a draft transaction
+//
+// The destination is a Bitcoin address, a paymail (or a known handle format) or a raw locking script (hex).
+// Paymail providers are only asked for their capabilities (nothing is created at the provider).
+// The draft transactions use the same resolution for their outputs.
+//
+// ctx is the context
+// destination is the address, paymail or script
+func (c *Client) ResolveOutput(ctx context.Context, destination string) (*OutputResolution, error) {
+
+	// Check for existing NewRelic transaction
+	ctx = c.GetOrStartTxn(ctx, "resolve_output")
+
+	// Convert known handle formats ($handcash or 1relayx)
+	destination, outputType := normalizeOutputDestination(destination)
+	if len(destination) == 0 {
+		return nil, ErrOutputValueNotRecognized
+	}
+
+	switch outputType {
+	case OutputTypePaymail:
+		if _, err := c.options.paymail.domainPolicy.checkOutputs(
+			[]*TransactionOutput{{To: destination}},
+		); err != nil {
+			return nil, err
+		}
+		resolution, _, err := resolvePaymailOutput(
+			ctx, c.options.paymail.requests, c.Cachestore(), c.PaymailClient(), destination,
+		)
+		return resolution, err
+	case OutputTypeScript:
+		return resolveScriptOutput(destination)
+	}
+
+	// Standard Bitcoin address (must belong to the network of the client)
+	resolution, err := resolveAddressOutput(destination)
+	if err != nil {
+		return nil, err
+	}
+	network := getClientNetwork(c)
+	if err = utils.ValidateAddressNetwork(resolution.Address, networkParams(network)); err != nil {
+		return nil, fmt.Errorf("%w: %s is not a %s address", ErrOutputAddressNetworkMismatch, resolution.Address, network)
+	}
+	return resolution, nil
+}
+
 // GetTransaction will get a transaction from the Datastore
 //
+// The latest note of the xPub (if any) is included (see AddTransactionNote).
+//
 // ctx is the context
+// xPubID is the xPub ID (or the raw public xPub), empty for any xPub
 // testTxID is the transaction ID
 func (c *Client) GetTransaction(ctx context.Context, xPubID, txID string) (*Transaction, error) {
 	// Check for existing NewRelic transaction
 	ctx = c.GetOrStartTxn(ctx, "get_transaction")
 
+	// Resolve the xPub ID (accepts the raw xPub key or the xPub ID, empty for any xPub)
+	var err error
+	if len(xPubID) > 0 {
+		if xPubID, err = resolveXpubID(xPubID); err != nil {
+			return nil, err
+		}
+	}
+
 	// Get the transaction by ID
-	transaction, err := getTransactionByID(
+	var transaction *Transaction
+	transaction, err = getTransactionByID(
 		ctx, xPubID, txID, c.DefaultModelOptions()...,
 	)
 	if err != nil {
@@ -278,9 +741,73 @@ func (c *Client) GetTransaction(ctx context.Context, xPubID, txID string) (*Tran
 		return nil, ErrMissingTransaction
 	}
 
+	// Add the latest note of the xPub (see AddTransactionNote)
+	if len(xPubID) > 0 {
+		if transaction.Note, err = getLatestTransactionNote(
+			ctx, xPubID, txID, c.DefaultModelOptions()...,
+		); err != nil {
+			return nil, err
+		}
+	}
+
+	// Add the fiat value at the rate stamped when recorded (see WithExchangeRateProvider)
+	transaction.FiatValue = fiatValueFromMetadata(transaction.Metadata, transaction.XpubOutputValue[xPubID])
+
 	return transaction, nil
 }
 
+// GetTransactionDisplay will get the transaction (see GetTransaction) filtered for display with the profile
+//
+// The view is for the xPub (direction, output value and metadata), the fields hidden from the profile are removed
+func (c *Client) GetTransactionDisplay(ctx context.Context, xPubID, txID, profile string) (interface{}, error) {
+	transaction, err := c.GetTransaction(ctx, xPubID, txID)
+	if err != nil {
+		return nil, err
+	}
+	if len(xPubID) > 0 {
+		if transaction.XPubID, err = resolveXpubID(xPubID); err != nil {
+			return nil, err
+		}
+	}
+	return transaction.DisplayFor(profile), nil
+}
+
+// ForEachTransaction will page through all the transactions of an xPub and invoke fn for each transaction
+//
+// Transactions are loaded in batches (keyset pagination), so no more than batchSize transactions are held in memory.
+// Iteration stops on the first error returned by fn or when the ctx is canceled.
+//
+// xPubID is the xPub ID (or the raw public xPub)
+func (c *Client) ForEachTransaction(ctx context.Context, xPubID string, conditions *map[string]interface{},
+	batchSize int, fn func(transaction *Transaction) error,
+) error {
+	// Check for existing NewRelic transaction
+	ctx = c.GetOrStartTxn(ctx, "for_each_transaction")
+
+	xPubID, err := resolveXpubID(xPubID)
+	if err != nil {
+		return err
+	}
+
+	opts := c.DefaultModelOptions()
+	return forEachKeysetRecord(ctx, processDBConditions(xPubID, conditions, nil), batchSize,
+		func(ctx context.Context, conditions map[string]interface{}, queryParams *datastore.QueryParams) ([]keysetRecord, error) {
+			transactions, err := getTransactionsInternal(ctx, conditions, xPubID, queryParams, opts...)
+			if err != nil {
+				return nil, err
+			}
+			records := make([]keysetRecord, 0, len(transactions))
+			for _, transaction := range transactions {
+				records = append(records, transaction)
+			}
+			return records, nil
+		}, func(record keysetRecord) error {
+			return fn(record.(*Transaction))
+		},
+		opts...,
+	)
+}
+
 // GetTransactionByID will get a transaction from the Datastore by tx ID
 // uses GetTransaction
 func (c *Client) GetTransactionByID(ctx context.Context, txID string) (*Transaction, error) {
@@ -355,18 +882,43 @@ func (c *Client) GetTransactionsCount(ctx context.Context, metadataConditions *M
 	return count, nil
 }
 
+// GetTransactionsPaged will get a page of transactions and the total count of transactions matching the conditions
+func (c *Client) GetTransactionsPaged(ctx context.Context, metadataConditions *Metadata,
+	conditions *map[string]interface{}, queryParams *datastore.QueryParams, opts ...ModelOps,
+) (*PagedResult[*Transaction], error) {
+	// Check for existing NewRelic transaction
+	ctx = c.GetOrStartTxn(ctx, "get_transactions_paged")
+
+	// Get the page and the total count using the same conditions
+	return getPagedResult(conditions, queryParams,
+		func(dbConditions *map[string]interface{}) ([]*Transaction, error) {
+			return c.GetTransactions(ctx, metadataConditions, dbConditions, queryParams, opts...)
+		},
+		func(dbConditions *map[string]interface{}) (int64, error) {
+			return c.GetTransactionsCount(ctx, metadataConditions, dbConditions, opts...)
+		},
+	)
+}
+
 // GetTransactionsByXpubID will get all transactions for a given xpub from the Datastore
 //
 // ctx is the context
 // rawXpubKey is the raw xPub key
 // metadataConditions is added to the request for searching
 // conditions is added the request for searching
+//
+// xPubID is the xPub ID (or the raw public xPub)
 func (c *Client) GetTransactionsByXpubID(ctx context.Context, xPubID string, metadataConditions *Metadata,
 	conditions *map[string]interface{}, queryParams *datastore.QueryParams,
 ) ([]*Transaction, error) {
 	// Check for existing NewRelic transaction
 	ctx = c.GetOrStartTxn(ctx, "get_transaction")
 
+	xPubID, err := resolveXpubID(xPubID)
+	if err != nil {
+		return nil, err
+	}
+
 	// Get the transaction by ID
 	// todo: add queryParams for: page size and page (right now it is unlimited)
 	transactions, err := getTransactionsByXpubID(
@@ -381,12 +933,19 @@ func (c *Client) GetTransactionsByXpubID(ctx context.Context, xPubID string, met
 }
 
 // GetTransactionsByXpubIDCount will get the count of all transactions matching the search criteria
+//
+// xPubID is the xPub ID (or the raw public xPub)
 func (c *Client) GetTransactionsByXpubIDCount(ctx context.Context, xPubID string, metadataConditions *Metadata,
 	conditions *map[string]interface{},
 ) (int64, error) {
 	// Check for existing NewRelic transaction
 	ctx = c.GetOrStartTxn(ctx, "count_transactions")
 
+	xPubID, err := resolveXpubID(xPubID)
+	if err != nil {
+		return 0, err
+	}
+
 	count, err := getTransactionsCountByXpubID(
 		ctx, xPubID, metadataConditions, conditions,
 		c.DefaultModelOptions()...,
@@ -398,13 +957,44 @@ func (c *Client) GetTransactionsByXpubIDCount(ctx context.Context, xPubID string
 	return count, nil
 }
 
+// SearchTransactions will get the transactions of an xPub matching the typed filter (see TransactionFilter)
+//
+// xPubID is the xPub ID (or the raw public xPub)
+// The raw conditions are still accepted by GetTransactionsByXpubID
+func (c *Client) SearchTransactions(ctx context.Context, xPubID string, filter *TransactionFilter,
+	queryParams *datastore.QueryParams,
+) ([]*Transaction, error) {
+	// Check for existing NewRelic transaction
+	ctx = c.GetOrStartTxn(ctx, "search_transactions")
+
+	xPubID, err := resolveXpubID(xPubID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Translate the filter for the datastore engine
+	var conditions map[string]interface{}
+	if conditions, err = filter.conditions(c.Datastore().Engine(), xPubID); err != nil {
+		return nil, err
+	}
+
+	return getTransactionsInternal(ctx, conditions, xPubID, queryParams, c.DefaultModelOptions()...)
+}
+
 // UpdateTransactionMetadata will update the metadata in an existing transaction
+//
+// xPubID is the xPub ID (or the raw public xPub)
 func (c *Client) UpdateTransactionMetadata(ctx context.Context, xPubID, id string,
 	metadata Metadata,
 ) (*Transaction, error) {
 	// Check for existing NewRelic transaction
 	ctx = c.GetOrStartTxn(ctx, "update_transaction_by_id")
 
+	xPubID, err := resolveXpubID(xPubID)
+	if err != nil {
+		return nil, err
+	}
+
 	// Get the transaction
 	transaction, err := c.GetTransaction(ctx, xPubID, id)
 	if err != nil {
@@ -412,14 +1002,15 @@ func (c *Client) UpdateTransactionMetadata(ctx context.Context, xPubID, id strin
 	}
 
 	// Update the metadata
+	entry := newAuditLog(ctx, AuditOperationUpdateMetadata, transaction, c.DefaultModelOptions(New())...)
 	if err = transaction.UpdateTransactionMetadata(
 		xPubID, metadata,
 	); err != nil {
 		return nil, err
 	}
 
-	// Save the model
-	if err = transaction.Save(ctx); err != nil {
+	// Save the model (and the audit entry)
+	if err = saveWithAudit(ctx, transaction, entry); err != nil {
 		return nil, err
 	}
 
@@ -509,9 +1100,26 @@ func (c *Client) RevertTransaction(ctx context.Context, id string) error {
 		if err = xpub.Save(ctx); err != nil {
 			return err
 		}
+
+		// record the reverted balance change
+		if outputValue != 0 {
+			if err = newBalanceEvent(
+				xpub.ID, transaction.ID, BalanceEventAdjustment, -outputValue, xpub.CurrentBalance,
+				c.DefaultModelOptions(New())...,
+			).Save(ctx); err != nil {
+				return err
+			}
+		}
+	}
+
+	// remove the output utxos from the unconfirmed balances (transaction is not on-chain)
+	unconfirmedValues := make(map[string]int64)
+	for _, utxo := range utxos {
+		unconfirmedValues[utxo.XpubID] -= int64(utxo.Satoshis)
 	}
 
 	// set any inputs (spent utxos) used in this transaction back to not spent
+	confirmedValues := make(map[string]int64)
 	var utxo *Utxo
 	for _, input := range draftTransaction.Configuration.Inputs {
 		if utxo, err = c.GetUtxoByTransactionID(ctx, input.TransactionID, input.OutputIndex); err != nil {
@@ -522,6 +1130,30 @@ func (c *Client) RevertTransaction(ctx context.Context, id string) error {
 		if err = utxo.Save(ctx); err != nil {
 			return err
 		}
+
+		// add the input back to the balance (confirmed if the funding transaction was mined)
+		if utxo.Transaction != nil && utxo.Transaction.BlockHeight > 0 {
+			confirmedValues[utxo.XpubID] += int64(utxo.Satoshis)
+		} else {
+			unconfirmedValues[utxo.XpubID] += int64(utxo.Satoshis)
+		}
+	}
+
+	// update the confirmed and unconfirmed balances
+	for xpubID := range confirmedValues {
+		if _, ok := unconfirmedValues[xpubID]; !ok {
+			unconfirmedValues[xpubID] = 0
+		}
+	}
+	for xpubID, unconfirmedValue := range unconfirmedValues {
+		if xpub, err = c.GetXpubByID(ctx, xpubID); err != nil {
+			return err
+		}
+		if err = xpub.incrementConfirmationBalances(
+			ctx, confirmedValues[xpubID], unconfirmedValue,
+		); err != nil {
+			return err
+		}
 	}
 
 	// cancel sync transaction
@@ -0,0 +1,133 @@
+package bux
+
+import (
+	"context"
+)
+
+// TransactionAncestry is a transaction with everything needed to verify it (SPV), IE: the data of BEEF as JSON
+type TransactionAncestry struct {
+	Ancestors           []*Transaction      `json:"ancestors"`                       // Unmined ancestors and the mined ones ending the ancestry (parents first)
+	CompoundMerklePaths CMPSlice            `json:"compound_merkle_paths,omitempty"` // Compound merkle paths of the mined ancestors (from the draft)
+	Depth               int                 `json:"depth"`                           // Deepest level of ancestry that was reached
+	Proofs              []*TransactionProof `json:"proofs"`                          // Merkle proofs of the mined transactions
+	Transaction         *Transaction        `json:"transaction"`                     // The subject transaction
+}
+
+// TransactionProof is the merkle proof of a mined transaction
+type TransactionProof struct {
+	BlockHash   string      `json:"block_hash"`
+	BlockHeight uint64      `json:"block_height"`
+	MerkleProof MerkleProof `json:"merkle_proof"`
+	TxID        string      `json:"tx_id"`
+}
+
+// GetTransactionWithAncestry will get a transaction of the xPub with its ancestry, down to the mined ancestors
+//
+// A mined transaction is its own proof (no ancestors). The walk is limited by maxDepth (0 = default) and by
+// the BEEF ancestry limits (see WithPaymailBeefAncestryLimits), the lowest depth is used.
+func (c *Client) GetTransactionWithAncestry(ctx context.Context, xPubID, txID string,
+	maxDepth int,
+) (*TransactionAncestry, error) {
+
+	// Check for existing NewRelic transaction
+	ctx = c.GetOrStartTxn(ctx, "get_transaction_with_ancestry")
+
+	var err error
+	if xPubID, err = resolveXpubID(xPubID); err != nil {
+		return nil, err
+	}
+
+	// Get the transaction (owned by the xPub)
+	var transaction *Transaction
+	if transaction, err = getTransactionByID(
+		ctx, "", txID, c.DefaultModelOptions()...,
+	); err != nil {
+		return nil, err
+	} else if transaction == nil {
+		return nil, ErrMissingTransaction
+	} else if !transaction.IsXpubIDAssociated(xPubID) {
+		return nil, ErrXpubIDMisMatch
+	}
+
+	ancestry := &TransactionAncestry{
+		Ancestors:   make([]*Transaction, 0),
+		Proofs:      make([]*TransactionProof, 0),
+		Transaction: transaction,
+	}
+	if isMinedWithProof(transaction) {
+		ancestry.Proofs = append(ancestry.Proofs, newTransactionProof(transaction))
+		ancestry.displayFor(xPubID)
+		return ancestry, nil
+	}
+
+	// The inputs of an unmined transaction are only known from the draft
+	if len(transaction.DraftID) == 0 {
+		return nil, ErrTransactionAncestryUnavailable
+	}
+	if err = hydrateTransaction(ctx, transaction); err != nil {
+		return nil, err
+	} else if transaction.draftTransaction == nil {
+		return nil, ErrTransactionAncestryUnavailable
+	}
+
+	// Same guards as BEEF
+	configDepth, maxTxs := beefAncestryLimits(c)
+	if maxDepth <= 0 || maxDepth > configDepth {
+		maxDepth = configDepth
+	}
+
+	var ancestors []*Transaction
+	if ancestors, ancestry.Depth, err = getAncestorTransactions(
+		ctx, transaction, maxDepth, maxTxs,
+	); err != nil {
+		return nil, err
+	}
+	if ancestry.Ancestors, err = kahnTopologicalSortTransactions(ancestors); err != nil {
+		return nil, err
+	}
+
+	for _, ancestor := range ancestry.Ancestors {
+		if isMinedWithProof(ancestor) {
+			ancestry.Proofs = append(ancestry.Proofs, newTransactionProof(ancestor))
+		}
+	}
+	if ancestry.CompoundMerklePaths, err = ancestryCompoundMerklePaths(ancestry.Ancestors); err != nil {
+		return nil, err
+	}
+
+	ancestry.displayFor(xPubID)
+	return ancestry, nil
+}
+
+// displayFor will set the transactions of the ancestry for display to the xPub
+//
+// The private fields of the ancestors that are not associated with the xPub (metadata, draft and xPub IDs) are removed
+func (a *TransactionAncestry) displayFor(xPubID string) {
+	a.Transaction.XPubID = xPubID
+	a.Transaction.Display()
+	for _, ancestor := range a.Ancestors {
+		if !ancestor.IsXpubIDAssociated(xPubID) {
+			ancestor.DraftID = ""
+			ancestor.Metadata = nil
+			ancestor.XPubID = ""
+		} else {
+			ancestor.XPubID = xPubID
+		}
+		ancestor.Display()
+	}
+}
+
+// isMinedWithProof will return true if the transaction has a merkle proof (same check as BEEF)
+func isMinedWithProof(tx *Transaction) bool {
+	return tx.MerkleProof.TxOrID != ""
+}
+
+// newTransactionProof will return the merkle proof of the mined transaction
+func newTransactionProof(tx *Transaction) *TransactionProof {
+	return &TransactionProof{
+		BlockHash:   tx.BlockHash,
+		BlockHeight: tx.BlockHeight,
+		MerkleProof: tx.MerkleProof,
+		TxID:        tx.ID,
+	}
+}
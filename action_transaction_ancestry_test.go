@@ -0,0 +1,122 @@
+package bux
+
+import (
+	"testing"
+
+	"github.com/BuxOrg/bux/utils"
+	"github.com/libsv/go-bc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestClient_GetTransactionWithAncestry will test the method GetTransactionWithAncestry()
+func (ts *EmbeddedDBTestSuite) TestClient_GetTransactionWithAncestry() {
+	for _, testCase := range dbTestCases {
+		ts.T().Run(testCase.name+" - 3-level ancestry", func(t *testing.T) {
+			tc := ts.genericDBClient(t, testCase.database, false)
+			t.Cleanup(func() { tc.Close(tc.ctx) }) // after the fixtures are released
+
+			fixtures := NewFixtures(t, tc.client).WithXpub(0).WithUtxos(100000)
+
+			// The funding transaction is mined
+			fundingTx := fixtures.Transactions[0]
+			fundingTx.BlockHash = "0000000000000000031928c28075a82d7a00c2c90b489d1d66dc0afa3f8d26f8"
+			fundingTx.BlockHeight = 800000
+			fundingTx.MerkleProof = MerkleProof(bc.MerkleProof{TxOrID: fundingTx.ID, Nodes: []string{"n1", "n2"}})
+			require.NoError(t, fundingTx.Save(tc.ctx))
+
+			// The parent spends the funding, the child spends the change of the parent (both unmined)
+			config := &TransactionConfig{Outputs: []*TransactionOutput{{
+				To:       testExternalAddress,
+				Satoshis: 1000,
+			}}}
+			parentTx, err := tc.client.RecordTransaction(
+				tc.ctx, fixtures.RawXpub, fixtures.WithDraft(config).Drafts[0].Hex, fixtures.Drafts[0].ID,
+			)
+			require.NoError(t, err)
+			var childTx *Transaction
+			childTx, err = tc.client.RecordTransaction(
+				tc.ctx, fixtures.RawXpub, fixtures.WithDraft(config).Drafts[1].Hex, fixtures.Drafts[1].ID,
+			)
+			require.NoError(t, err)
+
+			var ancestry *TransactionAncestry
+			ancestry, err = tc.client.GetTransactionWithAncestry(tc.ctx, fixtures.Xpub.ID, childTx.ID, 0)
+			require.NoError(t, err)
+			assert.Equal(t, childTx.ID, ancestry.Transaction.ID)
+			assert.Equal(t, []string{fundingTx.ID, parentTx.ID}, txIDsOf(ancestry.Ancestors))
+			assert.Equal(t, 2, ancestry.Depth)
+			require.Len(t, ancestry.Proofs, 1)
+			assert.Equal(t, fundingTx.ID, ancestry.Proofs[0].TxID)
+			assert.Equal(t, uint64(800000), ancestry.Proofs[0].BlockHeight)
+			assert.Equal(t, fundingTx.ID, ancestry.Proofs[0].MerkleProof.TxOrID)
+
+			// A mined transaction is its own proof
+			ancestry, err = tc.client.GetTransactionWithAncestry(tc.ctx, fixtures.RawXpub, fundingTx.ID, 0)
+			require.NoError(t, err)
+			assert.Len(t, ancestry.Ancestors, 0)
+			require.Len(t, ancestry.Proofs, 1)
+			assert.Equal(t, fundingTx.ID, ancestry.Proofs[0].TxID)
+
+			// Depth guard
+			_, err = tc.client.GetTransactionWithAncestry(tc.ctx, fixtures.Xpub.ID, childTx.ID, 1)
+			assert.ErrorIs(t, err, ErrBeefAncestryTooDeep)
+
+			// Ownership
+			_, err = tc.client.GetTransactionWithAncestry(tc.ctx, utils.Hash("other-xpub"), childTx.ID, 0)
+			assert.ErrorIs(t, err, ErrXpubIDMisMatch)
+			_, err = tc.client.GetTransactionWithAncestry(tc.ctx, fixtures.Xpub.ID, testTxID, 0)
+			assert.ErrorIs(t, err, ErrMissingTransaction)
+		})
+	}
+}
+
+// TestTransactionAncestry_displayFor will test the method displayFor()
+func TestTransactionAncestry_displayFor(t *testing.T) {
+	t.Parallel()
+
+	xPubID := utils.Hash("xpub")
+	otherXpubID := utils.Hash("other-xpub")
+
+	ancestry := &TransactionAncestry{
+		Ancestors: []*Transaction{{
+			DraftID:      testDraftID,
+			Model:        Model{Metadata: Metadata{"invoice": "other-1"}},
+			XPubID:       otherXpubID,
+			XpubInIDs:    IDs{otherXpubID},
+			XpubMetadata: XpubMetadata{otherXpubID: Metadata{"note": "private"}},
+			XpubOutIDs:   IDs{otherXpubID},
+		}, {
+			DraftID:         testDraftID2,
+			Model:           Model{Metadata: Metadata{"invoice": "own-1"}},
+			XpubInIDs:       IDs{xPubID},
+			XpubOutIDs:      IDs{xPubID, otherXpubID},
+			XpubOutputValue: XpubOutputValue{xPubID: -1000, otherXpubID: 1000},
+		}},
+		Transaction: &Transaction{
+			XpubInIDs:  IDs{xPubID},
+			XpubOutIDs: IDs{otherXpubID},
+		},
+	}
+	ancestry.displayFor(xPubID)
+
+	// Not associated with the xPub
+	other := ancestry.Ancestors[0]
+	assert.Empty(t, other.DraftID)
+	assert.Empty(t, other.Metadata)
+	assert.Empty(t, other.XPubID)
+	assert.Nil(t, other.XpubInIDs)
+	assert.Nil(t, other.XpubMetadata)
+	assert.Nil(t, other.XpubOutIDs)
+
+	// Associated with the xPub
+	own := ancestry.Ancestors[1]
+	assert.Equal(t, testDraftID2, own.DraftID)
+	assert.Equal(t, "own-1", own.Metadata["invoice"])
+	assert.Equal(t, int64(-1000), own.OutputValue)
+	assert.Nil(t, own.XpubOutIDs)
+	assert.Nil(t, own.XpubOutputValue)
+
+	assert.Equal(t, xPubID, ancestry.Transaction.XPubID)
+	assert.Nil(t, ancestry.Transaction.XpubOutIDs)
+}
@@ -0,0 +1,111 @@
+package bux
+
+import (
+	"context"
+	"fmt"
+)
+
+// AddTransactionNote will add a note (memo) of the xPub on the transaction
+//
+// The text is limited by WithTransactionNoteMaxLength, the transaction must be associated with the xPub.
+//
+// xPubID is the xPub ID (or the raw public xPub)
+// author is who wrote the note (IE: a user name or an access key)
+func (c *Client) AddTransactionNote(ctx context.Context, xPubID, txID, author, text string,
+	opts ...ModelOps,
+) (*TransactionNote, error) {
+
+	// Check for existing NewRelic transaction
+	ctx = c.GetOrStartTxn(ctx, "add_transaction_note")
+
+	xPubID, err := resolveXpubID(xPubID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = checkTransactionNoteText(text, c.TransactionNoteMaxLength()); err != nil {
+		return nil, err
+	}
+
+	// Only the xPubs of the transaction can add notes
+	var transaction *Transaction
+	if transaction, err = getTransactionByID(
+		ctx, xPubID, txID, c.DefaultModelOptions()...,
+	); err != nil {
+		return nil, err
+	} else if transaction == nil || !transaction.IsXpubIDAssociated(xPubID) {
+		return nil, ErrMissingTransaction
+	}
+
+	// Create the note
+	note := newTransactionNote(xPubID, txID, author, text, c.DefaultModelOptions(append(opts, New())...)...)
+	if err = note.Save(ctx); err != nil {
+		return nil, err
+	}
+	return note, nil
+}
+
+// GetTransactionNotes will get the notes of the xPub on the transaction (oldest first)
+//
+// xPubID is the xPub ID (or the raw public xPub)
+func (c *Client) GetTransactionNotes(ctx context.Context, xPubID, txID string) ([]*TransactionNote, error) {
+
+	// Check for existing NewRelic transaction
+	ctx = c.GetOrStartTxn(ctx, "get_transaction_notes")
+
+	xPubID, err := resolveXpubID(xPubID)
+	if err != nil {
+		return nil, err
+	}
+
+	return getTransactionNotes(ctx, xPubID, txID, nil, c.DefaultModelOptions()...)
+}
+
+// UpdateTransactionNote will change the text of the note, the previous version is kept in the history
+//
+// xPubID is the xPub ID (or the raw public xPub), the note must belong to the xPub
+func (c *Client) UpdateTransactionNote(ctx context.Context, xPubID, noteID, author,
+	text string,
+) (*TransactionNote, error) {
+
+	// Check for existing NewRelic transaction
+	ctx = c.GetOrStartTxn(ctx, "update_transaction_note")
+
+	xPubID, err := resolveXpubID(xPubID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = checkTransactionNoteText(text, c.TransactionNoteMaxLength()); err != nil {
+		return nil, err
+	}
+
+	// Concurrent updates of the note are serialized (each one keeps the previous version in the history)
+	var unlock func()
+	unlock, err = newWaitWriteLock(ctx, fmt.Sprintf(lockKeyTransactionNote, noteID), c.Cachestore())
+	defer unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	// Get the note
+	var note *TransactionNote
+	if note, err = getTransactionNote(
+		ctx, noteID, c.DefaultModelOptions()...,
+	); err != nil {
+		return nil, err
+	} else if note == nil || note.XpubID != xPubID {
+		return nil, ErrMissingTransactionNote
+	}
+
+	// Nothing changed (no new version)
+	if note.Text == text && note.Author == author {
+		return note, nil
+	}
+
+	note.update(author, text)
+	if err = note.Save(ctx); err != nil {
+		return nil, err
+	}
+	return note, nil
+}
@@ -3,10 +3,16 @@ package bux
 import (
 	"context"
 	"fmt"
+	"net/http"
+	"strings"
 	"testing"
 
 	"github.com/BuxOrg/bux/utils"
+	"github.com/bitcoin-sv/go-paymail"
+	"github.com/bitcoinschema/go-bitcoin/v2"
+	"github.com/jarcoal/httpmock"
 	"github.com/libsv/go-bk/bip32"
+	"github.com/libsv/go-bk/chaincfg"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -257,6 +263,127 @@ func initRevertTransactionData(t *testing.T) (context.Context, ClientInterface,
 	return ctx, client, transaction, xPriv, deferMe
 }
 
+// TestClient_ResolveOutput will test the method ResolveOutput()
+func TestClient_ResolveOutput(t *testing.T) {
+	paymailAddress := testAlias + "@" + testDomain
+	serverURL := "https://" + testDomain + "/api/v1/" + paymail.DefaultServiceName
+
+	newClient := func(t *testing.T) (context.Context, ClientInterface, func()) {
+		return CreateTestSQLiteClient(t, false, false,
+			WithCustomTaskManager(&taskManagerMockBase{}),
+			WithPaymailClient(newTestPaymailClient(t, []string{testDomain})),
+		)
+	}
+
+	t.Run("address", func(t *testing.T) {
+		ctx, client, deferMe := newClient(t)
+		defer deferMe()
+
+		resolution, err := client.ResolveOutput(ctx, " "+testExternalAddress+" ")
+		require.NoError(t, err)
+		assert.Equal(t, OutputTypeAddress, resolution.Type)
+		assert.Equal(t, testExternalAddress, resolution.To)
+		assert.Equal(t, testExternalAddress, resolution.Address)
+		assert.Equal(t, "76a9147ff514e6ae3deb46e6644caac5cdd0bf2388906588ac", resolution.LockingScript)
+		assert.Equal(t, utils.ScriptTypePubKeyHash, resolution.ScriptType)
+		assert.Nil(t, resolution.PaymailP4)
+	})
+
+	t.Run("address of another network", func(t *testing.T) {
+		ctx, client, deferMe := newClient(t)
+		defer deferMe()
+
+		testnetAddress, err := utils.GetAddressForNetwork(testExternalAddress, &chaincfg.TestNet)
+		require.NoError(t, err)
+
+		_, err = client.ResolveOutput(ctx, testnetAddress)
+		assert.ErrorIs(t, err, ErrOutputAddressNetworkMismatch)
+	})
+
+	t.Run("script", func(t *testing.T) {
+		ctx, client, deferMe := newClient(t)
+		defer deferMe()
+
+		resolution, err := client.ResolveOutput(ctx, testLockingScript)
+		require.NoError(t, err)
+		assert.Equal(t, OutputTypeScript, resolution.Type)
+		assert.Equal(t, testLockingScript, resolution.LockingScript)
+		assert.Equal(t, utils.ScriptTypePubKeyHash, resolution.ScriptType)
+		assert.Equal(t, utils.GetAddressFromScript(testLockingScript), resolution.Address)
+	})
+
+	t.Run("non-standard script", func(t *testing.T) {
+		ctx, client, deferMe := newClient(t)
+		defer deferMe()
+
+		resolution, err := client.ResolveOutput(ctx, "76a9")
+		require.NoError(t, err)
+		assert.Equal(t, OutputTypeScript, resolution.Type)
+		assert.Equal(t, utils.ScriptTypeNonStandard, resolution.ScriptType)
+		assert.Empty(t, resolution.Address)
+	})
+
+	t.Run("invalid address", func(t *testing.T) {
+		ctx, client, deferMe := newClient(t)
+		defer deferMe()
+
+		_, err := client.ResolveOutput(ctx, "1NotAnAddress")
+		require.Error(t, err)
+	})
+
+	t.Run("empty destination", func(t *testing.T) {
+		ctx, client, deferMe := newClient(t)
+		defer deferMe()
+
+		_, err := client.ResolveOutput(ctx, "")
+		assert.ErrorIs(t, err, ErrOutputValueNotRecognized)
+	})
+
+	t.Run("p2p paymail (nothing is created at the provider)", func(t *testing.T) {
+		ctx, client, deferMe := newClient(t)
+		defer deferMe()
+
+		mockValidResponse(http.StatusOK, true, testDomain)
+
+		resolution, err := client.ResolveOutput(ctx, strings.ToUpper(testAlias)+"@"+testDomain)
+		require.NoError(t, err)
+		assert.Equal(t, OutputTypePaymail, resolution.Type)
+		assert.Equal(t, paymailAddress, resolution.To)
+		assert.Empty(t, resolution.LockingScript)
+		assert.Equal(t, serverURL+"/p2p-payment-destination/{alias}@{domain.tld}", resolution.P2PDestinationURL)
+		require.NotNil(t, resolution.PaymailP4)
+		assert.Equal(t, testAlias, resolution.PaymailP4.Alias)
+		assert.Equal(t, testDomain, resolution.PaymailP4.Domain)
+		assert.Equal(t, ResolutionTypeP2P, resolution.PaymailP4.ResolutionType)
+		assert.Equal(t, serverURL+"/receive-transaction/{alias}@{domain.tld}", resolution.PaymailP4.ReceiveEndpoint)
+		assert.Len(t, resolution.PaymailP4.ReceiveEndpoints, 1)
+		assert.Equal(t, 0, httpmock.GetCallCountInfo()[http.MethodPost+" "+serverURL+"/p2p-payment-destination/"+paymailAddress])
+	})
+
+	t.Run("basic paymail", func(t *testing.T) {
+		ctx, client, deferMe := newClient(t)
+		defer deferMe()
+
+		mockValidResponse(http.StatusOK, false, testDomain)
+
+		resolution, err := client.ResolveOutput(ctx, paymailAddress)
+		require.NoError(t, err)
+		assert.Equal(t, OutputTypePaymail, resolution.Type)
+		assert.Empty(t, resolution.LockingScript)
+		assert.Empty(t, resolution.P2PDestinationURL)
+		assert.Equal(t, ResolutionTypeBasic, resolution.PaymailP4.ResolutionType)
+		assert.Equal(t, 0, httpmock.GetCallCountInfo()[http.MethodPost+" "+serverURL+"/address/"+paymailAddress])
+	})
+
+	t.Run("invalid paymail", func(t *testing.T) {
+		ctx, client, deferMe := newClient(t)
+		defer deferMe()
+
+		_, err := client.ResolveOutput(ctx, "@"+testDomain)
+		assert.ErrorIs(t, err, ErrPaymailAddressIsInvalid)
+	})
+}
+
 // BenchmarkAction_Transaction_recordTransaction will benchmark the method RecordTransaction()
 func BenchmarkAction_Transaction_recordTransaction(b *testing.B) {
 	b.ResetTimer()
@@ -368,3 +495,310 @@ func initBenchmarkData(b *testing.B) (context.Context, ClientInterface, *Xpub, *
 
 	return ctx, client, xPub, config, err
 }
+
+// TestClient_RecordSignedDraft will test the method RecordSignedDraft()
+func TestClient_RecordSignedDraft(t *testing.T) {
+	t.Parallel()
+
+	newDraft := func(t *testing.T) (context.Context, ClientInterface, *Fixtures) {
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, true, WithCustomTaskManager(&taskManagerMockBase{}))
+		t.Cleanup(deferMe)
+
+		fixtures := NewFixtures(t, client).WithXpub(0).WithUtxos(10000).WithDraft(&TransactionConfig{
+			Outputs: []*TransactionOutput{{
+				To:       testExternalAddress,
+				Satoshis: 1000,
+			}},
+		})
+		return ctx, client, fixtures
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		ctx, client, fixtures := newDraft(t)
+		draft := fixtures.Drafts[0]
+
+		signedHex, err := draft.SignInputs(fixtures.HDKey)
+		require.NoError(t, err)
+
+		var transaction *Transaction
+		transaction, err = client.RecordSignedDraft(ctx, fixtures.RawXpub, draft.ID, signedHex)
+		require.NoError(t, err)
+		require.NotNil(t, transaction)
+		assert.Equal(t, draft.ID, transaction.DraftID)
+		assert.Equal(t, []string{fixtures.Xpub.ID}, []string(transaction.XpubInIDs))
+
+		// The spent utxo
+		var utxo *Utxo
+		utxo, err = client.GetUtxoByTransactionID(ctx, fixtures.Utxos[0].TransactionID, 0)
+		require.NoError(t, err)
+		assert.Equal(t, transaction.ID, utxo.SpendingTxID.String)
+	})
+
+	t.Run("mismatch", func(t *testing.T) {
+		ctx, client, fixtures := newDraft(t)
+		draft := fixtures.Drafts[0]
+
+		// Not the transaction of the draft
+		otherHex := monitoredTxHex(t, []string{testLockingScript}, []uint64{1000})
+		transaction, err := client.RecordSignedDraft(ctx, fixtures.Xpub.ID, draft.ID, otherHex)
+		require.ErrorIs(t, err, ErrSignedDraftMismatch)
+		assert.Nil(t, transaction)
+
+		var txID string
+		txID, err = utils.GetTransactionIDFromHex(otherHex)
+		require.NoError(t, err)
+		_, err = client.GetTransaction(ctx, "", txID)
+		assert.ErrorIs(t, err, ErrMissingTransaction)
+	})
+
+	t.Run("missing draft", func(t *testing.T) {
+		ctx, client, fixtures := newDraft(t)
+
+		transaction, err := client.RecordSignedDraft(ctx, fixtures.Xpub.ID, "missing", fixtures.Drafts[0].Hex)
+		require.ErrorIs(t, err, ErrDraftNotFound)
+		assert.Nil(t, transaction)
+	})
+}
+
+// TestClient_NewInternalTransferDraft will test the method NewInternalTransferDraft()
+func TestClient_NewInternalTransferDraft(t *testing.T) {
+	t.Parallel()
+
+	newTransfer := func(t *testing.T) (context.Context, ClientInterface, *Fixtures, *Fixtures) {
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, true,
+			WithCustomTaskManager(&taskManagerMockBase{}),
+			WithAutoMigrate(&PaymailAddress{}),
+		)
+		t.Cleanup(deferMe)
+
+		// The receiving keys are derived from the paymail of the receiver
+		receiver := NewFixtures(t, client).WithXpub(0)
+		_, err := client.NewPaymailAddress(
+			ctx, receiver.RawXpub, testPaymail, testPublicName, testAvatar, client.DefaultModelOptions()...,
+		)
+		require.NoError(t, err)
+
+		return ctx, client, NewFixtures(t, client).WithXpub(0).WithUtxos(100000), receiver
+	}
+
+	t.Run("transfer", func(t *testing.T) {
+		ctx, client, sender, receiver := newTransfer(t)
+
+		draft, err := client.NewInternalTransferDraft(ctx, sender.RawXpub, receiver.Xpub.ID, 10000)
+		require.NoError(t, err)
+		require.NotNil(t, draft)
+		assert.Equal(t, sender.Xpub.ID, draft.XpubID)
+		assert.Equal(t, receiver.Xpub.ID, draft.Metadata[metadataKeyInternalTransfer])
+
+		// The first output is a fresh destination of the receiver (then the change)
+		require.Len(t, draft.Configuration.Outputs, 2)
+		output := draft.Configuration.Outputs[0]
+		assert.Equal(t, uint64(10000), output.Satoshis)
+		assert.Empty(t, output.PaymailP4)
+		var destination *Destination
+		destination, err = client.GetDestinationByAddress(ctx, receiver.Xpub.ID, output.To)
+		require.NoError(t, err)
+		assert.Equal(t, sender.Xpub.ID, destination.Metadata[metadataKeyInternalTransfer])
+
+		var signedHex string
+		signedHex, err = draft.SignInputs(sender.HDKey)
+		require.NoError(t, err)
+
+		var transaction *Transaction
+		transaction, err = client.RecordTransaction(ctx, sender.RawXpub, signedHex, draft.ID)
+		require.NoError(t, err)
+		assert.Equal(t, int64(10000), transaction.XpubOutputValue[receiver.Xpub.ID])
+
+		// Both sides are credited when recording (without the monitor)
+		var balances *XpubBalances
+		balances, err = client.GetXpubBalances(ctx, receiver.Xpub.ID)
+		require.NoError(t, err)
+		assert.Equal(t, uint64(10000), balances.Unconfirmed+balances.Confirmed)
+
+		var xPub *Xpub
+		xPub, err = client.GetXpubByID(ctx, sender.Xpub.ID)
+		require.NoError(t, err)
+		assert.Equal(t, 100000-10000-draft.Configuration.Fee, xPub.CurrentBalance)
+
+		var utxos []*Utxo
+		utxos, err = client.GetUtxosByXpubID(ctx, receiver.Xpub.ID, nil, nil, nil)
+		require.NoError(t, err)
+		require.Len(t, utxos, 1)
+		assert.Equal(t, transaction.ID, utxos[0].TransactionID)
+		assert.Equal(t, uint64(10000), utxos[0].Satoshis)
+		assert.Equal(t, destination.LockingScript, utxos[0].ScriptPubKey)
+
+		// The spent utxo and the change of the sender
+		utxos, err = client.GetUtxosByXpubID(ctx, sender.Xpub.ID, nil, nil, nil)
+		require.NoError(t, err)
+		var unspent uint64
+		for _, utxo := range utxos {
+			if !utxo.SpendingTxID.Valid {
+				unspent += utxo.Satoshis
+				assert.Equal(t, transaction.ID, utxo.TransactionID)
+			}
+		}
+		assert.Equal(t, 100000-10000-draft.Configuration.Fee, unspent)
+	})
+
+	t.Run("same xpub", func(t *testing.T) {
+		ctx, client, sender, _ := newTransfer(t)
+
+		_, err := client.NewInternalTransferDraft(ctx, sender.RawXpub, sender.Xpub.ID, 10000)
+		require.ErrorIs(t, err, ErrInternalTransferSameXpub)
+	})
+
+	t.Run("missing satoshis", func(t *testing.T) {
+		ctx, client, sender, receiver := newTransfer(t)
+
+		_, err := client.NewInternalTransferDraft(ctx, sender.RawXpub, receiver.Xpub.ID, 0)
+		require.ErrorIs(t, err, ErrMissingFieldSatoshis)
+	})
+
+	t.Run("receiver is not on the instance", func(t *testing.T) {
+		ctx, client, sender, _ := newTransfer(t)
+
+		_, err := client.NewInternalTransferDraft(ctx, sender.RawXpub, testXPubID, 10000)
+		require.ErrorIs(t, err, ErrMissingXpub)
+	})
+
+	t.Run("receiver without a paymail", func(t *testing.T) {
+		ctx, client, sender, _ := newTransfer(t)
+		other := NewFixtures(t, client).WithXpub(0)
+
+		_, err := client.NewInternalTransferDraft(ctx, sender.RawXpub, other.Xpub.ID, 10000)
+		require.ErrorIs(t, err, ErrMissingPaymail)
+	})
+
+	t.Run("failed draft leaves the receiver untouched", func(t *testing.T) {
+		ctx, client, sender, receiver := newTransfer(t)
+
+		_, err := client.NewInternalTransferDraft(ctx, sender.RawXpub, receiver.Xpub.ID, 1000000)
+		require.ErrorIs(t, err, ErrNotEnoughUtxos)
+
+		var destinations []*Destination
+		destinations, err = client.GetDestinationsByXpubID(ctx, receiver.Xpub.ID, nil, nil, nil)
+		require.NoError(t, err)
+		assert.Empty(t, destinations)
+
+		var xPub *Xpub
+		xPub, err = getXpubByID(ctx, receiver.Xpub.ID, client.DefaultModelOptions()...)
+		require.NoError(t, err)
+		assert.Equal(t, uint32(0), xPub.NextExternalNum)
+	})
+}
+
+// TestClient_SendToRecipients will test the method SendToRecipients()
+func TestClient_SendToRecipients(t *testing.T) {
+	t.Parallel()
+
+	recipients := func() []*TransactionOutput {
+		return []*TransactionOutput{{To: testExternalAddress, Satoshis: 1000}}
+	}
+
+	newSender := func(t *testing.T) (context.Context, ClientInterface, *Fixtures) {
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, true, WithCustomTaskManager(&taskManagerMockBase{}))
+		t.Cleanup(deferMe)
+
+		return ctx, client, NewFixtures(t, client).WithXpub(0).WithUtxos(10000)
+	}
+
+	// signWith will sign the draft of the payload with the key
+	signWith := func(ctx context.Context, t *testing.T, client ClientInterface, key *bip32.ExtendedKey) TransactionSigner {
+		return func(payload SigningPayload) (string, error) {
+			draft, err := getDraftTransactionID(ctx, payload.XpubID, payload.DraftID, client.DefaultModelOptions()...)
+			require.NoError(t, err)
+			require.NotNil(t, draft)
+			return draft.SignInputs(key)
+		}
+	}
+
+	// requireReleased will check that the draft was canceled and the utxo is available again
+	requireReleased := func(ctx context.Context, t *testing.T, client ClientInterface, fixtures *Fixtures) {
+		utxos, err := client.GetUtxosByXpubID(ctx, fixtures.Xpub.ID, nil, nil, nil)
+		require.NoError(t, err)
+		require.Len(t, utxos, 1)
+		assert.False(t, utxos[0].DraftID.Valid)
+		assert.False(t, utxos[0].SpendingTxID.Valid)
+
+		var drafts []*DraftTransaction
+		drafts, err = client.GetDraftTransactions(ctx, nil, &map[string]interface{}{
+			xPubIDField: fixtures.Xpub.ID,
+		}, nil)
+		require.NoError(t, err)
+		require.Len(t, drafts, 1)
+		assert.Equal(t, DraftStatusCanceled, drafts[0].Status)
+	}
+
+	t.Run("success", func(t *testing.T) {
+		ctx, client, fixtures := newSender(t)
+
+		transaction, err := client.SendToRecipients(
+			ctx, fixtures.RawXpub, recipients(), signWith(ctx, t, client, fixtures.HDKey),
+			WithMetadata("note", "direct send"),
+		)
+		require.NoError(t, err)
+		require.NotNil(t, transaction)
+		assert.NotEmpty(t, transaction.DraftID)
+		assert.Equal(t, "direct send", transaction.Metadata["note"])
+
+		var xPub *Xpub
+		xPub, err = client.GetXpubByID(ctx, fixtures.Xpub.ID)
+		require.NoError(t, err)
+		assert.Less(t, xPub.CurrentBalance, uint64(10000-1000))
+	})
+
+	t.Run("signer failure", func(t *testing.T) {
+		ctx, client, fixtures := newSender(t)
+
+		_, err := client.SendToRecipients(ctx, fixtures.RawXpub, recipients(), func(SigningPayload) (string, error) {
+			return "", fmt.Errorf("hsm unavailable")
+		})
+		require.ErrorIs(t, err, ErrSignerFailed)
+		assert.Contains(t, err.Error(), "hsm unavailable")
+		requireReleased(ctx, t, client, fixtures)
+	})
+
+	t.Run("caller canceled", func(t *testing.T) {
+		ctx, client, fixtures := newSender(t)
+
+		callerCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		_, err := client.SendToRecipients(callerCtx, fixtures.RawXpub, recipients(), func(SigningPayload) (string, error) {
+			cancel()
+			return "", fmt.Errorf("request aborted")
+		})
+		require.ErrorIs(t, err, ErrSignerFailed)
+		requireReleased(ctx, t, client, fixtures)
+	})
+
+	t.Run("invalid hex", func(t *testing.T) {
+		ctx, client, fixtures := newSender(t)
+
+		_, err := client.SendToRecipients(ctx, fixtures.RawXpub, recipients(), func(SigningPayload) (string, error) {
+			return "not-a-transaction", nil
+		})
+		require.Error(t, err)
+		requireReleased(ctx, t, client, fixtures)
+	})
+
+	t.Run("invalid signature", func(t *testing.T) {
+		ctx, client, fixtures := newSender(t)
+
+		other, err := bitcoin.GenerateHDKey(bitcoin.SecureSeedLength)
+		require.NoError(t, err)
+		_, err = client.SendToRecipients(ctx, fixtures.RawXpub, recipients(), signWith(ctx, t, client, other))
+		require.ErrorIs(t, err, ErrInvalidTransaction)
+		var invalid *InvalidTransactionError
+		require.ErrorAs(t, err, &invalid)
+		assert.Equal(t, 0, invalid.InputIndex)
+		requireReleased(ctx, t, client, fixtures)
+	})
+
+	t.Run("missing signer", func(t *testing.T) {
+		ctx, client, fixtures := newSender(t)
+
+		_, err := client.SendToRecipients(ctx, fixtures.RawXpub, recipients(), nil)
+		require.ErrorIs(t, err, ErrMissingSigner)
+	})
+}
@@ -2,8 +2,8 @@ package bux
 
 import (
 	"context"
+	"time"
 
-	"github.com/BuxOrg/bux/utils"
 	"github.com/mrz1836/go-datastore"
 )
 
@@ -48,13 +48,38 @@ func (c *Client) GetUtxosCount(ctx context.Context, metadataConditions *Metadata
 	return count, nil
 }
 
+// GetUtxosPaged will get a page of utxos and the total count of utxos matching the conditions
+func (c *Client) GetUtxosPaged(ctx context.Context, metadataConditions *Metadata,
+	conditions *map[string]interface{}, queryParams *datastore.QueryParams, opts ...ModelOps,
+) (*PagedResult[*Utxo], error) {
+	// Check for existing NewRelic transaction
+	ctx = c.GetOrStartTxn(ctx, "get_utxos_paged")
+
+	// Get the page and the total count using the same conditions
+	return getPagedResult(conditions, queryParams,
+		func(dbConditions *map[string]interface{}) ([]*Utxo, error) {
+			return c.GetUtxos(ctx, metadataConditions, dbConditions, queryParams, opts...)
+		},
+		func(dbConditions *map[string]interface{}) (int64, error) {
+			return c.GetUtxosCount(ctx, metadataConditions, dbConditions, opts...)
+		},
+	)
+}
+
 // GetUtxosByXpubID will get utxos based on an xPub
+//
+// xPubID is the xPub ID (or the raw public xPub)
 func (c *Client) GetUtxosByXpubID(ctx context.Context, xPubID string, metadata *Metadata, conditions *map[string]interface{},
 	queryParams *datastore.QueryParams,
 ) ([]*Utxo, error) {
 	// Check for existing NewRelic transaction
 	ctx = c.GetOrStartTxn(ctx, "get_utxos")
 
+	xPubID, err := resolveXpubID(xPubID)
+	if err != nil {
+		return nil, err
+	}
+
 	// Get the utxos
 	utxos, err := getUtxosByXpubID(
 		ctx,
@@ -74,13 +99,65 @@ func (c *Client) GetUtxosByXpubID(ctx context.Context, xPubID string, metadata *
 	return utxos, nil
 }
 
+// ForEachUtxo will page through all the utxos of an xPub and invoke fn for each utxo
+//
+// Utxos are loaded in batches (keyset pagination), so no more than batchSize utxos are held in memory.
+// Iteration stops on the first error returned by fn or when the ctx is canceled.
+//
+// xPubID is the xPub ID (or the raw public xPub)
+func (c *Client) ForEachUtxo(ctx context.Context, xPubID string, conditions *map[string]interface{},
+	batchSize int, fn func(utxo *Utxo) error,
+) error {
+	// Check for existing NewRelic transaction
+	ctx = c.GetOrStartTxn(ctx, "for_each_utxo")
+
+	xPubID, err := resolveXpubID(xPubID)
+	if err != nil {
+		return err
+	}
+
+	dbConditions := map[string]interface{}{}
+	if conditions != nil {
+		for key, value := range *conditions {
+			dbConditions[key] = value
+		}
+	}
+	dbConditions[xPubIDField] = xPubID
+
+	opts := c.DefaultModelOptions()
+	return forEachKeysetRecord(ctx, dbConditions, batchSize,
+		func(ctx context.Context, conditions map[string]interface{}, queryParams *datastore.QueryParams) ([]keysetRecord, error) {
+			utxos, err := getUtxosByConditions(ctx, conditions, queryParams, opts...)
+			if err != nil {
+				return nil, err
+			}
+			records := make([]keysetRecord, 0, len(utxos))
+			for _, utxo := range utxos {
+				records = append(records, utxo)
+			}
+			return records, nil
+		}, func(record keysetRecord) error {
+			return fn(record.(*Utxo))
+		},
+		opts...,
+	)
+}
+
 // GetUtxo will get a single utxo based on an xPub, the tx ID and the outputIndex
+//
+// xPubKey is the raw public xPub (or the xPub ID)
 func (c *Client) GetUtxo(ctx context.Context, xPubKey, txID string, outputIndex uint32) (*Utxo, error) {
 	// Check for existing NewRelic transaction
 	ctx = c.GetOrStartTxn(ctx, "get_utxo")
 
+	xPubID, err := resolveXpubID(xPubKey)
+	if err != nil {
+		return nil, err
+	}
+
 	// Get the utxos
-	utxo, err := getUtxo(
+	var utxo *Utxo
+	utxo, err = getUtxo(
 		ctx, txID, outputIndex, c.DefaultModelOptions()...,
 	)
 	if err != nil {
@@ -90,7 +167,7 @@ func (c *Client) GetUtxo(ctx context.Context, xPubKey, txID string, outputIndex
 	}
 
 	// Check that the id matches
-	if utxo.XpubID != utils.Hash(xPubKey) {
+	if utxo.XpubID != xPubID {
 		return nil, ErrXpubIDMisMatch
 	}
 
@@ -132,11 +209,87 @@ func (c *Client) GetUtxoByTransactionID(ctx context.Context, txID string, output
 }
 
 // UnReserveUtxos remove the reservation on the utxos for the given draft ID
+//
+// xPubID is the xPub ID (or the raw public xPub)
 func (c *Client) UnReserveUtxos(ctx context.Context, xPubID, draftID string) error {
 	// Check for existing NewRelic transaction
 	ctx = c.GetOrStartTxn(ctx, "unreserve_uxtos_by_draft_id")
 
-	return unReserveUtxos(ctx, xPubID, draftID)
+	xPubID, err := resolveXpubID(xPubID)
+	if err != nil {
+		return err
+	}
+
+	return unReserveUtxos(ctx, xPubID, draftID, c.DefaultModelOptions()...)
+}
+
+// ReserveUtxosManually will reserve utxos for use outside of bux (drafts will not spend them)
+//
+// xPubID is the xPub ID (or the raw public xPub)
+//
+// The reservation expires after the ttl (released by the draft clean up task) or when released using the reference
+func (c *Client) ReserveUtxosManually(ctx context.Context, xPubID string, utxoPointers []UtxoPointer,
+	ttl time.Duration, reference string,
+) ([]*UtxoReservationResult, error) {
+	// Check for existing NewRelic transaction
+	ctx = c.GetOrStartTxn(ctx, "reserve_utxos_manually")
+
+	xPubID, err := resolveXpubID(xPubID)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(reference) == 0 {
+		return nil, ErrMissingReservationReference
+	} else if ttl <= 0 {
+		return nil, ErrInvalidReservationTTL
+	}
+
+	return reserveUtxosManually(ctx, xPubID, utxoPointers, ttl, reference, c.DefaultModelOptions()...)
+}
+
+// ReleaseManualReservation will remove a manual reservation on the utxos for the given reference
+//
+// xPubID is the xPub ID (or the raw public xPub)
+func (c *Client) ReleaseManualReservation(ctx context.Context, xPubID, reference string) error {
+	// Check for existing NewRelic transaction
+	ctx = c.GetOrStartTxn(ctx, "release_manual_reservation")
+
+	xPubID, err := resolveXpubID(xPubID)
+	if err != nil {
+		return err
+	}
+
+	if len(reference) == 0 {
+		return ErrMissingReservationReference
+	}
+
+	return unReserveUtxos(ctx, xPubID, manualReservationDraftID(xPubID, reference), c.DefaultModelOptions()...)
+}
+
+// FreezeUtxo will freeze the utxo (compliance hold) until it is unfrozen
+//
+// A frozen utxo is excluded from the draft selection and the manual reservations, using it explicitly (coin control)
+// returns a UtxoFrozenError with the reason. The frozen satoshis are a separate number in GetXpubBalances.
+func (c *Client) FreezeUtxo(ctx context.Context, txID string, outputIndex uint32,
+	reason, frozenBy string,
+) (*Utxo, error) {
+	// Check for existing NewRelic transaction
+	ctx = c.GetOrStartTxn(ctx, "freeze_utxo")
+
+	if len(reason) == 0 {
+		return nil, ErrMissingFreezeReason
+	}
+
+	return freezeUtxo(ctx, txID, outputIndex, true, reason, frozenBy, c.DefaultModelOptions()...)
+}
+
+// UnfreezeUtxo will remove the compliance hold on the utxo
+func (c *Client) UnfreezeUtxo(ctx context.Context, txID string, outputIndex uint32) (*Utxo, error) {
+	// Check for existing NewRelic transaction
+	ctx = c.GetOrStartTxn(ctx, "unfreeze_utxo")
+
+	return freezeUtxo(ctx, txID, outputIndex, false, "", "", c.DefaultModelOptions()...)
 }
 
 // should this be optional in the results?
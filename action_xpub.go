@@ -2,7 +2,9 @@ package bux
 
 import (
 	"context"
+	"time"
 
+	"github.com/BuxOrg/bux/utils"
 	"github.com/mrz1836/go-datastore"
 )
 
@@ -29,16 +31,35 @@ func (c *Client) NewXpub(ctx context.Context, xPubKey string, opts ...ModelOps)
 	return xPub, nil
 }
 
+// resolveXpubID will return the xPub ID of the reference given to an action (the raw xPub key or the xPub ID)
+//
+// Returns ErrMissingFieldXpubID if the reference is empty, utils.ErrInvalidXpubReference if it is not valid
+func resolveXpubID(xPubRef string) (string, error) {
+	if len(xPubRef) == 0 {
+		return "", ErrMissingFieldXpubID
+	}
+	return utils.ResolveXpubID(xPubRef)
+}
+
 // GetXpub will get an existing xPub from the Datastore
 //
-// xPubKey is the raw public xPub
+// xPubKey is the raw public xPub (or the xPub ID)
 func (c *Client) GetXpub(ctx context.Context, xPubKey string) (*Xpub, error) {
 
 	// Check for existing NewRelic transaction
 	ctx = c.GetOrStartTxn(ctx, "get_xpub")
 
-	// Attempt to get from cache or datastore
-	xPub, err := getXpubWithCache(ctx, c, xPubKey, "", c.DefaultModelOptions()...)
+	xPubID, err := resolveXpubID(xPubKey)
+	if err != nil {
+		return nil, err
+	}
+
+	// Attempt to get from cache or datastore (the raw key is set on the model, if given)
+	if len(xPubKey) != utils.XpubKeyLength {
+		xPubKey = ""
+	}
+	var xPub *Xpub
+	xPub, err = getXpubWithCache(ctx, c, xPubKey, xPubID, c.DefaultModelOptions()...)
 	if err != nil {
 		return nil, err
 	}
@@ -49,12 +70,17 @@ func (c *Client) GetXpub(ctx context.Context, xPubKey string) (*Xpub, error) {
 
 // GetXpubByID will get an existing xPub from the Datastore
 //
-// xPubID is the hash of the xPub
+// xPubID is the hash of the xPub (or the raw public xPub)
 func (c *Client) GetXpubByID(ctx context.Context, xPubID string) (*Xpub, error) {
 
 	// Check for existing NewRelic transaction
 	ctx = c.GetOrStartTxn(ctx, "get_xpub_by_id")
 
+	xPubID, err := resolveXpubID(xPubID)
+	if err != nil {
+		return nil, err
+	}
+
 	// Attempt to get from cache or datastore
 	xPub, err := getXpubWithCache(ctx, c, "", xPubID, c.DefaultModelOptions()...)
 	if err != nil {
@@ -65,14 +91,102 @@ func (c *Client) GetXpubByID(ctx context.Context, xPubID string) (*Xpub, error)
 	return xPub, nil
 }
 
+// GetXpubBalances will get the confirmed, unconfirmed (pending) and reserved balances of an xPub
+//
+// xPubKey is the raw public xPub (or the xPub ID)
+func (c *Client) GetXpubBalances(ctx context.Context, xPubKey string) (*XpubBalances, error) {
+
+	// Check for existing NewRelic transaction
+	ctx = c.GetOrStartTxn(ctx, "get_xpub_balances")
+
+	xPubID, err := resolveXpubID(xPubKey)
+	if err != nil {
+		return nil, err
+	}
+
+	// Attempt to get from cache or datastore (the raw key is set on the model, if given)
+	if len(xPubKey) != utils.XpubKeyLength {
+		xPubKey = ""
+	}
+	var xPub *Xpub
+	xPub, err = getXpubWithCache(ctx, c, xPubKey, xPubID, c.DefaultModelOptions()...)
+	if err != nil {
+		return nil, err
+	}
+
+	// Get the utxos that are locked by drafts (reserved, not spent)
+	var utxos []*Utxo
+	if utxos, err = getUtxosByConditions(ctx, map[string]interface{}{
+		draftIDField:      map[string]interface{}{"$exists": true},
+		spendingTxIDField: nil,
+		xPubIDField:       xPub.ID,
+	}, nil, c.DefaultModelOptions()...); err != nil {
+		return nil, err
+	}
+
+	// Get the utxos that are frozen (not spent)
+	var frozenUtxos []*Utxo
+	if frozenUtxos, err = getUtxosByConditions(ctx, map[string]interface{}{
+		frozenField:       true,
+		spendingTxIDField: nil,
+		xPubIDField:       xPub.ID,
+	}, nil, c.DefaultModelOptions()...); err != nil {
+		return nil, err
+	}
+
+	balances := &XpubBalances{
+		Confirmed:   xPub.ConfirmedBalance,
+		Unconfirmed: xPub.UnconfirmedBalance,
+	}
+	for _, utxo := range utxos {
+		if !utxo.Frozen { // Counted once (as frozen)
+			balances.Reserved += utxo.Satoshis
+		}
+	}
+	for _, utxo := range frozenUtxos {
+		balances.Frozen += utxo.Satoshis
+	}
+	if total := balances.Confirmed + balances.Unconfirmed; total > balances.Reserved+balances.Frozen {
+		balances.Available = total - balances.Reserved - balances.Frozen
+	}
+
+	return balances, nil
+}
+
+// GetXpubBalanceAt will get the balance of an xPub at a point in time, computed from the transactions history
+//
+// timestamp is the time of the transactions used (BalanceAtCreated by default, or BalanceAtMined).
+// The result is not precise if some transactions recorded before the time lack a mined timestamp.
+//
+// xPubID is the xPub ID (or the raw public xPub)
+func (c *Client) GetXpubBalanceAt(ctx context.Context, xPubID string, at time.Time,
+	timestamp BalanceTimestamp,
+) (*XpubBalanceAt, error) {
+
+	// Check for existing NewRelic transaction
+	ctx = c.GetOrStartTxn(ctx, "get_xpub_balance_at")
+
+	xPubID, err := resolveXpubID(xPubID)
+	if err != nil {
+		return nil, err
+	}
+
+	return getXpubBalanceAt(ctx, c, xPubID, at, timestamp, c.DefaultModelOptions()...)
+}
+
 // UpdateXpubMetadata will update the metadata in an existing xPub
 //
-// xPubID is the hash of the xP
+// xPubID is the xPub ID (or the raw public xPub)
 func (c *Client) UpdateXpubMetadata(ctx context.Context, xPubID string, metadata Metadata) (*Xpub, error) {
 
 	// Check for existing NewRelic transaction
 	ctx = c.GetOrStartTxn(ctx, "update_xpub_by_id")
 
+	xPubID, err := resolveXpubID(xPubID)
+	if err != nil {
+		return nil, err
+	}
+
 	// Get the xPub
 	xPub, err := c.GetXpubByID(ctx, xPubID)
 	if err != nil {
@@ -80,9 +194,40 @@ func (c *Client) UpdateXpubMetadata(ctx context.Context, xPubID string, metadata
 	}
 
 	// Update the metadata
+	entry := newAuditLog(ctx, AuditOperationUpdateMetadata, xPub, c.DefaultModelOptions(New())...)
 	xPub.UpdateMetadata(metadata)
 
-	// Save the model
+	// Save the model (and the audit entry)
+	if err = saveWithAudit(ctx, xPub, entry); err != nil {
+		return nil, err
+	}
+
+	// Return the model
+	return xPub, nil
+}
+
+// SetXpubFlags will set the overrides of the incoming transactions check (ITC) and the input utxo check (IUC)
+//
+// A nil flag removes the override (the flag of the client is used).
+// The flags are honored immediately (no restart is required).
+//
+// xPubID is the xPub ID (or the raw public xPub)
+func (c *Client) SetXpubFlags(ctx context.Context, xPubID string, itc, iuc *bool) (*Xpub, error) {
+
+	// Check for existing NewRelic transaction
+	ctx = c.GetOrStartTxn(ctx, "set_xpub_flags")
+
+	// Get the xPub
+	xPub, err := c.GetXpubByID(ctx, xPubID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Set the overrides
+	xPub.ITCOverride = itc
+	xPub.IUCOverride = iuc
+
+	// Save the model (also updates the cache)
 	if err = xPub.Save(ctx); err != nil {
 		return nil, err
 	}
@@ -0,0 +1,356 @@
+package bux
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/mrz1836/go-datastore"
+)
+
+const (
+	snapshotPageSize    = 100 // Number of records read per query when exporting (the snapshot is streamed)
+	xpubSnapshotVersion = 1   // Current version of the snapshot format
+)
+
+// Record types in the snapshot stream
+const (
+	snapshotRecordAccessKey   = "access_key"
+	snapshotRecordDestination = "destination"
+	snapshotRecordHeader      = "header"
+	snapshotRecordPaymail     = "paymail_address"
+	snapshotRecordTransaction = "transaction"
+	snapshotRecordUtxo        = "utxo"
+	snapshotRecordXpub        = "xpub"
+)
+
+// XpubSnapshotHeader is the first record of an xPub snapshot
+type XpubSnapshotHeader struct {
+	CreatedAt time.Time `json:"created_at"` // When the snapshot was exported
+	Version   int       `json:"version"`    // Version of the snapshot format
+	XpubID    string    `json:"xpub_id"`    // The xPub in the snapshot
+}
+
+// XpubSnapshotResult is the result of importing an xPub snapshot (counts by record type)
+type XpubSnapshotResult struct {
+	Imported map[string]int `json:"imported"` // Records that were created
+	Skipped  map[string]int `json:"skipped"`  // Records that already existed
+	XpubID   string         `json:"xpub_id"`  // The xPub in the snapshot
+}
+
+// snapshotRecord is a single line of the snapshot stream (NDJSON)
+type snapshotRecord struct {
+	Data json.RawMessage `json:"data"`
+	Type string          `json:"type"`
+}
+
+// snapshotTransaction is the transaction record (includes the xPub specific fields that are not in the JSON)
+type snapshotTransaction struct {
+	*Transaction
+	XpubMetadata    XpubMetadata    `json:"xpub_metadata,omitempty"`
+	XpubOutputValue XpubOutputValue `json:"xpub_output_value,omitempty"`
+}
+
+// ExportXpubSnapshot will write a logical backup of the xPub to the writer
+//
+// The snapshot is a versioned NDJSON stream (header, xPub, destinations, utxos, paymail addresses,
+// access keys and transactions). Records are read in pages, large wallets are not buffered in memory.
+//
+// xPubKey is the raw public xPub (or the xPub ID)
+func (c *Client) ExportXpubSnapshot(ctx context.Context, xPubKey string, w io.Writer) error {
+
+	// Check for existing NewRelic transaction
+	ctx = c.GetOrStartTxn(ctx, "export_xpub_snapshot")
+
+	// Get the xPub (not from cache, the balances need to be current)
+	opts := c.DefaultModelOptions()
+	xPubID, err := resolveXpubID(xPubKey)
+	if err != nil {
+		return err
+	}
+	var xPub *Xpub
+	xPub, err = getXpubByID(ctx, xPubID, opts...)
+	if err != nil {
+		return err
+	} else if xPub == nil {
+		return ErrMissingXpub
+	}
+
+	encoder := json.NewEncoder(w)
+	write := func(recordType string, data interface{}) error {
+		return encoder.Encode(map[string]interface{}{"data": data, "type": recordType})
+	}
+
+	// Header & xPub
+	if err = write(snapshotRecordHeader, &XpubSnapshotHeader{
+		CreatedAt: time.Now().UTC(),
+		Version:   xpubSnapshotVersion,
+		XpubID:    xPubID,
+	}); err != nil {
+		return err
+	}
+	if err = write(snapshotRecordXpub, xPub); err != nil {
+		return err
+	}
+
+	// Destinations
+	if err = forEachSnapshotPage(func(queryParams *datastore.QueryParams) ([]*Destination, error) {
+		return getDestinationsByXpubID(ctx, xPubID, nil, nil, queryParams, opts...)
+	}, func(destination *Destination) error {
+		return write(snapshotRecordDestination, destination)
+	}); err != nil {
+		return err
+	}
+
+	// Utxos
+	if err = forEachSnapshotPage(func(queryParams *datastore.QueryParams) ([]*Utxo, error) {
+		return getUtxosByXpubID(ctx, xPubID, nil, nil, queryParams, opts...)
+	}, func(utxo *Utxo) error {
+		return write(snapshotRecordUtxo, utxo)
+	}); err != nil {
+		return err
+	}
+
+	// Paymail addresses
+	if err = forEachSnapshotPage(func(queryParams *datastore.QueryParams) ([]*PaymailAddress, error) {
+		return getPaymailAddresses(ctx, nil, &map[string]interface{}{
+			xPubIDField: xPubID,
+		}, queryParams, opts...)
+	}, func(paymailAddress *PaymailAddress) error {
+		return write(snapshotRecordPaymail, paymailAddress)
+	}); err != nil {
+		return err
+	}
+
+	// Access keys (only the hash, the private key is never stored)
+	if err = forEachSnapshotPage(func(queryParams *datastore.QueryParams) ([]*AccessKey, error) {
+		return getAccessKeysByXPubID(ctx, xPubID, nil, nil, queryParams, opts...)
+	}, func(accessKey *AccessKey) error {
+		return write(snapshotRecordAccessKey, accessKey)
+	}); err != nil {
+		return err
+	}
+
+	// Transactions
+	return forEachSnapshotPage(func(queryParams *datastore.QueryParams) ([]*Transaction, error) {
+		return getTransactionsByXpubID(ctx, xPubID, nil, nil, queryParams, opts...)
+	}, func(transaction *Transaction) error {
+		return write(snapshotRecordTransaction, &snapshotTransaction{
+			Transaction:     transaction,
+			XpubMetadata:    transaction.XpubMetadata,
+			XpubOutputValue: transaction.XpubOutputValue,
+		})
+	})
+}
+
+// ImportXpubSnapshot will recreate the xPub from a snapshot (see ExportXpubSnapshot)
+//
+// The import is idempotent: records that already exist are skipped. The records are stored as-is
+// (no hooks, notifications or tasks are fired). When finished, the xPub balance is validated
+// against the unspent utxos.
+func (c *Client) ImportXpubSnapshot(ctx context.Context, r io.Reader) (*XpubSnapshotResult, error) {
+
+	// Check for existing NewRelic transaction
+	ctx = c.GetOrStartTxn(ctx, "import_xpub_snapshot")
+
+	// The first record is the header
+	decoder := json.NewDecoder(r)
+	record := new(snapshotRecord)
+	header := new(XpubSnapshotHeader)
+	if err := decoder.Decode(record); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidSnapshot, err.Error())
+	} else if record.Type != snapshotRecordHeader {
+		return nil, ErrInvalidSnapshot
+	} else if err = json.Unmarshal(record.Data, header); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidSnapshot, err.Error())
+	} else if header.Version < 1 || header.Version > xpubSnapshotVersion || len(header.XpubID) == 0 {
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrInvalidSnapshot, header.Version)
+	}
+
+	result := &XpubSnapshotResult{
+		Imported: make(map[string]int),
+		Skipped:  make(map[string]int),
+		XpubID:   header.XpubID,
+	}
+
+	// Import each record
+	for {
+		record = new(snapshotRecord)
+		if err := decoder.Decode(record); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return result, fmt.Errorf("%w: %s", ErrInvalidSnapshot, err.Error())
+		}
+
+		model, err := decodeSnapshotRecord(record)
+		if err != nil {
+			return result, err
+		} else if !isSnapshotModelOfXpub(model, header.XpubID) {
+			return result, fmt.Errorf(
+				"%w: %s %s does not belong to the xpub of the header", ErrInvalidSnapshot, record.Type, model.GetID(),
+			)
+		}
+
+		var imported bool
+		if imported, err = c.importSnapshotModel(ctx, model); err != nil {
+			return result, err
+		} else if imported {
+			result.Imported[record.Type]++
+
+			// The imported balance is an adjustment (see BalanceEvent)
+			if xPub, ok := model.(*Xpub); ok && xPub.CurrentBalance > 0 {
+				if err = newBalanceEvent(
+					xPub.ID, "", BalanceEventAdjustment, int64(xPub.CurrentBalance), xPub.CurrentBalance,
+					c.DefaultModelOptions(New())...,
+				).Save(ctx); err != nil {
+					return result, err
+				}
+			}
+		} else {
+			result.Skipped[record.Type]++
+		}
+	}
+
+	// Validate the balance consistency
+	return result, c.validateSnapshotBalance(ctx, header.XpubID)
+}
+
+// importSnapshotModel will save the model as-is (skipped if the record already exists)
+func (c *Client) importSnapshotModel(ctx context.Context, model ModelInterface) (bool, error) {
+	ds := c.Datastore()
+	if ds == nil {
+		return false, ErrDatastoreRequired
+	}
+
+	count, err := getModelCount(
+		ctx, ds, model, map[string]interface{}{idField: model.GetID()}, defaultDatabaseReadTimeout,
+	)
+	if err != nil {
+		return false, err
+	} else if count > 0 {
+		return false, nil
+	}
+
+	if err = ds.NewTx(ctx, func(tx *datastore.Transaction) error {
+		if err = ds.SaveModel(ctx, model, tx, true, false); err != nil {
+			return err
+		}
+		if tx.CanCommit() {
+			return tx.Commit()
+		}
+		return nil
+	}); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// validateSnapshotBalance will check that the xPub balance matches the unspent utxos
+func (c *Client) validateSnapshotBalance(ctx context.Context, xPubID string) error {
+	opts := c.DefaultModelOptions()
+	xPub, err := getXpubByID(ctx, xPubID, opts...)
+	if err != nil {
+		return err
+	} else if xPub == nil {
+		return ErrMissingXpub
+	}
+
+	var unspent uint64
+	if err = forEachSnapshotPage(func(queryParams *datastore.QueryParams) ([]*Utxo, error) {
+		return getUtxosByXpubID(ctx, xPubID, nil, &map[string]interface{}{
+			spendingTxIDField: nil,
+		}, queryParams, opts...)
+	}, func(utxo *Utxo) error {
+		unspent += utxo.Satoshis
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	if unspent != xPub.CurrentBalance {
+		return fmt.Errorf(
+			"%w: current balance %d, unspent utxos %d", ErrSnapshotBalanceMismatch, xPub.CurrentBalance, unspent,
+		)
+	}
+	return nil
+}
+
+// decodeSnapshotRecord will decode the record into its model
+func decodeSnapshotRecord(record *snapshotRecord) (ModelInterface, error) {
+	switch record.Type {
+	case snapshotRecordAccessKey:
+		return decodeSnapshotModel(record.Data, &AccessKey{Model: *NewBaseModel(ModelAccessKey)})
+	case snapshotRecordDestination:
+		return decodeSnapshotModel(record.Data, &Destination{Model: *NewBaseModel(ModelDestination)})
+	case snapshotRecordPaymail:
+		return decodeSnapshotModel(record.Data, &PaymailAddress{Model: *NewBaseModel(ModelPaymailAddress)})
+	case snapshotRecordTransaction:
+		data := &snapshotTransaction{Transaction: &Transaction{Model: *NewBaseModel(ModelTransaction)}}
+		if err := json.Unmarshal(record.Data, data); err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidSnapshot, err.Error())
+		}
+		data.Transaction.XpubMetadata = data.XpubMetadata
+		data.Transaction.XpubOutputValue = data.XpubOutputValue
+		return data.Transaction, nil
+	case snapshotRecordUtxo:
+		return decodeSnapshotModel(record.Data, &Utxo{Model: *NewBaseModel(ModelUtxo)})
+	case snapshotRecordXpub:
+		return decodeSnapshotModel(record.Data, &Xpub{Model: *NewBaseModel(ModelXPub)})
+	}
+	return nil, fmt.Errorf("%w: unknown record type %s", ErrInvalidSnapshot, record.Type)
+}
+
+// isSnapshotModelOfXpub will check the snapshot record belongs to the xPub (the transactions are associated)
+func isSnapshotModelOfXpub(model ModelInterface, xPubID string) bool {
+	switch m := model.(type) {
+	case *AccessKey:
+		return m.XpubID == xPubID
+	case *Destination:
+		return m.XpubID == xPubID
+	case *PaymailAddress:
+		return m.XpubID == xPubID
+	case *Transaction:
+		return m.IsXpubIDAssociated(xPubID)
+	case *Utxo:
+		return m.XpubID == xPubID
+	case *Xpub:
+		return m.ID == xPubID
+	}
+	return false
+}
+
+// decodeSnapshotModel will unmarshal the record data into the model
+func decodeSnapshotModel[T ModelInterface](data json.RawMessage, model T) (ModelInterface, error) {
+	if err := json.Unmarshal(data, model); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidSnapshot, err.Error())
+	}
+	return model, nil
+}
+
+// forEachSnapshotPage will read the records page by page (ordered by id) and call fn for each record
+func forEachSnapshotPage[T any](getPage func(queryParams *datastore.QueryParams) ([]T, error),
+	fn func(item T) error,
+) error {
+	for page := 1; ; page++ {
+		items, err := getPage(&datastore.QueryParams{
+			OrderByField:  idField,
+			Page:          page,
+			PageSize:      snapshotPageSize,
+			SortDirection: datastore.SortAsc,
+		})
+		if err != nil {
+			return err
+		}
+		for _, item := range items {
+			if err = fn(item); err != nil {
+				return err
+			}
+		}
+		if len(items) < snapshotPageSize {
+			return nil
+		}
+	}
+}
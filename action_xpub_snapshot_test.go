@@ -0,0 +1,131 @@
+package bux
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestClient_XpubSnapshot will test the methods ExportXpubSnapshot() and ImportXpubSnapshot()
+func (ts *EmbeddedDBTestSuite) TestClient_XpubSnapshot() {
+	for _, testCase := range dbTestCases {
+		ts.T().Run(testCase.name+" - round trip", func(t *testing.T) {
+			source := ts.genericDBClient(t, testCase.database, false)
+			defer source.Close(source.ctx)
+
+			opts := source.client.DefaultModelOptions()
+
+			// Create the wallet state
+			fixtures := NewFixtures(t, source.client).WithXpub(0).WithDestinations(1).WithUtxos(122500)
+			xPub := fixtures.Xpub
+
+			_, err := source.client.NewPaymailAddress(source.ctx, fixtures.RawXpub, testPaymail, testPublicName, testAvatar, opts...)
+			require.NoError(t, err)
+
+			_, err = source.client.NewAccessKey(source.ctx, fixtures.RawXpub, opts...)
+			require.NoError(t, err)
+
+			// Export
+			var snapshot bytes.Buffer
+			require.NoError(t, source.client.ExportXpubSnapshot(source.ctx, fixtures.RawXpub, &snapshot))
+			assert.True(t, strings.HasPrefix(snapshot.String(), `{"data":{"created_at":`))
+
+			// Import on a fresh instance
+			target := ts.genericDBClient(t, testCase.database, false)
+			defer target.Close(target.ctx)
+
+			var result *XpubSnapshotResult
+			result, err = target.client.ImportXpubSnapshot(target.ctx, bytes.NewReader(snapshot.Bytes()))
+			require.NoError(t, err)
+			assert.Equal(t, xPub.ID, result.XpubID)
+			assert.Equal(t, 1, result.Imported[snapshotRecordXpub])
+			assert.Equal(t, 1, result.Imported[snapshotRecordUtxo])
+			assert.Equal(t, 1, result.Imported[snapshotRecordPaymail])
+			assert.Equal(t, 1, result.Imported[snapshotRecordAccessKey])
+			assert.Equal(t, 1, result.Imported[snapshotRecordTransaction])
+			assert.Len(t, result.Skipped, 0)
+
+			// Same numbers on both instances
+			sourceStats, err := source.client.GetStats(source.ctx)
+			require.NoError(t, err)
+			var targetStats *AdminStats
+			targetStats, err = target.client.GetStats(target.ctx)
+			require.NoError(t, err)
+			assert.Equal(t, sourceStats, targetStats)
+
+			var restored *Xpub
+			restored, err = target.client.GetXpubByID(target.ctx, xPub.ID)
+			require.NoError(t, err)
+			assert.Equal(t, uint64(122500), restored.CurrentBalance)
+			assert.Equal(t, xPub.NextExternalNum, restored.NextExternalNum)
+
+			// Importing again is idempotent
+			result, err = target.client.ImportXpubSnapshot(target.ctx, bytes.NewReader(snapshot.Bytes()))
+			require.NoError(t, err)
+			assert.Len(t, result.Imported, 0)
+			assert.Equal(t, 1, result.Skipped[snapshotRecordXpub])
+
+			targetStats, err = target.client.GetStats(target.ctx)
+			require.NoError(t, err)
+			assert.Equal(t, sourceStats, targetStats)
+		})
+	}
+}
+
+// TestClient_ImportXpubSnapshot will test the method ImportXpubSnapshot()
+func TestClient_ImportXpubSnapshot(t *testing.T) {
+	t.Parallel()
+
+	t.Run("missing header", func(t *testing.T) {
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, false, WithCustomTaskManager(&taskManagerMockBase{}))
+		defer deferMe()
+
+		_, err := client.ImportXpubSnapshot(ctx, strings.NewReader(`{"data":{"id":"`+testXPubID+`"},"type":"xpub"}`))
+		assert.ErrorIs(t, err, ErrInvalidSnapshot)
+	})
+
+	t.Run("unsupported version", func(t *testing.T) {
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, false, WithCustomTaskManager(&taskManagerMockBase{}))
+		defer deferMe()
+
+		_, err := client.ImportXpubSnapshot(ctx, strings.NewReader(`{"data":{"version":99,"xpub_id":"`+testXPubID+`"},"type":"header"}`))
+		assert.ErrorIs(t, err, ErrInvalidSnapshot)
+	})
+
+	t.Run("balance mismatch", func(t *testing.T) {
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, false, WithCustomTaskManager(&taskManagerMockBase{}))
+		defer deferMe()
+
+		_, err := client.ImportXpubSnapshot(ctx, strings.NewReader(
+			`{"data":{"version":1,"xpub_id":"`+testXPubID+`"},"type":"header"}`+"\n"+
+				`{"data":{"id":"`+testXPubID+`","current_balance":1000},"type":"xpub"}`+"\n",
+		))
+		assert.ErrorIs(t, err, ErrSnapshotBalanceMismatch)
+	})
+
+	t.Run("record of another xpub", func(t *testing.T) {
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, false, WithCustomTaskManager(&taskManagerMockBase{}))
+		defer deferMe()
+
+		result, err := client.ImportXpubSnapshot(ctx, strings.NewReader(
+			`{"data":{"version":1,"xpub_id":"`+testXPubID+`"},"type":"header"}`+"\n"+
+				`{"data":{"id":"`+testXPubID+`"},"type":"xpub"}`+"\n"+
+				`{"data":{"id":"`+testTxID+`","xpub_id":"`+testTxID2+`","satoshis":1000},"type":"utxo"}`+"\n",
+		))
+		assert.ErrorIs(t, err, ErrInvalidSnapshot)
+		assert.Equal(t, 1, result.Imported[snapshotRecordXpub])
+		assert.Equal(t, 0, result.Imported[snapshotRecordUtxo])
+	})
+
+	t.Run("export missing xpub", func(t *testing.T) {
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, false, WithCustomTaskManager(&taskManagerMockBase{}))
+		defer deferMe()
+
+		var snapshot bytes.Buffer
+		err := client.ExportXpubSnapshot(ctx, testXPub, &snapshot)
+		assert.ErrorIs(t, err, ErrMissingXpub)
+	})
+}
@@ -1,9 +1,12 @@
 package bux
 
 import (
+	"context"
+	"strings"
 	"testing"
 
 	"github.com/BuxOrg/bux/utils"
+	"github.com/libsv/go-bt/v2"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -219,3 +222,208 @@ func (ts *EmbeddedDBTestSuite) TestClient_UpdateXpubMetadata() {
 		})
 	}
 }
+
+// TestClient_xPubReference will test that the client methods accept the xPub key or the xPub ID
+func TestClient_xPubReference(t *testing.T) {
+	t.Parallel()
+
+	ctx, client, deferMe := CreateTestSQLiteClient(t, false, true, WithCustomTaskManager(&taskManagerMockBase{}))
+	defer deferMe()
+
+	fixtures := NewFixtures(t, client).WithXpub(0).WithDestinations(1).WithUtxos(1000)
+	destination := fixtures.Destinations[0]
+	utxo := fixtures.Utxos[0]
+
+	methods := []struct {
+		name string
+		call func(ctx context.Context, xPubRef string) error
+	}{
+		{"GetXpub", func(ctx context.Context, xPubRef string) error {
+			_, err := client.GetXpub(ctx, xPubRef)
+			return err
+		}},
+		{"GetXpubByID", func(ctx context.Context, xPubRef string) error {
+			_, err := client.GetXpubByID(ctx, xPubRef)
+			return err
+		}},
+		{"GetXpubBalances", func(ctx context.Context, xPubRef string) error {
+			_, err := client.GetXpubBalances(ctx, xPubRef)
+			return err
+		}},
+		{"GetDestinationByID", func(ctx context.Context, xPubRef string) error {
+			_, err := client.GetDestinationByID(ctx, xPubRef, destination.ID)
+			return err
+		}},
+		{"GetDestinationByAddress", func(ctx context.Context, xPubRef string) error {
+			_, err := client.GetDestinationByAddress(ctx, xPubRef, destination.Address)
+			return err
+		}},
+		{"GetDestinationsByXpubID", func(ctx context.Context, xPubRef string) error {
+			destinations, err := client.GetDestinationsByXpubID(ctx, xPubRef, nil, nil, nil)
+			if err == nil && len(destinations) != 1 {
+				return ErrMissingDestination
+			}
+			return err
+		}},
+		{"GetUtxo", func(ctx context.Context, xPubRef string) error {
+			_, err := client.GetUtxo(ctx, xPubRef, utxo.TransactionID, utxo.OutputIndex)
+			return err
+		}},
+		{"GetUtxosByXpubID", func(ctx context.Context, xPubRef string) error {
+			utxos, err := client.GetUtxosByXpubID(ctx, xPubRef, nil, nil, nil)
+			if err == nil && len(utxos) != 1 {
+				return ErrMissingUtxo
+			}
+			return err
+		}},
+		{"GetTransactionsByXpubIDCount", func(ctx context.Context, xPubRef string) error {
+			count, err := client.GetTransactionsByXpubIDCount(ctx, xPubRef, nil, nil)
+			if err == nil && count != 1 {
+				return ErrMissingTransaction
+			}
+			return err
+		}},
+	}
+
+	references := []struct {
+		name    string
+		xPubRef string
+		err     error
+	}{
+		{"xpub key", fixtures.RawXpub, nil},
+		{"xpub id", fixtures.Xpub.ID, nil},
+		{"upper case xpub id", strings.ToUpper(fixtures.Xpub.ID), nil},
+		{"garbage", "bad-xpub-reference", utils.ErrInvalidXpubReference},
+		{"empty", "", ErrMissingFieldXpubID},
+	}
+
+	for _, method := range methods {
+		for _, reference := range references {
+			t.Run(method.name+" - "+reference.name, func(t *testing.T) {
+				err := method.call(ctx, reference.xPubRef)
+				if reference.err != nil {
+					assert.ErrorIs(t, err, reference.err)
+					return
+				}
+				assert.NoError(t, err)
+			})
+		}
+	}
+}
+
+// TestClient_SetXpubFlags will test the method SetXpubFlags()
+func TestClient_SetXpubFlags(t *testing.T) {
+	t.Parallel()
+
+	ctx, client, deferMe := CreateTestSQLiteClient(t, false, true, WithCustomTaskManager(&taskManagerMockBase{}))
+	defer deferMe()
+
+	fixtures := NewFixtures(t, client).WithXpub(0).WithDestinations(1)
+	enabled, disabled := true, false
+
+	// newIncomingTx will return an incoming transaction paying to the destination of the xPub
+	newIncomingTx := func(t *testing.T) string {
+		parentID, err := utils.RandomHex(32)
+		require.NoError(t, err)
+		tx := bt.NewTx()
+		require.NoError(t, tx.From(parentID, 0, fixtures.Destinations[0].LockingScript, 1000))
+		require.NoError(t, tx.PayToAddress(fixtures.Destinations[0].Address, 900))
+		return tx.String()
+	}
+
+	t.Run("the flags of the client are the default", func(t *testing.T) {
+		xPub, err := client.GetXpubByID(ctx, fixtures.Xpub.ID)
+		require.NoError(t, err)
+		xPub = xPub.Display().(*Xpub)
+		assert.Nil(t, xPub.ITCOverride)
+		assert.Nil(t, xPub.IUCOverride)
+		assert.True(t, xPub.ITCEnabled)
+		assert.True(t, xPub.IUCEnabled)
+
+		// Incoming transaction check: queued for checking on-chain
+		var transaction *Transaction
+		transaction, err = client.RecordTransaction(ctx, fixtures.RawXpub, newIncomingTx(t), "")
+		require.NoError(t, err)
+		var incomingTx *IncomingTransaction
+		incomingTx, err = getIncomingTransactionByID(ctx, transaction.ID, client.DefaultModelOptions()...)
+		require.NoError(t, err)
+		assert.NotNil(t, incomingTx)
+	})
+
+	t.Run("overrides are honored immediately", func(t *testing.T) {
+		xPub, err := client.SetXpubFlags(ctx, fixtures.Xpub.ID, &disabled, &enabled)
+		require.NoError(t, err)
+		xPub = xPub.Display().(*Xpub)
+		assert.False(t, xPub.ITCEnabled)
+		assert.True(t, xPub.IUCEnabled)
+		assert.False(t, xpubITCEnabled(ctx, client, fixtures.Xpub.ID))
+		assert.True(t, xpubIUCEnabled(ctx, client, fixtures.Xpub.ID))
+
+		// No incoming transaction check: recorded directly
+		var transaction *Transaction
+		transaction, err = client.RecordTransaction(ctx, fixtures.RawXpub, newIncomingTx(t), "")
+		require.NoError(t, err)
+		var incomingTx *IncomingTransaction
+		incomingTx, err = getIncomingTransactionByID(ctx, transaction.ID, client.DefaultModelOptions()...)
+		require.NoError(t, err)
+		assert.Nil(t, incomingTx)
+		transaction, err = client.GetTransaction(ctx, fixtures.Xpub.ID, transaction.ID)
+		require.NoError(t, err)
+		assert.NotNil(t, transaction)
+
+		// The other xPubs use the flags of the client
+		other := NewFixtures(t, client).WithXpub(0)
+		assert.True(t, xpubITCEnabled(ctx, client, other.Xpub.ID))
+	})
+
+	t.Run("incoming uses the flags of the receiving xPub", func(t *testing.T) {
+		_, err := client.SetXpubFlags(ctx, fixtures.Xpub.ID, &disabled, nil)
+		require.NoError(t, err)
+
+		// Registered by another xPub (the flags of the client): recorded directly
+		other := NewFixtures(t, client).WithXpub(0)
+		var transaction *Transaction
+		transaction, err = client.RecordTransaction(ctx, other.RawXpub, newIncomingTx(t), "")
+		require.NoError(t, err)
+		var incomingTx *IncomingTransaction
+		incomingTx, err = getIncomingTransactionByID(ctx, transaction.ID, client.DefaultModelOptions()...)
+		require.NoError(t, err)
+		assert.Nil(t, incomingTx)
+		transaction, err = client.GetTransaction(ctx, fixtures.Xpub.ID, transaction.ID)
+		require.NoError(t, err)
+		assert.NotNil(t, transaction)
+
+		// Enabled for the receiving xPub: queued for checking on-chain
+		_, err = client.SetXpubFlags(ctx, fixtures.Xpub.ID, &enabled, nil)
+		require.NoError(t, err)
+		_, err = client.SetXpubFlags(ctx, other.Xpub.ID, &disabled, nil)
+		require.NoError(t, err)
+		transaction, err = client.RecordTransaction(ctx, other.RawXpub, newIncomingTx(t), "")
+		require.NoError(t, err)
+		incomingTx, err = getIncomingTransactionByID(ctx, transaction.ID, client.DefaultModelOptions()...)
+		require.NoError(t, err)
+		assert.NotNil(t, incomingTx)
+	})
+
+	t.Run("nil removes the overrides", func(t *testing.T) {
+		_, err := client.SetXpubFlags(ctx, fixtures.Xpub.ID, &enabled, &disabled)
+		require.NoError(t, err)
+		assert.False(t, xpubIUCEnabled(ctx, client, fixtures.Xpub.ID))
+
+		var xPub *Xpub
+		xPub, err = client.SetXpubFlags(ctx, fixtures.Xpub.ID, nil, nil)
+		require.NoError(t, err)
+
+		// Reload from the datastore
+		xPub, err = getXpubByID(ctx, xPub.ID, client.DefaultModelOptions()...)
+		require.NoError(t, err)
+		assert.Nil(t, xPub.ITCOverride)
+		assert.Nil(t, xPub.IUCOverride)
+		assert.True(t, xpubIUCEnabled(ctx, client, fixtures.Xpub.ID))
+	})
+
+	t.Run("unknown xPub", func(t *testing.T) {
+		_, err := client.SetXpubFlags(ctx, testXPubID, &disabled, nil)
+		require.ErrorIs(t, err, ErrMissingXpub)
+	})
+}
@@ -0,0 +1,73 @@
+package bux
+
+import (
+	"context"
+)
+
+// AdminGetDestinationByID will get a destination by id (any xPub, see WithAdminLookups)
+//
+// The XpubID of the destination is the owner
+func (c *Client) AdminGetDestinationByID(ctx context.Context, id string) (*Destination, error) {
+
+	// Check for existing NewRelic transaction
+	ctx = c.GetOrStartTxn(ctx, "admin_get_destination_by_id")
+
+	return c.adminGetDestination(ctx, id, "", "")
+}
+
+// AdminGetDestinationByAddress will get a destination for an address (any xPub, see WithAdminLookups)
+//
+// The XpubID of the destination is the owner
+func (c *Client) AdminGetDestinationByAddress(ctx context.Context, address string) (*Destination, error) {
+
+	// Check for existing NewRelic transaction
+	ctx = c.GetOrStartTxn(ctx, "admin_get_destination_by_address")
+
+	return c.adminGetDestination(ctx, "", address, "")
+}
+
+// AdminGetDestinationByLockingScript will get a destination for a locking script (any xPub, see WithAdminLookups)
+//
+// The XpubID of the destination is the owner
+func (c *Client) AdminGetDestinationByLockingScript(ctx context.Context, lockingScript string) (*Destination, error) {
+
+	// Check for existing NewRelic transaction
+	ctx = c.GetOrStartTxn(ctx, "admin_get_destination_by_locking_script")
+
+	return c.adminGetDestination(ctx, "", "", lockingScript)
+}
+
+// AdminGetTransactionByID will get a transaction by tx ID (any xPub, see WithAdminLookups)
+//
+// The XpubInIDs and XpubOutIDs of the transaction are the owners
+func (c *Client) AdminGetTransactionByID(ctx context.Context, txID string) (*Transaction, error) {
+
+	// Check for existing NewRelic transaction
+	ctx = c.GetOrStartTxn(ctx, "admin_get_transaction_by_id")
+
+	if !c.options.adminLookups {
+		return nil, ErrAdminLookupsDisabled
+	}
+
+	transaction, err := getTransactionByID(
+		ctx, "", txID, c.DefaultModelOptions()...,
+	)
+	if err != nil {
+		return nil, err
+	} else if transaction == nil {
+		return nil, ErrMissingTransaction
+	}
+
+	return transaction, nil
+}
+
+// adminGetDestination will get a destination by id, address or locking script without the xPub ownership check
+func (c *Client) adminGetDestination(ctx context.Context, id, address, lockingScript string) (*Destination, error) {
+	if !c.options.adminLookups {
+		return nil, ErrAdminLookupsDisabled
+	}
+
+	return getDestinationWithCache(
+		ctx, c, id, address, lockingScript, c.DefaultModelOptions()...,
+	)
+}
@@ -0,0 +1,71 @@
+package bux
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestClient_AdminLookups will test the cross-xPub admin lookups (AdminGetDestinationByID, etc.)
+func TestClient_AdminLookups(t *testing.T) {
+	t.Parallel()
+
+	t.Run("disabled by default", func(t *testing.T) {
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, true, WithCustomTaskManager(&taskManagerMockBase{}))
+		defer deferMe()
+
+		fixtures := NewFixtures(t, client).WithXpub(0).WithDestinations(1)
+		destination := fixtures.Destinations[0]
+
+		_, err := client.AdminGetDestinationByID(ctx, destination.ID)
+		assert.ErrorIs(t, err, ErrAdminLookupsDisabled)
+		_, err = client.AdminGetDestinationByAddress(ctx, destination.Address)
+		assert.ErrorIs(t, err, ErrAdminLookupsDisabled)
+		_, err = client.AdminGetDestinationByLockingScript(ctx, destination.LockingScript)
+		assert.ErrorIs(t, err, ErrAdminLookupsDisabled)
+		_, err = client.AdminGetTransactionByID(ctx, testTxID)
+		assert.ErrorIs(t, err, ErrAdminLookupsDisabled)
+	})
+
+	t.Run("lookups of any xpub", func(t *testing.T) {
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, true,
+			WithCustomTaskManager(&taskManagerMockBase{}),
+			WithAdminLookups(),
+		)
+		defer deferMe()
+
+		owner := NewFixtures(t, client).WithXpub(0).WithUtxos(1000)
+		other := NewFixtures(t, client).WithXpub(0)
+		destination := owner.Destinations[0]
+
+		// The tenant-scoped lookups still enforce the ownership
+		_, err := client.GetDestinationByAddress(ctx, other.Xpub.ID, destination.Address)
+		assert.ErrorIs(t, err, ErrXpubIDMisMatch)
+		_, err = client.GetDestinationByID(ctx, other.Xpub.ID, destination.ID)
+		assert.ErrorIs(t, err, ErrXpubIDMisMatch)
+
+		var found *Destination
+		found, err = client.AdminGetDestinationByID(ctx, destination.ID)
+		require.NoError(t, err)
+		assert.Equal(t, owner.Xpub.ID, found.XpubID)
+
+		found, err = client.AdminGetDestinationByAddress(ctx, destination.Address)
+		require.NoError(t, err)
+		assert.Equal(t, owner.Xpub.ID, found.XpubID)
+
+		found, err = client.AdminGetDestinationByLockingScript(ctx, destination.LockingScript)
+		require.NoError(t, err)
+		assert.Equal(t, owner.Xpub.ID, found.XpubID)
+
+		var transaction *Transaction
+		transaction, err = client.AdminGetTransactionByID(ctx, owner.Transactions[0].ID)
+		require.NoError(t, err)
+		assert.Equal(t, []string{owner.Xpub.ID}, []string(transaction.XpubOutIDs))
+
+		_, err = client.AdminGetDestinationByAddress(ctx, "1invalidAddress")
+		assert.ErrorIs(t, err, ErrMissingDestination)
+		_, err = client.AdminGetTransactionByID(ctx, testTxID)
+		assert.ErrorIs(t, err, ErrMissingTransaction)
+	})
+}
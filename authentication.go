@@ -193,11 +193,13 @@ func verifyAccessKey(ctx context.Context, key string, auth *AuthPayload, opts ..
 	} else if accessKey.RevokedAt.Valid {
 		return ErrAccessKeyRevoked
 	}
+	return verifyAccessKeySignature(key, auth)
+}
 
-	var address *bscript.Address
-	if address, err = bitcoin.GetAddressFromPubKeyString(
-		key, true,
-	); err != nil {
+// verifyAccessKeySignature will verify the signature payload of the access key (public key)
+func verifyAccessKeySignature(key string, auth *AuthPayload) error {
+	address, err := bitcoin.GetAddressFromPubKeyString(key, true)
+	if err != nil {
 		return err
 	}
 
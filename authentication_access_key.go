@@ -0,0 +1,147 @@
+package bux
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BuxOrg/bux/utils"
+)
+
+// AccessKeyAuthFailure is the reason a request signed by an access key was rejected
+type AccessKeyAuthFailure string
+
+// Reasons of the access key authentication failures (see AccessKeyAuthError)
+const (
+	AccessKeyAuthExpired          AccessKeyAuthFailure = "expired"           // Timestamp is outside the replay window
+	AccessKeyAuthInvalidSignature AccessKeyAuthFailure = "invalid_signature" // Body hash or signature does not match
+	AccessKeyAuthMalformed        AccessKeyAuthFailure = "malformed"         // Auth headers are missing
+	AccessKeyAuthReplayed         AccessKeyAuthFailure = "replayed"          // Nonce was already used in the replay window
+	AccessKeyAuthRevoked          AccessKeyAuthFailure = "revoked"           // Access key has been revoked
+	AccessKeyAuthUnknownKey       AccessKeyAuthFailure = "unknown_key"       // Access key (or its xPub) is not found
+)
+
+// AccessKeyAuthError is the error of a rejected request signed by an access key
+//
+// Use errors.As to get the reason, the cause is unwrapped (IE: errors.Is(err, ErrAccessKeyRevoked))
+type AccessKeyAuthError struct {
+	Reason AccessKeyAuthFailure
+	Err    error
+}
+
+// Error will return the reason and the cause of the failure
+func (e *AccessKeyAuthError) Error() string {
+	return "access key authentication failed (" + string(e.Reason) + "): " + e.Err.Error()
+}
+
+// Unwrap will return the cause of the failure
+func (e *AccessKeyAuthError) Unwrap() error {
+	return e.Err
+}
+
+// newAccessKeyAuthError will return the typed error of the reason
+func newAccessKeyAuthError(reason AccessKeyAuthFailure, err error) error {
+	return &AccessKeyAuthError{Reason: reason, Err: err}
+}
+
+// AccessKeyAuthentication is the result of an authenticated request signed by an access key
+type AccessKeyAuthentication struct {
+	AccessKey *AccessKey `json:"access_key"`
+	Xpub      *Xpub      `json:"xpub"`
+}
+
+// AuthenticateAccessKey will authenticate a request signed by an access key (see SetSignatureFromAccessKey)
+//
+// The auth headers are extracted, the body hash and the signature over the body hash, nonce and timestamp
+// are verified, and the key must be known and not revoked. A request is only valid once: the timestamp must be
+// within AuthSignatureTTL of now and the nonce can not be used again in that window.
+//
+// Returns an *AccessKeyAuthError on failure. The body of the request can still be read afterwards.
+func (c *Client) AuthenticateAccessKey(ctx context.Context, req *http.Request) (*AccessKeyAuthentication, error) {
+
+	// Get the auth headers
+	key := strings.TrimSpace(req.Header.Get(AuthAccessKey))
+	if len(key) == 0 {
+		return nil, newAccessKeyAuthError(AccessKeyAuthMalformed, ErrMissingAuthHeader)
+	}
+	authTime, _ := strconv.ParseInt(req.Header.Get(AuthHeaderTime), 10, 64)
+	auth := &AuthPayload{
+		AuthHash:  req.Header.Get(AuthHeaderHash),
+		AuthNonce: req.Header.Get(AuthHeaderNonce),
+		AuthTime:  authTime,
+		Signature: req.Header.Get(AuthSignature),
+	}
+	if len(auth.Signature) == 0 {
+		return nil, newAccessKeyAuthError(AccessKeyAuthMalformed, ErrMissingSignature)
+	} else if len(auth.AuthNonce) == 0 {
+		return nil, newAccessKeyAuthError(AccessKeyAuthMalformed, ErrMissingAuthNonce)
+	}
+
+	// Read the body (and set it back on the request), up to AuthMaxBodySize
+	if req.Body != nil {
+		b, err := io.ReadAll(http.MaxBytesReader(nil, req.Body, AuthMaxBodySize))
+		_ = req.Body.Close()
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			return nil, newAccessKeyAuthError(AccessKeyAuthMalformed, ErrAuthBodyTooLarge)
+		} else if err != nil {
+			return nil, err
+		}
+		req.Body = io.NopCloser(bytes.NewReader(b))
+		auth.BodyContents = string(b)
+	}
+
+	// Check the auth hash vs the body hash
+	if subtle.ConstantTimeCompare([]byte(auth.AuthHash), []byte(createBodyHash(auth.BodyContents))) != 1 {
+		return nil, newAccessKeyAuthError(AccessKeyAuthInvalidSignature, ErrAuhHashMismatch)
+	}
+
+	// Check the timestamp is within the replay window (both ways, the clocks can be skewed)
+	if age := time.Since(time.UnixMilli(auth.AuthTime)); auth.AuthTime <= 0 ||
+		age > AuthSignatureTTL || age < -AuthSignatureTTL {
+		return nil, newAccessKeyAuthError(AccessKeyAuthExpired, ErrSignatureExpired)
+	}
+
+	// Get the access key
+	accessKey, err := getAccessKey(ctx, utils.Hash(key), c.DefaultModelOptions()...)
+	if err != nil {
+		return nil, err
+	} else if accessKey == nil {
+		return nil, newAccessKeyAuthError(AccessKeyAuthUnknownKey, ErrUnknownAccessKey)
+	} else if accessKey.RevokedAt.Valid {
+		return nil, newAccessKeyAuthError(AccessKeyAuthRevoked, ErrAccessKeyRevoked)
+	}
+
+	// Verify the signature
+	if err = verifyAccessKeySignature(key, auth); err != nil {
+		return nil, newAccessKeyAuthError(AccessKeyAuthInvalidSignature, ErrSignatureInvalid)
+	}
+
+	// Use the nonce (only after the signature is verified, an unsigned request can not burn a nonce)
+	//
+	// The lock is never released, it expires after the replay window (both ways)
+	if _, err = c.Cachestore().WriteLock(
+		ctx, fmt.Sprintf(lockKeyAuthNonce, utils.Hash(key+auth.AuthNonce)), int64(2*AuthSignatureTTL/time.Second),
+	); isLockExistsError(err) {
+		return nil, newAccessKeyAuthError(AccessKeyAuthReplayed, ErrAuthReplayed)
+	} else if err != nil {
+		return nil, err
+	}
+
+	// Get the xPub of the access key
+	var xPub *Xpub
+	if xPub, err = getXpubByID(ctx, accessKey.XpubID, c.DefaultModelOptions()...); err != nil {
+		return nil, err
+	} else if xPub == nil {
+		return nil, newAccessKeyAuthError(AccessKeyAuthUnknownKey, ErrMissingXpub)
+	}
+
+	return &AccessKeyAuthentication{AccessKey: accessKey, Xpub: xPub}, nil
+}
@@ -0,0 +1,215 @@
+package bux
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/BuxOrg/bux/utils"
+	"github.com/bitcoinschema/go-bitcoin/v2"
+	"github.com/mrz1836/go-cachestore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newAccessKeyRequest will return a request signed by the access key at the given time
+func newAccessKeyRequest(t *testing.T, privateKeyHex, body string, authTime time.Time) *http.Request {
+	req, err := http.NewRequestWithContext(
+		context.Background(), http.MethodPost, "/", bytes.NewReader([]byte(body)),
+	)
+	require.NoError(t, err)
+
+	privateKey, err := bitcoin.PrivateKeyFromString(privateKeyHex)
+	require.NoError(t, err)
+	auth := &AuthPayload{
+		AuthHash:  utils.Hash(body),
+		AuthTime:  authTime.UnixMilli(),
+		accessKey: hex.EncodeToString(privateKey.PubKey().SerialiseCompressed()),
+	}
+	auth.AuthNonce, err = utils.RandomHex(32)
+	require.NoError(t, err)
+	auth.Signature, err = bitcoin.SignMessage(privateKeyHex, getSigningMessage(auth.accessKey, auth), true)
+	require.NoError(t, err)
+
+	req.Header.Set(AuthAccessKey, auth.accessKey)
+	require.NoError(t, setSignatureHeaders(&req.Header, auth))
+	return req
+}
+
+// requireAccessKeyAuthError will check the typed error of the access key authentication
+func requireAccessKeyAuthError(t *testing.T, err error, reason AccessKeyAuthFailure, cause error) {
+	var authErr *AccessKeyAuthError
+	require.True(t, errors.As(err, &authErr), err)
+	assert.Equal(t, reason, authErr.Reason)
+	require.ErrorIs(t, err, cause)
+}
+
+// TestClient_AuthenticateAccessKey will test the method AuthenticateAccessKey()
+func TestClient_AuthenticateAccessKey(t *testing.T) {
+
+	// newAccessKeyClient will return a client with an active access key of the test xPub
+	newAccessKeyClient := func(t *testing.T) (context.Context, ClientInterface, *AccessKey) {
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, false, WithCustomTaskManager(&taskManagerMockBase{}))
+		t.Cleanup(deferMe)
+
+		_, err := client.NewXpub(ctx, testXPub, client.DefaultModelOptions()...)
+		require.NoError(t, err)
+		var accessKey *AccessKey
+		accessKey, err = client.NewAccessKey(ctx, testXPub, client.DefaultModelOptions()...)
+		require.NoError(t, err)
+		return ctx, client, accessKey
+	}
+
+	t.Run("valid request", func(t *testing.T) {
+		ctx, client, accessKey := newAccessKeyClient(t)
+
+		req := newAccessKeyRequest(t, accessKey.Key, testBodyContents, time.Now())
+		auth, err := client.AuthenticateAccessKey(ctx, req)
+		require.NoError(t, err)
+		require.NotNil(t, auth)
+		assert.Equal(t, accessKey.ID, auth.AccessKey.ID)
+		assert.Equal(t, testXPubID, auth.Xpub.ID)
+
+		// The body can still be read
+		var body []byte
+		body, err = io.ReadAll(req.Body)
+		require.NoError(t, err)
+		assert.Equal(t, testBodyContents, string(body))
+	})
+
+	t.Run("valid request - SetSignatureFromAccessKey", func(t *testing.T) {
+		ctx, client, accessKey := newAccessKeyClient(t)
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, "/", bytes.NewReader([]byte(testBodyContents)))
+		require.NoError(t, err)
+		require.NoError(t, SetSignatureFromAccessKey(&req.Header, accessKey.Key, testBodyContents))
+
+		var auth *AccessKeyAuthentication
+		auth, err = client.AuthenticateAccessKey(ctx, req)
+		require.NoError(t, err)
+		assert.Equal(t, accessKey.ID, auth.AccessKey.ID)
+	})
+
+	t.Run("missing headers", func(t *testing.T) {
+		ctx, client, accessKey := newAccessKeyClient(t)
+
+		req := newAccessKeyRequest(t, accessKey.Key, testBodyContents, time.Now())
+		req.Header.Del(AuthAccessKey)
+		_, err := client.AuthenticateAccessKey(ctx, req)
+		requireAccessKeyAuthError(t, err, AccessKeyAuthMalformed, ErrMissingAuthHeader)
+
+		req = newAccessKeyRequest(t, accessKey.Key, testBodyContents, time.Now())
+		req.Header.Del(AuthSignature)
+		_, err = client.AuthenticateAccessKey(ctx, req)
+		requireAccessKeyAuthError(t, err, AccessKeyAuthMalformed, ErrMissingSignature)
+
+		req = newAccessKeyRequest(t, accessKey.Key, testBodyContents, time.Now())
+		req.Header.Del(AuthHeaderNonce)
+		_, err = client.AuthenticateAccessKey(ctx, req)
+		requireAccessKeyAuthError(t, err, AccessKeyAuthMalformed, ErrMissingAuthNonce)
+	})
+
+	t.Run("tampered body", func(t *testing.T) {
+		ctx, client, accessKey := newAccessKeyClient(t)
+
+		req := newAccessKeyRequest(t, accessKey.Key, testBodyContents, time.Now())
+		req.Body = io.NopCloser(bytes.NewReader([]byte(`{"test_field":"other_value"}`)))
+		_, err := client.AuthenticateAccessKey(ctx, req)
+		requireAccessKeyAuthError(t, err, AccessKeyAuthInvalidSignature, ErrAuhHashMismatch)
+	})
+
+	t.Run("invalid signature", func(t *testing.T) {
+		ctx, client, accessKey := newAccessKeyClient(t)
+
+		// Signed by an unknown key
+		other, err := bitcoin.CreatePrivateKeyString()
+		require.NoError(t, err)
+		req := newAccessKeyRequest(t, other, testBodyContents, time.Now())
+		_, err = client.AuthenticateAccessKey(ctx, req)
+		requireAccessKeyAuthError(t, err, AccessKeyAuthUnknownKey, ErrUnknownAccessKey)
+
+		// Signature of the key, signing another nonce
+		req = newAccessKeyRequest(t, accessKey.Key, testBodyContents, time.Now())
+		req.Header.Set(AuthHeaderNonce, "other-nonce")
+		_, err = client.AuthenticateAccessKey(ctx, req)
+		requireAccessKeyAuthError(t, err, AccessKeyAuthInvalidSignature, ErrSignatureInvalid)
+	})
+
+	t.Run("expired request", func(t *testing.T) {
+		ctx, client, accessKey := newAccessKeyClient(t)
+
+		req := newAccessKeyRequest(t, accessKey.Key, testBodyContents, time.Now().Add(-AuthSignatureTTL-time.Second))
+		_, err := client.AuthenticateAccessKey(ctx, req)
+		requireAccessKeyAuthError(t, err, AccessKeyAuthExpired, ErrSignatureExpired)
+
+		// Too far in the future
+		req = newAccessKeyRequest(t, accessKey.Key, testBodyContents, time.Now().Add(AuthSignatureTTL+time.Second))
+		_, err = client.AuthenticateAccessKey(ctx, req)
+		requireAccessKeyAuthError(t, err, AccessKeyAuthExpired, ErrSignatureExpired)
+	})
+
+	t.Run("revoked access key", func(t *testing.T) {
+		ctx, client, accessKey := newAccessKeyClient(t)
+
+		_, err := client.RevokeAccessKey(ctx, testXPub, accessKey.ID, client.DefaultModelOptions()...)
+		require.NoError(t, err)
+
+		req := newAccessKeyRequest(t, accessKey.Key, testBodyContents, time.Now())
+		_, err = client.AuthenticateAccessKey(ctx, req)
+		requireAccessKeyAuthError(t, err, AccessKeyAuthRevoked, ErrAccessKeyRevoked)
+	})
+
+	t.Run("replayed request", func(t *testing.T) {
+		ctx, client, accessKey := newAccessKeyClient(t)
+
+		req := newAccessKeyRequest(t, accessKey.Key, testBodyContents, time.Now())
+		_, err := client.AuthenticateAccessKey(ctx, req)
+		require.NoError(t, err)
+
+		// Same headers and body
+		replay := req.Clone(ctx)
+		replay.Body = io.NopCloser(bytes.NewReader([]byte(testBodyContents)))
+		_, err = client.AuthenticateAccessKey(ctx, replay)
+		requireAccessKeyAuthError(t, err, AccessKeyAuthReplayed, ErrAuthReplayed)
+
+		// A new nonce is accepted
+		_, err = client.AuthenticateAccessKey(ctx, newAccessKeyRequest(t, accessKey.Key, testBodyContents, time.Now()))
+		require.NoError(t, err)
+	})
+
+	t.Run("cachestore failure is not a replay", func(t *testing.T) {
+		cs, err := cachestore.NewClient(context.Background(), cachestore.WithFreeCache())
+		require.NoError(t, err)
+		unavailable := &unavailableCachestore{ClientInterface: cs}
+
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, false,
+			WithCustomTaskManager(&taskManagerMockBase{}), WithCustomCachestore(unavailable),
+		)
+		t.Cleanup(deferMe)
+		_, err = client.NewXpub(ctx, testXPub, client.DefaultModelOptions()...)
+		require.NoError(t, err)
+		var accessKey *AccessKey
+		accessKey, err = client.NewAccessKey(ctx, testXPub, client.DefaultModelOptions()...)
+		require.NoError(t, err)
+
+		unavailable.down = true
+		_, err = client.AuthenticateAccessKey(ctx, newAccessKeyRequest(t, accessKey.Key, testBodyContents, time.Now()))
+		require.ErrorIs(t, err, errCachestoreDown)
+		var authErr *AccessKeyAuthError
+		assert.False(t, errors.As(err, &authErr))
+	})
+
+	t.Run("body too large", func(t *testing.T) {
+		ctx, client, accessKey := newAccessKeyClient(t)
+
+		req := newAccessKeyRequest(t, accessKey.Key, testBodyContents, time.Now())
+		req.Body = io.NopCloser(bytes.NewReader(make([]byte, AuthMaxBodySize+1)))
+		_, err := client.AuthenticateAccessKey(ctx, req)
+		requireAccessKeyAuthError(t, err, AccessKeyAuthMalformed, ErrAuthBodyTooLarge)
+	})
+}
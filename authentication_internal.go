@@ -34,6 +34,9 @@ const (
 
 	// AuthSignatureTTL is the max TTL for a signature to be valid
 	AuthSignatureTTL = 20 * time.Second
+
+	// AuthMaxBodySize is the max size (in bytes) of the body of a signed request (read before authenticating)
+	AuthMaxBodySize = 10 << 20
 )
 
 // AuthPayload is the authentication payload for checking or creating a signature
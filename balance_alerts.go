@@ -0,0 +1,216 @@
+package bux
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/BuxOrg/bux/notifications"
+	"github.com/mrz1836/go-datastore"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Directions of the balance threshold crossings (see EventTypeBalanceThreshold)
+const (
+	// BalanceAlertDown is when the balance dropped below the low threshold (floor)
+	BalanceAlertDown = "down"
+
+	// BalanceAlertUp is when the balance exceeded the high threshold (ceiling)
+	BalanceAlertUp = "up"
+)
+
+// States of the balance alerts of an xPub (see Xpub.BalanceAlertState, empty = within the thresholds)
+const (
+	balanceAlertStateHigh = "high" // Fired above the high threshold, not recovered yet
+	balanceAlertStateLow  = "low"  // Fired below the low threshold, not recovered yet
+)
+
+// SetXpubBalanceAlerts will set the balance thresholds of the xPub (nil = no alert)
+//
+// The notifications.EventTypeBalanceThreshold notification fires when the balance drops below the low threshold
+// or exceeds the high threshold. It only fires again after the balance recovered past the threshold by the margin
+// (see WithBalanceAlertMargin).
+func (c *Client) SetXpubBalanceAlerts(ctx context.Context, xPubID string, low, high *uint64) (*Xpub, error) {
+
+	// Check for existing NewRelic transaction
+	ctx = c.GetOrStartTxn(ctx, "set_xpub_balance_alerts")
+
+	// The floor must be below the ceiling
+	if low != nil && high != nil && *low >= *high {
+		return nil, fmt.Errorf("%w: low %d must be below high %d", ErrInvalidBalanceAlerts, *low, *high)
+	}
+
+	// Get the xPub
+	xPub, err := c.GetXpubByID(ctx, xPubID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Set the thresholds
+	xPub.BalanceAlertLow = low
+	xPub.BalanceAlertHigh = high
+
+	// Save the model (also updates the cache)
+	if err = xPub.Save(ctx); err != nil {
+		return nil, err
+	}
+
+	// The new thresholds are evaluated from scratch (on the next balance change)
+	if _, err = xPub.setBalanceAlertState(ctx, nil, ""); err != nil {
+		return nil, err
+	}
+
+	// Return the model
+	return xPub, nil
+}
+
+// checkBalanceAlerts will fire the balance threshold notification if the balance (after the change by the
+// transaction) crossed a threshold of the xPub
+//
+// The state of the alerts is persisted on the xPub (conditional update), a crossing is only notified by the
+// instance changing the state. Failures are logged, the balance change is never failed by the alerts
+func (m *Xpub) checkBalanceAlerts(ctx context.Context, txID string) {
+	client := m.Client()
+	if client == nil || (m.BalanceAlertLow == nil && m.BalanceAlertHigh == nil) {
+		return
+	}
+
+	// The state of the model can be stale (IE: loaded from the cache), it is reloaded once if changed in between
+	state := m.BalanceAlertState
+	for attempt := 0; attempt < 2; attempt++ {
+		next, direction := nextBalanceAlertState(
+			state, m.CurrentBalance, m.BalanceAlertLow, m.BalanceAlertHigh, client.BalanceAlertMargin(),
+		)
+		if next == state {
+			m.BalanceAlertState = state
+			return
+		}
+
+		updated, err := m.setBalanceAlertState(ctx, &state, next)
+		if err != nil {
+			client.Logger().Error(ctx, "failed saving the balance alert state of xpub "+m.ID+": "+err.Error())
+			return
+		} else if updated {
+			if len(direction) > 0 {
+				m.notifyBalanceAlert(ctx, txID, direction)
+			}
+			return
+		}
+
+		var stored *Xpub
+		if stored, err = getXpubByID(ctx, m.ID, append(m.GetOptions(false), SkipCache())...); err != nil {
+			client.Logger().Error(ctx, "failed getting the balance alert state of xpub "+m.ID+": "+err.Error())
+			return
+		} else if stored == nil {
+			return
+		}
+		state = stored.BalanceAlertState
+	}
+}
+
+// notifyBalanceAlert will notify the crossing of the threshold in the direction
+func (m *Xpub) notifyBalanceAlert(ctx context.Context, txID, direction string) {
+	event := &notifications.BalanceThresholdEventV1{
+		Balance:   m.CurrentBalance,
+		Direction: direction,
+		TxID:      txID,
+		XpubID:    m.ID,
+	}
+	if direction == BalanceAlertDown {
+		event.Threshold = *m.BalanceAlertLow
+	} else {
+		event.Threshold = *m.BalanceAlertHigh
+	}
+	m.Client().Logger().Warn(ctx, fmt.Sprintf(
+		"[BALANCE] xpub %s balance %d crossed the threshold %d (%s)", m.ID, event.Balance, event.Threshold, direction,
+	))
+
+	// The event is notified for the xPub (suppressed and muted like the other events of the xPub)
+	notify(ctx, notifications.EventTypeBalanceThreshold, &balanceThresholdEvent{Xpub: m, event: event})
+}
+
+// balanceThresholdEvent is the balance threshold event of an xPub (the payload is the event, see versionedPayload)
+type balanceThresholdEvent struct {
+	*Xpub
+	event *notifications.BalanceThresholdEventV1
+}
+
+// setBalanceAlertState will set the state of the balance alerts of the xPub if the stored state is the
+// expected state (nil = any state)
+//
+// Returns false if the stored state changed in between (not the expected state)
+func (m *Xpub) setBalanceAlertState(ctx context.Context, expected *string, state string) (bool, error) {
+	ds := m.Client().Datastore()
+	tableName := ds.GetTableName(tableXPubs)
+
+	var updated bool
+	if ds.Engine() == datastore.MongoDB {
+		filter := bson.M{"_id": m.ID}
+		if expected != nil {
+			filter[balanceAlertStateField] = *expected
+			if len(*expected) == 0 {
+				filter[balanceAlertStateField] = bson.M{"$in": bson.A{nil, ""}}
+			}
+		}
+		result, err := ds.GetMongoCollectionByTableName(tableName).UpdateOne(
+			ctx, filter, bson.M{"$set": bson.M{balanceAlertStateField: state}},
+		)
+		if err != nil {
+			return false, err
+		}
+		updated = result.MatchedCount > 0
+	} else {
+		db := gormDB(ds)
+		query := db.WithContext(ctx).Table(tableName).Where(map[string]interface{}{idField: m.ID})
+		if expected != nil {
+			condition := db.Where(map[string]interface{}{balanceAlertStateField: *expected})
+			if len(*expected) == 0 {
+				condition = condition.Or(map[string]interface{}{balanceAlertStateField: nil})
+			}
+			query = query.Where(condition)
+		}
+		tx := query.UpdateColumn(balanceAlertStateField, state)
+		if tx.Error != nil {
+			return false, tx.Error
+		}
+		updated = tx.RowsAffected > 0
+	}
+
+	// MySQL does not count the unchanged rows
+	if !updated && expected != nil && *expected != state {
+		return false, nil
+	}
+	m.BalanceAlertState = state
+	return true, nil
+}
+
+// nextBalanceAlertState will return the next alert state of the balance and the direction of the crossing
+// (empty if no alert fires)
+//
+// A fired alert only fires again after the balance recovered past the threshold by the margin (hysteresis)
+func nextBalanceAlertState(state string, balance uint64, low, high *uint64, margin uint64) (string, string) {
+	switch {
+	case low != nil && balance < *low:
+		if state != balanceAlertStateLow {
+			return balanceAlertStateLow, BalanceAlertDown
+		}
+		return state, ""
+	case high != nil && balance > *high:
+		if state != balanceAlertStateHigh {
+			return balanceAlertStateHigh, BalanceAlertUp
+		}
+		return state, ""
+	}
+
+	// Within the thresholds: recovered once past the margin
+	switch state {
+	case balanceAlertStateLow:
+		if low == nil || balance >= *low+margin {
+			return "", ""
+		}
+	case balanceAlertStateHigh:
+		if high == nil || balance+margin <= *high {
+			return "", ""
+		}
+	}
+	return state, ""
+}
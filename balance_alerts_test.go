@@ -0,0 +1,161 @@
+package bux
+
+import (
+	"testing"
+	"time"
+
+	"github.com/BuxOrg/bux/notifications"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test_nextBalanceAlertState will test the hysteresis of the balance alerts
+func Test_nextBalanceAlertState(t *testing.T) {
+	t.Parallel()
+
+	low, high := uint64(1000), uint64(5000)
+
+	t.Run("crossing down, recovering and crossing again", func(t *testing.T) {
+		state, direction := nextBalanceAlertState("", 999, &low, &high, 100)
+		assert.Equal(t, balanceAlertStateLow, state)
+		assert.Equal(t, BalanceAlertDown, direction)
+
+		// Oscillating around the threshold (within the margin)
+		for _, balance := range []uint64{1000, 999, 1099, 500} {
+			state, direction = nextBalanceAlertState(state, balance, &low, &high, 100)
+			assert.Equal(t, balanceAlertStateLow, state)
+			assert.Empty(t, direction)
+		}
+
+		// Recovered past the margin
+		state, direction = nextBalanceAlertState(state, 1100, &low, &high, 100)
+		assert.Empty(t, state)
+		assert.Empty(t, direction)
+
+		state, direction = nextBalanceAlertState(state, 999, &low, &high, 100)
+		assert.Equal(t, balanceAlertStateLow, state)
+		assert.Equal(t, BalanceAlertDown, direction)
+	})
+
+	t.Run("crossing up", func(t *testing.T) {
+		state, direction := nextBalanceAlertState("", 5001, &low, &high, 100)
+		assert.Equal(t, balanceAlertStateHigh, state)
+		assert.Equal(t, BalanceAlertUp, direction)
+
+		state, direction = nextBalanceAlertState(state, 4901, &low, &high, 100)
+		assert.Equal(t, balanceAlertStateHigh, state)
+		assert.Empty(t, direction)
+
+		state, direction = nextBalanceAlertState(state, 4900, &low, &high, 100)
+		assert.Empty(t, state)
+		assert.Empty(t, direction)
+	})
+
+	t.Run("from low to high", func(t *testing.T) {
+		state, direction := nextBalanceAlertState(balanceAlertStateLow, 6000, &low, &high, 100)
+		assert.Equal(t, balanceAlertStateHigh, state)
+		assert.Equal(t, BalanceAlertUp, direction)
+	})
+
+	t.Run("threshold removed", func(t *testing.T) {
+		state, direction := nextBalanceAlertState(balanceAlertStateLow, 0, nil, &high, 100)
+		assert.Empty(t, state)
+		assert.Empty(t, direction)
+	})
+}
+
+// TestClient_SetXpubBalanceAlerts will test the method SetXpubBalanceAlerts() and the balance threshold notifications
+func TestClient_SetXpubBalanceAlerts(t *testing.T) {
+	t.Parallel()
+
+	ctx, client, deferMe := CreateTestSQLiteClient(t, false, true,
+		WithCustomTaskManager(&taskManagerMockBase{}),
+		WithBalanceAlertMargin(500),
+	)
+	defer deferMe()
+
+	fixtures := NewFixtures(t, client).WithXpub(10000)
+	mock := notifications.NewMockClient()
+	client.SetNotificationsClient(mock)
+
+	low, high := uint64(5000), uint64(20000)
+	_, err := client.SetXpubBalanceAlerts(ctx, fixtures.Xpub.ID, &high, &low)
+	require.ErrorIs(t, err, ErrInvalidBalanceAlerts)
+
+	xPub, err := client.SetXpubBalanceAlerts(ctx, fixtures.Xpub.ID, &low, &high)
+	require.NoError(t, err)
+	require.NotNil(t, xPub.BalanceAlertLow)
+	assert.Equal(t, low, *xPub.BalanceAlertLow)
+	assert.Equal(t, high, *xPub.BalanceAlertHigh)
+
+	// Crossing down
+	xPub, err = client.GetXpubByID(ctx, fixtures.Xpub.ID)
+	require.NoError(t, err)
+	require.NoError(t, xPub.incrementBalance(ctx, -6000, testTxID, BalanceEventOutgoing))
+	events := eventsOfType(mock, notifications.EventTypeBalanceThreshold, 1)
+	require.Len(t, events, 1)
+	assert.Equal(t, xPub.ID, events[0].ID)
+	payload, ok := events[0].Model.(*notifications.BalanceThresholdEventV1)
+	require.True(t, ok)
+	assert.Equal(t, BalanceAlertDown, payload.Direction)
+	assert.Equal(t, uint64(4000), payload.Balance)
+	assert.Equal(t, low, payload.Threshold)
+	assert.Equal(t, testTxID, payload.TxID)
+
+	// The state is persisted, a stale model (IE: another instance) does not fire the alert again
+	stored, err := getXpubByID(ctx, xPub.ID, append(client.DefaultModelOptions(), SkipCache())...)
+	require.NoError(t, err)
+	assert.Equal(t, balanceAlertStateLow, stored.BalanceAlertState)
+	stored.BalanceAlertState = ""
+	stored.checkBalanceAlerts(ctx, testTxID)
+	assert.Equal(t, balanceAlertStateLow, stored.BalanceAlertState)
+	assert.Len(t, eventsOfType(mock, notifications.EventTypeBalanceThreshold, 2), 1)
+
+	// Back above the floor, within the margin
+	require.NoError(t, xPub.incrementBalance(ctx, 1200, testTxID2, BalanceEventIncoming))
+	require.NoError(t, xPub.incrementBalance(ctx, -300, testTxID3, BalanceEventOutgoing))
+	assert.Len(t, eventsOfType(mock, notifications.EventTypeBalanceThreshold, 2), 1)
+
+	// Recovered past the margin
+	require.NoError(t, xPub.incrementBalance(ctx, 600, testTxID2, BalanceEventIncoming))
+	assert.Equal(t, uint64(5500), xPub.CurrentBalance)
+	assert.Len(t, eventsOfType(mock, notifications.EventTypeBalanceThreshold, 2), 1)
+
+	// Crossing down again
+	require.NoError(t, xPub.incrementBalance(ctx, -1000, testTxID3, BalanceEventOutgoing))
+	events = eventsOfType(mock, notifications.EventTypeBalanceThreshold, 2)
+	require.Len(t, events, 2)
+	payload, ok = events[1].Model.(*notifications.BalanceThresholdEventV1)
+	require.True(t, ok)
+	assert.Equal(t, BalanceAlertDown, payload.Direction)
+	assert.Equal(t, uint64(4500), payload.Balance)
+
+	// Crossing up
+	require.NoError(t, xPub.incrementBalance(ctx, 20000, testTxID, BalanceEventIncoming))
+	events = eventsOfType(mock, notifications.EventTypeBalanceThreshold, 3)
+	require.Len(t, events, 3)
+	payload, ok = events[2].Model.(*notifications.BalanceThresholdEventV1)
+	require.True(t, ok)
+	assert.Equal(t, BalanceAlertUp, payload.Direction)
+	assert.Equal(t, uint64(24500), payload.Balance)
+	assert.Equal(t, high, payload.Threshold)
+
+	// Removing the alerts
+	xPub, err = client.SetXpubBalanceAlerts(ctx, fixtures.Xpub.ID, nil, nil)
+	require.NoError(t, err)
+	assert.Nil(t, xPub.BalanceAlertLow)
+	assert.Empty(t, xPub.BalanceAlertState)
+	require.NoError(t, xPub.incrementBalance(ctx, -24000, testTxID2, BalanceEventOutgoing))
+	assert.Len(t, eventsOfType(mock, notifications.EventTypeBalanceThreshold, 4), 3)
+
+	// Muted like the other events of the xPub
+	_, err = client.SetXpubBalanceAlerts(ctx, fixtures.Xpub.ID, &low, nil)
+	require.NoError(t, err)
+	_, err = client.MuteNotifications(ctx, fixtures.Xpub.ID, time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	xPub, err = client.GetXpubByID(ctx, fixtures.Xpub.ID)
+	require.NoError(t, err)
+	require.NoError(t, xPub.incrementBalance(ctx, -1, testTxID3, BalanceEventOutgoing))
+	assert.Equal(t, balanceAlertStateLow, xPub.BalanceAlertState)
+	assert.Len(t, eventsOfType(mock, notifications.EventTypeBalanceThreshold, 4), 3)
+}
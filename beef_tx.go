@@ -5,6 +5,10 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"sort"
+
+	"github.com/BuxOrg/bux/chainstate"
+	"github.com/libsv/go-bt/v2"
 )
 
 const maxBeefVer = uint32(0xFFFF) // value from BRC-62
@@ -21,6 +25,13 @@ func ToBeefHex(ctx context.Context, tx *Transaction) (string, error) {
 		return "", fmt.Errorf("ToBeefHex() error: %w", err)
 	}
 
+	if tx.client != nil {
+		tx.client.Logger().Info(ctx, fmt.Sprintf(
+			"ToBeefHex(): built BEEF for TxID: %s, transactions: %d, ancestry depth: %d, size: %d bytes",
+			tx.ID, len(beef.transactions), beef.ancestryDepth, len(beefBytes),
+		))
+	}
+
 	return hex.EncodeToString(beefBytes), nil
 }
 
@@ -28,6 +39,7 @@ type beefTx struct {
 	version             uint32
 	compoundMerklePaths CMPSlice
 	transactions        []*Transaction
+	ancestryDepth       int
 }
 
 func newBeefTx(ctx context.Context, version uint32, tx *Transaction) (*beefTx, error) {
@@ -40,30 +52,34 @@ func newBeefTx(ctx context.Context, version uint32, tx *Transaction) (*beefTx, e
 		return nil, err
 	}
 
-	if err = validateCompoundMerklePathes(tx.draftTransaction.CompoundMerklePathes); err != nil {
-		return nil, err
+	// get inputs parent transactions (and any unconfirmed ancestors)
+	maxDepth, maxTxs := beefAncestryLimits(tx.client)
+	transactions, depth, err := getAncestorTransactions(ctx, tx, maxDepth, maxTxs)
+	if err != nil {
+		return nil, fmt.Errorf("retrieve input parent transaction failed: %w", err)
 	}
 
-	// get inputs parent transactions
-	inputs := tx.draftTransaction.Configuration.Inputs
-	transactions := make([]*Transaction, 0, len(inputs)+1)
-
-	for _, input := range inputs {
-		prevTxs, err := getParentTransactionsForInput(ctx, tx.client, input)
-		if err != nil {
-			return nil, fmt.Errorf("retrieve input parent transaction failed: %w", err)
-		}
-
-		transactions = append(transactions, prevTxs...)
+	// the mined ancestors (at any depth) are proven by the compound merkle paths
+	compoundMerklePaths, err := ancestryCompoundMerklePaths(transactions)
+	if err != nil {
+		return nil, err
+	}
+	if err = validateCompoundMerklePathes(compoundMerklePaths); err != nil {
+		return nil, err
 	}
 
 	// add current transaction
 	transactions = append(transactions, tx)
 
+	if transactions, err = kahnTopologicalSortTransactions(transactions); err != nil {
+		return nil, err
+	}
+
 	beef := &beefTx{
 		version:             version,
-		compoundMerklePaths: tx.draftTransaction.CompoundMerklePathes,
-		transactions:        kahnTopologicalSortTransactions(transactions),
+		compoundMerklePaths: compoundMerklePaths,
+		transactions:        transactions,
+		ancestryDepth:       depth,
 	}
 
 	return beef, nil
@@ -99,19 +115,161 @@ func validateCompoundMerklePathes(compountedPaths CMPSlice) error {
 	return nil
 }
 
-func getParentTransactionsForInput(ctx context.Context, client ClientInterface, input *TransactionInput) ([]*Transaction, error) {
-	inputTx, err := client.GetTransactionByID(ctx, input.UtxoPointer.TransactionID)
-	if err != nil {
+// beefAncestryLimits will return the configured max ancestry depth and number of transactions
+func beefAncestryLimits(client ClientInterface) (maxDepth, maxTxs int) {
+	maxDepth, maxTxs = defaultBeefMaxAncestryDepth, defaultBeefMaxAncestryTxs
+	if client == nil {
+		return
+	}
+	if config := client.GetPaymailConfig(); config != nil {
+		if config.BeefMaxAncestryDepth > 0 {
+			maxDepth = config.BeefMaxAncestryDepth
+		}
+		if config.BeefMaxAncestryTxs > 0 {
+			maxTxs = config.BeefMaxAncestryTxs
+		}
+	}
+	return
+}
+
+// getAncestorTransactions will walk (iteratively) the inputs of the transaction until mined ancestors are found
+//
+// The walk stops at every ancestor with a merkle proof, the ancestors that are not stored are fetched from
+// chainstate (with their merkle proof if mined). Returns the ancestors and the deepest level of ancestry that was reached
+func getAncestorTransactions(ctx context.Context, tx *Transaction, maxDepth, maxTxs int) ([]*Transaction, int, error) {
+	type ancestor struct {
+		txID  string
+		depth int
+	}
+
+	inputs := tx.draftTransaction.Configuration.Inputs
+	queue := make([]ancestor, 0, len(inputs))
+	for _, input := range inputs {
+		queue = append(queue, ancestor{txID: input.UtxoPointer.TransactionID, depth: 1})
+	}
+
+	// the transaction itself is marked as visited, a parent pointing back to it would be a cycle
+	visited := map[string]bool{tx.ID: true}
+	transactions := make([]*Transaction, 0, len(inputs))
+	reachedDepth := 0
+
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+
+		if visited[current.txID] {
+			continue
+		}
+		visited[current.txID] = true
+
+		if current.depth > maxDepth {
+			return nil, current.depth, fmt.Errorf("%w: depth %d, limit %d (tx.ID: %s)",
+				ErrBeefAncestryTooDeep, current.depth, maxDepth, tx.ID)
+		}
+		if len(transactions) >= maxTxs {
+			return nil, current.depth, fmt.Errorf("%w: limit %d (tx.ID: %s)",
+				ErrBeefAncestryTooLarge, maxTxs, tx.ID)
+		}
+
+		inputTx, err := getAncestorTransaction(ctx, tx, current.txID)
+		if err != nil {
+			return nil, current.depth, err
+		}
+
+		transactions = append(transactions, inputTx)
+		if current.depth > reachedDepth {
+			reachedDepth = current.depth
+		}
+
+		// mined transactions end the ancestry (proven by the compound merkle path)
+		if isMinedWithProof(inputTx) {
+			continue
+		}
+
+		var parentIDs []string
+		if parentIDs, err = inputTransactionIDs(inputTx); err != nil {
+			return nil, current.depth, err
+		}
+		for _, parentID := range parentIDs {
+			queue = append(queue, ancestor{txID: parentID, depth: current.depth + 1})
+		}
+	}
+
+	return transactions, reachedDepth, nil
+}
+
+// getAncestorTransaction will get the stored ancestor, or fetch it from chainstate if it is not stored
+// (IE: the parent of a co-funded input)
+//
+// A mined ancestor without a merkle proof gets the proof from chainstate
+func getAncestorTransaction(ctx context.Context, tx *Transaction, txID string) (*Transaction, error) {
+	ancestorTx, err := tx.client.GetTransactionByID(ctx, txID)
+	if errors.Is(err, ErrMissingTransaction) {
+		var txHex string
+		if txHex, err = tx.client.Chainstate().GetRawTransaction(ctx, txID); err != nil {
+			return nil, fmt.Errorf("%w: %s (tx.ID: %s)", ErrMissingTransaction, err.Error(), txID)
+		}
+		ancestorTx = newTransaction(txHex, tx.GetOptions(false)...)
+		if ancestorTx.ID != txID {
+			return nil, fmt.Errorf("%w: raw transaction does not match (tx.ID: %s)", ErrMissingTransaction, txID)
+		}
+	} else if err != nil {
 		return nil, err
+	} else if isMinedWithProof(ancestorTx) || ancestorTx.BlockHeight == 0 {
+		return ancestorTx, nil
 	}
 
-	if err = hydrateTransaction(ctx, inputTx); err != nil {
+	// only mAPI currently provides merkle proof, so QueryTransaction should be used here
+	var txInfo *chainstate.TransactionInfo
+	if txInfo, err = tx.client.Chainstate().QueryTransaction(
+		ctx, txID, chainstate.RequiredOnChain, defaultQueryTxTimeout,
+	); err != nil && !errors.Is(err, chainstate.ErrTransactionNotFound) {
 		return nil, err
+	} else if txInfo != nil && txInfo.BlockHeight > 0 && txInfo.MerkleProof != nil {
+		ancestorTx.setBlockInfo(txInfo.BlockHash, uint64(txInfo.BlockHeight))
+		ancestorTx.MerkleProof = MerkleProof(*txInfo.MerkleProof)
+	}
+	return ancestorTx, nil
+}
+
+// inputTransactionIDs will return the IDs of the parent transactions (from the inputs of the transaction hex)
+func inputTransactionIDs(tx *Transaction) ([]string, error) {
+	parsedTx := tx.TransactionBase.parsedTx
+	if parsedTx == nil {
+		var err error
+		if parsedTx, err = bt.NewTxFromString(tx.Hex); err != nil {
+			return nil, fmt.Errorf("parsing the transaction failed: %w (tx.ID: %s)", err, tx.ID)
+		}
+	}
+	parentIDs := make([]string, 0, len(parsedTx.Inputs))
+	for _, input := range parsedTx.Inputs {
+		parentIDs = append(parentIDs, input.PreviousTxIDStr())
 	}
+	return parentIDs, nil
+}
 
-	if inputTx.MerkleProof.TxOrID != "" {
-		return []*Transaction{inputTx}, nil
+// ancestryCompoundMerklePaths will return the compound merkle paths of the mined transactions (one per block)
+func ancestryCompoundMerklePaths(transactions []*Transaction) (CMPSlice, error) {
+	merkleProofs := make(map[uint64][]MerkleProof)
+	heights := make([]uint64, 0)
+	for _, tx := range transactions {
+		if !isMinedWithProof(tx) {
+			continue
+		}
+		if _, ok := merkleProofs[tx.BlockHeight]; !ok {
+			heights = append(heights, tx.BlockHeight)
+		}
+		merkleProofs[tx.BlockHeight] = append(merkleProofs[tx.BlockHeight], tx.MerkleProof)
 	}
+	sort.Slice(heights, func(i, j int) bool { return heights[i] < heights[j] })
 
-	return nil, fmt.Errorf("transaction is not mined yet (tx.ID: %s)", inputTx.ID) // TODO: handle it in next iterration
+	compoundMerklePaths := make(CMPSlice, 0, len(heights))
+	for _, height := range heights {
+		cmp, err := CalculateCompoundMerklePath(merkleProofs[height])
+		if err != nil {
+			return nil, err
+		}
+		compoundMerklePaths = append(compoundMerklePaths, cmp)
+	}
+	return compoundMerklePaths, nil
 }
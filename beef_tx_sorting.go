@@ -1,6 +1,17 @@
 package bux
 
-func kahnTopologicalSortTransactions(transactions []*Transaction) []*Transaction {
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// kahnTopologicalSortTransactions will sort the transactions from the oldest to the newest (parents first)
+//
+// The order is deterministic: independent transactions are ordered by txid. Inputs from transactions
+// outside the set are ignored. An error is returned (with the txids) if some transactions could not
+// be sorted: a cycle (and its ancestors) or duplicated transactions.
+func kahnTopologicalSortTransactions(transactions []*Transaction) ([]*Transaction, error) {
 	txByID, incomingEdgesMap, zeroIncomingEdgeQueue := prepareSortStructures(transactions)
 	result := make([]*Transaction, 0, len(transactions))
 
@@ -11,11 +22,15 @@ func kahnTopologicalSortTransactions(transactions []*Transaction) []*Transaction
 		tx := txByID[txID]
 		result = append(result, tx)
 
-		zeroIncomingEdgeQueue = removeTxFromIncomingEdges(tx, incomingEdgesMap, zeroIncomingEdgeQueue)
+		zeroIncomingEdgeQueue = removeTxFromIncomingEdges(tx, txByID, incomingEdgesMap, zeroIncomingEdgeQueue)
+	}
+
+	if len(result) != len(transactions) {
+		return nil, fmt.Errorf("%w: %s", ErrTransactionsNotSortable, strings.Join(unsortedTxIDs(transactions, result), ", "))
 	}
 
 	reverseInPlace(result)
-	return result
+	return result, nil
 }
 
 func prepareSortStructures(dag []*Transaction) (txByID map[string]*Transaction, incomingEdgesMap map[string]int, zeroIncomingEdgeQueue []string) {
@@ -36,7 +51,7 @@ func prepareSortStructures(dag []*Transaction) (txByID map[string]*Transaction,
 
 func calculateIncomingEdges(inDegree map[string]int, txByID map[string]*Transaction) {
 	for _, tx := range txByID {
-		for _, input := range tx.draftTransaction.Configuration.Inputs {
+		for _, input := range sortableInputs(tx) {
 			inputUtxoTxID := input.UtxoPointer.TransactionID
 			if _, ok := txByID[inputUtxoTxID]; ok { // transaction can contains inputs we are not interested in
 				inDegree[inputUtxoTxID]++
@@ -54,12 +69,21 @@ func getTxWithZeroIncomingEdges(incomingEdgesMap map[string]int) []string {
 		}
 	}
 
+	// Map iteration is random, the queue is sorted for a deterministic result
+	// (descending, the result is reversed: independent transactions end up ordered by txid)
+	sort.Sort(sort.Reverse(sort.StringSlice(zeroIncomingEdgeQueue)))
+
 	return zeroIncomingEdgeQueue
 }
 
-func removeTxFromIncomingEdges(tx *Transaction, incomingEdgesMap map[string]int, zeroIncomingEdgeQueue []string) []string {
-	for _, input := range tx.draftTransaction.Configuration.Inputs {
+func removeTxFromIncomingEdges(tx *Transaction, txByID map[string]*Transaction, incomingEdgesMap map[string]int,
+	zeroIncomingEdgeQueue []string,
+) []string {
+	for _, input := range sortableInputs(tx) {
 		neighborID := input.UtxoPointer.TransactionID
+		if _, ok := txByID[neighborID]; !ok { // not counted in calculateIncomingEdges
+			continue
+		}
 		incomingEdgesMap[neighborID]--
 
 		if incomingEdgesMap[neighborID] == 0 {
@@ -70,6 +94,45 @@ func removeTxFromIncomingEdges(tx *Transaction, incomingEdgesMap map[string]int,
 	return zeroIncomingEdgeQueue
 }
 
+// sortableInputs returns the inputs of the transaction
+//
+// The inputs come from the draft, or from the raw hex when there is no draft (IE: RecordTransactions).
+// Mined ancestors may have neither.
+func sortableInputs(tx *Transaction) []*TransactionInput {
+	if tx.draftTransaction != nil {
+		return tx.draftTransaction.Configuration.Inputs
+	} else if tx.parsedTx == nil {
+		return nil
+	}
+	inputs := make([]*TransactionInput, 0, len(tx.parsedTx.Inputs))
+	for _, input := range tx.parsedTx.Inputs {
+		inputs = append(inputs, &TransactionInput{Utxo: Utxo{UtxoPointer: UtxoPointer{
+			TransactionID: input.PreviousTxIDStr(),
+			OutputIndex:   input.PreviousTxOutIndex,
+		}}})
+	}
+	return inputs
+}
+
+// unsortedTxIDs returns the (sorted) txids of the transactions missing from the result
+func unsortedTxIDs(transactions, result []*Transaction) []string {
+	sorted := make(map[string]int, len(result))
+	for _, tx := range result {
+		sorted[tx.ID]++
+	}
+
+	txIDs := make([]string, 0, len(transactions)-len(result))
+	for _, tx := range transactions {
+		if sorted[tx.ID] > 0 {
+			sorted[tx.ID]--
+			continue
+		}
+		txIDs = append(txIDs, tx.ID)
+	}
+	sort.Strings(txIDs)
+	return txIDs
+}
+
 func reverseInPlace(collection []*Transaction) {
 	for i, j := 0, len(collection)-1; i < j; i, j = i+1, j-1 {
 		collection[i], collection[j] = collection[j], collection[i]
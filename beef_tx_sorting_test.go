@@ -6,6 +6,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func Test_kahnTopologicalSortTransaction(t *testing.T) {
@@ -53,9 +54,10 @@ func Test_kahnTopologicalSortTransaction(t *testing.T) {
 			unsortedTxs := shuffleTransactions(tc.expectedSortedTransactions)
 
 			// when
-			sortedGraph := kahnTopologicalSortTransactions(unsortedTxs)
+			sortedGraph, err := kahnTopologicalSortTransactions(unsortedTxs)
 
 			// then
+			require.NoError(t, err)
 			for i, tx := range txsFromOldestToNewest {
 				assert.Equal(t, tx.ID, sortedGraph[i].ID)
 			}
@@ -63,6 +65,81 @@ func Test_kahnTopologicalSortTransaction(t *testing.T) {
 	}
 }
 
+func Test_kahnTopologicalSortTransaction_deterministic(t *testing.T) {
+	// independent transactions (and branches) must always be in the same order
+	txs := []*Transaction{
+		createTx("a"),
+		createTx("b"),
+		createTx("c", "a"),
+		createTx("d", "b"),
+		createTx("e"),
+		createTx("f", "c", "d"),
+		createTx("g", "200"),
+	}
+
+	expected, err := kahnTopologicalSortTransactions(txs)
+	require.NoError(t, err)
+	require.Len(t, expected, len(txs))
+
+	for i := 0; i < 50; i++ {
+		var sortedGraph []*Transaction
+		sortedGraph, err = kahnTopologicalSortTransactions(shuffleTransactions(txs))
+		require.NoError(t, err)
+		assert.Equal(t, txIDsOf(expected), txIDsOf(sortedGraph))
+	}
+}
+
+func Test_kahnTopologicalSortTransaction_errors(t *testing.T) {
+	t.Run("cycle", func(t *testing.T) {
+		txs := []*Transaction{
+			createTx("0"),
+			createTx("1", "0", "3"),
+			createTx("2", "1"),
+			createTx("3", "2"),
+			createTx("4", "0"),
+		}
+
+		sortedGraph, err := kahnTopologicalSortTransactions(txs)
+		require.ErrorIs(t, err, ErrTransactionsNotSortable)
+		assert.Nil(t, sortedGraph)
+		assert.Contains(t, err.Error(), ": 0, 1, 2, 3") // the ancestors of the cycle as well
+	})
+
+	t.Run("duplicated transaction", func(t *testing.T) {
+		txs := []*Transaction{
+			createTx("0"),
+			createTx("1", "0"),
+			createTx("1", "0"),
+		}
+
+		sortedGraph, err := kahnTopologicalSortTransactions(txs)
+		require.ErrorIs(t, err, ErrTransactionsNotSortable)
+		assert.Nil(t, sortedGraph)
+		assert.Contains(t, err.Error(), ": 1")
+	})
+
+	t.Run("missing parent is not an error", func(t *testing.T) {
+		// the parent "1" is not in the set (IE: already mined), the children are still sorted
+		txs := []*Transaction{
+			createTx("3", "2", "1"),
+			createTx("2", "1", "1"),
+			createTx("4", "1"),
+		}
+
+		sortedGraph, err := kahnTopologicalSortTransactions(txs)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"2", "3", "4"}, txIDsOf(sortedGraph))
+	})
+}
+
+func txIDsOf(txs []*Transaction) []string {
+	txIDs := make([]string, 0, len(txs))
+	for _, tx := range txs {
+		txIDs = append(txIDs, tx.ID)
+	}
+	return txIDs
+}
+
 func createTx(txID string, inputsTxIDs ...string) *Transaction {
 	inputs := make([]*TransactionInput, 0)
 	for _, inTxID := range inputsTxIDs {
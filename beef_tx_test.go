@@ -3,7 +3,9 @@ package bux
 import (
 	"context"
 	"testing"
+	"time"
 
+	"github.com/BuxOrg/bux/chainstate"
 	"github.com/libsv/go-bc"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -29,8 +31,6 @@ func Test_ToBeefHex(t *testing.T) {
 	})
 
 	t.Run("some parents txs are not mined yet", func(t *testing.T) {
-		// Error expected! this should be changed in the future. right now the test case has been written to make sure the system doesn't panic in such a situation
-
 		//given
 		ctx, client, deferMe := initSimpleTestCase(t)
 		defer deferMe()
@@ -39,14 +39,150 @@ func Test_ToBeefHex(t *testing.T) {
 		notMinedParentTx := createTxWithDraft(ctx, t, client, ancestorTx, false)
 
 		newTx := createTxWithDraft(ctx, t, client, notMinedParentTx, false)
+		require.NoError(t, hydrateTransaction(ctx, newTx))
+
+		//when
+		beef, err := newBeefTx(ctx, 1, newTx)
+
+		//then the mined grandparent is proven by its compound merkle path
+		require.NoError(t, err)
+		require.Len(t, beef.compoundMerklePaths, 1)
+		assert.Contains(t, beef.compoundMerklePaths[0][0], ancestorTx.MerkleProof.TxOrID)
+		assert.Equal(t, newTx.ID, beef.transactions[len(beef.transactions)-1].ID)
+		assert.GreaterOrEqual(t, beef.ancestryDepth, 2)
+	})
+
+	t.Run("unconfirmed ancestry exceeds the max depth", func(t *testing.T) {
+		//given
+		ctx, client, deferMe := initSimpleTestCase(t, WithPaymailBeefAncestryLimits(1, 0, false))
+		defer deferMe()
+
+		ancestorTx := addGrandpaTx(ctx, t, client)
+		notMinedParentTx := createTxWithDraft(ctx, t, client, ancestorTx, false)
+
+		newTx := createTxWithDraft(ctx, t, client, notMinedParentTx, false)
+		require.NoError(t, hydrateTransaction(ctx, newTx))
+		newTx.draftTransaction.CompoundMerklePathes = CMPSlice{{{ancestorTx.ID: 0}}}
 
 		//when
 		hex, err := ToBeefHex(ctx, newTx)
 
 		//then
-		assert.Error(t, err)
+		assert.ErrorIs(t, err, ErrBeefAncestryTooDeep)
 		assert.Empty(t, hex)
 	})
+
+	t.Run("parent tx not stored is fetched from chainstate", func(t *testing.T) {
+		//given
+		mock := chainstate.NewMockClient()
+		ctx, client, deferMe := initSimpleTestCase(t, WithCustomChainstate(mock))
+		defer deferMe()
+
+		ancestorTx := addGrandpaTx(ctx, t, client)
+		parentTx := createTxWithDraft(ctx, t, client, ancestorTx, true)
+		newTx := createTxWithDraft(ctx, t, client, parentTx, false)
+		require.NoError(t, hydrateTransaction(ctx, newTx))
+
+		// IE: the parent of a co-funded input
+		table := client.Datastore().GetTableName(tableTransactions)
+		require.NoError(t, client.Datastore().Execute(`DELETE FROM "`+table+`" WHERE "id" = '`+parentTx.ID+`'`).Error)
+		newTx.draftTransaction.CompoundMerklePathes = CMPSlice{{{parentTx.ID: 0}}}
+
+		//when
+		hex, err := ToBeefHex(ctx, newTx)
+
+		//then
+		require.ErrorIs(t, err, ErrMissingTransaction)
+		assert.Empty(t, hex)
+
+		//when
+		mock.RawTransactions = map[string]string{parentTx.ID: parentTx.Hex}
+		hex, err = ToBeefHex(ctx, newTx)
+
+		//then
+		require.NoError(t, err)
+		assert.NotEmpty(t, hex)
+	})
+}
+
+func Test_getAncestorTransactions(t *testing.T) {
+	t.Run("mined parent not stored gets the merkle proof from chainstate", func(t *testing.T) {
+		//given
+		mock := chainstate.NewMockClient()
+		ctx, client, deferMe := initSimpleTestCase(t, WithCustomChainstate(mock))
+		defer deferMe()
+
+		ancestorTx := addGrandpaTx(ctx, t, client)
+		parentTx := createTxWithDraft(ctx, t, client, ancestorTx, false)
+		newTx := createTxWithDraft(ctx, t, client, parentTx, false)
+		require.NoError(t, hydrateTransaction(ctx, newTx))
+
+		table := client.Datastore().GetTableName(tableTransactions)
+		require.NoError(t, client.Datastore().Execute(`DELETE FROM "`+table+`" WHERE "id" = '`+parentTx.ID+`'`).Error)
+		mock.RawTransactions = map[string]string{parentTx.ID: parentTx.Hex}
+		mock.QueryTransactionFunc = func(_ context.Context, id string, _ chainstate.RequiredIn, _ time.Duration) (*chainstate.TransactionInfo, error) {
+			return &chainstate.TransactionInfo{
+				BlockHash:   testBlockHash,
+				BlockHeight: 130,
+				ID:          id,
+				MerkleProof: &bc.MerkleProof{TxOrID: id, Nodes: []string{"n1", "n2"}},
+			}, nil
+		}
+
+		//when
+		transactions, depth, err := getAncestorTransactions(ctx, newTx, 10, 10)
+
+		//then the walk stops at the parent
+		require.NoError(t, err)
+		require.Len(t, transactions, 1)
+		assert.Equal(t, 1, depth)
+		assert.Equal(t, parentTx.ID, transactions[0].ID)
+		assert.Equal(t, uint64(130), transactions[0].BlockHeight)
+		assert.Equal(t, parentTx.ID, transactions[0].MerkleProof.TxOrID)
+	})
+
+	t.Run("raw transaction of another id", func(t *testing.T) {
+		//given
+		mock := chainstate.NewMockClient()
+		ctx, client, deferMe := initSimpleTestCase(t, WithCustomChainstate(mock))
+		defer deferMe()
+
+		ancestorTx := addGrandpaTx(ctx, t, client)
+		parentTx := createTxWithDraft(ctx, t, client, ancestorTx, false)
+		newTx := createTxWithDraft(ctx, t, client, parentTx, false)
+		require.NoError(t, hydrateTransaction(ctx, newTx))
+
+		table := client.Datastore().GetTableName(tableTransactions)
+		require.NoError(t, client.Datastore().Execute(`DELETE FROM "`+table+`" WHERE "id" = '`+parentTx.ID+`'`).Error)
+		mock.RawTransactions = map[string]string{parentTx.ID: ancestorTx.Hex}
+
+		//when
+		_, _, err := getAncestorTransactions(ctx, newTx, 10, 10)
+
+		//then
+		require.ErrorIs(t, err, ErrMissingTransaction)
+	})
+}
+
+func Test_beefAncestryLimits(t *testing.T) {
+	t.Run("defaults without a client", func(t *testing.T) {
+		maxDepth, maxTxs := beefAncestryLimits(nil)
+		assert.Equal(t, defaultBeefMaxAncestryDepth, maxDepth)
+		assert.Equal(t, defaultBeefMaxAncestryTxs, maxTxs)
+	})
+
+	t.Run("custom limits", func(t *testing.T) {
+		_, client, deferMe := CreateTestSQLiteClient(t, false, true,
+			WithCustomTaskManager(&taskManagerMockBase{}),
+			WithPaymailBeefAncestryLimits(3, 10, true),
+		)
+		defer deferMe()
+
+		maxDepth, maxTxs := beefAncestryLimits(client)
+		assert.Equal(t, 3, maxDepth)
+		assert.Equal(t, 10, maxTxs)
+		assert.True(t, client.GetPaymailConfig().BeefFallbackToBasic)
+	})
 }
 
 func addGrandpaTx(ctx context.Context, t *testing.T, client ClientInterface) *Transaction {
@@ -0,0 +1,344 @@
+package bux
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/BuxOrg/bux/chainstate"
+	"github.com/libsv/go-bc"
+	"github.com/libsv/go-bk/crypto"
+	"github.com/libsv/go-bt/v2"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// powLimitBits is the proof-of-work limit (compact bits) of the mainnet, testnet and STN
+const powLimitBits = "1d00ffff"
+
+// BlockHeaderProvider is a source of block headers for the header sync (see WithBlockHeaderSync)
+type BlockHeaderProvider interface {
+	// GetBlockHeaders will return the headers from the height (ascending, at most count), fewer (or none) at the tip
+	GetBlockHeaders(ctx context.Context, fromHeight uint32, count int) ([]*ProvidedBlockHeader, error)
+}
+
+// ProvidedBlockHeader is a block header returned by a BlockHeaderProvider
+type ProvidedBlockHeader struct {
+	Hash   string         `json:"hash"`   // Hash of the block (hex)
+	Height uint32         `json:"height"` // Height of the block
+	Header bc.BlockHeader `json:"header"` // Fields of the header
+}
+
+// BlockHeaderSyncResult is the result of a header sync (see SyncBlockHeaders)
+type BlockHeaderSyncResult struct {
+	Imported  int    `json:"imported"`   // Number of new headers
+	TipHash   string `json:"tip_hash"`   // Hash of the tip after the sync
+	TipHeight uint32 `json:"tip_height"` // Height of the tip after the sync
+	Truncated int    `json:"truncated"`  // Number of headers removed by a reorg at the tip
+}
+
+// blockHeaderSyncOptions holds the configuration of the header sync
+type blockHeaderSyncOptions struct {
+	batchSize     int                 // Headers requested from the provider at once
+	maxReorgDepth int                 // Max headers removed at the tip before the sync fails
+	powLimit      *big.Int            // Easiest target allowed (see powLimitBits)
+	provider      BlockHeaderProvider // Source of the headers (sync is disabled if not set)
+}
+
+// syncBlockHeaders will fetch the headers after the tip, validate and save them
+//
+// If the next header does not connect to the tip (reorg), the branch of the provider replaces the headers after
+// the fork point (see reorg) and the sync continues from the new tip
+func (o *blockHeaderSyncOptions) syncBlockHeaders(ctx context.Context, network chainstate.Network,
+	opts ...ModelOps,
+) (*BlockHeaderSyncResult, error) {
+	tip, err := getLastBlockHeader(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &BlockHeaderSyncResult{}
+	for {
+		from := uint32(0)
+		if tip != nil {
+			from = tip.Height + 1
+		}
+
+		var headers []*ProvidedBlockHeader
+		if headers, err = o.provider.GetBlockHeaders(ctx, from, o.batchSize); err != nil {
+			return nil, err
+		} else if len(headers) == 0 {
+			break
+		}
+
+		// Reorg at the tip: switch to the branch of the provider (validated before the tip is removed)
+		if tip != nil && headers[0].Header.HashPrevBlockStr() != tip.ID {
+			var truncated, imported int
+			if tip, truncated, imported, err = o.reorg(ctx, tip, network, opts...); err != nil {
+				return nil, err
+			}
+			result.Truncated += truncated
+			result.Imported += imported
+			continue
+		}
+
+		for _, header := range headers {
+			if err = validateBlockHeader(tip, header, network, o.powLimit); err != nil {
+				return nil, err
+			}
+			blockHeader := newBlockHeader(header.Hash, header.Height, header.Header, append(opts, New())...)
+			if err = blockHeader.Save(ctx); err != nil {
+				return nil, err
+			}
+			tip = blockHeader
+			result.Imported++
+		}
+
+		if len(headers) < o.batchSize {
+			break
+		}
+	}
+
+	if tip != nil {
+		result.TipHash = tip.ID
+		result.TipHeight = tip.Height
+	}
+	return result, nil
+}
+
+// reorg will replace the headers after the fork point with the branch of the provider, and return the new tip
+// with the number of removed and imported headers
+//
+// The fork point is searched back from the tip (up to the max reorg depth). The branch is validated header by header
+// from the fork point (prev-hash linkage, hash and proof-of-work) and must have more work than the removed headers,
+// nothing is removed otherwise
+func (o *blockHeaderSyncOptions) reorg(ctx context.Context, tip *BlockHeader, network chainstate.Network,
+	opts ...ModelOps,
+) (*BlockHeader, int, int, error) {
+	removed := []*BlockHeader{tip}
+	for {
+		if len(removed) > o.maxReorgDepth {
+			return nil, 0, 0, fmt.Errorf("%w: more than %d headers", ErrBlockHeaderReorgTooDeep, o.maxReorgDepth)
+		}
+		forkHeight := removed[len(removed)-1].Height
+		if forkHeight == 0 {
+			return nil, 0, 0, fmt.Errorf("%w: the genesis block does not match", ErrBlockHeaderNetworkMismatch)
+		}
+		forkPoint, err := getBlockHeaderByHeight(ctx, forkHeight-1, opts...)
+		if err != nil {
+			return nil, 0, 0, err
+		} else if forkPoint == nil {
+			return nil, 0, 0, fmt.Errorf("%w: missing header at %d", ErrInvalidBlockHeader, forkHeight-1)
+		}
+
+		// The branch of the provider from the fork point (at least one header more than the removed headers)
+		var branch []*ProvidedBlockHeader
+		count := o.batchSize
+		if count <= len(removed) {
+			count = len(removed) + 1
+		}
+		if branch, err = o.provider.GetBlockHeaders(ctx, forkHeight, count); err != nil {
+			return nil, 0, 0, err
+		} else if len(branch) == 0 || branch[0].Header.HashPrevBlockStr() != forkPoint.ID {
+			removed = append(removed, forkPoint)
+			continue
+		}
+
+		// Validate the whole branch before anything is removed
+		previous := forkPoint
+		branchWork := new(big.Int)
+		for _, header := range branch {
+			if err = validateBlockHeader(previous, header, network, o.powLimit); err != nil {
+				return nil, 0, 0, err
+			}
+			branchWork.Add(branchWork, blockWork(header.Header.BitsStr()))
+			previous = &BlockHeader{Bits: header.Header.BitsStr(), Height: header.Height, ID: header.Hash}
+		}
+		removedWork := new(big.Int)
+		for _, header := range removed {
+			removedWork.Add(removedWork, blockWork(header.Bits))
+		}
+		if branchWork.Cmp(removedWork) <= 0 {
+			return nil, 0, 0, fmt.Errorf(
+				"%w: %d headers from %d", ErrBlockHeaderReorgInsufficientWork, len(branch), forkHeight,
+			)
+		}
+
+		// Switch to the branch
+		if err = deleteBlockHeadersFrom(ctx, forkHeight, opts...); err != nil {
+			return nil, 0, 0, err
+		}
+		tip = forkPoint
+		for _, header := range branch {
+			blockHeader := newBlockHeader(header.Hash, header.Height, header.Header, append(opts, New())...)
+			if err = blockHeader.Save(ctx); err != nil {
+				return nil, 0, 0, err
+			}
+			tip = blockHeader
+		}
+		return tip, len(removed), len(branch), nil
+	}
+}
+
+// validateBlockHeader will check that the header connects to the previous header (nil for the genesis block),
+// the hash and the proof-of-work against the target of the bits, and that the difficulty transition is allowed
+//
+// The minimum difficulty blocks (the powLimit) are accepted on the testnet and the STN
+func validateBlockHeader(previous *BlockHeader, header *ProvidedBlockHeader, network chainstate.Network,
+	powLimit *big.Int,
+) error {
+
+	// Continuity of the chain
+	if previous == nil {
+		if header.Height != 0 || header.Hash != networkGenesisHash(network) {
+			return fmt.Errorf("%w: unexpected genesis block %s", ErrBlockHeaderNetworkMismatch, header.Hash)
+		}
+	} else if header.Height != previous.Height+1 {
+		return fmt.Errorf("%w: expected height %d, got %d", ErrInvalidBlockHeader, previous.Height+1, header.Height)
+	} else if header.Header.HashPrevBlockStr() != previous.ID {
+		return fmt.Errorf("%w: %s does not connect to %s", ErrInvalidBlockHeader, header.Hash, previous.ID)
+	}
+
+	// The hash of the header
+	hash := bt.ReverseBytes(crypto.Sha256d(header.Header.Bytes()))
+	if hex.EncodeToString(hash) != header.Hash {
+		return fmt.Errorf("%w: hash mismatch %s, expected %s", ErrInvalidBlockHeader, header.Hash, hex.EncodeToString(hash))
+	}
+
+	// The proof-of-work: the hash is not above the target (the genesis block is not checked against the network limit)
+	target, err := bc.ExpandTargetFromAsInt(header.Header.BitsStr())
+	if err != nil || target.Sign() <= 0 {
+		return fmt.Errorf("%w: invalid bits %s", ErrInvalidBlockHeader, header.Header.BitsStr())
+	} else if new(big.Int).SetBytes(hash).Cmp(target) > 0 {
+		return fmt.Errorf("%w: insufficient proof-of-work %s", ErrInvalidBlockHeader, header.Hash)
+	} else if previous == nil {
+		return nil
+	} else if target.Cmp(powLimit) > 0 {
+		return fmt.Errorf("%w: target above the network limit %s", ErrInvalidBlockHeader, header.Hash)
+	}
+
+	// The difficulty transition (the target changes at most 4x between blocks)
+	// Headers saved without parsable bits (IE: by older versions) are not checked
+	previousTarget := blockHeaderTarget(previous.Bits)
+	if previousTarget == nil {
+		return nil
+	} else if network != chainstate.MainNet && (target.Cmp(powLimit) == 0 || previousTarget.Cmp(powLimit) == 0) {
+		return nil
+	}
+	if target.Cmp(new(big.Int).Mul(previousTarget, big.NewInt(4))) > 0 ||
+		new(big.Int).Mul(target, big.NewInt(4)).Cmp(previousTarget) < 0 {
+		return fmt.Errorf("%w: difficulty transition not allowed at %d", ErrInvalidBlockHeader, header.Height)
+	}
+	return nil
+}
+
+// blockWork will return the expected number of hashes of the bits (2^256 / (target + 1)), zero if the bits
+// can not be parsed
+func blockWork(bits string) *big.Int {
+	target := blockHeaderTarget(bits)
+	if target == nil {
+		return new(big.Int)
+	}
+	return new(big.Int).Div(new(big.Int).Lsh(big.NewInt(1), 256), new(big.Int).Add(target, big.NewInt(1)))
+}
+
+// blockHeaderTarget will return the target of the saved bits (nil if the bits can not be parsed)
+func blockHeaderTarget(bits string) *big.Int {
+	compact, err := strconv.ParseUint(bits, 16, 32)
+	if err != nil || compact == 0 {
+		return nil
+	}
+	var target *big.Int
+	if target, err = bc.ExpandTargetFromAsInt(fmt.Sprintf("%08x", compact)); err != nil || target.Sign() <= 0 {
+		return nil
+	}
+	return target
+}
+
+// deleteBlockHeadersFrom will delete the headers from the height (inclusive), used to switch the tip on a reorg
+func deleteBlockHeadersFrom(ctx context.Context, height uint32, opts ...ModelOps) error {
+	ds := NewBaseModel(ModelNameEmpty, opts...).Client().Datastore()
+	tableName := ds.GetTableName(tableBlockHeaders)
+	if db := gormDB(ds); db != nil {
+		return db.WithContext(ctx).Table(tableName).Where(heightField+" >= ?", height).Delete(&BlockHeader{}).Error
+	}
+	_, err := ds.GetMongoCollectionByTableName(tableName).DeleteMany(
+		ctx, bson.M{heightField: bson.M{"$gte": height}},
+	)
+	return err
+}
+
+// httpBlockHeaderProvider fetches the headers from an HTTP API (see NewHTTPBlockHeaderProvider)
+type httpBlockHeaderProvider struct {
+	httpClient HTTPInterface
+	url        string
+}
+
+// httpBlockHeader is a header returned by the HTTP API
+type httpBlockHeader struct {
+	Hash   string `json:"hash"`   // Hash of the block (hex)
+	Header string `json:"header"` // Raw header (80 bytes hex)
+	Height uint32 `json:"height"` // Height of the block
+}
+
+// NewHTTPBlockHeaderProvider will create a provider fetching the headers from an HTTP API
+//
+// The API is called with GET {url}?from={height}&count={count} and returns a JSON array
+// of {"hash": "...", "height": 1, "header": "<80 bytes hex>"} (ascending, empty at the tip)
+func NewHTTPBlockHeaderProvider(url string, httpClient HTTPInterface) BlockHeaderProvider {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &httpBlockHeaderProvider{httpClient: httpClient, url: url}
+}
+
+// GetBlockHeaders will fetch the headers from the height (see BlockHeaderProvider)
+func (p *httpBlockHeaderProvider) GetBlockHeaders(ctx context.Context, fromHeight uint32,
+	count int,
+) ([]*ProvidedBlockHeader, error) {
+	separator := "?"
+	if strings.Contains(p.url, "?") {
+		separator = "&"
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		p.url+separator+"from="+strconv.FormatUint(uint64(fromHeight), 10)+"&count="+strconv.Itoa(count), nil,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	var response *http.Response
+	if response, err = p.httpClient.Do(req); err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = response.Body.Close()
+	}()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: status code %d", ErrBlockHeaderProviderFailed, response.StatusCode)
+	}
+
+	var body []byte
+	if body, err = io.ReadAll(response.Body); err != nil {
+		return nil, err
+	}
+	var items []*httpBlockHeader
+	if err = json.Unmarshal(body, &items); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrBlockHeaderProviderFailed, err.Error())
+	}
+
+	headers := make([]*ProvidedBlockHeader, 0, len(items))
+	for _, item := range items {
+		var header *bc.BlockHeader
+		if header, err = bc.NewBlockHeaderFromStr(item.Header); err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrBlockHeaderProviderFailed, err.Error())
+		}
+		headers = append(headers, &ProvidedBlockHeader{Hash: item.Hash, Header: *header, Height: item.Height})
+	}
+	return headers, nil
+}
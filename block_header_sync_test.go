@@ -0,0 +1,320 @@
+package bux
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/BuxOrg/bux/chainstate"
+	"github.com/libsv/go-bc"
+	"github.com/libsv/go-bk/crypto"
+	"github.com/libsv/go-bt/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testEasyBits is the easiest regtest target, headers are mined in a few attempts
+const testEasyBits = "207fffff"
+
+// blockHeaderProviderMock returns the headers of a static chain
+type blockHeaderProviderMock struct {
+	headers []*ProvidedBlockHeader
+}
+
+// GetBlockHeaders will return the headers from the height
+func (p *blockHeaderProviderMock) GetBlockHeaders(_ context.Context, fromHeight uint32,
+	count int,
+) ([]*ProvidedBlockHeader, error) {
+	headers := make([]*ProvidedBlockHeader, 0)
+	for _, header := range p.headers {
+		if header.Height >= fromHeight && len(headers) < count {
+			headers = append(headers, header)
+		}
+	}
+	return headers, nil
+}
+
+// mineTestBlockHeader will create a header on top of the previous hash with a valid proof-of-work
+func mineTestBlockHeader(t *testing.T, previousHash string, height uint32, merkleSeed byte) *ProvidedBlockHeader {
+	return mineTestBlockHeaderWithBits(t, previousHash, height, merkleSeed, testEasyBits)
+}
+
+// mineTestBlockHeaderWithBits will create a header on top of the previous hash with a valid proof-of-work of the bits
+func mineTestBlockHeaderWithBits(t *testing.T, previousHash string, height uint32, merkleSeed byte,
+	targetBits string,
+) *ProvidedBlockHeader {
+	prevHash, err := hex.DecodeString(previousHash)
+	require.NoError(t, err)
+	var bits []byte
+	bits, err = hex.DecodeString(targetBits)
+	require.NoError(t, err)
+
+	merkleRoot := make([]byte, 32)
+	merkleRoot[0] = merkleSeed
+	header := bc.BlockHeader{
+		Bits:           bits,
+		HashMerkleRoot: merkleRoot,
+		HashPrevBlock:  prevHash,
+		Time:           1600000000 + height,
+		Version:        1,
+	}
+	for !header.Valid() {
+		header.Nonce++
+	}
+	return &ProvidedBlockHeader{
+		Hash:   hex.EncodeToString(bt.ReverseBytes(crypto.Sha256d(header.Bytes()))),
+		Header: header,
+		Height: height,
+	}
+}
+
+// mineTestChain will mine the headers on top of the previous header
+func mineTestChain(t *testing.T, previous *ProvidedBlockHeader, count int, merkleSeed byte) []*ProvidedBlockHeader {
+	headers := make([]*ProvidedBlockHeader, 0, count)
+	for i := 0; i < count; i++ {
+		previous = mineTestBlockHeader(t, previous.Hash, previous.Height+1, merkleSeed)
+		headers = append(headers, previous)
+	}
+	return headers
+}
+
+// newTestBlockHeaderSyncClient will create a client syncing from the provider with the easy target,
+// the start header is saved as the tip
+func newTestBlockHeaderSyncClient(t *testing.T, provider BlockHeaderProvider,
+	start *ProvidedBlockHeader,
+) (context.Context, ClientInterface, func()) {
+	ctx, client, deferMe := CreateTestSQLiteClient(t, false, true,
+		WithCustomTaskManager(&taskManagerMockBase{}), WithBlockHeaderSync(provider, 2),
+	)
+	powLimit, err := bc.ExpandTargetFromAsInt(testEasyBits)
+	require.NoError(t, err)
+	client.(*Client).options.blockHeaderSync.powLimit = powLimit
+
+	tip := newBlockHeader(start.Hash, start.Height, start.Header, client.DefaultModelOptions(New())...)
+	require.NoError(t, tip.Save(ctx))
+	return ctx, client, deferMe
+}
+
+// TestClient_SyncBlockHeaders will test the method SyncBlockHeaders()
+func TestClient_SyncBlockHeaders(t *testing.T) {
+	t.Parallel()
+
+	start := mineTestBlockHeader(t, "0000000000000000000000000000000000000000000000000000000000000001", 100, 0)
+
+	t.Run("disabled", func(t *testing.T) {
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, true, WithCustomTaskManager(&taskManagerMockBase{}))
+		defer deferMe()
+
+		assert.False(t, client.IsBlockHeaderSyncEnabled())
+		_, err := client.SyncBlockHeaders(ctx)
+		assert.ErrorIs(t, err, ErrBlockHeaderSyncDisabled)
+	})
+
+	t.Run("sync in batches", func(t *testing.T) {
+		provider := &blockHeaderProviderMock{headers: mineTestChain(t, start, 5, 1)}
+		ctx, client, deferMe := newTestBlockHeaderSyncClient(t, provider, start)
+		defer deferMe()
+
+		result, err := client.SyncBlockHeaders(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 5, result.Imported)
+		assert.Equal(t, 0, result.Truncated)
+		assert.Equal(t, uint32(105), result.TipHeight)
+		assert.Equal(t, provider.headers[4].Hash, result.TipHash)
+
+		var tip *BlockHeader
+		tip, err = client.GetLastBlockHeader(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, provider.headers[4].Hash, tip.ID)
+
+		// The next sync continues from the tip
+		provider.headers = append(provider.headers, mineTestChain(t, provider.headers[4], 1, 1)...)
+		result, err = client.SyncBlockHeaders(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 1, result.Imported)
+		assert.Equal(t, uint32(106), result.TipHeight)
+	})
+
+	t.Run("reorg at the tip", func(t *testing.T) {
+		chain := mineTestChain(t, start, 3, 1)
+		provider := &blockHeaderProviderMock{headers: chain}
+		ctx, client, deferMe := newTestBlockHeaderSyncClient(t, provider, start)
+		defer deferMe()
+
+		_, err := client.SyncBlockHeaders(ctx)
+		require.NoError(t, err)
+
+		// Fork after the first header, the new chain is longer
+		provider.headers = append([]*ProvidedBlockHeader{chain[0]}, mineTestChain(t, chain[0], 3, 2)...)
+
+		var result *BlockHeaderSyncResult
+		result, err = client.SyncBlockHeaders(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 2, result.Truncated)
+		assert.Equal(t, 3, result.Imported)
+		assert.Equal(t, uint32(104), result.TipHeight)
+		assert.Equal(t, provider.headers[3].Hash, result.TipHash)
+
+		var header *BlockHeader
+		header, err = getBlockHeaderByHeight(ctx, 102, client.DefaultModelOptions()...)
+		require.NoError(t, err)
+		assert.Equal(t, provider.headers[1].Hash, header.ID)
+	})
+
+	t.Run("reorg too deep", func(t *testing.T) {
+		chain := mineTestChain(t, start, 3, 1)
+		provider := &blockHeaderProviderMock{headers: chain}
+		ctx, client, deferMe := newTestBlockHeaderSyncClient(t, provider, start)
+		defer deferMe()
+		client.(*Client).options.blockHeaderSync.maxReorgDepth = 1
+
+		_, err := client.SyncBlockHeaders(ctx)
+		require.NoError(t, err)
+
+		provider.headers = append([]*ProvidedBlockHeader{chain[0]}, mineTestChain(t, chain[0], 3, 2)...)
+		_, err = client.SyncBlockHeaders(ctx)
+		assert.ErrorIs(t, err, ErrBlockHeaderReorgTooDeep)
+	})
+
+	t.Run("reorg without more work", func(t *testing.T) {
+		chain := mineTestChain(t, start, 1, 1)
+		chain = append(chain, mineTestBlockHeaderWithBits(t, chain[0].Hash, 102, 1, "2020ffff"))
+		chain = append(chain, mineTestBlockHeaderWithBits(t, chain[1].Hash, 103, 1, "2020ffff"))
+		provider := &blockHeaderProviderMock{headers: chain}
+		ctx, client, deferMe := newTestBlockHeaderSyncClient(t, provider, start)
+		defer deferMe()
+
+		_, err := client.SyncBlockHeaders(ctx)
+		require.NoError(t, err)
+
+		// Fork after the first header, the new chain is longer but the headers are easier (less work)
+		provider.headers = append([]*ProvidedBlockHeader{chain[0]}, mineTestChain(t, chain[0], 3, 2)...)
+		_, err = client.SyncBlockHeaders(ctx)
+		assert.ErrorIs(t, err, ErrBlockHeaderReorgInsufficientWork)
+
+		// Nothing was removed
+		var tip *BlockHeader
+		tip, err = client.GetLastBlockHeader(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, chain[2].Hash, tip.ID)
+	})
+
+	t.Run("reorg with an invalid branch", func(t *testing.T) {
+		chain := mineTestChain(t, start, 3, 1)
+		provider := &blockHeaderProviderMock{headers: chain}
+		ctx, client, deferMe := newTestBlockHeaderSyncClient(t, provider, start)
+		defer deferMe()
+
+		_, err := client.SyncBlockHeaders(ctx)
+		require.NoError(t, err)
+
+		// The last header of the longer branch does not connect
+		branch := mineTestChain(t, chain[0], 3, 2)
+		branch[2] = mineTestBlockHeader(t, chain[1].Hash, branch[2].Height, 2)
+		provider.headers = append([]*ProvidedBlockHeader{chain[0]}, branch...)
+		_, err = client.SyncBlockHeaders(ctx)
+		assert.ErrorIs(t, err, ErrInvalidBlockHeader)
+
+		var tip *BlockHeader
+		tip, err = client.GetLastBlockHeader(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, chain[2].Hash, tip.ID)
+	})
+}
+
+// Test_validateBlockHeader will test the method validateBlockHeader()
+func Test_validateBlockHeader(t *testing.T) {
+	t.Parallel()
+
+	powLimit, err := bc.ExpandTargetFromAsInt(testEasyBits)
+	require.NoError(t, err)
+
+	previous := &BlockHeader{Bits: testEasyBits, Height: 100, ID: "00000000000000000000000000000000000000000000000000000000000000aa"}
+	header := mineTestBlockHeader(t, previous.ID, 101, 0)
+
+	t.Run("valid", func(t *testing.T) {
+		assert.NoError(t, validateBlockHeader(previous, header, chainstate.MainNet, powLimit))
+	})
+
+	t.Run("does not connect", func(t *testing.T) {
+		other := &BlockHeader{Bits: testEasyBits, Height: 100, ID: "00000000000000000000000000000000000000000000000000000000000000bb"}
+		assert.ErrorIs(t, validateBlockHeader(other, header, chainstate.MainNet, powLimit), ErrInvalidBlockHeader)
+
+		wrongHeight := &ProvidedBlockHeader{Hash: header.Hash, Header: header.Header, Height: 102}
+		assert.ErrorIs(t, validateBlockHeader(previous, wrongHeight, chainstate.MainNet, powLimit), ErrInvalidBlockHeader)
+	})
+
+	t.Run("hash mismatch", func(t *testing.T) {
+		wrongHash := &ProvidedBlockHeader{Hash: previous.ID, Header: header.Header, Height: 101}
+		assert.ErrorIs(t, validateBlockHeader(previous, wrongHash, chainstate.MainNet, powLimit), ErrInvalidBlockHeader)
+	})
+
+	t.Run("hash above the target", func(t *testing.T) {
+		unmined := *header
+		unmined.Header.Nonce++
+		for unmined.Header.Valid() {
+			unmined.Header.Nonce++
+		}
+		unmined.Hash = hex.EncodeToString(bt.ReverseBytes(crypto.Sha256d(unmined.Header.Bytes())))
+		assert.ErrorIs(t, validateBlockHeader(previous, &unmined, chainstate.MainNet, powLimit), ErrInvalidBlockHeader)
+	})
+
+	t.Run("above the pow limit", func(t *testing.T) {
+		lowerLimit, limitErr := bc.ExpandTargetFromAsInt("1f7fffff")
+		require.NoError(t, limitErr)
+		assert.ErrorIs(t, validateBlockHeader(previous, header, chainstate.MainNet, lowerLimit), ErrInvalidBlockHeader)
+	})
+
+	t.Run("difficulty transition", func(t *testing.T) {
+		harder := &BlockHeader{Bits: "1f7fffff", Height: 100, ID: previous.ID}
+		assert.ErrorIs(t, validateBlockHeader(harder, header, chainstate.MainNet, powLimit), ErrInvalidBlockHeader)
+
+		// Minimum difficulty blocks are allowed on the testnet
+		assert.NoError(t, validateBlockHeader(harder, header, chainstate.TestNet, powLimit))
+
+		// Bits saved by older versions are not checked
+		unknown := &BlockHeader{Bits: "", Height: 100, ID: previous.ID}
+		assert.NoError(t, validateBlockHeader(unknown, header, chainstate.MainNet, powLimit))
+	})
+}
+
+// TestNewHTTPBlockHeaderProvider will test the method NewHTTPBlockHeaderProvider()
+func TestNewHTTPBlockHeaderProvider(t *testing.T) {
+	t.Parallel()
+
+	header := mineTestBlockHeader(t, "0000000000000000000000000000000000000000000000000000000000000001", 7, 0)
+
+	t.Run("valid response", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "7", r.URL.Query().Get("from"))
+			assert.Equal(t, "10", r.URL.Query().Get("count"))
+			assert.Equal(t, "main", r.URL.Query().Get("network"))
+			_ = json.NewEncoder(w).Encode([]*httpBlockHeader{{
+				Hash: header.Hash, Header: header.Header.String(), Height: header.Height,
+			}})
+		}))
+		defer server.Close()
+
+		provider := NewHTTPBlockHeaderProvider(server.URL+"?network=main", nil)
+		headers, err := provider.GetBlockHeaders(context.Background(), 7, 10)
+		require.NoError(t, err)
+		require.Len(t, headers, 1)
+		assert.Equal(t, header.Hash, headers[0].Hash)
+		assert.Equal(t, uint32(7), headers[0].Height)
+		assert.Equal(t, header.Header.HashPrevBlockStr(), headers[0].Header.HashPrevBlockStr())
+		assert.True(t, headers[0].Header.Valid())
+	})
+
+	t.Run("error status", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusBadGateway)
+		}))
+		defer server.Close()
+
+		_, err := NewHTTPBlockHeaderProvider(server.URL, nil).GetBlockHeaders(context.Background(), 7, 10)
+		assert.ErrorIs(t, err, ErrBlockHeaderProviderFailed)
+	})
+}
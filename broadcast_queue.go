@@ -0,0 +1,169 @@
+package bux
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/mrz1836/go-datastore"
+)
+
+// broadcastQueue dispatches the ready sync transactions to the broadcast workers while they are paged through
+//
+// The records of an xPub are broadcast in order by a single worker (across the pages), the number of workers is
+// bounded, and the records in flight (queued or broadcasting) are capped by the high-water mark: the next record is
+// only loaded once the records in flight dropped below the mark.
+type broadcastQueue struct {
+	active    map[string]bool                                          // xPubs with a running worker
+	broadcast func(ctx context.Context, syncTx *SyncTransaction) error // Broadcasts a record (processBroadcastTransaction)
+	done      *sync.Cond                                               // Signaled when records are no longer in flight
+	failed    map[string]bool                                          // xPubs that failed (the next records are skipped)
+	highWater int                                                      // Max number of records in flight
+	inFlight  int                                                      // Records queued or broadcasting
+	mu        sync.Mutex                                               // Guards the queue
+	peak      int                                                      // Max number of records in flight seen
+	pending   map[string][]*SyncTransaction                            // Queued records per xPub (in order)
+	wg        sync.WaitGroup                                           // Running workers
+	workers   chan bool                                                // Limits the number of running workers
+}
+
+// newBroadcastQueue will return a new broadcast queue
+func newBroadcastQueue(broadcast func(ctx context.Context, syncTx *SyncTransaction) error,
+	highWater, workers int) *broadcastQueue {
+
+	if highWater <= 0 {
+		highWater = defaultBroadcastHighWaterMark
+	}
+	if workers <= 0 {
+		workers = 1
+	}
+	q := &broadcastQueue{
+		active:    make(map[string]bool),
+		broadcast: broadcast,
+		failed:    make(map[string]bool),
+		highWater: highWater,
+		pending:   make(map[string][]*SyncTransaction),
+		workers:   make(chan bool, workers),
+	}
+	q.done = sync.NewCond(&q.mu)
+	return q
+}
+
+// dispatch will page through the ready sync transactions (oldest first) and queue the records that can be
+// broadcast, then wait for the workers
+//
+// The pages are never larger than the high-water mark. Loading stops once maxTransactions records are queued
+// (0 for no limit), or on the first error (the queued records are still broadcast).
+func (q *broadcastQueue) dispatch(ctx context.Context, pageSize, maxTransactions int, opts ...ModelOps) error {
+	if pageSize <= 0 || pageSize > q.highWater {
+		pageSize = q.highWater
+	}
+	if maxTransactions > 0 && pageSize > maxTransactions {
+		pageSize = maxTransactions
+	}
+
+	// the current limit of the chain of unconfirmed ancestors (configured or from the miners)
+	maxDepth := NewBaseModel(ModelNameEmpty, opts...).Client().MaxUnconfirmedChain()
+
+	queued := 0
+	err := forEachKeysetRecord(ctx, map[string]interface{}{
+		broadcastStatusField: SyncStatusReady.String(),
+	}, pageSize,
+		func(ctx context.Context, conditions map[string]interface{}, queryParams *datastore.QueryParams) ([]keysetRecord, error) {
+			txs, err := getSyncTransactionsByConditions(ctx, conditions, queryParams, opts...)
+			if err != nil {
+				return nil, err
+			}
+			records := make([]keysetRecord, 0, len(txs))
+			for _, tx := range txs {
+				records = append(records, tx)
+			}
+			return records, nil
+		}, func(record keysetRecord) error {
+			syncTx := record.(*SyncTransaction)
+			xPubID, ready, err := getBroadcastGroup(ctx, syncTx, maxDepth, opts...)
+			if err != nil || !ready {
+				return err
+			}
+			q.add(ctx, xPubID, syncTx)
+			if queued++; maxTransactions > 0 && queued >= maxTransactions {
+				return errKeysetStop
+			}
+			return nil
+		},
+		opts...,
+	)
+	if errors.Is(err, errKeysetStop) {
+		err = nil
+	}
+
+	// the records in flight are broadcast (even if loading failed)
+	q.wg.Wait()
+	return err
+}
+
+// add will queue the record for the worker of the xPub (waits for the records in flight to drop below the mark)
+func (q *broadcastQueue) add(ctx context.Context, xPubID string, syncTx *SyncTransaction) {
+	q.mu.Lock()
+	for q.inFlight >= q.highWater {
+		q.done.Wait()
+	}
+	if q.failed[xPubID] {
+		// stop processing transactions for this xpub if we found an error
+		q.mu.Unlock()
+		return
+	}
+	q.pending[xPubID] = append(q.pending[xPubID], syncTx)
+	q.inFlight++
+	if q.inFlight > q.peak {
+		q.peak = q.inFlight
+	}
+	start := !q.active[xPubID]
+	q.active[xPubID] = true
+	q.mu.Unlock()
+
+	if start {
+		q.workers <- true // limit the number of routines running at the same time
+		q.wg.Add(1)
+		go q.run(ctx, xPubID)
+	}
+}
+
+// run will broadcast the queued records of the xPub (in order) until the queue of the xPub is empty
+func (q *broadcastQueue) run(ctx context.Context, xPubID string) {
+	defer q.wg.Done()
+	defer func() { <-q.workers }()
+
+	for {
+		q.mu.Lock()
+		queued := q.pending[xPubID]
+		if len(queued) == 0 {
+			delete(q.pending, xPubID)
+			delete(q.active, xPubID)
+			q.mu.Unlock()
+			return
+		}
+		syncTx := queued[0]
+		queued[0] = nil
+		q.pending[xPubID] = queued[1:]
+		q.mu.Unlock()
+
+		err := q.broadcast(ctx, syncTx)
+
+		q.mu.Lock()
+		q.inFlight--
+		if err != nil {
+			syncTx.Client().Logger().Error(ctx,
+				fmt.Sprintf("error running broadcast tx for xpub %s, tx %s: %s", xPubID, syncTx.ID, err.Error()),
+			)
+
+			// stop processing transactions for this xpub if we found an error
+			q.failed[xPubID] = true
+			q.inFlight -= len(q.pending[xPubID])
+			q.pending[xPubID] = nil
+		}
+		q.done.Broadcast()
+		q.mu.Unlock()
+	}
+}
@@ -0,0 +1,123 @@
+package bux
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/libsv/go-bt/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// seedReadyBroadcasts will create the ready sync transactions (and transactions) spread over the xPubs
+func seedReadyBroadcasts(ctx context.Context, t *testing.T, client ClientInterface, records, xPubs int) {
+	opts := client.DefaultModelOptions()
+	for i := 0; i < records; i++ {
+		tx := bt.NewTx()
+		require.NoError(t, tx.From(testTxID, uint32(i), testLockingScript, 1000))
+		require.NoError(t, tx.PayToAddress(testExternalAddress, 900))
+
+		transaction := newTransaction(tx.String(), append(opts, New())...)
+		transaction.XpubInIDs = IDs{fmt.Sprintf("xpub-%d", i%xPubs)}
+		require.NoError(t, transaction.Save(ctx))
+
+		syncTx := newSyncTransaction(transaction.ID, &SyncConfig{Broadcast: true}, append(opts, New())...)
+		require.NoError(t, syncTx.Save(ctx))
+	}
+}
+
+// Test_broadcastQueue_dispatch will test streaming the ready sync transactions to the broadcast workers
+func Test_broadcastQueue_dispatch(t *testing.T) {
+	t.Parallel()
+
+	const records, xPubs, highWater = 2000, 25, 50
+
+	ctx, client, deferMe := CreateTestSQLiteClient(t, false, true, WithCustomTaskManager(&taskManagerMockBase{}))
+	defer deferMe()
+	seedReadyBroadcasts(ctx, t, client, records, xPubs)
+
+	t.Run("bounded and ordered per xpub", func(t *testing.T) {
+		var mu sync.Mutex
+		running := make(map[string]bool)
+		last := make(map[string]time.Time)
+		broadcast := 0
+
+		var queue *broadcastQueue
+		queue = newBroadcastQueue(func(_ context.Context, syncTx *SyncTransaction) error {
+			xPubID := syncTx.transaction.XpubInIDs[0]
+			mu.Lock()
+			assert.False(t, running[xPubID], "concurrent broadcasts of xpub "+xPubID)
+			assert.False(t, syncTx.CreatedAt.Before(last[xPubID]), "out of order broadcast of xpub "+xPubID)
+			running[xPubID] = true
+			last[xPubID] = syncTx.CreatedAt
+			mu.Unlock()
+
+			time.Sleep(50 * time.Microsecond)
+
+			mu.Lock()
+			running[xPubID] = false
+			broadcast++
+			mu.Unlock()
+			return nil
+		}, highWater, 8)
+
+		require.NoError(t, queue.dispatch(ctx, 500, 0, client.DefaultModelOptions()...))
+		assert.Equal(t, records, broadcast)
+		assert.LessOrEqual(t, queue.peak, highWater)
+		assert.Greater(t, queue.peak, 0)
+		assert.Equal(t, 0, queue.inFlight)
+	})
+
+	t.Run("failed xpub is skipped", func(t *testing.T) {
+		var mu sync.Mutex
+		broadcast := make(map[string]int)
+
+		queue := newBroadcastQueue(func(_ context.Context, syncTx *SyncTransaction) error {
+			xPubID := syncTx.transaction.XpubInIDs[0]
+			mu.Lock()
+			defer mu.Unlock()
+			broadcast[xPubID]++
+			if xPubID == "xpub-0" {
+				return errors.New("broadcast failed")
+			}
+			return nil
+		}, highWater, 8)
+
+		require.NoError(t, queue.dispatch(ctx, 100, 0, client.DefaultModelOptions()...))
+		assert.Equal(t, 1, broadcast["xpub-0"])
+		assert.Equal(t, records/xPubs, broadcast["xpub-1"])
+		assert.Equal(t, 0, queue.inFlight)
+	})
+	t.Run("capped per run", func(t *testing.T) {
+		const capped, maxTransactions = 250, 100
+
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, true, WithCustomTaskManager(&taskManagerMockBase{}))
+		defer deferMe()
+		seedReadyBroadcasts(ctx, t, client, capped, xPubs)
+
+		// each run marks its records as broadcast, the next run continues with the next records
+		var runs []int
+		for run := 0; run < 4; run++ {
+			var mu sync.Mutex
+			broadcast := 0
+			queue := newBroadcastQueue(func(ctx context.Context, syncTx *SyncTransaction) error {
+				syncTx.BroadcastStatus = SyncStatusComplete
+				if err := syncTx.Save(ctx); err != nil {
+					return err
+				}
+				mu.Lock()
+				broadcast++
+				mu.Unlock()
+				return nil
+			}, highWater, 8)
+
+			require.NoError(t, queue.dispatch(ctx, 30, maxTransactions, client.DefaultModelOptions()...))
+			runs = append(runs, broadcast)
+		}
+		assert.Equal(t, []int{maxTransactions, maxTransactions, capped - 2*maxTransactions, 0}, runs)
+	})
+}
@@ -51,3 +51,18 @@ func (tm *taskManagerMockBase) IsDebug() bool {
 func (tm *taskManagerMockBase) IsNewRelicEnabled() bool {
 	return false
 }
+
+func (tm *taskManagerMockBase) MigrationStatus() *taskmanager.MigrationStatus {
+	return &taskmanager.MigrationStatus{}
+}
+
+// closedTaskManagerMock records when the task manager is closed
+type closedTaskManagerMock struct {
+	taskManagerMockBase
+	closed bool
+}
+
+func (tm *closedTaskManagerMock) Close(context.Context) error {
+	tm.closed = true
+	return nil
+}
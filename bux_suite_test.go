@@ -202,15 +202,11 @@ func (ts *EmbeddedDBTestSuite) createTestClient(ctx context.Context, database da
 
 		// Load the in-memory version of the database
 		if database == datastore.SQLite {
-			opts = append(opts, WithSQLite(&datastore.SQLiteConfig{
-				CommonConfig: datastore.CommonConfig{
-					MaxIdleConnections: 1,
-					MaxOpenConnections: 1,
-					TablePrefix:        tablePrefix,
-				},
-				Shared: true, // mrz: TestTransaction_Save requires this to be true for some reason
-				// I get the error: no such table: _17a1f3e22f2eec56_utxos
-			}))
+			// Each client gets its own database: the connections of the client share it (no "no such table" errors)
+			// and parallel tests do not interfere with each other
+			sqliteConfig := tester.SQLiteIsolatedTestConfig(false)
+			sqliteConfig.TablePrefix = tablePrefix
+			opts = append(opts, WithSQLite(sqliteConfig))
 		} else if database == datastore.MongoDB {
 
 			// Sanity check
@@ -345,6 +341,28 @@ func (ts *EmbeddedDBTestSuite) genericDBClient(t *testing.T, database datastore.
 	return tc
 }
 
+// runParallelDBTests will run the same test body against all the databases concurrently
+//
+// Each database gets its own isolated client (closed when the test body finishes)
+func (ts *EmbeddedDBTestSuite) runParallelDBTests(name string, taskManagerEnabled bool,
+	fn func(t *testing.T, tc *TestingClient), opts ...ClientOps,
+) {
+	ts.T().Run(name, func(t *testing.T) {
+		for _, testCase := range dbTestCases {
+			testCase := testCase
+			t.Run(testCase.name, func(t *testing.T) {
+				t.Parallel()
+
+				// Each client gets its own copy of the options
+				tc := ts.genericDBClient(t, testCase.database, taskManagerEnabled, append([]ClientOps{}, opts...)...)
+				defer tc.Close(tc.ctx)
+
+				fn(t, tc)
+			})
+		}
+	})
+}
+
 // genericMockedDBClient is a helpful wrapper for getting the same type of client
 //
 // NOTE: you need to close the client: ts.Close()
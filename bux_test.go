@@ -57,16 +57,23 @@ func (tc *TestingClient) Close(ctx context.Context) {
 }
 
 // DefaultClientOpts will return a default set of client options required to load the new client
+//
+// shared will use a new in-memory database shared by all the connections of the client (isolated from other clients)
 func DefaultClientOpts(debug, shared bool) []ClientOps {
 	tqc := taskmanager.DefaultTaskQConfig(tester.RandomTablePrefix())
 	tqc.MaxNumWorker = 2
 	tqc.MaxNumFetcher = 2
 
+	sqliteConfig := tester.SQLiteTestConfig(debug, false)
+	if shared {
+		sqliteConfig = tester.SQLiteIsolatedTestConfig(debug)
+	}
+
 	opts := make([]ClientOps, 0)
 	opts = append(
 		opts,
 		WithTaskQ(tqc, taskmanager.FactoryMemory),
-		WithSQLite(tester.SQLiteTestConfig(debug, shared)),
+		WithSQLite(sqliteConfig),
 		WithChainstateOptions(false, false, false, false),
 		WithMinercraft(&chainstate.MinerCraftBase{}),
 	)
@@ -0,0 +1,34 @@
+package buxhttp
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/BuxOrg/bux"
+)
+
+// accessKeyContextKey is the context key of the access key authentication
+type accessKeyContextKey struct{}
+
+// AccessKeyAuthentication will return a middleware that only accepts requests signed by an active access key
+//
+// The request is authenticated by bux (AuthenticateAccessKey), the result is stored in the request context
+// (see GetAccessKeyAuthentication). Rejected requests get a 401 with the reason of the failure.
+func AccessKeyAuthentication(client AccessKeyAuthenticatorInterface) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			auth, err := client.AuthenticateAccessKey(req.Context(), req)
+			if err != nil {
+				writeError(w, http.StatusUnauthorized, err)
+				return
+			}
+			next.ServeHTTP(w, req.WithContext(context.WithValue(req.Context(), accessKeyContextKey{}, auth)))
+		})
+	}
+}
+
+// GetAccessKeyAuthentication will return the access key authentication stored by AccessKeyAuthentication
+func GetAccessKeyAuthentication(req *http.Request) (*bux.AccessKeyAuthentication, bool) {
+	auth, ok := req.Context().Value(accessKeyContextKey{}).(*bux.AccessKeyAuthentication)
+	return auth, ok && auth != nil
+}
@@ -0,0 +1,12 @@
+package buxhttp
+
+import "errors"
+
+// ErrMissingClient is when the handler is created without a bux client
+var ErrMissingClient = errors.New("missing the bux client")
+
+// ErrMissingAuthentication is when the handler is created without an authentication middleware
+var ErrMissingAuthentication = errors.New("missing the authentication middleware (see WithAuthentication)")
+
+// ErrInvalidQueryParam is when a query parameter of the request is invalid
+var ErrInvalidQueryParam = errors.New("invalid query parameter")
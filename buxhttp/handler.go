@@ -0,0 +1,248 @@
+// Package buxhttp is an optional http.Handler exposing the bux admin endpoints (stats, sync transactions, balances)
+package buxhttp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/BuxOrg/bux"
+	"github.com/BuxOrg/bux/utils"
+	"github.com/mrz1836/go-datastore"
+)
+
+// Handler serves the admin endpoints backed by the bux client (JSON responses)
+//
+//	GET  /stats                              bux.AdminStats
+//	GET  /sync-transactions                  bux.PagedResult of bux.SyncTransaction
+//	POST /sync-transactions/{id}/requeue     bux.SyncTransaction
+//	GET  /xpubs/{id}/balance                 bux.XpubBalances
+type Handler struct {
+	client  ClientInterface
+	handler http.Handler
+	options *handlerOptions
+}
+
+// errorResponse is the body of a failed request
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// syncStatusFilters are the query parameters filtering the sync transactions (by status)
+var syncStatusFilters = []string{"broadcast_status", "p2p_status", "sync_status"}
+
+// NewHandler creates a new handler for the admin endpoints
+//
+// An authentication middleware is required (WithAuthentication), unless it is explicitly disabled
+func NewHandler(client ClientInterface, opts ...HandlerOps) (*Handler, error) {
+	if client == nil {
+		return nil, ErrMissingClient
+	}
+
+	// Create a new handler with defaults
+	h := &Handler{
+		client:  client,
+		options: defaultHandlerOptions(),
+	}
+
+	// Overwrite defaults with any set by user
+	for _, opt := range opts {
+		opt(h.options)
+	}
+
+	h.handler = http.HandlerFunc(h.route)
+	if h.options.authentication != nil {
+		h.handler = h.options.authentication(h.handler)
+	} else if !h.options.noAuth {
+		return nil, ErrMissingAuthentication
+	}
+
+	return h, nil
+}
+
+// ServeHTTP implements http.Handler
+func (h *Handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	h.handler.ServeHTTP(w, req)
+}
+
+// route will dispatch the request to the endpoint
+func (h *Handler) route(w http.ResponseWriter, req *http.Request) {
+	path := req.URL.Path
+	if basePath := h.options.basePath; len(basePath) > 0 {
+		// The base path is a whole segment (IE: /admin does not match /administrator)
+		if path != basePath && !strings.HasPrefix(path, basePath+"/") {
+			writeError(w, http.StatusNotFound, nil)
+			return
+		}
+		path = strings.TrimPrefix(path, basePath)
+	}
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+
+	switch {
+	case len(parts) == 1 && parts[0] == "stats":
+		if allowMethod(w, req, http.MethodGet) {
+			h.getStats(w, req)
+		}
+	case len(parts) == 1 && parts[0] == "sync-transactions":
+		if allowMethod(w, req, http.MethodGet) {
+			h.getSyncTransactions(w, req)
+		}
+	case len(parts) == 3 && parts[0] == "sync-transactions" && parts[2] == "requeue":
+		if allowMethod(w, req, http.MethodPost) {
+			h.requeueSyncTransaction(w, req, parts[1])
+		}
+	case len(parts) == 3 && parts[0] == "xpubs" && parts[2] == "balance":
+		if allowMethod(w, req, http.MethodGet) {
+			h.getXpubBalance(w, req, parts[1])
+		}
+	default:
+		writeError(w, http.StatusNotFound, nil)
+	}
+}
+
+// getStats will return the admin stats
+func (h *Handler) getStats(w http.ResponseWriter, req *http.Request) {
+	stats, err := h.client.GetStats(req.Context())
+	if err != nil {
+		writeClientError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, stats)
+}
+
+// getSyncTransactions will return a page of sync transactions (filtered by the status query parameters)
+func (h *Handler) getSyncTransactions(w http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+	queryParams, err := h.queryParams(query)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	conditions := make(map[string]interface{})
+	for _, field := range syncStatusFilters {
+		value := query.Get(field)
+		if len(value) == 0 {
+			continue
+		}
+		var status bux.SyncStatus
+		if err = status.Scan(value); err != nil || status.String() != value {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("%w: %s", ErrInvalidQueryParam, field))
+			return
+		}
+		conditions[field] = value
+	}
+
+	var result *bux.PagedResult[*bux.SyncTransaction]
+	if result, err = h.client.GetSyncTransactionsPaged(req.Context(), &conditions, queryParams); err != nil {
+		writeClientError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// requeueSyncTransaction will requeue the errored actions of the sync transaction
+func (h *Handler) requeueSyncTransaction(w http.ResponseWriter, req *http.Request, txID string) {
+	syncTx, err := h.client.RequeueSyncTransaction(req.Context(), txID)
+	if err != nil {
+		writeClientError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, syncTx)
+}
+
+// getXpubBalance will return the balances of the xPub (xPub ID or the raw xPub)
+func (h *Handler) getXpubBalance(w http.ResponseWriter, req *http.Request, xPubID string) {
+	balances, err := h.client.GetXpubBalances(req.Context(), xPubID)
+	if err != nil {
+		writeClientError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, balances)
+}
+
+// queryParams will parse the paging query parameters (page, page_size, order_by and sort)
+func (h *Handler) queryParams(query map[string][]string) (*datastore.QueryParams, error) {
+	queryParams := &datastore.QueryParams{
+		Page:     1,
+		PageSize: h.options.maxPageSize,
+	}
+
+	var err error
+	for field, value := range map[string]*int{"page": &queryParams.Page, "page_size": &queryParams.PageSize} {
+		if values := query[field]; len(values) > 0 {
+			if *value, err = strconv.Atoi(values[0]); err != nil || *value < 1 {
+				return nil, fmt.Errorf("%w: %s", ErrInvalidQueryParam, field)
+			}
+		}
+	}
+	if queryParams.PageSize > h.options.maxPageSize {
+		queryParams.PageSize = h.options.maxPageSize
+	}
+
+	if values := query["order_by"]; len(values) > 0 {
+		switch values[0] {
+		case "created_at", "updated_at", "id":
+			queryParams.OrderByField = values[0]
+		default:
+			return nil, fmt.Errorf("%w: order_by", ErrInvalidQueryParam)
+		}
+	}
+	if values := query["sort"]; len(values) > 0 {
+		switch strings.ToLower(values[0]) {
+		case datastore.SortAsc:
+			queryParams.SortDirection = datastore.SortAsc
+		case datastore.SortDesc:
+			queryParams.SortDirection = datastore.SortDesc
+		default:
+			return nil, fmt.Errorf("%w: sort", ErrInvalidQueryParam)
+		}
+	}
+
+	return queryParams, nil
+}
+
+// allowMethod will write a 405 response if the request does not use the method
+func allowMethod(w http.ResponseWriter, req *http.Request, method string) bool {
+	if req.Method == method {
+		return true
+	}
+	w.Header().Set("Allow", method)
+	writeError(w, http.StatusMethodNotAllowed, nil)
+	return false
+}
+
+// writeClientError will write the error of the bux client (the status code depends on the error)
+//
+// Unexpected errors are not exposed (500)
+func writeClientError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, bux.ErrSyncTransactionNotFound), errors.Is(err, bux.ErrMissingXpub):
+		writeError(w, http.StatusNotFound, err)
+	case errors.Is(err, bux.ErrSyncTransactionNotErrored):
+		writeError(w, http.StatusConflict, err)
+	case errors.Is(err, utils.ErrInvalidXpubReference):
+		writeError(w, http.StatusBadRequest, err)
+	default:
+		writeError(w, http.StatusInternalServerError, nil)
+	}
+}
+
+// writeError will write the error response (the status text if the error is nil)
+func writeError(w http.ResponseWriter, status int, err error) {
+	message := http.StatusText(status)
+	if err != nil {
+		message = err.Error()
+	}
+	writeJSON(w, status, &errorResponse{Error: message})
+}
+
+// writeJSON will write the JSON response
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,79 @@
+package buxhttp
+
+import (
+	"net/http"
+	"strings"
+)
+
+const (
+	defaultMaxPageSize = 100
+)
+
+// HandlerOps allow functional options to be supplied
+// that overwrite default handler options.
+type HandlerOps func(h *handlerOptions)
+
+// handlerOptions holds all the configuration for the handler
+type handlerOptions struct {
+	authentication Middleware // Authentication of every request (required)
+	basePath       string     // Path prefix of all endpoints (IE: /admin)
+	maxPageSize    int        // Maximum page size of the listings
+	noAuth         bool       // Authentication is done upstream (explicitly disabled)
+}
+
+// defaultHandlerOptions will return a handlerOptions struct with the default settings
+//
+// Useful for starting with the default and then modifying as needed
+func defaultHandlerOptions() *handlerOptions {
+	return &handlerOptions{
+		maxPageSize: defaultMaxPageSize,
+	}
+}
+
+// WithAuthentication will set the middleware that authenticates every request
+func WithAuthentication(middleware Middleware) HandlerOps {
+	return func(h *handlerOptions) {
+		if middleware != nil {
+			h.authentication = middleware
+		}
+	}
+}
+
+// WithoutAuthentication will disable the authentication (only when the requests are authenticated upstream)
+func WithoutAuthentication() HandlerOps {
+	return func(h *handlerOptions) {
+		h.noAuth = true
+	}
+}
+
+// WithBasePath will set the path prefix of all the endpoints (IE: /admin)
+func WithBasePath(basePath string) HandlerOps {
+	return func(h *handlerOptions) {
+		h.basePath = strings.TrimRight(basePath, "/")
+	}
+}
+
+// WithMaxPageSize will set the maximum page size of the listings (default: 100)
+func WithMaxPageSize(maxPageSize int) HandlerOps {
+	return func(h *handlerOptions) {
+		if maxPageSize > 0 {
+			h.maxPageSize = maxPageSize
+		}
+	}
+}
+
+// AdminAuthentication will return a middleware that only accepts signed requests of the admin xPubs
+//
+// The request is authenticated by bux (AuthenticateRequest), the bux auth headers are used
+func AdminAuthentication(client AuthenticatorInterface, adminXPubs []string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			authReq, err := client.AuthenticateRequest(req.Context(), req, adminXPubs, true, true, false)
+			if err != nil {
+				writeError(w, http.StatusUnauthorized, err)
+				return
+			}
+			next.ServeHTTP(w, authReq)
+		})
+	}
+}
@@ -0,0 +1,278 @@
+package buxhttp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/BuxOrg/bux"
+	"github.com/BuxOrg/bux/chainstate"
+	"github.com/BuxOrg/bux/taskmanager"
+	"github.com/BuxOrg/bux/tester"
+	"github.com/BuxOrg/bux/utils"
+	"github.com/libsv/go-bt/v2"
+	"github.com/libsv/go-bt/v2/bscript"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testToken = "test-token"
+
+// cronServiceNoop will not run the cron tasks of the client (the sync transactions stay in their queues)
+type cronServiceNoop struct{}
+
+func (c *cronServiceNoop) AddFunc(string, func()) (int, error) { return 0, nil }
+func (c *cronServiceNoop) New()                                {}
+func (c *cronServiceNoop) Start()                              {}
+func (c *cronServiceNoop) Stop()                               {}
+
+// newTestClient will create an embedded bux client (isolated in-memory SQLite)
+func newTestClient(t *testing.T) bux.ClientInterface {
+	tqc := taskmanager.DefaultTaskQConfig(tester.RandomTablePrefix())
+	tqc.MaxNumWorker = 2
+	tqc.MaxNumFetcher = 2
+
+	client, err := bux.NewClient(context.Background(),
+		bux.WithTaskQ(tqc, taskmanager.FactoryMemory),
+		bux.WithCronService(&cronServiceNoop{}),
+		bux.WithSQLite(tester.SQLiteIsolatedTestConfig(false)),
+		bux.WithChainstateOptions(false, false, false, false),
+		bux.WithMinercraft(&chainstate.MinerCraftBase{}),
+		bux.WithAutoMigrate(bux.BaseModels...),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = client.Close(context.Background())
+	})
+	return client
+}
+
+// tokenAuthentication is a basic authentication middleware for the tests
+func tokenAuthentication(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Authorization") != "Bearer "+testToken {
+			writeError(w, http.StatusUnauthorized, nil)
+			return
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+// historicalTxHex will return a (fake) transaction paying to the locking script
+func historicalTxHex(t *testing.T, lockingScript string, satoshis uint64) string {
+	parentID, err := utils.RandomHex(32)
+	require.NoError(t, err)
+	tx := bt.NewTx()
+	require.NoError(t, tx.From(parentID, 0, lockingScript, satoshis))
+	script, err := bscript.NewFromHexString(lockingScript)
+	require.NoError(t, err)
+	tx.AddOutput(&bt.Output{LockingScript: script, Satoshis: satoshis})
+	return tx.String()
+}
+
+// statsClient replaces the stats of the embedded client (the SQLite datastore does not aggregate by date)
+type statsClient struct {
+	bux.ClientInterface
+	err   error
+	stats *bux.AdminStats
+}
+
+func (c *statsClient) GetStats(context.Context, ...bux.ModelOps) (*bux.AdminStats, error) {
+	return c.stats, c.err
+}
+
+// serve will serve the request with the handler and decode the JSON response into the body
+func serve(t *testing.T, handler http.Handler, method, target string, body interface{}) int {
+	req := httptest.NewRequest(method, target, nil)
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	if body != nil {
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), body))
+	}
+	return w.Code
+}
+
+// TestNewHandler will test the method NewHandler()
+func TestNewHandler(t *testing.T) {
+	t.Parallel()
+
+	t.Run("missing client", func(t *testing.T) {
+		h, err := NewHandler(nil, WithoutAuthentication())
+		require.ErrorIs(t, err, ErrMissingClient)
+		assert.Nil(t, h)
+	})
+
+	t.Run("authentication is required", func(t *testing.T) {
+		h, err := NewHandler(newTestClient(t))
+		require.ErrorIs(t, err, ErrMissingAuthentication)
+		assert.Nil(t, h)
+	})
+
+	t.Run("unauthenticated request", func(t *testing.T) {
+		h, err := NewHandler(newTestClient(t), WithAuthentication(tokenAuthentication))
+		require.NoError(t, err)
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/stats", nil))
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("admin authentication", func(t *testing.T) {
+		client := newTestClient(t)
+		h, err := NewHandler(client, WithAuthentication(AdminAuthentication(client, nil)))
+		require.NoError(t, err)
+
+		var response errorResponse
+		assert.Equal(t, http.StatusUnauthorized, serve(t, h, http.MethodGet, "/stats", &response))
+		assert.Equal(t, bux.ErrMissingAuthHeader.Error(), response.Error)
+	})
+}
+
+// TestHandler_endpoints will test the endpoints of the handler
+func TestHandler_endpoints(t *testing.T) {
+	t.Parallel()
+
+	client := newTestClient(t)
+	ctx := context.Background()
+	fixtures := bux.NewFixtures(t, client).WithXpub(0).WithUtxos(1000, 2000)
+
+	// The historical transactions are synced on-chain (sync transactions)
+	lockingScript := fixtures.Destinations[0].LockingScript
+	results, err := client.RecordTransactions(ctx, fixtures.RawXpub, []string{
+		historicalTxHex(t, lockingScript, 3000), historicalTxHex(t, lockingScript, 4000),
+	})
+	require.NoError(t, err)
+	for _, result := range results {
+		require.NoError(t, result.Error)
+	}
+
+	h, err := NewHandler(client, WithAuthentication(tokenAuthentication), WithBasePath("/admin/"))
+	require.NoError(t, err)
+
+	t.Run("sync transactions", func(t *testing.T) {
+		var page bux.PagedResult[*bux.SyncTransaction]
+		require.Equal(t, http.StatusOK, serve(t, h, http.MethodGet, "/admin/sync-transactions?page_size=1", &page))
+		assert.Equal(t, int64(2), page.TotalCount)
+		assert.Equal(t, 2, page.TotalPages)
+		assert.Len(t, page.Items, 1)
+
+		page = bux.PagedResult[*bux.SyncTransaction]{}
+		require.Equal(t, http.StatusOK, serve(t, h, http.MethodGet,
+			"/admin/sync-transactions?sync_status=ready&broadcast_status=skipped", &page))
+		assert.Equal(t, int64(2), page.TotalCount)
+
+		page = bux.PagedResult[*bux.SyncTransaction]{}
+		require.Equal(t, http.StatusOK, serve(t, h, http.MethodGet,
+			"/admin/sync-transactions?sync_status=error", &page))
+		assert.Equal(t, int64(0), page.TotalCount)
+		assert.Empty(t, page.Items)
+
+		assert.Equal(t, http.StatusBadRequest, serve(t, h, http.MethodGet,
+			"/admin/sync-transactions?broadcast_status=unknown", nil))
+		assert.Equal(t, http.StatusBadRequest, serve(t, h, http.MethodGet,
+			"/admin/sync-transactions?page=0", nil))
+	})
+
+	t.Run("requeue", func(t *testing.T) {
+		var response errorResponse
+		assert.Equal(t, http.StatusConflict, serve(t, h, http.MethodPost,
+			"/admin/sync-transactions/"+results[0].Transaction.ID+"/requeue", &response))
+		assert.Equal(t, bux.ErrSyncTransactionNotErrored.Error(), response.Error)
+
+		assert.Equal(t, http.StatusNotFound, serve(t, h, http.MethodPost,
+			"/admin/sync-transactions/unknown/requeue", nil))
+		assert.Equal(t, http.StatusMethodNotAllowed, serve(t, h, http.MethodGet,
+			"/admin/sync-transactions/"+fixtures.Transactions[0].ID+"/requeue", nil))
+	})
+
+	t.Run("xpub balance", func(t *testing.T) {
+		var balances bux.XpubBalances
+		require.Equal(t, http.StatusOK, serve(t, h, http.MethodGet,
+			"/admin/xpubs/"+fixtures.Xpub.ID+"/balance", &balances))
+		assert.Equal(t, uint64(10000), balances.Confirmed+balances.Unconfirmed)
+
+		assert.Equal(t, http.StatusBadRequest, serve(t, h, http.MethodGet, "/admin/xpubs/invalid/balance", nil))
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		assert.Equal(t, http.StatusNotFound, serve(t, h, http.MethodGet, "/admin/unknown", nil))
+		assert.Equal(t, http.StatusNotFound, serve(t, h, http.MethodGet, "/stats", nil))
+		assert.Equal(t, http.StatusNotFound, serve(t, h, http.MethodGet, "/adminstats", nil))
+		assert.Equal(t, http.StatusNotFound, serve(t, h, http.MethodGet, "/administrator/stats", nil))
+	})
+}
+
+// TestHandler_stats will test the stats endpoint
+func TestHandler_stats(t *testing.T) {
+	t.Parallel()
+
+	client := &statsClient{ClientInterface: newTestClient(t), stats: &bux.AdminStats{XPubs: 2, Utxos: 3}}
+	h, err := NewHandler(client, WithAuthentication(tokenAuthentication))
+	require.NoError(t, err)
+
+	var stats bux.AdminStats
+	require.Equal(t, http.StatusOK, serve(t, h, http.MethodGet, "/stats", &stats))
+	assert.Equal(t, int64(2), stats.XPubs)
+	assert.Equal(t, int64(3), stats.Utxos)
+
+	assert.Equal(t, http.StatusMethodNotAllowed, serve(t, h, http.MethodPost, "/stats", nil))
+
+	// Unexpected errors are not exposed
+	client.err = errors.New("database is down")
+	var response errorResponse
+	assert.Equal(t, http.StatusInternalServerError, serve(t, h, http.MethodGet, "/stats", &response))
+	assert.Equal(t, http.StatusText(http.StatusInternalServerError), response.Error)
+}
+
+// TestAccessKeyAuthentication will test the middleware AccessKeyAuthentication()
+func TestAccessKeyAuthentication(t *testing.T) {
+	t.Parallel()
+
+	client := newTestClient(t)
+	ctx := context.Background()
+	fixtures := bux.NewFixtures(t, client).WithXpub(0)
+	accessKey, err := client.NewAccessKey(ctx, fixtures.RawXpub, client.DefaultModelOptions()...)
+	require.NoError(t, err)
+
+	var auth *bux.AccessKeyAuthentication
+	h := AccessKeyAuthentication(client)(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		auth, _ = GetAccessKeyAuthentication(req)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{}`))
+	require.NoError(t, bux.SetSignatureFromAccessKey(&req.Header, accessKey.Key, `{}`))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	require.NotNil(t, auth)
+	assert.Equal(t, accessKey.ID, auth.AccessKey.ID)
+	assert.Equal(t, fixtures.Xpub.ID, auth.Xpub.ID)
+
+	t.Run("replayed request", func(t *testing.T) {
+		replay := req.Clone(ctx)
+		replay.Body = io.NopCloser(strings.NewReader(`{}`))
+		w = httptest.NewRecorder()
+		h.ServeHTTP(w, replay)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+		var response errorResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Contains(t, response.Error, bux.ErrAuthReplayed.Error())
+	})
+
+	t.Run("unsigned request", func(t *testing.T) {
+		w = httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{}`)))
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+}
@@ -0,0 +1,39 @@
+package buxhttp
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/BuxOrg/bux"
+	"github.com/mrz1836/go-datastore"
+)
+
+// ClientInterface is the part of the bux client used by the handler (bux.ClientInterface implements it)
+type ClientInterface interface {
+	GetStats(ctx context.Context, opts ...bux.ModelOps) (*bux.AdminStats, error)
+	GetSyncTransactionsPaged(ctx context.Context, conditions *map[string]interface{},
+		queryParams *datastore.QueryParams) (*bux.PagedResult[*bux.SyncTransaction], error)
+	GetXpubBalances(ctx context.Context, xPubKey string) (*bux.XpubBalances, error)
+	RequeueSyncTransaction(ctx context.Context, txID string) (*bux.SyncTransaction, error)
+}
+
+// AuthenticatorInterface is the part of the bux client used by AdminAuthentication
+type AuthenticatorInterface interface {
+	AuthenticateRequest(ctx context.Context, req *http.Request, adminXPubs []string,
+		adminRequired, requireSigning, signingDisabled bool) (*http.Request, error)
+}
+
+// AccessKeyAuthenticatorInterface is the part of the bux client used by AccessKeyAuthentication
+type AccessKeyAuthenticatorInterface interface {
+	AuthenticateAccessKey(ctx context.Context, req *http.Request) (*bux.AccessKeyAuthentication, error)
+}
+
+// Middleware wraps the handler of the endpoints (authentication, logging, etc.)
+type Middleware func(next http.Handler) http.Handler
+
+// The bux client implements the interfaces of the handler
+var (
+	_ ClientInterface                 = (bux.ClientInterface)(nil)
+	_ AuthenticatorInterface          = (bux.ClientInterface)(nil)
+	_ AccessKeyAuthenticatorInterface = (bux.ClientInterface)(nil)
+)
@@ -3,7 +3,6 @@ package chainstate
 import (
 	"context"
 	"fmt"
-	"strings"
 	"sync"
 	"time"
 
@@ -47,7 +46,9 @@ var (
 //
 // NOTE: if successful (in-mempool), no error will be returned
 // NOTE: function register the fastest successful broadcast into 'completeChannel' so client doesn't need to wait for other providers
-func (c *Client) broadcast(ctx context.Context, id, hex string, timeout time.Duration, completeChannel, errorChannel chan string) {
+func (c *Client) broadcast(ctx context.Context, id string, providers []txBroadcastProvider, timeout time.Duration,
+	completeChannel chan string, errorChannel chan *BroadcastRejection,
+) {
 	// Create a context (to cancel or timeout)
 	ctxWithCancel, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
@@ -57,7 +58,7 @@ func (c *Client) broadcast(ctx context.Context, id, hex string, timeout time.Dur
 	resultsChannel := make(chan broadcastResult)
 	status := newBroadcastStatus(completeChannel)
 
-	for _, broadcastProvider := range createActiveProviders(c, id, hex) {
+	for _, broadcastProvider := range providers {
 		wg.Add(1)
 		go func(provider txBroadcastProvider) {
 			defer wg.Done()
@@ -72,18 +73,18 @@ func (c *Client) broadcast(ctx context.Context, id, hex string, timeout time.Dur
 		status.dispose()
 	}()
 
-	var errorMessages []string
+	var rejections []*BroadcastRejection
 	for result := range resultsChannel {
 		if result.isError {
 			debugLog(c, id, fmt.Sprintf("broadcast error: %s from provider %s", result.err, result.provider))
-			errorMessages = append(errorMessages, result.provider+": "+result.err.Error())
+			rejections = append(rejections, newBroadcastRejection(result.provider, result.err))
 		} else {
 			debugLog(c, id, fmt.Sprintf("successful broadcast to %s", result.provider))
 		}
 	}
 
-	if !status.success && len(errorMessages) > 0 {
-		errorChannel <- strings.Join(errorMessages, ", ")
+	if !status.success && len(rejections) > 0 {
+		errorChannel <- combineBroadcastRejections(rejections)
 	}
 }
 
@@ -109,6 +110,17 @@ func createActiveProviders(c *Client, txID, txHex string) []txBroadcastProvider
 	return providers
 }
 
+// filterProviders will return the providers with the given names (in the order of the providers)
+func filterProviders(providers []txBroadcastProvider, names []string) []txBroadcastProvider {
+	filtered := make([]txBroadcastProvider, 0, len(names))
+	for _, provider := range providers {
+		if utils.StringInSlice(provider.getName(), names) {
+			filtered = append(filtered, provider)
+		}
+	}
+	return filtered
+}
+
 func shouldBroadcastWithMAPI(c *Client) bool {
 	return !utils.StringInSlice(ProviderMAPI, c.options.config.excludedProviders) &&
 		(c.Network() == MainNet || c.Network() == TestNet) // Only supported on main and test right now
@@ -123,7 +135,9 @@ func broadcastToProvider(ctx, fallbackCtx context.Context, provider txBroadcastP
 	c *Client, fallbackTimeout time.Duration,
 	resultsChannel chan broadcastResult, status *broadcastStatus,
 ) {
-	bErr := provider.broadcast(ctx, c)
+	captureCtx, capture := withBackoffCapture(ctx)
+	bErr := provider.broadcast(captureCtx, c)
+	c.recordProviderBackoff(fallbackCtx, provider.getName(), capture, bErr)
 
 	if bErr != nil {
 		// check in Mempool as fallback - if transaction is there -> GREAT SUCCESS
@@ -2,9 +2,11 @@ package chainstate
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/bitcoin-sv/go-broadcast-client/broadcast"
 	"github.com/tonicpow/go-minercraft/v2"
@@ -52,6 +54,9 @@ func broadcastMAPI(ctx context.Context, client ClientInterface, miner *minercraf
 	if resp == nil {
 		return emptyBroadcastResponseErr(id)
 	}
+
+	// Keep the signed response (proof of submission)
+	RecordBroadcastReceipt(ctx, newMAPIBroadcastReceipt(miner.Name, &resp.JSONEnvelope.JSONEnvelope))
 	if !strings.EqualFold(resp.Results.TxID, id) {
 		return incorrectTxIDReturnedErr(resp.Results.TxID, id)
 	}
@@ -109,5 +114,16 @@ func broadcastWithBroadcastClient(ctx context.Context, client ClientInterface, t
 
 	debugLog(client, txID, "result broadcast request for "+ProviderBroadcastClient+" blockhash: "+result.BlockHash+" status: "+result.TxStatus.String())
 
+	// Keep the response (not signed)
+	if payload, jsonErr := json.Marshal(result); jsonErr == nil {
+		RecordBroadcastReceipt(ctx, &BroadcastReceipt{
+			Encoding:   utf8Type,
+			MimeType:   applicationJSONType,
+			Payload:    string(payload),
+			Provider:   ProviderBroadcastClient,
+			ReceivedAt: time.Now().UTC(),
+		})
+	}
+
 	return nil
 }
@@ -0,0 +1,104 @@
+package chainstate
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/libsv/go-bk/envelope"
+)
+
+// BroadcastReceipt is the complete response envelope of a broadcast provider
+//
+// The mAPI responses are signed by the miner (public key is the miner id), this is the proof that the transaction
+// was submitted at the given time. The responses of the other providers are not signed (no signature).
+type BroadcastReceipt struct {
+	Encoding   string    `json:"encoding"`             // Encoding of the payload (IE: UTF-8)
+	MimeType   string    `json:"mime_type"`            // Mime type of the payload (IE: application/json)
+	Payload    string    `json:"payload"`              // Response payload (as returned by the provider)
+	Provider   string    `json:"provider"`             // Name of the provider (miner name or ProviderBroadcastClient)
+	PublicKey  string    `json:"public_key,omitempty"` // Public key of the signer (hex)
+	ReceivedAt time.Time `json:"received_at"`          // Time the response was received
+	Signature  string    `json:"signature,omitempty"`  // Signature of the payload (hex, DER)
+}
+
+// broadcastReceiptsKey is the context key of the receipts collector
+type broadcastReceiptsKey struct{}
+
+// BroadcastReceipts collects the receipts of the broadcast requests made with the context
+type BroadcastReceipts struct {
+	mu       sync.Mutex
+	receipts []*BroadcastReceipt
+}
+
+// WithBroadcastReceipts will return a context that collects the receipts of the broadcast requests
+//
+// Every provider response (accepted or rejected) is collected, use Receipts() after the broadcast
+func WithBroadcastReceipts(ctx context.Context) (context.Context, *BroadcastReceipts) {
+	receipts := new(BroadcastReceipts)
+	return context.WithValue(ctx, broadcastReceiptsKey{}, receipts), receipts
+}
+
+// Receipts will return the collected receipts (in the order received)
+func (r *BroadcastReceipts) Receipts() []*BroadcastReceipt {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append(make([]*BroadcastReceipt, 0, len(r.receipts)), r.receipts...)
+}
+
+// RecordBroadcastReceipt will add the receipt to the collector of the context (if any, see WithBroadcastReceipts)
+//
+// Custom implementations of the ClientInterface should record the provider responses
+func RecordBroadcastReceipt(ctx context.Context, receipt *BroadcastReceipt) {
+	if receipt == nil {
+		return
+	}
+	if receipts, ok := ctx.Value(broadcastReceiptsKey{}).(*BroadcastReceipts); ok {
+		receipts.mu.Lock()
+		defer receipts.mu.Unlock()
+		receipts.receipts = append(receipts.receipts, receipt)
+	}
+}
+
+// newMAPIBroadcastReceipt will create the receipt from the mAPI response envelope
+func newMAPIBroadcastReceipt(provider string, env *envelope.JSONEnvelope) *BroadcastReceipt {
+	receipt := &BroadcastReceipt{
+		Encoding:   env.Encoding,
+		MimeType:   env.MimeType,
+		Payload:    env.Payload,
+		Provider:   provider,
+		ReceivedAt: time.Now().UTC(),
+	}
+	if env.PublicKey != nil {
+		receipt.PublicKey = *env.PublicKey
+	}
+	if env.Signature != nil {
+		receipt.Signature = *env.Signature
+	}
+	return receipt
+}
+
+// VerifyBroadcastReceipt will check the signature of the receipt over the payload
+//
+// ErrBroadcastReceiptUnsigned is returned if the receipt is not signed (no proof of submission)
+func VerifyBroadcastReceipt(receipt *BroadcastReceipt) error {
+	if receipt == nil || len(receipt.Signature) == 0 || len(receipt.PublicKey) == 0 {
+		return ErrBroadcastReceiptUnsigned
+	}
+
+	env := &envelope.JSONEnvelope{
+		Encoding:  receipt.Encoding,
+		MimeType:  receipt.MimeType,
+		Payload:   receipt.Payload,
+		PublicKey: &receipt.PublicKey,
+		Signature: &receipt.Signature,
+	}
+	valid, err := env.IsValid()
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidBroadcastReceipt, err.Error())
+	} else if !valid {
+		return ErrInvalidBroadcastReceipt
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package chainstate
+
+import (
+	"context"
+	"testing"
+
+	"github.com/libsv/go-bk/envelope"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tonicpow/go-minercraft/v2"
+)
+
+// TestWithBroadcastReceipts will test collecting the receipts of the broadcast requests
+func TestWithBroadcastReceipts(t *testing.T) {
+	t.Parallel()
+
+	t.Run("mAPI response", func(t *testing.T) {
+		c := NewTestClient(context.Background(), t, WithMinercraft(&minerCraftBroadcastSuccess{}))
+		miner := c.Minercraft().MinerByName(minercraft.MinerTaal)
+		require.NotNil(t, miner)
+
+		ctx, receipts := WithBroadcastReceipts(context.Background())
+		require.NoError(t, broadcastMAPI(ctx, c, miner, broadcastExample1TxID, broadcastExample1TxHex))
+
+		collected := receipts.Receipts()
+		require.Len(t, collected, 1)
+		assert.Equal(t, minercraft.MinerTaal, collected[0].Provider)
+		assert.Contains(t, collected[0].Payload, broadcastExample1TxID)
+		assert.Equal(t, miner.MinerID, collected[0].PublicKey)
+		assert.NotEmpty(t, collected[0].Signature)
+		assert.Equal(t, applicationJSONType, collected[0].MimeType)
+		assert.False(t, collected[0].ReceivedAt.IsZero())
+	})
+
+	t.Run("no collector", func(t *testing.T) {
+		RecordBroadcastReceipt(context.Background(), &BroadcastReceipt{Provider: "test"})
+	})
+}
+
+// TestVerifyBroadcastReceipt will test the method VerifyBroadcastReceipt()
+func TestVerifyBroadcastReceipt(t *testing.T) {
+	t.Parallel()
+
+	env, err := envelope.NewJSONEnvelope(map[string]string{"txid": broadcastExample1TxID, "returnResult": "success"})
+	require.NoError(t, err)
+	receipt := newMAPIBroadcastReceipt(minercraft.MinerTaal, env)
+
+	t.Run("valid signature", func(t *testing.T) {
+		assert.NoError(t, VerifyBroadcastReceipt(receipt))
+	})
+
+	t.Run("changed payload", func(t *testing.T) {
+		changed := *receipt
+		changed.Payload = `{"returnResult":"failure","txid":"` + broadcastExample1TxID + `"}`
+		assert.ErrorIs(t, VerifyBroadcastReceipt(&changed), ErrInvalidBroadcastReceipt)
+	})
+
+	t.Run("invalid public key", func(t *testing.T) {
+		changed := *receipt
+		changed.PublicKey = "not-hex"
+		assert.ErrorIs(t, VerifyBroadcastReceipt(&changed), ErrInvalidBroadcastReceipt)
+	})
+
+	t.Run("unsigned", func(t *testing.T) {
+		assert.ErrorIs(t, VerifyBroadcastReceipt(&BroadcastReceipt{Payload: "{}"}), ErrBroadcastReceiptUnsigned)
+		assert.ErrorIs(t, VerifyBroadcastReceipt(nil), ErrBroadcastReceiptUnsigned)
+	})
+}
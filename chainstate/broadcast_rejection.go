@@ -0,0 +1,200 @@
+package chainstate
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/bitcoin-sv/go-broadcast-client/broadcast"
+)
+
+// RejectionReason is the normalized reason a broadcast was rejected by the provider(s)
+type RejectionReason string
+
+// Normalized rejection reasons
+const (
+	RejectionDoubleSpend         RejectionReason = "double_spend"         // Missing inputs or inputs already spent (conflict)
+	RejectionFeeTooLow           RejectionReason = "fee_too_low"          // Fee is below the miner's minimum
+	RejectionNonFinal            RejectionReason = "non_final"            // Transaction is not final (nLockTime / nSequence)
+	RejectionProviderUnavailable RejectionReason = "provider_unavailable" // Provider could not be reached (retry later)
+	RejectionScriptFailure       RejectionReason = "script_failure"       // Script (signature) verification failed
+	RejectionUnknown             RejectionReason = "unknown"              // Reason could not be determined
+)
+
+var (
+	// rejectionMessages are the (lowercase) provider messages for each reason
+	rejectionMessages = map[RejectionReason][]string{
+		RejectionDoubleSpend: {
+			"missing inputs", "missingorspent", "inputs_spent", "txn-mempool-conflict", "txn_mempool_conflict",
+			"double spend", "double-spend", "conflicting",
+		},
+		RejectionFeeTooLow: {
+			"insufficient priority", "fee too low", "fee_too_low", "min relay fee not met", "mempool min fee not met",
+			"insufficient fee",
+		},
+		RejectionNonFinal: {
+			"non-final", "non_final", "non-bip68-final", "non_bip68_final",
+		},
+		RejectionScriptFailure: {
+			"script-verify-flag-failed", "script verify", "script failed", "scriptsig", "unlocking script",
+			"signature must", "nonstandard_inputs",
+		},
+		RejectionProviderUnavailable: {
+			"connection refused", "context deadline exceeded", "context canceled", "no such host", "timeout",
+			"service unavailable", "bad gateway", "eof", "all broadcasters failed",
+		},
+	}
+
+	// rejectionPriority is the order used to pick the reason when several providers rejected the transaction
+	rejectionPriority = []RejectionReason{
+		RejectionDoubleSpend,
+		RejectionFeeTooLow,
+		RejectionScriptFailure,
+		RejectionNonFinal,
+		RejectionUnknown,
+		RejectionProviderUnavailable,
+	}
+
+	// arcStatusPattern finds the Arc status code in an error message
+	arcStatusPattern = regexp.MustCompile(`status: (\d{3})`)
+
+	// nodeRejectPattern finds the node reject code at the start of a mAPI result description
+	nodeRejectPattern = regexp.MustCompile(`^(?:ERROR: )?(\d{1,3}): `)
+)
+
+// BroadcastRejection is the parsed (typed) broadcast error from the provider(s)
+type BroadcastRejection struct {
+	Code     int             `json:"code,omitempty"` // Provider status code (Arc)
+	Message  string          `json:"message"`        // Original provider message(s)
+	Provider string          `json:"provider"`       // Provider that rejected the transaction (or all)
+	Reason   RejectionReason `json:"reason"`         // Normalized reason
+}
+
+// Error will return the original provider message(s)
+func (r *BroadcastRejection) Error() string {
+	return r.Message
+}
+
+// Is will match the sentinel error of the normalized reason (errors.Is(err, ErrBroadcastFeeTooLow))
+func (r *BroadcastRejection) Is(target error) bool {
+	return target == ErrBroadcastFeeTooLow && r.Reason == RejectionFeeTooLow
+}
+
+// IsRetryable will return true if the broadcast should be retried later
+func (r *BroadcastRejection) IsRetryable() bool {
+	return r.Reason == RejectionProviderUnavailable
+}
+
+// GetBroadcastRejection will return the rejection from a broadcast error (unknown if not found)
+func GetBroadcastRejection(err error) *BroadcastRejection {
+	if err == nil {
+		return nil
+	}
+	var rejection *BroadcastRejection
+	if errors.As(err, &rejection) {
+		return rejection
+	}
+	return &BroadcastRejection{Message: err.Error(), Provider: ProviderAll, Reason: RejectionUnknown}
+}
+
+// newBroadcastRejection will parse the provider error into a rejection
+func newBroadcastRejection(provider string, err error) *BroadcastRejection {
+	rejection := &BroadcastRejection{
+		Message:  err.Error(),
+		Provider: provider,
+		Reason:   RejectionUnknown,
+	}
+
+	// Arc status codes
+	var arcErr broadcast.ArcError
+	if errors.As(err, &arcErr) {
+		rejection.Code = arcErr.Status
+	} else if matches := arcStatusPattern.FindStringSubmatch(rejection.Message); len(matches) == 2 {
+		rejection.Code, _ = strconv.Atoi(matches[1])
+	}
+	if reason := arcStatusReason(rejection.Code); reason != RejectionUnknown {
+		rejection.Reason = reason
+		return rejection
+	}
+
+	// Timeouts and cancellations
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		rejection.Reason = RejectionProviderUnavailable
+		return rejection
+	}
+
+	// mAPI result descriptions with a node reject code
+	if matches := nodeRejectPattern.FindStringSubmatch(rejection.Message); len(matches) == 2 {
+		code, _ := strconv.Atoi(matches[1])
+		if reason := nodeRejectReason(code); reason != RejectionUnknown {
+			rejection.Reason = reason
+			return rejection
+		}
+	}
+
+	// mAPI result descriptions (and other messages)
+	rejection.Reason = parseRejectionReason(rejection.Message)
+	return rejection
+}
+
+// arcStatusReason will return the reason for the Arc status code
+func arcStatusReason(code int) RejectionReason {
+	switch {
+	case code == 465:
+		return RejectionFeeTooLow
+	case code == 462, code == 466:
+		return RejectionDoubleSpend
+	case code == 461:
+		return RejectionScriptFailure
+	case code >= 500:
+		return RejectionProviderUnavailable
+	}
+	return RejectionUnknown
+}
+
+// nodeRejectReason will return the reason for the node reject code (REJECT_INSUFFICIENTFEE)
+func nodeRejectReason(code int) RejectionReason {
+	if code == 66 {
+		return RejectionFeeTooLow
+	}
+	return RejectionUnknown
+}
+
+// parseRejectionReason will return the reason found in the provider message
+func parseRejectionReason(message string) RejectionReason {
+	for _, reason := range rejectionPriority {
+		if doesErrorContain(message, rejectionMessages[reason]) {
+			return reason
+		}
+	}
+	return RejectionUnknown
+}
+
+// combineBroadcastRejections will combine the rejections of all providers (most relevant reason wins)
+func combineBroadcastRejections(rejections []*BroadcastRejection) *BroadcastRejection {
+	combined := &BroadcastRejection{
+		Provider: ProviderAll,
+		Reason:   RejectionUnknown,
+	}
+	messages := make([]string, 0, len(rejections))
+	for _, rejection := range rejections {
+		messages = append(messages, rejection.Provider+": "+rejection.Message)
+	}
+	combined.Message = strings.Join(messages, ", ")
+
+	for _, reason := range rejectionPriority {
+		for _, rejection := range rejections {
+			if rejection.Reason == reason {
+				combined.Code = rejection.Code
+				combined.Reason = reason
+				if len(rejections) == 1 {
+					combined.Provider = rejection.Provider
+				}
+				return combined
+			}
+		}
+	}
+	return combined
+}
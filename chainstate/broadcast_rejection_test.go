@@ -0,0 +1,135 @@
+package chainstate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/bitcoin-sv/go-broadcast-client/broadcast"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test_newBroadcastRejection will test the method newBroadcastRejection()
+func Test_newBroadcastRejection(t *testing.T) {
+	t.Parallel()
+
+	t.Run("arc error status", func(t *testing.T) {
+		rejection := newBroadcastRejection(ProviderBroadcastClient, broadcast.ArcError{Status: 465, Title: "fee too low"})
+		require.NotNil(t, rejection)
+		assert.Equal(t, 465, rejection.Code)
+		assert.Equal(t, RejectionFeeTooLow, rejection.Reason)
+		assert.Equal(t, ProviderBroadcastClient, rejection.Provider)
+	})
+
+	t.Run("arc status in message", func(t *testing.T) {
+		rejection := newBroadcastRejection(ProviderBroadcastClient, errors.New("arc error status: 466, title: conflict"))
+		assert.Equal(t, 466, rejection.Code)
+		assert.Equal(t, RejectionDoubleSpend, rejection.Reason)
+	})
+
+	t.Run("arc server error", func(t *testing.T) {
+		rejection := newBroadcastRejection(ProviderBroadcastClient, broadcast.ArcError{Status: 503})
+		assert.Equal(t, RejectionProviderUnavailable, rejection.Reason)
+		assert.True(t, rejection.IsRetryable())
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		rejection := newBroadcastRejection(ProviderMAPI, fmt.Errorf("request failed: %w", context.DeadlineExceeded))
+		assert.Equal(t, RejectionProviderUnavailable, rejection.Reason)
+	})
+
+	t.Run("mapi result description", func(t *testing.T) {
+		rejection := newBroadcastRejection(ProviderMAPI, errors.New("ERROR: 258: txn-mempool-conflict"))
+		assert.Equal(t, RejectionDoubleSpend, rejection.Reason)
+		assert.False(t, rejection.IsRetryable())
+	})
+
+	t.Run("mapi node reject code", func(t *testing.T) {
+		rejection := newBroadcastRejection(ProviderMAPI, errors.New("ERROR: 66: mempool min fee not met"))
+		assert.Equal(t, RejectionFeeTooLow, rejection.Reason)
+		assert.ErrorIs(t, rejection, ErrBroadcastFeeTooLow)
+	})
+
+	t.Run("unknown", func(t *testing.T) {
+		rejection := newBroadcastRejection(ProviderMAPI, errors.New("something unexpected"))
+		assert.Equal(t, RejectionUnknown, rejection.Reason)
+		assert.Equal(t, "something unexpected", rejection.Error())
+	})
+}
+
+// Test_parseRejectionReason will test the method parseRejectionReason()
+func Test_parseRejectionReason(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]RejectionReason{
+		"Missing inputs":                                  RejectionDoubleSpend,
+		"66: insufficient priority":                       RejectionFeeTooLow,
+		"mandatory-script-verify-flag-failed (Signature)": RejectionScriptFailure,
+		"64: non-final":                                   RejectionNonFinal,
+		"dial tcp: connection refused":                    RejectionProviderUnavailable,
+		"":                                                RejectionUnknown,
+	}
+	for message, reason := range tests {
+		assert.Equal(t, reason, parseRejectionReason(message), message)
+	}
+}
+
+// Test_combineBroadcastRejections will test the method combineBroadcastRejections()
+func Test_combineBroadcastRejections(t *testing.T) {
+	t.Parallel()
+
+	t.Run("most relevant reason wins", func(t *testing.T) {
+		rejection := combineBroadcastRejections([]*BroadcastRejection{
+			{Message: "timeout", Provider: ProviderMAPI, Reason: RejectionProviderUnavailable},
+			{Code: 466, Message: "conflict", Provider: ProviderBroadcastClient, Reason: RejectionDoubleSpend},
+		})
+		assert.Equal(t, RejectionDoubleSpend, rejection.Reason)
+		assert.Equal(t, 466, rejection.Code)
+		assert.Equal(t, ProviderAll, rejection.Provider)
+		assert.Equal(t, ProviderMAPI+": timeout, "+ProviderBroadcastClient+": conflict", rejection.Message)
+	})
+
+	t.Run("single provider", func(t *testing.T) {
+		rejection := combineBroadcastRejections([]*BroadcastRejection{
+			{Message: "64: non-final", Provider: ProviderMAPI, Reason: RejectionNonFinal},
+		})
+		assert.Equal(t, RejectionNonFinal, rejection.Reason)
+		assert.Equal(t, ProviderMAPI, rejection.Provider)
+	})
+
+	t.Run("no rejections", func(t *testing.T) {
+		rejection := combineBroadcastRejections(nil)
+		assert.Equal(t, RejectionUnknown, rejection.Reason)
+		assert.Equal(t, ProviderAll, rejection.Provider)
+	})
+}
+
+// TestGetBroadcastRejection will test the method GetBroadcastRejection()
+func TestGetBroadcastRejection(t *testing.T) {
+	t.Parallel()
+
+	t.Run("nil error", func(t *testing.T) {
+		assert.Nil(t, GetBroadcastRejection(nil))
+	})
+
+	t.Run("wrapped rejection", func(t *testing.T) {
+		rejection := &BroadcastRejection{Message: "conflict", Provider: ProviderAll, Reason: RejectionDoubleSpend}
+		got := GetBroadcastRejection(fmt.Errorf("broadcast failed: %w", rejection))
+		assert.Equal(t, rejection, got)
+	})
+
+	t.Run("fee too low is matched", func(t *testing.T) {
+		rejection := &BroadcastRejection{Message: "fee", Provider: ProviderAll, Reason: RejectionFeeTooLow}
+		assert.ErrorIs(t, fmt.Errorf("broadcast failed: %w", rejection), ErrBroadcastFeeTooLow)
+		assert.NotErrorIs(t, &BroadcastRejection{Reason: RejectionDoubleSpend}, ErrBroadcastFeeTooLow)
+	})
+
+	t.Run("plain error", func(t *testing.T) {
+		got := GetBroadcastRejection(errors.New("some error"))
+		require.NotNil(t, got)
+		assert.Equal(t, RejectionUnknown, got.Reason)
+		assert.Equal(t, "some error", got.Message)
+	})
+}
@@ -257,3 +257,45 @@ func containsAtLeastOneElement(coll1 []string, coll2 ...string) bool {
 
 	return false
 }
+
+// TestClient_BroadcastWithProviders will test the method BroadcastWithProviders()
+func TestClient_BroadcastWithProviders(t *testing.T) {
+	t.Parallel()
+
+	newClient := func(t *testing.T) ClientInterface {
+		bc := broadcast_client_mock.Builder().
+			WithMockArc(broadcast_client_mock.MockSuccess).
+			Build()
+		return NewTestClient(
+			context.Background(), t,
+			WithMinercraft(&minerCraftBroadcastTimeout{}), // Timeout
+			WithBroadcastClient(bc),                       // Success
+		)
+	}
+
+	t.Run("configured providers", func(t *testing.T) {
+		providers := newClient(t).BroadcastProviders()
+		assert.Contains(t, providers, ProviderBroadcastClient)
+		assert.Contains(t, providers, minercraft.MinerTaal)
+	})
+
+	t.Run("only the given providers", func(t *testing.T) {
+		c := newClient(t)
+
+		provider, err := c.BroadcastWithProviders(
+			context.Background(), broadcastExample1TxID, broadcastExample1TxHex,
+			[]string{ProviderBroadcastClient}, defaultBroadcastTimeOut,
+		)
+		require.NoError(t, err)
+		assert.Equal(t, ProviderBroadcastClient, provider) // The mAPI miners (timeouts) are not used
+	})
+
+	t.Run("error - unknown providers", func(t *testing.T) {
+		provider, err := newClient(t).BroadcastWithProviders(
+			context.Background(), broadcastExample1TxID, broadcastExample1TxHex,
+			[]string{"unknown"}, defaultBroadcastTimeOut,
+		)
+		require.ErrorIs(t, err, ErrMissingBroadcastProviders)
+		assert.Empty(t, provider)
+	})
+}
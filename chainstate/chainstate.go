@@ -23,15 +23,73 @@ func (c *Client) Broadcast(ctx context.Context, id, txHex string, timeout time.D
 		return "", ErrInvalidTransactionHex
 	}
 
+	active, err := c.availableProviders(ctx, createActiveProviders(c, id, txHex))
+	if err != nil {
+		return "", err
+	}
+	return c.broadcastToProviders(ctx, id, txHex, active, timeout)
+}
+
+// BroadcastWithProviders will attempt to broadcast a transaction using only the given providers (by name)
+//
+// The names are the names of the mAPI miners or ProviderBroadcastClient (see BroadcastProviders)
+func (c *Client) BroadcastWithProviders(ctx context.Context, id, txHex string, providers []string,
+	timeout time.Duration,
+) (string, error) {
+	// Basic validation
+	if len(id) < 50 {
+		return "", ErrInvalidTransactionID
+	} else if len(txHex) <= 0 {
+		return "", ErrInvalidTransactionHex
+	}
+
+	active := filterProviders(createActiveProviders(c, id, txHex), providers)
+	if len(active) == 0 {
+		return "", fmt.Errorf("%w: %v", ErrMissingBroadcastProviders, providers)
+	}
+	active, err := c.availableProviders(ctx, active)
+	if err != nil {
+		return "", err
+	}
+	return c.broadcastToProviders(ctx, id, txHex, active, timeout)
+}
+
+// availableProviders will return the providers that are not in backoff (rate limited)
+//
+// ErrProvidersInBackoff is returned if all the providers are in backoff
+func (c *Client) availableProviders(ctx context.Context,
+	providers []txBroadcastProvider,
+) ([]txBroadcastProvider, error) {
+	available, until := c.withoutBackoffProviders(ctx, providers)
+	if len(available) == 0 && len(providers) > 0 {
+		return nil, fmt.Errorf("%w until %s", ErrProvidersInBackoff, until.UTC().Format(time.RFC3339))
+	}
+	return available, nil
+}
+
+// BroadcastProviders will return the names of the configured broadcast providers
+func (c *Client) BroadcastProviders() []string {
+	providers := createActiveProviders(c, "", "")
+	names := make([]string, 0, len(providers))
+	for _, provider := range providers {
+		names = append(names, provider.getName())
+	}
+	return names
+}
+
+// broadcastToProviders will broadcast the transaction to the providers (the first success is returned)
+func (c *Client) broadcastToProviders(ctx context.Context, id, txHex string, providers []txBroadcastProvider,
+	timeout time.Duration,
+) (string, error) {
 	// Debug the id and hex
 	c.DebugLog("tx_id: " + id)
 	c.DebugLog("tx_hex: " + txHex)
 
 	// Broadcast or die
 	successCompleteCh := make(chan string)
-	errorCh := make(chan string)
+	errorCh := make(chan *BroadcastRejection)
 
-	go c.broadcast(ctx, id, txHex, timeout, successCompleteCh, errorCh)
+	go c.broadcast(ctx, id, providers, timeout, successCompleteCh, errorCh)
 
 	// wait for first success
 	success := <-successCompleteCh
@@ -40,8 +98,9 @@ func (c *Client) Broadcast(ctx context.Context, id, txHex string, timeout time.D
 	}
 
 	// successCompleteCh closed without any values
-	errorMessage := <-errorCh
-	return ProviderAll, fmt.Errorf("broadcast failed, errors: %s", errorMessage)
+	// (the rejection has the normalized reason, use GetBroadcastRejection())
+	rejection := <-errorCh
+	return ProviderAll, fmt.Errorf("broadcast failed (%s), errors: %w", rejection.Reason, rejection)
 }
 
 // QueryTransaction will get the transaction info from all providers returning the "first" valid result
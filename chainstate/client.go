@@ -35,6 +35,7 @@ type (
 
 	// syncConfig holds all the configuration about the different sync processes
 	syncConfig struct {
+		backoffStore          BackoffStore               // Store of the backoff of the rate limited providers
 		excludedProviders     []string                   // List of provider names
 		httpClient            HTTPInterface              // Custom HTTP client (Minercraft, WOC)
 		minercraftConfig      *minercraftConfig          // minercraftConfig configuration
@@ -44,6 +45,8 @@ type (
 		broadcastClient       broadcast.Client           // Broadcast client
 		broadcastClientConfig *broadcastClientConfig     // Broadcast client config
 		pulseClient           *PulseClient               // Pulse client
+		rawTxProviders        []rawTransactionProvider   // Providers of the raw transactions (in order)
+		rawTxStore            RawTransactionStore        // Cache of the raw transactions (none by default)
 	}
 
 	// minercraftConfig is specific for minercraft configuration
@@ -58,6 +61,7 @@ type (
 
 	// Miner is the internal chainstate miner (wraps Minercraft miner with more information)
 	Miner struct {
+		AncestorLimit  uint32            `json:"ancestor_limit"`   // The limit of unconfirmed ancestors returned from Policy request (0 = unknown)
 		FeeLastChecked time.Time         `json:"fee_last_checked"` // Last time the fee was checked via mAPI
 		FeeUnit        *utils.FeeUnit    `json:"fee_unit"`         // The fee unit returned from Policy request
 		Miner          *minercraft.Miner `json:"miner"`            // The minercraft miner
@@ -193,6 +197,19 @@ func (c *Client) FeeUnit() *utils.FeeUnit {
 	return c.options.config.minercraftConfig.feeUnit
 }
 
+// AncestorLimit will return the lowest limit of unconfirmed ancestors among the broadcast miners
+//
+// The limit is refreshed from the miner's policy (ValidateMiners), 0 if no miner returned a limit
+func (c *Client) AncestorLimit() uint32 {
+	var limit uint32
+	for _, miner := range c.options.config.minercraftConfig.broadcastMiners {
+		if miner.AncestorLimit > 0 && (limit == 0 || miner.AncestorLimit < limit) {
+			limit = miner.AncestorLimit
+		}
+	}
+	return limit
+}
+
 func (c *Client) isMinercraftFeeQuotesEnabled() bool {
 	return c.options.config.minercraftConfig.minercraftFeeQuotes
 }
@@ -240,6 +257,11 @@ func (c *Client) ValidateMiners(ctx context.Context) {
 				}
 
 				fee = quote.Quote.Fees[0]
+
+				// The policy also contains the limit of unconfirmed ancestors
+				if quote.Quote.Policies != nil {
+					miner.AncestorLimit = quote.Quote.Policies.LimitAncestorCount
+				}
 			}
 			if c.isMinercraftFeeQuotesEnabled() {
 				miner.FeeUnit = &utils.FeeUnit{
@@ -43,9 +43,14 @@ func (c *Client) startMinerCraft(ctx context.Context) (err error) {
 				loadedMiners = append(loadedMiners, c.options.config.minercraftConfig.queryMiners[i].Miner.MinerID)
 			}
 		}
+		// Capture the rate limit headers of the responses (see backoffHTTPClient)
+		var httpClient minercraft.HTTPInterface
+		if c.HTTPClient() != nil {
+			httpClient = &backoffHTTPClient{client: c.HTTPClient()}
+		}
 		c.options.config.minercraft, err = minercraft.NewClient(
 			c.defaultMinercraftOptions(),
-			c.HTTPClient(),
+			httpClient,
 			c.options.config.minercraftConfig.apiType,
 			optionalMiners,
 			c.options.config.minercraftConfig.minerAPIs,
@@ -27,7 +27,8 @@ func defaultClientOptions() *clientOptions {
 	// Set the default options
 	return &clientOptions{
 		config: &syncConfig{
-			httpClient: nil,
+			backoffStore: newMemoryBackoffStore(),
+			httpClient:   nil,
 			minercraftConfig: &minercraftConfig{
 				broadcastMiners:     bm,
 				queryMiners:         qm,
@@ -100,6 +101,15 @@ func WithDebugging() ClientOps {
 	}
 }
 
+// WithBackoffStore will set a custom store for the backoff of the rate limited providers (IE: a shared cache)
+func WithBackoffStore(store BackoffStore) ClientOps {
+	return func(c *clientOptions) {
+		if store != nil {
+			c.config.backoffStore = store
+		}
+	}
+}
+
 // WithHTTPClient will set a custom HTTP client
 func WithHTTPClient(client HTTPInterface) ClientOps {
 	return func(c *clientOptions) {
@@ -242,6 +252,31 @@ func WithBroadcastClientAPIs(apis []broadcastClient.ArcClientConfig) ClientOps {
 	}
 }
 
+// WithWhatsOnChain will add WhatsOnChain as a raw transaction provider (the API key is optional)
+func WithWhatsOnChain(apiKey string) ClientOps {
+	return func(c *clientOptions) {
+		c.config.rawTxProviders = append(c.config.rawTxProviders, &whatsOnChainProvider{apiKey: apiKey})
+	}
+}
+
+// WithJungleBus will add a JungleBus (IE: https://junglebus.gorillapool.io) as a raw transaction provider
+func WithJungleBus(url string) ClientOps {
+	return func(c *clientOptions) {
+		if len(url) > 0 {
+			c.config.rawTxProviders = append(c.config.rawTxProviders, &jungleBusProvider{url: url})
+		}
+	}
+}
+
+// WithRawTransactionStore will set a cache of the raw transactions fetched from the providers (IE: a shared cache)
+func WithRawTransactionStore(store RawTransactionStore) ClientOps {
+	return func(c *clientOptions) {
+		if store != nil {
+			c.config.rawTxStore = store
+		}
+	}
+}
+
 // WithConnectionToPulse will set pulse API settings.
 func WithConnectionToPulse(url, authToken string) ClientOps {
 	return func(c *clientOptions) {
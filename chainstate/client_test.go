@@ -145,3 +145,24 @@ func TestNewClient(t *testing.T) {
 		assert.ErrorIs(t, err, ErrMissingBroadcastMiners)
 	})
 }
+
+// TestClient_AncestorLimit will test the method AncestorLimit()
+func TestClient_AncestorLimit(t *testing.T) {
+	t.Parallel()
+
+	newClientWithMiners := func(miners ...*Miner) *Client {
+		return &Client{options: &clientOptions{config: &syncConfig{
+			minercraftConfig: &minercraftConfig{broadcastMiners: miners},
+		}}}
+	}
+
+	t.Run("no limits", func(t *testing.T) {
+		c := newClientWithMiners(&Miner{}, &Miner{})
+		assert.Equal(t, uint32(0), c.AncestorLimit())
+	})
+
+	t.Run("lowest known limit", func(t *testing.T) {
+		c := newClientWithMiners(&Miner{AncestorLimit: 1000}, &Miner{}, &Miner{AncestorLimit: 25})
+		assert.Equal(t, uint32(25), c.AncestorLimit())
+	})
+}
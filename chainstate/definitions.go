@@ -14,7 +14,12 @@ const (
 	defaultFeeLastCheckIgnore      = 2 * time.Minute
 	defaultMaxNumberOfDestinations = 100000
 	defaultMonitorDays             = 7
+	defaultProviderBackoff         = 30 * time.Second
 	defaultQueryTimeOut            = 15 * time.Second
+	maxProviderBackoff             = 10 * time.Minute
+	maxRawTransactionResponseSize  = 64 << 20 // Max size (bytes) of the response of a raw transaction provider
+	whatsOnChainAPIURL             = "https://api.whatsonchain.com/v1/bsv/"
+	whatsOnChainMaxBatchSize       = 20 // Max number of transactions of a bulk request
 	whatsOnChainRateLimitWithKey   = 20
 )
 
@@ -49,6 +54,7 @@ const (
 	ProviderMAPI            = "mapi"            // Query & broadcast provider for mAPI (using given miners)
 	ProviderWhatsOnChain    = "whatsonchain"    // Query & broadcast provider for WhatsOnChain
 	ProviderBroadcastClient = "broadcastclient" // Query & broadcast provider for configured miners
+	ProviderJungleBus       = "junglebus"       // Raw transaction provider for JungleBus
 	ProviderPulse           = "pulse"           // MerkleProof provider
 )
 
@@ -20,8 +20,26 @@ var ErrInvalidRequirements = errors.New("requirements are invalid or missing")
 // ErrMissingBroadcastMiners is when broadcasting miners are missing
 var ErrMissingBroadcastMiners = errors.New("missing: broadcasting miners")
 
+// ErrMissingBroadcastProviders is when none of the given broadcast providers is configured
+var ErrMissingBroadcastProviders = errors.New("missing: broadcast providers")
+
+// ErrProvidersInBackoff is when all the broadcast providers are rate limited (in backoff)
+var ErrProvidersInBackoff = errors.New("broadcast providers are in backoff")
+
 // ErrMissingQueryMiners is when query miners are missing
 var ErrMissingQueryMiners = errors.New("missing: query miners")
 
 // ErrMonitorNotAvailable is when the monitor processor is not available
 var ErrMonitorNotAvailable = errors.New("monitor processor not available")
+
+// ErrBroadcastReceiptUnsigned is when the broadcast receipt has no signature (IE: not a mAPI response)
+var ErrBroadcastReceiptUnsigned = errors.New("broadcast receipt is not signed")
+
+// ErrInvalidBroadcastReceipt is when the signature of the broadcast receipt does not match the payload
+var ErrInvalidBroadcastReceipt = errors.New("invalid broadcast receipt signature")
+
+// ErrMissingRawTransactionProviders is when no raw transaction provider is configured (see WithWhatsOnChain)
+var ErrMissingRawTransactionProviders = errors.New("missing: raw transaction providers")
+
+// ErrBroadcastFeeTooLow is when the broadcast was rejected because the fee is below the miner's minimum
+var ErrBroadcastFeeTooLow = errors.New("broadcast fee too low")
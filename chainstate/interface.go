@@ -26,6 +26,11 @@ type Logger interface {
 // ChainService is the chain related methods
 type ChainService interface {
 	Broadcast(ctx context.Context, id, txHex string, timeout time.Duration) (string, error)
+	BroadcastProviders() []string
+	BroadcastWithProviders(ctx context.Context, id, txHex string, providers []string,
+		timeout time.Duration) (string, error)
+	GetRawTransaction(ctx context.Context, id string) (string, error)
+	GetRawTransactions(ctx context.Context, ids []string) (map[string]string, error)
 	QueryTransaction(
 		ctx context.Context, id string, requiredIn RequiredIn, timeout time.Duration,
 	) (*TransactionInfo, error)
@@ -38,10 +43,12 @@ type ChainService interface {
 type ProviderServices interface {
 	Minercraft() minercraft.ClientInterface
 	BroadcastClient() broadcast.Client
+	ProviderStatus(ctx context.Context) []*ProviderStatus
 }
 
 // MinercraftServices is the minercraft services interface
 type MinercraftServices interface {
+	AncestorLimit() uint32
 	BroadcastMiners() []*Miner
 	QueryMiners() []*Miner
 	ValidateMiners(ctx context.Context)
@@ -0,0 +1,251 @@
+package chainstate
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/BuxOrg/bux/utils"
+	"github.com/bitcoin-sv/go-broadcast-client/broadcast"
+	"github.com/tonicpow/go-minercraft/v2"
+)
+
+// ProviderMock is the provider name used by the MockClient
+const ProviderMock = "mock"
+
+// MockClient is a ready-made mock of the chainstate ClientInterface (for testing)
+//
+// By default all broadcasts succeed and all transactions are found in the mempool,
+// set the funcs to change the behavior. The broadcast transactions are kept in memory.
+// The raw transactions are the RawTransactions (hex by ID), the others are not found.
+type MockClient struct {
+	BroadcastFunc              func(ctx context.Context, id, txHex string, timeout time.Duration) (string, error)
+	BroadcastWithProvidersFunc func(ctx context.Context, id, txHex string, providers []string, timeout time.Duration) (string, error)
+	GetRawTransactionFunc      func(ctx context.Context, id string) (string, error)
+	QueryTransactionFunc       func(ctx context.Context, id string, requiredIn RequiredIn, timeout time.Duration) (*TransactionInfo, error)
+	BroadcastProvidersValue    []string          // Broadcast providers returned (ProviderMock if not set)
+	FeeUnitValue               *utils.FeeUnit    // Fee unit returned (DefaultFee if not set)
+	NetworkValue               Network           // Network returned (MainNet if not set)
+	RawTransactions            map[string]string // Raw transactions returned (hex by ID)
+	broadcasts                 []string          // IDs of the broadcast transactions
+	mu                         sync.RWMutex      // Lock for the broadcasts
+}
+
+// NewMockClient will return a new mock where everything is in the mempool
+func NewMockClient() *MockClient {
+	return &MockClient{}
+}
+
+// NewMockClientOnChain will return a new mock where every transaction is mined at the block height
+func NewMockClientOnChain(blockHeight int64) *MockClient {
+	return &MockClient{
+		QueryTransactionFunc: func(_ context.Context, id string, _ RequiredIn, _ time.Duration) (*TransactionInfo, error) {
+			blockHash, _ := utils.RandomHex(32)
+			return &TransactionInfo{
+				BlockHash:     blockHash,
+				BlockHeight:   blockHeight,
+				Confirmations: 1,
+				ID:            id,
+				Provider:      ProviderMock,
+			}, nil
+		},
+	}
+}
+
+// NewMockClientNotFound will return a new mock where no transaction is found
+func NewMockClientNotFound() *MockClient {
+	return &MockClient{
+		QueryTransactionFunc: func(context.Context, string, RequiredIn, time.Duration) (*TransactionInfo, error) {
+			return nil, ErrTransactionNotFound
+		},
+	}
+}
+
+// Broadcast will broadcast the transaction (BroadcastFunc)
+func (m *MockClient) Broadcast(ctx context.Context, id, txHex string, timeout time.Duration) (string, error) {
+	m.mu.Lock()
+	m.broadcasts = append(m.broadcasts, id)
+	m.mu.Unlock()
+
+	if m.BroadcastFunc != nil {
+		return m.BroadcastFunc(ctx, id, txHex, timeout)
+	}
+	return ProviderMock, nil
+}
+
+// BroadcastWithProviders will broadcast the transaction (BroadcastWithProvidersFunc)
+//
+// By default, the first of the given providers that is configured (BroadcastProviders) is used
+func (m *MockClient) BroadcastWithProviders(ctx context.Context, id, txHex string, providers []string,
+	timeout time.Duration,
+) (string, error) {
+	m.mu.Lock()
+	m.broadcasts = append(m.broadcasts, id)
+	m.mu.Unlock()
+
+	if m.BroadcastWithProvidersFunc != nil {
+		return m.BroadcastWithProvidersFunc(ctx, id, txHex, providers, timeout)
+	}
+	for _, provider := range providers {
+		if utils.StringInSlice(provider, m.BroadcastProviders()) {
+			return provider, nil
+		}
+	}
+	return "", ErrMissingBroadcastProviders
+}
+
+// BroadcastProviders will return the broadcast providers (ProviderMock if not set)
+func (m *MockClient) BroadcastProviders() []string {
+	if len(m.BroadcastProvidersValue) > 0 {
+		return m.BroadcastProvidersValue
+	}
+	return []string{ProviderMock}
+}
+
+// ProviderStatus will return the broadcast providers (never in backoff)
+func (m *MockClient) ProviderStatus(_ context.Context) []*ProviderStatus {
+	providers := m.BroadcastProviders()
+	statuses := make([]*ProviderStatus, 0, len(providers))
+	for _, provider := range providers {
+		statuses = append(statuses, &ProviderStatus{Name: provider})
+	}
+	return statuses
+}
+
+// Broadcasts will return the ids of the broadcast transactions (in order)
+func (m *MockClient) Broadcasts() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	broadcasts := make([]string, len(m.broadcasts))
+	copy(broadcasts, m.broadcasts)
+	return broadcasts
+}
+
+// GetRawTransaction will get the raw transaction (GetRawTransactionFunc, then RawTransactions)
+func (m *MockClient) GetRawTransaction(ctx context.Context, id string) (string, error) {
+	if m.GetRawTransactionFunc != nil {
+		return m.GetRawTransactionFunc(ctx, id)
+	} else if txHex, ok := m.RawTransactions[id]; ok {
+		return txHex, nil
+	}
+	return "", ErrTransactionNotFound
+}
+
+// GetRawTransactions will get the raw transactions (see GetRawTransaction), not found transactions are skipped
+func (m *MockClient) GetRawTransactions(ctx context.Context, ids []string) (map[string]string, error) {
+	transactions := make(map[string]string, len(ids))
+	for _, id := range ids {
+		txHex, err := m.GetRawTransaction(ctx, id)
+		if errors.Is(err, ErrTransactionNotFound) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		transactions[id] = txHex
+	}
+	return transactions, nil
+}
+
+// QueryTransaction will query the transaction (QueryTransactionFunc)
+func (m *MockClient) QueryTransaction(ctx context.Context, id string, requiredIn RequiredIn,
+	timeout time.Duration,
+) (*TransactionInfo, error) {
+	if m.QueryTransactionFunc != nil {
+		return m.QueryTransactionFunc(ctx, id, requiredIn, timeout)
+	}
+	return &TransactionInfo{
+		ID:       id,
+		Provider: ProviderMock,
+	}, nil
+}
+
+// QueryTransactionFastest will query the transaction (QueryTransactionFunc)
+func (m *MockClient) QueryTransactionFastest(ctx context.Context, id string, requiredIn RequiredIn,
+	timeout time.Duration,
+) (*TransactionInfo, error) {
+	return m.QueryTransaction(ctx, id, requiredIn, timeout)
+}
+
+// AncestorLimit will return 0 (unknown)
+func (m *MockClient) AncestorLimit() uint32 {
+	return 0
+}
+
+// BroadcastClient will return nil
+func (m *MockClient) BroadcastClient() broadcast.Client {
+	return nil
+}
+
+// BroadcastMiners will return nil
+func (m *MockClient) BroadcastMiners() []*Miner {
+	return nil
+}
+
+// Close will do nothing
+func (m *MockClient) Close(context.Context) {}
+
+// Debug will do nothing
+func (m *MockClient) Debug(bool) {}
+
+// DebugLog will do nothing
+func (m *MockClient) DebugLog(string) {}
+
+// FeeUnit will return the fee unit (DefaultFee if not set)
+func (m *MockClient) FeeUnit() *utils.FeeUnit {
+	if m.FeeUnitValue != nil {
+		return m.FeeUnitValue
+	}
+	return DefaultFee
+}
+
+// HTTPClient will return nil
+func (m *MockClient) HTTPClient() HTTPInterface {
+	return nil
+}
+
+// IsDebug will return false
+func (m *MockClient) IsDebug() bool {
+	return false
+}
+
+// IsNewRelicEnabled will return false
+func (m *MockClient) IsNewRelicEnabled() bool {
+	return false
+}
+
+// Minercraft will return nil
+func (m *MockClient) Minercraft() minercraft.ClientInterface {
+	return nil
+}
+
+// Monitor will return nil
+func (m *MockClient) Monitor() MonitorService {
+	return nil
+}
+
+// Network will return the network (MainNet if not set)
+func (m *MockClient) Network() Network {
+	if len(m.NetworkValue) > 0 {
+		return m.NetworkValue
+	}
+	return MainNet
+}
+
+// QueryMiners will return nil
+func (m *MockClient) QueryMiners() []*Miner {
+	return nil
+}
+
+// QueryTimeout will return the default query timeout
+func (m *MockClient) QueryTimeout() time.Duration {
+	return defaultQueryTimeOut
+}
+
+// ValidateMiners will do nothing
+func (m *MockClient) ValidateMiners(context.Context) {}
+
+// VerifyMerkleRoots will accept all merkle roots
+func (m *MockClient) VerifyMerkleRoots(context.Context, []string) error {
+	return nil
+}
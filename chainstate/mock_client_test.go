@@ -0,0 +1,80 @@
+package chainstate
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestMockClient will test the MockClient
+func TestMockClient(t *testing.T) {
+	t.Parallel()
+
+	t.Run("mempool by default", func(t *testing.T) {
+		var c ClientInterface = NewMockClient()
+
+		provider, err := c.Broadcast(context.Background(), "tx1", "hex", defaultBroadcastTimeOut)
+		require.NoError(t, err)
+		assert.Equal(t, ProviderMock, provider)
+		assert.Equal(t, []string{"tx1"}, c.(*MockClient).Broadcasts())
+
+		var info *TransactionInfo
+		info, err = c.QueryTransaction(context.Background(), "tx1", RequiredInMempool, defaultQueryTimeOut)
+		require.NoError(t, err)
+		assert.Equal(t, "tx1", info.ID)
+		assert.Equal(t, int64(0), info.BlockHeight)
+		assert.Equal(t, MainNet, c.Network())
+		assert.Equal(t, DefaultFee, c.FeeUnit())
+	})
+
+	t.Run("on chain", func(t *testing.T) {
+		c := NewMockClientOnChain(800000)
+
+		info, err := c.QueryTransactionFastest(context.Background(), "tx1", RequiredOnChain, defaultQueryTimeOut)
+		require.NoError(t, err)
+		assert.Equal(t, int64(800000), info.BlockHeight)
+		assert.Len(t, info.BlockHash, 64)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		c := NewMockClientNotFound()
+
+		_, err := c.QueryTransaction(context.Background(), "tx1", RequiredOnChain, defaultQueryTimeOut)
+		assert.ErrorIs(t, err, ErrTransactionNotFound)
+	})
+
+	t.Run("raw transactions", func(t *testing.T) {
+		c := NewMockClient()
+		c.RawTransactions = map[string]string{broadcastExample1TxID: broadcastExample1TxHex}
+
+		txHex, err := c.GetRawTransaction(context.Background(), broadcastExample1TxID)
+		require.NoError(t, err)
+		assert.Equal(t, broadcastExample1TxHex, txHex)
+
+		_, err = c.GetRawTransaction(context.Background(), notFoundExample1TxID)
+		assert.ErrorIs(t, err, ErrTransactionNotFound)
+
+		var transactions map[string]string
+		transactions, err = c.GetRawTransactions(
+			context.Background(), []string{broadcastExample1TxID, notFoundExample1TxID},
+		)
+		require.NoError(t, err)
+		assert.Equal(t, c.RawTransactions, transactions)
+	})
+
+	t.Run("custom broadcast", func(t *testing.T) {
+		c := NewMockClient()
+		c.BroadcastFunc = func(context.Context, string, string, time.Duration) (string, error) {
+			return ProviderAll, errors.New("txn-mempool-conflict")
+		}
+
+		provider, err := c.Broadcast(context.Background(), "tx1", "hex", defaultBroadcastTimeOut)
+		require.Error(t, err)
+		assert.Equal(t, ProviderAll, provider)
+		assert.Equal(t, []string{"tx1"}, c.Broadcasts())
+	})
+}
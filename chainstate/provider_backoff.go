@@ -0,0 +1,244 @@
+package chainstate
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BackoffStore stores the "backoff until" time of the providers (IE: after a rate limit response)
+//
+// The default store is in memory, a shared store (cachestore) can be set using WithBackoffStore
+type BackoffStore interface {
+	GetBackoff(ctx context.Context, provider string) (time.Time, error)
+	SetBackoff(ctx context.Context, provider string, until time.Time) error
+}
+
+// ProviderStatus is the status of a broadcast provider
+type ProviderStatus struct {
+	BackoffUntil *time.Time `json:"backoff_until,omitempty"` // The provider is skipped until this time (rate limited)
+	InBackoff    bool       `json:"in_backoff"`              // If the provider is currently skipped
+	Name         string     `json:"name"`                    // Name of the provider (see BroadcastProviders)
+}
+
+// rateLimitErrors are the (lowercase) error messages of the providers for a 429 response
+var rateLimitErrors = []string{
+	"code 429",         // go-paymail: bad response from paymail provider: code 429
+	"status code: 429", // minercraft: status code: 429 does not match 200
+	"statuscode: 429",  // go-broadcast-client: { statusCode: 429, body: ... }
+}
+
+// IsRateLimitedError will return true if the error is a rate limit response (429) of a provider
+//
+// Used when the response (and its headers) is not available, IE: the error of a client library
+func IsRateLimitedError(err error) bool {
+	return err != nil && doesErrorContain(err.Error(), rateLimitErrors)
+}
+
+// BackoffFromResponse will return how long the provider should not be called after the response
+//
+// A 429 (or a 503 with Retry-After) response uses the Retry-After header, then the rate limit reset headers,
+// then the default backoff. Any other response only backs off when the rate limit is exhausted (remaining = 0).
+func BackoffFromResponse(resp *http.Response, now time.Time) (time.Duration, bool) {
+	if resp == nil {
+		return 0, false
+	}
+
+	backoff, found := parseRetryAfter(resp.Header, now)
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests:
+		if !found {
+			backoff = defaultProviderBackoff
+		}
+	case resp.StatusCode == http.StatusServiceUnavailable && len(resp.Header.Get("Retry-After")) > 0:
+		if !found {
+			return 0, false
+		}
+	case resp.Header.Get("X-RateLimit-Remaining") == "0" || resp.Header.Get("RateLimit-Remaining") == "0":
+		if !found {
+			return 0, false
+		}
+	default:
+		return 0, false
+	}
+
+	if backoff <= 0 {
+		return 0, false
+	} else if backoff > maxProviderBackoff {
+		backoff = maxProviderBackoff
+	}
+	return backoff, true
+}
+
+// parseRetryAfter will parse the Retry-After (seconds or HTTP date) or the rate limit reset headers
+//
+// The reset headers are either seconds from now or a unix timestamp
+func parseRetryAfter(header http.Header, now time.Time) (time.Duration, bool) {
+	if value := strings.TrimSpace(header.Get("Retry-After")); len(value) > 0 {
+		if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return time.Duration(seconds) * time.Second, true
+		}
+		if date, err := http.ParseTime(value); err == nil {
+			return date.Sub(now), true
+		}
+	}
+
+	for _, name := range []string{"RateLimit-Reset", "X-RateLimit-Reset"} {
+		value := strings.TrimSpace(header.Get(name))
+		if len(value) == 0 {
+			continue
+		}
+		seconds, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			continue
+		}
+		if seconds > now.Unix()/2 { // A unix timestamp, not a delay
+			return time.Unix(seconds, 0).Sub(now), true
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	return 0, false
+}
+
+// memoryBackoffStore is the default (in memory) backoff store
+type memoryBackoffStore struct {
+	backoffs map[string]time.Time
+	mu       sync.RWMutex
+}
+
+// newMemoryBackoffStore will return a new in memory backoff store
+func newMemoryBackoffStore() *memoryBackoffStore {
+	return &memoryBackoffStore{backoffs: make(map[string]time.Time)}
+}
+
+// GetBackoff will return the backoff time of the provider (zero if none)
+func (m *memoryBackoffStore) GetBackoff(_ context.Context, provider string) (time.Time, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.backoffs[provider], nil
+}
+
+// SetBackoff will set the backoff time of the provider (an existing later time is kept)
+func (m *memoryBackoffStore) SetBackoff(_ context.Context, provider string, until time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if until.After(m.backoffs[provider]) {
+		m.backoffs[provider] = until
+	}
+	return nil
+}
+
+// backoffCaptureKey is the context key of the backoff capture of a provider request
+type backoffCaptureKey struct{}
+
+// backoffCapture collects the backoff of the responses of a single provider request
+type backoffCapture struct {
+	mu    sync.Mutex
+	until time.Time
+}
+
+// withBackoffCapture will return a context that captures the backoff of the HTTP responses
+func withBackoffCapture(ctx context.Context) (context.Context, *backoffCapture) {
+	capture := new(backoffCapture)
+	return context.WithValue(ctx, backoffCaptureKey{}, capture), capture
+}
+
+// record will keep the latest backoff time
+func (b *backoffCapture) record(until time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if until.After(b.until) {
+		b.until = until
+	}
+}
+
+// get will return the captured backoff time (zero if none)
+func (b *backoffCapture) get() time.Time {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.until
+}
+
+// backoffHTTPClient wraps the HTTP client to capture the rate limit headers of the responses
+type backoffHTTPClient struct {
+	client HTTPInterface
+}
+
+// Do will fire the request and capture the backoff of the response (see withBackoffCapture)
+func (h *backoffHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	resp, err := h.client.Do(req)
+	if resp != nil {
+		if capture, ok := req.Context().Value(backoffCaptureKey{}).(*backoffCapture); ok {
+			now := time.Now()
+			if backoff, found := BackoffFromResponse(resp, now); found {
+				capture.record(now.Add(backoff))
+			}
+		}
+	}
+	return resp, err
+}
+
+// getProviderBackoff will return the backoff time of the provider (zero if the provider is available)
+func (c *Client) getProviderBackoff(ctx context.Context, provider string) time.Time {
+	until, err := c.options.config.backoffStore.GetBackoff(ctx, provider)
+	if err != nil {
+		c.DebugLog("failed getting the backoff of provider " + provider + ": " + err.Error())
+		return time.Time{}
+	} else if !until.After(time.Now()) {
+		return time.Time{}
+	}
+	return until
+}
+
+// recordProviderBackoff will store the backoff of the provider after a request (captured or from the error)
+func (c *Client) recordProviderBackoff(ctx context.Context, provider string, capture *backoffCapture, err error) {
+	until := capture.get()
+	if until.IsZero() && IsRateLimitedError(err) {
+		until = time.Now().Add(defaultProviderBackoff)
+	}
+	if until.IsZero() {
+		return
+	}
+
+	c.DebugLog("provider " + provider + " is rate limited until " + until.UTC().Format(time.RFC3339))
+	if setErr := c.options.config.backoffStore.SetBackoff(ctx, provider, until); setErr != nil {
+		c.DebugLog("failed setting the backoff of provider " + provider + ": " + setErr.Error())
+	}
+}
+
+// withoutBackoffProviders will return the providers that are not in backoff
+//
+// The earliest backoff time of the skipped providers is returned (zero if none were skipped)
+func (c *Client) withoutBackoffProviders(ctx context.Context,
+	providers []txBroadcastProvider,
+) ([]txBroadcastProvider, time.Time) {
+	available := make([]txBroadcastProvider, 0, len(providers))
+	var earliest time.Time
+	for _, provider := range providers {
+		until := c.getProviderBackoff(ctx, provider.getName())
+		if until.IsZero() {
+			available = append(available, provider)
+		} else if earliest.IsZero() || until.Before(earliest) {
+			earliest = until
+		}
+	}
+	return available, earliest
+}
+
+// ProviderStatus will return the status of the broadcast providers (IE: rate limited providers)
+func (c *Client) ProviderStatus(ctx context.Context) []*ProviderStatus {
+	providers := createActiveProviders(c, "", "")
+	statuses := make([]*ProviderStatus, 0, len(providers))
+	for _, provider := range providers {
+		status := &ProviderStatus{Name: provider.getName()}
+		if until := c.getProviderBackoff(ctx, status.Name); !until.IsZero() {
+			status.BackoffUntil = &until
+			status.InBackoff = true
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
@@ -0,0 +1,181 @@
+package chainstate
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tonicpow/go-minercraft/v2"
+)
+
+// minerCraftRateLimited is a minercraft mock where Taal is rate limited (429)
+type minerCraftRateLimited struct {
+	minerCraftBroadcastSuccess
+}
+
+// SubmitTransaction mocks the SubmitTransaction method of the minercraft API (429 for Taal)
+func (m *minerCraftRateLimited) SubmitTransaction(ctx context.Context, miner *minercraft.Miner,
+	tx *minercraft.Transaction,
+) (*minercraft.SubmitTransactionResponse, error) {
+	if miner.Name == minercraft.MinerTaal {
+		return nil, errors.New("status code: 429 does not match 200")
+	}
+	return m.minerCraftBroadcastSuccess.SubmitTransaction(ctx, miner, tx)
+}
+
+// TestBackoffFromResponse will test the method BackoffFromResponse()
+func TestBackoffFromResponse(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2023, 10, 1, 12, 0, 0, 0, time.UTC)
+	newResponse := func(status int, headers map[string]string) *http.Response {
+		resp := &http.Response{StatusCode: status, Header: make(http.Header)}
+		for key, value := range headers {
+			resp.Header.Set(key, value)
+		}
+		return resp
+	}
+
+	tests := []struct {
+		name     string
+		response *http.Response
+		backoff  time.Duration
+		found    bool
+	}{
+		{"nil response", nil, 0, false},
+		{"success", newResponse(http.StatusOK, nil), 0, false},
+		{"429 retry-after seconds", newResponse(http.StatusTooManyRequests, map[string]string{"Retry-After": "120"}), 2 * time.Minute, true},
+		{"429 retry-after date", newResponse(http.StatusTooManyRequests, map[string]string{
+			"Retry-After": now.Add(90 * time.Second).Format(http.TimeFormat),
+		}), 90 * time.Second, true},
+		{"429 rate limit reset delay", newResponse(http.StatusTooManyRequests, map[string]string{"X-RateLimit-Reset": "45"}), 45 * time.Second, true},
+		{"429 rate limit reset timestamp", newResponse(http.StatusTooManyRequests, map[string]string{
+			"RateLimit-Reset": strconv.FormatInt(now.Add(time.Minute).Unix(), 10),
+		}), time.Minute, true},
+		{"429 without headers", newResponse(http.StatusTooManyRequests, nil), defaultProviderBackoff, true},
+		{"429 capped", newResponse(http.StatusTooManyRequests, map[string]string{"Retry-After": "86400"}), maxProviderBackoff, true},
+		{"503 retry-after", newResponse(http.StatusServiceUnavailable, map[string]string{"Retry-After": "10"}), 10 * time.Second, true},
+		{"503 without retry-after", newResponse(http.StatusServiceUnavailable, nil), 0, false},
+		{"exhausted rate limit", newResponse(http.StatusOK, map[string]string{
+			"X-RateLimit-Remaining": "0", "X-RateLimit-Reset": "30",
+		}), 30 * time.Second, true},
+		{"remaining rate limit", newResponse(http.StatusOK, map[string]string{
+			"X-RateLimit-Remaining": "5", "X-RateLimit-Reset": "30",
+		}), 0, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			backoff, found := BackoffFromResponse(test.response, now)
+			assert.Equal(t, test.found, found)
+			assert.Equal(t, test.backoff, backoff)
+		})
+	}
+}
+
+// TestIsRateLimitedError will test the method IsRateLimitedError()
+func TestIsRateLimitedError(t *testing.T) {
+	t.Parallel()
+
+	assert.False(t, IsRateLimitedError(nil))
+	assert.False(t, IsRateLimitedError(errors.New("status code: 500 does not match 200")))
+	assert.True(t, IsRateLimitedError(errors.New("status code: 429 does not match 200")))
+	assert.True(t, IsRateLimitedError(errors.New("bad response from paymail provider: code 429, message: slow down")))
+	assert.True(t, IsRateLimitedError(errors.New("server responded with no-success code. details: { statusCode: 429, body: }")))
+}
+
+// Test_backoffHTTPClient will test capturing the backoff of a mocked 429 response
+func Test_backoffHTTPClient(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	client := &backoffHTTPClient{client: server.Client()}
+
+	t.Run("captured", func(t *testing.T) {
+		ctx, capture := withBackoffCapture(context.Background())
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, server.URL, nil)
+		require.NoError(t, err)
+
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+
+		assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+		assert.WithinDuration(t, time.Now().Add(time.Minute), capture.get(), 5*time.Second)
+	})
+
+	t.Run("no capture", func(t *testing.T) {
+		req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, server.URL, nil)
+		require.NoError(t, err)
+
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+		assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	})
+}
+
+// TestClient_Broadcast_Backoff will test skipping the rate limited providers
+func TestClient_Broadcast_Backoff(t *testing.T) {
+	t.Parallel()
+
+	t.Run("rate limited provider is skipped", func(t *testing.T) {
+		ctx := context.Background()
+		c := NewTestClient(ctx, t, WithMinercraft(&minerCraftRateLimited{}))
+
+		// First broadcast: Taal responds with 429
+		provider, err := c.BroadcastWithProviders(
+			ctx, broadcastExample1TxID, broadcastExample1TxHex,
+			[]string{minercraft.MinerTaal, minercraft.MinerGorillaPool}, defaultBroadcastTimeOut,
+		)
+		require.NoError(t, err)
+		assert.Equal(t, minercraft.MinerGorillaPool, provider)
+
+		// Taal is in backoff
+		var taal *ProviderStatus
+		for _, status := range c.ProviderStatus(ctx) {
+			if status.Name == minercraft.MinerTaal {
+				taal = status
+			} else {
+				assert.False(t, status.InBackoff, status.Name)
+			}
+		}
+		require.NotNil(t, taal)
+		assert.True(t, taal.InBackoff)
+		require.NotNil(t, taal.BackoffUntil)
+		assert.WithinDuration(t, time.Now().Add(defaultProviderBackoff), *taal.BackoffUntil, 5*time.Second)
+
+		// Only Taal: nothing is broadcast
+		provider, err = c.BroadcastWithProviders(
+			ctx, broadcastExample1TxID, broadcastExample1TxHex, []string{minercraft.MinerTaal}, defaultBroadcastTimeOut,
+		)
+		require.ErrorIs(t, err, ErrProvidersInBackoff)
+		assert.Empty(t, provider)
+	})
+
+	t.Run("custom backoff store", func(t *testing.T) {
+		ctx := context.Background()
+		store := newMemoryBackoffStore()
+		c := NewTestClient(ctx, t,
+			WithMinercraft(&minerCraftBroadcastSuccess{}),
+			WithBackoffStore(store),
+		)
+		for _, name := range c.BroadcastProviders() {
+			require.NoError(t, store.SetBackoff(ctx, name, time.Now().Add(time.Minute)))
+		}
+
+		provider, err := c.Broadcast(ctx, broadcastExample1TxID, broadcastExample1TxHex, defaultBroadcastTimeOut)
+		require.ErrorIs(t, err, ErrProvidersInBackoff)
+		assert.Empty(t, provider)
+	})
+}
@@ -0,0 +1,297 @@
+package chainstate
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/BuxOrg/bux/utils"
+	"github.com/libsv/go-bt/v2"
+)
+
+// RawTransactionStore caches the raw transactions fetched from the providers (a transaction never changes)
+//
+// There is no cache by default, a shared store (cachestore) can be set using WithRawTransactionStore
+type RawTransactionStore interface {
+	GetRawTransaction(ctx context.Context, id string) (string, error) // Empty if the transaction is not cached
+	SetRawTransaction(ctx context.Context, id, txHex string) error
+}
+
+// rawTransactionProvider is a provider of the raw transactions (hex) by ID
+type rawTransactionProvider interface {
+	getName() string
+	getRawTransactions(ctx context.Context, c *Client, ids []string) (map[string]string, error)
+}
+
+// GetRawTransaction will get the raw transaction (hex) by ID from the cache or the raw transaction providers
+//
+// Returns ErrTransactionNotFound if no provider has the transaction
+func (c *Client) GetRawTransaction(ctx context.Context, id string) (string, error) {
+	transactions, err := c.GetRawTransactions(ctx, []string{id})
+	if err != nil {
+		return "", err
+	} else if txHex, ok := transactions[id]; ok {
+		return txHex, nil
+	}
+	return "", ErrTransactionNotFound
+}
+
+// GetRawTransactions will get the raw transactions (hex) by ID from the cache or the raw transaction providers
+//
+// The providers are asked for the missing transactions in order (WhatsOnChain fetches them in batches), the
+// transactions not found by any provider are not in the result. The hex of every transaction is checked
+// against its ID.
+func (c *Client) GetRawTransactions(ctx context.Context, ids []string) (map[string]string, error) {
+	transactions := make(map[string]string, len(ids))
+	missing := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if len(id) != 64 {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidTransactionID, id)
+		} else if _, ok := transactions[id]; ok || utils.StringInSlice(id, missing) {
+			continue
+		}
+		if txHex := c.getCachedRawTransaction(ctx, id); len(txHex) > 0 && isRawTransactionOf(txHex, id) {
+			transactions[id] = txHex
+		} else {
+			missing = append(missing, id)
+		}
+	}
+	if len(missing) == 0 {
+		return transactions, nil
+	}
+
+	providers := c.rawTransactionProviders()
+	if len(providers) == 0 {
+		return nil, ErrMissingRawTransactionProviders
+	}
+
+	// Create a context (to cancel or timeout)
+	ctxWithCancel, cancel := context.WithTimeout(ctx, c.QueryTimeout())
+	defer cancel()
+
+	var lastErr error
+	answered := false
+	for _, provider := range providers {
+		if len(missing) == 0 {
+			break
+		} else if until := c.getProviderBackoff(ctx, provider.getName()); !until.IsZero() {
+			continue
+		}
+
+		captureCtx, capture := withBackoffCapture(ctxWithCancel)
+		found, err := provider.getRawTransactions(captureCtx, c, missing)
+		c.recordProviderBackoff(ctx, provider.getName(), capture, err)
+		if err != nil {
+			c.DebugLog("error getting raw transactions using " + provider.getName() + ": " + err.Error())
+			lastErr = err
+		} else {
+			answered = true
+		}
+
+		stillMissing := make([]string, 0, len(missing))
+		for _, id := range missing {
+			txHex, ok := found[id]
+			if !ok {
+				stillMissing = append(stillMissing, id)
+				continue
+			} else if !isRawTransactionOf(txHex, id) {
+				c.DebugLog("raw transaction from " + provider.getName() + " does not match tx id: " + id)
+				stillMissing = append(stillMissing, id)
+				continue
+			}
+			transactions[id] = txHex
+			c.setCachedRawTransaction(ctx, id, txHex)
+		}
+		missing = stillMissing
+	}
+
+	// Nothing was found because of the errors of the providers (none of them answered)
+	if len(transactions) == 0 && !answered && lastErr != nil {
+		return nil, lastErr
+	}
+	return transactions, nil
+}
+
+// rawTransactionProviders will return the configured raw transaction providers (in order, without the excluded)
+func (c *Client) rawTransactionProviders() []rawTransactionProvider {
+	providers := make([]rawTransactionProvider, 0, len(c.options.config.rawTxProviders))
+	for _, provider := range c.options.config.rawTxProviders {
+		if !utils.StringInSlice(provider.getName(), c.options.config.excludedProviders) {
+			providers = append(providers, provider)
+		}
+	}
+	return providers
+}
+
+// getCachedRawTransaction will return the cached raw transaction (empty if not cached or there is no store)
+func (c *Client) getCachedRawTransaction(ctx context.Context, id string) string {
+	if c.options.config.rawTxStore == nil {
+		return ""
+	}
+	txHex, err := c.options.config.rawTxStore.GetRawTransaction(ctx, id)
+	if err != nil {
+		c.DebugLog("failed getting the cached raw transaction " + id + ": " + err.Error())
+		return ""
+	}
+	return txHex
+}
+
+// setCachedRawTransaction will cache the raw transaction (if there is a store)
+func (c *Client) setCachedRawTransaction(ctx context.Context, id, txHex string) {
+	if c.options.config.rawTxStore == nil {
+		return
+	}
+	if err := c.options.config.rawTxStore.SetRawTransaction(ctx, id, txHex); err != nil {
+		c.DebugLog("failed caching the raw transaction " + id + ": " + err.Error())
+	}
+}
+
+// isRawTransactionOf will return true if the hex is the transaction of the ID
+func isRawTransactionOf(txHex, id string) bool {
+	tx, err := bt.NewTxFromString(txHex)
+	return err == nil && tx.TxID() == id
+}
+
+// rawTransactionRequest will fire the request of a raw transaction provider
+//
+// Returns a nil body if the transaction was not found (404)
+func (c *Client) rawTransactionRequest(req *http.Request) ([]byte, error) {
+	if len(c.options.userAgent) > 0 {
+		req.Header.Set("User-Agent", c.options.userAgent)
+	}
+
+	httpClient := c.HTTPClient()
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	res, err := (&backoffHTTPClient{client: httpClient}).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = res.Body.Close()
+	}()
+
+	if res.StatusCode == http.StatusNotFound {
+		return nil, nil
+	} else if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status code: %d does not match %d", res.StatusCode, http.StatusOK)
+	}
+	return io.ReadAll(io.LimitReader(res.Body, maxRawTransactionResponseSize))
+}
+
+// whatsOnChainProvider gets the raw transactions from WhatsOnChain (in batches)
+type whatsOnChainProvider struct {
+	apiKey string
+}
+
+// whatsOnChainTx is a transaction of the bulk raw transaction response of WhatsOnChain
+type whatsOnChainTx struct {
+	Error string `json:"error"`
+	Hex   string `json:"hex"`
+	TxID  string `json:"txid"`
+}
+
+// getName will return the provider name
+func (p *whatsOnChainProvider) getName() string {
+	return ProviderWhatsOnChain
+}
+
+// getRawTransactions will get the raw transactions using the bulk endpoint (whatsOnChainMaxBatchSize per request)
+func (p *whatsOnChainProvider) getRawTransactions(ctx context.Context, c *Client,
+	ids []string,
+) (map[string]string, error) {
+	transactions := make(map[string]string, len(ids))
+	for start := 0; start < len(ids); start += whatsOnChainMaxBatchSize {
+		end := start + whatsOnChainMaxBatchSize
+		if end > len(ids) {
+			end = len(ids)
+		}
+
+		body, err := json.Marshal(map[string][]string{"txids": ids[start:end]})
+		if err != nil {
+			return transactions, err
+		}
+		var req *http.Request
+		if req, err = http.NewRequestWithContext(
+			ctx, http.MethodPost, whatsOnChainAPIURL+c.Network().Alternate()+"/txs/hex", bytes.NewReader(body),
+		); err != nil {
+			return transactions, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if len(p.apiKey) > 0 {
+			req.Header.Set("woc-api-key", p.apiKey)
+		}
+
+		if body, err = c.rawTransactionRequest(req); err != nil {
+			return transactions, err
+		} else if body == nil {
+			continue
+		}
+		var results []*whatsOnChainTx
+		if err = json.Unmarshal(body, &results); err != nil {
+			return transactions, err
+		}
+		for _, result := range results {
+			if result != nil && len(result.Error) == 0 && len(result.Hex) > 0 {
+				transactions[result.TxID] = result.Hex
+			}
+		}
+	}
+	return transactions, nil
+}
+
+// jungleBusProvider gets the raw transactions from a JungleBus (one request per transaction)
+type jungleBusProvider struct {
+	url string
+}
+
+// jungleBusTx is the transaction response of JungleBus
+type jungleBusTx struct {
+	ID          string `json:"id"`
+	Transaction string `json:"transaction"` // Base64 encoded raw transaction
+}
+
+// getName will return the provider name
+func (p *jungleBusProvider) getName() string {
+	return ProviderJungleBus
+}
+
+// getRawTransactions will get the raw transactions (one by one)
+func (p *jungleBusProvider) getRawTransactions(ctx context.Context, c *Client,
+	ids []string,
+) (map[string]string, error) {
+	transactions := make(map[string]string, len(ids))
+	for _, id := range ids {
+		req, err := http.NewRequestWithContext(
+			ctx, http.MethodGet, strings.TrimSuffix(p.url, "/")+"/v1/transaction/get/"+id, nil,
+		)
+		if err != nil {
+			return transactions, err
+		}
+
+		var body []byte
+		if body, err = c.rawTransactionRequest(req); err != nil {
+			return transactions, err
+		} else if body == nil {
+			continue
+		}
+		result := new(jungleBusTx)
+		if err = json.Unmarshal(body, result); err != nil {
+			return transactions, err
+		}
+		var raw []byte
+		if raw, err = base64.StdEncoding.DecodeString(result.Transaction); err != nil {
+			return transactions, err
+		} else if len(raw) > 0 {
+			transactions[id] = hex.EncodeToString(raw)
+		}
+	}
+	return transactions, nil
+}
@@ -0,0 +1,224 @@
+package chainstate
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// rawTransactionHTTPMock is an HTTP client serving the raw transaction providers
+type rawTransactionHTTPMock struct {
+	handler  func(req *http.Request) (int, string)
+	requests []*http.Request
+	mu       sync.Mutex
+}
+
+// Do will record the request and return the response of the handler
+func (h *rawTransactionHTTPMock) Do(req *http.Request) (*http.Response, error) {
+	h.mu.Lock()
+	h.requests = append(h.requests, req)
+	h.mu.Unlock()
+
+	status, body := h.handler(req)
+	return &http.Response{
+		Body:       io.NopCloser(strings.NewReader(body)),
+		Header:     http.Header{},
+		StatusCode: status,
+	}, nil
+}
+
+// rawTransactionMemoryStore is an in memory raw transaction store
+type rawTransactionMemoryStore struct {
+	transactions map[string]string
+}
+
+// GetRawTransaction will return the stored raw transaction
+func (s *rawTransactionMemoryStore) GetRawTransaction(_ context.Context, id string) (string, error) {
+	return s.transactions[id], nil
+}
+
+// SetRawTransaction will store the raw transaction
+func (s *rawTransactionMemoryStore) SetRawTransaction(_ context.Context, id, txHex string) error {
+	s.transactions[id] = txHex
+	return nil
+}
+
+// TestClient_GetRawTransactions will test the methods GetRawTransaction() and GetRawTransactions()
+func TestClient_GetRawTransactions(t *testing.T) {
+	t.Parallel()
+
+	wocHandler := func(req *http.Request) (int, string) {
+		if req.URL.String() != whatsOnChainAPIURL+"main/txs/hex" {
+			return http.StatusNotFound, ""
+		}
+		var body map[string][]string
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			return http.StatusBadRequest, ""
+		}
+		results := make([]*whatsOnChainTx, 0, len(body["txids"]))
+		for _, id := range body["txids"] {
+			if id == broadcastExample1TxID {
+				results = append(results, &whatsOnChainTx{Hex: broadcastExample1TxHex, TxID: id})
+			} else {
+				results = append(results, &whatsOnChainTx{Error: "unknown", TxID: id})
+			}
+		}
+		data, _ := json.Marshal(results)
+		return http.StatusOK, string(data)
+	}
+
+	t.Run("whatsonchain (cached)", func(t *testing.T) {
+		ctx := context.Background()
+		httpClient := &rawTransactionHTTPMock{handler: wocHandler}
+		store := &rawTransactionMemoryStore{transactions: map[string]string{}}
+		c := NewTestClient(ctx, t,
+			WithMinercraft(&minerCraftTxOnChain{}),
+			WithHTTPClient(httpClient),
+			WithWhatsOnChain("api-key"),
+			WithRawTransactionStore(store),
+		)
+
+		transactions, err := c.GetRawTransactions(ctx, []string{broadcastExample1TxID, notFoundExample1TxID})
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{broadcastExample1TxID: broadcastExample1TxHex}, transactions)
+		require.Len(t, httpClient.requests, 1)
+		assert.Equal(t, "api-key", httpClient.requests[0].Header.Get("woc-api-key"))
+		assert.Equal(t, broadcastExample1TxHex, store.transactions[broadcastExample1TxID])
+
+		// Cached
+		txHex, err := c.GetRawTransaction(ctx, broadcastExample1TxID)
+		require.NoError(t, err)
+		assert.Equal(t, broadcastExample1TxHex, txHex)
+		assert.Len(t, httpClient.requests, 1)
+
+		_, err = c.GetRawTransaction(ctx, notFoundExample1TxID)
+		assert.ErrorIs(t, err, ErrTransactionNotFound)
+	})
+
+	t.Run("batches", func(t *testing.T) {
+		ctx := context.Background()
+		httpClient := &rawTransactionHTTPMock{handler: wocHandler}
+		c := NewTestClient(ctx, t,
+			WithMinercraft(&minerCraftTxOnChain{}),
+			WithHTTPClient(httpClient),
+			WithWhatsOnChain(""),
+		)
+
+		ids := []string{broadcastExample1TxID}
+		for index := 0; index < whatsOnChainMaxBatchSize; index++ {
+			ids = append(ids, strings.Repeat(hex.EncodeToString([]byte{byte(index)}), 32))
+		}
+		transactions, err := c.GetRawTransactions(ctx, ids)
+		require.NoError(t, err)
+		assert.Len(t, transactions, 1)
+		assert.Len(t, httpClient.requests, 2)
+	})
+
+	t.Run("junglebus fallback", func(t *testing.T) {
+		ctx := context.Background()
+		raw, err := hex.DecodeString(broadcastExample1TxHex)
+		require.NoError(t, err)
+		httpClient := &rawTransactionHTTPMock{handler: func(req *http.Request) (int, string) {
+			if req.URL.Host == "junglebus.test" {
+				if req.URL.Path != "/v1/transaction/get/"+broadcastExample1TxID {
+					return http.StatusNotFound, ""
+				}
+				return http.StatusOK, `{"id":"` + broadcastExample1TxID + `","transaction":"` +
+					base64.StdEncoding.EncodeToString(raw) + `"}`
+			}
+			return http.StatusInternalServerError, ""
+		}}
+		c := NewTestClient(ctx, t,
+			WithMinercraft(&minerCraftTxOnChain{}),
+			WithHTTPClient(httpClient),
+			WithWhatsOnChain(""),
+			WithJungleBus("https://junglebus.test/"),
+		)
+
+		txHex, err := c.GetRawTransaction(ctx, broadcastExample1TxID)
+		require.NoError(t, err)
+		assert.Equal(t, broadcastExample1TxHex, txHex)
+
+		_, err = c.GetRawTransaction(ctx, notFoundExample1TxID)
+		assert.ErrorIs(t, err, ErrTransactionNotFound)
+	})
+
+	t.Run("mismatched transaction", func(t *testing.T) {
+		ctx := context.Background()
+		httpClient := &rawTransactionHTTPMock{handler: func(*http.Request) (int, string) {
+			return http.StatusOK, `[{"txid":"` + notFoundExample1TxID + `","hex":"` + broadcastExample1TxHex + `"}]`
+		}}
+		c := NewTestClient(ctx, t,
+			WithMinercraft(&minerCraftTxOnChain{}),
+			WithHTTPClient(httpClient),
+			WithWhatsOnChain(""),
+		)
+
+		_, err := c.GetRawTransaction(ctx, notFoundExample1TxID)
+		assert.ErrorIs(t, err, ErrTransactionNotFound)
+	})
+
+	t.Run("mismatched cached transaction", func(t *testing.T) {
+		ctx := context.Background()
+		httpClient := &rawTransactionHTTPMock{handler: wocHandler}
+		store := &rawTransactionMemoryStore{transactions: map[string]string{
+			broadcastExample1TxID: strings.Repeat("00", 60),
+		}}
+		c := NewTestClient(ctx, t,
+			WithMinercraft(&minerCraftTxOnChain{}),
+			WithHTTPClient(httpClient),
+			WithWhatsOnChain(""),
+			WithRawTransactionStore(store),
+		)
+
+		txHex, err := c.GetRawTransaction(ctx, broadcastExample1TxID)
+		require.NoError(t, err)
+		assert.Equal(t, broadcastExample1TxHex, txHex)
+		assert.Len(t, httpClient.requests, 1)
+		assert.Equal(t, broadcastExample1TxHex, store.transactions[broadcastExample1TxID])
+	})
+
+	t.Run("provider errors", func(t *testing.T) {
+		ctx := context.Background()
+		httpClient := &rawTransactionHTTPMock{handler: func(*http.Request) (int, string) {
+			return http.StatusInternalServerError, ""
+		}}
+		c := NewTestClient(ctx, t,
+			WithMinercraft(&minerCraftTxOnChain{}),
+			WithHTTPClient(httpClient),
+			WithWhatsOnChain(""),
+		)
+
+		_, err := c.GetRawTransaction(ctx, broadcastExample1TxID)
+		require.Error(t, err)
+		assert.NotErrorIs(t, err, ErrTransactionNotFound)
+	})
+
+	t.Run("invalid or no providers", func(t *testing.T) {
+		ctx := context.Background()
+		c := NewTestClient(ctx, t, WithMinercraft(&minerCraftTxOnChain{}))
+
+		_, err := c.GetRawTransaction(ctx, "invalid")
+		require.ErrorIs(t, err, ErrInvalidTransactionID)
+
+		_, err = c.GetRawTransaction(ctx, broadcastExample1TxID)
+		require.ErrorIs(t, err, ErrMissingRawTransactionProviders)
+
+		c = NewTestClient(ctx, t,
+			WithMinercraft(&minerCraftTxOnChain{}),
+			WithWhatsOnChain(""),
+			WithExcludedProviders([]string{ProviderWhatsOnChain}),
+		)
+		_, err = c.GetRawTransaction(ctx, broadcastExample1TxID)
+		require.ErrorIs(t, err, ErrMissingRawTransactionProviders)
+	})
+}
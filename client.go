@@ -3,6 +3,7 @@ package bux
 import (
 	"context"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/BuxOrg/bux/chainstate"
@@ -15,6 +16,7 @@ import (
 	"github.com/mrz1836/go-datastore"
 	zLogger "github.com/mrz1836/go-logger"
 	"github.com/newrelic/go-agent/v3/newrelic"
+	"golang.org/x/sync/singleflight"
 )
 
 type (
@@ -26,22 +28,50 @@ type (
 
 	// clientOptions holds all the configuration for the client
 	clientOptions struct {
+		adminLookups          bool                        // Allow the cross-xPub admin lookups (AdminGetDestinationByID, etc.)
+		auditSigningKey       string                      // Key of the HMAC of the audit log entries (SHA-256 if not set)
+		balanceAlertMargin    uint64                      // Satoshis the balance recovers past a threshold before the alert fires again
+		balanceCheckpoints    bool                        // Maintain (and use) the monthly balance checkpoints of the xPubs
+		blockHeaderSync       *blockHeaderSyncOptions     // Configuration options for the block header sync (from a provider)
 		cacheStore            *cacheStoreOptions          // Configuration options for Cachestore (ristretto, redis, etc.)
 		cluster               *clusterOptions             // Configuration options for the cluster coordinator
 		chainstate            *chainstateOptions          // Configuration options for Chainstate (broadcast, sync, etc.)
 		dataStore             *dataStoreOptions           // Configuration options for the DataStore (MySQL, etc.)
 		debug                 bool                        // If the client is in debug mode
+		derivationPrefix      string                      // BIP32 derivation path of the xPubs (IE: m/44'/236'/0')
+		draftExpiryWarning    time.Duration               // Lead time of the expiring soon notification of the drafts (0 = no warning)
+		draftMetadata         DraftMetadataPolicy         // How the metadata of the draft cascades to the recorded transaction
 		encryptionKey         string                      // Encryption key for encrypting sensitive information (IE: paymail xPub) (hex encoded key)
+		exchangeRates         *exchangeRateOptions        // Configuration options for the fiat display values (exchange rates)
+		feeCalculator         FeeCalculator               // Calculates the fee of the draft transactions (default: the fee unit)
 		httpClient            HTTPInterface               // HTTP interface to use
+		identityKey           string                      // Private key (hex) signing the payment acknowledgments (see GetPaymentAcknowledgment)
+		idGenerator           IDGenerator                 // Generator for new (non-content-derived) model IDs
+		incomingLimits        *IncomingTransactionLimits  // Limits of the incoming transactions (paymail receive and monitor)
+		incomingRejections    *incomingRejectionNotifier  // Delivers the notifications of the rejected incoming transactions
+		instanceID            string                      // Identifier of this instance, recorded on the created/updated records (see WithInstanceID)
 		importBlockHeadersURL string                      // The URL of the block headers zip file to import old block headers on startup. if block 0 is found in the DB, block headers will mpt be downloaded
 		itc                   bool                        // (Incoming Transactions Check) True will check incoming transactions via Miners (real-world)
 		iuc                   bool                        // (Input UTXO Check) True will check input utxos when saving transactions
+		keysetPageLoaded      func(records int)           // Called with the number of records of every keyset page (instrumentation)
 		logger                zLogger.GormLoggerInterface // Internal logging
+		metadataLimits        *MetadataLimits             // Limits of the metadata of the models (log only by default)
+		maxUnconfirmedChain   uint32                      // Maximum depth of the chain of unconfirmed ancestors for new transactions (0 = no limit)
+		modelCache            *modelCacheOptions          // Cache TTLs of the models (and the cache reads)
 		models                *modelOptions               // Configuration options for the loaded models
+		monitorCatchUp        *monitorCatchUpOptions      // Configuration options for the catch-up of the missed blocks
+		monitorFilter         *monitorFilterOptions       // Configuration options for filtering the monitored transactions
+		monitorQueue          *monitorQueueOptions        // Configuration options for the queue of the monitor events
+		network               chainstate.Network          // Bitcoin network (mainnet, testnet, stn)
 		newRelic              *newRelicOptions            // Configuration options for NewRelic
 		notifications         *notificationsOptions       // Configuration options for Notifications
 		paymail               *paymailOptions             // Paymail options & client
+		preBroadcastCheck     bool                        // Verify the scripts of the owned inputs before recording outgoing transactions
+		reconcile             *reconcileOptions           // Configuration options for the reconciliation against the chain
+		startupValidation     *startupValidationOptions   // Configuration options for the startup validation
+		syncQueue             *syncQueueOptions           // Configuration options for the sync queue depths
 		taskManager           *taskManagerOptions         // Configuration options for the TaskManager (TaskQ, etc.)
+		transactionNoteMax    int                         // Max length (characters) of the transaction notes (0 = no limit)
 		userAgent             string                      // User agent for all outgoing requests
 	}
 
@@ -50,7 +80,10 @@ type (
 		chainstate.ClientInterface                        // Client for Chainstate
 		options                    []chainstate.ClientOps // List of options
 		broadcasting               bool                   // Default value for all transactions
+		broadcastHighWaterMark     int                    // Max number of records in flight in the broadcast task
 		broadcastInstant           bool                   // Default value for all transactions
+		instantBroadcastMode       InstantBroadcastMode   // How the instant broadcast runs (async or sync)
+		instantBroadcasts          sync.WaitGroup         // Running asynchronous instant broadcasts (awaited on Close)
 		paymailP2P                 bool                   // Default value for all transactions
 		syncOnChain                bool                   // Default value for all transactions
 	}
@@ -58,6 +91,7 @@ type (
 	// cacheStoreOptions holds the cache configuration and client
 	cacheStoreOptions struct {
 		cachestore.ClientInterface                        // Client for Cachestore
+		localLockFallback          bool                   // Fall back to local (in-process) locks if the cachestore is unavailable
 		options                    []cachestore.ClientOps // List of options
 	}
 
@@ -65,7 +99,8 @@ type (
 	// at the moment we only support redis as the cluster coordinator
 	clusterOptions struct {
 		cluster.ClientInterface
-		options []cluster.ClientOps // List of options
+		coordinated bool                // True if a cluster coordinator is configured (multi-instance)
+		options     []cluster.ClientOps // List of options
 	}
 
 	// dataStoreOptions holds the data storage configuration and client
@@ -73,6 +108,8 @@ type (
 		datastore.ClientInterface                       // Client for Datastore
 		migrationDisabled         bool                  // If the migrations are disabled
 		options                   []datastore.ClientOps // List of options
+		schemaCheck               SchemaCheckMode       // What happens if the schema of the database is newer (strict by default)
+		versionIndexes            bool                  // Index the bux versions of the records (see WithRecordVersionIndexes)
 	}
 
 	// modelOptions holds the model configuration
@@ -92,13 +129,24 @@ type (
 	// notificationsOptions holds the configuration for notifications
 	notificationsOptions struct {
 		notifications.ClientInterface                           // Notifications client
+		deadLetterRetention           time.Duration             // Retention of the dead-lettered events (0 = keep all)
+		displayProfile                string                    // Display profile of the event payloads (see DisplayFor)
+		includeNotes                  bool                      // Include the transaction notes in the event payloads
+		lookups                       sync.WaitGroup            // Running lookups of the events (awaited on Close)
+		mutedMode                     MutedNotificationsMode    // What happens to the events of the muted xPubs
 		options                       []notifications.ClientOps // List of options
+		retention                     time.Duration             // Retention of the delivery receipts (0 = keep all)
 		webhookEndpoint               string                    // Webhook endpoint
 	}
 
 	// paymailOptions holds the configuration for Paymail
 	paymailOptions struct {
+		activation   time.Duration           // Window to activate the new paymail addresses (0 = no activation, active on creation)
 		client       paymail.ClientInterface // Paymail client for communicating with Paymail providers
+		domainPolicy *paymailDomainPolicy    // Allow-list and deny-list of the outgoing paymail domains
+		p2pFailures  uint32                  // Failed P2P notifications of a transaction before it is marked as failed (0 = no limit)
+		p2pMaxSize   int                     // Max size of the P2P payload (bytes), larger payloads are deferred on-chain (0 = no limit)
+		requests     *singleflight.Group     // Concurrent identical lookups of the client (capabilities and address resolution)
 		serverConfig *PaymailServerOptions   // Server configuration if Paymail is enabled
 	}
 
@@ -108,6 +156,45 @@ type (
 		options               []server.ConfigOps // Options for the paymail server
 		DefaultFromPaymail    string             // IE: from@domain.com
 		DefaultNote           string             // IE: some note for address resolution
+		BeefMaxAncestryDepth  int                // Max depth of unconfirmed ancestors walked when building BEEF
+		BeefMaxAncestryTxs    int                // Max number of ancestor transactions included in BEEF
+		BeefFallbackToBasic   bool               // Send the basic (hex) P2P format if the BEEF limits are exceeded
+		PublicNameMaxLength   int                // Max length of the public name of a paymail address
+		AvatarMaxLength       int                // Max length of the avatar url of a paymail address
+		AvatarVerification    bool               // HEAD the avatar url to confirm it returns an image
+		AliasRules            *PaymailAliasRules // Validation rules of the aliases of new paymail addresses (nil = legacy, not checked)
+	}
+
+	// startupValidationOptions holds the configuration for the startup validation
+	startupValidationOptions struct {
+		enabled bool // If the startup validation checks are run in NewClient
+		lenient bool // Log failures as warnings instead of returning an error
+	}
+
+	// monitorFilterOptions holds the minimum value for recording monitored transactions (and the skipped transactions)
+	monitorFilterOptions struct {
+		minimumSatoshis     uint64            // Matched outputs below the minimum are not recorded (0 = record all)
+		mu                  sync.Mutex        // Guards the counters and the skipped transactions
+		skipped             map[string]string // Recently skipped transactions (tx ID -> hex) for a manual import
+		skippedIDs          []string          // Order of the skipped transactions (oldest first)
+		skippedOutputs      uint64            // Number of skipped (matched) outputs
+		skippedTransactions uint64            // Number of skipped transactions
+	}
+
+	// monitorQueueOptions holds the size of the worker pool processing the monitor events (and the queue)
+	monitorQueueOptions struct {
+		depth   int                // Max number of queued events (the reader is blocked when full)
+		mu      sync.Mutex         // Guards the queue
+		queue   *monitorEventQueue // Queue of the monitor events (nil until the monitor handler is created)
+		workers int                // Number of workers
+	}
+
+	// syncQueueOptions holds the configuration (and the cache) for the sync queue depths
+	syncQueueOptions struct {
+		cacheTTL         time.Duration    // How long the depths are cached (0 = not cached)
+		cached           *SyncQueueDepths // Last depths
+		mu               sync.Mutex       // Guards the cached depths
+		warningThreshold int64            // Log a warning if a queue is deeper (0 = no warning)
 	}
 
 	// taskManagerOptions holds the configuration for taskmanager
@@ -132,6 +219,11 @@ func NewClient(ctx context.Context, opts ...ClientOps) (ClientInterface, error)
 		opt(client.options)
 	}
 
+	// Validate the combination of options
+	if err := client.options.validate(); err != nil {
+		return nil, err
+	}
+
 	// Use NewRelic if it's enabled (use existing txn if found on ctx)
 	ctx = client.GetOrStartTxn(ctx, "new_client")
 
@@ -140,8 +232,15 @@ func NewClient(ctx context.Context, opts ...ClientOps) (ClientInterface, error)
 		client.options.logger = zLogger.NewGormLogger(client.IsDebug(), 4)
 	}
 
-	// Load the Cachestore client
+	// Close the subsystems already loaded if a later step (or the startup validation) fails
 	var err error
+	defer func() {
+		if err != nil {
+			_ = client.Close(ctx)
+		}
+	}()
+
+	// Load the Cachestore client
 	if err = client.loadCache(ctx); err != nil {
 		return nil, err
 	}
@@ -163,6 +262,13 @@ func NewClient(ctx context.Context, opts ...ClientOps) (ClientInterface, error)
 		return nil, err
 	}
 
+	// Record the schema revisions of the migrated models (see SchemaStatus)
+	if err = client.recordSchemaVersions(
+		ctx, client.options.models.migrateModels...,
+	); err != nil {
+		return nil, err
+	}
+
 	// Load the Chainstate client
 	if err = client.loadChainstate(ctx); err != nil {
 		return nil, err
@@ -174,7 +280,7 @@ func NewClient(ctx context.Context, opts ...ClientOps) (ClientInterface, error)
 	}
 
 	// Load the Notification client (if client does not exist)
-	if err = client.loadNotificationClient(); err != nil {
+	if err = client.loadNotificationClient(ctx); err != nil {
 		return nil, err
 	}
 
@@ -202,6 +308,16 @@ func NewClient(ctx context.Context, opts ...ClientOps) (ClientInterface, error)
 		}
 	}
 
+	// Run the startup validation checks (optional)
+	if client.options.startupValidation.enabled {
+		if err = client.validateStartup(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	// Log the effective options (compare the hash between instances)
+	client.logConfigSummary(ctx)
+
 	// Return the client
 	return client, nil
 }
@@ -233,6 +349,11 @@ func (c *Client) AddModels(ctx context.Context, autoMigrate bool, models ...inte
 		if err := c.runModelMigrations(models...); err != nil {
 			return err
 		}
+
+		// Record the schema revisions
+		if err := c.recordSchemaVersions(ctx, models...); err != nil {
+			return err
+		}
 	}
 
 	// Register all tasks (again)
@@ -270,11 +391,26 @@ func (c *Client) Close(ctx context.Context) error {
 		defer txn.StartSegment("close_all").End()
 	}
 
+	// Wait for the asynchronous instant broadcasts (bounded by their timeout)
+	c.options.chainstate.instantBroadcasts.Wait()
+
+	// Wait for the lookups of the notification events (muted xPubs and notes)
+	c.options.notifications.lookups.Wait()
+
+	// Wait for the notifications of the rejected incoming transactions (bounded by their timeout)
+	c.options.incomingRejections.running.Wait()
+
+	// Process the queued monitor events
+	if queue := c.options.monitorQueue.loaded(); queue != nil {
+		queue.close()
+	}
+
 	// If we loaded a Monitor, remove the long-lasting lock-key before closing cachestore
 	cs := c.Cachestore()
-	m := c.Chainstate().Monitor()
-	if m != nil && cs != nil && len(m.GetLockID()) > 0 {
-		_ = cs.Delete(ctx, fmt.Sprintf(lockKeyMonitorLockID, m.GetLockID()))
+	if ch := c.Chainstate(); ch != nil && cs != nil {
+		if m := ch.Monitor(); m != nil && len(m.GetLockID()) > 0 {
+			_ = cs.Delete(ctx, fmt.Sprintf(lockKeyMonitorLockID, m.GetLockID()))
+		}
 	}
 
 	// Close Cachestore
@@ -392,16 +528,31 @@ func (c *Client) GetModelNames() []string {
 	return c.options.models.modelNames
 }
 
+// FeeCalculator will return the calculator of the fee of the draft transactions
+func (c *Client) FeeCalculator() FeeCalculator {
+	return c.options.feeCalculator
+}
+
 // HTTPClient will return the http interface to use in the client
 func (c *Client) HTTPClient() HTTPInterface {
 	return c.options.httpClient
 }
 
+// IDGenerator will return the generator used for new (non-content-derived) model IDs
+func (c *Client) IDGenerator() IDGenerator {
+	return c.options.idGenerator
+}
+
 // ImportBlockHeadersFromURL will the URL where to import block headers from
 func (c *Client) ImportBlockHeadersFromURL() string {
 	return c.options.importBlockHeadersURL
 }
 
+// InstanceID will return the identifier of this instance (recorded on the created/updated records)
+func (c *Client) InstanceID() string {
+	return c.options.instanceID
+}
+
 // IsDebug will return the debug flag (bool)
 func (c *Client) IsDebug() bool {
 	return c.options.debug
@@ -417,6 +568,50 @@ func (c *Client) IsMempoolMonitoringEnabled() bool {
 	return c.options.chainstate.IsNewRelicEnabled()
 }
 
+// DraftExpiryWarning will return the lead time of the expiring soon notification of the drafts (0 = no warning)
+func (c *Client) DraftExpiryWarning() time.Duration {
+	return c.options.draftExpiryWarning
+}
+
+// DerivationPrefix will return the BIP32 derivation path of the xPubs (prefix of the destination paths)
+func (c *Client) DerivationPrefix() string {
+	return c.options.derivationPrefix
+}
+
+// DraftMetadataPolicy will return how the metadata of the draft cascades to the recorded transaction
+func (c *Client) DraftMetadataPolicy() DraftMetadataPolicy {
+	return c.options.draftMetadata
+}
+
+// InstantBroadcastMode will return how the instant broadcast runs (async or sync)
+func (c *Client) InstantBroadcastMode() InstantBroadcastMode {
+	return c.options.chainstate.instantBroadcastMode
+}
+
+// instantBroadcastRunner runs the asynchronous instant broadcasts (InstantBroadcastAsync), implemented by Client
+type instantBroadcastRunner interface {
+	runInstantBroadcast(ctx context.Context, broadcast func(ctx context.Context))
+}
+
+// runInstantBroadcast will run the instant broadcast in the background
+//
+// The context is detached from the caller (IE: the HTTP request) and bounded by defaultInstantBroadcastTimeout,
+// suppressed notifications are kept. Close waits for the running broadcasts.
+func (c *Client) runInstantBroadcast(ctx context.Context, broadcast func(ctx context.Context)) {
+	detached := context.Background()
+	if isNotifySkipped(ctx, nil) {
+		detached = WithoutNotificationsContext(detached)
+	}
+
+	c.options.chainstate.instantBroadcasts.Add(1)
+	go func() {
+		defer c.options.chainstate.instantBroadcasts.Done()
+		broadcastCtx, cancel := context.WithTimeout(detached, defaultInstantBroadcastTimeout)
+		defer cancel()
+		broadcast(broadcastCtx)
+	}()
+}
+
 // IsITCEnabled will return the flag (bool)
 func (c *Client) IsITCEnabled() bool {
 	return c.options.itc
@@ -427,6 +622,38 @@ func (c *Client) IsIUCEnabled() bool {
 	return c.options.iuc
 }
 
+// ExchangeRateCurrency will return the currency of the fiat display values (IE: USD)
+func (c *Client) ExchangeRateCurrency() string {
+	return c.options.exchangeRates.currency
+}
+
+// ExchangeRateProvider will return the source of the exchange rates (no-op if not set, see WithExchangeRateProvider)
+func (c *Client) ExchangeRateProvider() ExchangeRateProvider {
+	return c.options.exchangeRates.provider
+}
+
+// BroadcastHighWaterMark will return the max number of records in flight (queued or broadcasting) in the
+// broadcast task
+func (c *Client) BroadcastHighWaterMark() int {
+	return c.options.chainstate.broadcastHighWaterMark
+}
+
+// BalanceAlertMargin will return the margin (satoshis) the balance recovers past a threshold before the alert
+// can fire again (see SetXpubBalanceAlerts)
+func (c *Client) BalanceAlertMargin() uint64 {
+	return c.options.balanceAlertMargin
+}
+
+// IsBalanceCheckpointsEnabled will return the flag (bool)
+func (c *Client) IsBalanceCheckpointsEnabled() bool {
+	return c.options.balanceCheckpoints
+}
+
+// IsBlockHeaderSyncEnabled will return the flag (bool) if the block headers are synced from a provider
+func (c *Client) IsBlockHeaderSyncEnabled() bool {
+	return c.options.blockHeaderSync.provider != nil
+}
+
 // IsEncryptionKeySet will return the flag (bool) if the encryption key has been set
 func (c *Client) IsEncryptionKeySet() bool {
 	return len(c.options.encryptionKey) > 0
@@ -481,6 +708,36 @@ func (c *Client) Notifications() notifications.ClientInterface {
 	return nil
 }
 
+// NotificationRetention will return the retention of the notification delivery receipts (0 = keep all)
+func (c *Client) NotificationRetention() time.Duration {
+	return c.options.notifications.retention
+}
+
+// NotificationDeadLetterRetention will return the retention of the dead-lettered notification events (0 = keep all)
+func (c *Client) NotificationDeadLetterRetention() time.Duration {
+	return c.options.notifications.deadLetterRetention
+}
+
+// MutedNotificationsMode will return what happens to the events of the xPubs with muted notifications
+func (c *Client) MutedNotificationsMode() MutedNotificationsMode {
+	return c.options.notifications.mutedMode
+}
+
+// IsNotificationNotesEnabled will return the flag (bool) if the transaction notes are included in the event payloads
+func (c *Client) IsNotificationNotesEnabled() bool {
+	return c.options.notifications.includeNotes
+}
+
+// NotificationDisplayProfile will return the display profile of the event payloads (default shows everything)
+func (c *Client) NotificationDisplayProfile() string {
+	return c.options.notifications.displayProfile
+}
+
+// TransactionNoteMaxLength will return the max length (characters) of the transaction notes (0 = no limit)
+func (c *Client) TransactionNoteMaxLength() int {
+	return c.options.transactionNoteMax
+}
+
 // SetNotificationsClient will overwrite the notification's client with the given client
 func (c *Client) SetNotificationsClient(client notifications.ClientInterface) {
 	c.options.notifications.ClientInterface = client
@@ -499,6 +756,48 @@ func (c *Client) UserAgent() string {
 	return c.options.userAgent
 }
 
+// LocalLockFallbacks will return the number of locks acquired using the local (in-process) lock fallback
+func (c *Client) LocalLockFallbacks() uint64 {
+	if f, ok := c.Cachestore().(*fallbackCachestore); ok {
+		return f.LocalLockFallbacks()
+	}
+	return 0
+}
+
+// MaxUnconfirmedChain will return the maximum depth of the chain of unconfirmed ancestors (0 = no limit)
+//
+// The configured limit is lowered to the limit of the miners (chainstate policy) when it is known
+func (c *Client) MaxUnconfirmedChain() uint32 {
+	limit := c.options.maxUnconfirmedChain
+	if cs := c.Chainstate(); cs != nil {
+		if minersLimit := cs.AncestorLimit(); minersLimit > 0 && (limit == 0 || minersLimit < limit) {
+			limit = minersLimit
+		}
+	}
+	return limit
+}
+
+// RefreshMaxUnconfirmedChain will refresh the limit of the miners (policy) and return the current limit
+func (c *Client) RefreshMaxUnconfirmedChain(ctx context.Context) uint32 {
+	if cs := c.Chainstate(); cs != nil {
+		cs.ValidateMiners(ctx)
+	}
+	return c.MaxUnconfirmedChain()
+}
+
+// TaskHealth will return the health of the registered tasks (IE: last successful run, recovered panics)
+func (c *Client) TaskHealth() []*TaskHealth {
+	if r, ok := c.Taskmanager().(*recoveringTaskManager); ok {
+		return r.TaskHealth()
+	}
+	return nil
+}
+
+// Network will return the Bitcoin network (mainnet, testnet, stn)
+func (c *Client) Network() chainstate.Network {
+	return c.options.network
+}
+
 // Version will return the version
 func (c *Client) Version() string {
 	return version
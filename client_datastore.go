@@ -3,12 +3,15 @@ package bux
 import (
 	"encoding/json"
 
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.mongodb.org/mongo-driver/x/bsonx"
 )
 
 const (
 	conditionAnd = "$and"
+	conditionOr  = "$or"
 )
 
 // processCustomFields will process all custom fields
@@ -87,6 +90,15 @@ func processXpubMetadataConditions(conditions *map[string]interface{}) {
 func getMongoIndexes() map[string][]mongo.IndexModel {
 
 	return map[string][]mongo.IndexModel{
+		"balance_events": {
+			mongo.IndexModel{Keys: bsonx.Doc{{
+				Key:   "xpub_id",
+				Value: bsonx.Int32(1),
+			}, {
+				Key:   "created_at",
+				Value: bsonx.Int32(1),
+			}}},
+		},
 		"block_headers": {
 			mongo.IndexModel{Keys: bsonx.Doc{{
 				Key:   "height",
@@ -97,11 +109,32 @@ func getMongoIndexes() map[string][]mongo.IndexModel {
 				Value: bsonx.Int32(1),
 			}}},
 		},
+		"broadcast_receipts": {
+			mongo.IndexModel{Keys: bsonx.Doc{{
+				Key:   "tx_id",
+				Value: bsonx.Int32(1),
+			}, {
+				Key:   "created_at",
+				Value: bsonx.Int32(1),
+			}}},
+		},
 		"destinations": {
 			mongo.IndexModel{Keys: bsonx.Doc{{
 				Key:   "address",
 				Value: bsonx.Int32(1),
 			}}},
+			mongo.IndexModel{Keys: bsonx.Doc{{
+				Key:   "xpub_id",
+				Value: bsonx.Int32(1),
+			}, {
+				Key:   "chain",
+				Value: bsonx.Int32(1),
+			}, {
+				Key:   "num",
+				Value: bsonx.Int32(1),
+			}}, Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{
+				"full_derivation_path": bson.M{"$exists": true},
+			})},
 		},
 		"draft_transactions": {
 			mongo.IndexModel{Keys: bsonx.Doc{{
@@ -116,6 +149,48 @@ func getMongoIndexes() map[string][]mongo.IndexModel {
 				Value: bsonx.Int32(1),
 			}}},
 		},
+		"notification_deliveries": {
+			mongo.IndexModel{Keys: bsonx.Doc{{
+				Key:   "model_id",
+				Value: bsonx.Int32(1),
+			}}},
+			mongo.IndexModel{Keys: bsonx.Doc{{
+				Key:   "created_at",
+				Value: bsonx.Int32(1),
+			}}},
+		},
+		"sync_transactions": {
+			mongo.IndexModel{Keys: bsonx.Doc{{
+				Key:   "broadcast_status",
+				Value: bsonx.Int32(1),
+			}, {
+				Key:   "created_at",
+				Value: bsonx.Int32(1),
+			}}},
+			mongo.IndexModel{Keys: bsonx.Doc{{
+				Key:   "p2p_status",
+				Value: bsonx.Int32(1),
+			}, {
+				Key:   "created_at",
+				Value: bsonx.Int32(1),
+			}}},
+			mongo.IndexModel{Keys: bsonx.Doc{{
+				Key:   "sync_status",
+				Value: bsonx.Int32(1),
+			}, {
+				Key:   "created_at",
+				Value: bsonx.Int32(1),
+			}}},
+		},
+		"transaction_notes": {
+			mongo.IndexModel{Keys: bsonx.Doc{{
+				Key:   "xpub_id",
+				Value: bsonx.Int32(1),
+			}, {
+				Key:   "tx_id",
+				Value: bsonx.Int32(1),
+			}}},
+		},
 		"transactions": {
 			mongo.IndexModel{Keys: bsonx.Doc{{
 				Key:   "xpub_metadata.x",
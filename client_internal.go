@@ -3,6 +3,7 @@ package bux
 import (
 	"context"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/BuxOrg/bux/chainstate"
@@ -20,7 +21,18 @@ func (c *Client) loadCache(ctx context.Context) (err error) {
 
 	// Load if a custom interface was NOT provided
 	if c.options.cacheStore.ClientInterface == nil {
-		c.options.cacheStore.ClientInterface, err = cachestore.NewClient(ctx, c.options.cacheStore.options...)
+		if c.options.cacheStore.ClientInterface, err = cachestore.NewClient(
+			ctx, c.options.cacheStore.options...,
+		); err != nil {
+			return
+		}
+	}
+
+	// Wrap the cachestore with the local lock fallback (degraded mode)
+	if c.options.cacheStore.localLockFallback {
+		c.options.cacheStore.ClientInterface = newFallbackCachestore(
+			c.options.cacheStore.ClientInterface, c.options.logger, c.options.newRelic.app,
+		)
 	}
 	return
 }
@@ -30,9 +42,19 @@ func (c *Client) loadCluster(ctx context.Context) (err error) {
 
 	// Load if a custom interface was NOT provided
 	if c.options.cluster.ClientInterface == nil {
-		c.options.cluster.ClientInterface, err = cluster.NewClient(ctx, c.options.cluster.options...)
+		if c.options.cluster.ClientInterface, err = cluster.NewClient(ctx, c.options.cluster.options...); err != nil {
+			return
+		}
 	}
 
+	// Evict the destinations updated (or deleted) by any instance from the cache
+	_, err = c.options.cluster.Subscribe(cluster.DestinationUpdated, func(data string) {
+		if evictErr := deleteFromCache(
+			ctx, c, strings.Split(data, destinationCacheKeySeparator),
+		); evictErr != nil {
+			c.Logger().Error(ctx, "failed evicting updated destination from cache: "+evictErr.Error())
+		}
+	})
 	return
 }
 
@@ -43,6 +65,8 @@ func (c *Client) loadChainstate(ctx context.Context) (err error) {
 	if c.options.chainstate.ClientInterface == nil {
 		c.options.chainstate.options = append(c.options.chainstate.options, chainstate.WithUserAgent(c.UserAgent()))
 		c.options.chainstate.options = append(c.options.chainstate.options, chainstate.WithHTTPClient(c.HTTPClient()))
+		c.options.chainstate.options = append(c.options.chainstate.options, chainstate.WithBackoffStore(&providerBackoffStore{client: c}))
+		c.options.chainstate.options = append(c.options.chainstate.options, chainstate.WithRawTransactionStore(&rawTransactionStore{client: c}))
 		c.options.chainstate.ClientInterface, err = chainstate.NewClient(ctx, c.options.chainstate.options...)
 	}
 
@@ -54,16 +78,18 @@ func (c *Client) loadChainstate(ctx context.Context) (err error) {
 // NOTE: this will run database migrations if the options was set
 func (c *Client) loadDatastore(ctx context.Context) (err error) {
 
-	// Add the models to migrate (after loading the client options)
+	// Add the schema versions to migrate (the models are migrated after the schema check)
 	if len(c.options.models.migrateModelNames) > 0 {
 		c.options.dataStore.options = append(
 			c.options.dataStore.options,
-			datastore.WithAutoMigrate(c.options.models.migrateModels...),
+			datastore.WithAutoMigrate(&SchemaVersion{Model: *NewBaseModel(ModelSchemaVersion)}),
 		)
 	}
 
-	// Load client (runs ALL options, IE: auto migrate models)
+	// Load client (runs ALL options, IE: auto migrate the schema versions)
+	migrate := false
 	if c.options.dataStore.ClientInterface == nil {
+		migrate = len(c.options.models.migrateModelNames) > 0
 
 		// Add custom array and object fields
 		c.options.dataStore.options = append(
@@ -91,19 +117,58 @@ func (c *Client) loadDatastore(ctx context.Context) (err error) {
 		)
 
 		// Load the datastore client
-		c.options.dataStore.ClientInterface, err = datastore.NewClient(
+		if c.options.dataStore.ClientInterface, err = datastore.NewClient(
 			ctx, c.options.dataStore.options...,
-		)
+		); err != nil {
+			return
+		}
+	}
+
+	// Claim the stored version of the versioned records in the transaction of the save (see claimModelVersion)
+	if err = registerVersionCallback(c.options.dataStore.ClientInterface); err != nil {
+		return
+	}
+
+	// Apply the balance events to the xPub balance in the transaction of the save (see applyBalanceEvent)
+	if err = registerBalanceEventCallback(c.options.dataStore.ClientInterface); err != nil {
+		return
+	}
+
+	// Refuse to migrate (and run) if the schema is newer than this version understands (see WithSchemaCheck)
+	if err = c.checkSchemaVersions(ctx); err != nil {
+		return
+	}
+
+	// Automatically migrate the models
+	if migrate {
+		err = c.options.dataStore.AutoMigrateDatabase(ctx, c.options.models.migrateModels...)
 	}
 	return
 }
 
 // loadNotificationClient will load the notifications client
-func (c *Client) loadNotificationClient() (err error) {
+func (c *Client) loadNotificationClient(ctx context.Context) (err error) {
 
-	// Load notification if a custom interface was NOT provided
+	// Load notification if a custom interface was NOT provided (the delivery receipts and endpoint changes are persisted)
 	if c.options.notifications.ClientInterface == nil {
-		c.options.notifications.ClientInterface, err = notifications.NewClient(c.options.notifications.options...)
+		opts := append([]notifications.ClientOps{
+			notifications.WithReceiptRecorder(&notificationDeliveryRecorder{client: c}),
+			notifications.WithEndpointStore(&webhookEndpointStore{
+				client: c, configured: c.options.notifications.webhookEndpoint,
+			}),
+		}, c.options.notifications.options...)
+
+		// The endpoint changed at runtime overrides the configured endpoint it replaced (see getWebhookEndpointOverride)
+		// IE: the settings are not migrated, the configured endpoint is used
+		if endpoint, ok, settingErr := getWebhookEndpointOverride(
+			ctx, c.options.notifications.webhookEndpoint, c.DefaultModelOptions()...,
+		); settingErr != nil {
+			c.Logger().Warn(ctx, "failed loading the webhook endpoint setting: "+settingErr.Error())
+		} else if ok {
+			opts = append(opts, notifications.WithNotifications(endpoint))
+		}
+
+		c.options.notifications.ClientInterface, err = notifications.NewClient(opts...)
 	}
 	return
 }
@@ -112,7 +177,9 @@ func (c *Client) loadNotificationClient() (err error) {
 func (c *Client) loadPaymailClient() (err error) {
 	// Only load if it's not set (the client can be overloaded)
 	if c.options.paymail.client == nil {
-		c.options.paymail.client, err = paymail.NewClient()
+		if c.options.paymail.client, err = paymail.NewClient(); err == nil {
+			c.options.paymail.client = c.options.paymail.client.WithCustomHTTPClient(c.newPaymailHTTPClient())
+		}
 	}
 	return
 }
@@ -121,8 +188,17 @@ func (c *Client) loadPaymailClient() (err error) {
 func (c *Client) loadTaskmanager(ctx context.Context) (err error) {
 	// Load if a custom interface was NOT provided
 	if c.options.taskManager.ClientInterface == nil {
-		c.options.taskManager.ClientInterface, err = taskmanager.NewClient(
+		if c.options.taskManager.ClientInterface, err = taskmanager.NewClient(
 			ctx, c.options.taskManager.options...,
+		); err != nil {
+			return
+		}
+	}
+
+	// Wrap the taskmanager with the panic recovery for the task handlers
+	if _, ok := c.options.taskManager.ClientInterface.(*recoveringTaskManager); !ok {
+		c.options.taskManager.ClientInterface = newRecoveringTaskManager(
+			c.options.taskManager.ClientInterface, c.options.logger, c.options.newRelic.app,
 		)
 	}
 	return
@@ -147,29 +223,38 @@ func (c *Client) loadMonitor(ctx context.Context) (err error) {
 		return err
 	}
 
-	lockKey := c.options.cluster.GetClusterPrefix() + lockKeyMonitorLockID
 	lockID := monitor.GetLockID()
+	leader := newClusterLeader(
+		c.Cachestore(), c.options.cluster.GetClusterPrefix()+lockKeyMonitorLockID, lockID, defaultMonitorLockTTL,
+	)
 	go func() {
-		var currentLock string
+		var isLeader bool
+		stopCatchUp := func() {}
 		for {
-			if currentLock, err = c.Cachestore().WriteLockWithSecret(ctx, lockKey, lockID, defaultMonitorLockTTL); err != nil {
+			if isLeader, err = leader.campaign(ctx); err != nil {
 				// do nothing really, we just didn't get the lock
 				if monitor.IsDebug() {
 					monitor.Logger().Info(ctx, fmt.Sprintf("[MONITOR] failed getting lock for monitor: %s: %e", lockID, err))
 				}
 			}
 
-			if lockID == currentLock {
+			if isLeader {
 				// Start the monitor, if not connected
 				if !monitor.IsConnected() {
+
+					// Replay the blocks missed while no instance was monitoring
+					stopCatchUp()
+					stopCatchUp = c.runMonitorCatchUp(ctx)
+
 					if err = monitor.Start(ctx, &handler, func() {
-						_, err = c.Cachestore().ReleaseLock(ctx, lockKeyMonitorLockID, lockID)
+						err = leader.resign(ctx)
 					}); err != nil {
 						monitor.Logger().Error(ctx, fmt.Sprintf("[MONITOR] ERROR: failed starting monitor: %e", err))
 					}
 				}
 			} else {
-				// first close any monitor if running
+				// first stop the catch-up and close any monitor if running
+				stopCatchUp()
 				if monitor.IsConnected() {
 					if err = monitor.Stop(ctx); err != nil {
 						monitor.Logger().Info(ctx, fmt.Sprintf("[MONITOR] ERROR: failed stopping monitor: %e", err))
@@ -199,6 +284,13 @@ func (c *Client) runModelMigrations(models ...interface{}) (err error) {
 		if err = model.(ModelInterface).Migrate(d); err != nil {
 			return
 		}
+
+		// Optional indexes of the bux versions of the records
+		if c.options.dataStore.versionIndexes {
+			if err = migrateVersionIndexes(d, d.GetTableName(model.(ModelInterface).GetModelTableName())); err != nil {
+				return
+			}
+		}
 	}
 	return
 }
@@ -3,8 +3,10 @@ package bux
 import (
 	"context"
 	"database/sql"
+	"net"
 	"net/http"
 	"net/url"
+	"runtime"
 	"strings"
 	"time"
 
@@ -18,6 +20,7 @@ import (
 	"github.com/bitcoin-sv/go-paymail/server"
 	"github.com/coocood/freecache"
 	"github.com/go-redis/redis/v8"
+	"github.com/libsv/go-bc"
 	"github.com/mrz1836/go-cache"
 	"github.com/mrz1836/go-cachestore"
 	"github.com/mrz1836/go-datastore"
@@ -26,6 +29,7 @@ import (
 	"github.com/tonicpow/go-minercraft/v2"
 	taskq "github.com/vmihailenco/taskq/v3"
 	"go.mongodb.org/mongo-driver/mongo"
+	"golang.org/x/sync/singleflight"
 )
 
 // ClientOps allow functional options to be supplied that overwrite default client options.
@@ -39,20 +43,51 @@ func defaultClientOptions() *clientOptions {
 	// Set the default options
 	return &clientOptions{
 
+		// Balance threshold alerts fire again once recovered past the margin
+		balanceAlertMargin: defaultBalanceAlertMargin,
+
+		// Block headers are not synced from a provider by default
+		blockHeaderSync: &blockHeaderSyncOptions{
+			batchSize:     defaultBlockHeaderSyncBatchSize,
+			maxReorgDepth: defaultBlockHeaderSyncMaxReorg,
+		},
+
+		// The metadata of the drafts does not cascade by default
+		draftMetadata: DraftMetadataOff,
+
+		// No fiat display values by default (no-op provider)
+		exchangeRates: &exchangeRateOptions{
+			currency: defaultExchangeRateCurrency,
+			provider: noopExchangeRateProvider{},
+		},
+
 		// Incoming Transaction Checker (lookup external tx via miner for validity)
 		itc: true,
 
 		// By default check input utxos (unless disabled by the user)
 		iuc: true,
 
+		// Generous limits for the incoming transactions
+		incomingLimits: defaultIncomingTransactionLimits(),
+
+		// Bounded delivery of the rejection notifications (the others are dropped)
+		incomingRejections: &incomingRejectionNotifier{
+			slots: make(chan struct{}, defaultIncomingRejectNotifiers),
+		},
+
+		// Generous limits for the metadata (violations are only logged)
+		metadataLimits: defaultMetadataLimits(),
+
 		// Blank chainstate config
 		chainstate: &chainstateOptions{
-			ClientInterface:  nil,
-			options:          []chainstate.ClientOps{},
-			broadcasting:     true, // Enabled by default for new users
-			broadcastInstant: true, // Enabled by default for new users
-			paymailP2P:       true, // Enabled by default for new users
-			syncOnChain:      true, // Enabled by default for new users
+			ClientInterface:        nil,
+			options:                []chainstate.ClientOps{},
+			broadcasting:           true,                          // Enabled by default for new users
+			broadcastHighWaterMark: defaultBroadcastHighWaterMark, // Bounded memory of the broadcast task
+			broadcastInstant:       true,                          // Enabled by default for new users
+			instantBroadcastMode:   InstantBroadcastSync,          // Record creation waits for the broadcast
+			paymailP2P:             true,                          // Enabled by default for new users
+			syncOnChain:            true,                          // Enabled by default for new users
 		},
 
 		cluster: &clusterOptions{
@@ -69,6 +104,7 @@ func defaultClientOptions() *clientOptions {
 		dataStore: &dataStoreOptions{
 			ClientInterface: nil,
 			options:         []datastore.ClientOps{},
+			schemaCheck:     SchemaCheckStrict,
 		},
 
 		// Default http client
@@ -76,6 +112,15 @@ func defaultClientOptions() *clientOptions {
 			Timeout: defaultHTTPTimeout,
 		},
 
+		// Default ID generator (random hex)
+		idGenerator: &randomIDGenerator{},
+
+		// Default fee calculator (the fee unit of the draft)
+		feeCalculator: &feeUnitCalculator{},
+
+		// Cached models without expiration
+		modelCache: newModelCacheOptions(),
+
 		// Blank model options (use the Base models)
 		models: &modelOptions{
 			modelNames:        modelNames(BaseModels...),
@@ -84,31 +129,73 @@ func defaultClientOptions() *clientOptions {
 			migrateModels:     nil,
 		},
 
+		// Default network (mainnet)
+		network: chainstate.MainNet,
+
 		// Blank NewRelic config
 		newRelic: &newRelicOptions{},
 
 		// Blank notifications config
 		notifications: &notificationsOptions{
-			ClientInterface: nil,
-			webhookEndpoint: "",
+			ClientInterface:     nil,
+			deadLetterRetention: defaultDeadLetterRetention,
+			mutedMode:           MutedNotificationsDrop,
+			retention:           defaultNotificationRetention,
+			webhookEndpoint:     "",
 		},
 
 		// Blank Paymail config
 		paymail: &paymailOptions{
-			client: nil,
+			client:       nil,
+			domainPolicy: &paymailDomainPolicy{},
+			p2pFailures:  defaultP2PFailureLimit,
+			requests:     &singleflight.Group{},
 			serverConfig: &PaymailServerOptions{
-				Configuration: nil,
-				options:       []server.ConfigOps{},
+				Configuration:        nil,
+				options:              []server.ConfigOps{},
+				BeefMaxAncestryDepth: defaultBeefMaxAncestryDepth,
+				BeefMaxAncestryTxs:   defaultBeefMaxAncestryTxs,
+				PublicNameMaxLength:  defaultPaymailPublicNameMaxLength,
+				AvatarMaxLength:      defaultPaymailAvatarMaxLength,
+				AliasRules:           defaultPaymailAliasRules(),
 			},
 		},
 
+		// Startup validation is disabled by default
+		startupValidation: &startupValidationOptions{},
+
+		// The missed blocks are not replayed by default
+		monitorCatchUp: &monitorCatchUpOptions{},
+
+		// The reconciliation is disabled by default (no provider)
+		reconcile: &reconcileOptions{interval: defaultReconcileInterval},
+
+		// All monitored transactions are recorded by default
+		monitorFilter: &monitorFilterOptions{},
+
+		// Monitor events are processed by a worker per CPU
+		monitorQueue: &monitorQueueOptions{
+			depth:   defaultMonitorQueueDepth,
+			workers: runtime.NumCPU(),
+		},
+
+		// Sync queue depths are not cached and there is no warning by default
+		syncQueue: &syncQueueOptions{},
+
+		// Limit the length of the transaction notes
+		transactionNoteMax: defaultTransactionNoteMaxLength,
+
 		// Blank TaskManager config
 		taskManager: &taskManagerOptions{
 			ClientInterface: nil,
 			cronTasks: map[string]time.Duration{
+				ModelBalanceCheckpoint.String() + "_update":               taskIntervalBalanceCheckpoints,
+				ModelBlockHeader.String() + "_sync":                       taskIntervalBlockHeaderSync,
 				ModelDestination.String() + "_monitor":                    taskIntervalMonitorCheck,
 				ModelDraftTransaction.String() + "_clean_up":              taskIntervalDraftCleanup,
 				ModelIncomingTransaction.String() + "_process":            taskIntervalProcessIncomingTxs,
+				ModelNotificationDelivery.String() + "_clean_up":          taskIntervalNotificationCleanup,
+				ModelPaymailAddress.String() + "_clean_up":                taskIntervalPaymailCleanup,
 				ModelSyncTransaction.String() + "_" + syncActionBroadcast: taskIntervalSyncActionBroadcast,
 				ModelSyncTransaction.String() + "_" + syncActionP2P:       taskIntervalSyncActionP2P,
 				ModelSyncTransaction.String() + "_" + syncActionSync:      taskIntervalSyncActionSync,
@@ -116,6 +203,9 @@ func defaultClientOptions() *clientOptions {
 			},
 		},
 
+		// Default derivation prefix (relative to the xPub)
+		derivationPrefix: defaultDerivationPrefix,
+
 		// Default user agent
 		userAgent: defaultUserAgent,
 	}
@@ -164,6 +254,16 @@ func (o *clientOptions) addModels(list string, models ...interface{}) {
 	}
 }
 
+// validate will check the combination of options (before loading any services)
+func (o *clientOptions) validate() error {
+
+	// The local lock fallback is only safe on a single instance
+	if o.cacheStore.localLockFallback && o.cluster.coordinated {
+		return ErrLocalLockFallbackWithCluster
+	}
+	return nil
+}
+
 // DefaultModelOptions will set any default model options (from Client options->model)
 func (c *Client) DefaultModelOptions(opts ...ModelOps) []ModelOps {
 
@@ -190,6 +290,75 @@ func WithUserAgent(userAgent string) ClientOps {
 	}
 }
 
+// WithInstanceID will set the identifier of this instance (IE: the hostname or the pod name)
+//
+// The identifier is recorded with the bux version on the created and updated records (max 64 characters)
+func WithInstanceID(instanceID string) ClientOps {
+	return func(c *clientOptions) {
+		if len(instanceID) > maxInstanceIDLength {
+			instanceID = instanceID[:maxInstanceIDLength]
+		}
+		c.instanceID = instanceID
+	}
+}
+
+// WithNetwork will set the Bitcoin network (mainnet, testnet, stn)
+//
+// The network is used for address derivation, output address validation and the chainstate providers
+func WithNetwork(network chainstate.Network) ClientOps {
+	return func(c *clientOptions) {
+		if len(network) > 0 {
+			c.network = network
+			c.chainstate.options = append(c.chainstate.options, chainstate.WithNetwork(network))
+		}
+	}
+}
+
+// WithDerivationPrefix will set the BIP32 derivation path of the xPubs (IE: m/44'/236'/0')
+//
+// The prefix is used for the full derivation path of the destinations (for external signers)
+func WithDerivationPrefix(prefix string) ClientOps {
+	return func(c *clientOptions) {
+		if prefix = strings.TrimSuffix(strings.TrimSpace(prefix), "/"); len(prefix) > 0 {
+			c.derivationPrefix = prefix
+		}
+	}
+}
+
+// WithIDGenerator will set a custom generator for new model IDs (IE: ULIDs)
+//
+// Content-derived IDs (transaction IDs, xPub hashes, etc.) are not affected
+func WithIDGenerator(generator IDGenerator) ClientOps {
+	return func(c *clientOptions) {
+		if generator != nil {
+			c.idGenerator = generator
+		}
+	}
+}
+
+// WithFeeCalculator will set a custom calculator of the fee of the draft transactions (IE: flat or size-tiered fees)
+//
+// The fee is never below the fee unit of the draft (the miners' fee unit by default) and must still pass the checks
+// of the draft (change above the dust limit), the name of the calculator (fmt.Stringer or the type) and the fee
+// are stored on the draft configuration
+func WithFeeCalculator(calculator FeeCalculator) ClientOps {
+	return func(c *clientOptions) {
+		if calculator != nil {
+			c.feeCalculator = calculator
+		}
+	}
+}
+
+// WithStartupValidation will run end-to-end checks of the loaded subsystems in NewClient
+//
+// Lenient mode will log the failed checks as warnings instead of returning an error
+func WithStartupValidation(lenient bool) ClientOps {
+	return func(c *clientOptions) {
+		c.startupValidation.enabled = true
+		c.startupValidation.lenient = lenient
+	}
+}
+
 // WithNewRelic will set the NewRelic application client
 func WithNewRelic(app *newrelic.Application) ClientOps {
 	return func(c *clientOptions) {
@@ -236,6 +405,27 @@ func WithEncryption(key string) ClientOps {
 	}
 }
 
+// WithIdentityKey will set the private key (hex) signing the payment acknowledgments (see GetPaymentAcknowledgment)
+func WithIdentityKey(privateKey string) ClientOps {
+	return func(c *clientOptions) {
+		if len(privateKey) > 0 {
+			c.identityKey = privateKey
+		}
+	}
+}
+
+// WithModelCacheTTL will set the cache TTL of a cached model (IE: xpub, destination)
+//
+// The models are cached without expiration by default, a TTL of 0 disables the cache for the model
+// (see ModelCacheStats to tune the TTLs)
+func WithModelCacheTTL(modelName string, ttl time.Duration) ClientOps {
+	return func(c *clientOptions) {
+		if len(modelName) > 0 && ttl >= 0 {
+			c.modelCache.ttls[modelName] = ttl
+		}
+	}
+}
+
 // WithModels will add additional models (will NOT migrate using datastore)
 //
 // Pointers of structs (IE: &models.Xpub{})
@@ -254,6 +444,46 @@ func WithITCDisabled() ClientOps {
 	}
 }
 
+// WithAdminLookups will allow the cross-xPub admin lookups (AdminGetDestinationByID, AdminGetTransactionByID, etc.)
+//
+// Only enable for the admin (support) tooling, the lookups skip the xPub ownership checks
+func WithAdminLookups() ClientOps {
+	return func(c *clientOptions) {
+		c.adminLookups = true
+	}
+}
+
+// WithAuditLogSigningKey will sign the entries of the audit log (HMAC-SHA256) with the key
+//
+// Without a key the entries are hashed (SHA-256), a signed chain cannot be rebuilt without the key.
+// Changing the key breaks the verification of the existing entries (see VerifyAuditChain)
+func WithAuditLogSigningKey(key string) ClientOps {
+	return func(c *clientOptions) {
+		if len(key) > 0 {
+			c.auditSigningKey = key
+		}
+	}
+}
+
+// WithBalanceAlertMargin will set the margin (satoshis) the balance must recover past a threshold before the
+// threshold alert fires again (see SetXpubBalanceAlerts)
+func WithBalanceAlertMargin(margin uint64) ClientOps {
+	return func(c *clientOptions) {
+		c.balanceAlertMargin = margin
+	}
+}
+
+// WithBalanceCheckpoints will maintain monthly balance checkpoints of the xPubs (see GetXpubBalanceAt)
+//
+// The checkpoints are updated by a task and only accelerate the historical balances (the results are the same)
+func WithBalanceCheckpoints() ClientOps {
+	return func(c *clientOptions) {
+		c.balanceCheckpoints = true
+		c.addModels(modelList, &BalanceCheckpoint{Model: *NewBaseModel(ModelBalanceCheckpoint)})
+		c.addModels(migrateList, &BalanceCheckpoint{Model: *NewBaseModel(ModelBalanceCheckpoint)})
+	}
+}
+
 // WithIUCDisabled will disable checking the input utxos
 func WithIUCDisabled() ClientOps {
 	return func(c *clientOptions) {
@@ -261,6 +491,133 @@ func WithIUCDisabled() ClientOps {
 	}
 }
 
+// WithPreBroadcastValidation will verify the transaction before recording it (outgoing transactions of a draft)
+//
+// The unlocking scripts of the inputs spending the utxos of bux are executed, an invalid transaction
+// (IE: bad signature of an external signer) is rejected before any utxo is marked as spent
+func WithPreBroadcastValidation() ClientOps {
+	return func(c *clientOptions) {
+		c.preBroadcastCheck = true
+	}
+}
+
+// WithTransactionNoteMaxLength will set the max length (characters) of the transaction notes (0 = no limit)
+//
+// Defaults to 1024 characters
+func WithTransactionNoteMaxLength(maxLength int) ClientOps {
+	return func(c *clientOptions) {
+		if maxLength >= 0 {
+			c.transactionNoteMax = maxLength
+		}
+	}
+}
+
+// WithMaxUnconfirmedChain will set the maximum depth of the chain of unconfirmed ancestors
+//
+// Drafts that would build a deeper chain are refused, and broadcasting of deeper transactions is deferred
+func WithMaxUnconfirmedChain(maxDepth uint32) ClientOps {
+	return func(c *clientOptions) {
+		c.maxUnconfirmedChain = maxDepth
+	}
+}
+
+// WithIncomingTransactionLimits will set the limits of the incoming transactions (paymail receive and monitor)
+//
+// Transactions exceeding a limit are rejected before they are persisted (a limit of 0 is not checked)
+func WithIncomingTransactionLimits(limits *IncomingTransactionLimits) ClientOps {
+	return func(c *clientOptions) {
+		if limits != nil {
+			c.incomingLimits = limits
+		}
+	}
+}
+
+// WithMetadataLimits will set the limits of the metadata of the models (checked by UpdateMetadata and on save)
+//
+// MetadataLimitsLogOnly (default) logs the violations, MetadataLimitsStrict rejects them (a limit of 0 is not checked)
+func WithMetadataLimits(limits *MetadataLimits) ClientOps {
+	return func(c *clientOptions) {
+		if limits != nil {
+			copied := *limits
+			if copied.Mode != MetadataLimitsStrict {
+				copied.Mode = MetadataLimitsLogOnly
+			}
+			c.metadataLimits = &copied
+		}
+	}
+}
+
+// WithDraftExpiryWarning will fire the EventTypeDraftExpiringSoon notification the lead time before a draft expires
+//
+// The warning is sent once per draft by the draft clean up task (which also notifies EventTypeDraftExpired)
+func WithDraftExpiryWarning(lead time.Duration) ClientOps {
+	return func(c *clientOptions) {
+		if lead > 0 {
+			c.draftExpiryWarning = lead
+		}
+	}
+}
+
+// WithDraftMetadataPolicy will set how the metadata of the draft cascades to the recorded transaction
+//
+// DraftMetadataMerge and DraftMetadataPrefix merge the metadata of the draft into the metadata of the transaction
+// (the keys of the transaction take precedence) and set the draft ID as correlation_id on the sync transaction.
+// DraftMetadataOff (default) keeps the metadata of the draft on the draft only.
+func WithDraftMetadataPolicy(policy DraftMetadataPolicy) ClientOps {
+	return func(c *clientOptions) {
+		if policy.isValid() {
+			c.draftMetadata = policy
+		}
+	}
+}
+
+// WithSyncQueueDepths will cache the sync queue depths (cacheTTL) and log a warning if a queue exceeds warningThreshold
+//
+// The sync task checks the depths when a threshold is set (see GetSyncQueueDepths)
+func WithSyncQueueDepths(cacheTTL time.Duration, warningThreshold int64) ClientOps {
+	return func(c *clientOptions) {
+		if cacheTTL > 0 {
+			c.syncQueue.cacheTTL = cacheTTL
+		}
+		if warningThreshold > 0 {
+			c.syncQueue.warningThreshold = warningThreshold
+		}
+	}
+}
+
+// WithExchangeRateProvider will stamp the exchange rate and the fiat values when recording (IE: for the UI)
+//
+// The rate of the currency (IE: USD) and the fiat value are set on the metadata of the transactions (total value)
+// and the drafts (estimated fee) under reserved keys (fiat_*), the reads expose them as fiat_value and fiat_fee.
+// A failure of the provider never fails the record (logged and skipped).
+func WithExchangeRateProvider(provider ExchangeRateProvider, currency string) ClientOps {
+	return func(c *clientOptions) {
+		if provider != nil {
+			c.exchangeRates.provider = provider
+		}
+		if len(currency) > 0 {
+			c.exchangeRates.currency = strings.ToUpper(currency)
+		}
+	}
+}
+
+// WithBlockHeaderSync will keep the block headers in sync with the provider (see NewHTTPBlockHeaderProvider)
+//
+// The block_header_sync task fetches the missing headers in batches (validating the chain and the proof-of-work),
+// a reorg at the tip is truncated and fetched again. The import of the zip file (see WithImportBlockHeaders)
+// remains the fast bootstrap.
+func WithBlockHeaderSync(provider BlockHeaderProvider, batchSize int) ClientOps {
+	return func(c *clientOptions) {
+		if provider != nil {
+			c.blockHeaderSync.provider = provider
+			c.blockHeaderSync.powLimit, _ = bc.ExpandTargetFromAsInt(powLimitBits)
+		}
+		if batchSize > 0 {
+			c.blockHeaderSync.batchSize = batchSize
+		}
+	}
+}
+
 // WithImportBlockHeaders will import block headers on startup
 func WithImportBlockHeaders(importBlockHeadersURL string) ClientOps {
 	return func(c *clientOptions) {
@@ -350,6 +707,15 @@ func WithRedisConnection(activeClient *cache.Client) ClientOps {
 	}
 }
 
+// WithLocalLockFallback will fall back to local (in-process) locks when the cachestore is unavailable
+//
+// Only use this on single-instance deployments, it cannot be combined with a cluster coordinator
+func WithLocalLockFallback() ClientOps {
+	return func(c *clientOptions) {
+		c.cacheStore.localLockFallback = true
+	}
+}
+
 // -----------------------------------------------------------------
 // DATASTORE
 // -----------------------------------------------------------------
@@ -382,6 +748,29 @@ func WithMigrationDisabled() ClientOps {
 	}
 }
 
+// WithSchemaCheck will set what happens on startup when the schema of the database was migrated by a newer version
+// (IE: two versions side by side during a rolling upgrade)
+//
+// Strict refuses to start (default), warn logs the newer models and starts
+func WithSchemaCheck(mode SchemaCheckMode) ClientOps {
+	return func(c *clientOptions) {
+		if mode == SchemaCheckWarn {
+			c.dataStore.schemaCheck = SchemaCheckWarn
+		} else {
+			c.dataStore.schemaCheck = SchemaCheckStrict
+		}
+	}
+}
+
+// WithRecordVersionIndexes will index the bux versions that created and updated the records (all the models)
+//
+// The indexes are created by the migrations (not needed unless the records are searched by version)
+func WithRecordVersionIndexes() ClientOps {
+	return func(c *clientOptions) {
+		c.dataStore.versionIndexes = true
+	}
+}
+
 // WithSQLite will set the Datastore to use SQLite
 func WithSQLite(config *datastore.SQLiteConfig) ClientOps {
 	return func(c *clientOptions) {
@@ -452,6 +841,19 @@ func WithMongoConnection(database *mongo.Database, tablePrefix string) ClientOps
 // PAYMAIL
 // -----------------------------------------------------------------
 
+// WithPaymailActivation will require the new paymail addresses to be activated within the window
+//
+// NewPaymailAddress creates the address pending with a random challenge, ActivatePaymailAddress verifies the
+// signature of the challenge by the identity key of the xPub and activates it. Pending addresses are not served and
+// are deleted once the window elapsed (paymail_address_clean_up task). Disabled by default (0)
+func WithPaymailActivation(window time.Duration) ClientOps {
+	return func(c *clientOptions) {
+		if window >= 0 {
+			c.paymail.activation = window
+		}
+	}
+}
+
 // WithPaymailClient will set a custom paymail client
 func WithPaymailClient(client paymail.ClientInterface) ClientOps {
 	return func(c *clientOptions) {
@@ -461,6 +863,45 @@ func WithPaymailClient(client paymail.ClientInterface) ClientOps {
 	}
 }
 
+// WithPaymailDomainAllowList will only allow outgoing paymail payments to the domains (case-insensitive)
+//
+// Drafts paying any other paymail domain fail with ErrPaymailDomainBlocked (see SetPaymailDomainAllowList)
+func WithPaymailDomainAllowList(domains ...string) ClientOps {
+	return func(c *clientOptions) {
+		c.paymail.domainPolicy.setAllowList(domains)
+	}
+}
+
+// WithPaymailDomainDenyList will block outgoing paymail payments to the domains (case-insensitive)
+//
+// Drafts paying these paymail domains fail with ErrPaymailDomainBlocked (see SetPaymailDomainDenyList)
+func WithPaymailDomainDenyList(domains ...string) ClientOps {
+	return func(c *clientOptions) {
+		c.paymail.domainPolicy.setDenyList(domains)
+	}
+}
+
+// WithPaymailP2PFailureLimit will set the failed P2P notifications of a transaction before the P2P status is failed
+//
+// The failed notification fires the EventTypeP2PFailed event (contact the recipient out-of-band), 0 retries forever
+func WithPaymailP2PFailureLimit(limit uint32) ClientOps {
+	return func(c *clientOptions) {
+		c.paymail.p2pFailures = limit
+	}
+}
+
+// WithPaymailP2PMaxPayloadSize will set the max size (bytes) of the P2P payload (hex or BEEF)
+//
+// Larger payloads (or a 413 response of the receiver) are not sent, the P2P is completed once the transaction
+// is on-chain (the receiver fetches it from the network), 0 is no limit
+func WithPaymailP2PMaxPayloadSize(size int) ClientOps {
+	return func(c *clientOptions) {
+		if size >= 0 {
+			c.paymail.p2pMaxSize = size
+		}
+	}
+}
+
 // WithPaymailSupport will set the configuration for Paymail support (as a server)
 func WithPaymailSupport(domains []string, defaultFromPaymail, defaultNote string,
 	domainValidation, senderValidation bool) ClientOps {
@@ -509,6 +950,57 @@ func WithPaymailBeefSupport(pulseURL, pulseAuthToken string) ClientOps {
 	}
 }
 
+// WithPaymailBeefAncestryLimits will set the limits used when gathering ancestors for a BEEF payload
+//
+// If fallbackToBasic is set, the basic (hex) P2P format is sent instead of failing when a limit is exceeded
+func WithPaymailBeefAncestryLimits(maxDepth, maxTransactions int, fallbackToBasic bool) ClientOps {
+	return func(c *clientOptions) {
+		if maxDepth > 0 {
+			c.paymail.serverConfig.BeefMaxAncestryDepth = maxDepth
+		}
+		if maxTransactions > 0 {
+			c.paymail.serverConfig.BeefMaxAncestryTxs = maxTransactions
+		}
+		c.paymail.serverConfig.BeefFallbackToBasic = fallbackToBasic
+	}
+}
+
+// WithPaymailProfileValidation will set the validation rules for the public name & avatar of paymail addresses
+//
+// If verifyAvatar is set, the avatar url is requested (HEAD) to confirm it returns an image
+func WithPaymailProfileValidation(publicNameMaxLength, avatarMaxLength int, verifyAvatar bool) ClientOps {
+	return func(c *clientOptions) {
+		if publicNameMaxLength > 0 {
+			c.paymail.serverConfig.PublicNameMaxLength = publicNameMaxLength
+		}
+		if avatarMaxLength > 0 {
+			c.paymail.serverConfig.AvatarMaxLength = avatarMaxLength
+		}
+		c.paymail.serverConfig.AvatarVerification = verifyAvatar
+	}
+}
+
+// WithPaymailAliasRules will set the validation rules of the aliases of new paymail addresses
+//
+// New addresses breaking the rules fail with ErrPaymailAliasInvalid, ErrPaymailAliasTooShort,
+// ErrPaymailAliasTooLong or ErrPaymailAliasReserved
+func WithPaymailAliasRules(rules *PaymailAliasRules) ClientOps {
+	return func(c *clientOptions) {
+		if rules != nil {
+			c.paymail.serverConfig.AliasRules = rules
+		}
+	}
+}
+
+// WithPaymailLegacyAliases will keep the legacy (permissive) behavior: the aliases of new paymail addresses are not validated
+//
+// Aliases are still stored in lowercase (and without invalid email characters)
+func WithPaymailLegacyAliases() ClientOps {
+	return func(c *clientOptions) {
+		c.paymail.serverConfig.AliasRules = nil
+	}
+}
+
 // WithPaymailServerConfig will set the custom server configuration for Paymail
 //
 // This will allow overriding the Configuration.actions (paymail service provider)
@@ -575,6 +1067,18 @@ func WithTaskQUsingRedis(config *taskq.QueueOptions, redisOptions *redis.Options
 	}
 }
 
+// WithTaskQMigration will set a secondary TaskQ backend (migration window: new tasks go to the secondary backend)
+func WithTaskQMigration(config *taskq.QueueOptions, factory taskmanager.Factory) ClientOps {
+	return func(c *clientOptions) {
+		if config != nil {
+			c.taskManager.options = append(
+				c.taskManager.options,
+				taskmanager.WithTaskQMigration(config, factory),
+			)
+		}
+	}
+}
+
 // WithCronService will set the custom cron service provider
 func WithCronService(cronService taskmanager.CronService) ClientOps {
 	return func(c *clientOptions) {
@@ -592,6 +1096,7 @@ func WithCronService(cronService taskmanager.CronService) ClientOps {
 func WithClusterRedis(redisOptions *redis.Options) ClientOps {
 	return func(c *clientOptions) {
 		if redisOptions != nil {
+			c.cluster.coordinated = true
 			c.cluster.options = append(c.cluster.options, cluster.WithRedis(redisOptions))
 		}
 	}
@@ -610,6 +1115,7 @@ func WithClusterKeyPrefix(prefix string) ClientOps {
 func WithClusterClient(clusterClient cluster.ClientInterface) ClientOps {
 	return func(c *clientOptions) {
 		if clusterClient != nil {
+			c.cluster.coordinated = true
 			c.cluster.ClientInterface = clusterClient
 		}
 	}
@@ -638,6 +1144,31 @@ func WithChainstateOptions(broadcasting, broadcastInstant, paymailP2P, syncOnCha
 	}
 }
 
+// WithInstantBroadcastMode will set how the instant broadcast runs when a transaction is recorded
+//
+// InstantBroadcastSync (default) waits for the broadcast, InstantBroadcastAsync (opt-in) runs the broadcast in the
+// background (the caller does not get the broadcast result)
+func WithInstantBroadcastMode(mode InstantBroadcastMode) ClientOps {
+	return func(c *clientOptions) {
+		if mode == InstantBroadcastAsync || mode == InstantBroadcastSync {
+			c.chainstate.instantBroadcastMode = mode
+		}
+	}
+}
+
+// WithBroadcastHighWaterMark will set the max number of records in flight (queued or broadcasting) in the
+// broadcast task
+//
+// The ready records are paged through (oldest first), the next records are only loaded once the records in flight
+// dropped below the mark
+func WithBroadcastHighWaterMark(records int) ClientOps {
+	return func(c *clientOptions) {
+		if records > 0 {
+			c.chainstate.broadcastHighWaterMark = records
+		}
+	}
+}
+
 // WithBroadcastMiners will set a list of miners for broadcasting
 func WithBroadcastMiners(miners []*chainstate.Miner) ClientOps {
 	return func(c *clientOptions) {
@@ -674,6 +1205,58 @@ func WithMonitoring(ctx context.Context, monitorOptions *chainstate.MonitorOptio
 	}
 }
 
+// WithMonitorCatchUp will replay the blocks missed by the monitor (IE: downtime) using the provider
+//
+// On startup, the blocks after the monitor checkpoint are replayed in the background (see MonitorCatchUp),
+// maxBlocks limits the blocks replayed at once (0 = up to the tip)
+func WithMonitorCatchUp(provider BlockTransactionsProvider, maxBlocks int) ClientOps {
+	return func(c *clientOptions) {
+		if provider != nil {
+			c.monitorCatchUp.provider = provider
+		}
+		if maxBlocks > 0 {
+			c.monitorCatchUp.maxBlocks = maxBlocks
+		}
+	}
+}
+
+// WithReconciliation will enable the reconciliation of the xPubs against the unspent outputs of the provider
+//
+// The requests to the provider are spaced by the interval (see ReconcileXpub), 0 keeps the default
+func WithReconciliation(provider UnspentOutputsProvider, interval time.Duration) ClientOps {
+	return func(c *clientOptions) {
+		if provider != nil {
+			c.reconcile.provider = provider
+		}
+		if interval > 0 {
+			c.reconcile.interval = interval
+		}
+	}
+}
+
+// WithMonitorMinimumSatoshis will skip monitored transactions that only pay less than minimum satoshis to our destinations
+//
+// Skipped transactions are counted (see GetMonitorStatus) and can be recorded later using ImportTransactionByID
+func WithMonitorMinimumSatoshis(minimum uint64) ClientOps {
+	return func(c *clientOptions) {
+		c.monitorFilter.minimumSatoshis = minimum
+	}
+}
+
+// WithMonitorQueue will set the number of workers processing the monitor events and the max number of queued events
+//
+// The events of a transaction are processed in order. If the queue is full, the monitor stops reading (backpressure)
+func WithMonitorQueue(workers, depth int) ClientOps {
+	return func(c *clientOptions) {
+		if workers > 0 {
+			c.monitorQueue.workers = workers
+		}
+		if depth > 0 {
+			c.monitorQueue.depth = depth
+		}
+	}
+}
+
 // WithMonitoringInterface will set the interface to use for monitoring the blockchain
 func WithMonitoringInterface(monitor chainstate.MonitorService) ClientOps {
 	return func(c *clientOptions) {
@@ -692,6 +1275,128 @@ func WithNotifications(webhookEndpoint string) ClientOps {
 	return func(c *clientOptions) {
 		if len(webhookEndpoint) > 0 {
 			c.notifications.webhookEndpoint = webhookEndpoint
+			c.notifications.options = append(c.notifications.options, notifications.WithNotifications(webhookEndpoint))
+		}
+	}
+}
+
+// WithNotificationRetries will retry the failed webhook deliveries (maxAttempts includes the first attempt)
+func WithNotificationRetries(maxAttempts int, retryDelay time.Duration) ClientOps {
+	return func(c *clientOptions) {
+		if maxAttempts > 0 {
+			c.notifications.options = append(
+				c.notifications.options, notifications.WithWebhookRetries(maxAttempts, retryDelay),
+			)
+		}
+	}
+}
+
+// WithNotificationEndpointValidation will ping (HEAD) the new webhook endpoint before accepting it
+// (see notifications.WebhookEndpointSetter)
+func WithNotificationEndpointValidation() ClientOps {
+	return func(c *clientOptions) {
+		c.notifications.options = append(c.notifications.options, notifications.WithEndpointValidation())
+	}
+}
+
+// WithNotificationHTTPSOnly will only accept the https webhook endpoints
+func WithNotificationHTTPSOnly() ClientOps {
+	return func(c *clientOptions) {
+		c.notifications.options = append(c.notifications.options, notifications.WithHTTPSOnly())
+	}
+}
+
+// WithNotificationBlockedRanges will set the address ranges refused as webhook endpoint
+// (default: notifications.DefaultBlockedRanges, the loopback and private ranges)
+//
+// The host of the endpoint is resolved before every delivery, a delivery to a blocked address is refused and logged
+func WithNotificationBlockedRanges(ranges ...*net.IPNet) ClientOps {
+	return func(c *clientOptions) {
+		c.notifications.options = append(c.notifications.options, notifications.WithBlockedRanges(ranges...))
+	}
+}
+
+// WithNotificationInsecureEndpoints will accept any http(s) webhook endpoint (IE: localhost for local development)
+//
+// Disables the blocked ranges and WithNotificationHTTPSOnly, never use it in production
+func WithNotificationInsecureEndpoints() ClientOps {
+	return func(c *clientOptions) {
+		c.notifications.options = append(c.notifications.options, notifications.WithInsecureEndpoints())
+	}
+}
+
+// WithNotificationRetention will set how long the notification delivery receipts are kept (0 = keep all)
+//
+// Defaults to 7 days, the older receipts are deleted by the notification_delivery_clean_up task
+func WithNotificationRetention(retention time.Duration) ClientOps {
+	return func(c *clientOptions) {
+		if retention >= 0 {
+			c.notifications.retention = retention
+		}
+	}
+}
+
+// WithNotificationDeadLetterRetention will set how long the dead-lettered notification events are kept (0 = keep all)
+//
+// The events exhausting the webhook retries are dead-lettered with their payload (see RedeliverNotification).
+// Defaults to 30 days, the older dead letters are deleted by the notification_delivery_clean_up task
+func WithNotificationDeadLetterRetention(retention time.Duration) ClientOps {
+	return func(c *clientOptions) {
+		if retention >= 0 {
+			c.notifications.deadLetterRetention = retention
+		}
+	}
+}
+
+// WithNotificationTransactionNotes will include the transaction notes in the event payloads
+//
+// The notes are private and excluded from the payloads by default, the transaction events include the latest note
+// of the xPubs of the transaction
+func WithNotificationTransactionNotes() ClientOps {
+	return func(c *clientOptions) {
+		c.notifications.includeNotes = true
+	}
+}
+
+// WithNotificationDisplayProfile will set the display profile of the event payloads (IE: DisplayProfileWebhook)
+//
+// The fields hidden from the profile are removed from the payloads (see RegisterDisplayMask)
+func WithNotificationDisplayProfile(profile string) ClientOps {
+	return func(c *clientOptions) {
+		c.notifications.displayProfile = profile
+	}
+}
+
+// WithMutedNotificationsMode will set what happens to the events of the xPubs with muted notifications
+//
+// MutedNotificationsDrop (default) drops the events, MutedNotificationsSpool records them as muted delivery receipts
+// and delivers them once the notifications are unmuted
+func WithMutedNotificationsMode(mode MutedNotificationsMode) ClientOps {
+	return func(c *clientOptions) {
+		if mode == MutedNotificationsDrop || mode == MutedNotificationsSpool {
+			c.notifications.mutedMode = mode
+		}
+	}
+}
+
+// WithNotificationTransport will add a custom notification transport (message bus, etc.)
+//
+// Multiple transports can be added, the webhook (if set) is used as well
+func WithNotificationTransport(transport notifications.Transport) ClientOps {
+	return func(c *clientOptions) {
+		if transport != nil {
+			c.notifications.options = append(c.notifications.options, notifications.WithTransport(transport))
+		}
+	}
+}
+
+// WithNotificationsSchemaVersion will set the version of the event payloads
+//
+// Defaults to notifications.SchemaVersionV1, notifications.SchemaVersionLegacy sends the raw models
+func WithNotificationsSchemaVersion(version notifications.SchemaVersion) ClientOps {
+	return func(c *clientOptions) {
+		if len(version) > 0 {
+			c.notifications.options = append(c.notifications.options, notifications.WithSchemaVersion(version))
 		}
 	}
 }
@@ -755,3 +1460,19 @@ func WithBroadcastClientAPIs(apis []broadcastclient.ArcClientConfig) ClientOps {
 		c.chainstate.options = append(c.chainstate.options, chainstate.WithBroadcastClientAPIs(apis))
 	}
 }
+
+// WithWhatsOnChain will add WhatsOnChain as a raw transaction provider (the API key is optional)
+//
+// The raw transactions not stored are fetched for the BEEF ancestry and ImportTransactionByID
+func WithWhatsOnChain(apiKey string) ClientOps {
+	return func(c *clientOptions) {
+		c.chainstate.options = append(c.chainstate.options, chainstate.WithWhatsOnChain(apiKey))
+	}
+}
+
+// WithJungleBus will add a JungleBus as a raw transaction provider (IE: https://junglebus.gorillapool.io)
+func WithJungleBus(url string) ClientOps {
+	return func(c *clientOptions) {
+		c.chainstate.options = append(c.chainstate.options, chainstate.WithJungleBus(url))
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/BuxOrg/bux/chainstate"
+	"github.com/BuxOrg/bux/notifications"
 	"github.com/BuxOrg/bux/taskmanager"
 	"github.com/BuxOrg/bux/tester"
 	"github.com/BuxOrg/bux/utils"
@@ -134,6 +135,8 @@ func TestClient_defaultModelOptions(t *testing.T) {
 
 		assert.Equal(t, true, dco.itc)
 
+		assert.Equal(t, InstantBroadcastSync, dco.chainstate.instantBroadcastMode)
+
 		assert.Nil(t, dco.logger)
 	})
 }
@@ -176,6 +179,96 @@ func TestWithUserAgent(t *testing.T) {
 	})
 }
 
+// TestWithIDGenerator will test the method WithIDGenerator()
+func TestWithIDGenerator(t *testing.T) {
+	t.Parallel()
+
+	t.Run("check type", func(t *testing.T) {
+		opt := WithIDGenerator(nil)
+		assert.IsType(t, *new(ClientOps), opt)
+	})
+
+	t.Run("default generator", func(t *testing.T) {
+		opts := DefaultClientOpts(false, true)
+		opts = append(opts, WithIDGenerator(nil))
+
+		tc, err := NewClient(tester.GetNewRelicCtx(t, defaultNewRelicApp, defaultNewRelicTx), opts...)
+		require.NoError(t, err)
+		require.NotNil(t, tc)
+		defer CloseClient(context.Background(), t, tc)
+
+		assert.IsType(t, &randomIDGenerator{}, tc.IDGenerator())
+	})
+
+	t.Run("sequence generator", func(t *testing.T) {
+		opts := DefaultClientOpts(false, true)
+		opts = append(opts, WithIDGenerator(tester.NewSequenceIDGenerator(1)))
+
+		tc, err := NewClient(tester.GetNewRelicCtx(t, defaultNewRelicApp, defaultNewRelicTx), opts...)
+		require.NoError(t, err)
+		require.NotNil(t, tc)
+		defer CloseClient(context.Background(), t, tc)
+
+		draftTx := newDraftTransaction(testXPub, &TransactionConfig{}, append(tc.DefaultModelOptions(), New())...)
+		assert.Equal(t, "0000000000000000000000000000000000000000000000000000000000000001", draftTx.ID)
+
+		paymailAddress := newPaymail(testPaymail, append(tc.DefaultModelOptions(), New())...)
+		assert.Equal(t, "0000000000000000000000000000000000000000000000000000000000000002", paymailAddress.ID)
+
+		// Content-derived IDs are not affected
+		xPub := newXpub(testXPub, append(tc.DefaultModelOptions(), New())...)
+		assert.Equal(t, testXPubID, xPub.ID)
+	})
+}
+
+// TestWithStartupValidation will test the method WithStartupValidation()
+func TestWithStartupValidation(t *testing.T) {
+	t.Parallel()
+
+	t.Run("check type", func(t *testing.T) {
+		opt := WithStartupValidation(false)
+		assert.IsType(t, *new(ClientOps), opt)
+	})
+
+	t.Run("valid configuration", func(t *testing.T) {
+		opts := DefaultClientOpts(false, true)
+		opts = append(opts, WithAutoMigrate(BaseModels...), WithStartupValidation(false))
+
+		tc, err := NewClient(tester.GetNewRelicCtx(t, defaultNewRelicApp, defaultNewRelicTx), opts...)
+		require.NoError(t, err)
+		require.NotNil(t, tc)
+		defer CloseClient(context.Background(), t, tc)
+	})
+
+	t.Run("unreachable webhook", func(t *testing.T) {
+		taskManager := &closedTaskManagerMock{}
+		opts := DefaultClientOpts(false, true)
+		opts = append(opts, WithStartupValidation(false), WithNotifications("http://127.0.0.1:1/webhook"),
+			WithNotificationInsecureEndpoints(), WithCustomTaskManager(taskManager),
+		)
+
+		tc, err := NewClient(tester.GetNewRelicCtx(t, defaultNewRelicApp, defaultNewRelicTx), opts...)
+		require.ErrorIs(t, err, ErrStartupValidationFailed)
+		assert.Contains(t, err.Error(), "notifications:")
+		assert.Nil(t, tc)
+
+		// The loaded subsystems are closed
+		assert.True(t, taskManager.closed)
+	})
+
+	t.Run("unreachable webhook (lenient)", func(t *testing.T) {
+		opts := DefaultClientOpts(false, true)
+		opts = append(opts, WithStartupValidation(true), WithNotifications("http://127.0.0.1:1/webhook"),
+			WithNotificationInsecureEndpoints(),
+		)
+
+		tc, err := NewClient(tester.GetNewRelicCtx(t, defaultNewRelicApp, defaultNewRelicTx), opts...)
+		require.NoError(t, err)
+		require.NotNil(t, tc)
+		defer CloseClient(context.Background(), t, tc)
+	})
+}
+
 // TestWithNewRelic will test the method WithNewRelic()
 func TestWithNewRelic(t *testing.T) {
 	t.Parallel()
@@ -560,8 +653,9 @@ func TestWithModels(t *testing.T) {
 			ModelXPub.String(), ModelAccessKey.String(),
 			ModelDraftTransaction.String(), ModelIncomingTransaction.String(),
 			ModelTransaction.String(), ModelBlockHeader.String(),
-			ModelSyncTransaction.String(), ModelDestination.String(),
-			ModelUtxo.String(),
+			ModelSyncTransaction.String(), ModelBroadcastReceipt.String(), ModelDestination.String(),
+			ModelUtxo.String(), ModelNotificationDelivery.String(), ModelBalanceEvent.String(),
+			ModelTransactionNote.String(), ModelSetting.String(), ModelAuditLog.String(),
 		}, tc.GetModelNames())
 	})
 
@@ -578,8 +672,10 @@ func TestWithModels(t *testing.T) {
 			ModelXPub.String(), ModelAccessKey.String(),
 			ModelDraftTransaction.String(), ModelIncomingTransaction.String(),
 			ModelTransaction.String(), ModelBlockHeader.String(),
-			ModelSyncTransaction.String(), ModelDestination.String(),
-			ModelUtxo.String(), ModelPaymailAddress.String(),
+			ModelSyncTransaction.String(), ModelBroadcastReceipt.String(), ModelDestination.String(),
+			ModelUtxo.String(), ModelNotificationDelivery.String(), ModelBalanceEvent.String(),
+			ModelTransactionNote.String(), ModelSetting.String(), ModelAuditLog.String(),
+			ModelPaymailAddress.String(),
 		}, tc.GetModelNames())
 	})
 }
@@ -617,6 +713,72 @@ func TestWithITCDisabled(t *testing.T) {
 	})
 }
 
+// TestWithLocalLockFallback will test the method WithLocalLockFallback()
+func TestWithLocalLockFallback(t *testing.T) {
+	t.Parallel()
+
+	t.Run("check type", func(t *testing.T) {
+		opt := WithLocalLockFallback()
+		assert.IsType(t, *new(ClientOps), opt)
+	})
+
+	t.Run("wraps the cachestore", func(t *testing.T) {
+		opts := DefaultClientOpts(false, true)
+		opts = append(opts, WithLocalLockFallback())
+
+		tc, err := NewClient(tester.GetNewRelicCtx(t, defaultNewRelicApp, defaultNewRelicTx), opts...)
+		require.NoError(t, err)
+		require.NotNil(t, tc)
+		defer CloseClient(context.Background(), t, tc)
+
+		assert.IsType(t, &fallbackCachestore{}, tc.Cachestore())
+		assert.Equal(t, uint64(0), tc.LocalLockFallbacks())
+	})
+
+	t.Run("not allowed with a cluster coordinator", func(t *testing.T) {
+		opts := DefaultClientOpts(false, true)
+		opts = append(opts, WithLocalLockFallback(), WithClusterRedis(&redis.Options{}))
+
+		tc, err := NewClient(tester.GetNewRelicCtx(t, defaultNewRelicApp, defaultNewRelicTx), opts...)
+		require.ErrorIs(t, err, ErrLocalLockFallbackWithCluster)
+		require.Nil(t, tc)
+	})
+}
+
+// TestWithNetwork will test the method WithNetwork()
+func TestWithNetwork(t *testing.T) {
+	t.Parallel()
+
+	t.Run("check type", func(t *testing.T) {
+		opt := WithNetwork(chainstate.TestNet)
+		assert.IsType(t, *new(ClientOps), opt)
+	})
+
+	t.Run("default options", func(t *testing.T) {
+		opts := DefaultClientOpts(false, true)
+
+		tc, err := NewClient(tester.GetNewRelicCtx(t, defaultNewRelicApp, defaultNewRelicTx), opts...)
+		require.NoError(t, err)
+		require.NotNil(t, tc)
+		defer CloseClient(context.Background(), t, tc)
+
+		assert.Equal(t, chainstate.MainNet, tc.Network())
+	})
+
+	t.Run("testnet", func(t *testing.T) {
+		opts := DefaultClientOpts(false, true)
+		opts = append(opts, WithNetwork(chainstate.TestNet))
+
+		tc, err := NewClient(tester.GetNewRelicCtx(t, defaultNewRelicApp, defaultNewRelicTx), opts...)
+		require.NoError(t, err)
+		require.NotNil(t, tc)
+		defer CloseClient(context.Background(), t, tc)
+
+		assert.Equal(t, chainstate.TestNet, tc.Network())
+		assert.Equal(t, chainstate.TestNet, tc.Chainstate().Network())
+	})
+}
+
 // TestWithIUCDisabled will test the method WithIUCDisabled()
 func TestWithIUCDisabled(t *testing.T) {
 	t.Parallel()
@@ -650,6 +812,39 @@ func TestWithIUCDisabled(t *testing.T) {
 	})
 }
 
+// TestWithMaxUnconfirmedChain will test the method WithMaxUnconfirmedChain()
+func TestWithMaxUnconfirmedChain(t *testing.T) {
+	t.Parallel()
+
+	t.Run("check type", func(t *testing.T) {
+		opt := WithMaxUnconfirmedChain(0)
+		assert.IsType(t, *new(ClientOps), opt)
+	})
+
+	t.Run("default options", func(t *testing.T) {
+		opts := DefaultClientOpts(false, true)
+
+		tc, err := NewClient(tester.GetNewRelicCtx(t, defaultNewRelicApp, defaultNewRelicTx), opts...)
+		require.NoError(t, err)
+		require.NotNil(t, tc)
+		defer CloseClient(context.Background(), t, tc)
+
+		assert.Equal(t, uint32(0), tc.MaxUnconfirmedChain())
+	})
+
+	t.Run("custom limit", func(t *testing.T) {
+		opts := DefaultClientOpts(false, true)
+		opts = append(opts, WithMaxUnconfirmedChain(25))
+
+		tc, err := NewClient(tester.GetNewRelicCtx(t, defaultNewRelicApp, defaultNewRelicTx), opts...)
+		require.NoError(t, err)
+		require.NotNil(t, tc)
+		defer CloseClient(context.Background(), t, tc)
+
+		assert.Equal(t, uint32(25), tc.MaxUnconfirmedChain())
+	})
+}
+
 // TestWithImportBlockHeaders will test the method WithImportBlockHeaders()
 func TestWithImportBlockHeaders(t *testing.T) {
 	t.Parallel()
@@ -828,8 +1023,14 @@ func TestWithAutoMigrate(t *testing.T) {
 			ModelTransaction.String(),
 			ModelBlockHeader.String(),
 			ModelSyncTransaction.String(),
+			ModelBroadcastReceipt.String(),
 			ModelDestination.String(),
 			ModelUtxo.String(),
+			ModelNotificationDelivery.String(),
+			ModelBalanceEvent.String(),
+			ModelTransactionNote.String(),
+			ModelSetting.String(),
+			ModelAuditLog.String(),
 		}, tc.GetModelNames())
 	})
 
@@ -850,8 +1051,14 @@ func TestWithAutoMigrate(t *testing.T) {
 			ModelTransaction.String(),
 			ModelBlockHeader.String(),
 			ModelSyncTransaction.String(),
+			ModelBroadcastReceipt.String(),
 			ModelDestination.String(),
 			ModelUtxo.String(),
+			ModelNotificationDelivery.String(),
+			ModelBalanceEvent.String(),
+			ModelTransactionNote.String(),
+			ModelSetting.String(),
+			ModelAuditLog.String(),
 			ModelPaymailAddress.String(),
 		}, tc.GetModelNames())
 	})
@@ -889,3 +1096,283 @@ func TestWithMigrationDisabled(t *testing.T) {
 		assert.Equal(t, false, tc.IsMigrationEnabled())
 	})
 }
+
+// TestWithNotificationTransport will test the method WithNotificationTransport()
+func TestWithNotificationTransport(t *testing.T) {
+	t.Parallel()
+
+	t.Run("check type", func(t *testing.T) {
+		opt := WithNotificationTransport(notifications.NewMemoryTransport())
+		assert.IsType(t, *new(ClientOps), opt)
+	})
+
+	t.Run("test applying nil", func(t *testing.T) {
+		options := &clientOptions{notifications: &notificationsOptions{}}
+		WithNotificationTransport(nil)(options)
+		assert.Equal(t, 0, len(options.notifications.options))
+	})
+
+	t.Run("events are delivered to the transports", func(t *testing.T) {
+		transport := notifications.NewMemoryTransport()
+		other := notifications.NewMemoryTransport()
+		ctx, client, deferMe := CreateTestSQLiteClient(
+			t, false, false, WithCustomTaskManager(&taskManagerMockBase{}),
+			WithNotificationTransport(transport), WithNotificationTransport(other),
+		)
+		defer deferMe()
+
+		require.Equal(t, 2, len(client.Notifications().Transports()))
+
+		_, err := client.NewXpub(ctx, testXPub, client.DefaultModelOptions()...)
+		require.NoError(t, err)
+
+		var destination *Destination
+		destination, err = client.NewDestination(ctx, testXPub, utils.ChainExternal, utils.ScriptTypePubKeyHash, false)
+		require.NoError(t, err)
+
+		findEvent := func(events []*notifications.Event) *notifications.Event {
+			for _, event := range events {
+				if event.ID == destination.ID {
+					return event
+				}
+			}
+			return nil
+		}
+		require.Eventually(t, func() bool {
+			return findEvent(transport.Events()) != nil && findEvent(other.Events()) != nil
+		}, 5*time.Second, 10*time.Millisecond)
+
+		event := findEvent(transport.Events())
+		assert.Equal(t, notifications.EventTypeCreate, event.EventType)
+		assert.Equal(t, ModelDestination.String(), event.ModelType)
+		assert.Equal(t, notifications.SchemaVersionV1, event.SchemaVersion)
+		require.IsType(t, &notifications.DestinationEventV1{}, event.Model)
+		assert.Equal(t, destination.Address, event.Model.(*notifications.DestinationEventV1).Address)
+	})
+}
+
+// TestWithNotificationInsecureEndpoints will test the SSRF guard options of the webhook endpoint
+func TestWithNotificationInsecureEndpoints(t *testing.T) {
+	t.Parallel()
+
+	t.Run("check type", func(t *testing.T) {
+		assert.IsType(t, *new(ClientOps), WithNotificationInsecureEndpoints())
+		assert.IsType(t, *new(ClientOps), WithNotificationHTTPSOnly())
+		assert.IsType(t, *new(ClientOps), WithNotificationBlockedRanges())
+	})
+
+	// newNotifications will load the notifications client of the options
+	newNotifications := func(opts ...ClientOps) (notifications.ClientInterface, error) {
+		options := defaultClientOptions()
+		for _, opt := range opts {
+			opt(options)
+		}
+		return notifications.NewClient(options.notifications.options...)
+	}
+
+	t.Run("local endpoint is blocked by default", func(t *testing.T) {
+		_, err := newNotifications(WithNotifications("http://localhost:3000/webhook"))
+		require.ErrorIs(t, err, notifications.ErrBlockedEndpoint)
+
+		_, err = newNotifications(WithNotifications("http://192.168.1.10/webhook"))
+		require.ErrorIs(t, err, notifications.ErrBlockedEndpoint)
+	})
+
+	t.Run("insecure endpoints (local development)", func(t *testing.T) {
+		n, err := newNotifications(
+			WithNotifications("http://localhost:3000/webhook"), WithNotificationHTTPSOnly(),
+			WithNotificationInsecureEndpoints(),
+		)
+		require.NoError(t, err)
+		assert.Equal(t, "http://localhost:3000/webhook", n.GetWebhookEndpoint())
+	})
+
+	t.Run("https only", func(t *testing.T) {
+		_, err := newNotifications(WithNotifications("http://hooks.example.com/webhook"), WithNotificationHTTPSOnly())
+		require.ErrorIs(t, err, notifications.ErrInvalidEndpoint)
+	})
+
+	t.Run("custom blocked ranges", func(t *testing.T) {
+		n, err := newNotifications(WithNotifications("http://192.168.1.10/webhook"), WithNotificationBlockedRanges())
+		require.NoError(t, err)
+		assert.Equal(t, "http://192.168.1.10/webhook", n.GetWebhookEndpoint())
+	})
+}
+
+// TestWithNotificationsSchemaVersion will test the method WithNotificationsSchemaVersion()
+func TestWithNotificationsSchemaVersion(t *testing.T) {
+	t.Parallel()
+
+	t.Run("check type", func(t *testing.T) {
+		opt := WithNotificationsSchemaVersion(notifications.SchemaVersionLegacy)
+		assert.IsType(t, *new(ClientOps), opt)
+	})
+
+	t.Run("test applying empty", func(t *testing.T) {
+		options := &clientOptions{notifications: &notificationsOptions{}}
+		WithNotificationsSchemaVersion("")(options)
+		assert.Equal(t, 0, len(options.notifications.options))
+	})
+
+	t.Run("legacy events are the raw models", func(t *testing.T) {
+		transport := notifications.NewMemoryTransport()
+		ctx, client, deferMe := CreateTestSQLiteClient(
+			t, false, false, WithCustomTaskManager(&taskManagerMockBase{}),
+			WithNotificationTransport(transport), WithNotificationsSchemaVersion(notifications.SchemaVersionLegacy),
+		)
+		defer deferMe()
+
+		_, err := client.NewXpub(ctx, testXPub, client.DefaultModelOptions()...)
+		require.NoError(t, err)
+
+		var destination *Destination
+		destination, err = client.NewDestination(ctx, testXPub, utils.ChainExternal, utils.ScriptTypePubKeyHash, false)
+		require.NoError(t, err)
+
+		var event *notifications.Event
+		require.Eventually(t, func() bool {
+			for _, e := range transport.Events() {
+				if e.ID == destination.ID {
+					event = e
+					return true
+				}
+			}
+			return false
+		}, 5*time.Second, 10*time.Millisecond)
+
+		assert.Equal(t, notifications.SchemaVersionLegacy, event.SchemaVersion)
+		require.IsType(t, &Destination{}, event.Model)
+		assert.Equal(t, destination.Address, event.Model.(*Destination).Address)
+	})
+}
+
+// TestWithSyncQueueDepths will test the method WithSyncQueueDepths()
+func TestWithSyncQueueDepths(t *testing.T) {
+	t.Parallel()
+
+	t.Run("check type", func(t *testing.T) {
+		opt := WithSyncQueueDepths(0, 0)
+		assert.IsType(t, *new(ClientOps), opt)
+	})
+
+	t.Run("default options", func(t *testing.T) {
+		opts := DefaultClientOpts(false, true)
+
+		tc, err := NewClient(tester.GetNewRelicCtx(t, defaultNewRelicApp, defaultNewRelicTx), opts...)
+		require.NoError(t, err)
+		require.NotNil(t, tc)
+		defer CloseClient(context.Background(), t, tc)
+
+		assert.Equal(t, int64(0), tc.SyncQueueWarningThreshold())
+		assert.Equal(t, time.Duration(0), tc.(*Client).options.syncQueue.cacheTTL)
+	})
+
+	t.Run("custom cache and threshold", func(t *testing.T) {
+		opts := DefaultClientOpts(false, true)
+		opts = append(opts, WithSyncQueueDepths(5*time.Second, 1000))
+
+		tc, err := NewClient(tester.GetNewRelicCtx(t, defaultNewRelicApp, defaultNewRelicTx), opts...)
+		require.NoError(t, err)
+		require.NotNil(t, tc)
+		defer CloseClient(context.Background(), t, tc)
+
+		assert.Equal(t, int64(1000), tc.SyncQueueWarningThreshold())
+		assert.Equal(t, 5*time.Second, tc.(*Client).options.syncQueue.cacheTTL)
+	})
+}
+
+// TestWithMonitorMinimumSatoshis will test the method WithMonitorMinimumSatoshis()
+func TestWithMonitorMinimumSatoshis(t *testing.T) {
+	t.Parallel()
+
+	t.Run("check type", func(t *testing.T) {
+		opt := WithMonitorMinimumSatoshis(0)
+		assert.IsType(t, *new(ClientOps), opt)
+	})
+
+	t.Run("default options", func(t *testing.T) {
+		opts := DefaultClientOpts(false, true)
+
+		tc, err := NewClient(tester.GetNewRelicCtx(t, defaultNewRelicApp, defaultNewRelicTx), opts...)
+		require.NoError(t, err)
+		require.NotNil(t, tc)
+		defer CloseClient(context.Background(), t, tc)
+
+		assert.Equal(t, uint64(0), tc.GetMonitorStatus().MinimumSatoshis)
+	})
+
+	t.Run("custom minimum", func(t *testing.T) {
+		opts := DefaultClientOpts(false, true)
+		opts = append(opts, WithMonitorMinimumSatoshis(546))
+
+		tc, err := NewClient(tester.GetNewRelicCtx(t, defaultNewRelicApp, defaultNewRelicTx), opts...)
+		require.NoError(t, err)
+		require.NotNil(t, tc)
+		defer CloseClient(context.Background(), t, tc)
+
+		assert.Equal(t, uint64(546), tc.GetMonitorStatus().MinimumSatoshis)
+		assert.False(t, tc.GetMonitorStatus().Enabled)
+	})
+}
+
+// TestWithDraftExpiryWarning will test the method WithDraftExpiryWarning()
+func TestWithDraftExpiryWarning(t *testing.T) {
+	t.Parallel()
+
+	t.Run("check type", func(t *testing.T) {
+		opt := WithDraftExpiryWarning(0)
+		assert.IsType(t, *new(ClientOps), opt)
+	})
+
+	t.Run("test applying", func(t *testing.T) {
+		options := &clientOptions{}
+		opt := WithDraftExpiryWarning(10 * time.Minute)
+		opt(options)
+		assert.Equal(t, 10*time.Minute, options.draftExpiryWarning)
+	})
+
+	t.Run("negative lead is ignored", func(t *testing.T) {
+		options := &clientOptions{}
+		opt := WithDraftExpiryWarning(-time.Minute)
+		opt(options)
+		assert.Equal(t, time.Duration(0), options.draftExpiryWarning)
+	})
+}
+
+// TestWithMetadataLimits will test the method WithMetadataLimits()
+func TestWithMetadataLimits(t *testing.T) {
+	t.Parallel()
+
+	t.Run("check type", func(t *testing.T) {
+		opt := WithMetadataLimits(nil)
+		assert.IsType(t, *new(ClientOps), opt)
+	})
+
+	t.Run("limits are copied", func(t *testing.T) {
+		options := &clientOptions{}
+		limits := &MetadataLimits{MaxKeys: 2}
+		opt := WithMetadataLimits(limits)
+		opt(options)
+		assert.Equal(t, MetadataLimitsMode(""), limits.Mode)
+		assert.Equal(t, &MetadataLimits{MaxKeys: 2, Mode: MetadataLimitsLogOnly}, options.metadataLimits)
+	})
+}
+
+// TestWithPaymailDomainLists will test the methods WithPaymailDomainAllowList() and WithPaymailDomainDenyList()
+func TestWithPaymailDomainLists(t *testing.T) {
+	t.Parallel()
+
+	t.Run("check type", func(t *testing.T) {
+		assert.IsType(t, *new(ClientOps), WithPaymailDomainAllowList())
+		assert.IsType(t, *new(ClientOps), WithPaymailDomainDenyList())
+	})
+
+	t.Run("test applying", func(t *testing.T) {
+		options := defaultClientOptions()
+		WithPaymailDomainAllowList("Example.com")(options)
+		WithPaymailDomainDenyList("blocked.com")(options)
+		assert.NoError(t, options.paymail.domainPolicy.check("example.com"))
+		assert.ErrorIs(t, options.paymail.domainPolicy.check("blocked.com"), ErrPaymailDomainBlocked)
+		assert.ErrorIs(t, options.paymail.domainPolicy.check("other.com"), ErrPaymailDomainBlocked)
+	})
+}
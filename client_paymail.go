@@ -1,6 +1,8 @@
 package bux
 
 import (
+	"time"
+
 	"github.com/bitcoin-sv/go-paymail"
 )
 
@@ -20,6 +22,33 @@ func (c *Client) GetPaymailConfig() *PaymailServerOptions {
 	return nil
 }
 
+// PaymailActivationWindow will return the window to activate the new paymail addresses (0 = active on creation)
+func (c *Client) PaymailActivationWindow() time.Duration {
+	if c.options.paymail != nil {
+		return c.options.paymail.activation
+	}
+	return 0
+}
+
+// PaymailP2PFailureLimit will return the failed P2P notifications of a transaction before it is marked as failed
+// (0 = retried until delivered)
+func (c *Client) PaymailP2PFailureLimit() uint32 {
+	if c.options.paymail != nil {
+		return c.options.paymail.p2pFailures
+	}
+	return 0
+}
+
+// PaymailP2PMaxPayloadSize will return the max size (bytes) of the P2P payload (0 = no limit)
+//
+// The larger transactions are not sent, the receiver fetches them on-chain (see WithPaymailP2PMaxPayloadSize)
+func (c *Client) PaymailP2PMaxPayloadSize() int {
+	if c.options.paymail != nil {
+		return c.options.paymail.p2pMaxSize
+	}
+	return 0
+}
+
 // Client will return the paymail client from the options struct
 func (p *paymailOptions) Client() paymail.ClientInterface {
 	return p.client
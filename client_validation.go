@@ -0,0 +1,195 @@
+package bux
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/BuxOrg/bux/utils"
+	"github.com/mrz1836/go-datastore"
+	"github.com/tonicpow/go-minercraft/v2"
+)
+
+// startupCheck is a single labeled startup validation check
+type startupCheck struct {
+	label string
+	check func(ctx context.Context) error
+}
+
+// validateStartup will run all the startup validation checks (end-to-end checks of the loaded subsystems)
+//
+// In lenient mode, failures are logged as warnings and no error is returned
+func (c *Client) validateStartup(ctx context.Context) error {
+
+	// Run each check (all checks run, failures are combined)
+	var failures []string
+	for _, sc := range []startupCheck{
+		{label: "datastore", check: c.validateStartupDatastore},
+		{label: "cachestore", check: c.validateStartupCachestore},
+		{label: "chainstate", check: c.validateStartupChainstate},
+		{label: "paymail", check: c.validateStartupPaymail},
+		{label: "notifications", check: c.validateStartupWebhook},
+	} {
+		if err := sc.check(ctx); err != nil {
+			failures = append(failures, sc.label+": "+err.Error())
+		}
+	}
+
+	if len(failures) == 0 {
+		return nil
+	}
+
+	// Lenient mode only logs the failures
+	if c.options.startupValidation.lenient {
+		for _, failure := range failures {
+			c.Logger().Warn(ctx, "startup validation failed: "+failure)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("%w: %s", ErrStartupValidationFailed, strings.Join(failures, "; "))
+}
+
+// validateStartupDatastore will write a sentinel row (in a transaction) and roll it back
+func (c *Client) validateStartupDatastore(ctx context.Context) error {
+	ds := c.Datastore()
+	if ds == nil {
+		return ErrDatastoreRequired
+	}
+
+	id, err := utils.RandomHex(32)
+	if err != nil {
+		return err
+	}
+	sentinel := newXpubUsingID(id, c.DefaultModelOptions(New())...)
+
+	// MongoDB does not support raw transactions, a read is the cheapest check
+	if ds.Engine() == datastore.MongoDB {
+		_, err = ds.GetModelCount(
+			ctx, sentinel, map[string]interface{}{idField: id}, defaultDatabaseReadTimeout,
+		)
+		return err
+	}
+
+	// Write the sentinel row, then roll it back (nothing is persisted)
+	var tx *datastore.Transaction
+	if tx, err = ds.NewRawTx(); err != nil {
+		return err
+	}
+	if err = ds.SaveModel(ctx, sentinel, tx, true, false); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Rollback()
+}
+
+// validateStartupCachestore will set, get and delete a sentinel key
+func (c *Client) validateStartupCachestore(ctx context.Context) error {
+	cs := c.Cachestore()
+	if cs == nil || cs.Engine().IsEmpty() {
+		return nil
+	}
+
+	id, err := utils.RandomHex(16)
+	if err != nil {
+		return err
+	}
+	key := cacheKeyStartupValidation + id
+	value := &SyncResult{Action: "startup", StatusMessage: id}
+	if err = cs.SetModel(ctx, key, value, cacheTTLStartupValidation); err != nil {
+		return err
+	}
+	defer func() {
+		_ = cs.Delete(ctx, key)
+	}()
+
+	result := new(SyncResult)
+	if err = cs.GetModel(ctx, key, result); err != nil {
+		return err
+	} else if result.StatusMessage != id {
+		return fmt.Errorf("cached value mismatch for key %s", key)
+	}
+	return nil
+}
+
+// validateStartupChainstate will fetch a policy/fee quote from each configured broadcast provider
+func (c *Client) validateStartupChainstate(ctx context.Context) error {
+	cs := c.Chainstate()
+	if cs == nil || !c.options.chainstate.broadcasting {
+		return nil
+	}
+
+	var failures []string
+
+	// Minercraft (mAPI or Arc miners)
+	if mc := cs.Minercraft(); mc != nil {
+		miners := cs.BroadcastMiners()
+		if len(miners) == 0 {
+			failures = append(failures, "no broadcast miners are available")
+		}
+		for _, miner := range miners {
+			var err error
+			if mc.APIType() == minercraft.Arc {
+				_, err = mc.PolicyQuote(ctx, miner.Miner)
+			} else {
+				_, err = mc.FeeQuote(ctx, miner.Miner)
+			}
+			if err != nil {
+				failures = append(failures, "miner "+miner.Miner.Name+": "+err.Error())
+			}
+		}
+	}
+
+	// Broadcast client (Arc)
+	if bc := cs.BroadcastClient(); bc != nil {
+		if _, err := bc.GetPolicyQuote(ctx); err != nil {
+			failures = append(failures, "broadcast client: "+err.Error())
+		}
+	}
+
+	if len(failures) > 0 {
+		return errors.New(strings.Join(failures, ", "))
+	}
+	return nil
+}
+
+// validateStartupPaymail will fetch the capabilities of the configured default paymail domain
+func (c *Client) validateStartupPaymail(ctx context.Context) error {
+	pm := c.PaymailClient()
+	config := c.GetPaymailConfig()
+	if pm == nil || config == nil || config.Configuration == nil || len(config.PaymailDomains) == 0 {
+		return nil
+	}
+
+	_, err := getCapabilities(ctx, c.options.paymail.requests, c.Cachestore(), pm, config.PaymailDomains[0].Name)
+	return err
+}
+
+// validateStartupWebhook will make sure the webhook endpoint is reachable (HEAD)
+func (c *Client) validateStartupWebhook(ctx context.Context) error {
+	n := c.Notifications()
+	if n == nil || len(n.GetWebhookEndpoint()) == 0 {
+		return nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, n.GetWebhookEndpoint(), nil)
+	if err != nil {
+		return err
+	}
+
+	var res *http.Response
+	if res, err = c.HTTPClient().Do(req); err != nil {
+		return err
+	}
+	defer func() {
+		_ = res.Body.Close()
+	}()
+
+	// Any response (other than a server error) means the endpoint is reachable
+	if res.StatusCode >= http.StatusInternalServerError {
+		return fmt.Errorf("webhook endpoint returned status code %d", res.StatusCode)
+	}
+	return nil
+}
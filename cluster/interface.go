@@ -19,6 +19,9 @@ type Channel string
 var (
 	// DestinationNew is a message sent when a new destination is created
 	DestinationNew Channel = "new-destination"
+
+	// DestinationUpdated is a message sent when a destination is updated or deleted (data: the cache keys to evict)
+	DestinationUpdated Channel = "updated-destination"
 )
 
 // ClientInterface interface for the internal pub/sub functionality for clusters
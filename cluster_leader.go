@@ -0,0 +1,45 @@
+package bux
+
+import (
+	"context"
+
+	"github.com/mrz1836/go-cachestore"
+)
+
+// clusterLeader is the leader election of the instances of a cluster (IE: only one instance runs the monitor)
+//
+// The leader holds a lease (a lock in the shared cachestore with the id of the instance) and renews it on every
+// campaign. If the leader stops renewing (IE: it was killed), another instance takes over when the lease expires.
+type clusterLeader struct {
+	cacheStore cachestore.ClientInterface // Shared cachestore (redis in a cluster)
+	id         string                     // ID of this instance (the secret of the lock)
+	key        string                     // Lock key of the lease
+	ttl        int64                      // Lease period (in seconds)
+}
+
+// newClusterLeader will start a new leader election for the lease (key)
+func newClusterLeader(cacheStore cachestore.ClientInterface, key, id string, ttl int64) *clusterLeader {
+	return &clusterLeader{
+		cacheStore: cacheStore,
+		id:         id,
+		key:        key,
+		ttl:        ttl,
+	}
+}
+
+// campaign will acquire (or renew) the lease, returns true if this instance is the leader
+//
+// The error is returned if the lease is held by another instance (or the cachestore failed)
+func (l *clusterLeader) campaign(ctx context.Context) (bool, error) {
+	lock, err := l.cacheStore.WriteLockWithSecret(ctx, l.key, l.id, l.ttl)
+	if err != nil {
+		return false, err
+	}
+	return lock == l.id, nil
+}
+
+// resign will release the lease (only if this instance is the leader)
+func (l *clusterLeader) resign(ctx context.Context) error {
+	_, err := l.cacheStore.ReleaseLock(ctx, l.key, l.id)
+	return err
+}
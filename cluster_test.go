@@ -0,0 +1,276 @@
+//go:build cluster_tests
+// +build cluster_tests
+
+package bux
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/BuxOrg/bux/chainstate"
+	"github.com/BuxOrg/bux/taskmanager"
+	"github.com/BuxOrg/bux/tester"
+	"github.com/mrz1836/go-cachestore"
+	zLogger "github.com/mrz1836/go-logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testClusterLeaseTTL is the lease period (in seconds) of the leader election tests
+const testClusterLeaseTTL = 2
+
+// clusterNode is an instance (client) of a test cluster
+type clusterNode struct {
+	chainstate *chainstate.MockClient
+	client     ClientInterface
+	name       string
+}
+
+// sharedCachestore is the cachestore shared by the instances of a test cluster
+//
+// Closing an instance does not close the cachestore (the other instances might still use it), see newTestCluster
+type sharedCachestore struct {
+	cachestore.ClientInterface
+}
+
+// Close will do nothing (the cachestore is closed once all the instances are closed)
+func (c *sharedCachestore) Close(_ context.Context) {}
+
+// newTestCluster will create the instances of a cluster sharing the same datastore (SQLite) and cachestore
+//
+// The shared FreeCache client stands in for redis (in-process), every instance has its own chainstate
+func newTestCluster(t *testing.T, instances int) (context.Context, []*clusterNode) {
+	ctx := context.Background()
+
+	cacheStore, err := cachestore.NewClient(ctx, cachestore.WithFreeCache())
+	require.NoError(t, err)
+
+	// All the instances use the same database (and table prefix), migrated with the paymail addresses
+	// (drafts look up the paymail of the sender)
+	databasePath, tablePrefix := tester.SQLiteInMemoryDSN(), tester.RandomTablePrefix()
+	models := append([]interface{}{&PaymailAddress{
+		Model: *NewBaseModel(ModelPaymailAddress),
+	}}, BaseModels...)
+
+	nodes := make([]*clusterNode, 0, instances)
+	for i := 0; i < instances; i++ {
+		sqliteConfig := tester.SQLiteTestConfig(false, false)
+		sqliteConfig.DatabasePath = databasePath
+		sqliteConfig.TablePrefix = tablePrefix
+
+		node := &clusterNode{
+			chainstate: chainstate.NewMockClient(),
+			name:       fmt.Sprintf("node-%d", i),
+		}
+		node.client, err = NewClient(ctx,
+			WithSQLite(sqliteConfig),
+			WithCustomCachestore(&sharedCachestore{ClientInterface: cacheStore}),
+			WithCustomChainstate(node.chainstate),
+			WithTaskQ(taskmanager.DefaultTaskQConfig(tester.RandomTablePrefix()), taskmanager.FactoryMemory),
+			WithAutoMigrate(models...),
+		)
+		require.NoError(t, err)
+		nodes = append(nodes, node)
+	}
+
+	// Every instance must see the tables migrated by the first one
+	for _, node := range nodes {
+		for _, tableName := range []string{tableXPubs, tablePaymailAddresses, tableSyncTransactions} {
+			require.NoError(t, node.client.Datastore().Execute(
+				"SELECT COUNT(*) FROM "+node.client.Datastore().GetTableName(tableName),
+			).Error, node.name)
+		}
+	}
+
+	t.Cleanup(func() {
+		// The cachestore is shared, it is closed once every instance is closed (and done with its lookups)
+		for _, node := range nodes {
+			_ = node.client.Close(context.Background())
+		}
+		cacheStore.Close(context.Background())
+	})
+	return ctx, nodes
+}
+
+// recordDeferredBroadcast will record a new transaction on the node (the broadcast is left to the cron task)
+func recordDeferredBroadcast(ctx context.Context, t *testing.T, node *clusterNode) *Transaction {
+	fixtures := NewFixtures(t, node.client).WithXpub(0).WithUtxos(10000).WithDraft(&TransactionConfig{
+		Outputs: []*TransactionOutput{{
+			To:       testExternalAddress,
+			Satoshis: 1000,
+		}},
+		Sync: &SyncConfig{Broadcast: true, BroadcastInstant: false},
+	})
+	signedHex, err := fixtures.Drafts[0].SignInputs(fixtures.HDKey)
+	require.NoError(t, err)
+
+	var transaction *Transaction
+	transaction, err = node.client.RecordTransaction(ctx, fixtures.RawXpub, signedHex, fixtures.Drafts[0].ID)
+	require.NoError(t, err)
+	return transaction
+}
+
+// TestCluster_broadcastTask will test the broadcast (cron task) of a transaction recorded on another instance
+func TestCluster_broadcastTask(t *testing.T) {
+	ctx, nodes := newTestCluster(t, 2)
+	nodeA, nodeB := nodes[0], nodes[1]
+
+	transaction := recordDeferredBroadcast(ctx, t, nodeA)
+	assert.Empty(t, nodeA.chainstate.Broadcasts())
+
+	// The task runs on the other instance
+	require.NoError(t, taskBroadcastTransactions(
+		ctx, zLogger.NewGormLogger(false, 4), nodeB.client.DefaultModelOptions()...,
+	))
+	assert.Equal(t, []string{transaction.ID}, nodeB.chainstate.Broadcasts())
+
+	// The record is seen by all the instances
+	syncTx, err := GetSyncTransactionByID(ctx, transaction.ID, nodeA.client.DefaultModelOptions()...)
+	require.NoError(t, err)
+	assert.Equal(t, SyncStatusSeen, syncTx.BroadcastStatus)
+
+	// The next run (on any instance) does not broadcast it again
+	require.NoError(t, taskBroadcastTransactions(
+		ctx, zLogger.NewGormLogger(false, 4), nodeA.client.DefaultModelOptions()...,
+	))
+	assert.Empty(t, nodeA.chainstate.Broadcasts())
+	assert.Len(t, nodeB.chainstate.Broadcasts(), 1)
+}
+
+// TestCluster_cacheLocks will test the cache locks between the instances
+func TestCluster_cacheLocks(t *testing.T) {
+	ctx, nodes := newTestCluster(t, 2)
+	nodeA, nodeB := nodes[0], nodes[1]
+
+	t.Run("lock is exclusive", func(t *testing.T) {
+		lockKey := fmt.Sprintf(lockKeyProcessXpub, testXPubID)
+		unlock, err := newWriteLock(ctx, lockKey, nodeA.client.Cachestore())
+		require.NoError(t, err)
+
+		_, err = newWriteLock(ctx, lockKey, nodeB.client.Cachestore())
+		require.Error(t, err)
+
+		// Released by the owner
+		unlock()
+		var unlockB func()
+		unlockB, err = newWriteLock(ctx, lockKey, nodeB.client.Cachestore())
+		require.NoError(t, err)
+		unlockB()
+	})
+
+	t.Run("locked transaction is not broadcast", func(t *testing.T) {
+		transaction := recordDeferredBroadcast(ctx, t, nodeA)
+
+		// The transaction is being processed by the first instance
+		unlock, err := newWriteLock(
+			ctx, fmt.Sprintf(lockKeyProcessBroadcastTx, transaction.ID), nodeA.client.Cachestore(),
+		)
+		require.NoError(t, err)
+
+		var syncTx *SyncTransaction
+		syncTx, err = GetSyncTransactionByID(ctx, transaction.ID, nodeB.client.DefaultModelOptions()...)
+		require.NoError(t, err)
+		require.Error(t, processBroadcastTransaction(ctx, syncTx))
+		assert.Empty(t, nodeB.chainstate.Broadcasts())
+
+		// Processed once the lock is released
+		unlock()
+		require.NoError(t, processBroadcastTransaction(ctx, syncTx))
+		assert.Equal(t, []string{transaction.ID}, nodeB.chainstate.Broadcasts())
+	})
+}
+
+// TestCluster_leaderElection will test the leader election (lease) between the instances
+func TestCluster_leaderElection(t *testing.T) {
+	ctx, nodes := newTestCluster(t, 2)
+	lockKey := fmt.Sprintf(lockKeyMonitorLockID, "cluster-test")
+
+	// Every instance campaigns in a loop (like loadMonitor), the current leader is tracked
+	var mu sync.Mutex
+	leaders := make(map[string]bool)
+	isLeader := func(name string) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return leaders[name]
+	}
+	countLeaders := func() (count int) {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, leader := range leaders {
+			if leader {
+				count++
+			}
+		}
+		return
+	}
+
+	stops := make(map[string]context.CancelFunc)
+	for _, node := range nodes {
+		leader := newClusterLeader(node.client.Cachestore(), lockKey, node.name, testClusterLeaseTTL)
+		campaignCtx, cancel := context.WithCancel(ctx)
+		stops[node.name] = cancel
+
+		go func(ctx context.Context, leader *clusterLeader, name string) {
+			ticker := time.NewTicker(200 * time.Millisecond)
+			defer ticker.Stop()
+			for {
+				elected, _ := leader.campaign(ctx)
+				mu.Lock()
+				leaders[name] = elected
+				mu.Unlock()
+
+				select {
+				case <-ctx.Done(): // Killed (the lease is not released)
+					mu.Lock()
+					leaders[name] = false
+					mu.Unlock()
+					return
+				case <-ticker.C:
+				}
+			}
+		}(campaignCtx, leader, node.name)
+	}
+	t.Cleanup(func() {
+		for _, stop := range stops {
+			stop()
+		}
+	})
+
+	// Exactly one leader
+	require.Eventually(t, func() bool { return countLeaders() == 1 }, 2*time.Second, 50*time.Millisecond)
+	var leaderName, followerName string
+	for _, node := range nodes {
+		if isLeader(node.name) {
+			leaderName = node.name
+		} else {
+			followerName = node.name
+		}
+	}
+
+	// The leader keeps the lease (renewed) past the lease period
+	time.Sleep((testClusterLeaseTTL + 1) * time.Second)
+	assert.True(t, isLeader(leaderName))
+	assert.False(t, isLeader(followerName))
+
+	// Kill the leader, the other instance takes over when the lease expires
+	killedAt := time.Now()
+	stops[leaderName]()
+	require.Eventually(t, func() bool {
+		return isLeader(followerName)
+	}, (testClusterLeaseTTL+1)*time.Second, 50*time.Millisecond)
+	assert.Less(t, time.Since(killedAt), (testClusterLeaseTTL+1)*time.Second)
+	assert.Equal(t, 1, countLeaders())
+}
+
+// TestCluster_datastore will test that the records are shared between the instances
+func TestCluster_datastore(t *testing.T) {
+	ctx, nodes := newTestCluster(t, 2)
+
+	fixtures := NewFixtures(t, nodes[0].client).WithXpub(0)
+	xPub, err := nodes[1].client.GetXpubByID(ctx, fixtures.Xpub.ID)
+	require.NoError(t, err)
+	assert.Equal(t, fixtures.Xpub.ID, xPub.ID)
+}
@@ -0,0 +1,245 @@
+package bux
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"sort"
+
+	"github.com/BuxOrg/bux/utils"
+)
+
+// ConfigSummary is a snapshot of the effective options of the client (secrets are never included)
+//
+// Compare the Hash of two instances to quickly check whether they run with the same options
+type ConfigSummary struct {
+	AdminLookups            bool                      `json:"admin_lookups"`
+	AuditLogSigned          bool                      `json:"audit_log_signed"` // The key itself is never included
+	BalanceAlertMargin      uint64                    `json:"balance_alert_margin"`
+	BalanceCheckpoints      bool                      `json:"balance_checkpoints"`
+	Cachestore              CachestoreSummary         `json:"cachestore"`
+	Chainstate              ChainstateSummary         `json:"chainstate"`
+	ClusterCoordinated      bool                      `json:"cluster_coordinated"`
+	Datastore               DatastoreSummary          `json:"datastore"`
+	Debug                   bool                      `json:"debug"`
+	DerivationPrefix        string                    `json:"derivation_prefix"`
+	DraftExpiryWarning      string                    `json:"draft_expiry_warning"`
+	DraftMetadata           string                    `json:"draft_metadata_policy"`
+	EncryptionKeySet        bool                      `json:"encryption_key_set"` // The key itself is never included
+	FeeCalculator           string                    `json:"fee_calculator"`     // Name of the calculator of the draft fees
+	FiatCurrency            string                    `json:"fiat_currency"`      // Empty if there is no exchange rate provider
+	Hash                    string                    `json:"hash"`               // Hash of the rest of the summary
+	IdentityKeySet          bool                      `json:"identity_key_set"`   // The key itself is never included
+	ImportBlockHeadersURL   string                    `json:"import_block_headers_url"`
+	IncomingLimits          IncomingTransactionLimits `json:"incoming_limits"`
+	InstanceID              string                    `json:"instance_id"`
+	ITC                     bool                      `json:"itc"`
+	IUC                     bool                      `json:"iuc"`
+	MaxUnconfirmedChain     uint32                    `json:"max_unconfirmed_chain"`
+	MetadataLimits          MetadataLimits            `json:"metadata_limits"`
+	MonitorCatchUp          bool                      `json:"monitor_catch_up"`
+	MonitorMinimum          uint64                    `json:"monitor_minimum_satoshis"`
+	MonitorQueueDepth       int                       `json:"monitor_queue_depth"`
+	MonitorQueueWorkers     int                       `json:"monitor_queue_workers"`
+	MutedNotifications      string                    `json:"muted_notifications_mode"`
+	NewRelic                bool                      `json:"new_relic"`
+	NotificationDeadLetters string                    `json:"notification_dead_letter_retention"`
+	NotificationRetention   string                    `json:"notification_retention"`
+	Notifications           string                    `json:"notifications_webhook"`
+	Paymail                 PaymailSummary            `json:"paymail"`
+	PreBroadcastCheck       bool                      `json:"pre_broadcast_validation"`
+	Reconciliation          bool                      `json:"reconciliation"`
+	StartupValidation       bool                      `json:"startup_validation"`
+	SyncQueueCacheTTL       string                    `json:"sync_queue_cache_ttl"`
+	SyncQueueWarning        int64                     `json:"sync_queue_warning_threshold"`
+	TaskManager             TaskSummary               `json:"task_manager"`
+	UserAgent               string                    `json:"user_agent"`
+}
+
+// CachestoreSummary is the summary of the cachestore options
+type CachestoreSummary struct {
+	Engine            string            `json:"engine"`
+	LocalLockFallback bool              `json:"local_lock_fallback"`
+	ModelTTLs         map[string]string `json:"model_ttls"` // Model name -> TTL (0s = not cached)
+}
+
+// ChainstateSummary is the summary of the chainstate options (default sync config of the transactions)
+type ChainstateSummary struct {
+	Broadcasting           bool   `json:"broadcasting"`
+	BroadcastHighWaterMark int    `json:"broadcast_high_water_mark"`
+	BroadcastInstant       bool   `json:"broadcast_instant"`
+	InstantMode            string `json:"instant_broadcast_mode"`
+	Monitor                bool   `json:"monitor"`
+	Network                string `json:"network"`
+	PaymailP2P             bool   `json:"paymail_p2p"`
+	SyncOnChain            bool   `json:"sync_on_chain"`
+}
+
+// DatastoreSummary is the summary of the datastore options (no DSN or credentials)
+type DatastoreSummary struct {
+	Engine            string `json:"engine"`
+	MigrationDisabled bool   `json:"migration_disabled"`
+	SchemaCheck       string `json:"schema_check"`
+	VersionIndexes    bool   `json:"version_indexes"`
+}
+
+// PaymailSummary is the summary of the paymail options
+type PaymailSummary struct {
+	ActivationWindow     string   `json:"activation_window"`
+	BeefFallbackToBasic  bool     `json:"beef_fallback_to_basic"`
+	BeefMaxAncestryDepth int      `json:"beef_max_ancestry_depth"`
+	BeefMaxAncestryTxs   int      `json:"beef_max_ancestry_txs"`
+	DefaultFromPaymail   string   `json:"default_from_paymail"`
+	DomainAllowList      []string `json:"domain_allow_list"`
+	DomainDenyList       []string `json:"domain_deny_list"`
+	Domains              []string `json:"domains"`
+	P2PFailureLimit      uint32   `json:"p2p_failure_limit"`
+	P2PMaxPayloadSize    int      `json:"p2p_max_payload_size"`
+	SenderValidation     bool     `json:"sender_validation"`
+}
+
+// TaskSummary is the summary of the task manager options
+type TaskSummary struct {
+	CronTasks map[string]string `json:"cron_tasks"` // Task name -> period
+	Engine    string            `json:"engine"`
+	Factory   string            `json:"factory"`
+}
+
+// ConfigSummary will return a snapshot of the effective options of the client (secrets are never included)
+func (c *Client) ConfigSummary() *ConfigSummary {
+	o := c.options
+	summary := &ConfigSummary{
+		AdminLookups:       o.adminLookups,
+		AuditLogSigned:     len(o.auditSigningKey) > 0,
+		BalanceAlertMargin: o.balanceAlertMargin,
+		BalanceCheckpoints: o.balanceCheckpoints,
+		Cachestore: CachestoreSummary{
+			LocalLockFallback: o.cacheStore.localLockFallback,
+		},
+		Chainstate: ChainstateSummary{
+			Broadcasting:           o.chainstate.broadcasting,
+			BroadcastHighWaterMark: o.chainstate.broadcastHighWaterMark,
+			BroadcastInstant:       o.chainstate.broadcastInstant,
+			InstantMode:            string(o.chainstate.instantBroadcastMode),
+			Network:                string(getClientNetwork(c)),
+			PaymailP2P:             o.chainstate.paymailP2P,
+			SyncOnChain:            o.chainstate.syncOnChain,
+		},
+		ClusterCoordinated: o.cluster.coordinated,
+		Datastore: DatastoreSummary{
+			MigrationDisabled: o.dataStore.migrationDisabled,
+			SchemaCheck:       string(o.dataStore.schemaCheck),
+			VersionIndexes:    o.dataStore.versionIndexes,
+		},
+		Debug:                   o.debug,
+		DerivationPrefix:        o.derivationPrefix,
+		DraftExpiryWarning:      o.draftExpiryWarning.String(),
+		DraftMetadata:           string(o.draftMetadata),
+		EncryptionKeySet:        len(o.encryptionKey) > 0,
+		FeeCalculator:           feeCalculatorName(o.feeCalculator),
+		IdentityKeySet:          len(o.identityKey) > 0,
+		ImportBlockHeadersURL:   redactURL(o.importBlockHeadersURL),
+		IncomingLimits:          *o.incomingLimits,
+		InstanceID:              o.instanceID,
+		ITC:                     o.itc,
+		IUC:                     o.iuc,
+		MaxUnconfirmedChain:     o.maxUnconfirmedChain,
+		MetadataLimits:          *o.metadataLimits,
+		MonitorCatchUp:          o.monitorCatchUp.provider != nil,
+		MonitorMinimum:          o.monitorFilter.minimumSatoshis,
+		MonitorQueueDepth:       o.monitorQueue.depth,
+		MonitorQueueWorkers:     o.monitorQueue.workers,
+		MutedNotifications:      string(o.notifications.mutedMode),
+		NewRelic:                o.newRelic.enabled,
+		NotificationDeadLetters: o.notifications.deadLetterRetention.String(),
+		NotificationRetention:   o.notifications.retention.String(),
+		Notifications:           redactURL(o.notifications.webhookEndpoint),
+		Paymail: PaymailSummary{
+			ActivationWindow:     o.paymail.activation.String(),
+			BeefFallbackToBasic:  o.paymail.serverConfig.BeefFallbackToBasic,
+			BeefMaxAncestryDepth: o.paymail.serverConfig.BeefMaxAncestryDepth,
+			BeefMaxAncestryTxs:   o.paymail.serverConfig.BeefMaxAncestryTxs,
+			DefaultFromPaymail:   o.paymail.serverConfig.DefaultFromPaymail,
+			P2PFailureLimit:      o.paymail.p2pFailures,
+			P2PMaxPayloadSize:    o.paymail.p2pMaxSize,
+		},
+		PreBroadcastCheck: o.preBroadcastCheck,
+		Reconciliation:    o.reconcile.provider != nil,
+		StartupValidation: o.startupValidation.enabled,
+		SyncQueueCacheTTL: o.syncQueue.cacheTTL.String(),
+		SyncQueueWarning:  o.syncQueue.warningThreshold,
+		TaskManager:       TaskSummary{CronTasks: make(map[string]string, len(o.taskManager.cronTasks))},
+		UserAgent:         o.userAgent,
+	}
+
+	// Engines of the loaded services
+	if cs := c.Cachestore(); cs != nil {
+		summary.Cachestore.Engine = cs.Engine().String()
+	}
+	if ds := c.Datastore(); ds != nil {
+		summary.Datastore.Engine = ds.Engine().String()
+	}
+	if chainState := c.Chainstate(); chainState != nil {
+		summary.Chainstate.Monitor = chainState.Monitor() != nil
+	}
+	if tm := c.Taskmanager(); tm != nil {
+		summary.TaskManager.Engine = tm.Engine().String()
+		summary.TaskManager.Factory = tm.Factory().String()
+	}
+	for name, period := range o.taskManager.cronTasks {
+		summary.TaskManager.CronTasks[name] = period.String()
+	}
+	summary.Cachestore.ModelTTLs = make(map[string]string, len(o.modelCache.ttls))
+	for name, ttl := range o.modelCache.ttls {
+		summary.Cachestore.ModelTTLs[name] = ttl.String()
+	}
+
+	// Fiat display values (the no-op provider stamps nothing)
+	if _, noop := o.exchangeRates.provider.(noopExchangeRateProvider); !noop {
+		summary.FiatCurrency = o.exchangeRates.currency
+	}
+
+	// Paymail domains (served and the outgoing policy)
+	summary.Paymail.DomainAllowList, summary.Paymail.DomainDenyList = o.paymail.domainPolicy.lists()
+	if config := o.paymail.serverConfig.Configuration; config != nil {
+		for _, domain := range config.PaymailDomains {
+			summary.Paymail.Domains = append(summary.Paymail.Domains, domain.Name)
+		}
+		sort.Strings(summary.Paymail.Domains)
+		summary.Paymail.SenderValidation = config.SenderValidationEnabled
+	}
+
+	summary.Hash = summary.hash()
+	return summary
+}
+
+// hash will return a stable hash of the summary (without the hash and the instance fields)
+func (s ConfigSummary) hash() string {
+	s.Hash = ""
+	s.InstanceID = ""
+	data, _ := json.Marshal(s) // map keys are sorted
+	return utils.Hash(string(data))
+}
+
+// redactURL will only keep the scheme and host of the URL (no credentials, path or query tokens)
+func redactURL(rawURL string) string {
+	if len(rawURL) == 0 {
+		return ""
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil || len(u.Host) == 0 {
+		return "[redacted]"
+	}
+	return u.Scheme + "://" + u.Host
+}
+
+// logConfigSummary will log the config summary (once, at the end of NewClient)
+func (c *Client) logConfigSummary(ctx context.Context) {
+	summary := c.ConfigSummary()
+	data, err := json.Marshal(summary)
+	if err != nil {
+		c.Logger().Error(ctx, "failed to serialize the config summary: "+err.Error())
+		return
+	}
+	c.Logger().Info(ctx, "[CONFIG] bux client config "+summary.Hash+": "+string(data))
+}
@@ -6,22 +6,52 @@ import (
 
 // Defaults for engine functionality
 const (
-	changeOutputSize               = uint64(35)       // Average size in bytes of a change output
-	databaseLongReadTimeout        = 30 * time.Second // For all "GET" or "SELECT" methods
-	defaultBroadcastTimeout        = 25 * time.Second // Default timeout for broadcasting
-	defaultCacheLockTTL            = 20               // in Seconds
-	defaultCacheLockTTW            = 10               // in Seconds
-	defaultDatabaseReadTimeout     = 20 * time.Second // For all "GET" or "SELECT" methods
-	defaultDraftTxExpiresIn        = 20 * time.Second // Default TTL for draft transactions
-	defaultHTTPTimeout             = 20 * time.Second // Default timeout for HTTP requests
-	defaultMonitorHeartbeat        = 60               // in Seconds (heartbeat for active monitor)
+	changeOutputSize               = uint64(35)             // Average size in bytes of a change output
+	defaultBailSaveRetries         = 3                      // Retries of a failed save of a bailed sync transaction
+	defaultBailSaveRetryDelay      = 250 * time.Millisecond // Delay before the first retry (increased on each retry)
+	defaultBeefMaxAncestryDepth    = 25                     // Max depth of unconfirmed ancestors gathered for a BEEF payload
+	defaultBeefMaxAncestryTxs      = 500                    // Max number of ancestor transactions in a BEEF payload
+	databaseLongReadTimeout        = 30 * time.Second       // For all "GET" or "SELECT" methods
+	defaultBroadcastHighWaterMark  = 1000                   // Max number of records in flight in the broadcast task
+	defaultBroadcastMaxRecords     = 1000                   // Max number of ready records dispatched per run of the broadcast task
+	defaultBroadcastPageSize       = 100                    // Number of ready records loaded per page by the broadcast task
+	defaultBroadcastTimeout        = 25 * time.Second       // Default timeout for broadcasting
+	defaultCacheLockTTL            = 20                     // in Seconds
+	defaultCacheLockTTW            = 10                     // in Seconds
+	defaultCancelDraftTimeout      = 20 * time.Second       // Max duration of the cancellation of a draft that failed to be signed or recorded
+	defaultDatabaseReadTimeout     = 20 * time.Second       // For all "GET" or "SELECT" methods
+	defaultDerivationPrefix        = "m"                    // Default derivation path of the xPub (relative to the xPub)
+	defaultDestinationIndexRetries = 5                      // Max retries for a new destination when the chain/num is already used
+	defaultDraftTxExpiresIn        = 20 * time.Second       // Default TTL for draft transactions
+	defaultHTTPTimeout             = 20 * time.Second       // Default timeout for HTTP requests
+	defaultIncomingMaxInputs       = 100000                 // Max number of inputs of an incoming transaction
+	defaultIncomingMaxOutputs      = 100000                 // Max number of outputs of an incoming transaction
+	defaultIncomingMaxScriptSize   = 10000000               // Max size (bytes) of a script of an incoming transaction
+	defaultIncomingMaxSize         = 100000000              // Max size (bytes) of an incoming transaction
+	defaultIncomingRejectNotifiers = 10                     // Max number of rejection notifications delivered at once
+	defaultIncomingRejectTimeout   = 20 * time.Second       // Max duration of the delivery of a rejection notification
+	defaultInstantBroadcastTimeout = 60 * time.Second       // Max duration of an asynchronous instant broadcast (InstantBroadcastAsync)
+	defaultMetadataMaxKeys         = 1000                   // Max number of keys of the metadata of a model
+	defaultMetadataMaxSize         = 1048576                // Max size (bytes) of the serialized metadata of a model
+	defaultMetadataMaxValueSize    = 262144                 // Max size (bytes) of a serialized metadata value
+	defaultMonitorHeartbeat        = 60                     // in Seconds (heartbeat for active monitor)
+	defaultMonitorQueueDepth       = 1000                   // Max number of queued monitor events (the reader is blocked when full)
 	defaultMonitorSleep            = 2 * time.Second
-	defaultMonitorLockTTL          = 10                // in seconds - should be larger than defaultMonitorSleep
-	defaultOverheadSize            = uint64(8)         // 8 bytes is the default overhead in a transaction = 4 bytes version + 4 bytes nLockTime
-	defaultQueryTxTimeout          = 10 * time.Second  // Default timeout for syncing on-chain information
-	defaultSleepForNewBlockHeaders = 30 * time.Second  // Default wait before checking for a new unprocessed block
-	defaultUserAgent               = "bux: " + version // Default user agent
-	dustLimit                      = uint64(1)         // Dust limit
+	defaultNotificationRetention   = 7 * 24 * time.Hour     // Default retention of the notification delivery receipts
+	defaultDeadLetterRetention     = 30 * 24 * time.Hour    // Default retention of the dead-lettered notification events
+	defaultMonitorLockTTL          = 10                     // in seconds - should be larger than defaultMonitorSleep
+	defaultOverheadSize            = uint64(8)              // 8 bytes is the default overhead in a transaction = 4 bytes version + 4 bytes nLockTime
+	defaultQueryTxTimeout          = 10 * time.Second       // Default timeout for syncing on-chain information
+	defaultReconcileBatchSize      = 20                     // Locking scripts per request of the reconciliation provider
+	defaultReconcileDestinations   = 30 * 24 * time.Hour    // Window of the recent destinations checked by the reconciliation
+	defaultReconcileInterval       = 100 * time.Millisecond // Min delay between the requests of the reconciliation provider
+	defaultReconcilePageSize       = 1000                   // Utxos (and destinations) loaded per page by the reconciliation
+	defaultReconcilePhantomAge     = 24 * time.Hour         // Min age of a phantom utxo frozen by the reconciliation (not indexed yet)
+	defaultSleepForNewBlockHeaders = 30 * time.Second       // Default wait before checking for a new unprocessed block
+	defaultStaleModelRetries       = 3                      // Max reloads of a stale (versioned) model before giving up
+	defaultUserAgent               = "bux: " + version      // Default user agent
+	dustLimit                      = uint64(1)              // Dust limit
+	maxInstanceIDLength            = 64                     // Max length of the instance identifier (see WithInstanceID)
 	//mongoTestVersion               = "4.2.1"           // Mongo Testing Version
 	mongoTestVersion  = "6.0.4"   // Mongo Testing Version
 	sqliteTestVersion = "3.37.0"  // SQLite Testing Version (dummy version for now)
@@ -30,8 +60,12 @@ const (
 
 // Defaults for task cron jobs (tasks)
 const (
+	taskIntervalBalanceCheckpoints  = 24 * time.Hour                        // Default task time for cron jobs (seconds)
+	taskIntervalBlockHeaderSync     = 60 * time.Second                      // Default task time for cron jobs (seconds)
 	taskIntervalDraftCleanup        = 60 * time.Second                      // Default task time for cron jobs (seconds)
 	taskIntervalMonitorCheck        = defaultMonitorHeartbeat * time.Second // Default task time for cron jobs (seconds)
+	taskIntervalNotificationCleanup = 60 * time.Minute                      // Default task time for cron jobs (seconds)
+	taskIntervalPaymailCleanup      = 10 * time.Minute                      // Default task time for cron jobs (seconds)
 	taskIntervalProcessIncomingTxs  = 30 * time.Second                      // Default task time for cron jobs (seconds)
 	taskIntervalSyncActionBroadcast = 30 * time.Second                      // Default task time for cron jobs (seconds)
 	taskIntervalSyncActionP2P       = 35 * time.Second                      // Default task time for cron jobs (seconds)
@@ -41,32 +75,48 @@ const (
 
 // All the base models
 const (
-	ModelAccessKey           ModelName = "access_key"
-	ModelBlockHeader         ModelName = "block_header"
-	ModelDestination         ModelName = "destination"
-	ModelDraftTransaction    ModelName = "draft_transaction"
-	ModelIncomingTransaction ModelName = "incoming_transaction"
-	ModelMetadata            ModelName = "metadata"
-	ModelNameEmpty           ModelName = "empty"
-	ModelPaymailAddress      ModelName = "paymail_address"
-	ModelSyncTransaction     ModelName = "sync_transaction"
-	ModelTransaction         ModelName = "transaction"
-	ModelUtxo                ModelName = "utxo"
-	ModelXPub                ModelName = "xpub"
+	ModelAccessKey            ModelName = "access_key"
+	ModelAuditLog             ModelName = "audit_log"
+	ModelBalanceCheckpoint    ModelName = "balance_checkpoint"
+	ModelBalanceEvent         ModelName = "balance_event"
+	ModelBlockHeader          ModelName = "block_header"
+	ModelBroadcastReceipt     ModelName = "broadcast_receipt"
+	ModelDestination          ModelName = "destination"
+	ModelDraftTransaction     ModelName = "draft_transaction"
+	ModelIncomingTransaction  ModelName = "incoming_transaction"
+	ModelMetadata             ModelName = "metadata"
+	ModelNameEmpty            ModelName = "empty"
+	ModelNotificationDelivery ModelName = "notification_delivery"
+	ModelPaymailAddress       ModelName = "paymail_address"
+	ModelSchemaVersion        ModelName = "schema_version"
+	ModelSetting              ModelName = "setting"
+	ModelSyncTransaction      ModelName = "sync_transaction"
+	ModelTransaction          ModelName = "transaction"
+	ModelTransactionNote      ModelName = "transaction_note"
+	ModelUtxo                 ModelName = "utxo"
+	ModelXPub                 ModelName = "xpub"
 )
 
 var (
 	// AllModelNames is a list of all models
 	AllModelNames = []ModelName{
 		ModelAccessKey,
+		ModelAuditLog,
+		ModelBalanceCheckpoint,
+		ModelBalanceEvent,
 		ModelBlockHeader,
+		ModelBroadcastReceipt,
 		ModelDestination,
 		ModelIncomingTransaction,
 		ModelMetadata,
+		ModelNotificationDelivery,
 		ModelPaymailAddress,
 		ModelPaymailAddress,
+		ModelSchemaVersion,
+		ModelSetting,
 		ModelSyncTransaction,
 		ModelTransaction,
+		ModelTransactionNote,
 		ModelUtxo,
 		ModelXPub,
 	}
@@ -74,16 +124,24 @@ var (
 
 // Internal table names
 const (
-	tableAccessKeys           = "access_keys"
-	tableBlockHeaders         = "block_headers"
-	tableDestinations         = "destinations"
-	tableDraftTransactions    = "draft_transactions"
-	tableIncomingTransactions = "incoming_transactions"
-	tablePaymailAddresses     = "paymail_addresses"
-	tableSyncTransactions     = "sync_transactions"
-	tableTransactions         = "transactions"
-	tableUTXOs                = "utxos"
-	tableXPubs                = "xpubs"
+	tableAccessKeys             = "access_keys"
+	tableAuditLogs              = "audit_logs"
+	tableBalanceCheckpoints     = "balance_checkpoints"
+	tableBalanceEvents          = "balance_events"
+	tableBlockHeaders           = "block_headers"
+	tableBroadcastReceipts      = "broadcast_receipts"
+	tableDestinations           = "destinations"
+	tableDraftTransactions      = "draft_transactions"
+	tableIncomingTransactions   = "incoming_transactions"
+	tableNotificationDeliveries = "notification_deliveries"
+	tablePaymailAddresses       = "paymail_addresses"
+	tableSchemaVersions         = "schema_versions"
+	tableSettings               = "settings"
+	tableSyncTransactions       = "sync_transactions"
+	tableTransactionNotes       = "transaction_notes"
+	tableTransactions           = "transactions"
+	tableUTXOs                  = "utxos"
+	tableXPubs                  = "xpubs"
 )
 
 const (
@@ -91,26 +149,56 @@ const (
 	ReferenceIDField = "reference_id"
 
 	// Internal field names
-	aliasField           = "alias"
-	broadcastStatusField = "broadcast_status"
-	createdAtField       = "created_at"
-	currentBalanceField  = "current_balance"
-	domainField          = "domain"
-	draftIDField         = "draft_id"
-	idField              = "id"
-	metadataField        = "metadata"
-	nextExternalNumField = "next_external_num"
-	nextInternalNumField = "next_internal_num"
-	p2pStatusField       = "p2p_status"
-	satoshisField        = "satoshis"
-	spendingTxIDField    = "spending_tx_id"
-	statusField          = "status"
-	syncStatusField      = "sync_status"
-	typeField            = "type"
-	xPubIDField          = "xpub_id"
-	xPubMetadataField    = "xpub_metadata"
-	blockHeightField     = "block_height"
-	blockHashField       = "block_hash"
+	activationExpiresAtField = "activation_expires_at"
+	aliasField               = "alias"
+	balanceAlertStateField   = "balance_alert_state"
+	basedOnField             = "based_on"
+	broadcastStatusField     = "broadcast_status"
+	chainField               = "chain"
+	checkpointAtField        = "checkpoint_at"
+	confirmedBalanceField    = "confirmed_balance"
+	createdAtField           = "created_at"
+	createdByVersionField    = "created_by_version"
+	currentBalanceField      = "current_balance"
+	deadLetteredAtField      = "dead_lettered_at"
+	deliveredAtField         = "delivered_at"
+	domainField              = "domain"
+	draftIDField             = "draft_id"
+	expiresAtField           = "expires_at"
+	expiryWarnedField        = "expiry_warned"
+	frozenField              = "frozen"
+	fullDerivationPathField  = "full_derivation_path"
+	heightField              = "height"
+	idField                  = "id"
+	metadataField            = "metadata"
+	minedAtField             = "mined_at"
+	modelIDField             = "model_id"
+	mutedField               = "muted"
+	nextExternalNumField     = "next_external_num"
+	nextInternalNumField     = "next_internal_num"
+	numField                 = "num"
+	p2pFailuresField         = "p2p_failures"
+	p2pStatusField           = "p2p_status"
+	reservedAtField          = "reserved_at"
+	reservedTillField        = "reserved_till"
+	revokedAtField           = "revoked_at"
+	satoshisField            = "satoshis"
+	scriptPubKeyField        = "script_pub_key"
+	sequenceField            = "sequence"
+	spendingTxIDField        = "spending_tx_id"
+	statusField              = "status"
+	syncStatusField          = "sync_status"
+	transactionIDField       = "transaction_id"
+	txIDField                = "tx_id"
+	typeField                = "type"
+	unconfirmedBalanceField  = "unconfirmed_balance"
+	updatedAtField           = "updated_at"
+	updatedByVersionField    = "updated_by_version"
+	versionField             = "version"
+	xPubIDField              = "xpub_id"
+	xPubMetadataField        = "xpub_metadata"
+	blockHeightField         = "block_height"
+	blockHashField           = "block_hash"
 
 	// Universal statuses
 	statusCanceled   = "canceled"
@@ -121,24 +209,80 @@ const (
 	statusPending    = "pending"
 	statusProcessing = "processing"
 	statusReady      = "ready"
+	statusSeen       = "seen"
 	statusSkipped    = "skipped"
 
 	// Paymail / Handles
-	cacheKeyAddressResolution       = "paymail-address-resolution-"
-	cacheKeyCapabilities            = "paymail-capabilities-"
-	cacheTTLAddressResolution       = 2 * time.Minute
-	cacheTTLCapabilities            = 60 * time.Minute
-	defaultAddressResolutionPurpose = "Created with BUX: getbux.io"
-	defaultSenderPaymail            = "buxorg@moneybutton.com"
-	handleHandcashPrefix            = "$"
-	handleMaxLength                 = 25
-	handleRelayPrefix               = "1"
-	p2pMetadataField                = "p2p_tx_metadata"
+	cacheKeyAddressResolution         = "paymail-address-resolution-"
+	cacheKeyCapabilities              = "paymail-capabilities-"
+	cacheTTLAddressResolution         = 2 * time.Minute
+	cacheTTLCapabilities              = 60 * time.Minute
+	defaultAddressResolutionPurpose   = "Created with BUX: getbux.io"
+	defaultPaymailAliasCharacters     = "a-z0-9._-"
+	defaultPaymailAliasMaxLength      = 64
+	defaultPaymailAliasMinLength      = 1
+	defaultPaymailAvatarMaxLength     = 2048
+	defaultPaymailAvatarTimeout       = 5 * time.Second  // Verification of the avatar content type
+	defaultPaymailBackoff             = 30 * time.Second // Rate limited without a Retry-After header
+	defaultPaymailHTTPTimeout         = 20 * time.Second // Same as go-paymail
+	defaultPaymailPublicNameMaxLength = 255
+	defaultPaymailRetryCount          = 2 // Same as go-paymail
+	defaultSenderPaymail              = "buxorg@moneybutton.com"
+	handleHandcashPrefix              = "$"
+	handleMaxLength                   = 25
+	handleRelayPrefix                 = "1"
+	p2pMetadataField                  = "p2p_tx_metadata"
+	paymailProviderPrefix             = "paymail:"
+
+	// Rate limited providers
+	cacheKeyProviderBackoff = "provider-backoff-"
+
+	// Raw transactions fetched from the chainstate providers
+	cacheKeyRawTransaction        = "raw-transaction-"
+	defaultRawTransactionCacheTTL = 24 * time.Hour
+
+	// Failing P2P receive endpoints (escalating backoff, see recordP2PEndpointFailure)
+	cacheKeyP2PEndpointHealth = "p2p-endpoint-health-"
+	defaultP2PBackoffBase     = 1 * time.Minute // Backoff after the first failure (doubled on each failure)
+	defaultP2PBackoffMax      = 6 * time.Hour   // Max backoff of a failing endpoint
+	defaultP2PFailureLimit    = 20              // Failed notifications of a transaction before the P2P is marked as failed
+
+	// Balance threshold alerts (see SetXpubBalanceAlerts)
+	defaultBalanceAlertMargin = 10000 // Satoshis the balance recovers past a threshold before the alert fires again
+
+	// Block header sync
+	defaultBlockHeaderSyncBatchSize = 2000 // Headers requested at once
+	defaultBlockHeaderSyncMaxReorg  = 100  // Headers removed at the tip before the sync fails
+
+	// Transaction notes
+	defaultTransactionNoteMaxLength = 1024 // Characters
+
+	// Fiat display values (see WithExchangeRateProvider)
+	defaultExchangeRateCurrency = "USD"
+	defaultExchangeRateTimeout  = 5 * time.Second // Max wait for the rate when recording
 
 	// Misc
-	gormTypeText = "text"
-	migrateList  = "migrate"
-	modelList    = "models"
+	gormTypeText             = "text"
+	migrateList              = "migrate"
+	modelList                = "models"
+	balanceEventCallbackName = "bux:apply_balance_event" // gorm create callback (see registerBalanceEventCallback)
+	versionCallbackName      = "bux:claim_version"       // gorm update callback (see registerVersionCallback)
+
+	// Manual utxo reservations (synthetic draft id prefix)
+	manualReservationPrefix = "manual-reservation-"
+
+	// Startup validation
+	cacheKeyStartupValidation = "startup-validation-"
+	cacheTTLStartupValidation = 1 * time.Minute
+)
+
+// contextKey is the type for values set on the context
+type contextKey string
+
+// Context keys
+const (
+	contextKeyAuditActor        contextKey = "audit_actor"        // Actor of the audited operations (see WithAuditActor)
+	contextKeySkipNotifications contextKey = "skip_notifications" // Suppress the model notifications (events)
 )
 
 // Cache keys for model caching
@@ -147,6 +291,7 @@ const (
 	cacheKeyDestinationModelByAddress       = "destination-address-%s"        // model-address-<address>
 	cacheKeyDestinationModelByLockingScript = "destination-locking-script-%s" // model-locking-script-<script>
 	cacheKeyXpubModel                       = "xpub-id-%s"                    // model-id-<xpub_id>
+	destinationCacheKeySeparator            = ","                             // Separator of the evicted keys (cluster.DestinationUpdated)
 )
 
 var (
@@ -189,6 +334,11 @@ var (
 			Model: *NewBaseModel(ModelSyncTransaction),
 		},
 
+		// Response envelopes of the broadcast providers (proof of submission) (related to SyncTransaction)
+		&BroadcastReceipt{
+			Model: *NewBaseModel(ModelBroadcastReceipt),
+		},
+
 		// Various types of destinations (common is: P2PKH Address)
 		&Destination{
 			Model: *NewBaseModel(ModelDestination),
@@ -199,6 +349,31 @@ var (
 			Model: *NewBaseModel(ModelUtxo),
 		},
 
+		// Delivery receipts of the notification events (webhook)
+		&NotificationDelivery{
+			Model: *NewBaseModel(ModelNotificationDelivery),
+		},
+
+		// Changes of the balances of the xPubs (append-only)
+		&BalanceEvent{
+			Model: *NewBaseModel(ModelBalanceEvent),
+		},
+
+		// Notes (memos) of the xPubs on the transactions
+		&TransactionNote{
+			Model: *NewBaseModel(ModelTransactionNote),
+		},
+
+		// Settings changed at runtime (IE: the notifications webhook endpoint)
+		&Setting{
+			Model: *NewBaseModel(ModelSetting),
+		},
+
+		// Audit log of the mutating operations (append-only hash chain)
+		&AuditLog{
+			Model: *NewBaseModel(ModelAuditLog),
+		},
+
 		// Paymail addresses related to XPubs (automatically added when paymail is enabled)
 		/*&PaymailAddress{
 			Model: *NewBaseModel(ModelPaymailAddress),
@@ -0,0 +1,60 @@
+package bux
+
+// DraftMetadataPolicy is how the metadata of the draft cascades to the recorded transaction (see WithDraftMetadataPolicy)
+type DraftMetadataPolicy string
+
+// Policies of the draft metadata
+const (
+	// DraftMetadataOff does not cascade the metadata of the draft (default)
+	DraftMetadataOff DraftMetadataPolicy = "off"
+
+	// DraftMetadataMerge merges the metadata of the draft (the keys of the transaction take precedence)
+	DraftMetadataMerge DraftMetadataPolicy = "merge"
+
+	// DraftMetadataPrefix merges the metadata of the draft under prefixed keys (IE: draft_invoice)
+	DraftMetadataPrefix DraftMetadataPolicy = "prefix"
+)
+
+// Metadata keys of the draft metadata cascade
+const (
+	draftMetadataPrefix      = "draft_"
+	metadataKeyCorrelationID = "correlation_id" // ID of the draft (sync transactions)
+)
+
+// isValid will return true if the policy is known
+func (p DraftMetadataPolicy) isValid() bool {
+	return p == DraftMetadataOff || p == DraftMetadataMerge || p == DraftMetadataPrefix
+}
+
+// cascadeDraftMetadata will merge the metadata of the draft into the metadata of the transaction
+//
+// The reserved fiat keys of the draft (fiat_*) are not merged as-is, the transaction stamps its own rate
+func cascadeDraftMetadata(policy DraftMetadataPolicy, metadata, draftMetadata Metadata) Metadata {
+	if policy == DraftMetadataOff || len(draftMetadata) == 0 {
+		return metadata
+	}
+	if metadata == nil {
+		metadata = make(Metadata, len(draftMetadata))
+	}
+	for key, value := range draftMetadata {
+		if policy == DraftMetadataPrefix {
+			key = draftMetadataPrefix + key
+		} else if isFiatMetadataKey(key) {
+			continue
+		}
+		if _, ok := metadata[key]; !ok {
+			metadata[key] = value
+		}
+	}
+	return metadata
+}
+
+// syncMetadataWithCorrelationID will return a copy of the metadata with the correlation ID (the draft ID)
+func syncMetadataWithCorrelationID(metadata Metadata, draftID string) Metadata {
+	syncMetadata := make(Metadata, len(metadata)+1)
+	for key, value := range metadata {
+		syncMetadata[key] = value
+	}
+	syncMetadata[metadataKeyCorrelationID] = draftID
+	return syncMetadata
+}
@@ -0,0 +1,114 @@
+package bux
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test_cascadeDraftMetadata will test the method cascadeDraftMetadata()
+func Test_cascadeDraftMetadata(t *testing.T) {
+	t.Parallel()
+
+	draftMetadata := Metadata{"invoice": "inv-1", "note": "draft note", metadataKeyFiatFee: 0.01}
+
+	t.Run("off", func(t *testing.T) {
+		assert.Equal(t, Metadata{"note": "tx note"},
+			cascadeDraftMetadata(DraftMetadataOff, Metadata{"note": "tx note"}, draftMetadata))
+		assert.Nil(t, cascadeDraftMetadata(DraftMetadataOff, nil, draftMetadata))
+	})
+
+	t.Run("merge", func(t *testing.T) {
+		assert.Equal(t, Metadata{"invoice": "inv-1", "note": "tx note"},
+			cascadeDraftMetadata(DraftMetadataMerge, Metadata{"note": "tx note"}, draftMetadata))
+		assert.Equal(t, Metadata{"invoice": "inv-1", "note": "draft note"},
+			cascadeDraftMetadata(DraftMetadataMerge, nil, draftMetadata))
+	})
+
+	t.Run("prefix", func(t *testing.T) {
+		assert.Equal(t, Metadata{
+			"draft_invoice": "inv-1", "draft_note": "draft note", "draft_fiat_fee": 0.01, "note": "tx note",
+		}, cascadeDraftMetadata(DraftMetadataPrefix, Metadata{"note": "tx note"}, draftMetadata))
+	})
+
+	t.Run("no draft metadata", func(t *testing.T) {
+		assert.Nil(t, cascadeDraftMetadata(DraftMetadataMerge, nil, nil))
+	})
+}
+
+// TestWithDraftMetadataPolicy will test cascading the draft metadata when recording
+func TestWithDraftMetadataPolicy(t *testing.T) {
+	t.Parallel()
+
+	t.Run("check type", func(t *testing.T) {
+		assert.IsType(t, *new(ClientOps), WithDraftMetadataPolicy(DraftMetadataMerge))
+	})
+
+	t.Run("unknown policy is ignored", func(t *testing.T) {
+		options := defaultClientOptions()
+		WithDraftMetadataPolicy("unknown")(options)
+		assert.Equal(t, DraftMetadataOff, options.draftMetadata)
+	})
+
+	recordWithPolicy := func(t *testing.T, opts ...ClientOps) (*Transaction, *SyncTransaction) {
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, true,
+			append(opts, WithCustomTaskManager(&taskManagerMockBase{}), WithChainstateOptions(false, false, false, true))...,
+		)
+		t.Cleanup(deferMe)
+
+		fixtures := NewFixtures(t, client).WithXpub(0).WithUtxos(100000)
+		draft, err := client.NewTransaction(ctx, fixtures.RawXpub, &TransactionConfig{
+			Outputs: []*TransactionOutput{{To: testExternalAddress, Satoshis: 10000}},
+		}, WithMetadatas(map[string]interface{}{"invoice": "inv-1", "note": "draft note"}))
+		require.NoError(t, err)
+		var signedHex string
+		signedHex, err = draft.SignInputs(fixtures.HDKey)
+		require.NoError(t, err)
+
+		var transaction *Transaction
+		transaction, err = client.RecordTransaction(ctx, fixtures.RawXpub, signedHex, draft.ID,
+			WithMetadata("note", "tx note"),
+		)
+		require.NoError(t, err)
+
+		var syncTx *SyncTransaction
+		syncTx, err = GetSyncTransactionByID(ctx, transaction.ID, client.DefaultModelOptions()...)
+		require.NoError(t, err)
+		return transaction, syncTx
+	}
+
+	t.Run("default - off", func(t *testing.T) {
+		transaction, syncTx := recordWithPolicy(t)
+		assert.Equal(t, DraftMetadataOff, transaction.Client().DraftMetadataPolicy())
+		assert.Equal(t, "off", transaction.Client().ConfigSummary().DraftMetadata)
+
+		assert.Equal(t, "tx note", transaction.Metadata["note"])
+		assert.NotContains(t, transaction.Metadata, "invoice")
+		assert.NotContains(t, syncTx.Metadata, metadataKeyCorrelationID)
+	})
+
+	t.Run("merge", func(t *testing.T) {
+		transaction, syncTx := recordWithPolicy(t, WithDraftMetadataPolicy(DraftMetadataMerge))
+
+		assert.Equal(t, "tx note", transaction.Metadata["note"])
+		assert.Equal(t, "inv-1", transaction.Metadata["invoice"])
+		assert.Equal(t, "inv-1", transaction.XpubMetadata[transaction.XPubID]["invoice"])
+		assert.NotContains(t, transaction.Metadata, metadataKeyCorrelationID)
+
+		assert.Equal(t, "inv-1", syncTx.Metadata["invoice"])
+		assert.Equal(t, transaction.DraftID, syncTx.Metadata[metadataKeyCorrelationID])
+	})
+
+	t.Run("prefix", func(t *testing.T) {
+		transaction, syncTx := recordWithPolicy(t, WithDraftMetadataPolicy(DraftMetadataPrefix))
+
+		assert.Equal(t, "tx note", transaction.Metadata["note"])
+		assert.Equal(t, "draft note", transaction.Metadata["draft_note"])
+		assert.Equal(t, "inv-1", transaction.Metadata["draft_invoice"])
+		assert.NotContains(t, transaction.Metadata, "invoice")
+
+		assert.Equal(t, "inv-1", syncTx.Metadata["draft_invoice"])
+		assert.Equal(t, transaction.DraftID, syncTx.Metadata[metadataKeyCorrelationID])
+	})
+}
@@ -37,12 +37,18 @@ var ErrMissingFieldTransactionID = errors.New("missing required field: transacti
 // ErrMissingFieldXpubID is when the field is required but missing
 var ErrMissingFieldXpubID = errors.New("missing required field: xpub_id")
 
+// ErrInvalidTransactionFilter is when the transaction filter has an unknown direction or an inverted range
+var ErrInvalidTransactionFilter = errors.New("invalid transaction filter")
+
 // ErrXpubIDMisMatch is when the xPubID does not match
 var ErrXpubIDMisMatch = errors.New("xpub_id mismatch")
 
 // ErrMissingXpub is when the field is required but missing
 var ErrMissingXpub = errors.New("could not find xpub")
 
+// ErrInternalTransferSameXpub is when an internal transfer pays the sending xPub
+var ErrInternalTransferSameXpub = errors.New("internal transfer must be between two different xpubs")
+
 // ErrMissingLockingScript is when the field is required but missing
 var ErrMissingLockingScript = errors.New("could not find locking script")
 
@@ -82,6 +88,9 @@ var ErrOutputValueTooLow = errors.New("output value is too low")
 // ErrOutputValueTooHigh is when the satoshis output is too high on a transaction
 var ErrOutputValueTooHigh = errors.New("output value is too high")
 
+// ErrOutputValueMismatch is when the scripts of a resolved output do not pay the satoshis of the output
+var ErrOutputValueMismatch = errors.New("output scripts do not match the output value")
+
 // ErrTransactionFeeInvalid is when the fee on the transaction is not the difference between inputs and outputs
 var ErrTransactionFeeInvalid = errors.New("transaction fee is invalid")
 
@@ -109,6 +118,9 @@ var ErrMissingBlockHeaderHash = errors.New("block header hash is empty or id is
 // ErrUtxoAlreadySpent is when the utxo is already spent, but is trying to be used
 var ErrUtxoAlreadySpent = errors.New("utxo has already been spent")
 
+// ErrUtxoAlreadyReserved is when the utxo was reserved by another draft first (concurrent reservation)
+var ErrUtxoAlreadyReserved = errors.New("utxo is already reserved by another draft")
+
 // ErrDraftNotFound is when the requested draft transaction was not found
 var ErrDraftNotFound = errors.New("corresponding draft transaction not found")
 
@@ -172,6 +184,15 @@ var ErrUnknownAccessKey = errors.New("unknown access key")
 // ErrAccessKeyRevoked is when the access key has been revoked
 var ErrAccessKeyRevoked = errors.New("access key has been revoked")
 
+// ErrMissingAuthNonce is when the nonce is missing from the signed request
+var ErrMissingAuthNonce = errors.New("missing authentication nonce")
+
+// ErrAuthReplayed is when the nonce of the signed request was already used in the replay window
+var ErrAuthReplayed = errors.New("request has already been used (replayed)")
+
+// ErrAuthBodyTooLarge is when the body of the signed request is larger than AuthMaxBodySize
+var ErrAuthBodyTooLarge = errors.New("request body is too large")
+
 // ErrMissingPaymail missing paymail
 var ErrMissingPaymail = errors.New("missing paymail")
 
@@ -195,3 +216,297 @@ var ErrMissingPaymailXPubID = errors.New("missing xpub_id in paymail")
 
 // ErrMissingClient missing client from model
 var ErrMissingClient = errors.New("client is missing from model, cannot save")
+
+// ErrBeefAncestryTooDeep is when the unconfirmed ancestry of a transaction exceeds the configured BEEF depth
+var ErrBeefAncestryTooDeep = errors.New("beef transaction ancestry exceeds the maximum depth")
+
+// ErrBeefAncestryTooLarge is when the ancestry of a transaction exceeds the configured number of BEEF transactions
+var ErrBeefAncestryTooLarge = errors.New("beef transaction ancestry exceeds the maximum number of transactions")
+
+// ErrPaymailPublicNameTooLong is when the public name of the paymail exceeds the max length
+var ErrPaymailPublicNameTooLong = errors.New("paymail public name is too long")
+
+// ErrPaymailAvatarInvalid is when the avatar of the paymail is not an http(s) url
+var ErrPaymailAvatarInvalid = errors.New("paymail avatar must be an http(s) url")
+
+// ErrPaymailAvatarTooLong is when the avatar url of the paymail exceeds the max length
+var ErrPaymailAvatarTooLong = errors.New("paymail avatar url is too long")
+
+// ErrPaymailAvatarNotImage is when the avatar url of the paymail does not return an image
+var ErrPaymailAvatarNotImage = errors.New("paymail avatar url does not return an image")
+
+// ErrStartupValidationFailed is when one or more startup validation checks failed
+var ErrStartupValidationFailed = errors.New("startup validation failed")
+
+// ErrMissingReservationReference is when a manual utxo reservation is missing the reference
+var ErrMissingReservationReference = errors.New("missing reference for the manual utxo reservation")
+
+// ErrInvalidReservationTTL is when a manual utxo reservation has no (positive) ttl
+var ErrInvalidReservationTTL = errors.New("manual utxo reservation ttl must be greater than zero")
+
+// ErrSyncTransactionNotFound is when the sync transaction could not be found
+var ErrSyncTransactionNotFound = errors.New("sync transaction could not be found")
+
+// ErrDuplicateSyncTransaction is when more than one sync transaction exists for a transaction id
+var ErrDuplicateSyncTransaction = errors.New("duplicate sync transaction found")
+
+// ErrOutputAddressNetworkMismatch is when an output address does not belong to the configured network
+var ErrOutputAddressNetworkMismatch = errors.New("output address does not belong to the configured network")
+
+// ErrBlockHeaderNetworkMismatch is when the imported block headers do not belong to the configured network
+var ErrBlockHeaderNetworkMismatch = errors.New("block headers do not belong to the configured network")
+
+// ErrLocalLockFallbackWithCluster is when the local lock fallback is combined with a cluster coordinator
+var ErrLocalLockFallbackWithCluster = errors.New("local lock fallback cannot be used with a cluster coordinator")
+
+// ErrDestinationIndexCollision is when no unused chain/num could be found for a new destination
+var ErrDestinationIndexCollision = errors.New("destination index collision, could not find an unused index")
+
+// ErrUnsupportedSigHashType is when an input uses a sighash type (or combination) that is not supported
+var ErrUnsupportedSigHashType = errors.New("unsupported sighash type for the input")
+
+// ErrSigHashInputNotFound is when a sighash type is set for an input that is not in from_utxos or include_utxos
+var ErrSigHashInputNotFound = errors.New("sighash type is set for an input that is not in from_utxos or include_utxos")
+
+// ErrExternalInputsRequireAnyoneCanPay is when external inputs are allowed but no input uses ANYONECANPAY
+var ErrExternalInputsRequireAnyoneCanPay = errors.New("external inputs require at least one ANYONECANPAY input")
+
+// ErrExternalInputsNotAllowed is when external inputs are configured without allowing them (or with send all to)
+var ErrExternalInputsNotAllowed = errors.New("external inputs are not allowed for this transaction config")
+
+// ErrDestinationRevoked is when the destination has been revoked (no new funds are accepted)
+var ErrDestinationRevoked = errors.New("destination has been revoked")
+
+// ErrStaleModel is when the record was changed by another process since it was loaded (version conflict)
+var ErrStaleModel = errors.New("model is stale, the record was changed since it was loaded")
+
+// ErrInvalidSnapshot is when the xpub snapshot stream is malformed or has an unsupported version
+var ErrInvalidSnapshot = errors.New("invalid or unsupported xpub snapshot")
+
+// ErrSnapshotBalanceMismatch is when the imported xpub balance does not match its unspent utxos
+var ErrSnapshotBalanceMismatch = errors.New("xpub balance does not match the unspent utxos")
+
+// ErrUtxoFrozen is when a frozen utxo (compliance hold) is chosen for a transaction
+var ErrUtxoFrozen = errors.New("utxo is frozen")
+
+// ErrUtxoReservedByDraft is when freezing a utxo that is reserved by a draft (cancel the draft first)
+var ErrUtxoReservedByDraft = errors.New("utxo is reserved by a draft, cancel the draft before freezing it")
+
+// ErrMissingFreezeReason is when a utxo is frozen without a reason
+var ErrMissingFreezeReason = errors.New("missing the reason for freezing the utxo")
+
+// ErrUtxosUnavailable is when the utxos chosen for a transaction are spent, reserved or not owned by the xpub
+var ErrUtxosUnavailable = errors.New("utxos are not available")
+
+// ErrUnconfirmedChainTooLong is when the transaction would exceed the maximum chain of unconfirmed ancestors
+var ErrUnconfirmedChainTooLong = errors.New("chain of unconfirmed ancestors is too long")
+
+// ErrSyncActionComplete is when a sync action (broadcast, p2p or sync) is re-enabled after it was completed
+var ErrSyncActionComplete = errors.New("sync action is already complete and cannot be re-enabled")
+
+// ErrInvalidMerkleProof is when the merkle proof does not prove the transaction is in the block
+var ErrInvalidMerkleProof = errors.New("merkle proof is invalid")
+
+// ErrMissingBlockHash is when the hash of the block is missing
+var ErrMissingBlockHash = errors.New("missing the block hash")
+
+// ErrSyncTransactionCanceled is when the configuration of a canceled sync transaction is changed
+var ErrSyncTransactionCanceled = errors.New("sync transaction is canceled")
+
+// ErrOutputScriptNotExclusive is when a custom script output also sets a to or op_return
+var ErrOutputScriptNotExclusive = errors.New("script output cannot be combined with to or op_return")
+
+// ErrSkippedTransactionNotFound is when a transaction to import was not skipped by the monitor (or is no longer kept)
+var ErrSkippedTransactionNotFound = errors.New("skipped monitor transaction not found")
+
+// ErrDuplicateTransactionHex is when the same transaction is given more than once (RecordTransactions)
+var ErrDuplicateTransactionHex = errors.New("duplicate transaction in the request")
+
+// ErrParentTransactionNotRecorded is when a parent transaction in the same request could not be recorded
+var ErrParentTransactionNotRecorded = errors.New("parent transaction was not recorded")
+
+// ErrPaymailDomainBlocked is when a paymail output is on the deny-list (or not on the allow-list) of the paymail domains
+var ErrPaymailDomainBlocked = errors.New("paymail domain is blocked")
+
+// ErrIncomingTransactionTooLarge is when an incoming transaction exceeds the maximum size
+var ErrIncomingTransactionTooLarge = errors.New("incoming transaction is too large")
+
+// ErrIncomingTransactionTooManyInputs is when an incoming transaction exceeds the maximum number of inputs
+var ErrIncomingTransactionTooManyInputs = errors.New("incoming transaction has too many inputs")
+
+// ErrIncomingTransactionTooManyOutputs is when an incoming transaction exceeds the maximum number of outputs
+var ErrIncomingTransactionTooManyOutputs = errors.New("incoming transaction has too many outputs")
+
+// ErrIncomingTransactionScriptTooLarge is when a script of an incoming transaction exceeds the maximum script size
+var ErrIncomingTransactionScriptTooLarge = errors.New("incoming transaction script is too large")
+
+// ErrAdminLookupsDisabled is when a cross-xPub admin lookup is used without enabling it (see WithAdminLookups)
+var ErrAdminLookupsDisabled = errors.New("admin lookups are not enabled")
+
+// ErrMissingIncomingTransaction is when the incoming transaction could not be found
+var ErrMissingIncomingTransaction = errors.New("incoming transaction could not be found")
+
+// ErrSignedDraftMismatch is when the signed transaction does not match the inputs and outputs of the draft
+var ErrSignedDraftMismatch = errors.New("signed transaction does not match the draft")
+
+// ErrUnknownBroadcastProvider is when a preferred broadcast provider is not configured in chainstate
+var ErrUnknownBroadcastProvider = errors.New("broadcast provider is not configured")
+
+// ErrMissingPreferredProviders is when the preferred providers are required but none are set
+var ErrMissingPreferredProviders = errors.New("preferred providers are required but missing")
+
+// ErrSyncTransactionNotErrored is when a sync transaction without an errored action is requeued
+var ErrSyncTransactionNotErrored = errors.New("sync transaction has no errored action to requeue")
+
+// ErrTransactionsNotSortable is when the transactions contain a cycle or duplicates and cannot be sorted (parents first)
+var ErrTransactionsNotSortable = errors.New("transactions cannot be sorted (cycle or duplicates)")
+
+// ErrTransactionAncestryUnavailable is when the ancestry of an unmined transaction is unknown (no draft)
+var ErrTransactionAncestryUnavailable = errors.New("transaction is not mined and has no draft, ancestry is unavailable")
+
+// ErrPaymailAddressExists is when a new paymail address already exists (the alias is case-insensitive)
+var ErrPaymailAddressExists = errors.New("paymail address already exists")
+
+// ErrPaymailAliasInvalid is when the alias of a new paymail address has characters that are not allowed
+var ErrPaymailAliasInvalid = errors.New("paymail alias has invalid characters")
+
+// ErrPaymailAliasTooShort is when the alias of a new paymail address is below the min length
+var ErrPaymailAliasTooShort = errors.New("paymail alias is too short")
+
+// ErrPaymailAliasTooLong is when the alias of a new paymail address exceeds the max length
+var ErrPaymailAliasTooLong = errors.New("paymail alias is too long")
+
+// ErrPaymailAliasReserved is when the alias of a new paymail address is reserved, IE: admin or postmaster
+var ErrPaymailAliasReserved = errors.New("paymail alias is reserved")
+
+// ErrBalanceEventsMismatch is when the resulting balance of the last balance event is not the balance of the xpub
+var ErrBalanceEventsMismatch = errors.New("xpub balance does not match the balance events")
+
+// ErrPaymailProviderInBackoff is when the paymail provider is rate limited (in backoff)
+var ErrPaymailProviderInBackoff = errors.New("paymail provider is in backoff")
+
+// ErrP2PPayloadTooLarge is when the P2P payload exceeds the max size (or the receiver refused it with a 413)
+var ErrP2PPayloadTooLarge = errors.New("p2p payload is too large")
+
+// ErrMissingMuteUntil is when the end of the notifications mute window is missing
+var ErrMissingMuteUntil = errors.New("missing the end of the notifications mute window")
+
+// ErrOutputsUnresolved is when one or more of the outputs of a draft could not be resolved (AllowPartialResolution)
+var ErrOutputsUnresolved = errors.New("outputs could not be resolved")
+
+// ErrInvalidTransaction is when the transaction fails the pre-broadcast validation (see WithPreBroadcastValidation)
+var ErrInvalidTransaction = errors.New("transaction failed the pre-broadcast validation")
+
+// ErrMissingTransactionNote is when the transaction note could not be found (or belongs to another xpub)
+var ErrMissingTransactionNote = errors.New("transaction note could not be found")
+
+// ErrMissingTransactionNoteText is when the text of a transaction note is empty
+var ErrMissingTransactionNoteText = errors.New("missing the text of the transaction note")
+
+// ErrTransactionNoteTooLong is when the text of a transaction note exceeds the max length
+var ErrTransactionNoteTooLong = errors.New("transaction note is too long")
+
+// ErrInvalidBlockHeader is when a synced block header does not connect to the chain or fails the proof-of-work checks
+var ErrInvalidBlockHeader = errors.New("invalid block header")
+
+// ErrBlockHeaderReorgTooDeep is when the header sync removed more headers at the tip than allowed
+var ErrBlockHeaderReorgTooDeep = errors.New("block header reorg is too deep")
+
+// ErrBlockHeaderReorgInsufficientWork is when the branch of a reorg does not have more work than the headers it replaces
+var ErrBlockHeaderReorgInsufficientWork = errors.New("block header reorg branch does not have more work")
+
+// ErrBlockHeaderProviderFailed is when the block header provider returned an invalid response
+var ErrBlockHeaderProviderFailed = errors.New("block header provider failed")
+
+// ErrBlockHeaderSyncDisabled is when the block header sync is not configured (see WithBlockHeaderSync)
+var ErrBlockHeaderSyncDisabled = errors.New("block header sync is not configured")
+
+// ErrExchangeRateNotFound is when the exchange rate provider has no rate for the currency
+var ErrExchangeRateNotFound = errors.New("exchange rate not found")
+
+// ErrMonitorCatchUpDisabled is when the monitor catch-up is not configured (see WithMonitorCatchUp)
+var ErrMonitorCatchUpDisabled = errors.New("monitor catch-up is not configured")
+
+// ErrMissingMonitorCheckpoint is when the monitor has not processed any block (the catch-up needs a start height)
+var ErrMissingMonitorCheckpoint = errors.New("monitor checkpoint not found, a start height is required")
+
+// ErrInvalidAuditLog is when an audit entry is missing its position in the chain or its operation
+var ErrInvalidAuditLog = errors.New("invalid audit log entry")
+
+// ErrAuditLogImmutable is when an audit entry is updated (the audit log is append-only)
+var ErrAuditLogImmutable = errors.New("audit log entries cannot be changed")
+
+// ErrAuditChainBroken is when an audit entry does not match its hash or the previous entry (tampering)
+var ErrAuditChainBroken = errors.New("audit chain is broken")
+
+// ErrTransactionNotMined is when the transaction is not mined yet (or the merkle proof is not synced yet)
+var ErrTransactionNotMined = errors.New("transaction is not mined yet")
+
+// ErrMissingBlockHeader is when the header of the block is not stored
+var ErrMissingBlockHeader = errors.New("block header not found")
+
+// ErrInvalidPaymentProof is when a payment proof bundle is invalid or does not prove the transaction
+var ErrInvalidPaymentProof = errors.New("payment proof is invalid")
+
+// ErrMetadataTooManyKeys is when the metadata of a model exceeds the maximum number of keys
+var ErrMetadataTooManyKeys = errors.New("metadata has too many keys")
+
+// ErrMetadataTooLarge is when the serialized metadata of a model exceeds the maximum size
+var ErrMetadataTooLarge = errors.New("metadata is too large")
+
+// ErrMetadataValueTooLarge is when a serialized metadata value exceeds the maximum value size
+var ErrMetadataValueTooLarge = errors.New("metadata value is too large")
+
+// ErrInvalidP2PTarget is when a P2P target of a recorded transaction is missing the receive endpoint or reference ID
+var ErrInvalidP2PTarget = errors.New("p2p target is missing the receive endpoint or reference id")
+
+// ErrP2PTargetNotPaid is when the recorded transaction does not pay the resolved outputs of a P2P target
+var ErrP2PTargetNotPaid = errors.New("p2p target is not paid by the transaction")
+
+// ErrSchemaNewerThanBinary is when the schema of the database was migrated by a newer version (rolling upgrade)
+var ErrSchemaNewerThanBinary = errors.New("database schema is newer than this version understands")
+
+// ErrInvalidBalanceAlerts is when the low balance alert threshold is not below the high threshold
+var ErrInvalidBalanceAlerts = errors.New("low balance alert must be below the high balance alert")
+
+// ErrMissingIdentityKey is when the payment acknowledgments cannot be signed (see WithIdentityKey)
+var ErrMissingIdentityKey = errors.New("missing identity key")
+
+// ErrMissingPaymailResolution is when the transaction has no outputs paying a resolved (P2P) paymail
+var ErrMissingPaymailResolution = errors.New("transaction has no resolved paymail outputs")
+
+// ErrInvalidPaymailSignature is when the signature of a paymail resolution is not signed by the recipient (PKI key)
+var ErrInvalidPaymailSignature = errors.New("paymail resolution is not signed by the recipient")
+
+// ErrInvalidPaymentAcknowledgment is when a payment acknowledgment is inconsistent or its signature is invalid
+var ErrInvalidPaymentAcknowledgment = errors.New("payment acknowledgment is invalid")
+
+// ErrPaymailNotPending is when activating a paymail address that is already active
+var ErrPaymailNotPending = errors.New("paymail address is not pending activation")
+
+// ErrPaymailActivationExpired is when the activation window of a pending paymail address elapsed
+var ErrPaymailActivationExpired = errors.New("paymail address activation expired")
+
+// ErrPaymailActivationSignatureInvalid is when the signature of the activation challenge is not by the identity key
+var ErrPaymailActivationSignatureInvalid = errors.New("paymail activation signature is invalid")
+
+// ErrMissingSigner is when sending without a draft has no signer (see SendToRecipients)
+var ErrMissingSigner = errors.New("missing transaction signer")
+
+// ErrSignerFailed is when the signer of a transaction failed (see SendToRecipients)
+var ErrSignerFailed = errors.New("transaction signer failed")
+
+// ErrNotificationNotDeadLettered is when redelivering a notification event that is not dead-lettered
+var ErrNotificationNotDeadLettered = errors.New("notification event is not dead-lettered")
+
+// ErrMissingNotificationDelivery is when the delivery receipt of the notification event is not found
+var ErrMissingNotificationDelivery = errors.New("notification delivery not found")
+
+// ErrFeeCalculatorFailed is when the fee calculator of the draft transactions failed (see WithFeeCalculator)
+var ErrFeeCalculatorFailed = errors.New("fee calculator failed")
+
+// ErrReconciliationDisabled is when reconciling an xPub without an unspent outputs provider (see WithReconciliation)
+var ErrReconciliationDisabled = errors.New("reconciliation is disabled: missing the unspent outputs provider")
+
+// ErrReconciliationFailed is when the unspent outputs provider of the reconciliation failed
+var ErrReconciliationFailed = errors.New("reconciliation provider failed")
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"time"
+
+	"github.com/BuxOrg/bux"
+	"github.com/BuxOrg/bux/taskmanager"
+	"github.com/bitcoinschema/go-bitcoin/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/mrz1836/go-cachestore"
+	"github.com/mrz1836/go-datastore"
+)
+
+// newNode will create an instance of the cluster (all the instances share redis and the PostgreSQL database)
+func newNode(name, redisURL string) bux.ClientInterface {
+	defaultTimeouts := 10 * time.Second
+
+	client, err := bux.NewClient(
+		context.Background(), // Set context
+		bux.WithRedis(&cachestore.RedisConfig{URL: redisURL}), // Cache (shared)
+		bux.WithClusterRedis(&redis.Options{Addr: redisURL}),  // Cluster coordination (pub/sub)
+		bux.WithTaskQUsingRedis( // Tasks (shared queue)
+			taskmanager.DefaultTaskQConfig("example_cluster_queue"),
+			&redis.Options{Addr: redisURL}),
+		bux.WithSQL(datastore.PostgreSQL, &datastore.SQLConfig{ // Datastore (shared)
+			CommonConfig: datastore.CommonConfig{
+				MaxConnectionIdleTime: defaultTimeouts,
+				MaxConnectionTime:     defaultTimeouts,
+				MaxIdleConnections:    10,
+				MaxOpenConnections:    10,
+				TablePrefix:           "bux",
+			},
+			Driver:    datastore.PostgreSQL.String(),
+			Host:      "localhost",
+			Name:      os.Getenv("DB_NAME"),
+			Password:  os.Getenv("DB_PASSWORD"),
+			Port:      "5432",
+			TimeZone:  "UTC",
+			TxTimeout: defaultTimeouts,
+			User:      os.Getenv("DB_USER"),
+		}),
+		bux.WithAutoMigrate(bux.BaseModels...),
+	)
+	if err != nil {
+		log.Fatalln("error loading " + name + ": " + err.Error())
+	}
+	log.Println(name+" loaded!", client.UserAgent())
+	return client
+}
+
+func main() {
+	ctx := context.Background()
+	redisURL := "localhost:6379"
+
+	// Two instances of the same cluster
+	nodeA := newNode("node-a", redisURL)
+	defer func() {
+		_ = nodeA.Close(context.Background())
+	}()
+	nodeB := newNode("node-b", redisURL)
+	defer func() {
+		_ = nodeB.Close(context.Background())
+	}()
+
+	// The xPriv of a funded wallet (BUX_XPRIV)
+	hdKey, err := bitcoin.GenerateHDKeyFromString(os.Getenv("BUX_XPRIV"))
+	if err != nil {
+		log.Fatalln("error: " + err.Error())
+	}
+	var rawXPub string
+	if rawXPub, err = bitcoin.GetExtendedPublicKey(hdKey); err != nil {
+		log.Fatalln("error: " + err.Error())
+	}
+	if _, err = nodeA.NewXpub(ctx, rawXPub); err != nil {
+		log.Println("xpub already exists: " + err.Error())
+	}
+
+	// Create the draft on the first instance, the broadcast is left to the cron task of the cluster
+	var draft *bux.DraftTransaction
+	if draft, err = nodeA.NewTransaction(ctx, rawXPub, &bux.TransactionConfig{
+		Outputs: []*bux.TransactionOutput{{
+			To:       os.Getenv("BUX_TO_ADDRESS"),
+			Satoshis: 1000,
+		}},
+		Sync: &bux.SyncConfig{Broadcast: true, BroadcastInstant: false},
+	}); err != nil {
+		log.Fatalln("error: " + err.Error())
+	}
+
+	var signedHex string
+	if signedHex, err = draft.SignInputs(hdKey); err != nil {
+		log.Fatalln("error: " + err.Error())
+	}
+
+	var transaction *bux.Transaction
+	if transaction, err = nodeA.RecordTransaction(ctx, rawXPub, signedHex, draft.ID); err != nil {
+		log.Fatalln("error: " + err.Error())
+	}
+	log.Println("node-a recorded transaction:", transaction.ID)
+
+	// Observe the broadcast processing on the other instance
+	for i := 0; i < 60; i++ {
+		var syncTx *bux.SyncTransaction
+		if syncTx, err = bux.GetSyncTransactionByID(
+			ctx, transaction.ID, nodeB.DefaultModelOptions()...,
+		); err != nil {
+			log.Fatalln("error: " + err.Error())
+		}
+		if syncTx.BroadcastStatus != bux.SyncStatusReady {
+			log.Println("node-b sees broadcast status:", syncTx.BroadcastStatus)
+			if response := syncTx.LastBroadcastResponse(); response != nil {
+				log.Println("broadcast by provider:", response.Provider)
+			}
+			return
+		}
+		time.Sleep(time.Second)
+	}
+	log.Println("transaction was not broadcast yet (is the cron running?)")
+}
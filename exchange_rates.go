@@ -0,0 +1,164 @@
+package bux
+
+import (
+	"context"
+	"math"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Reserved metadata keys of the fiat display values (stamped when recording, see WithExchangeRateProvider)
+const (
+	metadataKeyFiatCurrency = "fiat_currency" // Currency of the rate (IE: USD)
+	metadataKeyFiatFee      = "fiat_fee"      // Fiat value of the fee (drafts)
+	metadataKeyFiatRate     = "fiat_rate"     // Fiat value of 1 BSV
+	metadataKeyFiatRateAt   = "fiat_rate_at"  // Time of the rate (RFC3339)
+	metadataKeyFiatValue    = "fiat_value"    // Fiat value of the total value (transactions)
+)
+
+// ExchangeRateProvider is a source of the exchange rates of the fiat display values (see WithExchangeRateProvider)
+type ExchangeRateProvider interface {
+	// GetRate will return the fiat value of 1 BSV in the currency and the time of the rate
+	GetRate(ctx context.Context, currency string) (float64, time.Time, error)
+}
+
+// FiatValue is the fiat equivalent of an amount at the rate stamped when recording
+type FiatValue struct {
+	Currency string    `json:"currency"` // Currency of the rate (IE: USD)
+	Rate     float64   `json:"rate"`     // Fiat value of 1 BSV
+	RatedAt  time.Time `json:"rated_at"` // Time of the rate
+	Value    float64   `json:"value"`    // Fiat value of the amount (rounded to 2 decimals)
+}
+
+// exchangeRateOptions holds the configuration of the fiat display values
+type exchangeRateOptions struct {
+	currency string               // Currency of the fiat values (IE: USD)
+	provider ExchangeRateProvider // Source of the rates (no-op by default)
+}
+
+// noopExchangeRateProvider is the default provider (no rate, nothing is stamped)
+type noopExchangeRateProvider struct{}
+
+// GetRate will return no rate
+func (noopExchangeRateProvider) GetRate(context.Context, string) (float64, time.Time, error) {
+	return 0, time.Time{}, nil
+}
+
+// StaticExchangeRateProvider returns the rates set on the provider (IE: tests, fixed rates)
+type StaticExchangeRateProvider struct {
+	lock  sync.RWMutex
+	rates map[string]float64
+	at    time.Time
+}
+
+// NewStaticExchangeRateProvider will return a provider of the fixed rates (currency -> fiat value of 1 BSV)
+func NewStaticExchangeRateProvider(rates map[string]float64) *StaticExchangeRateProvider {
+	p := &StaticExchangeRateProvider{rates: make(map[string]float64, len(rates))}
+	p.SetRates(rates)
+	return p
+}
+
+// SetRates will replace the rates (the time of the rates is now)
+func (p *StaticExchangeRateProvider) SetRates(rates map[string]float64) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.rates = make(map[string]float64, len(rates))
+	for currency, rate := range rates {
+		p.rates[strings.ToUpper(currency)] = rate
+	}
+	p.at = time.Now().UTC()
+}
+
+// GetRate will return the rate of the currency (ErrExchangeRateNotFound if the currency is unknown)
+func (p *StaticExchangeRateProvider) GetRate(_ context.Context, currency string) (float64, time.Time, error) {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	rate, ok := p.rates[strings.ToUpper(currency)]
+	if !ok {
+		return 0, time.Time{}, ErrExchangeRateNotFound
+	}
+	return rate, p.at, nil
+}
+
+// getExchangeRate will return the rate of the configured currency (nil if there is no rate)
+//
+// A failure of the provider is logged and skipped (never fails the record)
+func getExchangeRate(ctx context.Context, client ClientInterface) *FiatValue {
+	if client == nil {
+		return nil
+	}
+	provider, currency := client.ExchangeRateProvider(), client.ExchangeRateCurrency()
+	if provider == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, defaultExchangeRateTimeout)
+	defer cancel()
+	rate, ratedAt, err := provider.GetRate(ctx, currency)
+	if err != nil {
+		client.Logger().Warn(ctx, "skipping the fiat values, failed getting the "+currency+" rate: "+err.Error())
+		return nil
+	} else if rate <= 0 || math.IsNaN(rate) || math.IsInf(rate, 0) {
+		return nil
+	}
+	if ratedAt.IsZero() {
+		ratedAt = time.Now()
+	}
+	return &FiatValue{Currency: currency, Rate: rate, RatedAt: ratedAt.UTC().Truncate(time.Second)} // Stamped as RFC3339
+}
+
+// at will return the fiat value of the satoshis at the rate
+func (f *FiatValue) at(satoshis int64) *FiatValue {
+	value := *f
+	value.Value = math.Round(float64(satoshis)/1e8*f.Rate*100) / 100
+	return &value
+}
+
+// isFiatMetadataKey will return true if the key is a reserved fiat key (see WithExchangeRateProvider)
+//
+// The reserved keys are only stamped by bux, they are stripped from the metadata set by the callers
+func isFiatMetadataKey(key string) bool {
+	switch key {
+	case metadataKeyFiatCurrency, metadataKeyFiatFee, metadataKeyFiatRate, metadataKeyFiatRateAt, metadataKeyFiatValue:
+		return true
+	}
+	return false
+}
+
+// stampFiatValue will set the rate and the fiat value of the satoshis on the metadata (under the key)
+func stampFiatValue(metadata Metadata, key string, rate *FiatValue, satoshis int64) {
+	metadata[metadataKeyFiatCurrency] = rate.Currency
+	metadata[metadataKeyFiatRate] = rate.Rate
+	metadata[metadataKeyFiatRateAt] = rate.RatedAt.Format(time.RFC3339)
+	metadata[key] = rate.at(satoshis).Value
+}
+
+// fiatValueFromMetadata will return the fiat value of the satoshis at the rate stamped on the metadata (nil if none)
+func fiatValueFromMetadata(metadata Metadata, satoshis int64) *FiatValue {
+	currency, _ := metadata[metadataKeyFiatCurrency].(string)
+	rate, ok := metadataFloat(metadata[metadataKeyFiatRate])
+	if len(currency) == 0 || !ok {
+		return nil
+	}
+	ratedAt, _ := metadata[metadataKeyFiatRateAt].(string)
+	at, _ := time.Parse(time.RFC3339, ratedAt)
+	return (&FiatValue{Currency: currency, Rate: rate, RatedAt: at}).at(satoshis)
+}
+
+// metadataFloat will return the number of the metadata value (JSON numbers are float64, other stores may differ)
+func metadataFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	}
+	return 0, false
+}
@@ -0,0 +1,147 @@
+package bux
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// exchangeRateProviderError always fails
+type exchangeRateProviderError struct{}
+
+// GetRate will return an error
+func (exchangeRateProviderError) GetRate(context.Context, string) (float64, time.Time, error) {
+	return 0, time.Time{}, errors.New("rate service is down")
+}
+
+// TestStaticExchangeRateProvider will test the method GetRate()
+func TestStaticExchangeRateProvider(t *testing.T) {
+	t.Parallel()
+
+	provider := NewStaticExchangeRateProvider(map[string]float64{"usd": 50})
+	rate, at, err := provider.GetRate(context.Background(), "USD")
+	require.NoError(t, err)
+	assert.Equal(t, 50.0, rate)
+	assert.False(t, at.IsZero())
+
+	_, _, err = provider.GetRate(context.Background(), "EUR")
+	assert.ErrorIs(t, err, ErrExchangeRateNotFound)
+
+	provider.SetRates(map[string]float64{"EUR": 45})
+	rate, _, err = provider.GetRate(context.Background(), "eur")
+	require.NoError(t, err)
+	assert.Equal(t, 45.0, rate)
+}
+
+// Test_fiatValueFromMetadata will test the fiat values stamped on the metadata
+func Test_fiatValueFromMetadata(t *testing.T) {
+	t.Parallel()
+
+	ratedAt := time.Date(2023, 10, 1, 12, 0, 0, 0, time.UTC)
+	metadata := Metadata{}
+	stampFiatValue(metadata, metadataKeyFiatValue, &FiatValue{Currency: "USD", Rate: 42.5, RatedAt: ratedAt}, 250000000)
+	assert.Equal(t, 106.25, metadata[metadataKeyFiatValue])
+	assert.Equal(t, "2023-10-01T12:00:00Z", metadata[metadataKeyFiatRateAt])
+
+	value := fiatValueFromMetadata(metadata, -1000000)
+	require.NotNil(t, value)
+	assert.Equal(t, "USD", value.Currency)
+	assert.Equal(t, 42.5, value.Rate)
+	assert.Equal(t, ratedAt, value.RatedAt)
+	assert.Equal(t, -0.43, value.Value)
+
+	assert.Nil(t, fiatValueFromMetadata(Metadata{"note": "test"}, 1000))
+	assert.Nil(t, fiatValueFromMetadata(nil, 1000))
+}
+
+// TestWithExchangeRateProvider will test stamping the fiat values when recording
+func TestWithExchangeRateProvider(t *testing.T) {
+	t.Parallel()
+
+	recordWithProvider := func(t *testing.T, provider ExchangeRateProvider) (*DraftTransaction, *Transaction) {
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, true,
+			WithCustomTaskManager(&taskManagerMockBase{}), WithExchangeRateProvider(provider, "usd"),
+		)
+		t.Cleanup(deferMe)
+
+		fixtures := NewFixtures(t, client).WithXpub(0).WithUtxos(100000).WithDraft(&TransactionConfig{
+			Outputs: []*TransactionOutput{{To: testExternalAddress, Satoshis: 10000}},
+		})
+		signedHex, err := fixtures.Drafts[0].SignInputs(fixtures.HDKey)
+		require.NoError(t, err)
+		var transaction *Transaction
+		transaction, err = client.RecordTransaction(ctx, fixtures.RawXpub, signedHex, fixtures.Drafts[0].ID)
+		require.NoError(t, err)
+
+		// The enriched read
+		transaction, err = client.GetTransaction(ctx, fixtures.Xpub.ID, transaction.ID)
+		require.NoError(t, err)
+		return fixtures.Drafts[0], transaction
+	}
+
+	t.Run("default - no fiat values", func(t *testing.T) {
+		_, client, deferMe := CreateTestSQLiteClient(t, false, false)
+		defer deferMe()
+		assert.IsType(t, noopExchangeRateProvider{}, client.ExchangeRateProvider())
+		assert.Equal(t, defaultExchangeRateCurrency, client.ExchangeRateCurrency())
+		assert.Empty(t, client.ConfigSummary().FiatCurrency)
+	})
+
+	t.Run("rate is stamped", func(t *testing.T) {
+		draft, transaction := recordWithProvider(t, NewStaticExchangeRateProvider(map[string]float64{"USD": 50000}))
+
+		require.NotNil(t, draft.FiatFee)
+		assert.Equal(t, "USD", draft.FiatFee.Currency)
+		assert.Equal(t, 50000.0, draft.FiatFee.Rate)
+		assert.InDelta(t, float64(draft.Configuration.Fee)/1e8*50000, draft.FiatFee.Value, 0.01)
+		assert.Equal(t, "USD", draft.Metadata[metadataKeyFiatCurrency])
+
+		assert.Equal(t, "USD", transaction.Metadata[metadataKeyFiatCurrency])
+		assert.Equal(t, 50000.0, transaction.Metadata[metadataKeyFiatRate])
+		assert.NotNil(t, transaction.Metadata[metadataKeyFiatValue])
+		require.NotNil(t, transaction.FiatValue)
+		assert.Equal(t, 50000.0, transaction.FiatValue.Rate)
+		assert.InDelta(t, float64(transaction.XpubOutputValue[transaction.XPubID])/1e8*50000, transaction.FiatValue.Value, 0.01)
+		assert.Less(t, transaction.FiatValue.Value, 0.0) // Outgoing
+
+		value := transaction.FiatValue.Value
+		assert.Equal(t, value, transaction.Display().(*Transaction).FiatValue.Value)
+		assert.Equal(t, draft.FiatFee, draft.Display().(*DraftTransaction).FiatFee)
+	})
+
+	t.Run("failed rate is skipped", func(t *testing.T) {
+		draft, transaction := recordWithProvider(t, exchangeRateProviderError{})
+		assert.Nil(t, draft.FiatFee)
+		assert.Nil(t, transaction.FiatValue)
+		assert.NotContains(t, transaction.Metadata, metadataKeyFiatRate)
+	})
+}
+
+// Test_isFiatMetadataKey will test stripping the reserved fiat keys from the metadata set by the callers
+func Test_isFiatMetadataKey(t *testing.T) {
+	t.Parallel()
+
+	model := NewBaseModel(ModelTransaction,
+		WithMetadata(metadataKeyFiatRate, 1.0),
+		WithMetadatas(map[string]interface{}{metadataKeyFiatCurrency: "XXX", "note": "test"}),
+		WithMetadataFromJSON([]byte(`{"fiat_value":1000000,"memo":"rent"}`)),
+	)
+	assert.Equal(t, Metadata{"memo": "rent", "note": "test"}, model.Metadata)
+
+	model.UpdateMetadata(Metadata{metadataKeyFiatRateAt: "2023-10-01T12:00:00Z", "note": nil})
+	assert.Equal(t, Metadata{"memo": "rent"}, model.Metadata)
+
+	// The stamped values can not be overwritten
+	stampFiatValue(model.Metadata, metadataKeyFiatValue, &FiatValue{Currency: "USD", Rate: 42.5}, 100000000)
+	model.UpdateMetadata(Metadata{metadataKeyFiatValue: 1, metadataKeyFiatCurrency: nil})
+	assert.Equal(t, 42.5, model.Metadata[metadataKeyFiatValue])
+	assert.Equal(t, "USD", model.Metadata[metadataKeyFiatCurrency])
+
+	transaction := &Transaction{}
+	require.NoError(t, transaction.UpdateTransactionMetadata(testXPubID, Metadata{metadataKeyFiatFee: 1, "memo": "rent"}))
+	assert.Equal(t, Metadata{"memo": "rent"}, transaction.XpubMetadata[testXPubID])
+}
@@ -0,0 +1,47 @@
+package bux
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	"github.com/BuxOrg/bux/utils"
+)
+
+// feeCalculatorFeeUnit is the name of the default fee calculator (stored on the drafts)
+const feeCalculatorFeeUnit = "fee_unit"
+
+// DraftSummary is the summary of a draft transaction given to the FeeCalculator
+type DraftSummary struct {
+	EstimatedSize  uint64         `json:"estimated_size"`  // Estimated size (bytes) of the transaction
+	FeeUnit        *utils.FeeUnit `json:"fee_unit"`        // Fee unit of the draft (configured or from the miners)
+	InputCount     int            `json:"input_count"`     // Number of inputs (including the expected external inputs)
+	OutputCount    int            `json:"output_count"`    // Number of outputs (including the change outputs being added)
+	OutputSatoshis uint64         `json:"output_satoshis"` // Total satoshis of the outputs (without the change)
+}
+
+// feeUnitCalculator is the default FeeCalculator (the estimated size times the fee unit of the draft)
+type feeUnitCalculator struct{}
+
+// CalculateFee will return the fee of the estimated size using the fee unit
+func (f *feeUnitCalculator) CalculateFee(_ context.Context, summary *DraftSummary) (uint64, error) {
+	return feeForSize(summary.FeeUnit, summary.EstimatedSize), nil
+}
+
+// String will return the name of the calculator
+func (f *feeUnitCalculator) String() string {
+	return feeCalculatorFeeUnit
+}
+
+// feeForSize will return the fee of the size using the fee unit (rounded up)
+func feeForSize(unit *utils.FeeUnit, size uint64) uint64 {
+	return uint64(math.Ceil(float64(size) * (float64(unit.Satoshis) / float64(unit.Bytes))))
+}
+
+// feeCalculatorName will return the name of the calculator stored on the drafts (fmt.Stringer or the type)
+func feeCalculatorName(calculator FeeCalculator) string {
+	if named, ok := calculator.(fmt.Stringer); ok {
+		return named.String()
+	}
+	return fmt.Sprintf("%T", calculator)
+}
@@ -0,0 +1,178 @@
+package bux
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/libsv/go-bt/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// tieredFeeCalculator subsidizes the small payments and charges a flat fee above the threshold
+type tieredFeeCalculator struct {
+	flatFee       uint64
+	subsidizedFee uint64
+	summaries     []*DraftSummary
+	threshold     uint64
+}
+
+// CalculateFee will return the fee of the tier of the payment
+func (f *tieredFeeCalculator) CalculateFee(_ context.Context, summary *DraftSummary) (uint64, error) {
+	f.summaries = append(f.summaries, summary)
+	if summary.OutputSatoshis < f.threshold {
+		return f.subsidizedFee, nil
+	}
+	return f.flatFee, nil
+}
+
+// String will return the name of the calculator
+func (f *tieredFeeCalculator) String() string {
+	return "tiered"
+}
+
+// perInputFeeCalculator charges a fee per input
+type perInputFeeCalculator uint64
+
+// CalculateFee will return the fee of the inputs
+func (f perInputFeeCalculator) CalculateFee(_ context.Context, summary *DraftSummary) (uint64, error) {
+	return uint64(f) * uint64(summary.InputCount), nil
+}
+
+// failingFeeCalculator always fails
+type failingFeeCalculator struct{}
+
+// CalculateFee will return an error
+func (f failingFeeCalculator) CalculateFee(context.Context, *DraftSummary) (uint64, error) {
+	return 0, errors.New("rates unavailable")
+}
+
+// TestWithFeeCalculator will test the drafts using a custom fee calculator
+func TestWithFeeCalculator(t *testing.T) {
+	t.Parallel()
+
+	// requireFee will check the fee of the draft (inputs - outputs)
+	requireFee := func(t *testing.T, draft *DraftTransaction, fee uint64) {
+		assert.Equal(t, fee, draft.Configuration.Fee)
+
+		tx, err := bt.NewTxFromString(draft.Hex)
+		require.NoError(t, err)
+		var inputs uint64
+		for _, input := range draft.Configuration.Inputs {
+			inputs += input.Satoshis
+		}
+		assert.Equal(t, fee, inputs-tx.TotalOutputSatoshis())
+	}
+
+	newDraft := func(ctx context.Context, t *testing.T, client ClientInterface, fixtures *Fixtures,
+		satoshis uint64,
+	) (*DraftTransaction, error) {
+		return client.NewTransaction(ctx, fixtures.RawXpub, &TransactionConfig{
+			Outputs: []*TransactionOutput{{To: testExternalAddress, Satoshis: satoshis}},
+		}, client.DefaultModelOptions()...)
+	}
+
+	t.Run("default fee unit", func(t *testing.T) {
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, true, WithCustomTaskManager(&taskManagerMockBase{}))
+		t.Cleanup(deferMe)
+		fixtures := NewFixtures(t, client).WithXpub(0).WithUtxos(100000)
+
+		draft, err := newDraft(ctx, t, client, fixtures, 1000)
+		require.NoError(t, err)
+		assert.Equal(t, feeCalculatorFeeUnit, draft.Configuration.FeeCalculator)
+		assert.Equal(t, feeCalculatorFeeUnit, client.(*Client).ConfigSummary().FeeCalculator)
+		requireFee(t, draft, draft.estimateFee(draft.Configuration.FeeUnit, 0))
+	})
+
+	t.Run("tiered", func(t *testing.T) {
+		calculator := &tieredFeeCalculator{flatFee: 500, subsidizedFee: 1, threshold: 10000}
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, true,
+			WithCustomTaskManager(&taskManagerMockBase{}),
+			WithFeeCalculator(calculator),
+		)
+		t.Cleanup(deferMe)
+		fixtures := NewFixtures(t, client).WithXpub(0).WithUtxos(100000, 100000)
+		assert.Equal(t, "tiered", client.(*Client).ConfigSummary().FeeCalculator)
+
+		// Subsidized small payment (not below the fee unit)
+		small, err := newDraft(ctx, t, client, fixtures, 1000)
+		require.NoError(t, err)
+		assert.Equal(t, "tiered", small.Configuration.FeeCalculator)
+		requireFee(t, small, small.estimateFee(small.Configuration.FeeUnit, 0))
+
+		// The calculator got the summary of the draft (reservation per input, then with the change output)
+		require.GreaterOrEqual(t, len(calculator.summaries), 3)
+		reservation := calculator.summaries[1]
+		assert.Equal(t, 1, reservation.InputCount)
+		assert.Equal(t, 1, reservation.OutputCount)
+		summary := calculator.summaries[len(calculator.summaries)-1]
+		assert.Equal(t, 1, summary.InputCount)
+		assert.Equal(t, 2, summary.OutputCount)
+		assert.Equal(t, uint64(1000), summary.OutputSatoshis)
+		assert.InDelta(t, small.estimateSize(), summary.EstimatedSize, 1) // The change output is estimated
+		assert.Equal(t, small.Configuration.FeeUnit, summary.FeeUnit)
+
+		// Flat fee above the threshold
+		var large *DraftTransaction
+		large, err = newDraft(ctx, t, client, fixtures, 50000)
+		require.NoError(t, err)
+		requireFee(t, large, 500)
+	})
+
+	t.Run("fee too high for send all", func(t *testing.T) {
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, true,
+			WithCustomTaskManager(&taskManagerMockBase{}),
+			WithFeeCalculator(&tieredFeeCalculator{flatFee: 50000, subsidizedFee: 50000}),
+		)
+		t.Cleanup(deferMe)
+		fixtures := NewFixtures(t, client).WithXpub(0).WithUtxos(10000)
+
+		_, err := client.NewTransaction(ctx, fixtures.RawXpub, &TransactionConfig{
+			SendAllTo: &TransactionOutput{To: testExternalAddress},
+		}, client.DefaultModelOptions()...)
+		require.ErrorIs(t, err, ErrOutputValueTooLow)
+	})
+
+	t.Run("zero fee is raised to the fee unit", func(t *testing.T) {
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, true,
+			WithCustomTaskManager(&taskManagerMockBase{}),
+			WithFeeCalculator(&tieredFeeCalculator{}),
+		)
+		t.Cleanup(deferMe)
+		fixtures := NewFixtures(t, client).WithXpub(0).WithUtxos(100000)
+
+		draft, err := newDraft(ctx, t, client, fixtures, 1000)
+		require.NoError(t, err)
+		requireFee(t, draft, draft.estimateFee(draft.Configuration.FeeUnit, 0))
+	})
+
+	t.Run("per input fee", func(t *testing.T) {
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, true,
+			WithCustomTaskManager(&taskManagerMockBase{}),
+			WithFeeCalculator(perInputFeeCalculator(1000)),
+		)
+		t.Cleanup(deferMe)
+		fixtures := NewFixtures(t, client).WithXpub(0).WithUtxos(2500, 2500, 2500)
+
+		// Two inputs are not enough for the payment and the fee of the inputs
+		draft, err := newDraft(ctx, t, client, fixtures, 3500)
+		require.NoError(t, err)
+		assert.Len(t, draft.Configuration.Inputs, 3)
+		requireFee(t, draft, 3000)
+	})
+
+	t.Run("calculator failure", func(t *testing.T) {
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, true,
+			WithCustomTaskManager(&taskManagerMockBase{}),
+			WithFeeCalculator(failingFeeCalculator{}),
+		)
+		t.Cleanup(deferMe)
+		fixtures := NewFixtures(t, client).WithXpub(0).WithUtxos(100000)
+		assert.Equal(t, "bux.failingFeeCalculator", client.(*Client).ConfigSummary().FeeCalculator)
+
+		_, err := newDraft(ctx, t, client, fixtures, 1000)
+		require.ErrorIs(t, err, ErrFeeCalculatorFailed)
+		assert.Contains(t, err.Error(), "rates unavailable")
+	})
+}
@@ -0,0 +1,224 @@
+package bux
+
+import (
+	"context"
+
+	"github.com/BuxOrg/bux/utils"
+	"github.com/bitcoinschema/go-bitcoin/v2"
+	"github.com/libsv/go-bk/bip32"
+	"github.com/libsv/go-bt/v2"
+	"github.com/libsv/go-bt/v2/bscript"
+)
+
+// TestingT is the part of testing.TB used by the fixtures (*testing.T or *testing.B)
+type TestingT interface {
+	Cleanup(fn func())
+	Fatalf(format string, args ...interface{})
+	Helper()
+}
+
+// Fixtures is a builder of seeded models for testing (xPub, destinations, utxos, transactions and drafts)
+//
+// Any error fails the test. The open drafts are canceled (their utxos are released) when the test finishes,
+// call Close before closing the client if the client is closed before the test finishes (IE: by a defer).
+//
+//	fixtures := bux.NewFixtures(t, client).WithXpub(0).WithDestinations(3).WithUtxos(1000, 2000)
+type Fixtures struct {
+	Destinations []*Destination      // Destinations of the xPub (in order of creation)
+	Drafts       []*DraftTransaction // Drafts created by the xPub
+	HDKey        *bip32.ExtendedKey  // Private key of the xPub (for signing)
+	RawXpub      string              // The raw public xPub
+	Transactions []*Transaction      // Recorded transactions (including the funding of the utxos)
+	Utxos        []*Utxo             // Utxos of the xPub (in order of creation)
+	Xpub         *Xpub               // The xPub
+	client       ClientInterface     // The client used to create the models
+	closed       bool                // Close was called
+	ctx          context.Context     // Context used to create the models
+	t            TestingT            // The current test
+}
+
+// NewFixtures will start a new fixtures builder using the client
+func NewFixtures(t TestingT, client ClientInterface) *Fixtures {
+	f := &Fixtures{
+		client: client,
+		ctx:    context.Background(),
+		t:      t,
+	}
+
+	// Cancel the open drafts
+	t.Cleanup(f.Close)
+	return f
+}
+
+// Close will cancel the drafts that are still open (the reserved utxos are released, see DraftTransaction)
+//
+// Called when the test finishes, calling it again does nothing
+func (f *Fixtures) Close() {
+	if f.closed {
+		return
+	}
+	f.closed = true
+
+	for _, draft := range f.Drafts {
+		current, err := getDraftTransactionID(f.ctx, draft.XpubID, draft.ID, f.client.DefaultModelOptions()...)
+		if err != nil || current == nil || current.Status != DraftStatusDraft {
+			continue // Recorded, canceled or expired
+		}
+		current.Status = DraftStatusCanceled
+		_ = current.Save(f.ctx)
+	}
+}
+
+// WithXpub will create a new (random) xPub with the starting balance (no utxos are created for the balance)
+//
+// Use WithXpub(0).WithUtxos(...) for a balance that can be spent
+func (f *Fixtures) WithXpub(balance uint64) *Fixtures {
+	f.t.Helper()
+
+	var err error
+	if f.HDKey, err = bitcoin.GenerateHDKey(bitcoin.SecureSeedLength); err != nil {
+		f.fail(err)
+	}
+	if f.RawXpub, err = bitcoin.GetExtendedPublicKey(f.HDKey); err != nil {
+		f.fail(err)
+	}
+
+	f.Xpub = newXpub(f.RawXpub, f.client.DefaultModelOptions(New())...)
+	f.Xpub.CurrentBalance = balance
+	f.Xpub.ConfirmedBalance = balance
+	if err = f.Xpub.Save(f.ctx); err != nil {
+		f.fail(err)
+	}
+
+	// The starting balance is an adjustment (see BalanceEvent)
+	if balance > 0 {
+		if err = newBalanceEvent(
+			f.Xpub.ID, "", BalanceEventAdjustment, int64(balance), balance, f.client.DefaultModelOptions(New())...,
+		).Save(f.ctx); err != nil {
+			f.fail(err)
+		}
+	}
+	return f
+}
+
+// WithDestinations will create new external (P2PKH) destinations for the xPub
+func (f *Fixtures) WithDestinations(count int) *Fixtures {
+	f.t.Helper()
+	f.requireXpub()
+
+	for i := 0; i < count; i++ {
+		destination, err := f.client.NewDestination(
+			f.ctx, f.RawXpub, utils.ChainExternal, utils.ScriptTypePubKeyHash, false,
+		)
+		if err != nil {
+			f.fail(err)
+		}
+		f.Destinations = append(f.Destinations, destination)
+	}
+	return f
+}
+
+// WithUtxos will record a (fake) funding transaction with one output per amount, paying to the destinations
+//
+// The outputs are spread over the destinations (one destination is created if there are none),
+// the balance of the xPub is increased by the total amount
+func (f *Fixtures) WithUtxos(satoshis ...uint64) *Fixtures {
+	f.t.Helper()
+	f.requireXpub()
+
+	if len(f.Destinations) == 0 {
+		f.WithDestinations(1)
+	}
+
+	// The input is not signed, the parent transaction does not exist
+	parentID, err := utils.RandomHex(32)
+	if err != nil {
+		f.fail(err)
+	}
+	var total uint64
+	for _, amount := range satoshis {
+		total += amount
+	}
+	tx := bt.NewTx()
+	if err = tx.From(parentID, 0, f.Destinations[0].LockingScript, total); err != nil {
+		f.fail(err)
+	}
+	for index, amount := range satoshis {
+		var lockingScript *bscript.Script
+		if lockingScript, err = bscript.NewFromHexString(
+			f.Destinations[index%len(f.Destinations)].LockingScript,
+		); err != nil {
+			f.fail(err)
+		}
+		tx.AddOutput(&bt.Output{LockingScript: lockingScript, Satoshis: amount})
+	}
+
+	f.WithRecordedTransaction(tx.String())
+
+	// Get the created utxos
+	for index := range satoshis {
+		var utxo *Utxo
+		if utxo, err = f.client.GetUtxoByTransactionID(f.ctx, tx.TxID(), uint32(index)); err != nil {
+			f.fail(err)
+		}
+		f.Utxos = append(f.Utxos, utxo)
+	}
+	return f.refreshXpub()
+}
+
+// WithRecordedTransaction will record the transaction (the outputs to known destinations become utxos)
+func (f *Fixtures) WithRecordedTransaction(txHex string) *Fixtures {
+	f.t.Helper()
+
+	transaction, err := f.client.RecordRawTransaction(f.ctx, txHex)
+	if err != nil {
+		f.fail(err)
+	}
+	f.Transactions = append(f.Transactions, transaction)
+	return f.refreshXpub()
+}
+
+// WithDraft will create a new draft transaction for the xPub (the utxos are reserved)
+func (f *Fixtures) WithDraft(config *TransactionConfig) *Fixtures {
+	f.t.Helper()
+	f.requireXpub()
+
+	draft, err := f.client.NewTransaction(f.ctx, f.RawXpub, config)
+	if err != nil {
+		f.fail(err)
+	}
+	f.Drafts = append(f.Drafts, draft)
+	return f.refreshXpub()
+}
+
+// requireXpub will fail the test if WithXpub() was not called
+func (f *Fixtures) requireXpub() {
+	f.t.Helper()
+	if f.Xpub == nil {
+		f.fail(ErrMissingXpub)
+	}
+}
+
+// refreshXpub will reload the xPub (balances and derivation numbers)
+func (f *Fixtures) refreshXpub() *Fixtures {
+	f.t.Helper()
+	if f.Xpub == nil {
+		return f
+	}
+
+	// Not from the cache, the balances need to be current
+	xPub, err := getXpubByID(f.ctx, f.Xpub.ID, f.client.DefaultModelOptions()...)
+	if err != nil {
+		f.fail(err)
+	} else if xPub == nil {
+		f.fail(ErrMissingXpub)
+	}
+	f.Xpub = xPub
+	return f
+}
+
+// fail will fail the test with the error
+func (f *Fixtures) fail(err error) {
+	f.t.Helper()
+	f.t.Fatalf("fixtures: %s", err.Error())
+}
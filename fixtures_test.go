@@ -0,0 +1,142 @@
+package bux
+
+import (
+	"fmt"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/BuxOrg/bux/chainstate"
+	"github.com/BuxOrg/bux/notifications"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeTestingT will capture the failures of the fixtures
+type fakeTestingT struct {
+	failure string
+}
+
+func (f *fakeTestingT) Cleanup(func()) {}
+
+func (f *fakeTestingT) Fatalf(format string, args ...interface{}) {
+	f.failure = fmt.Sprintf(format, args...)
+	runtime.Goexit()
+}
+
+func (f *fakeTestingT) Helper() {}
+
+// TestFixtures will test the fixtures builder
+func TestFixtures(t *testing.T) {
+	t.Parallel()
+
+	t.Run("xpub, destinations and utxos", func(t *testing.T) {
+		_, client, deferMe := CreateTestSQLiteClient(t, false, true,
+			WithCustomTaskManager(&taskManagerMockBase{}),
+			WithCustomChainstate(chainstate.NewMockClient()),
+		)
+		defer deferMe()
+
+		fixtures := NewFixtures(t, client).WithXpub(0).WithDestinations(2).WithUtxos(1000, 2000, 3000)
+		require.NotNil(t, fixtures.Xpub)
+		require.NotNil(t, fixtures.HDKey)
+		assert.Equal(t, uint64(6000), fixtures.Xpub.CurrentBalance)
+		assert.Equal(t, uint32(2), fixtures.Xpub.NextExternalNum)
+		require.Len(t, fixtures.Destinations, 2)
+		require.Len(t, fixtures.Transactions, 1)
+		require.Len(t, fixtures.Utxos, 3)
+		assert.Equal(t, fixtures.Destinations[0].LockingScript, fixtures.Utxos[0].ScriptPubKey)
+		assert.Equal(t, fixtures.Destinations[1].LockingScript, fixtures.Utxos[1].ScriptPubKey)
+		assert.Equal(t, fixtures.Destinations[0].LockingScript, fixtures.Utxos[2].ScriptPubKey)
+		assert.Equal(t, fixtures.Transactions[0].ID, fixtures.Utxos[2].TransactionID)
+		assert.Equal(t, uint64(3000), fixtures.Utxos[2].Satoshis)
+	})
+
+	t.Run("starting balance", func(t *testing.T) {
+		_, client, deferMe := CreateTestSQLiteClient(t, false, true, WithCustomTaskManager(&taskManagerMockBase{}))
+		defer deferMe()
+
+		fixtures := NewFixtures(t, client).WithXpub(5000).WithUtxos(1000)
+		assert.Equal(t, uint64(6000), fixtures.Xpub.CurrentBalance)
+		assert.Len(t, fixtures.Destinations, 1)
+	})
+
+	t.Run("open drafts are canceled", func(t *testing.T) {
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, true, WithCustomTaskManager(&taskManagerMockBase{}))
+		defer deferMe()
+
+		var fixtures *Fixtures
+		t.Run("draft", func(t *testing.T) {
+			fixtures = NewFixtures(t, client).WithXpub(0).WithUtxos(10000).WithDraft(&TransactionConfig{
+				Outputs: []*TransactionOutput{{
+					To:       testExternalAddress,
+					Satoshis: 1000,
+				}},
+			})
+			require.Len(t, fixtures.Drafts, 1)
+
+			utxo, err := client.GetUtxoByTransactionID(ctx, fixtures.Utxos[0].TransactionID, 0)
+			require.NoError(t, err)
+			assert.Equal(t, fixtures.Drafts[0].ID, utxo.DraftID.String)
+		})
+		require.NotNil(t, fixtures)
+
+		utxo, err := client.GetUtxoByTransactionID(ctx, fixtures.Utxos[0].TransactionID, 0)
+		require.NoError(t, err)
+		assert.False(t, utxo.DraftID.Valid)
+
+		draft, err := getDraftTransactionID(ctx, fixtures.Xpub.ID, fixtures.Drafts[0].ID, client.DefaultModelOptions()...)
+		require.NoError(t, err)
+		require.NotNil(t, draft)
+		assert.Equal(t, DraftStatusCanceled, draft.Status)
+	})
+
+	t.Run("closed before the client", func(t *testing.T) {
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, true, WithCustomTaskManager(&taskManagerMockBase{}))
+		defer deferMe()
+
+		fixtures := NewFixtures(t, client).WithXpub(0).WithUtxos(10000).WithDraft(&TransactionConfig{
+			Outputs: []*TransactionOutput{{
+				To:       testExternalAddress,
+				Satoshis: 1000,
+			}},
+		})
+		fixtures.Close()
+		fixtures.Close()
+
+		draft, err := getDraftTransactionID(ctx, fixtures.Xpub.ID, fixtures.Drafts[0].ID, client.DefaultModelOptions()...)
+		require.NoError(t, err)
+		require.NotNil(t, draft)
+		assert.Equal(t, DraftStatusCanceled, draft.Status)
+	})
+
+	t.Run("missing xpub", func(t *testing.T) {
+		_, client, deferMe := CreateTestSQLiteClient(t, false, true, WithCustomTaskManager(&taskManagerMockBase{}))
+		defer deferMe()
+
+		fakeT := &fakeTestingT{}
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			NewFixtures(fakeT, client).WithDestinations(1)
+		}()
+		<-done
+		assert.Contains(t, fakeT.failure, ErrMissingXpub.Error())
+	})
+
+	t.Run("notifications mock", func(t *testing.T) {
+		_, client, deferMe := CreateTestSQLiteClient(t, false, true, WithCustomTaskManager(&taskManagerMockBase{}))
+		defer deferMe()
+
+		mock := notifications.NewMockClient()
+		client.SetNotificationsClient(mock)
+
+		fixtures := NewFixtures(t, client).WithXpub(0).WithDestinations(1)
+
+		events, ok := mock.WaitForEvents(1, 5*time.Second)
+		require.True(t, ok)
+		assert.Equal(t, notifications.EventTypeCreate, events[0].EventType)
+		assert.Equal(t, fixtures.Destinations[0].ID, events[0].ID)
+		assert.Equal(t, notifications.SchemaVersionV1, events[0].SchemaVersion)
+	})
+}
@@ -15,9 +15,9 @@ require (
 	github.com/fergusstrange/embedded-postgres v1.24.0
 	github.com/go-redis/redis/v8 v8.11.5
 	github.com/go-redis/redis_rate/v9 v9.1.2
+	github.com/go-resty/resty/v2 v2.9.1
 	github.com/gomodule/redigo v2.0.0+incompatible
 	github.com/jarcoal/httpmock v1.3.1
-	github.com/korovkin/limiter v0.0.0-20230307205149-3d4b2b34c99d
 	github.com/libsv/go-bc v0.1.18
 	github.com/libsv/go-bk v0.1.6
 	github.com/libsv/go-bt v1.0.8
@@ -36,6 +36,7 @@ require (
 	github.com/tylertreat/BoomFilters v0.0.0-20210315201527-1a82519a3e43
 	github.com/vmihailenco/taskq/v3 v3.2.9
 	go.mongodb.org/mongo-driver v1.12.1
+	golang.org/x/sync v0.4.0
 	gorm.io/gorm v1.25.5
 )
 
@@ -59,7 +60,6 @@ require (
 	github.com/dolthub/jsonpath v0.0.2-0.20230525180605-8dc13778fd72 // indirect
 	github.com/dolthub/vitess v0.0.0-20230823204737-4a21a94e90c3 // indirect
 	github.com/go-kit/kit v0.13.0 // indirect
-	github.com/go-resty/resty/v2 v2.9.1 // indirect
 	github.com/go-sql-driver/mysql v1.7.1 // indirect
 	github.com/gocraft/dbr/v2 v2.7.6 // indirect
 	github.com/gojektech/heimdall/v6 v6.1.0 // indirect
@@ -119,7 +119,6 @@ require (
 	golang.org/x/crypto v0.14.0 // indirect
 	golang.org/x/mod v0.13.0 // indirect
 	golang.org/x/net v0.17.0 // indirect
-	golang.org/x/sync v0.4.0 // indirect
 	golang.org/x/sys v0.13.0 // indirect
 	golang.org/x/text v0.13.0 // indirect
 	golang.org/x/tools v0.14.0 // indirect
@@ -0,0 +1,41 @@
+package bux
+
+import (
+	"context"
+	"time"
+)
+
+// HealthCheck is the health of the client (IE: for the health endpoint of a server)
+type HealthCheck struct {
+	CheckedAt                 time.Time        `json:"checked_at" toml:"checked_at" yaml:"checked_at"`                                                    // When the health was checked
+	DeadLetteredNotifications int64            `json:"dead_lettered_notifications" toml:"dead_lettered_notifications" yaml:"dead_lettered_notifications"` // Notification events that exhausted the retries
+	LocalLockFallbacks        uint64           `json:"local_lock_fallbacks" toml:"local_lock_fallbacks" yaml:"local_lock_fallbacks"`                      // Locks taken locally (cachestore down)
+	SyncQueues                *SyncQueueDepths `json:"sync_queues" toml:"sync_queues" yaml:"sync_queues"`                                                 // Depths of the sync queues
+	Tasks                     []*TaskHealth    `json:"tasks" toml:"tasks" yaml:"tasks"`                                                                   // Health of the registered tasks
+}
+
+// HealthCheck will return the health of the client: the sync queues, the tasks and the dead-lettered notifications
+//
+// A growing number of dead letters means the webhook receiver is failing (see GetDeadLetteredNotifications)
+func (c *Client) HealthCheck(ctx context.Context) (*HealthCheck, error) {
+
+	// Check for existing NewRelic transaction
+	ctx = c.GetOrStartTxn(ctx, "health_check")
+
+	health := &HealthCheck{
+		CheckedAt:          time.Now().UTC(),
+		LocalLockFallbacks: c.LocalLockFallbacks(),
+		Tasks:              c.TaskHealth(),
+	}
+
+	var err error
+	if health.SyncQueues, err = c.GetSyncQueueDepths(ctx); err != nil {
+		return nil, err
+	}
+	if health.DeadLetteredNotifications, err = getDeadLetteredNotificationsCount(
+		ctx, c.DefaultModelOptions()...,
+	); err != nil {
+		return nil, err
+	}
+	return health, nil
+}
@@ -0,0 +1,28 @@
+package bux
+
+import (
+	"github.com/BuxOrg/bux/utils"
+)
+
+// randomIDGenerator is the default IDGenerator (random 32 byte hex, IE: 64 characters)
+type randomIDGenerator struct{}
+
+// NewID will return a new random hex ID
+func (g *randomIDGenerator) NewID() (string, error) {
+	return utils.RandomHex(32)
+}
+
+// newModelID will generate a new (non-content-derived) ID for the model
+//
+// The client IDGenerator is used if set, otherwise falls back to a random hex ID
+func (m *Model) newModelID() string {
+	if c := m.Client(); c != nil {
+		if generator := c.IDGenerator(); generator != nil {
+			if id, err := generator.NewID(); err == nil && len(id) > 0 {
+				return id
+			}
+		}
+	}
+	id, _ := utils.RandomHex(32)
+	return id
+}
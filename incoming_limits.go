@@ -0,0 +1,147 @@
+package bux
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/BuxOrg/bux/notifications"
+	"github.com/libsv/go-bt/v2"
+	zLogger "github.com/mrz1836/go-logger"
+)
+
+// Sources of the incoming transactions (checked against the limits)
+const (
+	incomingSourceMonitor = "monitor"
+	incomingSourcePaymail = "paymail"
+)
+
+// IncomingTransactionLimits are the limits of the incoming transactions (paymail receive and monitor)
+//
+// A limit of 0 is not checked
+type IncomingTransactionLimits struct {
+	MaxInputs     int `json:"max_inputs" toml:"max_inputs" yaml:"max_inputs"`                // Maximum number of inputs
+	MaxOutputs    int `json:"max_outputs" toml:"max_outputs" yaml:"max_outputs"`             // Maximum number of outputs
+	MaxScriptSize int `json:"max_script_size" toml:"max_script_size" yaml:"max_script_size"` // Maximum size of an input or output script (bytes)
+	MaxSize       int `json:"max_size" toml:"max_size" yaml:"max_size"`                      // Maximum size of the raw transaction (bytes)
+}
+
+// defaultIncomingTransactionLimits will return the default (generous) limits
+func defaultIncomingTransactionLimits() *IncomingTransactionLimits {
+	return &IncomingTransactionLimits{
+		MaxInputs:     defaultIncomingMaxInputs,
+		MaxOutputs:    defaultIncomingMaxOutputs,
+		MaxScriptSize: defaultIncomingMaxScriptSize,
+		MaxSize:       defaultIncomingMaxSize,
+	}
+}
+
+// check will return a typed error if the transaction exceeds the limits (and the parsed transaction if it was parsed)
+//
+// The size is checked before the transaction is parsed, invalid transactions are not checked
+func (l *IncomingTransactionLimits) check(txHex string) (*bt.Tx, error) {
+	size := len(txHex) / 2
+	if l.MaxSize > 0 && size > l.MaxSize {
+		return nil, fmt.Errorf("%w: %d bytes (max %d)", ErrIncomingTransactionTooLarge, size, l.MaxSize)
+	}
+
+	// Invalid transactions are rejected by the regular validation
+	tx, err := bt.NewTxFromString(txHex)
+	if err != nil {
+		return nil, nil //nolint:nilerr // not a limit violation
+	}
+	if l.MaxInputs > 0 && len(tx.Inputs) > l.MaxInputs {
+		return tx, fmt.Errorf("%w: %d inputs (max %d)", ErrIncomingTransactionTooManyInputs, len(tx.Inputs), l.MaxInputs)
+	}
+	if l.MaxOutputs > 0 && len(tx.Outputs) > l.MaxOutputs {
+		return tx, fmt.Errorf("%w: %d outputs (max %d)", ErrIncomingTransactionTooManyOutputs, len(tx.Outputs), l.MaxOutputs)
+	}
+	if l.MaxScriptSize > 0 {
+		for index, input := range tx.Inputs {
+			if input.UnlockingScript != nil && len(*input.UnlockingScript) > l.MaxScriptSize {
+				return tx, fmt.Errorf("%w: input %d is %d bytes (max %d)",
+					ErrIncomingTransactionScriptTooLarge, index, len(*input.UnlockingScript), l.MaxScriptSize)
+			}
+		}
+		for index, output := range tx.Outputs {
+			if output.LockingScript != nil && len(*output.LockingScript) > l.MaxScriptSize {
+				return tx, fmt.Errorf("%w: output %d is %d bytes (max %d)",
+					ErrIncomingTransactionScriptTooLarge, index, len(*output.LockingScript), l.MaxScriptSize)
+			}
+		}
+	}
+	return tx, nil
+}
+
+// incomingTransactionChecker rejects the incoming transactions exceeding the limits, implemented by Client
+//
+// The incoming transactions are not limited with other implementations of the client
+type incomingTransactionChecker interface {
+	checkIncomingTransaction(ctx context.Context, txHex, source string) error
+}
+
+// checkIncomingTransaction will reject the incoming transaction if it exceeds the limits (before it is persisted)
+//
+// A rejected transaction is logged and fires the EventTypeIncomingTransactionRejected notification
+func (c *Client) checkIncomingTransaction(ctx context.Context, txHex, source string) error {
+	tx, err := c.options.incomingLimits.check(txHex)
+	if err == nil {
+		return nil
+	}
+
+	event := &notifications.IncomingTransactionRejectedEventV1{
+		Reason: err.Error(),
+		Size:   len(txHex) / 2,
+		Source: source,
+	}
+	if tx != nil {
+		event.TxID = tx.TxID()
+	}
+	c.Logger().Warn(ctx, fmt.Sprintf("[LIMITS] rejected %s transaction %s: %s", source, event.TxID, event.Reason))
+
+	// Notify in the background (there is no model for the rejected transaction)
+	if n := c.Notifications(); n != nil && !isNotifySkipped(ctx, nil) {
+		c.options.incomingRejections.notify(ctx, c.Logger(), n, event)
+	}
+	return err
+}
+
+// incomingRejectionNotifier delivers the notifications of the rejected incoming transactions in the background
+//
+// At most defaultIncomingRejectNotifiers are delivered at once, the others are dropped (a flood of rejected
+// transactions does not start a goroutine each). Close waits for the running deliveries.
+type incomingRejectionNotifier struct {
+	running sync.WaitGroup // Running deliveries (awaited on Close)
+	slots   chan struct{}  // One slot per running delivery
+}
+
+// notify will deliver the rejection event in the background (dropped and logged if every slot is taken)
+//
+// The context is detached from the caller (the request is answered before the delivery) and bounded by
+// defaultIncomingRejectTimeout
+func (r *incomingRejectionNotifier) notify(ctx context.Context, logger zLogger.GormLoggerInterface,
+	n notifications.ClientInterface, event *notifications.IncomingTransactionRejectedEventV1,
+) {
+	select {
+	case r.slots <- struct{}{}:
+	default:
+		logger.Warn(ctx, "[LIMITS] dropped the notification of rejected transaction "+event.TxID+": too many deliveries")
+		return
+	}
+
+	r.running.Add(1)
+	go func() {
+		defer func() {
+			<-r.slots
+			r.running.Done()
+		}()
+		notifyCtx, cancel := context.WithTimeout(context.Background(), defaultIncomingRejectTimeout)
+		defer cancel()
+		if err := n.Notify(
+			notifyCtx, string(ModelTransaction), notifications.EventTypeIncomingTransactionRejected,
+			event, event.TxID,
+		); err != nil {
+			logger.Error(notifyCtx, "failed notifying about rejected transaction: "+err.Error())
+		}
+	}()
+}
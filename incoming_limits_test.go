@@ -0,0 +1,153 @@
+package bux
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/BuxOrg/bux/notifications"
+	"github.com/BuxOrg/bux/utils"
+	"github.com/bitcoin-sv/go-paymail"
+	zLogger "github.com/mrz1836/go-logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestIncomingTransactionLimits_check will test the method check()
+func TestIncomingTransactionLimits_check(t *testing.T) {
+	t.Parallel()
+
+	txHex := monitoredTxHex(t, []string{testLockingScript, testLockingScript}, []uint64{1000, 2000})
+
+	t.Run("defaults", func(t *testing.T) {
+		tx, err := defaultIncomingTransactionLimits().check(txHex)
+		require.NoError(t, err)
+		assert.NotNil(t, tx)
+	})
+
+	t.Run("size is checked before parsing", func(t *testing.T) {
+		tx, err := (&IncomingTransactionLimits{MaxSize: 10}).check(strings.Repeat("zz", 11))
+		assert.ErrorIs(t, err, ErrIncomingTransactionTooLarge)
+		assert.Nil(t, tx)
+	})
+
+	t.Run("inputs", func(t *testing.T) {
+		_, err := (&IncomingTransactionLimits{MaxInputs: 1}).check(txHex)
+		require.NoError(t, err)
+		_, err = (&IncomingTransactionLimits{MaxInputs: 0, MaxOutputs: 1}).check(txHex)
+		assert.ErrorIs(t, err, ErrIncomingTransactionTooManyOutputs)
+	})
+
+	t.Run("outputs", func(t *testing.T) {
+		tx, err := (&IncomingTransactionLimits{MaxOutputs: 1}).check(txHex)
+		assert.ErrorIs(t, err, ErrIncomingTransactionTooManyOutputs)
+		assert.NotNil(t, tx)
+	})
+
+	t.Run("script size", func(t *testing.T) {
+		_, err := (&IncomingTransactionLimits{MaxScriptSize: len(testLockingScript) / 2}).check(txHex)
+		require.NoError(t, err)
+		_, err = (&IncomingTransactionLimits{MaxScriptSize: 10}).check(txHex)
+		assert.ErrorIs(t, err, ErrIncomingTransactionScriptTooLarge)
+	})
+
+	t.Run("invalid transaction is not a violation", func(t *testing.T) {
+		tx, err := (&IncomingTransactionLimits{MaxOutputs: 1}).check("invalid")
+		require.NoError(t, err)
+		assert.Nil(t, tx)
+	})
+}
+
+// TestClient_checkIncomingTransaction will test rejecting the incoming transactions (monitor and paymail)
+func TestClient_checkIncomingTransaction(t *testing.T) {
+	t.Parallel()
+
+	newClient := func(t *testing.T) (context.Context, ClientInterface, *notifications.MockClient, *Fixtures, func()) {
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, true,
+			WithCustomTaskManager(&taskManagerMockBase{}),
+			WithIncomingTransactionLimits(&IncomingTransactionLimits{MaxOutputs: 1}),
+		)
+		fixtures := NewFixtures(t, client).WithXpub(0).WithDestinations(1)
+		mock := notifications.NewMockClient()
+		client.SetNotificationsClient(mock)
+		return ctx, client, mock, fixtures, deferMe
+	}
+
+	t.Run("monitor", func(t *testing.T) {
+		ctx, client, mock, fixtures, deferMe := newClient(t)
+		defer deferMe()
+
+		lockingScript := fixtures.Destinations[0].LockingScript
+		txHex := monitoredTxHex(t, []string{lockingScript, lockingScript}, []uint64{1000, 2000})
+		transaction, err := recordMonitoredTransaction(ctx, client, txHex)
+		require.ErrorIs(t, err, ErrIncomingTransactionTooManyOutputs)
+		assert.Nil(t, transaction)
+
+		// Not persisted
+		txID, err := utils.GetTransactionIDFromHex(txHex)
+		require.NoError(t, err)
+		_, err = client.GetTransaction(ctx, "", txID)
+		assert.ErrorIs(t, err, ErrMissingTransaction)
+
+		events := eventsOfType(mock, notifications.EventTypeIncomingTransactionRejected, 1)
+		require.Len(t, events, 1)
+		assert.Equal(t, txID, events[0].ID)
+		payload, ok := events[0].Model.(*notifications.IncomingTransactionRejectedEventV1)
+		require.True(t, ok)
+		assert.Equal(t, incomingSourceMonitor, payload.Source)
+		assert.Contains(t, payload.Reason, ErrIncomingTransactionTooManyOutputs.Error())
+
+		// Within the limits
+		txHex = monitoredTxHex(t, []string{lockingScript}, []uint64{1000})
+		transaction, err = recordMonitoredTransaction(ctx, client, txHex)
+		require.NoError(t, err)
+		assert.NotNil(t, transaction)
+	})
+
+	t.Run("paymail receive", func(t *testing.T) {
+		ctx, client, mock, fixtures, deferMe := newClient(t)
+		defer deferMe()
+
+		lockingScript := fixtures.Destinations[0].LockingScript
+		txHex := monitoredTxHex(t, []string{lockingScript, lockingScript}, []uint64{1000, 2000})
+
+		provider := &PaymailDefaultServiceProvider{client: client}
+		payload, err := provider.RecordTransaction(ctx, &paymail.P2PTransaction{
+			Hex:      txHex,
+			MetaData: &paymail.P2PMetaData{},
+		}, nil)
+		require.ErrorIs(t, err, ErrIncomingTransactionTooManyOutputs)
+		assert.Nil(t, payload)
+
+		events := eventsOfType(mock, notifications.EventTypeIncomingTransactionRejected, 1)
+		require.Len(t, events, 1)
+		event, ok := events[0].Model.(*notifications.IncomingTransactionRejectedEventV1)
+		require.True(t, ok)
+		assert.Equal(t, incomingSourcePaymail, event.Source)
+	})
+}
+
+// Test_incomingRejectionNotifier will test the bounded delivery of the rejection notifications
+func Test_incomingRejectionNotifier(t *testing.T) {
+	t.Parallel()
+
+	logger := zLogger.NewGormLogger(false, 4)
+	event := &notifications.IncomingTransactionRejectedEventV1{TxID: testTxID, Source: incomingSourceMonitor}
+
+	t.Run("delivered", func(t *testing.T) {
+		mock := notifications.NewMockClient()
+		notifier := &incomingRejectionNotifier{slots: make(chan struct{}, 1)}
+		notifier.notify(context.Background(), logger, mock, event)
+		notifier.running.Wait()
+		assert.Len(t, eventsOfType(mock, notifications.EventTypeIncomingTransactionRejected, 1), 1)
+	})
+
+	t.Run("dropped when every slot is taken", func(t *testing.T) {
+		mock := notifications.NewMockClient()
+		notifier := &incomingRejectionNotifier{slots: make(chan struct{}, 1)}
+		notifier.slots <- struct{}{}
+		notifier.notify(context.Background(), logger, mock, event)
+		notifier.running.Wait()
+		assert.Empty(t, mock.Events())
+	})
+}
@@ -2,6 +2,7 @@ package bux
 
 import (
 	"context"
+	"io"
 	"net/http"
 	"time"
 
@@ -23,6 +24,8 @@ type AccessKeyService interface {
 		queryParams *datastore.QueryParams, opts ...ModelOps) ([]*AccessKey, error)
 	GetAccessKeysCount(ctx context.Context, metadata *Metadata,
 		conditions *map[string]interface{}, opts ...ModelOps) (int64, error)
+	GetAccessKeysPaged(ctx context.Context, metadata *Metadata, conditions *map[string]interface{},
+		queryParams *datastore.QueryParams, opts ...ModelOps) (*PagedResult[*AccessKey], error)
 	GetAccessKeysByXPubID(ctx context.Context, xPubID string, metadata *Metadata, conditions *map[string]interface{},
 		queryParams *datastore.QueryParams, opts ...ModelOps) ([]*AccessKey, error)
 	GetAccessKeysByXPubIDCount(ctx context.Context, xPubID string, metadata *Metadata,
@@ -33,15 +36,40 @@ type AccessKeyService interface {
 
 // AdminService is the bux admin service interface comprised of all services available for admins
 type AdminService interface {
+	AdminGetDestinationByAddress(ctx context.Context, address string) (*Destination, error)
+	AdminGetDestinationByID(ctx context.Context, id string) (*Destination, error)
+	AdminGetDestinationByLockingScript(ctx context.Context, lockingScript string) (*Destination, error)
+	AdminGetTransactionByID(ctx context.Context, txID string) (*Transaction, error)
+	CompleteSyncWithProof(ctx context.Context, txID, blockHash string, blockHeight uint64,
+		proof *MerkleProof, source string) (*SyncTransaction, error)
+	GetAuditLog(ctx context.Context, conditions *map[string]interface{},
+		queryParams *datastore.QueryParams) ([]*AuditLog, error)
+	GetBroadcastReceipts(ctx context.Context, txID string) ([]*BroadcastReceipt, error)
+	GetDeadLetteredNotifications(ctx context.Context,
+		queryParams *datastore.QueryParams) ([]*NotificationDelivery, error)
+	GetNotificationDeliveries(ctx context.Context, modelID string,
+		queryParams *datastore.QueryParams) ([]*NotificationDelivery, error)
+	GetOversizedMetadataRecords(ctx context.Context, limits *MetadataLimits,
+		queryParams *datastore.QueryParams) ([]*OversizedMetadataRecord, error)
 	GetStats(ctx context.Context, opts ...ModelOps) (*AdminStats, error)
+	GetSyncQueueDepths(ctx context.Context) (*SyncQueueDepths, error)
 	GetPaymailAddresses(ctx context.Context, metadataConditions *Metadata, conditions *map[string]interface{},
 		queryParams *datastore.QueryParams, opts ...ModelOps) ([]*PaymailAddress, error)
 	GetPaymailAddressesCount(ctx context.Context, metadataConditions *Metadata,
 		conditions *map[string]interface{}, opts ...ModelOps) (int64, error)
+	GetPaymailAddressesPaged(ctx context.Context, metadataConditions *Metadata, conditions *map[string]interface{},
+		queryParams *datastore.QueryParams, opts ...ModelOps) (*PagedResult[*PaymailAddress], error)
+	GetSyncTransactionsPaged(ctx context.Context, conditions *map[string]interface{},
+		queryParams *datastore.QueryParams) (*PagedResult[*SyncTransaction], error)
 	GetXPubs(ctx context.Context, metadataConditions *Metadata,
 		conditions *map[string]interface{}, queryParams *datastore.QueryParams, opts ...ModelOps) ([]*Xpub, error)
 	GetXPubsCount(ctx context.Context, metadataConditions *Metadata,
 		conditions *map[string]interface{}, opts ...ModelOps) (int64, error)
+	HealthCheck(ctx context.Context) (*HealthCheck, error)
+	ReconcileXpub(ctx context.Context, xPubID string, opts *ReconcileOptions) (*ReconcileReport, error)
+	RedeliverNotification(ctx context.Context, eventID string) (*NotificationDelivery, error)
+	RequeueSyncTransaction(ctx context.Context, txID string) (*SyncTransaction, error)
+	VerifyAuditChain(ctx context.Context, from, to uint64) error
 }
 
 // BlockHeaderService is the block header actions
@@ -52,9 +80,12 @@ type BlockHeaderService interface {
 	GetBlockHeadersCount(ctx context.Context, metadata *Metadata, conditions *map[string]interface{},
 		opts ...ModelOps) (int64, error)
 	GetLastBlockHeader(ctx context.Context) (*BlockHeader, error)
+	GetMonitorCheckpoint(ctx context.Context) (*MonitorCheckpoint, error)
 	GetUnsyncedBlockHeaders(ctx context.Context) ([]*BlockHeader, error)
+	MonitorCatchUp(ctx context.Context, fromHeight uint32) (*MonitorCatchUpResult, error)
 	RecordBlockHeader(ctx context.Context, hash string, height uint32, bh bc.BlockHeader,
 		opts ...ModelOps) (*BlockHeader, error)
+	SyncBlockHeaders(ctx context.Context) (*BlockHeaderSyncResult, error)
 }
 
 // ClientService is the client related services
@@ -63,7 +94,9 @@ type ClientService interface {
 	Cluster() cluster.ClientInterface
 	Chainstate() chainstate.ClientInterface
 	Datastore() datastore.ClientInterface
+	GetProviderStatus(ctx context.Context, paymailHosts ...string) []*chainstate.ProviderStatus
 	HTTPClient() HTTPInterface
+	IDGenerator() IDGenerator
 	Logger() zLogger.GormLoggerInterface
 	Notifications() notifications.ClientInterface
 	PaymailClient() paymail.ClientInterface
@@ -72,6 +105,7 @@ type ClientService interface {
 
 // DestinationService is the destination actions
 type DestinationService interface {
+	FixDestinationIndexCollisions(ctx context.Context, xPubKey string) ([]*DestinationIndexCorrection, error)
 	GetDestinationByID(ctx context.Context, xPubID, id string) (*Destination, error)
 	GetDestinationByAddress(ctx context.Context, xPubID, address string) (*Destination, error)
 	GetDestinationByLockingScript(ctx context.Context, xPubID, lockingScript string) (*Destination, error)
@@ -79,6 +113,8 @@ type DestinationService interface {
 		queryParams *datastore.QueryParams, opts ...ModelOps) ([]*Destination, error)
 	GetDestinationsCount(ctx context.Context, metadata *Metadata,
 		conditions *map[string]interface{}, opts ...ModelOps) (int64, error)
+	GetDestinationsPaged(ctx context.Context, metadata *Metadata, conditions *map[string]interface{},
+		queryParams *datastore.QueryParams, opts ...ModelOps) (*PagedResult[*Destination], error)
 	GetDestinationsByXpubID(ctx context.Context, xPubID string, usingMetadata *Metadata, conditions *map[string]interface{},
 		queryParams *datastore.QueryParams) ([]*Destination, error)
 	GetDestinationsByXpubIDCount(ctx context.Context, xPubID string, usingMetadata *Metadata,
@@ -87,6 +123,8 @@ type DestinationService interface {
 		opts ...ModelOps) (*Destination, error)
 	NewDestinationForLockingScript(ctx context.Context, xPubID, lockingScript string, monitor bool,
 		opts ...ModelOps) (*Destination, error)
+	RevokeDestination(ctx context.Context, xPubID, id string) (*Destination, error)
+	UnrevokeDestination(ctx context.Context, xPubID, id string) (*Destination, error)
 	UpdateDestinationMetadataByID(ctx context.Context, xPubID, id string, metadata Metadata) (*Destination, error)
 	UpdateDestinationMetadataByLockingScript(ctx context.Context, xPubID,
 		lockingScript string, metadata Metadata) (*Destination, error)
@@ -100,6 +138,15 @@ type DraftTransactionService interface {
 		queryParams *datastore.QueryParams, opts ...ModelOps) ([]*DraftTransaction, error)
 	GetDraftTransactionsCount(ctx context.Context, metadata *Metadata,
 		conditions *map[string]interface{}, opts ...ModelOps) (int64, error)
+	GetSigningInstructions(ctx context.Context, xPubID, draftID string) (*SigningInstructions, error)
+}
+
+// FeeCalculator is the interface for calculating the fee of the draft transactions (IE: flat or size-tiered fees)
+//
+// The draft builder calls it while reserving the utxos (per reserved input) and again when adding the change
+// outputs. A fee below the fee unit of the draft (the miners' fee unit by default) is raised to it
+type FeeCalculator interface {
+	CalculateFee(ctx context.Context, summary *DraftSummary) (uint64, error)
 }
 
 // HTTPInterface is the HTTP client interface
@@ -107,6 +154,11 @@ type HTTPInterface interface {
 	Do(req *http.Request) (*http.Response, error)
 }
 
+// IDGenerator is the interface for generating new (non-content-derived) model IDs
+type IDGenerator interface {
+	NewID() (string, error)
+}
+
 // ModelService is the "model" related services
 type ModelService interface {
 	AddModels(ctx context.Context, autoMigrate bool, models ...interface{}) error
@@ -116,13 +168,17 @@ type ModelService interface {
 
 // PaymailService is the paymail actions & services
 type PaymailService interface {
+	ActivatePaymailAddress(ctx context.Context, address, signature string, opts ...ModelOps) (*PaymailAddress, error)
 	DeletePaymailAddress(ctx context.Context, address string, opts ...ModelOps) error
 	GetPaymailConfig() *PaymailServerOptions
 	GetPaymailAddress(ctx context.Context, address string, opts ...ModelOps) (*PaymailAddress, error)
+	GetPaymailAddressDisplay(ctx context.Context, address, profile string, opts ...ModelOps) (interface{}, error)
 	GetPaymailAddressesByXPubID(ctx context.Context, xPubID string, metadataConditions *Metadata,
 		conditions *map[string]interface{}, queryParams *datastore.QueryParams) ([]*PaymailAddress, error)
 	NewPaymailAddress(ctx context.Context, key, address, publicName,
 		avatar string, opts ...ModelOps) (*PaymailAddress, error)
+	SetPaymailDomainAllowList(domains ...string)
+	SetPaymailDomainDenyList(domains ...string)
 	UpdatePaymailAddress(ctx context.Context, address, publicName,
 		avatar string, opts ...ModelOps) (*PaymailAddress, error)
 	UpdatePaymailAddressMetadata(ctx context.Context, address string,
@@ -131,45 +187,88 @@ type PaymailService interface {
 
 // TransactionService is the transaction actions
 type TransactionService interface {
+	AddTransactionNote(ctx context.Context, xPubID, txID, author, text string, opts ...ModelOps) (*TransactionNote, error)
+	ForEachTransaction(ctx context.Context, xPubID string, conditions *map[string]interface{}, batchSize int,
+		fn func(transaction *Transaction) error) error
+	GetPaymentAcknowledgment(ctx context.Context, xPubID, txID string) (*PaymentAcknowledgment, error)
+	GetPaymentProofBundle(ctx context.Context, xPubID, txID string) (*PaymentProofBundle, error)
 	GetTransaction(ctx context.Context, xPubID, txID string) (*Transaction, error)
 	GetTransactionByID(ctx context.Context, txID string) (*Transaction, error)
 	GetTransactionByHex(ctx context.Context, hex string) (*Transaction, error)
+	GetTransactionDisplay(ctx context.Context, xPubID, txID, profile string) (interface{}, error)
+	GetTransactionNotes(ctx context.Context, xPubID, txID string) ([]*TransactionNote, error)
+	GetTransactionWithAncestry(ctx context.Context, xPubID, txID string, maxDepth int) (*TransactionAncestry, error)
 	GetTransactions(ctx context.Context, metadata *Metadata, conditions *map[string]interface{},
 		queryParams *datastore.QueryParams, opts ...ModelOps) ([]*Transaction, error)
 	GetTransactionsCount(ctx context.Context, metadata *Metadata,
 		conditions *map[string]interface{}, opts ...ModelOps) (int64, error)
+	GetTransactionsPaged(ctx context.Context, metadata *Metadata, conditions *map[string]interface{},
+		queryParams *datastore.QueryParams, opts ...ModelOps) (*PagedResult[*Transaction], error)
 	GetTransactionsByXpubID(ctx context.Context, xPubID string, metadata *Metadata, conditions *map[string]interface{},
 		queryParams *datastore.QueryParams) ([]*Transaction, error)
 	GetTransactionsByXpubIDCount(ctx context.Context, xPubID string, metadata *Metadata,
 		conditions *map[string]interface{}) (int64, error)
+	ImportTransactionByID(ctx context.Context, txID string, opts ...ModelOps) (*Transaction, error)
+	NewInternalTransferDraft(ctx context.Context, fromXpubKey, toXpubID string, satoshis uint64,
+		opts ...ModelOps) (*DraftTransaction, error)
 	NewTransaction(ctx context.Context, rawXpubKey string, config *TransactionConfig,
 		opts ...ModelOps) (*DraftTransaction, error)
+	RecordSignedDraft(ctx context.Context, xPubID, draftID, signedHex string, opts ...ModelOps) (*Transaction, error)
 	RecordTransaction(ctx context.Context, xPubKey, txHex, draftID string,
 		opts ...ModelOps) (*Transaction, error)
 	RecordRawTransaction(ctx context.Context, txHex string, opts ...ModelOps) (*Transaction, error)
+	RecordTransactions(ctx context.Context, xPubKey string, hexes []string,
+		opts ...ModelOps) ([]*RecordTransactionResult, error)
+	ResolveOutput(ctx context.Context, destination string) (*OutputResolution, error)
+	SearchTransactions(ctx context.Context, xPubID string, filter *TransactionFilter,
+		queryParams *datastore.QueryParams) ([]*Transaction, error)
+	SendToRecipients(ctx context.Context, xPubKey string, recipients []*TransactionOutput,
+		signer TransactionSigner, opts ...ModelOps) (*Transaction, error)
+	UpdateSyncTransactionConfig(ctx context.Context, txID string,
+		changes *SyncConfigChanges) (*SyncTransaction, error)
 	UpdateTransactionMetadata(ctx context.Context, xPubID, id string, metadata Metadata) (*Transaction, error)
+	UpdateTransactionNote(ctx context.Context, xPubID, noteID, author, text string) (*TransactionNote, error)
 	recordTxHex(ctx context.Context, txHex string, opts ...ModelOps) (*Transaction, error)
 	RevertTransaction(ctx context.Context, id string) error
 }
 
 // UTXOService is the utxo actions
 type UTXOService interface {
+	ForEachUtxo(ctx context.Context, xPubID string, conditions *map[string]interface{}, batchSize int,
+		fn func(utxo *Utxo) error) error
+	FreezeUtxo(ctx context.Context, txID string, outputIndex uint32, reason, frozenBy string) (*Utxo, error)
 	GetUtxo(ctx context.Context, xPubKey, txID string, outputIndex uint32) (*Utxo, error)
 	GetUtxoByTransactionID(ctx context.Context, txID string, outputIndex uint32) (*Utxo, error)
 	GetUtxos(ctx context.Context, metadata *Metadata, conditions *map[string]interface{},
 		queryParams *datastore.QueryParams, opts ...ModelOps) ([]*Utxo, error)
 	GetUtxosCount(ctx context.Context, metadata *Metadata,
 		conditions *map[string]interface{}, opts ...ModelOps) (int64, error)
+	GetUtxosPaged(ctx context.Context, metadata *Metadata, conditions *map[string]interface{},
+		queryParams *datastore.QueryParams, opts ...ModelOps) (*PagedResult[*Utxo], error)
 	GetUtxosByXpubID(ctx context.Context, xPubID string, metadata *Metadata, conditions *map[string]interface{},
 		queryParams *datastore.QueryParams) ([]*Utxo, error)
+	ReleaseManualReservation(ctx context.Context, xPubID, reference string) error
+	ReserveUtxosManually(ctx context.Context, xPubID string, utxoPointers []UtxoPointer, ttl time.Duration,
+		reference string) ([]*UtxoReservationResult, error)
+	UnfreezeUtxo(ctx context.Context, txID string, outputIndex uint32) (*Utxo, error)
 	UnReserveUtxos(ctx context.Context, xPubID, draftID string) error
 }
 
 // XPubService is the xPub actions
 type XPubService interface {
+	CheckBalanceEvents(ctx context.Context, xPubID string) error
+	ExportXpubSnapshot(ctx context.Context, xPubKey string, w io.Writer) error
+	GetBalanceEvents(ctx context.Context, xPubID string, queryParams *datastore.QueryParams) ([]*BalanceEvent, error)
 	GetXpub(ctx context.Context, xPubKey string) (*Xpub, error)
+	GetXpubBalanceAt(ctx context.Context, xPubID string, at time.Time, timestamp BalanceTimestamp) (*XpubBalanceAt, error)
+	GetXpubBalances(ctx context.Context, xPubKey string) (*XpubBalances, error)
 	GetXpubByID(ctx context.Context, xPubID string) (*Xpub, error)
+	ImportXpubSnapshot(ctx context.Context, r io.Reader) (*XpubSnapshotResult, error)
+	MuteNotifications(ctx context.Context, xPubID string, until time.Time) (*Xpub, error)
 	NewXpub(ctx context.Context, xPubKey string, opts ...ModelOps) (*Xpub, error)
+	SetXpubBalanceAlerts(ctx context.Context, xPubID string, low, high *uint64) (*Xpub, error)
+	SetXpubFlags(ctx context.Context, xPubID string, itc, iuc *bool) (*Xpub, error)
+	UnmuteNotifications(ctx context.Context, xPubID string) (*Xpub, error)
 	UpdateXpubMetadata(ctx context.Context, xPubID string, metadata Metadata) (*Xpub, error)
 }
 
@@ -186,23 +285,54 @@ type ClientInterface interface {
 	TransactionService
 	UTXOService
 	XPubService
+	AuthenticateAccessKey(ctx context.Context, req *http.Request) (*AccessKeyAuthentication, error)
 	AuthenticateRequest(ctx context.Context, req *http.Request, adminXPubs []string,
 		adminRequired, requireSigning, signingDisabled bool) (*http.Request, error)
+	BalanceAlertMargin() uint64
+	BroadcastHighWaterMark() int
 	Close(ctx context.Context) error
+	ConfigSummary() *ConfigSummary
 	Debug(on bool)
 	DefaultSyncConfig() *SyncConfig
+	DerivationPrefix() string
+	DraftExpiryWarning() time.Duration
+	DraftMetadataPolicy() DraftMetadataPolicy
 	EnableNewRelic()
+	ExchangeRateCurrency() string
+	ExchangeRateProvider() ExchangeRateProvider
+	GetMonitorStatus() *MonitorStatus
 	GetOrStartTxn(ctx context.Context, name string) context.Context
 	GetTaskPeriod(name string) time.Duration
 	ImportBlockHeadersFromURL() string
+	IsBalanceCheckpointsEnabled() bool
+	IsBlockHeaderSyncEnabled() bool
+	InstanceID() string
 	IsDebug() bool
 	IsEncryptionKeySet() bool
+	InstantBroadcastMode() InstantBroadcastMode
 	IsITCEnabled() bool
 	IsIUCEnabled() bool
 	IsMigrationEnabled() bool
 	IsNewRelicEnabled() bool
+	IsNotificationNotesEnabled() bool
+	LocalLockFallbacks() uint64
+	MaxUnconfirmedChain() uint32
+	ModelCacheStats() map[string]ModelCacheStats
 	ModifyTaskPeriod(name string, period time.Duration) error
+	MutedNotificationsMode() MutedNotificationsMode
+	Network() chainstate.Network
+	NotificationDeadLetterRetention() time.Duration
+	NotificationDisplayProfile() string
+	NotificationRetention() time.Duration
+	PaymailActivationWindow() time.Duration
+	PaymailP2PFailureLimit() uint32
+	PaymailP2PMaxPayloadSize() int
+	RefreshMaxUnconfirmedChain(ctx context.Context) uint32
+	SchemaStatus(ctx context.Context) ([]*ModelSchemaStatus, error)
 	SetNotificationsClient(notifications.ClientInterface)
+	SyncQueueWarningThreshold() int64
+	TaskHealth() []*TaskHealth
+	TransactionNoteMaxLength() int
 	UserAgent() string
 	Version() string
 }
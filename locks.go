@@ -2,11 +2,17 @@ package bux
 
 import (
 	"context"
+	"errors"
+	"strings"
 
+	"github.com/mrz1836/go-cache"
 	"github.com/mrz1836/go-cachestore"
 )
 
 const (
+	lockKeyAuditLog           = "action-audit-log-%s"              // + Network
+	lockKeyAuthNonce          = "auth-nonce-%s"                    // + Hash of the access key and nonce
+	lockKeyMonitorCatchUp     = "action-monitor-catch-up-%s"       // + Network
 	lockKeyMonitorLockID      = "monitor-lock-id-%s"               // + Lock ID
 	lockKeyProcessBroadcastTx = "process-broadcast-transaction-%s" // + Tx ID
 	lockKeyProcessIncomingTx  = "process-incoming-transaction-%s"  // + Tx ID
@@ -16,6 +22,8 @@ const (
 	lockKeyRecordBlockHeader  = "action-record-block-header-%s"    // + Hash id
 	lockKeyRecordTx           = "action-record-transaction-%s"     // + Tx ID
 	lockKeyReserveUtxo        = "utxo-reserve-xpub-id-%s"          // + Xpub ID
+	lockKeyTransactionNote    = "action-transaction-note-%s"       // + Note ID
+	lockKeySyncBlockHeaders   = "action-sync-block-headers-%s"     // + Network
 )
 
 // newWriteLock will take care of creating a lock and defer
@@ -35,3 +43,11 @@ func newWaitWriteLock(ctx context.Context, lockKey string, cacheStore cachestore
 		_, _ = cacheStore.ReleaseLock(context.Background(), lockKey, secret)
 	}, err
 }
+
+// isLockExistsError will return true if the lock could not be created because it is held (not a cachestore failure)
+//
+// The cachestore wraps the cause of a failed lock in the message of ErrLockCreateFailed
+func isLockExistsError(err error) bool {
+	return err != nil && (errors.Is(err, cachestore.ErrLockExists) ||
+		strings.Contains(err.Error(), cache.ErrLockMismatch.Error()))
+}
@@ -0,0 +1,181 @@
+package bux
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/BuxOrg/bux/utils"
+	"github.com/mrz1836/go-cachestore"
+	zLogger "github.com/mrz1836/go-logger"
+	"github.com/newrelic/go-agent/v3/newrelic"
+)
+
+const (
+	lockFallbackHealthKey  = "bux-lock-fallback-health-check"
+	lockFallbackMetricName = "Custom/bux/lock_fallback"
+	lockFallbackRetrySleep = 10 * time.Millisecond
+)
+
+// localLock is an in-process lock (used when the cachestore is unavailable)
+type localLock struct {
+	expiresAt time.Time
+	secret    string
+}
+
+// fallbackCachestore wraps the cachestore and falls back to in-process locks when the cachestore is unavailable
+//
+// NOTE: this is only safe for single-instance deployments (no cluster coordinator)
+type fallbackCachestore struct {
+	cachestore.ClientInterface
+	degraded  bool                        // True if the cachestore is currently unavailable
+	fallbacks uint64                      // Number of locks acquired using the in-process locks (metric)
+	locks     map[string]*localLock       // In-process locks by lock key
+	logger    zLogger.GormLoggerInterface // Logger for the degraded mode warnings
+	mu        sync.Mutex                  // Guards the locks and the degraded flag
+	newRelic  *newrelic.Application       // NewRelic application (for the fallback metric)
+}
+
+// newFallbackCachestore will wrap the cachestore with the in-process lock fallback
+func newFallbackCachestore(cacheStore cachestore.ClientInterface, logger zLogger.GormLoggerInterface,
+	newRelic *newrelic.Application,
+) *fallbackCachestore {
+	return &fallbackCachestore{
+		ClientInterface: cacheStore,
+		locks:           make(map[string]*localLock),
+		logger:          logger,
+		newRelic:        newRelic,
+	}
+}
+
+// WriteLock will create a lock, using an in-process lock if the cachestore is unavailable
+func (f *fallbackCachestore) WriteLock(ctx context.Context, lockKey string, ttl int64) (string, error) {
+	secret, err := f.ClientInterface.WriteLock(ctx, lockKey, ttl)
+	if err == nil {
+		return f.distributedLock(ctx, lockKey, secret)
+	} else if f.isAvailable(ctx) {
+		return "", err // The lock exists (or failed) in the cachestore
+	}
+	return f.localWriteLock(ctx, lockKey, "", ttl)
+}
+
+// WriteLockWithSecret will create a lock with the given secret, using an in-process lock if the cachestore is unavailable
+func (f *fallbackCachestore) WriteLockWithSecret(ctx context.Context, lockKey, secret string, ttl int64) (string, error) {
+	result, err := f.ClientInterface.WriteLockWithSecret(ctx, lockKey, secret, ttl)
+	if err == nil {
+		return f.distributedLock(ctx, lockKey, result)
+	} else if f.isAvailable(ctx) {
+		return "", err
+	}
+	return f.localWriteLock(ctx, lockKey, secret, ttl)
+}
+
+// WaitWriteLock will wait (ttw) for a lock, using an in-process lock if the cachestore is unavailable
+func (f *fallbackCachestore) WaitWriteLock(ctx context.Context, lockKey string, ttl, ttw int64) (string, error) {
+	if len(lockKey) == 0 {
+		return "", cachestore.ErrKeyRequired
+	} else if ttw <= 0 {
+		return "", cachestore.ErrTTWCannotBeEmpty
+	}
+
+	// Loop until we have a lock, or we are passed the end time
+	end := time.Now().Add(time.Duration(ttw) * time.Second)
+	for {
+		if secret, err := f.WriteLock(ctx, lockKey, ttl); err == nil {
+			return secret, nil
+		} else if time.Now().After(end) {
+			return "", cachestore.ErrLockCreateFailed
+		}
+		time.Sleep(lockFallbackRetrySleep)
+	}
+}
+
+// ReleaseLock will release the lock (in-process locks are released locally)
+func (f *fallbackCachestore) ReleaseLock(ctx context.Context, lockKey, secret string) (bool, error) {
+	f.mu.Lock()
+	if lock, ok := f.locks[lockKey]; ok && lock.secret == secret {
+		delete(f.locks, lockKey)
+		f.mu.Unlock()
+		return true, nil
+	}
+	f.mu.Unlock()
+
+	return f.ClientInterface.ReleaseLock(ctx, lockKey, secret)
+}
+
+// LocalLockFallbacks will return the number of locks acquired using the in-process locks
+func (f *fallbackCachestore) LocalLockFallbacks() uint64 {
+	return atomic.LoadUint64(&f.fallbacks)
+}
+
+// localWriteLock will create an in-process lock (fails if the lock exists with a different secret)
+func (f *fallbackCachestore) localWriteLock(ctx context.Context, lockKey, secret string, ttl int64) (string, error) {
+	if len(lockKey) == 0 {
+		return "", cachestore.ErrKeyRequired
+	}
+
+	var err error
+	if len(secret) == 0 {
+		if secret, err = utils.RandomHex(32); err != nil {
+			return "", err
+		}
+	}
+
+	f.mu.Lock()
+	if !f.degraded {
+		f.degraded = true
+		f.logger.Warn(ctx, "cachestore is unavailable: DEGRADED MODE, using local (in-process) locks until it recovers")
+	}
+	if lock, ok := f.locks[lockKey]; ok && lock.secret != secret && time.Now().Before(lock.expiresAt) {
+		f.mu.Unlock()
+		return "", cachestore.ErrLockExists
+	}
+	f.locks[lockKey] = &localLock{
+		expiresAt: time.Now().Add(time.Duration(ttl) * time.Second),
+		secret:    secret,
+	}
+	f.mu.Unlock()
+
+	// Record the metric
+	atomic.AddUint64(&f.fallbacks, 1)
+	if f.newRelic != nil {
+		f.newRelic.RecordCustomMetric(lockFallbackMetricName, 1)
+	}
+
+	return secret, nil
+}
+
+// distributedLock will leave the degraded mode and make sure the lock is not still held in-process
+//
+// In-process locks acquired while degraded are honored until they are released or expire
+func (f *fallbackCachestore) distributedLock(ctx context.Context, lockKey, secret string) (string, error) {
+	f.setAvailable(ctx)
+
+	f.mu.Lock()
+	lock, ok := f.locks[lockKey]
+	held := ok && lock.secret != secret && time.Now().Before(lock.expiresAt)
+	f.mu.Unlock()
+
+	if held {
+		_, _ = f.ClientInterface.ReleaseLock(context.Background(), lockKey, secret)
+		return "", cachestore.ErrLockExists
+	}
+	return secret, nil
+}
+
+// isAvailable will check if the cachestore is reachable
+func (f *fallbackCachestore) isAvailable(ctx context.Context) bool {
+	_, err := f.ClientInterface.Get(ctx, lockFallbackHealthKey)
+	return err == nil
+}
+
+// setAvailable will leave the degraded mode (the cachestore recovered)
+func (f *fallbackCachestore) setAvailable(ctx context.Context) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.degraded {
+		f.degraded = false
+		f.logger.Info(ctx, "cachestore recovered: using distributed locks again")
+	}
+}
@@ -0,0 +1,125 @@
+package bux
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/mrz1836/go-cachestore"
+	zLogger "github.com/mrz1836/go-logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var errCachestoreDown = errors.New("cachestore is down")
+
+// unavailableCachestore is a cachestore that can be switched off (simulates a redis outage)
+type unavailableCachestore struct {
+	cachestore.ClientInterface
+	down bool
+}
+
+// Get will fail if the cachestore is down
+func (u *unavailableCachestore) Get(ctx context.Context, key string) (string, error) {
+	if u.down {
+		return "", errCachestoreDown
+	}
+	return u.ClientInterface.Get(ctx, key)
+}
+
+// WriteLock will fail if the cachestore is down
+func (u *unavailableCachestore) WriteLock(ctx context.Context, lockKey string, ttl int64) (string, error) {
+	if u.down {
+		return "", errCachestoreDown
+	}
+	return u.ClientInterface.WriteLock(ctx, lockKey, ttl)
+}
+
+// newTestFallbackCachestore will return a fallback cachestore wrapping a cachestore that can be switched off
+func newTestFallbackCachestore(t *testing.T) (*fallbackCachestore, *unavailableCachestore) {
+	cs, err := cachestore.NewClient(context.Background(), cachestore.WithFreeCache())
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		cs.Close(context.Background())
+	})
+
+	underlying := &unavailableCachestore{ClientInterface: cs}
+	return newFallbackCachestore(underlying, zLogger.NewGormLogger(false, 4), nil), underlying
+}
+
+// Test_fallbackCachestore_WriteLock will test the method WriteLock()
+func Test_fallbackCachestore_WriteLock(t *testing.T) {
+	t.Parallel()
+
+	t.Run("cachestore available", func(t *testing.T) {
+		f, _ := newTestFallbackCachestore(t)
+		ctx := context.Background()
+
+		secret, err := f.WriteLock(ctx, "test-lock", defaultCacheLockTTL)
+		require.NoError(t, err)
+		assert.NotEmpty(t, secret)
+		assert.Equal(t, uint64(0), f.LocalLockFallbacks())
+
+		// The lock is taken (no fallback)
+		_, err = f.WriteLock(ctx, "test-lock", defaultCacheLockTTL)
+		require.Error(t, err)
+		assert.Equal(t, uint64(0), f.LocalLockFallbacks())
+
+		var released bool
+		released, err = f.ReleaseLock(ctx, "test-lock", secret)
+		require.NoError(t, err)
+		assert.True(t, released)
+	})
+
+	t.Run("cachestore unavailable", func(t *testing.T) {
+		f, underlying := newTestFallbackCachestore(t)
+		ctx := context.Background()
+		underlying.down = true
+
+		secret, err := f.WriteLock(ctx, "test-lock", defaultCacheLockTTL)
+		require.NoError(t, err)
+		assert.NotEmpty(t, secret)
+		assert.Equal(t, uint64(1), f.LocalLockFallbacks())
+		assert.True(t, f.degraded)
+
+		// The local lock is exclusive
+		_, err = f.WriteLock(ctx, "test-lock", defaultCacheLockTTL)
+		assert.ErrorIs(t, err, cachestore.ErrLockExists)
+
+		// The cachestore recovers, but the local lock is still honored
+		underlying.down = false
+		_, err = f.WriteLock(ctx, "test-lock", defaultCacheLockTTL)
+		assert.ErrorIs(t, err, cachestore.ErrLockExists)
+		assert.False(t, f.degraded)
+
+		// Release the local lock, then lock using the cachestore again
+		var released bool
+		released, err = f.ReleaseLock(ctx, "test-lock", secret)
+		require.NoError(t, err)
+		assert.True(t, released)
+
+		secret, err = f.WriteLock(ctx, "test-lock", defaultCacheLockTTL)
+		require.NoError(t, err)
+		assert.NotEmpty(t, secret)
+		assert.Equal(t, uint64(1), f.LocalLockFallbacks())
+	})
+}
+
+// Test_fallbackCachestore_WaitWriteLock will test the method WaitWriteLock()
+func Test_fallbackCachestore_WaitWriteLock(t *testing.T) {
+	t.Parallel()
+
+	f, underlying := newTestFallbackCachestore(t)
+	ctx := context.Background()
+	underlying.down = true
+
+	secret, err := f.WaitWriteLock(ctx, "test-lock", defaultCacheLockTTL, 1)
+	require.NoError(t, err)
+	assert.NotEmpty(t, secret)
+
+	_, err = f.WaitWriteLock(ctx, "test-lock", defaultCacheLockTTL, 1)
+	assert.ErrorIs(t, err, cachestore.ErrLockCreateFailed)
+
+	_, err = f.WaitWriteLock(ctx, "test-lock", defaultCacheLockTTL, 0)
+	assert.ErrorIs(t, err, cachestore.ErrTTWCannotBeEmpty)
+}
@@ -0,0 +1,279 @@
+package bux
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/BuxOrg/bux/utils"
+	"github.com/mrz1836/go-datastore"
+)
+
+// MetadataLimitsMode is what happens to the metadata exceeding the limits
+type MetadataLimitsMode string
+
+// Modes of the metadata limits
+const (
+	// MetadataLimitsLogOnly logs the models saved with metadata exceeding the limits (nothing is rejected)
+	MetadataLimitsLogOnly MetadataLimitsMode = "log_only"
+
+	// MetadataLimitsStrict rejects the metadata exceeding the limits (typed errors)
+	MetadataLimitsStrict MetadataLimitsMode = "strict"
+)
+
+const (
+	metadataReportPageSize = 100 // Number of records read per query (and default page size) of the oversized metadata report
+)
+
+// MetadataLimits are the limits of the metadata of the models (checked by UpdateMetadata and on save)
+//
+// A limit of 0 is not checked, the sizes are the sizes of the serialized (JSON) metadata
+type MetadataLimits struct {
+	MaxKeys      int                `json:"max_keys" toml:"max_keys" yaml:"max_keys"`                   // Maximum number of keys
+	MaxSize      int                `json:"max_size" toml:"max_size" yaml:"max_size"`                   // Maximum size of the metadata (bytes)
+	MaxValueSize int                `json:"max_value_size" toml:"max_value_size" yaml:"max_value_size"` // Maximum size of a value (bytes)
+	Mode         MetadataLimitsMode `json:"mode" toml:"mode" yaml:"mode"`                               // Log only (default) or strict
+}
+
+// OversizedMetadataRecord is a record with metadata exceeding the limits (see GetOversizedMetadataRecords)
+type OversizedMetadataRecord struct {
+	ID        string `json:"id" toml:"id" yaml:"id"`
+	ModelName string `json:"model_name" toml:"model_name" yaml:"model_name"`
+	Reason    string `json:"reason" toml:"reason" yaml:"reason"`
+}
+
+// defaultMetadataLimits will return the default (generous) limits, violations are only logged
+func defaultMetadataLimits() *MetadataLimits {
+	return &MetadataLimits{
+		MaxKeys:      defaultMetadataMaxKeys,
+		MaxSize:      defaultMetadataMaxSize,
+		MaxValueSize: defaultMetadataMaxValueSize,
+		Mode:         MetadataLimitsLogOnly,
+	}
+}
+
+// check will return a typed error if the metadata exceeds the limits
+func (l *MetadataLimits) check(metadata Metadata) error {
+	if l == nil || len(metadata) == 0 {
+		return nil
+	}
+	if l.MaxKeys > 0 && len(metadata) > l.MaxKeys {
+		return fmt.Errorf("%w: %d keys (max %d)", ErrMetadataTooManyKeys, len(metadata), l.MaxKeys)
+	}
+	if l.MaxSize > 0 {
+		data, err := json.Marshal(metadata)
+		if err != nil {
+			return err
+		} else if len(data) > l.MaxSize {
+			return fmt.Errorf("%w: %d bytes (max %d)", ErrMetadataTooLarge, len(data), l.MaxSize)
+		}
+	}
+	if l.MaxValueSize > 0 {
+		keys := make([]string, 0, len(metadata))
+		for key := range metadata {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			data, err := json.Marshal(metadata[key])
+			if err != nil {
+				return err
+			} else if len(data) > l.MaxValueSize {
+				return fmt.Errorf("%w: key %s is %d bytes (max %d)", ErrMetadataValueTooLarge, key, len(data), l.MaxValueSize)
+			}
+		}
+	}
+	return nil
+}
+
+// updatedMetadata will return a copy of the metadata with the update applied
+// (any key set to nil is removed, other keys updated or added)
+func updatedMetadata(metadata, update Metadata) Metadata {
+	updated := make(Metadata, len(metadata)+len(update))
+	for key, value := range metadata {
+		updated[key] = value
+	}
+	for key, value := range update {
+		if value == nil {
+			delete(updated, key)
+		} else {
+			updated[key] = value
+		}
+	}
+	return updated
+}
+
+// metadataLimitedModel is a model with metadata checked against the limits
+type metadataLimitedModel interface {
+	checkMetadataLimits(limits *MetadataLimits) error
+	metadataUpdated() bool
+}
+
+// checkMetadataLimits will return the violation of the limits by the metadata of the model
+//
+// An update rejected by UpdateMetadata (strict mode) is returned once
+func (m *Model) checkMetadataLimits(limits *MetadataLimits) error {
+	if err := m.metadataErr; err != nil {
+		m.metadataErr = nil
+		return err
+	}
+	return limits.check(m.Metadata)
+}
+
+// metadataUpdated will return true if the metadata was updated since the model was loaded
+func (m *Model) metadataUpdated() bool {
+	return m.metadataUpdate
+}
+
+// checkModelMetadata will check the metadata of the model before it is saved
+//
+// Only new models and updated metadata are checked, existing records exceeding the limits can still be saved
+// (see GetOversizedMetadataRecords). Violations are returned in strict mode, otherwise they are logged
+func checkModelMetadata(ctx context.Context, model ModelInterface) error {
+	limited, ok := model.(metadataLimitedModel)
+	if !ok || (!model.IsNew() && !limited.metadataUpdated()) {
+		return nil
+	}
+	limits := clientMetadataLimits(model.Client())
+	err := limited.checkMetadataLimits(limits)
+	if err == nil {
+		return nil
+	} else if limits.Mode == MetadataLimitsStrict {
+		return err
+	}
+	model.Client().Logger().Warn(ctx, fmt.Sprintf(
+		"[METADATA] %s %s exceeds the metadata limits: %s", model.GetModelName(), model.GetID(), err.Error(),
+	))
+	return nil
+}
+
+// GetOversizedMetadataRecords will get the records with metadata exceeding the limits (admin maintenance report)
+//
+// Nil limits are the configured limits (see WithMetadataLimits), other limits can be used to find the records
+// to clean up before lowering the limits or turning on the strict mode. The report is paged by the query params
+// (page and page size of the oversized records), the scan stops once the page is complete
+func (c *Client) GetOversizedMetadataRecords(ctx context.Context, limits *MetadataLimits,
+	queryParams *datastore.QueryParams,
+) ([]*OversizedMetadataRecord, error) {
+
+	// Check for existing NewRelic transaction
+	ctx = c.GetOrStartTxn(ctx, "get_oversized_metadata_records")
+
+	if limits == nil {
+		limits = c.options.metadataLimits
+	}
+
+	// The records of the pages before the requested page are skipped
+	page, pageSize := 1, metadataReportPageSize
+	if queryParams != nil {
+		if queryParams.Page > 1 {
+			page = queryParams.Page
+		}
+		if queryParams.PageSize > 0 {
+			pageSize = queryParams.PageSize
+		}
+	}
+	report := &oversizedMetadataReport{
+		limits:  limits,
+		records: make([]*OversizedMetadataRecord, 0),
+		size:    pageSize,
+		skip:    (page - 1) * pageSize,
+	}
+
+	// Models with metadata (the paymail addresses are only loaded with paymail)
+	scans := []struct {
+		modelName ModelName
+		scan      func(context.Context, ModelName, *oversizedMetadataReport, ...ModelOps) error
+	}{
+		{ModelAccessKey, scanOversizedMetadata[*AccessKey]},
+		{ModelDestination, scanOversizedMetadata[*Destination]},
+		{ModelDraftTransaction, scanOversizedMetadata[*DraftTransaction]},
+		{ModelPaymailAddress, scanOversizedMetadata[*PaymailAddress]},
+		{ModelTransaction, scanOversizedMetadata[*Transaction]},
+		{ModelUtxo, scanOversizedMetadata[*Utxo]},
+		{ModelXPub, scanOversizedMetadata[*Xpub]},
+	}
+
+	opts := c.DefaultModelOptions()
+	for _, scan := range scans {
+		if report.complete() {
+			break
+		} else if !utils.StringInSlice(scan.modelName.String(), c.GetModelNames()) {
+			continue
+		}
+		if err := scan.scan(ctx, scan.modelName, report, opts...); err != nil {
+			return nil, err
+		}
+	}
+	return report.records, nil
+}
+
+// oversizedMetadataReport is the page of the oversized metadata report being collected
+type oversizedMetadataReport struct {
+	limits  *MetadataLimits            // Limits checked
+	records []*OversizedMetadataRecord // Records of the page
+	size    int                        // Size of the page
+	skip    int                        // Records left to skip (previous pages)
+}
+
+// complete will return true if the page is complete (the scan can stop)
+func (r *oversizedMetadataReport) complete() bool {
+	return len(r.records) >= r.size
+}
+
+// add will add the record to the page (or skip it if it belongs to a previous page)
+func (r *oversizedMetadataReport) add(record *OversizedMetadataRecord) {
+	if r.skip > 0 {
+		r.skip--
+		return
+	}
+	r.records = append(r.records, record)
+}
+
+// scanOversizedMetadata will scan the records of the model with metadata exceeding the limits (page by page)
+func scanOversizedMetadata[T ModelInterface](ctx context.Context, modelName ModelName,
+	report *oversizedMetadataReport, opts ...ModelOps,
+) error {
+	for page := 1; !report.complete(); page++ {
+		modelItems := make([]T, 0)
+		if err := getModelsByConditions(ctx, modelName, &modelItems, nil, nil, &datastore.QueryParams{
+			OrderByField:  idField,
+			Page:          page,
+			PageSize:      metadataReportPageSize,
+			SortDirection: datastore.SortAsc,
+		}, opts...); err != nil {
+			return err
+		}
+		for _, item := range modelItems {
+			if report.complete() {
+				return nil
+			}
+			limited, ok := any(item).(metadataLimitedModel)
+			if !ok {
+				continue
+			}
+			if err := limited.checkMetadataLimits(report.limits); err != nil {
+				report.add(&OversizedMetadataRecord{
+					ID:        item.GetID(),
+					ModelName: modelName.String(),
+					Reason:    err.Error(),
+				})
+			}
+		}
+		if len(modelItems) < metadataReportPageSize {
+			return nil
+		}
+	}
+	return nil
+}
+
+// clientMetadataLimits will return the limits of the metadata of the models (see WithMetadataLimits)
+//
+// Other implementations of the client use the default limits
+func clientMetadataLimits(client ClientInterface) *MetadataLimits {
+	if c, ok := client.(*Client); ok {
+		return c.options.metadataLimits
+	}
+	return defaultMetadataLimits()
+}
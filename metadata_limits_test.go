@@ -0,0 +1,149 @@
+package bux
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mrz1836/go-datastore"
+	customTypes "github.com/mrz1836/go-datastore/custom_types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestMetadataLimits_check will test the method check()
+func TestMetadataLimits_check(t *testing.T) {
+	t.Parallel()
+
+	limits := &MetadataLimits{MaxKeys: 2, MaxSize: 30, MaxValueSize: 12}
+
+	t.Run("within the limits", func(t *testing.T) {
+		assert.NoError(t, limits.check(nil))
+		assert.NoError(t, limits.check(Metadata{"a": "value", "b": 1}))
+		assert.NoError(t, (*MetadataLimits)(nil).check(Metadata{"a": strings.Repeat("x", 100)}))
+		assert.NoError(t, (&MetadataLimits{}).check(Metadata{"a": strings.Repeat("x", 100)}))
+	})
+
+	t.Run("too many keys", func(t *testing.T) {
+		err := limits.check(Metadata{"a": 1, "b": 2, "c": 3})
+		require.ErrorIs(t, err, ErrMetadataTooManyKeys)
+		assert.Contains(t, err.Error(), "3 keys (max 2)")
+	})
+
+	t.Run("too large", func(t *testing.T) {
+		assert.ErrorIs(t, limits.check(Metadata{"a": "0123456789", "b": "0123456789"}), ErrMetadataTooLarge)
+	})
+
+	t.Run("value too large", func(t *testing.T) {
+		err := limits.check(Metadata{"a": "0123456789ab"})
+		require.ErrorIs(t, err, ErrMetadataValueTooLarge)
+		assert.Contains(t, err.Error(), "key a is 14 bytes (max 12)")
+	})
+}
+
+// TestClient_MetadataLimits will test the metadata limits on update and save, and GetOversizedMetadataRecords()
+func TestClient_MetadataLimits(t *testing.T) {
+
+	newLimitedClient := func(t *testing.T, mode MetadataLimitsMode) (context.Context, ClientInterface) {
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, false,
+			WithCustomTaskManager(&taskManagerMockBase{}),
+			WithMetadataLimits(&MetadataLimits{MaxKeys: 2, Mode: mode}),
+		)
+		t.Cleanup(deferMe)
+		return ctx, client
+	}
+
+	t.Run("log only (default)", func(t *testing.T) {
+		ctx, client := newLimitedClient(t, "")
+		assert.Equal(t, MetadataLimitsLogOnly, client.ConfigSummary().MetadataLimits.Mode)
+
+		xPub := newXpub(testXPub, append(client.DefaultModelOptions(), New(),
+			WithMetadatas(Metadata{"a": 1, "b": 2, "c": 3}))...)
+		require.NoError(t, xPub.Save(ctx))
+
+		records, err := client.GetOversizedMetadataRecords(ctx, nil, nil)
+		require.NoError(t, err)
+		require.Len(t, records, 1)
+		assert.Equal(t, testXPubID, records[0].ID)
+		assert.Equal(t, ModelXPub.String(), records[0].ModelName)
+		assert.Contains(t, records[0].Reason, ErrMetadataTooManyKeys.Error())
+
+		// Other limits (before turning the strict mode on)
+		records, err = client.GetOversizedMetadataRecords(ctx, &MetadataLimits{MaxKeys: 3}, nil)
+		require.NoError(t, err)
+		assert.Empty(t, records)
+	})
+
+	t.Run("strict", func(t *testing.T) {
+		ctx, client := newLimitedClient(t, MetadataLimitsStrict)
+
+		xPub := newXpub(testXPub, append(client.DefaultModelOptions(), New(),
+			WithMetadatas(Metadata{"a": 1, "b": 2, "c": 3}))...)
+		require.ErrorIs(t, xPub.Save(ctx), ErrMetadataTooManyKeys)
+
+		xPub = newXpub(testXPub, append(client.DefaultModelOptions(), New(), WithMetadatas(Metadata{"a": 1}))...)
+		require.NoError(t, xPub.Save(ctx))
+
+		_, err := client.UpdateXpubMetadata(ctx, testXPubID, Metadata{"b": 2, "c": 3})
+		require.ErrorIs(t, err, ErrMetadataTooManyKeys)
+
+		// The rejected update was not applied
+		xPub, err = client.GetXpubByID(ctx, testXPubID)
+		require.NoError(t, err)
+		assert.Equal(t, Metadata{"a": float64(1)}, xPub.Metadata)
+
+		// Removed keys are not counted
+		xPub, err = client.UpdateXpubMetadata(ctx, testXPubID, Metadata{"a": nil, "b": 2, "c": 3})
+		require.NoError(t, err)
+		assert.Len(t, xPub.Metadata, 2)
+	})
+
+	t.Run("strict with existing oversized records", func(t *testing.T) {
+		ctx, client := newLimitedClient(t, MetadataLimitsStrict)
+		fixtures := NewFixtures(t, client).WithXpub(0).WithDestinations(3)
+
+		// Records saved before the limits (or with higher limits)
+		client.(*Client).options.metadataLimits.Mode = MetadataLimitsLogOnly
+		oversized := Metadata{"a": 1, "b": 2, "c": 3}
+		for _, destination := range fixtures.Destinations {
+			destination.Metadata = oversized
+			destination.metadataUpdate = true
+			require.NoError(t, destination.Save(ctx))
+		}
+		client.(*Client).options.metadataLimits.Mode = MetadataLimitsStrict
+
+		// Saved without updating the metadata (IE: internal updates)
+		destination, err := getDestinationByID(ctx, fixtures.Destinations[0].ID, client.DefaultModelOptions()...)
+		require.NoError(t, err)
+		destination.Monitor = customTypes.NullTime{NullTime: sql.NullTime{Time: time.Now().UTC(), Valid: true}}
+		require.NoError(t, destination.Save(ctx))
+
+		// Updating the metadata is checked
+		destination.UpdateMetadata(Metadata{"d": 4})
+		require.ErrorIs(t, destination.Save(ctx), ErrMetadataTooManyKeys)
+
+		// Paged report
+		records, err := client.GetOversizedMetadataRecords(ctx, nil, &datastore.QueryParams{Page: 1, PageSize: 2})
+		require.NoError(t, err)
+		require.Len(t, records, 2)
+		page, err := client.GetOversizedMetadataRecords(ctx, nil, &datastore.QueryParams{Page: 2, PageSize: 2})
+		require.NoError(t, err)
+		require.Len(t, page, 1)
+		assert.NotContains(t, []string{records[0].ID, records[1].ID}, page[0].ID)
+	})
+
+	t.Run("strict transaction metadata", func(t *testing.T) {
+		ctx, client := newLimitedClient(t, MetadataLimitsStrict)
+		fixtures := NewFixtures(t, client).WithXpub(0).WithUtxos(100000)
+
+		_, err := client.UpdateTransactionMetadata(ctx, fixtures.Xpub.ID, fixtures.Transactions[0].ID,
+			Metadata{"a": 1, "b": 2, "c": 3})
+		require.ErrorIs(t, err, ErrMetadataTooManyKeys)
+
+		_, err = client.UpdateTransactionMetadata(ctx, fixtures.Xpub.ID, fixtures.Transactions[0].ID,
+			Metadata{"a": 1})
+		require.NoError(t, err)
+	})
+}
@@ -18,6 +18,22 @@ func (c *chainStateBase) Broadcast(context.Context, string, string, time.Duratio
 	return "", nil
 }
 
+func (c *chainStateBase) BroadcastProviders() []string {
+	return nil
+}
+
+func (c *chainStateBase) BroadcastWithProviders(context.Context, string, string, []string, time.Duration) (string, error) {
+	return "", nil
+}
+
+func (c *chainStateBase) GetRawTransaction(context.Context, string) (string, error) {
+	return "", chainstate.ErrTransactionNotFound
+}
+
+func (c *chainStateBase) GetRawTransactions(context.Context, []string) (map[string]string, error) {
+	return map[string]string{}, nil
+}
+
 func (c *chainStateBase) QueryTransaction(context.Context, string,
 	chainstate.RequiredIn, time.Duration) (*chainstate.TransactionInfo, error) {
 	return nil, nil
@@ -28,6 +44,10 @@ func (c *chainStateBase) QueryTransactionFastest(context.Context, string, chains
 	return nil, nil
 }
 
+func (c *chainStateBase) AncestorLimit() uint32 {
+	return 0
+}
+
 func (c *chainStateBase) BroadcastMiners() []*chainstate.Miner {
 	return nil
 }
@@ -62,6 +82,10 @@ func (c *chainStateBase) Network() chainstate.Network {
 	return chainstate.MainNet
 }
 
+func (c *chainStateBase) ProviderStatus(context.Context) []*chainstate.ProviderStatus {
+	return nil
+}
+
 func (c *chainStateBase) QueryMiners() []*chainstate.Miner {
 	return nil
 }
@@ -72,6 +96,22 @@ func (c *chainStateBase) QueryTimeout() time.Duration {
 
 func (c *chainStateBase) ValidateMiners(_ context.Context) {}
 
+func (c *chainStateBase) Monitor() chainstate.MonitorService {
+	return nil
+}
+
+func (c *chainStateBase) BroadcastClient() broadcast.Client {
+	return nil
+}
+
+func (c *chainStateBase) FeeUnit() *utils.FeeUnit {
+	return chainstate.DefaultFee
+}
+
+func (c *chainStateBase) VerifyMerkleRoots(_ context.Context, _ []string) error {
+	return nil
+}
+
 type chainStateEverythingInMempool struct {
 	chainStateBase
 }
@@ -112,14 +152,6 @@ type chainStateEverythingOnChain struct {
 	chainStateEverythingInMempool
 }
 
-func (c *chainStateEverythingOnChain) Monitor() chainstate.MonitorService {
-	return nil
-}
-
-func (c *chainStateEverythingOnChain) BroadcastClient() broadcast.Client {
-	return nil
-}
-
 func (c *chainStateEverythingOnChain) QueryTransaction(_ context.Context, id string,
 	_ chainstate.RequiredIn, _ time.Duration) (*chainstate.TransactionInfo, error) {
 
@@ -148,10 +180,16 @@ func (c *chainStateEverythingOnChain) QueryTransactionFastest(_ context.Context,
 	}, nil
 }
 
-func (c *chainStateEverythingOnChain) FeeUnit() *utils.FeeUnit {
-	return chainstate.DefaultFee
+type chainStateTransactionNotFound struct {
+	chainStateBase
 }
 
-func (c *chainStateEverythingOnChain) VerifyMerkleRoots(_ context.Context, _ []string) error {
-	return nil
+func (c *chainStateTransactionNotFound) QueryTransaction(context.Context, string,
+	chainstate.RequiredIn, time.Duration) (*chainstate.TransactionInfo, error) {
+	return nil, chainstate.ErrTransactionNotFound
+}
+
+func (c *chainStateTransactionNotFound) QueryTransactionFastest(context.Context, string, chainstate.RequiredIn,
+	time.Duration) (*chainstate.TransactionInfo, error) {
+	return nil, chainstate.ErrTransactionNotFound
 }
@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"encoding/hex"
 	"errors"
+	"time"
 
 	"github.com/BuxOrg/bux/utils"
 	"github.com/bitcoinschema/go-bitcoin/v2"
@@ -30,9 +31,12 @@ type AccessKey struct {
 	RevokedAt customTypes.NullTime `json:"revoked_at" toml:"revoked_at" yaml:"revoked_at" gorm:"<-;comment:When the key was revoked" bson:"revoked_at,omitempty"`
 
 	// Private fields
-	Key string `json:"key" gorm:"-" bson:"-"` // Used on "CREATE", shown to the user "once" only
+	Key string `json:"key,omitempty" gorm:"-" bson:"-"` // Used on "CREATE", shown to the user "once" only
 }
 
+// accessKeyRevokedCondition is the custom condition (bool) to filter the revoked (true) or active (false) access keys
+const accessKeyRevokedCondition = "revoked"
+
 // newAccessKey will start a new model
 func newAccessKey(xPubID string, opts ...ModelOps) *AccessKey {
 
@@ -75,7 +79,9 @@ func getAccessKeys(ctx context.Context, metadata *Metadata, conditions *map[stri
 	queryParams *datastore.QueryParams, opts ...ModelOps) ([]*AccessKey, error) {
 
 	modelItems := make([]*AccessKey, 0)
-	if err := getModelsByConditions(ctx, ModelAccessKey, &modelItems, metadata, conditions, queryParams, opts...); err != nil {
+	if err := getModelsByConditions(
+		ctx, ModelAccessKey, &modelItems, metadata, processAccessKeyConditions(conditions), queryParams, opts...,
+	); err != nil {
 		return nil, err
 	}
 
@@ -86,7 +92,9 @@ func getAccessKeys(ctx context.Context, metadata *Metadata, conditions *map[stri
 func getAccessKeysCount(ctx context.Context, metadata *Metadata, conditions *map[string]interface{},
 	opts ...ModelOps) (int64, error) {
 
-	return getModelCountByConditions(ctx, ModelAccessKey, AccessKey{}, metadata, conditions, opts...)
+	return getModelCountByConditions(
+		ctx, ModelAccessKey, AccessKey{}, metadata, processAccessKeyConditions(conditions), opts...,
+	)
 }
 
 // getAccessKeysByXPubID will get all the access keys that match the metadata search
@@ -98,7 +106,7 @@ func getAccessKeysByXPubID(ctx context.Context, xPubID string, metadata *Metadat
 
 	var dbConditions = map[string]interface{}{}
 	if conditions != nil {
-		dbConditions = *conditions
+		dbConditions = *processAccessKeyConditions(conditions)
 	}
 	dbConditions[xPubIDField] = xPubID
 
@@ -120,7 +128,7 @@ func getAccessKeysByXPubID(ctx context.Context, xPubID string, metadata *Metadat
 	// Loop and enrich
 	accessKeys := make([]*AccessKey, 0)
 	for index := range models {
-		models[index].enrich(ModelDestination, opts...)
+		models[index].enrich(ModelAccessKey, opts...)
 		accessKeys = append(accessKeys, &models[index])
 	}
 
@@ -133,7 +141,7 @@ func getAccessKeysByXPubIDCount(ctx context.Context, xPubID string, metadata *Me
 
 	var dbConditions = map[string]interface{}{}
 	if conditions != nil {
-		dbConditions = *conditions
+		dbConditions = *processAccessKeyConditions(conditions)
 	}
 	dbConditions[xPubIDField] = xPubID
 
@@ -156,6 +164,28 @@ func getAccessKeysByXPubIDCount(ctx context.Context, xPubID string, metadata *Me
 	return count, nil
 }
 
+// processAccessKeyConditions will return a copy of the conditions, replacing the custom "revoked" condition
+//
+// Revoked keys have a revoked_at date (greater than the zero time), active keys do not (null)
+func processAccessKeyConditions(conditions *map[string]interface{}) *map[string]interface{} {
+	dbConditions := copyConditions(conditions)
+	if dbConditions == nil {
+		return nil
+	}
+
+	if revoked, ok := (*dbConditions)[accessKeyRevokedCondition].(bool); ok {
+		delete(*dbConditions, accessKeyRevokedCondition)
+		if revoked {
+			(*dbConditions)[revokedAtField] = map[string]interface{}{
+				"$gt": time.Time{},
+			}
+		} else {
+			(*dbConditions)[revokedAtField] = nil
+		}
+	}
+	return dbConditions
+}
+
 // GetModelName will get the name of the current model
 func (m *AccessKey) GetModelName() string {
 	return ModelAccessKey.String()
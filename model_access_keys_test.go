@@ -171,3 +171,145 @@ func TestAccessKey_GetAccessKeys(t *testing.T) {
 		assert.Equal(t, "", accessKeys[0].Key)
 	})
 }
+
+// TestAccessKey_GetAccessKeysFilters will test the custom conditions of getAccessKeysByXPubID()
+func TestAccessKey_GetAccessKeysFilters(t *testing.T) {
+	ctx, client, deferMe := CreateTestSQLiteClient(t, false, true, WithCustomTaskManager(&taskManagerMockBase{}))
+	defer deferMe()
+	opts := client.DefaultModelOptions()
+	start := time.Now().UTC().Add(-1 * time.Minute)
+
+	active := newAccessKey(testXPubID, append(opts, New())...)
+	require.NoError(t, active.Save(ctx))
+	revoked := newAccessKey(testXPubID, append(opts, New())...)
+	revoked.RevokedAt.Valid = true
+	revoked.RevokedAt.Time = time.Now().UTC()
+	require.NoError(t, revoked.Save(ctx))
+
+	t.Run("active keys", func(t *testing.T) {
+		accessKeys, err := getAccessKeysByXPubID(ctx, testXPubID, nil, &map[string]interface{}{
+			accessKeyRevokedCondition: false,
+		}, nil, opts...)
+		require.NoError(t, err)
+		require.Len(t, accessKeys, 1)
+		assert.Equal(t, active.ID, accessKeys[0].ID)
+	})
+
+	t.Run("revoked keys", func(t *testing.T) {
+		accessKeys, err := getAccessKeys(ctx, nil, &map[string]interface{}{
+			accessKeyRevokedCondition: true,
+		}, nil, opts...)
+		require.NoError(t, err)
+		require.Len(t, accessKeys, 1)
+		assert.Equal(t, revoked.ID, accessKeys[0].ID)
+		assert.Equal(t, "", accessKeys[0].Key)
+	})
+
+	t.Run("created date range", func(t *testing.T) {
+		count, err := getAccessKeysByXPubIDCount(ctx, testXPubID, nil, &map[string]interface{}{
+			createdAtField: map[string]interface{}{"$gte": start},
+		}, opts...)
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), count)
+
+		count, err = getAccessKeysCount(ctx, nil, &map[string]interface{}{
+			createdAtField:            map[string]interface{}{"$lt": start},
+			accessKeyRevokedCondition: false,
+		}, opts...)
+		require.NoError(t, err)
+		assert.Equal(t, int64(0), count)
+	})
+}
+
+// TestAccessKey_processAccessKeyConditions will test the method processAccessKeyConditions()
+func TestAccessKey_processAccessKeyConditions(t *testing.T) {
+	t.Parallel()
+
+	t.Run("nil conditions", func(t *testing.T) {
+		assert.Nil(t, processAccessKeyConditions(nil))
+	})
+
+	t.Run("active keys", func(t *testing.T) {
+		conditions := map[string]interface{}{accessKeyRevokedCondition: false}
+		dbConditions := processAccessKeyConditions(&conditions)
+		require.NotNil(t, dbConditions)
+		assert.Equal(t, map[string]interface{}{revokedAtField: nil}, *dbConditions)
+		assert.Equal(t, false, conditions[accessKeyRevokedCondition]) // Not modified
+	})
+
+	t.Run("revoked keys", func(t *testing.T) {
+		conditions := map[string]interface{}{accessKeyRevokedCondition: true, idField: "test"}
+		dbConditions := processAccessKeyConditions(&conditions)
+		require.NotNil(t, dbConditions)
+		assert.Equal(t, map[string]interface{}{
+			idField:        "test",
+			revokedAtField: map[string]interface{}{"$gt": time.Time{}},
+		}, *dbConditions)
+	})
+}
+
+// TestClient_GetAccessKeysByXPubID will test the filters of the method GetAccessKeysByXPubID()
+func (ts *EmbeddedDBTestSuite) TestClient_GetAccessKeysByXPubID() {
+
+	ts.runParallelDBTests("filter and count", false, func(t *testing.T, tc *TestingClient) {
+		fixtures := NewFixtures(t, tc.client).WithXpub(0)
+		opts := tc.client.DefaultModelOptions()
+		start := time.Now().UTC().Add(-1 * time.Minute)
+
+		active, err := tc.client.NewAccessKey(tc.ctx, fixtures.RawXpub, opts...)
+		require.NoError(t, err)
+		var revoked *AccessKey
+		revoked, err = tc.client.NewAccessKey(tc.ctx, fixtures.RawXpub, opts...)
+		require.NoError(t, err)
+		_, err = tc.client.RevokeAccessKey(tc.ctx, fixtures.RawXpub, revoked.ID, opts...)
+		require.NoError(t, err)
+
+		// All the keys (no key material)
+		var accessKeys []*AccessKey
+		accessKeys, err = tc.client.GetAccessKeysByXPubID(tc.ctx, fixtures.Xpub.ID, nil, nil, nil, opts...)
+		require.NoError(t, err)
+		require.Len(t, accessKeys, 2)
+		for _, accessKey := range accessKeys {
+			assert.Equal(t, "", accessKey.Key)
+			assert.False(t, accessKey.CreatedAt.IsZero())
+		}
+
+		// Active keys
+		accessKeys, err = tc.client.GetAccessKeysByXPubID(tc.ctx, fixtures.Xpub.ID, nil, &map[string]interface{}{
+			accessKeyRevokedCondition: false,
+		}, nil, opts...)
+		require.NoError(t, err)
+		require.Len(t, accessKeys, 1)
+		assert.Equal(t, active.ID, accessKeys[0].ID)
+
+		// Revoked keys
+		accessKeys, err = tc.client.GetAccessKeysByXPubID(tc.ctx, fixtures.Xpub.ID, nil, &map[string]interface{}{
+			accessKeyRevokedCondition: true,
+		}, nil, opts...)
+		require.NoError(t, err)
+		require.Len(t, accessKeys, 1)
+		assert.Equal(t, revoked.ID, accessKeys[0].ID)
+		assert.True(t, accessKeys[0].RevokedAt.Valid)
+
+		var count int64
+		count, err = tc.client.GetAccessKeysByXPubIDCount(tc.ctx, fixtures.Xpub.ID, nil, &map[string]interface{}{
+			accessKeyRevokedCondition: true,
+		}, opts...)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), count)
+
+		// Creation date range
+		count, err = tc.client.GetAccessKeysByXPubIDCount(tc.ctx, fixtures.Xpub.ID, nil, &map[string]interface{}{
+			createdAtField: map[string]interface{}{"$gte": start},
+		}, opts...)
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), count)
+
+		count, err = tc.client.GetAccessKeysByXPubIDCount(tc.ctx, fixtures.Xpub.ID, nil, &map[string]interface{}{
+			createdAtField:            map[string]interface{}{"$lt": start},
+			accessKeyRevokedCondition: false,
+		}, opts...)
+		require.NoError(t, err)
+		assert.Equal(t, int64(0), count)
+	})
+}
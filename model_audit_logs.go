@@ -0,0 +1,267 @@
+package bux
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/BuxOrg/bux/utils"
+	"github.com/mrz1836/go-datastore"
+)
+
+// AuditOperation is the mutating operation recorded in the audit log
+type AuditOperation string
+
+const (
+	// AuditOperationDeletePaymail is when a paymail address was deleted
+	AuditOperationDeletePaymail AuditOperation = "delete_paymail_address"
+
+	// AuditOperationFreezeUtxo is when a utxo was frozen (compliance hold)
+	AuditOperationFreezeUtxo AuditOperation = "freeze_utxo"
+
+	// AuditOperationRequeueSync is when the errored actions of a sync transaction were requeued
+	AuditOperationRequeueSync AuditOperation = "requeue_sync_transaction"
+
+	// AuditOperationUnfreezeUtxo is when the compliance hold of a utxo was removed
+	AuditOperationUnfreezeUtxo AuditOperation = "unfreeze_utxo"
+
+	// AuditOperationUpdateMetadata is when the metadata of a model was edited
+	AuditOperationUpdateMetadata AuditOperation = "update_metadata"
+)
+
+// AuditLog is an object representing an entry of the audit log of the mutating operations (append-only)
+//
+// The entries are a hash chain: the hash (ID) of an entry covers the hash of the previous entry, a changed
+// or removed entry breaks the chain (see VerifyAuditChain)
+//
+// Gorm related models & indexes: https://gorm.io/docs/models.html - https://gorm.io/docs/indexes.html
+type AuditLog struct {
+	// Base model
+	Model `bson:",inline"`
+
+	// Model specific fields
+	ID           string         `json:"id" toml:"id" yaml:"id" gorm:"<-:create;type:char(64);primaryKey;comment:This is the hash of the entry" bson:"_id"`
+	Sequence     uint64         `json:"sequence" toml:"sequence" yaml:"sequence" gorm:"<-:create;uniqueIndex;comment:This is the position in the chain (starts at 1)" bson:"sequence"`
+	PreviousHash string         `json:"previous_hash" toml:"previous_hash" yaml:"previous_hash" gorm:"<-:create;type:varchar(64);comment:This is the hash of the previous entry" bson:"previous_hash"`
+	Actor        string         `json:"actor" toml:"actor" yaml:"actor" gorm:"<-:create;type:varchar(255);index;comment:This is who did the operation (see WithAuditActor)" bson:"actor"`
+	Operation    AuditOperation `json:"operation" toml:"operation" yaml:"operation" gorm:"<-:create;type:varchar(64);index;comment:This is the operation" bson:"operation"`
+	TargetModel  string         `json:"target_model" toml:"target_model" yaml:"target_model" gorm:"<-:create;type:varchar(64);comment:This is the name of the changed model" bson:"target_model"`
+	TargetID     string         `json:"target_id" toml:"target_id" yaml:"target_id" gorm:"<-:create;type:varchar(255);index;comment:This is the id of the changed model" bson:"target_id"`
+	BeforeHash   string         `json:"before_hash" toml:"before_hash" yaml:"before_hash" gorm:"<-:create;type:varchar(64);comment:This is the hash of the model before the operation" bson:"before_hash"`
+	AfterHash    string         `json:"after_hash" toml:"after_hash" yaml:"after_hash" gorm:"<-:create;type:varchar(64);comment:This is the hash of the model after the operation" bson:"after_hash"`
+}
+
+// WithAuditActor will return a context with the actor recorded in the audit log (IE: the admin user)
+// for operations using the context
+func WithAuditActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, contextKeyAuditActor, actor)
+}
+
+// auditActor will return the actor set on the context (empty if not set)
+func auditActor(ctx context.Context) string {
+	actor, _ := ctx.Value(contextKeyAuditActor).(string)
+	return actor
+}
+
+// newAuditLog will start a new audit entry of the operation on the target (the target is not changed yet)
+func newAuditLog(ctx context.Context, operation AuditOperation, target ModelInterface,
+	opts ...ModelOps,
+) *AuditLog {
+	return &AuditLog{
+		Actor:       auditActor(ctx),
+		BeforeHash:  auditSummaryHash(target),
+		Model:       *NewBaseModel(ModelAuditLog, opts...),
+		Operation:   operation,
+		TargetID:    target.GetID(),
+		TargetModel: target.GetModelName(),
+	}
+}
+
+// auditHookFields are the fields set by the save hooks (left out of the summary hash, see auditSummaryHash)
+var auditHookFields = append([]string{createdAtField, updatedAtField, versionField}, recordVersionFields...)
+
+// auditSummaryHash will return the hash of the state of the model
+//
+// The fields set by the save hooks are left out, the hash taken before the save matches the stored record
+func auditSummaryHash(model ModelInterface) string {
+	data, err := json.Marshal(model)
+	if err != nil {
+		return ""
+	}
+	fields := make(map[string]json.RawMessage)
+	if err = json.Unmarshal(data, &fields); err != nil {
+		return ""
+	}
+	for _, field := range auditHookFields {
+		delete(fields, field)
+	}
+	if data, err = json.Marshal(fields); err != nil {
+		return ""
+	}
+	return utils.Hash(string(data))
+}
+
+// computeHash will return the hash of the entry (HMAC if a signing key is set, see WithAuditLogSigningKey)
+func (m *AuditLog) computeHash(signingKey string) string {
+	data, _ := json.Marshal([]string{
+		strconv.FormatUint(m.Sequence, 10), m.PreviousHash, m.Actor, string(m.Operation),
+		m.TargetModel, m.TargetID, m.BeforeHash, m.AfterHash,
+	})
+	if len(signingKey) == 0 {
+		return utils.Hash(string(data))
+	}
+	mac := hmac.New(sha256.New, []byte(signingKey))
+	_, _ = mac.Write(data)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// auditLogSigningKey will return the key of the HMAC of the audit entries (see WithAuditLogSigningKey)
+//
+// Other implementations of the client have no signing key (plain hashes)
+func auditLogSigningKey(client ClientInterface) string {
+	if c, ok := client.(*Client); ok {
+		return c.options.auditSigningKey
+	}
+	return ""
+}
+
+// auditedModel is a model that saves an audit entry with the model (see saveWithAudit)
+type auditedModel interface {
+	setAuditLog(entry *AuditLog)
+}
+
+// saveWithAudit will save the changed model and the audit entry (same datastore transaction)
+//
+// The entry is linked to the last entry of the chain (under the lock of the chain)
+func saveWithAudit(ctx context.Context, model ModelInterface, entry *AuditLog) error {
+	audited, ok := model.(auditedModel)
+	if !ok {
+		return model.Save(ctx)
+	}
+	client := model.Client()
+
+	// Create the lock and set the release for after the function completes
+	unlock, err := newWaitWriteLock(
+		ctx, fmt.Sprintf(lockKeyAuditLog, getClientNetwork(client)), client.Cachestore(),
+	)
+	defer unlock()
+	if err != nil {
+		return err
+	}
+
+	var last *AuditLog
+	if last, err = getLastAuditLog(ctx, model.GetOptions(false)...); err != nil {
+		return err
+	}
+	entry.Sequence = 1
+	if last != nil {
+		entry.Sequence = last.Sequence + 1
+		entry.PreviousHash = last.ID
+	}
+	entry.AfterHash = auditSummaryHash(model)
+	entry.ID = entry.computeHash(auditLogSigningKey(client))
+
+	audited.setAuditLog(entry)
+	defer audited.setAuditLog(nil)
+	return model.Save(ctx)
+}
+
+// getAuditLogs will get the audit entries by conditions (ordered by sequence by default)
+func getAuditLogs(ctx context.Context, conditions *map[string]interface{},
+	queryParams *datastore.QueryParams, opts ...ModelOps,
+) ([]*AuditLog, error) {
+	if queryParams == nil {
+		queryParams = &datastore.QueryParams{}
+	}
+	if len(queryParams.OrderByField) == 0 {
+		queryParams.OrderByField = sequenceField
+		queryParams.SortDirection = datastore.SortAsc
+	}
+
+	modelItems := make([]*AuditLog, 0)
+	if err := getModelsByConditions(
+		ctx, ModelAuditLog, &modelItems, nil, conditions, queryParams, opts...,
+	); err != nil {
+		return nil, err
+	}
+
+	for index := range modelItems {
+		modelItems[index].enrich(ModelAuditLog, opts...)
+	}
+	return modelItems, nil
+}
+
+// getAuditLogBySequence will get the audit entry at the position of the chain (nil if not found)
+func getAuditLogBySequence(ctx context.Context, sequence uint64, opts ...ModelOps) (*AuditLog, error) {
+	entries, err := getAuditLogs(ctx, &map[string]interface{}{sequenceField: sequence}, nil, opts...)
+	if err != nil || len(entries) == 0 {
+		return nil, err
+	}
+	return entries[0], nil
+}
+
+// getLastAuditLog will get the last audit entry of the chain (nil if the chain is empty)
+func getLastAuditLog(ctx context.Context, opts ...ModelOps) (*AuditLog, error) {
+	entries, err := getAuditLogs(ctx, nil, &datastore.QueryParams{
+		Page:          1,
+		PageSize:      1,
+		OrderByField:  sequenceField,
+		SortDirection: datastore.SortDesc,
+	}, opts...)
+	if err != nil && !errors.Is(err, datastore.ErrNoResults) {
+		return nil, err
+	} else if len(entries) == 0 {
+		return nil, nil
+	}
+	return entries[0], nil
+}
+
+// GetModelName will get the name of the current model
+func (m *AuditLog) GetModelName() string {
+	return ModelAuditLog.String()
+}
+
+// GetModelTableName will get the db table name of the current model
+func (m *AuditLog) GetModelTableName() string {
+	return tableAuditLogs
+}
+
+// Save will save the model into the Datastore
+func (m *AuditLog) Save(ctx context.Context) error {
+	return Save(ctx, m)
+}
+
+// GetID will get the ID
+func (m *AuditLog) GetID() string {
+	return m.ID
+}
+
+// BeforeCreating will fire before the model is being inserted into the Datastore
+func (m *AuditLog) BeforeCreating(_ context.Context) error {
+	m.DebugLog("starting: " + m.Name() + " BeforeCreating hook...")
+
+	// Make sure ID is valid
+	if len(m.ID) == 0 {
+		return ErrMissingFieldID
+	} else if m.Sequence == 0 || len(m.Operation) == 0 {
+		return ErrInvalidAuditLog
+	}
+
+	m.DebugLog("end: " + m.Name() + " BeforeCreating hook")
+	return nil
+}
+
+// BeforeUpdating will fire before the model is being updated (the entries are append-only)
+func (m *AuditLog) BeforeUpdating(_ context.Context) error {
+	return ErrAuditLogImmutable
+}
+
+// Migrate model specific migration on startup
+func (m *AuditLog) Migrate(client datastore.ClientInterface) error {
+	return client.IndexMetadata(client.GetTableName(tableAuditLogs), metadataField)
+}
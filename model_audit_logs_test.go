@@ -0,0 +1,154 @@
+package bux
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestAuditLog_computeHash will test the method computeHash()
+func TestAuditLog_computeHash(t *testing.T) {
+	t.Parallel()
+
+	entry := &AuditLog{
+		Actor:       "admin@example.com",
+		Operation:   AuditOperationFreezeUtxo,
+		Sequence:    1,
+		TargetID:    testTxID + "12",
+		TargetModel: ModelUtxo.String(),
+	}
+
+	t.Run("hashed", func(t *testing.T) {
+		hash := entry.computeHash("")
+		assert.Len(t, hash, 64)
+		assert.Equal(t, hash, entry.computeHash(""))
+	})
+
+	t.Run("signed", func(t *testing.T) {
+		signed := entry.computeHash("secret")
+		assert.Len(t, signed, 64)
+		assert.NotEqual(t, entry.computeHash(""), signed)
+		assert.NotEqual(t, entry.computeHash("other"), signed)
+	})
+
+	t.Run("every field is covered", func(t *testing.T) {
+		hash := entry.computeHash("")
+		changed := *entry
+		changed.Actor = "someone@example.com"
+		assert.NotEqual(t, hash, changed.computeHash(""))
+
+		changed = *entry
+		changed.PreviousHash = testTxID
+		assert.NotEqual(t, hash, changed.computeHash(""))
+	})
+}
+
+// TestClient_AuditLog will test the audit entries of the mutating methods, GetAuditLog() and VerifyAuditChain()
+func TestClient_AuditLog(t *testing.T) {
+
+	newAuditedClient := func(t *testing.T, opts ...ClientOps) (context.Context, ClientInterface) {
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, false,
+			append(opts, WithCustomTaskManager(&taskManagerMockBase{}))...,
+		)
+		t.Cleanup(deferMe)
+		require.NoError(t, createTestUtxos(ctx, client))
+
+		xPub := newXpub(testXPub, append(client.DefaultModelOptions(), New())...)
+		require.NoError(t, xPub.Save(ctx))
+
+		ctx = WithAuditActor(ctx, "admin@example.com")
+		_, err := client.FreezeUtxo(ctx, testTxID, 12, "court order 42", "compliance@example.com")
+		require.NoError(t, err)
+		_, err = client.UpdateXpubMetadata(ctx, testXPubID, Metadata{"note": "audited"})
+		require.NoError(t, err)
+		_, err = client.UnfreezeUtxo(context.Background(), testTxID, 12)
+		require.NoError(t, err)
+		return ctx, client
+	}
+
+	t.Run("entries are written and chained", func(t *testing.T) {
+		ctx, client := newAuditedClient(t)
+
+		entries, err := client.GetAuditLog(ctx, nil, nil)
+		require.NoError(t, err)
+		require.Len(t, entries, 3)
+
+		assert.Equal(t, uint64(1), entries[0].Sequence)
+		assert.Empty(t, entries[0].PreviousHash)
+		assert.Equal(t, "admin@example.com", entries[0].Actor)
+		assert.Equal(t, AuditOperationFreezeUtxo, entries[0].Operation)
+		assert.Equal(t, ModelUtxo.String(), entries[0].TargetModel)
+		assert.NotEqual(t, entries[0].BeforeHash, entries[0].AfterHash)
+
+		assert.Equal(t, AuditOperationUpdateMetadata, entries[1].Operation)
+		assert.Equal(t, ModelXPub.String(), entries[1].TargetModel)
+		assert.Equal(t, testXPubID, entries[1].TargetID)
+		assert.Equal(t, entries[0].ID, entries[1].PreviousHash)
+
+		assert.Equal(t, AuditOperationUnfreezeUtxo, entries[2].Operation)
+		assert.Empty(t, entries[2].Actor)
+
+		// The after hash is the hash of the stored record
+		utxo, err := getUtxo(ctx, testTxID, 12, client.DefaultModelOptions()...)
+		require.NoError(t, err)
+		require.NotNil(t, utxo)
+		assert.Equal(t, auditSummaryHash(utxo), entries[2].AfterHash)
+
+		// Filtered by conditions
+		entries, err = client.GetAuditLog(ctx, &map[string]interface{}{
+			"operation": AuditOperationUpdateMetadata,
+		}, nil)
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+		assert.Equal(t, uint64(2), entries[0].Sequence)
+
+		require.NoError(t, client.VerifyAuditChain(ctx, 0, 0))
+		require.NoError(t, client.VerifyAuditChain(ctx, 2, 3))
+		assert.ErrorIs(t, client.VerifyAuditChain(ctx, 2, 4), ErrAuditChainBroken)
+	})
+
+	t.Run("entries cannot be updated", func(t *testing.T) {
+		ctx, client := newAuditedClient(t)
+
+		entries, err := client.GetAuditLog(ctx, nil, nil)
+		require.NoError(t, err)
+		entries[0].Actor = "someone@example.com"
+		assert.ErrorIs(t, entries[0].Save(ctx), ErrAuditLogImmutable)
+	})
+
+	t.Run("tampering is detected", func(t *testing.T) {
+		ctx, client := newAuditedClient(t)
+		table := client.Datastore().GetTableName(tableAuditLogs)
+
+		require.NoError(t, client.Datastore().Execute(
+			`UPDATE "`+table+`" SET "actor" = 'someone@example.com' WHERE "sequence" = 2`,
+		).Error)
+		err := client.VerifyAuditChain(ctx, 0, 0)
+		require.ErrorIs(t, err, ErrAuditChainBroken)
+		assert.Contains(t, err.Error(), "entry 2 does not match its hash")
+		require.NoError(t, client.VerifyAuditChain(ctx, 3, 0))
+	})
+
+	t.Run("removed entry is detected", func(t *testing.T) {
+		ctx, client := newAuditedClient(t)
+		table := client.Datastore().GetTableName(tableAuditLogs)
+
+		require.NoError(t, client.Datastore().Execute(`DELETE FROM "`+table+`" WHERE "sequence" = 2`).Error)
+		err := client.VerifyAuditChain(ctx, 0, 0)
+		require.ErrorIs(t, err, ErrAuditChainBroken)
+		assert.Contains(t, err.Error(), "entry 2 is missing")
+	})
+
+	t.Run("signed chain", func(t *testing.T) {
+		ctx, client := newAuditedClient(t, WithAuditLogSigningKey("secret"))
+		require.NoError(t, client.VerifyAuditChain(ctx, 0, 0))
+		assert.True(t, client.ConfigSummary().AuditLogSigned)
+
+		// The entries cannot be verified without the key
+		entries, err := client.GetAuditLog(ctx, nil, nil)
+		require.NoError(t, err)
+		assert.NotEqual(t, entries[0].ID, entries[0].computeHash(""))
+	})
+}
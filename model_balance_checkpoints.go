@@ -0,0 +1,418 @@
+package bux
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/BuxOrg/bux/taskmanager"
+	"github.com/BuxOrg/bux/utils"
+	"github.com/mrz1836/go-datastore"
+	zLogger "github.com/mrz1836/go-logger"
+)
+
+// BalanceTimestamp is the timestamp of the transactions used for the historical balances
+type BalanceTimestamp string
+
+const (
+	// BalanceAtCreated uses the time the transactions were recorded by bux (created_at)
+	BalanceAtCreated BalanceTimestamp = "created"
+
+	// BalanceAtMined uses the time of the blocks of the transactions (mined_at), unmined transactions are not counted
+	BalanceAtMined BalanceTimestamp = "mined"
+)
+
+// field will return the transaction field of the timestamp
+func (b BalanceTimestamp) field() string {
+	if b == BalanceAtMined {
+		return minedAtField
+	}
+	return createdAtField
+}
+
+// XpubBalanceAt is the balance of an xPub at a point in time (see GetXpubBalanceAt)
+type XpubBalanceAt struct {
+	At                  time.Time        `json:"at" toml:"at" yaml:"at" bson:"at"`                                                                         // The point in time
+	Balance             int64            `json:"balance" toml:"balance" yaml:"balance" bson:"balance"`                                                     // Sum of the (signed) values of the transactions
+	Checkpoint          *time.Time       `json:"checkpoint,omitempty" toml:"checkpoint" yaml:"checkpoint" bson:"checkpoint,omitempty"`                     // The balance checkpoint used (if any)
+	Precise             bool             `json:"precise" toml:"precise" yaml:"precise" bson:"precise"`                                                     // False if some transactions lack a mined timestamp
+	Timestamp           BalanceTimestamp `json:"timestamp" toml:"timestamp" yaml:"timestamp" bson:"timestamp"`                                             // The timestamp of the transactions used
+	Transactions        int64            `json:"transactions" toml:"transactions" yaml:"transactions" bson:"transactions"`                                 // Number of transactions counted
+	UnminedTransactions int64            `json:"unmined_transactions" toml:"unmined_transactions" yaml:"unmined_transactions" bson:"unmined_transactions"` // Transactions recorded before the time (after the checkpoint), without a mined timestamp
+	XpubID              string           `json:"xpub_id" toml:"xpub_id" yaml:"xpub_id" bson:"xpub_id"`                                                     // The xPub
+}
+
+// BalanceCheckpoint is the balance of an xPub at the start of a month (see WithBalanceCheckpoints)
+//
+// A checkpoint is only used if the number of transactions up to the checkpoint did not change and none of these
+// transactions was updated since it was computed (IE: late recorded, reverted or changed transactions invalidate
+// the checkpoint)
+//
+// Gorm related models & indexes: https://gorm.io/docs/models.html - https://gorm.io/docs/indexes.html
+type BalanceCheckpoint struct {
+	// Base model
+	Model `bson:",inline"`
+
+	// Model specific fields
+	ID           string           `json:"id" toml:"id" yaml:"id" gorm:"<-:create;type:char(64);primaryKey;comment:This is the unique id (xpub, timestamp and time)" bson:"_id"`
+	XpubID       string           `json:"xpub_id" toml:"xpub_id" yaml:"xpub_id" gorm:"<-:create;type:char(64);index;comment:This is the related xPub" bson:"xpub_id"`
+	BasedOn      BalanceTimestamp `json:"based_on" toml:"based_on" yaml:"based_on" gorm:"<-:create;type:varchar(16);comment:This is the timestamp of the transactions" bson:"based_on"`
+	CheckpointAt time.Time        `json:"checkpoint_at" toml:"checkpoint_at" yaml:"checkpoint_at" gorm:"<-:create;comment:This is the time of the checkpoint (inclusive)" bson:"checkpoint_at"`
+	Balance      int64            `json:"balance" toml:"balance" yaml:"balance" gorm:"<-;comment:This is the balance at the time (satoshis)" bson:"balance"`
+	Transactions int64            `json:"transactions" toml:"transactions" yaml:"transactions" gorm:"<-;comment:This is the number of transactions up to the time" bson:"transactions"`
+}
+
+// newBalanceCheckpoint will start a new balance checkpoint model
+func newBalanceCheckpoint(xPubID string, timestamp BalanceTimestamp, checkpointAt time.Time,
+	opts ...ModelOps,
+) *BalanceCheckpoint {
+	return &BalanceCheckpoint{
+		BasedOn:      timestamp,
+		CheckpointAt: checkpointAt.UTC(),
+		ID:           balanceCheckpointID(xPubID, timestamp, checkpointAt),
+		Model:        *NewBaseModel(ModelBalanceCheckpoint, opts...),
+		XpubID:       xPubID,
+	}
+}
+
+// balanceCheckpointID will return the id of the checkpoint
+func balanceCheckpointID(xPubID string, timestamp BalanceTimestamp, checkpointAt time.Time) string {
+	return utils.Hash(fmt.Sprintf("%s-%s-%d", xPubID, timestamp, checkpointAt.Unix()))
+}
+
+// getBalanceCheckpoints will get the checkpoints of the xPub until the time (latest first)
+func getBalanceCheckpoints(ctx context.Context, xPubID string, timestamp BalanceTimestamp, until time.Time,
+	opts ...ModelOps,
+) ([]*BalanceCheckpoint, error) {
+	modelItems := make([]*BalanceCheckpoint, 0)
+	if err := getModelsByConditions(ctx, ModelBalanceCheckpoint, &modelItems, nil, &map[string]interface{}{
+		basedOnField:      string(timestamp),
+		checkpointAtField: map[string]interface{}{"$lte": until.UTC()},
+		xPubIDField:       xPubID,
+	}, &datastore.QueryParams{
+		OrderByField:  checkpointAtField,
+		SortDirection: datastore.SortDesc,
+	}, opts...); err != nil {
+		return nil, err
+	}
+
+	for index := range modelItems {
+		modelItems[index].enrich(ModelBalanceCheckpoint, opts...)
+	}
+	return modelItems, nil
+}
+
+// getValidBalanceCheckpoint will get the latest checkpoint of the xPub (until the time) that is still valid
+//
+// The transactions up to the checkpoint are counted, and the ones updated after the checkpoint was computed
+// (IE: a changed value) invalidate it
+func getValidBalanceCheckpoint(ctx context.Context, xPubID string, timestamp BalanceTimestamp, until time.Time,
+	opts ...ModelOps,
+) (*BalanceCheckpoint, error) {
+	checkpoints, err := getBalanceCheckpoints(ctx, xPubID, timestamp, until, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, checkpoint := range checkpoints {
+		var count int64
+		conditions := balanceConditions(xPubID, timestamp, nil, checkpoint.CheckpointAt)
+		if count, err = getTransactionsCountInternal(ctx, conditions, opts...); err != nil {
+			return nil, err
+		} else if count != checkpoint.Transactions {
+			continue
+		}
+
+		conditions[updatedAtField] = map[string]interface{}{"$gt": checkpoint.UpdatedAt.UTC()}
+		if count, err = getTransactionsCountInternal(ctx, conditions, opts...); err != nil {
+			return nil, err
+		} else if count == 0 {
+			return checkpoint, nil
+		}
+	}
+	return nil, nil
+}
+
+// balanceConditions will return the conditions of the transactions of the xPub in the range (from, until]
+func balanceConditions(xPubID string, timestamp BalanceTimestamp, from *time.Time,
+	until time.Time,
+) map[string]interface{} {
+	timeRange := map[string]interface{}{"$lte": until.UTC()}
+	if from != nil {
+		timeRange["$gt"] = from.UTC()
+	}
+	return processDBConditions(xPubID, &map[string]interface{}{
+		timestamp.field(): timeRange,
+	}, nil)
+}
+
+// sumXpubOutputValues will sum the values of the transactions of the xPub in the range (from, until]
+//
+// Returns the sum and the number of transactions
+func sumXpubOutputValues(ctx context.Context, xPubID string, timestamp BalanceTimestamp, from *time.Time,
+	until time.Time, opts ...ModelOps,
+) (sum, count int64, err error) {
+	err = forEachKeysetRecord(ctx, balanceConditions(xPubID, timestamp, from, until), defaultPageSize,
+		func(ctx context.Context, conditions map[string]interface{}, queryParams *datastore.QueryParams) ([]keysetRecord, error) {
+			transactions, err := getTransactionsInternal(ctx, conditions, xPubID, queryParams, opts...)
+			if err != nil {
+				return nil, err
+			}
+			records := make([]keysetRecord, 0, len(transactions))
+			for _, transaction := range transactions {
+				records = append(records, transaction)
+			}
+			return records, nil
+		}, func(record keysetRecord) error {
+			sum += record.(*Transaction).XpubOutputValue[xPubID]
+			count++
+			return nil
+		},
+		opts...,
+	)
+	return
+}
+
+// getXpubBalanceAt will compute the balance of the xPub at the time from the transactions history
+func getXpubBalanceAt(ctx context.Context, client ClientInterface, xPubID string, at time.Time,
+	timestamp BalanceTimestamp, opts ...ModelOps,
+) (*XpubBalanceAt, error) {
+	if len(timestamp) == 0 {
+		timestamp = BalanceAtCreated
+	}
+	result := &XpubBalanceAt{
+		At:        at.UTC(),
+		Timestamp: timestamp,
+		XpubID:    xPubID,
+	}
+
+	// Start from the latest valid checkpoint (if enabled)
+	var from *time.Time
+	if client.IsBalanceCheckpointsEnabled() {
+		checkpoint, err := getValidBalanceCheckpoint(ctx, xPubID, timestamp, at, opts...)
+		if err != nil {
+			return nil, err
+		} else if checkpoint != nil {
+			from = &checkpoint.CheckpointAt
+			result.Balance, result.Checkpoint, result.Transactions = checkpoint.Balance, from, checkpoint.Transactions
+		}
+	}
+
+	// Sum the rest of the transactions
+	sum, count, err := sumXpubOutputValues(ctx, xPubID, timestamp, from, at, opts...)
+	if err != nil {
+		return nil, err
+	}
+	result.Balance += sum
+	result.Transactions += count
+
+	// The transactions recorded before the time without a mined timestamp (counted or not, depending on the timestamp),
+	// the transactions before the checkpoint are settled by the checkpoint (a transaction mined later invalidates it)
+	recordedRange := map[string]interface{}{"$lte": at.UTC()}
+	if from != nil {
+		recordedRange["$gt"] = from.UTC()
+	}
+	if result.UnminedTransactions, err = getTransactionsCountInternal(ctx, processDBConditions(
+		xPubID, &map[string]interface{}{
+			createdAtField: recordedRange,
+			minedAtField:   nil,
+		}, nil,
+	), opts...); err != nil {
+		return nil, err
+	}
+	result.Precise = result.UnminedTransactions == 0
+
+	return result, nil
+}
+
+// updateBalanceCheckpoints will create (or update) the monthly checkpoints of the xPub until the time
+//
+// The checkpoints are computed from the latest valid checkpoint (or the first transaction)
+func updateBalanceCheckpoints(ctx context.Context, xPubID string, timestamp BalanceTimestamp, until time.Time,
+	opts ...ModelOps,
+) error {
+	checkpoint, err := getValidBalanceCheckpoint(ctx, xPubID, timestamp, until, opts...)
+	if err != nil {
+		return err
+	}
+
+	// Start of the first month to compute
+	var (
+		balance, count int64
+		from           *time.Time
+		month          time.Time
+	)
+	if checkpoint != nil {
+		balance, count, from = checkpoint.Balance, checkpoint.Transactions, &checkpoint.CheckpointAt
+		month = checkpoint.CheckpointAt.AddDate(0, 1, 0)
+	} else {
+		var transactions []*Transaction
+		if transactions, err = getTransactionsInternal(
+			ctx, balanceConditions(xPubID, timestamp, nil, until), xPubID, &datastore.QueryParams{
+				Page:          1,
+				PageSize:      1,
+				OrderByField:  timestamp.field(),
+				SortDirection: datastore.SortAsc,
+			}, opts...,
+		); err != nil {
+			return err
+		} else if len(transactions) == 0 {
+			return nil
+		}
+		first := transactions[0].CreatedAt
+		if timestamp == BalanceAtMined {
+			first = transactions[0].MinedAt.Time
+		}
+		month = startOfMonth(first).AddDate(0, 1, 0)
+	}
+
+	for ; !month.After(until); month = month.AddDate(0, 1, 0) {
+		var sum, monthCount int64
+		if sum, monthCount, err = sumXpubOutputValues(ctx, xPubID, timestamp, from, month, opts...); err != nil {
+			return err
+		}
+		balance += sum
+		count += monthCount
+
+		// Create the checkpoint or replace the (invalid) checkpoint of the month
+		var next *BalanceCheckpoint
+		if next, err = getBalanceCheckpoint(
+			ctx, balanceCheckpointID(xPubID, timestamp, month), opts...,
+		); err != nil {
+			return err
+		} else if next == nil {
+			next = newBalanceCheckpoint(xPubID, timestamp, month, append(opts, New())...)
+		}
+		next.Balance, next.Transactions = balance, count
+		if err = next.Save(ctx); err != nil {
+			return err
+		}
+
+		checkpointAt := month
+		from = &checkpointAt
+	}
+	return nil
+}
+
+// getBalanceCheckpoint will get the checkpoint by ID (nil if not found)
+func getBalanceCheckpoint(ctx context.Context, id string, opts ...ModelOps) (*BalanceCheckpoint, error) {
+	checkpoint := &BalanceCheckpoint{ID: id}
+	checkpoint.enrich(ModelBalanceCheckpoint, opts...)
+	if err := Get(ctx, checkpoint, nil, false, defaultDatabaseReadTimeout, false); err != nil {
+		if errors.Is(err, datastore.ErrNoResults) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return checkpoint, nil
+}
+
+// startOfMonth will return the start of the month of the time (UTC)
+func startOfMonth(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// taskUpdateBalanceCheckpoints will update the monthly balance checkpoints of all the xPubs
+func taskUpdateBalanceCheckpoints(ctx context.Context, logClient zLogger.GormLoggerInterface, opts ...ModelOps) error {
+	logClient.Info(ctx, "running update balance checkpoints task...")
+
+	until := startOfMonth(time.Now())
+	return forEachKeysetRecord(ctx, nil, defaultPageSize,
+		func(ctx context.Context, conditions map[string]interface{}, queryParams *datastore.QueryParams) ([]keysetRecord, error) {
+			xPubs, err := getXPubs(ctx, nil, &conditions, queryParams, opts...)
+			if err != nil {
+				return nil, err
+			}
+			records := make([]keysetRecord, 0, len(xPubs))
+			for _, xPub := range xPubs {
+				records = append(records, xPub)
+			}
+			return records, nil
+		}, func(record keysetRecord) error {
+			for _, timestamp := range []BalanceTimestamp{BalanceAtCreated, BalanceAtMined} {
+				if err := updateBalanceCheckpoints(ctx, record.GetID(), timestamp, until, opts...); err != nil {
+					logClient.Error(ctx, "error updating the balance checkpoints of "+record.GetID()+": "+err.Error())
+				}
+			}
+			return nil
+		},
+		opts...,
+	)
+}
+
+// GetModelName will get the name of the current model
+func (m *BalanceCheckpoint) GetModelName() string {
+	return ModelBalanceCheckpoint.String()
+}
+
+// GetModelTableName will get the db table name of the current model
+func (m *BalanceCheckpoint) GetModelTableName() string {
+	return tableBalanceCheckpoints
+}
+
+// Save will save the model into the Datastore
+func (m *BalanceCheckpoint) Save(ctx context.Context) error {
+	return Save(ctx, m)
+}
+
+// GetID will get the ID
+func (m *BalanceCheckpoint) GetID() string {
+	return m.ID
+}
+
+// BeforeCreating will fire before the model is being inserted into the Datastore
+func (m *BalanceCheckpoint) BeforeCreating(_ context.Context) error {
+	m.DebugLog("starting: " + m.Name() + " BeforeCreating hook...")
+
+	// Make sure ID is valid
+	if len(m.ID) == 0 {
+		return ErrMissingFieldID
+	} else if len(m.XpubID) == 0 {
+		return ErrMissingFieldXpubID
+	}
+
+	m.DebugLog("end: " + m.Name() + " BeforeCreating hook")
+	return nil
+}
+
+// RegisterTasks will register the model specific tasks on client initialization
+func (m *BalanceCheckpoint) RegisterTasks() error {
+
+	// No task manager loaded?
+	tm := m.Client().Taskmanager()
+	if tm == nil {
+		return nil
+	}
+
+	// Register the task locally (cron task - set the defaults)
+	updateTask := m.Name() + "_update"
+	ctx := context.Background()
+
+	// Register the task
+	if err := tm.RegisterTask(&taskmanager.Task{
+		Name:       updateTask,
+		RetryLimit: 1,
+		Handler: func(client ClientInterface) error {
+			if taskErr := taskUpdateBalanceCheckpoints(ctx, client.Logger(), WithClient(client)); taskErr != nil {
+				client.Logger().Error(ctx, "error running "+updateTask+" task: "+taskErr.Error())
+			}
+			return nil
+		},
+	}); err != nil {
+		return err
+	}
+
+	// Run the task periodically
+	return tm.RunTask(ctx, &taskmanager.TaskOptions{
+		Arguments:      []interface{}{m.Client()},
+		RunEveryPeriod: m.Client().GetTaskPeriod(updateTask),
+		TaskName:       updateTask,
+	})
+}
+
+// Migrate model specific migration on startup
+func (m *BalanceCheckpoint) Migrate(client datastore.ClientInterface) error {
+	return client.IndexMetadata(client.GetTableName(tableBalanceCheckpoints), metadataField)
+}
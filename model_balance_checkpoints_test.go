@@ -0,0 +1,183 @@
+package bux
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+	"time"
+
+	customTypes "github.com/mrz1836/go-datastore/custom_types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// seedBalanceHistory will save a transaction of the xPub as-is (with the given value and timestamps)
+func seedBalanceHistory(ctx context.Context, t *testing.T, client ClientInterface, index int, xPubID string,
+	value int64, createdAt time.Time, minedAt *time.Time,
+) {
+	transaction := &Transaction{
+		Model:           *NewBaseModel(ModelTransaction, client.DefaultModelOptions()...),
+		TransactionBase: TransactionBase{ID: fmt.Sprintf("%064d", index), Hex: "00"},
+		XpubOutputValue: XpubOutputValue{xPubID: value},
+	}
+	transaction.CreatedAt = createdAt.UTC()
+	if value > 0 {
+		transaction.XpubOutIDs = IDs{xPubID}
+	} else {
+		transaction.XpubInIDs = IDs{xPubID}
+	}
+	if minedAt != nil {
+		transaction.BlockHeight = 800000
+		transaction.MinedAt = customTypes.NullTime{NullTime: sql.NullTime{Time: minedAt.UTC(), Valid: true}}
+	}
+
+	saved, err := client.(*Client).importSnapshotModel(ctx, transaction)
+	require.NoError(t, err)
+	require.True(t, saved)
+}
+
+// balanceHistoryTime will return the time (UTC)
+func balanceHistoryTime(year int, month time.Month, day, hour, minute int) time.Time {
+	return time.Date(year, month, day, hour, minute, 0, 0, time.UTC)
+}
+
+// newBalanceHistory will seed a known history of the test xPub
+//
+// Created:  +100000 (Oct 5th), -30000 (Nov 20th), +5000 (Dec 31st 23:50), +7000 (Jan 15th, unmined)
+// Mined:    Oct 5th, Nov 21st, Jan 1st 00:10 (the next year)
+func newBalanceHistory(t *testing.T, opts ...ClientOps) (context.Context, ClientInterface) {
+	ctx, client, deferMe := CreateTestSQLiteClient(t, false, true,
+		append(opts, WithCustomTaskManager(&taskManagerMockBase{}))...,
+	)
+	t.Cleanup(deferMe)
+
+	minedOct := balanceHistoryTime(2023, time.October, 5, 12, 0)
+	minedNov := balanceHistoryTime(2023, time.November, 21, 8, 0)
+	minedJan := balanceHistoryTime(2024, time.January, 1, 0, 10)
+	seedBalanceHistory(ctx, t, client, 1, testXPubID, 100000, balanceHistoryTime(2023, time.October, 5, 11, 0), &minedOct)
+	seedBalanceHistory(ctx, t, client, 2, testXPubID, -30000, balanceHistoryTime(2023, time.November, 20, 18, 0), &minedNov)
+	seedBalanceHistory(ctx, t, client, 3, testXPubID, 5000, balanceHistoryTime(2023, time.December, 31, 23, 50), &minedJan)
+	seedBalanceHistory(ctx, t, client, 4, testXPubID, 7000, balanceHistoryTime(2024, time.January, 15, 9, 0), nil)
+
+	// Another xPub (not counted)
+	seedBalanceHistory(ctx, t, client, 5, testDraftID, 99999, balanceHistoryTime(2023, time.October, 6, 0, 0), &minedOct)
+	return ctx, client
+}
+
+// TestClient_GetXpubBalanceAt will test the method GetXpubBalanceAt()
+func TestClient_GetXpubBalanceAt(t *testing.T) {
+
+	cutPoints := []struct {
+		name         string
+		at           time.Time
+		timestamp    BalanceTimestamp
+		balance      int64
+		transactions int64
+		unmined      int64
+		settled      bool // The unmined transactions are before the checkpoint
+	}{
+		{"before the history", balanceHistoryTime(2023, time.September, 30, 0, 0), BalanceAtCreated, 0, 0, 0, false},
+		{"first transaction", balanceHistoryTime(2023, time.October, 31, 0, 0), BalanceAtCreated, 100000, 1, 0, false},
+		{"end of the year (created)", balanceHistoryTime(2023, time.December, 31, 23, 59), BalanceAtCreated, 75000, 3, 0, false},
+		{"end of the year (mined)", balanceHistoryTime(2023, time.December, 31, 23, 59), BalanceAtMined, 70000, 2, 0, false},
+		{"default timestamp", balanceHistoryTime(2023, time.December, 31, 23, 59), "", 75000, 3, 0, false},
+		{"unmined (created)", balanceHistoryTime(2024, time.January, 20, 0, 0), BalanceAtCreated, 82000, 4, 1, false},
+		{"unmined (mined)", balanceHistoryTime(2024, time.January, 20, 0, 0), BalanceAtMined, 75000, 3, 1, false},
+		{"unmined before the checkpoint (created)", balanceHistoryTime(2024, time.February, 1, 0, 0), BalanceAtCreated, 82000, 4, 1, true},
+		{"unmined before the checkpoint (mined)", balanceHistoryTime(2024, time.February, 1, 0, 0), BalanceAtMined, 75000, 3, 1, true},
+	}
+
+	assertCutPoints := func(t *testing.T, ctx context.Context, client ClientInterface) {
+		for _, cutPoint := range cutPoints {
+			unmined := cutPoint.unmined
+			if cutPoint.settled && client.IsBalanceCheckpointsEnabled() {
+				unmined = 0
+			}
+			balance, err := client.GetXpubBalanceAt(ctx, testXPubID, cutPoint.at, cutPoint.timestamp)
+			require.NoError(t, err, cutPoint.name)
+			require.NotNil(t, balance, cutPoint.name)
+			assert.Equal(t, cutPoint.balance, balance.Balance, cutPoint.name)
+			assert.Equal(t, cutPoint.transactions, balance.Transactions, cutPoint.name)
+			assert.Equal(t, unmined, balance.UnminedTransactions, cutPoint.name)
+			assert.Equal(t, unmined == 0, balance.Precise, cutPoint.name)
+			assert.Equal(t, testXPubID, balance.XpubID, cutPoint.name)
+		}
+	}
+
+	t.Run("from the transactions history", func(t *testing.T) {
+		ctx, client := newBalanceHistory(t)
+		assert.False(t, client.IsBalanceCheckpointsEnabled())
+		assertCutPoints(t, ctx, client)
+	})
+
+	t.Run("with the balance checkpoints", func(t *testing.T) {
+		ctx, client := newBalanceHistory(t, WithBalanceCheckpoints())
+		assert.True(t, client.IsBalanceCheckpointsEnabled())
+
+		until := balanceHistoryTime(2024, time.February, 1, 0, 0)
+		opts := client.DefaultModelOptions()
+		require.NoError(t, updateBalanceCheckpoints(ctx, testXPubID, BalanceAtCreated, until, opts...))
+		require.NoError(t, updateBalanceCheckpoints(ctx, testXPubID, BalanceAtMined, until, opts...))
+
+		// November to February (the first transaction is in October)
+		checkpoints, err := getBalanceCheckpoints(ctx, testXPubID, BalanceAtCreated, until, opts...)
+		require.NoError(t, err)
+		require.Len(t, checkpoints, 4)
+		assert.Equal(t, until, checkpoints[0].CheckpointAt.UTC())
+		assert.Equal(t, int64(82000), checkpoints[0].Balance)
+		checkpoints, err = getBalanceCheckpoints(ctx, testXPubID, BalanceAtMined, until, opts...)
+		require.NoError(t, err)
+		require.Len(t, checkpoints, 4)
+		assert.Equal(t, int64(75000), checkpoints[0].Balance)
+
+		assertCutPoints(t, ctx, client)
+
+		var balance *XpubBalanceAt
+		balance, err = client.GetXpubBalanceAt(ctx, testXPubID, balanceHistoryTime(2023, time.December, 31, 23, 59), BalanceAtCreated)
+		require.NoError(t, err)
+		require.NotNil(t, balance.Checkpoint)
+		assert.Equal(t, balanceHistoryTime(2023, time.December, 1, 0, 0), balance.Checkpoint.UTC())
+
+		// A late recorded transaction invalidates the checkpoints after it
+		seedBalanceHistory(ctx, t, client, 6, testXPubID, 1000, balanceHistoryTime(2023, time.November, 2, 0, 0), nil)
+		balance, err = client.GetXpubBalanceAt(ctx, testXPubID, balanceHistoryTime(2023, time.December, 31, 23, 59), BalanceAtCreated)
+		require.NoError(t, err)
+		assert.Equal(t, int64(76000), balance.Balance)
+		require.NotNil(t, balance.Checkpoint)
+		assert.Equal(t, balanceHistoryTime(2023, time.November, 1, 0, 0), balance.Checkpoint.UTC())
+
+		// The checkpoints are rebuilt from the last valid one
+		require.NoError(t, updateBalanceCheckpoints(ctx, testXPubID, BalanceAtCreated, until, opts...))
+		balance, err = client.GetXpubBalanceAt(ctx, testXPubID, balanceHistoryTime(2023, time.December, 31, 23, 59), BalanceAtCreated)
+		require.NoError(t, err)
+		assert.Equal(t, int64(76000), balance.Balance)
+		assert.Equal(t, balanceHistoryTime(2023, time.December, 1, 0, 0), balance.Checkpoint.UTC())
+
+		// A changed value (same number of transactions) invalidates the checkpoints after it
+		require.NoError(t, gormDB(client.Datastore()).Table(client.Datastore().GetTableName(tableTransactions)).
+			Where(map[string]interface{}{idField: fmt.Sprintf("%064d", 2)}).
+			Updates(map[string]interface{}{
+				"xpub_output_value": XpubOutputValue{testXPubID: -20000},
+				updatedAtField:      time.Now().UTC().Add(time.Second),
+			}).Error)
+		balance, err = client.GetXpubBalanceAt(ctx, testXPubID, balanceHistoryTime(2023, time.December, 31, 23, 59), BalanceAtCreated)
+		require.NoError(t, err)
+		assert.Equal(t, int64(86000), balance.Balance)
+		require.NotNil(t, balance.Checkpoint)
+		assert.Equal(t, balanceHistoryTime(2023, time.November, 1, 0, 0), balance.Checkpoint.UTC())
+	})
+
+	t.Run("task", func(t *testing.T) {
+		ctx, client := newBalanceHistory(t, WithBalanceCheckpoints())
+		_, err := client.NewXpub(ctx, testXPub)
+		require.NoError(t, err)
+		require.NoError(t, taskUpdateBalanceCheckpoints(ctx, client.Logger(), WithClient(client)))
+
+		var balance *XpubBalanceAt
+		balance, err = client.GetXpubBalanceAt(ctx, testXPubID, time.Now(), BalanceAtCreated)
+		require.NoError(t, err)
+		assert.Equal(t, int64(82000), balance.Balance)
+		assert.NotNil(t, balance.Checkpoint)
+	})
+}
@@ -0,0 +1,289 @@
+package bux
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/mrz1836/go-datastore"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// BalanceEventReason is the reason of a change of the balance of an xPub
+type BalanceEventReason string
+
+const (
+	// BalanceEventIncoming is when the xPub received satoshis
+	BalanceEventIncoming BalanceEventReason = "incoming"
+
+	// BalanceEventOutgoing is when the xPub sent satoshis (including the fee)
+	BalanceEventOutgoing BalanceEventReason = "outgoing"
+
+	// BalanceEventFee is when the xPub only paid the fee (IE: sending to itself)
+	BalanceEventFee BalanceEventReason = "fee"
+
+	// BalanceEventAdjustment is when the balance was changed outside a transaction (IE: revert, import)
+	BalanceEventAdjustment BalanceEventReason = "adjustment"
+)
+
+// BalanceEvent is an object representing a change of the balance of an xPub (append-only)
+//
+// Gorm related models & indexes: https://gorm.io/docs/models.html - https://gorm.io/docs/indexes.html
+type BalanceEvent struct {
+	// Base model
+	Model `bson:",inline"`
+
+	// Model specific fields
+	ID       string             `json:"id" toml:"id" yaml:"id" gorm:"<-:create;type:char(64);primaryKey;comment:This is the unique id (random)" bson:"_id"`
+	XpubID   string             `json:"xpub_id" toml:"xpub_id" yaml:"xpub_id" gorm:"<-:create;type:char(64);index;comment:This is the related xPub" bson:"xpub_id"`
+	TxID     string             `json:"tx_id" toml:"tx_id" yaml:"tx_id" gorm:"<-:create;type:varchar(64);comment:This is the related transaction (if any)" bson:"tx_id,omitempty"`
+	Delta    int64              `json:"delta" toml:"delta" yaml:"delta" gorm:"<-:create;comment:This is the change of the balance (satoshis)" bson:"delta"`
+	Balance  uint64             `json:"balance" toml:"balance" yaml:"balance" gorm:"<-:create;comment:This is the resulting balance (satoshis)" bson:"balance"`
+	Reason   BalanceEventReason `json:"reason" toml:"reason" yaml:"reason" gorm:"<-:create;type:varchar(16);comment:This is the reason of the change" bson:"reason"`
+	Sequence uint64             `json:"sequence" toml:"sequence" yaml:"sequence" gorm:"<-:create;index;comment:This is the position in the events of the xPub (starts at 1)" bson:"sequence"`
+
+	// Private fields
+	applyDelta bool // The delta is applied to the xPub balance in the transaction of the save (see applyBalanceEvent)
+}
+
+// newBalanceEvent will start a new balance event model
+func newBalanceEvent(xPubID, txID string, reason BalanceEventReason, delta int64, balance uint64,
+	opts ...ModelOps,
+) *BalanceEvent {
+	event := &BalanceEvent{
+		Balance: balance,
+		Delta:   delta,
+		Model:   *NewBaseModel(ModelBalanceEvent, opts...),
+		Reason:  reason,
+		TxID:    txID,
+		XpubID:  xPubID,
+	}
+	event.ID = event.newModelID()
+	return event
+}
+
+// getBalanceEvents will get the balance events of the xPub
+func getBalanceEvents(ctx context.Context, xPubID string, queryParams *datastore.QueryParams,
+	opts ...ModelOps,
+) ([]*BalanceEvent, error) {
+	if queryParams == nil {
+		queryParams = &datastore.QueryParams{
+			OrderByField:  sequenceField,
+			SortDirection: datastore.SortAsc,
+		}
+	}
+
+	modelItems := make([]*BalanceEvent, 0)
+	if err := getModelsByConditions(
+		ctx, ModelBalanceEvent, &modelItems, nil,
+		&map[string]interface{}{xPubIDField: xPubID}, queryParams, opts...,
+	); err != nil {
+		return nil, err
+	}
+
+	for index := range modelItems {
+		modelItems[index].enrich(ModelBalanceEvent, opts...)
+	}
+	return modelItems, nil
+}
+
+// getLastBalanceEvent will get the last balance event of the xPub (nil if there are no events)
+func getLastBalanceEvent(ctx context.Context, xPubID string, opts ...ModelOps) (*BalanceEvent, error) {
+	events, err := getBalanceEvents(ctx, xPubID, &datastore.QueryParams{
+		Page:          1,
+		PageSize:      1,
+		OrderByField:  sequenceField,
+		SortDirection: datastore.SortDesc,
+	}, opts...)
+	if err != nil && !errors.Is(err, datastore.ErrNoResults) {
+		return nil, err
+	} else if len(events) == 0 {
+		return nil, nil
+	}
+	return events[0], nil
+}
+
+// checkBalanceEvents will check that the resulting balance of the last event is the current balance of the xPub
+//
+// Without events, the balance must be zero
+func checkBalanceEvents(ctx context.Context, xPub *Xpub, opts ...ModelOps) error {
+	last, err := getLastBalanceEvent(ctx, xPub.ID, opts...)
+	if err != nil {
+		return err
+	}
+
+	var balance uint64
+	if last != nil {
+		balance = last.Balance
+	}
+	if balance != xPub.CurrentBalance {
+		return fmt.Errorf(
+			"%w: current balance %d, last event balance %d", ErrBalanceEventsMismatch, xPub.CurrentBalance, balance,
+		)
+	}
+	return nil
+}
+
+// GetModelName will get the name of the current model
+func (m *BalanceEvent) GetModelName() string {
+	return ModelBalanceEvent.String()
+}
+
+// GetModelTableName will get the db table name of the current model
+func (m *BalanceEvent) GetModelTableName() string {
+	return tableBalanceEvents
+}
+
+// Save will save the model into the Datastore
+func (m *BalanceEvent) Save(ctx context.Context) error {
+	return Save(ctx, m)
+}
+
+// GetID will get the ID
+func (m *BalanceEvent) GetID() string {
+	return m.ID
+}
+
+// BeforeCreating will fire before the model is being inserted into the Datastore
+func (m *BalanceEvent) BeforeCreating(ctx context.Context) error {
+	m.DebugLog("starting: " + m.Name() + " BeforeCreating hook...")
+
+	// Make sure ID is valid
+	if len(m.ID) == 0 {
+		return ErrMissingFieldID
+	} else if len(m.XpubID) == 0 {
+		return ErrMissingFieldXpubID
+	}
+
+	// Next position in the events of the xPub (SQL: numbered in the transaction of the save, see applyBalanceEvent)
+	if m.Sequence == 0 && gormDB(m.Client().Datastore()) == nil {
+		last, err := getLastBalanceEvent(ctx, m.XpubID, m.GetOptions(false)...)
+		if err != nil {
+			return err
+		} else if last != nil {
+			m.Sequence = last.Sequence
+		}
+		m.Sequence++
+	}
+
+	m.DebugLog("end: " + m.Name() + " BeforeCreating hook")
+	return nil
+}
+
+// Migrate model specific migration on startup
+func (m *BalanceEvent) Migrate(client datastore.ClientInterface) error {
+	if err := m.migrateSequences(client); err != nil {
+		return err
+	}
+	return client.IndexMetadata(client.GetTableName(tableBalanceEvents), metadataField)
+}
+
+// migrateSequences will number the events recorded before the sequence (by the creation time, then the id)
+func (m *BalanceEvent) migrateSequences(client datastore.ClientInterface) error {
+	if client.Engine() == datastore.MongoDB {
+		return m.migrateSequencesMongoDB(client)
+	}
+
+	// The events are copied into a derived table (MySQL can not select from the updated table)
+	tableName := client.GetTableName(tableBalanceEvents)
+	tx := client.Execute(`UPDATE ` + tableName + ` SET ` + sequenceField + ` = (` +
+		`SELECT COUNT(*) FROM (SELECT ` + idField + `, ` + xPubIDField + `, ` + createdAtField + ` FROM ` +
+		tableName + `) e WHERE e.` + xPubIDField + ` = ` + tableName + `.` + xPubIDField + ` AND (e.` +
+		createdAtField + ` < ` + tableName + `.` + createdAtField + ` OR (e.` + createdAtField + ` = ` +
+		tableName + `.` + createdAtField + ` AND e.` + idField + ` <= ` + tableName + `.` + idField + `))` +
+		`) WHERE ` + sequenceField + ` = 0 OR ` + sequenceField + ` IS NULL`)
+	return tx.Error
+}
+
+// migrateSequencesMongoDB will number the events recorded before the sequence (MongoDB)
+func (m *BalanceEvent) migrateSequencesMongoDB(client datastore.ClientInterface) error {
+	ctx := context.Background()
+	collection := client.GetMongoCollectionByTableName(client.GetTableName(tableBalanceEvents))
+
+	// Nothing to number (IE: a new database)
+	count, err := collection.CountDocuments(ctx, bson.M{sequenceField: bson.M{"$in": bson.A{0, nil}}})
+	if err != nil || count == 0 {
+		return err
+	}
+
+	var cursor *mongo.Cursor
+	if cursor, err = collection.Find(ctx, bson.M{}, options.Find().SetSort(
+		bson.D{{Key: xPubIDField, Value: 1}, {Key: createdAtField, Value: 1}, {Key: "_id", Value: 1}},
+	)); err != nil {
+		return err
+	}
+	defer func() {
+		_ = cursor.Close(ctx)
+	}()
+
+	sequences := make(map[string]uint64)
+	for cursor.Next(ctx) {
+		var event struct {
+			ID     string `bson:"_id"`
+			XpubID string `bson:"xpub_id"`
+		}
+		if err = cursor.Decode(&event); err != nil {
+			return err
+		}
+		sequences[event.XpubID]++
+		if _, err = collection.UpdateOne(
+			ctx, bson.M{"_id": event.ID}, bson.M{"$set": bson.M{sequenceField: sequences[event.XpubID]}},
+		); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+// applyBalanceEvent will number the balance event and apply its delta to the xPub balance (if set) in the
+// transaction of the save (gorm create callback, see registerBalanceEventCallback)
+//
+// The xPub is locked for the update, the resulting balance and the next sequence of the events are set on the
+// event before it is inserted
+func applyBalanceEvent(tx *gorm.DB, event *BalanceEvent) error {
+	ds := event.Client().Datastore()
+	if event.applyDelta {
+		event.applyDelta = false
+
+		xPubsTable := ds.GetTableName(tableXPubs)
+		var balance int64
+		if err := tx.Table(xPubsTable).Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where(idField+" = ?", event.XpubID).Select(currentBalanceField).Row().Scan(&balance); err != nil {
+			return err
+		}
+		balance += event.Delta
+		if err := tx.Table(xPubsTable).Where(idField+" = ?", event.XpubID).
+			UpdateColumn(currentBalanceField, balance).Error; err != nil {
+			return err
+		}
+		event.Balance = uint64(balance)
+	}
+
+	if event.Sequence == 0 {
+		var sequence uint64
+		if err := tx.Table(ds.GetTableName(tableBalanceEvents)).Where(xPubIDField+" = ?", event.XpubID).
+			Select("COALESCE(MAX(" + sequenceField + "), 0)").Row().Scan(&sequence); err != nil {
+			return err
+		}
+		event.Sequence = sequence + 1
+	}
+	return nil
+}
+
+// registerBalanceEventCallback will register the gorm create callback applying the balance events
+// (see applyBalanceEvent)
+func registerBalanceEventCallback(ds datastore.ClientInterface) error {
+	db := gormDB(ds)
+	if db == nil || db.Callback().Create().Get(balanceEventCallbackName) != nil {
+		return nil
+	}
+	return db.Callback().Create().Before("gorm:create").Register(balanceEventCallbackName, func(tx *gorm.DB) {
+		if event, ok := tx.Statement.Dest.(*BalanceEvent); ok && tx.Error == nil {
+			_ = tx.AddError(applyBalanceEvent(tx.Session(&gorm.Session{NewDB: true}), event))
+		}
+	})
+}
@@ -0,0 +1,139 @@
+package bux
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestTransaction_balanceEventReason will test the method balanceEventReason()
+func TestTransaction_balanceEventReason(t *testing.T) {
+	t.Parallel()
+
+	transaction := &Transaction{Fee: 97}
+	assert.Equal(t, BalanceEventIncoming, transaction.balanceEventReason(1000))
+	assert.Equal(t, BalanceEventOutgoing, transaction.balanceEventReason(-1097))
+	assert.Equal(t, BalanceEventFee, transaction.balanceEventReason(-97))
+	assert.Equal(t, BalanceEventOutgoing, (&Transaction{}).balanceEventReason(-97))
+}
+
+// TestClient_GetBalanceEvents will test the methods GetBalanceEvents() and CheckBalanceEvents()
+func TestClient_GetBalanceEvents(t *testing.T) {
+	t.Parallel()
+
+	t.Run("incoming and outgoing", func(t *testing.T) {
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, true, WithCustomTaskManager(&taskManagerMockBase{}))
+		t.Cleanup(deferMe)
+
+		fixtures := NewFixtures(t, client).WithXpub(0).WithUtxos(1000, 2000).WithDraft(&TransactionConfig{
+			Outputs: []*TransactionOutput{{
+				To:       testExternalAddress,
+				Satoshis: 500,
+			}},
+		})
+		draft := fixtures.Drafts[0]
+		transaction, err := client.RecordTransaction(ctx, fixtures.RawXpub, draft.Hex, draft.ID)
+		require.NoError(t, err)
+
+		var events []*BalanceEvent
+		events, err = client.GetBalanceEvents(ctx, fixtures.RawXpub, nil)
+		require.NoError(t, err)
+		require.Len(t, events, 2)
+
+		assert.Equal(t, BalanceEventIncoming, events[0].Reason)
+		assert.Equal(t, fixtures.Transactions[0].ID, events[0].TxID)
+		assert.Equal(t, int64(3000), events[0].Delta)
+		assert.Equal(t, uint64(3000), events[0].Balance)
+
+		assert.Equal(t, BalanceEventOutgoing, events[1].Reason)
+		assert.Equal(t, transaction.ID, events[1].TxID)
+		assert.Equal(t, -int64(500+transaction.Fee), events[1].Delta)
+		assert.Equal(t, 3000-500-transaction.Fee, events[1].Balance)
+		assert.Equal(t, fixtures.Xpub.ID, events[1].XpubID)
+
+		require.NoError(t, client.CheckBalanceEvents(ctx, fixtures.Xpub.ID))
+	})
+
+	t.Run("starting balance is an adjustment", func(t *testing.T) {
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, true, WithCustomTaskManager(&taskManagerMockBase{}))
+		defer deferMe()
+
+		fixtures := NewFixtures(t, client).WithXpub(5000)
+
+		events, err := client.GetBalanceEvents(ctx, fixtures.Xpub.ID, nil)
+		require.NoError(t, err)
+		require.Len(t, events, 1)
+		assert.Equal(t, BalanceEventAdjustment, events[0].Reason)
+		assert.Equal(t, uint64(5000), events[0].Balance)
+
+		require.NoError(t, client.CheckBalanceEvents(ctx, fixtures.Xpub.ID))
+	})
+
+	t.Run("drift is detected", func(t *testing.T) {
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, true, WithCustomTaskManager(&taskManagerMockBase{}))
+		defer deferMe()
+
+		fixtures := NewFixtures(t, client).WithXpub(0)
+		require.NoError(t, client.CheckBalanceEvents(ctx, fixtures.Xpub.ID))
+
+		// Balance changed without an event
+		fixtures.Xpub.CurrentBalance = 1000
+		require.NoError(t, fixtures.Xpub.Save(ctx))
+
+		err := client.CheckBalanceEvents(ctx, fixtures.Xpub.ID)
+		require.ErrorIs(t, err, ErrBalanceEventsMismatch)
+		assert.Contains(t, err.Error(), "current balance 1000, last event balance 0")
+
+		err = client.CheckBalanceEvents(ctx, testXPubID)
+		assert.ErrorIs(t, err, ErrMissingXpub)
+	})
+}
+
+// TestBalanceEvent_sequence will test the events of an xPub are numbered (and the events before the sequence)
+func TestBalanceEvent_sequence(t *testing.T) {
+	t.Parallel()
+
+	ctx, client, deferMe := CreateTestSQLiteClient(t, false, true, WithCustomTaskManager(&taskManagerMockBase{}))
+	defer deferMe()
+
+	fixtures := NewFixtures(t, client).WithXpub(0)
+	xPub, err := getXpubByID(ctx, fixtures.Xpub.ID, client.DefaultModelOptions()...)
+	require.NoError(t, err)
+	for _, increment := range []int64{1000, -200, 300} {
+		require.NoError(t, xPub.incrementBalance(ctx, increment, "", BalanceEventAdjustment))
+	}
+	assert.Equal(t, uint64(1100), xPub.CurrentBalance)
+
+	// Recorded in the same second (the created_at is not an order)
+	table := client.Datastore().GetTableName(tableBalanceEvents)
+	require.NoError(t, gormDB(client.Datastore()).Table(table).
+		Where(xPubIDField+" = ?", xPub.ID).Update(createdAtField, time.Now().UTC().Truncate(time.Second)).Error)
+
+	assertSequence := func() {
+		events, err := getBalanceEvents(ctx, xPub.ID, nil, client.DefaultModelOptions()...)
+		require.NoError(t, err)
+		require.Len(t, events, 3)
+		for index, event := range events {
+			assert.Equal(t, uint64(index+1), event.Sequence)
+		}
+		assert.Equal(t, []uint64{1000, 800, 1100}, []uint64{events[0].Balance, events[1].Balance, events[2].Balance})
+		require.NoError(t, client.CheckBalanceEvents(ctx, xPub.ID))
+	}
+	assertSequence()
+
+	// The events before the sequence are numbered by the migration (same creation time: by id)
+	require.NoError(t, gormDB(client.Datastore()).Table(table).
+		Where(xPubIDField+" = ?", xPub.ID).Update(sequenceField, 0).Error)
+	require.NoError(t, (&BalanceEvent{}).migrateSequences(client.Datastore()))
+	events, err := getBalanceEvents(ctx, xPub.ID, nil, client.DefaultModelOptions()...)
+	require.NoError(t, err)
+	require.Len(t, events, 3)
+	for index, event := range events {
+		assert.Equal(t, uint64(index+1), event.Sequence)
+		if index > 0 {
+			assert.Less(t, events[index-1].ID, event.ID)
+		}
+	}
+}
@@ -6,12 +6,14 @@ import (
 	"encoding/csv"
 	"encoding/hex"
 	"errors"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
 	"strconv"
 	"time"
 
+	"github.com/BuxOrg/bux/taskmanager"
 	"github.com/BuxOrg/bux/utils"
 	"github.com/libsv/go-bc"
 	"github.com/mrz1836/go-datastore"
@@ -192,6 +194,26 @@ func getBlockHeaderByHeight(ctx context.Context, height uint32, opts ...ModelOps
 	return blockHeader, nil
 }
 
+// getBlockHeaderByHash will get the block header by the given hash
+func getBlockHeaderByHash(ctx context.Context, hash string, opts ...ModelOps) (*BlockHeader, error) {
+
+	// Construct an empty model
+	blockHeader := &BlockHeader{
+		ID:    hash,
+		Model: *NewBaseModel(ModelBlockHeader, opts...),
+	}
+
+	// Get the record
+	if err := Get(ctx, blockHeader, nil, true, defaultDatabaseReadTimeout, false); err != nil {
+		if errors.Is(err, datastore.ErrNoResults) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return blockHeader, nil
+}
+
 // BeforeCreating will fire before the model is being inserted into the Datastore
 func (m *BlockHeader) BeforeCreating(_ context.Context) error {
 
@@ -214,11 +236,51 @@ func (m *BlockHeader) AfterCreated(_ context.Context) error {
 	return nil
 }
 
+// RegisterTasks will register the model specific tasks on client initialization
+func (m *BlockHeader) RegisterTasks() error {
+
+	// No task manager loaded? (or the headers are not synced from a provider)
+	tm := m.Client().Taskmanager()
+	if tm == nil || !m.Client().IsBlockHeaderSyncEnabled() {
+		return nil
+	}
+
+	// Register the task locally (cron task - set the defaults)
+	syncTask := m.Name() + "_sync"
+	ctx := context.Background()
+
+	// Register the task
+	if err := tm.RegisterTask(&taskmanager.Task{
+		Name:       syncTask,
+		RetryLimit: 1,
+		Handler: func(client ClientInterface) error {
+			if _, taskErr := client.SyncBlockHeaders(ctx); taskErr != nil {
+				client.Logger().Error(ctx, "error running "+syncTask+" task: "+taskErr.Error())
+			}
+			return nil
+		},
+	}); err != nil {
+		return err
+	}
+
+	// Run the task periodically
+	return tm.RunTask(ctx, &taskmanager.TaskOptions{
+		Arguments:      []interface{}{m.Client()},
+		RunEveryPeriod: m.Client().GetTaskPeriod(syncTask),
+		TaskName:       syncTask,
+	})
+}
+
 // Display filter the model for display
 func (m *BlockHeader) Display() interface{} {
 	return m
 }
 
+// DisplayFor filter the model for display without the fields hidden from the profile (see RegisterDisplayMask)
+func (m *BlockHeader) DisplayFor(profile string) interface{} {
+	return displayFor(ModelBlockHeader, m.Display(), profile)
+}
+
 // Migrate model specific migration on startup
 func (m *BlockHeader) Migrate(client datastore.ClientInterface) error {
 	// import all previous block headers from file
@@ -350,6 +412,11 @@ func (m *BlockHeader) importCSVFile(ctx context.Context, blockFile string,
 
 		height := uint32(parsedInt)
 
+		// Make sure the block headers belong to the configured network (genesis block)
+		if height == 0 && row[0] != networkGenesisHash(getClientNetwork(m.Client())) {
+			return fmt.Errorf("%w: unexpected genesis block %s", ErrBlockHeaderNetworkMismatch, row[0])
+		}
+
 		if parsedInt, err = strconv.ParseUint(row[3], 10, 32); err != nil {
 			return err
 		}
@@ -0,0 +1,140 @@
+package bux
+
+import (
+	"context"
+	"time"
+
+	"github.com/BuxOrg/bux/chainstate"
+	"github.com/mrz1836/go-datastore"
+)
+
+// BroadcastReceipt is an object representing the complete response envelope of a broadcast provider
+//
+// The mAPI responses are signed by the miner, the receipt is the proof that the transaction was submitted at the
+// given time (see VerifyBroadcastReceipt). Receipts are stored apart from the sync results (never trimmed).
+//
+// Gorm related models & indexes: https://gorm.io/docs/models.html - https://gorm.io/docs/indexes.html
+type BroadcastReceipt struct {
+	// Base model
+	Model `bson:",inline"`
+
+	// Model specific fields
+	ID         string    `json:"id" toml:"id" yaml:"id" gorm:"<-:create;type:varchar(64);primaryKey;comment:This is the unique id (random)" bson:"_id"`
+	TxID       string    `json:"tx_id" toml:"tx_id" yaml:"tx_id" gorm:"<-:create;type:char(64);index;comment:This is the related sync transaction" bson:"tx_id"`
+	Provider   string    `json:"provider" toml:"provider" yaml:"provider" gorm:"<-:create;type:varchar(64);comment:This is the broadcast provider (miner name)" bson:"provider"`
+	Payload    string    `json:"payload" toml:"payload" yaml:"payload" gorm:"<-:create;type:text;comment:This is the response payload (as returned)" bson:"payload"`
+	Signature  string    `json:"signature" toml:"signature" yaml:"signature" gorm:"<-:create;type:varchar(255);comment:This is the signature of the payload (hex)" bson:"signature,omitempty"`
+	PublicKey  string    `json:"public_key" toml:"public_key" yaml:"public_key" gorm:"<-:create;type:varchar(130);comment:This is the public key of the signer (hex)" bson:"public_key,omitempty"`
+	Encoding   string    `json:"encoding" toml:"encoding" yaml:"encoding" gorm:"<-:create;type:varchar(32);comment:This is the encoding of the payload" bson:"encoding"`
+	MimeType   string    `json:"mime_type" toml:"mime_type" yaml:"mime_type" gorm:"<-:create;type:varchar(64);comment:This is the mime type of the payload" bson:"mime_type"`
+	ReceivedAt time.Time `json:"received_at" toml:"received_at" yaml:"received_at" gorm:"<-:create;comment:When the response was received" bson:"received_at"`
+}
+
+// newBroadcastReceipt will start a new model from the receipt of the broadcast provider
+func newBroadcastReceipt(txID string, receipt *chainstate.BroadcastReceipt, opts ...ModelOps) *BroadcastReceipt {
+	model := &BroadcastReceipt{
+		Encoding:   receipt.Encoding,
+		MimeType:   receipt.MimeType,
+		Model:      *NewBaseModel(ModelBroadcastReceipt, opts...),
+		Payload:    receipt.Payload,
+		Provider:   receipt.Provider,
+		PublicKey:  receipt.PublicKey,
+		ReceivedAt: receipt.ReceivedAt,
+		Signature:  receipt.Signature,
+		TxID:       txID,
+	}
+	model.ID = model.newModelID()
+	return model
+}
+
+// getBroadcastReceipts will get the receipts of the broadcasts of the transaction (oldest first)
+func getBroadcastReceipts(ctx context.Context, txID string, opts ...ModelOps) ([]*BroadcastReceipt, error) {
+	modelItems := make([]*BroadcastReceipt, 0)
+	if err := getModelsByConditions(
+		ctx, ModelBroadcastReceipt, &modelItems, nil,
+		&map[string]interface{}{txIDField: txID}, &datastore.QueryParams{
+			OrderByField:  createdAtField,
+			SortDirection: datastore.SortAsc,
+		}, opts...,
+	); err != nil {
+		return nil, err
+	}
+
+	for index := range modelItems {
+		modelItems[index].enrich(ModelBroadcastReceipt, opts...)
+	}
+	return modelItems, nil
+}
+
+// saveBroadcastReceipts will save the receipts collected during the broadcast of the sync transaction
+//
+// A failure is only logged, the broadcast already happened
+func saveBroadcastReceipts(ctx context.Context, syncTx *SyncTransaction, receipts *chainstate.BroadcastReceipts) {
+	for _, receipt := range receipts.Receipts() {
+		if err := newBroadcastReceipt(
+			syncTx.ID, receipt, append(syncTx.GetOptions(false), New())...,
+		).Save(ctx); err != nil {
+			syncTx.Client().Logger().Error(ctx,
+				"failed saving the broadcast receipt of tx "+syncTx.ID+" from "+receipt.Provider+": "+err.Error(),
+			)
+		}
+	}
+}
+
+// VerifyBroadcastReceipt will check the signature of the provider (miner) over the payload of the receipt
+//
+// chainstate.ErrBroadcastReceiptUnsigned is returned if the receipt is not signed (IE: not a mAPI response)
+func VerifyBroadcastReceipt(receipt *BroadcastReceipt) error {
+	if receipt == nil {
+		return chainstate.ErrBroadcastReceiptUnsigned
+	}
+	return chainstate.VerifyBroadcastReceipt(&chainstate.BroadcastReceipt{
+		Encoding:   receipt.Encoding,
+		MimeType:   receipt.MimeType,
+		Payload:    receipt.Payload,
+		Provider:   receipt.Provider,
+		PublicKey:  receipt.PublicKey,
+		ReceivedAt: receipt.ReceivedAt,
+		Signature:  receipt.Signature,
+	})
+}
+
+// GetModelName will get the name of the current model
+func (m *BroadcastReceipt) GetModelName() string {
+	return ModelBroadcastReceipt.String()
+}
+
+// GetModelTableName will get the db table name of the current model
+func (m *BroadcastReceipt) GetModelTableName() string {
+	return tableBroadcastReceipts
+}
+
+// Save will save the model into the Datastore
+func (m *BroadcastReceipt) Save(ctx context.Context) error {
+	return Save(ctx, m)
+}
+
+// GetID will get the ID
+func (m *BroadcastReceipt) GetID() string {
+	return m.ID
+}
+
+// BeforeCreating will fire before the model is being inserted into the Datastore
+func (m *BroadcastReceipt) BeforeCreating(_ context.Context) error {
+	m.DebugLog("starting: " + m.Name() + " BeforeCreating hook...")
+
+	// Make sure ID is valid
+	if len(m.ID) == 0 {
+		return ErrMissingFieldID
+	} else if len(m.TxID) == 0 {
+		return ErrMissingTransaction
+	}
+
+	m.DebugLog("end: " + m.Name() + " BeforeCreating hook")
+	return nil
+}
+
+// Migrate model specific migration on startup
+func (m *BroadcastReceipt) Migrate(client datastore.ClientInterface) error {
+	return client.IndexMetadata(client.GetTableName(tableBroadcastReceipts), metadataField)
+}
@@ -0,0 +1,98 @@
+package bux
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/BuxOrg/bux/chainstate"
+	"github.com/libsv/go-bk/envelope"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestClient_GetBroadcastReceipts will test keeping the broadcast responses (proof of submission)
+func TestClient_GetBroadcastReceipts(t *testing.T) {
+	t.Parallel()
+
+	signed, err := envelope.NewJSONEnvelope(map[string]string{"returnResult": "success", "txid": testTxID})
+	require.NoError(t, err)
+
+	// The miner signs the response, the other provider does not
+	mock := chainstate.NewMockClient()
+	rejected := true
+	mock.BroadcastFunc = func(ctx context.Context, _, _ string, _ time.Duration) (string, error) {
+		chainstate.RecordBroadcastReceipt(ctx, &chainstate.BroadcastReceipt{
+			Encoding:   signed.Encoding,
+			MimeType:   signed.MimeType,
+			Payload:    signed.Payload,
+			Provider:   "miner",
+			PublicKey:  *signed.PublicKey,
+			ReceivedAt: time.Now().UTC(),
+			Signature:  *signed.Signature,
+		})
+		chainstate.RecordBroadcastReceipt(ctx, &chainstate.BroadcastReceipt{
+			Payload:    `{"txStatus":"SEEN_ON_NETWORK"}`,
+			Provider:   chainstate.ProviderBroadcastClient,
+			ReceivedAt: time.Now().UTC(),
+		})
+		if rejected {
+			return chainstate.ProviderAll, fmt.Errorf("broadcast failed: %w", &chainstate.BroadcastRejection{
+				Message: "connection refused", Provider: "miner", Reason: chainstate.RejectionProviderUnavailable,
+			})
+		}
+		return "miner", nil
+	}
+
+	ctx, client, deferMe := CreateTestSQLiteClient(t, false, true,
+		WithCustomTaskManager(&taskManagerMockBase{}), WithCustomChainstate(mock),
+	)
+	t.Cleanup(deferMe) // After the clean-up of the fixtures
+
+	fixtures := NewFixtures(t, client).WithXpub(0).WithUtxos(10000).WithDraft(&TransactionConfig{
+		Outputs: []*TransactionOutput{{To: testExternalAddress, Satoshis: 1000}},
+		Sync:    &SyncConfig{Broadcast: true},
+	})
+	signedHex, err := fixtures.Drafts[0].SignInputs(fixtures.HDKey)
+	require.NoError(t, err)
+	transaction, err := client.RecordTransaction(ctx, fixtures.RawXpub, signedHex, fixtures.Drafts[0].ID)
+	require.NoError(t, err)
+
+	var syncTx *SyncTransaction
+	syncTx, err = GetSyncTransactionByID(ctx, transaction.ID, client.DefaultModelOptions()...)
+	require.NoError(t, err)
+
+	// The responses of a rejected broadcast are kept
+	require.NoError(t, processBroadcastTransaction(ctx, syncTx))
+	receipts, err := client.GetBroadcastReceipts(ctx, transaction.ID)
+	require.NoError(t, err)
+	require.Len(t, receipts, 2)
+
+	// Accepted, the history of the sync results is trimmed (the receipts are not)
+	rejected = false
+	syncTx, err = GetSyncTransactionByID(ctx, transaction.ID, client.DefaultModelOptions()...)
+	require.NoError(t, err)
+	for i := 0; i < 30; i++ {
+		syncTx.Results.Results = append(syncTx.Results.Results, &SyncResult{Action: syncActionSync})
+	}
+	require.NoError(t, processBroadcastTransaction(ctx, syncTx))
+	receipts, err = client.GetBroadcastReceipts(ctx, transaction.ID)
+	require.NoError(t, err)
+	require.Len(t, receipts, 4)
+
+	for _, receipt := range receipts {
+		assert.Equal(t, transaction.ID, receipt.TxID)
+		if receipt.Provider == "miner" {
+			assert.NoError(t, VerifyBroadcastReceipt(receipt))
+			assert.Equal(t, signed.Payload, receipt.Payload)
+		} else {
+			assert.ErrorIs(t, VerifyBroadcastReceipt(receipt), chainstate.ErrBroadcastReceiptUnsigned)
+		}
+	}
+
+	// A changed payload is detected
+	receipts[0].Payload = `{"returnResult":"failure"}`
+	assert.ErrorIs(t, VerifyBroadcastReceipt(receipts[0]), chainstate.ErrInvalidBroadcastReceipt)
+	assert.ErrorIs(t, VerifyBroadcastReceipt(nil), chainstate.ErrBroadcastReceiptUnsigned)
+}
@@ -0,0 +1,111 @@
+package bux
+
+import (
+	"sync"
+	"time"
+
+	"github.com/newrelic/go-agent/v3/newrelic"
+)
+
+// modelCacheMetricName is the prefix of the cache metrics (+ model name + /hit or /miss)
+const modelCacheMetricName = "Custom/bux/model_cache/"
+
+// ModelCacheStats are the reads of a cached model (see WithModelCacheTTL)
+type ModelCacheStats struct {
+	Hits   uint64 `json:"hits"`   // Reads returned from the cache
+	Misses uint64 `json:"misses"` // Reads from the datastore (not in the cache)
+}
+
+// modelCacheOptions holds the cache TTLs of the models (and the cache reads)
+type modelCacheOptions struct {
+	mu    sync.Mutex                  // Guards the stats
+	stats map[string]*ModelCacheStats // Reads by model name
+	ttls  map[string]time.Duration    // TTL by model name (0 = not cached, missing = no expiration)
+}
+
+// newModelCacheOptions will return the default cache options (cached without expiration)
+func newModelCacheOptions() *modelCacheOptions {
+	return &modelCacheOptions{
+		stats: make(map[string]*ModelCacheStats),
+		ttls:  make(map[string]time.Duration),
+	}
+}
+
+// ttl will return the cache TTL of the model, false if the model is not cached
+func (o *modelCacheOptions) ttl(modelName string) (time.Duration, bool) {
+	if o == nil {
+		return 0, true
+	}
+	ttl, ok := o.ttls[modelName]
+	if !ok {
+		return 0, true
+	}
+	return ttl, ttl > 0
+}
+
+// recordRead will count a read of the model (hit or miss) and record the metric (if NewRelic is enabled)
+func (o *modelCacheOptions) recordRead(app *newrelic.Application, modelName string, hit bool) {
+	if o == nil {
+		return
+	}
+	o.mu.Lock()
+	stats, ok := o.stats[modelName]
+	if !ok {
+		stats = &ModelCacheStats{}
+		o.stats[modelName] = stats
+	}
+	metric := "/miss"
+	if hit {
+		stats.Hits++
+		metric = "/hit"
+	} else {
+		stats.Misses++
+	}
+	o.mu.Unlock()
+
+	if app != nil {
+		app.RecordCustomMetric(modelCacheMetricName+modelName+metric, 1)
+	}
+}
+
+// snapshot will return a copy of the reads by model name
+func (o *modelCacheOptions) snapshot() map[string]ModelCacheStats {
+	stats := make(map[string]ModelCacheStats)
+	if o == nil {
+		return stats
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for modelName, modelStats := range o.stats {
+		stats[modelName] = *modelStats
+	}
+	return stats
+}
+
+// ModelCacheStats will return the cache reads (hits and misses) by model name, to tune the TTLs
+// (see WithModelCacheTTL)
+func (c *Client) ModelCacheStats() map[string]ModelCacheStats {
+	return c.options.modelCache.snapshot()
+}
+
+// modelCacheClient caches the models (see WithModelCacheTTL), implemented by Client
+//
+// The models are not cached with other implementations of the client
+type modelCacheClient interface {
+	modelCacheTTL(modelName string) (time.Duration, bool)
+	recordModelCacheRead(modelName string, hit bool)
+}
+
+// modelCacheTTL will return the cache TTL of the model, false if the model is not cached (see WithModelCacheTTL)
+func (c *Client) modelCacheTTL(modelName string) (time.Duration, bool) {
+	return c.options.modelCache.ttl(modelName)
+}
+
+// recordModelCacheRead will count a cached read of the model (hit or miss)
+func (c *Client) recordModelCacheRead(modelName string, hit bool) {
+	var app *newrelic.Application
+	if c.IsNewRelicEnabled() && c.options.newRelic.app != nil {
+		app = c.options.newRelic.app
+	}
+	c.options.modelCache.recordRead(app, modelName, hit)
+}
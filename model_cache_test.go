@@ -0,0 +1,111 @@
+package bux
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestWithModelCacheTTL will test the method WithModelCacheTTL()
+func TestWithModelCacheTTL(t *testing.T) {
+	t.Parallel()
+
+	t.Run("check type", func(t *testing.T) {
+		assert.IsType(t, *new(ClientOps), WithModelCacheTTL(ModelXPub.String(), time.Minute))
+	})
+
+	t.Run("default - cached without expiration", func(t *testing.T) {
+		options := defaultClientOptions()
+		ttl, cached := options.modelCache.ttl(ModelXPub.String())
+		assert.True(t, cached)
+		assert.Equal(t, time.Duration(0), ttl)
+	})
+
+	t.Run("set a ttl", func(t *testing.T) {
+		options := defaultClientOptions()
+		WithModelCacheTTL(ModelXPub.String(), time.Minute)(options)
+		ttl, cached := options.modelCache.ttl(ModelXPub.String())
+		assert.True(t, cached)
+		assert.Equal(t, time.Minute, ttl)
+	})
+
+	t.Run("zero ttl disables the cache", func(t *testing.T) {
+		options := defaultClientOptions()
+		WithModelCacheTTL(ModelXPub.String(), 0)(options)
+		_, cached := options.modelCache.ttl(ModelXPub.String())
+		assert.False(t, cached)
+
+		_, cached = options.modelCache.ttl(ModelDestination.String())
+		assert.True(t, cached)
+	})
+
+	t.Run("empty name or negative ttl is ignored", func(t *testing.T) {
+		options := defaultClientOptions()
+		WithModelCacheTTL("", time.Minute)(options)
+		WithModelCacheTTL(ModelXPub.String(), -time.Minute)(options)
+		assert.Empty(t, options.modelCache.ttls)
+	})
+}
+
+// Test_getXpubWithCache_modelCache will test the cache TTLs, the bypass and the cache reads
+func Test_getXpubWithCache_modelCache(t *testing.T) {
+
+	t.Run("hits and misses", func(t *testing.T) {
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, false, WithCustomTaskManager(&taskManagerMockBase{}))
+		defer deferMe()
+
+		// Not in the cache: read from the datastore (and cached)
+		require.NoError(t, client.Cachestore().Delete(ctx, fmt.Sprintf(cacheKeyXpubModel, testXPubID)))
+		require.NoError(t, newXpub(testXPub, client.DefaultModelOptions(New())...).Save(ctx))
+		require.NoError(t, client.Cachestore().Delete(ctx, fmt.Sprintf(cacheKeyXpubModel, testXPubID)))
+
+		xPub, err := getXpubWithCache(ctx, client, "", testXPubID, client.DefaultModelOptions()...)
+		require.NoError(t, err)
+		require.NotNil(t, xPub)
+
+		xPub, err = getXpubWithCache(ctx, client, "", testXPubID, client.DefaultModelOptions()...)
+		require.NoError(t, err)
+		require.NotNil(t, xPub)
+
+		assert.Equal(t, ModelCacheStats{Hits: 1, Misses: 1}, client.ModelCacheStats()[ModelXPub.String()])
+	})
+
+	t.Run("skip cache", func(t *testing.T) {
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, false, WithCustomTaskManager(&taskManagerMockBase{}))
+		defer deferMe()
+
+		require.NoError(t, newXpub(testXPub, client.DefaultModelOptions(New())...).Save(ctx))
+
+		xPub, err := getXpubWithCache(ctx, client, "", testXPubID, client.DefaultModelOptions(SkipCache())...)
+		require.NoError(t, err)
+		require.NotNil(t, xPub)
+
+		// The bypass is not a cache read
+		assert.Empty(t, client.ModelCacheStats())
+	})
+
+	t.Run("zero ttl - not cached", func(t *testing.T) {
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, false,
+			WithCustomTaskManager(&taskManagerMockBase{}), WithModelCacheTTL(ModelXPub.String(), 0),
+		)
+		defer deferMe()
+
+		require.NoError(t, newXpub(testXPub, client.DefaultModelOptions(New())...).Save(ctx))
+
+		// Nothing was saved to the cache
+		cached := new(Xpub)
+		require.Error(t, client.Cachestore().GetModel(ctx, fmt.Sprintf(cacheKeyXpubModel, testXPubID), cached))
+
+		xPub, err := getXpubWithCache(ctx, client, "", testXPubID, client.DefaultModelOptions()...)
+		require.NoError(t, err)
+		require.NotNil(t, xPub)
+		assert.Equal(t, testXPubID, xPub.ID)
+
+		assert.Empty(t, client.ModelCacheStats())
+		require.Error(t, client.Cachestore().GetModel(ctx, fmt.Sprintf(cacheKeyXpubModel, testXPubID), cached))
+		assert.Equal(t, map[string]string{ModelXPub.String(): "0s"}, client.ConfigSummary().Cachestore.ModelTTLs)
+	})
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strings"
 
 	"github.com/BuxOrg/bux/cluster"
 	"github.com/BuxOrg/bux/notifications"
@@ -21,15 +22,17 @@ type Destination struct {
 	Model `bson:",inline"`
 
 	// Model specific fields
-	ID            string               `json:"id" toml:"id" yaml:"id" gorm:"<-:create;type:char(64);primaryKey;comment:This is the hash of the locking script" bson:"_id"`
-	XpubID        string               `json:"xpub_id" toml:"xpub_id" yaml:"xpub_id" gorm:"<-:create;type:char(64);index;comment:This is the related xPub" bson:"xpub_id"`
-	LockingScript string               `json:"locking_script" toml:"locking_script" yaml:"locking_script" gorm:"<-:create;type:text;comment:This is Bitcoin output script in hex" bson:"locking_script"`
-	Type          string               `json:"type" toml:"type" yaml:"type" gorm:"<-:create;type:text;comment:Type of output" bson:"type"`
-	Chain         uint32               `json:"chain" toml:"chain" yaml:"chain" gorm:"<-:create;type:int;comment:This is the (chain)/num location of the address related to the xPub" bson:"chain"`
-	Num           uint32               `json:"num" toml:"num" yaml:"num" gorm:"<-:create;type:int;comment:This is the chain/(num) location of the address related to the xPub" bson:"num"`
-	Address       string               `json:"address" toml:"address" yaml:"address" gorm:"<-:create;type:varchar(35);index;comment:This is the BitCoin address" bson:"address"`
-	DraftID       string               `json:"draft_id" toml:"draft_id" yaml:"draft_id" gorm:"<-:create;type:varchar(64);index;comment:This is the related draft id (if internal tx)" bson:"draft_id,omitempty"`
-	Monitor       customTypes.NullTime `json:"monitor" toml:"monitor" yaml:"monitor" gorm:";index;comment:When this address was last used for an external transaction, for monitoring" bson:"monitor,omitempty"`
+	ID                 string               `json:"id" toml:"id" yaml:"id" gorm:"<-:create;type:char(64);primaryKey;comment:This is the hash of the locking script" bson:"_id"`
+	XpubID             string               `json:"xpub_id" toml:"xpub_id" yaml:"xpub_id" gorm:"<-:create;type:char(64);index;comment:This is the related xPub" bson:"xpub_id"`
+	LockingScript      string               `json:"locking_script" toml:"locking_script" yaml:"locking_script" gorm:"<-:create;type:text;comment:This is Bitcoin output script in hex" bson:"locking_script"`
+	Type               string               `json:"type" toml:"type" yaml:"type" gorm:"<-:create;type:text;comment:Type of output" bson:"type"`
+	Chain              uint32               `json:"chain" toml:"chain" yaml:"chain" gorm:"<-:create;type:int;comment:This is the (chain)/num location of the address related to the xPub" bson:"chain"`
+	Num                uint32               `json:"num" toml:"num" yaml:"num" gorm:"<-:create;type:int;comment:This is the chain/(num) location of the address related to the xPub" bson:"num"`
+	FullDerivationPath string               `json:"full_derivation_path,omitempty" toml:"full_derivation_path" yaml:"full_derivation_path" gorm:"<-;type:varchar(255);comment:This is the full BIP32 derivation path (for external signers)" bson:"full_derivation_path,omitempty"`
+	Address            string               `json:"address" toml:"address" yaml:"address" gorm:"<-:create;type:varchar(35);index;comment:This is the BitCoin address" bson:"address"`
+	DraftID            string               `json:"draft_id" toml:"draft_id" yaml:"draft_id" gorm:"<-:create;type:varchar(64);index;comment:This is the related draft id (if internal tx)" bson:"draft_id,omitempty"`
+	Monitor            customTypes.NullTime `json:"monitor" toml:"monitor" yaml:"monitor" gorm:";index;comment:When this address was last used for an external transaction, for monitoring" bson:"monitor,omitempty"`
+	RevokedAt          customTypes.NullTime `json:"revoked_at" toml:"revoked_at" yaml:"revoked_at" gorm:"<-;comment:When the destination was revoked (no new funds are accepted)" bson:"revoked_at,omitempty"`
 }
 
 // newDestination will start a new Destination model for a locking script
@@ -43,8 +46,8 @@ func newDestination(xPubID, lockingScript string, opts ...ModelOps) *Destination
 		address = utils.GetAddressFromScript(lockingScript)
 	}
 
-	// Return the model
-	return &Destination{
+	// Start the model
+	destination := &Destination{
 		ID:            utils.Hash(lockingScript),
 		LockingScript: lockingScript,
 		Model:         *NewBaseModel(ModelDestination, opts...),
@@ -52,6 +55,17 @@ func newDestination(xPubID, lockingScript string, opts ...ModelOps) *Destination
 		XpubID:        xPubID,
 		Address:       address,
 	}
+
+	// Use the address of the configured network
+	if len(address) > 0 {
+		if networkAddress, err := utils.GetAddressForNetwork(
+			address, networkParams(getClientNetwork(destination.Client())),
+		); err == nil {
+			destination.Address = networkAddress
+		}
+	}
+
+	return destination
 }
 
 // newAddress will start a new Destination model for a legacy Bitcoin address
@@ -81,10 +95,27 @@ func newAddress(rawXpubKey string, chain, num uint32, opts ...ModelOps) (*Destin
 	destination.Type = utils.GetDestinationType(destination.LockingScript)
 	destination.ID = utils.Hash(destination.LockingScript)
 
+	// Set the full derivation path (for external signers)
+	destination.setDerivationPath()
+
 	// Return the destination (address)
 	return destination, nil
 }
 
+// IsRevoked will return true if the destination is revoked (no new funds are accepted)
+func (m *Destination) IsRevoked() bool {
+	return m.RevokedAt.Valid
+}
+
+// setDerivationPath will set the full derivation path using the derivation prefix of the client
+func (m *Destination) setDerivationPath() {
+	prefix := defaultDerivationPrefix
+	if c := m.Client(); c != nil && len(c.DerivationPrefix()) > 0 {
+		prefix = c.DerivationPrefix()
+	}
+	m.FullDerivationPath = utils.GetDerivationPath(prefix, m.Chain, m.Num)
+}
+
 // getDestinationByID will get the destination by the given id
 func getDestinationByID(ctx context.Context, id string, opts ...ModelOps) (*Destination, error) {
 
@@ -105,6 +136,15 @@ func getDestinationByID(ctx context.Context, id string, opts ...ModelOps) (*Dest
 	return destination, nil
 }
 
+// isDestinationRevoked will check if the destination (by locking script) exists and is revoked
+func isDestinationRevoked(ctx context.Context, lockingScript string, opts ...ModelOps) (bool, error) {
+	destination, err := getDestinationByID(ctx, utils.Hash(lockingScript), opts...)
+	if err != nil {
+		return false, err
+	}
+	return destination != nil && destination.IsRevoked(), nil
+}
+
 // getDestinationByAddress will get the destination by the given address
 func getDestinationByAddress(ctx context.Context, address string, opts ...ModelOps) (*Destination, error) {
 
@@ -232,6 +272,19 @@ func getDestinationsCountByXPubID(ctx context.Context, xPubID string, usingMetad
 	return count, nil
 }
 
+// isDestinationIndexUsed will check if a derived destination exists for the given xPub chain/num
+func isDestinationIndexUsed(ctx context.Context, xPubID string, chain, num uint32, opts ...ModelOps) (bool, error) {
+	count, err := getDestinationsCountByXPubID(ctx, xPubID, nil, &map[string]interface{}{
+		chainField:              chain,
+		numField:                num,
+		fullDerivationPathField: map[string]interface{}{"$gt": ""},
+	}, opts...)
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
 // getXpubWithCache will try to get from cache first, then datastore
 //
 // key is the raw xPub key or use xPubID
@@ -254,7 +307,7 @@ func getDestinationWithCache(ctx context.Context, client ClientInterface,
 	// Attempt to get from cache
 	destination := new(Destination)
 	found, err := getModelFromCache(
-		ctx, client.Cachestore(), cacheKey, destination,
+		ctx, client, cacheKey, destination, opts...,
 	)
 	if err != nil { // Found a real error
 		return nil, err
@@ -287,13 +340,7 @@ func getDestinationWithCache(ctx context.Context, client ClientInterface,
 
 	// Save to cache
 	// todo: run in a go routine
-	if err = saveToCache(
-		ctx, []string{
-			fmt.Sprintf(cacheKeyDestinationModel, destination.GetID()),
-			fmt.Sprintf(cacheKeyDestinationModelByAddress, destination.Address),
-			fmt.Sprintf(cacheKeyDestinationModelByLockingScript, destination.LockingScript),
-		}, destination, 0,
-	); err != nil {
+	if err = saveToCache(ctx, destination.cacheKeys(), destination); err != nil {
 		return nil, err
 	}
 
@@ -347,17 +394,11 @@ func (m *Destination) AfterCreated(ctx context.Context) error {
 	}
 
 	// Store in the cache
-	if err = saveToCache(
-		ctx, []string{
-			fmt.Sprintf(cacheKeyDestinationModel, m.GetID()),
-			fmt.Sprintf(cacheKeyDestinationModelByAddress, m.Address),
-			fmt.Sprintf(cacheKeyDestinationModelByLockingScript, m.LockingScript),
-		}, m, 0,
-	); err != nil {
+	if err = saveToCache(ctx, m.cacheKeys(), m); err != nil {
 		return err
 	}
 
-	notify(notifications.EventTypeCreate, m)
+	notify(ctx, notifications.EventTypeCreate, m)
 
 	m.DebugLog("end: " + m.Name() + " AfterCreated hook")
 	return nil
@@ -375,9 +416,9 @@ func (m *Destination) setAddress(rawXpubKey string) error {
 	// Set the ID
 	m.XpubID = utils.Hash(rawXpubKey)
 
-	// Derive the address to ensure it is correct
-	if m.Address, err = utils.DeriveAddress(
-		hdKey, m.Chain, m.Num,
+	// Derive the address to ensure it is correct (for the configured network)
+	if m.Address, err = utils.DeriveAddressForNetwork(
+		hdKey, networkParams(getClientNetwork(m.Client())), m.Chain, m.Num,
 	); err != nil {
 		return err
 	}
@@ -387,25 +428,122 @@ func (m *Destination) setAddress(rawXpubKey string) error {
 
 // Migrate model specific migration on startup
 func (m *Destination) Migrate(client datastore.ClientInterface) error {
+	if err := m.migrateDerivationPaths(context.Background()); err != nil {
+		return err
+	}
+	if err := m.migrateIndexUniqueness(client); err != nil && !isUniqueConstraintError(err) {
+		return err
+	} else if err != nil { // The index is created by FixDestinationIndexCollisions
+		m.Client().Logger().Error(context.Background(), "existing destination index collisions, use FixDestinationIndexCollisions: "+err.Error())
+	}
 	return client.IndexMetadata(client.GetTableName(tableDestinations), metadataField)
 }
 
+// migrateDerivationPaths will set the full derivation path of the derived destinations created before the field
+//
+// Destinations at 0/0 are not updated: those cannot be told apart from the locking script destinations.
+// Revoked destinations are not updated (IE: detached by FixDestinationIndexCollisions)
+func (m *Destination) migrateDerivationPaths(ctx context.Context) error {
+	conditions := map[string]interface{}{
+		conditionAnd: []map[string]interface{}{{
+			conditionOr: []map[string]interface{}{{fullDerivationPathField: ""}, {fullDerivationPathField: nil}},
+		}, {
+			revokedAtField: nil,
+		}, {
+			conditionOr: []map[string]interface{}{
+				{chainField: map[string]interface{}{"$gt": 0}},
+				{numField: map[string]interface{}{"$gt": 0}},
+			},
+		}},
+	}
+	for {
+		// The updated destinations are not matched again, always load the first page
+		destinations, err := getDestinations(ctx, nil, &conditions, &datastore.QueryParams{
+			Page:          1,
+			PageSize:      defaultPageSize,
+			OrderByField:  idField,
+			SortDirection: datastore.SortAsc,
+		}, m.GetOptions(false)...)
+		if err != nil {
+			return err
+		}
+		for _, destination := range destinations {
+			destination.enrich(ModelDestination, m.GetOptions(false)...)
+			destination.setDerivationPath()
+			if err = destination.Save(ctx); err != nil {
+				return err
+			}
+		}
+		if len(destinations) < defaultPageSize {
+			return nil
+		}
+	}
+}
+
+// migrateIndexUniqueness will add a unique index on (xpub_id, chain, num) for the derived destinations
+//
+// Destinations without a derivation path (IE: locking script destinations) are not included.
+// If the index cannot be created (existing collisions), use FixDestinationIndexCollisions() (creates the index).
+func (m *Destination) migrateIndexUniqueness(client datastore.ClientInterface) error {
+	tableName := client.GetTableName(tableDestinations)
+	idxName := "idx_" + tableName + "_xpub_chain_num"
+
+	var query string
+	switch client.Engine() {
+	case datastore.PostgreSQL, datastore.SQLite:
+		query = `CREATE UNIQUE INDEX IF NOT EXISTS "` + idxName + `" ON "` + tableName +
+			`" ("xpub_id", "chain", "num") WHERE "full_derivation_path" <> ''`
+	case datastore.MySQL:
+		idxExists, err := client.IndexExists(tableName, idxName)
+		if err != nil {
+			return err
+		} else if idxExists {
+			return nil
+		}
+		// NULL values are not unique in MySQL (no partial indexes)
+		query = "CREATE UNIQUE INDEX " + idxName + " ON `" + tableName +
+			"` (xpub_id, chain, num, (NULLIF(full_derivation_path, '')))"
+	default: // MongoDB is using the mongo indexes
+		return nil
+	}
+
+	return client.Execute(query).Error
+}
+
+// cacheKeys will return the cache keys of the destination (by id, address and locking script)
+func (m *Destination) cacheKeys() []string {
+	return []string{
+		fmt.Sprintf(cacheKeyDestinationModel, m.GetID()),
+		fmt.Sprintf(cacheKeyDestinationModelByAddress, m.Address),
+		fmt.Sprintf(cacheKeyDestinationModelByLockingScript, m.LockingScript),
+	}
+}
+
+// evictFromCache will delete the destination from the cache, and from the cache of the other instances (cluster)
+func (m *Destination) evictFromCache(ctx context.Context) error {
+	if m.Client() == nil {
+		return nil
+	}
+	keys := m.cacheKeys()
+	if err := deleteFromCache(ctx, m.Client(), keys); err != nil {
+		return err
+	}
+	if c := m.Client().Cluster(); c != nil {
+		return c.Publish(cluster.DestinationUpdated, strings.Join(keys, destinationCacheKeySeparator))
+	}
+	return nil
+}
+
 // AfterUpdated will fire after the model is updated in the Datastore
 func (m *Destination) AfterUpdated(ctx context.Context) error {
 	m.DebugLog("starting: " + m.Name() + " AfterUpdated hook...")
 
-	// Store in the cache
-	if err := saveToCache(
-		ctx, []string{
-			fmt.Sprintf(cacheKeyDestinationModel, m.GetID()),
-			fmt.Sprintf(cacheKeyDestinationModelByAddress, m.Address),
-			fmt.Sprintf(cacheKeyDestinationModelByLockingScript, m.LockingScript),
-		}, m, 0,
-	); err != nil {
+	// Evict from the cache (the cached getters load the updated destination)
+	if err := m.evictFromCache(ctx); err != nil {
 		return err
 	}
 
-	notify(notifications.EventTypeUpdate, m)
+	notify(ctx, notifications.EventTypeUpdate, m)
 
 	m.DebugLog("end: " + m.Name() + " AfterUpdated hook")
 	return nil
@@ -416,23 +554,11 @@ func (m *Destination) AfterDeleted(ctx context.Context) error {
 	m.DebugLog("starting: " + m.Name() + " AfterDelete hook...")
 
 	// Only if we have a client, remove all keys
-	if m.Client() != nil {
-		keys := map[string]string{
-			cacheKeyDestinationModel:                m.GetID(),
-			cacheKeyDestinationModelByAddress:       m.Address,
-			cacheKeyDestinationModelByLockingScript: m.LockingScript,
-		}
-
-		for key, val := range keys {
-			if err := m.Client().Cachestore().Delete(
-				ctx, fmt.Sprintf(key, val),
-			); err != nil {
-				return err
-			}
-		}
+	if err := m.evictFromCache(ctx); err != nil {
+		return err
 	}
 
-	notify(notifications.EventTypeDelete, m)
+	notify(ctx, notifications.EventTypeDelete, m)
 
 	m.DebugLog("end: " + m.Name() + " AfterDelete hook")
 	return nil
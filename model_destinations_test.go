@@ -1,8 +1,10 @@
 package bux
 
 import (
+	"strings"
 	"testing"
 
+	"github.com/BuxOrg/bux/cluster"
 	"github.com/BuxOrg/bux/tester"
 	"github.com/BuxOrg/bux/utils"
 	"github.com/DATA-DOG/go-sqlmock"
@@ -85,6 +87,19 @@ func TestDestination_newAddress(t *testing.T) {
 		assert.Equal(t, testLockingScript, address.LockingScript)
 		assert.Equal(t, bscript2.ScriptTypePubKeyHash, address.Type)
 		assert.Equal(t, testAddressID, address.GetID())
+
+		// Check the derivation path (relative to the xPub by default)
+		assert.Equal(t, "m/0/0", address.FullDerivationPath)
+	})
+
+	t.Run("derivation prefix", func(t *testing.T) {
+		_, client, deferMe := CreateTestSQLiteClient(t, false, false, WithDerivationPrefix("m/44'/236'/0'/"))
+		defer deferMe()
+
+		address, err := newAddress(testXPub, utils.ChainInternal, 12, client.DefaultModelOptions()...)
+		require.NoError(t, err)
+		require.NotNil(t, address)
+		assert.Equal(t, "m/44'/236'/0'/1/12", address.FullDerivationPath)
 	})
 
 }
@@ -416,7 +431,7 @@ func (ts *EmbeddedDBTestSuite) TestDestination_Save() {
 		// Create model
 		tc.MockSQLDB.ExpectExec("INSERT INTO `"+tc.tablePrefix+"_destinations` ("+
 			"`created_at`,`updated_at`,`metadata`,`deleted_at`,`id`,`xpub_id`,`locking_script`,"+
-			"`type`,`chain`,`num`,`address`,`draft_id`,`monitor`) VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?)").WithArgs(
+			"`type`,`chain`,`num`,`full_derivation_path`,`address`,`draft_id`,`monitor`) VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?,?)").WithArgs(
 			tester.AnyTime{},    // created_at
 			tester.AnyTime{},    // updated_at
 			nil,                 // metadata
@@ -427,6 +442,7 @@ func (ts *EmbeddedDBTestSuite) TestDestination_Save() {
 			destination.Type,    // type
 			0,                   // chain
 			0,                   // num
+			"",                  // full_derivation_path
 			destination.Address, // address
 			testDraftID,         // draft_id
 			nil,                 // monitor
@@ -463,7 +479,7 @@ func (ts *EmbeddedDBTestSuite) TestDestination_Save() {
 		// Create model
 		tc.MockSQLDB.ExpectExec("INSERT INTO `"+tc.tablePrefix+"_destinations` ("+
 			"`created_at`,`updated_at`,`metadata`,`deleted_at`,`id`,`xpub_id`,`locking_script`,"+
-			"`type`,`chain`,`num`,`address`,`draft_id`,`monitor`) VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?)").WithArgs(
+			"`type`,`chain`,`num`,`full_derivation_path`,`address`,`draft_id`,`monitor`) VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?,?)").WithArgs(
 			tester.AnyTime{},    // created_at
 			tester.AnyTime{},    // updated_at
 			nil,                 // metadata
@@ -474,6 +490,7 @@ func (ts *EmbeddedDBTestSuite) TestDestination_Save() {
 			destination.Type,    // type
 			0,                   // chain
 			0,                   // num
+			"",                  // full_derivation_path
 			destination.Address, // address
 			testDraftID,         // draft_id
 			nil,                 // monitor
@@ -508,7 +525,7 @@ func (ts *EmbeddedDBTestSuite) TestDestination_Save() {
 		tc.MockSQLDB.ExpectBegin()
 
 		// Create model
-		tc.MockSQLDB.ExpectExec(`INSERT INTO "`+tc.tablePrefix+`_destinations" ("created_at","updated_at","metadata","deleted_at","id","xpub_id","locking_script","type","chain","num","address","draft_id","monitor") VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13)`).WithArgs(
+		tc.MockSQLDB.ExpectExec(`INSERT INTO "`+tc.tablePrefix+`_destinations" ("created_at","updated_at","metadata","deleted_at","id","xpub_id","locking_script","type","chain","num","full_derivation_path","address","draft_id","monitor") VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14)`).WithArgs(
 			tester.AnyTime{},    // created_at
 			tester.AnyTime{},    // updated_at
 			nil,                 // metadata
@@ -519,6 +536,7 @@ func (ts *EmbeddedDBTestSuite) TestDestination_Save() {
 			destination.Type,    // type
 			0,                   // chain
 			0,                   // num
+			"",                  // full_derivation_path
 			destination.Address, // address
 			testDraftID,         // draft_id
 			nil,                 // monitor
@@ -542,3 +560,101 @@ func (ts *EmbeddedDBTestSuite) TestDestination_Save() {
 		// todo: mocking for MongoDB
 	})
 }
+
+// TestDestination_cacheEviction will test that the updated destinations are evicted from the cache
+func TestDestination_cacheEviction(t *testing.T) {
+	t.Parallel()
+
+	ctx, client, deferMe := CreateTestSQLiteClient(t, false, true, WithCustomTaskManager(&taskManagerMockBase{}))
+	defer deferMe()
+
+	fixtures := NewFixtures(t, client).WithXpub(0).WithDestinations(1)
+	destination := fixtures.Destinations[0]
+
+	// Prime the cache (by address, locking script and id)
+	getCached := func(t *testing.T) (byAddress, byLockingScript, byID *Destination) {
+		var err error
+		byAddress, err = client.GetDestinationByAddress(ctx, fixtures.Xpub.ID, destination.Address)
+		require.NoError(t, err)
+		byLockingScript, err = client.GetDestinationByLockingScript(ctx, fixtures.Xpub.ID, destination.LockingScript)
+		require.NoError(t, err)
+		byID, err = client.GetDestinationByID(ctx, fixtures.Xpub.ID, destination.ID)
+		require.NoError(t, err)
+		return
+	}
+	getCached(t)
+
+	t.Run("metadata update", func(t *testing.T) {
+		_, err := client.UpdateDestinationMetadataByID(ctx, fixtures.Xpub.ID, destination.ID, Metadata{"label": "updated"})
+		require.NoError(t, err)
+
+		byAddress, byLockingScript, byID := getCached(t)
+		assert.Equal(t, "updated", byAddress.Metadata["label"])
+		assert.Equal(t, "updated", byLockingScript.Metadata["label"])
+		assert.Equal(t, "updated", byID.Metadata["label"])
+	})
+
+	t.Run("revoke", func(t *testing.T) {
+		_, err := client.RevokeDestination(ctx, fixtures.Xpub.ID, destination.ID)
+		require.NoError(t, err)
+
+		byAddress, byLockingScript, byID := getCached(t)
+		assert.True(t, byAddress.IsRevoked())
+		assert.True(t, byLockingScript.IsRevoked())
+		assert.True(t, byID.IsRevoked())
+	})
+
+	t.Run("evicted by another instance (cluster)", func(t *testing.T) {
+		// A stale copy in the cache (IE: the destination was updated by another instance)
+		stale, _, _ := getCached(t)
+		stale.Metadata = Metadata{"label": "stale"}
+		require.NoError(t, saveToCache(ctx, stale.cacheKeys(), stale))
+
+		byAddress, _, _ := getCached(t)
+		assert.Equal(t, "stale", byAddress.Metadata["label"])
+
+		require.NoError(t, client.Cluster().Publish(
+			cluster.DestinationUpdated, strings.Join(stale.cacheKeys(), destinationCacheKeySeparator),
+		))
+
+		byAddress, byLockingScript, byID := getCached(t)
+		assert.Equal(t, "updated", byAddress.Metadata["label"])
+		assert.Equal(t, "updated", byLockingScript.Metadata["label"])
+		assert.Equal(t, "updated", byID.Metadata["label"])
+	})
+}
+
+// TestDestination_migrateDerivationPaths will test the backfill of the full derivation paths
+func TestDestination_migrateDerivationPaths(t *testing.T) {
+	t.Parallel()
+
+	ctx, client, deferMe := CreateTestSQLiteClient(t, false, true, WithCustomTaskManager(&taskManagerMockBase{}))
+	defer deferMe()
+
+	fixtures := NewFixtures(t, client).WithXpub(0).WithDestinations(2)
+
+	// Destinations created before the field (the first one is at 0/0)
+	for _, destination := range fixtures.Destinations {
+		destination.FullDerivationPath = ""
+		require.NoError(t, destination.Save(ctx))
+	}
+	lockingScript := newDestination(fixtures.Xpub.ID, testLockingScript, append(client.DefaultModelOptions(), New())...)
+	require.NoError(t, lockingScript.Save(ctx))
+
+	model := newDestination("", "", client.DefaultModelOptions()...)
+	require.NoError(t, model.migrateDerivationPaths(ctx))
+
+	for _, destination := range fixtures.Destinations {
+		got, err := getDestinationByID(ctx, destination.ID, client.DefaultModelOptions()...)
+		require.NoError(t, err)
+		if destination.Chain == 0 && destination.Num == 0 {
+			assert.Empty(t, got.FullDerivationPath)
+		} else {
+			assert.Equal(t, utils.GetDerivationPath(defaultDerivationPrefix, destination.Chain, destination.Num), got.FullDerivationPath)
+		}
+	}
+
+	got, err := getDestinationByID(ctx, lockingScript.ID, client.DefaultModelOptions()...)
+	require.NoError(t, err)
+	assert.Empty(t, got.FullDerivationPath)
+}
@@ -0,0 +1,134 @@
+package bux
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// Display profiles (the view of a model for a consumer, see DisplayFor)
+const (
+	DisplayProfileAdmin   = "admin"   // Internal tooling, everything is shown
+	DisplayProfileDefault = ""        // Same output as Display()
+	DisplayProfileUser    = "user"    // End-user API responses, internal fields are hidden
+	DisplayProfileWebhook = "webhook" // Event payloads sent to the webhook (see WithNotificationDisplayProfile)
+)
+
+// displayMasks are the fields (json names) hidden by model and profile (see RegisterDisplayMask)
+var displayMasks = map[ModelName]map[string][]string{
+	ModelDraftTransaction: {
+		DisplayProfileUser:    {"configuration"},
+		DisplayProfileWebhook: {"configuration"},
+	},
+	ModelPaymailAddress: {
+		DisplayProfileUser:    {"external_xpub_key", "xpub_id"},
+		DisplayProfileWebhook: {"external_xpub_key"},
+	},
+	ModelTransaction: {
+		DisplayProfileUser:    {"inputs", "xpub_in_ids", "xpub_out_ids"},
+		DisplayProfileWebhook: {"inputs"},
+	},
+}
+
+// displayMasksLock guards the display masks
+var displayMasksLock sync.RWMutex
+
+// RegisterDisplayMask will set the fields (json names) hidden from the profile for the model (replaces the current mask)
+//
+// No fields will show the full model for the profile. The default profile can not be masked.
+func RegisterDisplayMask(modelName ModelName, profile string, fields ...string) {
+	if profile == DisplayProfileDefault {
+		return
+	}
+
+	displayMasksLock.Lock()
+	defer displayMasksLock.Unlock()
+	if displayMasks[modelName] == nil {
+		displayMasks[modelName] = make(map[string][]string)
+	}
+	displayMasks[modelName][profile] = append(make([]string, 0, len(fields)), fields...)
+}
+
+// displayMask will return the fields hidden from the profile for the model
+func displayMask(modelName ModelName, profile string) []string {
+	displayMasksLock.RLock()
+	defer displayMasksLock.RUnlock()
+	return displayMasks[modelName][profile]
+}
+
+// recordVersionFields are the fields of the base model only shown to the admin profile (see SetRecordTime)
+var recordVersionFields = []string{
+	"created_by_instance", "created_by_version", "updated_by_instance", "updated_by_version",
+}
+
+// displayFor will return the display value without the fields hidden from the profile
+//
+// The display value is never changed, a copy is returned if any field is hidden. The bux versions of the record
+// are hidden from every profile except the admin profile.
+func displayFor(modelName ModelName, display interface{}, profile string) interface{} {
+	fields := displayMask(modelName, profile)
+	if profile != DisplayProfileAdmin && profile != DisplayProfileDefault {
+		fields = append(append(make([]string, 0, len(fields)+len(recordVersionFields)), fields...),
+			recordVersionFields...)
+	}
+	return redactModel(display, fields)
+}
+
+// redactModel will return a copy of the model (pointer to a struct) with the fields (json names) set to the zero value
+//
+// The fields of the embedded structs (IE: Model) are also redacted. The copy is shallow, the hidden fields are replaced.
+// The model is returned as is if the hidden fields are already empty.
+func redactModel(model interface{}, fields []string) interface{} {
+	value := reflect.ValueOf(model)
+	if len(fields) == 0 || value.Kind() != reflect.Ptr || value.IsNil() || value.Elem().Kind() != reflect.Struct {
+		return model
+	}
+
+	masked := make(map[string]bool, len(fields))
+	for _, field := range fields {
+		masked[field] = true
+	}
+	if !hasMaskedValue(value.Elem(), masked) {
+		return model
+	}
+
+	redacted := reflect.New(value.Elem().Type())
+	redacted.Elem().Set(value.Elem())
+	redactFields(redacted.Elem(), masked)
+	return redacted.Interface()
+}
+
+// hasMaskedValue will return true if any masked field of the struct is set
+func hasMaskedValue(value reflect.Value, masked map[string]bool) bool {
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		if !field.IsExported() {
+			continue
+		} else if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			if hasMaskedValue(value.Field(i), masked) {
+				return true
+			}
+			continue
+		}
+		if name := strings.Split(field.Tag.Get("json"), ",")[0]; masked[name] && !value.Field(i).IsZero() {
+			return true
+		}
+	}
+	return false
+}
+
+// redactFields will set the masked fields of the struct to the zero value
+func redactFields(value reflect.Value, masked map[string]bool) {
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		if !field.IsExported() {
+			continue
+		} else if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			redactFields(value.Field(i), masked)
+			continue
+		}
+		if name := strings.Split(field.Tag.Get("json"), ",")[0]; masked[name] {
+			value.Field(i).Set(reflect.Zero(field.Type))
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package bux
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/BuxOrg/bux/notifications"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// goldenPaymailAddress will return a paymail address with fixed values
+func goldenPaymailAddress() *PaymailAddress {
+	return &PaymailAddress{
+		Model: Model{
+			CreatedAt:         goldenTime,
+			CreatedByInstance: "bux-1",
+			CreatedByVersion:  "v0.5.18",
+			Metadata:          Metadata{"note": "test"},
+			UpdatedAt:         goldenTime,
+			UpdatedByInstance: "bux-2",
+			UpdatedByVersion:  "v0.5.19",
+		},
+		Alias:           "tester",
+		Avatar:          "https://example.com/avatar.png",
+		Domain:          "example.com",
+		ExternalXpubKey: testXPub,
+		ID:              "c0b4f5ffc2f6c6b8d1f0c4b8a9e1d2f3a4b5c6d7e8f9a0b1c2d3e4f5a6b7c8d9",
+		PublicName:      "Tester",
+		XpubID:          testXPubID,
+	}
+}
+
+// goldenDisplayTransaction will return a transaction with fixed values (displayed for the xPub)
+func goldenDisplayTransaction() *Transaction {
+	transaction := goldenTransaction()
+	transaction.XPubID = testXPubID
+	transaction.XpubInIDs = IDs{"a4f2a6a5e9e5d8e4a4f5f8a07e0b7a9e4f8b3b3d0e7e3e3e1b1f0c5d8c9f6f2a"}
+	transaction.Inputs = RecordedInputs{{
+		OutputIndex: 1,
+		Satoshis:    300097,
+		TxID:        testTxID,
+		ValueKnown:  true,
+	}}
+	return transaction
+}
+
+// TestModel_DisplayFor will test the method DisplayFor() (golden files, any change to a profile fails the test)
+func TestModel_DisplayFor(t *testing.T) {
+	t.Parallel()
+
+	profiles := map[string]string{
+		"admin":   DisplayProfileAdmin,
+		"default": DisplayProfileDefault,
+		"user":    DisplayProfileUser,
+		"webhook": DisplayProfileWebhook,
+	}
+	models := map[string]func() ModelInterface{
+		"paymail_address": func() ModelInterface { return goldenPaymailAddress() },
+		"transaction":     func() ModelInterface { return goldenDisplayTransaction() },
+	}
+	for modelName, newModel := range models {
+		for profileName, profile := range profiles {
+			golden := modelName + "_" + profileName
+			newModel, profile := newModel, profile
+			t.Run(golden, func(t *testing.T) {
+				data, err := json.MarshalIndent(newModel().DisplayFor(profile), "", "  ")
+				require.NoError(t, err)
+
+				path := filepath.Join("testdata", "display", golden+".json")
+				if *updateGolden {
+					require.NoError(t, os.WriteFile(path, append(data, '\n'), 0o600))
+				}
+
+				var expected []byte
+				expected, err = os.ReadFile(path) //nolint:gosec // test file path
+				require.NoError(t, err)
+				assert.Equal(t, string(bytes.TrimSpace(expected)), string(data))
+			})
+		}
+	}
+
+	t.Run("default is the display output", func(t *testing.T) {
+		transaction := goldenDisplayTransaction()
+		assert.Equal(t, goldenDisplayTransaction().Display(), transaction.DisplayFor(DisplayProfileDefault))
+		assert.Equal(t, goldenDisplayTransaction().Display(), transaction.DisplayFor(DisplayProfileAdmin))
+	})
+
+	t.Run("the transaction is not changed", func(t *testing.T) {
+		transaction := goldenDisplayTransaction()
+		displayed := transaction.DisplayFor(DisplayProfileUser).(*Transaction)
+		assert.NotSame(t, transaction, displayed)
+		assert.Nil(t, displayed.XpubOutputValue)
+		assert.Equal(t, goldenDisplayTransaction(), transaction)
+	})
+
+	t.Run("the model is not changed", func(t *testing.T) {
+		paymailAddress := goldenPaymailAddress()
+		redacted := paymailAddress.DisplayFor(DisplayProfileUser).(*PaymailAddress)
+		assert.NotSame(t, paymailAddress, redacted)
+		assert.Empty(t, redacted.ExternalXpubKey)
+		assert.Empty(t, redacted.XpubID)
+		assert.Equal(t, testXPub, paymailAddress.ExternalXpubKey)
+		assert.Equal(t, testXPubID, paymailAddress.XpubID)
+		assert.Equal(t, paymailAddress.Alias, redacted.Alias)
+	})
+
+	t.Run("unknown profile", func(t *testing.T) {
+		transaction := goldenDisplayTransaction()
+		assert.Equal(t, goldenDisplayTransaction().Display(), transaction.DisplayFor("unknown"))
+	})
+
+	t.Run("record versions are only shown to the admin", func(t *testing.T) {
+		paymailAddress := goldenPaymailAddress()
+		admin := paymailAddress.DisplayFor(DisplayProfileAdmin).(*PaymailAddress)
+		assert.Equal(t, "v0.5.18", admin.CreatedByVersion)
+		assert.Equal(t, "bux-2", admin.UpdatedByInstance)
+
+		for _, profile := range []string{DisplayProfileUser, DisplayProfileWebhook, "unknown"} {
+			redacted := paymailAddress.DisplayFor(profile).(*PaymailAddress)
+			assert.Empty(t, redacted.CreatedByInstance)
+			assert.Empty(t, redacted.CreatedByVersion)
+			assert.Empty(t, redacted.UpdatedByInstance)
+			assert.Empty(t, redacted.UpdatedByVersion)
+		}
+	})
+}
+
+// TestRegisterDisplayMask will test the method RegisterDisplayMask()
+func TestRegisterDisplayMask(t *testing.T) {
+	t.Parallel()
+
+	const modelName ModelName = "display_mask_test"
+	model := &Model{CreatedAt: goldenTime, Metadata: Metadata{"note": "test"}, name: modelName}
+
+	RegisterDisplayMask(modelName, DisplayProfileUser, metadataField)
+	redacted := model.DisplayFor(DisplayProfileUser).(*Model)
+	assert.Nil(t, redacted.Metadata)
+	assert.Equal(t, goldenTime, redacted.CreatedAt)
+	assert.NotNil(t, model.Metadata)
+
+	// The default profile can not be masked
+	RegisterDisplayMask(modelName, DisplayProfileDefault, metadataField)
+	assert.Same(t, model, model.DisplayFor(DisplayProfileDefault))
+
+	// Remove the mask
+	RegisterDisplayMask(modelName, DisplayProfileUser)
+	assert.Same(t, model, model.DisplayFor(DisplayProfileUser))
+}
+
+// TestNotificationPayload_DisplayProfile will test the display profile of the event payloads
+func TestNotificationPayload_DisplayProfile(t *testing.T) {
+	t.Parallel()
+
+	t.Run("legacy payload", func(t *testing.T) {
+		paymailAddress := goldenPaymailAddress()
+		payload := notificationPayload(
+			notifications.SchemaVersionLegacy, paymailAddress, false, DisplayProfileWebhook,
+		).(*PaymailAddress)
+		assert.Empty(t, payload.ExternalXpubKey)
+		assert.Equal(t, testXPubID, payload.XpubID)
+		assert.Equal(t, testXPub, paymailAddress.ExternalXpubKey)
+	})
+
+	t.Run("v1 payload", func(t *testing.T) {
+		event := notificationPayload(
+			notifications.SchemaVersionV1, goldenDisplayTransaction(), false, DisplayProfileUser,
+		).(*notifications.TransactionEventV1)
+		assert.Empty(t, event.XpubInIDs)
+		assert.Empty(t, event.XpubOutIDs)
+		assert.Equal(t, testTxID, event.ID)
+	})
+}
+
+// TestClient_GetTransactionDisplay will test the method GetTransactionDisplay()
+func TestClient_GetTransactionDisplay(t *testing.T) {
+	t.Parallel()
+
+	ctx, client, deferMe := CreateTestSQLiteClient(t, false, true, WithCustomTaskManager(&taskManagerMockBase{}))
+	defer deferMe()
+
+	fixtures := NewFixtures(t, client).WithXpub(0).WithUtxos(1000)
+	txID := fixtures.Transactions[0].ID
+
+	display, err := client.GetTransactionDisplay(ctx, fixtures.RawXpub, txID, DisplayProfileUser)
+	require.NoError(t, err)
+	transaction := display.(*Transaction)
+	assert.Equal(t, txID, transaction.ID)
+	assert.Equal(t, TransactionDirectionIn, transaction.Direction)
+	assert.Nil(t, transaction.Inputs)
+
+	// The stored transaction is not changed
+	transaction, err = client.GetTransaction(ctx, fixtures.Xpub.ID, txID)
+	require.NoError(t, err)
+	assert.Equal(t, IDs{fixtures.Xpub.ID}, transaction.XpubOutIDs)
+}
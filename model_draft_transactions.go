@@ -17,6 +17,7 @@ import (
 	"github.com/libsv/go-bk/bip32"
 	"github.com/libsv/go-bt/v2"
 	"github.com/libsv/go-bt/v2/bscript"
+	"github.com/libsv/go-bt/v2/sighash"
 	"github.com/mrz1836/go-datastore"
 	"github.com/pkg/errors"
 )
@@ -38,14 +39,18 @@ type DraftTransaction struct {
 	Status               DraftStatus       `json:"status" toml:"status" yaml:"status" gorm:"<-;type:varchar(10);index;comment:This is the status of the draft" bson:"status"`
 	FinalTxID            string            `json:"final_tx_id,omitempty" toml:"final_tx_id" yaml:"final_tx_id" gorm:"<-;type:char(64);index;comment:This is the final tx ID" bson:"final_tx_id,omitempty"`
 	CompoundMerklePathes CMPSlice          `json:"compound_merkle_pathes,omitempty" toml:"compound_merkle_pathes" yaml:"compound_merkle_pathes" gorm:"<-;type:text;comment:Slice of Compound Merkle Path" bson:"compound_merkle_pathes,omitempty"`
+	ExpiryWarned         bool              `json:"expiry_warned" toml:"expiry_warned" yaml:"expiry_warned" gorm:"<-;comment:The expiring soon notification was sent" bson:"expiry_warned,omitempty"`
+
+	// Virtual Fields
+	FiatFee *FiatValue `json:"fiat_fee,omitempty" toml:"-" yaml:"-" gorm:"-" bson:"-"` // Estimated fiat value of the fee (see WithExchangeRateProvider)
+
+	// Private for internal use
+	reservedSatoshis uint64 `gorm:"-" bson:"-"` // Value of the reserved utxos (expiry notifications)
 }
 
 // newDraftTransaction will start a new draft tx
 func newDraftTransaction(rawXpubKey string, config *TransactionConfig, opts ...ModelOps) *DraftTransaction {
 
-	// Random GUID
-	id, _ := utils.RandomHex(32)
-
 	// Set the expires time (default)
 	expiresAt := time.Now().UTC().Add(defaultDraftTxExpiresIn)
 	if config.ExpiresIn > 0 {
@@ -54,17 +59,19 @@ func newDraftTransaction(rawXpubKey string, config *TransactionConfig, opts ...M
 
 	// Start the model
 	draft := &DraftTransaction{
-		Configuration:   *config,
-		ExpiresAt:       expiresAt,
-		Status:          DraftStatusDraft,
-		TransactionBase: TransactionBase{ID: id},
-		XpubID:          utils.Hash(rawXpubKey),
+		Configuration: *config,
+		ExpiresAt:     expiresAt,
+		Status:        DraftStatusDraft,
+		XpubID:        utils.Hash(rawXpubKey),
 		Model: *NewBaseModel(
 			ModelDraftTransaction,
 			append(opts, WithXPub(rawXpubKey))...,
 		),
 	}
 
+	// Random GUID
+	draft.ID = draft.newModelID()
+
 	// Set the fee (if not found) (if chainstate is loaded, use the first miner)
 	// todo: make this more intelligent or allow the config to dictate the miner selection
 	if config.FeeUnit == nil {
@@ -159,6 +166,11 @@ func (m *DraftTransaction) GetID() string {
 // doing any lookups and creating locking scripts
 func (m *DraftTransaction) processConfigOutputs(ctx context.Context) error {
 
+	// Paymail domains must be allowed (before anything is requested from the providers)
+	if err := m.checkPaymailDomains(); err != nil {
+		return err
+	}
+
 	// Get the client
 	c := m.Client()
 	// Get sender's paymail
@@ -179,7 +191,7 @@ func (m *DraftTransaction) processConfigOutputs(ctx context.Context) error {
 		m.Configuration.Outputs = []*TransactionOutput{m.Configuration.SendAllTo}
 
 		if err := m.Configuration.Outputs[0].processOutput(
-			ctx, c.Cachestore(),
+			ctx, paymailRequests(c), c.Cachestore(),
 			c.PaymailClient(),
 			paymailFrom,
 			c.GetPaymailConfig().DefaultNote,
@@ -192,7 +204,7 @@ func (m *DraftTransaction) processConfigOutputs(ctx context.Context) error {
 		for _, output := range outputs {
 			output.UseForChange = false // make sure we do not add change to this output
 			if err := output.processOutput(
-				ctx, c.Cachestore(),
+				ctx, paymailRequests(c), c.Cachestore(),
 				c.PaymailClient(),
 				paymailFrom,
 				c.GetPaymailConfig().DefaultNote,
@@ -204,27 +216,77 @@ func (m *DraftTransaction) processConfigOutputs(ctx context.Context) error {
 		}
 	} else {
 		// Loop all outputs and process
+		var unresolved *OutputsUnresolvedError
 		for index := range m.Configuration.Outputs {
+			output := m.Configuration.Outputs[index]
+
+			// Only the paymail resolution may fail (the other outputs are validated as usual)
+			if !m.Configuration.AllowPartialResolution || !output.isPaymailOutput() {
+				if m.Configuration.AllowPartialResolution {
+					output.Scripts = nil
+				}
+				if output.Scripts == nil {
+					output.Scripts = make([]*ScriptOutput, 0)
+				}
+				if err := output.processOutput(
+					ctx, paymailRequests(c), c.Cachestore(),
+					c.PaymailClient(),
+					paymailFrom,
+					c.GetPaymailConfig().DefaultNote,
+					true,
+				); err != nil {
+					return err
+				}
+				continue
+			}
+
+			// Paymail outputs are validated before resolving
+			if err := output.validatePaymailOutput(); err != nil {
+				return err
+			}
 
-			// Start the output script slice
-			if m.Configuration.Outputs[index].Scripts == nil {
-				m.Configuration.Outputs[index].Scripts = make([]*ScriptOutput, 0)
+			// Resolved by a previous attempt (locked in)
+			if output.isResolved() {
+				if err := output.validateResolvedScripts(); err != nil {
+					return err
+				}
+				continue
 			}
 
-			// Process the outputs
-			if err := m.Configuration.Outputs[index].processOutput(
-				ctx, c.Cachestore(),
+			// Resolve the paymail (keep resolving the other outputs if it fails)
+			output.Scripts = make([]*ScriptOutput, 0)
+			if err := output.processOutput(
+				ctx, paymailRequests(c), c.Cachestore(),
 				c.PaymailClient(),
 				paymailFrom,
 				c.GetPaymailConfig().DefaultNote,
 				true,
 			); err != nil {
-				return err
+				if unresolved == nil {
+					unresolved = &OutputsUnresolvedError{}
+				}
+				unresolved.Failures = append(unresolved.Failures, &OutputResolutionFailure{
+					Index:  index,
+					Reason: err.Error(),
+					To:     output.To,
+				})
+				output.Scripts = nil
+			}
+		}
+
+		// Some recipients failed: return the resolved outputs (nothing is reserved)
+		if unresolved != nil {
+			for _, output := range m.Configuration.Outputs {
+				if output.isResolved() {
+					unresolved.Resolved = append(unresolved.Resolved, output)
+				}
 			}
+			return unresolved
 		}
 	}
 
-	return nil
+	// Make sure all the output addresses belong to the configured network
+	return m.Configuration.validateOutputsNetwork(getClientNetwork(c))
 }
 
 // createTransactionHex will create the transaction with the given inputs and outputs
@@ -235,8 +297,16 @@ func (m *DraftTransaction) createTransactionHex(ctx context.Context) (err error)
 		return ErrMissingTransactionOutputs
 	}
 
+	// Validate the sighash types and the external inputs before reserving any utxos
+	// (the inputs are built from the utxos, the overrides are set on them later)
+	sigHashOverrides := m.Configuration.popSigHashOverrides()
+	if err = m.Configuration.validateSigHashTypes(sigHashOverrides); err != nil {
+		return
+	}
+
 	// Get the total satoshis needed to make this transaction
 	satoshisNeeded := m.getTotalSatoshis()
+	externalSatoshis := m.Configuration.getExternalInputsSatoshis()
 
 	// Set opts
 	opts := m.GetOptions(false)
@@ -299,15 +369,34 @@ func (m *DraftTransaction) createTransactionHex(ctx context.Context) (err error)
 
 		// Reserve and Get utxos for the transaction
 		var reservedUtxos []*Utxo
-		feePerByte := float64(m.Configuration.FeeUnit.Satoshis / m.Configuration.FeeUnit.Bytes)
-
-		reserveSatoshis := satoshisNeeded + m.estimateFee(m.Configuration.FeeUnit, 0)
+		var reserveFee uint64
+		if reserveFee, err = m.calculateFee(ctx, 0, 0); err != nil {
+			return
+		}
+		reserveSatoshis := satoshisNeeded + reserveFee
 		if reserveSatoshis <= dustLimit && !m.containsOpReturn() {
 			m.client.Logger().Error(ctx, "amount of satoshis to send less than the dust limit")
 			return ErrOutputValueTooLow
 		}
+
+		// Inputs added externally will fund part of the transaction
+		if externalSatoshis >= reserveSatoshis {
+			reserveSatoshis = 0
+		} else {
+			reserveSatoshis -= externalSatoshis
+		}
+
+		// The fee of the reserved inputs is added by the calculator (on top of the fee without inputs)
+		inputsFee := func(inputs int) (uint64, error) {
+			inputFee, feeErr := m.calculateFee(ctx, inputs, 0)
+			if feeErr != nil || inputFee <= reserveFee {
+				return 0, feeErr
+			}
+			return inputFee - reserveFee, nil
+		}
 		if reservedUtxos, err = reserveUtxos(
-			ctx, m.XpubID, m.ID, reserveSatoshis, feePerByte, m.Configuration.FromUtxos, opts...,
+			ctx, m.XpubID, m.ID, reserveSatoshis, inputsFee,
+			m.Configuration.FromUtxos, m.Configuration.IncludeAutomaticInputs, opts...,
 		); err != nil {
 			return
 		}
@@ -330,19 +419,43 @@ func (m *DraftTransaction) createTransactionHex(ctx context.Context) (err error)
 		}
 	}
 
+	// Do not build a chain of unconfirmed transactions deeper than the limit
+	if err = m.checkUnconfirmedChain(ctx); err != nil {
+		return
+	}
+
+	// Set the sighash types on the inputs
+	if err = m.setSigHashTypes(sigHashOverrides); err != nil {
+		return
+	}
+
 	// Start a new transaction from the reservedUtxos
 	tx := bt.NewTx()
 	if err = tx.FromUTXOs(*inputUtxos...); err != nil {
 		return
 	}
 
-	// Estimate the fee for the transaction
-	fee := m.estimateFee(m.Configuration.FeeUnit, 0)
+	// Calculate the fee for the transaction
+	var fee uint64
+	if fee, err = m.calculateFee(ctx, 0, 0); err != nil {
+		return
+	}
 	if m.Configuration.SendAllTo != nil {
 		if m.Configuration.Outputs[0].Satoshis <= dustLimit {
 			return ErrOutputValueTooLow
 		}
 
+		// The fee and the other outputs must leave more than the dust limit
+		spent := fee
+		for _, output := range m.Configuration.Outputs {
+			if !output.UseForChange {
+				spent += output.Satoshis
+			}
+		}
+		if m.Configuration.Outputs[0].Satoshis <= spent+dustLimit {
+			return ErrOutputValueTooLow
+		}
+
 		m.Configuration.Fee = fee
 		m.Configuration.Outputs[0].Satoshis -= fee
 
@@ -355,12 +468,12 @@ func (m *DraftTransaction) createTransactionHex(ctx context.Context) (err error)
 
 		m.Configuration.Outputs[0].Scripts[0].Satoshis = m.Configuration.Outputs[0].Satoshis
 	} else {
-		if satoshisReserved < satoshisNeeded+fee {
+		if satoshisReserved+externalSatoshis < satoshisNeeded+fee {
 			return ErrNotEnoughUtxos
 		}
 
 		// if we have a remainder, add that to an output to our own wallet address
-		satoshisChange := satoshisReserved - satoshisNeeded - fee
+		satoshisChange := satoshisReserved + externalSatoshis - satoshisNeeded - fee
 		m.Configuration.Fee = fee
 		if satoshisChange > 0 {
 			var newFee uint64
@@ -403,6 +516,14 @@ func (m *DraftTransaction) createTransactionHex(ctx context.Context) (err error)
 		outputValue += output.Satoshis
 	}
 
+	// SIGHASH_SINGLE needs an output with the same index as the input
+	if err = m.validateSigHashSingle(tx); err != nil {
+		return
+	}
+
+	// Inputs added externally (ANYONECANPAY) are part of the final transaction
+	inputValue += externalSatoshis
+
 	if inputValue < outputValue {
 		return ErrOutputValueTooHigh
 	}
@@ -426,6 +547,27 @@ func (m *DraftTransaction) createTransactionHex(ctx context.Context) (err error)
 	return
 }
 
+// checkUnconfirmedChain will check the depth of the chain of unconfirmed ancestors against the client limit
+func (m *DraftTransaction) checkUnconfirmedChain(ctx context.Context) error {
+	maxDepth := m.Client().MaxUnconfirmedChain()
+	if maxDepth == 0 {
+		return nil
+	}
+
+	parentIDs := make([]string, 0, len(m.Configuration.Inputs))
+	for _, input := range m.Configuration.Inputs {
+		parentIDs = append(parentIDs, input.UtxoPointer.TransactionID)
+	}
+
+	depth, err := getUnconfirmedDepth(ctx, parentIDs, maxDepth, m.GetOptions(false)...)
+	if err != nil {
+		return err
+	} else if depth > maxDepth {
+		return fmt.Errorf("%w: depth %d, limit %d", ErrUnconfirmedChainTooLong, depth, maxDepth)
+	}
+	return nil
+}
+
 // addIncludeUtxos will add the included utxos
 func (m *DraftTransaction) addIncludeUtxos(ctx context.Context) (uint64, error) {
 	// Whatever utxos are selected, the IncludeUtxos should be added to the transaction
@@ -441,6 +583,8 @@ func (m *DraftTransaction) addIncludeUtxos(ctx context.Context) (uint64, error)
 			return 0, err
 		} else if utxoModel == nil {
 			return 0, ErrMissingUtxo
+		} else if utxoModel.Frozen {
+			return 0, utxoModel.frozenError()
 		}
 		includeUtxos = append(includeUtxos, utxoModel)
 		includeUtxoSatoshis += utxoModel.Satoshis
@@ -463,6 +607,12 @@ func (m *DraftTransaction) processUtxos(ctx context.Context, utxos []*Utxo) erro
 		if destination == nil {
 			return ErrMissingDestination
 		}
+
+		// Destinations created before the derivation path was recorded
+		if len(destination.FullDerivationPath) == 0 && len(destination.XpubID) > 0 {
+			destination.setDerivationPath()
+		}
+
 		m.Configuration.Inputs = append(
 			m.Configuration.Inputs, &TransactionInput{
 				Utxo:        *utxo,
@@ -473,11 +623,49 @@ func (m *DraftTransaction) processUtxos(ctx context.Context, utxos []*Utxo) erro
 	return nil
 }
 
+// setSigHashTypes will set the sighash type overrides on the matching inputs
+func (m *DraftTransaction) setSigHashTypes(overrides []*TransactionInput) error {
+	anyoneCanPay := false
+	for _, input := range m.Configuration.Inputs {
+		for _, override := range overrides {
+			if override.TransactionID == input.TransactionID && override.OutputIndex == input.OutputIndex {
+				input.SigHashType = override.SigHashType
+			}
+		}
+		if input.getSigHashType().Has(sighash.AnyOneCanPay) {
+			anyoneCanPay = true
+		}
+	}
+
+	// The inputs with ANYONECANPAY might not have been selected (FromUtxos)
+	if m.Configuration.AllowExternalInputs && !anyoneCanPay {
+		return ErrExternalInputsRequireAnyoneCanPay
+	}
+	return nil
+}
+
+// validateSigHashSingle will make sure every SIGHASH_SINGLE input has a matching output
+func (m *DraftTransaction) validateSigHashSingle(tx *bt.Tx) error {
+	for index, input := range m.Configuration.Inputs {
+		if input.getSigHashType().HasWithMask(sighash.Single) && index >= tx.OutputCount() {
+			return ErrUnsupportedSigHashType
+		}
+	}
+	return nil
+}
+
 // estimateSize will loop the inputs and outputs and estimate the size of the transaction
 func (m *DraftTransaction) estimateSize() uint64 {
 	size := defaultOverheadSize // version + nLockTime
 
-	inputSize := bt.VarInt(len(m.Configuration.Inputs))
+	// Inputs expected to be added externally are estimated as P2PKH inputs
+	numberOfInputs := len(m.Configuration.Inputs)
+	if m.Configuration.AllowExternalInputs {
+		numberOfInputs += int(m.Configuration.ExternalInputsCount)
+		size += uint64(m.Configuration.ExternalInputsCount) * utils.GetInputSizeForType(utils.ScriptTypePubKeyHash)
+	}
+
+	inputSize := bt.VarInt(numberOfInputs)
 	size += uint64(inputSize.Length())
 
 	for _, input := range m.Configuration.Inputs {
@@ -498,9 +686,48 @@ func (m *DraftTransaction) estimateSize() uint64 {
 
 // estimateFee will loop the inputs and outputs and estimate the required fee
 func (m *DraftTransaction) estimateFee(unit *utils.FeeUnit, addToSize uint64) uint64 {
-	size := m.estimateSize() + addToSize
-	feeEstimate := float64(size) * (float64(unit.Satoshis) / float64(unit.Bytes))
-	return uint64(math.Ceil(feeEstimate))
+	return feeForSize(unit, m.estimateSize()+addToSize)
+}
+
+// calculateFee will calculate the fee using the fee calculator of the client (the fee unit by default)
+//
+// reservedInputs is the number of the (P2PKH) inputs being reserved and changeOutputs the number of the change
+// outputs being added (not yet in the inputs and outputs). The fee is never below the fee of the estimated size
+// at the fee unit of the draft (the miners' fee unit by default). The name of the calculator is stored on the
+// configuration
+func (m *DraftTransaction) calculateFee(ctx context.Context, reservedInputs, changeOutputs int) (uint64, error) {
+	var calculator FeeCalculator = &feeUnitCalculator{}
+	if c, ok := m.Client().(*Client); ok && c.options.feeCalculator != nil {
+		calculator = c.options.feeCalculator
+	}
+
+	summary := &DraftSummary{
+		EstimatedSize: m.estimateSize() +
+			uint64(reservedInputs)*utils.GetInputSizeForType(utils.ScriptTypePubKeyHash) +
+			uint64(changeOutputs)*changeOutputSize,
+		FeeUnit:        m.Configuration.FeeUnit,
+		InputCount:     len(m.Configuration.Inputs) + reservedInputs,
+		OutputCount:    changeOutputs,
+		OutputSatoshis: m.getTotalSatoshis(),
+	}
+	if m.Configuration.AllowExternalInputs {
+		summary.InputCount += int(m.Configuration.ExternalInputsCount)
+	}
+	for _, output := range m.Configuration.Outputs {
+		summary.OutputCount += len(output.Scripts)
+	}
+
+	fee, err := calculator.CalculateFee(ctx, summary)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %s", ErrFeeCalculatorFailed, err.Error())
+	}
+	m.Configuration.FeeCalculator = feeCalculatorName(calculator)
+
+	// A lower fee would not be accepted by the miners
+	if minimumFee := feeForSize(summary.FeeUnit, summary.EstimatedSize); fee < minimumFee {
+		return minimumFee, nil
+	}
+	return fee, nil
 }
 
 // addOutputs will add the given outputs to the bt.Tx
@@ -553,6 +780,21 @@ func (m *DraftTransaction) addOutputsToTx(tx *bt.Tx) (err error) {
 	return
 }
 
+// customOutputIndexes will return the indexes (in the transaction) of the custom script outputs
+func (m *DraftTransaction) customOutputIndexes() map[uint32]bool {
+	indexes := make(map[uint32]bool)
+	var index uint32
+	for _, output := range m.Configuration.Outputs {
+		for _, sc := range output.Scripts {
+			if sc.ScriptType == ScriptTypeCustom {
+				indexes[index] = true
+			}
+			index++
+		}
+	}
+	return indexes
+}
+
 // setChangeDestination will make a new change destination
 func (m *DraftTransaction) setChangeDestination(ctx context.Context, satoshisChange uint64, fee uint64) (uint64, error) {
 
@@ -593,10 +835,18 @@ func (m *DraftTransaction) setChangeDestination(ctx context.Context, satoshisCha
 			numberOfDestinations = 1
 		}
 
-		newFee = m.estimateFee(m.Configuration.FeeUnit, uint64(numberOfDestinations)*changeOutputSize)
+		var err error
+		if newFee, err = m.calculateFee(ctx, 0, numberOfDestinations); err != nil {
+			return fee, err
+		}
 		satoshisChange -= newFee - fee
 		m.Configuration.ChangeSatoshis = satoshisChange
 
+		// Revoked destinations are never used for change
+		if err := m.removeRevokedChangeDestinations(ctx); err != nil {
+			return fee, err
+		}
+
 		if m.Configuration.ChangeDestinations == nil {
 			if err := m.setChangeDestinations(
 				ctx, numberOfDestinations,
@@ -680,8 +930,8 @@ func (m *DraftTransaction) setChangeDestinations(ctx context.Context, numberOfDe
 	var xPub *Xpub
 	var num uint32
 
-	// Loop for each destination
-	for i := 0; i < numberOfDestinations; i++ {
+	// Loop for each destination (skipping any revoked destination)
+	for skipped := 0; len(m.Configuration.ChangeDestinations) < numberOfDestinations; {
 		if xPub, err = getXpubWithCache(
 			ctx, c, m.rawXpubKey, "", opts...,
 		); err != nil {
@@ -703,6 +953,16 @@ func (m *DraftTransaction) setChangeDestinations(ctx context.Context, numberOfDe
 			return err
 		}
 
+		var revoked bool
+		if revoked, err = isDestinationRevoked(ctx, destination.LockingScript, opts...); err != nil {
+			return err
+		} else if revoked {
+			if skipped++; skipped > defaultDestinationIndexRetries {
+				return ErrDestinationRevoked
+			}
+			continue
+		}
+
 		destination.DraftID = m.ID
 		if err = destination.Save(ctx); err != nil {
 			return err
@@ -714,6 +974,35 @@ func (m *DraftTransaction) setChangeDestinations(ctx context.Context, numberOfDe
 	return nil
 }
 
+// removeRevokedChangeDestinations will remove the revoked destinations from the given change destinations
+//
+// If all the given destinations are revoked, new change destinations will be created
+func (m *DraftTransaction) removeRevokedChangeDestinations(ctx context.Context) error {
+	if len(m.Configuration.ChangeDestinations) == 0 {
+		return nil
+	}
+
+	opts := m.GetOptions(false)
+	changeDestinations := make([]*Destination, 0, len(m.Configuration.ChangeDestinations))
+	for _, destination := range m.Configuration.ChangeDestinations {
+		if destination.IsRevoked() {
+			continue
+		}
+		revoked, err := isDestinationRevoked(ctx, destination.LockingScript, opts...)
+		if err != nil {
+			return err
+		} else if !revoked {
+			changeDestinations = append(changeDestinations, destination)
+		}
+	}
+
+	if len(changeDestinations) == 0 {
+		changeDestinations = nil
+	}
+	m.Configuration.ChangeDestinations = changeDestinations
+	return nil
+}
+
 // getInputsFromUtxos this function transforms bux utxos to bt.UTXOs
 func (m *DraftTransaction) getInputsFromUtxos(reservedUtxos []*Utxo) (*[]*bt.UTXO, uint64, error) {
 	// transform to bt.utxo and check if we have enough
@@ -767,10 +1056,32 @@ func (m *DraftTransaction) BeforeCreating(ctx context.Context) (err error) {
 		return
 	}
 
+	// Estimate the fiat value of the fee (skipped if there is no rate)
+	if rate := getExchangeRate(ctx, m.Client()); rate != nil {
+		if m.Metadata == nil {
+			m.Metadata = make(Metadata)
+		}
+		stampFiatValue(m.Metadata, metadataKeyFiatFee, rate, int64(m.Configuration.Fee))
+		m.FiatFee = rate.at(int64(m.Configuration.Fee))
+	}
+
 	m.DebugLog("end: " + m.Name() + " BeforeCreating hook")
 	return
 }
 
+// setReservedSatoshis will set the value of the utxos reserved by the draft (for the expiry notifications)
+func (m *DraftTransaction) setReservedSatoshis(ctx context.Context) error {
+	utxos, err := getUtxosByDraftID(ctx, m.ID, nil, m.GetOptions(false)...)
+	if err != nil {
+		return err
+	}
+	m.reservedSatoshis = 0
+	for _, utxo := range utxos {
+		m.reservedSatoshis += utxo.Satoshis
+	}
+	return nil
+}
+
 // AfterUpdated will fire after a successful update into the Datastore
 func (m *DraftTransaction) AfterUpdated(ctx context.Context) error {
 	m.DebugLog("starting: " + m.Name() + " AfterUpdated hook...")
@@ -837,6 +1148,17 @@ func (m *DraftTransaction) RegisterTasks() error {
 	})
 }
 
+// Display filter the model for display
+func (m *DraftTransaction) Display() interface{} {
+	m.FiatFee = fiatValueFromMetadata(m.Metadata, int64(m.Configuration.Fee))
+	return m
+}
+
+// DisplayFor filter the model for display without the fields hidden from the profile (see RegisterDisplayMask)
+func (m *DraftTransaction) DisplayFor(profile string) interface{} {
+	return displayFor(ModelDraftTransaction, m.Display(), profile)
+}
+
 // Migrate model specific migration on startup
 func (m *DraftTransaction) Migrate(client datastore.ClientInterface) error {
 	return client.IndexMetadata(client.GetTableName(tableDraftTransactions), metadataField)
@@ -902,8 +1224,8 @@ func (m *DraftTransaction) SignInputs(xPriv *bip32.ExtendedKey) (signedHex strin
 
 		// Get the unlocking script
 		var s *bscript.Script
-		if s, err = utils.GetUnlockingScript(
-			txDraft, uint32(index), privateKey,
+		if s, err = utils.GetUnlockingScriptWithSigHash(
+			txDraft, uint32(index), privateKey, input.getSigHashType(),
 		); err != nil {
 			return
 		}
@@ -921,6 +1243,151 @@ func (m *DraftTransaction) SignInputs(xPriv *bip32.ExtendedKey) (signedHex strin
 	return
 }
 
+// SigningInstruction is the signing information for a single input of a draft transaction (for external signers)
+type SigningInstruction struct {
+	DerivationPath string `json:"derivation_path" toml:"derivation_path" yaml:"derivation_path" bson:"derivation_path"`
+	InputIndex     uint32 `json:"input_index" toml:"input_index" yaml:"input_index" bson:"input_index"`
+	LockingScript  string `json:"locking_script" toml:"locking_script" yaml:"locking_script" bson:"locking_script"`
+	OutputIndex    uint32 `json:"output_index" toml:"output_index" yaml:"output_index" bson:"output_index"`
+	Satoshis       uint64 `json:"satoshis" toml:"satoshis" yaml:"satoshis" bson:"satoshis"`
+	SigHashFlags   uint32 `json:"sighash_flags" toml:"sighash_flags" yaml:"sighash_flags" bson:"sighash_flags"`
+	TransactionID  string `json:"transaction_id" toml:"transaction_id" yaml:"transaction_id" bson:"transaction_id"`
+}
+
+// SigningInstructions are the signing instructions for a draft transaction (for external signers)
+type SigningInstructions struct {
+	DraftID string                `json:"draft_id" toml:"draft_id" yaml:"draft_id" bson:"draft_id"`
+	Hex     string                `json:"hex" toml:"hex" yaml:"hex" bson:"hex"`
+	Inputs  []*SigningInstruction `json:"inputs" toml:"inputs" yaml:"inputs" bson:"inputs"`
+	XpubID  string                `json:"xpub_id" toml:"xpub_id" yaml:"xpub_id" bson:"xpub_id"`
+}
+
+// getSigningInstructions will return the signing instructions for all the inputs of the draft
+func (m *DraftTransaction) getSigningInstructions() *SigningInstructions {
+	instructions := &SigningInstructions{
+		DraftID: m.ID,
+		Hex:     m.Hex,
+		Inputs:  make([]*SigningInstruction, 0, len(m.Configuration.Inputs)),
+		XpubID:  m.XpubID,
+	}
+	for index, input := range m.Configuration.Inputs {
+		derivationPath := input.Destination.FullDerivationPath
+		if len(derivationPath) == 0 {
+			derivationPath = utils.GetDerivationPath(
+				defaultDerivationPrefix, input.Destination.Chain, input.Destination.Num,
+			)
+		}
+		instructions.Inputs = append(instructions.Inputs, &SigningInstruction{
+			DerivationPath: derivationPath,
+			InputIndex:     uint32(index),
+			LockingScript:  input.Destination.LockingScript,
+			OutputIndex:    input.OutputIndex,
+			Satoshis:       input.Satoshis,
+			SigHashFlags:   uint32(input.getSigHashType()),
+			TransactionID:  input.TransactionID,
+		})
+	}
+	return instructions
+}
+
+// SigningPayloadVersion is the current version of the SigningPayload (bumped on breaking changes)
+const SigningPayloadVersion uint32 = 1
+
+// SigningPayloadInput is an input of the SigningPayload (the utxo being spent and how to sign it)
+type SigningPayloadInput struct {
+	DerivationPath string `json:"derivation_path" toml:"derivation_path" yaml:"derivation_path" bson:"derivation_path"`
+	LockingScript  string `json:"locking_script" toml:"locking_script" yaml:"locking_script" bson:"locking_script"`
+	Satoshis       uint64 `json:"satoshis" toml:"satoshis" yaml:"satoshis" bson:"satoshis"`
+	SigHashType    uint32 `json:"sighash_type" toml:"sighash_type" yaml:"sighash_type" bson:"sighash_type"`
+	TxID           string `json:"txid" toml:"txid" yaml:"txid" bson:"txid"`
+	Vout           uint32 `json:"vout" toml:"vout" yaml:"vout" bson:"vout"`
+}
+
+// SigningPayloadOutput is an expected output of the signed transaction
+type SigningPayloadOutput struct {
+	LockingScript string `json:"locking_script" toml:"locking_script" yaml:"locking_script" bson:"locking_script"`
+	Satoshis      uint64 `json:"satoshis" toml:"satoshis" yaml:"satoshis" bson:"satoshis"`
+}
+
+// SigningPayload is everything a client-side signing library needs to sign a draft transaction
+//
+// The inputs and outputs are in the order of the unsigned transaction (Hex), see RecordSignedDraft
+type SigningPayload struct {
+	DraftID string                  `json:"draft_id" toml:"draft_id" yaml:"draft_id" bson:"draft_id"`
+	Hex     string                  `json:"hex" toml:"hex" yaml:"hex" bson:"hex"`
+	Inputs  []*SigningPayloadInput  `json:"inputs" toml:"inputs" yaml:"inputs" bson:"inputs"`
+	Outputs []*SigningPayloadOutput `json:"outputs" toml:"outputs" yaml:"outputs" bson:"outputs"`
+	Version uint32                  `json:"version" toml:"version" yaml:"version" bson:"version"`
+	XpubID  string                  `json:"xpub_id" toml:"xpub_id" yaml:"xpub_id" bson:"xpub_id"`
+}
+
+// SigningPayload will return the signing payload of the draft (inputs to sign and the expected outputs)
+func (m *DraftTransaction) SigningPayload() (*SigningPayload, error) {
+	tx, err := bt.NewTxFromString(m.Hex)
+	if err != nil {
+		return nil, err
+	}
+
+	payload := &SigningPayload{
+		DraftID: m.ID,
+		Hex:     m.Hex,
+		Inputs:  make([]*SigningPayloadInput, 0, len(m.Configuration.Inputs)),
+		Outputs: make([]*SigningPayloadOutput, 0, len(tx.Outputs)),
+		Version: SigningPayloadVersion,
+		XpubID:  m.XpubID,
+	}
+	for _, instruction := range m.getSigningInstructions().Inputs {
+		payload.Inputs = append(payload.Inputs, &SigningPayloadInput{
+			DerivationPath: instruction.DerivationPath,
+			LockingScript:  instruction.LockingScript,
+			Satoshis:       instruction.Satoshis,
+			SigHashType:    instruction.SigHashFlags,
+			TxID:           instruction.TransactionID,
+			Vout:           instruction.OutputIndex,
+		})
+	}
+	for _, output := range tx.Outputs {
+		payload.Outputs = append(payload.Outputs, &SigningPayloadOutput{
+			LockingScript: output.LockingScript.String(),
+			Satoshis:      output.Satoshis,
+		})
+	}
+	return payload, nil
+}
+
+// checkSignedHex will return an error if the signed transaction does not match the payload
+//
+// The inputs and outputs must be the same (and in the same order), inputs can only be
+// appended if the draft allows external inputs
+func (p *SigningPayload) checkSignedHex(signedHex string, allowExternalInputs bool) error {
+	signedTx, err := bt.NewTxFromString(signedHex)
+	if err != nil {
+		return err
+	}
+	if len(signedTx.Inputs) < len(p.Inputs) ||
+		(len(signedTx.Inputs) > len(p.Inputs) && !allowExternalInputs) {
+		return fmt.Errorf("%w: %d inputs (expected %d)", ErrSignedDraftMismatch, len(signedTx.Inputs), len(p.Inputs))
+	}
+	for index, input := range p.Inputs {
+		signedInput := signedTx.Inputs[index]
+		if signedInput.PreviousTxIDStr() != input.TxID || signedInput.PreviousTxOutIndex != input.Vout {
+			return fmt.Errorf("%w: input %d spends %s:%d (expected %s:%d)", ErrSignedDraftMismatch, index,
+				signedInput.PreviousTxIDStr(), signedInput.PreviousTxOutIndex, input.TxID, input.Vout)
+		}
+	}
+
+	if len(signedTx.Outputs) != len(p.Outputs) {
+		return fmt.Errorf("%w: %d outputs (expected %d)", ErrSignedDraftMismatch, len(signedTx.Outputs), len(p.Outputs))
+	}
+	for index, output := range p.Outputs {
+		signedOutput := signedTx.Outputs[index]
+		if signedOutput.Satoshis != output.Satoshis || signedOutput.LockingScript.String() != output.LockingScript {
+			return fmt.Errorf("%w: output %d is different", ErrSignedDraftMismatch, index)
+		}
+	}
+	return nil
+}
+
 func (m *DraftTransaction) containsOpReturn() bool {
 	for _, output := range m.Configuration.Outputs {
 		if output.OpReturn != nil {
@@ -2,6 +2,7 @@ package bux
 
 import (
 	"context"
+	"database/sql"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
@@ -13,7 +14,9 @@ import (
 	"time"
 
 	"github.com/BuxOrg/bux/chainstate"
+	"github.com/BuxOrg/bux/notifications"
 	"github.com/BuxOrg/bux/utils"
+	"github.com/bitcoin-sv/go-paymail"
 	"github.com/bitcoinschema/go-bitcoin/v2"
 	"github.com/jarcoal/httpmock"
 	"github.com/libsv/go-bk/bec"
@@ -21,6 +24,7 @@ import (
 	"github.com/libsv/go-bt/v2"
 	"github.com/libsv/go-bt/v2/bscript"
 	"github.com/libsv/go-bt/v2/sighash"
+	customTypes "github.com/mrz1836/go-datastore/custom_types"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -180,6 +184,74 @@ func TestDraftTransaction_setChangeDestinations(t *testing.T) {
 		require.NoError(t, err)
 		assert.Len(t, draftTx.Configuration.ChangeDestinations, 5)
 	})
+
+	t.Run("revoked destination is skipped", func(t *testing.T) {
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, false, WithCustomTaskManager(&taskManagerMockBase{}))
+		defer deferMe()
+		xPub := newXpub(testXPub, append(client.DefaultModelOptions(), New())...)
+		err := xPub.Save(ctx)
+		require.NoError(t, err)
+
+		// The next internal destination is revoked
+		var revoked *Destination
+		revoked, err = newAddress(testXPub, utils.ChainInternal, 0, append(client.DefaultModelOptions(), New())...)
+		require.NoError(t, err)
+		revoked.RevokedAt = customTypes.NullTime{NullTime: sql.NullTime{Valid: true, Time: time.Now()}}
+		require.NoError(t, revoked.Save(ctx))
+
+		draftTx := newDraftTransaction(testXPub, &TransactionConfig{
+			Outputs: []*TransactionOutput{{
+				To:       testExternalAddress,
+				Satoshis: 1000,
+			}},
+		}, append(client.DefaultModelOptions(), New())...)
+
+		err = draftTx.setChangeDestinations(ctx, 1)
+		require.NoError(t, err)
+		require.Len(t, draftTx.Configuration.ChangeDestinations, 1)
+		assert.NotEqual(t, revoked.ID, draftTx.Configuration.ChangeDestinations[0].ID)
+		assert.Equal(t, uint32(1), draftTx.Configuration.ChangeDestinations[0].Num)
+	})
+}
+
+// TestDraftTransaction_removeRevokedChangeDestinations will test the method removeRevokedChangeDestinations()
+func TestDraftTransaction_removeRevokedChangeDestinations(t *testing.T) {
+	ctx, client, deferMe := CreateTestSQLiteClient(t, false, false, WithCustomTaskManager(&taskManagerMockBase{}))
+	defer deferMe()
+
+	revoked, err := newAddress(testXPub, utils.ChainInternal, 0, append(client.DefaultModelOptions(), New())...)
+	require.NoError(t, err)
+	revoked.RevokedAt = customTypes.NullTime{NullTime: sql.NullTime{Valid: true, Time: time.Now()}}
+	require.NoError(t, revoked.Save(ctx))
+
+	var active *Destination
+	active, err = newAddress(testXPub, utils.ChainInternal, 1, append(client.DefaultModelOptions(), New())...)
+	require.NoError(t, err)
+	require.NoError(t, active.Save(ctx))
+
+	t.Run("revoked rows are removed", func(t *testing.T) {
+		draftTx := newDraftTransaction(testXPub, &TransactionConfig{
+			ChangeDestinations: []*Destination{
+				{LockingScript: revoked.LockingScript},
+				{LockingScript: active.LockingScript},
+			},
+		}, append(client.DefaultModelOptions(), New())...)
+
+		err = draftTx.removeRevokedChangeDestinations(ctx)
+		require.NoError(t, err)
+		require.Len(t, draftTx.Configuration.ChangeDestinations, 1)
+		assert.Equal(t, active.LockingScript, draftTx.Configuration.ChangeDestinations[0].LockingScript)
+	})
+
+	t.Run("all revoked", func(t *testing.T) {
+		draftTx := newDraftTransaction(testXPub, &TransactionConfig{
+			ChangeDestinations: []*Destination{{LockingScript: revoked.LockingScript}},
+		}, append(client.DefaultModelOptions(), New())...)
+
+		err = draftTx.removeRevokedChangeDestinations(ctx)
+		require.NoError(t, err)
+		assert.Nil(t, draftTx.Configuration.ChangeDestinations)
+	})
 }
 
 // TestDraftTransaction_getDraftTransactionID tests getting the draft transaction by draft id
@@ -671,7 +743,7 @@ func TestDraftTransaction_createTransaction(t *testing.T) {
 		require.NoError(t, err)
 		assert.Equal(t, testXPubID, draftTransaction.XpubID)
 		assert.Equal(t, DraftStatusDraft, draftTransaction.Status)
-		assert.Equal(t, uint64(120), draftTransaction.Configuration.Fee)
+		assert.Equal(t, uint64(121), draftTransaction.Configuration.Fee)
 		assert.Len(t, draftTransaction.Configuration.Inputs, 2)
 		assert.Len(t, draftTransaction.Configuration.Outputs, 3)
 
@@ -692,7 +764,7 @@ func TestDraftTransaction_createTransaction(t *testing.T) {
 		assert.Equal(t, uint64(564), draftTransaction.Configuration.Outputs[1].Scripts[0].Satoshis)
 		assert.Equal(t, testSTASLockingScript, draftTransaction.Configuration.Outputs[1].Scripts[0].Script)
 
-		assert.Equal(t, uint64(98880), draftTransaction.Configuration.Outputs[2].Satoshis)
+		assert.Equal(t, uint64(98879), draftTransaction.Configuration.Outputs[2].Satoshis)
 	})
 
 	t.Run("SendAllTo", func(t *testing.T) {
@@ -890,6 +962,61 @@ func TestDraftTransaction_createTransaction(t *testing.T) {
 	})
 }
 
+// TestDraftTransaction_checkUnconfirmedChain will test the limit of the chain of unconfirmed ancestors
+func TestDraftTransaction_checkUnconfirmedChain(t *testing.T) {
+	// testTxHex spends testTx2Hex, the utxo (testTxID) has a chain of 2 unconfirmed transactions
+	newChainTestCase := func(t *testing.T, blockHeight uint64, opts ...ClientOps) (context.Context, ClientInterface, func()) {
+		ctx, client, deferMe := CreateTestSQLiteClient(
+			t, false, true, append([]ClientOps{WithCustomTaskManager(&taskManagerMockBase{})}, opts...)...,
+		)
+
+		// The parent is recorded first (the depth is recorded with the child)
+		parent := newTransaction(testTx2Hex, append(client.DefaultModelOptions(), New())...)
+		parent.BlockHeight = blockHeight
+		require.NoError(t, parent.Save(ctx))
+		seedSimpleTestCase(ctx, t, client)
+		return ctx, client, deferMe
+	}
+
+	newTestDraft := func(client ClientInterface) *DraftTransaction {
+		return newDraftTransaction(testXPub, &TransactionConfig{
+			Outputs: []*TransactionOutput{{
+				To:       testExternalAddress,
+				Satoshis: 1000,
+			}},
+		}, append(client.DefaultModelOptions(), New())...)
+	}
+
+	t.Run("no limit", func(t *testing.T) {
+		ctx, client, deferMe := newChainTestCase(t, 0)
+		defer deferMe()
+
+		require.NoError(t, newTestDraft(client).createTransactionHex(ctx))
+	})
+
+	t.Run("chain too long", func(t *testing.T) {
+		ctx, client, deferMe := newChainTestCase(t, 0, WithMaxUnconfirmedChain(1))
+		defer deferMe()
+
+		err := newTestDraft(client).createTransactionHex(ctx)
+		require.ErrorIs(t, err, ErrUnconfirmedChainTooLong)
+	})
+
+	t.Run("chain within the limit", func(t *testing.T) {
+		ctx, client, deferMe := newChainTestCase(t, 0, WithMaxUnconfirmedChain(2))
+		defer deferMe()
+
+		require.NoError(t, newTestDraft(client).createTransactionHex(ctx))
+	})
+
+	t.Run("mined ancestor ends the chain", func(t *testing.T) {
+		ctx, client, deferMe := newChainTestCase(t, 100, WithMaxUnconfirmedChain(1))
+		defer deferMe()
+
+		require.NoError(t, newTestDraft(client).createTransactionHex(ctx))
+	})
+}
+
 // TestDraftTransaction_setChangeDestination setting the change destination
 func TestDraftTransaction_setChangeDestination(t *testing.T) {
 	t.Run("missing xpub", func(t *testing.T) {
@@ -1406,6 +1533,234 @@ func TestDraftTransaction_estimateFees(t *testing.T) {
 	})
 }
 
+// TestDraftTransaction_customScriptOutput will test a custom (caller-supplied) script output
+func TestDraftTransaction_customScriptOutput(t *testing.T) {
+	// newDraft will create a draft paying to the custom script
+	newDraft := func(ctx context.Context, t *testing.T, client ClientInterface, script string) *DraftTransaction {
+		draftTransaction := newDraftTransaction(testXPub, &TransactionConfig{
+			Outputs: []*TransactionOutput{{
+				Satoshis: 1000,
+				Script:   script,
+			}},
+		}, append(client.DefaultModelOptions(), New())...)
+		require.NoError(t, draftTransaction.createTransactionHex(ctx))
+		return draftTransaction
+	}
+
+	t.Run("exact script in the draft", func(t *testing.T) {
+		ctx, client, deferMe := initSimpleTestCase(t)
+		defer deferMe()
+
+		draftTransaction := newDraft(ctx, t, client, testSTASLockingScript)
+		require.Len(t, draftTransaction.Configuration.Outputs[0].Scripts, 1)
+		assert.Equal(t, ScriptTypeCustom, draftTransaction.Configuration.Outputs[0].Scripts[0].ScriptType)
+
+		tx, err := bt.NewTxFromString(draftTransaction.Hex)
+		require.NoError(t, err)
+		assert.Equal(t, testSTASLockingScript, tx.Outputs[0].LockingScript.String())
+		assert.Equal(t, uint64(1000), tx.Outputs[0].Satoshis)
+		assert.Equal(t, map[uint32]bool{0: true}, draftTransaction.customOutputIndexes())
+	})
+
+	t.Run("large script fee", func(t *testing.T) {
+		ctx, client, deferMe := initSimpleTestCase(t)
+		defer deferMe()
+
+		small := newDraft(ctx, t, client, "51")
+		require.NoError(t, client.UnReserveUtxos(ctx, small.XpubID, small.ID))
+		large := newDraft(ctx, t, client, strings.Repeat("51", 10000))
+
+		// 9999 more script bytes and 2 more bytes for the script length
+		assert.Equal(t, small.estimateSize()+10001, large.estimateSize())
+		assert.Equal(t, large.estimateFee(large.Configuration.FeeUnit, 0), large.Configuration.Fee)
+		assert.Greater(t, large.Configuration.Fee, small.Configuration.Fee+499)
+	})
+
+	t.Run("script and to", func(t *testing.T) {
+		ctx, client, deferMe := initSimpleTestCase(t)
+		defer deferMe()
+
+		draftTransaction := newDraftTransaction(testXPub, &TransactionConfig{
+			Outputs: []*TransactionOutput{{
+				Satoshis: 1000,
+				Script:   testLockingScript,
+				To:       testExternalAddress,
+			}},
+		}, append(client.DefaultModelOptions(), New())...)
+		require.ErrorIs(t, draftTransaction.createTransactionHex(ctx), ErrOutputScriptNotExclusive)
+	})
+}
+
+// TestDraftTransaction_getSigningInstructions will test the method getSigningInstructions()
+func TestDraftTransaction_getSigningInstructions(t *testing.T) {
+	t.Parallel()
+
+	draft := newDraftTransaction(testXPub, &TransactionConfig{
+		Inputs: []*TransactionInput{{
+			Utxo: Utxo{
+				UtxoPointer: UtxoPointer{TransactionID: testTxID, OutputIndex: 1},
+				Satoshis:    1000,
+			},
+			Destination: Destination{
+				Chain:              utils.ChainInternal,
+				Num:                12,
+				FullDerivationPath: "m/44'/236'/0'/1/12",
+				LockingScript:      testLockingScript,
+			},
+		}, {
+			Utxo: Utxo{
+				UtxoPointer: UtxoPointer{TransactionID: testTxID, OutputIndex: 2},
+				Satoshis:    2000,
+			},
+			Destination: Destination{
+				Chain:         utils.ChainExternal,
+				Num:           3,
+				LockingScript: testLockingScript,
+			},
+			SigHashType: sighash.AllForkID | sighash.AnyOneCanPay,
+		}},
+	}, New())
+
+	instructions := draft.getSigningInstructions()
+	require.NotNil(t, instructions)
+	assert.Equal(t, draft.ID, instructions.DraftID)
+	assert.Equal(t, draft.XpubID, instructions.XpubID)
+	require.Len(t, instructions.Inputs, 2)
+
+	assert.Equal(t, uint32(0), instructions.Inputs[0].InputIndex)
+	assert.Equal(t, "m/44'/236'/0'/1/12", instructions.Inputs[0].DerivationPath)
+	assert.Equal(t, testLockingScript, instructions.Inputs[0].LockingScript)
+	assert.Equal(t, uint64(1000), instructions.Inputs[0].Satoshis)
+	assert.Equal(t, testTxID, instructions.Inputs[0].TransactionID)
+	assert.Equal(t, uint32(1), instructions.Inputs[0].OutputIndex)
+	assert.Equal(t, uint32(sighash.AllForkID), instructions.Inputs[0].SigHashFlags)
+
+	// Destinations without a recorded path use the default prefix
+	assert.Equal(t, "m/0/3", instructions.Inputs[1].DerivationPath)
+	assert.Equal(t, uint32(sighash.AllForkID|sighash.AnyOneCanPay), instructions.Inputs[1].SigHashFlags)
+}
+
+// TestDraftTransaction_SigningPayload will test the method SigningPayload()
+func TestDraftTransaction_SigningPayload(t *testing.T) {
+	t.Parallel()
+
+	_, client, deferMe := CreateTestSQLiteClient(t, false, true, WithCustomTaskManager(&taskManagerMockBase{}))
+	t.Cleanup(deferMe)
+
+	fixtures := NewFixtures(t, client).WithXpub(0).WithUtxos(10000).WithDraft(&TransactionConfig{
+		Outputs: []*TransactionOutput{{
+			To:       testExternalAddress,
+			Satoshis: 1000,
+		}},
+	})
+	draft := fixtures.Drafts[0]
+
+	payload, err := draft.SigningPayload()
+	require.NoError(t, err)
+	assert.Equal(t, SigningPayloadVersion, payload.Version)
+	assert.Equal(t, draft.ID, payload.DraftID)
+	assert.Equal(t, draft.Hex, payload.Hex)
+	assert.Equal(t, fixtures.Xpub.ID, payload.XpubID)
+
+	require.Len(t, payload.Inputs, 1)
+	assert.Equal(t, fixtures.Utxos[0].TransactionID, payload.Inputs[0].TxID)
+	assert.Equal(t, uint32(0), payload.Inputs[0].Vout)
+	assert.Equal(t, uint64(10000), payload.Inputs[0].Satoshis)
+	assert.Equal(t, fixtures.Destinations[0].LockingScript, payload.Inputs[0].LockingScript)
+	assert.Equal(t, fixtures.Destinations[0].FullDerivationPath, payload.Inputs[0].DerivationPath)
+	assert.Equal(t, uint32(sighash.AllForkID), payload.Inputs[0].SigHashType)
+
+	// The expected outputs include the change
+	require.Len(t, payload.Outputs, 2)
+	assert.Equal(t, uint64(1000), payload.Outputs[0].Satoshis)
+	assert.Equal(t, draft.Configuration.Outputs[0].Scripts[0].Script, payload.Outputs[0].LockingScript)
+	assert.Equal(t, draft.Configuration.ChangeSatoshis, payload.Outputs[1].Satoshis)
+
+	t.Run("signed transaction must match", func(t *testing.T) {
+		var signedHex string
+		signedHex, err = draft.SignInputs(fixtures.HDKey)
+		require.NoError(t, err)
+		require.NoError(t, payload.checkSignedHex(signedHex, false))
+
+		var tx *bt.Tx
+		tx, err = bt.NewTxFromString(signedHex)
+		require.NoError(t, err)
+
+		changed := tx.Clone()
+		changed.Outputs[0].Satoshis++
+		assert.ErrorIs(t, payload.checkSignedHex(changed.String(), false), ErrSignedDraftMismatch)
+
+		changed = tx.Clone()
+		changed.Outputs = changed.Outputs[:1]
+		assert.ErrorIs(t, payload.checkSignedHex(changed.String(), false), ErrSignedDraftMismatch)
+
+		changed = tx.Clone()
+		changed.Inputs[0].PreviousTxOutIndex = 5
+		assert.ErrorIs(t, payload.checkSignedHex(changed.String(), false), ErrSignedDraftMismatch)
+
+		// Appended inputs (only if the draft allows external inputs)
+		changed = tx.Clone()
+		require.NoError(t, changed.From(testTxID, 0, testLockingScript, 1000))
+		assert.ErrorIs(t, payload.checkSignedHex(changed.String(), false), ErrSignedDraftMismatch)
+		assert.NoError(t, payload.checkSignedHex(changed.String(), true))
+	})
+}
+
+// TestDraftTransaction_setSigHashTypes will test the method setSigHashTypes()
+func TestDraftTransaction_setSigHashTypes(t *testing.T) {
+	t.Parallel()
+
+	newDraft := func(allowExternalInputs bool) *DraftTransaction {
+		return newDraftTransaction(testXPub, &TransactionConfig{
+			AllowExternalInputs: allowExternalInputs,
+			Inputs: []*TransactionInput{
+				{Utxo: Utxo{UtxoPointer: UtxoPointer{TransactionID: testTxID, OutputIndex: 0}}},
+				{Utxo: Utxo{UtxoPointer: UtxoPointer{TransactionID: testTxID, OutputIndex: 1}}},
+			},
+		}, New())
+	}
+	anyoneCanPay := []*TransactionInput{{
+		Utxo:        Utxo{UtxoPointer: UtxoPointer{TransactionID: testTxID, OutputIndex: 1}},
+		SigHashType: sighash.AllForkID | sighash.AnyOneCanPay,
+	}}
+
+	t.Run("no overrides", func(t *testing.T) {
+		draft := newDraft(false)
+		require.NoError(t, draft.setSigHashTypes(nil))
+		assert.Equal(t, sighash.AllForkID, draft.Configuration.Inputs[0].getSigHashType())
+		assert.Equal(t, sighash.AllForkID, draft.Configuration.Inputs[1].getSigHashType())
+	})
+
+	t.Run("override matching input", func(t *testing.T) {
+		draft := newDraft(true)
+		require.NoError(t, draft.setSigHashTypes(anyoneCanPay))
+		assert.Equal(t, sighash.AllForkID, draft.Configuration.Inputs[0].getSigHashType())
+		assert.Equal(t, sighash.AllForkID|sighash.AnyOneCanPay, draft.Configuration.Inputs[1].getSigHashType())
+	})
+
+	t.Run("external inputs without anyonecanpay input", func(t *testing.T) {
+		draft := newDraft(true)
+		assert.ErrorIs(t, draft.setSigHashTypes(nil), ErrExternalInputsRequireAnyoneCanPay)
+	})
+}
+
+// TestDraftTransaction_estimateSize_externalInputs will test the method estimateSize() with external inputs
+func TestDraftTransaction_estimateSize_externalInputs(t *testing.T) {
+	t.Parallel()
+
+	draft := newDraftTransaction(testXPub, &TransactionConfig{
+		Inputs: []*TransactionInput{{Utxo: Utxo{Type: utils.ScriptTypePubKeyHash}}},
+	}, New())
+	size := draft.estimateSize()
+
+	// Not counted unless external inputs are allowed
+	draft.Configuration.ExternalInputsCount = 2
+	assert.Equal(t, size, draft.estimateSize())
+
+	draft.Configuration.AllowExternalInputs = true
+	assert.Equal(t, size+2*utils.GetInputSizeForType(utils.ScriptTypePubKeyHash), draft.estimateSize())
+}
+
 // TestDraftTransaction_RegisterTasks will test the method RegisterTasks()
 func TestDraftTransaction_RegisterTasks(t *testing.T) {
 	draftCleanupTask := "draft_transaction_clean_up"
@@ -1540,9 +1895,17 @@ func TestDraftTransaction_SignInputs(t *testing.T) {
 	}
 }
 
-func initSimpleTestCase(t *testing.T) (context.Context, ClientInterface, func()) {
-	ctx, client, deferMe := CreateTestSQLiteClient(t, false, true, WithCustomTaskManager(&taskManagerMockBase{}))
+func initSimpleTestCase(t *testing.T, opts ...ClientOps) (context.Context, ClientInterface, func()) {
+	ctx, client, deferMe := CreateTestSQLiteClient(
+		t, false, true, append([]ClientOps{WithCustomTaskManager(&taskManagerMockBase{})}, opts...)...,
+	)
+	seedSimpleTestCase(ctx, t, client)
+
+	return ctx, client, deferMe
+}
 
+// seedSimpleTestCase will save the xPub, destination, utxo and transaction of the simple test case
+func seedSimpleTestCase(ctx context.Context, t *testing.T, client ClientInterface) {
 	xPub := newXpub(testXPub, append(client.DefaultModelOptions(), New())...)
 	xPub.CurrentBalance = 100000
 	err := xPub.Save(ctx)
@@ -1561,6 +1924,222 @@ func initSimpleTestCase(t *testing.T) (context.Context, ClientInterface, func())
 	transaction := newTransaction(testTxHex, append(client.DefaultModelOptions(), New())...)
 	err = transaction.Save(ctx)
 	require.NoError(t, err)
+}
 
-	return ctx, client, deferMe
+// eventsOfType will wait for the notifications of the event type (other events are ignored)
+func eventsOfType(mock *notifications.MockClient, eventType notifications.EventType, count int) []*notifications.Event {
+	var found []*notifications.Event
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		found = nil
+		for _, event := range mock.Events() {
+			if event.EventType == eventType {
+				found = append(found, event)
+			}
+		}
+		if len(found) >= count {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return found
+}
+
+// TestDraftTransaction_expiryNotifications will test the draft expiring soon and expired notifications
+func TestDraftTransaction_expiryNotifications(t *testing.T) {
+	t.Parallel()
+
+	// The client is closed after the fixtures released the reservations
+	newDraft := func(t *testing.T, expiresIn time.Duration) (context.Context, ClientInterface,
+		*notifications.MockClient, *Fixtures) {
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, true,
+			WithCustomTaskManager(&taskManagerMockBase{}),
+			WithDraftExpiryWarning(time.Hour),
+		)
+		t.Cleanup(deferMe)
+		mock := notifications.NewMockClient()
+		client.SetNotificationsClient(mock)
+
+		fixtures := NewFixtures(t, client).WithXpub(0).WithUtxos(10000).WithDraft(&TransactionConfig{
+			ExpiresIn: expiresIn,
+			Outputs:   []*TransactionOutput{{To: testExternalAddress, Satoshis: 1000}},
+		})
+		return ctx, client, mock, fixtures
+	}
+
+	t.Run("expiring soon is only notified once", func(t *testing.T) {
+		ctx, client, mock, fixtures := newDraft(t, 30*time.Minute)
+
+		require.NoError(t, taskCleanupDraftTransactions(ctx, client.Logger(), client.DefaultModelOptions()...))
+		require.NoError(t, taskCleanupDraftTransactions(ctx, client.Logger(), client.DefaultModelOptions()...))
+
+		events := eventsOfType(mock, notifications.EventTypeDraftExpiringSoon, 1)
+		require.Len(t, events, 1)
+		assert.Equal(t, fixtures.Drafts[0].ID, events[0].ID)
+		payload, ok := events[0].Model.(*notifications.DraftEventV1)
+		require.True(t, ok)
+		assert.Equal(t, uint64(10000), payload.ReservedSatoshis)
+		assert.Equal(t, fixtures.Xpub.ID, payload.XpubID)
+		assert.Equal(t, string(DraftStatusDraft), payload.Status)
+
+		draft, err := getDraftTransactionID(ctx, fixtures.Xpub.ID, fixtures.Drafts[0].ID, client.DefaultModelOptions()...)
+		require.NoError(t, err)
+		assert.True(t, draft.ExpiryWarned)
+		assert.Equal(t, DraftStatusDraft, draft.Status)
+	})
+
+	t.Run("not expiring soon", func(t *testing.T) {
+		ctx, client, mock, _ := newDraft(t, 2*time.Hour)
+
+		require.NoError(t, taskCleanupDraftTransactions(ctx, client.Logger(), client.DefaultModelOptions()...))
+		assert.Empty(t, eventsOfType(mock, notifications.EventTypeDraftExpiringSoon, 1))
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		ctx, client, mock, fixtures := newDraft(t, 10*time.Millisecond)
+		time.Sleep(20 * time.Millisecond)
+
+		require.NoError(t, taskCleanupDraftTransactions(ctx, client.Logger(), client.DefaultModelOptions()...))
+
+		events := eventsOfType(mock, notifications.EventTypeDraftExpired, 1)
+		require.Len(t, events, 1)
+		assert.Equal(t, fixtures.Drafts[0].ID, events[0].ID)
+		payload, ok := events[0].Model.(*notifications.DraftEventV1)
+		require.True(t, ok)
+		assert.Equal(t, uint64(10000), payload.ReservedSatoshis)
+		assert.Equal(t, string(DraftStatusExpired), payload.Status)
+		assert.Empty(t, eventsOfType(mock, notifications.EventTypeDraftExpiringSoon, 1))
+	})
+}
+
+// TestDraftTransaction_partialResolution will test the drafts with one failing paymail domain out of three
+func TestDraftTransaction_partialResolution(t *testing.T) {
+	const (
+		secondDomain = "second.com"
+		downDomain   = "down.com"
+	)
+
+	// mockPaymailDomains will mock the address resolution of the domains (the down domain fails)
+	mockPaymailDomains := func() {
+		mockValidResponse(http.StatusOK, false, testDomain)
+		serverURL := "https://" + secondDomain + "/api/v1/" + paymail.DefaultServiceName
+		httpmock.RegisterResponder(http.MethodGet, "https://"+secondDomain+":443/.well-known/"+paymail.DefaultServiceName,
+			httpmock.NewStringResponder(http.StatusOK, `{"`+paymail.DefaultServiceName+`": "`+paymail.DefaultBsvAliasVersion+`","capabilities":{
+"`+paymail.BRFCPaymentDestination+`": "`+serverURL+`/address/{alias}@{domain.tld}"}
+}`),
+		)
+		httpmock.RegisterResponder(http.MethodPost, serverURL+"/address/"+testAlias+"@"+secondDomain,
+			httpmock.NewStringResponder(http.StatusOK, `{"output": "`+testDraftLockingScript+`"}`),
+		)
+		httpmock.RegisterResponder(http.MethodGet, "https://"+downDomain+":443/.well-known/"+paymail.DefaultServiceName,
+			httpmock.NewStringResponder(http.StatusServiceUnavailable, `{}`),
+		)
+	}
+
+	// newPartialDraft will return a client (with the mocked paymail domains), the fixtures and the outputs
+	newPartialDraft := func(t *testing.T) (context.Context, ClientInterface, *Fixtures, []*TransactionOutput) {
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, true,
+			WithCustomTaskManager(&taskManagerMockBase{}),
+			WithPaymailClient(newTestPaymailClient(t, []string{testDomain, secondDomain, downDomain})),
+		)
+		t.Cleanup(deferMe)
+		mockPaymailDomains()
+
+		return ctx, client, NewFixtures(t, client).WithXpub(0).WithUtxos(10000), []*TransactionOutput{
+			{To: testAlias + "@" + testDomain, Satoshis: 1000},
+			{To: testAlias + "@" + secondDomain, Satoshis: 1000},
+			{To: testAlias + "@" + downDomain, Satoshis: 1000},
+		}
+	}
+
+	// assertNothingReserved will check that none of the utxos of the xPub is reserved
+	assertNothingReserved := func(ctx context.Context, t *testing.T, client ClientInterface, fixtures *Fixtures) {
+		utxos, err := client.GetUtxosByXpubID(ctx, fixtures.Xpub.ID, nil, nil, nil)
+		require.NoError(t, err)
+		require.NotEmpty(t, utxos)
+		for _, utxo := range utxos {
+			assert.False(t, utxo.DraftID.Valid)
+		}
+	}
+
+	t.Run("default: the draft fails, nothing is reserved", func(t *testing.T) {
+		ctx, client, fixtures, outputs := newPartialDraft(t)
+
+		_, err := client.NewTransaction(ctx, fixtures.RawXpub, &TransactionConfig{Outputs: outputs})
+		require.Error(t, err)
+		assert.NotErrorIs(t, err, ErrOutputsUnresolved)
+		assertNothingReserved(ctx, t, client, fixtures)
+	})
+
+	t.Run("partial: the failed recipients are listed, nothing is reserved", func(t *testing.T) {
+		ctx, client, fixtures, outputs := newPartialDraft(t)
+
+		_, err := client.NewTransaction(ctx, fixtures.RawXpub, &TransactionConfig{
+			AllowPartialResolution: true,
+			Outputs:                outputs,
+		})
+		require.ErrorIs(t, err, ErrOutputsUnresolved)
+
+		var unresolvedErr *OutputsUnresolvedError
+		require.ErrorAs(t, err, &unresolvedErr)
+		require.Len(t, unresolvedErr.Failures, 1)
+		assert.Equal(t, 2, unresolvedErr.Failures[0].Index)
+		assert.Equal(t, testAlias+"@"+downDomain, unresolvedErr.Failures[0].To)
+		assert.NotEmpty(t, unresolvedErr.Failures[0].Reason)
+
+		require.Len(t, unresolvedErr.Resolved, 2)
+		assert.Equal(t, testOutput, unresolvedErr.Resolved[0].Scripts[0].Script)
+		assert.Equal(t, testDraftLockingScript, unresolvedErr.Resolved[1].Scripts[0].Script)
+		assertNothingReserved(ctx, t, client, fixtures)
+
+		// The resolved outputs are locked in (not resolved again, the providers are not requested)
+		httpmock.Reset()
+		var draft *DraftTransaction
+		draft, err = client.NewTransaction(ctx, fixtures.RawXpub, &TransactionConfig{
+			AllowPartialResolution: true,
+			Outputs:                unresolvedErr.Resolved,
+		})
+		require.NoError(t, err)
+		fixtures.Drafts = append(fixtures.Drafts, draft)
+		require.Len(t, draft.Configuration.Outputs[0].Scripts, 1)
+		assert.Equal(t, testOutput, draft.Configuration.Outputs[0].Scripts[0].Script)
+		assert.Equal(t, testDraftLockingScript, draft.Configuration.Outputs[1].Scripts[0].Script)
+	})
+
+	t.Run("partial: the other outputs are validated as usual", func(t *testing.T) {
+		ctx, client, fixtures, outputs := newPartialDraft(t)
+
+		_, err := client.NewTransaction(ctx, fixtures.RawXpub, &TransactionConfig{
+			AllowPartialResolution: true,
+			Outputs: append(outputs, &TransactionOutput{
+				Script:   "not-a-script",
+				Satoshis: 1000,
+				Scripts:  []*ScriptOutput{{Script: testOutput, Satoshis: 1000}},
+			}),
+		})
+		require.Error(t, err)
+		assert.NotErrorIs(t, err, ErrOutputsUnresolved)
+
+		_, err = client.NewTransaction(ctx, fixtures.RawXpub, &TransactionConfig{
+			AllowPartialResolution: true,
+			Outputs:                []*TransactionOutput{{To: testAlias + "@" + downDomain, Satoshis: 0}},
+		})
+		require.ErrorIs(t, err, ErrOutputValueTooLow)
+		assertNothingReserved(ctx, t, client, fixtures)
+	})
+
+	t.Run("partial: the locked in scripts are validated", func(t *testing.T) {
+		ctx, client, fixtures, _ := newPartialDraft(t)
+
+		_, err := client.NewTransaction(ctx, fixtures.RawXpub, &TransactionConfig{
+			AllowPartialResolution: true,
+			Outputs: []*TransactionOutput{{
+				To:       testAlias + "@" + testDomain,
+				Satoshis: 1000,
+				Scripts:  []*ScriptOutput{{Script: testOutput, Satoshis: 5000}},
+			}},
+		})
+		require.ErrorIs(t, err, ErrOutputValueMismatch)
+		assertNothingReserved(ctx, t, client, fixtures)
+	})
 }
@@ -3,6 +3,7 @@ package bux
 import (
 	"context"
 	"errors"
+	"sort"
 	"time"
 
 	"github.com/mrz1836/go-cachestore"
@@ -177,13 +178,172 @@ func getModelCountByConditions(ctx context.Context, modelName ModelName, model i
 }
 
 // getModelFromCache will attempt to get a model from cache
-func getModelFromCache(ctx context.Context, cacheClient cachestore.ClientInterface,
-	key string, model ModelInterface) (bool, error) { // Success if the key was found
-	if err := cacheClient.GetModel(ctx, key, model); err != nil {
+//
+// Not found if the model is not cached (see WithModelCacheTTL) or the cache is bypassed (see SkipCache),
+// the hits and misses are counted by model (see ModelCacheStats)
+func getModelFromCache(ctx context.Context, client ClientInterface,
+	key string, model ModelInterface, opts ...ModelOps) (bool, error) { // Success if the key was found
+	cache, ok := client.(modelCacheClient)
+	if !ok || NewBaseModel(ModelNameEmpty, opts...).skipCache {
+		return false, nil
+	} else if _, cached := cache.modelCacheTTL(model.GetModelName()); !cached {
+		return false, nil
+	}
+	if err := client.Cachestore().GetModel(ctx, key, model); err != nil {
 		if errors.Is(err, cachestore.ErrKeyNotFound) {
+			cache.recordModelCacheRead(model.GetModelName(), false)
 			return false, nil
 		}
 		return false, err
 	}
+	cache.recordModelCacheRead(model.GetModelName(), true)
 	return true, nil
 }
+
+// keysetRecord is a model that can be paged using keyset pagination (created_at + id)
+type keysetRecord interface {
+	GetID() string
+	getCreatedAt() time.Time
+}
+
+// keysetFetcher will fetch a page of keyset records using the given conditions and query params
+type keysetFetcher func(ctx context.Context, conditions map[string]interface{},
+	queryParams *datastore.QueryParams) ([]keysetRecord, error)
+
+// keysetPageHook will return the hook of the client called with the number of records of every page loaded
+// by forEachKeysetRecord (nil if not set)
+//
+// This is used for instrumentation (IE: tests asserting the memory bounds of an iterator)
+func keysetPageHook(opts ...ModelOps) func(records int) {
+	if c, ok := NewBaseModel(ModelNameEmpty, opts...).Client().(*Client); ok {
+		return c.options.keysetPageLoaded
+	}
+	return nil
+}
+
+// errKeysetStop is returned by the function of forEachKeysetRecord to stop the iteration (not an error)
+var errKeysetStop = errors.New("keyset iteration stopped")
+
+// getCreatedAt will return the time the record was created (used for keyset pagination)
+func (m *Model) getCreatedAt() time.Time {
+	return m.CreatedAt
+}
+
+// forEachKeysetRecord will page through all records matching the conditions and invoke fn for each record
+//
+// Records are paged using keyset pagination on (created_at, id) instead of OFFSET. Only one page
+// (batchSize records) is held in memory at any time. Iteration stops on the first error or ctx cancellation.
+func forEachKeysetRecord(ctx context.Context, conditions map[string]interface{}, batchSize int,
+	fetch keysetFetcher, fn func(record keysetRecord) error, opts ...ModelOps) error {
+
+	if batchSize <= 0 {
+		batchSize = defaultPageSize
+	}
+	pageLoaded := keysetPageHook(opts...)
+
+	var lastCreatedAt *time.Time
+	for {
+		pageConditions := conditions
+		if lastCreatedAt != nil {
+			pageConditions = keysetConditions(conditions, map[string]interface{}{
+				createdAtField: map[string]interface{}{"$gt": *lastCreatedAt},
+			})
+		}
+
+		records, err := fetchKeysetPage(ctx, pageConditions, createdAtField, batchSize, fetch, pageLoaded)
+		if err != nil {
+			return err
+		} else if len(records) == 0 {
+			return nil
+		}
+
+		// Records sharing the last created_at might continue on the next page, those are paged by id
+		complete := len(records) < batchSize
+		boundary := records[len(records)-1].getCreatedAt()
+		for _, record := range records {
+			if !complete && record.getCreatedAt().Equal(boundary) {
+				continue
+			}
+			if err = fn(record); err != nil {
+				return err
+			}
+		}
+		if complete {
+			return nil
+		}
+
+		if err = forEachKeysetBoundaryRecord(ctx, conditions, boundary, batchSize, fetch, fn, pageLoaded); err != nil {
+			return err
+		}
+		lastCreatedAt = &boundary
+	}
+}
+
+// forEachKeysetBoundaryRecord will page (by id) through all records created at the exact boundary time
+func forEachKeysetBoundaryRecord(ctx context.Context, conditions map[string]interface{}, boundary time.Time,
+	batchSize int, fetch keysetFetcher, fn func(record keysetRecord) error, pageLoaded func(records int)) error {
+
+	lastID := ""
+	for {
+		records, err := fetchKeysetPage(ctx, keysetConditions(conditions, map[string]interface{}{
+			createdAtField: boundary,
+			idField:        map[string]interface{}{"$gt": lastID},
+		}), idField, batchSize, fetch, pageLoaded)
+		if err != nil {
+			return err
+		}
+
+		for _, record := range records {
+			if err = fn(record); err != nil {
+				return err
+			}
+			lastID = record.GetID()
+		}
+
+		if len(records) < batchSize {
+			return nil
+		}
+	}
+}
+
+// fetchKeysetPage will fetch (and sort) a single page of records ordered by the given field
+func fetchKeysetPage(ctx context.Context, conditions map[string]interface{}, orderByField string,
+	batchSize int, fetch keysetFetcher, pageLoaded func(records int)) ([]keysetRecord, error) {
+
+	// Stop if the context was canceled
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	records, err := fetch(ctx, conditions, &datastore.QueryParams{
+		Page:          1,
+		PageSize:      batchSize,
+		OrderByField:  orderByField,
+		SortDirection: datastore.SortAsc,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if pageLoaded != nil {
+		pageLoaded(len(records))
+	}
+
+	sort.SliceStable(records, func(i, j int) bool {
+		if records[i].getCreatedAt().Equal(records[j].getCreatedAt()) {
+			return records[i].GetID() < records[j].GetID()
+		}
+		return records[i].getCreatedAt().Before(records[j].getCreatedAt())
+	})
+	return records, nil
+}
+
+// keysetConditions will combine the given conditions with the keyset conditions
+func keysetConditions(conditions, keyset map[string]interface{}) map[string]interface{} {
+	if len(conditions) == 0 {
+		return keyset
+	}
+	return map[string]interface{}{
+		"$and": []map[string]interface{}{conditions, keyset},
+	}
+}
@@ -68,6 +68,74 @@ func getIncomingTransactionByID(ctx context.Context, id string, opts ...ModelOps
 	return tx, nil
 }
 
+// saveIncomingTransaction will save the new incoming transaction, or merge it into the existing record (same tx ID)
+//
+// Two instances can receive the same transaction (IE: monitor and paymail P2P), the second writer
+// does not create a new record: the new metadata is attached to the existing (canonical) record
+func saveIncomingTransaction(ctx context.Context, incomingTx *IncomingTransaction) (*IncomingTransaction, error) {
+
+	// Existing record?
+	existing, err := getIncomingTransactionByID(ctx, incomingTx.ID, incomingTx.GetOptions(false)...)
+	if err != nil {
+		return nil, err
+	} else if existing == nil {
+		if err = incomingTx.Save(ctx); err == nil {
+			return incomingTx, nil
+		} else if !isUniqueConstraintError(err) {
+			return nil, err
+		}
+
+		// Created by another instance in the meantime (the ID is unique)
+		if existing, err = getIncomingTransactionByID(
+			ctx, incomingTx.ID, incomingTx.GetOptions(false)...,
+		); err != nil {
+			return nil, err
+		} else if existing == nil {
+			return nil, ErrMissingIncomingTransaction
+		}
+	}
+
+	return existing.mergeMetadata(ctx, incomingTx.Metadata)
+}
+
+// mergeMetadata will attach the new metadata keys to the record (the existing keys are kept)
+//
+// The record is reloaded if it was saved by another instance in the meantime (see ErrStaleModel)
+func (m *IncomingTransaction) mergeMetadata(ctx context.Context, metadata Metadata) (*IncomingTransaction, error) {
+	newKeys := func(incomingTx *IncomingTransaction) Metadata {
+		merged := make(Metadata)
+		for key, value := range metadata {
+			if _, ok := incomingTx.Metadata[key]; !ok && value != nil {
+				merged[key] = value
+			}
+		}
+		return merged
+	}
+	if len(newKeys(m)) == 0 {
+		return m, nil
+	}
+	return saveWithReload(ctx, m, m.reload, func(incomingTx *IncomingTransaction) {
+		incomingTx.UpdateMetadata(newKeys(incomingTx))
+	})
+}
+
+// reload will get the latest version of the record from the datastore
+func (m *IncomingTransaction) reload(ctx context.Context) (*IncomingTransaction, error) {
+	incomingTx, err := getIncomingTransactionByID(ctx, m.ID, m.GetOptions(false)...)
+	if err == nil && incomingTx == nil {
+		err = ErrMissingIncomingTransaction
+	}
+	return incomingTx, err
+}
+
+// saveStatus will save the status of the record (reloaded if it was saved by another instance in the meantime)
+func (m *IncomingTransaction) saveStatus(ctx context.Context, status SyncStatus, message string) (*IncomingTransaction, error) {
+	return saveWithReload(ctx, m, m.reload, func(incomingTx *IncomingTransaction) {
+		incomingTx.Status = status
+		incomingTx.StatusMessage = message
+	})
+}
+
 // getIncomingTransactionsToProcess will get the incoming transactions to process
 func getIncomingTransactionsToProcess(ctx context.Context, queryParams *datastore.QueryParams,
 	opts ...ModelOps) ([]*IncomingTransaction, error) {
@@ -118,6 +186,11 @@ func (m *IncomingTransaction) GetModelTableName() string {
 	return tableIncomingTransactions
 }
 
+// isVersioned will return true (saves use optimistic concurrency, see ErrStaleModel)
+func (m *IncomingTransaction) isVersioned() bool {
+	return true
+}
+
 // Save will save the model into the Datastore
 func (m *IncomingTransaction) Save(ctx context.Context) error {
 	return Save(ctx, m)
@@ -299,6 +372,16 @@ func processIncomingTransaction(ctx context.Context, logClient zLogger.GormLogge
 		return err
 	}
 
+	// Already processed by another instance (while waiting on the lock)
+	var current *IncomingTransaction
+	if current, err = getIncomingTransactionByID(
+		ctx, incomingTx.ID, incomingTx.GetOptions(false)...,
+	); err != nil {
+		return err
+	} else if current != nil && current.Status == statusComplete {
+		return nil
+	}
+
 	// Find in mempool or on-chain
 	var txInfo *chainstate.TransactionInfo
 	if txInfo, err = incomingTx.Client().Chainstate().QueryTransactionFastest(
@@ -330,9 +413,9 @@ func processIncomingTransaction(ctx context.Context, logClient zLogger.GormLogge
 			if txInfo, err = incomingTx.Client().Chainstate().QueryTransactionFastest(
 				ctx, incomingTx.ID, chainstate.RequiredInMempool, defaultQueryTxTimeout,
 			); err != nil {
-				incomingTx.Status = statusReady
-				incomingTx.StatusMessage = "tx was not found on-chain, attempting to broadcast using provider: " + provider
-				_ = incomingTx.Save(ctx)
+				_, _ = incomingTx.saveStatus(
+					ctx, statusReady, "tx was not found on-chain, attempting to broadcast using provider: "+provider,
+				)
 				return err
 			}
 		} else {
@@ -356,11 +439,14 @@ func processIncomingTransaction(ctx context.Context, logClient zLogger.GormLogge
 		transaction = tx
 	}
 	// Add additional information (if found on-chain)
-	transaction.BlockHeight = uint64(txInfo.BlockHeight)
-	transaction.BlockHash = txInfo.BlockHash
+	transaction.setBlockInfo(txInfo.BlockHash, uint64(txInfo.BlockHeight))
+	transaction.setMinedAt(ctx)
 
 	// Create status message
 	onChain := len(transaction.BlockHash) > 0 || transaction.BlockHeight > 0
+	if !onChain {
+		transaction.setFirstSeen(time.Now().UTC())
+	}
 	message := "transaction was found in mempool by " + txInfo.Provider
 	if onChain {
 		message = "transaction was found on-chain by " + txInfo.Provider
@@ -373,9 +459,7 @@ func processIncomingTransaction(ctx context.Context, logClient zLogger.GormLogge
 	}
 
 	// Update (or delete?) the incoming transaction record
-	incomingTx.Status = statusComplete
-	incomingTx.StatusMessage = message
-	if err = incomingTx.Save(ctx); err != nil {
+	if incomingTx, err = incomingTx.saveStatus(ctx, statusComplete, message); err != nil {
 		bailAndSaveIncomingTransaction(ctx, incomingTx, err.Error())
 		return err
 	}
@@ -386,7 +470,5 @@ func processIncomingTransaction(ctx context.Context, logClient zLogger.GormLogge
 
 // bailAndSaveIncomingTransaction try to save the error message
 func bailAndSaveIncomingTransaction(ctx context.Context, incomingTx *IncomingTransaction, errorMessage string) {
-	incomingTx.Status = statusError
-	incomingTx.StatusMessage = errorMessage
-	_ = incomingTx.Save(ctx)
+	_, _ = incomingTx.saveStatus(ctx, statusError, errorMessage)
 }
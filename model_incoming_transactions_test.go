@@ -1,8 +1,12 @@
 package bux
 
 import (
+	"context"
+	"fmt"
+	"sync"
 	"testing"
 
+	"github.com/BuxOrg/bux/tester"
 	"github.com/BuxOrg/bux/utils"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -19,52 +23,113 @@ func TestIncomingTransaction_GetModelName(t *testing.T) {
 // TestProcessIncomingTransaction will test the method processIncomingTransaction()
 func (ts *EmbeddedDBTestSuite) TestProcessIncomingTransaction() {
 
-	for _, testCase := range dbTestCases {
-		ts.T().Run(testCase.name+" - LIVE integration test - valid external incoming tx", func(t *testing.T) {
-
-			// todo: mock the response vs using a LIVE request for Chainstate
-
-			tc := ts.genericDBClient(t, testCase.database, true, WithCustomChainstate(&chainStateEverythingOnChain{}))
-			defer tc.Close(tc.ctx)
-
-			// Create a xpub
-			var err error
-			xPubKey := "xpub6826nizKsKjNvxGbcYPiyS4tLVB3nd3e4yujBe6YmqmNtN3DMytsQMkruEgHoyUu89CHcTtaeeLynTC19fD4JcAvKXBUbHi9qdeWtUMYCQK"
-			xPub := newXpub(xPubKey, append(tc.client.DefaultModelOptions(), New())...)
-			require.NotNil(t, xPub)
-
-			err = xPub.Save(tc.ctx)
-			require.NoError(t, err)
-
-			// Create a destination
-			var destination *Destination
-			destination, err = xPub.getNewDestination(tc.ctx, utils.ChainExternal, utils.ScriptTypePubKeyHash, tc.client.DefaultModelOptions()...)
-			require.NoError(t, err)
-			require.NotNil(t, destination)
-
-			// Save the updated xPub and new destination
-			err = xPub.Save(tc.ctx)
-			require.NoError(t, err)
-
-			// Record an external incoming tx
-			txHex := "0100000001574eacf3305f561f63d6f1896566d5ff63409fea2aae1534a3e3734191b47430020000006b483045022100e3f002e318d2dfae67f00da8aa327cc905e93d4a5adb5b7c33afde95bfc26acc022000ddfcdba500e0ba9eaadde478e2b6c6566f8d6837e7802c5f867492eadfe5d1412102ff596abfae0099d480d93937380af985f5165b84ad31790c10c09d3daab8562effffffff01493a1100000000001976a914ec8470c5d9275c39829b15ea7f1997cb66082d3188ac00000000"
-			var tx *Transaction
-			tx, err = tc.client.RecordTransaction(tc.ctx, xPubKey, txHex, "", tc.client.DefaultModelOptions()...)
-			require.NoError(t, err)
-			require.NotNil(t, tx)
-
-			// Process if found
-			err = processIncomingTransactions(tc.ctx, nil, 5, WithClient(tc.client))
-			require.NoError(t, err)
-
-			// Check if the tx is found in the datastore
-			var foundTx *Transaction
-			foundTx, err = tc.client.GetTransaction(tc.ctx, xPub.ID, tx.ID)
-			require.NoError(t, err)
-			require.NotNil(t, foundTx)
-
-			// Test that we found the tx on-chain(600000 is a height of a mocked tx)
-			assert.Equal(t, uint64(600000), foundTx.BlockHeight)
-		})
+	ts.runParallelDBTests("LIVE integration test - valid external incoming tx", true, func(t *testing.T, tc *TestingClient) {
+		// todo: mock the response vs using a LIVE request for Chainstate
+
+		// Create a xpub
+		var err error
+		xPubKey := "xpub6826nizKsKjNvxGbcYPiyS4tLVB3nd3e4yujBe6YmqmNtN3DMytsQMkruEgHoyUu89CHcTtaeeLynTC19fD4JcAvKXBUbHi9qdeWtUMYCQK"
+		xPub := newXpub(xPubKey, append(tc.client.DefaultModelOptions(), New())...)
+		require.NotNil(t, xPub)
+
+		err = xPub.Save(tc.ctx)
+		require.NoError(t, err)
+
+		// Create a destination
+		var destination *Destination
+		destination, err = xPub.getNewDestination(tc.ctx, utils.ChainExternal, utils.ScriptTypePubKeyHash, tc.client.DefaultModelOptions()...)
+		require.NoError(t, err)
+		require.NotNil(t, destination)
+
+		// Save the updated xPub and new destination
+		err = xPub.Save(tc.ctx)
+		require.NoError(t, err)
+
+		// Record an external incoming tx
+		txHex := "0100000001574eacf3305f561f63d6f1896566d5ff63409fea2aae1534a3e3734191b47430020000006b483045022100e3f002e318d2dfae67f00da8aa327cc905e93d4a5adb5b7c33afde95bfc26acc022000ddfcdba500e0ba9eaadde478e2b6c6566f8d6837e7802c5f867492eadfe5d1412102ff596abfae0099d480d93937380af985f5165b84ad31790c10c09d3daab8562effffffff01493a1100000000001976a914ec8470c5d9275c39829b15ea7f1997cb66082d3188ac00000000"
+		var tx *Transaction
+		tx, err = tc.client.RecordTransaction(tc.ctx, xPubKey, txHex, "", tc.client.DefaultModelOptions()...)
+		require.NoError(t, err)
+		require.NotNil(t, tx)
+
+		// Process if found
+		err = processIncomingTransactions(tc.ctx, nil, 5, WithClient(tc.client))
+		require.NoError(t, err)
+
+		// Check if the tx is found in the datastore
+		var foundTx *Transaction
+		foundTx, err = tc.client.GetTransaction(tc.ctx, xPub.ID, tx.ID)
+		require.NoError(t, err)
+		require.NotNil(t, foundTx)
+
+		// Test that we found the tx on-chain(600000 is a height of a mocked tx)
+		assert.Equal(t, uint64(600000), foundTx.BlockHeight)
+	}, WithCustomChainstate(&chainStateEverythingOnChain{}))
+}
+
+// TestSaveIncomingTransaction_concurrent will test recording the same incoming transaction from two instances
+func TestSaveIncomingTransaction_concurrent(t *testing.T) {
+	t.Parallel()
+
+	// Two instances (own cachestore and locks) using the same datastore
+	sqliteConfig := tester.SQLiteIsolatedTestConfig(false)
+	newInstance := func() (context.Context, ClientInterface, func()) {
+		return CreateTestSQLiteClient(t, false, true,
+			WithSQLite(sqliteConfig),
+			WithCustomChainstate(&chainStateEverythingOnChain{}),
+			WithCustomTaskManager(&taskManagerMockBase{}),
+		)
+	}
+	ctx, client, deferMe := newInstance()
+	defer deferMe()
+	_, other, deferOther := newInstance()
+	defer deferOther()
+
+	fixtures := NewFixtures(t, client).WithXpub(0).WithDestinations(1)
+	txHex := monitoredTxHex(t, []string{fixtures.Destinations[0].LockingScript}, []uint64{5000})
+	txID, err := utils.GetTransactionIDFromHex(txHex)
+	require.NoError(t, err)
+
+	// Record at the same time (IE: monitor and paymail P2P)
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	for index, instance := range []ClientInterface{client, other} {
+		wg.Add(1)
+		go func(index int, instance ClientInterface) {
+			defer wg.Done()
+			_, errs[index] = instance.RecordTransaction(
+				ctx, "", txHex, "", WithMetadata(fmt.Sprintf("instance_%d", index), "received"),
+			)
+		}(index, instance)
 	}
+	wg.Wait()
+	require.NoError(t, errs[0])
+	require.NoError(t, errs[1])
+
+	// One canonical record with the metadata of both writers
+	var incomingTxs []IncomingTransaction
+	require.NoError(t, getModels(
+		ctx, client.Datastore(), &incomingTxs, map[string]interface{}{idField: txID}, nil, defaultDatabaseReadTimeout,
+	))
+	require.Len(t, incomingTxs, 1)
+	assert.Equal(t, "received", incomingTxs[0].Metadata["instance_0"])
+	assert.Equal(t, "received", incomingTxs[0].Metadata["instance_1"])
+
+	// One transaction and utxo
+	transaction, err := client.GetTransaction(ctx, "", txID)
+	require.NoError(t, err)
+	assert.Equal(t, txID, transaction.ID)
+
+	var utxos []*Utxo
+	utxos, err = client.GetUtxosByXpubID(ctx, fixtures.Xpub.ID, nil, nil, nil)
+	require.NoError(t, err)
+	assert.Len(t, utxos, 1)
+
+	// Recording again is a no-op merge
+	_, err = other.RecordTransaction(ctx, "", txHex, "", WithMetadata("instance_0", "changed"))
+	require.NoError(t, err)
+	var incomingTx *IncomingTransaction
+	incomingTx, err = getIncomingTransactionByID(ctx, txID, client.DefaultModelOptions()...)
+	require.NoError(t, err)
+	assert.Equal(t, "received", incomingTx.Metadata["instance_0"])
 }
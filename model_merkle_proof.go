@@ -2,12 +2,15 @@ package bux
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"database/sql/driver"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"reflect"
 
 	"github.com/libsv/go-bc"
+	"github.com/libsv/go-bk/crypto"
 	"github.com/libsv/go-bt/v2"
 )
 
@@ -36,6 +39,38 @@ func (m MerkleProof) ToCompoundMerklePath() CompoundMerklePath {
 	return cmp
 }
 
+// merkleRoot will compute the merkle root of the block (display hex) from the proof of the transaction
+//
+// The node "*" is a duplicate of the computed hash (the last transaction of an odd level)
+func (m MerkleProof) merkleRoot(txID string) (string, error) {
+	hash, err := hex.DecodeString(txID)
+	if err != nil || len(hash) != sha256.Size {
+		return "", fmt.Errorf("%w: invalid txid %s", ErrInvalidMerkleProof, txID)
+	}
+	hash = bt.ReverseBytes(hash)
+
+	index := m.Index
+	for _, node := range m.Nodes {
+		sibling := hash
+		if node != "*" {
+			if sibling, err = hex.DecodeString(node); err != nil || len(sibling) != sha256.Size {
+				return "", fmt.Errorf("%w: invalid node %s", ErrInvalidMerkleProof, node)
+			}
+			sibling = bt.ReverseBytes(sibling)
+		}
+		if index%2 == 1 {
+			hash = crypto.Sha256d(append(append([]byte{}, sibling...), hash...))
+		} else {
+			hash = crypto.Sha256d(append(append([]byte{}, hash...), sibling...))
+		}
+		index /= 2
+	}
+	if index > 0 {
+		return "", fmt.Errorf("%w: index %d out of range for %d nodes", ErrInvalidMerkleProof, m.Index, len(m.Nodes))
+	}
+	return hex.EncodeToString(bt.ReverseBytes(hash)), nil
+}
+
 func offsetPair(offset uint64) uint64 {
 	if offset%2 == 0 {
 		return offset + 1
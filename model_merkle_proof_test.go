@@ -3,8 +3,10 @@ package bux
 import (
 	"testing"
 
+	"github.com/libsv/go-bc"
 	"github.com/libsv/go-bt/v2"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // TestMerkleProofModel_ToCompoundMerklePath will test the method ToCompoundMerklePath()
@@ -74,3 +76,46 @@ func TestMerkleProofModel_ToCompoundMerklePath(t *testing.T) {
 		assert.Nil(t, cmp)
 	})
 }
+
+// TestMerkleProofModel_merkleRoot will test the method merkleRoot()
+func TestMerkleProofModel_merkleRoot(t *testing.T) {
+	t.Parallel()
+
+	nodes := []string{
+		"b9ef07a62553ef8b0898a79c291b92c60f7932260888bde0dab2dd2610d8668e",
+		"0fc1c12fb1b57b38140442927fbadb3d1e5a5039a5d6db355ea25486374f104d",
+	}
+
+	t.Run("matches the merkle branches", func(t *testing.T) {
+		for _, index := range []uint64{0, 1, 2, 3} {
+			expected, err := bc.MerkleRootFromBranches(testTxID, int(index), nodes)
+			require.NoError(t, err)
+
+			var root string
+			root, err = MerkleProof{Index: index, Nodes: nodes}.merkleRoot(testTxID)
+			require.NoError(t, err)
+			assert.Equal(t, expected, root)
+		}
+	})
+
+	t.Run("duplicate node", func(t *testing.T) {
+		expected, err := bc.MerkleRootFromBranches(testTxID, 0, []string{testTxID})
+		require.NoError(t, err)
+
+		var root string
+		root, err = MerkleProof{Index: 0, Nodes: []string{"*"}}.merkleRoot(testTxID)
+		require.NoError(t, err)
+		assert.Equal(t, expected, root)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := MerkleProof{Index: 4, Nodes: nodes}.merkleRoot(testTxID)
+		require.ErrorIs(t, err, ErrInvalidMerkleProof)
+
+		_, err = MerkleProof{Nodes: []string{"not-hex"}}.merkleRoot(testTxID)
+		require.ErrorIs(t, err, ErrInvalidMerkleProof)
+
+		_, err = MerkleProof{Nodes: nodes}.merkleRoot("abc")
+		require.ErrorIs(t, err, ErrInvalidMerkleProof)
+	})
+}
@@ -0,0 +1,353 @@
+package bux
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/BuxOrg/bux/notifications"
+	"github.com/BuxOrg/bux/taskmanager"
+	"github.com/mrz1836/go-datastore"
+	customTypes "github.com/mrz1836/go-datastore/custom_types"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// NotificationDelivery is an object representing the delivery receipt of a notification event (webhook)
+//
+// Gorm related models & indexes: https://gorm.io/docs/models.html - https://gorm.io/docs/indexes.html
+type NotificationDelivery struct {
+	// Base model
+	Model `bson:",inline"`
+
+	// Model specific fields
+	ID             string               `json:"id" toml:"id" yaml:"id" gorm:"<-:create;type:char(26);primaryKey;comment:This is the event id (ULID)" bson:"_id"`
+	Attempts       int                  `json:"attempts" toml:"attempts" yaml:"attempts" gorm:"<-;comment:This is the number of delivery attempts" bson:"attempts"`
+	DeadLetteredAt customTypes.NullTime `json:"dead_lettered_at" toml:"dead_lettered_at" yaml:"dead_lettered_at" gorm:"<-;index;comment:When the event exhausted the retries (null = not dead-lettered)" bson:"dead_lettered_at,omitempty"`
+	DeliveredAt    customTypes.NullTime `json:"delivered_at" toml:"delivered_at" yaml:"delivered_at" gorm:"<-;comment:When the event was delivered (null = failed)" bson:"delivered_at,omitempty"`
+	Endpoint       string               `json:"endpoint" toml:"endpoint" yaml:"endpoint" gorm:"<-;type:varchar(255);comment:This is the endpoint (scheme and host)" bson:"endpoint"`
+	EventType      string               `json:"event_type" toml:"event_type" yaml:"event_type" gorm:"<-;type:varchar(64);comment:This is the type of the event" bson:"event_type"`
+	HTTPStatus     int                  `json:"http_status" toml:"http_status" yaml:"http_status" gorm:"<-;column:http_status;comment:This is the status code of the last attempt" bson:"http_status"`
+	LastError      string               `json:"last_error" toml:"last_error" yaml:"last_error" gorm:"<-;type:varchar(512);comment:This is the error of the last attempt" bson:"last_error,omitempty"`
+	ModelID        string               `json:"model_id" toml:"model_id" yaml:"model_id" gorm:"<-;type:varchar(64);index;comment:This is the id of the model of the event" bson:"model_id"`
+	ModelType      string               `json:"model_type" toml:"model_type" yaml:"model_type" gorm:"<-;type:varchar(32);comment:This is the type of the model of the event" bson:"model_type"`
+	Muted          bool                 `json:"muted" toml:"muted" yaml:"muted" gorm:"<-;comment:The event was not delivered (the notifications of the xPub were muted)" bson:"muted"`
+	Payload        string               `json:"payload,omitempty" toml:"payload" yaml:"payload" gorm:"<-;type:text;comment:This is the event (JSON) kept for the redelivery (dead-lettered or muted)" bson:"payload,omitempty"`
+	XpubIDs        IDs                  `json:"xpub_ids,omitempty" toml:"xpub_ids" yaml:"xpub_ids" gorm:"<-;type:json;comment:The muted xPubs of the event (see redeliverMutedNotifications)" bson:"xpub_ids,omitempty"`
+}
+
+// newNotificationDelivery will start a new model from the delivery receipt
+func newNotificationDelivery(receipt *notifications.DeliveryReceipt, opts ...ModelOps) *NotificationDelivery {
+	delivery := &NotificationDelivery{
+		Model:     *NewBaseModel(ModelNotificationDelivery, opts...),
+		ID:        receipt.EventID,
+		Attempts:  receipt.Attempts,
+		Endpoint:  redactURL(receipt.Endpoint),
+		EventType: string(receipt.EventType),
+		ModelID:   receipt.ModelID,
+		ModelType: receipt.ModelType,
+	}
+	delivery.HTTPStatus = receipt.HTTPStatus
+	if receipt.DeliveredAt != nil {
+		delivery.DeliveredAt = customTypes.NullTime{NullTime: sql.NullTime{Valid: true, Time: *receipt.DeliveredAt}}
+	} else if len(receipt.Payload) > 0 {
+		// Exhausted the retries: dead-lettered with the payload (see RedeliverNotification)
+		delivery.DeadLetteredAt = customTypes.NullTime{NullTime: sql.NullTime{Valid: true, Time: time.Now().UTC()}}
+		delivery.Payload = receipt.Payload
+	}
+	delivery.setLastError(receipt.Error)
+	return delivery
+}
+
+// setLastError will set the error of the last attempt (truncated)
+func (m *NotificationDelivery) setLastError(lastError string) {
+	if len(lastError) > 512 {
+		m.LastError = lastError[:512]
+	} else {
+		m.LastError = lastError
+	}
+}
+
+// getNotificationDeliveryByID will get the delivery receipt of the event (nil if not found)
+func getNotificationDeliveryByID(ctx context.Context, eventID string, opts ...ModelOps) (*NotificationDelivery, error) {
+	delivery := &NotificationDelivery{
+		Model: *NewBaseModel(ModelNotificationDelivery, opts...),
+		ID:    eventID,
+	}
+	if err := Get(ctx, delivery, nil, false, defaultDatabaseReadTimeout, false); err != nil {
+		if errors.Is(err, datastore.ErrNoResults) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return delivery, nil
+}
+
+// getDeadLetteredNotifications will get the delivery receipts of the events that exhausted the retries
+func getDeadLetteredNotifications(ctx context.Context, queryParams *datastore.QueryParams,
+	opts ...ModelOps,
+) ([]*NotificationDelivery, error) {
+	if queryParams == nil {
+		queryParams = &datastore.QueryParams{
+			OrderByField:  deadLetteredAtField,
+			SortDirection: datastore.SortAsc,
+		}
+	}
+
+	modelItems := make([]*NotificationDelivery, 0)
+	if err := getModelsByConditions(
+		ctx, ModelNotificationDelivery, &modelItems, nil,
+		&map[string]interface{}{deadLetteredAtField: map[string]interface{}{"$exists": true}}, queryParams, opts...,
+	); err != nil {
+		return nil, err
+	}
+
+	for index := range modelItems {
+		modelItems[index].enrich(ModelNotificationDelivery, opts...)
+	}
+	return modelItems, nil
+}
+
+// getDeadLetteredNotificationsCount will count the dead-lettered events
+func getDeadLetteredNotificationsCount(ctx context.Context, opts ...ModelOps) (int64, error) {
+	return getModelCountByConditions(
+		ctx, ModelNotificationDelivery, NotificationDelivery{}, nil,
+		&map[string]interface{}{deadLetteredAtField: map[string]interface{}{"$exists": true}}, opts...,
+	)
+}
+
+// redeliver will deliver the dead-lettered event again (single attempt) and save the result
+//
+// The event is no longer dead-lettered once delivered, the payload is dropped
+func (m *NotificationDelivery) redeliver(ctx context.Context, client notifications.ClientInterface) error {
+	receipt, err := client.Redeliver(ctx, []byte(m.Payload))
+	if receipt == nil {
+		return err
+	}
+
+	m.Attempts += receipt.Attempts
+	m.Endpoint = redactURL(receipt.Endpoint)
+	m.HTTPStatus = receipt.HTTPStatus
+	m.setLastError(receipt.Error)
+	if receipt.DeliveredAt != nil {
+		m.DeliveredAt = customTypes.NullTime{NullTime: sql.NullTime{Valid: true, Time: *receipt.DeliveredAt}}
+		m.DeadLetteredAt = customTypes.NullTime{}
+		m.Payload = ""
+	}
+	if saveErr := m.Save(ctx); saveErr != nil {
+		return saveErr
+	}
+	return err
+}
+
+// claimMuted will remove the muted receipt before the event is delivered (see redeliverMutedNotifications)
+//
+// Returns false if the receipt was already claimed (IE: by another node)
+func (m *NotificationDelivery) claimMuted(ctx context.Context) (bool, error) {
+	ds := m.Client().Datastore()
+	tableName := ds.GetTableName(tableNotificationDeliveries)
+	if db := gormDB(ds); db != nil {
+		tx := db.WithContext(ctx).Table(tableName).Where(map[string]interface{}{
+			idField:    m.ID,
+			mutedField: true,
+		}).Delete(&NotificationDelivery{})
+		return tx.RowsAffected == 1, tx.Error
+	}
+	result, err := ds.GetMongoCollectionByTableName(tableName).DeleteOne(
+		ctx, bson.M{"_id": m.ID, mutedField: true},
+	)
+	if err != nil {
+		return false, err
+	}
+	return result.DeletedCount == 1, nil
+}
+
+// getNotificationDeliveries will get the delivery receipts of the events about the model
+func getNotificationDeliveries(ctx context.Context, modelID string, queryParams *datastore.QueryParams,
+	opts ...ModelOps,
+) ([]*NotificationDelivery, error) {
+	if queryParams == nil {
+		queryParams = &datastore.QueryParams{
+			OrderByField:  createdAtField,
+			SortDirection: datastore.SortAsc,
+		}
+	}
+
+	modelItems := make([]*NotificationDelivery, 0)
+	if err := getModelsByConditions(
+		ctx, ModelNotificationDelivery, &modelItems, nil,
+		&map[string]interface{}{modelIDField: modelID}, queryParams, opts...,
+	); err != nil {
+		return nil, err
+	}
+
+	for index := range modelItems {
+		modelItems[index].enrich(ModelNotificationDelivery, opts...)
+	}
+	return modelItems, nil
+}
+
+// GetModelName will get the name of the current model
+func (m *NotificationDelivery) GetModelName() string {
+	return ModelNotificationDelivery.String()
+}
+
+// GetModelTableName will get the db table name of the current model
+func (m *NotificationDelivery) GetModelTableName() string {
+	return tableNotificationDeliveries
+}
+
+// Save will save the model into the Datastore
+func (m *NotificationDelivery) Save(ctx context.Context) error {
+	return Save(ctx, m)
+}
+
+// GetID will get the ID
+func (m *NotificationDelivery) GetID() string {
+	return m.ID
+}
+
+// BeforeCreating will fire before the model is being inserted into the Datastore
+func (m *NotificationDelivery) BeforeCreating(_ context.Context) error {
+	m.DebugLog("starting: " + m.Name() + " BeforeCreating hook...")
+
+	// Make sure ID is valid
+	if len(m.ID) == 0 {
+		return ErrMissingFieldID
+	}
+
+	m.DebugLog("end: " + m.Name() + " BeforeCreating hook")
+	return nil
+}
+
+// Migrate model specific migration on startup
+func (m *NotificationDelivery) Migrate(client datastore.ClientInterface) error {
+	return client.IndexMetadata(client.GetTableName(tableNotificationDeliveries), metadataField)
+}
+
+// RegisterTasks will register the model specific tasks on client initialization
+func (m *NotificationDelivery) RegisterTasks() error {
+
+	// No task manager loaded?
+	tm := m.Client().Taskmanager()
+	if tm == nil {
+		return nil
+	}
+
+	// Register the task locally (cron task - set the defaults)
+	cleanUpTask := m.Name() + "_clean_up"
+	ctx := context.Background()
+
+	// Register the task
+	if err := tm.RegisterTask(&taskmanager.Task{
+		Name:       cleanUpTask,
+		RetryLimit: 1,
+		Handler: func(client ClientInterface) error {
+			if taskErr := taskCleanupNotificationDeliveries(ctx, client.Logger(), WithClient(client)); taskErr != nil {
+				client.Logger().Error(ctx, "error running "+cleanUpTask+" task: "+taskErr.Error())
+			}
+			return nil
+		},
+	}); err != nil {
+		return err
+	}
+
+	// Run the task periodically
+	return tm.RunTask(ctx, &taskmanager.TaskOptions{
+		Arguments:      []interface{}{m.Client()},
+		RunEveryPeriod: m.Client().GetTaskPeriod(cleanUpTask),
+		TaskName:       cleanUpTask,
+	})
+}
+
+// pruneNotificationDeliveries will delete the delivery receipts created before the time (a batch of records)
+//
+// The dead-lettered events are kept (see pruneDeadLetteredNotifications). Returns the number of deleted records
+func pruneNotificationDeliveries(ctx context.Context, before time.Time, batchSize int,
+	opts ...ModelOps,
+) (int, error) {
+	return deleteNotificationDeliveries(ctx, map[string]interface{}{
+		createdAtField: map[string]interface{}{
+			"$lt": before.UTC(),
+		},
+		deadLetteredAtField: nil,
+	}, createdAtField, batchSize, opts...)
+}
+
+// pruneDeadLetteredNotifications will delete the events dead-lettered before the time (a batch of records)
+//
+// Returns the number of deleted records
+func pruneDeadLetteredNotifications(ctx context.Context, before time.Time, batchSize int,
+	opts ...ModelOps,
+) (int, error) {
+	return deleteNotificationDeliveries(ctx, map[string]interface{}{
+		deadLetteredAtField: map[string]interface{}{
+			"$lt": before.UTC(),
+		},
+	}, deadLetteredAtField, batchSize, opts...)
+}
+
+// deleteNotificationDeliveries will delete a batch of the delivery receipts matching the conditions (oldest first)
+//
+// Returns the number of deleted records
+func deleteNotificationDeliveries(ctx context.Context, conditions map[string]interface{}, orderByField string,
+	batchSize int, opts ...ModelOps,
+) (int, error) {
+
+	// Get the IDs of the records
+	var models []NotificationDelivery
+	ds := NewBaseModel(ModelNameEmpty, opts...).Client().Datastore()
+	if err := getModels(
+		ctx, ds, &models, conditions, &datastore.QueryParams{
+			Page:          1,
+			PageSize:      batchSize,
+			OrderByField:  orderByField,
+			SortDirection: datastore.SortAsc,
+		}, defaultDatabaseReadTimeout,
+	); err != nil {
+		if errors.Is(err, datastore.ErrNoResults) {
+			return 0, nil
+		}
+		return 0, err
+	} else if len(models) == 0 {
+		return 0, nil
+	}
+
+	ids := make([]string, 0, len(models))
+	for index := range models {
+		ids = append(ids, models[index].ID)
+	}
+
+	// Delete the records directly (receipts are not soft-deleted)
+	tableName := ds.GetTableName(tableNotificationDeliveries)
+	if db := gormDB(ds); db != nil {
+		if err := db.WithContext(ctx).Table(tableName).Where(idField+" IN ?", ids).
+			Delete(&NotificationDelivery{}).Error; err != nil {
+			return 0, err
+		}
+		return len(ids), nil
+	}
+	if _, err := ds.GetMongoCollectionByTableName(tableName).DeleteMany(
+		ctx, bson.M{"_id": bson.M{"$in": ids}},
+	); err != nil {
+		return 0, err
+	}
+	return len(ids), nil
+}
+
+// notificationDeliveryRecorder persists the delivery receipts of the notifications client
+type notificationDeliveryRecorder struct {
+	client ClientInterface
+}
+
+// RecordDelivery will save the delivery receipt (see notifications.ReceiptRecorder)
+func (r *notificationDeliveryRecorder) RecordDelivery(ctx context.Context,
+	receipt *notifications.DeliveryReceipt,
+) error {
+	if len(receipt.EventID) == 0 {
+		return ErrMissingFieldID
+	}
+	return newNotificationDelivery(
+		receipt, append(r.client.DefaultModelOptions(), New())...,
+	).Save(ctx)
+}
@@ -0,0 +1,254 @@
+package bux
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/BuxOrg/bux/notifications"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestClient_GetNotificationDeliveries will test the persisted delivery receipts of the webhook
+func TestClient_GetNotificationDeliveries(t *testing.T) {
+	t.Parallel()
+
+	// The webhook fails the next requests (failures)
+	var failures int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if atomic.AddInt32(&failures, -1) >= 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	ctx, client, deferMe := CreateTestSQLiteClient(t, false, true,
+		WithCustomTaskManager(&taskManagerMockBase{}),
+		WithNotifications(server.URL+"/webhook?token=secret"),
+		WithNotificationRetries(3, time.Millisecond),
+		WithNotificationInsecureEndpoints(),
+	)
+	defer deferMe()
+
+	notify := func(t *testing.T, modelID string, fail int32) (*NotificationDelivery, error) {
+		atomic.StoreInt32(&failures, fail)
+		event := &notifications.Event{EventType: notifications.EventTypeBroadcast, ID: modelID, ModelType: "sync_transaction"}
+		notifyErr := client.Notifications().NotifyEvent(ctx, event)
+
+		deliveries, err := client.GetNotificationDeliveries(ctx, modelID, nil)
+		require.NoError(t, err)
+		require.Len(t, deliveries, 1)
+		assert.Equal(t, event.EventID, deliveries[0].ID)
+		return deliveries[0], notifyErr
+	}
+
+	t.Run("success", func(t *testing.T) {
+		delivery, err := notify(t, "tx-success", 0)
+		require.NoError(t, err)
+		assert.Equal(t, 1, delivery.Attempts)
+		assert.True(t, delivery.DeliveredAt.Valid)
+		assert.Equal(t, http.StatusOK, delivery.HTTPStatus)
+		assert.Equal(t, server.URL, delivery.Endpoint) // No path or tokens
+		assert.Equal(t, string(notifications.EventTypeBroadcast), delivery.EventType)
+		assert.Equal(t, "sync_transaction", delivery.ModelType)
+		assert.Empty(t, delivery.LastError)
+	})
+
+	t.Run("retry then success", func(t *testing.T) {
+		delivery, err := notify(t, "tx-retry", 2)
+		require.NoError(t, err)
+		assert.Equal(t, 3, delivery.Attempts)
+		assert.True(t, delivery.DeliveredAt.Valid)
+		assert.Equal(t, http.StatusOK, delivery.HTTPStatus)
+	})
+
+	t.Run("permanent failure", func(t *testing.T) {
+		delivery, err := notify(t, "tx-failure", 3)
+		require.ErrorIs(t, err, notifications.ErrInvalidResponse)
+		assert.Equal(t, 3, delivery.Attempts)
+		assert.False(t, delivery.DeliveredAt.Valid)
+		assert.Equal(t, http.StatusServiceUnavailable, delivery.HTTPStatus)
+		assert.Equal(t, err.Error(), delivery.LastError)
+
+		// Dead-lettered with the payload
+		assert.True(t, delivery.DeadLetteredAt.Valid)
+		assert.Contains(t, delivery.Payload, delivery.ID)
+	})
+
+	t.Run("unknown model", func(t *testing.T) {
+		deliveries, err := client.GetNotificationDeliveries(ctx, "unknown", nil)
+		require.NoError(t, err)
+		assert.Empty(t, deliveries)
+	})
+}
+
+// TestClient_RedeliverNotification will test the dead-lettered events and their redelivery
+func TestClient_RedeliverNotification(t *testing.T) {
+	t.Parallel()
+
+	// The webhook fails while down
+	var down int32 = 1
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if atomic.LoadInt32(&down) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	ctx, client, deferMe := CreateTestSQLiteClient(t, false, true,
+		WithCustomTaskManager(&taskManagerMockBase{}),
+		WithNotifications(server.URL),
+		WithNotificationRetries(2, time.Millisecond),
+		WithNotificationInsecureEndpoints(),
+	)
+	defer deferMe()
+
+	// Exhaust the retries (the second event is delivered)
+	event := &notifications.Event{EventType: notifications.EventTypeBroadcast, ID: testTxID, ModelType: "sync_transaction"}
+	require.ErrorIs(t, client.Notifications().NotifyEvent(ctx, event), notifications.ErrInvalidResponse)
+	atomic.StoreInt32(&down, 0)
+	delivered := &notifications.Event{EventType: notifications.EventTypeBroadcast, ID: "delivered", ModelType: "sync_transaction"}
+	require.NoError(t, client.Notifications().NotifyEvent(ctx, delivered))
+	atomic.StoreInt32(&down, 1)
+
+	t.Run("dead letters", func(t *testing.T) {
+		deadLetters, err := client.GetDeadLetteredNotifications(ctx, nil)
+		require.NoError(t, err)
+		require.Len(t, deadLetters, 1)
+		assert.Equal(t, event.EventID, deadLetters[0].ID)
+		assert.Equal(t, 2, deadLetters[0].Attempts)
+
+		var health *HealthCheck
+		health, err = client.HealthCheck(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), health.DeadLetteredNotifications)
+		assert.NotNil(t, health.SyncQueues)
+	})
+
+	t.Run("receiver still down", func(t *testing.T) {
+		delivery, err := client.RedeliverNotification(ctx, event.EventID)
+		require.ErrorIs(t, err, notifications.ErrInvalidResponse)
+		require.NotNil(t, delivery)
+		assert.Equal(t, 3, delivery.Attempts)
+		assert.True(t, delivery.DeadLetteredAt.Valid)
+		assert.False(t, delivery.DeliveredAt.Valid)
+		assert.Equal(t, http.StatusBadGateway, delivery.HTTPStatus)
+	})
+
+	t.Run("receiver fixed", func(t *testing.T) {
+		atomic.StoreInt32(&down, 0)
+
+		delivery, err := client.RedeliverNotification(ctx, event.EventID)
+		require.NoError(t, err)
+		assert.Equal(t, 4, delivery.Attempts)
+		assert.True(t, delivery.DeliveredAt.Valid)
+		assert.False(t, delivery.DeadLetteredAt.Valid)
+		assert.Empty(t, delivery.Payload)
+		assert.Empty(t, delivery.LastError)
+
+		var deadLetters []*NotificationDelivery
+		deadLetters, err = client.GetDeadLetteredNotifications(ctx, nil)
+		require.NoError(t, err)
+		assert.Empty(t, deadLetters)
+
+		var health *HealthCheck
+		health, err = client.HealthCheck(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, int64(0), health.DeadLetteredNotifications)
+	})
+
+	t.Run("not dead-lettered", func(t *testing.T) {
+		_, err := client.RedeliverNotification(ctx, delivered.EventID)
+		require.ErrorIs(t, err, ErrNotificationNotDeadLettered)
+
+		_, err = client.RedeliverNotification(ctx, notifications.NewEventID())
+		require.ErrorIs(t, err, ErrMissingNotificationDelivery)
+	})
+}
+
+// Test_taskCleanupNotificationDeliveries will test the retention of the delivery receipts
+func Test_taskCleanupNotificationDeliveries(t *testing.T) {
+	t.Parallel()
+
+	newDelivery := func(ctx context.Context, t *testing.T, client ClientInterface, modelID string) {
+		recorder := &notificationDeliveryRecorder{client: client}
+		require.NoError(t, recorder.RecordDelivery(ctx, &notifications.DeliveryReceipt{
+			Attempts: 1,
+			EventID:  notifications.NewEventID(),
+			ModelID:  modelID,
+		}))
+	}
+
+	t.Run("receipts older than the retention are deleted", func(t *testing.T) {
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, true,
+			WithCustomTaskManager(&taskManagerMockBase{}),
+			WithNotificationRetention(time.Millisecond),
+		)
+		defer deferMe()
+		newDelivery(ctx, t, client, testTxID)
+		newDelivery(ctx, t, client, testTxID)
+
+		deleted, err := pruneNotificationDeliveries(ctx, time.Now().Add(-time.Hour), 10, client.DefaultModelOptions()...)
+		require.NoError(t, err)
+		assert.Equal(t, 0, deleted)
+
+		deleted, err = pruneNotificationDeliveries(ctx, time.Now(), 1, client.DefaultModelOptions()...)
+		require.NoError(t, err)
+		assert.Equal(t, 1, deleted)
+
+		time.Sleep(5 * time.Millisecond)
+		require.NoError(t, taskCleanupNotificationDeliveries(ctx, client.Logger(), WithClient(client)))
+		deliveries, err := client.GetNotificationDeliveries(ctx, testTxID, nil)
+		require.NoError(t, err)
+		assert.Empty(t, deliveries)
+	})
+
+	t.Run("dead letters have their own retention", func(t *testing.T) {
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, true,
+			WithCustomTaskManager(&taskManagerMockBase{}),
+			WithNotificationRetention(time.Millisecond),
+			WithNotificationDeadLetterRetention(time.Hour),
+		)
+		defer deferMe()
+		recorder := &notificationDeliveryRecorder{client: client}
+		require.NoError(t, recorder.RecordDelivery(ctx, &notifications.DeliveryReceipt{
+			Attempts: 3,
+			Error:    "receiver gone",
+			EventID:  notifications.NewEventID(),
+			ModelID:  testTxID,
+			Payload:  `{"event_id":"test"}`,
+		}))
+
+		time.Sleep(5 * time.Millisecond)
+		require.NoError(t, taskCleanupNotificationDeliveries(ctx, client.Logger(), WithClient(client)))
+		deliveries, err := client.GetDeadLetteredNotifications(ctx, nil)
+		require.NoError(t, err)
+		require.Len(t, deliveries, 1)
+
+		deleted, err := pruneDeadLetteredNotifications(ctx, time.Now().Add(time.Second), 10, client.DefaultModelOptions()...)
+		require.NoError(t, err)
+		assert.Equal(t, 1, deleted)
+	})
+
+	t.Run("no retention keeps the receipts", func(t *testing.T) {
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, true,
+			WithCustomTaskManager(&taskManagerMockBase{}),
+			WithNotificationRetention(0),
+		)
+		defer deferMe()
+		newDelivery(ctx, t, client, testTxID)
+
+		require.NoError(t, taskCleanupNotificationDeliveries(ctx, client.Logger(), WithClient(client)))
+		deliveries, err := client.GetNotificationDeliveries(ctx, testTxID, nil)
+		require.NoError(t, err)
+		assert.Len(t, deliveries, 1)
+	})
+}
@@ -40,9 +40,12 @@ func WithEncryptionKey(encryptionKey string) ModelOps {
 	}
 }
 
-// WithMetadata will add the metadata record to the model
+// WithMetadata will add the metadata record to the model (the reserved fiat keys are ignored)
 func WithMetadata(key string, value interface{}) ModelOps {
 	return func(m *Model) {
+		if isFiatMetadataKey(key) {
+			return
+		}
 		if m.Metadata == nil {
 			m.Metadata = make(Metadata)
 		}
@@ -50,7 +53,7 @@ func WithMetadata(key string, value interface{}) ModelOps {
 	}
 }
 
-// WithMetadatas will add multiple metadata records to the model
+// WithMetadatas will add multiple metadata records to the model (the reserved fiat keys are ignored)
 func WithMetadatas(metadata map[string]interface{}) ModelOps {
 	return func(m *Model) {
 		if len(metadata) > 0 {
@@ -58,20 +61,80 @@ func WithMetadatas(metadata map[string]interface{}) ModelOps {
 				m.Metadata = make(Metadata)
 			}
 			for key, value := range metadata {
-				m.Metadata[key] = value
+				if !isFiatMetadataKey(key) {
+					m.Metadata[key] = value
+				}
 			}
 		}
 	}
 }
 
-// WithMetadataFromJSON will add the metadata record to the model
+// WithMetadataFromJSON will add the metadata record to the model (the reserved fiat keys are ignored)
 func WithMetadataFromJSON(jsonData []byte) ModelOps {
 	return func(m *Model) {
 		if len(jsonData) > 0 {
 			if m.Metadata == nil {
 				m.Metadata = make(Metadata)
 			}
-			_ = json.Unmarshal(jsonData, &m.Metadata)
+			metadata := make(Metadata)
+			_ = json.Unmarshal(jsonData, &metadata)
+			for key, value := range metadata {
+				if !isFiatMetadataKey(key) {
+					m.Metadata[key] = value
+				}
+			}
+		}
+	}
+}
+
+// WithoutNotifications will suppress the notifications (events) for the model and any child models
+// saved in the same operation (IE: bulk imports, backfills)
+func WithoutNotifications() ModelOps {
+	return func(m *Model) {
+		m.skipNotify = true
+	}
+}
+
+// SkipCache will read the model from the datastore (the cache is bypassed, then refreshed with the record)
+func SkipCache() ModelOps {
+	return func(m *Model) {
+		m.skipCache = true
+	}
+}
+
+// WithSyncConfig will override the sync config of the sync transactions created for the model
+// (IE: broadcast the transactions recorded by RecordTransactions)
+func WithSyncConfig(config *SyncConfig) ModelOps {
+	return func(m *Model) {
+		if config != nil {
+			m.syncConfig = config
+		}
+	}
+}
+
+// WithP2PTargets will set the P2P notification targets of a transaction recorded without a draft (IE: RecordTransaction)
+//
+// The targets are resolved out-of-band (receive endpoints, reference IDs and the resolved outputs), they are notified
+// like the P2P outputs of a draft. The transaction must pay the resolved outputs of every target (ErrP2PTargetNotPaid)
+func WithP2PTargets(targets ...*PaymailP4) ModelOps {
+	return func(m *Model) {
+		for _, target := range targets {
+			if target != nil {
+				m.p2pTargets = append(m.p2pTargets, target)
+			}
+		}
+	}
+}
+
+// WithExternalInputs will set the values of the external inputs (not utxos of bux) of a recorded transaction
+//
+// The fee of a transaction is only known if the values of all the inputs are known
+func WithExternalInputs(inputs ...*ExternalInput) ModelOps {
+	return func(m *Model) {
+		for _, input := range inputs {
+			if input != nil {
+				m.externalInputs = append(m.externalInputs, input)
+			}
 		}
 	}
 }
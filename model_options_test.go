@@ -111,3 +111,24 @@ func TestWithMetadatas(t *testing.T) {
 		assert.Equal(t, "value", m.Metadata["key"])
 	})
 }
+
+// TestWithoutNotifications will test the method WithoutNotifications()
+func TestWithoutNotifications(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Get opts", func(t *testing.T) {
+		opt := WithoutNotifications()
+		assert.IsType(t, *new(ModelOps), opt)
+	})
+
+	t.Run("apply opts", func(t *testing.T) {
+		m := new(Model)
+		m.SetOptions(WithoutNotifications())
+		assert.Equal(t, true, m.isNotifySkipped())
+
+		// Propagates to child models
+		child := new(Model)
+		child.SetOptions(m.GetOptions(true)...)
+		assert.Equal(t, true, child.isNotifySkipped())
+	})
+}
@@ -3,12 +3,16 @@ package bux
 import (
 	"context"
 	"errors"
+	"time"
 
+	"github.com/BuxOrg/bux/taskmanager"
 	"github.com/BuxOrg/bux/utils"
 	"github.com/bitcoin-sv/go-paymail"
 	"github.com/bitcoinschema/go-bitcoin/v2"
 	"github.com/libsv/go-bk/bip32"
+	"github.com/libsv/go-bt/v2/bscript"
 	"github.com/mrz1836/go-datastore"
+	customTypes "github.com/mrz1836/go-datastore/custom_types"
 )
 
 // PaymailAddress is an "external model example" - this model is not part of the standard models loaded and runtime
@@ -29,6 +33,10 @@ type PaymailAddress struct {
 	Avatar          string `json:"avatar" toml:"avatar" yaml:"avatar" gorm:"<-;type:text;comment:This is avatar url" bson:"avatar"`                                                                                                       // This is the url of the user (public profile)
 	ExternalXpubKey string `json:"external_xpub_key" toml:"external_xpub_key" yaml:"external_xpub_key" gorm:"<-:create;type:varchar(512);index;comment:This is full xPub for external use, encryption optional" bson:"external_xpub_key"` // PublicKey hex encoded
 
+	// Activation (see WithPaymailActivation)
+	ActivationChallenge string               `json:"activation_challenge,omitempty" toml:"activation_challenge" yaml:"activation_challenge" gorm:"<-;type:varchar(64);comment:This is the challenge signed to activate the paymail" bson:"activation_challenge,omitempty"` // Pending until the challenge is signed
+	ActivationExpiresAt customTypes.NullTime `json:"activation_expires_at,omitempty" toml:"activation_expires_at" yaml:"activation_expires_at" gorm:"<-;index;comment:When the pending paymail expires" bson:"activation_expires_at,omitempty"`                            // Pending paymails are deleted after
+
 	// Private fields
 	externalXpubKeyDecrypted string
 }
@@ -38,13 +46,12 @@ func newPaymail(paymailAddress string, opts ...ModelOps) *PaymailAddress {
 
 	// Standardize and sanitize!
 	alias, domain, _ := paymail.SanitizePaymail(paymailAddress)
-	id, _ := utils.RandomHex(32)
 	p := &PaymailAddress{
 		Alias:  alias,
 		Domain: domain,
-		ID:     id,
 		Model:  *NewBaseModel(ModelPaymailAddress, opts...),
 	}
+	p.ID = p.newModelID()
 
 	// Set the xPub information if found
 	if len(p.rawXpubKey) > 0 {
@@ -148,6 +155,56 @@ func (m *PaymailAddress) setXPub() error {
 	return err
 }
 
+// IsPending will return true if the paymail was not activated yet (see ActivatePaymailAddress)
+//
+// Pending paymails are not served (capabilities, PKI, resolution)
+func (m *PaymailAddress) IsPending() bool {
+	return len(m.ActivationChallenge) > 0
+}
+
+// verifyActivation will verify the signature of the activation challenge by the identity key
+func (m *PaymailAddress) verifyActivation(signature string) error {
+	if len(signature) == 0 {
+		return ErrMissingSignature
+	}
+
+	identityKey, err := m.GetIdentityXpub()
+	if err != nil {
+		return err
+	}
+
+	var address *bscript.Address
+	if address, err = bitcoin.GetAddressFromHDKey(identityKey); err != nil {
+		return err
+	}
+
+	if err = bitcoin.VerifyMessage(
+		address.AddressString, signature, m.ActivationChallenge,
+	); err != nil {
+		return ErrPaymailActivationSignatureInvalid
+	}
+	return nil
+}
+
+// softDelete will mark the paymail as deleted (the record is kept for the history)
+func (m *PaymailAddress) softDelete() error {
+
+	// todo: make a better approach for deleting paymail addresses?
+	randomString, err := utils.RandomHex(16)
+	if err != nil {
+		return err
+	}
+
+	// We will do a soft delete to make sure we still have the history for this address
+	// setting the Domain to a random string solved the problem of the unique index on Alias/Domain
+	// todo: figure out a different approach - history table?
+	m.Alias = m.Alias + "@" + m.Domain
+	m.Domain = randomString
+	m.DeletedAt.Valid = true
+	m.DeletedAt.Time = time.Now()
+	return nil
+}
+
 // GetIdentityXpub will get the identity related to the xPub
 func (m *PaymailAddress) GetIdentityXpub() (*bip32.ExtendedKey, error) {
 
@@ -246,6 +303,85 @@ func (m *PaymailAddress) AfterCreated(_ context.Context) error {
 	return nil
 }
 
+// DisplayFor filter the model for display without the fields hidden from the profile (see RegisterDisplayMask)
+func (m *PaymailAddress) DisplayFor(profile string) interface{} {
+	return displayFor(ModelPaymailAddress, m, profile)
+}
+
+// RegisterTasks will register the model specific tasks on client initialization
+func (m *PaymailAddress) RegisterTasks() error {
+
+	// No task manager loaded?
+	tm := m.Client().Taskmanager()
+	if tm == nil {
+		return nil
+	}
+
+	// Register the task locally (cron task - set the defaults)
+	cleanUpTask := m.Name() + "_clean_up"
+	ctx := context.Background()
+
+	// Register the task
+	if err := tm.RegisterTask(&taskmanager.Task{
+		Name:       cleanUpTask,
+		RetryLimit: 1,
+		Handler: func(client ClientInterface) error {
+			if taskErr := taskCleanupPendingPaymails(ctx, client.Logger(), WithClient(client)); taskErr != nil {
+				client.Logger().Error(ctx, "error running "+cleanUpTask+" task: "+taskErr.Error())
+			}
+			return nil
+		},
+	}); err != nil {
+		return err
+	}
+
+	// Run the task periodically
+	return tm.RunTask(ctx, &taskmanager.TaskOptions{
+		Arguments:      []interface{}{m.Client()},
+		RunEveryPeriod: m.Client().GetTaskPeriod(cleanUpTask),
+		TaskName:       cleanUpTask,
+	})
+}
+
+// expirePendingPaymails will delete the pending paymail addresses past the activation window
+func expirePendingPaymails(ctx context.Context, opts ...ModelOps) error {
+	var models []PaymailAddress
+	conditions := map[string]interface{}{
+		activationExpiresAtField: map[string]interface{}{
+			"$lt": time.Now().UTC(),
+		},
+	}
+
+	// Get the records
+	if err := getModels(
+		ctx, NewBaseModel(ModelNameEmpty, opts...).Client().Datastore(),
+		&models, conditions, nil, defaultDatabaseReadTimeout,
+	); err != nil {
+		if errors.Is(err, datastore.ErrNoResults) {
+			return nil
+		}
+		return err
+	}
+
+	// Loop and delete (the alias is released)
+	for index := range models {
+		paymailAddress := &models[index]
+		if !paymailAddress.IsPending() {
+			continue
+		}
+		paymailAddress.enrich(ModelPaymailAddress, opts...)
+		if err := paymailAddress.softDelete(); err != nil {
+			return err
+		}
+		paymailAddress.ActivationExpiresAt.Valid = false
+		if err := paymailAddress.Save(ctx); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 // Migrate model specific migration on startup
 func (m *PaymailAddress) Migrate(client datastore.ClientInterface) error {
 
@@ -3,10 +3,11 @@ package bux
 import (
 	"context"
 	"fmt"
-	"time"
 
 	"github.com/mrz1836/go-datastore"
 	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"gorm.io/gorm"
 )
 
 // Save will save the model(s) into the Datastore
@@ -23,6 +24,17 @@ func Save(ctx context.Context, model ModelInterface) (err error) {
 	if ds == nil {
 		return ErrDatastoreRequired
 	}
+
+	// Suppressed notifications also apply to the child models
+	if isNotifySkipped(ctx, model) {
+		ctx = WithoutNotificationsContext(ctx)
+	}
+
+	// Check the metadata limits (before the version of the record is claimed)
+	if err = checkModelMetadata(ctx, model); err != nil {
+		return err
+	}
+
 	// Create new Datastore transaction
 	// @siggi: we need this to be in a callback context for Mongo
 	// NOTE: a DB error is not being returned from here
@@ -48,6 +60,9 @@ func Save(ctx context.Context, model ModelInterface) (err error) {
 		// Add any child models (fire before hooks)
 		if children := model.ChildModels(); len(children) > 0 {
 			for _, child := range children {
+				if err = checkModelMetadata(ctx, child); err != nil {
+					return
+				}
 				if child.IsNew() {
 					if err = child.BeforeCreating(ctx); err != nil {
 						return
@@ -70,11 +85,29 @@ func Save(ctx context.Context, model ModelInterface) (err error) {
 		model.DebugLog(fmt.Sprintf("saving %d models...", len(modelsToSave)))
 
 		// Save all models (or fail!)
+		var prepared int
+		var saved bool
+		defer func() {
+			for index := 0; index < prepared; index++ {
+				if err != nil && !saved { // Nothing was saved, keep the loaded versions
+					restoreModelVersion(ctx, modelsToSave[index])
+				} else if versioned, ok := modelsToSave[index].(versionedModel); ok {
+					versioned.setVersionClaim(false)
+				}
+			}
+		}()
 		for index := range modelsToSave {
+			prepared++
+			if err = prepareModelVersion(ctx, modelsToSave[index]); err != nil {
+				return
+			}
 			modelsToSave[index].DebugLog("starting to save model: " + modelsToSave[index].Name() + " id: " + modelsToSave[index].GetID())
 			if err = modelsToSave[index].Client().Datastore().SaveModel(
 				ctx, modelsToSave[index], tx, modelsToSave[index].IsNew(), false,
 			); err != nil {
+				if duplicate, ok := modelsToSave[index].(duplicateReporter); ok && isUniqueConstraintError(err) {
+					err = duplicate.duplicateError(err)
+				}
 				return
 			}
 		}
@@ -86,6 +119,7 @@ func Save(ctx context.Context, model ModelInterface) (err error) {
 				return
 			}
 		}
+		saved = true
 
 		// Fire after hooks (only on commit success)
 		var afterErr error
@@ -112,10 +146,19 @@ func Save(ctx context.Context, model ModelInterface) (err error) {
 
 // saveToCache will save the model to the cache using the given key(s)
 //
-// ttl of 0 will cache forever
-func saveToCache(ctx context.Context, keys []string, model ModelInterface, ttl time.Duration) error { //nolint:nolintlint,unparam // this does not matter
+// The TTL is the cache TTL of the model (without expiration by default), nothing is saved if the model
+// is not cached (see WithModelCacheTTL)
+func saveToCache(ctx context.Context, keys []string, model ModelInterface) error {
 	// NOTE: this check is in place in-case a model does not load its parent Client()
 	if model.Client() != nil {
+		cache, ok := model.Client().(modelCacheClient)
+		if !ok {
+			return nil
+		}
+		ttl, cached := cache.modelCacheTTL(model.GetModelName())
+		if !cached {
+			return nil
+		}
 		for _, key := range keys {
 			if err := model.Client().Cachestore().SetModel(ctx, key, model, ttl); err != nil {
 				return err
@@ -126,3 +169,198 @@ func saveToCache(ctx context.Context, keys []string, model ModelInterface, ttl t
 	}
 	return nil
 }
+
+// deleteFromCache will delete the given key(s) from the cache (IE: evict an updated model)
+func deleteFromCache(ctx context.Context, client ClientInterface, keys []string) error {
+	if client == nil || client.Cachestore() == nil {
+		return nil
+	}
+	for _, key := range keys {
+		if err := client.Cachestore().Delete(ctx, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// versionedModel is a model using optimistic concurrency (conditional update on the version)
+type versionedModel interface {
+	getVersion() int64
+	isVersioned() bool
+	setVersion(version int64)
+	setVersionClaim(claim bool)
+	versionClaimed() bool
+}
+
+// incrementModelVersion will increment the version of the record (every save)
+func incrementModelVersion(model ModelInterface) {
+	if m, ok := model.(interface {
+		getVersion() int64
+		setVersion(version int64)
+	}); ok {
+		m.setVersion(m.getVersion() + 1)
+	}
+}
+
+// prepareModelVersion will increment the version of the record before it is saved
+//
+// The stored version of an existing (versioned) record is claimed in the same datastore transaction as the save:
+// by the gorm update callback for SQL (see claimModelVersion) or right away for MongoDB (released if the save
+// fails, see restoreModelVersion)
+func prepareModelVersion(ctx context.Context, model ModelInterface) error {
+	incrementModelVersion(model)
+	versioned, ok := model.(versionedModel)
+	if !ok || !versioned.isVersioned() || model.IsNew() {
+		return nil
+	}
+	if model.Client().Datastore().Engine() == datastore.MongoDB {
+		if err := claimMongoModelVersion(ctx, model, versioned); err != nil {
+			return err
+		}
+	}
+	versioned.setVersionClaim(true)
+	return nil
+}
+
+// registerVersionCallback will register the gorm update callback claiming the stored version of the saved records
+//
+// The datastore skips the gorm model hooks, the callback runs in the transaction of the save (see claimModelVersion)
+func registerVersionCallback(ds datastore.ClientInterface) error {
+	db := gormDB(ds)
+	if db == nil || db.Callback().Update().Get(versionCallbackName) != nil {
+		return nil
+	}
+	return db.Callback().Update().Before("gorm:update").Register(versionCallbackName, func(tx *gorm.DB) {
+		if model, ok := tx.Statement.Dest.(ModelInterface); ok && tx.Error == nil {
+			_ = tx.AddError(claimModelVersion(tx.Session(&gorm.Session{NewDB: true}), model))
+		}
+	})
+}
+
+// restoreModelVersion will restore the loaded version of a record that was not saved
+//
+// The version claimed in MongoDB (outside the datastore transaction) is released, the record can be saved again
+func restoreModelVersion(ctx context.Context, model ModelInterface) {
+	if versioned, ok := model.(versionedModel); ok && versioned.versionClaimed() {
+		versioned.setVersionClaim(false)
+		if model.Client().Datastore().Engine() == datastore.MongoDB {
+			if err := releaseMongoModelVersion(model, versioned); err != nil {
+				model.Client().Logger().Error(ctx, "error releasing the version of "+model.Name()+
+					" "+model.GetID()+": "+err.Error())
+			}
+		}
+	}
+	if m, ok := model.(interface {
+		getVersion() int64
+		setVersion(version int64)
+	}); ok {
+		m.setVersion(m.getVersion() - 1)
+	}
+}
+
+// claimModelVersion will move the stored version of an existing (versioned) record to the version being saved
+//
+// Runs in the gorm update callback (the transaction of the save), nothing is claimed for other updates.
+// Returns ErrStaleModel if the record was saved by another process since it was loaded (version does not match)
+func claimModelVersion(tx *gorm.DB, model ModelInterface) error {
+	versioned, ok := model.(versionedModel)
+	if !ok || !versioned.versionClaimed() {
+		return nil
+	}
+	versioned.setVersionClaim(false)
+
+	ds := model.Client().Datastore()
+	tableName := ds.GetTableName(model.GetModelTableName())
+	version := versioned.getVersion()
+
+	query := tx.Table(tableName).Where(idField+" = ?", model.GetID())
+	if version == 1 { // Records created before the version field
+		query = query.Where(tx.Where(versionField+" = ?", 0).Or(versionField + " IS NULL"))
+	} else {
+		query = query.Where(versionField+" = ?", version-1)
+	}
+	result := query.UpdateColumn(versionField, version)
+	if result.Error != nil {
+		return result.Error
+	} else if result.RowsAffected > 0 {
+		return nil
+	}
+
+	// Nothing updated: the record is stale (or does not exist yet, which is saved as usual)
+	var count int64
+	if err := tx.Table(tableName).Where(idField+" = ?", model.GetID()).Count(&count).Error; err != nil {
+		return err
+	} else if count > 0 {
+		return ErrStaleModel
+	}
+	return nil
+}
+
+// claimMongoModelVersion will atomically move the stored version of an existing (versioned) record
+// to the version being saved (MongoDB does not use the datastore transaction)
+//
+// Returns ErrStaleModel if the record was saved by another process since it was loaded (version does not match)
+func claimMongoModelVersion(ctx context.Context, model ModelInterface, versioned versionedModel) error {
+	ds := model.Client().Datastore()
+	version := versioned.getVersion()
+
+	filter := bson.M{"_id": model.GetID(), versionField: version - 1}
+	if version == 1 { // Records created before the version field
+		filter[versionField] = bson.M{"$in": bson.A{0, nil}}
+	}
+	result, err := ds.GetMongoCollectionByTableName(ds.GetTableName(model.GetModelTableName())).UpdateOne(
+		ctx, filter, bson.M{"$set": bson.M{versionField: version}},
+	)
+	if err != nil {
+		return err
+	} else if result.MatchedCount > 0 {
+		return nil
+	}
+
+	// Nothing updated: the record is stale (or does not exist yet, which is saved as usual)
+	count, err := getModelCount(
+		ctx, ds, model, map[string]interface{}{idField: model.GetID()}, defaultDatabaseReadTimeout,
+	)
+	if err != nil && !errors.Is(err, datastore.ErrNoResults) {
+		return err
+	} else if count > 0 {
+		return ErrStaleModel
+	}
+	return nil
+}
+
+// releaseMongoModelVersion will move the stored version of a record claimed by claimMongoModelVersion back
+// to the loaded version (only if it was not saved by another process in the meantime)
+//
+// The context is not used, the save could be canceled, but the release should never be stopped
+func releaseMongoModelVersion(model ModelInterface, versioned versionedModel) error {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultDatabaseReadTimeout)
+	defer cancel()
+
+	ds := model.Client().Datastore()
+	version := versioned.getVersion()
+	_, err := ds.GetMongoCollectionByTableName(ds.GetTableName(model.GetModelTableName())).UpdateOne(
+		ctx, bson.M{"_id": model.GetID(), versionField: version}, bson.M{"$set": bson.M{versionField: version - 1}},
+	)
+	return err
+}
+
+// saveWithReload will apply the changes and save the (versioned) model
+//
+// If the model is stale, the model is reloaded and the changes are re-applied (up to defaultStaleModelRetries)
+func saveWithReload[T ModelInterface](ctx context.Context, model T,
+	reload func(ctx context.Context) (T, error), apply func(model T),
+) (T, error) {
+	apply(model)
+	err := model.Save(ctx)
+	for attempt := 0; errors.Is(err, ErrStaleModel) && attempt < defaultStaleModelRetries; attempt++ {
+		var reloaded T
+		if reloaded, err = reload(ctx); err != nil {
+			return model, err
+		}
+		model = reloaded
+		apply(model)
+		err = model.Save(ctx)
+	}
+	return model, err
+}
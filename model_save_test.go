@@ -1,2 +1,142 @@
 package bux
 
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestSave_versioning will test the optimistic concurrency of Save()
+func TestSave_versioning(t *testing.T) {
+	t.Parallel()
+
+	t.Run("version is incremented on every save", func(t *testing.T) {
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, true, WithCustomTaskManager(&taskManagerMockBase{}))
+		defer deferMe()
+
+		syncTx := newSyncTransaction(testTxID, &SyncConfig{Broadcast: true}, append(client.DefaultModelOptions(), New())...)
+		require.NoError(t, syncTx.Save(ctx))
+		assert.Equal(t, int64(1), syncTx.Version)
+
+		syncTx.BroadcastStatus = SyncStatusSkipped
+		require.NoError(t, syncTx.Save(ctx))
+		assert.Equal(t, int64(2), syncTx.Version)
+
+		got, err := GetSyncTransactionByID(ctx, testTxID, client.DefaultModelOptions()...)
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), got.Version)
+	})
+
+	t.Run("stale versioned model", func(t *testing.T) {
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, true, WithCustomTaskManager(&taskManagerMockBase{}))
+		defer deferMe()
+
+		syncTx := newSyncTransaction(testTxID, &SyncConfig{Broadcast: true}, append(client.DefaultModelOptions(), New())...)
+		require.NoError(t, syncTx.Save(ctx))
+
+		first, err := GetSyncTransactionByID(ctx, testTxID, client.DefaultModelOptions()...)
+		require.NoError(t, err)
+		var second *SyncTransaction
+		second, err = GetSyncTransactionByID(ctx, testTxID, client.DefaultModelOptions()...)
+		require.NoError(t, err)
+
+		first.BroadcastStatus = SyncStatusComplete
+		require.NoError(t, first.Save(ctx))
+
+		second.SyncStatus = SyncStatusComplete
+		err = second.Save(ctx)
+		assert.ErrorIs(t, err, ErrStaleModel)
+
+		// The first save was not overwritten
+		var got *SyncTransaction
+		got, err = GetSyncTransactionByID(ctx, testTxID, client.DefaultModelOptions()...)
+		require.NoError(t, err)
+		assert.Equal(t, SyncStatusComplete, got.BroadcastStatus)
+		assert.Equal(t, int64(2), got.Version)
+	})
+
+	t.Run("stale model stays stale on retry", func(t *testing.T) {
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, true, WithCustomTaskManager(&taskManagerMockBase{}))
+		defer deferMe()
+
+		syncTx := newSyncTransaction(testTxID, &SyncConfig{Broadcast: true}, append(client.DefaultModelOptions(), New())...)
+		require.NoError(t, syncTx.Save(ctx))
+
+		first, err := GetSyncTransactionByID(ctx, testTxID, client.DefaultModelOptions()...)
+		require.NoError(t, err)
+		var second *SyncTransaction
+		second, err = GetSyncTransactionByID(ctx, testTxID, client.DefaultModelOptions()...)
+		require.NoError(t, err)
+
+		first.BroadcastStatus = SyncStatusComplete
+		require.NoError(t, first.Save(ctx))
+
+		// The version of the stale model is not moved by the failed saves
+		second.SyncStatus = SyncStatusComplete
+		require.ErrorIs(t, second.Save(ctx), ErrStaleModel)
+		assert.Equal(t, int64(1), second.Version)
+		require.ErrorIs(t, second.Save(ctx), ErrStaleModel)
+
+		var got *SyncTransaction
+		got, err = GetSyncTransactionByID(ctx, testTxID, client.DefaultModelOptions()...)
+		require.NoError(t, err)
+		assert.Equal(t, syncTx.SyncStatus, got.SyncStatus)
+		assert.Equal(t, int64(2), got.Version)
+	})
+
+	t.Run("stale model is reloaded and the changes are re-applied", func(t *testing.T) {
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, true, WithCustomTaskManager(&taskManagerMockBase{}))
+		defer deferMe()
+
+		syncTx := newSyncTransaction(testTxID, &SyncConfig{Broadcast: true}, append(client.DefaultModelOptions(), New())...)
+		require.NoError(t, syncTx.Save(ctx))
+
+		first, err := GetSyncTransactionByID(ctx, testTxID, client.DefaultModelOptions()...)
+		require.NoError(t, err)
+		var second *SyncTransaction
+		second, err = GetSyncTransactionByID(ctx, testTxID, client.DefaultModelOptions()...)
+		require.NoError(t, err)
+
+		first.BroadcastStatus = SyncStatusComplete
+		require.NoError(t, first.Save(ctx))
+
+		second, err = saveWithReload(ctx, second,
+			func(ctx context.Context) (*SyncTransaction, error) {
+				return GetSyncTransactionByID(ctx, testTxID, client.DefaultModelOptions()...)
+			},
+			func(syncTx *SyncTransaction) {
+				syncTx.SyncStatus = SyncStatusComplete
+			},
+		)
+		require.NoError(t, err)
+		assert.Equal(t, int64(3), second.Version)
+
+		// Both changes are saved
+		var got *SyncTransaction
+		got, err = GetSyncTransactionByID(ctx, testTxID, client.DefaultModelOptions()...)
+		require.NoError(t, err)
+		assert.Equal(t, SyncStatusComplete, got.BroadcastStatus)
+		assert.Equal(t, SyncStatusComplete, got.SyncStatus)
+	})
+
+	t.Run("non-versioned model is last write wins", func(t *testing.T) {
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, true, WithCustomTaskManager(&taskManagerMockBase{}))
+		defer deferMe()
+
+		xPub := newXpub(testXPub, append(client.DefaultModelOptions(), New())...)
+		require.NoError(t, xPub.Save(ctx))
+		assert.Equal(t, int64(1), xPub.Version)
+
+		first, err := getXpubByID(ctx, testXPubID, client.DefaultModelOptions()...)
+		require.NoError(t, err)
+		var second *Xpub
+		second, err = getXpubByID(ctx, testXPubID, client.DefaultModelOptions()...)
+		require.NoError(t, err)
+
+		require.NoError(t, first.Save(ctx))
+		require.NoError(t, second.Save(ctx))
+		assert.Equal(t, int64(2), second.Version)
+	})
+}
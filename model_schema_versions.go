@@ -0,0 +1,352 @@
+package bux
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/BuxOrg/bux/utils"
+	"github.com/mrz1836/go-datastore"
+)
+
+// Schema revisions of the models understood by this version
+//
+// Bump the revision of a model with every migration changing its schema (new columns, indexes, etc.), the older
+// versions running side by side (rolling upgrade) detect the newer schema on startup (see WithSchemaCheck)
+const (
+	schemaRevisionAccessKey            uint32 = 2 // Bux version of the records
+	schemaRevisionAuditLog             uint32 = 2 // Bux version of the records
+	schemaRevisionBalanceCheckpoint    uint32 = 2 // Bux version of the records
+	schemaRevisionBalanceEvent         uint32 = 3 // Bux version of the records
+	schemaRevisionBlockHeader          uint32 = 2 // Bux version of the records
+	schemaRevisionBroadcastReceipt     uint32 = 2 // Bux version of the records
+	schemaRevisionDestination          uint32 = 2 // Bux version of the records
+	schemaRevisionDraftTransaction     uint32 = 2 // Bux version of the records
+	schemaRevisionIncomingTransaction  uint32 = 2 // Bux version of the records
+	schemaRevisionNotificationDelivery uint32 = 4 // Bux version of the records
+	schemaRevisionPaymailAddress       uint32 = 3 // Bux version of the records
+	schemaRevisionSchemaVersion        uint32 = 2 // Bux version of the records
+	schemaRevisionSetting              uint32 = 2 // Bux version of the records
+	schemaRevisionSyncTransaction      uint32 = 3 // Bux version of the records
+	schemaRevisionTransaction          uint32 = 2 // Bux version of the records
+	schemaRevisionTransactionNote      uint32 = 2 // Bux version of the records
+	schemaRevisionUtxo                 uint32 = 2 // Bux version of the records
+	schemaRevisionXpub                 uint32 = 4 // Bux version of the records
+)
+
+// schemaRevisions are the schema revisions of the models by model name (custom models are not versioned)
+var schemaRevisions = map[ModelName]uint32{
+	ModelAccessKey:            schemaRevisionAccessKey,
+	ModelAuditLog:             schemaRevisionAuditLog,
+	ModelBalanceCheckpoint:    schemaRevisionBalanceCheckpoint,
+	ModelBalanceEvent:         schemaRevisionBalanceEvent,
+	ModelBlockHeader:          schemaRevisionBlockHeader,
+	ModelBroadcastReceipt:     schemaRevisionBroadcastReceipt,
+	ModelDestination:          schemaRevisionDestination,
+	ModelDraftTransaction:     schemaRevisionDraftTransaction,
+	ModelIncomingTransaction:  schemaRevisionIncomingTransaction,
+	ModelNotificationDelivery: schemaRevisionNotificationDelivery,
+	ModelPaymailAddress:       schemaRevisionPaymailAddress,
+	ModelSchemaVersion:        schemaRevisionSchemaVersion,
+	ModelSetting:              schemaRevisionSetting,
+	ModelSyncTransaction:      schemaRevisionSyncTransaction,
+	ModelTransaction:          schemaRevisionTransaction,
+	ModelTransactionNote:      schemaRevisionTransactionNote,
+	ModelUtxo:                 schemaRevisionUtxo,
+	ModelXPub:                 schemaRevisionXpub,
+}
+
+// SchemaCheckMode is what happens on startup when the schema of the database is newer than this version understands
+type SchemaCheckMode string
+
+// Modes of the schema check
+const (
+	// SchemaCheckStrict refuses to start (ErrSchemaNewerThanBinary)
+	SchemaCheckStrict SchemaCheckMode = "strict"
+
+	// SchemaCheckWarn logs a warning and starts
+	SchemaCheckWarn SchemaCheckMode = "warn"
+)
+
+// SchemaState is the state of the schema of a model in the database compared to this version
+type SchemaState string
+
+// States of the schema of a model
+const (
+	// SchemaStateCurrent is when the database has the revision of this version
+	SchemaStateCurrent SchemaState = "current"
+
+	// SchemaStateNewer is when the database was migrated by a newer version
+	SchemaStateNewer SchemaState = "newer"
+
+	// SchemaStateOutdated is when the database has an older revision (the model is not migrated by this version)
+	SchemaStateOutdated SchemaState = "outdated"
+
+	// SchemaStateUnknown is when the revision of the model is not recorded (IE: migrated before the registry)
+	SchemaStateUnknown SchemaState = "unknown"
+)
+
+// SchemaVersion is an object representing the schema revision of a model in the database (maintained by the migrations)
+//
+// Gorm related models & indexes: https://gorm.io/docs/models.html - https://gorm.io/docs/indexes.html
+type SchemaVersion struct {
+	// Base model
+	Model `bson:",inline"`
+
+	// Model specific fields
+	ID             string `json:"id" toml:"id" yaml:"id" gorm:"<-:create;type:varchar(64);primaryKey;comment:This is the name of the model" bson:"_id"`
+	PackageVersion string `json:"package_version" toml:"package_version" yaml:"package_version" gorm:"<-;type:varchar(32);comment:This is the bux version that migrated the model" bson:"package_version"`
+	Revision       uint32 `json:"revision" toml:"revision" yaml:"revision" gorm:"<-;type:int;comment:This is the schema revision of the model" bson:"revision"`
+}
+
+// ModelSchemaStatus is the schema revision of a model in the database compared to the revision of this version
+type ModelSchemaStatus struct {
+	CurrentRevision  uint32      `json:"current_revision" toml:"current_revision" yaml:"current_revision"`    // Revision in the database (0 if not recorded)
+	ExpectedRevision uint32      `json:"expected_revision" toml:"expected_revision" yaml:"expected_revision"` // Revision understood by this version
+	ModelName        string      `json:"model_name" toml:"model_name" yaml:"model_name"`
+	PackageVersion   string      `json:"package_version" toml:"package_version" yaml:"package_version"` // Version that migrated the model (empty if not recorded)
+	State            SchemaState `json:"state" toml:"state" yaml:"state"`
+}
+
+// newSchemaVersion will start a new schema version model
+func newSchemaVersion(modelName ModelName, revision uint32, opts ...ModelOps) *SchemaVersion {
+	return &SchemaVersion{
+		ID:             modelName.String(),
+		Model:          *NewBaseModel(ModelSchemaVersion, opts...),
+		PackageVersion: version,
+		Revision:       revision,
+	}
+}
+
+// getSchemaVersions will get the recorded schema versions (by model name)
+func getSchemaVersions(ctx context.Context, opts ...ModelOps) (map[string]*SchemaVersion, error) {
+	modelItems := make([]*SchemaVersion, 0)
+	if err := getModelsByConditions(
+		ctx, ModelSchemaVersion, &modelItems, nil, nil, nil, opts...,
+	); err != nil {
+		return nil, err
+	}
+
+	versions := make(map[string]*SchemaVersion, len(modelItems))
+	for _, item := range modelItems {
+		item.enrich(ModelSchemaVersion, opts...)
+		versions[item.ID] = item
+	}
+	return versions, nil
+}
+
+// SchemaStatus will return the schema revisions of the models in the database compared to the revisions of this
+// version (sorted by model name, the custom models are not versioned)
+func (c *Client) SchemaStatus(ctx context.Context) ([]*ModelSchemaStatus, error) {
+
+	// Check for existing NewRelic transaction
+	ctx = c.GetOrStartTxn(ctx, "schema_status")
+
+	versions, err := getSchemaVersions(ctx, c.DefaultModelOptions()...)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]*ModelSchemaStatus, 0, len(c.GetModelNames()))
+	for _, modelName := range c.GetModelNames() {
+		expected, ok := schemaRevisions[ModelName(modelName)]
+		if !ok {
+			continue
+		}
+		status := &ModelSchemaStatus{
+			ExpectedRevision: expected,
+			ModelName:        modelName,
+			State:            SchemaStateUnknown,
+		}
+		if recorded, found := versions[modelName]; found {
+			status.CurrentRevision = recorded.Revision
+			status.PackageVersion = recorded.PackageVersion
+			switch {
+			case recorded.Revision > expected:
+				status.State = SchemaStateNewer
+			case recorded.Revision < expected:
+				status.State = SchemaStateOutdated
+			default:
+				status.State = SchemaStateCurrent
+			}
+		}
+		statuses = append(statuses, status)
+	}
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].ModelName < statuses[j].ModelName
+	})
+	return statuses, nil
+}
+
+// checkSchemaVersions will check that the schema of the database is not newer than this version understands
+// (before the models are migrated)
+//
+// Returns ErrSchemaNewerThanBinary (or the error reading the registry) in strict mode, otherwise the newer models
+// are logged (see WithSchemaCheck). A database without the registry (IE: a new database) has nothing to check
+func (c *Client) checkSchemaVersions(ctx context.Context) error {
+	if !c.schemaRegistryExists() {
+		return nil
+	}
+
+	statuses, err := c.SchemaStatus(ctx)
+	if err != nil {
+		err = fmt.Errorf("failed checking the schema versions: %w", err)
+		if c.options.dataStore.schemaCheck == SchemaCheckWarn {
+			c.Logger().Warn(ctx, "[SCHEMA] "+err.Error())
+			return nil
+		}
+		return err
+	}
+
+	newer := make([]string, 0)
+	for _, status := range statuses {
+		if status.State == SchemaStateNewer {
+			newer = append(newer, fmt.Sprintf(
+				"%s (revision %d by %s, expected %d)",
+				status.ModelName, status.CurrentRevision, status.PackageVersion, status.ExpectedRevision,
+			))
+		}
+	}
+	if len(newer) == 0 {
+		return nil
+	}
+
+	err = fmt.Errorf("%w: %s", ErrSchemaNewerThanBinary, strings.Join(newer, ", "))
+	if c.options.dataStore.schemaCheck == SchemaCheckWarn {
+		c.Logger().Warn(ctx, "[SCHEMA] "+err.Error())
+		return nil
+	}
+	return err
+}
+
+// schemaRegistryExists will return false if the table of the schema versions was not created yet
+// (the collections of Mongo are created on the first write)
+func (c *Client) schemaRegistryExists() bool {
+	ds := c.Datastore()
+	if ds == nil {
+		return false
+	}
+	if db := gormDB(ds); db != nil {
+		return db.Migrator().HasTable(ds.GetTableName(tableSchemaVersions))
+	}
+	return true
+}
+
+// recordSchemaVersions will record the schema revisions of the migrated models
+//
+// A newer revision is never replaced (the schema was migrated by a newer version, see WithSchemaCheck), a revision
+// recorded at the same time by another instance starting up is reloaded and compared
+func (c *Client) recordSchemaVersions(ctx context.Context, models ...interface{}) error {
+	d := c.Datastore()
+	if d == nil || !d.IsAutoMigrate() || len(models) == 0 {
+		return nil
+	}
+
+	opts := c.DefaultModelOptions()
+	versions, err := getSchemaVersions(ctx, opts...)
+	if err != nil {
+		return err
+	}
+
+	modelNames := []string{ModelSchemaVersion.String()}
+	for _, model := range models {
+		m, ok := model.(ModelInterface)
+		if !ok {
+			continue
+		}
+		if modelName := m.GetModelName(); !utils.StringInSlice(modelName, modelNames) {
+			modelNames = append(modelNames, modelName)
+		}
+	}
+
+	for _, modelName := range modelNames {
+		revision, ok := schemaRevisions[ModelName(modelName)]
+		if !ok {
+			continue
+		}
+		if err = saveSchemaVersion(ctx, versions[modelName], ModelName(modelName), revision, opts...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// saveSchemaVersion will record the revision of the model (unless the recorded revision is the same or newer)
+func saveSchemaVersion(ctx context.Context, schemaVersion *SchemaVersion, modelName ModelName, revision uint32,
+	opts ...ModelOps,
+) error {
+	if schemaVersion == nil {
+		schemaVersion = newSchemaVersion(modelName, revision, append(opts, New())...)
+		err := schemaVersion.Save(ctx)
+		if err == nil || !isUniqueConstraintError(err) {
+			return err
+		}
+
+		// Recorded by another instance in the meantime
+		if schemaVersion, err = getSchemaVersion(ctx, modelName, opts...); err != nil {
+			return err
+		} else if schemaVersion == nil {
+			return nil
+		}
+	}
+	if schemaVersion.Revision >= revision {
+		return nil
+	}
+	schemaVersion.PackageVersion = version
+	schemaVersion.Revision = revision
+	return schemaVersion.Save(ctx)
+}
+
+// getSchemaVersion will get the recorded schema version of the model (nil if not recorded)
+func getSchemaVersion(ctx context.Context, modelName ModelName, opts ...ModelOps) (*SchemaVersion, error) {
+	schemaVersion := &SchemaVersion{ID: modelName.String()}
+	schemaVersion.enrich(ModelSchemaVersion, opts...)
+	if err := Get(ctx, schemaVersion, nil, false, defaultDatabaseReadTimeout, false); err != nil {
+		if errors.Is(err, datastore.ErrNoResults) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return schemaVersion, nil
+}
+
+// GetModelName will get the name of the current model
+func (m *SchemaVersion) GetModelName() string {
+	return ModelSchemaVersion.String()
+}
+
+// GetModelTableName will get the db table name of the current model
+func (m *SchemaVersion) GetModelTableName() string {
+	return tableSchemaVersions
+}
+
+// Save will save the model into the Datastore
+func (m *SchemaVersion) Save(ctx context.Context) error {
+	return Save(ctx, m)
+}
+
+// GetID will get the ID
+func (m *SchemaVersion) GetID() string {
+	return m.ID
+}
+
+// BeforeCreating will fire before the model is being inserted into the Datastore
+func (m *SchemaVersion) BeforeCreating(_ context.Context) error {
+	m.DebugLog("starting: " + m.Name() + " BeforeCreating hook...")
+
+	// Make sure ID is valid
+	if len(m.ID) == 0 {
+		return ErrMissingFieldID
+	}
+
+	m.DebugLog("end: " + m.Name() + " BeforeCreating hook")
+	return nil
+}
+
+// Migrate model specific migration on startup
+func (m *SchemaVersion) Migrate(client datastore.ClientInterface) error {
+	return client.IndexMetadata(client.GetTableName(tableSchemaVersions), metadataField)
+}
@@ -0,0 +1,153 @@
+package bux
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/BuxOrg/bux/chainstate"
+	"github.com/BuxOrg/bux/tester"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestClient_SchemaStatus will test the method SchemaStatus() and the recorded schema versions
+func TestClient_SchemaStatus(t *testing.T) {
+	t.Parallel()
+
+	ctx, client, deferMe := CreateTestSQLiteClient(t, false, true, WithCustomTaskManager(&taskManagerMockBase{}))
+	defer deferMe()
+
+	statuses, err := client.SchemaStatus(ctx)
+	require.NoError(t, err)
+	require.NotEmpty(t, statuses)
+	for _, status := range statuses {
+		assert.Equal(t, SchemaStateCurrent, status.State, status.ModelName)
+		assert.Equal(t, status.ExpectedRevision, status.CurrentRevision)
+		assert.Equal(t, version, status.PackageVersion)
+	}
+	assert.Equal(t, ModelAccessKey.String(), statuses[0].ModelName)
+
+	// The paymail addresses are recorded when added
+	require.NoError(t, client.AddModels(ctx, true, &PaymailAddress{Model: *NewBaseModel(ModelPaymailAddress)}))
+	var versions map[string]*SchemaVersion
+	versions, err = getSchemaVersions(ctx, client.DefaultModelOptions()...)
+	require.NoError(t, err)
+	require.NotNil(t, versions[ModelPaymailAddress.String()])
+	assert.Equal(t, schemaRevisionPaymailAddress, versions[ModelPaymailAddress.String()].Revision)
+	assert.NotNil(t, versions[ModelSchemaVersion.String()])
+
+	// Other values than models are skipped
+	require.NoError(t, client.(*Client).recordSchemaVersions(ctx, "not a model"))
+}
+
+// Test_saveSchemaVersion will test recording a revision recorded at the same time by another instance
+func Test_saveSchemaVersion(t *testing.T) {
+	t.Parallel()
+
+	ctx, client, deferMe := CreateTestSQLiteClient(t, false, true, WithCustomTaskManager(&taskManagerMockBase{}))
+	defer deferMe()
+	opts := client.DefaultModelOptions()
+
+	t.Run("recorded by an older instance", func(t *testing.T) {
+		stored, err := getSchemaVersion(ctx, ModelUtxo, opts...)
+		require.NoError(t, err)
+		require.NotNil(t, stored)
+		stored.Revision = schemaRevisionUtxo - 1
+		require.NoError(t, stored.Save(ctx))
+
+		// Not loaded before the other instance recorded it
+		require.NoError(t, saveSchemaVersion(ctx, nil, ModelUtxo, schemaRevisionUtxo, opts...))
+		stored, err = getSchemaVersion(ctx, ModelUtxo, opts...)
+		require.NoError(t, err)
+		assert.Equal(t, schemaRevisionUtxo, stored.Revision)
+	})
+
+	t.Run("recorded by a newer instance", func(t *testing.T) {
+		require.NoError(t, saveSchemaVersion(ctx, nil, ModelUtxo, schemaRevisionUtxo-1, opts...))
+		stored, err := getSchemaVersion(ctx, ModelUtxo, opts...)
+		require.NoError(t, err)
+		assert.Equal(t, schemaRevisionUtxo, stored.Revision)
+	})
+}
+
+// TestClient_checkSchemaVersions will test refusing to start when the schema was migrated by a newer version
+func TestClient_checkSchemaVersions(t *testing.T) {
+	t.Parallel()
+
+	config := tester.SQLiteIsolatedTestConfig(false)
+	newSchemaClient := func(opts ...ClientOps) (ClientInterface, error) {
+		return NewClient(context.Background(), append([]ClientOps{
+			WithSQLite(config),
+			WithChainstateOptions(false, false, false, false),
+			WithMinercraft(&chainstate.MinerCraftBase{}),
+			WithCustomTaskManager(&taskManagerMockBase{}),
+			WithAutoMigrate(BaseModels...),
+		}, opts...)...)
+	}
+
+	ctx := context.Background()
+	client, err := newSchemaClient()
+	require.NoError(t, err)
+	defer func() {
+		_ = client.Close(context.Background())
+	}()
+	assert.Equal(t, string(SchemaCheckStrict), client.ConfigSummary().Datastore.SchemaCheck)
+
+	// A newer version migrated the transactions
+	var versions map[string]*SchemaVersion
+	versions, err = getSchemaVersions(ctx, client.DefaultModelOptions()...)
+	require.NoError(t, err)
+	newer := versions[ModelTransaction.String()]
+	require.NotNil(t, newer)
+	newer.PackageVersion = "v9.9.9"
+	newer.Revision = schemaRevisionTransaction + 1
+	require.NoError(t, newer.Save(ctx))
+
+	var statuses []*ModelSchemaStatus
+	statuses, err = client.SchemaStatus(ctx)
+	require.NoError(t, err)
+	for _, status := range statuses {
+		if status.ModelName == ModelTransaction.String() {
+			assert.Equal(t, SchemaStateNewer, status.State)
+			assert.Equal(t, "v9.9.9", status.PackageVersion)
+		}
+	}
+
+	t.Run("strict", func(t *testing.T) {
+		_, err = newSchemaClient()
+		require.ErrorIs(t, err, ErrSchemaNewerThanBinary)
+		assert.Contains(t, err.Error(), fmt.Sprintf(
+			"transaction (revision %d by v9.9.9, expected %d)", schemaRevisionTransaction+1, schemaRevisionTransaction,
+		))
+	})
+
+	t.Run("registry failure", func(t *testing.T) {
+		registry := client.(*Client)
+		require.True(t, registry.schemaRegistryExists())
+		failing, cancel := context.WithCancel(ctx)
+		cancel()
+		require.Error(t, registry.checkSchemaVersions(failing))
+
+		registry.options.dataStore.schemaCheck = SchemaCheckWarn
+		defer func() {
+			registry.options.dataStore.schemaCheck = SchemaCheckStrict
+		}()
+		require.NoError(t, registry.checkSchemaVersions(failing))
+	})
+
+	t.Run("warn", func(t *testing.T) {
+		var other ClientInterface
+		other, err = newSchemaClient(WithSchemaCheck(SchemaCheckWarn))
+		require.NoError(t, err)
+		defer func() {
+			_ = other.Close(context.Background())
+		}()
+
+		// The newer revision is kept
+		versions, err = getSchemaVersions(ctx, other.DefaultModelOptions()...)
+		require.NoError(t, err)
+		assert.Equal(t, schemaRevisionTransaction+1, versions[ModelTransaction.String()].Revision)
+		assert.Equal(t, "v9.9.9", versions[ModelTransaction.String()].PackageVersion)
+	})
+}
@@ -0,0 +1,139 @@
+package bux
+
+import (
+	"context"
+	"errors"
+
+	"github.com/mrz1836/go-datastore"
+)
+
+// Setting keys
+const (
+	settingMonitorCatchUp            = "monitor_catch_up"                 // Next block of an interrupted catch-up (see MonitorCatchUp)
+	settingMonitorCheckpoint         = "monitor_checkpoint"               // Last block processed by the monitor (see GetMonitorCheckpoint)
+	settingWebhookEndpoint           = "notifications_webhook_endpoint"   // Webhook endpoint changed at runtime (see SetWebhookEndpoint)
+	settingWebhookEndpointConfigured = "notifications_webhook_configured" // Configured endpoint replaced by the runtime endpoint
+)
+
+// Setting is an object representing a setting changed at runtime (kept for restarts)
+//
+// Gorm related models & indexes: https://gorm.io/docs/models.html - https://gorm.io/docs/indexes.html
+type Setting struct {
+	// Base model
+	Model `bson:",inline"`
+
+	// Model specific fields
+	ID    string `json:"id" toml:"id" yaml:"id" gorm:"<-:create;type:varchar(64);primaryKey;comment:This is the key of the setting" bson:"_id"`
+	Value string `json:"value" toml:"value" yaml:"value" gorm:"<-;type:text;comment:This is the value of the setting" bson:"value"`
+}
+
+// newSetting will start a new setting model
+func newSetting(key, value string, opts ...ModelOps) *Setting {
+	return &Setting{
+		ID:    key,
+		Model: *NewBaseModel(ModelSetting, opts...),
+		Value: value,
+	}
+}
+
+// getSetting will get the setting by key (nil if not found)
+func getSetting(ctx context.Context, key string, opts ...ModelOps) (*Setting, error) {
+	setting := &Setting{ID: key}
+	setting.enrich(ModelSetting, opts...)
+	if err := Get(ctx, setting, nil, false, defaultDatabaseReadTimeout, false); err != nil {
+		if errors.Is(err, datastore.ErrNoResults) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return setting, nil
+}
+
+// saveSetting will create (or update) the setting
+func saveSetting(ctx context.Context, key, value string, opts ...ModelOps) error {
+	setting, err := getSetting(ctx, key, opts...)
+	if err != nil {
+		return err
+	} else if setting == nil {
+		setting = newSetting(key, value, append(opts, New())...)
+	}
+	setting.Value = value
+	return setting.Save(ctx)
+}
+
+// GetModelName will get the name of the current model
+func (m *Setting) GetModelName() string {
+	return ModelSetting.String()
+}
+
+// GetModelTableName will get the db table name of the current model
+func (m *Setting) GetModelTableName() string {
+	return tableSettings
+}
+
+// isVersioned will return true (saves use optimistic concurrency, see ErrStaleModel)
+func (m *Setting) isVersioned() bool {
+	return true
+}
+
+// Save will save the model into the Datastore
+func (m *Setting) Save(ctx context.Context) error {
+	return Save(ctx, m)
+}
+
+// GetID will get the ID
+func (m *Setting) GetID() string {
+	return m.ID
+}
+
+// BeforeCreating will fire before the model is being inserted into the Datastore
+func (m *Setting) BeforeCreating(_ context.Context) error {
+	m.DebugLog("starting: " + m.Name() + " BeforeCreating hook...")
+
+	// Make sure ID is valid
+	if len(m.ID) == 0 {
+		return ErrMissingFieldID
+	}
+
+	m.DebugLog("end: " + m.Name() + " BeforeCreating hook")
+	return nil
+}
+
+// Migrate model specific migration on startup
+func (m *Setting) Migrate(client datastore.ClientInterface) error {
+	return client.IndexMetadata(client.GetTableName(tableSettings), metadataField)
+}
+
+// webhookEndpointStore persists the webhook endpoint changes of the notifications client
+type webhookEndpointStore struct {
+	client     ClientInterface
+	configured string // Endpoint configured at startup (see WithNotifications)
+}
+
+// SaveWebhookEndpoint will save the endpoint, used instead of the configured endpoint on restart
+// (see notifications.EndpointStore and getWebhookEndpointOverride)
+func (s *webhookEndpointStore) SaveWebhookEndpoint(ctx context.Context, endpoint string) error {
+	opts := s.client.DefaultModelOptions()
+	if err := saveSetting(ctx, settingWebhookEndpointConfigured, s.configured, opts...); err != nil {
+		return err
+	}
+	return saveSetting(ctx, settingWebhookEndpoint, endpoint, opts...)
+}
+
+// getWebhookEndpointOverride will return the webhook endpoint changed at runtime (see SetWebhookEndpoint)
+//
+// The runtime endpoint takes precedence over the configured endpoint it replaced. Once the configured endpoint
+// is changed (IE: a new deployment), the configured endpoint takes precedence again and false is returned.
+func getWebhookEndpointOverride(ctx context.Context, configured string, opts ...ModelOps) (string, bool, error) {
+	endpoint, err := getSetting(ctx, settingWebhookEndpoint, opts...)
+	if err != nil || endpoint == nil {
+		return "", false, err
+	}
+	var replaced *Setting
+	if replaced, err = getSetting(ctx, settingWebhookEndpointConfigured, opts...); err != nil {
+		return "", false, err
+	} else if replaced == nil || replaced.Value != configured {
+		return "", false, nil
+	}
+	return endpoint.Value, true, nil
+}
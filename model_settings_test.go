@@ -0,0 +1,89 @@
+package bux
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/BuxOrg/bux/notifications"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestClient_SetWebhookEndpoint will test the webhook endpoint changed at runtime (persisted for restarts)
+func TestClient_SetWebhookEndpoint(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/down" {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	ctx, client, deferMe := CreateTestSQLiteClient(t, false, true,
+		WithCustomTaskManager(&taskManagerMockBase{}),
+		WithNotifications(server.URL+"/configured"),
+		WithNotificationEndpointValidation(),
+		WithNotificationInsecureEndpoints(),
+	)
+	defer deferMe()
+
+	// restart will load the notifications client again (IE: a new instance)
+	restart := func(t *testing.T) notifications.ClientInterface {
+		client.SetNotificationsClient(nil)
+		require.NoError(t, client.(*Client).loadNotificationClient(ctx))
+		return client.Notifications()
+	}
+
+	t.Run("the configured endpoint is used by default", func(t *testing.T) {
+		assert.Equal(t, server.URL+"/configured", restart(t).GetWebhookEndpoint())
+	})
+
+	t.Run("the validation ping rejects the endpoint", func(t *testing.T) {
+		err := client.Notifications().(notifications.WebhookEndpointSetter).SetWebhookEndpoint(ctx, server.URL+"/down")
+		require.ErrorIs(t, err, notifications.ErrInvalidEndpoint)
+
+		setting, err := getSetting(ctx, settingWebhookEndpoint, client.DefaultModelOptions()...)
+		require.NoError(t, err)
+		assert.Nil(t, setting)
+	})
+
+	t.Run("the endpoint is kept after a restart", func(t *testing.T) {
+		require.NoError(t, client.Notifications().(notifications.WebhookEndpointSetter).SetWebhookEndpoint(ctx, server.URL+"/changed"))
+		assert.Equal(t, server.URL+"/changed", client.Notifications().GetWebhookEndpoint())
+		assert.Equal(t, server.URL+"/changed", restart(t).GetWebhookEndpoint())
+
+		// Changed again (updates the setting)
+		require.NoError(t, client.Notifications().(notifications.WebhookEndpointSetter).SetWebhookEndpoint(ctx, server.URL+"/again"))
+		assert.Equal(t, server.URL+"/again", restart(t).GetWebhookEndpoint())
+	})
+
+	t.Run("a new configured endpoint takes precedence", func(t *testing.T) {
+		require.NoError(t, client.Notifications().(notifications.WebhookEndpointSetter).SetWebhookEndpoint(
+			ctx, server.URL+"/changed",
+		))
+
+		// Deployed with another configured endpoint
+		options := client.(*Client).options.notifications
+		configured, configuredOptions := options.webhookEndpoint, options.options
+		defer func() {
+			options.webhookEndpoint, options.options = configured, configuredOptions
+			restart(t)
+		}()
+		options.webhookEndpoint = server.URL + "/deployed"
+		options.options = append(options.options[:len(options.options):len(options.options)],
+			notifications.WithNotifications(options.webhookEndpoint),
+		)
+		assert.Equal(t, server.URL+"/deployed", restart(t).GetWebhookEndpoint())
+	})
+
+	t.Run("the webhook is disabled after a restart", func(t *testing.T) {
+		require.NoError(t, client.Notifications().(notifications.WebhookEndpointSetter).SetWebhookEndpoint(ctx, ""))
+		n := restart(t)
+		assert.Empty(t, n.GetWebhookEndpoint())
+		assert.Len(t, n.Transports(), 0)
+	})
+}
@@ -5,23 +5,54 @@ import (
 	"database/sql/driver"
 	"encoding/json"
 	"fmt"
+
+	"github.com/BuxOrg/bux/chainstate"
+	"github.com/BuxOrg/bux/utils"
 )
 
 // SyncConfig is the configuration used for syncing a transaction (on-chain)
 type SyncConfig struct {
-	Broadcast        bool `json:"broadcast" toml:"broadcast" yaml:"broadcast"`                         // Transaction should be broadcasted
-	BroadcastInstant bool `json:"broadcast_instant" toml:"broadcast_instant" yaml:"broadcast_instant"` // Transaction should be broadcasted instantly (ASAP)
-	PaymailP2P       bool `json:"paymail_p2p" toml:"paymail_p2p" yaml:"paymail_p2p"`                   // Transaction will be sent to all related paymail providers if P2P is detected
-	SyncOnChain      bool `json:"sync_on_chain" toml:"sync_on_chain" yaml:"sync_on_chain"`             // Transaction should be checked that it's on-chain
+	Broadcast          bool         `json:"broadcast" toml:"broadcast" yaml:"broadcast"`                                         // Transaction should be broadcasted
+	BroadcastInstant   bool         `json:"broadcast_instant" toml:"broadcast_instant" yaml:"broadcast_instant"`                 // Transaction should be broadcasted instantly (ASAP)
+	P2PTargets         []*PaymailP4 `json:"p2p_targets,omitempty" toml:"p2p_targets" yaml:"p2p_targets"`                         // P2P notification targets of a transaction recorded without a draft (see WithP2PTargets)
+	PaymailP2P         bool         `json:"paymail_p2p" toml:"paymail_p2p" yaml:"paymail_p2p"`                                   // Transaction will be sent to all related paymail providers if P2P is detected
+	PreferredProviders []string     `json:"preferred_providers,omitempty" toml:"preferred_providers" yaml:"preferred_providers"` // Broadcast providers to try first (names of the chainstate broadcast providers)
+	RequirePreferred   bool         `json:"require_preferred,omitempty" toml:"require_preferred" yaml:"require_preferred"`       // Only broadcast to the preferred providers (no fallback to the other providers)
+	SyncOnChain        bool         `json:"sync_on_chain" toml:"sync_on_chain" yaml:"sync_on_chain"`                             // Transaction should be checked that it's on-chain
 	// FUTURE IDEAS:
 	// DelayToBroadcast time.Duration `json:"delay_to_broadcast" toml:"delay_to_broadcast" yaml:"delay_to_broadcast"` // Delay for broadcasting
-	// Miner       string `json:"miner" toml:"miner" yaml:"miner"`  // Use a specific miner
 	// miners: []miner{name, token, feeQuote}
-	// default: miner
-	// failover: miner
 	// keep tx updated until x blocks?
 }
 
+// InstantBroadcastMode is how the instant broadcast (SyncConfig.BroadcastInstant) runs when the record is created
+type InstantBroadcastMode string
+
+// Modes of the instant broadcast
+const (
+	// InstantBroadcastAsync runs the broadcast in the background (detached from the caller, with its own timeout)
+	InstantBroadcastAsync InstantBroadcastMode = "async"
+
+	// InstantBroadcastSync runs the broadcast in the record creation (the caller waits for the broadcast)
+	InstantBroadcastSync InstantBroadcastMode = "sync"
+)
+
+// validatePreferredProviders will make sure the preferred providers are configured in chainstate
+func (t *SyncConfig) validatePreferredProviders(chainstateClient chainstate.ClientInterface) error {
+	if t == nil {
+		return nil
+	} else if t.RequirePreferred && len(t.PreferredProviders) == 0 {
+		return ErrMissingPreferredProviders
+	}
+	configured := chainstateClient.BroadcastProviders()
+	for _, provider := range t.PreferredProviders {
+		if !utils.StringInSlice(provider, configured) {
+			return fmt.Errorf("%w: %s", ErrUnknownBroadcastProvider, provider)
+		}
+	}
+	return nil
+}
+
 // Scan will scan the value into Struct, implements sql.Scanner interface
 func (t *SyncConfig) Scan(value interface{}) error {
 	if value == nil {
@@ -6,6 +6,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"time"
+
+	"github.com/BuxOrg/bux/chainstate"
 )
 
 // SyncResults is the results from all sync attempts (broadcast or sync)
@@ -17,16 +19,79 @@ type SyncResults struct {
 // Sync actions for syncing transactions
 const (
 	syncActionBroadcast = "broadcast" // Broadcast a transaction into the mempool
+	syncActionConfig    = "config"    // Manual change of the sync configuration
 	syncActionP2P       = "p2p"       // Notify all paymail providers associated to the transaction
+	syncActionRequeue   = "requeue"   // Manual requeue of the errored actions
 	syncActionSync      = "sync"      // Get on-chain data about the transaction (IE: block hash, height, etc)
 )
 
+// P2PStrategy is how the transaction was delivered to the paymail provider
+type P2PStrategy string
+
+// Strategies of the P2P delivery
+const (
+	// P2PStrategyPayload sends the transaction (hex or BEEF) to the receive endpoint
+	P2PStrategyPayload P2PStrategy = "payload"
+
+	// P2PStrategyOnChain lets the receiver fetch the transaction on-chain (the payload is too large)
+	P2PStrategyOnChain P2PStrategy = "on_chain"
+)
+
 // SyncResult is the complete attempt/result to sync (multiple providers and strategies)
 type SyncResult struct {
-	Action        string    `json:"action"`             // type: broadcast, sync etc
-	ExecutedAt    time.Time `json:"executed_at"`        // Time it was executed
-	Provider      string    `json:"provider,omitempty"` // Provider used for attempt(s)
-	StatusMessage string    `json:"status_message"`     // Success or failure message
+	Action             string                     `json:"action"`                        // type: broadcast, sync etc
+	ExecutedAt         time.Time                  `json:"executed_at"`                   // Time it was executed
+	P2PStrategy        P2PStrategy                `json:"p2p_strategy,omitempty"`        // Delivery strategy of the P2P (payload or on-chain)
+	PreferredProviders []string                   `json:"preferred_providers,omitempty"` // Preferred providers of the broadcast (see SyncConfig)
+	Provider           string                     `json:"provider,omitempty"`            // Provider used for attempt(s)
+	RejectionReason    chainstate.RejectionReason `json:"rejection_reason,omitempty"`    // Normalized reason if the broadcast was rejected
+	StatusMessage      string                     `json:"status_message"`                // Success or failure message
+}
+
+// ForAction will return the results of the given action (IE: broadcast, p2p, sync), in the order executed
+func (t *SyncResults) ForAction(action string) []*SyncResult {
+	var results []*SyncResult
+	for _, result := range t.Results {
+		if result.Action == action {
+			results = append(results, result)
+		}
+	}
+	return results
+}
+
+// LastForAction will return the last result of the given action (nil if never executed)
+func (t *SyncResults) LastForAction(action string) *SyncResult {
+	for i := len(t.Results) - 1; i >= 0; i-- {
+		if t.Results[i].Action == action {
+			return t.Results[i]
+		}
+	}
+	return nil
+}
+
+// Attempts will return the number of results (attempts) per action
+func (t *SyncResults) Attempts() map[string]int {
+	attempts := make(map[string]int)
+	for _, result := range t.Results {
+		attempts[result.Action]++
+	}
+	return attempts
+}
+
+// syncResults is the stored form of SyncResults (without the computed fields)
+type syncResults SyncResults
+
+// MarshalJSON will marshal the results with the computed attempts per action
+//
+// The flat results are still emitted (backward compatible), the attempts are not stored (see Value)
+func (t SyncResults) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		syncResults
+		Attempts map[string]int `json:"attempts"`
+	}{
+		syncResults: syncResults(t),
+		Attempts:    t.Attempts(),
+	})
 }
 
 // Scan will scan the value into Struct, implements sql.Scanner interface
@@ -51,7 +116,7 @@ func (t *SyncResults) Scan(value interface{}) error {
 
 // Value return json value, implement driver.Valuer interface
 func (t SyncResults) Value() (driver.Value, error) {
-	marshal, err := json.Marshal(t)
+	marshal, err := json.Marshal(syncResults(t))
 	if err != nil {
 		return nil, err
 	}
@@ -27,6 +27,9 @@ const (
 	// SyncStatusError is when the sync has an error
 	SyncStatusError SyncStatus = statusError
 
+	// SyncStatusSeen is when the sync was accepted by a provider but not yet confirmed on the network
+	SyncStatusSeen SyncStatus = statusSeen
+
 	// SyncStatusComplete is when the sync is complete
 	SyncStatusComplete SyncStatus = statusComplete
 )
@@ -52,6 +55,8 @@ func (t *SyncStatus) Scan(value interface{}) error {
 		*t = SyncStatusCanceled
 	case statusError:
 		*t = SyncStatusError
+	case statusSeen:
+		*t = SyncStatusSeen
 	case statusComplete:
 		*t = SyncStatusComplete
 	case statusSkipped:
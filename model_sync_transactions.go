@@ -9,13 +9,11 @@ import (
 	"runtime"
 	"runtime/debug"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/BuxOrg/bux/chainstate"
 	"github.com/BuxOrg/bux/notifications"
 	"github.com/BuxOrg/bux/taskmanager"
-	"github.com/bitcoin-sv/go-paymail"
 	"github.com/libsv/go-bt/v2"
 	"github.com/mrz1836/go-datastore"
 	customTypes "github.com/mrz1836/go-datastore/custom_types"
@@ -36,6 +34,7 @@ type SyncTransaction struct {
 	BroadcastStatus SyncStatus           `json:"broadcast_status" toml:"broadcast_status" yaml:"broadcast_status" gorm:"<-;type:varchar(10);index;comment:This is the status of the broadcast" bson:"broadcast_status"`
 	P2PStatus       SyncStatus           `json:"p2p_status" toml:"p2p_status" yaml:"p2p_status" gorm:"<-;column:p2p_status;type:varchar(10);index;comment:This is the status of the p2p paymail requests" bson:"p2p_status"`
 	SyncStatus      SyncStatus           `json:"sync_status" toml:"sync_status" yaml:"sync_status" gorm:"<-;type:varchar(10);index;comment:This is the status of the on-chain sync" bson:"sync_status"`
+	P2PFailures     uint32               `json:"p2p_failures" toml:"p2p_failures" yaml:"p2p_failures" gorm:"<-;column:p2p_failures;type:int;comment:Failed P2P notifications (see WithPaymailP2PFailureLimit)" bson:"p2p_failures"`
 
 	// internal fields
 	transaction *Transaction
@@ -54,10 +53,12 @@ func newSyncTransaction(txID string, config *SyncConfig, opts ...ModelOps) *Sync
 		bs = SyncStatusSkipped
 	}
 
-	// Notify Paymail P2P
+	// Notify Paymail P2P (waits for the broadcast, if any)
 	ps := SyncStatusPending
 	if !config.PaymailP2P {
 		ps = SyncStatusSkipped
+	} else if !config.Broadcast {
+		ps = SyncStatusReady
 	}
 
 	// Sync
@@ -77,6 +78,9 @@ func newSyncTransaction(txID string, config *SyncConfig, opts ...ModelOps) *Sync
 }
 
 // GetSyncTransactionByID will get a sync transaction
+//
+// Returns ErrSyncTransactionNotFound if no record was found, and ErrDuplicateSyncTransaction (with the count)
+// if more than one record was found. NOTE: previously (nil, nil) was returned in both cases
 func GetSyncTransactionByID(ctx context.Context, id string, opts ...ModelOps) (*SyncTransaction, error) {
 	// Get the records by status
 	txs, err := getSyncTransactionsByConditions(ctx,
@@ -88,63 +92,69 @@ func GetSyncTransactionByID(ctx context.Context, id string, opts ...ModelOps) (*
 	if err != nil {
 		return nil, err
 	}
-	if len(txs) != 1 {
-		return nil, nil
+	if len(txs) == 0 {
+		return nil, ErrSyncTransactionNotFound
+	} else if len(txs) > 1 {
+		return nil, fmt.Errorf("%w: found %d records for id %s", ErrDuplicateSyncTransaction, len(txs), id)
 	}
 
 	return txs[0], nil
 }
 
-// getTransactionsToBroadcast will get the sync transactions to broadcast
-func getTransactionsToBroadcast(ctx context.Context, queryParams *datastore.QueryParams,
+// getBroadcastGroup will load the transaction of the sync transaction and return the xPub grouping the broadcast
+// (the first input xPub, empty if none)
+//
+// Returns false if the transaction cannot be broadcast yet (the parents are not broadcast, or the chain of
+// unconfirmed ancestors is deeper than maxDepth)
+func getBroadcastGroup(ctx context.Context, syncTx *SyncTransaction, maxDepth uint32,
 	opts ...ModelOps,
-) (map[string][]*SyncTransaction, error) {
-	// Get the records by status
-	txs, err := getSyncTransactionsByConditions(
-		ctx,
-		map[string]interface{}{
-			broadcastStatusField: SyncStatusReady.String(),
-		},
-		queryParams, opts...,
-	)
-	if err != nil {
-		return nil, err
+) (string, bool, error) {
+	var err error
+	if syncTx.transaction, err = getTransactionByID(
+		ctx, "", syncTx.ID, opts...,
+	); err != nil {
+		return "", false, err
 	}
 
-	// group transactions by xpub and return including the tx itself
-	txsByXpub := make(map[string][]*SyncTransaction)
-	for _, tx := range txs {
-		if tx.transaction, err = getTransactionByID(
-			ctx, "", tx.ID, opts...,
-		); err != nil {
-			return nil, err
-		}
-
-		var parentsBroadcast bool
-		parentsBroadcast, err = areParentsBroadcast(ctx, tx, opts...)
-		if err != nil {
-			return nil, err
-		}
+	var parentsBroadcast bool
+	if parentsBroadcast, err = areParentsBroadcast(ctx, syncTx, opts...); err != nil {
+		return "", false, err
+	} else if !parentsBroadcast {
+		// if all parents are not broadcast, then we cannot broadcast this tx
+		return "", false, nil
+	}
 
-		if !parentsBroadcast {
-			// if all parents are not broadcast, then we cannot broadcast this tx
-			continue
+	// the miners would reject a chain of unconfirmed transactions deeper than the limit
+	// wait for the ancestors to be mined instead of attempting and failing
+	if maxDepth > 0 {
+		var exceeded bool
+		if exceeded, err = exceedsUnconfirmedChain(ctx, syncTx.transaction, maxDepth, opts...); err != nil {
+			return "", false, err
+		} else if exceeded {
+			return "", false, nil
 		}
+	}
 
-		xPubID := "" // fallback if we have no input xpubs
-		if len(tx.transaction.XpubInIDs) > 0 {
-			// use the first xpub for the grouping
-			// in most cases when we are broadcasting, there should be only 1 xpub in
-			xPubID = tx.transaction.XpubInIDs[0]
-		}
+	if len(syncTx.transaction.XpubInIDs) > 0 {
+		// use the first xpub for the grouping
+		// in most cases when we are broadcasting, there should be only 1 xpub in
+		return syncTx.transaction.XpubInIDs[0], true, nil
+	}
+	return "", true, nil // fallback if we have no input xpubs
+}
 
-		if txsByXpub[xPubID] == nil {
-			txsByXpub[xPubID] = make([]*SyncTransaction, 0)
-		}
-		txsByXpub[xPubID] = append(txsByXpub[xPubID], tx)
+// exceedsUnconfirmedChain will check if the chain of unconfirmed ancestors of the transaction is deeper than the limit
+func exceedsUnconfirmedChain(ctx context.Context, tx *Transaction, maxDepth uint32, opts ...ModelOps) (bool, error) {
+	btTx, err := bt.NewTxFromString(tx.Hex)
+	if err != nil {
+		return false, err
 	}
 
-	return txsByXpub, nil
+	var depth uint32
+	if depth, err = getUnconfirmedDepth(ctx, getParentIDs(btTx), maxDepth, opts...); err != nil {
+		return false, err
+	}
+	return depth > maxDepth, nil
 }
 
 func areParentsBroadcast(ctx context.Context, syncTx *SyncTransaction, opts ...ModelOps) (bool, error) {
@@ -170,11 +180,15 @@ func areParentsBroadcast(ctx context.Context, syncTx *SyncTransaction, opts ...M
 		var parentTx *SyncTransaction
 		previousTxID := hex.EncodeToString(bt.ReverseBytes(input.PreviousTxID()))
 		parentTx, err = GetSyncTransactionByID(ctx, previousTxID, opts...)
-		if err != nil {
+		if errors.Is(err, ErrSyncTransactionNotFound) {
+			// the parent is not handled by Bux
+			continue
+		} else if err != nil {
 			return false, err
 		}
-		// if we have a sync transaction, and it is not complete, then we cannot broadcast
-		if parentTx != nil && parentTx.BroadcastStatus != SyncStatusComplete {
+		// if we have a sync transaction, and it is not seen or complete, then we cannot broadcast
+		if parentTx.BroadcastStatus != SyncStatusSeen &&
+			parentTx.BroadcastStatus != SyncStatusComplete {
 			parentsBroadcast = false
 		}
 	}
@@ -182,6 +196,24 @@ func areParentsBroadcast(ctx context.Context, syncTx *SyncTransaction, opts ...M
 	return parentsBroadcast, nil
 }
 
+// getTransactionsToConfirmBroadcast will get the sync transactions that were seen, but not confirmed on the network
+func getTransactionsToConfirmBroadcast(ctx context.Context, queryParams *datastore.QueryParams,
+	opts ...ModelOps,
+) ([]*SyncTransaction, error) {
+	// Get the records by status
+	txs, err := getSyncTransactionsByConditions(
+		ctx,
+		map[string]interface{}{
+			broadcastStatusField: SyncStatusSeen.String(),
+		},
+		queryParams, opts...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return txs, nil
+}
+
 // getTransactionsToNotifyP2P will get the sync transactions to notify p2p paymail providers
 func getTransactionsToNotifyP2P(ctx context.Context, queryParams *datastore.QueryParams,
 	opts ...ModelOps,
@@ -261,6 +293,23 @@ func (m *SyncTransaction) isSkipped() bool {
 		m.P2PStatus == SyncStatusSkipped
 }
 
+// LastBroadcastResponse will return the last broadcast result (nil if never broadcast)
+//
+// The RejectionReason is set if the broadcast was rejected
+func (m *SyncTransaction) LastBroadcastResponse() *SyncResult {
+	return m.LastResultForAction(syncActionBroadcast)
+}
+
+// ResultsForAction will return the results of the given action (IE: broadcast, p2p, sync), in the order executed
+func (m *SyncTransaction) ResultsForAction(action string) []*SyncResult {
+	return m.Results.ForAction(action)
+}
+
+// LastResultForAction will return the last result of the given action (nil if never executed)
+func (m *SyncTransaction) LastResultForAction(action string) *SyncResult {
+	return m.Results.LastForAction(action)
+}
+
 // GetModelName will get the name of the current model
 func (m *SyncTransaction) GetModelName() string {
 	return ModelSyncTransaction.String()
@@ -271,6 +320,11 @@ func (m *SyncTransaction) GetModelTableName() string {
 	return tableSyncTransactions
 }
 
+// isVersioned will return true (saves use optimistic concurrency, see ErrStaleModel)
+func (m *SyncTransaction) isVersioned() bool {
+	return true
+}
+
 // Save will save the model into the Datastore
 func (m *SyncTransaction) Save(ctx context.Context) error {
 	return Save(ctx, m)
@@ -282,7 +336,7 @@ func (m *SyncTransaction) GetID() string {
 }
 
 // BeforeCreating will fire before the model is being inserted into the Datastore
-func (m *SyncTransaction) BeforeCreating(_ context.Context) error {
+func (m *SyncTransaction) BeforeCreating(ctx context.Context) error {
 	m.DebugLog("starting: [" + m.name.String() + "] BeforeCreating hook...")
 
 	// Make sure ID is valid
@@ -294,6 +348,12 @@ func (m *SyncTransaction) BeforeCreating(_ context.Context) error {
 	return nil
 }
 
+// duplicateError will return the error when a record already exists for the transaction
+// (only one record per transaction, the primary key rejects the others)
+func (m *SyncTransaction) duplicateError(err error) error {
+	return fmt.Errorf("%w: a record already exists for id %s: %s", ErrDuplicateSyncTransaction, m.ID, err.Error())
+}
+
 // AfterCreated will fire after the model is created in the Datastore
 func (m *SyncTransaction) AfterCreated(ctx context.Context) error {
 	m.DebugLog("starting: " + m.Name() + " AfterCreated hook...")
@@ -301,7 +361,17 @@ func (m *SyncTransaction) AfterCreated(ctx context.Context) error {
 	// Should we broadcast immediately?
 	if m.Configuration.Broadcast &&
 		m.Configuration.BroadcastInstant {
-		if err := processBroadcastTransaction(
+
+		// Wait for the broadcast (the caller relies on the broadcast result), unless InstantBroadcastAsync:
+		// the record is returned promptly (a slow provider does not hold the caller), the sync transaction
+		// is reloaded (the model is still used by the caller)
+		if runner, ok := m.Client().(instantBroadcastRunner); ok &&
+			m.Client().InstantBroadcastMode() == InstantBroadcastAsync {
+			client, id, opts := m.Client(), m.GetID(), m.GetOptions(false)
+			runner.runInstantBroadcast(ctx, func(ctx context.Context) {
+				processInstantBroadcast(ctx, client, id, opts...)
+			})
+		} else if err := processBroadcastTransaction(
 			ctx, m,
 		); err != nil {
 			// return err (do not return and fail the record creation)
@@ -401,8 +471,89 @@ func (m *SyncTransaction) RegisterTasks() error {
 }
 
 // Migrate model specific migration on startup
+//
+// The sync queries filter on a status and sort by created_at, composite indexes (status, created_at) avoid
+// sorting the matching records on every run (see syncQueueStatusFields)
 func (m *SyncTransaction) Migrate(client datastore.ClientInterface) error {
-	return client.IndexMetadata(client.GetTableName(tableSyncTransactions), metadataField)
+	tableName := client.GetTableName(tableSyncTransactions)
+	if client.Engine() == datastore.MySQL {
+		if err := m.migrateMySQL(client, tableName); err != nil {
+			return err
+		}
+	} else if client.Engine() == datastore.PostgreSQL {
+		if err := m.migratePostgreSQL(client, tableName); err != nil {
+			return err
+		}
+	} else if client.Engine() == datastore.SQLite {
+		if err := m.migrateSQLite(client, tableName); err != nil {
+			return err
+		}
+	}
+
+	return client.IndexMetadata(tableName, metadataField)
+}
+
+// syncQueueStatusFields are the status fields of the sync queries (indexed with created_at)
+var syncQueueStatusFields = []string{broadcastStatusField, p2pStatusField, syncStatusField}
+
+// syncQueueIndexName will return the name of the composite index of the status field
+func syncQueueIndexName(tableName, statusField string) string {
+	return "idx_" + tableName + "_" + statusField + "_" + createdAtField
+}
+
+// migratePostgreSQL is specific migration SQL for Postgresql
+//
+// The indexes are created concurrently (no lock on the table), an invalid index of a failed build is dropped first
+func (m *SyncTransaction) migratePostgreSQL(client datastore.ClientInterface, tableName string) error {
+	for _, field := range syncQueueStatusFields {
+		idxName := syncQueueIndexName(tableName, field)
+
+		var invalid int
+		if tx := client.Raw(`SELECT COUNT(*) FROM pg_index i JOIN pg_class c ON c.oid = i.indexrelid
+			WHERE c.relname = '` + idxName + `' AND NOT i.indisvalid`).Scan(&invalid); tx.Error != nil {
+			return tx.Error
+		}
+		if invalid > 0 {
+			if tx := client.Execute(`DROP INDEX CONCURRENTLY IF EXISTS "` + idxName + `"`); tx.Error != nil {
+				return tx.Error
+			}
+		}
+
+		if tx := client.Execute(`CREATE INDEX CONCURRENTLY IF NOT EXISTS "` + idxName + `" ON "` + tableName +
+			`" ("` + field + `", "` + createdAtField + `")`); tx.Error != nil {
+			return tx.Error
+		}
+	}
+	return nil
+}
+
+// migrateMySQL is specific migration SQL for MySQL
+func (m *SyncTransaction) migrateMySQL(client datastore.ClientInterface, tableName string) error {
+	for _, field := range syncQueueStatusFields {
+		idxName := syncQueueIndexName(tableName, field)
+		idxExists, err := client.IndexExists(tableName, idxName)
+		if err != nil {
+			return err
+		}
+		if !idxExists {
+			if tx := client.Execute("CREATE INDEX `" + idxName + "` ON `" + tableName +
+				"` (" + field + "," + createdAtField + ")"); tx.Error != nil {
+				return tx.Error
+			}
+		}
+	}
+	return nil
+}
+
+// migrateSQLite is specific migration SQL for SQLite
+func (m *SyncTransaction) migrateSQLite(client datastore.ClientInterface, tableName string) error {
+	for _, field := range syncQueueStatusFields {
+		if tx := client.Execute(`CREATE INDEX IF NOT EXISTS "` + syncQueueIndexName(tableName, field) + `" ON "` +
+			tableName + `" ("` + field + `", "` + createdAtField + `")`); tx.Error != nil {
+			return tx.Error
+		}
+	}
+	return nil
 }
 
 // processSyncTransactions will process sync transaction records
@@ -436,52 +587,31 @@ func processSyncTransactions(ctx context.Context, maxTransactions int, opts ...M
 	return nil
 }
 
-// processBroadcastTransactions will process sync transaction records
-func processBroadcastTransactions(ctx context.Context, maxTransactions int, opts ...ModelOps) error {
-	queryParams := &datastore.QueryParams{
-		Page:          1,
-		PageSize:      maxTransactions,
-		OrderByField:  createdAtField,
-		SortDirection: datastore.SortAsc,
-	}
-
-	// Get maxTransactions records, grouped by xpub
-	txsByXpub, err := getTransactionsToBroadcast(
-		ctx, queryParams, opts...,
+// processBroadcastTransactions will broadcast the ready sync transaction records
+//
+// The records are paged through (pageSize records at a time, oldest first) and dispatched to the broadcast workers
+// as the pages arrive, see broadcastQueue. At most maxTransactions records are dispatched, the next run continues.
+func processBroadcastTransactions(ctx context.Context, pageSize, maxTransactions int, opts ...ModelOps) error {
+	// we limit the number of concurrent broadcasts to the number of cpus*2, since there is lots of IO wait
+	queue := newBroadcastQueue(
+		processBroadcastTransaction,
+		NewBaseModel(ModelNameEmpty, opts...).Client().BroadcastHighWaterMark(),
+		runtime.NumCPU()*2,
 	)
-	if err != nil {
-		return err
-	} else if len(txsByXpub) == 0 {
-		return nil
-	}
+	return queue.dispatch(ctx, pageSize, maxTransactions, opts...)
+}
 
-	wg := new(sync.WaitGroup)
-	// we limit the number of concurrent broadcasts to the number of cpus*2, since there is lots of IO wait
-	limit := make(chan bool, runtime.NumCPU()*2)
-
-	// Process the transactions per xpub, in parallel
-	for xPubID := range txsByXpub {
-		limit <- true // limit the number of routines running at the same time
-		wg.Add(1)
-		go func(xPubID string) {
-			defer wg.Done()
-			defer func() { <-limit }()
-
-			for _, tx := range txsByXpub[xPubID] {
-				if err = processBroadcastTransaction(
-					ctx, tx,
-				); err != nil {
-					tx.Client().Logger().Error(ctx,
-						fmt.Sprintf("error running broadcast tx for xpub %s, tx %s: %s", xPubID, tx.ID, err.Error()),
-					)
-					return // stop processing transactions for this xpub if we found an error
-				}
-			}
-		}(xPubID)
+// processInstantBroadcast will broadcast the (reloaded) sync transaction in the background (InstantBroadcastAsync)
+//
+// Any failure is left to the broadcast task (the record stays ready)
+func processInstantBroadcast(ctx context.Context, client ClientInterface, id string, opts ...ModelOps) {
+	syncTx, err := GetSyncTransactionByID(ctx, id, opts...)
+	if err == nil {
+		err = processBroadcastTransaction(ctx, syncTx)
+	}
+	if err != nil {
+		client.Logger().Error(ctx, "error running instant broadcast of tx "+id+": "+err.Error())
 	}
-	wg.Wait()
-
-	return nil
 }
 
 // processBroadcastTransaction will process a sync transaction record and broadcast it
@@ -534,19 +664,22 @@ func processBroadcastTransaction(ctx context.Context, syncTx *SyncTransaction) e
 		}
 	}
 
-	// Broadcast
+	// Broadcast (to the preferred providers first), the responses are kept as the proof of submission
 	var provider string
-	if provider, err = syncTx.Client().Chainstate().Broadcast(
-		ctx, syncTx.ID, txHex, defaultBroadcastTimeout,
-	); err != nil {
-		bailAndSaveSyncTransaction(
-			ctx, syncTx, SyncStatusError, syncActionBroadcast, provider, "broadcast error: "+err.Error(),
-		)
-		return nil //nolint:nolintlint,nilerr // error is not needed
+	receiptsCtx, receipts := chainstate.WithBroadcastReceipts(ctx)
+	provider, err = broadcastWithPreferredProviders(receiptsCtx, syncTx, txHex)
+	saveBroadcastReceipts(ctx, syncTx, receipts)
+	if err != nil {
+		if errors.Is(err, chainstate.ErrProvidersInBackoff) { // Deferred to the next run (the record stays ready)
+			syncTx.Client().Logger().Info(ctx, "broadcast of tx "+syncTx.ID+" is deferred: "+err.Error())
+			return nil
+		}
+		return processBroadcastRejection(ctx, syncTx, provider, chainstate.GetBroadcastRejection(err))
 	}
 
 	// Create status message
 	message := "broadcast success"
+	seenAt := time.Now().UTC()
 
 	// process the incoming transaction before finishing the sync
 	if incomingTransaction != nil {
@@ -561,8 +694,28 @@ func processBroadcastTransaction(ctx context.Context, syncTx *SyncTransaction) e
 		}
 	}
 
-	// Update the sync information
-	syncTx.BroadcastStatus = SyncStatusComplete
+	// Record when the transaction was first seen (the broadcast was accepted)
+	if transaction != nil && !transaction.FirstSeenAt.Valid {
+		if transaction, err = saveWithReload(ctx, transaction,
+			func(ctx context.Context) (*Transaction, error) {
+				reloaded, reloadErr := getTransactionByID(ctx, "", syncTx.ID, syncTx.GetOptions(false)...)
+				if reloadErr == nil && reloaded == nil {
+					reloadErr = ErrMissingTransaction
+				}
+				return reloaded, reloadErr
+			},
+			func(transaction *Transaction) {
+				transaction.setFirstSeen(seenAt)
+			},
+		); err != nil {
+			// the broadcast was accepted, so a failed timestamp must not fail the sync record
+			syncTx.Client().Logger().Error(ctx,
+				"error recording the first seen time of tx "+syncTx.ID+": "+err.Error())
+		}
+	}
+
+	// Update the sync information (the broadcast is confirmed later by the sync task)
+	syncTx.BroadcastStatus = SyncStatusSeen
 	syncTx.Results.LastMessage = message
 	syncTx.LastAttempt = customTypes.NullTime{
 		NullTime: sql.NullTime{
@@ -577,10 +730,11 @@ func processBroadcastTransaction(ctx context.Context, syncTx *SyncTransaction) e
 	}
 
 	syncTx.Results.Results = append(syncTx.Results.Results, &SyncResult{
-		Action:        syncActionBroadcast,
-		ExecutedAt:    time.Now().UTC(),
-		Provider:      provider,
-		StatusMessage: message,
+		Action:             syncActionBroadcast,
+		ExecutedAt:         time.Now().UTC(),
+		PreferredProviders: syncTx.Configuration.PreferredProviders,
+		Provider:           provider,
+		StatusMessage:      message,
 	})
 
 	// Update the P2P status
@@ -595,14 +749,16 @@ func processBroadcastTransaction(ctx context.Context, syncTx *SyncTransaction) e
 
 	// Update the sync transaction record
 	if err = syncTx.Save(ctx); err != nil {
-		bailAndSaveSyncTransaction(
+		if bailErr := bailAndSaveSyncTransaction(
 			ctx, syncTx, SyncStatusError, syncActionBroadcast, "internal", err.Error(),
-		)
+		); bailErr != nil {
+			logBailFailure(ctx, syncTx, syncActionBroadcast, bailErr)
+		}
 		return err
 	}
 
 	// Fire a notification
-	notify(notifications.EventTypeBroadcast, syncTx)
+	notify(ctx, notifications.EventTypeBroadcast, syncTx)
 
 	// Notify any P2P paymail providers associated to the transaction
 	// but only if we actually found the transaction in the transactions' collection, otherwise this was an incoming
@@ -617,6 +773,118 @@ func processBroadcastTransaction(ctx context.Context, syncTx *SyncTransaction) e
 	return nil
 }
 
+// broadcastWithPreferredProviders will broadcast the transaction to the preferred providers of the sync config first
+//
+// If the preferred providers fail (or are rate limited), all the providers are used (unless the preferred
+// providers are required)
+func broadcastWithPreferredProviders(ctx context.Context, syncTx *SyncTransaction, txHex string) (string, error) {
+	chainstateClient := syncTx.Client().Chainstate()
+	preferred := syncTx.Configuration.PreferredProviders
+	if len(preferred) == 0 {
+		return chainstateClient.Broadcast(ctx, syncTx.ID, txHex, defaultBroadcastTimeout)
+	}
+
+	provider, err := chainstateClient.BroadcastWithProviders(ctx, syncTx.ID, txHex, preferred, defaultBroadcastTimeout)
+	if err == nil || syncTx.Configuration.RequirePreferred {
+		return provider, err
+	}
+
+	syncTx.Client().Logger().Warn(ctx, fmt.Sprintf(
+		"broadcast of tx %s to the preferred providers %v failed, using all the providers: %s",
+		syncTx.ID, preferred, err.Error(),
+	))
+	return chainstateClient.Broadcast(ctx, syncTx.ID, txHex, defaultBroadcastTimeout)
+}
+
+// processBroadcastConfirmations will confirm that seen (broadcast) transactions are on the network
+func processBroadcastConfirmations(ctx context.Context, maxTransactions int, opts ...ModelOps) error {
+	queryParams := &datastore.QueryParams{
+		Page:          1,
+		PageSize:      maxTransactions,
+		OrderByField:  createdAtField,
+		SortDirection: datastore.SortAsc,
+	}
+
+	// Get x records
+	records, err := getTransactionsToConfirmBroadcast(
+		ctx, queryParams, opts...,
+	)
+	if err != nil {
+		return err
+	} else if len(records) == 0 {
+		return nil
+	}
+
+	// Confirm each broadcast
+	for index := range records {
+		if err = processBroadcastConfirmation(
+			ctx, records[index],
+		); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// processBroadcastConfirmation will check that a seen transaction is in the mempool or on-chain
+//
+// If the transaction vanished, the broadcast status is set back to ready (to be broadcast again)
+func processBroadcastConfirmation(ctx context.Context, syncTx *SyncTransaction) error {
+	// Create the lock and set the release for after the function completes
+	unlock, err := newWriteLock(
+		ctx, fmt.Sprintf(lockKeyProcessBroadcastTx, syncTx.GetID()), syncTx.Client().Cachestore(),
+	)
+	defer unlock()
+	if err != nil {
+		return err
+	}
+
+	// Find in the mempool or on-chain
+	var txInfo *chainstate.TransactionInfo
+	if txInfo, err = syncTx.Client().Chainstate().QueryTransaction(
+		ctx, syncTx.ID, chainstate.RequiredInMempool, defaultQueryTxTimeout,
+	); err != nil {
+		if errors.Is(err, chainstate.ErrTransactionNotFound) {
+			if err = bailAndSaveSyncTransaction(
+				ctx, syncTx, SyncStatusReady, syncActionBroadcast, "all",
+				"transaction not found in mempool or on-chain after broadcast",
+			); err != nil {
+				logBailFailure(ctx, syncTx, syncActionBroadcast, err)
+			}
+			return err
+		}
+		return err
+	} else if txInfo == nil {
+		return nil
+	}
+
+	// Create status message
+	message := "broadcast confirmed on the network by " + txInfo.Provider
+
+	// Update the sync information
+	syncTx.BroadcastStatus = SyncStatusComplete
+	syncTx.Results.LastMessage = message
+	syncTx.Results.Results = append(syncTx.Results.Results, &SyncResult{
+		Action:        syncActionBroadcast,
+		ExecutedAt:    time.Now().UTC(),
+		Provider:      txInfo.Provider,
+		StatusMessage: message,
+	})
+
+	// Update the sync transaction record
+	if err = syncTx.Save(ctx); err != nil {
+		if bailErr := bailAndSaveSyncTransaction(
+			ctx, syncTx, SyncStatusError, syncActionBroadcast, "internal", err.Error(),
+		); bailErr != nil {
+			logBailFailure(ctx, syncTx, syncActionBroadcast, bailErr)
+		}
+		return err
+	}
+
+	return nil
+}
+
 // processSyncTransaction will process the sync transaction record, or save the failure
 func processSyncTransaction(ctx context.Context, syncTx *SyncTransaction, transaction *Transaction) error {
 	// Successfully capture any panics, convert to readable string and log the error
@@ -647,10 +915,12 @@ func processSyncTransaction(ctx context.Context, syncTx *SyncTransaction, transa
 		ctx, syncTx.ID, chainstate.RequiredOnChain, defaultQueryTxTimeout,
 	); err != nil {
 		if errors.Is(err, chainstate.ErrTransactionNotFound) {
-			bailAndSaveSyncTransaction(
+			if err = bailAndSaveSyncTransaction(
 				ctx, syncTx, SyncStatusReady, syncActionSync, "all", "transaction not found on-chain",
-			)
-			return nil
+			); err != nil {
+				logBailFailure(ctx, syncTx, syncActionSync, err)
+			}
+			return err
 		}
 		return err
 	}
@@ -668,35 +938,57 @@ func processSyncTransaction(ctx context.Context, syncTx *SyncTransaction, transa
 		return ErrMissingTransaction
 	}
 
-	// Add additional information (if found on-chain)
-	transaction.BlockHash = txInfo.BlockHash
-	transaction.BlockHeight = uint64(txInfo.BlockHeight)
-	transaction.MerkleProof = MerkleProof(*txInfo.MerkleProof)
-
 	// Create status message
 	message := "transaction was found on-chain by " + chainstate.ProviderBroadcastClient
 
-	// Save the transaction (should NOT error)
-	if err = transaction.Save(ctx); err != nil {
-		bailAndSaveSyncTransaction(
+	// Add additional information (if found on-chain) and save the transaction (should NOT error)
+	// If the transaction was changed by another process (IE: metadata), reload it and re-apply the block info
+	if _, err = saveWithReload(ctx, transaction,
+		func(ctx context.Context) (*Transaction, error) {
+			reloaded, reloadErr := getTransactionByID(ctx, "", syncTx.ID, syncTx.GetOptions(false)...)
+			if reloadErr == nil && reloaded == nil {
+				reloadErr = ErrMissingTransaction
+			}
+			return reloaded, reloadErr
+		},
+		func(transaction *Transaction) {
+			transaction.setBlockInfo(txInfo.BlockHash, uint64(txInfo.BlockHeight))
+			transaction.setMinedAt(ctx)
+			transaction.MerkleProof = MerkleProof(*txInfo.MerkleProof)
+		},
+	); err != nil {
+		if bailErr := bailAndSaveSyncTransaction(
 			ctx, syncTx, SyncStatusError, syncActionSync, "internal", err.Error(),
-		)
+		); bailErr != nil {
+			logBailFailure(ctx, syncTx, syncActionSync, bailErr)
+		}
 		return err
 	}
 
-	// Update the sync status
-	syncTx.SyncStatus = SyncStatusComplete
-	syncTx.Results.LastMessage = message
-	syncTx.Results.Results = append(syncTx.Results.Results, &SyncResult{
-		Action:        syncActionSync,
-		ExecutedAt:    time.Now().UTC(),
-		Provider:      chainstate.ProviderBroadcastClient,
-		StatusMessage: message,
-	})
-
-	// Update the sync transaction record
-	if err = syncTx.Save(ctx); err != nil {
-		bailAndSaveSyncTransaction(ctx, syncTx, SyncStatusError, syncActionSync, "internal", err.Error())
+	// Update the sync status (found on-chain also confirms a seen broadcast) and save the sync transaction record
+	if _, err = saveWithReload(ctx, syncTx,
+		func(ctx context.Context) (*SyncTransaction, error) {
+			return GetSyncTransactionByID(ctx, syncTx.ID, syncTx.GetOptions(false)...)
+		},
+		func(syncTx *SyncTransaction) {
+			syncTx.SyncStatus = SyncStatusComplete
+			if syncTx.BroadcastStatus == SyncStatusSeen {
+				syncTx.BroadcastStatus = SyncStatusComplete
+			}
+			syncTx.Results.LastMessage = message
+			syncTx.Results.Results = append(syncTx.Results.Results, &SyncResult{
+				Action:        syncActionSync,
+				ExecutedAt:    time.Now().UTC(),
+				Provider:      chainstate.ProviderBroadcastClient,
+				StatusMessage: message,
+			})
+		},
+	); err != nil {
+		if bailErr := bailAndSaveSyncTransaction(
+			ctx, syncTx, SyncStatusError, syncActionSync, "internal", err.Error(),
+		); bailErr != nil {
+			logBailFailure(ctx, syncTx, syncActionSync, bailErr)
+		}
 		return err
 	}
 
@@ -705,33 +997,87 @@ func processSyncTransaction(ctx context.Context, syncTx *SyncTransaction, transa
 }
 
 // processP2PTransactions will process transactions for p2p notifications
+//
+// The ready records are paged by keyset (the records processed meanwhile do not shift the pages), the transactions
+// of a page are loaded with one query. The records of the endpoints backing off are skipped
 func processP2PTransactions(ctx context.Context, maxTransactions int, opts ...ModelOps) error {
-	queryParams := &datastore.QueryParams{
-		Page:          1,
-		PageSize:      maxTransactions,
-		OrderByField:  "created_at",
-		SortDirection: "asc",
+	if err := readyP2PWithoutBroadcast(ctx, maxTransactions, opts...); err != nil {
+		return err
 	}
 
-	// Get x records
-	records, err := getTransactionsToNotifyP2P(
-		ctx, queryParams, opts...,
+	processed := 0
+	var transactions map[string]*Transaction
+	err := forEachKeysetRecord(ctx, map[string]interface{}{
+		p2pStatusField: SyncStatusReady.String(),
+	}, maxTransactions,
+		func(ctx context.Context, conditions map[string]interface{}, queryParams *datastore.QueryParams) ([]keysetRecord, error) {
+			syncTxs, err := getSyncTransactionsByConditions(ctx, conditions, queryParams, opts...)
+			if err != nil {
+				return nil, err
+			}
+			records := make([]keysetRecord, 0, len(syncTxs))
+			ids := make([]string, 0, len(syncTxs))
+			for _, syncTx := range syncTxs {
+				records = append(records, syncTx)
+				ids = append(ids, syncTx.ID)
+			}
+			if transactions, err = getTransactionsByIDs(ctx, ids, opts...); err != nil {
+				return nil, err
+			}
+			return records, nil
+		}, func(record keysetRecord) error {
+			syncTx := record.(*SyncTransaction)
+			transaction := transactions[syncTx.ID]
+			if transaction == nil {
+				return nil
+			}
+
+			inBackoff, err := p2pEndpointsInBackoff(ctx, syncTx, transaction)
+			if err != nil {
+				return err
+			} else if inBackoff {
+				return nil
+			}
+
+			processed++
+			if err = processP2PTransaction(ctx, syncTx, transaction); err != nil {
+				return err
+			} else if processed >= maxTransactions {
+				return errKeysetStop
+			}
+			return nil
+		},
+		opts...,
 	)
+	if errors.Is(err, errKeysetStop) {
+		return nil
+	}
+	return err
+}
+
+// readyP2PWithoutBroadcast will make the pending p2p of the records with a skipped broadcast ready
+//
+// The p2p waits for the broadcast, it would stay pending forever if the broadcast is skipped
+func readyP2PWithoutBroadcast(ctx context.Context, maxTransactions int, opts ...ModelOps) error {
+	syncTxs, err := getSyncTransactionsByConditions(ctx, map[string]interface{}{
+		broadcastStatusField: SyncStatusSkipped.String(),
+		p2pStatusField:       SyncStatusPending.String(),
+	}, &datastore.QueryParams{
+		Page:          1,
+		PageSize:      maxTransactions,
+		OrderByField:  createdAtField,
+		SortDirection: datastore.SortAsc,
+	}, opts...)
 	if err != nil {
 		return err
-	} else if len(records) == 0 {
-		return nil
 	}
 
-	// Process the incoming transaction
-	for index := range records {
-		if err = processP2PTransaction(
-			ctx, records[index], nil,
-		); err != nil {
+	for _, syncTx := range syncTxs {
+		syncTx.P2PStatus = SyncStatusReady
+		if err = syncTx.Save(ctx); err != nil {
 			return err
 		}
 	}
-
 	return nil
 }
 
@@ -767,20 +1113,73 @@ func processP2PTransaction(ctx context.Context, syncTx *SyncTransaction, transac
 		}
 	}
 
-	// No draft?
-	if len(transaction.DraftID) == 0 {
-		bailAndSaveSyncTransaction(
-			ctx, syncTx, SyncStatusComplete, syncActionP2P, "all", "no draft found, cannot complete p2p",
-		)
-		return nil
+	// No draft and no P2P targets (IE: recorded from hex without WithP2PTargets): nobody can be notified
+	if len(transaction.DraftID) == 0 && len(syncTx.Configuration.P2PTargets) == 0 {
+		syncTx.Client().Logger().Warn(ctx, "p2p of tx "+syncTx.ID+" is skipped: no draft or p2p targets found")
+		if err = bailAndSaveSyncTransaction(
+			ctx, syncTx, SyncStatusComplete, syncActionP2P, "all", "no draft or p2p targets found, p2p skipped",
+		); err != nil {
+			logBailFailure(ctx, syncTx, syncActionP2P, err)
+		}
+		return err
+	}
+
+	// Deferred on-chain (the payload is too large): the payload is not sent again
+	if last := syncTx.Results.LastForAction(syncActionP2P); last != nil && last.P2PStrategy == P2PStrategyOnChain {
+		if !isFetchableOnChain(syncTx, transaction) {
+			return nil
+		}
+		return completeP2POnChain(ctx, syncTx)
 	}
 
 	// Notify any P2P paymail providers associated to the transaction
 	var results []*SyncResult
-	if results, err = notifyPaymailProviders(ctx, transaction); err != nil {
-		bailAndSaveSyncTransaction(
+	if results, err = notifyPaymailProviders(ctx, syncTx, transaction); err != nil {
+		if errors.Is(err, ErrPaymailProviderInBackoff) { // Deferred to the next run (the record stays ready)
+			syncTx.Client().Logger().Info(ctx, "p2p of tx "+syncTx.ID+" is deferred: "+err.Error())
+			return nil
+		} else if errors.Is(err, ErrP2PPayloadTooLarge) { // Deferred until the receiver can fetch it on-chain
+			syncTx.Client().Logger().Info(ctx, "p2p of tx "+syncTx.ID+" is deferred on-chain: "+err.Error())
+			syncTx.Results.Results = append(syncTx.Results.Results, results...)
+			syncTx.Results.Results = append(syncTx.Results.Results, &SyncResult{
+				Action:        syncActionP2P,
+				ExecutedAt:    time.Now().UTC(),
+				P2PStrategy:   P2PStrategyOnChain,
+				Provider:      "all",
+				StatusMessage: "deferred until on-chain: " + err.Error(),
+			})
+			if !isFetchableOnChain(syncTx, transaction) { // The record stays ready
+				syncTx.Results.LastMessage = "p2p deferred until the transaction is on-chain"
+				return syncTx.Save(ctx)
+			}
+			return completeP2POnChain(ctx, syncTx)
+		}
+		syncTx.Results.Results = append(syncTx.Results.Results, results...)
+
+		// The failures are counted in the datastore (atomic)
+		failures, incrementErr := incrementField(ctx, syncTx, p2pFailuresField, 1)
+		if incrementErr != nil {
+			logBailFailure(ctx, syncTx, syncActionP2P, incrementErr)
+			failures = int64(syncTx.P2PFailures) + 1
+		}
+		syncTx.P2PFailures = uint32(failures)
+
+		// Too many failures: failed (terminal), the recipient must be contacted out-of-band
+		if limit := syncTx.Client().PaymailP2PFailureLimit(); limit > 0 && syncTx.P2PFailures >= limit {
+			if bailErr := bailAndSaveSyncTransaction(
+				ctx, syncTx, SyncStatusError, syncActionP2P, "",
+				fmt.Sprintf("p2p failed after %d attempts: %s", syncTx.P2PFailures, err.Error()),
+			); bailErr != nil {
+				logBailFailure(ctx, syncTx, syncActionP2P, bailErr)
+			}
+			notify(ctx, notifications.EventTypeP2PFailed, syncTx)
+			return err
+		}
+		if bailErr := bailAndSaveSyncTransaction(
 			ctx, syncTx, SyncStatusReady, syncActionP2P, "", err.Error(),
-		)
+		); bailErr != nil {
+			logBailFailure(ctx, syncTx, syncActionP2P, bailErr)
+		}
 		return err
 	}
 
@@ -793,9 +1192,11 @@ func processP2PTransaction(ctx context.Context, syncTx *SyncTransaction, transac
 	// Save the record
 	syncTx.P2PStatus = SyncStatusComplete
 	if err = syncTx.Save(ctx); err != nil {
-		bailAndSaveSyncTransaction(
+		if bailErr := bailAndSaveSyncTransaction(
 			ctx, syncTx, SyncStatusError, syncActionP2P, "internal", err.Error(),
-		)
+		); bailErr != nil {
+			logBailFailure(ctx, syncTx, syncActionP2P, bailErr)
+		}
 		return err
 	}
 
@@ -803,10 +1204,98 @@ func processP2PTransaction(ctx context.Context, syncTx *SyncTransaction, transac
 	return nil
 }
 
+// isFetchableOnChain will return true if the receiver can fetch the transaction from the network
+// (synced, or broadcast if the sync is skipped)
+func isFetchableOnChain(syncTx *SyncTransaction, transaction *Transaction) bool {
+	if len(transaction.BlockHash) > 0 || syncTx.SyncStatus == SyncStatusComplete {
+		return true
+	}
+	return syncTx.SyncStatus == SyncStatusSkipped && syncTx.BroadcastStatus == SyncStatusComplete
+}
+
+// completeP2POnChain will complete the P2P deferred on-chain (the payload was too large for the receiver)
+func completeP2POnChain(ctx context.Context, syncTx *SyncTransaction) error {
+	syncTx.Results.Results = append(syncTx.Results.Results, &SyncResult{
+		Action:        syncActionP2P,
+		ExecutedAt:    time.Now().UTC(),
+		P2PStrategy:   P2PStrategyOnChain,
+		Provider:      "all",
+		StatusMessage: "success: the receiver fetches the transaction on-chain",
+	})
+	syncTx.Results.LastMessage = "p2p completed on-chain"
+	syncTx.P2PStatus = SyncStatusComplete
+	if err := syncTx.Save(ctx); err != nil {
+		if bailErr := bailAndSaveSyncTransaction(
+			ctx, syncTx, SyncStatusError, syncActionP2P, "internal", err.Error(),
+		); bailErr != nil {
+			logBailFailure(ctx, syncTx, syncActionP2P, bailErr)
+		}
+		return err
+	}
+	return nil
+}
+
+// processBroadcastRejection will save the rejection and act on the normalized reason
+//
+// double spend: failed immediately (no sync or p2p) and the conflict is notified
+// fee too low: failed, a fee bump (child pays for parent) is suggested and the rejection is returned
+// (errors.Is(err, chainstate.ErrBroadcastFeeTooLow))
+// provider unavailable: the broadcast is retried later
+func processBroadcastRejection(ctx context.Context, syncTx *SyncTransaction, provider string,
+	rejection *chainstate.BroadcastRejection,
+) error {
+	status := SyncStatusError
+	message := "broadcast error: " + rejection.Error()
+
+	switch rejection.Reason {
+	case chainstate.RejectionProviderUnavailable:
+		status = SyncStatusReady
+		message = "broadcast provider unavailable, retrying later: " + rejection.Error()
+	case chainstate.RejectionDoubleSpend:
+		if syncTx.P2PStatus != SyncStatusComplete {
+			syncTx.P2PStatus = SyncStatusCanceled
+		}
+		syncTx.SyncStatus = SyncStatusCanceled
+	case chainstate.RejectionFeeTooLow:
+		message = "broadcast fee too low, a fee bump (child pays for parent) is suggested: " + rejection.Error()
+	}
+
+	syncTx.BroadcastStatus = status
+	syncTx.LastAttempt = customTypes.NullTime{
+		NullTime: sql.NullTime{
+			Time:  time.Now().UTC(),
+			Valid: true,
+		},
+	}
+	syncTx.Results.LastMessage = message
+	syncTx.Results.Results = append(syncTx.Results.Results, &SyncResult{
+		Action:             syncActionBroadcast,
+		ExecutedAt:         time.Now().UTC(),
+		PreferredProviders: syncTx.Configuration.PreferredProviders,
+		Provider:           provider,
+		RejectionReason:    rejection.Reason,
+		StatusMessage:      message,
+	})
+	_ = syncTx.Save(ctx)
+
+	// Trigger the conflict flow
+	if rejection.Reason == chainstate.RejectionDoubleSpend {
+		notify(ctx, notifications.EventTypeDoubleSpend, syncTx)
+	}
+
+	// Surface the rejection that needs a fee bump (the others are retried or handled by the conflict flow)
+	if errors.Is(rejection, chainstate.ErrBroadcastFeeTooLow) {
+		return fmt.Errorf("tx %s needs a fee bump: %w", syncTx.ID, rejection)
+	}
+	return nil
+}
+
 // bailAndSaveSyncTransaction will save the error message for a sync tx
+//
+// The save is retried (see saveBailedSyncTransaction), the error is returned if the status change could not be saved
 func bailAndSaveSyncTransaction(ctx context.Context, syncTx *SyncTransaction, status SyncStatus,
 	action, provider, message string,
-) {
+) error {
 	if action == syncActionSync {
 		syncTx.SyncStatus = status
 	} else if action == syncActionP2P {
@@ -827,12 +1316,70 @@ func bailAndSaveSyncTransaction(ctx context.Context, syncTx *SyncTransaction, st
 		Provider:      provider,
 		StatusMessage: message,
 	})
-	_ = syncTx.Save(ctx)
+	return saveBailedSyncTransaction(ctx, syncTx)
+}
+
+// saveBailedSyncTransaction will save the bailed sync tx, retrying a transient failure (IE: the datastore is
+// briefly down) up to defaultBailSaveRetries times
+//
+// A stale record is not retried (saved by another process, the bail is outdated)
+func saveBailedSyncTransaction(ctx context.Context, syncTx *SyncTransaction) error {
+	err := syncTx.Save(ctx)
+	for attempt := 1; err != nil && !errors.Is(err, ErrStaleModel) && attempt <= defaultBailSaveRetries; attempt++ {
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(time.Duration(attempt) * defaultBailSaveRetryDelay):
+		}
+		err = syncTx.Save(ctx)
+	}
+	return err
+}
+
+// logBailFailure will log the lost status change of a sync tx (the bail could not be saved)
+func logBailFailure(ctx context.Context, syncTx *SyncTransaction, action string, err error) {
+	syncTx.Client().Logger().Error(ctx, fmt.Sprintf(
+		"failed saving the %s status of tx %s: %s", action, syncTx.ID, err.Error(),
+	))
 }
 
 // notifyPaymailProviders will notify any associated Paymail providers
-func notifyPaymailProviders(ctx context.Context, transaction *Transaction) ([]*SyncResult, error) {
-	// First get the draft tx
+func notifyPaymailProviders(ctx context.Context, syncTx *SyncTransaction, transaction *Transaction) ([]*SyncResult, error) {
+	// First get the targets (the draft tx or the sync config)
+	targets, err := getP2PTargets(ctx, syncTx, transaction)
+	if err != nil {
+		return nil, err
+	}
+
+	// Loop each target (paymail output)
+	var attempts []*SyncResult
+	pm := transaction.Client().PaymailClient()
+
+	for _, target := range targets {
+
+		// Notify each provider with the transaction (all the receive endpoints are attempted)
+		var results []*SyncResult
+		_, results, err = finalizeP2PTransaction(
+			ctx,
+			pm,
+			target,
+			transaction,
+		)
+		attempts = append(attempts, results...)
+		if err != nil {
+			return attempts, err
+		}
+	}
+	return attempts, nil
+}
+
+// getP2PTargets will return the P2P notification targets of the transaction: the P2P outputs of the draft, or the
+// targets of the sync config if the transaction was recorded without a draft (see WithP2PTargets)
+func getP2PTargets(ctx context.Context, syncTx *SyncTransaction, transaction *Transaction) ([]*PaymailP4, error) {
+	if len(transaction.DraftID) == 0 {
+		return syncTx.Configuration.P2PTargets, nil
+	}
+
 	draftTx, err := getDraftTransactionID(
 		ctx,
 		transaction.XPubID,
@@ -842,33 +1389,70 @@ func notifyPaymailProviders(ctx context.Context, transaction *Transaction) ([]*S
 	if err != nil {
 		return nil, err
 	} else if draftTx == nil {
-		return nil, errors.New("draft not found: " + transaction.DraftID)
+		return nil, fmt.Errorf("%w: %s", ErrDraftNotFound, transaction.DraftID)
 	}
 
-	// Loop each output looking for paymail outputs
-	var attempts []*SyncResult
-	pm := transaction.Client().PaymailClient()
-	var payload *paymail.P2PTransactionPayload
-
+	var targets []*PaymailP4
 	for _, out := range draftTx.Configuration.Outputs {
 		if out.PaymailP4 != nil && out.PaymailP4.ResolutionType == ResolutionTypeP2P {
+			targets = append(targets, out.PaymailP4)
+		}
+	}
+	return targets, nil
+}
 
-			// Notify each provider with the transaction
-			if payload, err = finalizeP2PTransaction(
-				ctx,
-				pm,
-				out.PaymailP4,
-				transaction,
-			); err != nil {
-				return nil, err
+// newP2PTargetsSyncTransaction will create the sync transaction notifying the P2P targets of a transaction recorded
+// without a draft (see WithP2PTargets)
+//
+// The transaction is not broadcast by bux (the recorder did), the targets are ready to be notified
+func newP2PTargetsSyncTransaction(transaction *Transaction) *SyncTransaction {
+	sync := newSyncTransaction(
+		transaction.GetID(),
+		transaction.Client().DefaultSyncConfig(),
+		transaction.GetOptions(true)...,
+	)
+	sync.BroadcastStatus = SyncStatusSkipped
+	sync.Configuration.P2PTargets = transaction.p2pTargets
+	sync.Configuration.PaymailP2P = true
+	sync.P2PStatus = SyncStatusReady
+	sync.Metadata = transaction.Metadata
+	return sync
+}
+
+// validateP2PTargets will check that every P2P target has a receive endpoint and a reference ID, and that the
+// transaction pays every output of the target resolution
+func validateP2PTargets(targets []*PaymailP4, tx *bt.Tx) error {
+	for _, target := range targets {
+		if len(target.ReferenceID) == 0 {
+			return fmt.Errorf("%w: %s@%s", ErrInvalidP2PTarget, target.Alias, target.Domain)
+		}
+		for _, endpoint := range target.getReceiveEndpoints() {
+			if len(endpoint.URL) == 0 {
+				return fmt.Errorf("%w: %s@%s", ErrInvalidP2PTarget, target.Alias, target.Domain)
+			}
+		}
+		if target.Resolution == nil || len(target.Resolution.Outputs) == 0 {
+			return fmt.Errorf("%w: %s@%s", ErrP2PTargetNotPaid, target.Alias, target.Domain)
+		}
+		for _, output := range target.Resolution.Outputs {
+			if !paysOutput(tx, output) {
+				return fmt.Errorf("%w: %s@%s", ErrP2PTargetNotPaid, target.Alias, target.Domain)
 			}
-			attempts = append(attempts, &SyncResult{
-				Action:        syncActionP2P,
-				ExecutedAt:    time.Now().UTC(),
-				Provider:      out.PaymailP4.ReceiveEndpoint,
-				StatusMessage: "success: " + payload.TxID,
-			})
 		}
 	}
-	return attempts, nil
+	return nil
+}
+
+// paysOutput will return true if the transaction has an output with the locking script and (at least) the satoshis
+// of the resolved output
+func paysOutput(tx *bt.Tx, output *PaymailResolutionOutput) bool {
+	if tx == nil {
+		return false
+	}
+	for _, txOutput := range tx.Outputs {
+		if txOutput.LockingScriptHexString() == output.Script && txOutput.Satoshis >= output.Satoshis {
+			return true
+		}
+	}
+	return false
 }
@@ -1,9 +1,21 @@
 package bux
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"net/http"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/BuxOrg/bux/chainstate"
+	"github.com/BuxOrg/bux/utils"
+	"github.com/jarcoal/httpmock"
+	"github.com/libsv/go-bt/v2"
+	"github.com/libsv/go-bt/v2/bscript"
+	"github.com/mrz1836/go-datastore"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -24,6 +36,39 @@ func TestSyncTransaction_GetModelName(t *testing.T) {
 	})
 }
 
+// TestGetSyncTransactionByID will test the method GetSyncTransactionByID()
+func TestGetSyncTransactionByID(t *testing.T) {
+	t.Parallel()
+
+	ctx, client, deferMe := CreateTestSQLiteClient(t, false, true, WithCustomTaskManager(&taskManagerMockBase{}))
+	defer deferMe()
+
+	t.Run("not found", func(t *testing.T) {
+		syncTx, err := GetSyncTransactionByID(ctx, testTxID, client.DefaultModelOptions()...)
+		require.ErrorIs(t, err, ErrSyncTransactionNotFound)
+		assert.Nil(t, syncTx)
+	})
+
+	t.Run("found", func(t *testing.T) {
+		syncTx := newSyncTransaction(testTxID2, &SyncConfig{Broadcast: true}, append(client.DefaultModelOptions(), New())...)
+		require.NoError(t, syncTx.Save(ctx))
+
+		got, err := GetSyncTransactionByID(ctx, testTxID2, client.DefaultModelOptions()...)
+		require.NoError(t, err)
+		require.NotNil(t, got)
+		assert.Equal(t, testTxID2, got.ID)
+	})
+
+	t.Run("duplicates cannot be created", func(t *testing.T) {
+		syncTx := newSyncTransaction(testTxID3, &SyncConfig{Broadcast: true}, append(client.DefaultModelOptions(), New())...)
+		require.NoError(t, syncTx.Save(ctx))
+
+		syncTx = newSyncTransaction(testTxID3, &SyncConfig{Broadcast: true}, append(client.DefaultModelOptions(), New())...)
+		err := syncTx.Save(ctx)
+		require.ErrorIs(t, err, ErrDuplicateSyncTransaction)
+	})
+}
+
 func Test_areParentsBroadcast(t *testing.T) {
 	ctx, client, deferMe := CreateTestSQLiteClient(t, false, true, WithCustomTaskManager(&taskManagerMockBase{}))
 	defer deferMe()
@@ -101,3 +146,776 @@ func Test_areParentsBroadcast(t *testing.T) {
 		})
 	}
 }
+
+// Test_getBroadcastGroup_unconfirmedChain will test deferring transactions that exceed the unconfirmed chain limit
+func Test_getBroadcastGroup_unconfirmedChain(t *testing.T) {
+	ctx, client, deferMe := CreateTestSQLiteClient(t, false, true,
+		WithCustomTaskManager(&taskManagerMockBase{}),
+		WithMaxUnconfirmedChain(1),
+	)
+	defer deferMe()
+
+	opts := client.DefaultModelOptions()
+
+	// testTxHex spends testTx2Hex (both unconfirmed)
+	tx := newTransaction(testTx2Hex, append(opts, New())...)
+	require.NoError(t, tx.Save(ctx))
+	assert.Equal(t, uint32(0), tx.UnconfirmedDepth)
+	parentID := tx.ID
+
+	tx = newTransaction(testTxHex, append(opts, New())...)
+	require.NoError(t, tx.Save(ctx))
+	assert.Equal(t, uint32(1), tx.UnconfirmedDepth)
+
+	// the child of testTxHex is one level too deep
+	childTx := bt.NewTx()
+	require.NoError(t, childTx.From(testTxID, 0, "76a91413473d21dc9e1fb392f05a028b447b165a052d4d88ac", 300000))
+	require.NoError(t, childTx.PayToAddress(testExternalAddress, 299000))
+	child := newTransaction(childTx.String(), append(opts, New())...)
+	require.NoError(t, child.Save(ctx))
+	assert.Equal(t, uint32(2), child.UnconfirmedDepth)
+
+	for _, id := range []string{testTxID, child.ID} {
+		syncTx := newSyncTransaction(id, &SyncConfig{Broadcast: true}, append(opts, New())...)
+		require.NoError(t, syncTx.Save(ctx))
+
+		xPubID, ready, err := getBroadcastGroup(ctx, syncTx, client.MaxUnconfirmedChain(), opts...)
+		require.NoError(t, err)
+		assert.Empty(t, xPubID)
+		assert.Equal(t, id == testTxID, ready, id)
+	}
+
+	// the recorded depth is stale once testTx2Hex is mined, the ancestors are checked
+	require.NoError(t, gormDB(client.Datastore()).Table(client.Datastore().GetTableName(tableTransactions)).
+		Where(map[string]interface{}{idField: parentID}).
+		Update(blockHeightField, 800000).Error)
+	syncTx, err := GetSyncTransactionByID(ctx, child.ID, opts...)
+	require.NoError(t, err)
+	_, ready, err := getBroadcastGroup(ctx, syncTx, client.MaxUnconfirmedChain(), opts...)
+	require.NoError(t, err)
+	assert.True(t, ready)
+}
+
+// Test_processBroadcastConfirmation will test the method processBroadcastConfirmation()
+func Test_processBroadcastConfirmation(t *testing.T) {
+	t.Parallel()
+
+	t.Run("seen transaction is confirmed", func(t *testing.T) {
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, true,
+			WithCustomTaskManager(&taskManagerMockBase{}),
+			WithCustomChainstate(&chainStateEverythingInMempool{}),
+		)
+		defer deferMe()
+
+		syncTx := newSyncTransaction(testTxID, &SyncConfig{Broadcast: true}, append(client.DefaultModelOptions(), New())...)
+		syncTx.BroadcastStatus = SyncStatusSeen
+		require.NoError(t, syncTx.Save(ctx))
+
+		err := processBroadcastConfirmations(ctx, 10, client.DefaultModelOptions()...)
+		require.NoError(t, err)
+
+		var got *SyncTransaction
+		got, err = GetSyncTransactionByID(ctx, testTxID, client.DefaultModelOptions()...)
+		require.NoError(t, err)
+		require.NotNil(t, got)
+		assert.Equal(t, SyncStatusComplete, got.BroadcastStatus)
+	})
+
+	t.Run("vanished transaction is ready again", func(t *testing.T) {
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, true,
+			WithCustomTaskManager(&taskManagerMockBase{}),
+			WithCustomChainstate(&chainStateTransactionNotFound{}),
+		)
+		defer deferMe()
+
+		syncTx := newSyncTransaction(testTxID, &SyncConfig{Broadcast: true}, append(client.DefaultModelOptions(), New())...)
+		syncTx.BroadcastStatus = SyncStatusSeen
+		require.NoError(t, syncTx.Save(ctx))
+
+		err := processBroadcastConfirmation(ctx, syncTx)
+		require.NoError(t, err)
+
+		var got *SyncTransaction
+		got, err = GetSyncTransactionByID(ctx, testTxID, client.DefaultModelOptions()...)
+		require.NoError(t, err)
+		require.NotNil(t, got)
+		assert.Equal(t, SyncStatusReady, got.BroadcastStatus)
+		assert.Equal(t, "transaction not found in mempool or on-chain after broadcast", got.Results.LastMessage)
+	})
+
+	t.Run("complete transactions are untouched", func(t *testing.T) {
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, true,
+			WithCustomTaskManager(&taskManagerMockBase{}),
+			WithCustomChainstate(&chainStateTransactionNotFound{}),
+		)
+		defer deferMe()
+
+		syncTx := newSyncTransaction(testTxID, &SyncConfig{Broadcast: true}, append(client.DefaultModelOptions(), New())...)
+		syncTx.BroadcastStatus = SyncStatusComplete
+		require.NoError(t, syncTx.Save(ctx))
+
+		err := processBroadcastConfirmations(ctx, 10, client.DefaultModelOptions()...)
+		require.NoError(t, err)
+
+		var got *SyncTransaction
+		got, err = GetSyncTransactionByID(ctx, testTxID, client.DefaultModelOptions()...)
+		require.NoError(t, err)
+		require.NotNil(t, got)
+		assert.Equal(t, SyncStatusComplete, got.BroadcastStatus)
+	})
+}
+
+// errDatastoreUnavailable is the error of the flaky datastore
+var errDatastoreUnavailable = errors.New("datastore unavailable")
+
+// flakySyncTxDatastore is a datastore failing the first saves of the sync transactions (IE: briefly down)
+type flakySyncTxDatastore struct {
+	datastore.ClientInterface
+	failures int // Saves left to fail
+	mu       sync.Mutex
+	saves    int // Successful saves
+}
+
+// SaveModel will fail the sync transactions until the failures are used up
+func (d *flakySyncTxDatastore) SaveModel(ctx context.Context, model interface{}, tx *datastore.Transaction,
+	newRecord, commitTx bool,
+) error {
+	if _, ok := model.(*SyncTransaction); ok {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		if d.failures > 0 {
+			d.failures--
+			_ = tx.Rollback()
+			return errDatastoreUnavailable
+		}
+		d.saves++
+	}
+	return d.ClientInterface.SaveModel(ctx, model, tx, newRecord, commitTx)
+}
+
+// Test_bailAndSaveSyncTransaction will test saving the bailed sync transactions on a flaky datastore
+func Test_bailAndSaveSyncTransaction(t *testing.T) {
+	t.Parallel()
+
+	newFlakyClient := func(t *testing.T, failures int) (context.Context, ClientInterface, *flakySyncTxDatastore, func()) {
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, true,
+			WithCustomTaskManager(&taskManagerMockBase{}),
+			WithCustomChainstate(&chainStateTransactionNotFound{}),
+		)
+		syncTx := newSyncTransaction(testTxID, &SyncConfig{Broadcast: true}, append(client.DefaultModelOptions(), New())...)
+		syncTx.BroadcastStatus = SyncStatusSeen
+		require.NoError(t, syncTx.Save(ctx))
+
+		ds := &flakySyncTxDatastore{ClientInterface: client.Datastore(), failures: failures}
+		client.(*Client).options.dataStore.ClientInterface = ds
+		return ctx, client, ds, deferMe
+	}
+
+	t.Run("recovering datastore", func(t *testing.T) {
+		ctx, client, ds, deferMe := newFlakyClient(t, defaultBailSaveRetries)
+		defer deferMe()
+
+		syncTx, err := GetSyncTransactionByID(ctx, testTxID, client.DefaultModelOptions()...)
+		require.NoError(t, err)
+		require.NoError(t, processBroadcastConfirmation(ctx, syncTx))
+		assert.Equal(t, 1, ds.saves)
+
+		var got *SyncTransaction
+		got, err = GetSyncTransactionByID(ctx, testTxID, client.DefaultModelOptions()...)
+		require.NoError(t, err)
+		require.NotNil(t, got)
+		assert.Equal(t, SyncStatusReady, got.BroadcastStatus)
+		assert.Len(t, got.ResultsForAction(syncActionBroadcast), 1)
+	})
+
+	t.Run("datastore down", func(t *testing.T) {
+		ctx, client, ds, deferMe := newFlakyClient(t, defaultBailSaveRetries+1)
+		defer deferMe()
+
+		syncTx, err := GetSyncTransactionByID(ctx, testTxID, client.DefaultModelOptions()...)
+		require.NoError(t, err)
+		err = processBroadcastConfirmation(ctx, syncTx)
+		require.ErrorIs(t, err, errDatastoreUnavailable)
+		assert.Equal(t, 0, ds.saves)
+
+		var got *SyncTransaction
+		got, err = GetSyncTransactionByID(ctx, testTxID, client.DefaultModelOptions()...)
+		require.NoError(t, err)
+		require.NotNil(t, got)
+		assert.Equal(t, SyncStatusSeen, got.BroadcastStatus)
+	})
+}
+
+// Test_processBroadcastRejection will test the method processBroadcastRejection()
+func Test_processBroadcastRejection(t *testing.T) {
+	t.Parallel()
+
+	t.Run("double spend cancels the sync", func(t *testing.T) {
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, true, WithCustomTaskManager(&taskManagerMockBase{}))
+		defer deferMe()
+
+		syncTx := newSyncTransaction(testTxID, &SyncConfig{Broadcast: true, SyncOnChain: true}, append(client.DefaultModelOptions(), New())...)
+		syncTx.P2PStatus = SyncStatusPending
+		require.NoError(t, syncTx.Save(ctx))
+
+		require.NoError(t, processBroadcastRejection(ctx, syncTx, chainstate.ProviderBroadcastClient, &chainstate.BroadcastRejection{
+			Code: 466, Message: "conflict", Provider: chainstate.ProviderBroadcastClient, Reason: chainstate.RejectionDoubleSpend,
+		}))
+
+		got, err := GetSyncTransactionByID(ctx, testTxID, client.DefaultModelOptions()...)
+		require.NoError(t, err)
+		require.NotNil(t, got)
+		assert.Equal(t, SyncStatusError, got.BroadcastStatus)
+		assert.Equal(t, SyncStatusCanceled, got.SyncStatus)
+		assert.Equal(t, SyncStatusCanceled, got.P2PStatus)
+
+		response := got.LastBroadcastResponse()
+		require.NotNil(t, response)
+		assert.Equal(t, chainstate.RejectionDoubleSpend, response.RejectionReason)
+	})
+
+	t.Run("provider unavailable is retried", func(t *testing.T) {
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, true, WithCustomTaskManager(&taskManagerMockBase{}))
+		defer deferMe()
+
+		syncTx := newSyncTransaction(testTxID, &SyncConfig{Broadcast: true}, append(client.DefaultModelOptions(), New())...)
+		require.NoError(t, syncTx.Save(ctx))
+
+		require.NoError(t, processBroadcastRejection(ctx, syncTx, chainstate.ProviderAll, &chainstate.BroadcastRejection{
+			Message: "connection refused", Provider: chainstate.ProviderAll, Reason: chainstate.RejectionProviderUnavailable,
+		}))
+
+		got, err := GetSyncTransactionByID(ctx, testTxID, client.DefaultModelOptions()...)
+		require.NoError(t, err)
+		require.NotNil(t, got)
+		assert.Equal(t, SyncStatusReady, got.BroadcastStatus)
+		assert.Equal(t, chainstate.RejectionProviderUnavailable, got.LastBroadcastResponse().RejectionReason)
+	})
+
+	t.Run("fee too low is returned", func(t *testing.T) {
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, true, WithCustomTaskManager(&taskManagerMockBase{}))
+		defer deferMe()
+
+		syncTx := newSyncTransaction(testTxID, &SyncConfig{Broadcast: true}, append(client.DefaultModelOptions(), New())...)
+		require.NoError(t, syncTx.Save(ctx))
+
+		err := processBroadcastRejection(ctx, syncTx, chainstate.ProviderAll, &chainstate.BroadcastRejection{
+			Code: 465, Message: "fee too low", Provider: chainstate.ProviderAll, Reason: chainstate.RejectionFeeTooLow,
+		})
+		require.ErrorIs(t, err, chainstate.ErrBroadcastFeeTooLow)
+
+		got, err := GetSyncTransactionByID(ctx, testTxID, client.DefaultModelOptions()...)
+		require.NoError(t, err)
+		require.NotNil(t, got)
+		assert.Equal(t, SyncStatusError, got.BroadcastStatus)
+		assert.Equal(t, chainstate.RejectionFeeTooLow, got.LastBroadcastResponse().RejectionReason)
+	})
+}
+
+// Test_processP2PTransaction_p2pTargets will test notifying the P2P targets of the transactions recorded without a draft
+func Test_processP2PTransaction_p2pTargets(t *testing.T) {
+	// t.Parallel() mocking does not allow parallel tests
+
+	const targetScript = "76a914a1fa1d43d5c4b2e5a0d4a4b3b4ed6ee4e2c3e6b188ac"
+
+	newTarget := func() *PaymailP4 {
+		return &PaymailP4{
+			Alias:           testAlias,
+			Domain:          testDomain,
+			ReceiveEndpoint: testServerURL + "/receive-transaction/{alias}@{domain.tld}",
+			ReferenceID:     "z0bac4ec-6f15-42de-9ef4-e60bfdabf4f7",
+			Resolution: &PaymailResolution{
+				Outputs:   []*PaymailResolutionOutput{{Satoshis: 50, Script: targetScript}},
+				Reference: "z0bac4ec-6f15-42de-9ef4-e60bfdabf4f7",
+			},
+		}
+	}
+
+	// newTargetsClient will return a client with an xPub and a transaction paying to its destination
+	newTargetsClient := func(t *testing.T, opts ...ClientOps) (context.Context, ClientInterface, *Fixtures, string) {
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, true, append(opts,
+			WithCustomTaskManager(&taskManagerMockBase{}), WithPaymailClient(newTestPaymailClient(t, []string{testDomain})),
+		)...)
+		t.Cleanup(deferMe)
+		fixtures := NewFixtures(t, client).WithXpub(0).WithDestinations(1)
+
+		parentID, err := utils.RandomHex(32)
+		require.NoError(t, err)
+		tx := bt.NewTx()
+		require.NoError(t, tx.From(parentID, 0, fixtures.Destinations[0].LockingScript, 1000))
+		require.NoError(t, tx.PayToAddress(fixtures.Destinations[0].Address, 850))
+		script, err := bscript.NewFromHexString(targetScript)
+		require.NoError(t, err)
+		tx.AddOutput(&bt.Output{LockingScript: script, Satoshis: 50})
+		return ctx, client, fixtures, tx.String()
+	}
+
+	// notifyTargets will process the P2P of the recorded transaction (the targets must be notified)
+	notifyTargets := func(t *testing.T, ctx context.Context, client ClientInterface, transaction *Transaction) {
+		syncTx, err := GetSyncTransactionByID(ctx, transaction.ID, client.DefaultModelOptions()...)
+		require.NoError(t, err)
+		assert.Equal(t, SyncStatusSkipped, syncTx.BroadcastStatus)
+		assert.Equal(t, SyncStatusReady, syncTx.P2PStatus)
+		require.Len(t, syncTx.Configuration.P2PTargets, 1)
+		assert.Equal(t, newTarget().ReferenceID, syncTx.Configuration.P2PTargets[0].ReferenceID)
+
+		inBackoff, err := p2pEndpointsInBackoff(ctx, syncTx, transaction)
+		require.NoError(t, err)
+		assert.False(t, inBackoff)
+
+		httpmock.Reset()
+		httpmock.RegisterResponder(http.MethodPost, testServerURL+"/receive-transaction/"+testAlias+"@"+testDomain,
+			httpmock.NewStringResponder(http.StatusOK, `{"txid": "`+transaction.ID+`", "note": "thanks"}`),
+		)
+		require.NoError(t, processP2PTransaction(ctx, syncTx, transaction))
+		assert.Equal(t, 1, httpmock.GetTotalCallCount())
+
+		syncTx, err = GetSyncTransactionByID(ctx, transaction.ID, client.DefaultModelOptions()...)
+		require.NoError(t, err)
+		assert.Equal(t, SyncStatusComplete, syncTx.P2PStatus)
+		assert.Equal(t, "notified 1 paymail provider(s)", syncTx.Results.LastMessage)
+	}
+
+	t.Run("recorded with targets", func(t *testing.T) {
+		ctx, client, fixtures, txHex := newTargetsClient(t, WithITCDisabled())
+
+		transaction, err := client.RecordTransaction(ctx, fixtures.RawXpub, txHex, "", WithP2PTargets(newTarget()))
+		require.NoError(t, err)
+		notifyTargets(t, ctx, client, transaction)
+	})
+
+	t.Run("incoming transaction with targets", func(t *testing.T) {
+		ctx, client, fixtures, txHex := newTargetsClient(t)
+
+		transaction, err := client.RecordTransaction(ctx, fixtures.RawXpub, txHex, "", WithP2PTargets(newTarget()))
+		require.NoError(t, err)
+		notifyTargets(t, ctx, client, transaction)
+	})
+
+	t.Run("invalid targets", func(t *testing.T) {
+		ctx, client, fixtures, txHex := newTargetsClient(t, WithITCDisabled())
+
+		target := newTarget()
+		target.ReferenceID = ""
+		_, err := client.RecordTransaction(ctx, fixtures.RawXpub, txHex, "", WithP2PTargets(target))
+		require.ErrorIs(t, err, ErrInvalidP2PTarget)
+
+		target = newTarget()
+		target.ReceiveEndpoint = ""
+		_, err = client.RecordTransaction(ctx, fixtures.RawXpub, txHex, "", WithP2PTargets(target))
+		require.ErrorIs(t, err, ErrInvalidP2PTarget)
+	})
+
+	t.Run("targets not paid by the transaction", func(t *testing.T) {
+		ctx, client, fixtures, txHex := newTargetsClient(t, WithITCDisabled())
+
+		target := newTarget()
+		target.Resolution = nil
+		_, err := client.RecordTransaction(ctx, fixtures.RawXpub, txHex, "", WithP2PTargets(target))
+		require.ErrorIs(t, err, ErrP2PTargetNotPaid)
+
+		target = newTarget()
+		target.Resolution.Outputs[0].Satoshis = 51
+		_, err = client.RecordTransaction(ctx, fixtures.RawXpub, txHex, "", WithP2PTargets(target))
+		require.ErrorIs(t, err, ErrP2PTargetNotPaid)
+
+		target = newTarget()
+		target.Resolution.Outputs[0].Script = "76a914b2fa1d43d5c4b2e5a0d4a4b3b4ed6ee4e2c3e6b188ac"
+		_, err = client.RecordTransaction(ctx, fixtures.RawXpub, txHex, "", WithP2PTargets(target))
+		require.ErrorIs(t, err, ErrP2PTargetNotPaid)
+	})
+
+	t.Run("no draft or targets", func(t *testing.T) {
+		ctx, client, _, txHex := newTargetsClient(t)
+
+		syncTx := newSyncTransaction(testTxID, &SyncConfig{PaymailP2P: true}, append(client.DefaultModelOptions(), New())...)
+		syncTx.P2PStatus = SyncStatusReady
+		require.NoError(t, syncTx.Save(ctx))
+
+		transaction := &Transaction{
+			Model:           *NewBaseModel(ModelTransaction, client.DefaultModelOptions()...),
+			TransactionBase: TransactionBase{Hex: txHex, ID: testTxID},
+		}
+
+		httpmock.Reset()
+		require.NoError(t, processP2PTransaction(ctx, syncTx, transaction))
+		assert.Equal(t, 0, httpmock.GetTotalCallCount())
+
+		got, err := GetSyncTransactionByID(ctx, testTxID, client.DefaultModelOptions()...)
+		require.NoError(t, err)
+		assert.Equal(t, SyncStatusComplete, got.P2PStatus)
+		assert.Equal(t, "no draft or p2p targets found, p2p skipped", got.Results.LastMessage)
+	})
+}
+
+// Test_processBroadcastTransaction_preferredProviders will test broadcasting to the preferred providers (SyncConfig)
+func Test_processBroadcastTransaction_preferredProviders(t *testing.T) {
+	t.Parallel()
+
+	// The preferred provider (SLA miner) fails, the pool accepts everything
+	const (
+		poolProvider = "pool"
+		slaProvider  = "sla-miner"
+	)
+	newScriptedChainstate := func() *chainstate.MockClient {
+		mock := chainstate.NewMockClient()
+		mock.BroadcastProvidersValue = []string{slaProvider, poolProvider}
+		mock.BroadcastWithProvidersFunc = func(context.Context, string, string, []string, time.Duration) (string, error) {
+			return chainstate.ProviderAll, fmt.Errorf("broadcast failed: %w", &chainstate.BroadcastRejection{
+				Message: "connection refused", Provider: slaProvider, Reason: chainstate.RejectionProviderUnavailable,
+			})
+		}
+		mock.BroadcastFunc = func(context.Context, string, string, time.Duration) (string, error) {
+			return poolProvider, nil
+		}
+		return mock
+	}
+
+	// recordWithSync will record a new transaction (of a draft) using the sync config, and return the sync transaction
+	recordWithSync := func(t *testing.T, mock *chainstate.MockClient, config *SyncConfig) (context.Context, *SyncTransaction, error) {
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, true,
+			WithCustomTaskManager(&taskManagerMockBase{}),
+			WithCustomChainstate(mock),
+		)
+		t.Cleanup(deferMe)
+
+		fixtures := NewFixtures(t, client).WithXpub(0).WithUtxos(10000).WithDraft(&TransactionConfig{
+			Outputs: []*TransactionOutput{{
+				To:       testExternalAddress,
+				Satoshis: 1000,
+			}},
+			Sync: config,
+		})
+		signedHex, err := fixtures.Drafts[0].SignInputs(fixtures.HDKey)
+		require.NoError(t, err)
+
+		var transaction *Transaction
+		if transaction, err = client.RecordTransaction(
+			ctx, fixtures.RawXpub, signedHex, fixtures.Drafts[0].ID,
+		); err != nil {
+			return ctx, nil, err
+		}
+
+		var syncTx *SyncTransaction
+		syncTx, err = GetSyncTransactionByID(ctx, transaction.ID, client.DefaultModelOptions()...)
+		require.NoError(t, err)
+		return ctx, syncTx, nil
+	}
+
+	t.Run("fallback to all the providers", func(t *testing.T) {
+		mock := newScriptedChainstate()
+		ctx, syncTx, err := recordWithSync(t, mock, &SyncConfig{
+			Broadcast:          true,
+			PreferredProviders: []string{slaProvider},
+		})
+		require.NoError(t, err)
+
+		require.NoError(t, processBroadcastTransaction(ctx, syncTx))
+		assert.Len(t, mock.Broadcasts(), 2) // Preferred, then all
+
+		var got *SyncTransaction
+		got, err = GetSyncTransactionByID(ctx, syncTx.ID, syncTx.GetOptions(false)...)
+		require.NoError(t, err)
+		assert.Equal(t, SyncStatusSeen, got.BroadcastStatus)
+
+		response := got.LastBroadcastResponse()
+		require.NotNil(t, response)
+		assert.Equal(t, []string{slaProvider}, response.PreferredProviders)
+		assert.Equal(t, poolProvider, response.Provider)
+	})
+
+	t.Run("preferred providers are required", func(t *testing.T) {
+		mock := newScriptedChainstate()
+		ctx, syncTx, err := recordWithSync(t, mock, &SyncConfig{
+			Broadcast:          true,
+			PreferredProviders: []string{slaProvider},
+			RequirePreferred:   true,
+		})
+		require.NoError(t, err)
+
+		require.NoError(t, processBroadcastTransaction(ctx, syncTx))
+		assert.Len(t, mock.Broadcasts(), 1) // No fallback
+
+		var got *SyncTransaction
+		got, err = GetSyncTransactionByID(ctx, syncTx.ID, syncTx.GetOptions(false)...)
+		require.NoError(t, err)
+		assert.Equal(t, SyncStatusReady, got.BroadcastStatus) // Retried later
+
+		response := got.LastBroadcastResponse()
+		require.NotNil(t, response)
+		assert.Equal(t, []string{slaProvider}, response.PreferredProviders)
+		assert.Equal(t, chainstate.RejectionProviderUnavailable, response.RejectionReason)
+	})
+
+	t.Run("preferred provider succeeds", func(t *testing.T) {
+		mock := newScriptedChainstate()
+		mock.BroadcastWithProvidersFunc = nil // First configured preferred provider
+		ctx, syncTx, err := recordWithSync(t, mock, &SyncConfig{
+			Broadcast:          true,
+			PreferredProviders: []string{slaProvider},
+		})
+		require.NoError(t, err)
+
+		require.NoError(t, processBroadcastTransaction(ctx, syncTx))
+		assert.Len(t, mock.Broadcasts(), 1)
+
+		var got *SyncTransaction
+		got, err = GetSyncTransactionByID(ctx, syncTx.ID, syncTx.GetOptions(false)...)
+		require.NoError(t, err)
+		assert.Equal(t, slaProvider, got.LastBroadcastResponse().Provider)
+	})
+
+	t.Run("all the providers are in backoff", func(t *testing.T) {
+		mock := newScriptedChainstate()
+		inBackoff := fmt.Errorf("%w until 2023-10-01T12:00:00Z", chainstate.ErrProvidersInBackoff)
+		mock.BroadcastWithProvidersFunc = func(context.Context, string, string, []string, time.Duration) (string, error) {
+			return "", inBackoff
+		}
+		mock.BroadcastFunc = func(context.Context, string, string, time.Duration) (string, error) {
+			return "", inBackoff
+		}
+		ctx, syncTx, err := recordWithSync(t, mock, &SyncConfig{
+			Broadcast:          true,
+			PreferredProviders: []string{slaProvider},
+		})
+		require.NoError(t, err)
+
+		require.NoError(t, processBroadcastTransaction(ctx, syncTx))
+		assert.Len(t, mock.Broadcasts(), 2) // Preferred, then all
+
+		var got *SyncTransaction
+		got, err = GetSyncTransactionByID(ctx, syncTx.ID, syncTx.GetOptions(false)...)
+		require.NoError(t, err)
+		assert.Equal(t, SyncStatusReady, got.BroadcastStatus) // Deferred
+		assert.Nil(t, got.LastBroadcastResponse())
+	})
+
+	t.Run("unknown provider is rejected at record time", func(t *testing.T) {
+		_, _, err := recordWithSync(t, newScriptedChainstate(), &SyncConfig{
+			Broadcast:          true,
+			PreferredProviders: []string{"unknown-miner"},
+		})
+		require.ErrorIs(t, err, ErrUnknownBroadcastProvider)
+
+		_, _, err = recordWithSync(t, newScriptedChainstate(), &SyncConfig{
+			Broadcast:        true,
+			RequirePreferred: true,
+		})
+		require.ErrorIs(t, err, ErrMissingPreferredProviders)
+	})
+}
+
+// TestSyncTransaction_AfterCreated_instantBroadcast will test the instant broadcast modes (slow broadcast provider)
+func TestSyncTransaction_AfterCreated_instantBroadcast(t *testing.T) {
+	t.Parallel()
+
+	// newSlowChainstate will return a chainstate where the broadcast blocks until released
+	newSlowChainstate := func() (*chainstate.MockClient, chan struct{}, chan string) {
+		release, broadcast := make(chan struct{}), make(chan string, 1)
+		mock := chainstate.NewMockClient()
+		mock.BroadcastFunc = func(_ context.Context, id, _ string, _ time.Duration) (string, error) {
+			<-release
+			broadcast <- id
+			return chainstate.ProviderMock, nil
+		}
+		return mock, release, broadcast
+	}
+
+	// recordInstant will record a new transaction (of a draft) using the instant broadcast
+	recordInstant := func(t *testing.T, mock *chainstate.MockClient, mode InstantBroadcastMode) func() (*Transaction, error) {
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, true,
+			WithCustomTaskManager(&taskManagerMockBase{}),
+			WithCustomChainstate(mock),
+			WithInstantBroadcastMode(mode),
+		)
+		t.Cleanup(deferMe)
+
+		fixtures := NewFixtures(t, client).WithXpub(0).WithUtxos(10000).WithDraft(&TransactionConfig{
+			Outputs: []*TransactionOutput{{
+				To:       testExternalAddress,
+				Satoshis: 1000,
+			}},
+			Sync: &SyncConfig{Broadcast: true, BroadcastInstant: true},
+		})
+		signedHex, err := fixtures.Drafts[0].SignInputs(fixtures.HDKey)
+		require.NoError(t, err)
+
+		return func() (*Transaction, error) {
+			return client.RecordTransaction(ctx, fixtures.RawXpub, signedHex, fixtures.Drafts[0].ID)
+		}
+	}
+
+	t.Run("async: the record is created without waiting for the broadcast", func(t *testing.T) {
+		mock, release, broadcast := newSlowChainstate()
+		record := recordInstant(t, mock, InstantBroadcastAsync)
+
+		transaction, err := record()
+		require.NoError(t, err)
+		require.NotNil(t, transaction)
+		select {
+		case <-broadcast:
+			t.Fatal("the broadcast should not be finished")
+		default:
+		}
+
+		// The broadcast finishes in the background
+		close(release)
+		select {
+		case id := <-broadcast:
+			assert.Equal(t, transaction.ID, id)
+		case <-time.After(5 * time.Second):
+			t.Fatal("the broadcast was not run")
+		}
+	})
+
+	t.Run("sync: the record creation waits for the broadcast", func(t *testing.T) {
+		mock, release, broadcast := newSlowChainstate()
+		record := recordInstant(t, mock, InstantBroadcastSync)
+
+		done := make(chan *Transaction, 1)
+		go func() {
+			transaction, err := record()
+			assert.NoError(t, err)
+			done <- transaction
+		}()
+
+		select {
+		case <-done:
+			t.Fatal("the record creation should wait for the broadcast")
+		case <-time.After(200 * time.Millisecond):
+		}
+
+		close(release)
+		select {
+		case transaction := <-done:
+			require.NotNil(t, transaction)
+			assert.Equal(t, transaction.ID, <-broadcast)
+		case <-time.After(5 * time.Second):
+			t.Fatal("the record was not created")
+		}
+	})
+}
+
+// TestSyncTransaction_ResultsForAction will test the results per action (failed broadcasts, then a success)
+func TestSyncTransaction_ResultsForAction(t *testing.T) {
+	t.Parallel()
+
+	ctx, client, deferMe := CreateTestSQLiteClient(t, false, true, WithCustomTaskManager(&taskManagerMockBase{}))
+	defer deferMe()
+
+	syncTx := newSyncTransaction(testTxID, &SyncConfig{Broadcast: true, SyncOnChain: true}, append(client.DefaultModelOptions(), New())...)
+	require.NoError(t, syncTx.Save(ctx))
+
+	// Two failed broadcasts (retried), a sync in between, then a success
+	for i := 0; i < 2; i++ {
+		require.NoError(t, processBroadcastRejection(ctx, syncTx, chainstate.ProviderAll, &chainstate.BroadcastRejection{
+			Message: "connection refused", Provider: chainstate.ProviderAll, Reason: chainstate.RejectionProviderUnavailable,
+		}))
+	}
+	syncTx.Results.Results = append(syncTx.Results.Results,
+		&SyncResult{Action: syncActionSync, StatusMessage: "transaction not found"},
+		&SyncResult{Action: syncActionBroadcast, Provider: chainstate.ProviderMock, StatusMessage: "broadcast success"},
+	)
+	require.NoError(t, syncTx.Save(ctx))
+
+	got, err := GetSyncTransactionByID(ctx, testTxID, client.DefaultModelOptions()...)
+	require.NoError(t, err)
+	require.NotNil(t, got)
+
+	t.Run("results of an action", func(t *testing.T) {
+		broadcasts := got.ResultsForAction(syncActionBroadcast)
+		require.Len(t, broadcasts, 3)
+		assert.Equal(t, chainstate.RejectionProviderUnavailable, broadcasts[0].RejectionReason)
+		assert.Equal(t, chainstate.RejectionProviderUnavailable, broadcasts[1].RejectionReason)
+		assert.Equal(t, "broadcast success", broadcasts[2].StatusMessage)
+
+		assert.Len(t, got.ResultsForAction(syncActionSync), 1)
+		assert.Empty(t, got.ResultsForAction(syncActionP2P))
+	})
+
+	t.Run("last result of an action", func(t *testing.T) {
+		last := got.LastResultForAction(syncActionBroadcast)
+		require.NotNil(t, last)
+		assert.Equal(t, chainstate.ProviderMock, last.Provider)
+		assert.Equal(t, last, got.LastBroadcastResponse())
+		assert.Nil(t, got.LastResultForAction(syncActionP2P))
+	})
+
+	t.Run("attempts are computed in the json", func(t *testing.T) {
+		assert.Equal(t, map[string]int{syncActionBroadcast: 3, syncActionSync: 1}, got.Results.Attempts())
+
+		raw, err := json.Marshal(got)
+		require.NoError(t, err)
+
+		var decoded struct {
+			Results struct {
+				Attempts map[string]int `json:"attempts"`
+				Results  []*SyncResult  `json:"results"`
+			} `json:"results"`
+		}
+		require.NoError(t, json.Unmarshal(raw, &decoded))
+		assert.Equal(t, 3, decoded.Results.Attempts[syncActionBroadcast])
+		assert.Equal(t, 1, decoded.Results.Attempts[syncActionSync])
+		assert.Len(t, decoded.Results.Results, 4)
+	})
+
+	t.Run("attempts are not stored", func(t *testing.T) {
+		value, err := got.Results.Value()
+		require.NoError(t, err)
+		assert.NotContains(t, value, "attempts")
+
+		var scanned SyncResults
+		require.NoError(t, scanned.Scan(value))
+		assert.Len(t, scanned.Results, 4)
+	})
+}
+
+// TestSyncTransaction_Migrate_queueIndexes will test the planner uses the composite indexes of the sync queries
+func TestSyncTransaction_Migrate_queueIndexes(t *testing.T) {
+	t.Parallel()
+
+	_, client, deferMe := CreateTestSQLiteClient(t, false, false, WithCustomTaskManager(&taskManagerMockBase{}))
+	defer deferMe()
+
+	ds := client.Datastore()
+	tableName := ds.GetTableName(tableSyncTransactions)
+	for _, field := range syncQueueStatusFields {
+		t.Run(field, func(t *testing.T) {
+			var plan []struct {
+				Detail string `gorm:"column:detail"`
+			}
+			require.NoError(t, ds.Raw(`EXPLAIN QUERY PLAN SELECT * FROM "`+tableName+`" WHERE "`+field+
+				`" = 'ready' ORDER BY "`+createdAtField+`" ASC LIMIT 10`).Scan(&plan).Error)
+			require.NotEmpty(t, plan)
+
+			details := make([]string, 0, len(plan))
+			for _, row := range plan {
+				details = append(details, row.Detail)
+			}
+			assert.Contains(t, details[0], syncQueueIndexName(tableName, field))
+			assert.NotContains(t, fmt.Sprint(details), "TEMP B-TREE") // No sort of the matching records
+		})
+	}
+}
+
+// TestSyncTransaction_Migrate_queueIndexes will test the Postgresql planner uses the composite indexes
+// of the sync queries (EXPLAIN, the sequential scan is disabled as the test table is small)
+func (ts *EmbeddedDBTestSuite) TestSyncTransaction_Migrate_queueIndexes() {
+	ts.T().Run("[postgresql] [in-memory] - composite indexes", func(t *testing.T) {
+		tc := ts.genericDBClient(t, datastore.PostgreSQL, false)
+		defer tc.Close(tc.ctx)
+
+		ds := tc.client.Datastore()
+		tableName := ds.GetTableName(tableSyncTransactions)
+		require.NoError(t, ds.Execute("SET enable_seqscan = off").Error)
+
+		for _, field := range syncQueueStatusFields {
+			var plan []string
+			require.NoError(t, ds.Raw(`EXPLAIN SELECT * FROM "`+tableName+`" WHERE "`+field+
+				`" = 'ready' ORDER BY "`+createdAtField+`" ASC LIMIT 10`).Scan(&plan).Error)
+			require.NotEmpty(t, plan)
+			assert.Contains(t, fmt.Sprint(plan), syncQueueIndexName(tableName, field))
+			assert.NotContains(t, fmt.Sprint(plan), "Sort Key")
+		}
+	})
+}
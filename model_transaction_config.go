@@ -10,29 +10,38 @@ import (
 	"strings"
 	"time"
 
+	"github.com/BuxOrg/bux/chainstate"
 	"github.com/BuxOrg/bux/utils"
 	"github.com/bitcoin-sv/go-paymail"
 	magic "github.com/bitcoinschema/go-map"
 	"github.com/libsv/go-bt/v2/bscript"
+	"github.com/libsv/go-bt/v2/sighash"
 	"github.com/mrz1836/go-cachestore"
+	"golang.org/x/sync/singleflight"
 )
 
 // TransactionConfig is the configuration used to start a transaction
 type TransactionConfig struct {
+	AllowExternalInputs        bool                 `json:"allow_external_inputs,omitempty" toml:"allow_external_inputs" yaml:"allow_external_inputs" bson:"allow_external_inputs,omitempty"`             // Allow inputs to be added externally (requires an ANYONECANPAY input)
+	AllowPartialResolution     bool                 `json:"allow_partial_resolution,omitempty" toml:"allow_partial_resolution" yaml:"allow_partial_resolution" bson:"allow_partial_resolution,omitempty"` // Resolve all the outputs, return the failed recipients (OutputsUnresolvedError) and keep the resolved outputs
 	ChangeDestinations         []*Destination       `json:"change_destinations" toml:"change_destinations" yaml:"change_destinations" bson:"change_destinations"`
 	ChangeDestinationsStrategy ChangeStrategy       `json:"change_destinations_strategy" toml:"change_destinations_strategy" yaml:"change_destinations_strategy" bson:"change_destinations_strategy"`
 	ChangeMinimumSatoshis      uint64               `json:"change_minimum_satoshis" toml:"change_minimum_satoshis" yaml:"change_minimum_satoshis" bson:"change_minimum_satoshis"`
 	ChangeNumberOfDestinations int                  `json:"change_number_of_destinations" toml:"change_number_of_destinations" yaml:"change_number_of_destinations" bson:"change_number_of_destinations"`
-	ChangeSatoshis             uint64               `json:"change_satoshis" toml:"change_satoshis" yaml:"change_satoshis" bson:"change_satoshis"` // The satoshis used for change
-	ExpiresIn                  time.Duration        `json:"expires_in" toml:"expires_in" yaml:"expires_in" bson:"expires_in"`                     // The expiration time for the draft and utxos
-	Fee                        uint64               `json:"fee" toml:"fee" yaml:"fee" bson:"fee"`                                                 // The fee used for the transaction (auto generated)
-	FeeUnit                    *utils.FeeUnit       `json:"fee_unit" toml:"fee_unit" yaml:"fee_unit" bson:"fee_unit"`                             // Fee unit to use (overrides chainstate if set)
-	FromUtxos                  []*UtxoPointer       `json:"from_utxos" toml:"from_utxos" yaml:"from_utxos" bson:"from_utxos"`                     // Use these specific utxos for the transaction
-	IncludeUtxos               []*UtxoPointer       `json:"include_utxos" toml:"include_utxos" yaml:"include_utxos" bson:"include_utxos"`         // Include these utxos for the transaction, among others necessary if more is needed for fees
-	Inputs                     []*TransactionInput  `json:"inputs" toml:"inputs" yaml:"inputs" bson:"inputs"`                                     // All transaction inputs
-	Outputs                    []*TransactionOutput `json:"outputs" toml:"outputs" yaml:"outputs" bson:"outputs"`                                 // All transaction outputs
-	SendAllTo                  *TransactionOutput   `json:"send_all_to,omitempty" toml:"send_all_to" yaml:"send_all_to" bson:"send_all_to"`       // Send ALL utxos to the output
-	Sync                       *SyncConfig          `json:"sync" toml:"sync" yaml:"sync" bson:"sync"`                                             // Sync config for broadcasting and on-chain sync
+	ChangeSatoshis             uint64               `json:"change_satoshis" toml:"change_satoshis" yaml:"change_satoshis" bson:"change_satoshis"`                                                         // The satoshis used for change
+	ExpiresIn                  time.Duration        `json:"expires_in" toml:"expires_in" yaml:"expires_in" bson:"expires_in"`                                                                             // The expiration time for the draft and utxos
+	ExternalInputsCount        uint32               `json:"external_inputs_count,omitempty" toml:"external_inputs_count" yaml:"external_inputs_count" bson:"external_inputs_count,omitempty"`             // Number of inputs expected to be added externally (used for the fee)
+	ExternalInputsSatoshis     uint64               `json:"external_inputs_satoshis,omitempty" toml:"external_inputs_satoshis" yaml:"external_inputs_satoshis" bson:"external_inputs_satoshis,omitempty"` // Satoshis expected from the inputs added externally
+	Fee                        uint64               `json:"fee" toml:"fee" yaml:"fee" bson:"fee"`                                                                                                         // The fee used for the transaction (auto generated)
+	FeeCalculator              string               `json:"fee_calculator,omitempty" toml:"fee_calculator" yaml:"fee_calculator" bson:"fee_calculator,omitempty"`                                         // Name of the calculator of the fee (auto generated, see WithFeeCalculator)
+	FeeUnit                    *utils.FeeUnit       `json:"fee_unit" toml:"fee_unit" yaml:"fee_unit" bson:"fee_unit"`                                                                                     // Fee unit to use (overrides chainstate if set)
+	FromUtxos                  []*UtxoPointer       `json:"from_utxos" toml:"from_utxos" yaml:"from_utxos" bson:"from_utxos"`                                                                             // Use these specific utxos for the transaction
+	IncludeAutomaticInputs     bool                 `json:"include_automatic_inputs,omitempty" toml:"include_automatic_inputs" yaml:"include_automatic_inputs" bson:"include_automatic_inputs,omitempty"` // Top up the FromUtxos with automatically selected utxos if more is needed
+	IncludeUtxos               []*UtxoPointer       `json:"include_utxos" toml:"include_utxos" yaml:"include_utxos" bson:"include_utxos"`                                                                 // Include these utxos for the transaction, among others necessary if more is needed for fees
+	Inputs                     []*TransactionInput  `json:"inputs" toml:"inputs" yaml:"inputs" bson:"inputs"`                                                                                             // All transaction inputs (set a utxo pointer and sighash type to override the sighash type)
+	Outputs                    []*TransactionOutput `json:"outputs" toml:"outputs" yaml:"outputs" bson:"outputs"`                                                                                         // All transaction outputs
+	SendAllTo                  *TransactionOutput   `json:"send_all_to,omitempty" toml:"send_all_to" yaml:"send_all_to" bson:"send_all_to"`                                                               // Send ALL utxos to the output
+	Sync                       *SyncConfig          `json:"sync" toml:"sync" yaml:"sync" bson:"sync"`                                                                                                     // Sync config for broadcasting and on-chain sync
 	// Future ideas:
 	// Conditions (utxo strategy, chain limit, split utxos)
 	// NlockTime uint32
@@ -41,7 +50,26 @@ type TransactionConfig struct {
 // TransactionInput is an input on the transaction config
 type TransactionInput struct {
 	Utxo
-	Destination Destination `json:"destination" toml:"destination" yaml:"destination" bson:"destination"`
+	Destination Destination  `json:"destination" toml:"destination" yaml:"destination" bson:"destination"`
+	SigHashType sighash.Flag `json:"sighash_type,omitempty" toml:"sighash_type" yaml:"sighash_type" bson:"sighash_type,omitempty"` // Defaults to SIGHASH_ALL|FORKID
+}
+
+// supportedSigHashTypes are the sighash types that can be used for the inputs
+var supportedSigHashTypes = []sighash.Flag{
+	sighash.AllForkID,
+	sighash.NoneForkID,
+	sighash.SingleForkID,
+	sighash.AllForkID | sighash.AnyOneCanPay,
+	sighash.NoneForkID | sighash.AnyOneCanPay,
+	sighash.SingleForkID | sighash.AnyOneCanPay,
+}
+
+// getSigHashType will return the sighash type for the input (defaults to SIGHASH_ALL|FORKID)
+func (t *TransactionInput) getSigHashType() sighash.Flag {
+	if t.SigHashType == 0 {
+		return sighash.AllForkID
+	}
+	return t.SigHashType
 }
 
 // MapProtocol is a specific MAP protocol interface for an op_return
@@ -103,8 +131,76 @@ type PaymailP4 struct {
 	ReferenceID     string               `json:"reference_id,omitempty" toml:"reference_id" yaml:"reference_id" bson:"reference_id,omitempty"`                 // Reference ID saved from P2P request
 	ResolutionType  string               `json:"resolution_type" toml:"resolution_type" yaml:"resolution_type" bson:"resolution_type,omitempty"`               // Type of address resolution (basic vs p2p)
 	Format          PaymailPayloadFormat `json:"format,omitempty" toml:"format" yaml:"format" bson:"format,omitempty"`                                         // Use beef format for the transaction
+
+	// All the P2P receive endpoints of the recipient in order of preference (the first endpoint is the ReceiveEndpoint)
+	ReceiveEndpoints []*PaymailReceiveEndpoint `json:"receive_endpoints,omitempty" toml:"receive_endpoints" yaml:"receive_endpoints" bson:"receive_endpoints,omitempty"`
+
+	// The P2P payment destination response of the recipient (the evidence of the payment, see GetPaymentAcknowledgment)
+	Resolution *PaymailResolution `json:"resolution,omitempty" toml:"resolution" yaml:"resolution" bson:"resolution,omitempty"`
+}
+
+// PaymailResolution is the P2P payment destination response of the recipient
+type PaymailResolution struct {
+	Outputs    []*PaymailResolutionOutput `json:"outputs" toml:"outputs" yaml:"outputs" bson:"outputs"`                                 // Outputs requested by the recipient
+	PublicKey  string                     `json:"public_key,omitempty" toml:"public_key" yaml:"public_key" bson:"public_key,omitempty"` // PKI public key of the recipient (verifies the signature)
+	Reference  string                     `json:"reference" toml:"reference" yaml:"reference" bson:"reference"`                         // Reference of the payment (created by the recipient)
+	ResolvedAt time.Time                  `json:"resolved_at" toml:"resolved_at" yaml:"resolved_at" bson:"resolved_at"`                 // When the recipient answered
+	Response   string                     `json:"response,omitempty" toml:"response" yaml:"response" bson:"response,omitempty"`         // Raw response of the recipient (JSON)
+	Signature  string                     `json:"signature,omitempty" toml:"signature" yaml:"signature" bson:"signature,omitempty"`     // Signature of the reference by the recipient (if provided)
+}
+
+// PaymailResolutionOutput is an output requested by the recipient (P2P payment destination)
+type PaymailResolutionOutput struct {
+	Address  string `json:"address,omitempty" toml:"address" yaml:"address" bson:"address,omitempty"` // Address of the locking script
+	Satoshis uint64 `json:"satoshis" toml:"satoshis" yaml:"satoshis" bson:"satoshis"`                 // Requested satoshis
+	Script   string `json:"script" toml:"script" yaml:"script" bson:"script"`                         // Locking script (hex)
+}
+
+// PaymailReceiveEndpoint is a P2P receive endpoint of the recipient
+type PaymailReceiveEndpoint struct {
+	Format PaymailPayloadFormat `json:"format,omitempty" toml:"format" yaml:"format" bson:"format,omitempty"` // Payload format for the endpoint
+	URL    string               `json:"url" toml:"url" yaml:"url" bson:"url"`                                 // P2P endpoint when notifying
+}
+
+// getReceiveEndpoints will return the P2P receive endpoints to attempt (in order)
+//
+// Drafts created before the list of endpoints only have the ReceiveEndpoint
+func (p *PaymailP4) getReceiveEndpoints() []*PaymailReceiveEndpoint {
+	if len(p.ReceiveEndpoints) > 0 {
+		return p.ReceiveEndpoints
+	}
+	return []*PaymailReceiveEndpoint{{
+		Format: p.Format,
+		URL:    p.ReceiveEndpoint,
+	}}
+}
+
+// OutputResolution is the normalized result of resolving an output destination (address, paymail or script)
+type OutputResolution struct {
+	Address           string     `json:"address,omitempty" toml:"address" yaml:"address" bson:"address,omitempty"`                                                 // Bitcoin address (address outputs)
+	LockingScript     string     `json:"locking_script,omitempty" toml:"locking_script" yaml:"locking_script" bson:"locking_script,omitempty"`                     // Locking script in hex (not known for paymail until the draft is created)
+	P2PDestinationURL string     `json:"p2p_destination_url,omitempty" toml:"p2p_destination_url" yaml:"p2p_destination_url" bson:"p2p_destination_url,omitempty"` // P2P payment destination endpoint of the paymail provider
+	PaymailP4         *PaymailP4 `json:"paymail_p4,omitempty" toml:"paymail_p4" yaml:"paymail_p4" bson:"paymail_p4,omitempty"`                                     // Paymail information (alias, domain, resolution type & P2P endpoints)
+	ScriptType        string     `json:"script_type,omitempty" toml:"script_type" yaml:"script_type" bson:"script_type,omitempty"`                                 // Type of the locking script
+	To                string     `json:"to" toml:"to" yaml:"to" bson:"to"`                                                                                         // Normalized destination (sanitized paymail, address or script)
+	Type              string     `json:"type" toml:"type" yaml:"type" bson:"type"`                                                                                 // Type of destination (address, paymail or script)
 }
 
+// Types of output destinations
+const (
+	// OutputTypeAddress is a standard Bitcoin address (P2PKH)
+	OutputTypeAddress = "address"
+
+	// OutputTypePaymail is a paymail address (or a known handle format)
+	OutputTypePaymail = "paymail"
+
+	// OutputTypeScript is a raw locking script in hex
+	OutputTypeScript = "script"
+)
+
+// ScriptTypeCustom is the script type of a caller-supplied locking script (never attributed to a destination)
+const ScriptTypeCustom = "custom"
+
 // Types of resolution methods
 const (
 	// ResolutionTypeBasic is for the "deprecated" way to resolve an address from a Paymail
@@ -173,31 +269,187 @@ func (t TransactionConfig) Value() (driver.Value, error) {
 	return string(marshal), nil
 }
 
-// processOutput will inspect the output to determine how to process
-func (t *TransactionOutput) processOutput(ctx context.Context, cacheStore cachestore.ClientInterface,
-	paymailClient paymail.ClientInterface, defaultFromSender, defaultNote string, checkSatoshis bool) error {
+// validateOutputsNetwork will make sure all the output addresses belong to the given network
+func (t *TransactionConfig) validateOutputsNetwork(network chainstate.Network) error {
+	params := networkParams(network)
+	for _, output := range t.Outputs {
+		for _, script := range output.Scripts {
+			if len(script.Address) == 0 {
+				continue
+			}
+			if err := utils.ValidateAddressNetwork(script.Address, params); err != nil {
+				return fmt.Errorf("%w: %s is not a %s address", ErrOutputAddressNetworkMismatch, script.Address, network)
+			}
+		}
+	}
+	return nil
+}
 
-	// Convert known handle formats ($handcash or 1relayx)
-	if strings.Contains(t.To, handleHandcashPrefix) ||
-		(len(t.To) < handleMaxLength && len(t.To) > 1 && t.To[:1] == handleRelayPrefix) {
+// popSigHashOverrides will remove and return the inputs that only set a sighash type (overrides)
+func (t *TransactionConfig) popSigHashOverrides() []*TransactionInput {
+	overrides := make([]*TransactionInput, 0)
+	inputs := make([]*TransactionInput, 0, len(t.Inputs))
+	for _, input := range t.Inputs {
+		if input.SigHashType != 0 {
+			overrides = append(overrides, input)
+		} else {
+			inputs = append(inputs, input)
+		}
+	}
+	if len(overrides) > 0 {
+		t.Inputs = inputs
+	}
+	return overrides
+}
 
-		// Convert the handle and check if it's changed (becomes a paymail address)
-		if p := paymail.ConvertHandle(t.To, false); p != t.To {
-			t.To = p
+// validateSigHashTypes will validate the sighash type overrides and the external inputs
+//
+// Overrides must point to a utxo in FromUtxos or IncludeUtxos
+func (t *TransactionConfig) validateSigHashTypes(overrides []*TransactionInput) error {
+	anyoneCanPay := false
+	for _, input := range overrides {
+		if !isSupportedSigHashType(input.getSigHashType()) {
+			return ErrUnsupportedSigHashType
+		}
+		if !t.hasUtxoPointer(input.TransactionID, input.OutputIndex) {
+			return ErrSigHashInputNotFound
+		}
+		if input.getSigHashType().Has(sighash.AnyOneCanPay) {
+			anyoneCanPay = true
 		}
 	}
 
-	// Check for Paymail, Bitcoin Address or OP Return
-	if len(t.To) > 0 && strings.Contains(t.To, "@") { // Paymail output
-		if checkSatoshis && t.Satoshis <= 0 {
-			return ErrOutputValueTooLow
+	if !t.AllowExternalInputs {
+		if t.ExternalInputsCount > 0 || t.ExternalInputsSatoshis > 0 {
+			return ErrExternalInputsNotAllowed
 		}
-		return t.processPaymailOutput(ctx, cacheStore, paymailClient, defaultFromSender, defaultNote)
-	} else if len(t.To) > 0 { // Standard Bitcoin Address
-		if checkSatoshis && t.Satoshis <= 0 {
+		return nil
+	} else if t.SendAllTo != nil {
+		return ErrExternalInputsNotAllowed
+	} else if !anyoneCanPay {
+		return ErrExternalInputsRequireAnyoneCanPay
+	}
+	return nil
+}
+
+// hasUtxoPointer will return true if the utxo is in FromUtxos or IncludeUtxos
+func (t *TransactionConfig) hasUtxoPointer(txID string, outputIndex uint32) bool {
+	for _, pointer := range append(t.FromUtxos, t.IncludeUtxos...) {
+		if pointer.TransactionID == txID && pointer.OutputIndex == outputIndex {
+			return true
+		}
+	}
+	return false
+}
+
+// getExternalInputsSatoshis will return the satoshis expected from the external inputs (if allowed)
+func (t *TransactionConfig) getExternalInputsSatoshis() uint64 {
+	if !t.AllowExternalInputs {
+		return 0
+	}
+	return t.ExternalInputsSatoshis
+}
+
+// isSupportedSigHashType will return true if the sighash type can be used for an input
+func isSupportedSigHashType(sigHashType sighash.Flag) bool {
+	for _, flag := range supportedSigHashTypes {
+		if flag == sigHashType {
+			return true
+		}
+	}
+	return false
+}
+
+// OutputResolutionFailure is an output of a draft that could not be resolved (IE: the paymail host is down)
+type OutputResolutionFailure struct {
+	Index  int    `json:"index"`  // Index of the output in the configuration
+	Reason string `json:"reason"` // Why the resolution failed
+	To     string `json:"to"`     // Recipient of the output
+}
+
+// OutputsUnresolvedError is when one or more of the outputs of a draft could not be resolved (AllowPartialResolution)
+//
+// Nothing is reserved. The resolved outputs are locked in: a retry using them does not resolve them again
+type OutputsUnresolvedError struct {
+	Failures []*OutputResolutionFailure `json:"failures"` // The unresolved outputs (with the reason)
+	Resolved []*TransactionOutput       `json:"resolved"` // The resolved outputs
+}
+
+// Error will return the failed recipients with the reason
+func (e *OutputsUnresolvedError) Error() string {
+	details := make([]string, 0, len(e.Failures))
+	for _, failure := range e.Failures {
+		details = append(details, fmt.Sprintf("#%d %s (%s)", failure.Index, failure.To, failure.Reason))
+	}
+	return ErrOutputsUnresolved.Error() + ": " + strings.Join(details, ", ")
+}
+
+// Unwrap will return ErrOutputsUnresolved (for errors.Is)
+func (e *OutputsUnresolvedError) Unwrap() error {
+	return ErrOutputsUnresolved
+}
+
+// isResolved will return true if the output was already resolved (the locking scripts are set)
+func (t *TransactionOutput) isResolved() bool {
+	return len(t.Scripts) > 0
+}
+
+// isPaymailOutput will return true if the output is sent to a paymail (or a known handle)
+func (t *TransactionOutput) isPaymailOutput() bool {
+	return len(t.To) > 0 && detectOutputType(convertOutputHandle(t.To)) == OutputTypePaymail
+}
+
+// validatePaymailOutput will validate the paymail output before it is resolved
+func (t *TransactionOutput) validatePaymailOutput() error {
+	if t.Script != "" {
+		return ErrOutputScriptNotExclusive
+	} else if t.Satoshis <= 0 {
+		return ErrOutputValueTooLow
+	}
+	return nil
+}
+
+// validateResolvedScripts will validate the scripts of an output resolved by a previous attempt
+//
+// The scripts must be valid and pay exactly the satoshis of the output
+func (t *TransactionOutput) validateResolvedScripts() error {
+	var satoshis uint64
+	for _, script := range t.Scripts {
+		if _, err := resolveScriptOutput(script.Script); err != nil {
+			return err
+		}
+		satoshis += script.Satoshis
+	}
+	if satoshis != t.Satoshis {
+		return ErrOutputValueMismatch
+	}
+	return nil
+}
+
+// processOutput will inspect the output to determine how to process
+func (t *TransactionOutput) processOutput(ctx context.Context, requests *singleflight.Group,
+	cacheStore cachestore.ClientInterface, paymailClient paymail.ClientInterface, defaultFromSender, defaultNote string, checkSatoshis bool) error {
+
+	// A custom script is the whole output
+	if t.Script != "" && (len(t.To) > 0 || t.OpReturn != nil) {
+		return ErrOutputScriptNotExclusive
+	}
+
+	// Check for Paymail, Bitcoin Address, script or OP Return (same detection as ResolveOutput)
+	if len(t.To) > 0 {
+		var outputType string
+		if t.To, outputType = normalizeOutputDestination(t.To); len(t.To) == 0 {
+			return ErrOutputValueNotRecognized
+		} else if checkSatoshis && t.Satoshis <= 0 {
 			return ErrOutputValueTooLow
 		}
-		return t.processAddressOutput()
+		switch outputType {
+		case OutputTypePaymail:
+			return t.processPaymailOutput(ctx, requests, cacheStore, paymailClient, defaultFromSender, defaultNote)
+		case OutputTypeScript:
+			return t.appendScriptOutput(t.To)
+		}
+		return t.processAddressOutput() // Standard Bitcoin Address
 	} else if t.OpReturn != nil { // OP_RETURN output
 		return t.processOpReturnOutput()
 	} else if t.Script != "" { // Custom script output
@@ -208,56 +460,179 @@ func (t *TransactionOutput) processOutput(ctx context.Context, cacheStore caches
 	return ErrOutputValueNotRecognized
 }
 
-// processPaymailOutput will detect how to process the Paymail output given
-func (t *TransactionOutput) processPaymailOutput(ctx context.Context, cacheStore cachestore.ClientInterface,
-	paymailClient paymail.ClientInterface, fromPaymail, defaultNote string) error {
+// convertOutputHandle will convert known handle formats ($handcash or 1relayx) into a paymail address
+func convertOutputHandle(destination string) string {
+	if strings.Contains(destination, handleHandcashPrefix) ||
+		(len(destination) < handleMaxLength && len(destination) > 1 && destination[:1] == handleRelayPrefix) {
+		return paymail.ConvertHandle(destination, false)
+	}
+	return destination
+}
 
-	// Standardize the paymail address (break into parts)
-	alias, domain, paymailAddress := paymail.SanitizePaymail(t.To)
-	if len(paymailAddress) == 0 {
-		return ErrPaymailAddressIsInvalid
+// normalizeOutputDestination will trim and convert the known handle formats of the destination and detect its type
+//
+// The draft outputs and ResolveOutput detect the destinations the same way
+func normalizeOutputDestination(destination string) (string, string) {
+	destination = convertOutputHandle(strings.TrimSpace(destination))
+	if len(destination) == 0 {
+		return "", ""
 	}
+	return destination, detectOutputType(destination)
+}
 
-	// Set the sanitized version of the paymail address provided
-	t.To = paymailAddress
+// detectOutputType will detect the type of the output destination (paymail, address or script)
+//
+// Anything that is not a paymail, and not a valid address but valid hex, is a script
+func detectOutputType(destination string) string {
+	if strings.Contains(destination, "@") {
+		return OutputTypePaymail
+	} else if _, err := bscript.NewAddressFromString(destination); err == nil {
+		return OutputTypeAddress
+	} else if _, err = hex.DecodeString(destination); err == nil {
+		return OutputTypeScript
+	}
+	return OutputTypeAddress
+}
 
-	// Start setting the Paymail information (nil check might not be needed)
-	if t.PaymailP4 == nil {
-		t.PaymailP4 = &PaymailP4{
-			Alias:  alias,
-			Domain: domain,
-		}
-	} else {
-		t.PaymailP4.Alias = alias
-		t.PaymailP4.Domain = domain
+// resolveAddressOutput will validate the Bitcoin address and create the locking script
+func resolveAddressOutput(address string) (*OutputResolution, error) {
+	s, err := bscript.NewP2PKHFromAddress(address)
+	if err != nil {
+		return nil, err
+	}
+	return &OutputResolution{
+		Address:       address,
+		LockingScript: s.String(),
+		ScriptType:    utils.ScriptTypePubKeyHash,
+		To:            address,
+		Type:          OutputTypeAddress,
+	}, nil
+}
+
+// resolveScriptOutput will validate the locking script and determine the type
+func resolveScriptOutput(script string) (*OutputResolution, error) {
+	if script == "" {
+		return nil, ErrInvalidScriptOutput
+	}
+
+	// check whether go-bt parses the script correctly
+	if _, err := bscript.NewFromHexString(script); err != nil {
+		return nil, err
+	}
+
+	return &OutputResolution{
+		Address:       utils.GetAddressFromScript(script),
+		LockingScript: script,
+		ScriptType:    utils.GetDestinationType(script), // try to determine type
+		To:            script,
+		Type:          OutputTypeScript,
+	}, nil
+}
+
+// resolvePaymailOutput will sanitize the paymail and check the capabilities of the provider
+//
+// Nothing is requested from the provider besides the capabilities (no destination is created), so the
+// locking script is not known until the draft is created
+func resolvePaymailOutput(ctx context.Context, requests *singleflight.Group, cacheStore cachestore.ClientInterface,
+	paymailClient paymail.ClientInterface, address string) (*OutputResolution, *paymail.CapabilitiesPayload, error) {
+
+	// Standardize the paymail address (break into parts)
+	alias, domain, paymailAddress := paymail.SanitizePaymail(address)
+	if len(paymailAddress) == 0 {
+		return nil, nil, ErrPaymailAddressIsInvalid
 	}
 
 	// Get the capabilities for the domain
 	capabilities, err := getCapabilities(
-		ctx, cacheStore, paymailClient, domain,
+		ctx, requests, cacheStore, paymailClient, domain,
 	)
 	if err != nil {
-		return err
+		return nil, nil, err
+	}
+
+	resolution := &OutputResolution{
+		PaymailP4: &PaymailP4{
+			Alias:          alias,
+			Domain:         domain,
+			ResolutionType: ResolutionTypeBasic,
+		},
+		To:   paymailAddress,
+		Type: OutputTypePaymail,
 	}
 
 	// Does the provider support P2P?
 	success, p2pDestinationURL, p2pSubmitTxURL, format := hasP2P(capabilities)
 	if success {
-		return t.processPaymailViaP2P(
-			paymailClient, p2pDestinationURL, p2pSubmitTxURL, fromPaymail, format,
-		)
+		resolution.P2PDestinationURL = p2pDestinationURL
+		resolution.PaymailP4.Format = format
+		resolution.PaymailP4.ReceiveEndpoint = p2pSubmitTxURL
+		resolution.PaymailP4.ReceiveEndpoints = getP2PReceiveEndpoints(capabilities)
+		resolution.PaymailP4.ResolutionType = ResolutionTypeP2P
+	} else if len(capabilities.GetString(
+		paymail.BRFCBasicAddressResolution, paymail.BRFCPaymentDestination,
+	)) == 0 {
+		return nil, nil, ErrMissingAddressResolutionURL
+	}
+
+	return resolution, capabilities, nil
+}
+
+// processPaymailOutput will detect how to process the Paymail output given
+func (t *TransactionOutput) processPaymailOutput(ctx context.Context, requests *singleflight.Group,
+	cacheStore cachestore.ClientInterface, paymailClient paymail.ClientInterface, fromPaymail, defaultNote string) error {
+
+	// Resolve the paymail (sanitize & check the capabilities of the provider)
+	resolution, capabilities, err := resolvePaymailOutput(ctx, requests, cacheStore, paymailClient, t.To)
+	if err != nil {
+		return err
+	}
+
+	// Set the sanitized version of the paymail address provided
+	t.To = resolution.To
+
+	// Start setting the Paymail information (nil check might not be needed)
+	if t.PaymailP4 == nil {
+		t.PaymailP4 = &PaymailP4{
+			Alias:  resolution.PaymailP4.Alias,
+			Domain: resolution.PaymailP4.Domain,
+		}
+	} else {
+		t.PaymailP4.Alias = resolution.PaymailP4.Alias
+		t.PaymailP4.Domain = resolution.PaymailP4.Domain
+	}
+
+	// Does the provider support P2P?
+	if resolution.PaymailP4.ResolutionType == ResolutionTypeP2P {
+		if err = t.processPaymailViaP2P(
+			paymailClient, resolution.P2PDestinationURL, resolution.PaymailP4.ReceiveEndpoint,
+			fromPaymail, resolution.PaymailP4.Format,
+		); err != nil {
+			return err
+		}
+
+		// A signed resolution must be signed by the PKI key of the recipient
+		if len(t.PaymailP4.Resolution.Signature) > 0 {
+			if err = t.PaymailP4.Resolution.setPublicKey(
+				paymailClient, capabilities, t.PaymailP4.Alias, t.PaymailP4.Domain,
+			); err != nil {
+				return err
+			}
+		}
+		t.PaymailP4.ReceiveEndpoints = resolution.PaymailP4.ReceiveEndpoints
+		return nil
 	}
 
 	// Default is resolving using the deprecated address resolution method
 	return t.processPaymailViaAddressResolution(
-		ctx, cacheStore, paymailClient, capabilities,
+		ctx, requests, cacheStore, paymailClient, capabilities,
 		fromPaymail, defaultNote,
 	)
 }
 
 // processPaymailViaAddressResolution will use a deprecated way to resolve a Paymail address
-func (t *TransactionOutput) processPaymailViaAddressResolution(ctx context.Context, cacheStore cachestore.ClientInterface,
-	paymailClient paymail.ClientInterface, capabilities *paymail.CapabilitiesPayload, defaultFromSender, defaultNote string) error {
+func (t *TransactionOutput) processPaymailViaAddressResolution(ctx context.Context, requests *singleflight.Group,
+	cacheStore cachestore.ClientInterface, paymailClient paymail.ClientInterface, capabilities *paymail.CapabilitiesPayload,
+	defaultFromSender, defaultNote string) error {
 
 	// Requires a note value
 	if len(t.PaymailP4.Note) == 0 {
@@ -269,7 +644,7 @@ func (t *TransactionOutput) processPaymailViaAddressResolution(ctx context.Conte
 
 	// Resolve the address information
 	resolution, err := resolvePaymailAddress(
-		ctx, cacheStore, paymailClient, capabilities,
+		ctx, requests, cacheStore, paymailClient, capabilities,
 		t.PaymailP4.Alias, t.PaymailP4.Domain,
 		t.PaymailP4.Note,
 		t.PaymailP4.FromPaymail,
@@ -338,41 +713,47 @@ func (t *TransactionOutput) processPaymailViaP2P(client paymail.ClientInterface,
 	t.PaymailP4.ResolutionType = ResolutionTypeP2P
 	t.PaymailP4.FromPaymail = fromPaymail
 	t.PaymailP4.Format = format
+	t.PaymailP4.Resolution = newPaymailResolution(destinationInfo)
 
 	return nil
 }
 
 // processAddressOutput will process an output for a standard Bitcoin Address Transaction
-func (t *TransactionOutput) processAddressOutput() (err error) {
+func (t *TransactionOutput) processAddressOutput() error {
 
 	// Create the script from the Bitcoin address
-	var s *bscript.Script
-	if s, err = bscript.NewP2PKHFromAddress(t.To); err != nil {
-		return
+	resolution, err := resolveAddressOutput(t.To)
+	if err != nil {
+		return err
 	}
 
 	// Append the script
 	t.Scripts = append(
 		t.Scripts,
 		&ScriptOutput{
-			Address:    t.To,
+			Address:    resolution.Address,
 			Satoshis:   t.Satoshis,
-			Script:     s.String(),
-			ScriptType: utils.ScriptTypePubKeyHash,
+			Script:     resolution.LockingScript,
+			ScriptType: resolution.ScriptType,
 		},
 	)
-	return
+	return nil
 }
 
 // processScriptOutput will process a custom bitcoin script output
-func (t *TransactionOutput) processScriptOutput() (err error) {
-	if t.Script == "" {
-		return ErrInvalidScriptOutput
-	}
+//
+// The exact script is used (type "custom"), the output is never attributed to a destination
+func (t *TransactionOutput) processScriptOutput() error {
+	return t.appendScriptOutput(t.Script)
+}
 
-	// check whether go-bt parses the script correctly
-	if _, err = bscript.NewFromHexString(t.Script); err != nil {
-		return
+// appendScriptOutput will validate the custom script and append it to the scripts of the output
+func (t *TransactionOutput) appendScriptOutput(script string) error {
+
+	// Validate the script
+	resolution, err := resolveScriptOutput(script)
+	if err != nil {
+		return err
 	}
 
 	// Append the script
@@ -380,8 +761,8 @@ func (t *TransactionOutput) processScriptOutput() (err error) {
 		t.Scripts,
 		&ScriptOutput{
 			Satoshis:   t.Satoshis,
-			Script:     t.Script,
-			ScriptType: utils.GetDestinationType(t.Script), // try to determine type
+			Script:     resolution.LockingScript,
+			ScriptType: ScriptTypeCustom,
 		},
 	)
 
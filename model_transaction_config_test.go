@@ -9,12 +9,13 @@ import (
 	"github.com/BuxOrg/bux/chainstate"
 	"github.com/BuxOrg/bux/utils"
 	magic "github.com/bitcoinschema/go-map"
+	"github.com/libsv/go-bt/v2/sighash"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
 var (
-	emptyConfigJSON = "{\"change_destinations\":[{\"created_at\":\"0001-01-01T00:00:00Z\",\"updated_at\":\"0001-01-01T00:00:00Z\",\"deleted_at\":null,\"id\":\"c775e7b757ede630cd0aa1113bd102661ab38829ca52a6422ab782862f268646\",\"xpub_id\":\"1a0b10d4eda0636aae1709e7e7080485a4d99af3ca2962c6e677cf5b53d8ab8c\",\"locking_script\":\"76a9147ff514e6ae3deb46e6644caac5cdd0bf2388906588ac\",\"type\":\"pubkeyhash\",\"chain\":1,\"num\":123,\"address\":\"1CfaQw9udYNPccssFJFZ94DN8MqNZm9nGt\",\"draft_id\":\"test-reference\",\"monitor\":null}],\"change_destinations_strategy\":\"\",\"change_minimum_satoshis\":0,\"change_number_of_destinations\":0,\"change_satoshis\":124,\"expires_in\":20000000000,\"fee\":12,\"fee_unit\":{\"satoshis\":1,\"bytes\":20},\"from_utxos\":null,\"include_utxos\":null,\"inputs\":null,\"outputs\":null,\"sync\":null}"
+	emptyConfigJSON = "{\"change_destinations\":[{\"created_at\":\"0001-01-01T00:00:00Z\",\"updated_at\":\"0001-01-01T00:00:00Z\",\"deleted_at\":null,\"version\":0,\"id\":\"c775e7b757ede630cd0aa1113bd102661ab38829ca52a6422ab782862f268646\",\"xpub_id\":\"1a0b10d4eda0636aae1709e7e7080485a4d99af3ca2962c6e677cf5b53d8ab8c\",\"locking_script\":\"76a9147ff514e6ae3deb46e6644caac5cdd0bf2388906588ac\",\"type\":\"pubkeyhash\",\"chain\":1,\"num\":123,\"address\":\"1CfaQw9udYNPccssFJFZ94DN8MqNZm9nGt\",\"draft_id\":\"test-reference\",\"monitor\":null,\"revoked_at\":null}],\"change_destinations_strategy\":\"\",\"change_minimum_satoshis\":0,\"change_number_of_destinations\":0,\"change_satoshis\":124,\"expires_in\":20000000000,\"fee\":12,\"fee_unit\":{\"satoshis\":1,\"bytes\":20},\"from_utxos\":null,\"include_utxos\":null,\"inputs\":null,\"outputs\":null,\"sync\":null}"
 	opReturn        = "006a2231394878696756345179427633744870515663554551797131707a5a56646f417574324b65657020616e20657965206f6e207468697320706c61636520666f7220736f6d65204a616d696679206c6f76652e2e2e200d746578742f6d61726b646f776e055554462d38"
 	unsetConfigJSON = "{\"change_destinations\":null,\"change_destinations_strategy\":\"\",\"change_minimum_satoshis\":0,\"change_number_of_destinations\":0,\"change_satoshis\":0,\"expires_in\":0,\"fee\":0,\"fee_unit\":null,\"from_utxos\":null,\"include_utxos\":null,\"inputs\":null,\"outputs\":null,\"sync\":null}"
 
@@ -165,7 +166,7 @@ func TestTransactionConfig_processOutput(t *testing.T) {
 		}
 
 		err := out.processOutput(
-			context.Background(), nil, client,
+			context.Background(), nil, nil, client,
 			defaultSenderPaymail, defaultAddressResolutionPurpose,
 			true,
 		)
@@ -173,6 +174,54 @@ func TestTransactionConfig_processOutput(t *testing.T) {
 		assert.ErrorIs(t, err, ErrOutputValueNotRecognized)
 	})
 
+	t.Run("error - script and to given", func(t *testing.T) {
+		out := &TransactionOutput{
+			Satoshis: satoshis,
+			Script:   testLockingScript,
+			To:       testExternalAddress,
+		}
+
+		err := out.processOutput(
+			context.Background(), nil, nil, nil,
+			defaultSenderPaymail, defaultAddressResolutionPurpose,
+			true,
+		)
+		assert.ErrorIs(t, err, ErrOutputScriptNotExclusive)
+		assert.Len(t, out.Scripts, 0)
+	})
+
+	t.Run("error - script and op_return given", func(t *testing.T) {
+		out := &TransactionOutput{
+			OpReturn: &OpReturn{StringParts: []string{"hello"}},
+			Script:   testLockingScript,
+		}
+
+		err := out.processOutput(
+			context.Background(), nil, nil, nil,
+			defaultSenderPaymail, defaultAddressResolutionPurpose,
+			true,
+		)
+		assert.ErrorIs(t, err, ErrOutputScriptNotExclusive)
+	})
+
+	t.Run("script as the destination (same as ResolveOutput)", func(t *testing.T) {
+		out := &TransactionOutput{
+			Satoshis: satoshis,
+			To:       " " + testLockingScript + " ",
+		}
+
+		err := out.processOutput(
+			context.Background(), nil, nil, nil,
+			defaultSenderPaymail, defaultAddressResolutionPurpose,
+			true,
+		)
+		require.NoError(t, err)
+		assert.Equal(t, testLockingScript, out.To)
+		require.Len(t, out.Scripts, 1)
+		assert.Equal(t, testLockingScript, out.Scripts[0].Script)
+		assert.Equal(t, ScriptTypeCustom, out.Scripts[0].ScriptType)
+	})
+
 	t.Run("error - invalid paymail given", func(t *testing.T) {
 		client := newTestPaymailClient(t, []string{testDomain})
 
@@ -182,7 +231,7 @@ func TestTransactionConfig_processOutput(t *testing.T) {
 		}
 
 		err := out.processOutput(
-			context.Background(), nil, client,
+			context.Background(), nil, nil, client,
 			defaultSenderPaymail, defaultAddressResolutionPurpose,
 			true,
 		)
@@ -210,7 +259,7 @@ func TestTransactionConfig_processOutput(t *testing.T) {
 		mockValidResponse(http.StatusOK, false, testDomain)
 
 		err = out.processOutput(
-			context.Background(), tc.Cachestore(), client,
+			context.Background(), nil, tc.Cachestore(), client,
 			defaultSenderPaymail, defaultAddressResolutionPurpose,
 			true,
 		)
@@ -249,7 +298,7 @@ func TestTransactionConfig_processOutput(t *testing.T) {
 		mockValidResponse(http.StatusOK, false, handleDomain)
 
 		err = out.processOutput(
-			context.Background(), tc.Cachestore(), client,
+			context.Background(), nil, tc.Cachestore(), client,
 			defaultSenderPaymail, defaultAddressResolutionPurpose,
 			true,
 		)
@@ -288,7 +337,7 @@ func TestTransactionConfig_processOutput(t *testing.T) {
 		mockValidResponse(http.StatusOK, false, handleDomain)
 
 		err = out.processOutput(
-			context.Background(), tc.Cachestore(), client,
+			context.Background(), nil, tc.Cachestore(), client,
 			defaultSenderPaymail, defaultAddressResolutionPurpose,
 			true,
 		)
@@ -324,7 +373,7 @@ func TestTransactionConfig_processOutput(t *testing.T) {
 		mockValidResponse(http.StatusOK, true, testDomain)
 
 		err = out.processOutput(
-			context.Background(), tc.Cachestore(), client,
+			context.Background(), nil, tc.Cachestore(), client,
 			defaultSenderPaymail, defaultAddressResolutionPurpose,
 			true,
 		)
@@ -477,6 +526,12 @@ func TestTransactionConfig_processScriptOutput(t *testing.T) {
 		}
 		err := output.processScriptOutput()
 		require.NoError(t, err)
+
+		// Never attributed to a destination, even if it is a standard script
+		require.Len(t, output.Scripts, 1)
+		assert.Equal(t, ScriptTypeCustom, output.Scripts[0].ScriptType)
+		assert.Equal(t, "", output.Scripts[0].Address)
+		assert.Equal(t, testLockingScript, output.Scripts[0].Script)
 	})
 
 	t.Run("STAS token script", func(t *testing.T) {
@@ -488,3 +543,79 @@ func TestTransactionConfig_processScriptOutput(t *testing.T) {
 		require.NoError(t, err)
 	})
 }
+
+// TestTransactionConfig_validateSigHashTypes will test the method validateSigHashTypes()
+func TestTransactionConfig_validateSigHashTypes(t *testing.T) {
+	t.Parallel()
+
+	pointer := &UtxoPointer{TransactionID: testTxID, OutputIndex: 1}
+	newOverride := func(flag sighash.Flag) []*TransactionInput {
+		return []*TransactionInput{{Utxo: Utxo{UtxoPointer: *pointer}, SigHashType: flag}}
+	}
+
+	t.Run("no overrides", func(t *testing.T) {
+		config := &TransactionConfig{}
+		assert.NoError(t, config.validateSigHashTypes(nil))
+	})
+
+	t.Run("supported sighash types", func(t *testing.T) {
+		config := &TransactionConfig{FromUtxos: []*UtxoPointer{pointer}}
+		for _, flag := range supportedSigHashTypes {
+			assert.NoError(t, config.validateSigHashTypes(newOverride(flag)))
+		}
+	})
+
+	t.Run("unsupported sighash types", func(t *testing.T) {
+		config := &TransactionConfig{FromUtxos: []*UtxoPointer{pointer}}
+		for _, flag := range []sighash.Flag{sighash.All, sighash.AnyOneCanPay, sighash.AnyOneCanPayForkID, sighash.Single | sighash.AnyOneCanPay} {
+			assert.ErrorIs(t, config.validateSigHashTypes(newOverride(flag)), ErrUnsupportedSigHashType)
+		}
+	})
+
+	t.Run("override for an unknown utxo", func(t *testing.T) {
+		config := &TransactionConfig{}
+		assert.ErrorIs(t, config.validateSigHashTypes(newOverride(sighash.AllForkID)), ErrSigHashInputNotFound)
+	})
+
+	t.Run("override for an included utxo", func(t *testing.T) {
+		config := &TransactionConfig{IncludeUtxos: []*UtxoPointer{pointer}}
+		assert.NoError(t, config.validateSigHashTypes(newOverride(sighash.AllForkID)))
+	})
+
+	t.Run("external inputs", func(t *testing.T) {
+		config := &TransactionConfig{
+			AllowExternalInputs:    true,
+			ExternalInputsCount:    1,
+			ExternalInputsSatoshis: 1000,
+			FromUtxos:              []*UtxoPointer{pointer},
+		}
+		assert.NoError(t, config.validateSigHashTypes(newOverride(sighash.AllForkID|sighash.AnyOneCanPay)))
+		assert.ErrorIs(t, config.validateSigHashTypes(newOverride(sighash.AllForkID)), ErrExternalInputsRequireAnyoneCanPay)
+		assert.Equal(t, uint64(1000), config.getExternalInputsSatoshis())
+
+		config.SendAllTo = &TransactionOutput{To: testExternalAddress}
+		assert.ErrorIs(t, config.validateSigHashTypes(newOverride(sighash.AllForkID|sighash.AnyOneCanPay)), ErrExternalInputsNotAllowed)
+	})
+
+	t.Run("external inputs not allowed", func(t *testing.T) {
+		config := &TransactionConfig{ExternalInputsSatoshis: 1000}
+		assert.ErrorIs(t, config.validateSigHashTypes(nil), ErrExternalInputsNotAllowed)
+		assert.Equal(t, uint64(0), config.getExternalInputsSatoshis())
+	})
+}
+
+// TestTransactionConfig_popSigHashOverrides will test the method popSigHashOverrides()
+func TestTransactionConfig_popSigHashOverrides(t *testing.T) {
+	t.Parallel()
+
+	input := &TransactionInput{Utxo: Utxo{UtxoPointer: UtxoPointer{TransactionID: testTxID, OutputIndex: 0}}}
+	override := &TransactionInput{
+		Utxo:        Utxo{UtxoPointer: UtxoPointer{TransactionID: testTxID, OutputIndex: 1}},
+		SigHashType: sighash.SingleForkID,
+	}
+	config := &TransactionConfig{Inputs: []*TransactionInput{input, override}}
+
+	overrides := config.popSigHashOverrides()
+	assert.Equal(t, []*TransactionInput{override}, overrides)
+	assert.Equal(t, []*TransactionInput{input}, config.Inputs)
+}
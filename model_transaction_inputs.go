@@ -0,0 +1,115 @@
+package bux
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// RecordedInput is an input of a recorded transaction and its owner
+//
+// Inputs that do not spend a known utxo are external (IE: co-funded transactions), their value is only known
+// if it was given when recording (see WithExternalInputs) or if the transaction is in the extended format
+type RecordedInput struct {
+	External    bool   `json:"external"`          // The input does not spend a utxo of bux
+	Index       uint32 `json:"index"`             // Index of the input in the transaction
+	OutputIndex uint32 `json:"output_index"`      // Index of the spent output
+	Owned       bool   `json:"owned"`             // Display only: the input is spent by the xPub (see Transaction.Display)
+	Satoshis    uint64 `json:"satoshis"`          // Value of the spent output (if known)
+	TxID        string `json:"tx_id"`             // ID of the transaction of the spent output
+	ValueKnown  bool   `json:"value_known"`       // If the value of the spent output is known
+	XpubID      string `json:"xpub_id,omitempty"` // xPub ID of the owner of the utxo (hidden on display)
+}
+
+// RecordedInputs are the inputs of a recorded transaction
+type RecordedInputs []*RecordedInput
+
+// ExternalInput is the value of an external input of a transaction (not a utxo of bux), see WithExternalInputs
+type ExternalInput struct {
+	OutputIndex uint32 `json:"output_index"` // Index of the spent output
+	Satoshis    uint64 `json:"satoshis"`     // Value of the spent output
+	TxID        string `json:"tx_id"`        // ID of the transaction of the spent output
+}
+
+// externalInputKey will return the key of the spent output (txid:index)
+func externalInputKey(txID string, outputIndex uint32) string {
+	return txID + ":" + strconv.FormatUint(uint64(outputIndex), 10)
+}
+
+// allKnown will return true if the value of every input is known
+func (r RecordedInputs) allKnown() bool {
+	for _, input := range r {
+		if !input.ValueKnown {
+			return false
+		}
+	}
+	return true
+}
+
+// hasExternal will return true if any input is external (not a utxo of bux)
+func (r RecordedInputs) hasExternal() bool {
+	for _, input := range r {
+		if input.External {
+			return true
+		}
+	}
+	return false
+}
+
+// value will return the total value of the inputs (only the known values)
+func (r RecordedInputs) value() (satoshis uint64) {
+	for _, input := range r {
+		satoshis += input.Satoshis
+	}
+	return
+}
+
+// display will return a copy of the inputs for the xPub (the owners are only shown as owned or not)
+func (r RecordedInputs) display(xPubID string) RecordedInputs {
+	if r == nil {
+		return nil
+	}
+	inputs := make(RecordedInputs, 0, len(r))
+	for _, input := range r {
+		displayed := *input
+		displayed.Owned = len(input.XpubID) > 0 && input.XpubID == xPubID
+		displayed.XpubID = ""
+		inputs = append(inputs, &displayed)
+	}
+	return inputs
+}
+
+// Scan will scan the value into Struct, implements sql.Scanner interface
+func (r *RecordedInputs) Scan(value interface{}) error {
+	if value == nil {
+		return nil
+	}
+
+	xType := fmt.Sprintf("%T", value)
+	var byteValue []byte
+	if xType == ValueTypeString {
+		byteValue = []byte(value.(string))
+	} else {
+		byteValue = value.([]byte)
+	}
+	if bytes.Equal(byteValue, []byte("")) || bytes.Equal(byteValue, []byte("\"\"")) {
+		return nil
+	}
+
+	return json.Unmarshal(byteValue, &r)
+}
+
+// Value return json value, implement driver.Valuer interface
+func (r RecordedInputs) Value() (driver.Value, error) {
+	if r == nil {
+		return nil, nil
+	}
+	marshal, err := json.Marshal(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return string(marshal), nil
+}
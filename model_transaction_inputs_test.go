@@ -0,0 +1,107 @@
+package bux
+
+import (
+	"testing"
+
+	"github.com/BuxOrg/bux/utils"
+	"github.com/libsv/go-bt/v2"
+	"github.com/libsv/go-bt/v2/bscript"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestTransaction_externalInputs will test recording co-funded transactions (half of the inputs are external)
+func TestTransaction_externalInputs(t *testing.T) {
+	externalScript, err := bscript.NewP2PKHFromAddress(testExternalAddress)
+	require.NoError(t, err)
+
+	// newCoFundedTx will return a transaction spending the utxo and an external input (5000 satoshis)
+	newCoFundedTx := func(t *testing.T, utxo *Utxo) (*bt.Tx, string) {
+		externalTxID, err := utils.RandomHex(32)
+		require.NoError(t, err)
+
+		tx := bt.NewTx()
+		require.NoError(t, tx.From(utxo.TransactionID, utxo.OutputIndex, utxo.ScriptPubKey, utxo.Satoshis))
+		require.NoError(t, tx.From(externalTxID, 1, externalScript.String(), 5000))
+		return tx, externalTxID
+	}
+
+	t.Run("outgoing: only the inputs of the xPub are counted", func(t *testing.T) {
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, true, WithCustomTaskManager(&taskManagerMockBase{}))
+		defer deferMe()
+		fixtures := NewFixtures(t, client).WithXpub(0).WithUtxos(10000)
+
+		tx, externalTxID := newCoFundedTx(t, fixtures.Utxos[0])
+		tx.AddOutput(&bt.Output{LockingScript: externalScript, Satoshis: 14900})
+
+		transaction, err := client.RecordRawTransaction(ctx, tx.String(), WithExternalInputs(&ExternalInput{
+			OutputIndex: 1,
+			Satoshis:    5000,
+			TxID:        externalTxID,
+		}))
+		require.NoError(t, err)
+		assert.Equal(t, uint64(100), transaction.Fee)
+		assert.False(t, transaction.FeeUnknown)
+
+		// The utxo of the xPub is spent
+		var utxo *Utxo
+		utxo, err = client.GetUtxo(ctx, fixtures.RawXpub, fixtures.Utxos[0].TransactionID, fixtures.Utxos[0].OutputIndex)
+		require.NoError(t, err)
+		assert.Equal(t, transaction.ID, utxo.SpendingTxID.String)
+
+		transaction, err = client.GetTransaction(ctx, fixtures.Xpub.ID, transaction.ID)
+		require.NoError(t, err)
+		transaction = transaction.Display().(*Transaction)
+		assert.Equal(t, int64(-10000), transaction.OutputValue)
+		assert.Equal(t, TransactionDirectionOut, transaction.Direction)
+		require.Len(t, transaction.Inputs, 2)
+
+		assert.True(t, transaction.Inputs[0].Owned)
+		assert.False(t, transaction.Inputs[0].External)
+		assert.Equal(t, uint64(10000), transaction.Inputs[0].Satoshis)
+		assert.Empty(t, transaction.Inputs[0].XpubID)
+
+		assert.False(t, transaction.Inputs[1].Owned)
+		assert.True(t, transaction.Inputs[1].External)
+		assert.True(t, transaction.Inputs[1].ValueKnown)
+		assert.Equal(t, uint64(5000), transaction.Inputs[1].Satoshis)
+		assert.Equal(t, externalTxID, transaction.Inputs[1].TxID)
+		assert.Equal(t, uint32(1), transaction.Inputs[1].Index)
+	})
+
+	t.Run("incoming: the fee is unknown without the value of the external input", func(t *testing.T) {
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, true, WithCustomTaskManager(&taskManagerMockBase{}))
+		defer deferMe()
+		fixtures := NewFixtures(t, client).WithXpub(0).WithDestinations(1).WithUtxos(1000)
+
+		tx, _ := newCoFundedTx(t, fixtures.Utxos[0])
+		lockingScript, err := bscript.NewFromHexString(fixtures.Destinations[0].LockingScript)
+		require.NoError(t, err)
+		tx.AddOutput(&bt.Output{LockingScript: lockingScript, Satoshis: 5900})
+
+		var transaction *Transaction
+		transaction, err = client.RecordRawTransaction(ctx, tx.String())
+		require.NoError(t, err)
+		assert.Equal(t, uint64(0), transaction.Fee)
+		assert.True(t, transaction.FeeUnknown)
+
+		transaction, err = client.GetTransaction(ctx, fixtures.Xpub.ID, transaction.ID)
+		require.NoError(t, err)
+		transaction = transaction.Display().(*Transaction)
+		assert.Equal(t, int64(4900), transaction.OutputValue)
+		assert.Equal(t, TransactionDirectionIn, transaction.Direction)
+		require.Len(t, transaction.Inputs, 2)
+
+		assert.True(t, transaction.Inputs[0].Owned)
+		assert.Equal(t, uint64(1000), transaction.Inputs[0].Satoshis)
+
+		assert.True(t, transaction.Inputs[1].External)
+		assert.False(t, transaction.Inputs[1].ValueKnown)
+		assert.Equal(t, uint64(0), transaction.Inputs[1].Satoshis)
+
+		// The balance of the xPub only changes by its own inputs and outputs
+		xPub, err := client.GetXpubByID(ctx, fixtures.Xpub.ID)
+		require.NoError(t, err)
+		assert.Equal(t, uint64(5900), xPub.CurrentBalance)
+	})
+}
@@ -0,0 +1,242 @@
+package bux
+
+import (
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+	"unicode/utf8"
+
+	"github.com/mrz1836/go-datastore"
+)
+
+// TransactionNote is an object representing a human-readable note (memo) of an xPub on a transaction
+//
+// The previous versions of the note are kept in the history (see UpdateTransactionNote)
+//
+// Gorm related models & indexes: https://gorm.io/docs/models.html - https://gorm.io/docs/indexes.html
+type TransactionNote struct {
+	// Base model
+	Model `bson:",inline"`
+
+	// Model specific fields
+	ID      string                 `json:"id" toml:"id" yaml:"id" gorm:"<-:create;type:varchar(64);primaryKey;comment:This is the unique id (random)" bson:"_id"`
+	TxID    string                 `json:"tx_id" toml:"tx_id" yaml:"tx_id" gorm:"<-:create;type:char(64);index;comment:This is the related transaction" bson:"tx_id"`
+	XpubID  string                 `json:"xpub_id" toml:"xpub_id" yaml:"xpub_id" gorm:"<-:create;type:char(64);index;comment:This is the related xPub" bson:"xpub_id"`
+	Author  string                 `json:"author" toml:"author" yaml:"author" gorm:"<-;type:varchar(255);comment:This is the author of the current version" bson:"author"`
+	Text    string                 `json:"text" toml:"text" yaml:"text" gorm:"<-;type:text;comment:This is the text of the current version" bson:"text"`
+	History TransactionNoteHistory `json:"history,omitempty" toml:"history" yaml:"history" gorm:"<-;type:text;comment:This is the previous versions of the note" bson:"history,omitempty"`
+}
+
+// TransactionNoteVersion is a previous version of a transaction note
+type TransactionNoteVersion struct {
+	Author    string    `json:"author"`     // Author of the version
+	Text      string    `json:"text"`       // Text of the version
+	UpdatedAt time.Time `json:"updated_at"` // When the version was written
+}
+
+// TransactionNoteHistory is the previous versions of a transaction note (oldest first)
+type TransactionNoteHistory []*TransactionNoteVersion
+
+// newTransactionNote will start a new transaction note model
+func newTransactionNote(xPubID, txID, author, text string, opts ...ModelOps) *TransactionNote {
+	note := &TransactionNote{
+		Author: author,
+		Model:  *NewBaseModel(ModelTransactionNote, opts...),
+		Text:   text,
+		TxID:   txID,
+		XpubID: xPubID,
+	}
+	note.ID = note.newModelID()
+	return note
+}
+
+// getTransactionNote will get the note by ID (nil if not found)
+func getTransactionNote(ctx context.Context, id string, opts ...ModelOps) (*TransactionNote, error) {
+	note := &TransactionNote{ID: id}
+	note.enrich(ModelTransactionNote, opts...)
+	if err := Get(ctx, note, nil, false, defaultDatabaseReadTimeout, false); err != nil {
+		if errors.Is(err, datastore.ErrNoResults) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return note, nil
+}
+
+// getTransactionNotes will get the notes of the xPub on the transaction
+func getTransactionNotes(ctx context.Context, xPubID, txID string, queryParams *datastore.QueryParams,
+	opts ...ModelOps,
+) ([]*TransactionNote, error) {
+	if queryParams == nil {
+		queryParams = &datastore.QueryParams{
+			OrderByField:  createdAtField,
+			SortDirection: datastore.SortAsc,
+		}
+	}
+
+	modelItems := make([]*TransactionNote, 0)
+	if err := getModelsByConditions(
+		ctx, ModelTransactionNote, &modelItems, nil,
+		&map[string]interface{}{xPubIDField: xPubID, txIDField: txID}, queryParams, opts...,
+	); err != nil {
+		return nil, err
+	}
+
+	for index := range modelItems {
+		modelItems[index].enrich(ModelTransactionNote, opts...)
+	}
+	return modelItems, nil
+}
+
+// getLatestTransactionNote will get the last updated note of the xPub on the transaction (nil if there are no notes)
+func getLatestTransactionNote(ctx context.Context, xPubID, txID string, opts ...ModelOps) (*TransactionNote, error) {
+	notes, err := getTransactionNotes(ctx, xPubID, txID, &datastore.QueryParams{
+		Page:          1,
+		PageSize:      1,
+		OrderByField:  updatedAtField,
+		SortDirection: datastore.SortDesc,
+	}, opts...)
+	if err != nil {
+		return nil, err
+	} else if len(notes) == 0 {
+		return nil, nil
+	}
+	return notes[0], nil
+}
+
+// getLatestTransactionNoteOfXpubs will get the last updated note of any of the xPubs on the transaction
+// (nil if there are no notes)
+func getLatestTransactionNoteOfXpubs(ctx context.Context, xPubIDs []string, txID string,
+	opts ...ModelOps,
+) (*TransactionNote, error) {
+	if len(xPubIDs) == 0 {
+		return nil, nil
+	}
+	xPubConditions := make([]map[string]interface{}, 0, len(xPubIDs))
+	for _, xPubID := range xPubIDs {
+		xPubConditions = append(xPubConditions, map[string]interface{}{xPubIDField: xPubID})
+	}
+	modelItems := make([]*TransactionNote, 0)
+	if err := getModelsByConditions(
+		ctx, ModelTransactionNote, &modelItems, nil,
+		&map[string]interface{}{
+			conditionOr: xPubConditions,
+			txIDField:   txID,
+		}, &datastore.QueryParams{
+			Page:          1,
+			PageSize:      1,
+			OrderByField:  updatedAtField,
+			SortDirection: datastore.SortDesc,
+		}, opts...,
+	); err != nil {
+		return nil, err
+	} else if len(modelItems) == 0 {
+		return nil, nil
+	}
+	modelItems[0].enrich(ModelTransactionNote, opts...)
+	return modelItems[0], nil
+}
+
+// update will change the text of the note, the current version is kept in the history
+func (m *TransactionNote) update(author, text string) {
+	updatedAt := m.UpdatedAt
+	if updatedAt.IsZero() {
+		updatedAt = m.CreatedAt
+	}
+	m.History = append(m.History, &TransactionNoteVersion{
+		Author:    m.Author,
+		Text:      m.Text,
+		UpdatedAt: updatedAt,
+	})
+	m.Author = author
+	m.Text = text
+}
+
+// checkTransactionNoteText will make sure the text is not empty and within the max length (characters)
+func checkTransactionNoteText(text string, maxLength int) error {
+	if len(text) == 0 {
+		return ErrMissingTransactionNoteText
+	} else if maxLength > 0 && utf8.RuneCountInString(text) > maxLength {
+		return fmt.Errorf("%w: max %d characters", ErrTransactionNoteTooLong, maxLength)
+	}
+	return nil
+}
+
+// GetModelName will get the name of the current model
+func (m *TransactionNote) GetModelName() string {
+	return ModelTransactionNote.String()
+}
+
+// GetModelTableName will get the db table name of the current model
+func (m *TransactionNote) GetModelTableName() string {
+	return tableTransactionNotes
+}
+
+// Save will save the model into the Datastore
+func (m *TransactionNote) Save(ctx context.Context) error {
+	return Save(ctx, m)
+}
+
+// GetID will get the ID
+func (m *TransactionNote) GetID() string {
+	return m.ID
+}
+
+// BeforeCreating will fire before the model is being inserted into the Datastore
+func (m *TransactionNote) BeforeCreating(_ context.Context) error {
+	m.DebugLog("starting: " + m.Name() + " BeforeCreating hook...")
+
+	// Make sure ID is valid
+	if len(m.ID) == 0 {
+		return ErrMissingFieldID
+	} else if len(m.XpubID) == 0 {
+		return ErrMissingFieldXpubID
+	} else if len(m.TxID) == 0 {
+		return ErrMissingTransaction
+	}
+
+	m.DebugLog("end: " + m.Name() + " BeforeCreating hook")
+	return nil
+}
+
+// Migrate model specific migration on startup
+func (m *TransactionNote) Migrate(client datastore.ClientInterface) error {
+	return client.IndexMetadata(client.GetTableName(tableTransactionNotes), metadataField)
+}
+
+// Scan will scan the value into Struct, implements sql.Scanner interface
+func (h *TransactionNoteHistory) Scan(value interface{}) error {
+	if value == nil {
+		return nil
+	}
+
+	xType := fmt.Sprintf("%T", value)
+	var byteValue []byte
+	if xType == ValueTypeString {
+		byteValue = []byte(value.(string))
+	} else {
+		byteValue = value.([]byte)
+	}
+	if bytes.Equal(byteValue, []byte("")) || bytes.Equal(byteValue, []byte("\"\"")) {
+		return nil
+	}
+
+	return json.Unmarshal(byteValue, &h)
+}
+
+// Value return json value, implement driver.Valuer interface
+func (h TransactionNoteHistory) Value() (driver.Value, error) {
+	if h == nil {
+		return nil, nil
+	}
+	marshal, err := json.Marshal(h)
+	if err != nil {
+		return nil, err
+	}
+
+	return string(marshal), nil
+}
@@ -0,0 +1,130 @@
+package bux
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/BuxOrg/bux/notifications"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestClient_TransactionNotes will test the methods AddTransactionNote(), GetTransactionNotes() and UpdateTransactionNote()
+func TestClient_TransactionNotes(t *testing.T) {
+	t.Parallel()
+
+	t.Run("add, update and read", func(t *testing.T) {
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, true, WithCustomTaskManager(&taskManagerMockBase{}))
+		defer deferMe()
+
+		fixtures := NewFixtures(t, client).WithXpub(0).WithUtxos(1000)
+		txID := fixtures.Transactions[0].ID
+
+		note, err := client.AddTransactionNote(ctx, fixtures.RawXpub, txID, "alice", "rent for may")
+		require.NoError(t, err)
+		assert.Equal(t, fixtures.Xpub.ID, note.XpubID)
+		assert.Equal(t, txID, note.TxID)
+		assert.Empty(t, note.History)
+
+		note, err = client.UpdateTransactionNote(ctx, fixtures.Xpub.ID, note.ID, "bob", "rent for june")
+		require.NoError(t, err)
+		assert.Equal(t, "bob", note.Author)
+		assert.Equal(t, "rent for june", note.Text)
+		require.Len(t, note.History, 1)
+		assert.Equal(t, "alice", note.History[0].Author)
+		assert.Equal(t, "rent for may", note.History[0].Text)
+
+		var notes []*TransactionNote
+		notes, err = client.GetTransactionNotes(ctx, fixtures.Xpub.ID, txID)
+		require.NoError(t, err)
+		require.Len(t, notes, 1)
+		assert.Equal(t, "rent for june", notes[0].Text)
+		require.Len(t, notes[0].History, 1)
+		assert.Equal(t, "rent for may", notes[0].History[0].Text)
+
+		// The latest note is included in the transaction of the xPub
+		var transaction *Transaction
+		transaction, err = client.GetTransaction(ctx, fixtures.Xpub.ID, txID)
+		require.NoError(t, err)
+		require.NotNil(t, transaction.Note)
+		assert.Equal(t, note.ID, transaction.Note.ID)
+
+		transaction, err = client.GetTransactionByID(ctx, txID)
+		require.NoError(t, err)
+		assert.Nil(t, transaction.Note)
+	})
+
+	t.Run("text limits", func(t *testing.T) {
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, true,
+			WithCustomTaskManager(&taskManagerMockBase{}), WithTransactionNoteMaxLength(10),
+		)
+		defer deferMe()
+
+		fixtures := NewFixtures(t, client).WithXpub(0).WithUtxos(1000)
+		txID := fixtures.Transactions[0].ID
+
+		_, err := client.AddTransactionNote(ctx, fixtures.Xpub.ID, txID, "alice", "")
+		require.ErrorIs(t, err, ErrMissingTransactionNoteText)
+
+		_, err = client.AddTransactionNote(ctx, fixtures.Xpub.ID, txID, "alice", strings.Repeat("a", 11))
+		require.ErrorIs(t, err, ErrTransactionNoteTooLong)
+
+		var note *TransactionNote
+		note, err = client.AddTransactionNote(ctx, fixtures.Xpub.ID, txID, "alice", strings.Repeat("ü", 10))
+		require.NoError(t, err)
+
+		_, err = client.UpdateTransactionNote(ctx, fixtures.Xpub.ID, note.ID, "alice", strings.Repeat("a", 11))
+		require.ErrorIs(t, err, ErrTransactionNoteTooLong)
+	})
+
+	t.Run("other xPubs", func(t *testing.T) {
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, true, WithCustomTaskManager(&taskManagerMockBase{}))
+		defer deferMe()
+
+		fixtures := NewFixtures(t, client).WithXpub(0).WithUtxos(1000)
+		other := NewFixtures(t, client).WithXpub(0)
+		txID := fixtures.Transactions[0].ID
+
+		_, err := client.AddTransactionNote(ctx, other.Xpub.ID, txID, "mallory", "mine")
+		require.ErrorIs(t, err, ErrMissingTransaction)
+
+		_, err = client.AddTransactionNote(ctx, fixtures.Xpub.ID, testTxID, "alice", "unknown")
+		require.ErrorIs(t, err, ErrMissingTransaction)
+
+		var note *TransactionNote
+		note, err = client.AddTransactionNote(ctx, fixtures.Xpub.ID, txID, "alice", "private")
+		require.NoError(t, err)
+
+		_, err = client.UpdateTransactionNote(ctx, other.Xpub.ID, note.ID, "mallory", "changed")
+		require.ErrorIs(t, err, ErrMissingTransactionNote)
+
+		var notes []*TransactionNote
+		notes, err = client.GetTransactionNotes(ctx, other.Xpub.ID, txID)
+		require.NoError(t, err)
+		assert.Empty(t, notes)
+	})
+
+	t.Run("notification payload", func(t *testing.T) {
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, true, WithCustomTaskManager(&taskManagerMockBase{}))
+		defer deferMe()
+
+		fixtures := NewFixtures(t, client).WithXpub(0).WithUtxos(1000)
+		transaction := fixtures.Transactions[0]
+
+		// Without a note, the transaction is not copied
+		assert.Same(t, transaction, withTransactionNote(ctx, transaction))
+
+		note, err := client.AddTransactionNote(ctx, fixtures.Xpub.ID, transaction.ID, "alice", "rent for may")
+		require.NoError(t, err)
+
+		withNote, ok := withTransactionNote(ctx, transaction).(*Transaction)
+		require.True(t, ok)
+		require.NotNil(t, withNote.Note)
+		assert.Equal(t, note.ID, withNote.Note.ID)
+		assert.Nil(t, transaction.Note)
+
+		event, ok := versionedPayload(notifications.SchemaVersionV1, withNote, true).(*notifications.TransactionEventV1)
+		require.True(t, ok)
+		assert.Equal(t, "rent for may", event.Note)
+	})
+}
@@ -2,8 +2,12 @@ package bux
 
 import (
 	"context"
+	"database/sql"
 	"encoding/hex"
 	"errors"
+	"fmt"
+	"sort"
+	"time"
 
 	"github.com/BuxOrg/bux/chainstate"
 	"github.com/BuxOrg/bux/notifications"
@@ -11,6 +15,7 @@ import (
 	"github.com/BuxOrg/bux/utils"
 	"github.com/libsv/go-bt/v2"
 	"github.com/mrz1836/go-datastore"
+	customTypes "github.com/mrz1836/go-datastore/custom_types"
 )
 
 // TransactionBase is the same fields share between multiple transaction models
@@ -47,32 +52,49 @@ type Transaction struct {
 	TransactionBase `bson:",inline"`
 
 	// Model specific fields
-	XpubInIDs       IDs             `json:"xpub_in_ids,omitempty" toml:"xpub_in_ids" yaml:"xpub_in_ids" gorm:"<-;type:json" bson:"xpub_in_ids,omitempty"`
-	XpubOutIDs      IDs             `json:"xpub_out_ids,omitempty" toml:"xpub_out_ids" yaml:"xpub_out_ids" gorm:"<-;type:json" bson:"xpub_out_ids,omitempty"`
-	BlockHash       string          `json:"block_hash" toml:"block_hash" yaml:"block_hash" gorm:"<-;type:char(64);comment:This is the related block when the transaction was mined" bson:"block_hash,omitempty"`
-	BlockHeight     uint64          `json:"block_height" toml:"block_height" yaml:"block_height" gorm:"<-;type:bigint;comment:This is the related block when the transaction was mined" bson:"block_height,omitempty"`
-	Fee             uint64          `json:"fee" toml:"fee" yaml:"fee" gorm:"<-create;type:bigint" bson:"fee,omitempty"`
-	NumberOfInputs  uint32          `json:"number_of_inputs" toml:"number_of_inputs" yaml:"number_of_inputs" gorm:"<-;type:int" bson:"number_of_inputs,omitempty"`
-	NumberOfOutputs uint32          `json:"number_of_outputs" toml:"number_of_outputs" yaml:"number_of_outputs" gorm:"<-;type:int" bson:"number_of_outputs,omitempty"`
-	DraftID         string          `json:"draft_id" toml:"draft_id" yaml:"draft_id" gorm:"<-create;type:varchar(64);index;comment:This is the related draft id" bson:"draft_id,omitempty"`
-	TotalValue      uint64          `json:"total_value" toml:"total_value" yaml:"total_value" gorm:"<-create;type:bigint" bson:"total_value,omitempty"`
-	XpubMetadata    XpubMetadata    `json:"-" toml:"xpub_metadata" gorm:"<-;type:json;xpub_id specific metadata" bson:"xpub_metadata,omitempty"`
-	XpubOutputValue XpubOutputValue `json:"-" toml:"xpub_output_value" gorm:"<-;type:json;xpub_id specific value" bson:"xpub_output_value,omitempty"`
-	MerkleProof     MerkleProof     `json:"merkle_proof" toml:"merkle_proof" yaml:"merkle_proof" gorm:"<-;type:text;comment:Merkle Proof payload from mAPI" bson:"merkle_proof,omitempty"`
+	XpubInIDs        IDs                  `json:"xpub_in_ids,omitempty" toml:"xpub_in_ids" yaml:"xpub_in_ids" gorm:"<-;type:json" bson:"xpub_in_ids,omitempty"`
+	XpubOutIDs       IDs                  `json:"xpub_out_ids,omitempty" toml:"xpub_out_ids" yaml:"xpub_out_ids" gorm:"<-;type:json" bson:"xpub_out_ids,omitempty"`
+	BlockHash        string               `json:"block_hash" toml:"block_hash" yaml:"block_hash" gorm:"<-;type:char(64);comment:This is the related block when the transaction was mined" bson:"block_hash,omitempty"`
+	BlockHeight      uint64               `json:"block_height" toml:"block_height" yaml:"block_height" gorm:"<-;type:bigint;comment:This is the related block when the transaction was mined" bson:"block_height,omitempty"`
+	Fee              uint64               `json:"fee" toml:"fee" yaml:"fee" gorm:"<-create;type:bigint" bson:"fee,omitempty"`
+	FeeUnknown       bool                 `json:"fee_unknown,omitempty" toml:"fee_unknown" yaml:"fee_unknown" gorm:"<-create;type:boolean;comment:The value of an input is not known (IE: external inputs)" bson:"fee_unknown,omitempty"`
+	Inputs           RecordedInputs       `json:"inputs,omitempty" toml:"inputs" yaml:"inputs" gorm:"<-create;type:text;comment:This is the inputs and their owners" bson:"inputs,omitempty"`
+	NumberOfInputs   uint32               `json:"number_of_inputs" toml:"number_of_inputs" yaml:"number_of_inputs" gorm:"<-;type:int" bson:"number_of_inputs,omitempty"`
+	NumberOfOutputs  uint32               `json:"number_of_outputs" toml:"number_of_outputs" yaml:"number_of_outputs" gorm:"<-;type:int" bson:"number_of_outputs,omitempty"`
+	DraftID          string               `json:"draft_id" toml:"draft_id" yaml:"draft_id" gorm:"<-create;type:varchar(64);index;comment:This is the related draft id" bson:"draft_id,omitempty"`
+	TotalValue       uint64               `json:"total_value" toml:"total_value" yaml:"total_value" gorm:"<-create;type:bigint" bson:"total_value,omitempty"`
+	XpubMetadata     XpubMetadata         `json:"-" toml:"xpub_metadata" gorm:"<-;type:json;xpub_id specific metadata" bson:"xpub_metadata,omitempty"`
+	XpubOutputValue  XpubOutputValue      `json:"-" toml:"xpub_output_value" gorm:"<-;type:json;xpub_id specific value" bson:"xpub_output_value,omitempty"`
+	MerkleProof      MerkleProof          `json:"merkle_proof" toml:"merkle_proof" yaml:"merkle_proof" gorm:"<-;type:text;comment:Merkle Proof payload from mAPI" bson:"merkle_proof,omitempty"`
+	UnconfirmedDepth uint32               `json:"unconfirmed_depth" toml:"unconfirmed_depth" yaml:"unconfirmed_depth" gorm:"<-create;type:int;comment:This is the depth of the chain of unconfirmed ancestors when recorded" bson:"unconfirmed_depth,omitempty"`
+	FirstSeenAt      customTypes.NullTime `json:"first_seen_at" toml:"first_seen_at" yaml:"first_seen_at" gorm:"<-;index;comment:This is when the transaction was first seen (mempool or broadcast)" bson:"first_seen_at,omitempty"`
+	MinedAt          customTypes.NullTime `json:"mined_at" toml:"mined_at" yaml:"mined_at" gorm:"<-;index;comment:This is the time of the block the transaction was mined in" bson:"mined_at,omitempty"`
 
 	// Virtual Fields
 	OutputValue int64                `json:"output_value" toml:"-" yaml:"-" gorm:"-" bson:"-,omitempty"`
 	Status      SyncStatus           `json:"status" toml:"-" yaml:"-" gorm:"-" bson:"-"`
 	Direction   TransactionDirection `json:"direction" toml:"-" yaml:"-" gorm:"-" bson:"-"`
+	Note        *TransactionNote     `json:"note,omitempty" toml:"-" yaml:"-" gorm:"-" bson:"-"`       // Latest note of the xPub (see GetTransaction)
+	FiatValue   *FiatValue           `json:"fiat_value,omitempty" toml:"-" yaml:"-" gorm:"-" bson:"-"` // Fiat value of the output value (see WithExchangeRateProvider)
 	// Confirmations  uint64       `json:"-" toml:"-" yaml:"-" gorm:"-" bson:"-"`
 
 	// Private for internal use
-	draftTransaction   *DraftTransaction    `gorm:"-" bson:"-"` // Related draft transaction for processing and recording
-	syncTransaction    *SyncTransaction     `gorm:"-" bson:"-"` // Related record if broadcast config is detected (create new recordNew)
-	transactionService transactionInterface `gorm:"-" bson:"-"` // Used for interfacing methods
-	utxos              []Utxo               `gorm:"-" bson:"-"` // json:"destinations,omitempty"
-	XPubID             string               `gorm:"-" bson:"-"` // XPub of the user registering this transaction
-	beforeCreateCalled bool                 `gorm:"-" bson:"-"` // Private information that the transaction lifecycle method BeforeCreate was already called
+	draftTransaction   *DraftTransaction             `gorm:"-" bson:"-"` // Related draft transaction for processing and recording
+	syncTransaction    *SyncTransaction              `gorm:"-" bson:"-"` // Related record if broadcast config is detected (create new recordNew)
+	transactionService transactionInterface          `gorm:"-" bson:"-"` // Used for interfacing methods
+	utxos              []Utxo                        `gorm:"-" bson:"-"` // json:"destinations,omitempty"
+	XPubID             string                        `gorm:"-" bson:"-"` // XPub of the user registering this transaction
+	beforeCreateCalled bool                          `gorm:"-" bson:"-"` // Private information that the transaction lifecycle method BeforeCreate was already called
+	balanceChanges     map[string]*xpubBalanceChange `gorm:"-" bson:"-"` // Changes of the confirmed/unconfirmed balances by xPub ID
+	newlyMined         bool                          `gorm:"-" bson:"-"` // An existing transaction was mined (confirm the balances after updating)
+	historical         bool                          `gorm:"-" bson:"-"` // Already signed transaction spending utxos without a draft (RecordTransactions)
+}
+
+// xpubBalanceChange is the change of the confirmed and unconfirmed balances of an xPub (by a transaction)
+type xpubBalanceChange struct {
+	received         int64 // Value of the outputs (confirmed if the transaction is mined)
+	spentConfirmed   int64 // Value of the inputs that were funded by a mined transaction
+	spentUnconfirmed int64 // Value of the inputs that were funded by an unmined transaction
 }
 
 // newTransactionBase creates the standard transaction model base
@@ -85,6 +107,7 @@ func newTransactionBase(hex string, opts ...ModelOps) *Transaction {
 		Status:             statusComplete,
 		transactionService: transactionService{},
 		XpubOutputValue:    map[string]int64{},
+		balanceChanges:     map[string]*xpubBalanceChange{},
 	}
 }
 
@@ -152,6 +175,29 @@ func getTransactionByID(ctx context.Context, xPubID, txID string, opts ...ModelO
 	return tx, nil
 }
 
+// getTransactionsByIDs will get the transactions by ID (one query), keyed by ID (the missing ones are not set)
+func getTransactionsByIDs(ctx context.Context, ids []string, opts ...ModelOps) (map[string]*Transaction, error) {
+	transactions := make(map[string]*Transaction, len(ids))
+	if len(ids) == 0 {
+		return transactions, nil
+	}
+	idConditions := make([]map[string]interface{}, 0, len(ids))
+	for _, id := range ids {
+		idConditions = append(idConditions, map[string]interface{}{idField: id})
+	}
+	modelItems, err := getTransactions(ctx, nil, &map[string]interface{}{
+		conditionOr: idConditions,
+	}, &datastore.QueryParams{PageSize: len(ids)}, opts...)
+	if err != nil {
+		return nil, err
+	}
+	for _, transaction := range modelItems {
+		transaction.enrich(ModelTransaction, opts...)
+		transactions[transaction.ID] = transaction
+	}
+	return transactions, nil
+}
+
 // setXPubID will set the xPub ID on the model
 func (m *Transaction) setXPubID() {
 	if len(m.rawXpubKey) > 0 && len(m.XPubID) == 0 {
@@ -332,13 +378,23 @@ func getTransactionsCountInternal(ctx context.Context, conditions map[string]int
 	return count, nil
 }
 
-// UpdateTransactionMetadata will update the transaction metadata by xPubID
+// UpdateTransactionMetadata will update the transaction metadata by xPubID (the reserved fiat keys are ignored)
 func (m *Transaction) UpdateTransactionMetadata(xPubID string, metadata Metadata) error {
 	if xPubID == "" {
 		return ErrXpubIDMisMatch
 	}
 
+	// In the strict mode of the metadata limits, an update exceeding the limits is rejected
+	if m.client != nil {
+		if limits := clientMetadataLimits(m.client); limits.Mode == MetadataLimitsStrict {
+			if err := limits.check(updatedMetadata(m.XpubMetadata[xPubID], metadata)); err != nil {
+				return err
+			}
+		}
+	}
+
 	// transaction metadata is saved per xPubID
+	m.metadataUpdate = true
 	if m.XpubMetadata == nil {
 		m.XpubMetadata = make(XpubMetadata)
 	}
@@ -347,7 +403,9 @@ func (m *Transaction) UpdateTransactionMetadata(xPubID string, metadata Metadata
 	}
 
 	for key, value := range metadata {
-		if value == nil {
+		if isFiatMetadataKey(key) {
+			continue
+		} else if value == nil {
 			delete(m.XpubMetadata[xPubID], key)
 		} else {
 			m.XpubMetadata[xPubID][key] = value
@@ -357,6 +415,25 @@ func (m *Transaction) UpdateTransactionMetadata(xPubID string, metadata Metadata
 	return nil
 }
 
+// checkMetadataLimits will return the violation of the limits by the metadata of the transaction
+// (including the metadata of each xPub)
+func (m *Transaction) checkMetadataLimits(limits *MetadataLimits) error {
+	if err := m.Model.checkMetadataLimits(limits); err != nil {
+		return err
+	}
+	xPubIDs := make([]string, 0, len(m.XpubMetadata))
+	for xPubID := range m.XpubMetadata {
+		xPubIDs = append(xPubIDs, xPubID)
+	}
+	sort.Strings(xPubIDs)
+	for _, xPubID := range xPubIDs {
+		if err := limits.check(m.XpubMetadata[xPubID]); err != nil {
+			return fmt.Errorf("xpub %s metadata: %w", xPubID, err)
+		}
+	}
+	return nil
+}
+
 // GetModelName will get the name of the current model
 func (m *Transaction) GetModelName() string {
 	return ModelTransaction.String()
@@ -367,6 +444,11 @@ func (m *Transaction) GetModelTableName() string {
 	return tableTransactions
 }
 
+// isVersioned will return true (saves use optimistic concurrency, see ErrStaleModel)
+func (m *Transaction) isVersioned() bool {
+	return true
+}
+
 // Save will save the model into the Datastore
 func (m *Transaction) Save(ctx context.Context) (err error) {
 	// Prepare the metadata
@@ -412,31 +494,35 @@ func (m *Transaction) setID() (err error) {
 }
 
 // getValue calculates the value of the transaction
-func (m *Transaction) getValues() (outputValue uint64, fee uint64) {
+//
+// The fee of the draft is used if the draft funded all the inputs, otherwise the fee is only known
+// if the value of all the inputs is known (IE: co-funded transactions with external inputs)
+func (m *Transaction) getValues() (outputValue uint64, fee uint64, feeUnknown bool) {
 	// Parse the outputs
+	var totalOutputs uint64
 	for _, output := range m.TransactionBase.parsedTx.Outputs {
-		outputValue += output.Satoshis
+		totalOutputs += output.Satoshis
 	}
+	outputValue = totalOutputs
 
 	// Remove the "change" from the transaction if found
-	// todo: this will NOT work for an "external" tx that is coming into our system?
 	if m.draftTransaction != nil {
 		outputValue -= m.draftTransaction.Configuration.ChangeSatoshis
-		fee = m.draftTransaction.Configuration.Fee
-	} else { // external transaction
-
-		// todo: missing inputs in some tests?
-		var inputValue uint64
-		for _, input := range m.TransactionBase.parsedTx.Inputs {
-			inputValue += input.PreviousTxSatoshis
+		if !m.Inputs.hasExternal() {
+			fee = m.draftTransaction.Configuration.Fee
 		}
+	}
 
-		if inputValue > 0 {
-			fee = inputValue - outputValue
-			outputValue -= fee
+	// External and co-funded transactions
+	if m.draftTransaction == nil || m.Inputs.hasExternal() {
+		inputValue := m.Inputs.value()
+		if len(m.Inputs) == 0 || !m.Inputs.allKnown() || inputValue < totalOutputs {
+			return outputValue, 0, true
+		}
+		fee = inputValue - totalOutputs
+		if m.draftTransaction == nil {
+			return outputValue, fee, false
 		}
-
-		// todo: outputs we know are accumulated
 	}
 
 	// remove the fee from the value
@@ -492,6 +578,22 @@ func (m *Transaction) BeforeCreating(ctx context.Context) error {
 			m.draftTransaction.Configuration.Sync = m.Client().DefaultSyncConfig()
 		}
 
+		// The preferred broadcast providers must be configured (at the time of recording)
+		if err = m.draftTransaction.Configuration.Sync.validatePreferredProviders(
+			m.Client().Chainstate(),
+		); err != nil {
+			return err
+		}
+
+		// Cascade the metadata of the draft (see WithDraftMetadataPolicy)
+		metadataPolicy := m.Client().DraftMetadataPolicy()
+		m.Metadata = cascadeDraftMetadata(metadataPolicy, m.Metadata, m.draftTransaction.Metadata)
+		if metadataPolicy != DraftMetadataOff && len(m.XPubID) > 0 {
+			if err = m.UpdateTransactionMetadata(m.XPubID, m.Metadata); err != nil {
+				return err
+			}
+		}
+
 		// Create the sync transaction model
 		sync := newSyncTransaction(
 			m.GetID(),
@@ -510,8 +612,11 @@ func (m *Transaction) BeforeCreating(ctx context.Context) error {
 		}
 		sync.P2PStatus = p2pStatus
 
-		// Use the same metadata
+		// Use the same metadata (and correlate the sync transaction with the draft)
 		sync.Metadata = m.Metadata
+		if metadataPolicy != DraftMetadataOff {
+			sync.Metadata = syncMetadataWithCorrelationID(m.Metadata, m.DraftID)
+		}
 
 		// set this transaction on the sync transaction object. This is needed for the first broadcast
 		sync.transaction = m
@@ -523,7 +628,8 @@ func (m *Transaction) BeforeCreating(ctx context.Context) error {
 	}
 
 	// If we are external and the user disabled incoming transaction checking, check outputs
-	if m.isExternal() && !m.Client().IsITCEnabled() {
+	// (the flag of the xPub receiving the transaction, see SetXpubFlags)
+	if m.isExternal() && !xpubITCEnabled(ctx, m.Client(), m.itcXpubID(ctx)) {
 		// Check that the transaction has >= 1 known destination
 		if !m.TransactionBase.hasOneKnownDestination(ctx, m.Client(), m.GetOptions(false)...) {
 			return ErrNoMatchingOutputs
@@ -536,12 +642,29 @@ func (m *Transaction) BeforeCreating(ctx context.Context) error {
 	}
 
 	// Set the values from the inputs/outputs and draft tx
-	m.TotalValue, m.Fee = m.getValues()
+	m.TotalValue, m.Fee, m.FeeUnknown = m.getValues()
+
+	// Stamp the exchange rate at the moment of recording (skipped if there is no rate)
+	if rate := getExchangeRate(ctx, m.Client()); rate != nil {
+		if m.Metadata == nil {
+			m.Metadata = make(Metadata)
+		}
+		stampFiatValue(m.Metadata, metadataKeyFiatValue, rate, int64(m.TotalValue))
+	}
 
 	// Add values if found
 	if m.TransactionBase.parsedTx != nil {
 		m.NumberOfInputs = uint32(len(m.TransactionBase.parsedTx.Inputs))
 		m.NumberOfOutputs = uint32(len(m.TransactionBase.parsedTx.Outputs))
+
+		// Track the depth of the chain of unconfirmed ancestors
+		if m.BlockHeight == 0 {
+			if m.UnconfirmedDepth, err = getUnconfirmedDepth(
+				ctx, getParentIDs(m.TransactionBase.parsedTx), 0, m.GetOptions(false)...,
+			); err != nil {
+				return err
+			}
+		}
 	}
 
 	m.DebugLog("end: " + m.Name() + " BeforeCreating hook")
@@ -565,9 +688,22 @@ func (m *Transaction) AfterCreated(ctx context.Context) error {
 		} else if xPub == nil {
 			return ErrMissingRequiredXpub
 		}
-		if err = xPub.incrementBalance(ctx, balance); err != nil {
+		if err = xPub.incrementBalance(ctx, balance, m.ID, m.balanceEventReason(balance)); err != nil {
 			return err
 		}
+
+		// Update the confirmed and unconfirmed balances
+		if change, ok := m.balanceChanges[xPubID]; ok {
+			confirmed, unconfirmed := -change.spentConfirmed, -change.spentUnconfirmed
+			if m.BlockHeight > 0 {
+				confirmed += change.received
+			} else {
+				unconfirmed += change.received
+			}
+			if err = xPub.incrementConfirmationBalances(ctx, confirmed, unconfirmed); err != nil {
+				return err
+			}
+		}
 	}
 
 	// Update the draft transaction, process broadcasting
@@ -581,29 +717,37 @@ func (m *Transaction) AfterCreated(ctx context.Context) error {
 	}
 
 	// Fire notifications (this is already in a go routine)
-	notify(notifications.EventTypeCreate, m)
+	notify(ctx, notifications.EventTypeCreate, m)
 
 	m.DebugLog("end: " + m.Name() + " AfterCreated hook")
 	return nil
 }
 
 // AfterUpdated will fire after the model is updated in the Datastore
-func (m *Transaction) AfterUpdated(_ context.Context) error {
+func (m *Transaction) AfterUpdated(ctx context.Context) error {
 	m.DebugLog("starting: " + m.Name() + " AfterUpdated hook...")
 
+	// The transaction was mined, confirm the balances of the xPubs
+	if m.newlyMined {
+		m.newlyMined = false
+		if err := m.confirmBalances(ctx); err != nil {
+			return err
+		}
+	}
+
 	// Fire notifications (this is already in a go routine)
-	notify(notifications.EventTypeUpdate, m)
+	notify(ctx, notifications.EventTypeUpdate, m)
 
 	m.DebugLog("end: " + m.Name() + " AfterUpdated hook")
 	return nil
 }
 
 // AfterDeleted will fire after the model is deleted in the Datastore
-func (m *Transaction) AfterDeleted(_ context.Context) error {
+func (m *Transaction) AfterDeleted(ctx context.Context) error {
 	m.DebugLog("starting: " + m.Name() + " AfterDelete hook...")
 
 	// Fire notifications (this is already in a go routine)
-	notify(notifications.EventTypeDelete, m)
+	notify(ctx, notifications.EventTypeDelete, m)
 
 	m.DebugLog("end: " + m.Name() + " AfterDelete hook")
 	return nil
@@ -611,6 +755,9 @@ func (m *Transaction) AfterDeleted(_ context.Context) error {
 
 // ChildModels will get any related sub models
 func (m *Transaction) ChildModels() (childModels []ModelInterface) {
+	// Add the audit entry (if audited)
+	childModels = m.Model.ChildModels()
+
 	// Add the UTXOs if found
 	for index := range m.utxos {
 		childModels = append(childModels, &m.utxos[index])
@@ -626,11 +773,9 @@ func (m *Transaction) ChildModels() (childModels []ModelInterface) {
 
 // processUtxos will process the inputs and outputs for UTXOs
 func (m *Transaction) processUtxos(ctx context.Context) error {
-	// Input should be processed only for outgoing transactions
-	if m.draftTransaction != nil {
-		if err := m.processInputs(ctx); err != nil {
-			return err
-		}
+	// All the inputs are recorded: spending known utxos or external (IE: co-funded transactions)
+	if err := m.processInputs(ctx); err != nil {
+		return err
 	}
 
 	return m.processOutputs(ctx)
@@ -643,13 +788,19 @@ func (m *Transaction) processOutputs(ctx context.Context) (err error) {
 	newOpts := append(opts, New())
 	var destination *Destination
 
+	// custom script outputs of the draft are never attributed to a destination
+	var customOutputs map[uint32]bool
+	if m.draftTransaction != nil {
+		customOutputs = m.draftTransaction.customOutputIndexes()
+	}
+
 	// check all the outputs for a known destination
 	numberOfOutputsProcessed := 0
 	for index := range m.TransactionBase.parsedTx.Outputs {
 		amount := m.TransactionBase.parsedTx.Outputs[index].Satoshis
 
 		// only save outputs with a satoshi value attached to it
-		if amount > 0 {
+		if amount > 0 && !customOutputs[uint32(index)] {
 
 			txLockingScript := m.TransactionBase.parsedTx.Outputs[index].LockingScript.String()
 			lockingScript := utils.GetDestinationLockingScript(txLockingScript)
@@ -663,11 +814,17 @@ func (m *Transaction) processOutputs(ctx context.Context) (err error) {
 				return
 			} else if destination != nil {
 
+				// Funds are still recorded for a revoked destination, but notified separately
+				if destination.IsRevoked() && m.isExternal() {
+					notify(ctx, notifications.EventTypeRevokedDestinationPayment, destination)
+				}
+
 				// Add value of output to xPub ID
 				if _, ok := m.XpubOutputValue[destination.XpubID]; !ok {
 					m.XpubOutputValue[destination.XpubID] = 0
 				}
 				m.XpubOutputValue[destination.XpubID] += int64(amount)
+				m.getBalanceChange(destination.XpubID).received += int64(amount)
 
 				utxo, _ := m.client.GetUtxoByTransactionID(ctx, m.ID, uint32(index))
 				if utxo == nil {
@@ -704,24 +861,49 @@ func (m *Transaction) processInputs(ctx context.Context) (err error) {
 
 	var utxo *Utxo
 
+	// Values of the external inputs given when recording (see WithExternalInputs)
+	externalValues := make(map[string]uint64, len(m.externalInputs))
+	for _, input := range m.externalInputs {
+		externalValues[externalInputKey(input.TxID, input.OutputIndex)] = input.Satoshis
+	}
+
 	// check whether we are spending an internal utxo
-	for index := range m.TransactionBase.parsedTx.Inputs {
+	m.Inputs = make(RecordedInputs, 0, len(m.TransactionBase.parsedTx.Inputs))
+	for index, txInput := range m.TransactionBase.parsedTx.Inputs {
+		input := &RecordedInput{
+			Index:       uint32(index),
+			OutputIndex: txInput.PreviousTxOutIndex,
+			TxID:        hex.EncodeToString(txInput.PreviousTxID()),
+		}
+		m.Inputs = append(m.Inputs, input)
+
 		// todo: optimize this SQL SELECT to get all utxos in one query?
 		if utxo, err = m.transactionService.getUtxo(ctx,
-			hex.EncodeToString(m.TransactionBase.parsedTx.Inputs[index].PreviousTxID()),
-			m.TransactionBase.parsedTx.Inputs[index].PreviousTxOutIndex,
-			opts...,
+			input.TxID, input.OutputIndex, opts...,
 		); err != nil {
 			return
-		} else if utxo != nil { // Found a UTXO record
+		} else if utxo == nil { // External input (not a utxo of bux)
+			input.External = true
+			if satoshis, ok := externalValues[externalInputKey(input.TxID, input.OutputIndex)]; ok {
+				input.Satoshis, input.ValueKnown = satoshis, true
+			} else if txInput.PreviousTxSatoshis > 0 {
+				input.Satoshis, input.ValueKnown = txInput.PreviousTxSatoshis, true
+			}
+		} else { // Found a UTXO record
 
 			// Is Spent?
 			if len(utxo.SpendingTxID.String) > 0 {
 				return ErrUtxoAlreadySpent
 			}
 
-			// Only if IUC is enabled (or client is nil which means its enabled by default)
-			if client == nil || client.IsIUCEnabled() {
+			// Is Frozen? (historical transactions are already on-chain)
+			if utxo.Frozen && !m.historical {
+				return utxo.frozenError()
+			}
+
+			// Only if IUC is enabled for the owner of the utxo (or client is nil which means its enabled by default),
+			// historical and external transactions were signed without a reservation
+			if !m.historical && !m.isExternal() && xpubIUCEnabled(ctx, client, utxo.XpubID) {
 
 				// check whether the utxo is spent
 				isReserved := len(utxo.DraftID.String) > 0
@@ -736,12 +918,27 @@ func (m *Transaction) processInputs(ctx context.Context) (err error) {
 				}
 			}
 
-			// Update the output value
+			input.Satoshis, input.ValueKnown, input.XpubID = utxo.Satoshis, true, utxo.XpubID
+
+			// Update the output value (only the inputs of the xPub are counted)
 			if _, ok := m.XpubOutputValue[utxo.XpubID]; !ok {
 				m.XpubOutputValue[utxo.XpubID] = 0
 			}
 			m.XpubOutputValue[utxo.XpubID] -= int64(utxo.Satoshis)
 
+			// Spending a confirmed or unconfirmed utxo? (funding transaction has a block height)
+			var fundingTx *Transaction
+			if fundingTx, err = m.transactionService.getTransaction(
+				ctx, utxo.TransactionID, opts...,
+			); err != nil {
+				return
+			}
+			if fundingTx != nil && fundingTx.BlockHeight > 0 {
+				m.getBalanceChange(utxo.XpubID).spentConfirmed += int64(utxo.Satoshis)
+			} else {
+				m.getBalanceChange(utxo.XpubID).spentUnconfirmed += int64(utxo.Satoshis)
+			}
+
 			// Mark utxo as spent
 			utxo.SpendingTxID.Valid = true
 			utxo.SpendingTxID.String = m.ID
@@ -752,13 +949,109 @@ func (m *Transaction) processInputs(ctx context.Context) (err error) {
 				m.XpubInIDs = append(m.XpubInIDs, utxo.XpubID)
 			}
 		}
-
-		// todo: what if the utxo is nil (not found)?
 	}
 
 	return
 }
 
+// getBalanceChange will get (or start) the balance change for the given xPub ID
+func (m *Transaction) getBalanceChange(xPubID string) *xpubBalanceChange {
+	if m.balanceChanges == nil {
+		m.balanceChanges = make(map[string]*xpubBalanceChange)
+	}
+	if _, ok := m.balanceChanges[xPubID]; !ok {
+		m.balanceChanges[xPubID] = &xpubBalanceChange{}
+	}
+	return m.balanceChanges[xPubID]
+}
+
+// balanceEventReason will get the reason of a balance change caused by the transaction (see BalanceEvent)
+func (m *Transaction) balanceEventReason(balance int64) BalanceEventReason {
+	if balance >= 0 {
+		return BalanceEventIncoming
+	} else if m.Fee > 0 && uint64(-balance) == m.Fee {
+		return BalanceEventFee
+	}
+	return BalanceEventOutgoing
+}
+
+// setBlockInfo will set the block information (transaction was found on-chain)
+//
+// If an existing (unmined) transaction is mined, the balances are confirmed after updating
+func (m *Transaction) setBlockInfo(blockHash string, blockHeight uint64) {
+	if m.BlockHeight == 0 && blockHeight > 0 && !m.IsNew() {
+		m.newlyMined = true
+	}
+	m.BlockHash = blockHash
+	m.BlockHeight = blockHeight
+}
+
+// setFirstSeen will set the time the transaction was first seen (mempool or broadcast), if not already set
+func (m *Transaction) setFirstSeen(seenAt time.Time) bool {
+	if m.FirstSeenAt.Valid {
+		return false
+	}
+	m.FirstSeenAt = customTypes.NullTime{
+		NullTime: sql.NullTime{
+			Time:  seenAt.UTC(),
+			Valid: true,
+		},
+	}
+	return true
+}
+
+// setMinedAt will set the time the transaction was mined from the block header (if the header is known)
+func (m *Transaction) setMinedAt(ctx context.Context) {
+	if len(m.BlockHash) == 0 {
+		return
+	}
+	blockHeader, err := getBlockHeaderByHash(ctx, m.BlockHash, m.GetOptions(false)...)
+	if err != nil || blockHeader == nil {
+		return
+	}
+	m.MinedAt = customTypes.NullTime{
+		NullTime: sql.NullTime{
+			Time:  time.Unix(int64(blockHeader.Time), 0).UTC(),
+			Valid: true,
+		},
+	}
+
+	// Mined implies it was seen (IE: found on-chain before the mempool)
+	m.setFirstSeen(m.MinedAt.Time)
+}
+
+// confirmBalances will move the value of the unspent outputs from the unconfirmed to the confirmed balance
+func (m *Transaction) confirmBalances(ctx context.Context) error {
+
+	// Get the unspent outputs of the transaction
+	opts := m.GetOptions(false)
+	utxos, err := getUtxosByConditions(ctx, map[string]interface{}{
+		transactionIDField: m.ID,
+		spendingTxIDField:  nil,
+	}, nil, opts...)
+	if err != nil {
+		return err
+	}
+
+	// Sum the value by xPub
+	values := make(map[string]int64)
+	for _, utxo := range utxos {
+		values[utxo.XpubID] += int64(utxo.Satoshis)
+	}
+
+	// Move the value into the confirmed balance
+	var xPub *Xpub
+	for xPubID, value := range values {
+		if xPub, err = getXpubWithCache(ctx, m.Client(), "", xPubID, opts...); err != nil {
+			return err
+		}
+		if err = xPub.incrementConfirmationBalances(ctx, value, -value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // IsXpubAssociated will check if this key is associated to this transaction
 func (m *Transaction) IsXpubAssociated(rawXpubKey string) bool {
 	// Hash the raw key
@@ -812,7 +1105,9 @@ func (m *Transaction) Display() interface{} {
 	} else {
 		m.Direction = TransactionDirectionOut
 	}
+	m.FiatValue = fiatValueFromMetadata(m.Metadata, m.OutputValue)
 
+	m.Inputs = m.Inputs.display(m.XPubID)
 	m.XpubInIDs = nil
 	m.XpubOutIDs = nil
 	m.XpubMetadata = nil
@@ -820,6 +1115,20 @@ func (m *Transaction) Display() interface{} {
 	return m
 }
 
+// DisplayFor filter the model for display without the fields hidden from the profile (see RegisterDisplayMask)
+//
+// The display is built from a copy, the transaction is not changed
+func (m *Transaction) DisplayFor(profile string) interface{} {
+	view := *m
+	if m.Metadata != nil {
+		view.Metadata = make(Metadata, len(m.Metadata))
+		for key, value := range m.Metadata {
+			view.Metadata[key] = value
+		}
+	}
+	return displayFor(ModelTransaction, view.Display(), profile)
+}
+
 // Migrate model specific migration on startup
 func (m *Transaction) Migrate(client datastore.ClientInterface) error {
 	tableName := client.GetTableName(tableTransactions)
@@ -896,6 +1205,11 @@ func (m *Transaction) migrateMySQL(client datastore.ClientInterface, tableName s
 //
 // This is used to validate if an external transaction should be recorded into the engine
 func (m *TransactionBase) hasOneKnownDestination(ctx context.Context, client ClientInterface, opts ...ModelOps) bool {
+	return m.knownDestination(ctx, client, opts...) != nil
+}
+
+// knownDestination will return the first known destination paid by the transaction (nil if none is known)
+func (m *TransactionBase) knownDestination(ctx context.Context, client ClientInterface, opts ...ModelOps) *Destination {
 	// todo: this can be optimized searching X records at a time vs loop->query->loop->query
 	lockingScript := ""
 	for index := range m.parsedTx.Outputs {
@@ -905,10 +1219,24 @@ func (m *TransactionBase) hasOneKnownDestination(ctx context.Context, client Cli
 			destination = newDestination("", lockingScript, opts...)
 			destination.Client().Logger().Error(ctx, "error getting destination: "+err.Error())
 		} else if destination != nil && destination.LockingScript == lockingScript {
-			return true
+			return destination
 		}
 	}
-	return false
+	return nil
+}
+
+// itcXpubID will return the xPub deciding the incoming transaction check: the owner of the first known
+// destination paid by a transaction recorded without a draft, otherwise the xPub registering the transaction
+func (m *Transaction) itcXpubID(ctx context.Context) string {
+	m.setXPubID()
+	if len(m.DraftID) == 0 && m.TransactionBase.parsedTx != nil {
+		if destination := m.TransactionBase.knownDestination(
+			ctx, m.Client(), m.GetOptions(false)...,
+		); destination != nil {
+			return destination.XpubID
+		}
+	}
+	return m.XPubID
 }
 
 // RegisterTasks will register the model specific tasks on client initialization
@@ -996,8 +1324,8 @@ func processTransaction(ctx context.Context, transaction *Transaction) error {
 		return err
 	}
 
-	transaction.BlockHash = txInfo.BlockHash
-	transaction.BlockHeight = uint64(txInfo.BlockHeight)
+	transaction.setBlockInfo(txInfo.BlockHash, uint64(txInfo.BlockHeight))
+	transaction.setMinedAt(ctx)
 
 	return transaction.Save(ctx)
 }
@@ -5,6 +5,7 @@ import "context"
 // transactionInterface is used for extending or mocking transaction methods
 type transactionInterface interface {
 	getDestinationByLockingScript(ctx context.Context, lockingScript string, opts ...ModelOps) (*Destination, error)
+	getTransaction(ctx context.Context, txID string, opts ...ModelOps) (*Transaction, error)
 	getUtxo(ctx context.Context, txID string, index uint32, opts ...ModelOps) (*Utxo, error)
 }
 
@@ -17,6 +18,12 @@ func (x transactionService) getDestinationByLockingScript(ctx context.Context,
 	return getDestinationByLockingScript(ctx, lockingScript, opts...)
 }
 
+// getTransaction will get a transaction by ID
+func (x transactionService) getTransaction(ctx context.Context, txID string,
+	opts ...ModelOps) (*Transaction, error) {
+	return getTransactionByID(ctx, "", txID, opts...)
+}
+
 // getUtxo will get an utxo given the conditions
 func (x transactionService) getUtxo(ctx context.Context, txID string, index uint32,
 	opts ...ModelOps) (*Utxo, error) {
@@ -8,6 +8,7 @@ import (
 
 	"github.com/BuxOrg/bux/utils"
 	"github.com/bitcoinschema/go-bitcoin/v2"
+	"github.com/libsv/go-bc"
 	"github.com/libsv/go-bk/bec"
 	"github.com/libsv/go-bk/bip32"
 	"github.com/libsv/go-bt/v2"
@@ -20,6 +21,7 @@ import (
 
 var (
 	testTxHex            = "020000000165bb8d2733298b2d3b441a871868d6323c5392facf0d3eced3a6c6a17dc84c10000000006a473044022057b101e9a017cdcc333ef66a4a1e78720ae15adf7d1be9c33abec0fe56bc849d022013daa203095522039fadaba99e567ec3cf8615861d3b7258d5399c9f1f4ace8f412103b9c72aebee5636664b519e5f7264c78614f1e57fa4097ae83a3012a967b1c4b9ffffffff03e0930400000000001976a91413473d21dc9e1fb392f05a028b447b165a052d4d88acf9020000000000001976a91455decebedd9a6c2c2d32cf0ee77e2640c3955d3488ac00000000000000000c006a09446f7457616c6c657400000000"
+	testBlockHash        = "0000000000000000034dcb6b21b7ec7a3d5e2e4e5e7e8c11a2c4ed33d2e5c9aa"
 	testTxID             = "1b52eac9d1eb0adf3ce6a56dee1c4768780b8126e288aca65dd1db32f173b853"
 	testTxID2            = "104cc87da1c6a6d3ce3e0dcffa92533c32d66818871a443b2d8b2933278dbb65"
 	testTx2Hex           = "020000000189fbccca3a5e2bfc8a161bf7f54e8cb5898e296ae8c23b620b89ed570711f931000000006a47304402204e94380ae4d27f8bb9b40dd9944b4fea532d5fe12cf62c1994a6a495c81490f202204aab42f8f1b15259a032e58a3810fbbfd691771b92317f8a12a0da84761a400641210382229c0295e4d63ee54c541eba40be2963f0e80489b7da34e022d513a723181fffffffff0259970400000000001976a914e069bd2e2fe3ea702c40d5e65b491b734c01686788ac00000000000000000c006a09446f7457616c6c657400000000"
@@ -49,6 +51,10 @@ func (x transactionServiceMock) getDestinationByLockingScript(_ context.Context,
 	return x.destinations[lockingScript], nil
 }
 
+func (x transactionServiceMock) getTransaction(_ context.Context, _ string, _ ...ModelOps) (*Transaction, error) {
+	return nil, nil
+}
+
 func (x transactionServiceMock) getUtxo(_ context.Context, txID string, index uint32, _ ...ModelOps) (*Utxo, error) {
 	return x.utxos[txID][index], nil
 }
@@ -162,6 +168,60 @@ func TestTransaction_getTransactionsByXpubID(t *testing.T) {
 	})
 }
 
+// TestTransaction_seenAndMinedAt will test the methods setFirstSeen() and setMinedAt()
+func TestTransaction_seenAndMinedAt(t *testing.T) {
+	t.Run("first seen is only set once", func(t *testing.T) {
+		transaction := newTransaction(testTxHex)
+		firstSeen := time.Now().Add(-time.Hour).UTC()
+		assert.True(t, transaction.setFirstSeen(firstSeen))
+		assert.False(t, transaction.setFirstSeen(time.Now()))
+		assert.True(t, transaction.FirstSeenAt.Valid)
+		assert.Equal(t, firstSeen, transaction.FirstSeenAt.Time)
+	})
+
+	t.Run("unknown block header", func(t *testing.T) {
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, true, WithCustomTaskManager(&taskManagerMockBase{}))
+		defer deferMe()
+		transaction := newTransaction(testTxHex, append(client.DefaultModelOptions(), New())...)
+		transaction.setBlockInfo(testBlockHash, 100)
+		transaction.setMinedAt(ctx)
+		assert.False(t, transaction.MinedAt.Valid)
+		assert.False(t, transaction.FirstSeenAt.Valid)
+	})
+
+	t.Run("mined at from the block header, filter by condition", func(t *testing.T) {
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, true, WithCustomTaskManager(&taskManagerMockBase{}))
+		defer deferMe()
+		opts := client.DefaultModelOptions()
+
+		blockTime := time.Date(2022, 4, 1, 12, 0, 0, 0, time.UTC)
+		blockHeader := newBlockHeader(testBlockHash, 100, bc.BlockHeader{
+			Bits:           []byte{},
+			HashPrevBlock:  []byte{},
+			HashMerkleRoot: []byte{},
+			Time:           uint32(blockTime.Unix()),
+		}, append(opts, New())...)
+		require.NoError(t, blockHeader.Save(ctx))
+
+		transaction := newTransaction(testTxHex, append(opts, New())...)
+		transaction.setBlockInfo(testBlockHash, 100)
+		transaction.setMinedAt(ctx)
+		require.True(t, transaction.MinedAt.Valid)
+		assert.Equal(t, blockTime, transaction.MinedAt.Time)
+		assert.Equal(t, blockTime, transaction.FirstSeenAt.Time)
+		require.NoError(t, transaction.Save(ctx))
+
+		transactions, err := getTransactions(ctx, nil, &map[string]interface{}{
+			"mined_at": map[string]interface{}{
+				"$gte": customTypes.NullTime{NullTime: sql.NullTime{Time: blockTime.AddDate(0, 0, -1), Valid: true}},
+			},
+		}, nil, opts...)
+		require.NoError(t, err)
+		require.Len(t, transactions, 1)
+		assert.Equal(t, blockTime, transactions[0].MinedAt.Time.UTC())
+	})
+}
+
 // TestTransaction_UpdateTransactionMetadata will test the method UpdateTransactionMetadata()
 func TestTransaction_UpdateTransactionMetadata(t *testing.T) {
 	t.Run("tx without meta data", func(t *testing.T) {
@@ -440,6 +500,38 @@ func TestTransaction_processInputs(t *testing.T) {
 		require.ErrorIs(t, err, ErrUtxoAlreadySpent)
 	})
 
+	t.Run("frozen utxo", func(t *testing.T) {
+		transaction := newTransaction(testTxHex, New())
+		require.NotNil(t, transaction)
+
+		transaction.draftTransaction = &DraftTransaction{
+			TransactionBase: TransactionBase{ID: testDraftID},
+		}
+		transaction.transactionService = transactionServiceMock{
+			utxos: map[string]map[uint32]*Utxo{
+				testTxID2: {
+					uint32(0): {
+						Model: Model{name: ModelUtxo},
+						UtxoPointer: UtxoPointer{
+							OutputIndex:   0,
+							TransactionID: testTxID2,
+						},
+						XpubID: "test-xpub-id",
+						DraftID: customTypes.NullString{NullString: sql.NullString{
+							Valid:  true,
+							String: testDraftID,
+						}},
+						Frozen: true,
+					},
+				},
+			},
+		}
+
+		ctx := context.Background()
+		err := transaction.processInputs(ctx)
+		require.ErrorIs(t, err, ErrUtxoFrozen)
+	})
+
 	t.Run("not reserved utxo", func(t *testing.T) {
 		transaction := newTransaction(testTxHex, New())
 		require.NotNil(t, transaction)
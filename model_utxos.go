@@ -3,12 +3,14 @@ package bux
 import (
 	"context"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/BuxOrg/bux/utils"
 	"github.com/mrz1836/go-datastore"
 	customTypes "github.com/mrz1836/go-datastore/custom_types"
 	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
 )
 
 // UtxoPointer is the actual pointer (index) for the UTXO
@@ -17,6 +19,57 @@ type UtxoPointer struct {
 	OutputIndex   uint32 `json:"output_index" toml:"output_index" yaml:"output_index" gorm:"<-:create;type:uint;comment:This is the index of the output in the transaction" bson:"output_index"`
 }
 
+// Conflicts for a manual utxo reservation
+const (
+	UtxoConflictAlreadyReserved = "already_reserved" // Utxo is reserved by a draft (or another reference)
+	UtxoConflictAlreadySpent    = "already_spent"    // Utxo has been spent
+	UtxoConflictFrozen          = "frozen"           // Utxo is frozen (compliance hold)
+	UtxoConflictNotFound        = "not_found"        // Utxo was not found (for the given xPub)
+	UtxoConflictUnsupported     = "unsupported_type" // Utxo is not a P2PKH output (drafts can not spend it)
+)
+
+// UtxoReservationResult is the result of a manual reservation for a single utxo
+type UtxoReservationResult struct {
+	UtxoPointer `bson:",inline"`
+	Conflict    string `json:"conflict,omitempty" toml:"conflict" yaml:"conflict" bson:"conflict,omitempty"` // Set if the utxo was not reserved
+	Reserved    bool   `json:"reserved" toml:"reserved" yaml:"reserved" bson:"reserved"`                     // True if the utxo is reserved for the reference
+}
+
+// UtxosUnavailableError is when one or more of the utxos chosen for a draft (FromUtxos) can not be used
+type UtxosUnavailableError struct {
+	Utxos []*UtxoReservationResult `json:"utxos"` // The unavailable utxos (with the conflict)
+}
+
+// Error will return the unavailable utxos with their conflict
+func (e *UtxosUnavailableError) Error() string {
+	details := make([]string, 0, len(e.Utxos))
+	for _, utxo := range e.Utxos {
+		details = append(details, fmt.Sprintf("%s:%d (%s)", utxo.TransactionID, utxo.OutputIndex, utxo.Conflict))
+	}
+	return ErrUtxosUnavailable.Error() + ": " + strings.Join(details, ", ")
+}
+
+// Unwrap will return ErrUtxosUnavailable (for errors.Is)
+func (e *UtxosUnavailableError) Unwrap() error {
+	return ErrUtxosUnavailable
+}
+
+// UtxoFrozenError is when a frozen utxo (compliance hold) is chosen for a transaction
+type UtxoFrozenError struct {
+	UtxoPointer
+	Reason string `json:"reason"` // Reason of the hold
+}
+
+// Error will return the frozen utxo with the reason of the hold
+func (e *UtxoFrozenError) Error() string {
+	return fmt.Sprintf("%s: %s:%d (%s)", ErrUtxoFrozen.Error(), e.TransactionID, e.OutputIndex, e.Reason)
+}
+
+// Unwrap will return ErrUtxoFrozen (for errors.Is)
+func (e *UtxoFrozenError) Unwrap() error {
+	return ErrUtxoFrozen
+}
+
 // Utxo is an object representing a BitCoin unspent transaction
 //
 // Gorm related models & indexes: https://gorm.io/docs/models.html - https://gorm.io/docs/indexes.html
@@ -35,7 +88,12 @@ type Utxo struct {
 	Type         string                 `json:"type" toml:"type" yaml:"type" gorm:"<-:create;type:varchar(32);comment:Type of output" bson:"type"`
 	DraftID      customTypes.NullString `json:"draft_id" toml:"draft_id" yaml:"draft_id" gorm:"<-;type:varchar(64);index;comment:Related draft id for reservations" bson:"draft_id,omitempty"`
 	ReservedAt   customTypes.NullTime   `json:"reserved_at" toml:"reserved_at" yaml:"reserved_at" gorm:"<-;comment:When it was reserved" bson:"reserved_at,omitempty"`
+	ReservedTill customTypes.NullTime   `json:"reserved_till,omitempty" toml:"reserved_till" yaml:"reserved_till" gorm:"<-;index;comment:When a manual reservation expires" bson:"reserved_till,omitempty"`
 	SpendingTxID customTypes.NullString `json:"spending_tx_id,omitempty" toml:"spending_tx_id" yaml:"spending_tx_id" gorm:"<-;type:char(64);index;comment:This is tx ID of the spend" bson:"spending_tx_id,omitempty"`
+	Frozen       bool                   `json:"frozen" toml:"frozen" yaml:"frozen" gorm:"<-;type:boolean;default:false;index;comment:The utxo is frozen (compliance hold), it can not be spent" bson:"frozen"`
+	FrozenAt     customTypes.NullTime   `json:"frozen_at,omitempty" toml:"frozen_at" yaml:"frozen_at" gorm:"<-;comment:When the utxo was frozen" bson:"frozen_at,omitempty"`
+	FrozenBy     string                 `json:"frozen_by,omitempty" toml:"frozen_by" yaml:"frozen_by" gorm:"<-;type:varchar(255);comment:Who froze the utxo" bson:"frozen_by,omitempty"`
+	FrozenReason string                 `json:"frozen_reason,omitempty" toml:"frozen_reason" yaml:"frozen_reason" gorm:"<-;type:varchar(255);comment:The reason of the hold" bson:"frozen_reason,omitempty"`
 
 	// Virtual field holding the original transaction the utxo originated from
 	// This is needed when signing a new transaction that spends the utxo
@@ -64,6 +122,7 @@ func getSpendableUtxos(ctx context.Context, xPubID, utxoType string, queryParams
 	var models []Utxo
 	conditions := map[string]interface{}{
 		draftIDField:      nil,
+		frozenField:       false,
 		spendingTxIDField: nil,
 		typeField:         utxoType,
 		xPubIDField:       xPubID,
@@ -79,6 +138,8 @@ func getSpendableUtxos(ctx context.Context, xPubID, utxoType string, queryParams
 			}
 			if utxo.XpubID != xPubID || utxo.SpendingTxID.Valid {
 				return nil, ErrUtxoAlreadySpent
+			} else if utxo.Frozen {
+				return nil, utxo.frozenError()
 			}
 			models = append(models, *utxo)
 		}
@@ -111,41 +172,47 @@ func getSpendableUtxos(ctx context.Context, xPubID, utxoType string, queryParams
 }
 
 // unReserveUtxos remove the reservation on the utxos for the given draft ID
+//
+// Conditional update on the draft: a utxo reserved by another draft in the meantime keeps its reservation
 func unReserveUtxos(ctx context.Context, xPubID, draftID string, opts ...ModelOps) error {
-	var models []Utxo
-	conditions := map[string]interface{}{
-		xPubIDField:  xPubID,
-		draftIDField: draftID,
-	}
-
-	// Get the records
-	if err := getModels(
-		ctx, NewBaseModel(ModelNameEmpty, opts...).Client().Datastore(),
-		&models, conditions, nil, defaultDatabaseReadTimeout,
-	); err != nil {
-		if errors.Is(err, datastore.ErrNoResults) {
-			return nil
-		}
+	ds := NewBaseModel(ModelNameEmpty, opts...).Client().Datastore()
+	tableName := ds.GetTableName(tableUTXOs)
+	updatedAt := time.Now().UTC()
+
+	if ds.Engine() == datastore.MongoDB {
+		_, err := ds.GetMongoCollectionByTableName(tableName).UpdateMany(ctx, bson.M{
+			xPubIDField:  xPubID,
+			draftIDField: draftID,
+		}, bson.M{"$set": bson.M{
+			draftIDField:      nil,
+			reservedAtField:   nil,
+			reservedTillField: nil,
+			updatedAtField:    updatedAt,
+		}})
 		return err
 	}
 
-	// Loop and un-reserve
-	for index := range models {
-		utxo := models[index]
-		utxo.enrich(ModelUtxo, opts...)
-		utxo.DraftID.Valid = false
-		utxo.ReservedAt.Valid = false
-		if err := utxo.Save(ctx); err != nil {
-			return err
-		}
-	}
-
-	return nil
+	return gormDB(ds).WithContext(ctx).Table(tableName).Where(map[string]interface{}{
+		xPubIDField:  xPubID,
+		draftIDField: draftID,
+	}).Updates(map[string]interface{}{
+		draftIDField:      nil,
+		reservedAtField:   nil,
+		reservedTillField: nil,
+		updatedAtField:    updatedAt,
+	}).Error
 }
 
 // reserveUtxos reserve utxos for the given draft ID and amount
-func reserveUtxos(ctx context.Context, xPubID, draftID string,
-	satoshis uint64, feePerByte float64, fromUtxos []*UtxoPointer, opts ...ModelOps) ([]*Utxo, error) {
+//
+// When fromUtxos is set, exactly those utxos are reserved (all must be available) and the automatic
+// selection is only used to top up the amount if includeAutomatic is set. inputsFee returns the fee of the
+// given number of reserved inputs (see DraftTransaction.calculateFee)
+//
+// The reservations of the draft are released on any error
+func reserveUtxos(ctx context.Context, xPubID, draftID string, satoshis uint64,
+	inputsFee func(inputs int) (uint64, error), fromUtxos []*UtxoPointer, includeAutomatic bool,
+	opts ...ModelOps) (_ []*Utxo, err error) {
 
 	// Create base model
 	m := NewBaseModel(ModelNameEmpty, opts...)
@@ -159,77 +226,99 @@ func reserveUtxos(ctx context.Context, xPubID, draftID string,
 		return nil, err
 	}
 
+	// Release the utxos reserved so far (under the lock)
+	defer func() {
+		if err != nil {
+			if releaseErr := unReserveUtxos(
+				ctx, xPubID, draftID, m.GetOptions(false)...,
+			); releaseErr != nil {
+				err = errors.Wrap(err, releaseErr.Error())
+			}
+		}
+	}()
+
 	// Get spendable utxos
 	utxos := new([]*Utxo)
 	feeNeeded := uint64(0)
 	reservedSatoshis := uint64(0)
 
-	queryParams := &datastore.QueryParams{}
-	if fromUtxos == nil {
-		// if we are not getting all utxos, paginate the retreival
-		queryParams.Page = 1
-		queryParams.PageSize = m.pageSize
-		if queryParams.PageSize == 0 {
-			queryParams.PageSize = defaultPageSize
-		}
-	}
-
-reserveUtxoLoop:
-	for {
-		var freeUtxos []*Utxo
-		if freeUtxos, err = getSpendableUtxos(
-			ctx, xPubID, utils.ScriptTypePubKeyHash, queryParams, fromUtxos, opts..., // todo: allow reservation of utxos by a different utxo destination type
+	// Reserve exactly the utxos chosen by the caller
+	if fromUtxos != nil {
+		var explicitUtxos []*Utxo
+		if explicitUtxos, err = reserveExplicitUtxos(
+			ctx, xPubID, draftID, fromUtxos, opts...,
 		); err != nil {
 			return nil, err
 		}
-
-		if len(freeUtxos) == 0 {
-			break reserveUtxoLoop
+		for _, utxo := range explicitUtxos {
+			reservedSatoshis += utxo.Satoshis
+			*utxos = append(*utxos, utxo)
 		}
+		if feeNeeded, err = inputsFee(len(*utxos)); err != nil {
+			return nil, err
+		}
+	}
 
-		// Set vars
-		size := utils.GetInputSizeForType(utils.ScriptTypePubKeyHash)
-
-		// Loop the returned utxos
-		for _, utxo := range freeUtxos {
-
-			// Set the values on the UTXO
-			utxo.DraftID.Valid = true
-			utxo.DraftID.String = draftID
-			utxo.ReservedAt.Valid = true
-			utxo.ReservedAt.Time = time.Now().UTC()
-
-			// Accumulate the reserved satoshis
-			reservedSatoshis += utxo.Satoshis
+	// Automatic selection (or top up of the chosen utxos)
+	if fromUtxos == nil || (includeAutomatic && reservedSatoshis < satoshis+feeNeeded) {
+		queryParams := &datastore.QueryParams{
+			Page:     1,
+			PageSize: m.pageSize,
+		}
+		if queryParams.PageSize == 0 {
+			queryParams.PageSize = defaultPageSize
+		}
 
-			// Save the UTXO
-			// todo: should occur in 1 DB transaction
-			if err = utxo.Save(ctx); err != nil {
+	reserveUtxoLoop:
+		for {
+			var freeUtxos []*Utxo
+			if freeUtxos, err = getSpendableUtxos(
+				ctx, xPubID, utils.ScriptTypePubKeyHash, queryParams, nil, opts..., // todo: allow reservation of utxos by a different utxo destination type
+			); err != nil {
+				if errors.Is(err, ErrMissingUTXOsSpendable) && len(*utxos) > 0 {
+					break reserveUtxoLoop
+				}
 				return nil, err
 			}
 
-			// Add the utxo to the final slice
-			*utxos = append(*utxos, utxo)
-
-			// add fee for this new input
-			feeNeeded += uint64(float64(size) * feePerByte)
-			if reservedSatoshis >= (satoshis + feeNeeded) {
+			if len(freeUtxos) == 0 {
 				break reserveUtxoLoop
 			}
-		}
 
-		if queryParams.PageSize == 0 {
-			// break the loop if we are not paginating
-			break reserveUtxoLoop
+			// Loop the returned utxos
+			for _, utxo := range freeUtxos {
+
+				// Reserve the UTXO (another draft might have reserved or frozen it since it was selected)
+				if err = utxo.reserve(ctx, draftID); errors.Is(err, ErrUtxoAlreadyReserved) || errors.Is(err, ErrUtxoFrozen) {
+					continue // Select a different utxo (the reserved one is not returned again)
+				} else if err != nil {
+					return nil, err
+				}
+
+				// Accumulate the reserved satoshis
+				reservedSatoshis += utxo.Satoshis
+
+				// Save the UTXO
+				// todo: should occur in 1 DB transaction
+				if err = utxo.Save(ctx); err != nil {
+					return nil, err
+				}
+
+				// Add the utxo to the final slice
+				*utxos = append(*utxos, utxo)
+
+				// add fee for this new input
+				if feeNeeded, err = inputsFee(len(*utxos)); err != nil {
+					return nil, err
+				}
+				if reservedSatoshis >= (satoshis + feeNeeded) {
+					break reserveUtxoLoop
+				}
+			}
 		}
 	}
 
 	if reservedSatoshis < satoshis {
-		if err = unReserveUtxos(
-			ctx, xPubID, draftID, m.GetOptions(false)...,
-		); err != nil {
-			return nil, errors.Wrap(err, ErrNotEnoughUtxos.Error())
-		}
 		return nil, ErrNotEnoughUtxos
 	}
 
@@ -245,6 +334,351 @@ reserveUtxoLoop:
 	return *utxos, nil
 }
 
+// reserveExplicitUtxos will reserve exactly the given utxos for the draft
+//
+// All utxos are validated first (unspent, unreserved and owned by the xPub), if any is not available
+// nothing is reserved and a UtxosUnavailableError is returned with the detail per utxo
+func reserveExplicitUtxos(ctx context.Context, xPubID, draftID string, fromUtxos []*UtxoPointer,
+	opts ...ModelOps) ([]*Utxo, error) {
+
+	utxos := make([]*Utxo, 0, len(fromUtxos))
+	unavailable := make([]*UtxoReservationResult, 0)
+	usedUtxos := make([]string, 0, len(fromUtxos))
+	for _, pointer := range fromUtxos {
+		utxo, err := getUtxo(ctx, pointer.TransactionID, pointer.OutputIndex, opts...)
+		if err != nil {
+			return nil, err
+		}
+
+		result := &UtxoReservationResult{UtxoPointer: *pointer}
+		if utxo == nil || utxo.XpubID != xPubID {
+			result.Conflict = UtxoConflictNotFound
+		} else if utxo.Type != utils.ScriptTypePubKeyHash { // Same filter as the automatic inputs
+			result.Conflict = UtxoConflictUnsupported
+		} else if utxo.SpendingTxID.Valid {
+			result.Conflict = UtxoConflictAlreadySpent
+		} else if utxo.Frozen {
+			return nil, utxo.frozenError()
+		} else if utxo.DraftID.Valid && utxo.DraftID.String != draftID {
+			result.Conflict = UtxoConflictAlreadyReserved
+		} else if utils.StringInSlice(utxo.ID, usedUtxos) {
+			return nil, ErrDuplicateUTXOs
+		}
+		if len(result.Conflict) > 0 {
+			unavailable = append(unavailable, result)
+			continue
+		}
+
+		usedUtxos = append(usedUtxos, utxo.ID)
+		utxos = append(utxos, utxo)
+	}
+
+	if len(unavailable) > 0 {
+		return nil, &UtxosUnavailableError{Utxos: unavailable}
+	}
+
+	// Reserve the utxos (all or nothing, another draft might have reserved one since it was validated)
+	for _, utxo := range utxos {
+		err := utxo.reserve(ctx, draftID)
+		if err == nil {
+			err = utxo.Save(ctx)
+		}
+		if err == nil {
+			continue
+		}
+
+		// Release the utxos reserved so far
+		if releaseErr := unReserveUtxos(ctx, xPubID, draftID, opts...); releaseErr != nil {
+			return nil, releaseErr
+		}
+		if errors.Is(err, ErrUtxoAlreadyReserved) {
+			return nil, &UtxosUnavailableError{Utxos: []*UtxoReservationResult{{
+				Conflict: UtxoConflictAlreadyReserved, UtxoPointer: utxo.UtxoPointer,
+			}}}
+		}
+		return nil, err
+	}
+
+	return utxos, nil
+}
+
+// reserve will reserve the utxo for the draft using a compare-and-set on the datastore
+//
+// The utxo is only reserved if it is unspent, not frozen and unreserved (or already reserved by the draft),
+// otherwise ErrUtxoAlreadyReserved is returned (the UtxoFrozenError if it was frozen in the meantime). The draft and the reservation time are set, the caller saves the utxo.
+func (m *Utxo) reserve(ctx context.Context, draftID string) error {
+	ds := m.Client().Datastore()
+	tableName := ds.GetTableName(tableUTXOs)
+
+	var reserved bool
+	if ds.Engine() == datastore.MongoDB {
+		result, err := ds.GetMongoCollectionByTableName(tableName).UpdateOne(ctx, bson.M{
+			"_id":             m.ID,
+			draftIDField:      bson.M{"$in": bson.A{nil, "", draftID}},
+			frozenField:       bson.M{"$ne": true},
+			spendingTxIDField: nil,
+		}, bson.M{"$set": bson.M{draftIDField: draftID}})
+		if err != nil {
+			return err
+		}
+		reserved = result.MatchedCount > 0
+	} else {
+		db := gormDB(ds)
+		tx := db.WithContext(ctx).Table(tableName).Where(map[string]interface{}{
+			frozenField:       false,
+			idField:           m.ID,
+			spendingTxIDField: nil,
+		}).Where(
+			db.Where(map[string]interface{}{draftIDField: nil}).Or(draftIDField+" IN ?", []string{"", draftID}),
+		).UpdateColumn(draftIDField, draftID)
+		if tx.Error != nil {
+			return tx.Error
+		}
+		reserved = tx.RowsAffected > 0
+	}
+
+	// Nothing updated: MySQL does not count the unchanged rows (already reserved by the draft)
+	if !reserved {
+		current, err := getUtxo(ctx, m.TransactionID, m.OutputIndex, m.GetOptions(false)...)
+		if err != nil {
+			return err
+		} else if current != nil && current.Frozen {
+			return current.frozenError()
+		} else if current == nil || current.SpendingTxID.Valid || current.DraftID.String != draftID {
+			return ErrUtxoAlreadyReserved
+		}
+	}
+
+	m.DraftID.Valid = true
+	m.DraftID.String = draftID
+	m.ReservedAt.Valid = true
+	m.ReservedAt.Time = time.Now().UTC()
+	return nil
+}
+
+// frozenError will return the typed error of the frozen utxo (with the reason of the hold)
+func (m *Utxo) frozenError() error {
+	return &UtxoFrozenError{UtxoPointer: m.UtxoPointer, Reason: m.FrozenReason}
+}
+
+// setFrozen will freeze (or unfreeze) the utxo, the reason and who froze it are kept while frozen
+func (m *Utxo) setFrozen(frozen bool, reason, frozenBy string) {
+	m.Frozen = frozen
+	m.FrozenAt = customTypes.NullTime{}
+	m.FrozenBy = ""
+	m.FrozenReason = ""
+	if frozen {
+		m.FrozenAt.Valid = true
+		m.FrozenAt.Time = time.Now().UTC()
+		m.FrozenBy = frozenBy
+		m.FrozenReason = reason
+	}
+}
+
+// freezeUtxo will freeze (or unfreeze) the utxo (a compliance hold, the utxo can not be reserved or spent)
+//
+// Spent utxos and utxos reserved by a draft can not be frozen (the draft could still spend it)
+func freezeUtxo(ctx context.Context, txID string, outputIndex uint32, frozen bool, reason, frozenBy string,
+	opts ...ModelOps) (*Utxo, error) {
+
+	utxo, err := getUtxo(ctx, txID, outputIndex, opts...)
+	if err != nil {
+		return nil, err
+	} else if utxo == nil {
+		return nil, ErrMissingUtxo
+	}
+
+	// Use the reservation lock of the xPub (no draft selects the utxo while freezing)
+	var unlock func()
+	unlock, err = newWaitWriteLock(
+		ctx, fmt.Sprintf(lockKeyReserveUtxo, utxo.XpubID), utxo.Client().Cachestore(),
+	)
+	defer unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	// Reload the utxo (under the lock)
+	if utxo, err = getUtxo(ctx, txID, outputIndex, opts...); err != nil {
+		return nil, err
+	} else if utxo == nil {
+		return nil, ErrMissingUtxo
+	} else if frozen && utxo.SpendingTxID.Valid {
+		return nil, ErrUtxoAlreadySpent
+	} else if frozen && utxo.DraftID.Valid && len(utxo.DraftID.String) > 0 {
+		return nil, ErrUtxoReservedByDraft
+	}
+
+	// Audit the compliance hold
+	operation := AuditOperationUnfreezeUtxo
+	if frozen {
+		operation = AuditOperationFreezeUtxo
+	}
+	entry := newAuditLog(ctx, operation, utxo, append(opts, New())...)
+
+	utxo.setFrozen(frozen, reason, frozenBy)
+	if err = saveWithAudit(ctx, utxo, entry); err != nil {
+		return nil, err
+	}
+	return utxo, nil
+}
+
+// manualReservationDraftID will return the synthetic draft id used for a manual reservation
+func manualReservationDraftID(xPubID, reference string) string {
+	return utils.Hash(manualReservationPrefix + xPubID + "-" + reference)
+}
+
+// reserveUtxosManually will reserve the given utxos using a synthetic draft id (expires after the ttl)
+//
+// Utxos that are already reserved (by another draft or reference) or spent are returned as conflicts
+func reserveUtxosManually(ctx context.Context, xPubID string, utxoPointers []UtxoPointer, ttl time.Duration,
+	reference string, opts ...ModelOps) ([]*UtxoReservationResult, error) {
+
+	// Create base model
+	m := NewBaseModel(ModelNameEmpty, opts...)
+
+	// Create the lock and set the release for after the function completes
+	unlock, err := newWaitWriteLock(
+		ctx, fmt.Sprintf(lockKeyReserveUtxo, xPubID), m.Client().Cachestore(),
+	)
+	defer unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	draftID := manualReservationDraftID(xPubID, reference)
+	reservedAt := time.Now().UTC()
+
+	results := make([]*UtxoReservationResult, 0, len(utxoPointers))
+	for _, pointer := range utxoPointers {
+		result := &UtxoReservationResult{UtxoPointer: pointer}
+		results = append(results, result)
+
+		var utxo *Utxo
+		if utxo, err = getUtxo(ctx, pointer.TransactionID, pointer.OutputIndex, opts...); err != nil {
+			return nil, err
+		} else if utxo == nil || utxo.XpubID != xPubID {
+			result.Conflict = UtxoConflictNotFound
+			continue
+		} else if utxo.SpendingTxID.Valid {
+			result.Conflict = UtxoConflictAlreadySpent
+			continue
+		} else if utxo.Frozen {
+			result.Conflict = UtxoConflictFrozen
+			continue
+		} else if utxo.DraftID.Valid && utxo.DraftID.String != draftID {
+			result.Conflict = UtxoConflictAlreadyReserved
+			continue
+		}
+
+		// Reserve (or extend the reservation for the same reference)
+		if err = utxo.reserve(ctx, draftID); errors.Is(err, ErrUtxoAlreadyReserved) {
+			result.Conflict = UtxoConflictAlreadyReserved
+			continue
+		} else if errors.Is(err, ErrUtxoFrozen) {
+			result.Conflict = UtxoConflictFrozen
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		utxo.ReservedAt.Time = reservedAt
+		utxo.ReservedTill.Valid = true
+		utxo.ReservedTill.Time = reservedAt.Add(ttl)
+		if err = utxo.Save(ctx); err != nil {
+			return nil, err
+		}
+		result.Reserved = true
+	}
+
+	return results, nil
+}
+
+// releaseExpiredUtxoReservations will remove the manual reservations that have expired
+//
+// The expired reservations are released in pages, using a conditional update (a utxo spent in the meantime
+// is not changed)
+func releaseExpiredUtxoReservations(ctx context.Context, opts ...ModelOps) error {
+	m := NewBaseModel(ModelNameEmpty, opts...)
+	ds := m.Client().Datastore()
+	now := time.Now().UTC()
+	conditions := map[string]interface{}{
+		reservedTillField: map[string]interface{}{
+			"$lt": now,
+		},
+		spendingTxIDField: nil,
+	}
+
+	// The released utxos do not match the conditions anymore, the next page is always the first
+	queryParams := &datastore.QueryParams{
+		Page:          1,
+		PageSize:      m.pageSize,
+		OrderByField:  idField,
+		SortDirection: datastore.SortAsc,
+	}
+	if queryParams.PageSize == 0 {
+		queryParams.PageSize = defaultPageSize
+	}
+	for {
+		var models []Utxo
+		if err := getModels(
+			ctx, ds, &models, conditions, queryParams, defaultDatabaseReadTimeout,
+		); err != nil {
+			if errors.Is(err, datastore.ErrNoResults) {
+				return nil
+			}
+			return err
+		}
+
+		ids := make([]string, 0, len(models))
+		for index := range models {
+			ids = append(ids, models[index].ID)
+		}
+		released, err := releaseUtxoReservations(ctx, ds, ids, now)
+		if err != nil {
+			return err
+		} else if released == 0 || len(models) < queryParams.PageSize {
+			return nil
+		}
+	}
+}
+
+// releaseUtxoReservations will remove the reservation of the given utxos if it expired before the given time
+// and the utxo is not spent (returns the number of released utxos)
+func releaseUtxoReservations(ctx context.Context, ds datastore.ClientInterface, ids []string,
+	expiredBefore time.Time) (int64, error) {
+	tableName := ds.GetTableName(tableUTXOs)
+	updatedAt := time.Now().UTC()
+
+	if ds.Engine() == datastore.MongoDB {
+		result, err := ds.GetMongoCollectionByTableName(tableName).UpdateMany(ctx, bson.M{
+			"_id":             bson.M{"$in": ids},
+			reservedTillField: bson.M{"$lt": expiredBefore},
+			spendingTxIDField: nil,
+		}, bson.M{"$set": bson.M{
+			draftIDField:      nil,
+			reservedAtField:   nil,
+			reservedTillField: nil,
+			updatedAtField:    updatedAt,
+		}})
+		if err != nil {
+			return 0, err
+		}
+		return result.ModifiedCount, nil
+	}
+
+	tx := gormDB(ds).WithContext(ctx).Table(tableName).
+		Where(idField+" IN ?", ids).
+		Where(reservedTillField+" < ?", expiredBefore).
+		Where(map[string]interface{}{spendingTxIDField: nil}).
+		Updates(map[string]interface{}{
+			draftIDField:      nil,
+			reservedAtField:   nil,
+			reservedTillField: nil,
+			updatedAtField:    updatedAt,
+		})
+	return tx.RowsAffected, tx.Error
+}
+
 // newUtxoFromTxID will start a new utxo model
 func newUtxoFromTxID(txID string, index uint32, opts ...ModelOps) *Utxo {
 	return &Utxo{
@@ -445,7 +879,11 @@ func (m *Utxo) GenerateID() string {
 func (m *Utxo) Migrate(client datastore.ClientInterface) error {
 
 	tableName := client.GetTableName(tableUTXOs)
-	if client.Engine() == datastore.MySQL {
+	if client.Engine() == datastore.MongoDB {
+		if err := m.migrateMongoDB(client, tableName); err != nil {
+			return err
+		}
+	} else if client.Engine() == datastore.MySQL {
 		if err := m.migrateMySQL(client, tableName); err != nil {
 			return err
 		}
@@ -458,6 +896,16 @@ func (m *Utxo) Migrate(client datastore.ClientInterface) error {
 	return client.IndexMetadata(client.GetTableName(tableUTXOs), metadataField)
 }
 
+// migrateMongoDB will set the frozen flag (false) on the utxos created before the flag existed
+func (m *Utxo) migrateMongoDB(client datastore.ClientInterface, tableName string) error {
+	_, err := client.GetMongoCollectionByTableName(tableName).UpdateMany(
+		context.Background(),
+		bson.M{frozenField: bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{frozenField: false}},
+	)
+	return err
+}
+
 // migratePostgreSQL is specific migration SQL for Postgresql
 func (m *Utxo) migratePostgreSQL(client datastore.ClientInterface, tableName string) error {
 	tx := client.Execute(`CREATE INDEX IF NOT EXISTS "idx_utxo_reserved" ON "` + tableName + `" ("xpub_id","type","draft_id","spending_tx_id")`)
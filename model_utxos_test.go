@@ -2,8 +2,12 @@ package bux
 
 import (
 	"context"
+	"errors"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/BuxOrg/bux/tester"
 	"github.com/BuxOrg/bux/utils"
 	"github.com/mrz1836/go-datastore"
 	"github.com/stretchr/testify/assert"
@@ -54,6 +58,14 @@ func createTestUtxos(ctx context.Context, client ClientInterface) error {
 	return nil
 }
 
+// feePerByteOfInputs will return the fee of the (P2PKH) inputs at the fee per byte
+func feePerByteOfInputs(feePerByte float64) func(inputs int) (uint64, error) {
+	inputFee := uint64(float64(utils.GetInputSizeForType(utils.ScriptTypePubKeyHash)) * feePerByte)
+	return func(inputs int) (uint64, error) {
+		return uint64(inputs) * inputFee, nil
+	}
+}
+
 // TestUtxo_newUtxo will test the method newUtxo()
 func TestUtxo_newUtxo(t *testing.T) {
 	t.Parallel()
@@ -163,7 +175,7 @@ func TestUtxo_UnReserveUtxos(t *testing.T) {
 		require.NoError(t, err)
 
 		var utxos []*Utxo
-		utxos, err = reserveUtxos(ctx, testXPubID, testDraftID2, 2000, 0.5, nil, client.DefaultModelOptions()...)
+		utxos, err = reserveUtxos(ctx, testXPubID, testDraftID2, 2000, feePerByteOfInputs(0.5), nil, false, client.DefaultModelOptions()...)
 		require.NoError(t, err)
 		assert.Len(t, utxos, 2)
 		for _, utxo := range utxos {
@@ -183,6 +195,23 @@ func TestUtxo_UnReserveUtxos(t *testing.T) {
 			assert.False(t, u.ReservedAt.Valid)
 		}
 	})
+
+	t.Run("reservation of another draft is kept", func(t *testing.T) {
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, false, WithCustomTaskManager(&taskManagerMockBase{}))
+		defer deferMe()
+
+		utxo := newUtxo(testXPubID, testTxID, testLockingScript, 12, 1225, append(client.DefaultModelOptions(), New())...)
+		require.NoError(t, utxo.Save(ctx))
+		require.NoError(t, utxo.reserve(ctx, testDraftID3))
+		require.NoError(t, utxo.Save(ctx))
+
+		// The release of the draft that lost the utxo does not clear the reservation
+		require.NoError(t, unReserveUtxos(ctx, testXPubID, testDraftID2, client.DefaultModelOptions()...))
+		got, err := getUtxo(ctx, testTxID, 12, client.DefaultModelOptions()...)
+		require.NoError(t, err)
+		assert.Equal(t, testDraftID3, got.DraftID.String)
+		assert.True(t, got.ReservedAt.Valid)
+	})
 }
 
 // TestUtxo_ReserveUtxos reserve utxos
@@ -194,7 +223,7 @@ func TestUtxo_ReserveUtxos(t *testing.T) {
 		require.NoError(t, err)
 
 		var utxos []*Utxo
-		utxos, err = reserveUtxos(ctx, testXPubID, testDraftID2, 1000, 0.5, nil, client.DefaultModelOptions()...)
+		utxos, err = reserveUtxos(ctx, testXPubID, testDraftID2, 1000, feePerByteOfInputs(0.5), nil, false, client.DefaultModelOptions()...)
 		require.NoError(t, err)
 		assert.Len(t, utxos, 1)
 		assert.Equal(t, testDraftID2, utxos[0].DraftID.String)
@@ -208,7 +237,7 @@ func TestUtxo_ReserveUtxos(t *testing.T) {
 		require.NoError(t, err)
 
 		var utxos []*Utxo
-		utxos, err = reserveUtxos(ctx, testXPubID, testDraftID2, 2000, 0.5, nil, client.DefaultModelOptions()...)
+		utxos, err = reserveUtxos(ctx, testXPubID, testDraftID2, 2000, feePerByteOfInputs(0.5), nil, false, client.DefaultModelOptions()...)
 		require.NoError(t, err)
 		assert.Len(t, utxos, 2)
 		assert.Equal(t, testDraftID2, utxos[0].DraftID.String)
@@ -223,7 +252,7 @@ func TestUtxo_ReserveUtxos(t *testing.T) {
 		err := createTestUtxos(ctx, client)
 		require.NoError(t, err)
 
-		_, err = reserveUtxos(ctx, testXPubID, testDraftID2, 20000, 0.5, nil, client.DefaultModelOptions()...)
+		_, err = reserveUtxos(ctx, testXPubID, testDraftID2, 20000, feePerByteOfInputs(0.5), nil, false, client.DefaultModelOptions()...)
 		require.Error(t, err, ErrNotEnoughUtxos)
 	})
 
@@ -239,7 +268,7 @@ func TestUtxo_ReserveUtxos(t *testing.T) {
 		}}
 
 		var utxos []*Utxo
-		utxos, err = reserveUtxos(ctx, testXPubID, testDraftID2, 1000, 0.5, fromUtxos, client.DefaultModelOptions()...)
+		utxos, err = reserveUtxos(ctx, testXPubID, testDraftID2, 1000, feePerByteOfInputs(0.5), fromUtxos, false, client.DefaultModelOptions()...)
 		require.NoError(t, err)
 		assert.Len(t, utxos, 1)
 		assert.Equal(t, testDraftID2, utxos[0].DraftID.String)
@@ -263,7 +292,7 @@ func TestUtxo_ReserveUtxos(t *testing.T) {
 		}}
 
 		var utxos []*Utxo
-		utxos, err = reserveUtxos(ctx, testXPubID, testDraftID2, 2000, 0.5, fromUtxos, client.DefaultModelOptions()...)
+		utxos, err = reserveUtxos(ctx, testXPubID, testDraftID2, 2000, feePerByteOfInputs(0.5), fromUtxos, false, client.DefaultModelOptions()...)
 		require.NoError(t, err)
 		assert.Len(t, utxos, 2)
 		assert.Equal(t, testDraftID2, utxos[0].DraftID.String)
@@ -286,10 +315,142 @@ func TestUtxo_ReserveUtxos(t *testing.T) {
 			TransactionID: testTxID,
 			OutputIndex:   16,
 		}}
-		_, err = reserveUtxos(ctx, testXPubID, testDraftID2, 2000, 0.5, fromUtxos, client.DefaultModelOptions()...)
+		_, err = reserveUtxos(ctx, testXPubID, testDraftID2, 2000, feePerByteOfInputs(0.5), fromUtxos, false, client.DefaultModelOptions()...)
 		require.Error(t, err, ErrNotEnoughUtxos)
 	})
 
+	t.Run("reserve fromUtxos exactly", func(t *testing.T) {
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, false, WithCustomTaskManager(&taskManagerMockBase{}))
+		defer deferMe()
+		err := createTestUtxos(ctx, client)
+		require.NoError(t, err)
+
+		fromUtxos := []*UtxoPointer{{
+			TransactionID: testTxID,
+			OutputIndex:   15,
+		}, {
+			TransactionID: testTxID,
+			OutputIndex:   16,
+		}}
+
+		// All chosen utxos are reserved, even if one would be enough
+		var utxos []*Utxo
+		utxos, err = reserveUtxos(ctx, testXPubID, testDraftID2, 1000, feePerByteOfInputs(0.5), fromUtxos, false, client.DefaultModelOptions()...)
+		require.NoError(t, err)
+		require.Len(t, utxos, 2)
+		assert.Equal(t, uint32(15), utxos[0].OutputIndex)
+		assert.Equal(t, uint32(16), utxos[1].OutputIndex)
+
+		// Released when the draft is canceled
+		err = unReserveUtxos(ctx, testXPubID, testDraftID2, client.DefaultModelOptions()...)
+		require.NoError(t, err)
+		var u *Utxo
+		u, err = getUtxo(ctx, testTxID, 15, client.DefaultModelOptions()...)
+		require.NoError(t, err)
+		assert.False(t, u.DraftID.Valid)
+	})
+
+	t.Run("reserve fromUtxos unavailable", func(t *testing.T) {
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, false, WithCustomTaskManager(&taskManagerMockBase{}))
+		defer deferMe()
+		err := createTestUtxos(ctx, client)
+		require.NoError(t, err)
+
+		_, err = reserveUtxos(ctx, testXPubID, testDraftID3, 1000, feePerByteOfInputs(0.5), []*UtxoPointer{{
+			TransactionID: testTxID,
+			OutputIndex:   15,
+		}}, false, client.DefaultModelOptions()...)
+		require.NoError(t, err)
+
+		fromUtxos := []*UtxoPointer{{
+			TransactionID: testTxID,
+			OutputIndex:   15,
+		}, {
+			TransactionID: testTxID,
+			OutputIndex:   16,
+		}, {
+			TransactionID: testTxID,
+			OutputIndex:   99,
+		}}
+		_, err = reserveUtxos(ctx, testXPubID, testDraftID2, 1000, feePerByteOfInputs(0.5), fromUtxos, false, client.DefaultModelOptions()...)
+		require.ErrorIs(t, err, ErrUtxosUnavailable)
+
+		var unavailableErr *UtxosUnavailableError
+		require.ErrorAs(t, err, &unavailableErr)
+		require.Len(t, unavailableErr.Utxos, 2)
+		assert.Equal(t, uint32(15), unavailableErr.Utxos[0].OutputIndex)
+		assert.Equal(t, UtxoConflictAlreadyReserved, unavailableErr.Utxos[0].Conflict)
+		assert.Equal(t, uint32(99), unavailableErr.Utxos[1].OutputIndex)
+		assert.Equal(t, UtxoConflictNotFound, unavailableErr.Utxos[1].Conflict)
+
+		// Nothing was reserved
+		var u *Utxo
+		u, err = getUtxo(ctx, testTxID, 16, client.DefaultModelOptions()...)
+		require.NoError(t, err)
+		assert.False(t, u.DraftID.Valid)
+	})
+
+	t.Run("reserve fromUtxos of another script type", func(t *testing.T) {
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, false, WithCustomTaskManager(&taskManagerMockBase{}))
+		defer deferMe()
+		err := createTestUtxos(ctx, client)
+		require.NoError(t, err)
+
+		utxo := newUtxo(testXPubID, testTxID, "6a0568656c6c6f", 20, 1225, append(client.DefaultModelOptions(), New())...)
+		require.NoError(t, utxo.Save(ctx))
+		require.NotEqual(t, utils.ScriptTypePubKeyHash, utxo.Type)
+
+		_, err = reserveUtxos(ctx, testXPubID, testDraftID2, 1000, feePerByteOfInputs(0.5), []*UtxoPointer{{
+			TransactionID: testTxID,
+			OutputIndex:   20,
+		}}, false, client.DefaultModelOptions()...)
+		require.ErrorIs(t, err, ErrUtxosUnavailable)
+
+		var unavailableErr *UtxosUnavailableError
+		require.ErrorAs(t, err, &unavailableErr)
+		require.Len(t, unavailableErr.Utxos, 1)
+		assert.Equal(t, UtxoConflictUnsupported, unavailableErr.Utxos[0].Conflict)
+	})
+
+	t.Run("reserve fromUtxos with automatic inputs", func(t *testing.T) {
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, false, WithCustomTaskManager(&taskManagerMockBase{}))
+		defer deferMe()
+		err := createTestUtxos(ctx, client)
+		require.NoError(t, err)
+
+		fromUtxos := []*UtxoPointer{{
+			TransactionID: testTxID,
+			OutputIndex:   16,
+		}}
+
+		var utxos []*Utxo
+		utxos, err = reserveUtxos(ctx, testXPubID, testDraftID2, 2000, feePerByteOfInputs(0.5), fromUtxos, true, client.DefaultModelOptions()...)
+		require.NoError(t, err)
+		require.Len(t, utxos, 2)
+		assert.Equal(t, uint32(16), utxos[0].OutputIndex)
+		assert.NotEqual(t, uint32(16), utxos[1].OutputIndex)
+		for _, utxo := range utxos {
+			assert.Equal(t, testDraftID2, utxo.DraftID.String)
+		}
+	})
+
+	t.Run("reserve fromUtxos enough without automatic inputs", func(t *testing.T) {
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, false, WithCustomTaskManager(&taskManagerMockBase{}))
+		defer deferMe()
+		err := createTestUtxos(ctx, client)
+		require.NoError(t, err)
+
+		fromUtxos := []*UtxoPointer{{
+			TransactionID: testTxID,
+			OutputIndex:   16,
+		}}
+
+		var utxos []*Utxo
+		utxos, err = reserveUtxos(ctx, testXPubID, testDraftID2, 1000, feePerByteOfInputs(0.5), fromUtxos, true, client.DefaultModelOptions()...)
+		require.NoError(t, err)
+		assert.Len(t, utxos, 1)
+	})
+
 	t.Run("reserve utxos paginated", func(t *testing.T) {
 		ctx, client, deferMe := CreateTestSQLiteClient(t, false, false, WithCustomTaskManager(&taskManagerMockBase{}))
 		defer deferMe()
@@ -297,11 +458,33 @@ func TestUtxo_ReserveUtxos(t *testing.T) {
 		require.NoError(t, err)
 
 		var utxos []*Utxo
-		utxos, err = reserveUtxos(ctx, testXPubID, testDraftID2, 4000, 0.5, nil, client.DefaultModelOptions(WithPageSize(2))...)
+		utxos, err = reserveUtxos(ctx, testXPubID, testDraftID2, 4000, feePerByteOfInputs(0.5), nil, false, client.DefaultModelOptions(WithPageSize(2))...)
 		require.NoError(t, err)
 		assert.Len(t, utxos, 4)
 	})
 
+	t.Run("reservations are released when the fee fails", func(t *testing.T) {
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, false, WithCustomTaskManager(&taskManagerMockBase{}))
+		defer deferMe()
+		err := createTestUtxos(ctx, client)
+		require.NoError(t, err)
+
+		errFee := errors.New("fee failed")
+		inputsFee := func(inputs int) (uint64, error) {
+			if inputs > 1 {
+				return 0, errFee
+			}
+			return 0, nil
+		}
+		_, err = reserveUtxos(ctx, testXPubID, testDraftID2, 2000, inputsFee, nil, false, client.DefaultModelOptions()...)
+		require.ErrorIs(t, err, errFee)
+
+		var utxos []*Utxo
+		utxos, err = getUtxosByDraftID(ctx, testDraftID2, nil, client.DefaultModelOptions()...)
+		require.NoError(t, err)
+		assert.Empty(t, utxos)
+	})
+
 	t.Run("duplicate inputs", func(t *testing.T) {
 		ctx, client, deferMe := CreateTestSQLiteClient(t, false, false, WithCustomTaskManager(&taskManagerMockBase{}))
 		defer deferMe()
@@ -319,11 +502,113 @@ func TestUtxo_ReserveUtxos(t *testing.T) {
 			OutputIndex:   utxo.OutputIndex,
 		}}
 
-		_, err = reserveUtxos(ctx, testXPubID, testDraftID2, 2200, 0.05, fromUtxos, client.DefaultModelOptions()...)
+		_, err = reserveUtxos(ctx, testXPubID, testDraftID2, 2200, feePerByteOfInputs(0.05), fromUtxos, false, client.DefaultModelOptions()...)
 		require.ErrorIs(t, err, ErrDuplicateUTXOs)
 	})
 }
 
+// TestUtxo_reserve will test the compare-and-set reservation of a utxo
+func TestUtxo_reserve(t *testing.T) {
+	ctx, client, deferMe := CreateTestSQLiteClient(t, false, false, WithCustomTaskManager(&taskManagerMockBase{}))
+	defer deferMe()
+
+	utxo := newUtxo(testXPubID, testTxID, testLockingScript, 12, 1225, append(client.DefaultModelOptions(), New())...)
+	require.NoError(t, utxo.Save(ctx))
+
+	// A stale copy (selected by both drafts before either reserved it)
+	stale, err := getUtxo(ctx, testTxID, 12, client.DefaultModelOptions()...)
+	require.NoError(t, err)
+
+	require.NoError(t, utxo.reserve(ctx, testDraftID2))
+	require.NoError(t, utxo.Save(ctx))
+	assert.Equal(t, testDraftID2, utxo.DraftID.String)
+	assert.True(t, utxo.ReservedAt.Valid)
+
+	// Already reserved by another draft
+	require.ErrorIs(t, stale.reserve(ctx, testDraftID3), ErrUtxoAlreadyReserved)
+	assert.False(t, stale.DraftID.Valid)
+
+	// Already reserved by the same draft
+	require.NoError(t, stale.reserve(ctx, testDraftID2))
+
+	var got *Utxo
+	got, err = getUtxo(ctx, testTxID, 12, client.DefaultModelOptions()...)
+	require.NoError(t, err)
+	assert.Equal(t, testDraftID2, got.DraftID.String)
+
+	// Spent utxos are not reserved
+	require.NoError(t, unReserveUtxos(ctx, testXPubID, testDraftID2, client.DefaultModelOptions()...))
+	got, err = getUtxo(ctx, testTxID, 12, client.DefaultModelOptions()...)
+	require.NoError(t, err)
+	got.SpendingTxID.Valid = true
+	got.SpendingTxID.String = testTxID
+	require.NoError(t, got.Save(ctx))
+	require.ErrorIs(t, stale.reserve(ctx, testDraftID3), ErrUtxoAlreadyReserved)
+
+	// Frozen utxos are not reserved (frozen after the utxo was selected)
+	frozen := newUtxo(testXPubID, testTxID, testLockingScript, 13, 1225, append(client.DefaultModelOptions(), New())...)
+	require.NoError(t, frozen.Save(ctx))
+	stale, err = getUtxo(ctx, testTxID, 13, client.DefaultModelOptions()...)
+	require.NoError(t, err)
+	frozen.setFrozen(true, "compliance hold", "tester")
+	require.NoError(t, frozen.Save(ctx))
+	require.ErrorIs(t, stale.reserve(ctx, testDraftID3), ErrUtxoFrozen)
+
+	got, err = getUtxo(ctx, testTxID, 13, client.DefaultModelOptions()...)
+	require.NoError(t, err)
+	assert.False(t, got.DraftID.Valid)
+}
+
+// TestUtxo_ReserveUtxos_concurrentClients will test two clients (not sharing the locks) drafting from a single utxo
+func TestUtxo_ReserveUtxos_concurrentClients(t *testing.T) {
+	sqliteConfig := tester.SQLiteIsolatedTestConfig(false)
+	newClient := func() ClientInterface {
+		_, client, deferMe := CreateTestSQLiteClient(t, false, true,
+			WithCustomTaskManager(&taskManagerMockBase{}), WithSQLite(sqliteConfig),
+		)
+		t.Cleanup(deferMe)
+		return client
+	}
+	clients := []ClientInterface{newClient(), newClient()}
+
+	fixtures := NewFixtures(t, clients[0]).WithXpub(0).WithUtxos(100000)
+
+	// Both clients draft simultaneously (each client has its own reservation lock)
+	var wg sync.WaitGroup
+	drafts := make([]*DraftTransaction, len(clients))
+	errs := make([]error, len(clients))
+	start := make(chan struct{})
+	for index := range clients {
+		wg.Add(1)
+		go func(index int) {
+			defer wg.Done()
+			<-start
+			drafts[index], errs[index] = clients[index].NewTransaction(
+				context.Background(), fixtures.RawXpub, &TransactionConfig{
+					Outputs: []*TransactionOutput{{To: testExternalAddress, Satoshis: 10000}},
+				}, clients[index].DefaultModelOptions()...,
+			)
+		}(index)
+	}
+	close(start)
+	wg.Wait()
+
+	// Only one draft reserved the utxo
+	var reserved *DraftTransaction
+	for index := range clients {
+		if errs[index] == nil {
+			require.Nil(t, reserved, "both drafts reserved the utxo")
+			reserved = drafts[index]
+		}
+	}
+	require.NotNil(t, reserved, errs)
+
+	utxos, err := getUtxosByXpubID(context.Background(), fixtures.Xpub.ID, nil, nil, nil, clients[0].DefaultModelOptions()...)
+	require.NoError(t, err)
+	require.Len(t, utxos, 1)
+	assert.Equal(t, reserved.ID, utxos[0].DraftID.String)
+}
+
 // TestUtxo_GetSpendableUtxos get spendable utxos
 func TestUtxo_GetSpendableUtxos(t *testing.T) {
 	t.Run("spendable", func(t *testing.T) {
@@ -339,14 +624,14 @@ func TestUtxo_GetSpendableUtxos(t *testing.T) {
 		require.NoError(t, err)
 		assert.Len(t, utxos, 5)
 
-		_, err = reserveUtxos(ctx, testXPubID, testDraftID2, 2000, 0.5, nil, opts...)
+		_, err = reserveUtxos(ctx, testXPubID, testDraftID2, 2000, feePerByteOfInputs(0.5), nil, false, opts...)
 		require.NoError(t, err)
 
 		utxos, err = getSpendableUtxos(ctx, testXPubID, utils.ScriptTypePubKeyHash, nil, nil, opts...)
 		require.NoError(t, err)
 		assert.Len(t, utxos, 3)
 
-		_, err = reserveUtxos(ctx, testXPubID, testDraftID3, 1000, 0.5, nil, opts...)
+		_, err = reserveUtxos(ctx, testXPubID, testDraftID3, 1000, feePerByteOfInputs(0.5), nil, false, opts...)
 		require.NoError(t, err)
 
 		utxos, err = getSpendableUtxos(ctx, testXPubID, utils.ScriptTypePubKeyHash, nil, nil, opts...)
@@ -393,6 +678,316 @@ func TestUtxo_GetSpendableUtxos(t *testing.T) {
 	})
 }
 
+// TestClient_ReserveUtxosManually will test the method ReserveUtxosManually()
+func TestClient_ReserveUtxosManually(t *testing.T) {
+
+	t.Run("reserve, conflicts and release", func(t *testing.T) {
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, false, WithCustomTaskManager(&taskManagerMockBase{}))
+		defer deferMe()
+		err := createTestUtxos(ctx, client)
+		require.NoError(t, err)
+
+		// Spend one of the utxos
+		var spent *Utxo
+		spent, err = getUtxo(ctx, testTxID, 15, client.DefaultModelOptions()...)
+		require.NoError(t, err)
+		spent.SpendingTxID.Valid = true
+		spent.SpendingTxID.String = testTxID2
+		require.NoError(t, spent.Save(ctx))
+
+		var results []*UtxoReservationResult
+		results, err = client.ReserveUtxosManually(ctx, testXPubID, []UtxoPointer{
+			{TransactionID: testTxID, OutputIndex: 12},
+			{TransactionID: testTxID, OutputIndex: 13},
+		}, time.Hour, "ref-1")
+		require.NoError(t, err)
+		require.Len(t, results, 2)
+		assert.True(t, results[0].Reserved)
+		assert.True(t, results[1].Reserved)
+
+		results, err = client.ReserveUtxosManually(ctx, testXPubID, []UtxoPointer{
+			{TransactionID: testTxID, OutputIndex: 13},
+			{TransactionID: testTxID, OutputIndex: 14},
+			{TransactionID: testTxID, OutputIndex: 15},
+			{TransactionID: testTxID, OutputIndex: 99},
+		}, time.Hour, "ref-2")
+		require.NoError(t, err)
+		require.Len(t, results, 4)
+		assert.Equal(t, UtxoConflictAlreadyReserved, results[0].Conflict)
+		assert.True(t, results[1].Reserved)
+		assert.Equal(t, UtxoConflictAlreadySpent, results[2].Conflict)
+		assert.Equal(t, UtxoConflictNotFound, results[3].Conflict)
+
+		// Drafts can only use the unreserved utxo
+		var utxos []*Utxo
+		utxos, err = getSpendableUtxos(ctx, testXPubID, utils.ScriptTypePubKeyHash, nil, nil, client.DefaultModelOptions()...)
+		require.NoError(t, err)
+		require.Len(t, utxos, 1)
+		assert.Equal(t, uint32(16), utxos[0].OutputIndex)
+
+		// Release the first reference
+		err = client.ReleaseManualReservation(ctx, testXPubID, "ref-1")
+		require.NoError(t, err)
+
+		utxos, err = getSpendableUtxos(ctx, testXPubID, utils.ScriptTypePubKeyHash, nil, nil, client.DefaultModelOptions()...)
+		require.NoError(t, err)
+		assert.Len(t, utxos, 3)
+	})
+
+	t.Run("expired reservations are released", func(t *testing.T) {
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, false, WithCustomTaskManager(&taskManagerMockBase{}))
+		defer deferMe()
+		err := createTestUtxos(ctx, client)
+		require.NoError(t, err)
+
+		_, err = client.ReserveUtxosManually(ctx, testXPubID, []UtxoPointer{
+			{TransactionID: testTxID, OutputIndex: 12},
+		}, time.Millisecond, "ref-1")
+		require.NoError(t, err)
+		time.Sleep(10 * time.Millisecond)
+
+		err = taskCleanupDraftTransactions(ctx, client.Logger(), client.DefaultModelOptions()...)
+		require.NoError(t, err)
+
+		var utxo *Utxo
+		utxo, err = getUtxo(ctx, testTxID, 12, client.DefaultModelOptions()...)
+		require.NoError(t, err)
+		assert.False(t, utxo.DraftID.Valid)
+		assert.False(t, utxo.ReservedTill.Valid)
+	})
+
+	t.Run("expired reservations are released in pages", func(t *testing.T) {
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, false, WithCustomTaskManager(&taskManagerMockBase{}))
+		defer deferMe()
+		err := createTestUtxos(ctx, client)
+		require.NoError(t, err)
+
+		pointers := []UtxoPointer{
+			{TransactionID: testTxID, OutputIndex: 12},
+			{TransactionID: testTxID, OutputIndex: 13},
+			{TransactionID: testTxID, OutputIndex: 14},
+			{TransactionID: testTxID, OutputIndex: 15},
+			{TransactionID: testTxID, OutputIndex: 16},
+		}
+		_, err = client.ReserveUtxosManually(ctx, testXPubID, pointers, time.Millisecond, "ref-1")
+		require.NoError(t, err)
+		time.Sleep(10 * time.Millisecond)
+
+		// A utxo spent after the reservation expired keeps its record
+		var spent *Utxo
+		spent, err = getUtxo(ctx, testTxID, 16, client.DefaultModelOptions()...)
+		require.NoError(t, err)
+		spent.SpendingTxID.Valid = true
+		spent.SpendingTxID.String = testTxID2
+		require.NoError(t, spent.Save(ctx))
+
+		require.NoError(t, releaseExpiredUtxoReservations(ctx, client.DefaultModelOptions(WithPageSize(2))...))
+
+		for _, pointer := range pointers[:4] {
+			var utxo *Utxo
+			utxo, err = getUtxo(ctx, pointer.TransactionID, pointer.OutputIndex, client.DefaultModelOptions()...)
+			require.NoError(t, err)
+			assert.False(t, utxo.DraftID.Valid)
+			assert.False(t, utxo.ReservedTill.Valid)
+		}
+		spent, err = getUtxo(ctx, testTxID, 16, client.DefaultModelOptions()...)
+		require.NoError(t, err)
+		assert.Equal(t, testTxID2, spent.SpendingTxID.String)
+		assert.True(t, spent.DraftID.Valid)
+	})
+
+	t.Run("missing reference", func(t *testing.T) {
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, false, WithCustomTaskManager(&taskManagerMockBase{}))
+		defer deferMe()
+
+		_, err := client.ReserveUtxosManually(ctx, testXPubID, nil, time.Hour, "")
+		assert.ErrorIs(t, err, ErrMissingReservationReference)
+	})
+}
+
+// TestClient_FreezeUtxo will test the methods FreezeUtxo() and UnfreezeUtxo()
+func TestClient_FreezeUtxo(t *testing.T) {
+
+	// newFrozenUtxo will create the test utxos (and the xPub) and freeze the utxo 12
+	newFrozenUtxo := func(t *testing.T) (context.Context, ClientInterface) {
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, false, WithCustomTaskManager(&taskManagerMockBase{}))
+		t.Cleanup(deferMe)
+		require.NoError(t, createTestUtxos(ctx, client))
+
+		xPub := newXpub(testXPub, append(client.DefaultModelOptions(), New())...)
+		require.NoError(t, xPub.Save(ctx))
+		require.NoError(t, xPub.incrementConfirmationBalances(ctx, 5*1225, 0))
+
+		utxo, err := client.FreezeUtxo(ctx, testTxID, 12, "court order 42", "compliance@example.com")
+		require.NoError(t, err)
+		assert.True(t, utxo.Frozen)
+		assert.True(t, utxo.FrozenAt.Valid)
+		assert.Equal(t, "court order 42", utxo.FrozenReason)
+		assert.Equal(t, "compliance@example.com", utxo.FrozenBy)
+		return ctx, client
+	}
+
+	t.Run("missing reason", func(t *testing.T) {
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, false, WithCustomTaskManager(&taskManagerMockBase{}))
+		defer deferMe()
+
+		_, err := client.FreezeUtxo(ctx, testTxID, 12, "", "")
+		assert.ErrorIs(t, err, ErrMissingFreezeReason)
+	})
+
+	t.Run("unknown utxo", func(t *testing.T) {
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, false, WithCustomTaskManager(&taskManagerMockBase{}))
+		defer deferMe()
+
+		_, err := client.FreezeUtxo(ctx, testTxID, 99, "court order 42", "")
+		assert.ErrorIs(t, err, ErrMissingUtxo)
+	})
+
+	t.Run("reserved utxo", func(t *testing.T) {
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, false, WithCustomTaskManager(&taskManagerMockBase{}))
+		defer deferMe()
+		require.NoError(t, createTestUtxos(ctx, client))
+
+		_, err := reserveUtxos(ctx, testXPubID, testDraftID, 1000, feePerByteOfInputs(0.5), []*UtxoPointer{
+			{TransactionID: testTxID, OutputIndex: 12},
+		}, false, client.DefaultModelOptions()...)
+		require.NoError(t, err)
+
+		_, err = client.FreezeUtxo(ctx, testTxID, 12, "court order 42", "")
+		require.ErrorIs(t, err, ErrUtxoReservedByDraft)
+
+		var utxo *Utxo
+		utxo, err = getUtxo(ctx, testTxID, 12, client.DefaultModelOptions()...)
+		require.NoError(t, err)
+		assert.False(t, utxo.Frozen)
+		assert.Equal(t, testDraftID, utxo.DraftID.String)
+	})
+
+	t.Run("excluded from the draft selection", func(t *testing.T) {
+		ctx, client := newFrozenUtxo(t)
+
+		utxos, err := getSpendableUtxos(ctx, testXPubID, utils.ScriptTypePubKeyHash, nil, nil, client.DefaultModelOptions()...)
+		require.NoError(t, err)
+		require.Len(t, utxos, 4)
+		for _, utxo := range utxos {
+			assert.NotEqual(t, uint32(12), utxo.OutputIndex)
+		}
+	})
+
+	t.Run("excluded from the manual reservation", func(t *testing.T) {
+		ctx, client := newFrozenUtxo(t)
+
+		results, err := client.ReserveUtxosManually(ctx, testXPubID, []UtxoPointer{
+			{TransactionID: testTxID, OutputIndex: 12},
+			{TransactionID: testTxID, OutputIndex: 13},
+		}, time.Hour, "ref-1")
+		require.NoError(t, err)
+		require.Len(t, results, 2)
+		assert.Equal(t, UtxoConflictFrozen, results[0].Conflict)
+		assert.False(t, results[0].Reserved)
+		assert.True(t, results[1].Reserved)
+	})
+
+	t.Run("coin control returns the reason", func(t *testing.T) {
+		ctx, client := newFrozenUtxo(t)
+
+		_, err := reserveUtxos(ctx, testXPubID, testDraftID, 1000, feePerByteOfInputs(0.5), []*UtxoPointer{
+			{TransactionID: testTxID, OutputIndex: 12},
+		}, false, client.DefaultModelOptions()...)
+		require.ErrorIs(t, err, ErrUtxoFrozen)
+
+		var frozenErr *UtxoFrozenError
+		require.ErrorAs(t, err, &frozenErr)
+		assert.Equal(t, "court order 42", frozenErr.Reason)
+		assert.Equal(t, uint32(12), frozenErr.OutputIndex)
+	})
+
+	t.Run("frozen balance", func(t *testing.T) {
+		ctx, client := newFrozenUtxo(t)
+
+		balances, err := client.GetXpubBalances(ctx, testXPubID)
+		require.NoError(t, err)
+		assert.Equal(t, uint64(5*1225), balances.Confirmed)
+		assert.Equal(t, uint64(1225), balances.Frozen)
+		assert.Equal(t, uint64(4*1225), balances.Available)
+	})
+
+	t.Run("unfreeze", func(t *testing.T) {
+		ctx, client := newFrozenUtxo(t)
+
+		utxo, err := client.UnfreezeUtxo(ctx, testTxID, 12)
+		require.NoError(t, err)
+		assert.False(t, utxo.Frozen)
+		assert.False(t, utxo.FrozenAt.Valid)
+		assert.Empty(t, utxo.FrozenReason)
+
+		var utxos []*Utxo
+		utxos, err = getSpendableUtxos(ctx, testXPubID, utils.ScriptTypePubKeyHash, nil, nil, client.DefaultModelOptions()...)
+		require.NoError(t, err)
+		assert.Len(t, utxos, 5)
+	})
+}
+
+// TestClient_ForEachUtxo will test the method ForEachUtxo()
+func TestClient_ForEachUtxo(t *testing.T) {
+
+	t.Run("iterate all utxos in batches", func(t *testing.T) {
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, false, WithCustomTaskManager(&taskManagerMockBase{}))
+		defer deferMe()
+		err := createTestUtxos(ctx, client)
+		require.NoError(t, err)
+
+		// count the records held in memory for every page
+		maxLoaded := 0
+		client.(*Client).options.keysetPageLoaded = func(records int) {
+			if records > maxLoaded {
+				maxLoaded = records
+			}
+		}
+
+		seen := make(map[string]bool)
+		err = client.ForEachUtxo(ctx, testXPubID, nil, 2, func(utxo *Utxo) error {
+			assert.False(t, seen[utxo.ID])
+			seen[utxo.ID] = true
+			return nil
+		})
+		require.NoError(t, err)
+		assert.Len(t, seen, 5)
+		assert.Positive(t, maxLoaded)
+		assert.LessOrEqual(t, maxLoaded, 2)
+	})
+
+	t.Run("stop on error", func(t *testing.T) {
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, false, WithCustomTaskManager(&taskManagerMockBase{}))
+		defer deferMe()
+		err := createTestUtxos(ctx, client)
+		require.NoError(t, err)
+
+		count := 0
+		err = client.ForEachUtxo(ctx, testXPubID, nil, 2, func(utxo *Utxo) error {
+			count++
+			return ErrMissingUtxo
+		})
+		assert.ErrorIs(t, err, ErrMissingUtxo)
+		assert.Equal(t, 1, count)
+	})
+
+	t.Run("canceled context", func(t *testing.T) {
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, false, WithCustomTaskManager(&taskManagerMockBase{}))
+		defer deferMe()
+		err := createTestUtxos(ctx, client)
+		require.NoError(t, err)
+
+		canceledCtx, cancel := context.WithCancel(ctx)
+		cancel()
+
+		err = client.ForEachUtxo(canceledCtx, testXPubID, nil, 2, func(utxo *Utxo) error {
+			return nil
+		})
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+}
+
 // TestUtxo_Save will test the method Save()
 func TestUtxo_Save(t *testing.T) {
 	// t.Parallel()
@@ -4,9 +4,11 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/BuxOrg/bux/utils"
 	"github.com/mrz1836/go-datastore"
+	customTypes "github.com/mrz1836/go-datastore/custom_types"
 )
 
 // Xpub is an object representing an HD-Key or extended public key (xPub for short)
@@ -17,14 +19,40 @@ type Xpub struct {
 	Model `bson:",inline"`
 
 	// Model specific fields
-	ID              string `json:"id" toml:"id" yaml:"id" gorm:"<-:create;type:char(64);primaryKey;comment:This is the sha256(xpub) hash" bson:"_id"`
-	CurrentBalance  uint64 `json:"current_balance" toml:"current_balance" yaml:"current_balance" gorm:"<-;comment:The current balance of unspent satoshis" bson:"current_balance"`
-	NextInternalNum uint32 `json:"next_internal_num" toml:"next_internal_num" yaml:"next_internal_num" gorm:"<-;type:int;comment:The next index number for the internal xPub derivation" bson:"next_internal_num"`
-	NextExternalNum uint32 `json:"next_external_num" toml:"next_external_num" yaml:"next_external_num" gorm:"<-;type:int;comment:The next index number for the external xPub derivation" bson:"next_external_num"`
+	ID                 string `json:"id" toml:"id" yaml:"id" gorm:"<-:create;type:char(64);primaryKey;comment:This is the sha256(xpub) hash" bson:"_id"`
+	CurrentBalance     uint64 `json:"current_balance" toml:"current_balance" yaml:"current_balance" gorm:"<-;comment:The current balance of unspent satoshis" bson:"current_balance"`
+	ConfirmedBalance   uint64 `json:"confirmed_balance" toml:"confirmed_balance" yaml:"confirmed_balance" gorm:"<-;comment:The balance of unspent satoshis in mined transactions" bson:"confirmed_balance"`
+	UnconfirmedBalance uint64 `json:"unconfirmed_balance" toml:"unconfirmed_balance" yaml:"unconfirmed_balance" gorm:"<-;comment:The balance of unspent satoshis in unmined transactions" bson:"unconfirmed_balance"`
+	NextInternalNum    uint32 `json:"next_internal_num" toml:"next_internal_num" yaml:"next_internal_num" gorm:"<-;type:int;comment:The next index number for the internal xPub derivation" bson:"next_internal_num"`
+	NextExternalNum    uint32 `json:"next_external_num" toml:"next_external_num" yaml:"next_external_num" gorm:"<-;type:int;comment:The next index number for the external xPub derivation" bson:"next_external_num"`
+	ITCOverride        *bool  `json:"itc_override" toml:"itc_override" yaml:"itc_override" gorm:"<-;type:boolean;comment:Overrides the incoming transactions check of the client (null = client)" bson:"itc_override"`
+	IUCOverride        *bool  `json:"iuc_override" toml:"iuc_override" yaml:"iuc_override" gorm:"<-;type:boolean;comment:Overrides the input utxo check of the client (null = client)" bson:"iuc_override"`
+
+	BalanceAlertLow  *uint64 `json:"balance_alert_low" toml:"balance_alert_low" yaml:"balance_alert_low" gorm:"<-;comment:Alert when the balance drops below (null = no alert)" bson:"balance_alert_low"`
+	BalanceAlertHigh *uint64 `json:"balance_alert_high" toml:"balance_alert_high" yaml:"balance_alert_high" gorm:"<-;comment:Alert when the balance exceeds (null = no alert)" bson:"balance_alert_high"`
+
+	BalanceAlertState string `json:"balance_alert_state" toml:"balance_alert_state" yaml:"balance_alert_state" gorm:"<-:create;type:varchar(4);comment:The fired balance alert not recovered yet (low, high or empty)" bson:"balance_alert_state"`
+
+	NotificationsMutedUntil customTypes.NullTime `json:"notifications_muted_until" toml:"notifications_muted_until" yaml:"notifications_muted_until" gorm:"<-;comment:The notifications are muted until (null = not muted)" bson:"notifications_muted_until,omitempty"`
+
+	// Virtual Fields
+	ITCEnabled bool `json:"itc_enabled" toml:"-" yaml:"-" gorm:"-" bson:"-"` // Effective incoming transactions check (see Display)
+	IUCEnabled bool `json:"iuc_enabled" toml:"-" yaml:"-" gorm:"-" bson:"-"` // Effective input utxo check (see Display)
+
+	NotificationsMuted bool `json:"notifications_muted" toml:"-" yaml:"-" gorm:"-" bson:"-"` // The mute window is active (see Display)
 
 	destinations []Destination `gorm:"-" bson:"-"` // json:"destinations,omitempty"
 }
 
+// XpubBalances is the confirmed, unconfirmed (pending) and reserved balances of an xPub
+type XpubBalances struct {
+	Confirmed   uint64 `json:"confirmed" toml:"confirmed" yaml:"confirmed" bson:"confirmed"`         // Unspent satoshis in mined transactions
+	Unconfirmed uint64 `json:"unconfirmed" toml:"unconfirmed" yaml:"unconfirmed" bson:"unconfirmed"` // Unspent satoshis in unmined transactions
+	Reserved    uint64 `json:"reserved" toml:"reserved" yaml:"reserved" bson:"reserved"`             // Unspent satoshis locked by draft transactions
+	Frozen      uint64 `json:"frozen" toml:"frozen" yaml:"frozen" bson:"frozen"`                     // Unspent satoshis in frozen utxos (compliance hold)
+	Available   uint64 `json:"available" toml:"available" yaml:"available" bson:"available"`         // Unspent satoshis that can be spent (not reserved or frozen)
+}
+
 // newXpub will start a new xPub model
 func newXpub(key string, opts ...ModelOps) *Xpub {
 	return &Xpub{
@@ -93,7 +121,7 @@ func getXpubWithCache(ctx context.Context, client ClientInterface,
 	// Attempt to get from cache
 	xPub := new(Xpub)
 	found, err := getModelFromCache(
-		ctx, client.Cachestore(), cacheKey, xPub,
+		ctx, client, cacheKey, xPub, opts...,
 	)
 	if err != nil { // Found a real error
 		return nil, err
@@ -116,7 +144,7 @@ func getXpubWithCache(ctx context.Context, client ClientInterface,
 	// Save to cache
 	// todo: run in a go routine
 	if err = saveToCache(
-		ctx, []string{cacheKey}, xPub, 0,
+		ctx, []string{cacheKey}, xPub,
 	); err != nil {
 		return nil, err
 	}
@@ -173,40 +201,137 @@ func (m *Xpub) getNewDestination(ctx context.Context, chain uint32, destinationT
 		return nil, ErrUnsupportedDestinationType
 	}
 
-	// Increment the next num
-	num, err := m.incrementNextNum(ctx, chain)
-	if err != nil {
-		return nil, err
-	}
+	// Increment the next num (skip any index that is already used - cache/DB mismatch)
+	for retry := 0; retry < defaultDestinationIndexRetries; retry++ {
+		num, err := m.incrementNextNum(ctx, chain)
+		if err != nil {
+			return nil, err
+		}
 
-	// Create the new address
-	var destination *Destination
-	if destination, err = newAddress(
-		m.rawXpubKey, chain, num, append(opts, New())...,
-	); err != nil {
-		return nil, err
+		// Check for an existing destination on the same chain/num
+		var used bool
+		if used, err = isDestinationIndexUsed(ctx, m.ID, chain, num, opts...); err != nil {
+			return nil, err
+		} else if used {
+			m.Client().Logger().Warn(ctx, fmt.Sprintf(
+				"destination index collision for xpub %s: chain %d num %d is already used, trying num %d",
+				m.ID, chain, num, num+1,
+			))
+			continue
+		}
+
+		// Create the new address
+		var destination *Destination
+		if destination, err = newAddress(
+			m.rawXpubKey, chain, num, append(opts, New())...,
+		); err != nil {
+			return nil, err
+		}
+
+		// Add the destination to the xPub
+		m.destinations = append(m.destinations, *destination)
+		return destination, nil
 	}
 
-	// Add the destination to the xPub
-	m.destinations = append(m.destinations, *destination)
-	return destination, nil
+	return nil, ErrDestinationIndexCollision
 }
 
-// incrementBalance will atomically update the balance of the xPub
-func (m *Xpub) incrementBalance(ctx context.Context, balanceIncrement int64) error {
+// incrementBalance will atomically update the balance of the xPub (and record the balance event)
+func (m *Xpub) incrementBalance(ctx context.Context, balanceIncrement int64, txID string,
+	reason BalanceEventReason,
+) error {
 
-	// Increment the field
-	newBalance, err := incrementField(ctx, m, currentBalanceField, balanceIncrement)
-	if err != nil {
+	// Nothing changes, only refresh the balance
+	if balanceIncrement == 0 {
+		newBalance, err := incrementField(ctx, m, currentBalanceField, 0)
+		if err != nil {
+			return err
+		}
+		m.CurrentBalance = uint64(newBalance)
+		return m.AfterUpdated(ctx)
+	}
+
+	// Record the change with the resulting balance
+	event := newBalanceEvent(m.ID, txID, reason, balanceIncrement, 0, m.GetOptions(true)...)
+	if gormDB(m.Client().Datastore()) != nil {
+
+		// The increment is applied in the transaction of the event (see applyBalanceEvent)
+		event.applyDelta = true
+	} else {
+
+		// MongoDB: the atomic increment, then the event
+		newBalance, err := incrementField(ctx, m, currentBalanceField, balanceIncrement)
+		if err != nil {
+			return err
+		}
+		event.Balance = uint64(newBalance)
+	}
+	if err := event.Save(ctx); err != nil {
 		return err
 	}
 
 	// Update the field value
-	m.CurrentBalance = uint64(newBalance)
+	m.CurrentBalance = event.Balance
+
+	// Alert on the crossed thresholds (see SetXpubBalanceAlerts)
+	m.checkBalanceAlerts(ctx, txID)
 
 	// Fire the after update
-	err = m.AfterUpdated(ctx)
-	return err
+	return m.AfterUpdated(ctx)
+}
+
+// incrementConfirmationBalances will atomically update the confirmed and unconfirmed balances of the xPub
+func (m *Xpub) incrementConfirmationBalances(ctx context.Context, confirmedIncrement, unconfirmedIncrement int64) error {
+	if confirmedIncrement == 0 && unconfirmedIncrement == 0 {
+		return nil
+	}
+
+	// The balances never go below zero: utxos that were never added to these balances
+	// (not recorded via a transaction) would otherwise make the balance negative when spent
+	if confirmedIncrement < 0 || unconfirmedIncrement < 0 {
+		current, err := getXpubByID(ctx, m.ID, m.GetOptions(false)...)
+		if err != nil {
+			return err
+		} else if current != nil {
+			limitedConfirmed := limitBalanceDecrement(current.ConfirmedBalance, confirmedIncrement)
+			limitedUnconfirmed := limitBalanceDecrement(current.UnconfirmedBalance, unconfirmedIncrement)
+			if limitedConfirmed != confirmedIncrement || limitedUnconfirmed != unconfirmedIncrement {
+				m.Client().Logger().Warn(ctx, fmt.Sprintf(
+					"balance of xpub %s clamped at zero: confirmed increment %d (limited to %d), "+
+						"unconfirmed increment %d (limited to %d)",
+					m.ID, confirmedIncrement, limitedConfirmed, unconfirmedIncrement, limitedUnconfirmed,
+				))
+			}
+			confirmedIncrement, unconfirmedIncrement = limitedConfirmed, limitedUnconfirmed
+		}
+	}
+
+	// Increment the fields
+	if confirmedIncrement != 0 {
+		newBalance, err := incrementField(ctx, m, confirmedBalanceField, confirmedIncrement)
+		if err != nil {
+			return err
+		}
+		m.ConfirmedBalance = uint64(newBalance)
+	}
+	if unconfirmedIncrement != 0 {
+		newBalance, err := incrementField(ctx, m, unconfirmedBalanceField, unconfirmedIncrement)
+		if err != nil {
+			return err
+		}
+		m.UnconfirmedBalance = uint64(newBalance)
+	}
+
+	// Fire the after update
+	return m.AfterUpdated(ctx)
+}
+
+// limitBalanceDecrement will limit a negative increment to the current balance
+func limitBalanceDecrement(balance uint64, increment int64) int64 {
+	if increment < 0 && uint64(-increment) > balance {
+		return -int64(balance)
+	}
+	return increment
 }
 
 // incrementNextNum will atomically update the num of the given chain of the xPub and return it
@@ -244,6 +369,7 @@ func (m *Xpub) incrementNextNum(ctx context.Context, chain uint32) (uint32, erro
 
 // ChildModels will get any related sub models
 func (m *Xpub) ChildModels() (childModels []ModelInterface) {
+	childModels = m.Model.ChildModels()
 	for index := range m.destinations {
 		childModels = append(childModels, &m.destinations[index])
 	}
@@ -277,7 +403,7 @@ func (m *Xpub) AfterCreated(ctx context.Context) error {
 
 	// Store in the cache
 	if err := saveToCache(
-		ctx, []string{fmt.Sprintf(cacheKeyXpubModel, m.GetID())}, m, 0,
+		ctx, []string{fmt.Sprintf(cacheKeyXpubModel, m.GetID())}, m,
 	); err != nil {
 		return err
 	}
@@ -292,7 +418,7 @@ func (m *Xpub) AfterUpdated(ctx context.Context) error {
 
 	// Store in the cache
 	if err := saveToCache(
-		ctx, []string{fmt.Sprintf(cacheKeyXpubModel, m.GetID())}, m, 0,
+		ctx, []string{fmt.Sprintf(cacheKeyXpubModel, m.GetID())}, m,
 	); err != nil {
 		return err
 	}
@@ -301,11 +427,178 @@ func (m *Xpub) AfterUpdated(ctx context.Context) error {
 	return nil
 }
 
+// isITCEnabled will return the effective incoming transactions check (the override or the flag of the client)
+func (m *Xpub) isITCEnabled() bool {
+	if m.ITCOverride != nil {
+		return *m.ITCOverride
+	}
+	return m.Client() == nil || m.Client().IsITCEnabled()
+}
+
+// isIUCEnabled will return the effective input utxo check (the override or the flag of the client)
+func (m *Xpub) isIUCEnabled() bool {
+	if m.IUCOverride != nil {
+		return *m.IUCOverride
+	}
+	return m.Client() == nil || m.Client().IsIUCEnabled()
+}
+
+// xpubITCEnabled will return the effective incoming transactions check of the xPub
+//
+// The flag of the client is used if the xPub is unknown (or no xPub is given)
+func xpubITCEnabled(ctx context.Context, client ClientInterface, xPubID string) bool {
+	if xPub := getXpubFlags(ctx, client, xPubID); xPub != nil {
+		return xPub.isITCEnabled()
+	}
+	return client == nil || client.IsITCEnabled()
+}
+
+// xpubIUCEnabled will return the effective input utxo check of the xPub
+//
+// The flag of the client is used if the xPub is unknown (or no xPub is given)
+func xpubIUCEnabled(ctx context.Context, client ClientInterface, xPubID string) bool {
+	if xPub := getXpubFlags(ctx, client, xPubID); xPub != nil {
+		return xPub.isIUCEnabled()
+	}
+	return client == nil || client.IsIUCEnabled()
+}
+
+// getXpubFlags will get the xPub (from the cache) for reading the flags, nil if not found
+func getXpubFlags(ctx context.Context, client ClientInterface, xPubID string) *Xpub {
+	if client == nil || len(xPubID) == 0 {
+		return nil
+	}
+	xPub, err := getXpubWithCache(ctx, client, "", xPubID, client.DefaultModelOptions()...)
+	if err != nil {
+		return nil
+	}
+	return xPub
+}
+
+// isNotificationsMuted will return true if the notifications are muted (the mute window is not expired)
+func (m *Xpub) isNotificationsMuted() bool {
+	return m.NotificationsMutedUntil.Valid && m.NotificationsMutedUntil.Time.After(time.Now().UTC())
+}
+
+// xpubNotificationsMuted will return true if the notifications of the xPub are muted
+//
+// Unknown xPubs are never muted
+func xpubNotificationsMuted(ctx context.Context, client ClientInterface, xPubID string) bool {
+	if xPub := getXpubFlags(ctx, client, xPubID); xPub != nil {
+		return xPub.isNotificationsMuted()
+	}
+	return false
+}
+
+// Display filter the model for display (with the effective flags)
+func (m *Xpub) Display() interface{} {
+	m.ITCEnabled = m.isITCEnabled()
+	m.IUCEnabled = m.isIUCEnabled()
+	m.NotificationsMuted = m.isNotificationsMuted()
+	return m
+}
+
+// DisplayFor filter the model for display without the fields hidden from the profile (see RegisterDisplayMask)
+func (m *Xpub) DisplayFor(profile string) interface{} {
+	return displayFor(ModelXPub, m.Display(), profile)
+}
+
 // Migrate model specific migration on startup
 func (m *Xpub) Migrate(client datastore.ClientInterface) error {
+	if err := m.migrateBalances(client); err != nil {
+		return err
+	}
 	return client.IndexMetadata(client.GetTableName(tableXPubs), metadataField)
 }
 
+// migrateBalances will backfill the confirmed and unconfirmed balances (aggregating the unspent utxos
+// by the block height of the funding transaction)
+//
+// Only xPubs with a current balance and no confirmed/unconfirmed balance are backfilled
+func (m *Xpub) migrateBalances(client datastore.ClientInterface) error {
+	if client.Engine() == datastore.MongoDB {
+		return m.migrateBalancesMongoDB(client)
+	}
+
+	xPubsTable := client.GetTableName(tableXPubs)
+	utxosTable := client.GetTableName(tableUTXOs)
+	transactionsTable := client.GetTableName(tableTransactions)
+
+	// Sum of the unspent utxos of the xPub (joined to the funding transaction)
+	sumQuery := func(minedCondition string) string {
+		return `(SELECT COALESCE(SUM(u.satoshis), 0) FROM ` + utxosTable + ` u` +
+			` LEFT JOIN ` + transactionsTable + ` t ON t.id = u.transaction_id` +
+			` WHERE u.xpub_id = ` + xPubsTable + `.id AND u.spending_tx_id IS NULL AND ` + minedCondition + `)`
+	}
+
+	tx := client.Execute(`UPDATE ` + xPubsTable + ` SET ` +
+		confirmedBalanceField + ` = ` + sumQuery(`t.block_height > 0`) + `, ` +
+		unconfirmedBalanceField + ` = ` + sumQuery(`(t.block_height IS NULL OR t.block_height = 0)`) +
+		` WHERE ` + confirmedBalanceField + ` = 0 AND ` + unconfirmedBalanceField + ` = 0 AND ` +
+		currentBalanceField + ` > 0`)
+	return tx.Error
+}
+
+// migrateBalancesMongoDB will backfill the confirmed and unconfirmed balances (MongoDB)
+func (m *Xpub) migrateBalancesMongoDB(client datastore.ClientInterface) error {
+	ctx := context.Background()
+
+	// Get the xPubs that need a backfill
+	var xPubs []*Xpub
+	if err := client.GetModels(ctx, &xPubs, map[string]interface{}{
+		confirmedBalanceField:   0,
+		unconfirmedBalanceField: 0,
+		currentBalanceField:     map[string]interface{}{"$gt": 0},
+	}, nil, nil, defaultDatabaseReadTimeout); err != nil {
+		if errors.Is(err, datastore.ErrNoResults) {
+			return nil
+		}
+		return err
+	}
+
+	for _, xPub := range xPubs {
+
+		// Get the unspent utxos
+		var utxos []*Utxo
+		if err := client.GetModels(ctx, &utxos, map[string]interface{}{
+			xPubIDField:       xPub.ID,
+			spendingTxIDField: nil,
+		}, nil, nil, defaultDatabaseReadTimeout); err != nil && !errors.Is(err, datastore.ErrNoResults) {
+			return err
+		}
+
+		// Sum by the block height of the funding transaction
+		var confirmed, unconfirmed int64
+		for _, utxo := range utxos {
+			transaction := &Transaction{}
+			if err := client.GetModel(ctx, transaction, map[string]interface{}{
+				idField: utxo.TransactionID,
+			}, defaultDatabaseReadTimeout, false); err != nil && !errors.Is(err, datastore.ErrNoResults) {
+				return err
+			}
+			if transaction.BlockHeight > 0 {
+				confirmed += int64(utxo.Satoshis)
+			} else {
+				unconfirmed += int64(utxo.Satoshis)
+			}
+		}
+
+		// Set the balances
+		if confirmed > 0 {
+			if _, err := client.IncrementModel(ctx, xPub, confirmedBalanceField, confirmed); err != nil {
+				return err
+			}
+		}
+		if unconfirmed > 0 {
+			if _, err := client.IncrementModel(ctx, xPub, unconfirmedBalanceField, unconfirmed); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
 // RemovePrivateData unset all fields that are sensitive
 func (m *Xpub) RemovePrivateData() {
 	m.NextExternalNum = 0
@@ -249,6 +249,35 @@ func TestXpub_AfterUpdated(t *testing.T) {
 	})
 }
 
+// TestXpub_incrementConfirmationBalances will test the method incrementConfirmationBalances()
+func TestXpub_incrementConfirmationBalances(t *testing.T) {
+	ctx, client, deferMe := CreateTestSQLiteClient(t, false, false, WithCustomTaskManager(&taskManagerMockBase{}))
+	defer deferMe()
+
+	xPub := newXpub(testXPub, append(client.DefaultModelOptions(), New())...)
+	require.NoError(t, xPub.Save(ctx))
+
+	// Received (unconfirmed)
+	err := xPub.incrementConfirmationBalances(ctx, 0, 1000)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(0), xPub.ConfirmedBalance)
+	assert.Equal(t, uint64(1000), xPub.UnconfirmedBalance)
+
+	// Mined (move to confirmed)
+	err = xPub.incrementConfirmationBalances(ctx, 1000, -1000)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1000), xPub.ConfirmedBalance)
+	assert.Equal(t, uint64(0), xPub.UnconfirmedBalance)
+
+	// Check the balances using the client
+	var balances *XpubBalances
+	balances, err = client.GetXpubBalances(ctx, testXPub)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1000), balances.Confirmed)
+	assert.Equal(t, uint64(0), balances.Unconfirmed)
+	assert.Equal(t, uint64(0), balances.Reserved)
+}
+
 // TestXpub_RemovePrivateData will test the method RemovePrivateData()
 func TestXpub_RemovePrivateData(t *testing.T) {
 
@@ -277,49 +306,38 @@ func TestXpub_RemovePrivateData(t *testing.T) {
 // TestXpub_Save will test the method Save()
 func (ts *EmbeddedDBTestSuite) TestXpub_Save() {
 
-	for _, testCase := range dbTestCases {
-		ts.T().Run(testCase.name+" - valid Save (basic)", func(t *testing.T) {
-			tc := ts.genericDBClient(t, testCase.database, false)
-			defer tc.Close(tc.ctx)
-
-			xPub := newXpub(testXPub, append(tc.client.DefaultModelOptions(), New())...)
-			require.NotNil(t, xPub)
-
-			err := xPub.Save(tc.ctx)
-			require.NoError(t, err)
-
-			var xPub2 *Xpub
-			xPub2, err = tc.client.GetXpub(tc.ctx, testXPub)
-			require.NoError(t, err)
-			require.NotNil(t, xPub2)
+	ts.runParallelDBTests("valid Save (basic)", false, func(t *testing.T, tc *TestingClient) {
+		xPub := newXpub(testXPub, append(tc.client.DefaultModelOptions(), New())...)
+		require.NotNil(t, xPub)
 
-			assert.Equal(t, xPub2.ID, testXPubID)
-			require.NoError(t, err)
-		})
+		err := xPub.Save(tc.ctx)
+		require.NoError(t, err)
 
-		ts.T().Run(testCase.name+" - dynamic xPub creation", func(t *testing.T) {
-			tc := ts.genericDBClient(t, testCase.database, false)
-			defer tc.Close(tc.ctx)
+		var xPub2 *Xpub
+		xPub2, err = tc.client.GetXpub(tc.ctx, testXPub)
+		require.NoError(t, err)
+		require.NotNil(t, xPub2)
 
-			_, xPub, rawKey := CreateNewXPub(tc.ctx, t, tc.client)
+		assert.Equal(t, xPub2.ID, testXPubID)
+		require.NoError(t, err)
+	})
 
-			xPub2, err := tc.client.GetXpub(tc.ctx, rawKey)
-			require.NoError(t, err)
-			require.NotNil(t, xPub2)
-			assert.Equal(t, xPub2.ID, xPub.ID)
-		})
+	ts.runParallelDBTests("dynamic xPub creation", false, func(t *testing.T, tc *TestingClient) {
+		fixtures := NewFixtures(t, tc.client).WithXpub(0)
 
-		ts.T().Run(testCase.name+" - error invalid xPub", func(t *testing.T) {
-			tc := ts.genericDBClient(t, testCase.database, false)
-			defer tc.Close(tc.ctx)
+		xPub2, err := tc.client.GetXpub(tc.ctx, fixtures.RawXpub)
+		require.NoError(t, err)
+		require.NotNil(t, xPub2)
+		assert.Equal(t, xPub2.ID, fixtures.Xpub.ID)
+	})
 
-			xPub := newXpub("bad-key-val", append(tc.client.DefaultModelOptions(), New())...)
-			require.NotNil(t, xPub)
+	ts.runParallelDBTests("error invalid xPub", false, func(t *testing.T, tc *TestingClient) {
+		xPub := newXpub("bad-key-val", append(tc.client.DefaultModelOptions(), New())...)
+		require.NotNil(t, xPub)
 
-			err := xPub.Save(tc.ctx)
-			require.Error(t, err)
-		})
-	}
+		err := xPub.Save(tc.ctx)
+		require.Error(t, err)
+	})
 
 	ts.T().Run("[sqlite] [redis] [mocking] - create xpub", func(t *testing.T) {
 		tc := ts.genericMockedDBClient(t, datastore.SQLite)
@@ -333,14 +351,16 @@ func (ts *EmbeddedDBTestSuite) TestXpub_Save() {
 
 		// Create model
 		tc.MockSQLDB.ExpectExec("INSERT INTO `"+tc.tablePrefix+"_"+tableXPubs+"` (`created_at`,`updated_at`,`metadata`,`deleted_at`,`id`,"+
-			"`current_balance`,`next_internal_num`,`next_external_num`"+
-			") VALUES (?,?,?,?,?,?,?,?)").WithArgs(
+			"`current_balance`,`confirmed_balance`,`unconfirmed_balance`,`next_internal_num`,`next_external_num`"+
+			") VALUES (?,?,?,?,?,?,?,?,?,?)").WithArgs(
 			tester.AnyTime{}, // created_at
 			tester.AnyTime{}, // updated_at
 			nil,              // metadata
 			nil,              // deleted_at
 			xPub.GetID(),     // id
 			0,                // current_balance
+			0,                // confirmed_balance
+			0,                // unconfirmed_balance
 			0,                // next_internal_num
 			0,                // next_external_num
 		).WillReturnResult(sqlmock.NewResult(1, 1))
@@ -372,14 +392,16 @@ func (ts *EmbeddedDBTestSuite) TestXpub_Save() {
 
 		// Create model
 		tc.MockSQLDB.ExpectExec("INSERT INTO `"+tc.tablePrefix+"_"+tableXPubs+"` (`created_at`,`updated_at`,`metadata`,`deleted_at`,`id`,"+
-			"`current_balance`,`next_internal_num`,`next_external_num`"+
-			") VALUES (?,?,?,?,?,?,?,?)").WithArgs(
+			"`current_balance`,`confirmed_balance`,`unconfirmed_balance`,`next_internal_num`,`next_external_num`"+
+			") VALUES (?,?,?,?,?,?,?,?,?,?)").WithArgs(
 			tester.AnyTime{}, // created_at
 			tester.AnyTime{}, // updated_at
 			nil,              // metadata
 			nil,              // deleted_at
 			xPub.GetID(),     // id
 			0,                // current_balance
+			0,                // confirmed_balance
+			0,                // unconfirmed_balance
 			0,                // next_internal_num
 			0,                // next_external_num
 		).WillReturnResult(sqlmock.NewResult(1, 1))
@@ -410,13 +432,15 @@ func (ts *EmbeddedDBTestSuite) TestXpub_Save() {
 		tc.MockSQLDB.ExpectBegin()
 
 		// Create model
-		tc.MockSQLDB.ExpectExec(`INSERT INTO "`+tc.tablePrefix+`_`+tableXPubs+`" ("created_at","updated_at","metadata","deleted_at","id","current_balance","next_internal_num","next_external_num") VALUES ($1,$2,$3,$4,$5,$6,$7,$8)`).WithArgs(
+		tc.MockSQLDB.ExpectExec(`INSERT INTO "`+tc.tablePrefix+`_`+tableXPubs+`" ("created_at","updated_at","metadata","deleted_at","id","current_balance","confirmed_balance","unconfirmed_balance","next_internal_num","next_external_num") VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10)`).WithArgs(
 			tester.AnyTime{}, // created_at
 			tester.AnyTime{}, // updated_at
 			nil,              // metadata
 			nil,              // deleted_at
 			xPub.GetID(),     // id
 			0,                // current_balance
+			0,                // confirmed_balance
+			0,                // unconfirmed_balance
 			0,                // next_internal_num
 			0,                // next_external_num
 		).WillReturnResult(sqlmock.NewResult(1, 1))
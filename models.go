@@ -26,13 +26,31 @@ type Model struct {
 	// DeletedAt gorm.DeletedAt `json:"deleted_at" toml:"deleted_at" yaml:"deleted_at" (@mrz: this was the original type)
 	DeletedAt customTypes.NullTime `json:"deleted_at" toml:"deleted_at" yaml:"deleted_at" gorm:"index;comment:The time the record was marked as deleted" bson:"deleted_at,omitempty"`
 
+	// The bux version (and instance, see WithInstanceID) that created and last updated the record
+	CreatedByInstance string `json:"created_by_instance,omitempty" toml:"created_by_instance" yaml:"created_by_instance" gorm:"<-:create;type:varchar(64);comment:The bux instance that created the record" bson:"created_by_instance,omitempty"`
+	CreatedByVersion  string `json:"created_by_version,omitempty" toml:"created_by_version" yaml:"created_by_version" gorm:"<-:create;type:varchar(32);comment:The bux version that created the record" bson:"created_by_version,omitempty"`
+	UpdatedByInstance string `json:"updated_by_instance,omitempty" toml:"updated_by_instance" yaml:"updated_by_instance" gorm:"<-;type:varchar(64);comment:The bux instance that last updated the record" bson:"updated_by_instance,omitempty"`
+	UpdatedByVersion  string `json:"updated_by_version,omitempty" toml:"updated_by_version" yaml:"updated_by_version" gorm:"<-;type:varchar(32);comment:The bux version that last updated the record" bson:"updated_by_version,omitempty"`
+
+	// Optimistic concurrency (the conditional update is opt-in per model, see versionedModel)
+	Version int64 `json:"version" toml:"version" yaml:"version" gorm:"<-;type:bigint;default:0;comment:The version of the record (incremented on every save)" bson:"version"`
+
 	// Private fields
-	client        ClientInterface // Interface of the parent Client that loaded this bux model
-	encryptionKey string          // Use for sensitive values that required encryption (IE: paymail public xpub)
-	name          ModelName       // Name of model (table name)
-	newRecord     bool            // Determine if the record is new (create vs update)
-	pageSize      int             // Number of items per page to get if being used in for method getModels
-	rawXpubKey    string          // Used on "CREATE" on some models
+	auditLog       *AuditLog        // Audit entry saved with the model (same datastore transaction, see saveWithAudit)
+	client         ClientInterface  // Interface of the parent Client that loaded this bux model
+	encryptionKey  string           // Use for sensitive values that required encryption (IE: paymail public xpub)
+	externalInputs []*ExternalInput // Values of the external inputs of a recorded transaction (IE: co-funded transactions)
+	metadataErr    error            // Violation of the metadata limits by a rejected update (see UpdateMetadata)
+	metadataUpdate bool             // The metadata was updated since the model was loaded (checked against the limits on save)
+	name           ModelName        // Name of model (table name)
+	newRecord      bool             // Determine if the record is new (create vs update)
+	p2pTargets     []*PaymailP4     // P2P notification targets of a transaction recorded without a draft (see WithP2PTargets)
+	pageSize       int              // Number of items per page to get if being used in for method getModels
+	rawXpubKey     string           // Used on "CREATE" on some models
+	skipCache      bool             // Read from the datastore (see SkipCache)
+	skipNotify     bool             // Suppress the notifications (events) for this model (and child models)
+	syncConfig     *SyncConfig      // Overrides the default sync config of the created sync transactions (IE: RecordTransactions)
+	versionClaim   bool             // The stored version is claimed by the next update (see claimModelVersion)
 }
 
 // ModelInterface is the interface that all models share
@@ -46,6 +64,7 @@ type ModelInterface interface {
 	Client() ClientInterface
 	DebugLog(text string)
 	Display() interface{}
+	DisplayFor(profile string) interface{}
 	GetID() string
 	GetModelName() string
 	GetModelTableName() string
@@ -2,9 +2,14 @@ package bux
 
 import (
 	"context"
+	"strings"
 	"time"
 
 	"github.com/BuxOrg/bux/notifications"
+	"github.com/mrz1836/go-datastore"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/x/bsonx"
+	"gorm.io/gorm"
 )
 
 // AfterDeleted will fire after a successful delete in the Datastore
@@ -28,9 +33,17 @@ func (m *Model) Client() ClientInterface {
 
 // ChildModels will return any child models
 func (m *Model) ChildModels() []ModelInterface {
+	if m.auditLog != nil {
+		return []ModelInterface{m.auditLog}
+	}
 	return nil
 }
 
+// setAuditLog will set the audit entry saved with the model (see saveWithAudit)
+func (m *Model) setAuditLog(entry *AuditLog) {
+	m.auditLog = entry
+}
+
 // DebugLog will display verbose logs
 func (m *Model) DebugLog(text string) {
 	c := m.Client()
@@ -61,9 +74,19 @@ func (m *Model) GetOptions(isNewRecord bool) (opts []ModelOps) {
 		opts = append(opts, New())
 	}
 
+	// Suppressed notifications (propagate to child models)
+	if m.skipNotify {
+		opts = append(opts, WithoutNotifications())
+	}
+
 	return
 }
 
+// isNotifySkipped will return true if the notifications are suppressed for this model
+func (m *Model) isNotifySkipped() bool {
+	return m.skipNotify
+}
+
 // IsNew returns true if the model is (or was) a new record
 func (m *Model) IsNew() bool {
 	return m.newRecord
@@ -94,24 +117,77 @@ func (m *Model) RawXpub() string {
 	return m.rawXpubKey
 }
 
-// SetRecordTime will set the record timestamps (created is true for a new record)
+// SetRecordTime will set the record timestamps and the bux version (created is true for a new record)
 func (m *Model) SetRecordTime(created bool) {
+	recordVersion, instanceID := version, ""
+	if m.client != nil {
+		recordVersion, instanceID = m.client.Version(), m.client.InstanceID()
+	}
 	if created {
 		m.CreatedAt = time.Now().UTC()
+		m.CreatedByInstance = instanceID
+		m.CreatedByVersion = recordVersion
 	} else {
 		m.UpdatedAt = time.Now().UTC()
+		m.UpdatedByInstance = instanceID
+		m.UpdatedByVersion = recordVersion
 	}
 }
 
+// gormDB will return a new gorm session of the SQL datastore (nil for MongoDB)
+//
+// Used for the conditional updates and deletes (parameterized conditions instead of raw queries)
+func gormDB(ds datastore.ClientInterface) *gorm.DB {
+	if !datastore.IsSQLEngine(ds.Engine()) {
+		return nil
+	}
+	return ds.Raw("").Session(&gorm.Session{NewDB: true})
+}
+
+// getVersion will return the version of the record
+func (m *Model) getVersion() int64 {
+	return m.Version
+}
+
+// setVersion will set the version of the record
+func (m *Model) setVersion(version int64) {
+	m.Version = version
+}
+
+// setVersionClaim will set if the stored version is claimed by the next update (see claimModelVersion)
+func (m *Model) setVersionClaim(claim bool) {
+	m.versionClaim = claim
+}
+
+// versionClaimed will return true if the stored version is claimed by the next update
+func (m *Model) versionClaimed() bool {
+	return m.versionClaim
+}
+
 // UpdateMetadata will update the metadata on the model
-// any key set to nil will be removed, other keys updated or added
+// any key set to nil will be removed, other keys updated or added (the reserved fiat keys are ignored)
+//
+// In the strict mode of the metadata limits, an update exceeding the limits is not applied
+// (the violation is returned by Save)
 func (m *Model) UpdateMetadata(metadata Metadata) {
+	m.metadataUpdate = true
+	if m.client != nil {
+		if limits := clientMetadataLimits(m.client); limits.Mode == MetadataLimitsStrict {
+			if err := limits.check(updatedMetadata(m.Metadata, metadata)); err != nil {
+				m.metadataErr = err
+				return
+			}
+		}
+	}
+
 	if m.Metadata == nil {
 		m.Metadata = make(Metadata)
 	}
 
 	for key, value := range metadata {
-		if value == nil {
+		if isFiatMetadataKey(key) {
+			continue
+		} else if value == nil {
 			delete(m.Metadata, key)
 		} else {
 			m.Metadata[key] = value
@@ -131,6 +207,11 @@ func (m *Model) Display() interface{} {
 	return m
 }
 
+// DisplayFor filter the model for display without the fields hidden from the profile (see RegisterDisplayMask)
+func (m *Model) DisplayFor(profile string) interface{} {
+	return displayFor(m.name, m.Display(), profile)
+}
+
 // RegisterTasks will register the model specific tasks on client initialization
 func (m *Model) RegisterTasks() error {
 	return nil
@@ -171,29 +252,125 @@ func incrementField(ctx context.Context, model ModelInterface, fieldName string,
 	return newValue, nil
 }
 
+// isUniqueConstraintError will return true if the error is a unique constraint (duplicate key) violation
+func isUniqueConstraintError(err error) bool {
+	if err == nil {
+		return false
+	}
+	message := strings.ToLower(err.Error())
+	return strings.Contains(message, "unique constraint") || // SQLite & PostgreSQL
+		strings.Contains(message, "duplicate key") || // PostgreSQL & MongoDB (E11000)
+		strings.Contains(message, "duplicate entry") || // MySQL
+		strings.Contains(message, "could not create unique index") // PostgreSQL (existing duplicates)
+}
+
+// duplicateReporter is a model that reports its own error when the record already exists
+// (the unique constraint of the datastore rejected the creation)
+type duplicateReporter interface {
+	duplicateError(err error) error
+}
+
+// notifySkipper is a model that can suppress notifications
+type notifySkipper interface {
+	isNotifySkipped() bool
+}
+
+// WithoutNotificationsContext will return a context that suppresses all the model notifications (events)
+// for operations using the context
+func WithoutNotificationsContext(ctx context.Context) context.Context {
+	return context.WithValue(ctx, contextKeySkipNotifications, true)
+}
+
+// isNotifySkipped will return true if notifications are suppressed (by the context or the model)
+func isNotifySkipped(ctx context.Context, model interface{}) bool {
+	if skip, ok := ctx.Value(contextKeySkipNotifications).(bool); ok && skip {
+		return true
+	}
+	if m, ok := model.(notifySkipper); ok {
+		return m.isNotifySkipped()
+	}
+	return false
+}
+
 // notify about an event on the model
-func notify(eventType notifications.EventType, model interface{}) {
+//
+// The event is delivered in the background, the muted xPubs are looked up there as well (see MuteNotifications)
+func notify(ctx context.Context, eventType notifications.EventType, model interface{}) {
+
+	// Notifications are suppressed (request scoped)
+	if isNotifySkipped(ctx, model) {
+		return
+	}
+
+	m := model.(ModelInterface)
+	client := m.Client()
+	if client == nil {
+		return
+	}
+	n := client.Notifications()
+	if n == nil {
+		return
+	}
+
+	// Close waits for the lookups (the datastore and cachestore are still open)
+	lookupDone := func() {}
+	if c, ok := client.(*Client); ok {
+		c.options.notifications.lookups.Add(1)
+		lookupDone = c.options.notifications.lookups.Done
+	}
 
 	// run the notifications in a separate goroutine since there could be significant network delay
-	// communicating with a notification provider
+	// communicating with a notification provider (or looking up the muted xPubs)
 
 	go func() {
-		m := model.(ModelInterface)
-		if client := m.Client(); client != nil {
-			if n := client.Notifications(); n != nil {
-				if err := n.Notify(
-					context.Background(), m.GetModelName(), eventType, model, m.GetID(),
-				); err != nil {
-					client.Logger().Error(
-						context.Background(),
-						"failed notifying about "+string(eventType)+" on "+m.GetID()+": "+err.Error(),
-					)
-				}
-			}
+		// The request might be canceled before the event is delivered
+		ctx := context.Background()
+		event, deliver := notificationEvent(ctx, client, n, eventType, m)
+		lookupDone()
+		if !deliver {
+			return
+		}
+
+		if err := n.NotifyEvent(ctx, event); err != nil {
+			client.Logger().Error(ctx, "failed notifying about "+string(eventType)+" on "+m.GetID()+": "+err.Error())
 		}
 	}()
 }
 
+// notificationEvent will return the event of the model, false if the event is muted (and spooled,
+// see MutedNotificationsSpool)
+func notificationEvent(ctx context.Context, client ClientInterface, n notifications.ClientInterface,
+	eventType notifications.EventType, m ModelInterface,
+) (*notifications.Event, bool) {
+	var payloadModel interface{} = m
+	if client.IsNotificationNotesEnabled() {
+		payloadModel = withTransactionNote(ctx, m)
+	}
+	version := notificationSchemaVersion(n)
+	event := &notifications.Event{
+		EventType: eventType,
+		ID:        m.GetID(),
+		Model: notificationPayload(
+			version, payloadModel, client.IsNotificationNotesEnabled(), client.NotificationDisplayProfile(),
+		),
+		ModelType:     m.GetModelName(),
+		SchemaVersion: payloadSchemaVersion(version, payloadModel),
+	}
+
+	// The notifications of the xPub(s) are muted (see MuteNotifications)
+	xPubIDs := notificationXpubIDs(ctx, m)
+	if !isNotifyMuted(ctx, client, xPubIDs) {
+		return event, true
+	}
+	if client.MutedNotificationsMode() == MutedNotificationsSpool {
+		event.EventID = notifications.NewEventID()
+		if err := spoolMutedNotification(ctx, client, xPubIDs, event); err != nil {
+			client.Logger().Error(ctx, "failed spooling muted "+string(eventType)+" on "+m.GetID()+": "+err.Error())
+		}
+	}
+	return nil, false
+}
+
 /*
 // setFieldValueByJSONTag will parse the struct looking for the field (json tag) and updating the value if found
 //
@@ -237,3 +414,35 @@ func setFieldValueByJSONTag(item interface{}, fieldName string, value interface{
 	return nil
 }
 */
+
+// migrateVersionIndexes will index the bux versions that created and updated the records of the table
+// (see WithRecordVersionIndexes)
+func migrateVersionIndexes(client datastore.ClientInterface, tableName string) error {
+	fields := []string{createdByVersionField, updatedByVersionField}
+	if client.Engine() == datastore.MongoDB {
+		indexes := make([]mongo.IndexModel, 0, len(fields))
+		for _, field := range fields {
+			indexes = append(indexes, mongo.IndexModel{Keys: bsonx.Doc{{Key: field, Value: bsonx.Int32(1)}}})
+		}
+		_, err := client.GetMongoCollectionByTableName(tableName).Indexes().CreateMany(context.Background(), indexes)
+		return err
+	}
+
+	for _, field := range fields {
+		idxName := "idx_" + tableName + "_" + field
+		query := `CREATE INDEX IF NOT EXISTS "` + idxName + `" ON "` + tableName + `" ("` + field + `")`
+		if client.Engine() == datastore.MySQL {
+			idxExists, err := client.IndexExists(tableName, idxName)
+			if err != nil {
+				return err
+			} else if idxExists {
+				continue
+			}
+			query = "CREATE INDEX `" + idxName + "` ON `" + tableName + "` (" + field + ")"
+		}
+		if tx := client.Execute(query); tx.Error != nil {
+			return tx.Error
+		}
+	}
+	return nil
+}
@@ -1,9 +1,16 @@
 package bux
 
 import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // TestModelSetRecordTime will test the method SetRecordTime()
@@ -37,6 +44,55 @@ func TestModelSetRecordTime(t *testing.T) {
 		assert.Equal(t, false, m.CreatedAt.IsZero())
 		assert.Equal(t, false, m.UpdatedAt.IsZero())
 	})
+
+	t.Run("set the version without a client", func(t *testing.T) {
+		m := new(Model)
+		m.SetRecordTime(true)
+		assert.Equal(t, version, m.CreatedByVersion)
+		assert.Empty(t, m.CreatedByInstance)
+		assert.Empty(t, m.UpdatedByVersion)
+	})
+}
+
+// TestModel_recordVersion will test recording the bux version and the instance of the saved records
+func TestModel_recordVersion(t *testing.T) {
+	t.Parallel()
+
+	ctx, client, deferMe := CreateTestSQLiteClient(t, false, true,
+		WithCustomTaskManager(&taskManagerMockBase{}),
+		WithInstanceID("bux-1"),
+		WithRecordVersionIndexes(),
+	)
+	t.Cleanup(deferMe)
+
+	fixtures := NewFixtures(t, client).WithXpub(0)
+	assert.Equal(t, client.Version(), fixtures.Xpub.CreatedByVersion)
+	assert.Equal(t, "bux-1", fixtures.Xpub.CreatedByInstance)
+	assert.Empty(t, fixtures.Xpub.UpdatedByVersion)
+
+	// Updated by another instance
+	client.(*Client).options.instanceID = "bux-2"
+	fixtures.Xpub.UpdateMetadata(Metadata{"key": "value"})
+	require.NoError(t, fixtures.Xpub.Save(ctx))
+
+	xPub, err := getXpubByID(ctx, fixtures.Xpub.ID, client.DefaultModelOptions(SkipCache())...)
+	require.NoError(t, err)
+	require.NotNil(t, xPub)
+	assert.Equal(t, client.Version(), xPub.CreatedByVersion)
+	assert.Equal(t, "bux-1", xPub.CreatedByInstance)
+	assert.Equal(t, client.Version(), xPub.UpdatedByVersion)
+	assert.Equal(t, "bux-2", xPub.UpdatedByInstance)
+
+	// The optional indexes
+	ds := client.Datastore()
+	for _, field := range []string{createdByVersionField, updatedByVersionField} {
+		var count int64
+		require.NoError(t, ds.Raw(
+			"SELECT COUNT(*) FROM sqlite_master WHERE type = 'index' AND name = 'idx_"+
+				ds.GetTableName(tableXPubs)+"_"+field+"'",
+		).Scan(&count).Error)
+		assert.Equal(t, int64(1), count, field)
+	}
 }
 
 // TestModelSetRecordTime will test the method New()
@@ -110,3 +166,62 @@ func TestModel_Name(t *testing.T) {
 		assert.Equal(t, "xpub", m.Name())
 	})
 }
+
+// Test_notify will test the method notify() (suppressed using the model option or context)
+func Test_notify(t *testing.T) {
+
+	var webhookCalls int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&webhookCalls, 1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	ctx, client, deferMe := CreateTestSQLiteClient(t, false, false,
+		WithCustomTaskManager(&taskManagerMockBase{}),
+		WithNotifications(server.URL),
+		WithNotificationInsecureEndpoints(),
+	)
+	defer deferMe()
+
+	saveDestinations := func(ctx context.Context, fromNum uint32, opts ...ModelOps) {
+		for num := fromNum; num < fromNum+10; num++ {
+			destination, err := newAddress(
+				testXPub, 0, num, append(client.DefaultModelOptions(New()), opts...)...,
+			)
+			require.NoError(t, err)
+			require.NoError(t, destination.Save(ctx))
+		}
+	}
+
+	t.Run("suppressed using the model option", func(t *testing.T) {
+		saveDestinations(ctx, 0, WithoutNotifications())
+		time.Sleep(500 * time.Millisecond)
+		assert.Equal(t, int64(0), atomic.LoadInt64(&webhookCalls))
+	})
+
+	t.Run("suppressed using the context", func(t *testing.T) {
+		saveDestinations(WithoutNotificationsContext(ctx), 10)
+		time.Sleep(500 * time.Millisecond)
+		assert.Equal(t, int64(0), atomic.LoadInt64(&webhookCalls))
+	})
+
+	t.Run("not suppressed", func(t *testing.T) {
+		saveDestinations(ctx, 20)
+		assert.Eventually(t, func() bool {
+			return atomic.LoadInt64(&webhookCalls) == 10
+		}, 5*time.Second, 50*time.Millisecond)
+	})
+}
+
+// Test_isUniqueConstraintError will test the method isUniqueConstraintError()
+func Test_isUniqueConstraintError(t *testing.T) {
+	t.Parallel()
+
+	assert.False(t, isUniqueConstraintError(nil))
+	assert.False(t, isUniqueConstraintError(errors.New("record not found")))
+	assert.True(t, isUniqueConstraintError(errors.New("UNIQUE constraint failed: destinations.xpub_id")))
+	assert.True(t, isUniqueConstraintError(errors.New(`ERROR: duplicate key value violates unique constraint "idx"`)))
+	assert.True(t, isUniqueConstraintError(errors.New("Error 1062: Duplicate entry 'x' for key 'idx'")))
+	assert.True(t, isUniqueConstraintError(errors.New("E11000 duplicate key error collection")))
+}
@@ -20,18 +20,26 @@ func TestModelName_String(t *testing.T) {
 	t.Parallel()
 
 	t.Run("all model names", func(t *testing.T) {
+		assert.Equal(t, "audit_log", ModelAuditLog.String())
+		assert.Equal(t, "balance_event", ModelBalanceEvent.String())
+		assert.Equal(t, "balance_checkpoint", ModelBalanceCheckpoint.String())
 		assert.Equal(t, "block_header", ModelBlockHeader.String())
+		assert.Equal(t, "broadcast_receipt", ModelBroadcastReceipt.String())
 		assert.Equal(t, "destination", ModelDestination.String())
 		assert.Equal(t, "empty", ModelNameEmpty.String())
 		assert.Equal(t, "incoming_transaction", ModelIncomingTransaction.String())
 		assert.Equal(t, "metadata", ModelMetadata.String())
+		assert.Equal(t, "notification_delivery", ModelNotificationDelivery.String())
 		assert.Equal(t, "paymail_address", ModelPaymailAddress.String())
 		assert.Equal(t, "paymail_address", ModelPaymailAddress.String())
+		assert.Equal(t, "schema_version", ModelSchemaVersion.String())
+		assert.Equal(t, "setting", ModelSetting.String())
 		assert.Equal(t, "sync_transaction", ModelSyncTransaction.String())
 		assert.Equal(t, "transaction", ModelTransaction.String())
+		assert.Equal(t, "transaction_note", ModelTransactionNote.String())
 		assert.Equal(t, "utxo", ModelUtxo.String())
 		assert.Equal(t, "xpub", ModelXPub.String())
-		assert.Len(t, AllModelNames, 11)
+		assert.Len(t, AllModelNames, 19)
 	})
 }
 
@@ -143,48 +151,42 @@ type xPubFieldsTest struct {
 func (ts *EmbeddedDBTestSuite) TestModels_GetModels() {
 
 	numberOfModels := 10
-	for _, testCase := range dbTestCases {
-		ts.T().Run(testCase.name+" - GetModels", func(t *testing.T) {
-			tc := ts.genericDBClient(t, testCase.database, false)
-			defer tc.Close(tc.ctx)
-			ts.createXpubModels(tc, t, numberOfModels)
-
-			queryParams := &datastore.QueryParams{Page: 0, PageSize: 10}
-			var models []*Xpub
-			err := tc.client.Datastore().GetModels(
-				tc.ctx,
-				&models,
-				nil,
-				queryParams,
-				nil,
-				30*time.Second,
-			)
-			require.NoError(t, err)
-			require.Len(t, models, numberOfModels)
-			assert.Equal(t, uint64(125000), models[0].CurrentBalance) // should be set
-			assert.Equal(t, uint32(12), models[0].NextExternalNum)    // should be set
-			assert.Equal(t, uint32(37), models[0].NextInternalNum)    // should be set
-		})
-
-		ts.T().Run(testCase.name+" - GetModels with projection", func(t *testing.T) {
-			tc := ts.genericDBClient(t, testCase.database, false)
-			defer tc.Close(tc.ctx)
-			ts.createXpubModels(tc, t, numberOfModels)
-
-			queryParams := &datastore.QueryParams{Page: 0, PageSize: 10}
-			var models []*Xpub
-			var results []*xPubFieldsTest
-			err := tc.client.Datastore().GetModels(
-				tc.ctx,
-				&models,
-				nil,
-				queryParams,
-				&results,
-				30*time.Second,
-			)
-			require.NoError(t, err)
-			require.Len(t, results, numberOfModels)
-			assert.Equal(t, uint64(125000), results[0].CurrentBalance) // should be set
-		})
-	}
+	ts.runParallelDBTests("GetModels", false, func(t *testing.T, tc *TestingClient) {
+		ts.createXpubModels(tc, t, numberOfModels)
+
+		queryParams := &datastore.QueryParams{Page: 0, PageSize: 10}
+		var models []*Xpub
+		err := tc.client.Datastore().GetModels(
+			tc.ctx,
+			&models,
+			nil,
+			queryParams,
+			nil,
+			30*time.Second,
+		)
+		require.NoError(t, err)
+		require.Len(t, models, numberOfModels)
+		assert.Equal(t, uint64(125000), models[0].CurrentBalance) // should be set
+		assert.Equal(t, uint32(12), models[0].NextExternalNum)    // should be set
+		assert.Equal(t, uint32(37), models[0].NextInternalNum)    // should be set
+	})
+
+	ts.runParallelDBTests("GetModels with projection", false, func(t *testing.T, tc *TestingClient) {
+		ts.createXpubModels(tc, t, numberOfModels)
+
+		queryParams := &datastore.QueryParams{Page: 0, PageSize: 10}
+		var models []*Xpub
+		var results []*xPubFieldsTest
+		err := tc.client.Datastore().GetModels(
+			tc.ctx,
+			&models,
+			nil,
+			queryParams,
+			&results,
+			30*time.Second,
+		)
+		require.NoError(t, err)
+		require.Len(t, results, numberOfModels)
+		assert.Equal(t, uint64(125000), results[0].CurrentBalance) // should be set
+	})
 }
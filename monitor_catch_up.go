@@ -0,0 +1,279 @@
+package bux
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/BuxOrg/bux/utils"
+	"github.com/mrz1836/go-datastore"
+)
+
+// BlockTransactionsProvider is a source of the transactions of past blocks for the monitor catch-up
+// (see WithMonitorCatchUp)
+type BlockTransactionsProvider interface {
+	// GetBlockTransactions will return the transactions (hex) of the block at the height with an output
+	// to one of the locking scripts
+	GetBlockTransactions(ctx context.Context, height uint32, lockingScripts []string) ([]string, error)
+}
+
+// MonitorCheckpoint is the last block processed by the monitor (or by the catch-up)
+type MonitorCheckpoint struct {
+	Height      uint32    `json:"height"`       // Height of the block
+	ProcessedAt time.Time `json:"processed_at"` // When the block was processed
+}
+
+// MonitorCatchUpResult is the summary of a monitor catch-up (see MonitorCatchUp)
+type MonitorCatchUpResult struct {
+	BlocksScanned        int    `json:"blocks_scanned"`        // Number of blocks replayed
+	FromHeight           uint32 `json:"from_height"`           // First block of the range
+	ToHeight             uint32 `json:"to_height"`             // Last block of the range (the tip or the max blocks)
+	TransactionsFound    int    `json:"transactions_found"`    // Transactions returned by the provider
+	TransactionsImported int    `json:"transactions_imported"` // New transactions recorded (the known ones are skipped)
+}
+
+// monitorCatchUpOptions holds the configuration of the monitor catch-up
+type monitorCatchUpOptions struct {
+	maxBlocks int                       // Max blocks replayed by a catch-up (0 = up to the tip)
+	provider  BlockTransactionsProvider // Source of the transactions (catch-up is disabled if not set)
+}
+
+// MonitorCatchUp will replay the blocks missed by the monitor (IE: downtime) up to the last block header
+//
+// The transactions of the blocks paying the monitored destinations are recorded like the monitored
+// transactions (the known transactions are skipped). The progress is saved after every block: a fromHeight
+// of 0 resumes an interrupted catch-up, or starts after the monitor checkpoint (see GetMonitorCheckpoint).
+func (c *Client) MonitorCatchUp(ctx context.Context, fromHeight uint32) (*MonitorCatchUpResult, error) {
+
+	// Check for existing NewRelic transaction
+	ctx = c.GetOrStartTxn(ctx, "monitor_catch_up")
+
+	if c.options.monitorCatchUp.provider == nil {
+		return nil, ErrMonitorCatchUpDisabled
+	}
+
+	// Create the lock and set the release for after the function completes
+	unlock, err := newWriteLock(
+		ctx, fmt.Sprintf(lockKeyMonitorCatchUp, getClientNetwork(c)), c.Cachestore(),
+	)
+	defer unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	opts := c.DefaultModelOptions()
+	if fromHeight == 0 {
+		if fromHeight, err = monitorCatchUpStart(ctx, opts...); err != nil {
+			return nil, err
+		} else if fromHeight == 0 {
+			return nil, ErrMissingMonitorCheckpoint
+		}
+	}
+
+	// The range ends at the tip (or the max blocks)
+	var tip *BlockHeader
+	if tip, err = getLastBlockHeader(ctx, opts...); err != nil {
+		return nil, err
+	}
+	result := &MonitorCatchUpResult{FromHeight: fromHeight}
+	if tip == nil || tip.Height < fromHeight {
+		return result, saveSetting(ctx, settingMonitorCatchUp, "", opts...)
+	}
+	result.ToHeight = tip.Height
+	if maxBlocks := c.options.monitorCatchUp.maxBlocks; maxBlocks > 0 && tip.Height-fromHeight >= uint32(maxBlocks) {
+		result.ToHeight = fromHeight + uint32(maxBlocks) - 1
+	}
+
+	var lockingScripts []string
+	if lockingScripts, err = getMonitoredLockingScripts(ctx, c); err != nil {
+		return nil, err
+	}
+
+	for height := fromHeight; height <= result.ToHeight; height++ {
+		if err = c.monitorCatchUpBlock(ctx, height, lockingScripts, result); err != nil {
+			c.Logger().Error(ctx, fmt.Sprintf(
+				"[MONITOR] catch-up stopped at block %d (%d blocks scanned): %s", height, result.BlocksScanned, err.Error(),
+			))
+			return result, err
+		}
+		result.BlocksScanned++
+	}
+
+	// The range is complete (a remaining range is resumed by the next catch-up)
+	next := ""
+	if result.ToHeight < tip.Height {
+		next = strconv.FormatUint(uint64(result.ToHeight)+1, 10)
+	}
+	if err = saveSetting(ctx, settingMonitorCatchUp, next, opts...); err != nil {
+		return result, err
+	}
+
+	c.Logger().Info(ctx, fmt.Sprintf(
+		"[MONITOR] catch-up scanned %d blocks (%d to %d): %d transactions found, %d imported",
+		result.BlocksScanned, result.FromHeight, result.ToHeight, result.TransactionsFound, result.TransactionsImported,
+	))
+	return result, nil
+}
+
+// monitorCatchUpBlock will record the transactions of the block paying the locking scripts and save the progress
+func (c *Client) monitorCatchUpBlock(ctx context.Context, height uint32, lockingScripts []string,
+	result *MonitorCatchUpResult,
+) error {
+	opts := c.DefaultModelOptions()
+	if len(lockingScripts) > 0 {
+		txHexes, err := c.options.monitorCatchUp.provider.GetBlockTransactions(ctx, height, lockingScripts)
+		if err != nil {
+			return err
+		}
+		for _, txHex := range txHexes {
+			result.TransactionsFound++
+
+			// Known transactions are skipped (IE: seen in the mempool before the downtime)
+			var txID string
+			if txID, err = utils.GetTransactionIDFromHex(txHex); err != nil {
+				return err
+			}
+			var transaction *Transaction
+			if transaction, err = getTransactionByID(ctx, "", txID, opts...); err != nil {
+				return err
+			} else if transaction != nil {
+				continue
+			}
+
+			if transaction, err = recordMonitoredTransaction(ctx, c, txHex); err != nil {
+				return fmt.Errorf("could not record transaction %s: %w", txID, err)
+			} else if transaction != nil {
+				result.TransactionsImported++
+			}
+		}
+	}
+
+	// Progress of the catch-up and the checkpoint of the monitor
+	if err := saveSetting(ctx, settingMonitorCatchUp, strconv.FormatUint(uint64(height)+1, 10), opts...); err != nil {
+		return err
+	}
+	return saveMonitorCheckpoint(ctx, height, opts...)
+}
+
+// monitorCatchUpStart will return the height of an interrupted catch-up, or the block after the monitor
+// checkpoint (0 if there is no checkpoint)
+func monitorCatchUpStart(ctx context.Context, opts ...ModelOps) (uint32, error) {
+	setting, err := getSetting(ctx, settingMonitorCatchUp, opts...)
+	if err != nil {
+		return 0, err
+	} else if setting != nil && len(setting.Value) > 0 {
+		var next uint64
+		if next, err = strconv.ParseUint(setting.Value, 10, 32); err != nil {
+			return 0, err
+		}
+		return uint32(next), nil
+	}
+
+	var checkpoint *MonitorCheckpoint
+	if checkpoint, err = getMonitorCheckpoint(ctx, opts...); err != nil || checkpoint == nil {
+		return 0, err
+	}
+	return checkpoint.Height + 1, nil
+}
+
+// runMonitorCatchUp will replay the blocks missed while the monitor was down (in the background)
+//
+// Only the leader of the monitor runs the catch-up, before it starts the monitor (see loadMonitor): the start is
+// taken before the monitor processes any block (the checkpoint moves with the monitor). The returned function
+// stops the catch-up (IE: the leadership is lost), an interrupted catch-up is resumed by the next leader.
+func (c *Client) runMonitorCatchUp(ctx context.Context) context.CancelFunc {
+	if c.options.monitorCatchUp.provider == nil {
+		return func() {}
+	}
+	fromHeight, err := monitorCatchUpStart(ctx, c.DefaultModelOptions()...)
+	if err != nil {
+		c.Logger().Error(ctx, "[MONITOR] could not load the catch-up checkpoint: "+err.Error())
+		return func() {}
+	} else if fromHeight == 0 {
+		return func() {} // First start, nothing was missed
+	}
+
+	catchUpCtx, cancel := context.WithCancel(ctx)
+	go func() {
+		defer cancel()
+		_, _ = c.MonitorCatchUp(catchUpCtx, fromHeight)
+	}()
+	return cancel
+}
+
+// GetMonitorCheckpoint will return the last block processed by the monitor (nil if no block was processed)
+func (c *Client) GetMonitorCheckpoint(ctx context.Context) (*MonitorCheckpoint, error) {
+
+	// Check for existing NewRelic transaction
+	ctx = c.GetOrStartTxn(ctx, "get_monitor_checkpoint")
+
+	return getMonitorCheckpoint(ctx, c.DefaultModelOptions()...)
+}
+
+// getMonitorCheckpoint will get the checkpoint of the monitor (nil if not found)
+func getMonitorCheckpoint(ctx context.Context, opts ...ModelOps) (*MonitorCheckpoint, error) {
+	setting, err := getSetting(ctx, settingMonitorCheckpoint, opts...)
+	if err != nil || setting == nil {
+		return nil, err
+	}
+	checkpoint := new(MonitorCheckpoint)
+	if err = json.Unmarshal([]byte(setting.Value), checkpoint); err != nil {
+		return nil, err
+	}
+	return checkpoint, nil
+}
+
+// saveMonitorCheckpoint will save the processed block as the checkpoint of the monitor (if it is a later block)
+//
+// The checkpoint is updated atomically (optimistic concurrency, see ErrStaleModel): a checkpoint saved in between
+// (IE: by the live monitor during a catch-up) is reloaded and compared again
+func saveMonitorCheckpoint(ctx context.Context, height uint32, opts ...ModelOps) error {
+	value, err := json.Marshal(&MonitorCheckpoint{Height: height, ProcessedAt: time.Now().UTC()})
+	if err != nil {
+		return err
+	}
+
+	for attempt := 0; ; attempt++ {
+		var setting *Setting
+		if setting, err = getSetting(ctx, settingMonitorCheckpoint, opts...); err != nil {
+			return err
+		} else if setting == nil {
+			setting = newSetting(settingMonitorCheckpoint, string(value), append(opts, New())...)
+		} else {
+			checkpoint := new(MonitorCheckpoint)
+			if err = json.Unmarshal([]byte(setting.Value), checkpoint); err != nil {
+				return err
+			} else if checkpoint.Height > height {
+				return nil
+			}
+			setting.Value = string(value)
+		}
+
+		// Saved in between: created (duplicate key) or updated (stale version)
+		if err = setting.Save(ctx); err == nil || attempt >= defaultStaleModelRetries ||
+			(!errors.Is(err, ErrStaleModel) && !isUniqueConstraintError(err)) {
+			return err
+		}
+	}
+}
+
+// getMonitoredLockingScripts will return the locking scripts of the monitored destinations
+func getMonitoredLockingScripts(ctx context.Context, client ClientInterface) ([]string, error) {
+	var destinations []*destinationMonitor
+	if err := client.Datastore().GetModels(
+		ctx, &[]*Destination{}, map[string]interface{}{
+			"monitor": map[string]interface{}{"$exists": true},
+		}, nil, &destinations, defaultDatabaseReadTimeout,
+	); err != nil && !errors.Is(err, datastore.ErrNoResults) {
+		return nil, err
+	}
+
+	lockingScripts := make([]string, 0, len(destinations))
+	for _, destination := range destinations {
+		lockingScripts = append(lockingScripts, destination.LockingScript)
+	}
+	return lockingScripts, nil
+}
@@ -0,0 +1,190 @@
+package bux
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/BuxOrg/bux/utils"
+	"github.com/libsv/go-bc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// blockTransactionsProviderMock is a BlockTransactionsProvider with the transactions by height
+type blockTransactionsProviderMock struct {
+	err          error               // Error returned at the height errAtHeight
+	errAtHeight  uint32              // Height returning the error
+	heights      []uint32            // Heights requested
+	transactions map[uint32][]string // Transactions (hex) by height
+}
+
+// GetBlockTransactions will return the transactions of the height
+func (p *blockTransactionsProviderMock) GetBlockTransactions(_ context.Context, height uint32,
+	_ []string,
+) ([]string, error) {
+	p.heights = append(p.heights, height)
+	if p.err != nil && height == p.errAtHeight {
+		return nil, p.err
+	}
+	return p.transactions[height], nil
+}
+
+// saveTestBlockHeaders will save the block headers of the heights (the last one is the tip)
+func saveTestBlockHeaders(ctx context.Context, t *testing.T, client ClientInterface, heights ...uint32) {
+	for _, height := range heights {
+		require.NoError(t, newBlockHeader(
+			fmt.Sprintf("%064d", height), height, bc.BlockHeader{}, client.DefaultModelOptions(New())...,
+		).Save(ctx))
+	}
+}
+
+// TestClient_MonitorCatchUp will test the method MonitorCatchUp()
+func TestClient_MonitorCatchUp(t *testing.T) {
+
+	newClient := func(t *testing.T, provider BlockTransactionsProvider, maxBlocks int) (context.Context, ClientInterface, *Destination) {
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, true,
+			WithCustomTaskManager(&taskManagerMockBase{}),
+			WithMonitorCatchUp(provider, maxBlocks),
+		)
+		t.Cleanup(deferMe)
+
+		fixtures := NewFixtures(t, client).WithXpub(0)
+		destination, err := client.NewDestination(
+			ctx, fixtures.RawXpub, utils.ChainExternal, utils.ScriptTypePubKeyHash, true,
+		)
+		require.NoError(t, err)
+		return ctx, client, destination
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, true, WithCustomTaskManager(&taskManagerMockBase{}))
+		defer deferMe()
+
+		result, err := client.MonitorCatchUp(ctx, 1)
+		require.ErrorIs(t, err, ErrMonitorCatchUpDisabled)
+		assert.Nil(t, result)
+	})
+
+	t.Run("missing checkpoint", func(t *testing.T) {
+		ctx, client, _ := newClient(t, &blockTransactionsProviderMock{}, 0)
+
+		result, err := client.MonitorCatchUp(ctx, 0)
+		require.ErrorIs(t, err, ErrMissingMonitorCheckpoint)
+		assert.Nil(t, result)
+	})
+
+	t.Run("imports the missed transactions", func(t *testing.T) {
+		provider := &blockTransactionsProviderMock{transactions: make(map[uint32][]string)}
+		ctx, client, destination := newClient(t, provider, 0)
+		txHex := monitoredTxHex(t, []string{destination.LockingScript}, []uint64{10000})
+		provider.transactions[102] = []string{txHex}
+
+		// The monitor processed the block 100, the tip is 103
+		require.NoError(t, saveMonitorCheckpoint(ctx, 100, client.DefaultModelOptions()...))
+		saveTestBlockHeaders(ctx, t, client, 101, 102, 103)
+
+		result, err := client.MonitorCatchUp(ctx, 0)
+		require.NoError(t, err)
+		assert.Equal(t, &MonitorCatchUpResult{
+			BlocksScanned:        3,
+			FromHeight:           101,
+			ToHeight:             103,
+			TransactionsFound:    1,
+			TransactionsImported: 1,
+		}, result)
+		assert.Equal(t, []uint32{101, 102, 103}, provider.heights)
+
+		txID, err := utils.GetTransactionIDFromHex(txHex)
+		require.NoError(t, err)
+		transaction, err := client.GetTransaction(ctx, "", txID)
+		require.NoError(t, err)
+		assert.Equal(t, txID, transaction.ID)
+
+		checkpoint, err := client.GetMonitorCheckpoint(ctx)
+		require.NoError(t, err)
+		require.NotNil(t, checkpoint)
+		assert.Equal(t, uint32(103), checkpoint.Height)
+
+		// Nothing left to replay
+		result, err = client.MonitorCatchUp(ctx, 0)
+		require.NoError(t, err)
+		assert.Equal(t, 0, result.BlocksScanned)
+
+		// A replay of the range skips the known transaction
+		result, err = client.MonitorCatchUp(ctx, 101)
+		require.NoError(t, err)
+		assert.Equal(t, 3, result.BlocksScanned)
+		assert.Equal(t, 1, result.TransactionsFound)
+		assert.Equal(t, 0, result.TransactionsImported)
+	})
+
+	t.Run("max blocks - resumed by the next catch-up", func(t *testing.T) {
+		provider := &blockTransactionsProviderMock{}
+		ctx, client, _ := newClient(t, provider, 2)
+		saveTestBlockHeaders(ctx, t, client, 10, 11, 12)
+
+		result, err := client.MonitorCatchUp(ctx, 10)
+		require.NoError(t, err)
+		assert.Equal(t, uint32(11), result.ToHeight)
+		assert.Equal(t, 2, result.BlocksScanned)
+
+		result, err = client.MonitorCatchUp(ctx, 0)
+		require.NoError(t, err)
+		assert.Equal(t, uint32(12), result.FromHeight)
+		assert.Equal(t, uint32(12), result.ToHeight)
+		assert.Equal(t, []uint32{10, 11, 12}, provider.heights)
+	})
+
+	t.Run("provider error - resumed at the failed block", func(t *testing.T) {
+		provider := &blockTransactionsProviderMock{err: errors.New("provider error"), errAtHeight: 21}
+		ctx, client, _ := newClient(t, provider, 0)
+		saveTestBlockHeaders(ctx, t, client, 20, 21, 22)
+
+		result, err := client.MonitorCatchUp(ctx, 20)
+		require.Error(t, err)
+		require.NotNil(t, result)
+		assert.Equal(t, 1, result.BlocksScanned)
+
+		checkpoint, err := client.GetMonitorCheckpoint(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, uint32(20), checkpoint.Height)
+
+		provider.err = nil
+		result, err = client.MonitorCatchUp(ctx, 0)
+		require.NoError(t, err)
+		assert.Equal(t, uint32(21), result.FromHeight)
+		assert.Equal(t, 2, result.BlocksScanned)
+	})
+}
+
+// Test_saveMonitorCheckpoint will test the method saveMonitorCheckpoint()
+func Test_saveMonitorCheckpoint(t *testing.T) {
+	ctx, client, deferMe := CreateTestSQLiteClient(t, false, true, WithCustomTaskManager(&taskManagerMockBase{}))
+	defer deferMe()
+
+	checkpoint, err := client.GetMonitorCheckpoint(ctx)
+	require.NoError(t, err)
+	assert.Nil(t, checkpoint)
+
+	require.NoError(t, saveMonitorCheckpoint(ctx, 200, client.DefaultModelOptions()...))
+	require.NoError(t, saveMonitorCheckpoint(ctx, 150, client.DefaultModelOptions()...))
+
+	checkpoint, err = client.GetMonitorCheckpoint(ctx)
+	require.NoError(t, err)
+	require.NotNil(t, checkpoint)
+	assert.Equal(t, uint32(200), checkpoint.Height)
+	assert.False(t, checkpoint.ProcessedAt.IsZero())
+
+	// A checkpoint saved in between is not overwritten (optimistic concurrency)
+	stale, err := getSetting(ctx, settingMonitorCheckpoint, client.DefaultModelOptions()...)
+	require.NoError(t, err)
+	require.NoError(t, saveMonitorCheckpoint(ctx, 300, client.DefaultModelOptions()...))
+	stale.Value = `{"height":250}`
+	require.ErrorIs(t, stale.Save(ctx), ErrStaleModel)
+
+	checkpoint, err = client.GetMonitorCheckpoint(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(300), checkpoint.Height)
+}
@@ -5,14 +5,13 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
-	"runtime"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/BuxOrg/bux/chainstate"
+	"github.com/BuxOrg/bux/utils"
 	"github.com/centrifugal/centrifuge-go"
-	"github.com/korovkin/limiter"
 	"github.com/libsv/go-bc"
 	"github.com/libsv/go-bt/v2"
 )
@@ -23,9 +22,9 @@ type MonitorEventHandler struct {
 	buxClient        ClientInterface
 	ctx              context.Context
 	debug            bool
-	limit            *limiter.ConcurrencyLimiter
 	logger           chainstate.Logger
 	monitor          chainstate.MonitorService
+	queue            *monitorEventQueue
 }
 
 type blockSubscriptionHandler struct {
@@ -84,15 +83,18 @@ func (b *blockSubscriptionHandler) OnUnsubscribe(subscription *centrifuge.Subscr
 
 // NewMonitorHandler create a new monitor handler
 func NewMonitorHandler(ctx context.Context, buxClient ClientInterface, monitor chainstate.MonitorService) MonitorEventHandler {
-	return MonitorEventHandler{
+	handler := MonitorEventHandler{
 		blockSyncChannel: make(chan bool),
 		buxClient:        buxClient,
 		ctx:              ctx,
 		debug:            monitor.IsDebug(),
-		limit:            limiter.NewConcurrencyLimiter(runtime.NumCPU()),
 		logger:           monitor.Logger(),
 		monitor:          monitor,
 	}
+	if provider, ok := buxClient.(monitorEventQueueProvider); ok {
+		handler.queue = provider.monitorEventQueue()
+	}
+	return handler
 }
 
 // OnConnect event when connected
@@ -176,6 +178,10 @@ func (h *MonitorEventHandler) ProcessBlocks(ctx context.Context, client *centrif
 								blockHeader.Synced.Time = time.Now()
 								if err = blockHeader.Save(ctx); err != nil {
 									h.logger.Error(ctx, err.Error())
+								} else if err = saveMonitorCheckpoint(
+									ctx, blockHeader.Height, h.buxClient.DefaultModelOptions()...,
+								); err != nil {
+									h.logger.Error(ctx, err.Error())
 								}
 							}
 						}
@@ -352,15 +358,25 @@ func (h *MonitorEventHandler) OnServerLeave(_ *centrifuge.Client, e centrifuge.S
 func (h *MonitorEventHandler) OnServerPublish(c *centrifuge.Client, e centrifuge.ServerPublishEvent) {
 	h.logger.Info(h.ctx, fmt.Sprintf("[MONITOR] Server publish to channel %s with data %v", e.Channel, string(e.Data)))
 	// todo make this configurable
-	// h.onServerPublishLinear(c, e)
+	if h.queue == nil {
+		h.onServerPublishLinear(c, e)
+		return
+	}
 	h.onServerPublishParallel(c, e)
 }
 
 func (h *MonitorEventHandler) processMempoolPublish(_ *centrifuge.Client, e centrifuge.ServerPublishEvent) {
+	if tx := h.filterMempoolPublish(e); tx != "" {
+		h.recordMempoolTransaction(tx)
+	}
+}
+
+// filterMempoolPublish will return the transaction of the event if it passes the monitor filter (empty if not)
+func (h *MonitorEventHandler) filterMempoolPublish(e centrifuge.ServerPublishEvent) string {
 	tx, err := h.monitor.Processor().FilterTransactionPublishEvent(e.Data)
 	if err != nil {
 		h.logger.Error(h.ctx, fmt.Sprintf("[MONITOR] failed to process server event: %v", err))
-		return
+		return ""
 	}
 
 	if h.monitor.SaveDestinations() {
@@ -368,11 +384,12 @@ func (h *MonitorEventHandler) processMempoolPublish(_ *centrifuge.Client, e cent
 		// todo: replace printf
 		fmt.Printf("Should save the destination here...\n")
 	}
+	return tx
+}
 
-	if tx == "" {
-		return
-	}
-	if _, err = recordMonitoredTransaction(h.ctx, h.buxClient, tx); err != nil {
+// recordMempoolTransaction will record the transaction (that passed the monitor filter)
+func (h *MonitorEventHandler) recordMempoolTransaction(tx string) {
+	if _, err := recordMonitoredTransaction(h.ctx, h.buxClient, tx); err != nil {
 		h.logger.Error(h.ctx, fmt.Sprintf("[MONITOR] ERROR recording tx: %v", err))
 		return
 	}
@@ -434,12 +451,32 @@ func (h *MonitorEventHandler) onServerPublishLinear(c *centrifuge.Client, e cent
 	}
 }
 
+// onServerPublishParallel will queue the event on the worker pool (blocks the reader while the queue is full)
+//
+// The events of a transaction are processed in order, the block headers are processed one by one (in order)
 func (h *MonitorEventHandler) onServerPublishParallel(c *centrifuge.Client, e centrifuge.ServerPublishEvent) {
-	_, err := h.limit.Execute(func() {
-		h.onServerPublishLinear(c, e)
-	})
-	if err != nil {
-		h.logger.Error(h.ctx, fmt.Sprintf("[MONITOR] ERROR failed to start goroutine: %v", err))
+	var key string
+	var event func()
+	switch e.Channel {
+	case "mempool:transactions":
+		tx := h.filterMempoolPublish(e)
+		if tx == "" {
+			return
+		}
+		txID, err := utils.GetTransactionIDFromHex(tx)
+		if err != nil {
+			h.logger.Error(h.ctx, fmt.Sprintf("[MONITOR] ERROR could not parse transaction: %v", err))
+			return
+		}
+		key, event = txID, func() { h.recordMempoolTransaction(tx) }
+	case "block:headers":
+		key, event = e.Channel, func() { h.processBlockHeaderPublish(c, e) }
+	default:
+		return
+	}
+
+	if !h.queue.enqueue(key, event) {
+		h.logger.Error(h.ctx, fmt.Sprintf("[MONITOR] ERROR dropped event on channel %s: the queue is closed", e.Channel))
 	}
 }
 
@@ -0,0 +1,156 @@
+package bux
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/libsv/go-bt/v2"
+)
+
+// maxSkippedMonitorTransactions is the number of skipped transactions kept for a manual import
+const maxSkippedMonitorTransactions = 1000
+
+// MonitorStatus is the status of the mempool monitor (and the dust transactions it did not record)
+type MonitorStatus struct {
+	Connected             bool     `json:"connected" toml:"connected" yaml:"connected"`                                           // Connected to the monitor server
+	Enabled               bool     `json:"enabled" toml:"enabled" yaml:"enabled"`                                                 // The monitor is loaded
+	MinimumSatoshis       uint64   `json:"minimum_satoshis" toml:"minimum_satoshis" yaml:"minimum_satoshis"`                      // Minimum value of the matched outputs (0 = record all)
+	QueueDepth            int64    `json:"queue_depth" toml:"queue_depth" yaml:"queue_depth"`                                     // Events waiting in the queue (or being processed)
+	QueueDrops            uint64   `json:"queue_drops" toml:"queue_drops" yaml:"queue_drops"`                                     // Events dropped (received after closing the queue)
+	QueueProcessed        uint64   `json:"queue_processed" toml:"queue_processed" yaml:"queue_processed"`                         // Events processed
+	QueueWorkers          int      `json:"queue_workers" toml:"queue_workers" yaml:"queue_workers"`                               // Workers processing the events
+	SkippedOutputs        uint64   `json:"skipped_outputs" toml:"skipped_outputs" yaml:"skipped_outputs"`                         // Matched outputs below the minimum
+	SkippedTransactionIDs []string `json:"skipped_transaction_ids" toml:"skipped_transaction_ids" yaml:"skipped_transaction_ids"` // Recently skipped transactions (can be imported)
+	SkippedTransactions   uint64   `json:"skipped_transactions" toml:"skipped_transactions" yaml:"skipped_transactions"`          // Transactions that were not recorded
+}
+
+// recordSkipped will count the skipped transaction and keep it for a manual import
+func (o *monitorFilterOptions) recordSkipped(txID, txHex string, outputs uint64) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.skippedOutputs += outputs
+	o.skippedTransactions++
+	if o.skipped == nil {
+		o.skipped = make(map[string]string)
+	}
+	if _, ok := o.skipped[txID]; ok {
+		return
+	}
+
+	// Drop the oldest skipped transaction
+	if len(o.skippedIDs) >= maxSkippedMonitorTransactions {
+		delete(o.skipped, o.skippedIDs[0])
+		o.skippedIDs = o.skippedIDs[1:]
+	}
+	o.skipped[txID] = txHex
+	o.skippedIDs = append(o.skippedIDs, txID)
+}
+
+// skippedHex will return the hex of a skipped transaction (empty if not found)
+func (o *monitorFilterOptions) skippedHex(txID string) string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.skipped[txID]
+}
+
+// removeSkipped will remove an imported transaction from the skipped transactions
+func (o *monitorFilterOptions) removeSkipped(txID string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if _, ok := o.skipped[txID]; !ok {
+		return
+	}
+	delete(o.skipped, txID)
+	for index, id := range o.skippedIDs {
+		if id == txID {
+			o.skippedIDs = append(o.skippedIDs[:index], o.skippedIDs[index+1:]...)
+			break
+		}
+	}
+}
+
+// monitoredDustFilter skips the monitored transactions only paying dust to our destinations, implemented by Client
+type monitoredDustFilter interface {
+	skipMonitoredDust(ctx context.Context, txHex string) (bool, error)
+}
+
+// skipMonitoredDust will check whether a monitored transaction only pays dust to our destinations
+//
+// The transaction is not skipped if it spends our utxos or has a matched output of at least the minimum.
+// Skipped transactions are logged, counted and kept for a manual import (see ImportTransactionByID).
+func (c *Client) skipMonitoredDust(ctx context.Context, txHex string) (bool, error) {
+	filter := c.options.monitorFilter
+	if filter.minimumSatoshis == 0 {
+		return false, nil
+	}
+
+	tx, err := bt.NewTxFromString(txHex)
+	if err != nil {
+		return false, err
+	}
+
+	// Spending our utxos is always recorded
+	opts := c.DefaultModelOptions()
+	for _, input := range tx.Inputs {
+		var utxo *Utxo
+		if utxo, err = getUtxo(
+			ctx, input.PreviousTxIDStr(), input.PreviousTxOutIndex, opts...,
+		); err != nil {
+			return false, err
+		} else if utxo != nil {
+			return false, nil
+		}
+	}
+
+	// Count the matched outputs below the minimum
+	var dustOutputs uint64
+	for _, output := range tx.Outputs {
+		var destination *Destination
+		if destination, err = getDestinationByLockingScript(
+			ctx, output.LockingScript.String(), opts...,
+		); err != nil {
+			return false, err
+		} else if destination == nil {
+			continue
+		}
+		if output.Satoshis >= filter.minimumSatoshis {
+			return false, nil
+		}
+		dustOutputs++
+	}
+	if dustOutputs == 0 {
+		return false, nil
+	}
+
+	filter.recordSkipped(tx.TxID(), txHex, dustOutputs)
+	c.Logger().Info(ctx, fmt.Sprintf(
+		"[MONITOR] skipped tx %s: %d matched output(s) below %d satoshis", tx.TxID(), dustOutputs, filter.minimumSatoshis,
+	))
+	return true, nil
+}
+
+// GetMonitorStatus will return the status of the mempool monitor (including the skipped dust transactions)
+func (c *Client) GetMonitorStatus() *MonitorStatus {
+	filter := c.options.monitorFilter
+	filter.mu.Lock()
+	defer filter.mu.Unlock()
+
+	status := &MonitorStatus{
+		MinimumSatoshis:       filter.minimumSatoshis,
+		SkippedOutputs:        filter.skippedOutputs,
+		SkippedTransactionIDs: append([]string{}, filter.skippedIDs...),
+		SkippedTransactions:   filter.skippedTransactions,
+	}
+	if queue := c.options.monitorQueue.loaded(); queue != nil {
+		queue.setStatus(status)
+	}
+	if c.options.chainstate != nil && c.options.chainstate.ClientInterface != nil {
+		if monitor := c.options.chainstate.Monitor(); monitor != nil {
+			status.Connected = monitor.IsConnected()
+			status.Enabled = true
+		}
+	}
+	return status
+}
@@ -0,0 +1,126 @@
+package bux
+
+import (
+	"context"
+	"testing"
+
+	"github.com/BuxOrg/bux/chainstate"
+	"github.com/BuxOrg/bux/utils"
+	"github.com/libsv/go-bt/v2"
+	"github.com/libsv/go-bt/v2/bscript"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// monitoredTxHex will return the hex of a (unsigned) transaction paying the satoshis to the locking scripts
+func monitoredTxHex(t *testing.T, lockingScripts []string, satoshis []uint64) string {
+	prevTxID, err := utils.RandomHex(32)
+	require.NoError(t, err)
+
+	tx := bt.NewTx()
+	require.NoError(t, tx.From(prevTxID, 0, "76a9147ff514e6ae3deb46e6644caac5cdd0bf2388906588ac", 100000))
+	for index, lockingScript := range lockingScripts {
+		var script *bscript.Script
+		script, err = bscript.NewFromHexString(lockingScript)
+		require.NoError(t, err)
+		tx.AddOutput(&bt.Output{LockingScript: script, Satoshis: satoshis[index]})
+	}
+	return tx.String()
+}
+
+// TestClient_skipMonitoredDust will test recording monitored transactions with a minimum value
+func TestClient_skipMonitoredDust(t *testing.T) {
+	t.Parallel()
+
+	newClient := func(t *testing.T, minimum uint64) (context.Context, ClientInterface, *Fixtures, func()) {
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, true,
+			WithCustomTaskManager(&taskManagerMockBase{}),
+			WithMonitorMinimumSatoshis(minimum),
+		)
+		return ctx, client, NewFixtures(t, client).WithXpub(0).WithDestinations(2), deferMe
+	}
+
+	t.Run("dust is skipped and can be imported", func(t *testing.T) {
+		ctx, client, fixtures, deferMe := newClient(t, 546)
+		defer deferMe()
+
+		txHex := monitoredTxHex(t, []string{
+			fixtures.Destinations[0].LockingScript, fixtures.Destinations[1].LockingScript, testLockingScript,
+		}, []uint64{1, 1, 90000})
+		transaction, err := recordMonitoredTransaction(ctx, client, txHex)
+		require.NoError(t, err)
+		assert.Nil(t, transaction)
+
+		txID, err := utils.GetTransactionIDFromHex(txHex)
+		require.NoError(t, err)
+		transaction, err = client.GetTransaction(ctx, "", txID)
+		require.ErrorIs(t, err, ErrMissingTransaction)
+		assert.Nil(t, transaction)
+
+		status := client.GetMonitorStatus()
+		assert.Equal(t, uint64(546), status.MinimumSatoshis)
+		assert.Equal(t, uint64(1), status.SkippedTransactions)
+		assert.Equal(t, uint64(2), status.SkippedOutputs)
+		assert.Equal(t, []string{txID}, status.SkippedTransactionIDs)
+
+		// Import manually
+		transaction, err = client.ImportTransactionByID(ctx, txID)
+		require.NoError(t, err)
+		require.NotNil(t, transaction)
+		assert.Equal(t, txID, transaction.ID)
+		assert.Empty(t, client.GetMonitorStatus().SkippedTransactionIDs)
+
+		// Imported again: the recorded transaction is returned
+		transaction, err = client.ImportTransactionByID(ctx, txID)
+		require.NoError(t, err)
+		require.NotNil(t, transaction)
+		assert.Equal(t, txID, transaction.ID)
+	})
+
+	t.Run("transaction no longer kept is fetched from chainstate", func(t *testing.T) {
+		mock := chainstate.NewMockClient()
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, true,
+			WithCustomTaskManager(&taskManagerMockBase{}),
+			WithCustomChainstate(mock),
+		)
+		defer deferMe()
+		fixtures := NewFixtures(t, client).WithXpub(0).WithDestinations(1)
+
+		txHex := monitoredTxHex(t, []string{fixtures.Destinations[0].LockingScript}, []uint64{1})
+		txID, err := utils.GetTransactionIDFromHex(txHex)
+		require.NoError(t, err)
+
+		_, err = client.ImportTransactionByID(ctx, txID)
+		require.ErrorIs(t, err, ErrSkippedTransactionNotFound)
+
+		mock.RawTransactions = map[string]string{txID: txHex}
+		transaction, err := client.ImportTransactionByID(ctx, txID)
+		require.NoError(t, err)
+		require.NotNil(t, transaction)
+		assert.Equal(t, txID, transaction.ID)
+	})
+
+	t.Run("qualifying output is recorded", func(t *testing.T) {
+		ctx, client, fixtures, deferMe := newClient(t, 546)
+		defer deferMe()
+
+		txHex := monitoredTxHex(t, []string{
+			fixtures.Destinations[0].LockingScript, fixtures.Destinations[1].LockingScript,
+		}, []uint64{1, 1000})
+		transaction, err := recordMonitoredTransaction(ctx, client, txHex)
+		require.NoError(t, err)
+		require.NotNil(t, transaction)
+		assert.Equal(t, uint64(0), client.GetMonitorStatus().SkippedTransactions)
+	})
+
+	t.Run("no minimum", func(t *testing.T) {
+		ctx, client, fixtures, deferMe := newClient(t, 0)
+		defer deferMe()
+
+		txHex := monitoredTxHex(t, []string{fixtures.Destinations[0].LockingScript}, []uint64{1})
+		transaction, err := recordMonitoredTransaction(ctx, client, txHex)
+		require.NoError(t, err)
+		require.NotNil(t, transaction)
+		assert.Equal(t, uint64(0), client.GetMonitorStatus().SkippedTransactions)
+	})
+}
@@ -0,0 +1,164 @@
+package bux
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	zLogger "github.com/mrz1836/go-logger"
+	"github.com/newrelic/go-agent/v3/newrelic"
+)
+
+const (
+	monitorQueueDepthMetricName = "Custom/bux/monitor_queue/depth"
+	monitorQueueDropMetricName  = "Custom/bux/monitor_queue/drops"
+)
+
+// monitorEventQueue is the bounded worker pool processing the monitor events
+//
+// The events with the same key (IE: tx ID) are processed by the same worker, in order. If the queue
+// of the worker is full, the reader is blocked (backpressure) instead of spawning more goroutines.
+type monitorEventQueue struct {
+	closed    bool                        // True if the queue is closed (events are dropped)
+	depth     int64                       // Number of queued (and running) events
+	drops     uint64                      // Number of dropped events (queued after closing)
+	logger    zLogger.GormLoggerInterface // Logger for the panics
+	mu        sync.RWMutex                // Guards the closed flag (and the channels)
+	newRelic  *newrelic.Application       // NewRelic application (for the depth and drops metrics)
+	processed uint64                      // Number of processed events
+	wg        sync.WaitGroup              // Running workers
+	workers   []chan func()               // Queue of each worker
+}
+
+// newMonitorEventQueue will start the workers of a new queue (the depth is shared by the workers)
+func newMonitorEventQueue(workers, depth int, logger zLogger.GormLoggerInterface,
+	newRelic *newrelic.Application,
+) *monitorEventQueue {
+	if workers <= 0 {
+		workers = 1
+	}
+	workerDepth := depth / workers
+	if workerDepth <= 0 {
+		workerDepth = 1
+	}
+
+	q := &monitorEventQueue{
+		logger:   logger,
+		newRelic: newRelic,
+		workers:  make([]chan func(), workers),
+	}
+	for index := range q.workers {
+		q.workers[index] = make(chan func(), workerDepth)
+		q.wg.Add(1)
+		go q.work(q.workers[index])
+	}
+	return q
+}
+
+// work will process the events of the worker queue until it is closed
+func (q *monitorEventQueue) work(events chan func()) {
+	defer q.wg.Done()
+	for event := range events {
+		q.run(event)
+		atomic.AddInt64(&q.depth, -1)
+		atomic.AddUint64(&q.processed, 1)
+	}
+}
+
+// run will process the event (a panic does not stop the worker)
+func (q *monitorEventQueue) run(event func()) {
+	defer func() {
+		if err := recover(); err != nil && q.logger != nil {
+			q.logger.Error(context.Background(), fmt.Sprintf(
+				"[MONITOR] panic processing event: %v - stack trace: %v", err,
+				strings.ReplaceAll(string(debug.Stack()), "\n", ""),
+			))
+		}
+	}()
+	event()
+}
+
+// enqueue will queue the event on the worker of the key, blocking while the worker queue is full
+//
+// Returns false if the event was dropped (the queue is closed)
+func (q *monitorEventQueue) enqueue(key string, event func()) bool {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	if q.closed {
+		atomic.AddUint64(&q.drops, 1)
+		if q.newRelic != nil {
+			q.newRelic.RecordCustomMetric(monitorQueueDropMetricName, 1)
+		}
+		return false
+	}
+
+	depth := atomic.AddInt64(&q.depth, 1)
+	if q.newRelic != nil {
+		q.newRelic.RecordCustomMetric(monitorQueueDepthMetricName, float64(depth))
+	}
+	q.workers[q.workerIndex(key)] <- event
+	return true
+}
+
+// workerIndex will return the worker of the key
+func (q *monitorEventQueue) workerIndex(key string) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	return int(h.Sum32() % uint32(len(q.workers)))
+}
+
+// close will stop accepting events and wait for the queued events to be processed
+func (q *monitorEventQueue) close() {
+	q.mu.Lock()
+	if !q.closed {
+		q.closed = true
+		for _, events := range q.workers {
+			close(events)
+		}
+	}
+	q.mu.Unlock()
+	q.wg.Wait()
+}
+
+// setStatus will set the queue depth and counters on the monitor status
+func (q *monitorEventQueue) setStatus(status *MonitorStatus) {
+	status.QueueDepth = atomic.LoadInt64(&q.depth)
+	status.QueueDrops = atomic.LoadUint64(&q.drops)
+	status.QueueProcessed = atomic.LoadUint64(&q.processed)
+	status.QueueWorkers = len(q.workers)
+}
+
+// loaded will return the queue of the monitor events (nil if not started)
+func (o *monitorQueueOptions) loaded() *monitorEventQueue {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.queue
+}
+
+// monitorEventQueueProvider provides the queue of the monitor events, implemented by Client
+//
+// The events are processed in order by the reader with other implementations of the client
+type monitorEventQueueProvider interface {
+	monitorEventQueue() *monitorEventQueue
+}
+
+// monitorEventQueue will return the queue of the monitor events (started on first use)
+func (c *Client) monitorEventQueue() *monitorEventQueue {
+	options := c.options.monitorQueue
+	options.mu.Lock()
+	defer options.mu.Unlock()
+
+	if options.queue == nil {
+		var app *newrelic.Application
+		if c.IsNewRelicEnabled() {
+			app = c.options.newRelic.app
+		}
+		options.queue = newMonitorEventQueue(options.workers, options.depth, c.Logger(), app)
+	}
+	return options.queue
+}
@@ -0,0 +1,114 @@
+package bux
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestMonitorEventQueue will test the bounded worker pool of the monitor events
+func TestMonitorEventQueue(t *testing.T) {
+	t.Parallel()
+
+	t.Run("stress: ordered per key, zero loss", func(t *testing.T) {
+		const (
+			events = 10000
+			keys   = 100
+		)
+		queue := newMonitorEventQueue(4, 8, nil, nil)
+
+		var mu sync.Mutex
+		processed := make(map[string][]int)
+		for index := 0; index < events; index++ {
+			key, sequence := fmt.Sprintf("tx-%d", index%keys), index/keys
+			require.True(t, queue.enqueue(key, func() {
+				mu.Lock()
+				processed[key] = append(processed[key], sequence)
+				mu.Unlock()
+			}))
+		}
+		queue.close()
+
+		require.Len(t, processed, keys)
+		for key, sequences := range processed {
+			require.Len(t, sequences, events/keys, key)
+			for index, sequence := range sequences {
+				require.Equal(t, index, sequence, key)
+			}
+		}
+
+		status := new(MonitorStatus)
+		queue.setStatus(status)
+		assert.Equal(t, int64(0), status.QueueDepth)
+		assert.Equal(t, uint64(0), status.QueueDrops)
+		assert.Equal(t, uint64(events), status.QueueProcessed)
+		assert.Equal(t, 4, status.QueueWorkers)
+	})
+
+	t.Run("backpressure: the reader is blocked while the queue is full", func(t *testing.T) {
+		queue := newMonitorEventQueue(1, 1, nil, nil)
+		release := make(chan struct{})
+		started := make(chan struct{})
+
+		require.True(t, queue.enqueue("a", func() {
+			close(started)
+			<-release
+		}))
+		<-started
+		require.True(t, queue.enqueue("b", func() {})) // Queued
+
+		enqueued := make(chan bool)
+		go func() {
+			enqueued <- queue.enqueue("c", func() {})
+		}()
+		select {
+		case <-enqueued:
+			t.Fatal("the reader should be blocked")
+		case <-time.After(100 * time.Millisecond):
+		}
+
+		status := new(MonitorStatus)
+		queue.setStatus(status)
+		assert.Equal(t, int64(3), status.QueueDepth)
+
+		close(release)
+		assert.True(t, <-enqueued)
+		queue.close()
+	})
+
+	t.Run("closed: the events are dropped", func(t *testing.T) {
+		queue := newMonitorEventQueue(2, 10, nil, nil)
+		queue.close()
+		assert.False(t, queue.enqueue("a", func() {}))
+
+		status := new(MonitorStatus)
+		queue.setStatus(status)
+		assert.Equal(t, uint64(1), status.QueueDrops)
+	})
+
+	t.Run("a panic does not stop the worker", func(t *testing.T) {
+		_, client, deferMe := CreateTestSQLiteClient(t, false, true,
+			WithCustomTaskManager(&taskManagerMockBase{}),
+			WithMonitorQueue(1, 10),
+		)
+		defer deferMe()
+		queue := client.(*Client).monitorEventQueue()
+
+		done := make(chan struct{})
+		require.True(t, queue.enqueue("a", func() { panic("failed") }))
+		require.True(t, queue.enqueue("a", func() { close(done) }))
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("the event was not processed")
+		}
+
+		status := client.GetMonitorStatus()
+		assert.Equal(t, 1, status.QueueWorkers)
+		assert.Equal(t, uint64(0), status.QueueDrops)
+	})
+}
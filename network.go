@@ -0,0 +1,38 @@
+package bux
+
+import (
+	"github.com/BuxOrg/bux/chainstate"
+	"github.com/libsv/go-bk/chaincfg"
+)
+
+// Genesis block hashes (used to validate imported block headers)
+const (
+	genesisHashMainNet = "000000000019d6689c085ae165831e934ff763ae46a2a6c172b3f1b60a8ce26f"
+	genesisHashTestNet = "000000000933ea01ad0ee984209779baaec3ced90fa3f408719526f8d77f4943" // Also used by the STN
+)
+
+// networkParams will return the address params (chaincfg) for the given network
+//
+// The stress test network (STN) uses the testnet address params
+func networkParams(network chainstate.Network) *chaincfg.Params {
+	if network == chainstate.TestNet || network == chainstate.StressTestNet {
+		return &chaincfg.TestNet
+	}
+	return &chaincfg.MainNet
+}
+
+// networkGenesisHash will return the genesis block hash for the given network
+func networkGenesisHash(network chainstate.Network) string {
+	if network == chainstate.TestNet || network == chainstate.StressTestNet {
+		return genesisHashTestNet
+	}
+	return genesisHashMainNet
+}
+
+// getClientNetwork will return the network of the client (defaults to mainnet if no client is set)
+func getClientNetwork(client ClientInterface) chainstate.Network {
+	if client == nil || len(client.Network()) == 0 {
+		return chainstate.MainNet
+	}
+	return client.Network()
+}
@@ -0,0 +1,98 @@
+package bux
+
+import (
+	"testing"
+
+	"github.com/BuxOrg/bux/chainstate"
+	"github.com/BuxOrg/bux/utils"
+	"github.com/libsv/go-bk/chaincfg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test_networkParams will test the method networkParams()
+func Test_networkParams(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, &chaincfg.MainNet, networkParams(chainstate.MainNet))
+	assert.Equal(t, &chaincfg.MainNet, networkParams(""))
+	assert.Equal(t, &chaincfg.TestNet, networkParams(chainstate.TestNet))
+	assert.Equal(t, &chaincfg.TestNet, networkParams(chainstate.StressTestNet))
+}
+
+// Test_networkGenesisHash will test the method networkGenesisHash()
+func Test_networkGenesisHash(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, genesisHashMainNet, networkGenesisHash(chainstate.MainNet))
+	assert.Equal(t, genesisHashTestNet, networkGenesisHash(chainstate.TestNet))
+	assert.Equal(t, genesisHashTestNet, networkGenesisHash(chainstate.StressTestNet))
+}
+
+// TestNetwork_newAddress will test address generation using a testnet client
+func TestNetwork_newAddress(t *testing.T) {
+	t.Parallel()
+
+	_, client, deferMe := CreateTestSQLiteClient(t, false, false, WithNetwork(chainstate.TestNet))
+	defer deferMe()
+
+	destination, err := newAddress(testXPub, utils.ChainExternal, 0, client.DefaultModelOptions()...)
+	require.NoError(t, err)
+	require.NotNil(t, destination)
+
+	assert.NotEqual(t, testExternalAddress, destination.Address)
+	assert.NoError(t, utils.ValidateAddressNetwork(destination.Address, &chaincfg.TestNet))
+	assert.ErrorIs(t, utils.ValidateAddressNetwork(destination.Address, &chaincfg.MainNet), utils.ErrAddressNetworkMismatch)
+
+	// The locking script is the same on every network
+	mainDestination, err := newAddress(testXPub, utils.ChainExternal, 0, New())
+	require.NoError(t, err)
+	assert.Equal(t, testExternalAddress, mainDestination.Address)
+	assert.Equal(t, mainDestination.LockingScript, destination.LockingScript)
+}
+
+// TestTransactionConfig_validateOutputsNetwork will test the method validateOutputsNetwork()
+func TestTransactionConfig_validateOutputsNetwork(t *testing.T) {
+	t.Parallel()
+
+	testnetAddress, err := utils.GetAddressForNetwork(testExternalAddress, &chaincfg.TestNet)
+	require.NoError(t, err)
+
+	newConfig := func(address string) *TransactionConfig {
+		return &TransactionConfig{
+			Outputs: []*TransactionOutput{{
+				To:       address,
+				Satoshis: 1000,
+				Scripts:  []*ScriptOutput{{Address: address, Satoshis: 1000}},
+			}},
+		}
+	}
+
+	t.Run("mainnet address on mainnet", func(t *testing.T) {
+		assert.NoError(t, newConfig(testExternalAddress).validateOutputsNetwork(chainstate.MainNet))
+	})
+
+	t.Run("testnet address on testnet", func(t *testing.T) {
+		assert.NoError(t, newConfig(testnetAddress).validateOutputsNetwork(chainstate.TestNet))
+	})
+
+	t.Run("testnet address on mainnet", func(t *testing.T) {
+		err := newConfig(testnetAddress).validateOutputsNetwork(chainstate.MainNet)
+		assert.ErrorIs(t, err, ErrOutputAddressNetworkMismatch)
+	})
+
+	t.Run("mainnet address on testnet", func(t *testing.T) {
+		err := newConfig(testExternalAddress).validateOutputsNetwork(chainstate.TestNet)
+		assert.ErrorIs(t, err, ErrOutputAddressNetworkMismatch)
+	})
+
+	t.Run("script without address", func(t *testing.T) {
+		config := &TransactionConfig{
+			Outputs: []*TransactionOutput{{
+				OpReturn: &OpReturn{StringParts: []string{"hello"}},
+				Scripts:  []*ScriptOutput{{Script: "006a0568656c6c6f"}},
+			}},
+		}
+		assert.NoError(t, config.validateOutputsNetwork(chainstate.TestNet))
+	})
+}
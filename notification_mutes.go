@@ -0,0 +1,188 @@
+package bux
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/BuxOrg/bux/notifications"
+	"github.com/mrz1836/go-datastore"
+)
+
+// MutedNotificationsMode is what happens to the events of an xPub with muted notifications
+type MutedNotificationsMode string
+
+// Modes of the muted notifications
+const (
+	// MutedNotificationsDrop drops the muted events (nothing is delivered or recorded)
+	MutedNotificationsDrop MutedNotificationsMode = "drop"
+
+	// MutedNotificationsSpool records the muted events as delivery receipts flagged muted, the events are delivered
+	// once the notifications are unmuted (or the mute window expired)
+	MutedNotificationsSpool MutedNotificationsMode = "spool"
+)
+
+// notificationXpubIDs will return the xPub IDs of the model of the event
+//
+// The model is not changed (the transaction of a sync transaction is loaded if not set)
+func notificationXpubIDs(ctx context.Context, model interface{}) []string {
+	switch m := model.(type) {
+	case *Xpub:
+		return []string{m.ID}
+	case *balanceThresholdEvent:
+		return []string{m.ID}
+	case *AccessKey:
+		return []string{m.XpubID}
+	case *Destination:
+		return []string{m.XpubID}
+	case *DraftTransaction:
+		return []string{m.XpubID}
+	case *PaymailAddress:
+		return []string{m.XpubID}
+	case *Utxo:
+		return []string{m.XpubID}
+	case *Transaction:
+		return append(append([]string{}, m.XpubInIDs...), m.XpubOutIDs...)
+	case *SyncTransaction:
+		transaction := m.transaction
+		if transaction == nil {
+			transaction, _ = getTransactionByID(ctx, "", m.ID, m.GetOptions(false)...)
+		}
+		if transaction != nil {
+			return notificationXpubIDs(ctx, transaction)
+		}
+	}
+	return nil
+}
+
+// isNotifyMuted will return true if the notifications of all the xPubs (of the event) are muted
+//
+// Events without an xPub are never muted
+func isNotifyMuted(ctx context.Context, client ClientInterface, xPubIDs []string) bool {
+	if len(xPubIDs) == 0 {
+		return false
+	}
+	for _, xPubID := range xPubIDs {
+		if !xpubNotificationsMuted(ctx, client, xPubID) {
+			return false
+		}
+	}
+	return true
+}
+
+// spoolMutedNotification will record the muted event as a delivery receipt flagged muted (MutedNotificationsSpool)
+//
+// The event (payload) is kept and delivered once the notifications of one of the xPubs are unmuted
+// (see redeliverMutedNotifications)
+func spoolMutedNotification(ctx context.Context, client ClientInterface, xPubIDs []string,
+	event *notifications.Event,
+) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	delivery := newNotificationDelivery(&notifications.DeliveryReceipt{
+		EventID:   event.EventID,
+		EventType: event.EventType,
+		ModelID:   event.ID,
+		ModelType: event.ModelType,
+	}, append(client.DefaultModelOptions(), New())...)
+	delivery.Muted = true
+	delivery.Payload = string(payload)
+	delivery.XpubIDs = xPubIDs
+	return delivery.Save(ctx)
+}
+
+// redeliverMutedNotifications will deliver the spooled events (oldest first) of the xPubs that are no longer muted
+//
+// The muted receipt is removed before the delivery (the delivery is recorded like any other event), so the event is
+// only delivered once. Returns the number of delivered events
+func redeliverMutedNotifications(ctx context.Context, client ClientInterface) (int, error) {
+	n := client.Notifications()
+	if n == nil {
+		return 0, nil
+	}
+
+	opts := client.DefaultModelOptions()
+	delivered := 0
+	muted := make(map[string]bool)
+	err := forEachKeysetRecord(ctx, map[string]interface{}{
+		mutedField:       true,
+		deliveredAtField: nil,
+	}, defaultPageSize,
+		func(ctx context.Context, conditions map[string]interface{}, queryParams *datastore.QueryParams) ([]keysetRecord, error) {
+			deliveries := make([]*NotificationDelivery, 0)
+			if err := getModelsByConditions(
+				ctx, ModelNotificationDelivery, &deliveries, nil, &conditions, queryParams, opts...,
+			); err != nil {
+				return nil, err
+			}
+			records := make([]keysetRecord, 0, len(deliveries))
+			for _, delivery := range deliveries {
+				delivery.enrich(ModelNotificationDelivery, opts...)
+				records = append(records, delivery)
+			}
+			return records, nil
+		}, func(record keysetRecord) error {
+			delivery := record.(*NotificationDelivery)
+			stillMuted := true
+			for _, xPubID := range delivery.XpubIDs {
+				if _, ok := muted[xPubID]; !ok {
+					muted[xPubID] = xpubNotificationsMuted(ctx, client, xPubID)
+				}
+				stillMuted = stillMuted && muted[xPubID]
+			}
+			if stillMuted && len(delivery.XpubIDs) > 0 {
+				return nil
+			}
+
+			// Claim the event (another node might be delivering it)
+			claimed, err := delivery.claimMuted(ctx)
+			if err != nil || !claimed {
+				return err
+			}
+
+			event := &notifications.Event{}
+			var payload json.RawMessage
+			event.Model = &payload
+			if err = json.Unmarshal([]byte(delivery.Payload), event); err != nil {
+				return err
+			}
+			event.Model = payload
+			if err = n.NotifyEvent(ctx, event); err != nil {
+				client.Logger().Error(ctx, "failed delivering muted "+string(event.EventType)+" on "+event.ID+": "+err.Error())
+			}
+			delivered++
+			return nil
+		},
+		opts...,
+	)
+	return delivered, err
+}
+
+// muteNotifications will set the mute window of the xPub (a zero time removes it)
+func muteNotifications(ctx context.Context, client ClientInterface, xPubID string, until time.Time) (*Xpub, error) {
+
+	// Get the xPub
+	xPub, err := client.GetXpubByID(ctx, xPubID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Set the mute window
+	xPub.NotificationsMutedUntil.Valid = !until.IsZero()
+	xPub.NotificationsMutedUntil.Time = until.UTC()
+
+	// Save the model (also updates the cache)
+	if err = xPub.Save(ctx); err != nil {
+		return nil, err
+	}
+
+	// Deliver the events spooled while muted (MutedNotificationsSpool)
+	if !xPub.isNotificationsMuted() {
+		if _, err = redeliverMutedNotifications(ctx, client); err != nil {
+			client.Logger().Error(ctx, "failed delivering the muted notifications of "+xPub.ID+": "+err.Error())
+		}
+	}
+	return xPub, nil
+}
@@ -0,0 +1,165 @@
+package bux
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/BuxOrg/bux/notifications"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestClient_MuteNotifications will test the method MuteNotifications()
+func TestClient_MuteNotifications(t *testing.T) {
+	t.Parallel()
+
+	// newMutedXpub will return a client (with the mock notifications) and an xPub
+	newMutedXpub := func(t *testing.T, opts ...ClientOps) (context.Context, ClientInterface,
+		*notifications.MockClient, *Fixtures) {
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, true,
+			append(opts, WithCustomTaskManager(&taskManagerMockBase{}))...,
+		)
+		t.Cleanup(deferMe)
+		mock := notifications.NewMockClient()
+		client.SetNotificationsClient(mock)
+		return ctx, client, mock, NewFixtures(t, client).WithXpub(0)
+	}
+
+	t.Run("missing until", func(t *testing.T) {
+		ctx, client, _, fixtures := newMutedXpub(t)
+		_, err := client.MuteNotifications(ctx, fixtures.Xpub.ID, time.Time{})
+		require.ErrorIs(t, err, ErrMissingMuteUntil)
+	})
+
+	t.Run("muted events are dropped", func(t *testing.T) {
+		ctx, client, mock, fixtures := newMutedXpub(t)
+
+		xPub, err := client.MuteNotifications(ctx, fixtures.Xpub.ID, time.Now().Add(time.Hour))
+		require.NoError(t, err)
+		require.True(t, xPub.NotificationsMutedUntil.Valid)
+
+		// The mute state is displayed
+		xPub, err = client.GetXpubByID(ctx, fixtures.Xpub.ID)
+		require.NoError(t, err)
+		assert.True(t, xPub.Display().(*Xpub).NotificationsMuted)
+
+		fixtures.WithDestinations(1)
+		events, _ := mock.WaitForEvents(1, 200*time.Millisecond)
+		assert.Empty(t, events)
+
+		deliveries, err := client.GetNotificationDeliveries(ctx, fixtures.Destinations[0].ID, nil)
+		require.NoError(t, err)
+		assert.Empty(t, deliveries)
+	})
+
+	t.Run("unmute", func(t *testing.T) {
+		ctx, client, mock, fixtures := newMutedXpub(t)
+
+		_, err := client.MuteNotifications(ctx, fixtures.Xpub.ID, time.Now().Add(time.Hour))
+		require.NoError(t, err)
+
+		var xPub *Xpub
+		xPub, err = client.UnmuteNotifications(ctx, fixtures.Xpub.ID)
+		require.NoError(t, err)
+		assert.False(t, xPub.NotificationsMutedUntil.Valid)
+		assert.False(t, xPub.Display().(*Xpub).NotificationsMuted)
+
+		fixtures.WithDestinations(1)
+		events, ok := mock.WaitForEvents(1, 5*time.Second)
+		require.True(t, ok)
+		assert.Equal(t, fixtures.Destinations[0].ID, events[0].ID)
+	})
+
+	t.Run("expired mute window", func(t *testing.T) {
+		ctx, client, mock, fixtures := newMutedXpub(t)
+
+		_, err := client.MuteNotifications(ctx, fixtures.Xpub.ID, time.Now().Add(-time.Second))
+		require.NoError(t, err)
+
+		fixtures.WithDestinations(1)
+		events, ok := mock.WaitForEvents(1, 5*time.Second)
+		require.True(t, ok)
+		assert.Equal(t, fixtures.Destinations[0].ID, events[0].ID)
+	})
+
+	t.Run("muted events are spooled", func(t *testing.T) {
+		ctx, client, mock, fixtures := newMutedXpub(t, WithMutedNotificationsMode(MutedNotificationsSpool))
+
+		_, err := client.MuteNotifications(ctx, fixtures.Xpub.ID, time.Now().Add(time.Hour))
+		require.NoError(t, err)
+
+		fixtures.WithDestinations(1)
+		var deliveries []*NotificationDelivery
+		require.Eventually(t, func() bool {
+			deliveries, err = client.GetNotificationDeliveries(ctx, fixtures.Destinations[0].ID, nil)
+			return err == nil && len(deliveries) == 1
+		}, 5*time.Second, 10*time.Millisecond)
+
+		assert.True(t, deliveries[0].Muted)
+		assert.False(t, deliveries[0].DeliveredAt.Valid)
+		assert.Equal(t, string(notifications.EventTypeCreate), deliveries[0].EventType)
+		assert.Equal(t, IDs{fixtures.Xpub.ID}, deliveries[0].XpubIDs)
+		assert.Empty(t, mock.Events())
+
+		// Still muted
+		delivered, err := redeliverMutedNotifications(ctx, client)
+		require.NoError(t, err)
+		assert.Equal(t, 0, delivered)
+
+		// Delivered once unmuted (with the event ID of the spooled event)
+		_, err = client.UnmuteNotifications(ctx, fixtures.Xpub.ID)
+		require.NoError(t, err)
+		events, ok := mock.WaitForEvents(1, 5*time.Second)
+		require.True(t, ok)
+		assert.Equal(t, deliveries[0].ID, events[0].EventID)
+		assert.Equal(t, fixtures.Destinations[0].ID, events[0].ID)
+		assert.Equal(t, notifications.EventTypeCreate, events[0].EventType)
+
+		// Only once
+		delivered, err = redeliverMutedNotifications(ctx, client)
+		require.NoError(t, err)
+		assert.Equal(t, 0, delivered)
+		deliveries, err = client.GetNotificationDeliveries(ctx, fixtures.Destinations[0].ID, nil)
+		require.NoError(t, err)
+		assert.Empty(t, deliveries)
+	})
+
+	t.Run("expired mute window is delivered by the task", func(t *testing.T) {
+		ctx, client, mock, fixtures := newMutedXpub(t, WithMutedNotificationsMode(MutedNotificationsSpool))
+
+		_, err := client.MuteNotifications(ctx, fixtures.Xpub.ID, time.Now().Add(time.Hour))
+		require.NoError(t, err)
+		fixtures.WithDestinations(1)
+		require.Eventually(t, func() bool {
+			deliveries, getErr := client.GetNotificationDeliveries(ctx, fixtures.Destinations[0].ID, nil)
+			return getErr == nil && len(deliveries) == 1
+		}, 5*time.Second, 10*time.Millisecond)
+
+		// Expire the window (without unmuting)
+		xPub, err := client.GetXpubByID(ctx, fixtures.Xpub.ID)
+		require.NoError(t, err)
+		xPub.NotificationsMutedUntil.Time = time.Now().UTC().Add(-time.Second)
+		require.NoError(t, xPub.Save(ctx))
+
+		require.NoError(t, taskCleanupNotificationDeliveries(ctx, client.Logger(), WithClient(client)))
+		events, ok := mock.WaitForEvents(1, 5*time.Second)
+		require.True(t, ok)
+		assert.Equal(t, fixtures.Destinations[0].ID, events[0].ID)
+	})
+}
+
+// TestNotificationXpubIDs will test the method notificationXpubIDs()
+func TestNotificationXpubIDs(t *testing.T) {
+	t.Parallel()
+
+	ctx, client, deferMe := CreateTestSQLiteClient(t, false, true, WithCustomTaskManager(&taskManagerMockBase{}))
+	defer deferMe()
+
+	fixtures := NewFixtures(t, client).WithXpub(0).WithUtxos(1000)
+	syncTx := newSyncTransaction(fixtures.Transactions[0].ID, &SyncConfig{}, client.DefaultModelOptions()...)
+
+	// The transaction is loaded, not set on the sync transaction
+	assert.Equal(t, []string{fixtures.Xpub.ID}, notificationXpubIDs(ctx, syncTx))
+	assert.Nil(t, syncTx.transaction)
+}
@@ -0,0 +1,182 @@
+package bux
+
+import (
+	"context"
+	"time"
+
+	"github.com/BuxOrg/bux/notifications"
+	customTypes "github.com/mrz1836/go-datastore/custom_types"
+)
+
+// notificationPayload will map the model to the event payload for the schema version
+//
+// The legacy version (and models without a versioned payload) use the raw model.
+// The transaction notes are private, they are only included if includeNotes is set (see WithNotificationTransactionNotes)
+// The fields hidden from the display profile are removed from the payload (see WithNotificationDisplayProfile)
+func notificationPayload(version notifications.SchemaVersion, model interface{}, includeNotes bool,
+	profile string,
+) interface{} {
+	payload := versionedPayload(version, model, includeNotes)
+	if m, ok := model.(ModelInterface); ok && profile != DisplayProfileDefault {
+		return redactModel(payload, displayMask(ModelName(m.GetModelName()), profile))
+	}
+	return payload
+}
+
+// payloadSchemaVersion will return the schema version of the payload of the model (see versionedPayload)
+//
+// The models without a versioned payload are delivered raw, their version is unknown
+func payloadSchemaVersion(version notifications.SchemaVersion, model interface{}) notifications.SchemaVersion {
+	if version == notifications.SchemaVersionLegacy {
+		return version
+	}
+	switch model.(type) {
+	case *balanceThresholdEvent, *Destination, *DraftTransaction, *SyncTransaction, *Transaction:
+		return version
+	}
+	return notifications.SchemaVersionUnknown
+}
+
+// notificationSchemaVersion will return the version of the event payloads of the notification client
+// (SchemaVersionLegacy if the client is not versioned, see notifications.SchemaVersioner)
+func notificationSchemaVersion(n notifications.ClientInterface) notifications.SchemaVersion {
+	if versioner, ok := n.(notifications.SchemaVersioner); ok {
+		return versioner.SchemaVersion()
+	}
+	return notifications.SchemaVersionLegacy
+}
+
+// versionedPayload will map the model to the payload of the schema version (see notificationPayload)
+func versionedPayload(version notifications.SchemaVersion, model interface{}, includeNotes bool) interface{} {
+	if m, ok := model.(*balanceThresholdEvent); ok { // The event is the payload (all schema versions)
+		return m.event
+	}
+	if version == notifications.SchemaVersionLegacy {
+		if m, ok := model.(*Transaction); ok && m.Note != nil && !includeNotes {
+			withoutNote := *m
+			withoutNote.Note = nil
+			return &withoutNote
+		}
+		return model
+	}
+
+	switch m := model.(type) {
+	case *Destination:
+		return newDestinationEventV1(m)
+	case *DraftTransaction:
+		return newDraftEventV1(m)
+	case *SyncTransaction:
+		return newSyncStatusEventV1(m)
+	case *Transaction:
+		event := newTransactionEventV1(m)
+		if m.Note != nil && includeNotes {
+			event.Note = m.Note.Text
+		}
+		return event
+	}
+	return model
+}
+
+// withTransactionNote will return a copy of the transaction with the latest note of its xPubs
+// (see WithNotificationTransactionNotes), other models (or transactions with a note) are returned as-is
+func withTransactionNote(ctx context.Context, model interface{}) interface{} {
+	m, ok := model.(*Transaction)
+	if !ok || m.Note != nil {
+		return model
+	}
+	note, err := getLatestTransactionNoteOfXpubs(
+		ctx, append(append([]string{}, m.XpubInIDs...), m.XpubOutIDs...), m.ID, m.GetOptions(false)...,
+	)
+	if err != nil {
+		if client := m.Client(); client != nil {
+			client.Logger().Error(ctx, "failed getting the note of transaction "+m.ID+": "+err.Error())
+		}
+		return model
+	} else if note == nil {
+		return model
+	}
+	withNote := *m
+	withNote.Note = note
+	return &withNote
+}
+
+// newDestinationEventV1 will map the destination to the v1 payload
+func newDestinationEventV1(m *Destination) *notifications.DestinationEventV1 {
+	return &notifications.DestinationEventV1{
+		Address:       m.Address,
+		Chain:         m.Chain,
+		CreatedAt:     m.CreatedAt,
+		DraftID:       m.DraftID,
+		ID:            m.ID,
+		LockingScript: m.LockingScript,
+		Metadata:      m.Metadata,
+		Num:           m.Num,
+		RevokedAt:     nullTimePointer(m.RevokedAt),
+		Type:          m.Type,
+		UpdatedAt:     m.UpdatedAt,
+		XpubID:        m.XpubID,
+	}
+}
+
+// newDraftEventV1 will map the draft transaction to the v1 payload
+func newDraftEventV1(m *DraftTransaction) *notifications.DraftEventV1 {
+	return &notifications.DraftEventV1{
+		ExpiresAt:        m.ExpiresAt,
+		ID:               m.ID,
+		ReservedSatoshis: m.reservedSatoshis,
+		Status:           string(m.Status),
+		XpubID:           m.XpubID,
+	}
+}
+
+// newSyncStatusEventV1 will map the sync transaction to the v1 payload
+func newSyncStatusEventV1(m *SyncTransaction) *notifications.SyncStatusEventV1 {
+	event := &notifications.SyncStatusEventV1{
+		BroadcastStatus: m.BroadcastStatus.String(),
+		ID:              m.ID,
+		LastAttempt:     nullTimePointer(m.LastAttempt),
+		P2PStatus:       m.P2PStatus.String(),
+		SyncStatus:      m.SyncStatus.String(),
+		UpdatedAt:       m.UpdatedAt,
+	}
+	if response := m.LastBroadcastResponse(); response != nil && len(response.RejectionReason) > 0 {
+		event.RejectionMessage = response.StatusMessage
+		event.RejectionReason = string(response.RejectionReason)
+	}
+	return event
+}
+
+// newTransactionEventV1 will map the transaction to the v1 payload
+func newTransactionEventV1(m *Transaction) *notifications.TransactionEventV1 {
+	event := &notifications.TransactionEventV1{
+		BlockHash:       m.BlockHash,
+		BlockHeight:     m.BlockHeight,
+		CreatedAt:       m.CreatedAt,
+		DraftID:         m.DraftID,
+		Fee:             m.Fee,
+		ID:              m.ID,
+		Metadata:        m.Metadata,
+		NumberOfInputs:  m.NumberOfInputs,
+		NumberOfOutputs: m.NumberOfOutputs,
+		TotalValue:      m.TotalValue,
+		UpdatedAt:       m.UpdatedAt,
+		XpubInIDs:       append(make([]string, 0, len(m.XpubInIDs)), m.XpubInIDs...),
+		XpubOutIDs:      append(make([]string, 0, len(m.XpubOutIDs)), m.XpubOutIDs...),
+	}
+	if len(m.XpubOutputValue) > 0 {
+		event.XpubOutputValue = make(map[string]int64, len(m.XpubOutputValue))
+		for xPubID, value := range m.XpubOutputValue {
+			event.XpubOutputValue[xPubID] = value
+		}
+	}
+	return event
+}
+
+// nullTimePointer will return the time (nil if not set)
+func nullTimePointer(t customTypes.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	value := t.Time
+	return &value
+}
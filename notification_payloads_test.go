@@ -0,0 +1,164 @@
+package bux
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/BuxOrg/bux/chainstate"
+	"github.com/BuxOrg/bux/notifications"
+	"github.com/BuxOrg/bux/utils"
+	customTypes "github.com/mrz1836/go-datastore/custom_types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// updateGolden will rewrite the golden files (go test -run TestNotificationPayload -update-golden)
+var updateGolden = flag.Bool("update-golden", false, "update the golden files")
+
+// goldenTime is the fixed time used in the golden files
+var goldenTime = time.Date(2023, 10, 1, 12, 0, 0, 0, time.UTC)
+
+// goldenEventID is the fixed event id (ULID) of the golden payloads
+const goldenEventID = "01HBNV9X00TESTEVENT0000000"
+
+// goldenDestination will return a destination with fixed values
+func goldenDestination() *Destination {
+	return &Destination{
+		Model: Model{
+			CreatedAt: goldenTime,
+			Metadata:  Metadata{"note": "test"},
+			UpdatedAt: goldenTime,
+		},
+		Address:       "1CfaQw9udYNPccssFJFZ94DN8MqNZm9nGt",
+		Chain:         utils.ChainExternal,
+		ID:            "a4f2a6a5e9e5d8e4a4f5f8a07e0b7a9e4f8b3b3d0e7e3e3e1b1f0c5d8c9f6f2a",
+		LockingScript: testLockingScript,
+		Num:           2,
+		Type:          utils.ScriptTypePubKeyHash,
+		XpubID:        testXPubID,
+	}
+}
+
+// goldenTransaction will return a transaction with fixed values
+func goldenTransaction() *Transaction {
+	return &Transaction{
+		Model: Model{
+			CreatedAt: goldenTime,
+			Metadata:  Metadata{"note": "test"},
+			UpdatedAt: goldenTime,
+		},
+		TransactionBase: TransactionBase{
+			Hex: testTxHex,
+			ID:  testTxID,
+		},
+		Fee:             97,
+		NumberOfInputs:  1,
+		NumberOfOutputs: 3,
+		TotalValue:      300000,
+		XpubOutIDs:      IDs{testXPubID},
+		XpubOutputValue: XpubOutputValue{testXPubID: 300000},
+	}
+}
+
+// goldenSyncTransaction will return a sync transaction with fixed values
+func goldenSyncTransaction() *SyncTransaction {
+	return &SyncTransaction{
+		Model: Model{
+			CreatedAt: goldenTime,
+			UpdatedAt: goldenTime,
+		},
+		BroadcastStatus: SyncStatusComplete,
+		ID:              testTxID,
+		LastAttempt:     customTypes.NullTime{NullTime: sql.NullTime{Time: goldenTime, Valid: true}},
+		P2PStatus:       SyncStatusSkipped,
+		SyncStatus:      SyncStatusReady,
+	}
+}
+
+// TestNotificationPayload will test the event payloads (golden files, any change to a payload fails the test)
+func TestNotificationPayload(t *testing.T) {
+	revokedDestination := goldenDestination()
+	revokedDestination.RevokedAt = customTypes.NullTime{NullTime: sql.NullTime{Time: goldenTime, Valid: true}}
+
+	doubleSpend := goldenSyncTransaction()
+	doubleSpend.BroadcastStatus = SyncStatusError
+	doubleSpend.P2PStatus = SyncStatusCanceled
+	doubleSpend.SyncStatus = SyncStatusCanceled
+	doubleSpend.Results.Results = []*SyncResult{{
+		Action:          syncActionBroadcast,
+		ExecutedAt:      goldenTime,
+		Provider:        chainstate.ProviderAll,
+		RejectionReason: chainstate.RejectionDoubleSpend,
+		StatusMessage:   "txn-mempool-conflict",
+	}}
+
+	tests := []struct {
+		eventType notifications.EventType
+		golden    string
+		model     ModelInterface
+	}{
+		{notifications.EventTypeCreate, "destination_create_v1", goldenDestination()},
+		{notifications.EventTypeRevokedDestinationPayment, "destination_revoked_destination_payment_v1", revokedDestination},
+		{notifications.EventTypeCreate, "transaction_create_v1", goldenTransaction()},
+		{notifications.EventTypeBroadcast, "sync_transaction_broadcast_v1", goldenSyncTransaction()},
+		{notifications.EventTypeDoubleSpend, "sync_transaction_double_spend_v1", doubleSpend},
+	}
+	for _, test := range tests {
+		t.Run(test.golden, func(t *testing.T) {
+			data, err := json.MarshalIndent(&notifications.Event{
+				EventID:       goldenEventID,
+				EventType:     test.eventType,
+				ID:            test.model.GetID(),
+				Model:         notificationPayload(notifications.SchemaVersionV1, test.model, false, DisplayProfileDefault),
+				ModelType:     test.model.GetModelName(),
+				SchemaVersion: notifications.SchemaVersionV1,
+			}, "", "  ")
+			require.NoError(t, err)
+
+			path := filepath.Join("testdata", "notifications", test.golden+".json")
+			if *updateGolden {
+				require.NoError(t, os.WriteFile(path, append(data, '\n'), 0o600))
+			}
+
+			var expected []byte
+			expected, err = os.ReadFile(path) //nolint:gosec // test file path
+			require.NoError(t, err)
+			assert.Equal(t, string(bytes.TrimSpace(expected)), string(data))
+		})
+	}
+
+	t.Run("legacy is the raw model", func(t *testing.T) {
+		transaction := goldenTransaction()
+		assert.Equal(t, transaction, notificationPayload(notifications.SchemaVersionLegacy, transaction, false, DisplayProfileDefault))
+	})
+
+	t.Run("transaction notes are excluded by default", func(t *testing.T) {
+		transaction := goldenTransaction()
+		transaction.Note = &TransactionNote{Text: "private memo"}
+
+		legacy := notificationPayload(notifications.SchemaVersionLegacy, transaction, false, DisplayProfileDefault).(*Transaction)
+		assert.Nil(t, legacy.Note)
+		assert.NotNil(t, transaction.Note)
+		assert.Equal(t, transaction.ID, legacy.ID)
+		assert.Equal(t, transaction, notificationPayload(notifications.SchemaVersionLegacy, transaction, true, DisplayProfileDefault))
+
+		event := notificationPayload(notifications.SchemaVersionV1, transaction, false, DisplayProfileDefault)
+		assert.Empty(t, event.(*notifications.TransactionEventV1).Note)
+		event = notificationPayload(notifications.SchemaVersionV1, transaction, true, DisplayProfileDefault)
+		assert.Equal(t, "private memo", event.(*notifications.TransactionEventV1).Note)
+	})
+
+	t.Run("model without a versioned payload", func(t *testing.T) {
+		xPub := newXpub(testXPub)
+		assert.Equal(t, xPub, notificationPayload(notifications.SchemaVersionV1, xPub, false, DisplayProfileDefault))
+		assert.Equal(t, notifications.SchemaVersionUnknown, payloadSchemaVersion(notifications.SchemaVersionV1, xPub))
+		assert.Equal(t, notifications.SchemaVersionLegacy, payloadSchemaVersion(notifications.SchemaVersionLegacy, xPub))
+		assert.Equal(t, notifications.SchemaVersionV1, payloadSchemaVersion(notifications.SchemaVersionV1, goldenTransaction()))
+	})
+}
@@ -1,6 +1,9 @@
 package notifications
 
 import (
+	"sync"
+	"time"
+
 	zLogger "github.com/mrz1836/go-logger"
 )
 
@@ -19,26 +22,57 @@ const (
 
 	// EventTypeBroadcast when a transaction is broadcasted (sync tx)
 	EventTypeBroadcast EventType = "broadcast"
+
+	// EventTypeDoubleSpend when a broadcast is rejected as a double spend (sync tx)
+	EventTypeDoubleSpend EventType = "double_spend"
+
+	// EventTypeRevokedDestinationPayment when funds are received on a revoked destination
+	EventTypeRevokedDestinationPayment EventType = "revoked_destination_payment"
+
+	// EventTypeDraftExpiringSoon when a draft transaction will expire soon (not yet recorded)
+	EventTypeDraftExpiringSoon EventType = "draft_expiring_soon"
+
+	// EventTypeDraftExpired when a draft transaction expired (canceled by the clean up task)
+	EventTypeDraftExpired EventType = "draft_expired"
+
+	// EventTypeIncomingTransactionRejected when an incoming transaction exceeds the size or script limits
+	EventTypeIncomingTransactionRejected EventType = "incoming_transaction_rejected"
+
+	// EventTypeP2PFailed when the P2P notification of a transaction failed too many times (sync tx)
+	EventTypeP2PFailed EventType = "p2p_failed"
+
+	// EventTypeBalanceThreshold when the balance of an xPub crossed one of its alert thresholds
+	EventTypeBalanceThreshold EventType = "balance_threshold"
 )
 
 type (
 
 	// Client is the client (configuration)
 	Client struct {
-		options *clientOptions
+		endpointMu sync.Mutex // Serializes the changes of the webhook endpoint (persisted in order)
+		options    *clientOptions
+		webhook    *webhookTransport // The webhook transport (the endpoint can be changed, see SetWebhookEndpoint)
 	}
 
 	// clientOptions holds all the configuration for the client
 	clientOptions struct {
-		config     *notificationsConfig        // Configuration for broadcasting and other chain-state actions
-		debug      bool                        // Debugging mode
-		httpClient HTTPInterface               // Custom HTTP client
-		logger     zLogger.GormLoggerInterface // Custom logger interface
+		config           *notificationsConfig        // Configuration for broadcasting and other chain-state actions
+		debug            bool                        // Debugging mode
+		endpointStore    EndpointStore               // Persists the webhook endpoint changes (optional)
+		guard            *endpointGuard              // Refuses the webhook endpoints in the blocked address ranges
+		httpClient       HTTPInterface               // Custom HTTP client
+		logger           zLogger.GormLoggerInterface // Custom logger interface
+		recorder         ReceiptRecorder             // Keeps the delivery receipts of the webhook (optional)
+		schemaVersion    SchemaVersion               // Version of the event payloads
+		transports       []Transport                 // Transports used to deliver the events (webhook is added first if set)
+		validateEndpoint bool                        // Ping the new webhook endpoint before accepting it
 	}
 
 	// syncConfig holds all the configuration about the different notifications
 	notificationsConfig struct {
-		webhookEndpoint string // Webhook URL for basic notifications
+		webhookEndpoint   string        // Webhook URL for basic notifications
+		webhookAttempts   int           // Attempts of each webhook delivery (0 or 1 = no retries)
+		webhookRetryDelay time.Duration // Wait between the webhook attempts
 	}
 )
 
@@ -60,6 +94,25 @@ func NewClient(opts ...ClientOps) (ClientInterface, error) {
 		client.options.logger = zLogger.NewGormLogger(client.IsDebug(), 4)
 	}
 
+	// The configured endpoint must be valid (and not in a blocked range)
+	if len(client.options.config.webhookEndpoint) > 0 {
+		endpoint, err := client.options.guard.normalizeEndpoint(client.options.config.webhookEndpoint)
+		if err != nil {
+			return nil, err
+		}
+		client.options.config.webhookEndpoint = endpoint
+	}
+
+	// The webhook is the default transport (used while the endpoint is set)
+	client.webhook = &webhookTransport{
+		endpoint:    client.options.config.webhookEndpoint,
+		guard:       client.options.guard,
+		httpClient:  client.options.httpClient,
+		maxAttempts: client.options.config.webhookAttempts,
+		recorder:    client.options.recorder,
+		retryDelay:  client.options.config.webhookRetryDelay,
+	}
+
 	// Return the client
 	return client, nil
 }
@@ -74,6 +127,11 @@ func (c *Client) Debug(on bool) {
 	c.options.debug = on
 }
 
+// SchemaVersion will return the version of the event payloads
+func (c *Client) SchemaVersion() SchemaVersion {
+	return c.options.schemaVersion
+}
+
 // Logger get the logger
 func (c *Client) Logger() zLogger.GormLoggerInterface {
 	return c.options.logger
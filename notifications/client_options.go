@@ -1,14 +1,17 @@
 package notifications
 
 import (
-	"net/http"
+	"net"
 	"time"
 
 	zLogger "github.com/mrz1836/go-logger"
 )
 
 const (
-	defaultHTTPTimeout = 20 * time.Second
+	defaultDialKeepAlive = 30 * time.Second
+	defaultDialTimeout   = 10 * time.Second
+	defaultHTTPTimeout   = 20 * time.Second
+	maxRedirects         = 10
 )
 
 // ClientOps allow functional options to be supplied
@@ -20,15 +23,16 @@ type ClientOps func(c *clientOptions)
 // Useful for starting with the default and then modifying as needed
 func defaultClientOptions() *clientOptions {
 
-	// Set the default options
+	// Set the default options (the HTTP client uses the guard, see WithBlockedRanges)
+	guard := newEndpointGuard()
 	return &clientOptions{
 		config: &notificationsConfig{
 			webhookEndpoint: "",
 		},
-		logger: nil,
-		httpClient: &http.Client{
-			Timeout: defaultHTTPTimeout,
-		},
+		guard:         guard,
+		logger:        nil,
+		httpClient:    guard.httpClient(),
+		schemaVersion: SchemaVersionV1,
 	}
 }
 
@@ -39,6 +43,100 @@ func WithNotifications(webhookEndpoint string) ClientOps {
 	}
 }
 
+// WithHTTPSOnly will only accept the https webhook endpoints
+func WithHTTPSOnly() ClientOps {
+	return func(c *clientOptions) {
+		c.guard.httpsOnly = true
+	}
+}
+
+// WithBlockedRanges will set the address ranges refused as webhook endpoint (default: DefaultBlockedRanges)
+//
+// The host of the endpoint is resolved before every delivery, a delivery to a blocked address is refused
+// (not retried) and logged. The address actually connected to and the redirects are checked as well.
+// No ranges = no resolving (any address is accepted)
+func WithBlockedRanges(ranges ...*net.IPNet) ClientOps {
+	return func(c *clientOptions) {
+		c.guard.blocked = make([]*net.IPNet, 0, len(ranges))
+		for _, ipNet := range ranges {
+			if ipNet != nil {
+				c.guard.blocked = append(c.guard.blocked, ipNet)
+			}
+		}
+	}
+}
+
+// WithInsecureEndpoints will accept any http(s) webhook endpoint (IE: localhost for local development)
+//
+// Disables the blocked ranges and WithHTTPSOnly, never use it in production
+func WithInsecureEndpoints() ClientOps {
+	return func(c *clientOptions) {
+		c.guard.allowInsecure = true
+	}
+}
+
+// WithResolver will set the resolver of the webhook endpoint host (default: net.DefaultResolver)
+func WithResolver(resolver Resolver) ClientOps {
+	return func(c *clientOptions) {
+		if resolver != nil {
+			c.guard.resolver = resolver
+		}
+	}
+}
+
+// WithWebhookRetries will retry the failed webhook deliveries (maxAttempts includes the first attempt)
+func WithWebhookRetries(maxAttempts int, retryDelay time.Duration) ClientOps {
+	return func(c *clientOptions) {
+		if maxAttempts > 0 {
+			c.config.webhookAttempts = maxAttempts
+			c.config.webhookRetryDelay = retryDelay
+		}
+	}
+}
+
+// WithReceiptRecorder will set the recorder of the webhook delivery receipts (IE: persisted by bux)
+func WithReceiptRecorder(recorder ReceiptRecorder) ClientOps {
+	return func(c *clientOptions) {
+		if recorder != nil {
+			c.recorder = recorder
+		}
+	}
+}
+
+// WithEndpointStore will set the store persisting the webhook endpoint changes (see SetWebhookEndpoint)
+func WithEndpointStore(store EndpointStore) ClientOps {
+	return func(c *clientOptions) {
+		if store != nil {
+			c.endpointStore = store
+		}
+	}
+}
+
+// WithEndpointValidation will ping (HEAD) the new webhook endpoint before accepting it (see SetWebhookEndpoint)
+func WithEndpointValidation() ClientOps {
+	return func(c *clientOptions) {
+		c.validateEndpoint = true
+	}
+}
+
+// WithTransport will add a custom transport for delivering the events (multiple transports can be used)
+func WithTransport(transport Transport) ClientOps {
+	return func(c *clientOptions) {
+		if transport != nil {
+			c.transports = append(c.transports, transport)
+		}
+	}
+}
+
+// WithSchemaVersion will set the version of the event payloads (SchemaVersionLegacy for the raw models)
+func WithSchemaVersion(version SchemaVersion) ClientOps {
+	return func(c *clientOptions) {
+		if len(version) > 0 {
+			c.schemaVersion = version
+		}
+	}
+}
+
 // WithLogger will set the logger
 func WithLogger(customLogger zLogger.GormLoggerInterface) ClientOps {
 	return func(c *clientOptions) {
@@ -1,10 +1,12 @@
 package notifications
 
 import (
+	"context"
 	"net/http"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestWithNotifications(t *testing.T) {
@@ -38,25 +40,62 @@ func TestWithNotifications(t *testing.T) {
 }
 
 func Test_defaultClientOptions(t *testing.T) {
-	tests := []struct {
-		name string
-		want *clientOptions
-	}{
-		{
-			name: "options",
-			want: &clientOptions{
-				config: &notificationsConfig{
-					webhookEndpoint: "",
-				},
-				httpClient: &http.Client{
-					Timeout: defaultHTTPTimeout,
-				},
-			},
-		},
-	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			assert.Equalf(t, tt.want, defaultClientOptions(), "defaultClientOptions()")
-		})
-	}
+	t.Run("options", func(t *testing.T) {
+		options := defaultClientOptions()
+		assert.Equal(t, &notificationsConfig{webhookEndpoint: ""}, options.config)
+		assert.Equal(t, newEndpointGuard(), options.guard)
+		assert.Equal(t, SchemaVersionV1, options.schemaVersion)
+
+		// The HTTP client is guarded (dialed addresses and redirects)
+		httpClient, ok := options.httpClient.(*http.Client)
+		require.True(t, ok)
+		assert.Equal(t, defaultHTTPTimeout, httpClient.Timeout)
+		assert.NotNil(t, httpClient.CheckRedirect)
+		transport, ok := httpClient.Transport.(*http.Transport)
+		require.True(t, ok)
+		assert.NotNil(t, transport.DialContext)
+	})
+}
+
+func TestWithTransport(t *testing.T) {
+	t.Run("nil transport", func(t *testing.T) {
+		client, err := NewClient(WithTransport(nil))
+		require.NoError(t, err)
+		assert.Len(t, client.Transports(), 0)
+	})
+
+	t.Run("custom transports", func(t *testing.T) {
+		client, err := NewClient(WithTransport(NewMemoryTransport()), WithTransport(NewMemoryTransport()))
+		require.NoError(t, err)
+		assert.Len(t, client.Transports(), 2)
+	})
+}
+
+// TestWithSchemaVersion will test the method WithSchemaVersion()
+func TestWithSchemaVersion(t *testing.T) {
+	t.Run("default is v1", func(t *testing.T) {
+		c, err := NewClient()
+		require.NoError(t, err)
+		assert.Equal(t, SchemaVersionV1, c.(SchemaVersioner).SchemaVersion())
+	})
+
+	t.Run("empty version is ignored", func(t *testing.T) {
+		options := defaultClientOptions()
+		WithSchemaVersion("")(options)
+		assert.Equal(t, SchemaVersionV1, options.schemaVersion)
+	})
+
+	t.Run("legacy version is in every delivery", func(t *testing.T) {
+		transport := NewMemoryTransport()
+		c, err := NewClient(WithSchemaVersion(SchemaVersionLegacy), WithTransport(transport))
+		require.NoError(t, err)
+
+		require.NoError(t, c.Notify(context.Background(), "destination", EventTypeCreate, nil, "test-id"))
+		require.NoError(t, c.NotifyEvent(context.Background(), &Event{EventType: EventTypeUpdate, ID: "test-id"}))
+
+		events := transport.Events()
+		require.Len(t, events, 2)
+		assert.Equal(t, SchemaVersionLegacy, events[0].SchemaVersion)
+		assert.Equal(t, SchemaVersionLegacy, events[1].SchemaVersion)
+	})
 }
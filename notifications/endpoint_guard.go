@@ -0,0 +1,199 @@
+package notifications
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Resolver resolves the host of the webhook endpoint (net.DefaultResolver implements it)
+type Resolver interface {
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+// endpointGuard refuses the webhook endpoints in the blocked address ranges (SSRF guard)
+type endpointGuard struct {
+	allowInsecure bool         // Local development: any http(s) endpoint is accepted (see WithInsecureEndpoints)
+	blocked       []*net.IPNet // Refused address ranges (see WithBlockedRanges)
+	httpsOnly     bool         // Only https endpoints are accepted (see WithHTTPSOnly)
+	resolver      Resolver     // Resolves the host on every delivery (see WithResolver)
+}
+
+// defaultBlockedRanges are the loopback, private, link-local and unspecified address ranges
+var defaultBlockedRanges = []string{
+	"0.0.0.0/8",      // "This" network
+	"10.0.0.0/8",     // Private
+	"100.64.0.0/10",  // Carrier-grade NAT
+	"127.0.0.0/8",    // Loopback
+	"169.254.0.0/16", // Link-local (IE: cloud metadata)
+	"172.16.0.0/12",  // Private
+	"192.168.0.0/16", // Private
+	"::/128",         // Unspecified
+	"::1/128",        // Loopback
+	"fc00::/7",       // Unique local
+	"fe80::/10",      // Link-local
+}
+
+// DefaultBlockedRanges will return the address ranges refused by default (loopback, private, link-local, etc.)
+func DefaultBlockedRanges() []*net.IPNet {
+	ranges := make([]*net.IPNet, 0, len(defaultBlockedRanges))
+	for _, cidr := range defaultBlockedRanges {
+		_, ipNet, _ := net.ParseCIDR(cidr)
+		ranges = append(ranges, ipNet)
+	}
+	return ranges
+}
+
+// newEndpointGuard will return the default guard (blocked ranges, resolved with net.DefaultResolver)
+func newEndpointGuard() *endpointGuard {
+	return &endpointGuard{
+		blocked:  DefaultBlockedRanges(),
+		resolver: net.DefaultResolver,
+	}
+}
+
+// normalizeEndpoint will validate the endpoint and return the normalized URL (lower-case host, no fragment)
+//
+// The hosts that are blocked without resolving (localhost, IP in a blocked range) are refused
+func (g *endpointGuard) normalizeEndpoint(endpoint string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(endpoint))
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", ErrInvalidEndpoint, err.Error())
+	} else if (u.Scheme != "http" && u.Scheme != "https") || len(u.Hostname()) == 0 {
+		return "", fmt.Errorf("%w: %s", ErrInvalidEndpoint, "expected an http(s) url")
+	} else if g.httpsOnly && !g.allowInsecure && u.Scheme != "https" {
+		return "", fmt.Errorf("%w: %s", ErrInvalidEndpoint, "expected an https url")
+	}
+	u.Host = strings.ToLower(u.Host)
+	u.Fragment = ""
+
+	if !g.allowInsecure {
+		if isLocalhost(u.Hostname()) {
+			return "", fmt.Errorf("%w: %s", ErrBlockedEndpoint, u.Hostname())
+		} else if ip := net.ParseIP(u.Hostname()); ip != nil && g.isBlocked(ip) {
+			return "", fmt.Errorf("%w: %s", ErrBlockedEndpoint, ip.String())
+		}
+	}
+	return u.String(), nil
+}
+
+// checkEndpoint will resolve the host of the endpoint and refuse it if any address is in a blocked range
+//
+// Called before every request for a clear error, the address actually dialed is checked by the HTTP client
+// (a DNS rebinding between the check and the connection is refused, see httpClient)
+func (g *endpointGuard) checkEndpoint(ctx context.Context, endpoint string) error {
+	if g == nil || g.allowInsecure || len(g.blocked) == 0 {
+		return nil
+	}
+
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidEndpoint, err.Error())
+	}
+	host := u.Hostname()
+	if isLocalhost(host) {
+		return fmt.Errorf("%w: %s", ErrBlockedEndpoint, host)
+	}
+
+	var ips []net.IP
+	if ip := net.ParseIP(host); ip != nil {
+		ips = append(ips, ip)
+	} else {
+		var addresses []net.IPAddr
+		if addresses, err = g.resolver.LookupIPAddr(ctx, host); err != nil {
+			return err
+		}
+		for _, address := range addresses {
+			ips = append(ips, address.IP)
+		}
+	}
+	for _, ip := range ips {
+		if g.isBlocked(ip) {
+			return fmt.Errorf("%w: %s resolves to %s", ErrBlockedEndpoint, host, ip.String())
+		}
+	}
+	return nil
+}
+
+// httpClient will return the default HTTP client of the webhook (the guard is applied to every connection)
+//
+// The address actually dialed is checked (a DNS rebinding after checkEndpoint is refused),
+// the redirects are checked as new endpoints
+func (g *endpointGuard) httpClient() *http.Client {
+	transport := &http.Transport{Proxy: http.ProxyFromEnvironment}
+	if defaultTransport, ok := http.DefaultTransport.(*http.Transport); ok {
+		transport = defaultTransport.Clone()
+	}
+	transport.DialContext = (&net.Dialer{
+		Control:   g.control,
+		KeepAlive: defaultDialKeepAlive,
+		Timeout:   defaultDialTimeout,
+	}).DialContext
+	return &http.Client{
+		CheckRedirect: g.checkRedirect,
+		Timeout:       defaultHTTPTimeout,
+		Transport:     transport,
+	}
+}
+
+// NewGuardedHTTPClient will return an HTTP client refusing the connections to the default blocked ranges
+// (see DefaultBlockedRanges), the redirects are checked as new endpoints
+//
+// Useful for any request to a user given URL (IE: the avatar of a paymail profile)
+func NewGuardedHTTPClient(timeout time.Duration) *http.Client {
+	client := newEndpointGuard().httpClient()
+	if timeout > 0 {
+		client.Timeout = timeout
+	}
+	return client
+}
+
+// control will refuse the connection if the dialed address is in a blocked range (see net.Dialer)
+func (g *endpointGuard) control(_, address string, _ syscall.RawConn) error {
+	if g.allowInsecure || len(g.blocked) == 0 {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrBlockedEndpoint, address)
+	}
+	if ip := net.ParseIP(host); ip == nil || g.isBlocked(ip) {
+		return fmt.Errorf("%w: %s", ErrBlockedEndpoint, host)
+	}
+	return nil
+}
+
+// checkRedirect will check every redirect as a new endpoint (see http.Client)
+func (g *endpointGuard) checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxRedirects {
+		return fmt.Errorf("%w: stopped after %d redirects", ErrInvalidEndpoint, maxRedirects)
+	}
+	if _, err := g.normalizeEndpoint(req.URL.String()); err != nil {
+		return err
+	}
+	return g.checkEndpoint(req.Context(), req.URL.String())
+}
+
+// isBlocked will return true if the IP is in a blocked range (IPv4-mapped addresses are checked as IPv4)
+func (g *endpointGuard) isBlocked(ip net.IP) bool {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	for _, ipNet := range g.blocked {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// isLocalhost will return true for the localhost names (never resolved)
+func isLocalhost(host string) bool {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	return host == "localhost" || strings.HasSuffix(host, ".localhost")
+}
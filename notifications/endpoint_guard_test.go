@@ -0,0 +1,281 @@
+package notifications
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testPublicIP is a (public) address of the test endpoints
+const testPublicIP = "93.184.216.34"
+
+// staticResolver resolves every host to the next address of the list (the last address is kept)
+type staticResolver struct {
+	addresses []string
+	err       error
+	lookups   int
+	mu        sync.Mutex
+}
+
+// newStaticResolver will return a resolver of the addresses (in order)
+func newStaticResolver(addresses ...string) *staticResolver {
+	return &staticResolver{addresses: addresses}
+}
+
+// LookupIPAddr will return the next address (or the error)
+func (r *staticResolver) LookupIPAddr(context.Context, string) ([]net.IPAddr, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lookups++
+	if r.err != nil {
+		return nil, r.err
+	}
+	address := r.addresses[0]
+	if len(r.addresses) > 1 {
+		r.addresses = r.addresses[1:]
+	}
+	return []net.IPAddr{{IP: net.ParseIP(address)}}, nil
+}
+
+// getLookups will return the number of lookups
+func (r *staticResolver) getLookups() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.lookups
+}
+
+// mockHTTP will send the webhook requests of the client to httpmock (the client is not using http.DefaultTransport)
+func mockHTTP(c ClientInterface) {
+	httpmock.ActivateNonDefault(c.(*Client).options.httpClient.(*http.Client))
+}
+
+// Test_endpointGuard_isBlocked will test the default blocked ranges
+func Test_endpointGuard_isBlocked(t *testing.T) {
+	guard := newEndpointGuard()
+	for _, address := range []string{
+		"127.0.0.1", "10.1.2.3", "172.16.0.1", "192.168.1.1", "169.254.169.254", "100.64.0.1", "0.0.0.0",
+		"::1", "::", "fd00::1", "fe80::1", "::ffff:127.0.0.1",
+	} {
+		assert.True(t, guard.isBlocked(net.ParseIP(address)), address)
+	}
+	for _, address := range []string{testPublicIP, "8.8.8.8", "172.32.0.1", "2606:2800:220:1::1"} {
+		assert.False(t, guard.isBlocked(net.ParseIP(address)), address)
+	}
+}
+
+// Test_endpointGuard_normalizeEndpoint will test the method normalizeEndpoint()
+func Test_endpointGuard_normalizeEndpoint(t *testing.T) {
+	t.Run("normalized", func(t *testing.T) {
+		endpoint, err := newEndpointGuard().normalizeEndpoint("  HTTPS://Hooks.Example.COM:8443/Bux?token=A#fragment ")
+		require.NoError(t, err)
+		assert.Equal(t, "https://hooks.example.com:8443/Bux?token=A", endpoint)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		for _, endpoint := range []string{"hooks.example.com", "ftp://hooks.example.com", "https://", "://bad"} {
+			_, err := newEndpointGuard().normalizeEndpoint(endpoint)
+			assert.ErrorIs(t, err, ErrInvalidEndpoint, endpoint)
+		}
+	})
+
+	t.Run("blocked without resolving", func(t *testing.T) {
+		for _, endpoint := range []string{
+			"http://localhost:3000/hook", "http://api.localhost/hook", "http://127.0.0.1/hook",
+			"http://[::1]:8080/hook", "http://169.254.169.254/latest/meta-data",
+		} {
+			_, err := newEndpointGuard().normalizeEndpoint(endpoint)
+			assert.ErrorIs(t, err, ErrBlockedEndpoint, endpoint)
+		}
+	})
+
+	t.Run("https only", func(t *testing.T) {
+		guard := newEndpointGuard()
+		guard.httpsOnly = true
+		_, err := guard.normalizeEndpoint("http://hooks.example.com/hook")
+		assert.ErrorIs(t, err, ErrInvalidEndpoint)
+
+		_, err = guard.normalizeEndpoint("https://hooks.example.com/hook")
+		require.NoError(t, err)
+	})
+
+	t.Run("insecure endpoints", func(t *testing.T) {
+		guard := newEndpointGuard()
+		guard.httpsOnly = true
+		guard.allowInsecure = true
+		endpoint, err := guard.normalizeEndpoint("http://localhost:3000/hook")
+		require.NoError(t, err)
+		assert.Equal(t, "http://localhost:3000/hook", endpoint)
+	})
+}
+
+// TestNewClient_endpointGuard will test validating the configured endpoint
+func TestNewClient_endpointGuard(t *testing.T) {
+	t.Run("blocked endpoint", func(t *testing.T) {
+		_, err := NewClient(WithNotifications("http://127.0.0.1:8080/hook"))
+		require.ErrorIs(t, err, ErrBlockedEndpoint)
+	})
+
+	t.Run("https only", func(t *testing.T) {
+		_, err := NewClient(WithNotifications("http://hooks.example.com/hook"), WithHTTPSOnly())
+		require.ErrorIs(t, err, ErrInvalidEndpoint)
+	})
+
+	t.Run("insecure endpoints", func(t *testing.T) {
+		c, err := NewClient(WithNotifications("http://127.0.0.1:8080/hook"), WithHTTPSOnly(), WithInsecureEndpoints())
+		require.NoError(t, err)
+		assert.Equal(t, "http://127.0.0.1:8080/hook", c.GetWebhookEndpoint())
+	})
+
+	t.Run("normalized", func(t *testing.T) {
+		c, err := NewClient(WithNotifications(" https://HOOKS.example.com/hook "))
+		require.NoError(t, err)
+		assert.Equal(t, "https://hooks.example.com/hook", c.GetWebhookEndpoint())
+	})
+
+	t.Run("set a blocked endpoint", func(t *testing.T) {
+		c, err := NewClient(WithNotifications("https://hooks.example.com/hook"))
+		require.NoError(t, err)
+		require.ErrorIs(t, c.(WebhookEndpointSetter).SetWebhookEndpoint(context.Background(), "http://localhost/hook"), ErrBlockedEndpoint)
+		assert.Equal(t, "https://hooks.example.com/hook", c.GetWebhookEndpoint())
+	})
+}
+
+// TestWebhookTransport_endpointGuard will test resolving the endpoint on every delivery
+func TestWebhookTransport_endpointGuard(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	ctx := context.Background()
+	webhookURL := "https://hooks.example.com/hook"
+
+	t.Run("dns rebinding is refused", func(t *testing.T) {
+		httpmock.Reset()
+		httpmock.RegisterResponder(http.MethodPost, webhookURL, httpmock.NewStringResponder(http.StatusOK, `OK`))
+
+		// Public address when the endpoint is set, then rebinding to the loopback
+		resolver := newStaticResolver(testPublicIP, "127.0.0.1")
+		recorder := &receiptRecorder{}
+		c, err := NewClient(
+			WithNotifications(webhookURL), WithResolver(resolver), WithReceiptRecorder(recorder),
+			WithWebhookRetries(3, time.Millisecond),
+		)
+		require.NoError(t, err)
+		mockHTTP(c)
+
+		require.NoError(t, c.Notify(ctx, "transaction", EventTypeCreate, nil, "test-id"))
+		assert.Equal(t, 1, httpmock.GetTotalCallCount())
+
+		err = c.Notify(ctx, "transaction", EventTypeCreate, nil, "test-id")
+		require.ErrorIs(t, err, ErrBlockedEndpoint)
+		assert.Contains(t, err.Error(), "hooks.example.com resolves to 127.0.0.1")
+		assert.Equal(t, 1, httpmock.GetTotalCallCount()) // Nothing was sent
+
+		// The refused delivery is not retried (and the receipt has the reason)
+		assert.Equal(t, 2, resolver.getLookups())
+		require.Len(t, recorder.receipts, 2)
+		assert.Equal(t, 1, recorder.receipts[1].Attempts)
+		assert.Nil(t, recorder.receipts[1].DeliveredAt)
+		assert.Equal(t, err.Error(), recorder.receipts[1].Error)
+	})
+
+	t.Run("resolver failure", func(t *testing.T) {
+		httpmock.Reset()
+		resolver := newStaticResolver(testPublicIP)
+		resolver.err = errors.New("no such host")
+		c, err := NewClient(WithNotifications(webhookURL), WithResolver(resolver))
+		require.NoError(t, err)
+		mockHTTP(c)
+
+		require.Error(t, c.Notify(ctx, "transaction", EventTypeCreate, nil, "test-id"))
+		assert.Equal(t, 0, httpmock.GetTotalCallCount())
+	})
+
+	t.Run("no blocked ranges", func(t *testing.T) {
+		httpmock.Reset()
+		httpmock.RegisterResponder(http.MethodPost, webhookURL, httpmock.NewStringResponder(http.StatusOK, `OK`))
+		resolver := newStaticResolver("127.0.0.1")
+		c, err := NewClient(WithNotifications(webhookURL), WithResolver(resolver), WithBlockedRanges())
+		require.NoError(t, err)
+		mockHTTP(c)
+
+		require.NoError(t, c.Notify(ctx, "transaction", EventTypeCreate, nil, "test-id"))
+		assert.Equal(t, 1, httpmock.GetTotalCallCount())
+		assert.Equal(t, 0, resolver.getLookups())
+	})
+
+	t.Run("custom blocked ranges", func(t *testing.T) {
+		httpmock.Reset()
+		_, blocked, err := net.ParseCIDR("93.184.216.0/24")
+		require.NoError(t, err)
+		c, err := NewClient(
+			WithNotifications(webhookURL), WithResolver(newStaticResolver(testPublicIP)),
+			WithBlockedRanges(append(DefaultBlockedRanges(), blocked)...),
+		)
+		require.NoError(t, err)
+		mockHTTP(c)
+
+		require.ErrorIs(t, c.Notify(ctx, "transaction", EventTypeCreate, nil, "test-id"), ErrBlockedEndpoint)
+		assert.Equal(t, 0, httpmock.GetTotalCallCount())
+	})
+
+	t.Run("validation ping is guarded", func(t *testing.T) {
+		httpmock.Reset()
+		c, err := NewClient(WithEndpointValidation(), WithResolver(newStaticResolver("10.0.0.5")))
+		require.NoError(t, err)
+		mockHTTP(c)
+
+		require.ErrorIs(t, c.(WebhookEndpointSetter).SetWebhookEndpoint(ctx, webhookURL), ErrBlockedEndpoint)
+		assert.Empty(t, c.GetWebhookEndpoint())
+		assert.Equal(t, 0, httpmock.GetTotalCallCount())
+	})
+}
+
+// Test_endpointGuard_httpClient will test the guard of the connections and redirects of the default HTTP client
+func Test_endpointGuard_httpClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/redirect" {
+			http.Redirect(w, req, "http://127.0.0.2:8080/hook", http.StatusTemporaryRedirect)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	t.Run("dialed address is refused", func(t *testing.T) {
+		// The host resolves to a blocked address when connecting (IE: DNS rebinding after checkEndpoint)
+		guard := newEndpointGuard()
+		response, err := guard.httpClient().Get(server.URL)
+		if response != nil {
+			_ = response.Body.Close()
+		}
+		require.ErrorIs(t, err, ErrBlockedEndpoint)
+	})
+
+	t.Run("redirect to a blocked address is refused", func(t *testing.T) {
+		_, blocked, err := net.ParseCIDR("127.0.0.2/32")
+		require.NoError(t, err)
+		c, err := NewClient(WithNotifications(server.URL+"/redirect"), WithBlockedRanges(blocked))
+		require.NoError(t, err)
+
+		err = c.Notify(context.Background(), "transaction", EventTypeCreate, nil, "test-id")
+		require.ErrorIs(t, err, ErrBlockedEndpoint)
+	})
+
+	t.Run("insecure endpoints", func(t *testing.T) {
+		guard := newEndpointGuard()
+		guard.allowInsecure = true
+		response, err := guard.httpClient().Get(server.URL)
+		require.NoError(t, err)
+		_ = response.Body.Close()
+		assert.Equal(t, http.StatusOK, response.StatusCode)
+	})
+}
@@ -0,0 +1,21 @@
+package notifications
+
+import "errors"
+
+// ErrInvalidResponse is when the webhook endpoint returns a non-OK status code
+var ErrInvalidResponse = errors.New("received invalid response from notification endpoint")
+
+// ErrTransportsFailed is when more than one notification transport failed to deliver the event
+var ErrTransportsFailed = errors.New("notification transports failed to deliver the event")
+
+// ErrInvalidEndpoint is when the new webhook endpoint is not a valid URL (or failed the validation ping)
+var ErrInvalidEndpoint = errors.New("invalid notification webhook endpoint")
+
+// ErrBlockedEndpoint is when the webhook endpoint is (or resolves to) a blocked address range (see WithBlockedRanges)
+var ErrBlockedEndpoint = errors.New("notification webhook endpoint is in a blocked address range")
+
+// ErrMissingEndpoint is when the webhook was disabled before the event was delivered
+var ErrMissingEndpoint = errors.New("missing notification webhook endpoint")
+
+// ErrInvalidPayload is when the payload of a redelivery is not a notification event (JSON)
+var ErrInvalidPayload = errors.New("invalid notification event payload")
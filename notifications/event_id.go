@@ -0,0 +1,39 @@
+package notifications
+
+import (
+	"crypto/rand"
+	"time"
+)
+
+// crockfordAlphabet is the Crockford base32 alphabet used by ULIDs
+const crockfordAlphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// NewEventID will return a new ULID (26 characters, sortable by the creation time)
+//
+// 48 bits of the timestamp (milliseconds) followed by 80 random bits
+func NewEventID() string {
+	var data [16]byte
+	ms := uint64(time.Now().UnixMilli())
+	for i := 5; i >= 0; i-- {
+		data[i] = byte(ms)
+		ms >>= 8
+	}
+	_, _ = rand.Read(data[6:])
+
+	// Encode the 128 bits as 26 base32 characters (the first character only uses 3 bits)
+	id := make([]byte, 26)
+	var bits, value uint
+	position := 25
+	for i := 15; i >= 0; i-- {
+		value |= uint(data[i]) << bits
+		bits += 8
+		for bits >= 5 {
+			id[position] = crockfordAlphabet[value&31]
+			position--
+			value >>= 5
+			bits -= 5
+		}
+	}
+	id[position] = crockfordAlphabet[value&31]
+	return string(id)
+}
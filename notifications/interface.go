@@ -19,4 +19,26 @@ type ClientInterface interface {
 	IsDebug() bool
 	Logger() zLogger.GormLoggerInterface
 	Notify(ctx context.Context, modelType string, eventType EventType, model interface{}, id string) error
+	NotifyEvent(ctx context.Context, event *Event) error
+	Redeliver(ctx context.Context, payload []byte) (*DeliveryReceipt, error)
+	Transports() []Transport
+}
+
+// SchemaVersioner is a notification client with versioned event payloads (see WithSchemaVersion)
+//
+// Optional: the clients without it receive the raw models (SchemaVersionLegacy)
+type SchemaVersioner interface {
+	SchemaVersion() SchemaVersion
+}
+
+// WebhookEndpointSetter is a notification client with a webhook endpoint that can be changed at runtime
+//
+// Optional: the clients without it keep the configured endpoint (see Client.SetWebhookEndpoint)
+type WebhookEndpointSetter interface {
+	SetWebhookEndpoint(ctx context.Context, endpoint string) error
+}
+
+// EndpointStore persists the webhook endpoint changes (IE: bux keeps the endpoint in the datastore for restarts)
+type EndpointStore interface {
+	SaveWebhookEndpoint(ctx context.Context, endpoint string) error
 }
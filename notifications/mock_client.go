@@ -0,0 +1,126 @@
+package notifications
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	zLogger "github.com/mrz1836/go-logger"
+)
+
+// MockClient is a ready-made mock of the notifications ClientInterface (for testing)
+//
+// The events are kept in memory. Bux sends the notifications in the background, use WaitForEvents()
+type MockClient struct {
+	SchemaVersionValue SchemaVersion    // Version of the event payloads (SchemaVersionV1 if not set)
+	WebhookEndpoint    string           // The webhook endpoint (see SetWebhookEndpoint), nothing is delivered to it
+	transport          *MemoryTransport // Keeps the events
+}
+
+// NewMockClient will return a new mock
+func NewMockClient() *MockClient {
+	return &MockClient{transport: NewMemoryTransport()}
+}
+
+// Debug will do nothing
+func (m *MockClient) Debug(bool) {}
+
+// GetWebhookEndpoint will return the endpoint set (empty by default)
+func (m *MockClient) GetWebhookEndpoint() string {
+	return m.WebhookEndpoint
+}
+
+// SetWebhookEndpoint will keep the endpoint
+func (m *MockClient) SetWebhookEndpoint(_ context.Context, endpoint string) error {
+	m.WebhookEndpoint = endpoint
+	return nil
+}
+
+// IsDebug will return false
+func (m *MockClient) IsDebug() bool {
+	return false
+}
+
+// Logger will return a new (non-debug) logger
+func (m *MockClient) Logger() zLogger.GormLoggerInterface {
+	return zLogger.NewGormLogger(false, 4)
+}
+
+// Notify will keep the event in memory
+func (m *MockClient) Notify(ctx context.Context, modelType string, eventType EventType,
+	model interface{}, id string,
+) error {
+	return m.NotifyEvent(ctx, &Event{
+		EventType: eventType,
+		ID:        id,
+		Model:     model,
+		ModelType: modelType,
+	})
+}
+
+// NotifyEvent will keep the event in memory
+func (m *MockClient) NotifyEvent(ctx context.Context, event *Event) error {
+	if len(event.SchemaVersion) == 0 {
+		event.SchemaVersion = m.SchemaVersion()
+	}
+	if len(event.EventID) == 0 {
+		event.EventID = NewEventID()
+	}
+	return m.transport.Deliver(ctx, event)
+}
+
+// Redeliver will keep the event of the payload in memory (always delivered)
+func (m *MockClient) Redeliver(ctx context.Context, payload []byte) (*DeliveryReceipt, error) {
+	event := &Event{}
+	if err := json.Unmarshal(payload, event); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidPayload, err.Error())
+	}
+	deliveredAt := time.Now().UTC()
+	return &DeliveryReceipt{
+		Attempts:    1,
+		DeliveredAt: &deliveredAt,
+		Endpoint:    m.WebhookEndpoint,
+		EventID:     event.EventID,
+		EventType:   event.EventType,
+		ModelID:     event.ID,
+		ModelType:   event.ModelType,
+	}, m.transport.Deliver(ctx, event)
+}
+
+// SchemaVersion will return the version of the event payloads (SchemaVersionV1 if not set)
+func (m *MockClient) SchemaVersion() SchemaVersion {
+	if len(m.SchemaVersionValue) > 0 {
+		return m.SchemaVersionValue
+	}
+	return SchemaVersionV1
+}
+
+// Transports will return the in-memory transport
+func (m *MockClient) Transports() []Transport {
+	return []Transport{m.transport}
+}
+
+// Events will return a copy of the events (in order)
+func (m *MockClient) Events() []*Event {
+	return m.transport.Events()
+}
+
+// Reset will remove all the events
+func (m *MockClient) Reset() {
+	m.transport.Reset()
+}
+
+// WaitForEvents will wait until there are at least count events (false if the timeout was reached)
+func (m *MockClient) WaitForEvents(count int, timeout time.Duration) ([]*Event, bool) {
+	deadline := time.Now().Add(timeout)
+	for {
+		events := m.transport.Events()
+		if len(events) >= count {
+			return events, true
+		} else if time.Now().After(deadline) {
+			return events, false
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,45 @@
+package notifications
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestMockClient will test the MockClient
+func TestMockClient(t *testing.T) {
+	t.Parallel()
+
+	t.Run("keeps the events", func(t *testing.T) {
+		var c ClientInterface = NewMockClient()
+		require.NoError(t, c.Notify(context.Background(), "xpub", EventTypeCreate, map[string]string{}, "id1"))
+		require.NoError(t, c.NotifyEvent(context.Background(), &Event{EventType: EventTypeDelete, ID: "id2"}))
+
+		events := c.(*MockClient).Events()
+		require.Len(t, events, 2)
+		assert.Equal(t, "id1", events[0].ID)
+		assert.Equal(t, SchemaVersionV1, events[0].SchemaVersion)
+		assert.Equal(t, EventTypeDelete, events[1].EventType)
+
+		c.(*MockClient).Reset()
+		assert.Len(t, c.(*MockClient).Events(), 0)
+	})
+
+	t.Run("wait for events", func(t *testing.T) {
+		c := NewMockClient()
+		go func() {
+			time.Sleep(20 * time.Millisecond)
+			_ = c.Notify(context.Background(), "xpub", EventTypeCreate, nil, "id1")
+		}()
+
+		events, ok := c.WaitForEvents(1, time.Second)
+		require.True(t, ok)
+		assert.Len(t, events, 1)
+
+		_, ok = c.WaitForEvents(2, 20*time.Millisecond)
+		assert.False(t, ok)
+	})
+}
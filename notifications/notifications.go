@@ -5,59 +5,288 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"sync"
+	"time"
 )
 
-// GetWebhookEndpoint will get the configured webhook endpoint
+// GetWebhookEndpoint will get the current webhook endpoint
 func (c *Client) GetWebhookEndpoint() string {
-	return c.options.config.webhookEndpoint
+	return c.webhook.getEndpoint()
 }
 
-// Notify will create a new notification event
-func (c *Client) Notify(ctx context.Context, modelType string, eventType EventType,
-	model interface{}, id string) error {
+// SetWebhookEndpoint will change the webhook endpoint without restarting the client (empty = disable the webhook)
+//
+// The endpoint is pinged before it's accepted (see WithEndpointValidation) and persisted (see WithEndpointStore).
+// The deliveries in progress (IE: waiting for a retry) are redirected to the new endpoint
+func (c *Client) SetWebhookEndpoint(ctx context.Context, endpoint string) error {
+	c.endpointMu.Lock()
+	defer c.endpointMu.Unlock()
 
-	if len(c.options.config.webhookEndpoint) == 0 {
-		if c.IsDebug() {
-			c.Logger().Info(ctx, fmt.Sprintf("NOTIFY %s: %s - %v", eventType, id, model))
-		}
-	} else {
-		jsonData, err := json.Marshal(map[string]interface{}{
-			"event_type": eventType,
-			"id":         id,
-			"model":      model,
-			"model_type": modelType,
-		})
-		if err != nil {
+	if len(endpoint) > 0 {
+		var err error
+		if endpoint, err = c.options.guard.normalizeEndpoint(endpoint); err != nil {
 			return err
 		}
+		if c.options.validateEndpoint {
+			if err := c.pingEndpoint(ctx, endpoint); err != nil {
+				return err
+			}
+		}
+	}
 
-		var req *http.Request
-		if req, err = http.NewRequestWithContext(ctx,
-			http.MethodPost,
-			c.options.config.webhookEndpoint,
-			bytes.NewBuffer(jsonData),
-		); err != nil {
+	if c.options.endpointStore != nil {
+		if err := c.options.endpointStore.SaveWebhookEndpoint(ctx, endpoint); err != nil {
 			return err
 		}
+	}
 
-		var response *http.Response
-		if response, err = c.options.httpClient.Do(req); err != nil {
-			return err
+	c.webhook.setEndpoint(endpoint)
+	return nil
+}
+
+// pingEndpoint will make sure the endpoint is reachable (HEAD), any response other than a server error is accepted
+func (c *Client) pingEndpoint(ctx context.Context, endpoint string) error {
+	if err := c.options.guard.checkEndpoint(ctx, endpoint); err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, endpoint, nil)
+	if err != nil {
+		return err
+	}
+
+	var response *http.Response
+	if response, err = c.options.httpClient.Do(req); err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidEndpoint, err.Error())
+	}
+	defer func() {
+		_ = response.Body.Close()
+	}()
+
+	if response.StatusCode >= http.StatusInternalServerError {
+		return fmt.Errorf("%w: status code %d", ErrInvalidEndpoint, response.StatusCode)
+	}
+	return nil
+}
+
+// Redeliver will POST the payload of a failed webhook delivery (IE: a dead-lettered event) to the current endpoint
+//
+// A single attempt (no retries), the receipt is returned and not recorded
+func (c *Client) Redeliver(ctx context.Context, payload []byte) (*DeliveryReceipt, error) {
+	event := &Event{}
+	if err := json.Unmarshal(payload, event); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidPayload, err.Error())
+	}
+
+	receipt := &DeliveryReceipt{
+		EventID:   event.EventID,
+		EventType: event.EventType,
+		ModelID:   event.ID,
+		ModelType: event.ModelType,
+	}
+	return receipt, c.webhook.deliver(ctx, payload, receipt, 1)
+}
+
+// Transports will return the configured transports (the webhook is the first, if set)
+func (c *Client) Transports() []Transport {
+	if len(c.webhook.getEndpoint()) == 0 {
+		return c.options.transports
+	}
+	return append([]Transport{c.webhook}, c.options.transports...)
+}
+
+// Notify will create a new notification event
+func (c *Client) Notify(ctx context.Context, modelType string, eventType EventType,
+	model interface{}, id string) error {
+
+	return c.NotifyEvent(ctx, &Event{
+		EventType:     eventType,
+		ID:            id,
+		Model:         model,
+		ModelType:     modelType,
+		SchemaVersion: c.options.schemaVersion,
+	})
+}
+
+// NotifyEvent will deliver the event using all the transports
+//
+// A failing transport does not stop the delivery to the other transports
+func (c *Client) NotifyEvent(ctx context.Context, event *Event) error {
+
+	// Every delivery includes the schema version and the event ID
+	if len(event.SchemaVersion) == 0 {
+		event.SchemaVersion = c.options.schemaVersion
+	}
+	if len(event.EventID) == 0 {
+		event.EventID = NewEventID()
+	}
+
+	transports := c.Transports()
+	if len(transports) == 0 {
+		if c.IsDebug() {
+			c.Logger().Info(ctx, fmt.Sprintf("NOTIFY %s: %s - %v", event.EventType, event.ID, event.Model))
 		}
-		defer func() {
-			_ = response.Body.Close()
-		}()
+		return nil
+	}
 
-		if response.StatusCode != http.StatusOK {
-			// todo queue notification for another try ...
+	var firstErr error
+	failed := 0
+	for _, transport := range transports {
+		if err := transport.Deliver(ctx, event); err != nil {
 			c.Logger().Error(ctx, fmt.Sprintf(
-				"%s: %d",
-				"received invalid response from notification endpoint: ",
-				response.StatusCode))
+				"failed delivering %s notification for %s using %T: %s",
+				event.EventType, event.ID, transport, err.Error(),
+			))
+			if firstErr == nil {
+				firstErr = err
+			}
+			failed++
 		}
 	}
 
-	return nil
+	if failed > 1 {
+		return fmt.Errorf("%w: %d of %d failed, first error: %s",
+			ErrTransportsFailed, failed, len(transports), firstErr.Error())
+	}
+	return firstErr
+}
+
+// webhookTransport delivers the events using an HTTP POST (JSON) to the webhook endpoint
+type webhookTransport struct {
+	endpoint    string
+	guard       *endpointGuard // Refuses the blocked endpoints (none = no checks)
+	httpClient  HTTPInterface
+	maxAttempts int             // Attempts of each delivery (0 or 1 = no retries)
+	mu          sync.RWMutex    // Guards the endpoint (see SetWebhookEndpoint)
+	recorder    ReceiptRecorder // Keeps the delivery receipts (optional)
+	retryDelay  time.Duration   // Wait between the attempts
+}
+
+// NewWebhookTransport will return a new webhook (HTTP POST) transport
+//
+// The endpoint is not guarded (see WithBlockedRanges for the webhook of the client)
+func NewWebhookTransport(endpoint string, httpClient HTTPInterface) Transport {
+	return &webhookTransport{
+		endpoint:   endpoint,
+		httpClient: httpClient,
+	}
+}
+
+// getEndpoint will return the current endpoint
+func (w *webhookTransport) getEndpoint() string {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.endpoint
+}
+
+// setEndpoint will change the endpoint (used by the next attempts)
+func (w *webhookTransport) setEndpoint(endpoint string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.endpoint = endpoint
+}
+
+// Deliver will POST the event (JSON) to the webhook endpoint
+//
+// Failed attempts are retried (see WithWebhookRetries), the receipt is recorded after the last attempt.
+// Every attempt uses the current endpoint (the retries follow an endpoint change)
+func (w *webhookTransport) Deliver(ctx context.Context, event *Event) error {
+	jsonData, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	receipt := &DeliveryReceipt{
+		EventID:   event.EventID,
+		EventType: event.EventType,
+		ModelID:   event.ID,
+		ModelType: event.ModelType,
+	}
+	if err = w.deliver(ctx, jsonData, receipt, w.maxAttempts); err != nil {
+		receipt.Payload = string(jsonData) // Kept for the redelivery (IE: dead-lettered by bux)
+	}
+	if w.recorder != nil {
+		_ = w.recorder.RecordDelivery(ctx, receipt) // A failing recorder does not fail the delivery
+	}
+	return err
+}
+
+// deliver will POST the JSON data to the current endpoint (up to maxAttempts) and fill in the receipt
+func (w *webhookTransport) deliver(ctx context.Context, jsonData []byte, receipt *DeliveryReceipt,
+	maxAttempts int,
+) (err error) {
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		if attempt > 1 {
+			if err = w.waitForRetry(ctx); err != nil {
+				break
+			}
+		}
+		receipt.Attempts = attempt
+		receipt.Endpoint = w.getEndpoint()
+		if len(receipt.Endpoint) == 0 {
+			err = ErrMissingEndpoint // The webhook was disabled
+			break
+		}
+		if receipt.HTTPStatus, err = w.post(ctx, receipt.Endpoint, jsonData); err == nil {
+			deliveredAt := time.Now().UTC()
+			receipt.DeliveredAt = &deliveredAt
+			break
+		} else if errors.Is(err, ErrBlockedEndpoint) {
+			break // Refused, not retried
+		}
+	}
+
+	if err != nil {
+		receipt.Error = err.Error()
+	}
+	return err
+}
+
+// waitForRetry will wait for the retry delay (or until the context is done)
+func (w *webhookTransport) waitForRetry(ctx context.Context) error {
+	timer := time.NewTimer(w.retryDelay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// post will POST the JSON data to the endpoint (returns the status code, if any)
+func (w *webhookTransport) post(ctx context.Context, endpoint string, jsonData []byte) (int, error) {
+	// Resolved for every request (the address could have changed since the endpoint was set)
+	if err := w.guard.checkEndpoint(ctx, endpoint); err != nil {
+		return 0, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx,
+		http.MethodPost,
+		endpoint,
+		bytes.NewBuffer(jsonData),
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	var response *http.Response
+	if response, err = w.httpClient.Do(req); err != nil {
+		return 0, err
+	}
+	defer func() {
+		_ = response.Body.Close()
+	}()
+
+	if response.StatusCode != http.StatusOK {
+		return response.StatusCode, fmt.Errorf("%w: %d", ErrInvalidResponse, response.StatusCode)
+	}
+
+	return response.StatusCode, nil
 }
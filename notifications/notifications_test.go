@@ -2,10 +2,15 @@ package notifications
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/jarcoal/httpmock"
 	"github.com/stretchr/testify/assert"
@@ -52,7 +57,7 @@ func TestClient_Notify(t *testing.T) {
 		{
 			name: "http call done",
 			options: []ClientOps{
-				WithNotifications(webhookURL),
+				WithNotifications(webhookURL), WithResolver(newStaticResolver(testPublicIP)),
 			},
 			args:      useArgs,
 			wantErr:   assert.NoError,
@@ -69,7 +74,7 @@ func TestClient_Notify(t *testing.T) {
 		{
 			name: "http error",
 			options: []ClientOps{
-				WithNotifications(webhookURL),
+				WithNotifications(webhookURL), WithResolver(newStaticResolver(testPublicIP)),
 			},
 			args:      useArgs,
 			wantErr:   assert.Error,
@@ -87,8 +92,374 @@ func TestClient_Notify(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			c, err := NewClient(tt.options...)
 			require.NoError(t, err)
+			mockHTTP(c)
 			tt.wantErr(t, c.Notify(ctx, tt.args.modelType, tt.args.eventType, tt.args.model, tt.args.id), fmt.Sprintf("Notify(%v, %v, %v, %v, %v)", ctx, tt.args.modelType, tt.args.eventType, tt.args.model, tt.args.id))
 			assert.Equal(t, tt.httpCalls, httpmock.GetTotalCallCount())
 		})
 	}
 }
+
+// failingTransport is a transport that always fails
+type failingTransport struct{}
+
+// Deliver will always fail
+func (f *failingTransport) Deliver(_ context.Context, _ *Event) error {
+	return errors.New("transport failed")
+}
+
+func TestClient_NotifyEvent(t *testing.T) {
+	ctx := context.Background()
+	event := &Event{
+		EventType: EventTypeCreate,
+		ID:        "test-id",
+		Model:     map[string]interface{}{"key": "value"},
+		ModelType: "transaction",
+	}
+
+	t.Run("memory transport", func(t *testing.T) {
+		transport := NewMemoryTransport()
+		c, err := NewClient(WithTransport(transport))
+		require.NoError(t, err)
+
+		require.NoError(t, c.NotifyEvent(ctx, event))
+		require.NoError(t, c.Notify(ctx, "destination", EventTypeUpdate, nil, "other-id"))
+
+		events := transport.Events()
+		require.Len(t, events, 2)
+		assert.Equal(t, event, events[0])
+		assert.Equal(t, EventTypeUpdate, events[1].EventType)
+		assert.Equal(t, "destination", events[1].ModelType)
+		assert.Equal(t, "other-id", events[1].ID)
+
+		transport.Reset()
+		assert.Len(t, transport.Events(), 0)
+	})
+
+	t.Run("failing transport does not stop the others", func(t *testing.T) {
+		first := NewMemoryTransport()
+		last := NewMemoryTransport()
+		c, err := NewClient(WithTransport(first), WithTransport(&failingTransport{}), WithTransport(last))
+		require.NoError(t, err)
+
+		require.Error(t, c.NotifyEvent(ctx, event))
+		assert.Len(t, first.Events(), 1)
+		assert.Len(t, last.Events(), 1)
+	})
+
+	t.Run("multiple failing transports", func(t *testing.T) {
+		c, err := NewClient(WithTransport(&failingTransport{}), WithTransport(&failingTransport{}))
+		require.NoError(t, err)
+		assert.ErrorIs(t, c.NotifyEvent(ctx, event), ErrTransportsFailed)
+	})
+
+	t.Run("webhook and custom transport", func(t *testing.T) {
+		httpmock.Activate()
+		defer httpmock.DeactivateAndReset()
+
+		webhookURL := "https://test.example.com/v1/api-endpoint"
+		httpmock.RegisterResponder(http.MethodPost, webhookURL,
+			httpmock.NewStringResponder(http.StatusInternalServerError, `error`),
+		)
+
+		transport := NewMemoryTransport()
+		c, err := NewClient(
+			WithTransport(transport), WithNotifications(webhookURL), WithResolver(newStaticResolver(testPublicIP)),
+		)
+		require.NoError(t, err)
+		mockHTTP(c)
+		require.Len(t, c.Transports(), 2)
+
+		assert.ErrorIs(t, c.NotifyEvent(ctx, event), ErrInvalidResponse)
+		assert.Equal(t, 1, httpmock.GetTotalCallCount())
+		assert.Len(t, transport.Events(), 1)
+	})
+}
+
+// receiptRecorder keeps the receipts in memory
+type receiptRecorder struct {
+	receipts []*DeliveryReceipt
+}
+
+// RecordDelivery will keep the receipt
+func (r *receiptRecorder) RecordDelivery(_ context.Context, receipt *DeliveryReceipt) error {
+	r.receipts = append(r.receipts, receipt)
+	return nil
+}
+
+// TestNewEventID will test the method NewEventID()
+func TestNewEventID(t *testing.T) {
+	first := NewEventID()
+	time.Sleep(2 * time.Millisecond)
+	second := NewEventID()
+
+	assert.Len(t, first, 26)
+	assert.Regexp(t, "^[0-9A-HJKMNP-TV-Z]{26}$", first)
+	assert.NotEqual(t, first, second)
+	assert.Less(t, first, second) // Sortable by the creation time
+}
+
+// TestWebhookTransport_receipts will test the delivery receipts of the webhook (with retries)
+func TestWebhookTransport_receipts(t *testing.T) {
+	ctx := context.Background()
+
+	// newServer will return a webhook endpoint failing the first requests (status code)
+	newServer := func(t *testing.T, failures, status int) (*httptest.Server, *[]string) {
+		var eventIDs []string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			var event Event
+			_ = json.NewDecoder(req.Body).Decode(&event)
+			eventIDs = append(eventIDs, event.EventID)
+			if len(eventIDs) <= failures {
+				w.WriteHeader(status)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+		}))
+		t.Cleanup(server.Close)
+		return server, &eventIDs
+	}
+
+	t.Run("success", func(t *testing.T) {
+		server, eventIDs := newServer(t, 0, 0)
+		recorder := &receiptRecorder{}
+		c, err := NewClient(WithNotifications(server.URL), WithReceiptRecorder(recorder), WithInsecureEndpoints())
+		require.NoError(t, err)
+
+		require.NoError(t, c.Notify(ctx, "transaction", EventTypeCreate, nil, "test-id"))
+		require.Len(t, recorder.receipts, 1)
+		receipt := recorder.receipts[0]
+		assert.Equal(t, 1, receipt.Attempts)
+		assert.NotNil(t, receipt.DeliveredAt)
+		assert.Equal(t, http.StatusOK, receipt.HTTPStatus)
+		assert.Equal(t, server.URL, receipt.Endpoint)
+		assert.Equal(t, "test-id", receipt.ModelID)
+		assert.Equal(t, "transaction", receipt.ModelType)
+		assert.Equal(t, EventTypeCreate, receipt.EventType)
+		assert.Empty(t, receipt.Error)
+
+		// The receiver gets the same event ID
+		assert.Len(t, receipt.EventID, 26)
+		assert.Equal(t, []string{receipt.EventID}, *eventIDs)
+	})
+
+	t.Run("retry then success", func(t *testing.T) {
+		server, eventIDs := newServer(t, 2, http.StatusServiceUnavailable)
+		recorder := &receiptRecorder{}
+		c, err := NewClient(
+			WithNotifications(server.URL), WithReceiptRecorder(recorder), WithWebhookRetries(3, time.Millisecond),
+			WithInsecureEndpoints(),
+		)
+		require.NoError(t, err)
+
+		require.NoError(t, c.Notify(ctx, "transaction", EventTypeCreate, nil, "test-id"))
+		require.Len(t, recorder.receipts, 1)
+		receipt := recorder.receipts[0]
+		assert.Equal(t, 3, receipt.Attempts)
+		assert.NotNil(t, receipt.DeliveredAt)
+		assert.Equal(t, http.StatusOK, receipt.HTTPStatus)
+
+		// Every attempt has the same event ID
+		require.Len(t, *eventIDs, 3)
+		for _, eventID := range *eventIDs {
+			assert.Equal(t, receipt.EventID, eventID)
+		}
+	})
+
+	t.Run("permanent failure", func(t *testing.T) {
+		server, eventIDs := newServer(t, 10, http.StatusInternalServerError)
+		recorder := &receiptRecorder{}
+		c, err := NewClient(
+			WithNotifications(server.URL), WithReceiptRecorder(recorder), WithWebhookRetries(2, time.Millisecond),
+			WithInsecureEndpoints(),
+		)
+		require.NoError(t, err)
+
+		err = c.Notify(ctx, "transaction", EventTypeCreate, nil, "test-id")
+		require.ErrorIs(t, err, ErrInvalidResponse)
+		require.Len(t, recorder.receipts, 1)
+		receipt := recorder.receipts[0]
+		assert.Equal(t, 2, receipt.Attempts)
+		assert.Nil(t, receipt.DeliveredAt)
+		assert.Equal(t, http.StatusInternalServerError, receipt.HTTPStatus)
+		assert.Equal(t, err.Error(), receipt.Error)
+		assert.Len(t, *eventIDs, 2)
+
+		// The payload is kept (for the redelivery)
+		var event Event
+		require.NoError(t, json.Unmarshal([]byte(receipt.Payload), &event))
+		assert.Equal(t, receipt.EventID, event.EventID)
+	})
+
+	t.Run("redeliver", func(t *testing.T) {
+		server, eventIDs := newServer(t, 2, http.StatusServiceUnavailable)
+		recorder := &receiptRecorder{}
+		c, err := NewClient(
+			WithNotifications(server.URL), WithReceiptRecorder(recorder), WithWebhookRetries(2, time.Millisecond),
+			WithInsecureEndpoints(),
+		)
+		require.NoError(t, err)
+
+		require.ErrorIs(t, c.Notify(ctx, "transaction", EventTypeCreate, nil, "test-id"), ErrInvalidResponse)
+		require.Len(t, recorder.receipts, 1)
+		failed := recorder.receipts[0]
+
+		// The receiver is fixed: a single attempt, not recorded
+		var receipt *DeliveryReceipt
+		receipt, err = c.Redeliver(ctx, []byte(failed.Payload))
+		require.NoError(t, err)
+		assert.Equal(t, 1, receipt.Attempts)
+		assert.NotNil(t, receipt.DeliveredAt)
+		assert.Equal(t, failed.EventID, receipt.EventID)
+		assert.Equal(t, "test-id", receipt.ModelID)
+		assert.Empty(t, receipt.Payload)
+		assert.Len(t, recorder.receipts, 1)
+		assert.Equal(t, []string{failed.EventID, failed.EventID, failed.EventID}, *eventIDs)
+
+		_, err = c.Redeliver(ctx, []byte("not-json"))
+		require.ErrorIs(t, err, ErrInvalidPayload)
+	})
+}
+
+// endpointStore keeps the endpoint changes in memory
+type endpointStore struct {
+	endpoints []string
+	err       error
+}
+
+// SaveWebhookEndpoint will keep the endpoint (or fail)
+func (s *endpointStore) SaveWebhookEndpoint(_ context.Context, endpoint string) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.endpoints = append(s.endpoints, endpoint)
+	return nil
+}
+
+// TestClient_SetWebhookEndpoint will test the method SetWebhookEndpoint()
+func TestClient_SetWebhookEndpoint(t *testing.T) {
+	ctx := context.Background()
+
+	// newServer will return a webhook endpoint (counting the events)
+	newServer := func(t *testing.T, status int) (*httptest.Server, *int32) {
+		var events int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if req.Method == http.MethodPost {
+				atomic.AddInt32(&events, 1)
+			}
+			w.WriteHeader(status)
+		}))
+		t.Cleanup(server.Close)
+		return server, &events
+	}
+
+	t.Run("enable, change and disable", func(t *testing.T) {
+		first, firstEvents := newServer(t, http.StatusOK)
+		second, secondEvents := newServer(t, http.StatusOK)
+		store := &endpointStore{}
+		c, err := NewClient(WithEndpointStore(store), WithInsecureEndpoints())
+		require.NoError(t, err)
+		assert.Empty(t, c.GetWebhookEndpoint())
+		assert.Len(t, c.Transports(), 0)
+
+		require.NoError(t, c.(WebhookEndpointSetter).SetWebhookEndpoint(ctx, first.URL))
+		assert.Equal(t, first.URL, c.GetWebhookEndpoint())
+		assert.Len(t, c.Transports(), 1)
+		require.NoError(t, c.Notify(ctx, "transaction", EventTypeCreate, nil, "test-id"))
+
+		require.NoError(t, c.(WebhookEndpointSetter).SetWebhookEndpoint(ctx, second.URL))
+		require.NoError(t, c.Notify(ctx, "transaction", EventTypeCreate, nil, "test-id"))
+
+		require.NoError(t, c.(WebhookEndpointSetter).SetWebhookEndpoint(ctx, ""))
+		assert.Len(t, c.Transports(), 0)
+		require.NoError(t, c.Notify(ctx, "transaction", EventTypeCreate, nil, "test-id"))
+
+		assert.Equal(t, int32(1), atomic.LoadInt32(firstEvents))
+		assert.Equal(t, int32(1), atomic.LoadInt32(secondEvents))
+		assert.Equal(t, []string{first.URL, second.URL, ""}, store.endpoints)
+	})
+
+	t.Run("invalid endpoint", func(t *testing.T) {
+		c, err := NewClient(WithNotifications("https://test.example.com/v1/api-endpoint"))
+		require.NoError(t, err)
+		for _, endpoint := range []string{"test.example.com", "ftp://test.example.com", "https://", "://bad"} {
+			assert.ErrorIs(t, c.(WebhookEndpointSetter).SetWebhookEndpoint(ctx, endpoint), ErrInvalidEndpoint, endpoint)
+		}
+		assert.Equal(t, "https://test.example.com/v1/api-endpoint", c.GetWebhookEndpoint())
+	})
+
+	t.Run("validation ping", func(t *testing.T) {
+		failing, _ := newServer(t, http.StatusBadGateway)
+		reachable, _ := newServer(t, http.StatusMethodNotAllowed)
+		store := &endpointStore{}
+		c, err := NewClient(WithEndpointValidation(), WithEndpointStore(store), WithInsecureEndpoints())
+		require.NoError(t, err)
+
+		assert.ErrorIs(t, c.(WebhookEndpointSetter).SetWebhookEndpoint(ctx, failing.URL), ErrInvalidEndpoint)
+		assert.Empty(t, c.GetWebhookEndpoint())
+		assert.Empty(t, store.endpoints)
+
+		require.NoError(t, c.(WebhookEndpointSetter).SetWebhookEndpoint(ctx, reachable.URL))
+		assert.Equal(t, reachable.URL, c.GetWebhookEndpoint())
+
+		// Without the validation, the endpoint is not pinged
+		c, err = NewClient(WithInsecureEndpoints())
+		require.NoError(t, err)
+		require.NoError(t, c.(WebhookEndpointSetter).SetWebhookEndpoint(ctx, failing.URL))
+	})
+
+	t.Run("failing store keeps the endpoint", func(t *testing.T) {
+		c, err := NewClient(
+			WithNotifications("https://test.example.com/v1/api-endpoint"),
+			WithEndpointStore(&endpointStore{err: errors.New("store failed")}),
+		)
+		require.NoError(t, err)
+		require.Error(t, c.(WebhookEndpointSetter).SetWebhookEndpoint(ctx, "https://other.example.com"))
+		assert.Equal(t, "https://test.example.com/v1/api-endpoint", c.GetWebhookEndpoint())
+	})
+
+	t.Run("the retries are redirected", func(t *testing.T) {
+		second, secondEvents := newServer(t, http.StatusOK)
+		recorder := &receiptRecorder{}
+		var c ClientInterface
+		first := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			_ = c.(WebhookEndpointSetter).SetWebhookEndpoint(req.Context(), second.URL) // Changed while the event is queued for a retry
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		t.Cleanup(first.Close)
+
+		var err error
+		c, err = NewClient(
+			WithNotifications(first.URL), WithReceiptRecorder(recorder), WithWebhookRetries(2, time.Millisecond),
+			WithInsecureEndpoints(),
+		)
+		require.NoError(t, err)
+
+		require.NoError(t, c.Notify(ctx, "transaction", EventTypeCreate, nil, "test-id"))
+		assert.Equal(t, int32(1), atomic.LoadInt32(secondEvents))
+		require.Len(t, recorder.receipts, 1)
+		assert.Equal(t, 2, recorder.receipts[0].Attempts)
+		assert.Equal(t, second.URL, recorder.receipts[0].Endpoint)
+		assert.NotNil(t, recorder.receipts[0].DeliveredAt)
+	})
+
+	t.Run("concurrent changes and deliveries", func(t *testing.T) {
+		server, events := newServer(t, http.StatusOK)
+		c, err := NewClient(WithNotifications(server.URL), WithInsecureEndpoints())
+		require.NoError(t, err)
+
+		var wg sync.WaitGroup
+		for index := 0; index < 10; index++ {
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				assert.NoError(t, c.(WebhookEndpointSetter).SetWebhookEndpoint(ctx, server.URL))
+			}()
+			go func() {
+				defer wg.Done()
+				assert.NoError(t, c.Notify(ctx, "transaction", EventTypeCreate, nil, "test-id"))
+			}()
+		}
+		wg.Wait()
+		assert.Equal(t, int32(10), atomic.LoadInt32(events))
+	})
+}
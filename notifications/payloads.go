@@ -0,0 +1,95 @@
+package notifications
+
+import (
+	"time"
+)
+
+// SchemaVersion is the version of the event payload (the "model" of the event)
+type SchemaVersion string
+
+const (
+	// SchemaVersionLegacy is the raw (internal) model, the payload changes when the models change
+	SchemaVersionLegacy SchemaVersion = "legacy"
+
+	// SchemaVersionV1 is the versioned v1 payload (TransactionEventV1, DestinationEventV1, DraftEventV1,
+	// IncomingTransactionRejectedEventV1, BalanceThresholdEventV1 or SyncStatusEventV1)
+	SchemaVersionV1 SchemaVersion = "v1"
+
+	// SchemaVersionUnknown is a raw model delivered without a versioned payload (no mapping for the model)
+	SchemaVersionUnknown SchemaVersion = "unknown"
+)
+
+// BalanceThresholdEventV1 is the payload of the balance threshold event
+// (the same payload is used for the legacy schema version, there is no model)
+type BalanceThresholdEventV1 struct {
+	Balance   uint64 `json:"balance"`         // Balance at the crossing (satoshis)
+	Direction string `json:"direction"`       // Direction of the crossing (down, up)
+	Threshold uint64 `json:"threshold"`       // The crossed threshold (satoshis)
+	TxID      string `json:"tx_id,omitempty"` // Transaction that changed the balance
+	XpubID    string `json:"xpub_id"`         // Owner of the balance
+}
+
+// DestinationEventV1 is the v1 payload for the destination events (create, update, delete, revoked destination payment)
+type DestinationEventV1 struct {
+	Address       string                 `json:"address"`              // Address of the destination
+	Chain         uint32                 `json:"chain"`                // Derivation chain (internal/external)
+	CreatedAt     time.Time              `json:"created_at"`           // When the destination was created
+	DraftID       string                 `json:"draft_id,omitempty"`   // Related draft (change destinations)
+	ID            string                 `json:"id"`                   // Hash of the locking script
+	LockingScript string                 `json:"locking_script"`       // Locking script (hex)
+	Metadata      map[string]interface{} `json:"metadata,omitempty"`   // Metadata of the destination
+	Num           uint32                 `json:"num"`                  // Derivation number
+	RevokedAt     *time.Time             `json:"revoked_at,omitempty"` // When the destination was revoked
+	Type          string                 `json:"type"`                 // Script type
+	UpdatedAt     time.Time              `json:"updated_at"`           // When the destination was last updated
+	XpubID        string                 `json:"xpub_id"`              // Owner of the destination
+}
+
+// DraftEventV1 is the v1 payload for the draft transaction events (expiring soon, expired)
+type DraftEventV1 struct {
+	ExpiresAt        time.Time `json:"expires_at"`        // When the draft expires
+	ID               string    `json:"id"`                // Draft ID
+	ReservedSatoshis uint64    `json:"reserved_satoshis"` // Value of the utxos reserved by the draft
+	Status           string    `json:"status"`            // Status of the draft
+	XpubID           string    `json:"xpub_id"`           // Owner of the draft
+}
+
+// IncomingTransactionRejectedEventV1 is the payload of the incoming transaction rejected event
+// (the same payload is used for the legacy schema version, there is no model)
+type IncomingTransactionRejectedEventV1 struct {
+	Reason string `json:"reason"`          // The exceeded limit
+	Size   int    `json:"size"`            // Size of the transaction (bytes)
+	Source string `json:"source"`          // Where the transaction came from (paymail, monitor)
+	TxID   string `json:"tx_id,omitempty"` // ID of the transaction (empty if it was not parsed)
+}
+
+// SyncStatusEventV1 is the v1 payload for the sync transaction events (broadcast, double spend)
+type SyncStatusEventV1 struct {
+	BroadcastStatus  string     `json:"broadcast_status"`            // Status of the broadcast
+	ID               string     `json:"id"`                          // Transaction ID
+	LastAttempt      *time.Time `json:"last_attempt,omitempty"`      // When the last broadcast was attempted
+	P2PStatus        string     `json:"p2p_status"`                  // Status of the P2P notification
+	RejectionMessage string     `json:"rejection_message,omitempty"` // Provider message if the broadcast was rejected
+	RejectionReason  string     `json:"rejection_reason,omitempty"`  // Normalized reason if the broadcast was rejected
+	SyncStatus       string     `json:"sync_status"`                 // Status of the sync (merkle proof)
+	UpdatedAt        time.Time  `json:"updated_at"`                  // When the status last changed
+}
+
+// TransactionEventV1 is the v1 payload for the transaction events (create, update, delete)
+type TransactionEventV1 struct {
+	BlockHash       string                 `json:"block_hash,omitempty"`        // Block hash (if mined)
+	BlockHeight     uint64                 `json:"block_height,omitempty"`      // Block height (if mined)
+	CreatedAt       time.Time              `json:"created_at"`                  // When the transaction was recorded
+	DraftID         string                 `json:"draft_id,omitempty"`          // Related draft (outgoing transactions)
+	Fee             uint64                 `json:"fee"`                         // Fee paid (satoshis)
+	ID              string                 `json:"id"`                          // Transaction ID
+	Metadata        map[string]interface{} `json:"metadata,omitempty"`          // Metadata of the transaction
+	Note            string                 `json:"note,omitempty"`              // Latest note of the xPub (only if enabled)
+	NumberOfInputs  uint32                 `json:"number_of_inputs"`            // Number of inputs
+	NumberOfOutputs uint32                 `json:"number_of_outputs"`           // Number of outputs
+	TotalValue      uint64                 `json:"total_value"`                 // Total value (satoshis)
+	UpdatedAt       time.Time              `json:"updated_at"`                  // When the transaction was last updated
+	XpubInIDs       []string               `json:"xpub_in_ids"`                 // xPubs spending in the transaction
+	XpubOutIDs      []string               `json:"xpub_out_ids"`                // xPubs receiving in the transaction
+	XpubOutputValue map[string]int64       `json:"xpub_output_value,omitempty"` // Value (satoshis) per xPub
+}
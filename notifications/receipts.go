@@ -0,0 +1,25 @@
+package notifications
+
+import (
+	"context"
+	"time"
+)
+
+// DeliveryReceipt is the result of delivering an event to an endpoint (after all the attempts)
+type DeliveryReceipt struct {
+	Attempts    int        `json:"attempts"`               // Number of attempts (1 = no retries)
+	DeliveredAt *time.Time `json:"delivered_at,omitempty"` // When the event was delivered (nil = failed)
+	Endpoint    string     `json:"endpoint"`               // Where the event was delivered
+	Error       string     `json:"error,omitempty"`        // Error of the last attempt (failed)
+	EventID     string     `json:"event_id"`               // Stable ID of the event (ULID)
+	EventType   EventType  `json:"event_type"`             // Type of the event
+	HTTPStatus  int        `json:"http_status,omitempty"`  // Status code of the last attempt (0 = no response)
+	ModelID     string     `json:"model_id"`               // ID of the model of the event
+	ModelType   string     `json:"model_type"`             // Type of the model of the event
+	Payload     string     `json:"payload,omitempty"`      // The delivered JSON (failed, see Client.Redeliver)
+}
+
+// ReceiptRecorder keeps the delivery receipts (IE: persisted by bux)
+type ReceiptRecorder interface {
+	RecordDelivery(ctx context.Context, receipt *DeliveryReceipt) error
+}
@@ -0,0 +1,56 @@
+package notifications
+
+import (
+	"context"
+	"sync"
+)
+
+// Event is a notification event (transports choose their own encoding)
+type Event struct {
+	EventID       string        `json:"event_id"` // Stable ID of the event (ULID), the same for every transport and retry
+	EventType     EventType     `json:"event_type"`
+	ID            string        `json:"id"`
+	Model         interface{}   `json:"model"`
+	ModelType     string        `json:"model_type"`
+	SchemaVersion SchemaVersion `json:"schema_version"` // Version of the model payload (see SchemaVersionV1)
+}
+
+// Transport delivers the notification events (webhook, message bus, etc.)
+type Transport interface {
+	Deliver(ctx context.Context, event *Event) error
+}
+
+// MemoryTransport keeps the delivered events in memory (useful for testing)
+type MemoryTransport struct {
+	events []*Event
+	mu     sync.RWMutex
+}
+
+// NewMemoryTransport will return a new in-memory transport
+func NewMemoryTransport() *MemoryTransport {
+	return &MemoryTransport{events: make([]*Event, 0)}
+}
+
+// Deliver will store the event in memory
+func (m *MemoryTransport) Deliver(_ context.Context, event *Event) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.events = append(m.events, event)
+	return nil
+}
+
+// Events will return a copy of the delivered events
+func (m *MemoryTransport) Events() []*Event {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	events := make([]*Event, len(m.events))
+	copy(events, m.events)
+	return events
+}
+
+// Reset will remove all the delivered events
+func (m *MemoryTransport) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.events = make([]*Event, 0)
+}
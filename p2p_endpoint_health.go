@@ -0,0 +1,122 @@
+package bux
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/mrz1836/go-cachestore"
+)
+
+// p2pEndpointHealth is the cached failure memory of a P2P receive endpoint (by host)
+type p2pEndpointHealth struct {
+	Failures    uint32    `json:"failures"`     // Consecutive failed deliveries
+	LastFailure time.Time `json:"last_failure"` // Time of the last failed delivery
+}
+
+// p2pEndpointBackoff will return the backoff after the consecutive failures (doubled on each failure, up to the max)
+func p2pEndpointBackoff(failures uint32) time.Duration {
+	backoff := defaultP2PBackoffBase
+	for i := uint32(1); i < failures && backoff < defaultP2PBackoffMax; i++ {
+		backoff *= 2
+	}
+	if backoff > defaultP2PBackoffMax {
+		return defaultP2PBackoffMax
+	}
+	return backoff
+}
+
+// getP2PEndpointHealth will return the failure memory of the endpoint (nil if the endpoint did not fail)
+func getP2PEndpointHealth(ctx context.Context, client ClientInterface, endpoint string) (*p2pEndpointHealth, error) {
+	cs := client.Cachestore()
+	if cs == nil || cs.Engine().IsEmpty() {
+		return nil, nil
+	}
+
+	health := new(p2pEndpointHealth)
+	if err := cs.GetModel(ctx, cacheKeyP2PEndpointHealth+paymailBackoffProvider(endpoint), health); err != nil {
+		if errors.Is(err, cachestore.ErrKeyNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return health, nil
+}
+
+// recordP2PEndpointFailure will remember the failed delivery and back off the endpoint (escalating on each failure)
+//
+// The backoff is shared with the rate limited providers, the endpoint is skipped until it expires
+func recordP2PEndpointFailure(ctx context.Context, client ClientInterface, endpoint string) {
+	if client == nil {
+		return
+	}
+
+	health, err := getP2PEndpointHealth(ctx, client, endpoint)
+	if err != nil {
+		client.Logger().Error(ctx, "failed getting the health of p2p endpoint "+endpoint+": "+err.Error())
+		return
+	} else if health == nil {
+		if cs := client.Cachestore(); cs == nil || cs.Engine().IsEmpty() {
+			return
+		}
+		health = new(p2pEndpointHealth)
+	}
+	health.Failures++
+	health.LastFailure = time.Now().UTC()
+
+	backoff := p2pEndpointBackoff(health.Failures)
+	if err = client.Cachestore().SetModel(
+		ctx, cacheKeyP2PEndpointHealth+paymailBackoffProvider(endpoint), health, defaultP2PBackoffMax+backoff,
+	); err != nil {
+		client.Logger().Error(ctx, "failed saving the health of p2p endpoint "+endpoint+": "+err.Error())
+	}
+	setPaymailBackoff(ctx, client, endpoint, time.Now().Add(backoff))
+}
+
+// recordP2PEndpointSuccess will forget the failures of the endpoint and clear the backoff (recovered endpoint)
+func recordP2PEndpointSuccess(ctx context.Context, client ClientInterface, endpoint string) {
+	if client == nil {
+		return
+	}
+	cs := client.Cachestore()
+	if cs == nil || cs.Engine().IsEmpty() {
+		return
+	}
+
+	if health, err := getP2PEndpointHealth(ctx, client, endpoint); err != nil || health == nil {
+		return
+	}
+	for _, key := range []string{
+		cacheKeyP2PEndpointHealth + paymailBackoffProvider(endpoint),
+		cacheKeyProviderBackoff + paymailBackoffProvider(endpoint),
+	} {
+		if err := cs.Delete(ctx, key); err != nil {
+			client.Logger().Error(ctx, "failed clearing the health of p2p endpoint "+endpoint+": "+err.Error())
+		}
+	}
+}
+
+// p2pEndpointsInBackoff will return true if the P2P notification of the transaction can not be delivered now
+// (all the receive endpoints of a paymail output or target are backing off)
+func p2pEndpointsInBackoff(ctx context.Context, syncTx *SyncTransaction, transaction *Transaction) (bool, error) {
+	targets, err := getP2PTargets(ctx, syncTx, transaction)
+	if errors.Is(err, ErrDraftNotFound) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	for _, target := range targets {
+		available := false
+		for _, endpoint := range target.getReceiveEndpoints() {
+			if getPaymailBackoff(ctx, transaction.client, endpoint.URL).IsZero() {
+				available = true
+				break
+			}
+		}
+		if !available {
+			return true, nil
+		}
+	}
+	return false, nil
+}
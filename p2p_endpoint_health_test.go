@@ -0,0 +1,336 @@
+package bux
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/jarcoal/httpmock"
+	"github.com/mrz1836/go-datastore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test_p2pEndpointBackoff will test the escalating backoff of the failing endpoints
+func Test_p2pEndpointBackoff(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, defaultP2PBackoffBase, p2pEndpointBackoff(0))
+	assert.Equal(t, defaultP2PBackoffBase, p2pEndpointBackoff(1))
+	assert.Equal(t, 2*defaultP2PBackoffBase, p2pEndpointBackoff(2))
+	assert.Equal(t, 4*defaultP2PBackoffBase, p2pEndpointBackoff(3))
+	assert.Equal(t, defaultP2PBackoffMax, p2pEndpointBackoff(100))
+}
+
+// Test_finalizeP2PTransaction_endpointHealth will test the failure memory of the receive endpoints
+func Test_finalizeP2PTransaction_endpointHealth(t *testing.T) {
+	// t.Parallel() mocking does not allow parallel tests
+
+	ctx, client, deferMe := CreateTestSQLiteClient(t, false, false, WithCustomTaskManager(&taskManagerMockBase{}))
+	defer deferMe()
+
+	endpoint := testServerURL + "/receive-transaction/{alias}@{domain.tld}"
+	p4 := &PaymailP4{
+		Alias:           testAlias,
+		Domain:          testDomain,
+		ReceiveEndpoint: endpoint,
+		ReferenceID:     "z0bac4ec-6f15-42de-9ef4-e60bfdabf4f7",
+	}
+	transaction := &Transaction{
+		TransactionBase: TransactionBase{Hex: testTxHex},
+		Model:           *NewBaseModel(ModelTransaction, client.DefaultModelOptions()...),
+	}
+	pm := newTestPaymailClient(t, []string{testDomain})
+
+	httpmock.Reset()
+	httpmock.RegisterResponder(http.MethodPost, testServerURL+"/receive-transaction/"+testAlias+"@"+testDomain,
+		httpmock.NewStringResponder(http.StatusInternalServerError, `{"message": "down"}`),
+	)
+
+	// Failed: the endpoint is backing off
+	_, _, err := finalizeP2PTransaction(ctx, pm, p4, transaction)
+	require.Error(t, err)
+	assert.NotErrorIs(t, err, ErrPaymailProviderInBackoff)
+
+	var health *p2pEndpointHealth
+	health, err = getP2PEndpointHealth(ctx, client, endpoint)
+	require.NoError(t, err)
+	require.NotNil(t, health)
+	assert.Equal(t, uint32(1), health.Failures)
+	assert.WithinDuration(t, time.Now().Add(defaultP2PBackoffBase), getPaymailBackoff(ctx, client, endpoint), 5*time.Second)
+
+	// Backing off: nothing is attempted
+	calls := httpmock.GetTotalCallCount()
+	_, _, err = finalizeP2PTransaction(ctx, pm, p4, transaction)
+	require.ErrorIs(t, err, ErrPaymailProviderInBackoff)
+	assert.Equal(t, calls, httpmock.GetTotalCallCount())
+
+	// The next failure escalates the backoff
+	require.NoError(t, client.Cachestore().Delete(ctx, cacheKeyProviderBackoff+paymailBackoffProvider(endpoint)))
+	_, _, err = finalizeP2PTransaction(ctx, pm, p4, transaction)
+	require.Error(t, err)
+	health, err = getP2PEndpointHealth(ctx, client, endpoint)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(2), health.Failures)
+	assert.WithinDuration(t, time.Now().Add(2*defaultP2PBackoffBase), getPaymailBackoff(ctx, client, endpoint), 5*time.Second)
+
+	// Recovered (delivered for another record): the failures and the backoff are cleared
+	recordP2PEndpointSuccess(ctx, client, endpoint)
+	health, err = getP2PEndpointHealth(ctx, client, endpoint)
+	require.NoError(t, err)
+	assert.Nil(t, health)
+	assert.True(t, getPaymailBackoff(ctx, client, endpoint).IsZero())
+
+	httpmock.Reset()
+	httpmock.RegisterResponder(http.MethodPost, testServerURL+"/receive-transaction/"+testAlias+"@"+testDomain,
+		httpmock.NewStringResponder(http.StatusOK, `{"txid": "`+testTxID+`", "note": "thanks"}`),
+	)
+	payload, _, err := finalizeP2PTransaction(ctx, pm, p4, transaction)
+	require.NoError(t, err)
+	assert.Equal(t, testTxID, payload.TxID)
+}
+
+// Test_processP2PTransaction_failureLimit will test failing the P2P after too many failed notifications
+func Test_processP2PTransaction_failureLimit(t *testing.T) {
+	t.Parallel()
+
+	ctx, client, deferMe := CreateTestSQLiteClient(t, false, true,
+		WithCustomTaskManager(&taskManagerMockBase{}), WithPaymailP2PFailureLimit(2),
+	)
+	defer deferMe()
+
+	syncTx := newSyncTransaction(testTxID, &SyncConfig{PaymailP2P: true}, append(client.DefaultModelOptions(), New())...)
+	require.NoError(t, syncTx.Save(ctx))
+
+	// The draft is missing, the notification always fails
+	transaction := &Transaction{
+		DraftID:         "missing-draft",
+		Model:           *NewBaseModel(ModelTransaction, client.DefaultModelOptions()...),
+		TransactionBase: TransactionBase{Hex: testTxHex, ID: testTxID},
+	}
+
+	require.Error(t, processP2PTransaction(ctx, syncTx, transaction))
+	got, err := GetSyncTransactionByID(ctx, testTxID, client.DefaultModelOptions()...)
+	require.NoError(t, err)
+	assert.Equal(t, SyncStatusReady, got.P2PStatus)
+	assert.Equal(t, uint32(1), got.P2PFailures)
+
+	require.Error(t, processP2PTransaction(ctx, got, transaction))
+	got, err = GetSyncTransactionByID(ctx, testTxID, client.DefaultModelOptions()...)
+	require.NoError(t, err)
+	assert.Equal(t, SyncStatusError, got.P2PStatus)
+	assert.Equal(t, uint32(2), got.P2PFailures)
+	assert.Contains(t, got.Results.LastMessage, "p2p failed after 2 attempts")
+}
+
+// Test_finalizeP2PTransaction_payloadTooLarge will test detecting the payloads too large for the receiver
+func Test_finalizeP2PTransaction_payloadTooLarge(t *testing.T) {
+	// t.Parallel() mocking does not allow parallel tests
+
+	endpoint := testServerURL + "/receive-transaction/{alias}@{domain.tld}"
+	p4 := &PaymailP4{
+		Alias:           testAlias,
+		Domain:          testDomain,
+		ReceiveEndpoint: endpoint,
+		ReferenceID:     "z0bac4ec-6f15-42de-9ef4-e60bfdabf4f7",
+	}
+	pm := newTestPaymailClient(t, []string{testDomain})
+
+	t.Run("413 response", func(t *testing.T) {
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, false, WithCustomTaskManager(&taskManagerMockBase{}))
+		defer deferMe()
+
+		transaction := &Transaction{
+			TransactionBase: TransactionBase{Hex: testTxHex},
+			Model:           *NewBaseModel(ModelTransaction, client.DefaultModelOptions()...),
+		}
+
+		httpmock.Reset()
+		httpmock.RegisterResponder(http.MethodPost, testServerURL+"/receive-transaction/"+testAlias+"@"+testDomain,
+			httpmock.NewStringResponder(http.StatusRequestEntityTooLarge, `<html>413 Request Entity Too Large</html>`),
+		)
+
+		_, results, err := finalizeP2PTransaction(ctx, pm, p4, transaction)
+		require.ErrorIs(t, err, ErrP2PPayloadTooLarge)
+		require.Len(t, results, 1)
+		assert.Equal(t, P2PStrategyPayload, results[0].P2PStrategy)
+
+		// Not a failure of the endpoint
+		var health *p2pEndpointHealth
+		health, err = getP2PEndpointHealth(ctx, client, endpoint)
+		require.NoError(t, err)
+		assert.Nil(t, health)
+		assert.True(t, getPaymailBackoff(ctx, client, endpoint).IsZero())
+	})
+
+	t.Run("max payload size", func(t *testing.T) {
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, false,
+			WithCustomTaskManager(&taskManagerMockBase{}), WithPaymailP2PMaxPayloadSize(len(testTxHex)-1),
+		)
+		defer deferMe()
+
+		transaction := &Transaction{
+			TransactionBase: TransactionBase{Hex: testTxHex},
+			Model:           *NewBaseModel(ModelTransaction, client.DefaultModelOptions()...),
+		}
+
+		httpmock.Reset()
+		_, _, err := finalizeP2PTransaction(ctx, pm, p4, transaction)
+		require.ErrorIs(t, err, ErrP2PPayloadTooLarge)
+		assert.Equal(t, 0, httpmock.GetTotalCallCount()) // Nothing was sent
+	})
+}
+
+// Test_processP2PTransaction_payloadTooLarge will test deferring the P2P on-chain when the payload is too large
+func Test_processP2PTransaction_payloadTooLarge(t *testing.T) {
+	// t.Parallel() mocking does not allow parallel tests
+
+	ctx, client, deferMe := CreateTestSQLiteClient(t, false, true,
+		WithCustomTaskManager(&taskManagerMockBase{}), WithPaymailClient(newTestPaymailClient(t, []string{testDomain})),
+	)
+	defer deferMe()
+
+	// Saved as-is (the draft hooks would resolve the outputs)
+	draft := newDraftTransaction(testXPub, &TransactionConfig{
+		Outputs: []*TransactionOutput{{
+			To:       testAlias + "@" + testDomain,
+			Satoshis: 1000,
+			PaymailP4: &PaymailP4{
+				Alias:           testAlias,
+				Domain:          testDomain,
+				ReceiveEndpoint: testServerURL + "/receive-transaction/{alias}@{domain.tld}",
+				ReferenceID:     "z0bac4ec-6f15-42de-9ef4-e60bfdabf4f7",
+				ResolutionType:  ResolutionTypeP2P,
+			},
+		}},
+	}, client.DefaultModelOptions()...)
+	ds := client.Datastore()
+	require.NoError(t, ds.NewTx(ctx, func(tx *datastore.Transaction) error {
+		if err := ds.SaveModel(ctx, draft, tx, true, false); err != nil {
+			return err
+		}
+		return tx.Commit()
+	}))
+
+	syncTx := newSyncTransaction(testTxID, &SyncConfig{PaymailP2P: true}, append(client.DefaultModelOptions(), New())...)
+	syncTx.P2PStatus = SyncStatusReady // Broadcast
+	syncTx.SyncStatus = SyncStatusReady
+	require.NoError(t, syncTx.Save(ctx))
+
+	transaction := &Transaction{
+		DraftID:         draft.ID,
+		Model:           *NewBaseModel(ModelTransaction, client.DefaultModelOptions()...),
+		TransactionBase: TransactionBase{Hex: testTxHex, ID: testTxID},
+		XPubID:          draft.XpubID,
+	}
+
+	httpmock.Reset()
+	httpmock.RegisterResponder(http.MethodPost, testServerURL+"/receive-transaction/"+testAlias+"@"+testDomain,
+		httpmock.NewStringResponder(http.StatusRequestEntityTooLarge, `{"message": "payload too large"}`),
+	)
+
+	// Not on-chain yet: deferred (the record stays ready)
+	require.NoError(t, processP2PTransaction(ctx, syncTx, transaction))
+	got, err := GetSyncTransactionByID(ctx, testTxID, client.DefaultModelOptions()...)
+	require.NoError(t, err)
+	assert.Equal(t, SyncStatusReady, got.P2PStatus)
+	assert.Equal(t, uint32(0), got.P2PFailures)
+	assert.Equal(t, P2PStrategyOnChain, got.Results.LastForAction(syncActionP2P).P2PStrategy)
+	calls := httpmock.GetTotalCallCount()
+	assert.Positive(t, calls)
+
+	// Still not on-chain: the payload is not sent again
+	require.NoError(t, processP2PTransaction(ctx, got, transaction))
+	assert.Equal(t, calls, httpmock.GetTotalCallCount())
+
+	// Synced: the receiver fetches the transaction on-chain
+	got, err = GetSyncTransactionByID(ctx, testTxID, client.DefaultModelOptions()...)
+	require.NoError(t, err)
+	got.SyncStatus = SyncStatusComplete
+	require.NoError(t, processP2PTransaction(ctx, got, transaction))
+	assert.Equal(t, calls, httpmock.GetTotalCallCount())
+
+	got, err = GetSyncTransactionByID(ctx, testTxID, client.DefaultModelOptions()...)
+	require.NoError(t, err)
+	assert.Equal(t, SyncStatusComplete, got.P2PStatus)
+	last := got.Results.LastForAction(syncActionP2P)
+	assert.Equal(t, P2PStrategyOnChain, last.P2PStrategy)
+	assert.Contains(t, last.StatusMessage, "success")
+}
+
+// Test_processP2PTransactions will test processing the ready records (keyset pages, up to the max)
+func Test_processP2PTransactions(t *testing.T) {
+	t.Parallel()
+
+	ctx, client, deferMe := CreateTestSQLiteClient(t, false, true, WithCustomTaskManager(&taskManagerMockBase{}))
+	defer deferMe()
+
+	// No draft and no P2P targets: the records are completed (nobody to notify)
+	fixtures := NewFixtures(t, client).WithXpub(0).WithUtxos(1000).WithUtxos(2000).WithUtxos(3000)
+	require.Len(t, fixtures.Transactions, 3)
+	for _, transaction := range fixtures.Transactions {
+		syncTx := newSyncTransaction(
+			transaction.ID, &SyncConfig{PaymailP2P: true}, append(client.DefaultModelOptions(), New())...,
+		)
+		syncTx.P2PStatus = SyncStatusReady
+		require.NoError(t, syncTx.Save(ctx))
+	}
+
+	// A record without the transaction is skipped
+	orphan := newSyncTransaction(testTxID, &SyncConfig{PaymailP2P: true}, append(client.DefaultModelOptions(), New())...)
+	orphan.P2PStatus = SyncStatusReady
+	require.NoError(t, orphan.Save(ctx))
+
+	p2pStatuses := func() (ready, complete int) {
+		for _, transaction := range fixtures.Transactions {
+			syncTx, err := GetSyncTransactionByID(ctx, transaction.ID, client.DefaultModelOptions()...)
+			require.NoError(t, err)
+			if syncTx.P2PStatus == SyncStatusReady {
+				ready++
+			} else if syncTx.P2PStatus == SyncStatusComplete {
+				complete++
+			}
+		}
+		return
+	}
+
+	require.NoError(t, processP2PTransactions(ctx, 2, client.DefaultModelOptions()...))
+	ready, complete := p2pStatuses()
+	assert.Equal(t, 1, ready)
+	assert.Equal(t, 2, complete)
+
+	require.NoError(t, processP2PTransactions(ctx, 2, client.DefaultModelOptions()...))
+	ready, complete = p2pStatuses()
+	assert.Equal(t, 0, ready)
+	assert.Equal(t, 3, complete)
+
+	syncTx, err := GetSyncTransactionByID(ctx, testTxID, client.DefaultModelOptions()...)
+	require.NoError(t, err)
+	assert.Equal(t, SyncStatusReady, syncTx.P2PStatus)
+}
+
+// Test_readyP2PWithoutBroadcast will test the pending p2p of the skipped broadcasts is made ready
+func Test_readyP2PWithoutBroadcast(t *testing.T) {
+	t.Parallel()
+
+	ctx, client, deferMe := CreateTestSQLiteClient(t, false, true, WithCustomTaskManager(&taskManagerMockBase{}))
+	defer deferMe()
+
+	skipped := newSyncTransaction(testTxID, &SyncConfig{PaymailP2P: true}, append(client.DefaultModelOptions(), New())...)
+	skipped.P2PStatus = SyncStatusPending // Recorded before the p2p was made ready without a broadcast
+	require.NoError(t, skipped.Save(ctx))
+
+	waiting := newSyncTransaction(testTxID2, &SyncConfig{Broadcast: true, PaymailP2P: true},
+		append(client.DefaultModelOptions(), New())...)
+	require.NoError(t, waiting.Save(ctx))
+
+	require.NoError(t, readyP2PWithoutBroadcast(ctx, 10, client.DefaultModelOptions()...))
+
+	syncTx, err := GetSyncTransactionByID(ctx, testTxID, client.DefaultModelOptions()...)
+	require.NoError(t, err)
+	assert.Equal(t, SyncStatusReady, syncTx.P2PStatus)
+
+	syncTx, err = GetSyncTransactionByID(ctx, testTxID2, client.DefaultModelOptions()...)
+	require.NoError(t, err)
+	assert.Equal(t, SyncStatusPending, syncTx.P2PStatus)
+}
@@ -0,0 +1,81 @@
+package bux
+
+import (
+	"github.com/mrz1836/go-datastore"
+)
+
+// PagedResult is a page of records with the total count of records matching the conditions
+type PagedResult[T any] struct {
+	Items      []T   `json:"items" toml:"items" yaml:"items" bson:"items"`                         // Records on this page
+	Page       int   `json:"page" toml:"page" yaml:"page" bson:"page"`                             // Current page (starts at 1)
+	PageSize   int   `json:"page_size" toml:"page_size" yaml:"page_size" bson:"page_size"`         // Records per page (0 = all records)
+	TotalCount int64 `json:"total_count" toml:"total_count" yaml:"total_count" bson:"total_count"` // Total records matching the conditions
+	TotalPages int   `json:"total_pages" toml:"total_pages" yaml:"total_pages" bson:"total_pages"` // Total pages for the page size
+}
+
+// newPagedResult will create a new paged result from the items, query params and total count
+func newPagedResult[T any](items []T, queryParams *datastore.QueryParams, totalCount int64) *PagedResult[T] {
+	result := &PagedResult[T]{
+		Items:      items,
+		Page:       1,
+		TotalCount: totalCount,
+	}
+	if result.Items == nil {
+		result.Items = make([]T, 0)
+	}
+
+	if queryParams != nil {
+		if queryParams.Page > 1 {
+			result.Page = queryParams.Page
+		}
+		if queryParams.PageSize > 0 {
+			result.PageSize = queryParams.PageSize
+		}
+	}
+
+	// No page size means all records are on a single page
+	if totalCount > 0 {
+		if result.PageSize > 0 {
+			result.TotalPages = int((totalCount + int64(result.PageSize) - 1) / int64(result.PageSize))
+		} else {
+			result.TotalPages = 1
+		}
+	}
+
+	return result
+}
+
+// getPagedResult will run the data query and the count query using identical conditions
+//
+// Each query gets its own copy of the conditions (the datastore may modify the conditions map)
+func getPagedResult[T any](conditions *map[string]interface{}, queryParams *datastore.QueryParams,
+	getItems func(conditions *map[string]interface{}) ([]T, error),
+	getCount func(conditions *map[string]interface{}) (int64, error),
+) (*PagedResult[T], error) {
+
+	// Get the records for the page
+	items, err := getItems(copyConditions(conditions))
+	if err != nil {
+		return nil, err
+	}
+
+	// Get the total count
+	var totalCount int64
+	if totalCount, err = getCount(copyConditions(conditions)); err != nil {
+		return nil, err
+	}
+
+	return newPagedResult(items, queryParams, totalCount), nil
+}
+
+// copyConditions will return a shallow copy of the conditions
+func copyConditions(conditions *map[string]interface{}) *map[string]interface{} {
+	if conditions == nil {
+		return nil
+	}
+	dbConditions := make(map[string]interface{}, len(*conditions))
+	for key, value := range *conditions {
+		dbConditions[key] = value
+	}
+	return &dbConditions
+}
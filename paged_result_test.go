@@ -0,0 +1,91 @@
+package bux
+
+import (
+	"testing"
+
+	"github.com/BuxOrg/bux/utils"
+	"github.com/mrz1836/go-datastore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test_newPagedResult will test the method newPagedResult()
+func Test_newPagedResult(t *testing.T) {
+	t.Parallel()
+
+	t.Run("no query params", func(t *testing.T) {
+		result := newPagedResult([]string{"a", "b"}, nil, 2)
+		assert.Equal(t, []string{"a", "b"}, result.Items)
+		assert.Equal(t, 1, result.Page)
+		assert.Equal(t, 0, result.PageSize)
+		assert.Equal(t, int64(2), result.TotalCount)
+		assert.Equal(t, 1, result.TotalPages)
+	})
+
+	t.Run("no results", func(t *testing.T) {
+		result := newPagedResult[string](nil, &datastore.QueryParams{Page: 1, PageSize: 10}, 0)
+		assert.NotNil(t, result.Items)
+		assert.Equal(t, 0, len(result.Items))
+		assert.Equal(t, int64(0), result.TotalCount)
+		assert.Equal(t, 0, result.TotalPages)
+	})
+
+	t.Run("partial last page", func(t *testing.T) {
+		result := newPagedResult([]string{"a"}, &datastore.QueryParams{Page: 3, PageSize: 2}, 5)
+		assert.Equal(t, 3, result.Page)
+		assert.Equal(t, 2, result.PageSize)
+		assert.Equal(t, int64(5), result.TotalCount)
+		assert.Equal(t, 3, result.TotalPages)
+	})
+
+	t.Run("exact pages", func(t *testing.T) {
+		result := newPagedResult([]string{"a", "b"}, &datastore.QueryParams{PageSize: 2}, 4)
+		assert.Equal(t, 1, result.Page)
+		assert.Equal(t, 2, result.TotalPages)
+	})
+}
+
+// Test_copyConditions will test the method copyConditions()
+func Test_copyConditions(t *testing.T) {
+	t.Parallel()
+
+	assert.Nil(t, copyConditions(nil))
+
+	conditions := map[string]interface{}{xPubIDField: testXPubID}
+	dbConditions := copyConditions(&conditions)
+	(*dbConditions)[chainField] = utils.ChainExternal
+	assert.Equal(t, 1, len(conditions))
+	assert.Equal(t, 2, len(*dbConditions))
+}
+
+// TestClient_GetDestinationsPaged will test the method GetDestinationsPaged()
+func TestClient_GetDestinationsPaged(t *testing.T) {
+	t.Parallel()
+
+	ctx, client, deferMe := CreateTestSQLiteClient(t, false, false, WithCustomTaskManager(&taskManagerMockBase{}))
+	defer deferMe()
+
+	_, err := client.NewXpub(ctx, testXPub, client.DefaultModelOptions()...)
+	require.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		_, err = client.NewDestination(ctx, testXPub, utils.ChainExternal, utils.ScriptTypePubKeyHash, false)
+		require.NoError(t, err)
+	}
+
+	conditions := map[string]interface{}{xPubIDField: testXPubID}
+	queryParams := &datastore.QueryParams{Page: 2, PageSize: 2}
+
+	var result *PagedResult[*Destination]
+	result, err = client.GetDestinationsPaged(ctx, nil, &conditions, queryParams)
+	require.NoError(t, err)
+	require.NotNil(t, result)
+	assert.Equal(t, 1, len(result.Items))
+	assert.Equal(t, 2, result.Page)
+	assert.Equal(t, 2, result.PageSize)
+	assert.Equal(t, int64(3), result.TotalCount)
+	assert.Equal(t, 2, result.TotalPages)
+
+	// The conditions are not modified
+	assert.Equal(t, map[string]interface{}{xPubIDField: testXPubID}, conditions)
+}
@@ -2,18 +2,52 @@ package bux
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"net/http"
 	"strings"
 	"time"
 
+	"github.com/BuxOrg/bux/chainstate"
 	"github.com/bitcoin-sv/go-paymail"
+	"github.com/bitcoinschema/go-bitcoin/v2"
 	"github.com/mrz1836/go-cachestore"
+	"golang.org/x/sync/singleflight"
 )
 
+// paymailRequests will return the group that deduplicates the concurrent identical paymail lookups of the client
+func paymailRequests(client ClientInterface) *singleflight.Group {
+	if c, ok := client.(*Client); ok {
+		return c.options.paymail.requests
+	}
+	return nil
+}
+
+// lookupPaymail will run the lookup once for all the concurrent callers of the same key (nil group = not shared)
+//
+// The lookup is detached from the context of the caller that started it (a canceled caller does not fail the
+// other waiters), it is bounded by defaultPaymailHTTPTimeout
+func lookupPaymail(requests *singleflight.Group, key string,
+	lookup func(ctx context.Context) (interface{}, error)) (interface{}, error) {
+
+	run := func() (interface{}, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), defaultPaymailHTTPTimeout)
+		defer cancel()
+		return lookup(ctx)
+	}
+	if requests == nil {
+		return run()
+	}
+	result, err, _ := requests.Do(key, run)
+	return result, err
+}
+
 // getCapabilities is a utility function to retrieve capabilities for a Paymail provider
-func getCapabilities(ctx context.Context, cs cachestore.ClientInterface, client paymail.ClientInterface,
-	domain string) (*paymail.CapabilitiesPayload, error) {
+//
+// Concurrent callers for the same domain share one in-flight request (and its result or error), see lookupPaymail
+func getCapabilities(ctx context.Context, requests *singleflight.Group, cs cachestore.ClientInterface,
+	client paymail.ClientInterface, domain string) (*paymail.CapabilitiesPayload, error) {
 
 	// Attempt to get from cachestore
 	// todo: allow user to configure the time that they want to cache the capabilities (if they want to cache or not)
@@ -26,6 +60,20 @@ func getCapabilities(ctx context.Context, cs cachestore.ClientInterface, client
 		return capabilities, nil
 	}
 
+	// Only one request per domain is in-flight (beneath the cache)
+	result, err := lookupPaymail(requests, cacheKeyCapabilities+domain, func(ctx context.Context) (interface{}, error) {
+		return requestCapabilities(ctx, cs, client, domain)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result.(*paymail.CapabilitiesPayload), nil
+}
+
+// requestCapabilities will request the capabilities from the Paymail provider and save them to the cachestore
+func requestCapabilities(ctx context.Context, cs cachestore.ClientInterface, client paymail.ClientInterface,
+	domain string) (*paymail.CapabilitiesPayload, error) {
+
 	// Get SRV record (domain can be different!)
 	var response *paymail.CapabilitiesResponse
 	srv, err := client.GetSRVRecord(
@@ -59,7 +107,7 @@ func getCapabilities(ctx context.Context, cs cachestore.ClientInterface, client
 	// Save to cachestore
 	if cs != nil && !cs.Engine().IsEmpty() {
 		_ = cs.SetModel(
-			context.Background(), cacheKeyCapabilities+domain,
+			ctx, cacheKeyCapabilities+domain,
 			&response.CapabilitiesPayload, cacheTTLCapabilities,
 		)
 	}
@@ -87,11 +135,23 @@ func hasP2P(capabilities *paymail.CapabilitiesPayload) (success bool, p2pDestina
 	return
 }
 
+// getP2PReceiveEndpoints will return the P2P receive endpoints in order of preference (BEEF first)
+func getP2PReceiveEndpoints(capabilities *paymail.CapabilitiesPayload) []*PaymailReceiveEndpoint {
+	endpoints := make([]*PaymailReceiveEndpoint, 0, 2)
+	if url := capabilities.GetString(paymail.BRFCBeefTransaction, ""); len(url) > 0 {
+		endpoints = append(endpoints, &PaymailReceiveEndpoint{Format: BeefPaymailPayloadFormat, URL: url})
+	}
+	if url := capabilities.GetString(paymail.BRFCP2PTransactions, ""); len(url) > 0 {
+		endpoints = append(endpoints, &PaymailReceiveEndpoint{Format: BasicPaymailPayloadFormat, URL: url})
+	}
+	return endpoints
+}
+
 // resolvePaymailAddress is an old way to resolve a Paymail address (if P2P is not supported)
 //
 // Deprecated: this is already deprecated by TSC, use P2P or the new P4
-func resolvePaymailAddress(ctx context.Context, cs cachestore.ClientInterface, client paymail.ClientInterface,
-	capabilities *paymail.CapabilitiesPayload, alias, domain, purpose, senderPaymail string) (*paymail.ResolutionPayload, error) {
+func resolvePaymailAddress(ctx context.Context, requests *singleflight.Group, cs cachestore.ClientInterface,
+	client paymail.ClientInterface, capabilities *paymail.CapabilitiesPayload, alias, domain, purpose, senderPaymail string) (*paymail.ResolutionPayload, error) {
 
 	// Attempt to get from cachestore
 	// todo: allow user to configure the time that they want to cache the address resolution (if they want to cache or not)
@@ -104,6 +164,22 @@ func resolvePaymailAddress(ctx context.Context, cs cachestore.ClientInterface, c
 		return resolution, nil
 	}
 
+	// Only one request per alias and domain is in-flight (beneath the cache)
+	result, err := lookupPaymail(requests, cacheKeyAddressResolution+alias+"-"+domain,
+		func(ctx context.Context) (interface{}, error) {
+			return requestPaymailAddress(ctx, cs, client, capabilities, alias, domain, purpose, senderPaymail)
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+	return result.(*paymail.ResolutionPayload), nil
+}
+
+// requestPaymailAddress will resolve the Paymail address using the provider and save it to the cachestore
+func requestPaymailAddress(ctx context.Context, cs cachestore.ClientInterface, client paymail.ClientInterface,
+	capabilities *paymail.CapabilitiesPayload, alias, domain, purpose, senderPaymail string) (*paymail.ResolutionPayload, error) {
+
 	// Get the URL
 	addressResolutionURL := capabilities.GetString(
 		paymail.BRFCBasicAddressResolution, paymail.BRFCPaymentDestination,
@@ -137,9 +213,11 @@ func resolvePaymailAddress(ctx context.Context, cs cachestore.ClientInterface, c
 	return &response.ResolutionPayload, nil
 }
 
-// startP2PTransaction will start the P2P transaction, returning the reference ID and outputs
+// startP2PTransaction will start the P2P transaction, returning the reference ID and outputs (and the raw response)
+//
+// NOTE: this is not deduplicated, every payment needs its own reference ID and outputs
 func startP2PTransaction(client paymail.ClientInterface,
-	alias, domain, p2pDestinationURL string, satoshis uint64) (*paymail.PaymentDestinationPayload, error) {
+	alias, domain, p2pDestinationURL string, satoshis uint64) (*paymail.PaymentDestinationResponse, error) {
 
 	// Start the P2P transaction request
 	response, err := client.GetP2PPaymentDestination(
@@ -151,11 +229,158 @@ func startP2PTransaction(client paymail.ClientInterface,
 		return nil, err
 	}
 
-	return &response.PaymentDestinationPayload, nil
+	return response, nil
+}
+
+// newPaymailResolution will keep the P2P payment destination response of the recipient (the evidence of the payment)
+//
+// The signature of the recipient is not part of the P2P specs, it is kept if the provider includes it (the reference
+// signed by the PKI key of the recipient)
+func newPaymailResolution(response *paymail.PaymentDestinationResponse) *PaymailResolution {
+	resolution := &PaymailResolution{
+		Outputs:    make([]*PaymailResolutionOutput, 0, len(response.Outputs)),
+		Reference:  response.Reference,
+		ResolvedAt: time.Now().UTC(),
+		Response:   string(response.Body),
+	}
+	for _, output := range response.Outputs {
+		resolution.Outputs = append(resolution.Outputs, &PaymailResolutionOutput{
+			Address:  output.Address,
+			Satoshis: output.Satoshis,
+			Script:   output.Script,
+		})
+	}
+	signed := struct {
+		Signature string `json:"signature"`
+	}{}
+	if len(response.Body) > 0 && json.Unmarshal(response.Body, &signed) == nil {
+		resolution.Signature = signed.Signature
+	}
+	return resolution
+}
+
+// setPublicKey will set the PKI public key of the recipient and verify the signature of the resolution
+func (r *PaymailResolution) setPublicKey(client paymail.ClientInterface, capabilities *paymail.CapabilitiesPayload,
+	alias, domain string) error {
+
+	pkiURL := capabilities.GetString(paymail.BRFCPki, paymail.BRFCPkiAlternate)
+	if len(pkiURL) == 0 {
+		return fmt.Errorf("%w: missing the pki capability", ErrInvalidPaymailSignature)
+	}
+	pki, err := client.GetPKI(pkiURL, alias, domain)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidPaymailSignature, err.Error())
+	}
+	r.PublicKey = pki.PubKey
+	return r.verifySignature()
+}
+
+// verifySignature will verify the signature of the reference by the recipient (PKI public key)
+func (r *PaymailResolution) verifySignature() error {
+	if len(r.PublicKey) == 0 {
+		return fmt.Errorf("%w: missing the public key of the recipient", ErrInvalidPaymailSignature)
+	}
+	address, err := bitcoin.GetAddressFromPubKeyString(r.PublicKey, true)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidPaymailSignature, err.Error())
+	}
+	if err = bitcoin.VerifyMessage(address.AddressString, r.Signature, r.Reference); err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidPaymailSignature, err.Error())
+	}
+	return nil
 }
 
 // finalizeP2PTransaction will notify the paymail provider about the transaction
-func finalizeP2PTransaction(ctx context.Context, client paymail.ClientInterface, p4 *PaymailP4, transaction *Transaction) (*paymail.P2PTransactionPayload, error) {
+//
+// Each receive endpoint of the recipient is attempted (in order) until one succeeds, every attempt is returned
+// as a sync result. An error is only returned if all the endpoints failed. The endpoints of rate limited
+// providers are skipped, ErrPaymailProviderInBackoff is returned if all of them were skipped.
+// A failing endpoint is backed off (escalating), a successful delivery clears the backoff of the endpoint.
+// A payload too large for an endpoint is not a failure of the endpoint, ErrP2PPayloadTooLarge is returned if no
+// endpoint accepted the payload (the P2P is deferred on-chain, see processP2PTransaction).
+func finalizeP2PTransaction(ctx context.Context, client paymail.ClientInterface, p4 *PaymailP4,
+	transaction *Transaction,
+) (*paymail.P2PTransactionPayload, []*SyncResult, error) {
+	endpoints := p4.getReceiveEndpoints()
+	attempts := make([]*SyncResult, 0, len(endpoints))
+
+	var backoffErr, lastErr, payloadErr error
+	for index, endpoint := range endpoints {
+
+		// Skip the rate limited providers (the other endpoints are attempted)
+		if until := getPaymailBackoff(ctx, transaction.client, endpoint.URL); !until.IsZero() {
+			backoffErr = fmt.Errorf(
+				"%w: %s until %s", ErrPaymailProviderInBackoff, endpoint.URL, until.UTC().Format(time.RFC3339),
+			)
+			continue
+		}
+
+		attempt := *p4
+		attempt.Format = endpoint.Format
+		attempt.ReceiveEndpoint = endpoint.URL
+
+		payload, err := sendP2PTransaction(ctx, client, &attempt, transaction)
+		if err != nil {
+			if errors.Is(err, ErrP2PPayloadTooLarge) { // The next endpoint (format) might accept it
+				payloadErr = err
+				attempts = append(attempts, &SyncResult{
+					Action:        syncActionP2P,
+					ExecutedAt:    time.Now().UTC(),
+					P2PStrategy:   P2PStrategyPayload,
+					Provider:      endpoint.URL,
+					StatusMessage: "error: " + err.Error(),
+				})
+				continue
+			} else if chainstate.IsRateLimitedError(err) { // The headers are recorded by the HTTP client (if any)
+				setPaymailBackoff(ctx, transaction.client, endpoint.URL, time.Now().Add(defaultPaymailBackoff))
+			} else {
+				recordP2PEndpointFailure(ctx, transaction.client, endpoint.URL)
+			}
+			lastErr = err
+			attempts = append(attempts, &SyncResult{
+				Action:        syncActionP2P,
+				ExecutedAt:    time.Now().UTC(),
+				Provider:      endpoint.URL,
+				StatusMessage: "error: " + err.Error(),
+			})
+			continue
+		}
+
+		recordP2PEndpointSuccess(ctx, transaction.client, endpoint.URL)
+
+		message := "success: " + payload.TxID
+		if index > 0 {
+			message += " (fallback endpoint " + endpoint.URL + " using " + endpoint.Format.String() + ")"
+			if transaction.client != nil {
+				transaction.client.Logger().Warn(ctx, fmt.Sprintf(
+					"finalizeP2PTransaction(): delivered using fallback endpoint %s for TxID: %s", endpoint.URL, transaction.ID,
+				))
+			}
+		}
+		attempts = append(attempts, &SyncResult{
+			Action:        syncActionP2P,
+			ExecutedAt:    time.Now().UTC(),
+			P2PStrategy:   P2PStrategyPayload,
+			Provider:      endpoint.URL,
+			StatusMessage: message,
+		})
+		return payload, attempts, nil
+	}
+
+	// Only deferred (on-chain or to the next run) if no endpoint failed
+	if lastErr == nil {
+		lastErr = payloadErr
+	}
+	if lastErr == nil {
+		lastErr = backoffErr
+	}
+	return nil, attempts, lastErr
+}
+
+// sendP2PTransaction will send the transaction to a single receive endpoint of the paymail provider
+func sendP2PTransaction(ctx context.Context, client paymail.ClientInterface, p4 *PaymailP4,
+	transaction *Transaction,
+) (*paymail.P2PTransactionPayload, error) {
 	if transaction.client != nil {
 		transaction.client.Logger().Info(ctx, fmt.Sprintf("finalizeP2PTransaction(): start %s for TxID: %s", p4.Format, transaction.ID))
 	}
@@ -165,11 +390,22 @@ func finalizeP2PTransaction(ctx context.Context, client paymail.ClientInterface,
 		return nil, err
 	}
 
+	// Detect the size before submission (the receiving servers cap the request body size)
+	size := len(p2pTransaction.Hex) + len(p2pTransaction.Beef)
+	if transaction.client != nil {
+		if maxSize := transaction.client.PaymailP2PMaxPayloadSize(); maxSize > 0 && size > maxSize {
+			return nil, fmt.Errorf("%w: %d bytes (max %d)", ErrP2PPayloadTooLarge, size, maxSize)
+		}
+	}
+
 	response, err := client.SendP2PTransaction(p4.ReceiveEndpoint, p4.Alias, p4.Domain, p2pTransaction)
 	if err != nil {
 		if transaction.client != nil {
 			transaction.client.Logger().Info(ctx, fmt.Sprintf("finalizeP2PTransaction(): error %s for TxID: %s, reason: %s", p4.Format, transaction.ID, err.Error()))
 		}
+		if isPayloadTooLargeError(response, err) {
+			return nil, fmt.Errorf("%w: %d bytes refused by the receiver: %s", ErrP2PPayloadTooLarge, size, err.Error())
+		}
 		return nil, err
 	}
 
@@ -194,7 +430,13 @@ func buildP2pTx(ctx context.Context, p4 *PaymailP4, transaction *Transaction) (*
 		beef, err := ToBeefHex(ctx, transaction)
 
 		if err != nil {
-			return nil, err
+			if !canFallbackToBasicP2P(transaction, err) {
+				return nil, err
+			}
+
+			transaction.client.Logger().Warn(ctx, fmt.Sprintf("buildP2pTx(): falling back to basic format for TxID: %s, reason: %s", transaction.ID, err.Error()))
+			p2pTransaction.Hex = transaction.Hex
+			break
 		}
 
 		p2pTransaction.Beef = beef
@@ -208,3 +450,26 @@ func buildP2pTx(ctx context.Context, p4 *PaymailP4, transaction *Transaction) (*
 
 	return p2pTransaction, nil
 }
+
+// isPayloadTooLargeError will return true if the receiver refused the request body (413 Payload Too Large)
+//
+// The response is returned with the error of a non-JSON body (IE: the page of a proxy), otherwise the paymail
+// client only has the status code in the message of the error
+func isPayloadTooLargeError(response *paymail.P2PTransactionResponse, err error) bool {
+	if response != nil && response.StatusCode == http.StatusRequestEntityTooLarge {
+		return true
+	}
+	return strings.Contains(err.Error(), fmt.Sprintf("code %d", http.StatusRequestEntityTooLarge))
+}
+
+// canFallbackToBasicP2P will return true if the BEEF error was caused by the ancestry limits and the fallback is enabled
+func canFallbackToBasicP2P(transaction *Transaction, err error) bool {
+	if transaction.client == nil {
+		return false
+	}
+	if !errors.Is(err, ErrBeefAncestryTooDeep) && !errors.Is(err, ErrBeefAncestryTooLarge) {
+		return false
+	}
+	config := transaction.client.GetPaymailConfig()
+	return config != nil && config.BeefFallbackToBasic
+}
@@ -0,0 +1,80 @@
+package bux
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// PaymailAliasRules are the validation rules of the alias of new paymail addresses
+//
+// The alias is validated in lowercase (aliases are always stored in lowercase)
+type PaymailAliasRules struct {
+	AllowedCharacters string   `json:"allowed_characters" toml:"allowed_characters" yaml:"allowed_characters"` // Regular expression character class, IE: a-z0-9._-
+	MaxLength         int      `json:"max_length" toml:"max_length" yaml:"max_length"`                         // Maximum length of the alias (0 = not checked)
+	MinLength         int      `json:"min_length" toml:"min_length" yaml:"min_length"`                         // Minimum length of the alias (0 = not checked)
+	Reserved          []string `json:"reserved" toml:"reserved" yaml:"reserved"`                               // Aliases that cannot be created (case-insensitive)
+}
+
+// defaultPaymailAliasRules will return the default rules (accepted by most paymail providers)
+func defaultPaymailAliasRules() *PaymailAliasRules {
+	return &PaymailAliasRules{
+		AllowedCharacters: defaultPaymailAliasCharacters,
+		MaxLength:         defaultPaymailAliasMaxLength,
+		MinLength:         defaultPaymailAliasMinLength,
+		Reserved:          []string{"admin", "administrator", "hostmaster", "postmaster", "root", "webmaster"},
+	}
+}
+
+// validate will check the alias against the rules
+func (r *PaymailAliasRules) validate(alias string) error {
+	alias = strings.ToLower(strings.TrimSpace(alias))
+
+	// Length bounds
+	length := utf8.RuneCountInString(alias)
+	if r.MinLength > 0 && length < r.MinLength {
+		return fmt.Errorf("%w: min length is %d", ErrPaymailAliasTooShort, r.MinLength)
+	} else if r.MaxLength > 0 && length > r.MaxLength {
+		return fmt.Errorf("%w: max length is %d", ErrPaymailAliasTooLong, r.MaxLength)
+	}
+
+	// Allowed characters
+	if len(r.AllowedCharacters) > 0 {
+		allowed, err := regexp.Compile("^[" + r.AllowedCharacters + "]*$")
+		if err != nil {
+			return fmt.Errorf("%w: invalid allowed characters: %s", ErrPaymailAliasInvalid, err.Error())
+		} else if !allowed.MatchString(alias) {
+			return fmt.Errorf("%w: allowed characters are %s", ErrPaymailAliasInvalid, r.AllowedCharacters)
+		}
+	}
+
+	// Dots are only allowed between the characters
+	if strings.HasPrefix(alias, ".") || strings.HasSuffix(alias, ".") || strings.Contains(alias, "..") {
+		return fmt.Errorf("%w: leading, trailing or consecutive dots", ErrPaymailAliasInvalid)
+	}
+
+	// Reserved aliases
+	for _, reserved := range r.Reserved {
+		if strings.EqualFold(alias, strings.TrimSpace(reserved)) {
+			return fmt.Errorf("%w: %s", ErrPaymailAliasReserved, alias)
+		}
+	}
+	return nil
+}
+
+// validatePaymailAlias will validate the alias of a new paymail address (alias@domain.com)
+//
+// Nothing is checked if the legacy (permissive) aliases are enabled, see WithPaymailLegacyAliases
+func (c *Client) validatePaymailAlias(address string) error {
+	config := c.GetPaymailConfig()
+	if config == nil || config.AliasRules == nil {
+		return nil
+	}
+
+	index := strings.LastIndex(address, "@")
+	if index < 0 {
+		return ErrPaymailAddressIsInvalid
+	}
+	return config.AliasRules.validate(address[:index])
+}
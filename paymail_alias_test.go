@@ -0,0 +1,115 @@
+package bux
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestPaymailAliasRules_validate will test the method validate()
+func TestPaymailAliasRules_validate(t *testing.T) {
+	t.Parallel()
+
+	rules := defaultPaymailAliasRules()
+
+	t.Run("valid aliases", func(t *testing.T) {
+		assert.NoError(t, rules.validate("alice"))
+		assert.NoError(t, rules.validate("alice.smith-1_2"))
+		assert.NoError(t, rules.validate("Alice"))
+		assert.NoError(t, rules.validate(strings.Repeat("a", defaultPaymailAliasMaxLength)))
+	})
+
+	t.Run("characters", func(t *testing.T) {
+		assert.ErrorIs(t, rules.validate("alicé"), ErrPaymailAliasInvalid)
+		assert.ErrorIs(t, rules.validate("alice+tag"), ErrPaymailAliasInvalid)
+		assert.ErrorIs(t, rules.validate("ali ce"), ErrPaymailAliasInvalid)
+		assert.ErrorIs(t, (&PaymailAliasRules{AllowedCharacters: "z-a"}).validate("alice"), ErrPaymailAliasInvalid)
+	})
+
+	t.Run("dots", func(t *testing.T) {
+		assert.ErrorIs(t, rules.validate(".alice"), ErrPaymailAliasInvalid)
+		assert.ErrorIs(t, rules.validate("alice."), ErrPaymailAliasInvalid)
+		assert.ErrorIs(t, rules.validate("ali..ce"), ErrPaymailAliasInvalid)
+	})
+
+	t.Run("length", func(t *testing.T) {
+		assert.ErrorIs(t, rules.validate(""), ErrPaymailAliasTooShort)
+		assert.ErrorIs(t, rules.validate(strings.Repeat("a", defaultPaymailAliasMaxLength+1)), ErrPaymailAliasTooLong)
+		assert.ErrorIs(t, (&PaymailAliasRules{MinLength: 3}).validate("al"), ErrPaymailAliasTooShort)
+		assert.NoError(t, (&PaymailAliasRules{}).validate(strings.Repeat("a", 500)))
+	})
+
+	t.Run("reserved", func(t *testing.T) {
+		assert.ErrorIs(t, rules.validate("admin"), ErrPaymailAliasReserved)
+		assert.ErrorIs(t, rules.validate("PostMaster"), ErrPaymailAliasReserved)
+		assert.NoError(t, (&PaymailAliasRules{Reserved: []string{"bob"}}).validate("admin"))
+	})
+}
+
+// TestClient_NewPaymailAddress_aliasRules will test the alias rules of the method NewPaymailAddress()
+func TestClient_NewPaymailAddress_aliasRules(t *testing.T) {
+	t.Parallel()
+
+	t.Run("default rules", func(t *testing.T) {
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, true,
+			WithCustomTaskManager(&taskManagerMockBase{}),
+			WithAutoMigrate(&PaymailAddress{}),
+		)
+		defer deferMe()
+
+		fixtures := NewFixtures(t, client).WithXpub(0)
+
+		_, err := client.NewPaymailAddress(ctx, fixtures.RawXpub, "admin@tester.com", testPublicName, testAvatar, client.DefaultModelOptions()...)
+		assert.ErrorIs(t, err, ErrPaymailAliasReserved)
+		_, err = client.NewPaymailAddress(ctx, fixtures.RawXpub, ".alice@tester.com", testPublicName, testAvatar, client.DefaultModelOptions()...)
+		assert.ErrorIs(t, err, ErrPaymailAliasInvalid)
+		_, err = client.NewPaymailAddress(ctx, fixtures.RawXpub, "alicé@tester.com", testPublicName, testAvatar, client.DefaultModelOptions()...)
+		assert.ErrorIs(t, err, ErrPaymailAliasInvalid)
+
+		// The alias is stored in lowercase, a mixed-case duplicate is the same address
+		paymailAddress, err := client.NewPaymailAddress(ctx, fixtures.RawXpub, "Alice@Tester.com", testPublicName, testAvatar, client.DefaultModelOptions()...)
+		require.NoError(t, err)
+		assert.Equal(t, "alice", paymailAddress.Alias)
+		assert.Equal(t, "tester.com", paymailAddress.Domain)
+
+		_, err = client.NewPaymailAddress(ctx, fixtures.RawXpub, "ALICE@tester.com", testPublicName, testAvatar, client.DefaultModelOptions()...)
+		assert.ErrorIs(t, err, ErrPaymailAddressExists)
+	})
+
+	t.Run("custom rules", func(t *testing.T) {
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, true,
+			WithCustomTaskManager(&taskManagerMockBase{}),
+			WithAutoMigrate(&PaymailAddress{}),
+			WithPaymailAliasRules(&PaymailAliasRules{AllowedCharacters: "a-z", MinLength: 3, MaxLength: 8}),
+		)
+		defer deferMe()
+
+		fixtures := NewFixtures(t, client).WithXpub(0)
+
+		_, err := client.NewPaymailAddress(ctx, fixtures.RawXpub, "al@tester.com", testPublicName, testAvatar, client.DefaultModelOptions()...)
+		assert.ErrorIs(t, err, ErrPaymailAliasTooShort)
+		_, err = client.NewPaymailAddress(ctx, fixtures.RawXpub, "alice.smith@tester.com", testPublicName, testAvatar, client.DefaultModelOptions()...)
+		assert.ErrorIs(t, err, ErrPaymailAliasTooLong)
+		_, err = client.NewPaymailAddress(ctx, fixtures.RawXpub, "alice1@tester.com", testPublicName, testAvatar, client.DefaultModelOptions()...)
+		assert.ErrorIs(t, err, ErrPaymailAliasInvalid)
+		_, err = client.NewPaymailAddress(ctx, fixtures.RawXpub, "admin@tester.com", testPublicName, testAvatar, client.DefaultModelOptions()...)
+		require.NoError(t, err)
+	})
+
+	t.Run("legacy aliases", func(t *testing.T) {
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, true,
+			WithCustomTaskManager(&taskManagerMockBase{}),
+			WithAutoMigrate(&PaymailAddress{}),
+			WithPaymailLegacyAliases(),
+		)
+		defer deferMe()
+
+		fixtures := NewFixtures(t, client).WithXpub(0)
+
+		paymailAddress, err := client.NewPaymailAddress(ctx, fixtures.RawXpub, "Admin@tester.com", testPublicName, testAvatar, client.DefaultModelOptions()...)
+		require.NoError(t, err)
+		assert.Equal(t, "admin", paymailAddress.Alias)
+	})
+}
@@ -0,0 +1,145 @@
+package bux
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/bitcoin-sv/go-paymail"
+)
+
+// metadataKeyPaymailDomainPolicy is the draft metadata key of the decisions for the paymail outputs (audit)
+const metadataKeyPaymailDomainPolicy = "paymail_domain_policy"
+
+// Decisions of the paymail domain policy (recorded in the draft metadata)
+const (
+	paymailDomainAllowed = "allowed"
+	paymailDomainBlocked = "blocked"
+)
+
+// paymailDomainPolicy is the allow-list and deny-list of the domains of outgoing paymail payments
+type paymailDomainPolicy struct {
+	allow map[string]bool // Only these domains can be paid (if set)
+	deny  map[string]bool // These domains can never be paid
+	mu    sync.RWMutex    // Lists can be changed at runtime
+}
+
+// newPaymailDomainSet will return the set of lower case domains
+func newPaymailDomainSet(domains []string) map[string]bool {
+	set := make(map[string]bool, len(domains))
+	for _, domain := range domains {
+		if domain = strings.ToLower(strings.TrimSpace(domain)); len(domain) > 0 {
+			set[domain] = true
+		}
+	}
+	return set
+}
+
+// setAllowList will replace the allow-list (empty allows all domains that are not denied)
+func (p *paymailDomainPolicy) setAllowList(domains []string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.allow = newPaymailDomainSet(domains)
+}
+
+// setDenyList will replace the deny-list
+func (p *paymailDomainPolicy) setDenyList(domains []string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.deny = newPaymailDomainSet(domains)
+}
+
+// lists will return the sorted allow-list and deny-list
+func (p *paymailDomainPolicy) lists() (allow, deny []string) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	for domain := range p.allow {
+		allow = append(allow, domain)
+	}
+	for domain := range p.deny {
+		deny = append(deny, domain)
+	}
+	sort.Strings(allow)
+	sort.Strings(deny)
+	return
+}
+
+// isSet will return true if any of the lists is set
+func (p *paymailDomainPolicy) isSet() bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return len(p.allow) > 0 || len(p.deny) > 0
+}
+
+// check will return ErrPaymailDomainBlocked if the domain is denied (or not on the allow-list)
+func (p *paymailDomainPolicy) check(domain string) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	domain = strings.ToLower(domain)
+	if p.deny[domain] || (len(p.allow) > 0 && !p.allow[domain]) {
+		return fmt.Errorf("%w: %s", ErrPaymailDomainBlocked, domain)
+	}
+	return nil
+}
+
+// checkOutputs will check the domains of the paymail outputs and return the decisions (nil if no list is set)
+//
+// The check happens before anything is requested from the paymail provider (P2P or address resolution)
+func (p *paymailDomainPolicy) checkOutputs(outputs []*TransactionOutput) (Metadata, error) {
+	if !p.isSet() {
+		return nil, nil
+	}
+
+	decisions := make(Metadata)
+	for _, output := range outputs {
+		if output == nil || len(output.To) == 0 {
+			continue
+		}
+		to := convertOutputHandle(output.To)
+		if detectOutputType(to) != OutputTypePaymail {
+			continue
+		}
+		_, domain, address := paymail.SanitizePaymail(to)
+		if len(address) == 0 {
+			continue // Fails when the output is processed
+		}
+		if err := p.check(domain); err != nil {
+			decisions[address] = paymailDomainBlocked
+			return decisions, err
+		}
+		decisions[address] = paymailDomainAllowed
+	}
+	return decisions, nil
+}
+
+// checkPaymailDomains will check the paymail outputs of the draft and record the decisions in the metadata
+func (m *DraftTransaction) checkPaymailDomains() error {
+	outputs := m.Configuration.Outputs
+	if m.Configuration.SendAllTo != nil {
+		outputs = append([]*TransactionOutput{m.Configuration.SendAllTo}, outputs...)
+	}
+
+	// The policy is an option of the client (none for other implementations)
+	client, ok := m.Client().(*Client)
+	if !ok {
+		return nil
+	}
+	decisions, err := client.options.paymail.domainPolicy.checkOutputs(outputs)
+	if len(decisions) > 0 {
+		m.UpdateMetadata(Metadata{metadataKeyPaymailDomainPolicy: decisions})
+	}
+	return err
+}
+
+// SetPaymailDomainAllowList will replace the allow-list of the outgoing paymail domains (none allows all domains)
+func (c *Client) SetPaymailDomainAllowList(domains ...string) {
+	c.options.paymail.domainPolicy.setAllowList(domains)
+}
+
+// SetPaymailDomainDenyList will replace the deny-list of the outgoing paymail domains
+func (c *Client) SetPaymailDomainDenyList(domains ...string) {
+	c.options.paymail.domainPolicy.setDenyList(domains)
+}
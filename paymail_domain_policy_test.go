@@ -0,0 +1,121 @@
+package bux
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test_paymailDomainPolicy_check will test the method check()
+func Test_paymailDomainPolicy_check(t *testing.T) {
+	t.Parallel()
+
+	t.Run("no lists", func(t *testing.T) {
+		policy := &paymailDomainPolicy{}
+		assert.False(t, policy.isSet())
+		assert.NoError(t, policy.check("example.com"))
+	})
+
+	t.Run("deny-list (case-insensitive)", func(t *testing.T) {
+		policy := &paymailDomainPolicy{}
+		policy.setDenyList([]string{" Blocked.COM ", ""})
+		assert.True(t, policy.isSet())
+		assert.ErrorIs(t, policy.check("blocked.com"), ErrPaymailDomainBlocked)
+		assert.ErrorIs(t, policy.check("BLOCKED.com"), ErrPaymailDomainBlocked)
+		assert.NoError(t, policy.check("example.com"))
+	})
+
+	t.Run("allow-list (case-insensitive)", func(t *testing.T) {
+		policy := &paymailDomainPolicy{}
+		policy.setAllowList([]string{"Example.com"})
+		assert.NoError(t, policy.check("EXAMPLE.COM"))
+		assert.ErrorIs(t, policy.check("other.com"), ErrPaymailDomainBlocked)
+	})
+
+	t.Run("deny-list wins", func(t *testing.T) {
+		policy := &paymailDomainPolicy{}
+		policy.setAllowList([]string{"example.com"})
+		policy.setDenyList([]string{"example.com"})
+		assert.ErrorIs(t, policy.check("example.com"), ErrPaymailDomainBlocked)
+	})
+
+	t.Run("outputs", func(t *testing.T) {
+		policy := &paymailDomainPolicy{}
+		policy.setDenyList([]string{"blocked.com"})
+
+		decisions, err := policy.checkOutputs([]*TransactionOutput{
+			{To: testExternalAddress},
+			{To: "Alice@Example.com"},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, Metadata{"alice@example.com": paymailDomainAllowed}, decisions)
+
+		decisions, err = policy.checkOutputs([]*TransactionOutput{{To: "bob@BLOCKED.com"}})
+		assert.ErrorIs(t, err, ErrPaymailDomainBlocked)
+		assert.Equal(t, Metadata{"bob@blocked.com": paymailDomainBlocked}, decisions)
+	})
+}
+
+// TestClient_paymailDomainPolicy will test the paymail domain lists on the drafts and output resolution
+func TestClient_paymailDomainPolicy(t *testing.T) {
+	paymailAddress := testAlias + "@" + testDomain
+
+	t.Run("deny-list", func(t *testing.T) {
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, true,
+			WithCustomTaskManager(&taskManagerMockBase{}),
+			WithPaymailClient(newTestPaymailClient(t, []string{testDomain})),
+			WithPaymailDomainDenyList("Blocked.com"),
+		)
+		t.Cleanup(deferMe)
+		fixtures := NewFixtures(t, client).WithXpub(0).WithUtxos(10000)
+
+		_, err := client.NewTransaction(ctx, fixtures.RawXpub, &TransactionConfig{
+			Outputs: []*TransactionOutput{{To: "alice@BLOCKED.com", Satoshis: 1000}},
+		})
+		assert.ErrorIs(t, err, ErrPaymailDomainBlocked)
+
+		_, err = client.NewTransaction(ctx, fixtures.RawXpub, &TransactionConfig{
+			SendAllTo: &TransactionOutput{To: "alice@blocked.com"},
+		})
+		assert.ErrorIs(t, err, ErrPaymailDomainBlocked)
+
+		_, err = client.ResolveOutput(ctx, "alice@blocked.com")
+		assert.ErrorIs(t, err, ErrPaymailDomainBlocked)
+
+		// Not a paymail
+		_, err = client.ResolveOutput(ctx, testExternalAddress)
+		assert.NoError(t, err)
+	})
+
+	t.Run("allow-list set at runtime", func(t *testing.T) {
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, true,
+			WithCustomTaskManager(&taskManagerMockBase{}),
+			WithPaymailClient(newTestPaymailClient(t, []string{testDomain})),
+		)
+		t.Cleanup(deferMe)
+		fixtures := NewFixtures(t, client).WithXpub(0).WithUtxos(10000)
+
+		client.SetPaymailDomainAllowList(testDomain)
+
+		_, err := client.NewTransaction(ctx, fixtures.RawXpub, &TransactionConfig{
+			Outputs: []*TransactionOutput{{To: "alice@other.com", Satoshis: 1000}},
+		})
+		assert.ErrorIs(t, err, ErrPaymailDomainBlocked)
+
+		// Address resolution
+		mockValidResponse(http.StatusOK, false, testDomain)
+		draft, err := client.NewTransaction(ctx, fixtures.RawXpub, &TransactionConfig{
+			Outputs: []*TransactionOutput{{To: paymailAddress, Satoshis: 1000}},
+		})
+		require.NoError(t, err)
+		fixtures.Drafts = append(fixtures.Drafts, draft)
+		assert.Equal(t, Metadata{paymailAddress: paymailDomainAllowed}, draft.Metadata[metadataKeyPaymailDomainPolicy])
+
+		// Cleared
+		client.SetPaymailDomainAllowList()
+		_, err = client.ResolveOutput(ctx, "alice@other.com")
+		assert.NotErrorIs(t, err, ErrPaymailDomainBlocked)
+	})
+}
@@ -0,0 +1,103 @@
+package bux
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/BuxOrg/bux/notifications"
+)
+
+// validatePaymailProfile will validate the public profile fields (public name & avatar) of a paymail address
+//
+// Returns the sanitized public name
+func (c *Client) validatePaymailProfile(ctx context.Context, publicName, avatar string) (string, error) {
+
+	// Use the defaults unless configured
+	nameMaxLength, avatarMaxLength, verifyAvatar := defaultPaymailPublicNameMaxLength, defaultPaymailAvatarMaxLength, false
+	if config := c.GetPaymailConfig(); config != nil {
+		if config.PublicNameMaxLength > 0 {
+			nameMaxLength = config.PublicNameMaxLength
+		}
+		if config.AvatarMaxLength > 0 {
+			avatarMaxLength = config.AvatarMaxLength
+		}
+		verifyAvatar = config.AvatarVerification
+	}
+
+	// Sanitize & validate the public name
+	publicName = sanitizePublicName(publicName)
+	if utf8.RuneCountInString(publicName) > nameMaxLength {
+		return "", fmt.Errorf("%w: max length is %d", ErrPaymailPublicNameTooLong, nameMaxLength)
+	}
+
+	// Validate the avatar
+	if err := validateAvatarURL(avatar, avatarMaxLength); err != nil {
+		return "", err
+	}
+
+	// Confirm that the avatar is an image (optional)
+	if verifyAvatar && len(avatar) > 0 {
+		// The avatar is a user given URL: bounded timeout, no private or loopback addresses
+		httpClient := notifications.NewGuardedHTTPClient(defaultPaymailAvatarTimeout)
+		if err := verifyAvatarContentType(ctx, httpClient, avatar); err != nil {
+			return "", err
+		}
+	}
+
+	return publicName, nil
+}
+
+// sanitizePublicName will remove control characters & markup characters, and trim any whitespace
+func sanitizePublicName(publicName string) string {
+	return strings.TrimSpace(strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || r == '<' || r == '>' {
+			return -1
+		}
+		return r
+	}, publicName))
+}
+
+// validateAvatarURL will make sure the avatar is empty or an http(s) URL within the length limit
+func validateAvatarURL(avatar string, maxLength int) error {
+	if len(avatar) == 0 {
+		return nil
+	} else if len(avatar) > maxLength {
+		return fmt.Errorf("%w: max length is %d", ErrPaymailAvatarTooLong, maxLength)
+	}
+
+	u, err := url.ParseRequestURI(avatar)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrPaymailAvatarInvalid, err.Error())
+	} else if (u.Scheme != "http" && u.Scheme != "https") || len(u.Host) == 0 {
+		return ErrPaymailAvatarInvalid
+	}
+	return nil
+}
+
+// verifyAvatarContentType will HEAD the avatar URL and make sure it returns an image content type
+func verifyAvatarContentType(ctx context.Context, httpClient HTTPInterface, avatar string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, avatar, nil)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrPaymailAvatarInvalid, err.Error())
+	}
+
+	var res *http.Response
+	if res, err = httpClient.Do(req); err != nil {
+		return fmt.Errorf("%w: %s", ErrPaymailAvatarNotImage, err.Error())
+	}
+	defer func() {
+		_ = res.Body.Close()
+	}()
+
+	if res.StatusCode < http.StatusOK || res.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("%w: status code %d", ErrPaymailAvatarNotImage, res.StatusCode)
+	} else if !strings.HasPrefix(strings.ToLower(res.Header.Get("Content-Type")), "image/") {
+		return fmt.Errorf("%w: content type %s", ErrPaymailAvatarNotImage, res.Header.Get("Content-Type"))
+	}
+	return nil
+}
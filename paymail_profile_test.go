@@ -0,0 +1,98 @@
+package bux
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/BuxOrg/bux/notifications"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test_sanitizePublicName will test the method sanitizePublicName()
+func Test_sanitizePublicName(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, "", sanitizePublicName(""))
+	assert.Equal(t, testPublicName, sanitizePublicName(" "+testPublicName+"\n"))
+	assert.Equal(t, "scriptalert(1)/script", sanitizePublicName("<script>alert(1)</script>"))
+	assert.Equal(t, "Name", sanitizePublicName("Na\x00m\te"))
+}
+
+// Test_validateAvatarURL will test the method validateAvatarURL()
+func Test_validateAvatarURL(t *testing.T) {
+	t.Parallel()
+
+	t.Run("valid avatars", func(t *testing.T) {
+		assert.NoError(t, validateAvatarURL("", defaultPaymailAvatarMaxLength))
+		assert.NoError(t, validateAvatarURL(testAvatar, defaultPaymailAvatarMaxLength))
+		assert.NoError(t, validateAvatarURL("http://domain.com/avatar.png", defaultPaymailAvatarMaxLength))
+	})
+
+	t.Run("invalid scheme", func(t *testing.T) {
+		assert.ErrorIs(t, validateAvatarURL("javascript:alert(1)", defaultPaymailAvatarMaxLength), ErrPaymailAvatarInvalid)
+		assert.ErrorIs(t, validateAvatarURL("ftp://domain.com/avatar.png", defaultPaymailAvatarMaxLength), ErrPaymailAvatarInvalid)
+		assert.ErrorIs(t, validateAvatarURL("not-a-url", defaultPaymailAvatarMaxLength), ErrPaymailAvatarInvalid)
+	})
+
+	t.Run("too long", func(t *testing.T) {
+		avatar := "https://domain.com/" + strings.Repeat("a", defaultPaymailAvatarMaxLength)
+		assert.ErrorIs(t, validateAvatarURL(avatar, defaultPaymailAvatarMaxLength), ErrPaymailAvatarTooLong)
+	})
+}
+
+// Test_verifyAvatarContentType will test the method verifyAvatarContentType()
+func Test_verifyAvatarContentType(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, http.MethodHead, r.Method)
+		if r.URL.Path == "/avatar.png" {
+			w.Header().Set("Content-Type", "image/png")
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+	}))
+	defer server.Close()
+
+	t.Run("image content type", func(t *testing.T) {
+		err := verifyAvatarContentType(context.Background(), server.Client(), server.URL+"/avatar.png")
+		assert.NoError(t, err)
+	})
+
+	t.Run("not an image", func(t *testing.T) {
+		err := verifyAvatarContentType(context.Background(), server.Client(), server.URL+"/index.html")
+		assert.ErrorIs(t, err, ErrPaymailAvatarNotImage)
+	})
+
+	t.Run("loopback address is refused", func(t *testing.T) {
+		httpClient := notifications.NewGuardedHTTPClient(defaultPaymailAvatarTimeout)
+		err := verifyAvatarContentType(context.Background(), httpClient, server.URL+"/avatar.png")
+		assert.ErrorIs(t, err, ErrPaymailAvatarNotImage)
+		assert.ErrorContains(t, err, notifications.ErrBlockedEndpoint.Error())
+	})
+}
+
+// TestClient_validatePaymailProfile will test the method validatePaymailProfile()
+func TestClient_validatePaymailProfile(t *testing.T) {
+	t.Parallel()
+
+	ctx, client, deferMe := CreateTestSQLiteClient(t, false, true,
+		WithCustomTaskManager(&taskManagerMockBase{}),
+		WithPaymailProfileValidation(5, 0, false),
+	)
+	defer deferMe()
+
+	publicName, err := client.(*Client).validatePaymailProfile(ctx, " Name ", testAvatar)
+	require.NoError(t, err)
+	assert.Equal(t, "Name", publicName)
+
+	_, err = client.(*Client).validatePaymailProfile(ctx, testPublicName, testAvatar)
+	assert.ErrorIs(t, err, ErrPaymailPublicNameTooLong)
+
+	_, err = client.(*Client).validatePaymailProfile(ctx, "Name", "javascript:alert(1)")
+	assert.ErrorIs(t, err, ErrPaymailAvatarInvalid)
+}
@@ -56,7 +56,9 @@ func (p *PaymailDefaultServiceProvider) GetPaymailByAlias(ctx context.Context, a
 	paymailAddress, pubKey, err := p.createPaymailInformation(
 		ctx, alias, domain, append(p.client.DefaultModelOptions(), WithMetadatas(metadata))...,
 	)
-	if err != nil {
+	if errors.Is(err, ErrMissingPaymail) {
+		return nil, nil // not found (or pending activation)
+	} else if err != nil {
 		return nil, err
 	}
 
@@ -141,6 +143,13 @@ func (p *PaymailDefaultServiceProvider) CreateP2PDestinationResponse(ctx context
 func (p *PaymailDefaultServiceProvider) RecordTransaction(ctx context.Context,
 	p2pTx *paymail.P2PTransaction, requestMetadata *server.RequestMetadata) (*paymail.P2PTransactionPayload, error) {
 
+	// Reject the transactions exceeding the limits (before any other work)
+	if checker, ok := p.client.(incomingTransactionChecker); ok {
+		if err := checker.checkIncomingTransaction(ctx, p2pTx.Hex, incomingSourcePaymail); err != nil {
+			return nil, err
+		}
+	}
+
 	// Create the metadata
 	metadata := p.createMetadata(requestMetadata, "RecordTransaction")
 	metadata[p2pMetadataField] = p2pTx.MetaData
@@ -189,6 +198,9 @@ func (p *PaymailDefaultServiceProvider) createPaymailInformation(ctx context.Con
 	paymailAddress, err = getPaymailAddress(ctx, alias+"@"+domain, opts...)
 	if err != nil {
 		return nil, nil, err
+	} else if paymailAddress == nil || paymailAddress.IsPending() {
+		// pending paymails are not served until activated
+		return nil, nil, ErrMissingPaymail
 	}
 
 	unlock, err := newWaitWriteLock(ctx, lockKey(paymailAddress), p.client.Cachestore())
@@ -207,16 +219,29 @@ func (p *PaymailDefaultServiceProvider) createPaymailInformation(ctx context.Con
 		return nil, nil, err
 	}
 
-	chainNum, err := xPub.incrementNextNum(ctx, utils.ChainExternal)
-	if err != nil {
-		return nil, nil, err
-	}
+	// Revoked destinations are never handed out (the key is skipped)
+	for {
+		var chainNum uint32
+		if chainNum, err = xPub.incrementNextNum(ctx, utils.ChainExternal); err != nil {
+			return nil, nil, err
+		}
 
-	pubKey, err = deriveKey(externalXpub.String(), chainNum)
-	if err != nil {
-		return nil, nil, err
+		if pubKey, err = deriveKey(externalXpub.String(), chainNum); err != nil {
+			return nil, nil, err
+		}
+
+		var lockingScript string
+		if lockingScript, err = createLockingScript(pubKey.ecPubKey); err != nil {
+			return nil, nil, err
+		}
+
+		var revoked bool
+		if revoked, err = isDestinationRevoked(ctx, lockingScript, opts...); err != nil {
+			return nil, nil, err
+		} else if !revoked {
+			return
+		}
 	}
-	return
 }
 
 func getXpubForPaymail(ctx context.Context, client ClientInterface, paymailAddress *PaymailAddress, opts []ModelOps) (*Xpub, error) {
@@ -3,6 +3,7 @@ package bux
 import (
 	"context"
 	"net/http"
+	"sync"
 	"testing"
 	"time"
 
@@ -16,6 +17,7 @@ import (
 	"github.com/mrz1836/go-datastore"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/sync/singleflight"
 )
 
 const (
@@ -158,6 +160,86 @@ func Test_hasP2P_beefCapabilities(t *testing.T) {
 	})
 }
 
+// Test_getP2PReceiveEndpoints will test the method getP2PReceiveEndpoints()
+func Test_getP2PReceiveEndpoints(t *testing.T) {
+	t.Parallel()
+
+	t.Run("no p2p capabilities", func(t *testing.T) {
+		capabilities := server.GenericCapabilities(paymail.DefaultBsvAliasVersion, false)
+		assert.Len(t, getP2PReceiveEndpoints(capabilities), 0)
+	})
+
+	t.Run("beef and basic capabilities", func(t *testing.T) {
+		capabilities := server.GenericCapabilities(paymail.DefaultBsvAliasVersion, false)
+		capabilities.Capabilities[paymail.BRFCP2PTransactions] = "/receive-transaction/{alias}@{domain.tld}"
+		capabilities.Capabilities[paymail.BRFCBeefTransaction] = "/receive-beef-transaction/{alias}@{domain.tld}"
+
+		endpoints := getP2PReceiveEndpoints(capabilities)
+		require.Len(t, endpoints, 2)
+		assert.Equal(t, BeefPaymailPayloadFormat, endpoints[0].Format)
+		assert.Equal(t, capabilities.Capabilities[paymail.BRFCBeefTransaction], endpoints[0].URL)
+		assert.Equal(t, BasicPaymailPayloadFormat, endpoints[1].Format)
+		assert.Equal(t, capabilities.Capabilities[paymail.BRFCP2PTransactions], endpoints[1].URL)
+	})
+}
+
+// Test_finalizeP2PTransaction will test the method finalizeP2PTransaction()
+func Test_finalizeP2PTransaction(t *testing.T) {
+	// t.Parallel() mocking does not allow parallel tests
+
+	p4 := &PaymailP4{
+		Alias:  testAlias,
+		Domain: testDomain,
+		ReceiveEndpoints: []*PaymailReceiveEndpoint{
+			{URL: testServerURL + "/receive-transaction/{alias}@{domain.tld}"},
+			{URL: testServerURL + "/receive-transaction-v2/{alias}@{domain.tld}"},
+		},
+		ReferenceID: "z0bac4ec-6f15-42de-9ef4-e60bfdabf4f7",
+	}
+	transaction := &Transaction{TransactionBase: TransactionBase{Hex: testTxHex}, Model: Model{}}
+
+	t.Run("[mocked] - delivered on the fallback endpoint", func(t *testing.T) {
+		client := newTestPaymailClient(t, []string{testDomain})
+
+		httpmock.Reset()
+		httpmock.RegisterResponder(http.MethodPost, testServerURL+"/receive-transaction/"+testAlias+"@"+testDomain,
+			httpmock.NewStringResponder(http.StatusInternalServerError, `{"message": "unavailable"}`),
+		)
+		httpmock.RegisterResponder(http.MethodPost, testServerURL+"/receive-transaction-v2/"+testAlias+"@"+testDomain,
+			httpmock.NewStringResponder(http.StatusOK, `{"txid": "`+testTxID+`", "note": "thanks"}`),
+		)
+
+		payload, attempts, err := finalizeP2PTransaction(context.Background(), client, p4, transaction)
+		require.NoError(t, err)
+		require.NotNil(t, payload)
+		assert.Equal(t, testTxID, payload.TxID)
+		require.Len(t, attempts, 2)
+		assert.Contains(t, attempts[0].StatusMessage, "error: ")
+		assert.Contains(t, attempts[1].StatusMessage, "success: "+testTxID)
+		assert.Contains(t, attempts[1].StatusMessage, "fallback endpoint")
+		assert.Equal(t, p4.ReceiveEndpoints[1].URL, attempts[1].Provider)
+	})
+
+	t.Run("[mocked] - all endpoints failed", func(t *testing.T) {
+		client := newTestPaymailClient(t, []string{testDomain})
+
+		httpmock.Reset()
+		httpmock.RegisterResponder(http.MethodPost, testServerURL+"/receive-transaction/"+testAlias+"@"+testDomain,
+			httpmock.NewStringResponder(http.StatusInternalServerError, `{"message": "unavailable"}`),
+		)
+		httpmock.RegisterResponder(http.MethodPost, testServerURL+"/receive-transaction-v2/"+testAlias+"@"+testDomain,
+			httpmock.NewStringResponder(http.StatusNotFound, `{"message": "not found"}`),
+		)
+
+		payload, attempts, err := finalizeP2PTransaction(context.Background(), client, p4, transaction)
+		require.Error(t, err)
+		assert.Nil(t, payload)
+		require.Len(t, attempts, 2)
+		assert.Contains(t, attempts[0].StatusMessage, "error: ")
+		assert.Contains(t, attempts[1].StatusMessage, "error: ")
+	})
+}
+
 // Test_startP2PTransaction will test the method startP2PTransaction()
 func Test_startP2PTransaction(t *testing.T) {
 	// t.Parallel() mocking does not allow parallel tests
@@ -236,7 +318,7 @@ func Test_getCapabilities(t *testing.T) {
 		mockValidResponse(http.StatusOK, false, testDomain)
 		var payload *paymail.CapabilitiesPayload
 		payload, err = getCapabilities(
-			context.Background(), tc.Cachestore(), client, testDomain,
+			context.Background(), nil, tc.Cachestore(), client, testDomain,
 		)
 		require.NoError(t, err)
 		require.NotNil(t, payload)
@@ -276,7 +358,7 @@ func Test_getCapabilities(t *testing.T) {
 		mockValidResponse(http.StatusBadRequest, false, testDomain)
 		var payload *paymail.CapabilitiesPayload
 		payload, err = getCapabilities(
-			context.Background(), tc.Cachestore(), client, testDomain,
+			context.Background(), nil, tc.Cachestore(), client, testDomain,
 		)
 		require.Error(t, err)
 		require.Nil(t, payload)
@@ -300,7 +382,7 @@ func Test_getCapabilities(t *testing.T) {
 		mockValidResponse(http.StatusOK, false, testDomain)
 		var payload *paymail.CapabilitiesPayload
 		payload, err = getCapabilities(
-			context.Background(), tc.Cachestore(), client, testDomain,
+			context.Background(), nil, tc.Cachestore(), client, testDomain,
 		)
 		require.NoError(t, err)
 		require.NotNil(t, payload)
@@ -325,7 +407,7 @@ func Test_getCapabilities(t *testing.T) {
 		mockValidResponse(http.StatusOK, false, testDomain)
 		var payload *paymail.CapabilitiesPayload
 		payload, err = getCapabilities(
-			context.Background(), tc.Cachestore(), client, testDomain,
+			context.Background(), nil, tc.Cachestore(), client, testDomain,
 		)
 		require.NoError(t, err)
 		require.NotNil(t, payload)
@@ -335,7 +417,7 @@ func Test_getCapabilities(t *testing.T) {
 		time.Sleep(1 * time.Second)
 
 		payload, err = getCapabilities(
-			context.Background(), tc.Cachestore(), client, testDomain,
+			context.Background(), nil, tc.Cachestore(), client, testDomain,
 		)
 		require.NoError(t, err)
 		require.NotNil(t, payload)
@@ -344,6 +426,118 @@ func Test_getCapabilities(t *testing.T) {
 	})
 }
 
+// Test_getCapabilities_concurrent will test that concurrent lookups share one upstream request
+func Test_getCapabilities_concurrent(t *testing.T) {
+	// t.Parallel() mocking does not allow parallel tests
+
+	const lookups = 25
+	capabilitiesURL := "https://" + testDomain + ":443/.well-known/" + paymail.DefaultServiceName
+
+	// slowResponder will respond after a delay (all the lookups are in-flight at the same time)
+	slowResponder := func(statusCode int) httpmock.Responder {
+		return func(req *http.Request) (*http.Response, error) {
+			time.Sleep(250 * time.Millisecond)
+			return httpmock.NewStringResponse(statusCode,
+				`{"`+paymail.DefaultServiceName+`": "`+paymail.DefaultBsvAliasVersion+`","capabilities":{
+"`+paymail.BRFCPaymentDestination+`": "`+testServerURL+`/address/{alias}@{domain.tld}"}
+}`), nil
+		}
+	}
+
+	// getConcurrently will run the lookups at the same time for N drafts
+	getConcurrently := func(tc ClientInterface, client paymail.ClientInterface) ([]*paymail.CapabilitiesPayload, []error) {
+		payloads := make([]*paymail.CapabilitiesPayload, lookups)
+		errs := make([]error, lookups)
+		start := make(chan struct{})
+		var wg sync.WaitGroup
+		for i := 0; i < lookups; i++ {
+			wg.Add(1)
+			go func(index int) {
+				defer wg.Done()
+				<-start
+				payloads[index], errs[index] = getCapabilities(
+					context.Background(), paymailRequests(tc), tc.Cachestore(), client, testDomain,
+				)
+			}(i)
+		}
+		close(start)
+		wg.Wait()
+		return payloads, errs
+	}
+
+	t.Run("valid response - one upstream request", func(t *testing.T) {
+		client := newTestPaymailClient(t, []string{testDomain})
+
+		tc, err := NewClient(context.Background(), DefaultClientOpts(true, true)...)
+		require.NoError(t, err)
+		require.NotNil(t, tc)
+		defer CloseClient(context.Background(), t, tc)
+
+		httpmock.Reset()
+		httpmock.RegisterResponder(http.MethodGet, capabilitiesURL, slowResponder(http.StatusOK))
+
+		payloads, errs := getConcurrently(tc, client)
+		for i := 0; i < lookups; i++ {
+			require.NoError(t, errs[i])
+			require.NotNil(t, payloads[i])
+			assert.Equal(t, paymail.DefaultBsvAliasVersion, payloads[i].BsvAlias)
+		}
+		assert.Equal(t, 1, httpmock.GetCallCountInfo()[http.MethodGet+" "+capabilitiesURL])
+	})
+
+	t.Run("server error - propagated to all the waiters", func(t *testing.T) {
+		client := newTestPaymailClient(t, []string{testDomain})
+
+		tc, err := NewClient(context.Background(), DefaultClientOpts(true, true)...)
+		require.NoError(t, err)
+		require.NotNil(t, tc)
+		defer CloseClient(context.Background(), t, tc)
+
+		httpmock.Reset()
+		httpmock.RegisterResponder(http.MethodGet, capabilitiesURL, slowResponder(http.StatusBadRequest))
+
+		payloads, errs := getConcurrently(tc, client)
+		for i := 0; i < lookups; i++ {
+			require.Error(t, errs[i])
+			assert.Nil(t, payloads[i])
+			assert.Equal(t, errs[0], errs[i])
+		}
+	})
+}
+
+// Test_lookupPaymail will test the method lookupPaymail()
+func Test_lookupPaymail(t *testing.T) {
+	t.Parallel()
+
+	t.Run("one group per client", func(t *testing.T) {
+		_, client, deferMe := CreateTestSQLiteClient(t, false, false)
+		defer deferMe()
+		_, other, deferOther := CreateTestSQLiteClient(t, false, false)
+		defer deferOther()
+
+		require.NotNil(t, paymailRequests(client))
+		assert.NotSame(t, paymailRequests(client), paymailRequests(other))
+	})
+
+	t.Run("detached from the caller", func(t *testing.T) {
+		result, err := lookupPaymail(&singleflight.Group{}, testDomain, func(ctx context.Context) (interface{}, error) {
+			_, hasDeadline := ctx.Deadline()
+			assert.True(t, hasDeadline)
+			return ctx.Err(), nil
+		})
+		require.NoError(t, err)
+		assert.Nil(t, result)
+	})
+
+	t.Run("no group", func(t *testing.T) {
+		result, err := lookupPaymail(nil, testDomain, func(ctx context.Context) (interface{}, error) {
+			return testDomain, nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, testDomain, result)
+	})
+}
+
 // Test_resolvePaymailAddress will test the method resolvePaymailAddress()
 func Test_resolvePaymailAddress(t *testing.T) {
 	// t.Parallel() mocking does not allow parallel tests
@@ -382,7 +576,7 @@ func Test_resolvePaymailAddress(t *testing.T) {
 		// Get capabilities
 		var payload *paymail.CapabilitiesPayload
 		payload, err = getCapabilities(
-			context.Background(), tc.Cachestore(), client, testDomain,
+			context.Background(), nil, tc.Cachestore(), client, testDomain,
 		)
 		require.NoError(t, err)
 		require.NotNil(t, payload)
@@ -394,7 +588,7 @@ func Test_resolvePaymailAddress(t *testing.T) {
 		// Resolve address
 		var resolvePayload *paymail.ResolutionPayload
 		resolvePayload, err = resolvePaymailAddress(
-			context.Background(), tc.Cachestore(), client, payload,
+			context.Background(), nil, tc.Cachestore(), client, payload,
 			testAlias, testDomain, defaultAddressResolutionPurpose, defaultSenderPaymail,
 		)
 		require.NoError(t, err)
@@ -425,7 +619,7 @@ func Test_resolvePaymailAddress(t *testing.T) {
 		// Get capabilities
 		var payload *paymail.CapabilitiesPayload
 		payload, err = getCapabilities(
-			context.Background(), tc.Cachestore(), client, testDomain,
+			context.Background(), nil, tc.Cachestore(), client, testDomain,
 		)
 		require.NoError(t, err)
 		require.NotNil(t, payload)
@@ -433,7 +627,7 @@ func Test_resolvePaymailAddress(t *testing.T) {
 		// Resolve address
 		var resolvePayload *paymail.ResolutionPayload
 		resolvePayload, err = resolvePaymailAddress(
-			context.Background(), tc.Cachestore(), client, payload,
+			context.Background(), nil, tc.Cachestore(), client, payload,
 			testAlias, testDomain, defaultAddressResolutionPurpose, defaultSenderPaymail,
 		)
 		require.NoError(t, err)
@@ -463,7 +657,7 @@ func Test_resolvePaymailAddress(t *testing.T) {
 		// Get capabilities
 		var payload *paymail.CapabilitiesPayload
 		payload, err = getCapabilities(
-			context.Background(), tc.Cachestore(), client, testDomain,
+			context.Background(), nil, tc.Cachestore(), client, testDomain,
 		)
 		require.NoError(t, err)
 		require.NotNil(t, payload)
@@ -471,7 +665,7 @@ func Test_resolvePaymailAddress(t *testing.T) {
 		// Resolve address
 		var resolvePayload *paymail.ResolutionPayload
 		resolvePayload, err = resolvePaymailAddress(
-			context.Background(), tc.Cachestore(), client, payload,
+			context.Background(), nil, tc.Cachestore(), client, payload,
 			testAlias, testDomain, defaultAddressResolutionPurpose, defaultSenderPaymail,
 		)
 		require.NoError(t, err)
@@ -482,7 +676,7 @@ func Test_resolvePaymailAddress(t *testing.T) {
 
 		// Resolve address
 		resolvePayload, err = resolvePaymailAddress(
-			context.Background(), tc.Cachestore(), client, payload,
+			context.Background(), nil, tc.Cachestore(), client, payload,
 			testAlias, testDomain, defaultAddressResolutionPurpose, defaultSenderPaymail,
 		)
 		require.NoError(t, err)
@@ -0,0 +1,254 @@
+package bux
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/bitcoinschema/go-bitcoin/v2"
+	"github.com/libsv/go-bk/bec"
+	"github.com/libsv/go-bt/v2"
+)
+
+// PaymentAcknowledgment is a signed statement tying a payment to the paymail resolutions of the recipients: the
+// transaction, the P2P payment destination responses and the outputs paying the resolved scripts
+// (see VerifyPaymentAcknowledgment)
+type PaymentAcknowledgment struct {
+	IdentityKey string                   `json:"identity_key"` // Public key (hex) of the signer (see WithIdentityKey)
+	Recipients  []*AcknowledgedRecipient `json:"recipients"`   // The paid recipients (resolved via P2P)
+	Signature   string                   `json:"signature"`    // DER signature (hex) of the digest (see Digest)
+	SignedAt    time.Time                `json:"signed_at"`    // When the acknowledgment was signed
+	TxHex       string                   `json:"tx_hex"`       // Raw transaction (hex)
+	TxID        string                   `json:"tx_id"`        // ID of the transaction
+}
+
+// AcknowledgedRecipient is a recipient paid by the transaction of a payment acknowledgment
+type AcknowledgedRecipient struct {
+	OutputIndexes []uint32           `json:"output_indexes"` // Outputs of the transaction paying the resolved scripts
+	Paymail       string             `json:"paymail"`        // Paymail of the recipient (alias@domain)
+	Resolution    *PaymailResolution `json:"resolution"`     // The P2P payment destination response of the recipient
+}
+
+// GetPaymentAcknowledgment will return the signed acknowledgment of a payment of the xPub to the paymail recipients
+// (IE: for a counterparty disputing the payment)
+//
+// Only the outputs resolved via P2P are acknowledged (the resolution is kept on the draft), returns
+// ErrMissingPaymailResolution if the transaction has none. Requires the identity key (see WithIdentityKey).
+//
+// xPubID is the xPub ID (or the raw public xPub) of the payer
+func (c *Client) GetPaymentAcknowledgment(ctx context.Context, xPubID, txID string) (*PaymentAcknowledgment, error) {
+
+	// Check for existing NewRelic transaction
+	ctx = c.GetOrStartTxn(ctx, "get_payment_acknowledgment")
+
+	// The key signing the acknowledgment
+	if len(c.options.identityKey) == 0 {
+		return nil, ErrMissingIdentityKey
+	}
+	privateKey, err := bitcoin.PrivateKeyFromString(c.options.identityKey)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrMissingIdentityKey, err.Error())
+	}
+
+	if xPubID, err = resolveXpubID(xPubID); err != nil {
+		return nil, err
+	}
+
+	// Get the transaction (paid by the xPub)
+	var transaction *Transaction
+	if transaction, err = getTransactionByID(ctx, "", txID, c.DefaultModelOptions()...); err != nil {
+		return nil, err
+	} else if transaction == nil {
+		return nil, ErrMissingTransaction
+	} else if !transaction.IsXpubIDAssociated(xPubID) {
+		return nil, ErrXpubIDMisMatch
+	} else if len(transaction.DraftID) == 0 {
+		return nil, ErrMissingPaymailResolution
+	}
+
+	// The draft of the payer (the resolutions of the recipients)
+	var draft *DraftTransaction
+	if draft, err = getDraftTransactionID(
+		ctx, xPubID, transaction.DraftID, c.DefaultModelOptions()...,
+	); err != nil {
+		return nil, err
+	} else if draft == nil {
+		return nil, fmt.Errorf("%w: %s", ErrDraftNotFound, transaction.DraftID)
+	}
+
+	var tx *bt.Tx
+	if tx, err = bt.NewTxFromString(transaction.Hex); err != nil {
+		return nil, err
+	}
+	acknowledgment := &PaymentAcknowledgment{
+		IdentityKey: hex.EncodeToString(privateKey.PubKey().SerialiseCompressed()),
+		Recipients:  make([]*AcknowledgedRecipient, 0),
+		SignedAt:    time.Now().UTC().Truncate(time.Second),
+		TxHex:       transaction.Hex,
+		TxID:        transaction.ID,
+	}
+	for _, output := range draft.Configuration.Outputs {
+		if output.PaymailP4 == nil || output.PaymailP4.ResolutionType != ResolutionTypeP2P ||
+			output.PaymailP4.Resolution == nil {
+			continue
+		}
+		acknowledgment.Recipients = append(acknowledgment.Recipients, &AcknowledgedRecipient{
+			OutputIndexes: resolvedOutputIndexes(tx, output.PaymailP4.Resolution),
+			Paymail:       output.PaymailP4.Alias + "@" + output.PaymailP4.Domain,
+			Resolution:    output.PaymailP4.Resolution,
+		})
+	}
+	if len(acknowledgment.Recipients) == 0 {
+		return nil, ErrMissingPaymailResolution
+	}
+
+	// Sign the digest
+	var digest [32]byte
+	if digest, err = acknowledgment.Digest(); err != nil {
+		return nil, err
+	}
+	var signature *bec.Signature
+	if signature, err = privateKey.Sign(digest[:]); err != nil {
+		return nil, err
+	}
+	acknowledgment.Signature = hex.EncodeToString(signature.Serialise())
+	return acknowledgment, nil
+}
+
+// resolvedOutputIndexes will return the indexes of the outputs paying the scripts of the resolution
+func resolvedOutputIndexes(tx *bt.Tx, resolution *PaymailResolution) []uint32 {
+	indexes := make([]uint32, 0, len(resolution.Outputs))
+	for index, output := range tx.Outputs {
+		for _, resolved := range resolution.Outputs {
+			if output.LockingScriptHexString() == resolved.Script {
+				indexes = append(indexes, uint32(index))
+				break
+			}
+		}
+	}
+	return indexes
+}
+
+// Digest will return the signed digest: SHA-256 of the JSON encoding of the acknowledgment without the signature
+func (a *PaymentAcknowledgment) Digest() ([32]byte, error) {
+	unsigned := *a
+	unsigned.Signature = ""
+	data, err := json.Marshal(&unsigned)
+	if err != nil {
+		return [32]byte{}, err
+	}
+	return sha256.Sum256(data), nil
+}
+
+// VerifyPaymentAcknowledgment will check the internal consistency of the acknowledgment and its signature
+//
+// Every acknowledged output must pay a script resolved by the recipient, every resolved script must be paid (at
+// least the requested satoshis), the signature of the recipient (if any) must be signed by its PKI key and
+// the raw response of the recipient (if kept) must match the resolution. The identity key is not checked: the
+// receiver must check that the key is the key of the payer (IE: published out-of-band).
+func VerifyPaymentAcknowledgment(acknowledgment *PaymentAcknowledgment) error {
+	if acknowledgment == nil {
+		return fmt.Errorf("%w: missing the acknowledgment", ErrInvalidPaymentAcknowledgment)
+	}
+
+	// The transaction
+	tx, err := bt.NewTxFromString(acknowledgment.TxHex)
+	if err != nil {
+		return fmt.Errorf("%w: invalid transaction: %s", ErrInvalidPaymentAcknowledgment, err.Error())
+	} else if tx.TxID() != acknowledgment.TxID {
+		return fmt.Errorf("%w: the transaction is not %s", ErrInvalidPaymentAcknowledgment, acknowledgment.TxID)
+	} else if len(acknowledgment.Recipients) == 0 {
+		return fmt.Errorf("%w: missing the recipients", ErrInvalidPaymentAcknowledgment)
+	}
+
+	// The recipients
+	for _, recipient := range acknowledgment.Recipients {
+		if err = verifyAcknowledgedRecipient(tx, recipient); err != nil {
+			return fmt.Errorf("%w: %s: %s", ErrInvalidPaymentAcknowledgment, recipient.Paymail, err.Error())
+		}
+	}
+
+	// The signature
+	var digest [32]byte
+	if digest, err = acknowledgment.Digest(); err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidPaymentAcknowledgment, err.Error())
+	}
+	var verified bool
+	if verified, err = bitcoin.VerifyMessageDER(
+		digest, acknowledgment.IdentityKey, acknowledgment.Signature,
+	); err != nil || !verified {
+		return fmt.Errorf("%w: invalid signature", ErrInvalidPaymentAcknowledgment)
+	}
+	return nil
+}
+
+// verifyAcknowledgedRecipient will check that the outputs of the recipient pay the resolved scripts
+func verifyAcknowledgedRecipient(tx *bt.Tx, recipient *AcknowledgedRecipient) error {
+	resolution := recipient.Resolution
+	if resolution == nil || len(resolution.Reference) == 0 || len(resolution.Outputs) == 0 {
+		return errors.New("missing the resolution")
+	} else if len(recipient.OutputIndexes) == 0 {
+		return errors.New("no output pays the recipient")
+	}
+
+	paid := make(map[string]bool, len(resolution.Outputs))
+	var paidSatoshis uint64
+	for _, index := range recipient.OutputIndexes {
+		if int(index) >= len(tx.Outputs) {
+			return fmt.Errorf("output %d is not in the transaction", index)
+		}
+		paidSatoshis += tx.Outputs[index].Satoshis
+		script := tx.Outputs[index].LockingScriptHexString()
+		resolved := false
+		for _, output := range resolution.Outputs {
+			if output.Script == script {
+				resolved = true
+				break
+			}
+		}
+		if !resolved {
+			return fmt.Errorf("output %d does not pay a resolved script", index)
+		}
+		paid[script] = true
+	}
+	var requestedSatoshis uint64
+	for _, output := range resolution.Outputs {
+		if !paid[output.Script] {
+			return fmt.Errorf("the resolved script %s is not paid", output.Script)
+		}
+		requestedSatoshis += output.Satoshis
+	}
+	if paidSatoshis < requestedSatoshis {
+		return fmt.Errorf("the outputs pay %d of the %d requested satoshis", paidSatoshis, requestedSatoshis)
+	}
+
+	// The signature of the recipient
+	if len(resolution.Signature) > 0 {
+		if err := resolution.verifySignature(); err != nil {
+			return err
+		}
+	}
+
+	// The raw response of the recipient
+	if len(resolution.Response) == 0 {
+		return nil
+	}
+	response := &PaymailResolution{}
+	if err := json.Unmarshal([]byte(resolution.Response), response); err != nil {
+		return fmt.Errorf("invalid response: %s", err.Error())
+	} else if response.Reference != resolution.Reference || len(response.Outputs) != len(resolution.Outputs) {
+		return errors.New("the response does not match the resolution")
+	} else if len(resolution.Signature) > 0 && response.Signature != resolution.Signature {
+		return errors.New("the response does not match the signature of the recipient")
+	}
+	for index, output := range response.Outputs {
+		if output.Script != resolution.Outputs[index].Script {
+			return errors.New("the response does not match the resolution")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package bux
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/bitcoinschema/go-bitcoin/v2"
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestClient_GetPaymentAcknowledgment will test the method GetPaymentAcknowledgment()
+func TestClient_GetPaymentAcknowledgment(t *testing.T) {
+	// t.Parallel() mocking does not allow parallel tests
+
+	identityKey, err := bitcoin.CreatePrivateKeyString()
+	require.NoError(t, err)
+
+	ctx, client, deferMe := CreateTestSQLiteClient(t, false, true,
+		WithCustomTaskManager(&taskManagerMockBase{}),
+		WithPaymailClient(newTestPaymailClient(t, []string{testDomain})),
+		WithIdentityKey(identityKey),
+	)
+	t.Cleanup(deferMe)
+
+	// The recipient signs the reference with its PKI key
+	const reference = "z0bac4ec-6f15-42de-9ef4-e60bfdabf4f7"
+	recipientKey, err := bitcoin.CreatePrivateKey()
+	require.NoError(t, err)
+	recipientSignature, err := bitcoin.SignMessage(hex.EncodeToString(recipientKey.Serialise()), reference, true)
+	require.NoError(t, err)
+	recipientPubKey := hex.EncodeToString(recipientKey.PubKey().SerialiseCompressed())
+
+	httpmock.Reset()
+	mockValidResponse(http.StatusOK, true, testDomain)
+	httpmock.RegisterResponder(http.MethodPost, testServerURL+"/p2p-payment-destination/"+testAlias+"@"+testDomain,
+		httpmock.NewStringResponder(
+			http.StatusOK,
+			`{"outputs": [{"script": "76a9143e2d1d795f8acaa7957045cc59376177eb04a3c588ac","satoshis": 1000}],"reference": "`+reference+`","signature": "`+recipientSignature+`"}`,
+		),
+	)
+	httpmock.RegisterResponder(http.MethodGet, testServerURL+"/id/"+testAlias+"@"+testDomain,
+		httpmock.NewStringResponder(
+			http.StatusOK,
+			`{"bsvalias": "1.0","handle": "`+testAlias+"@"+testDomain+`","pubkey": "`+recipientPubKey+`"}`,
+		),
+	)
+
+	fixtures := NewFixtures(t, client).WithXpub(0).WithUtxos(10000).WithDraft(&TransactionConfig{
+		Outputs: []*TransactionOutput{{To: testAlias + "@" + testDomain, Satoshis: 1000}},
+	})
+
+	// The resolution is kept on the draft
+	resolution := fixtures.Drafts[0].Configuration.Outputs[0].PaymailP4.Resolution
+	require.NotNil(t, resolution)
+	assert.Equal(t, reference, resolution.Reference)
+	assert.Equal(t, recipientSignature, resolution.Signature)
+	assert.Equal(t, recipientPubKey, resolution.PublicKey)
+	require.Len(t, resolution.Outputs, 1)
+	assert.Equal(t, "76a9143e2d1d795f8acaa7957045cc59376177eb04a3c588ac", resolution.Outputs[0].Script)
+
+	signedHex, err := fixtures.Drafts[0].SignInputs(fixtures.HDKey)
+	require.NoError(t, err)
+	transaction, err := client.RecordTransaction(ctx, fixtures.RawXpub, signedHex, fixtures.Drafts[0].ID)
+	require.NoError(t, err)
+
+	t.Run("valid acknowledgment", func(t *testing.T) {
+		acknowledgment, err := client.GetPaymentAcknowledgment(ctx, fixtures.Xpub.ID, transaction.ID)
+		require.NoError(t, err)
+		require.NotNil(t, acknowledgment)
+		assert.Equal(t, transaction.ID, acknowledgment.TxID)
+		require.Len(t, acknowledgment.Recipients, 1)
+		assert.Equal(t, testAlias+"@"+testDomain, acknowledgment.Recipients[0].Paymail)
+		assert.Equal(t, []uint32{0}, acknowledgment.Recipients[0].OutputIndexes)
+		require.NoError(t, VerifyPaymentAcknowledgment(acknowledgment))
+
+		// The counterparty receives the JSON
+		data, err := json.Marshal(acknowledgment)
+		require.NoError(t, err)
+		received := &PaymentAcknowledgment{}
+		require.NoError(t, json.Unmarshal(data, received))
+		require.NoError(t, VerifyPaymentAcknowledgment(received))
+	})
+
+	t.Run("tampered acknowledgment", func(t *testing.T) {
+		acknowledgment, err := client.GetPaymentAcknowledgment(ctx, fixtures.Xpub.ID, transaction.ID)
+		require.NoError(t, err)
+
+		acknowledgment.Recipients[0].OutputIndexes = []uint32{1}
+		require.ErrorIs(t, VerifyPaymentAcknowledgment(acknowledgment), ErrInvalidPaymentAcknowledgment)
+
+		acknowledgment.Recipients[0].OutputIndexes = []uint32{0}
+		acknowledgment.Recipients[0].Resolution.Response = `{"outputs": [],"reference": "other"}`
+		require.ErrorIs(t, VerifyPaymentAcknowledgment(acknowledgment), ErrInvalidPaymentAcknowledgment)
+
+		// Less than requested
+		acknowledgment, err = client.GetPaymentAcknowledgment(ctx, fixtures.Xpub.ID, transaction.ID)
+		require.NoError(t, err)
+		acknowledgment.Recipients[0].Resolution.Outputs[0].Satoshis = 2000
+		err = VerifyPaymentAcknowledgment(acknowledgment)
+		require.ErrorIs(t, err, ErrInvalidPaymentAcknowledgment)
+		assert.Contains(t, err.Error(), "requested satoshis")
+
+		// Not signed by the recipient
+		acknowledgment, err = client.GetPaymentAcknowledgment(ctx, fixtures.Xpub.ID, transaction.ID)
+		require.NoError(t, err)
+		acknowledgment.Recipients[0].Resolution.PublicKey = acknowledgment.IdentityKey
+		err = VerifyPaymentAcknowledgment(acknowledgment)
+		require.ErrorIs(t, err, ErrInvalidPaymentAcknowledgment)
+		assert.Contains(t, err.Error(), ErrInvalidPaymailSignature.Error())
+
+		acknowledgment, err = client.GetPaymentAcknowledgment(ctx, fixtures.Xpub.ID, transaction.ID)
+		require.NoError(t, err)
+		acknowledgment.SignedAt = acknowledgment.SignedAt.Add(-1)
+		err = VerifyPaymentAcknowledgment(acknowledgment)
+		require.ErrorIs(t, err, ErrInvalidPaymentAcknowledgment)
+		assert.Contains(t, err.Error(), "invalid signature")
+	})
+
+	t.Run("not a paymail payment", func(t *testing.T) {
+		_, err := client.GetPaymentAcknowledgment(ctx, fixtures.Xpub.ID, fixtures.Transactions[0].ID)
+		require.ErrorIs(t, err, ErrMissingPaymailResolution)
+	})
+
+	t.Run("not the payer", func(t *testing.T) {
+		_, err := client.GetPaymentAcknowledgment(ctx, testXPubID, transaction.ID)
+		require.ErrorIs(t, err, ErrXpubIDMisMatch)
+	})
+
+	t.Run("missing identity key", func(t *testing.T) {
+		client.(*Client).options.identityKey = ""
+		defer func() {
+			client.(*Client).options.identityKey = identityKey
+		}()
+		_, err := client.GetPaymentAcknowledgment(ctx, fixtures.Xpub.ID, transaction.ID)
+		require.ErrorIs(t, err, ErrMissingIdentityKey)
+	})
+}
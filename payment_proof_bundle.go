@@ -0,0 +1,278 @@
+package bux
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/libsv/go-bc"
+	"github.com/libsv/go-bk/crypto"
+	"github.com/libsv/go-bt/v2"
+)
+
+const (
+	paymentProofBundleVersion = byte(0x01) // Version of the compact encoding of the bundle
+	proofNodeDuplicate        = byte(0x01) // The node is a duplicate of the computed hash ("*")
+	proofNodeHash             = byte(0x00) // The node is a hash (32 bytes)
+)
+
+// PaymentProofBundle is a small verifiable (SPV) artifact of a mined payment: the transaction, its merkle proof
+// and the header of the block (see VerifyPaymentProofBundle)
+type PaymentProofBundle struct {
+	BlockHash   string      `json:"block_hash"`   // Hash of the block
+	BlockHeader string      `json:"block_header"` // 80-byte block header (hex)
+	BlockHeight uint64      `json:"block_height"` // Height of the block
+	MerkleProof MerkleProof `json:"merkle_proof"` // Merkle proof of the transaction in the block
+	TxHex       string      `json:"tx_hex"`       // Raw transaction (hex)
+	TxID        string      `json:"tx_id"`        // ID of the transaction
+}
+
+// GetPaymentProofBundle will return the proof bundle of a mined transaction of the xPub (IE: for the merchant
+// receiving the payment)
+//
+// Returns ErrTransactionNotMined if the transaction is not mined yet (or the proof is not synced yet)
+//
+// xPubID is the xPub ID (or the raw public xPub)
+func (c *Client) GetPaymentProofBundle(ctx context.Context, xPubID, txID string) (*PaymentProofBundle, error) {
+
+	// Check for existing NewRelic transaction
+	ctx = c.GetOrStartTxn(ctx, "get_payment_proof_bundle")
+
+	var err error
+	if xPubID, err = resolveXpubID(xPubID); err != nil {
+		return nil, err
+	}
+
+	// Get the transaction (owned by the xPub)
+	var transaction *Transaction
+	if transaction, err = getTransactionByID(ctx, "", txID, c.DefaultModelOptions()...); err != nil {
+		return nil, err
+	} else if transaction == nil {
+		return nil, ErrMissingTransaction
+	} else if !transaction.IsXpubIDAssociated(xPubID) {
+		return nil, ErrXpubIDMisMatch
+	} else if transaction.BlockHeight == 0 || len(transaction.BlockHash) == 0 ||
+		reflect.DeepEqual(transaction.MerkleProof, MerkleProof{}) {
+		return nil, ErrTransactionNotMined
+	}
+
+	// The header of the block (rebuilt from the stored block header)
+	var blockHeader *BlockHeader
+	if blockHeader, err = getBlockHeaderByHash(ctx, transaction.BlockHash, c.DefaultModelOptions()...); err != nil {
+		return nil, err
+	} else if blockHeader == nil {
+		return nil, fmt.Errorf("%w: block %s", ErrMissingBlockHeader, transaction.BlockHash)
+	}
+	var header []byte
+	if header, err = blockHeader.headerBytes(); err != nil {
+		return nil, err
+	}
+
+	bundle := &PaymentProofBundle{
+		BlockHash:   transaction.BlockHash,
+		BlockHeader: hex.EncodeToString(header),
+		BlockHeight: transaction.BlockHeight,
+		MerkleProof: transaction.MerkleProof,
+		TxHex:       transaction.Hex,
+		TxID:        transaction.ID,
+	}
+	bundle.MerkleProof.TxOrID = transaction.ID
+	return bundle, nil
+}
+
+// headerBytes will return the 80-byte header rebuilt from the stored fields (the hash must match the block hash)
+func (m *BlockHeader) headerBytes() ([]byte, error) {
+	prevBlock, err := hex.DecodeString(m.HashPreviousBlock)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid previous block hash %s", ErrInvalidBlockHeader, m.HashPreviousBlock)
+	}
+	var merkleRoot, bits []byte
+	if merkleRoot, err = hex.DecodeString(m.HashMerkleRoot); err != nil {
+		return nil, fmt.Errorf("%w: invalid merkle root %s", ErrInvalidBlockHeader, m.HashMerkleRoot)
+	} else if bits, err = hex.DecodeString(m.Bits); err != nil {
+		return nil, fmt.Errorf("%w: invalid bits %s", ErrInvalidBlockHeader, m.Bits)
+	}
+	header := (&bc.BlockHeader{
+		Bits:           bits,
+		HashMerkleRoot: merkleRoot,
+		HashPrevBlock:  prevBlock,
+		Nonce:          m.Nonce,
+		Time:           m.Time,
+		Version:        m.Version,
+	}).Bytes()
+	if len(header) != 80 || blockHeaderHash(header) != m.ID {
+		return nil, fmt.Errorf("%w: the stored header of the block %s cannot be rebuilt", ErrInvalidBlockHeader, m.ID)
+	}
+	return header, nil
+}
+
+// blockHeaderHash will return the hash (display hex) of the 80-byte header
+func blockHeaderHash(header []byte) string {
+	return hex.EncodeToString(bt.ReverseBytes(crypto.Sha256d(header)))
+}
+
+// VerifyPaymentProofBundle will check the merkle proof of the transaction against the block header and the
+// proof-of-work of the header
+//
+// The header is not checked against the chain: the receiver must check that the block is in the best chain
+// (IE: using the block hash and height with its own headers)
+func VerifyPaymentProofBundle(bundle *PaymentProofBundle) error {
+	if bundle == nil {
+		return fmt.Errorf("%w: missing the bundle", ErrInvalidPaymentProof)
+	}
+
+	// The transaction
+	tx, err := bt.NewTxFromString(bundle.TxHex)
+	if err != nil {
+		return fmt.Errorf("%w: invalid transaction: %s", ErrInvalidPaymentProof, err.Error())
+	}
+	txID := tx.TxID()
+	if len(bundle.TxID) > 0 && bundle.TxID != txID {
+		return fmt.Errorf("%w: the transaction is not %s", ErrInvalidPaymentProof, bundle.TxID)
+	} else if len(bundle.MerkleProof.TxOrID) > 0 && !strings.EqualFold(bundle.MerkleProof.TxOrID, txID) &&
+		!strings.EqualFold(bundle.MerkleProof.TxOrID, bundle.TxHex) {
+		return fmt.Errorf("%w: the merkle proof is not of the transaction %s", ErrInvalidPaymentProof, txID)
+	}
+
+	// The header and its proof-of-work
+	var header *bc.BlockHeader
+	if header, err = bc.NewBlockHeaderFromStr(bundle.BlockHeader); err != nil {
+		return fmt.Errorf("%w: invalid block header: %s", ErrInvalidPaymentProof, err.Error())
+	}
+	hash := blockHeaderHash(header.Bytes())
+	if len(bundle.BlockHash) > 0 && !strings.EqualFold(bundle.BlockHash, hash) {
+		return fmt.Errorf("%w: the block header is not the block %s", ErrInvalidPaymentProof, bundle.BlockHash)
+	} else if !header.Valid() {
+		return fmt.Errorf("%w: insufficient proof-of-work of the block %s", ErrInvalidPaymentProof, hash)
+	}
+
+	// The merkle proof
+	var merkleRoot string
+	if merkleRoot, err = bundle.MerkleProof.merkleRoot(txID); err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidPaymentProof, err.Error())
+	} else if merkleRoot != header.HashMerkleRootStr() {
+		return fmt.Errorf(
+			"%w: merkle root %s is not the merkle root of the block %s", ErrInvalidPaymentProof, merkleRoot, hash,
+		)
+	}
+	return nil
+}
+
+// Bytes will return the compact binary encoding of the bundle
+//
+// version (1 byte) | tx length (varint) | tx | header (80 bytes) | block height (varint) | index (varint) |
+// nodes (varint) | per node: 0x00 + hash (32 bytes) or 0x01 (duplicate)
+func (b *PaymentProofBundle) Bytes() ([]byte, error) {
+	tx, err := hex.DecodeString(b.TxHex)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid transaction hex", ErrInvalidPaymentProof)
+	}
+	var header []byte
+	if header, err = hex.DecodeString(b.BlockHeader); err != nil || len(header) != 80 {
+		return nil, fmt.Errorf("%w: invalid block header", ErrInvalidPaymentProof)
+	}
+
+	buffer := []byte{paymentProofBundleVersion}
+	buffer = append(buffer, bt.VarInt(len(tx)).Bytes()...)
+	buffer = append(buffer, tx...)
+	buffer = append(buffer, header...)
+	buffer = append(buffer, bt.VarInt(b.BlockHeight).Bytes()...)
+	buffer = append(buffer, bt.VarInt(b.MerkleProof.Index).Bytes()...)
+	buffer = append(buffer, bt.VarInt(len(b.MerkleProof.Nodes)).Bytes()...)
+	for _, node := range b.MerkleProof.Nodes {
+		if node == "*" {
+			buffer = append(buffer, proofNodeDuplicate)
+			continue
+		}
+		var hash []byte
+		if hash, err = hex.DecodeString(node); err != nil || len(hash) != 32 {
+			return nil, fmt.Errorf("%w: invalid node %s", ErrInvalidPaymentProof, node)
+		}
+		buffer = append(append(buffer, proofNodeHash), bt.ReverseBytes(hash)...)
+	}
+	return buffer, nil
+}
+
+// Hex will return the compact encoding of the bundle (hex)
+func (b *PaymentProofBundle) Hex() (string, error) {
+	data, err := b.Bytes()
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(data), nil
+}
+
+// NewPaymentProofBundleFromBytes will decode the compact binary encoding of a bundle (see PaymentProofBundle.Bytes)
+func NewPaymentProofBundleFromBytes(data []byte) (*PaymentProofBundle, error) {
+	invalid := fmt.Errorf("%w: invalid encoding", ErrInvalidPaymentProof)
+	if len(data) == 0 || data[0] != paymentProofBundleVersion {
+		return nil, invalid
+	}
+	data = data[1:]
+
+	// readVarInt will read a varint and move to the next field
+	readVarInt := func() (uint64, bool) {
+		if len(data) == 0 {
+			return 0, false
+		}
+		value, size := bt.NewVarIntFromBytes(data)
+		if size > len(data) {
+			return 0, false
+		}
+		data = data[size:]
+		return uint64(value), true
+	}
+
+	txLength, ok := readVarInt()
+	if !ok || txLength > uint64(len(data)) || uint64(len(data))-txLength < 80 {
+		return nil, invalid
+	}
+	bundle := &PaymentProofBundle{
+		TxHex:       hex.EncodeToString(data[:txLength]),
+		BlockHeader: hex.EncodeToString(data[txLength : txLength+80]),
+		BlockHash:   blockHeaderHash(data[txLength : txLength+80]),
+	}
+	tx, err := bt.NewTxFromBytes(data[:txLength])
+	if err != nil {
+		return nil, invalid
+	}
+	bundle.TxID = tx.TxID()
+	data = data[txLength+80:]
+
+	var nodes uint64
+	if bundle.BlockHeight, ok = readVarInt(); !ok {
+		return nil, invalid
+	} else if bundle.MerkleProof.Index, ok = readVarInt(); !ok {
+		return nil, invalid
+	} else if nodes, ok = readVarInt(); !ok || nodes > uint64(len(data)) {
+		return nil, invalid
+	}
+	bundle.MerkleProof.Nodes = make([]string, 0, nodes)
+	for index := uint64(0); index < nodes; index++ {
+		if len(data) > 0 && data[0] == proofNodeDuplicate {
+			bundle.MerkleProof.Nodes = append(bundle.MerkleProof.Nodes, "*")
+			data = data[1:]
+		} else if len(data) > 32 && data[0] == proofNodeHash {
+			bundle.MerkleProof.Nodes = append(bundle.MerkleProof.Nodes, hex.EncodeToString(bt.ReverseBytes(data[1:33])))
+			data = data[33:]
+		} else {
+			return nil, invalid
+		}
+	}
+	if len(data) > 0 {
+		return nil, invalid
+	}
+	bundle.MerkleProof.TxOrID = bundle.TxID
+	return bundle, nil
+}
+
+// NewPaymentProofBundleFromHex will decode the compact encoding of a bundle (hex, see PaymentProofBundle.Hex)
+func NewPaymentProofBundleFromHex(data string) (*PaymentProofBundle, error) {
+	decoded, err := hex.DecodeString(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid hex", ErrInvalidPaymentProof)
+	}
+	return NewPaymentProofBundleFromBytes(decoded)
+}
@@ -0,0 +1,150 @@
+package bux
+
+import (
+	"context"
+	"encoding/hex"
+	"testing"
+
+	"github.com/libsv/go-bc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newMinedTestPayment will return a client with a transaction of the xPub mined in a block with a valid
+// proof-of-work (the header is saved)
+func newMinedTestPayment(t *testing.T) (context.Context, ClientInterface, *Fixtures) {
+	ctx, client, deferMe := CreateTestSQLiteClient(t, false, true, WithCustomTaskManager(&taskManagerMockBase{}))
+	t.Cleanup(deferMe)
+	fixtures := NewFixtures(t, client).WithXpub(0).WithUtxos(100000)
+	transaction := fixtures.Transactions[0]
+
+	proof := MerkleProof{
+		Index: 1,
+		Nodes: []string{
+			"b9ef07a62553ef8b0898a79c291b92c60f7932260888bde0dab2dd2610d8668e",
+			"*",
+		},
+	}
+	merkleRoot, err := proof.merkleRoot(transaction.ID)
+	require.NoError(t, err)
+	root, err := hex.DecodeString(merkleRoot)
+	require.NoError(t, err)
+	bits, err := hex.DecodeString(testEasyBits)
+	require.NoError(t, err)
+
+	header := bc.BlockHeader{
+		Bits:           bits,
+		HashMerkleRoot: root,
+		HashPrevBlock:  make([]byte, 32),
+		Time:           1600000000,
+		Version:        1,
+	}
+	for !header.Valid() {
+		header.Nonce++
+	}
+	blockHash := blockHeaderHash(header.Bytes())
+	require.NoError(t, newBlockHeader(blockHash, 800000, header, client.DefaultModelOptions(New())...).Save(ctx))
+
+	transaction.BlockHash = blockHash
+	transaction.BlockHeight = 800000
+	transaction.MerkleProof = proof
+	require.NoError(t, transaction.Save(ctx))
+	return ctx, client, fixtures
+}
+
+// TestClient_GetPaymentProofBundle will test the method GetPaymentProofBundle()
+func TestClient_GetPaymentProofBundle(t *testing.T) {
+
+	t.Run("mined payment", func(t *testing.T) {
+		ctx, client, fixtures := newMinedTestPayment(t)
+		transaction := fixtures.Transactions[0]
+
+		bundle, err := client.GetPaymentProofBundle(ctx, fixtures.Xpub.ID, transaction.ID)
+		require.NoError(t, err)
+		assert.Equal(t, transaction.ID, bundle.TxID)
+		assert.Equal(t, transaction.Hex, bundle.TxHex)
+		assert.Equal(t, transaction.BlockHash, bundle.BlockHash)
+		assert.Equal(t, uint64(800000), bundle.BlockHeight)
+		assert.Len(t, bundle.BlockHeader, 160)
+		require.NoError(t, VerifyPaymentProofBundle(bundle))
+	})
+
+	t.Run("not mined", func(t *testing.T) {
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, true, WithCustomTaskManager(&taskManagerMockBase{}))
+		t.Cleanup(deferMe)
+		fixtures := NewFixtures(t, client).WithXpub(0).WithUtxos(100000)
+
+		_, err := client.GetPaymentProofBundle(ctx, fixtures.Xpub.ID, fixtures.Transactions[0].ID)
+		assert.ErrorIs(t, err, ErrTransactionNotMined)
+	})
+
+	t.Run("other xPub", func(t *testing.T) {
+		ctx, client, fixtures := newMinedTestPayment(t)
+
+		_, err := client.GetPaymentProofBundle(ctx, testXPubID, fixtures.Transactions[0].ID)
+		assert.ErrorIs(t, err, ErrXpubIDMisMatch)
+	})
+
+	t.Run("missing block header", func(t *testing.T) {
+		ctx, client, fixtures := newMinedTestPayment(t)
+		transaction := fixtures.Transactions[0]
+		transaction.BlockHash = testBlockHash
+		require.NoError(t, transaction.Save(ctx))
+
+		_, err := client.GetPaymentProofBundle(ctx, fixtures.Xpub.ID, transaction.ID)
+		assert.ErrorIs(t, err, ErrMissingBlockHeader)
+	})
+}
+
+// TestVerifyPaymentProofBundle will test the method VerifyPaymentProofBundle() and the compact encoding
+func TestVerifyPaymentProofBundle(t *testing.T) {
+	ctx, client, fixtures := newMinedTestPayment(t)
+	bundle, err := client.GetPaymentProofBundle(ctx, fixtures.Xpub.ID, fixtures.Transactions[0].ID)
+	require.NoError(t, err)
+
+	t.Run("compact encoding", func(t *testing.T) {
+		encoded, encodeErr := bundle.Hex()
+		require.NoError(t, encodeErr)
+
+		decoded, decodeErr := NewPaymentProofBundleFromHex(encoded)
+		require.NoError(t, decodeErr)
+		assert.Equal(t, bundle.TxID, decoded.TxID)
+		assert.Equal(t, bundle.TxHex, decoded.TxHex)
+		assert.Equal(t, bundle.BlockHash, decoded.BlockHash)
+		assert.Equal(t, bundle.BlockHeader, decoded.BlockHeader)
+		assert.Equal(t, bundle.BlockHeight, decoded.BlockHeight)
+		assert.Equal(t, bundle.MerkleProof.Index, decoded.MerkleProof.Index)
+		assert.Equal(t, bundle.MerkleProof.Nodes, decoded.MerkleProof.Nodes)
+		require.NoError(t, VerifyPaymentProofBundle(decoded))
+
+		_, decodeErr = NewPaymentProofBundleFromHex(encoded[:len(encoded)-2])
+		assert.ErrorIs(t, decodeErr, ErrInvalidPaymentProof)
+		_, decodeErr = NewPaymentProofBundleFromHex("02" + encoded[2:])
+		assert.ErrorIs(t, decodeErr, ErrInvalidPaymentProof)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		otherTx := *bundle
+		otherTx.TxHex = testTxHex
+		otherTx.TxID = ""
+		otherTx.MerkleProof.TxOrID = ""
+
+		otherNode := *bundle
+		otherNode.MerkleProof.Nodes = []string{testTxID, "*"}
+
+		otherBlock := *bundle
+		otherBlock.BlockHash = testBlockHash
+
+		header, headerErr := bc.NewBlockHeaderFromStr(bundle.BlockHeader)
+		require.NoError(t, headerErr)
+		header.Bits, headerErr = hex.DecodeString("1d00ffff")
+		require.NoError(t, headerErr)
+		noWork := *bundle
+		noWork.BlockHash = ""
+		noWork.BlockHeader = header.String()
+
+		for _, invalid := range []*PaymentProofBundle{nil, &otherTx, &otherNode, &otherBlock, &noWork} {
+			assert.ErrorIs(t, VerifyPaymentProofBundle(invalid), ErrInvalidPaymentProof)
+		}
+	})
+}
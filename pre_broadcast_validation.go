@@ -0,0 +1,94 @@
+package bux
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/libsv/go-bt/v2"
+	"github.com/libsv/go-bt/v2/bscript"
+	"github.com/libsv/go-bt/v2/bscript/interpreter"
+)
+
+// InvalidTransactionError is when the pre-broadcast validation rejects the transaction (see WithPreBroadcastValidation)
+type InvalidTransactionError struct {
+	InputIndex int    `json:"input_index"` // Index of the invalid input
+	Reason     string `json:"reason"`      // Reason given by the script verification
+}
+
+// Error will return the invalid input with the reason
+func (e *InvalidTransactionError) Error() string {
+	return fmt.Sprintf("%s: input %d (%s)", ErrInvalidTransaction.Error(), e.InputIndex, e.Reason)
+}
+
+// Unwrap will return ErrInvalidTransaction (for errors.Is)
+func (e *InvalidTransactionError) Unwrap() error {
+	return ErrInvalidTransaction
+}
+
+// validateBeforeBroadcast will execute the scripts of the inputs spending the utxos of bux
+//
+// The external inputs are skipped (the previous outputs are not known)
+func validateBeforeBroadcast(ctx context.Context, transaction *Transaction) error {
+	tx := transaction.parsedTx
+	if tx == nil {
+		return ErrMissingTxHex
+	}
+
+	opts := transaction.GetOptions(false)
+	for index, input := range tx.Inputs {
+		utxo, err := transaction.transactionService.getUtxo(
+			ctx, hex.EncodeToString(input.PreviousTxID()), input.PreviousTxOutIndex, opts...,
+		)
+		if err != nil {
+			return err
+		} else if utxo == nil {
+			continue
+		}
+
+		if err = verifyInputScript(tx, index, utxo.ScriptPubKey, utxo.Satoshis); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// verifySignedHex will execute the scripts of the inputs of the payload (the signatures of the signed transaction)
+func (p *SigningPayload) verifySignedHex(signedHex string) error {
+	tx, err := bt.NewTxFromString(signedHex)
+	if err != nil {
+		return err
+	}
+
+	for index, input := range p.Inputs {
+		if index >= len(tx.Inputs) {
+			return fmt.Errorf("%w: %d inputs (expected %d)", ErrSignedDraftMismatch, len(tx.Inputs), len(p.Inputs))
+		}
+		if err = verifyInputScript(tx, index, input.LockingScript, input.Satoshis); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// verifyInputScript will execute the unlocking script of the input against the locking script of the spent output
+func verifyInputScript(tx *bt.Tx, index int, lockingScriptHex string, satoshis uint64) error {
+	lockingScript, err := bscript.NewFromHexString(lockingScriptHex)
+	if err != nil {
+		return err
+	}
+
+	if err = interpreter.NewEngine().Execute(
+		interpreter.WithTx(tx, index, &bt.Output{
+			LockingScript: lockingScript,
+			Satoshis:      satoshis,
+		}),
+		interpreter.WithForkID(),
+		interpreter.WithAfterGenesis(),
+	); err != nil {
+		return &InvalidTransactionError{InputIndex: index, Reason: err.Error()}
+	}
+	return nil
+}
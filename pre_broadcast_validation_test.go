@@ -0,0 +1,74 @@
+package bux
+
+import (
+	"context"
+	"testing"
+
+	"github.com/bitcoinschema/go-bitcoin/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestClient_preBroadcastValidation will test the option WithPreBroadcastValidation()
+func TestClient_preBroadcastValidation(t *testing.T) {
+	t.Parallel()
+
+	newDraft := func(t *testing.T, opts ...ClientOps) (context.Context, ClientInterface, *Fixtures) {
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, true,
+			append(opts, WithCustomTaskManager(&taskManagerMockBase{}))...,
+		)
+		t.Cleanup(deferMe)
+
+		fixtures := NewFixtures(t, client).WithXpub(0).WithUtxos(10000).WithDraft(&TransactionConfig{
+			Outputs: []*TransactionOutput{{
+				To:       testExternalAddress,
+				Satoshis: 1000,
+			}},
+		})
+		return ctx, client, fixtures
+	}
+
+	t.Run("valid signatures", func(t *testing.T) {
+		ctx, client, fixtures := newDraft(t, WithPreBroadcastValidation())
+		draft := fixtures.Drafts[0]
+
+		signedHex, err := draft.SignInputs(fixtures.HDKey)
+		require.NoError(t, err)
+
+		var transaction *Transaction
+		transaction, err = client.RecordTransaction(ctx, fixtures.RawXpub, signedHex, draft.ID)
+		require.NoError(t, err)
+		require.NotNil(t, transaction)
+	})
+
+	t.Run("invalid signature, utxo is not spent", func(t *testing.T) {
+		ctx, client, fixtures := newDraft(t, WithPreBroadcastValidation())
+		draft := fixtures.Drafts[0]
+
+		// Signed by another key (IE: a broken external signer)
+		otherKey, err := bitcoin.GenerateHDKey(bitcoin.SecureSeedLength)
+		require.NoError(t, err)
+		var signedHex string
+		signedHex, err = draft.SignInputs(otherKey)
+		require.NoError(t, err)
+
+		var transaction *Transaction
+		transaction, err = client.RecordTransaction(ctx, fixtures.RawXpub, signedHex, draft.ID)
+		require.ErrorIs(t, err, ErrInvalidTransaction)
+		assert.Nil(t, transaction)
+
+		var invalidErr *InvalidTransactionError
+		require.ErrorAs(t, err, &invalidErr)
+		assert.Equal(t, 0, invalidErr.InputIndex)
+
+		var utxo *Utxo
+		utxo, err = client.GetUtxoByTransactionID(ctx, fixtures.Utxos[0].TransactionID, 0)
+		require.NoError(t, err)
+		assert.False(t, utxo.SpendingTxID.Valid)
+	})
+
+	t.Run("disabled by default", func(t *testing.T) {
+		_, client, _ := newDraft(t)
+		assert.False(t, client.ConfigSummary().PreBroadcastCheck)
+	})
+}
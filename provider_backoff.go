@@ -0,0 +1,139 @@
+package bux
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/BuxOrg/bux/chainstate"
+	"github.com/go-resty/resty/v2"
+	"github.com/mrz1836/go-cachestore"
+)
+
+// providerBackoff is the cached backoff of a rate limited provider
+type providerBackoff struct {
+	Until time.Time `json:"until"`
+}
+
+// providerBackoffStore stores the backoff of the rate limited providers in the cachestore (see chainstate.BackoffStore)
+//
+// The backoff is shared by all the instances using the same cachestore
+type providerBackoffStore struct {
+	client ClientInterface
+}
+
+// GetBackoff will return the backoff time of the provider (zero if none)
+func (s *providerBackoffStore) GetBackoff(ctx context.Context, provider string) (time.Time, error) {
+	cs := s.client.Cachestore()
+	if cs == nil || cs.Engine().IsEmpty() {
+		return time.Time{}, nil
+	}
+
+	backoff := new(providerBackoff)
+	if err := cs.GetModel(ctx, cacheKeyProviderBackoff+provider, backoff); err != nil {
+		if errors.Is(err, cachestore.ErrKeyNotFound) {
+			return time.Time{}, nil
+		}
+		return time.Time{}, err
+	}
+	return backoff.Until, nil
+}
+
+// SetBackoff will set the backoff time of the provider (an existing later time is kept)
+func (s *providerBackoffStore) SetBackoff(ctx context.Context, provider string, until time.Time) error {
+	cs := s.client.Cachestore()
+	if cs == nil || cs.Engine().IsEmpty() {
+		return nil
+	}
+
+	ttl := time.Until(until)
+	if ttl <= 0 {
+		return nil
+	}
+	if current, err := s.GetBackoff(ctx, provider); err != nil {
+		return err
+	} else if !current.Before(until) {
+		return nil
+	}
+	return cs.SetModel(ctx, cacheKeyProviderBackoff+provider, &providerBackoff{Until: until.UTC()}, ttl)
+}
+
+// paymailBackoffProvider will return the backoff provider name of the paymail endpoint (by host)
+func paymailBackoffProvider(endpoint string) string {
+	host := endpoint
+	if u, err := url.Parse(endpoint); err == nil && len(u.Host) > 0 {
+		host = u.Host
+	}
+	return paymailProviderPrefix + strings.ToLower(host)
+}
+
+// getPaymailBackoff will return the backoff time of the paymail endpoint (zero if the provider is available)
+func getPaymailBackoff(ctx context.Context, client ClientInterface, endpoint string) time.Time {
+	if client == nil {
+		return time.Time{}
+	}
+	until, err := (&providerBackoffStore{client: client}).GetBackoff(ctx, paymailBackoffProvider(endpoint))
+	if err != nil || !until.After(time.Now()) {
+		return time.Time{}
+	}
+	return until
+}
+
+// setPaymailBackoff will set the backoff time of the paymail endpoint
+func setPaymailBackoff(ctx context.Context, client ClientInterface, endpoint string, until time.Time) {
+	if client == nil {
+		return
+	}
+	if err := (&providerBackoffStore{client: client}).SetBackoff(
+		ctx, paymailBackoffProvider(endpoint), until,
+	); err != nil {
+		client.Logger().Error(ctx, "failed setting the backoff of paymail provider "+endpoint+": "+err.Error())
+	}
+}
+
+// newPaymailHTTPClient will return the HTTP client of the paymail client (same defaults as go-paymail)
+//
+// The rate limit headers of the responses are recorded as the backoff of the paymail provider
+func (c *Client) newPaymailHTTPClient() *resty.Client {
+	httpClient := resty.New()
+	httpClient.SetTimeout(defaultPaymailHTTPTimeout)
+	httpClient.SetRetryCount(defaultPaymailRetryCount)
+	httpClient.OnAfterResponse(func(_ *resty.Client, resp *resty.Response) error {
+		if resp == nil || resp.RawResponse == nil || resp.Request == nil {
+			return nil
+		}
+		now := time.Now()
+		if backoff, found := chainstate.BackoffFromResponse(resp.RawResponse, now); found {
+			setPaymailBackoff(resp.Request.Context(), c, resp.Request.URL, now.Add(backoff))
+		}
+		return nil
+	})
+	return httpClient
+}
+
+// GetProviderStatus will return the status of the broadcast providers and the paymail providers (by host)
+//
+// The status of the given paymail hosts is returned after the broadcast providers (sorted by name)
+func (c *Client) GetProviderStatus(ctx context.Context, paymailHosts ...string) []*chainstate.ProviderStatus {
+	var statuses []*chainstate.ProviderStatus
+	if cs := c.Chainstate(); cs != nil {
+		statuses = cs.ProviderStatus(ctx)
+	}
+
+	paymailStatuses := make([]*chainstate.ProviderStatus, 0, len(paymailHosts))
+	for _, host := range paymailHosts {
+		status := &chainstate.ProviderStatus{Name: paymailBackoffProvider(host)}
+		if until := getPaymailBackoff(ctx, c, host); !until.IsZero() {
+			status.BackoffUntil = &until
+			status.InBackoff = true
+		}
+		paymailStatuses = append(paymailStatuses, status)
+	}
+	sort.Slice(paymailStatuses, func(i, j int) bool {
+		return paymailStatuses[i].Name < paymailStatuses[j].Name
+	})
+	return append(statuses, paymailStatuses...)
+}
@@ -0,0 +1,120 @@
+package bux
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test_providerBackoffStore will test the cachestore backoff store
+func Test_providerBackoffStore(t *testing.T) {
+	ctx, client, deferMe := CreateTestSQLiteClient(t, false, false, WithCustomTaskManager(&taskManagerMockBase{}))
+	defer deferMe()
+
+	store := &providerBackoffStore{client: client}
+
+	t.Run("no backoff", func(t *testing.T) {
+		until, err := store.GetBackoff(ctx, "unknown")
+		require.NoError(t, err)
+		assert.True(t, until.IsZero())
+	})
+
+	t.Run("later backoff is kept", func(t *testing.T) {
+		later := time.Now().Add(2 * time.Minute)
+		require.NoError(t, store.SetBackoff(ctx, "provider", later))
+		require.NoError(t, store.SetBackoff(ctx, "provider", time.Now().Add(time.Minute)))
+
+		until, err := store.GetBackoff(ctx, "provider")
+		require.NoError(t, err)
+		assert.WithinDuration(t, later, until, time.Second)
+	})
+
+	t.Run("past backoff is ignored", func(t *testing.T) {
+		require.NoError(t, store.SetBackoff(ctx, "past", time.Now().Add(-time.Minute)))
+
+		until, err := store.GetBackoff(ctx, "past")
+		require.NoError(t, err)
+		assert.True(t, until.IsZero())
+	})
+}
+
+// TestClient_newPaymailHTTPClient will test recording the backoff of a mocked 429 response
+func TestClient_newPaymailHTTPClient(t *testing.T) {
+	ctx, client, deferMe := CreateTestSQLiteClient(t, false, false, WithCustomTaskManager(&taskManagerMockBase{}))
+	defer deferMe()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Retry-After", "120")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	resp, err := client.(*Client).newPaymailHTTPClient().SetRetryCount(0).R().
+		SetContext(ctx).Post(server.URL + "/receive-transaction/tester@test.com")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode())
+
+	statuses := client.GetProviderStatus(ctx, server.URL)
+	require.NotEmpty(t, statuses)
+	status := statuses[len(statuses)-1]
+	assert.Equal(t, paymailBackoffProvider(server.URL), status.Name)
+	assert.True(t, status.InBackoff)
+	require.NotNil(t, status.BackoffUntil)
+	assert.WithinDuration(t, time.Now().Add(2*time.Minute), *status.BackoffUntil, 5*time.Second)
+}
+
+// Test_finalizeP2PTransaction_backoff will test skipping the rate limited paymail providers
+func Test_finalizeP2PTransaction_backoff(t *testing.T) {
+	// t.Parallel() mocking does not allow parallel tests
+
+	ctx, client, deferMe := CreateTestSQLiteClient(t, false, false, WithCustomTaskManager(&taskManagerMockBase{}))
+	defer deferMe()
+
+	p4 := &PaymailP4{
+		Alias:  testAlias,
+		Domain: testDomain,
+		ReceiveEndpoints: []*PaymailReceiveEndpoint{
+			{URL: testServerURL + "/receive-transaction/{alias}@{domain.tld}"},
+			{URL: testServerURL + "/receive-transaction-v2/{alias}@{domain.tld}"},
+		},
+		ReferenceID: "z0bac4ec-6f15-42de-9ef4-e60bfdabf4f7",
+	}
+	transaction := &Transaction{
+		TransactionBase: TransactionBase{Hex: testTxHex},
+		Model:           *NewBaseModel(ModelTransaction, client.DefaultModelOptions()...),
+	}
+	pm := newTestPaymailClient(t, []string{testDomain})
+
+	httpmock.Reset()
+	httpmock.RegisterResponder(http.MethodPost, testServerURL+"/receive-transaction/"+testAlias+"@"+testDomain,
+		httpmock.NewStringResponder(http.StatusTooManyRequests, `{"message": "slow down"}`),
+	)
+	httpmock.RegisterResponder(http.MethodPost, testServerURL+"/receive-transaction-v2/"+testAlias+"@"+testDomain,
+		httpmock.NewStringResponder(http.StatusOK, `{"txid": "`+testTxID+`", "note": "thanks"}`),
+	)
+
+	// Rate limited: the other endpoint of the same provider is not attempted
+	payload, attempts, err := finalizeP2PTransaction(ctx, pm, p4, transaction)
+	require.Error(t, err)
+	assert.NotErrorIs(t, err, ErrPaymailProviderInBackoff)
+	assert.Nil(t, payload)
+	require.Len(t, attempts, 1)
+	assert.Contains(t, attempts[0].StatusMessage, "429")
+
+	statuses := client.GetProviderStatus(ctx, testServerURL)
+	require.NotEmpty(t, statuses)
+	assert.True(t, statuses[len(statuses)-1].InBackoff)
+
+	// In backoff: nothing is attempted (deferred)
+	calls := httpmock.GetTotalCallCount()
+	payload, attempts, err = finalizeP2PTransaction(ctx, pm, p4, transaction)
+	require.ErrorIs(t, err, ErrPaymailProviderInBackoff)
+	assert.Nil(t, payload)
+	assert.Empty(t, attempts)
+	assert.Equal(t, calls, httpmock.GetTotalCallCount())
+}
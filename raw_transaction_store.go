@@ -0,0 +1,45 @@
+package bux
+
+import (
+	"context"
+	"errors"
+
+	"github.com/mrz1836/go-cachestore"
+)
+
+// cachedRawTransaction is a cached raw transaction fetched from the chainstate providers
+type cachedRawTransaction struct {
+	Hex string `json:"hex"`
+}
+
+// rawTransactionStore caches the raw transactions fetched by chainstate in the cachestore
+// (see chainstate.RawTransactionStore)
+type rawTransactionStore struct {
+	client ClientInterface
+}
+
+// GetRawTransaction will return the cached raw transaction (empty if not cached)
+func (s *rawTransactionStore) GetRawTransaction(ctx context.Context, id string) (string, error) {
+	cs := s.client.Cachestore()
+	if cs == nil || cs.Engine().IsEmpty() {
+		return "", nil
+	}
+
+	transaction := new(cachedRawTransaction)
+	if err := cs.GetModel(ctx, cacheKeyRawTransaction+id, transaction); err != nil {
+		if errors.Is(err, cachestore.ErrKeyNotFound) {
+			return "", nil
+		}
+		return "", err
+	}
+	return transaction.Hex, nil
+}
+
+// SetRawTransaction will cache the raw transaction (defaultRawTransactionCacheTTL)
+func (s *rawTransactionStore) SetRawTransaction(ctx context.Context, id, txHex string) error {
+	cs := s.client.Cachestore()
+	if cs == nil || cs.Engine().IsEmpty() {
+		return nil
+	}
+	return cs.SetModel(ctx, cacheKeyRawTransaction+id, &cachedRawTransaction{Hex: txHex}, defaultRawTransactionCacheTTL)
+}
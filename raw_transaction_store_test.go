@@ -0,0 +1,25 @@
+package bux
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test_rawTransactionStore will test the cachestore raw transaction store
+func Test_rawTransactionStore(t *testing.T) {
+	ctx, client, deferMe := CreateTestSQLiteClient(t, false, false, WithCustomTaskManager(&taskManagerMockBase{}))
+	defer deferMe()
+
+	store := &rawTransactionStore{client: client}
+
+	txHex, err := store.GetRawTransaction(ctx, testTxID)
+	require.NoError(t, err)
+	assert.Empty(t, txHex)
+
+	require.NoError(t, store.SetRawTransaction(ctx, testTxID, testTxHex))
+	txHex, err = store.GetRawTransaction(ctx, testTxID)
+	require.NoError(t, err)
+	assert.Equal(t, testTxHex, txHex)
+}
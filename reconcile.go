@@ -0,0 +1,421 @@
+package bux
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/mrz1836/go-datastore"
+)
+
+// UnspentOutputsProvider is a source of the on-chain unspent outputs for the reconciliation (see WithReconciliation)
+type UnspentOutputsProvider interface {
+	// GetUnspentOutputs will return the outputs paying one of the locking scripts that are unspent on-chain
+	GetUnspentOutputs(ctx context.Context, lockingScripts []string) ([]*ChainOutput, error)
+}
+
+// ChainOutput is an unspent output as seen on-chain by the provider
+type ChainOutput struct {
+	LockingScript string `json:"locking_script"` // Locking script (hex) of the output
+	OutputIndex   uint32 `json:"output_index"`   // Index of the output in the transaction
+	Satoshis      uint64 `json:"satoshis"`       // Value of the output
+	TransactionID string `json:"transaction_id"` // ID of the transaction
+}
+
+// ReconcileOptions are the options of a reconciliation (see ReconcileXpub)
+//
+// The fixes are applied per category only if the flag is set, otherwise the report is read-only
+type ReconcileOptions struct {
+	BatchSize          int                               `json:"batch_size"`           // Locking scripts per provider request (default 20)
+	FixMissing         bool                              `json:"fix_missing"`          // Import the transactions of the missing outputs
+	FixPhantoms        bool                              `json:"fix_phantoms"`         // Freeze the utxos that are not unspent on-chain
+	FixValueMismatches bool                              `json:"fix_value_mismatches"` // Set the value of the utxos to the on-chain value
+	OnProgress         func(progress *ReconcileProgress) `json:"-"`                    // Called after every provider request
+	PageSize           int                               `json:"page_size"`            // Utxos (and destinations) loaded per page (default 1000)
+	RecentDestinations time.Duration                     `json:"recent_destinations"`  // Window of the destinations checked for unknown outputs (default 30 days)
+}
+
+// ReconcileProgress is the progress of a reconciliation (see ReconcileOptions.OnProgress)
+type ReconcileProgress struct {
+	Destinations int `json:"destinations"` // Destinations checked
+	Requests     int `json:"requests"`     // Requests sent to the provider
+	Utxos        int `json:"utxos"`        // Utxos checked
+}
+
+// ReconcileOutput is an output of the xPub where bux and the chain disagree
+type ReconcileOutput struct {
+	ChainSatoshis uint64 `json:"chain_satoshis"` // Value on-chain (0 for a phantom)
+	Fixed         bool   `json:"fixed"`          // True if the fix was applied
+	LockingScript string `json:"locking_script"` // Locking script (hex) of the output
+	OutputIndex   uint32 `json:"output_index"`   // Index of the output in the transaction
+	Satoshis      uint64 `json:"satoshis"`       // Value in bux (0 for a missing output)
+	TransactionID string `json:"transaction_id"` // ID of the transaction
+}
+
+// ReconcileReport is the result of a reconciliation of an xPub against the chain (see ReconcileXpub)
+type ReconcileReport struct {
+	CheckedAt       time.Time          `json:"checked_at"`       // When the reconciliation started
+	Destinations    int                `json:"destinations"`     // Recent destinations checked for unknown outputs
+	Missing         []*ReconcileOutput `json:"missing"`          // Unspent on-chain, unknown to bux
+	Phantom         []*ReconcileOutput `json:"phantom"`          // Unspent in bux, not unspent on-chain
+	Requests        int                `json:"requests"`         // Requests sent to the provider
+	Utxos           int                `json:"utxos"`            // Unspent utxos checked
+	ValueMismatches []*ReconcileOutput `json:"value_mismatches"` // Unspent on both sides with a different value
+	XpubID          string             `json:"xpub_id"`          // ID of the xPub
+}
+
+// reconcileOptions holds the configuration of the reconciliation
+type reconcileOptions struct {
+	interval time.Duration          // Min delay between the provider requests
+	provider UnspentOutputsProvider // Source of the unspent outputs (reconciliation is disabled if not set)
+}
+
+// reconcileLimiter spaces the provider requests of a reconciliation by the interval
+type reconcileLimiter struct {
+	interval time.Duration // Min delay between the requests
+	last     time.Time     // When the last request was sent
+}
+
+// wait will block until the next request can be sent (or the context is done)
+func (l *reconcileLimiter) wait(ctx context.Context) error {
+	if !l.last.IsZero() && l.interval > 0 {
+		if delay := l.interval - time.Since(l.last); delay > 0 {
+			timer := time.NewTimer(delay)
+			defer timer.Stop()
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-timer.C:
+			}
+		}
+	}
+	l.last = time.Now()
+	return nil
+}
+
+// reconciliation is the state of a running reconciliation
+type reconciliation struct {
+	checked  map[string]bool         // Locking scripts already sent to the provider
+	client   *Client                 // The client
+	limiter  *reconcileLimiter       // Rate limit of the provider requests
+	onChain  map[string]*ChainOutput // Unspent outputs of the checked scripts (by outpoint)
+	options  *ReconcileOptions       // The options of the reconciliation
+	progress ReconcileProgress       // The progress
+	report   *ReconcileReport        // The report
+}
+
+// ReconcileXpub will compare the unspent utxos of the xPub with the unspent outputs on-chain (see WithReconciliation)
+//
+// Every unspent utxo is checked (in pages, the locking scripts are sent to the provider in batches), then the recent
+// destinations not checked yet are checked for outputs unknown to bux. The provider requests are spaced by the
+// configured interval. The fixes are applied after the scan, a failed fix stops the fixes and the report is
+// returned with the error.
+//
+// xPubID is the xPub ID (or the raw public xPub)
+func (c *Client) ReconcileXpub(ctx context.Context, xPubID string, opts *ReconcileOptions) (*ReconcileReport, error) {
+
+	// Check for existing NewRelic transaction
+	ctx = c.GetOrStartTxn(ctx, "reconcile_xpub")
+
+	if c.options.reconcile.provider == nil {
+		return nil, ErrReconciliationDisabled
+	}
+
+	var err error
+	if xPubID, err = resolveXpubID(xPubID); err != nil {
+		return nil, err
+	}
+	var xPub *Xpub
+	if xPub, err = getXpubByID(ctx, xPubID, c.DefaultModelOptions()...); err != nil {
+		return nil, err
+	} else if xPub == nil {
+		return nil, ErrMissingXpub
+	}
+
+	if opts == nil {
+		opts = &ReconcileOptions{}
+	}
+	r := &reconciliation{
+		checked: make(map[string]bool),
+		client:  c,
+		limiter: &reconcileLimiter{interval: c.options.reconcile.interval},
+		onChain: make(map[string]*ChainOutput),
+		options: opts,
+		report: &ReconcileReport{
+			CheckedAt:       time.Now().UTC(),
+			Missing:         make([]*ReconcileOutput, 0),
+			Phantom:         make([]*ReconcileOutput, 0),
+			ValueMismatches: make([]*ReconcileOutput, 0),
+			XpubID:          xPubID,
+		},
+	}
+
+	if err = r.checkUtxos(ctx); err != nil {
+		return r.report, err
+	}
+	if err = r.checkDestinations(ctx); err != nil {
+		return r.report, err
+	}
+	if err = r.fix(ctx); err != nil {
+		c.Logger().Error(ctx, fmt.Sprintf("[RECONCILE] fixes of xpub %s stopped: %s", xPubID, err.Error()))
+		return r.report, err
+	}
+
+	c.Logger().Info(ctx, fmt.Sprintf(
+		"[RECONCILE] xpub %s: %d utxos and %d destinations checked, %d missing, %d phantom, %d value mismatches",
+		xPubID, r.report.Utxos, r.report.Destinations, len(r.report.Missing), len(r.report.Phantom),
+		len(r.report.ValueMismatches),
+	))
+	return r.report, nil
+}
+
+// checkUtxos will check the unspent utxos of the xPub (page by page)
+func (r *reconciliation) checkUtxos(ctx context.Context) error {
+	opts := r.client.DefaultModelOptions()
+	page := make([]*Utxo, 0, r.pageSize())
+	err := forEachKeysetRecord(ctx, map[string]interface{}{
+		xPubIDField:       r.report.XpubID,
+		spendingTxIDField: nil,
+	}, r.pageSize(),
+		func(ctx context.Context, conditions map[string]interface{}, queryParams *datastore.QueryParams) ([]keysetRecord, error) {
+			utxos, err := getUtxosByConditions(ctx, conditions, queryParams, opts...)
+			if err != nil {
+				return nil, err
+			}
+			records := make([]keysetRecord, 0, len(utxos))
+			for _, utxo := range utxos {
+				records = append(records, utxo)
+			}
+			return records, nil
+		}, func(record keysetRecord) error {
+			if page = append(page, record.(*Utxo)); len(page) < r.pageSize() {
+				return nil
+			}
+			err := r.checkPage(ctx, page)
+			page = page[:0]
+			return err
+		},
+		opts...,
+	)
+	if err != nil {
+		return err
+	}
+	return r.checkPage(ctx, page)
+}
+
+// checkPage will query the unchecked locking scripts of the utxos and compare the utxos with the chain
+func (r *reconciliation) checkPage(ctx context.Context, utxos []*Utxo) error {
+	scripts := make([]string, 0, len(utxos))
+	for _, utxo := range utxos {
+		if !r.checked[utxo.ScriptPubKey] {
+			r.checked[utxo.ScriptPubKey] = true
+			scripts = append(scripts, utxo.ScriptPubKey)
+		}
+	}
+	if err := r.query(ctx, scripts); err != nil {
+		return err
+	}
+
+	for _, utxo := range utxos {
+		output := &ReconcileOutput{
+			LockingScript: utxo.ScriptPubKey,
+			OutputIndex:   utxo.OutputIndex,
+			Satoshis:      utxo.Satoshis,
+			TransactionID: utxo.TransactionID,
+		}
+		if onChain, ok := r.onChain[outpointKey(utxo.TransactionID, utxo.OutputIndex)]; !ok {
+			output.Fixed = utxo.Frozen // Already on hold (IE: by a previous reconciliation)
+			r.report.Phantom = append(r.report.Phantom, output)
+		} else if onChain.Satoshis != utxo.Satoshis {
+			output.ChainSatoshis = onChain.Satoshis
+			r.report.ValueMismatches = append(r.report.ValueMismatches, output)
+		}
+	}
+	r.report.Utxos += len(utxos)
+	r.progress.Utxos += len(utxos)
+	r.notify()
+	return nil
+}
+
+// checkDestinations will query the recent destinations of the xPub that were not checked with the utxos
+func (r *reconciliation) checkDestinations(ctx context.Context) error {
+	window := r.options.RecentDestinations
+	if window <= 0 {
+		window = defaultReconcileDestinations
+	}
+
+	opts := r.client.DefaultModelOptions()
+	scripts := make([]string, 0, r.pageSize())
+	err := forEachKeysetRecord(ctx, map[string]interface{}{
+		xPubIDField: r.report.XpubID,
+		createdAtField: map[string]interface{}{
+			"$gt": time.Now().UTC().Add(-window),
+		},
+	}, r.pageSize(),
+		func(ctx context.Context, conditions map[string]interface{}, queryParams *datastore.QueryParams) ([]keysetRecord, error) {
+			destinations, err := getDestinations(ctx, nil, &conditions, queryParams, opts...)
+			if err != nil {
+				return nil, err
+			}
+			records := make([]keysetRecord, 0, len(destinations))
+			for _, destination := range destinations {
+				records = append(records, destination)
+			}
+			return records, nil
+		}, func(record keysetRecord) error {
+			destination := record.(*Destination)
+			r.report.Destinations++
+			r.progress.Destinations++
+			if r.checked[destination.LockingScript] {
+				return nil
+			}
+			r.checked[destination.LockingScript] = true
+			if scripts = append(scripts, destination.LockingScript); len(scripts) < r.pageSize() {
+				return nil
+			}
+			err := r.query(ctx, scripts)
+			scripts = scripts[:0]
+			return err
+		},
+		opts...,
+	)
+	if err != nil {
+		return err
+	}
+	err = r.query(ctx, scripts)
+	r.notify()
+	return err
+}
+
+// query will send the locking scripts to the provider (in batches) and record the outputs unknown to bux
+func (r *reconciliation) query(ctx context.Context, scripts []string) error {
+	batchSize := r.options.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultReconcileBatchSize
+	}
+
+	opts := r.client.DefaultModelOptions()
+	for start := 0; start < len(scripts); start += batchSize {
+		end := start + batchSize
+		if end > len(scripts) {
+			end = len(scripts)
+		}
+		if err := r.limiter.wait(ctx); err != nil {
+			return err
+		}
+		outputs, err := r.client.options.reconcile.provider.GetUnspentOutputs(ctx, scripts[start:end])
+		if err != nil {
+			return fmt.Errorf("%w: %s", ErrReconciliationFailed, err.Error())
+		}
+		r.report.Requests++
+		r.progress.Requests++
+
+		for _, output := range outputs {
+			key := outpointKey(output.TransactionID, output.OutputIndex)
+			if _, ok := r.onChain[key]; ok {
+				continue
+			}
+			r.onChain[key] = output
+
+			// Outputs with a record (IE: spent by a pending transaction) are not missing
+			var utxo *Utxo
+			if utxo, err = getUtxo(ctx, output.TransactionID, output.OutputIndex, opts...); err != nil {
+				return err
+			} else if utxo == nil {
+				r.report.Missing = append(r.report.Missing, &ReconcileOutput{
+					ChainSatoshis: output.Satoshis,
+					LockingScript: output.LockingScript,
+					OutputIndex:   output.OutputIndex,
+					TransactionID: output.TransactionID,
+				})
+			}
+		}
+		r.notify()
+	}
+	return nil
+}
+
+// fix will apply the fixes of the categories enabled in the options
+func (r *reconciliation) fix(ctx context.Context) error {
+	opts := r.client.DefaultModelOptions()
+
+	// Phantoms are frozen (kept for the audit, but never selected again), the outputs of the unmined or recent
+	// transactions might not be indexed by the provider yet
+	if r.options.FixPhantoms {
+		for _, output := range r.report.Phantom {
+			if output.Fixed {
+				continue
+			}
+			settled, err := isSettledOutput(ctx, output, opts...)
+			if err != nil {
+				return err
+			} else if !settled {
+				continue
+			}
+			if _, err = freezeUtxo(
+				ctx, output.TransactionID, output.OutputIndex, true,
+				"reconciliation: not unspent on-chain", "reconciliation", opts...,
+			); errors.Is(err, ErrUtxoReservedByDraft) {
+				continue
+			} else if err != nil {
+				return err
+			}
+			output.Fixed = true
+		}
+	}
+
+	// Missing outputs are recorded by importing their transactions (the known transactions are skipped)
+	if r.options.FixMissing {
+		imported := make(map[string]bool)
+		for _, output := range r.report.Missing {
+			if !imported[output.TransactionID] {
+				transaction, err := getTransactionByID(ctx, "", output.TransactionID, opts...)
+				if err != nil {
+					return err
+				} else if transaction != nil {
+					continue
+				}
+				if _, err = r.client.ImportTransactionByID(ctx, output.TransactionID); err != nil {
+					return err
+				}
+				imported[output.TransactionID] = true
+			}
+			output.Fixed = true
+		}
+	}
+	return nil
+}
+
+// isSettledOutput will return true if the transaction of the output is mined and older than the age of the
+// phantoms (see defaultReconcilePhantomAge)
+func isSettledOutput(ctx context.Context, output *ReconcileOutput, opts ...ModelOps) (bool, error) {
+	transaction, err := getTransactionByID(ctx, "", output.TransactionID, opts...)
+	if err != nil {
+		return false, err
+	} else if transaction == nil || transaction.BlockHeight == 0 {
+		return false, nil
+	}
+	return time.Since(transaction.CreatedAt) >= defaultReconcilePhantomAge, nil
+}
+
+// notify will call the progress callback (if set)
+func (r *reconciliation) notify() {
+	if r.options.OnProgress != nil {
+		progress := r.progress
+		r.options.OnProgress(&progress)
+	}
+}
+
+// pageSize will return the number of records loaded per page
+func (r *reconciliation) pageSize() int {
+	if r.options.PageSize > 0 {
+		return r.options.PageSize
+	}
+	return defaultReconcilePageSize
+}
+
+// outpointKey will return the key of the output (txID:index)
+func outpointKey(txID string, index uint32) string {
+	return fmt.Sprintf("%s:%d", txID, index)
+}
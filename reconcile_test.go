@@ -0,0 +1,215 @@
+package bux
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/BuxOrg/bux/chainstate"
+	"github.com/BuxOrg/bux/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// reconcileProviderMock is an unspent outputs provider serving the outputs of the locking scripts
+type reconcileProviderMock struct {
+	err      error
+	mu       sync.Mutex
+	outputs  map[string][]*ChainOutput
+	requests []time.Time
+}
+
+// GetUnspentOutputs will return the outputs of the locking scripts (and record the request)
+func (p *reconcileProviderMock) GetUnspentOutputs(_ context.Context, lockingScripts []string) ([]*ChainOutput, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.requests = append(p.requests, time.Now())
+	if p.err != nil {
+		return nil, p.err
+	}
+	outputs := make([]*ChainOutput, 0)
+	for _, lockingScript := range lockingScripts {
+		outputs = append(outputs, p.outputs[lockingScript]...)
+	}
+	return outputs, nil
+}
+
+// TestClient_ReconcileXpub will test the method ReconcileXpub()
+func TestClient_ReconcileXpub(t *testing.T) {
+	// t.Parallel() the provider records the requests
+
+	const interval = 20 * time.Millisecond
+
+	provider := &reconcileProviderMock{}
+	mock := chainstate.NewMockClient()
+	ctx, client, deferMe := CreateTestSQLiteClient(t, false, true,
+		WithCustomTaskManager(&taskManagerMockBase{}),
+		WithCustomChainstate(mock),
+		WithReconciliation(provider, interval),
+	)
+	t.Cleanup(deferMe)
+
+	// utxo 0 is fine, utxo 1 is spent on-chain, utxo 2 has another value on-chain
+	fixtures := NewFixtures(t, client).WithXpub(0).WithDestinations(3).WithUtxos(1000, 2000, 3000)
+	fixtures.WithDestinations(1)
+
+	// An output to the last destination (without utxos) that bux never saw
+	txHex := monitoredTxHex(t, []string{fixtures.Destinations[3].LockingScript}, []uint64{5000})
+	missingTxID, err := utils.GetTransactionIDFromHex(txHex)
+	require.NoError(t, err)
+	mock.RawTransactions = map[string]string{missingTxID: txHex}
+
+	chainOutput := func(utxo *Utxo, satoshis uint64) *ChainOutput {
+		return &ChainOutput{
+			LockingScript: utxo.ScriptPubKey,
+			OutputIndex:   utxo.OutputIndex,
+			Satoshis:      satoshis,
+			TransactionID: utxo.TransactionID,
+		}
+	}
+	utxos := fixtures.Utxos
+	provider.outputs = map[string][]*ChainOutput{
+		utxos[0].ScriptPubKey: {chainOutput(utxos[0], 1000)},
+		utxos[2].ScriptPubKey: {chainOutput(utxos[2], 3500)},
+		fixtures.Destinations[3].LockingScript: {{
+			LockingScript: fixtures.Destinations[3].LockingScript,
+			OutputIndex:   0,
+			Satoshis:      5000,
+			TransactionID: missingTxID,
+		}},
+	}
+
+	t.Run("report", func(t *testing.T) {
+		provider.requests = nil
+		var progress []*ReconcileProgress
+		report, err := client.ReconcileXpub(ctx, fixtures.RawXpub, &ReconcileOptions{
+			BatchSize:  2,
+			OnProgress: func(p *ReconcileProgress) { progress = append(progress, p) },
+			PageSize:   2,
+		})
+		require.NoError(t, err)
+
+		assert.Equal(t, fixtures.Xpub.ID, report.XpubID)
+		assert.Equal(t, 3, report.Utxos)
+		assert.Equal(t, 4, report.Destinations)
+
+		// Two pages of utxos, then the unchecked destination
+		assert.Equal(t, 3, report.Requests)
+		require.Len(t, provider.requests, 3)
+		for i := 1; i < len(provider.requests); i++ {
+			assert.GreaterOrEqual(t, provider.requests[i].Sub(provider.requests[i-1]), interval)
+		}
+		require.NotEmpty(t, progress)
+		assert.Equal(t, ReconcileProgress{Destinations: 4, Requests: 3, Utxos: 3}, *progress[len(progress)-1])
+
+		require.Len(t, report.Phantom, 1)
+		assert.Equal(t, utxos[1].TransactionID, report.Phantom[0].TransactionID)
+		assert.Equal(t, utxos[1].OutputIndex, report.Phantom[0].OutputIndex)
+		assert.Equal(t, uint64(2000), report.Phantom[0].Satoshis)
+		assert.False(t, report.Phantom[0].Fixed)
+
+		require.Len(t, report.ValueMismatches, 1)
+		assert.Equal(t, utxos[2].OutputIndex, report.ValueMismatches[0].OutputIndex)
+		assert.Equal(t, uint64(3000), report.ValueMismatches[0].Satoshis)
+		assert.Equal(t, uint64(3500), report.ValueMismatches[0].ChainSatoshis)
+
+		require.Len(t, report.Missing, 1)
+		assert.Equal(t, missingTxID, report.Missing[0].TransactionID)
+		assert.Equal(t, uint64(5000), report.Missing[0].ChainSatoshis)
+
+		// Nothing is fixed without the flags
+		utxo, err := getUtxo(ctx, utxos[1].TransactionID, utxos[1].OutputIndex, client.DefaultModelOptions()...)
+		require.NoError(t, err)
+		assert.False(t, utxo.Frozen)
+		transaction, err := getTransactionByID(ctx, "", missingTxID, client.DefaultModelOptions()...)
+		require.NoError(t, err)
+		assert.Nil(t, transaction)
+	})
+
+	t.Run("fix", func(t *testing.T) {
+		report, err := client.ReconcileXpub(ctx, fixtures.Xpub.ID, &ReconcileOptions{
+			FixMissing:  true,
+			FixPhantoms: true,
+		})
+		require.NoError(t, err)
+
+		// The transaction of the phantom is not mined (might not be indexed yet)
+		require.Len(t, report.Phantom, 1)
+		assert.False(t, report.Phantom[0].Fixed)
+
+		// The value mismatches are only reported
+		require.Len(t, report.ValueMismatches, 1)
+		assert.False(t, report.ValueMismatches[0].Fixed)
+		require.Len(t, report.Missing, 1)
+		assert.True(t, report.Missing[0].Fixed)
+
+		opts := client.DefaultModelOptions()
+		utxo, err := getUtxo(ctx, utxos[1].TransactionID, utxos[1].OutputIndex, opts...)
+		require.NoError(t, err)
+		assert.False(t, utxo.Frozen)
+
+		utxo, err = getUtxo(ctx, utxos[2].TransactionID, utxos[2].OutputIndex, opts...)
+		require.NoError(t, err)
+		assert.Equal(t, uint64(3000), utxo.Satoshis)
+
+		utxo, err = getUtxo(ctx, missingTxID, 0, opts...)
+		require.NoError(t, err)
+		require.NotNil(t, utxo)
+		assert.Equal(t, fixtures.Xpub.ID, utxo.XpubID)
+
+		xPub, err := getXpubByID(ctx, fixtures.Xpub.ID, opts...)
+		require.NoError(t, err)
+		assert.Equal(t, uint64(1000+2000+3000+5000), xPub.CurrentBalance)
+
+		// Mined long ago
+		require.NoError(t, gormDB(client.Datastore()).Table(client.Datastore().GetTableName(tableTransactions)).
+			Where(map[string]interface{}{idField: utxos[1].TransactionID}).
+			Updates(map[string]interface{}{
+				blockHeightField: 800000,
+				createdAtField:   time.Now().UTC().Add(-2 * defaultReconcilePhantomAge),
+			}).Error)
+		report, err = client.ReconcileXpub(ctx, fixtures.Xpub.ID, &ReconcileOptions{FixPhantoms: true})
+		require.NoError(t, err)
+		require.Len(t, report.Phantom, 1)
+		assert.True(t, report.Phantom[0].Fixed)
+
+		utxo, err = getUtxo(ctx, utxos[1].TransactionID, utxos[1].OutputIndex, opts...)
+		require.NoError(t, err)
+		assert.True(t, utxo.Frozen)
+		assert.Equal(t, "reconciliation", utxo.FrozenBy)
+
+		// Only the (frozen) phantom and the value mismatch are left
+		report, err = client.ReconcileXpub(ctx, fixtures.Xpub.ID, nil)
+		require.NoError(t, err)
+		assert.Equal(t, 4, report.Utxos)
+		require.Len(t, report.Phantom, 1)
+		assert.True(t, report.Phantom[0].Fixed)
+		assert.Len(t, report.ValueMismatches, 1)
+		assert.Empty(t, report.Missing)
+	})
+
+	t.Run("provider failure", func(t *testing.T) {
+		provider.err = errors.New("provider is down")
+		defer func() {
+			provider.err = nil
+		}()
+		_, err := client.ReconcileXpub(ctx, fixtures.Xpub.ID, nil)
+		require.ErrorIs(t, err, ErrReconciliationFailed)
+	})
+
+	t.Run("missing xpub", func(t *testing.T) {
+		_, err := client.ReconcileXpub(ctx, testXPubID, nil)
+		require.ErrorIs(t, err, ErrMissingXpub)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		client.(*Client).options.reconcile.provider = nil
+		defer func() {
+			client.(*Client).options.reconcile.provider = provider
+		}()
+		_, err := client.ReconcileXpub(ctx, fixtures.Xpub.ID, nil)
+		require.ErrorIs(t, err, ErrReconciliationDisabled)
+	})
+}
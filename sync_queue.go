@@ -0,0 +1,99 @@
+package bux
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+const syncQueueMetricName = "Custom/bux/sync_queue/" // + queue name
+
+// SyncQueueDepths are the number of transactions waiting in each sync queue (used for autoscaling the workers)
+type SyncQueueDepths struct {
+	BroadcastReady int64     `json:"broadcast_ready" toml:"broadcast_ready" yaml:"broadcast_ready"` // Waiting to be broadcast
+	CheckedAt      time.Time `json:"checked_at" toml:"checked_at" yaml:"checked_at"`                // When the depths were counted
+	Errored        int64     `json:"errored" toml:"errored" yaml:"errored"`                         // With an error in any action
+	P2PReady       int64     `json:"p2p_ready" toml:"p2p_ready" yaml:"p2p_ready"`                   // Waiting to notify the paymail providers
+	SyncReady      int64     `json:"sync_ready" toml:"sync_ready" yaml:"sync_ready"`                // Waiting to be synced on-chain
+}
+
+// queues will return the depth of each queue by name
+func (d *SyncQueueDepths) queues() map[string]int64 {
+	return map[string]int64{
+		"broadcast_ready": d.BroadcastReady,
+		"errored":         d.Errored,
+		"p2p_ready":       d.P2PReady,
+		"sync_ready":      d.SyncReady,
+	}
+}
+
+// GetSyncQueueDepths will count the sync transactions waiting in each queue (indexed count queries)
+//
+// The depths are cached when configured (WithSyncQueueDepths), recorded as NewRelic metrics (if enabled)
+// and a warning is logged for each queue that exceeds the configured threshold.
+func (c *Client) GetSyncQueueDepths(ctx context.Context) (*SyncQueueDepths, error) {
+
+	// Check for existing NewRelic transaction
+	ctx = c.GetOrStartTxn(ctx, "get_sync_queue_depths")
+
+	// Use the cached depths if still fresh
+	options := c.options.syncQueue
+	options.mu.Lock()
+	defer options.mu.Unlock()
+	if options.cached != nil && options.cacheTTL > 0 &&
+		time.Since(options.cached.CheckedAt) < options.cacheTTL {
+		depths := *options.cached
+		return &depths, nil
+	}
+
+	opts := c.DefaultModelOptions()
+	depths := &SyncQueueDepths{CheckedAt: time.Now().UTC()}
+	var err error
+	for _, queue := range []struct {
+		conditions map[string]interface{}
+		depth      *int64
+	}{
+		{map[string]interface{}{broadcastStatusField: SyncStatusReady.String()}, &depths.BroadcastReady},
+		{map[string]interface{}{p2pStatusField: SyncStatusReady.String()}, &depths.P2PReady},
+		{map[string]interface{}{syncStatusField: SyncStatusReady.String()}, &depths.SyncReady},
+		{map[string]interface{}{
+			"$or": []map[string]interface{}{
+				{broadcastStatusField: SyncStatusError.String()},
+				{p2pStatusField: SyncStatusError.String()},
+				{syncStatusField: SyncStatusError.String()},
+			},
+		}, &depths.Errored},
+	} {
+		if *queue.depth, err = getModelCountByConditions(
+			ctx, ModelSyncTransaction, SyncTransaction{}, nil, &queue.conditions, opts...,
+		); err != nil {
+			return nil, err
+		}
+	}
+
+	options.cached = depths
+	c.reportSyncQueueDepths(ctx, depths)
+
+	result := *depths
+	return &result, nil
+}
+
+// reportSyncQueueDepths will record the metrics and warn about the queues that exceed the threshold
+func (c *Client) reportSyncQueueDepths(ctx context.Context, depths *SyncQueueDepths) {
+	threshold := c.options.syncQueue.warningThreshold
+	for name, depth := range depths.queues() {
+		if c.IsNewRelicEnabled() && c.options.newRelic.app != nil {
+			c.options.newRelic.app.RecordCustomMetric(syncQueueMetricName+name, float64(depth))
+		}
+		if threshold > 0 && depth > threshold && c.Logger() != nil {
+			c.Logger().Warn(ctx, fmt.Sprintf(
+				"sync queue %s has %d transactions waiting (threshold: %d)", name, depth, threshold,
+			))
+		}
+	}
+}
+
+// SyncQueueWarningThreshold will return the depth of a sync queue that logs a warning (0 = no warning)
+func (c *Client) SyncQueueWarningThreshold() int64 {
+	return c.options.syncQueue.warningThreshold
+}
@@ -0,0 +1,83 @@
+package bux
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/BuxOrg/bux/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestClient_GetSyncQueueDepths will test the method GetSyncQueueDepths()
+func TestClient_GetSyncQueueDepths(t *testing.T) {
+	t.Parallel()
+
+	// saveSyncTx will save a new sync transaction with the given statuses
+	saveSyncTx := func(ctx context.Context, t *testing.T, client ClientInterface,
+		broadcastStatus, p2pStatus, syncStatus SyncStatus,
+	) {
+		id, err := utils.RandomHex(32)
+		require.NoError(t, err)
+		syncTx := newSyncTransaction(id, &SyncConfig{}, append(client.DefaultModelOptions(), New())...)
+		syncTx.BroadcastStatus = broadcastStatus
+		syncTx.P2PStatus = p2pStatus
+		syncTx.SyncStatus = syncStatus
+		require.NoError(t, syncTx.Save(ctx))
+	}
+
+	t.Run("empty queues", func(t *testing.T) {
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, true, WithCustomTaskManager(&taskManagerMockBase{}))
+		defer deferMe()
+
+		depths, err := client.GetSyncQueueDepths(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, int64(0), depths.BroadcastReady)
+		assert.Equal(t, int64(0), depths.Errored)
+		assert.Equal(t, int64(0), depths.P2PReady)
+		assert.Equal(t, int64(0), depths.SyncReady)
+		assert.False(t, depths.CheckedAt.IsZero())
+	})
+
+	t.Run("count per queue", func(t *testing.T) {
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, true, WithCustomTaskManager(&taskManagerMockBase{}))
+		defer deferMe()
+
+		saveSyncTx(ctx, t, client, SyncStatusReady, SyncStatusPending, SyncStatusReady)
+		saveSyncTx(ctx, t, client, SyncStatusReady, SyncStatusSkipped, SyncStatusPending)
+		saveSyncTx(ctx, t, client, SyncStatusComplete, SyncStatusReady, SyncStatusReady)
+		saveSyncTx(ctx, t, client, SyncStatusError, SyncStatusSkipped, SyncStatusError)
+		saveSyncTx(ctx, t, client, SyncStatusComplete, SyncStatusError, SyncStatusComplete)
+
+		depths, err := client.GetSyncQueueDepths(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), depths.BroadcastReady)
+		assert.Equal(t, int64(2), depths.Errored)
+		assert.Equal(t, int64(1), depths.P2PReady)
+		assert.Equal(t, int64(2), depths.SyncReady)
+	})
+
+	t.Run("cached depths", func(t *testing.T) {
+		ctx, client, deferMe := CreateTestSQLiteClient(t, false, true,
+			WithCustomTaskManager(&taskManagerMockBase{}),
+			WithSyncQueueDepths(time.Minute, 1),
+		)
+		defer deferMe()
+
+		saveSyncTx(ctx, t, client, SyncStatusReady, SyncStatusPending, SyncStatusReady)
+
+		depths, err := client.GetSyncQueueDepths(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), depths.BroadcastReady)
+
+		// Not counted again until the cache expires
+		saveSyncTx(ctx, t, client, SyncStatusReady, SyncStatusPending, SyncStatusReady)
+
+		var cached *SyncQueueDepths
+		cached, err = client.GetSyncQueueDepths(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), cached.BroadcastReady)
+		assert.Equal(t, depths.CheckedAt, cached.CheckedAt)
+	})
+}
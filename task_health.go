@@ -0,0 +1,142 @@
+package bux
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BuxOrg/bux/taskmanager"
+	zLogger "github.com/mrz1836/go-logger"
+	"github.com/newrelic/go-agent/v3/newrelic"
+)
+
+const taskPanicMetricName = "Custom/bux/task_panic"
+
+// TaskHealth is the health of a registered task (used for detecting a dead cron)
+type TaskHealth struct {
+	LastPanic     string    `json:"last_panic,omitempty" toml:"last_panic" yaml:"last_panic"`                // Last recovered panic
+	LastPanicAt   time.Time `json:"last_panic_at,omitempty" toml:"last_panic_at" yaml:"last_panic_at"`       // When the task last panicked
+	LastRunAt     time.Time `json:"last_run_at,omitempty" toml:"last_run_at" yaml:"last_run_at"`             // When the task was last started
+	LastSuccessAt time.Time `json:"last_success_at,omitempty" toml:"last_success_at" yaml:"last_success_at"` // When the task last completed (no panic or error)
+	Name          string    `json:"name" toml:"name" yaml:"name"`                                            // Name of the task
+	Panics        uint64    `json:"panics" toml:"panics" yaml:"panics"`                                      // Number of recovered panics
+}
+
+// recoveringTaskManager wraps the taskmanager and recovers panics in the registered task handlers
+//
+// A panic is logged (with the stack) and recorded, the handler returns normally so the periodic schedule stays alive
+type recoveringTaskManager struct {
+	taskmanager.ClientInterface
+	health   map[string]*TaskHealth      // Health by task name
+	logger   zLogger.GormLoggerInterface // Logger for the recovered panics
+	mu       sync.RWMutex                // Guards the health
+	newRelic *newrelic.Application       // NewRelic application (for the panic metric)
+}
+
+// newRecoveringTaskManager will wrap the taskmanager with the panic recovery
+func newRecoveringTaskManager(tm taskmanager.ClientInterface, logger zLogger.GormLoggerInterface,
+	newRelic *newrelic.Application,
+) *recoveringTaskManager {
+	return &recoveringTaskManager{
+		ClientInterface: tm,
+		health:          make(map[string]*TaskHealth),
+		logger:          logger,
+		newRelic:        newRelic,
+	}
+}
+
+// RegisterTask will register the task, wrapping the bux task handlers with the panic recovery
+func (r *recoveringTaskManager) RegisterTask(task *taskmanager.Task) error {
+	if handler, ok := task.Handler.(func(client ClientInterface) error); ok {
+		wrapped := *task
+		wrapped.Handler = r.recoverHandler(task.Name, handler)
+		task = &wrapped
+	}
+	return r.ClientInterface.RegisterTask(task)
+}
+
+// TaskHealth will return the health of all the registered tasks (sorted by name)
+func (r *recoveringTaskManager) TaskHealth() []*TaskHealth {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	tasks := make([]*TaskHealth, 0, len(r.health))
+	for _, health := range r.health {
+		h := *health
+		tasks = append(tasks, &h)
+	}
+	sort.Slice(tasks, func(i, j int) bool {
+		return tasks[i].Name < tasks[j].Name
+	})
+	return tasks
+}
+
+// recoverHandler will wrap the handler with the panic recovery and health tracking
+func (r *recoveringTaskManager) recoverHandler(name string,
+	handler func(client ClientInterface) error,
+) func(client ClientInterface) error {
+	r.getHealth(name)
+
+	return func(client ClientInterface) (err error) {
+		defer func() {
+			if rec := recover(); rec != nil {
+				r.recordPanic(name, rec)
+				err = nil // keep the periodic schedule alive
+			}
+		}()
+
+		r.update(name, func(health *TaskHealth) {
+			health.LastRunAt = time.Now().UTC()
+		})
+		if err = handler(client); err == nil {
+			r.update(name, func(health *TaskHealth) {
+				health.LastSuccessAt = time.Now().UTC()
+			})
+		}
+		return
+	}
+}
+
+// recordPanic will log the panic (with the stack), record it and increment the metric
+func (r *recoveringTaskManager) recordPanic(name string, rec interface{}) {
+	message := fmt.Sprintf("%v", rec)
+	r.update(name, func(health *TaskHealth) {
+		health.LastPanic = message
+		health.LastPanicAt = time.Now().UTC()
+		health.Panics++
+	})
+
+	if r.logger != nil {
+		r.logger.Error(context.Background(), fmt.Sprintf(
+			"panic recovered in task %s: %s - stack trace: %s", name, message,
+			strings.ReplaceAll(string(debug.Stack()), "\n", ""),
+		))
+	}
+	if r.newRelic != nil {
+		r.newRelic.RecordCustomMetric(taskPanicMetricName, 1)
+	}
+}
+
+// getHealth will get (or create) the health of the task
+func (r *recoveringTaskManager) getHealth(name string) *TaskHealth {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	health, ok := r.health[name]
+	if !ok {
+		health = &TaskHealth{Name: name}
+		r.health[name] = health
+	}
+	return health
+}
+
+// update will update the health of the task
+func (r *recoveringTaskManager) update(name string, fn func(health *TaskHealth)) {
+	health := r.getHealth(name)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	fn(health)
+}
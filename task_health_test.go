@@ -0,0 +1,105 @@
+package bux
+
+import (
+	"testing"
+
+	"github.com/BuxOrg/bux/taskmanager"
+	zLogger "github.com/mrz1836/go-logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// taskManagerRegisterMock keeps the registered tasks
+type taskManagerRegisterMock struct {
+	taskManagerMockBase
+	tasks map[string]*taskmanager.Task
+}
+
+func (tm *taskManagerRegisterMock) RegisterTask(task *taskmanager.Task) error {
+	tm.tasks[task.Name] = task
+	return nil
+}
+
+// Test_recoveringTaskManager_RegisterTask will test the method RegisterTask()
+func Test_recoveringTaskManager_RegisterTask(t *testing.T) {
+	t.Parallel()
+
+	newTaskManager := func() (*recoveringTaskManager, *taskManagerRegisterMock) {
+		mock := &taskManagerRegisterMock{tasks: make(map[string]*taskmanager.Task)}
+		return newRecoveringTaskManager(mock, zLogger.NewGormLogger(false, 4), nil), mock
+	}
+
+	t.Run("panic is recovered", func(t *testing.T) {
+		r, mock := newTaskManager()
+		require.NoError(t, r.RegisterTask(&taskmanager.Task{
+			Name: "panic_task",
+			Handler: func(ClientInterface) error {
+				panic("task exploded")
+			},
+		}))
+
+		handler, ok := mock.tasks["panic_task"].Handler.(func(ClientInterface) error)
+		require.True(t, ok)
+		assert.NotPanics(t, func() {
+			assert.NoError(t, handler(nil))
+		})
+
+		health := r.TaskHealth()
+		require.Len(t, health, 1)
+		assert.Equal(t, "panic_task", health[0].Name)
+		assert.Equal(t, uint64(1), health[0].Panics)
+		assert.Equal(t, "task exploded", health[0].LastPanic)
+		assert.False(t, health[0].LastRunAt.IsZero())
+		assert.True(t, health[0].LastSuccessAt.IsZero())
+	})
+
+	t.Run("successful run", func(t *testing.T) {
+		r, mock := newTaskManager()
+		require.NoError(t, r.RegisterTask(&taskmanager.Task{
+			Name: "good_task",
+			Handler: func(ClientInterface) error {
+				return nil
+			},
+		}))
+
+		// Registered tasks are listed before the first run
+		health := r.TaskHealth()
+		require.Len(t, health, 1)
+		assert.True(t, health[0].LastRunAt.IsZero())
+
+		handler := mock.tasks["good_task"].Handler.(func(ClientInterface) error)
+		require.NoError(t, handler(nil))
+
+		health = r.TaskHealth()
+		require.Len(t, health, 1)
+		assert.False(t, health[0].LastSuccessAt.IsZero())
+		assert.Equal(t, uint64(0), health[0].Panics)
+	})
+
+	t.Run("other handler signatures are not wrapped", func(t *testing.T) {
+		r, mock := newTaskManager()
+		require.NoError(t, r.RegisterTask(&taskmanager.Task{
+			Name:    "other_task",
+			Handler: func() {},
+		}))
+
+		_, ok := mock.tasks["other_task"].Handler.(func())
+		assert.True(t, ok)
+		assert.Len(t, r.TaskHealth(), 0)
+	})
+}
+
+// TestClient_TaskHealth will test the method TaskHealth()
+func TestClient_TaskHealth(t *testing.T) {
+	_, client, deferMe := CreateTestSQLiteClient(t, false, false, WithCustomTaskManager(&taskManagerMockBase{}))
+	defer deferMe()
+
+	health := client.TaskHealth()
+	require.NotEmpty(t, health)
+
+	names := make([]string, 0, len(health))
+	for _, task := range health {
+		names = append(names, task.Name)
+	}
+	assert.Contains(t, names, ModelSyncTransaction.String()+"_"+syncActionBroadcast)
+}
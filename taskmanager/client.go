@@ -3,6 +3,7 @@ package taskmanager
 import (
 	"context"
 	"errors"
+	"time"
 
 	zLogger "github.com/mrz1836/go-logger"
 	"github.com/newrelic/go-agent/v3/newrelic"
@@ -28,11 +29,33 @@ type (
 
 	// taskqOptions holds all the configuration for the TaskQ engine
 	taskqOptions struct {
-		config      *taskq.QueueOptions    // Configuration for the TaskQ engine
-		factory     taskq.Factory          // Factory for TaskQ (in-memory or Redis)
-		factoryType Factory                // Type of factory to use (in-memory or Redis)
-		queue       taskq.Queue            // Queue for TaskQ
-		tasks       map[string]*taskq.Task // Registered tasks
+		config      *taskq.QueueOptions      // Configuration for the TaskQ engine
+		factory     taskq.Factory            // Factory for TaskQ (in-memory or Redis)
+		factoryType Factory                  // Type of factory to use (in-memory or Redis)
+		migration   *taskqMigrationOptions   // Secondary (new) TaskQ backend during a migration window
+		queue       taskq.Queue              // Queue for TaskQ
+		scheduled   map[string]time.Duration // Periodic (cron) tasks that are scheduled (task name: period)
+		tasks       map[string]*taskq.Task   // Registered tasks
+	}
+
+	// MigrationStatus is the status of the TaskQ migration (between factories)
+	MigrationStatus struct {
+		Active      bool      `json:"active"`       // If a migration is in progress
+		Drained     bool      `json:"drained"`      // If the primary (old) queue has no pending messages
+		Error       string    `json:"error"`        // Error when reading the primary queue length
+		FromFactory Factory   `json:"from_factory"` // Primary (old) factory
+		PendingFrom int       `json:"pending_from"` // Pending messages on the primary (old) queue
+		StartedAt   time.Time `json:"started_at"`   // When the migration started
+		ToFactory   Factory   `json:"to_factory"`   // Secondary (new) factory
+	}
+
+	// taskqMigrationOptions holds the secondary TaskQ backend (new tasks are added here, the primary is drained)
+	taskqMigrationOptions struct {
+		config      *taskq.QueueOptions // Configuration for the secondary queue
+		factory     taskq.Factory       // Factory for the secondary queue
+		factoryType Factory             // Type of factory to use (in-memory or Redis)
+		queue       taskq.Queue         // Secondary queue
+		startedAt   time.Time           // When the migration started
 	}
 )
 
@@ -96,6 +119,14 @@ func (c *Client) Close(ctx context.Context) error {
 
 		if c.options.engine == TaskQ {
 
+			// Close the secondary queue (migration)
+			if c.options.taskq.migration != nil && c.options.taskq.migration.queue != nil {
+				if err := c.options.taskq.migration.queue.Close(); err != nil {
+					return err
+				}
+				c.options.taskq.migration = nil
+			}
+
 			// Close the queue
 			if err := c.options.taskq.queue.Close(); err != nil {
 				return err
@@ -119,6 +150,10 @@ func (c *Client) Close(ctx context.Context) error {
 
 // ResetCron will reset the cron scheduler and all loaded tasks
 func (c *Client) ResetCron() {
+	mutex.Lock()
+	c.options.taskq.scheduled = make(map[string]time.Duration)
+	mutex.Unlock()
+
 	c.options.cronService.New()
 	c.options.cronService.Start()
 }
@@ -164,3 +199,30 @@ func (c *Client) Factory() Factory {
 	}
 	return FactoryEmpty
 }
+
+// MigrationStatus will return the status of the TaskQ migration (primary backend is drained into the secondary)
+func (c *Client) MigrationStatus() *MigrationStatus {
+	m := c.options.taskq.migration
+	if c.Engine() != TaskQ || m == nil || m.queue == nil {
+		return &MigrationStatus{}
+	}
+
+	status := &MigrationStatus{
+		Active:      true,
+		FromFactory: c.options.taskq.factoryType,
+		StartedAt:   m.startedAt,
+		ToFactory:   m.factoryType,
+	}
+
+	// Remaining messages on the primary (old) queue
+	if c.options.taskq.queue != nil {
+		if pending, err := c.options.taskq.queue.Len(); err != nil {
+			status.Error = err.Error()
+		} else {
+			status.PendingFrom = pending
+			status.Drained = pending == 0
+		}
+	}
+
+	return status
+}
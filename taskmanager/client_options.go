@@ -2,6 +2,7 @@ package taskmanager
 
 import (
 	"context"
+	"time"
 
 	zLogger "github.com/mrz1836/go-logger"
 	"github.com/newrelic/go-agent/v3/newrelic"
@@ -23,7 +24,8 @@ func defaultClientOptions() *clientOptions {
 		engine:          Empty,
 		newRelicEnabled: false,
 		taskq: &taskqOptions{
-			tasks: make(map[string]*taskq.Task),
+			scheduled: make(map[string]time.Duration),
+			tasks:     make(map[string]*taskq.Task),
 		},
 	}
 }
@@ -64,6 +66,20 @@ func WithTaskQ(config *taskq.QueueOptions, factory Factory) ClientOps {
 	}
 }
 
+// WithTaskQMigration will load a secondary TaskQ backend (IE: moving from in-memory to Redis)
+//
+// New tasks (including periodic tasks) are added to the secondary backend, the primary (WithTaskQ) is drained
+func WithTaskQMigration(config *taskq.QueueOptions, factory Factory) ClientOps {
+	return func(c *clientOptions) {
+		if config != nil && !factory.IsEmpty() {
+			c.taskq.migration = &taskqMigrationOptions{
+				config:      config,
+				factoryType: factory,
+			}
+		}
+	}
+}
+
 // WithLogger will set the custom logger interface
 func WithLogger(customLogger zLogger.GormLoggerInterface) ClientOps {
 	return func(c *clientOptions) {
@@ -5,6 +5,7 @@ import (
 
 	zLogger "github.com/mrz1836/go-logger"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // TestWithNewRelic will test the method WithNewRelic()
@@ -74,6 +75,34 @@ func TestWithTaskQ(t *testing.T) {
 	})
 }
 
+// TestWithTaskQMigration will test the method WithTaskQMigration()
+func TestWithTaskQMigration(t *testing.T) {
+	t.Run("check type", func(t *testing.T) {
+		opt := WithTaskQMigration(nil, FactoryEmpty)
+		assert.IsType(t, *new(ClientOps), opt)
+	})
+
+	t.Run("test applying nil config", func(t *testing.T) {
+		options := &clientOptions{
+			taskq: &taskqOptions{},
+		}
+		opt := WithTaskQMigration(nil, FactoryMemory)
+		opt(options)
+		assert.Nil(t, options.taskq.migration)
+	})
+
+	t.Run("test applying valid config", func(t *testing.T) {
+		options := &clientOptions{
+			taskq: &taskqOptions{},
+		}
+		opt := WithTaskQMigration(DefaultTaskQConfig(testQueueName+"_new"), FactoryMemory)
+		opt(options)
+		require.NotNil(t, options.taskq.migration)
+		assert.Equal(t, FactoryMemory, options.taskq.migration.factoryType)
+		assert.NotNil(t, options.taskq.migration.config)
+	})
+}
+
 // TestWithLogger will test the method WithLogger()
 func TestWithLogger(t *testing.T) {
 	t.Parallel()
@@ -28,3 +28,6 @@ var ErrInvalidTaskDuration = errors.New("invalid duration for task")
 
 // ErrNoTasksFound is when there are no tasks found in the taskmanager
 var ErrNoTasksFound = errors.New("no tasks found")
+
+// ErrMigrationSameBackend is when the migration (secondary) backend is the same as the primary backend
+var ErrMigrationSameBackend = errors.New("taskq migration backend must be different from the primary backend")
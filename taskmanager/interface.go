@@ -32,4 +32,5 @@ type ClientInterface interface {
 	GetTxnCtx(ctx context.Context) context.Context
 	IsDebug() bool
 	IsNewRelicEnabled() bool
+	MigrationStatus() *MigrationStatus
 }
@@ -52,36 +52,35 @@ func convertTaskToTaskQ(task *Task) *taskq.TaskOptions {
 }
 
 // loadTaskQ will load TaskQ based on the Factory Type and configuration set by the client loading
-func (c *Client) loadTaskQ() error {
+func (c *Client) loadTaskQ() (err error) {
 
 	// Check for a valid config (set on client creation)
 	if c.options.taskq.config == nil {
 		return ErrMissingTaskQConfig
 	}
 
-	// Load using in-memory vs Redis
-	if c.options.taskq.factoryType == FactoryMemory {
-
-		// Create the factory
-		c.options.taskq.factory = memqueue.NewFactory()
-
-	} else if c.options.taskq.factoryType == FactoryRedis {
-
-		// Check for a redis connection (given on taskq configuration)
-		if c.options.taskq.config.Redis == nil {
-			return ErrMissingRedis
-		}
-
-		// Create the factory
-		c.options.taskq.factory = redisq.NewFactory()
-
-	} else {
-		return ErrMissingFactory
+	// Create the factory (in-memory vs Redis)
+	if c.options.taskq.factory, err = newTaskQFactory(
+		c.options.taskq.factoryType, c.options.taskq.config,
+	); err != nil {
+		return err
 	}
 
 	// Set the queue
 	c.options.taskq.queue = c.options.taskq.factory.RegisterQueue(c.options.taskq.config)
 
+	// Load the secondary backend (migration)
+	if m := c.options.taskq.migration; m != nil {
+		if m.config.Name == c.options.taskq.config.Name && m.factoryType == c.options.taskq.factoryType {
+			return ErrMigrationSameBackend
+		}
+		if m.factory, err = newTaskQFactory(m.factoryType, m.config); err != nil {
+			return err
+		}
+		m.queue = m.factory.RegisterQueue(m.config)
+		m.startedAt = time.Now().UTC()
+	}
+
 	// turn off logger for now
 	// NOTE: having issues with logger with system resources
 	// taskq.SetLogger(nil)
@@ -89,6 +88,29 @@ func (c *Client) loadTaskQ() error {
 	return nil
 }
 
+// newTaskQFactory will create the TaskQ factory for the given factory type (in-memory or Redis)
+func newTaskQFactory(factoryType Factory, config *taskq.QueueOptions) (taskq.Factory, error) {
+	if factoryType == FactoryMemory {
+		return memqueue.NewFactory(), nil
+	} else if factoryType == FactoryRedis {
+
+		// Check for a redis connection (given on taskq configuration)
+		if config.Redis == nil {
+			return nil, ErrMissingRedis
+		}
+		return redisq.NewFactory(), nil
+	}
+	return nil, ErrMissingFactory
+}
+
+// activeQueue will return the queue where new tasks are added (the secondary queue during a migration)
+func (c *Client) activeQueue() taskq.Queue {
+	if c.options.taskq.migration != nil && c.options.taskq.migration.queue != nil {
+		return c.options.taskq.migration.queue
+	}
+	return c.options.taskq.queue
+}
+
 // registerTaskUsingTaskQ will register a new task using the TaskQ engine
 func (c *Client) registerTaskUsingTaskQ(task *Task) {
 
@@ -147,18 +169,35 @@ func (c *Client) runTaskUsingTaskQ(ctx context.Context, options *TaskOptions) er
 		msg.SetDelay(options.Delay)
 	}
 
+	// Get the queue (new tasks go to the secondary queue during a migration)
+	queue := c.activeQueue()
+
 	// This is the "cron" aspect of the task
 	if options.RunEveryPeriod > 0 {
+
+		// Already scheduled using the same period? (registering twice is safe)
+		mutex.Lock()
+		if c.options.taskq.scheduled == nil {
+			c.options.taskq.scheduled = make(map[string]time.Duration)
+		}
+		if period, ok := c.options.taskq.scheduled[options.TaskName]; ok && period == options.RunEveryPeriod {
+			mutex.Unlock()
+			c.DebugLog(fmt.Sprintf("task: %s is already scheduled every %s", options.TaskName, period.String()))
+			return nil
+		}
+		c.options.taskq.scheduled[options.TaskName] = options.RunEveryPeriod
+		mutex.Unlock()
+
 		_, err := c.options.cronService.AddFunc(
 			fmt.Sprintf("@every %ds", int(options.RunEveryPeriod.Seconds())),
 			func() {
 				// todo: log the error if it occurs? Cannot pass the error back up
-				_ = c.options.taskq.queue.Add(msg)
+				_ = queue.Add(msg)
 			},
 		)
 		return err
 	}
 
 	// Add to the queue
-	return c.options.taskq.queue.Add(msg)
+	return queue.Add(msg)
 }
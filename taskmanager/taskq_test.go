@@ -6,6 +6,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
@@ -75,3 +76,85 @@ func TestNewClient(t *testing.T) {
 
 	t.Log("closing...")
 }
+
+// TestClient_MigrationStatus will test the method MigrationStatus()
+func TestClient_MigrationStatus(t *testing.T) {
+	t.Run("no migration", func(t *testing.T) {
+		c, err := NewClient(
+			context.Background(),
+			WithTaskQ(DefaultTaskQConfig(testQueueName+"_status"), FactoryMemory),
+		)
+		require.NoError(t, err)
+		defer func() {
+			_ = c.Close(context.Background())
+		}()
+
+		status := c.MigrationStatus()
+		require.NotNil(t, status)
+		assert.False(t, status.Active)
+	})
+
+	t.Run("same backend", func(t *testing.T) {
+		_, err := NewClient(
+			context.Background(),
+			WithTaskQ(DefaultTaskQConfig(testQueueName+"_same"), FactoryMemory),
+			WithTaskQMigration(DefaultTaskQConfig(testQueueName+"_same"), FactoryMemory),
+		)
+		require.ErrorIs(t, err, ErrMigrationSameBackend)
+	})
+
+	t.Run("memory to memory", func(t *testing.T) {
+		c, err := NewClient(
+			context.Background(),
+			WithTaskQ(DefaultTaskQConfig(testQueueName+"_old"), FactoryMemory),
+			WithTaskQMigration(DefaultTaskQConfig(testQueueName+"_new"), FactoryMemory),
+		)
+		require.NoError(t, err)
+		defer func() {
+			_ = c.Close(context.Background())
+		}()
+
+		status := c.MigrationStatus()
+		require.NotNil(t, status)
+		assert.True(t, status.Active)
+		assert.True(t, status.Drained)
+		assert.Equal(t, FactoryMemory, status.FromFactory)
+		assert.Equal(t, FactoryMemory, status.ToFactory)
+		assert.False(t, status.StartedAt.IsZero())
+	})
+}
+
+// TestClient_RunTask_Periodic will test the method RunTask() using a periodic task
+func TestClient_RunTask_Periodic(t *testing.T) {
+	c, err := NewClient(
+		context.Background(),
+		WithTaskQ(DefaultTaskQConfig(testQueueName+"_periodic"), FactoryMemory),
+	)
+	require.NoError(t, err)
+	defer func() {
+		_ = c.Close(context.Background())
+	}()
+
+	err = c.RegisterTask(&Task{
+		Name: "task-periodic",
+		Handler: func() error {
+			return nil
+		},
+	})
+	require.NoError(t, err)
+
+	// Registering the same periodic task twice is safe
+	options := &TaskOptions{
+		RunEveryPeriod: time.Minute,
+		TaskName:       "task-periodic",
+	}
+	require.NoError(t, c.RunTask(context.Background(), options))
+	require.NoError(t, c.RunTask(context.Background(), options))
+
+	client := c.(*Client)
+	assert.Len(t, client.options.taskq.scheduled, 1)
+
+	// Reset will clear the scheduled tasks
+	c.ResetCron()
+	assert.Len(t, client.options.taskq.scheduled, 0)
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"time"
 
+	"github.com/BuxOrg/bux/notifications"
 	"github.com/mrz1836/go-datastore"
 	zLogger "github.com/mrz1836/go-logger"
 )
@@ -16,9 +17,24 @@ func taskCleanupDraftTransactions(ctx context.Context, logClient zLogger.GormLog
 
 	// Construct an empty model
 	var models []DraftTransaction
+	timeNow := time.Now().UTC()
+	warningLead := NewBaseModel(ModelNameEmpty, opts...).Client().DraftExpiryWarning()
 	conditions := map[string]interface{}{
-		statusField: DraftStatusDraft,
-		// todo: add DB condition for date "expires_at": map[string]interface{}{"$lte": time.Now()},
+		statusField:    DraftStatusDraft,
+		expiresAtField: map[string]interface{}{"$lt": timeNow},
+	}
+
+	// The drafts expiring soon are warned once
+	if warningLead > 0 {
+		conditions = map[string]interface{}{
+			statusField: DraftStatusDraft,
+			conditionOr: []map[string]interface{}{{
+				expiresAtField: map[string]interface{}{"$lt": timeNow},
+			}, {
+				expiresAtField:    map[string]interface{}{"$lt": timeNow.Add(warningLead)},
+				expiryWarnedField: false,
+			}},
+		}
 	}
 
 	queryParams := &datastore.QueryParams{
@@ -34,25 +50,40 @@ func taskCleanupDraftTransactions(ctx context.Context, logClient zLogger.GormLog
 		&models, conditions, queryParams, defaultDatabaseReadTimeout,
 	); err != nil {
 		if errors.Is(err, datastore.ErrNoResults) {
-			return nil
+			return releaseExpiredUtxoReservations(ctx, opts...)
 		}
 		return err
 	}
 
-	// Loop and update
+	// Loop and update (expire, or warn about the drafts expiring soon)
 	var err error
-	timeNow := time.Now().UTC()
 	for index := range models {
-		if timeNow.After(models[index].ExpiresAt) {
-			models[index].enrich(ModelDraftTransaction, opts...)
-			models[index].Status = DraftStatusExpired
-			if err = models[index].Save(ctx); err != nil {
+		draft := &models[index]
+		if timeNow.After(draft.ExpiresAt) {
+			draft.enrich(ModelDraftTransaction, opts...)
+			if err = draft.setReservedSatoshis(ctx); err != nil {
 				return err
 			}
+			draft.Status = DraftStatusExpired
+			if err = draft.Save(ctx); err != nil {
+				return err
+			}
+			notify(ctx, notifications.EventTypeDraftExpired, draft)
+		} else if warningLead > 0 && !draft.ExpiryWarned && timeNow.Add(warningLead).After(draft.ExpiresAt) {
+			draft.enrich(ModelDraftTransaction, opts...)
+			if err = draft.setReservedSatoshis(ctx); err != nil {
+				return err
+			}
+			draft.ExpiryWarned = true
+			if err = draft.Save(ctx); err != nil {
+				return err
+			}
+			notify(ctx, notifications.EventTypeDraftExpiringSoon, draft)
 		}
 	}
 
-	return nil
+	// Release any expired manual utxo reservations
+	return releaseExpiredUtxoReservations(ctx, opts...)
 }
 
 // taskProcessIncomingTransactions will process any incoming transactions found
@@ -72,7 +103,7 @@ func taskBroadcastTransactions(ctx context.Context, logClient zLogger.GormLogger
 
 	logClient.Info(ctx, "running broadcast transaction(s) task...")
 
-	err := processBroadcastTransactions(ctx, 1000, opts...)
+	err := processBroadcastTransactions(ctx, defaultBroadcastPageSize, defaultBroadcastMaxRecords, opts...)
 	if err == nil || errors.Is(err, datastore.ErrNoResults) {
 		return nil
 	}
@@ -96,6 +127,18 @@ func taskSyncTransactions(ctx context.Context, logClient zLogger.GormLoggerInter
 
 	logClient.Info(ctx, "running sync transaction(s) task...")
 
+	// Warn about any backlog in the sync queues (only if a threshold is set)
+	if client := NewBaseModel(ModelNameEmpty, opts...).Client(); client != nil && client.SyncQueueWarningThreshold() > 0 {
+		if _, err := client.GetSyncQueueDepths(ctx); err != nil {
+			logClient.Error(ctx, "error getting the sync queue depths: "+err.Error())
+		}
+	}
+
+	// Confirm any broadcasts that were seen, but not yet confirmed on the network
+	if err := processBroadcastConfirmations(ctx, 10, opts...); err != nil && !errors.Is(err, datastore.ErrNoResults) {
+		return err
+	}
+
 	err := processSyncTransactions(ctx, 10, opts...)
 	if err == nil || errors.Is(err, datastore.ErrNoResults) {
 		return nil
@@ -110,3 +153,54 @@ func taskCheckTransactions(ctx context.Context, logClient zLogger.GormLoggerInte
 
 	return processTransactions(ctx, 1000, opts...)
 }
+
+// taskCleanupPendingPaymails will delete the pending paymail addresses that were not activated in time
+func taskCleanupPendingPaymails(ctx context.Context, logClient zLogger.GormLoggerInterface, opts ...ModelOps) error {
+
+	logClient.Info(ctx, "running cleanup pending paymail addresses task...")
+
+	return expirePendingPaymails(ctx, opts...)
+}
+
+// taskCleanupNotificationDeliveries will delete the notification delivery receipts older than the retention
+//
+// The dead-lettered events have their own retention (see WithNotificationDeadLetterRetention)
+func taskCleanupNotificationDeliveries(ctx context.Context, logClient zLogger.GormLoggerInterface,
+	opts ...ModelOps,
+) error {
+
+	logClient.Info(ctx, "running cleanup notification deliveries task...")
+
+	client := NewBaseModel(ModelNameEmpty, opts...).Client()
+
+	// Deliver the muted events of the expired mute windows (see MutedNotificationsSpool)
+	if _, err := redeliverMutedNotifications(ctx, client); err != nil {
+		return err
+	}
+
+	for _, cleanup := range []struct {
+		prune     func(ctx context.Context, before time.Time, batchSize int, opts ...ModelOps) (int, error)
+		retention time.Duration
+	}{
+		{pruneNotificationDeliveries, client.NotificationRetention()},
+		{pruneDeadLetteredNotifications, client.NotificationDeadLetterRetention()},
+	} {
+
+		// No retention means the records are kept
+		if cleanup.retention <= 0 {
+			continue
+		}
+
+		// Delete in batches
+		before := time.Now().UTC().Add(-cleanup.retention)
+		for {
+			deleted, err := cleanup.prune(ctx, before, 1000, opts...)
+			if err != nil {
+				return err
+			} else if deleted < 1000 {
+				break
+			}
+		}
+	}
+	return nil
+}
@@ -107,3 +107,17 @@ func SQLiteTestConfig(debug, shared bool) *datastore.SQLiteConfig {
 		Shared:       shared,
 	}
 }
+
+// SQLiteIsolatedTestConfig will return a test-version of SQLite using a new (named) in-memory database
+//
+// All the connections of the client share the database, and no other client can see it (safe for parallel tests)
+func SQLiteIsolatedTestConfig(debug bool) *datastore.SQLiteConfig {
+	config := SQLiteTestConfig(debug, false)
+	config.DatabasePath = SQLiteInMemoryDSN()
+	return config
+}
+
+// SQLiteInMemoryDSN will return the DSN of a new (named) in-memory database with a shared cache
+func SQLiteInMemoryDSN() string {
+	return "file:" + RandomTablePrefix() + "?mode=memory&cache=shared"
+}
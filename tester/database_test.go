@@ -1,6 +1,7 @@
 package tester
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -31,3 +32,20 @@ func TestSQLiteTestConfig(t *testing.T) {
 		assert.Equal(t, false, config.Shared)
 	})
 }
+
+// TestSQLiteIsolatedTestConfig will test the method SQLiteIsolatedTestConfig()
+func TestSQLiteIsolatedTestConfig(t *testing.T) {
+	t.Parallel()
+
+	config := SQLiteIsolatedTestConfig(true)
+	require.NotNil(t, config)
+
+	assert.Equal(t, true, config.Debug)
+	assert.Equal(t, false, config.Shared)
+	assert.NotEmpty(t, config.TablePrefix)
+	assert.True(t, strings.HasPrefix(config.DatabasePath, "file:_"))
+	assert.True(t, strings.HasSuffix(config.DatabasePath, "?mode=memory&cache=shared"))
+
+	// Each config gets a new database
+	assert.NotEqual(t, config.DatabasePath, SQLiteIsolatedTestConfig(true).DatabasePath)
+}
@@ -0,0 +1,28 @@
+package tester
+
+import (
+	"fmt"
+	"sync"
+)
+
+// SequenceIDGenerator is a deterministic ID generator for tests (IE: WithIDGenerator)
+//
+// IDs are 64 character hex strings: 00...01, 00...02, etc.
+type SequenceIDGenerator struct {
+	mu   sync.Mutex
+	next uint64
+}
+
+// NewSequenceIDGenerator will return a new sequence generator (the first ID will be start)
+func NewSequenceIDGenerator(start uint64) *SequenceIDGenerator {
+	return &SequenceIDGenerator{next: start}
+}
+
+// NewID will return the next ID in the sequence
+func (g *SequenceIDGenerator) NewID() (string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	id := fmt.Sprintf("%064x", g.next)
+	g.next++
+	return id, nil
+}
@@ -0,0 +1,160 @@
+package bux
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/mrz1836/go-datastore"
+)
+
+// Internal field names of the transaction filter
+const (
+	totalValueField      = "total_value"
+	xPubInIDsField       = "xpub_in_ids"
+	xPubOutIDsField      = "xpub_out_ids"
+	xPubOutputValueField = "xpub_output_value"
+)
+
+// TransactionFilter is a typed search of the transactions of an xPub (see SearchTransactions)
+//
+// The empty fields are not filtered, the conditions are combined (AND)
+type TransactionFilter struct {
+	BlockHeightRange *BlockHeightRange    `json:"block_height_range,omitempty"` // Mined in the range of blocks
+	Confirmed        *bool                `json:"confirmed,omitempty"`          // Mined (true) or not mined yet (false)
+	CreatedRange     *TimeRange           `json:"created_range,omitempty"`      // Recorded in the range of time
+	Direction        TransactionDirection `json:"direction,omitempty"`          // Value of the xPub: incoming, outgoing or reconcile
+	HasDraft         *bool                `json:"has_draft,omitempty"`          // Created from a draft of this instance (true) or external (false)
+	MaxSatoshis      uint64               `json:"max_satoshis,omitempty"`       // Maximum total value of the transaction
+	MinSatoshis      uint64               `json:"min_satoshis,omitempty"`       // Minimum total value of the transaction
+}
+
+// BlockHeightRange is an inclusive range of block heights (a zero bound is open)
+type BlockHeightRange struct {
+	From uint64 `json:"from,omitempty"`
+	To   uint64 `json:"to,omitempty"`
+}
+
+// TimeRange is an inclusive range of time (a zero bound is open)
+type TimeRange struct {
+	From time.Time `json:"from,omitempty"`
+	To   time.Time `json:"to,omitempty"`
+}
+
+// conditions will translate the filter into the conditions of the datastore engine (transactions of the xPub)
+func (f *TransactionFilter) conditions(engine datastore.Engine, xPubID string) (map[string]interface{}, error) {
+	conditions := map[string]interface{}{
+		conditionOr: []map[string]interface{}{{
+			xPubInIDsField: xPubID,
+		}, {
+			xPubOutIDsField: xPubID,
+		}},
+	}
+	if f == nil {
+		return conditions, nil
+	}
+
+	// Conditions that are a choice of values (the missing fields of Mongo are the zero values of SQL)
+	and := make([]map[string]interface{}, 0)
+	zeroOrMissing := func(field string, zero interface{}) map[string]interface{} {
+		return map[string]interface{}{
+			conditionOr: []map[string]interface{}{{field: zero}, {field: nil}},
+		}
+	}
+
+	// Direction (the value of the xPub in the transaction)
+	switch f.Direction {
+	case "":
+	case TransactionDirectionIn:
+		conditions[xPubOutputValueKey(engine, xPubID)] = map[string]interface{}{"$gt": 0}
+	case TransactionDirectionOut:
+		conditions[xPubOutputValueKey(engine, xPubID)] = map[string]interface{}{"$lt": 0}
+	case TransactionDirectionReconcile:
+		conditions[xPubOutputValueKey(engine, xPubID)] = 0
+	default:
+		return nil, fmt.Errorf("%w: unknown direction %s", ErrInvalidTransactionFilter, f.Direction)
+	}
+
+	// Block height (confirmed and the range)
+	blockHeight := make(map[string]interface{})
+	if f.Confirmed != nil {
+		if *f.Confirmed {
+			blockHeight["$gt"] = 0
+		} else {
+			and = append(and, zeroOrMissing(blockHeightField, 0))
+		}
+	}
+	if f.BlockHeightRange != nil {
+		if f.BlockHeightRange.To > 0 && f.BlockHeightRange.From > f.BlockHeightRange.To {
+			return nil, fmt.Errorf("%w: block height range", ErrInvalidTransactionFilter)
+		}
+		if f.BlockHeightRange.From > 0 {
+			blockHeight["$gte"] = f.BlockHeightRange.From
+		}
+		if f.BlockHeightRange.To > 0 {
+			blockHeight["$lte"] = f.BlockHeightRange.To
+		}
+	}
+	if len(blockHeight) > 0 {
+		conditions[blockHeightField] = blockHeight
+	}
+
+	// Total value
+	if f.MaxSatoshis > 0 && f.MinSatoshis > f.MaxSatoshis {
+		return nil, fmt.Errorf("%w: satoshis range", ErrInvalidTransactionFilter)
+	}
+	totalValue := make(map[string]interface{})
+	if f.MinSatoshis > 0 {
+		totalValue["$gte"] = f.MinSatoshis
+	}
+	if f.MaxSatoshis > 0 {
+		totalValue["$lte"] = f.MaxSatoshis
+	}
+	if len(totalValue) > 0 {
+		conditions[totalValueField] = totalValue
+	}
+
+	// Created (kept at the top level, the nested conditions of Mongo are converted through JSON)
+	if f.CreatedRange != nil {
+		if !f.CreatedRange.To.IsZero() && f.CreatedRange.From.After(f.CreatedRange.To) {
+			return nil, fmt.Errorf("%w: created range", ErrInvalidTransactionFilter)
+		}
+		createdAt := make(map[string]interface{})
+		if !f.CreatedRange.From.IsZero() {
+			createdAt["$gte"] = f.CreatedRange.From.UTC()
+		}
+		if !f.CreatedRange.To.IsZero() {
+			createdAt["$lte"] = f.CreatedRange.To.UTC()
+		}
+		if len(createdAt) > 0 {
+			conditions[createdAtField] = createdAt
+		}
+	}
+
+	// Draft
+	if f.HasDraft != nil {
+		if *f.HasDraft {
+			conditions[draftIDField] = map[string]interface{}{"$gt": ""}
+		} else {
+			and = append(and, zeroOrMissing(draftIDField, ""))
+		}
+	}
+
+	if len(and) > 0 {
+		conditions[conditionAnd] = and
+	}
+	return conditions, nil
+}
+
+// xPubOutputValueKey will return the condition key of the value of the xPub (xpub_output_value) for the engine
+//
+// The xPub ID is a resolved (hex) ID
+func xPubOutputValueKey(engine datastore.Engine, xPubID string) string {
+	switch engine {
+	case datastore.MongoDB:
+		return xPubOutputValueField + "." + xPubID
+	case datastore.PostgreSQL:
+		return "CAST(" + xPubOutputValueField + "::jsonb ->> '" + xPubID + "' AS BIGINT)"
+	default: // MySQL and SQLite
+		return "JSON_EXTRACT(" + xPubOutputValueField + ", '$.\"" + xPubID + "\"')"
+	}
+}
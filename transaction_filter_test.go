@@ -0,0 +1,171 @@
+package bux
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mrz1836/go-datastore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestTransactionFilter_conditions will test the method conditions()
+func TestTransactionFilter_conditions(t *testing.T) {
+	t.Parallel()
+
+	xPubOr := []map[string]interface{}{{xPubInIDsField: testXPubID}, {xPubOutIDsField: testXPubID}}
+	confirmed, unconfirmed := true, false
+
+	t.Run("no filter", func(t *testing.T) {
+		var filter *TransactionFilter
+		conditions, err := filter.conditions(datastore.SQLite, testXPubID)
+		require.NoError(t, err)
+		assert.Equal(t, map[string]interface{}{conditionOr: xPubOr}, conditions)
+	})
+
+	t.Run("direction by engine", func(t *testing.T) {
+		for engine, key := range map[datastore.Engine]string{
+			datastore.MongoDB:    "xpub_output_value." + testXPubID,
+			datastore.MySQL:      `JSON_EXTRACT(xpub_output_value, '$."` + testXPubID + `"')`,
+			datastore.PostgreSQL: "CAST(xpub_output_value::jsonb ->> '" + testXPubID + "' AS BIGINT)",
+			datastore.SQLite:     `JSON_EXTRACT(xpub_output_value, '$."` + testXPubID + `"')`,
+		} {
+			conditions, err := (&TransactionFilter{Direction: TransactionDirectionIn}).conditions(engine, testXPubID)
+			require.NoError(t, err)
+			assert.Equal(t, map[string]interface{}{"$gt": 0}, conditions[key], engine)
+
+			conditions, err = (&TransactionFilter{Direction: TransactionDirectionOut}).conditions(engine, testXPubID)
+			require.NoError(t, err)
+			assert.Equal(t, map[string]interface{}{"$lt": 0}, conditions[key], engine)
+
+			conditions, err = (&TransactionFilter{Direction: TransactionDirectionReconcile}).conditions(engine, testXPubID)
+			require.NoError(t, err)
+			assert.Equal(t, 0, conditions[key], engine)
+		}
+	})
+
+	t.Run("all fields", func(t *testing.T) {
+		from := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+		conditions, err := (&TransactionFilter{
+			BlockHeightRange: &BlockHeightRange{From: 700000, To: 800000},
+			Confirmed:        &confirmed,
+			CreatedRange:     &TimeRange{From: from},
+			HasDraft:         &confirmed,
+			MaxSatoshis:      5000,
+			MinSatoshis:      1000,
+		}).conditions(datastore.SQLite, testXPubID)
+		require.NoError(t, err)
+		assert.Equal(t, map[string]interface{}{
+			conditionOr:      xPubOr,
+			blockHeightField: map[string]interface{}{"$gt": 0, "$gte": uint64(700000), "$lte": uint64(800000)},
+			createdAtField:   map[string]interface{}{"$gte": from},
+			draftIDField:     map[string]interface{}{"$gt": ""},
+			totalValueField:  map[string]interface{}{"$gte": uint64(1000), "$lte": uint64(5000)},
+		}, conditions)
+	})
+
+	t.Run("zero or missing", func(t *testing.T) {
+		conditions, err := (&TransactionFilter{
+			Confirmed: &unconfirmed,
+			HasDraft:  &unconfirmed,
+		}).conditions(datastore.MongoDB, testXPubID)
+		require.NoError(t, err)
+		assert.Equal(t, []map[string]interface{}{
+			{conditionOr: []map[string]interface{}{{blockHeightField: 0}, {blockHeightField: nil}}},
+			{conditionOr: []map[string]interface{}{{draftIDField: ""}, {draftIDField: nil}}},
+		}, conditions[conditionAnd])
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		for _, filter := range []*TransactionFilter{
+			{Direction: "sideways"},
+			{BlockHeightRange: &BlockHeightRange{From: 2, To: 1}},
+			{MinSatoshis: 2, MaxSatoshis: 1},
+			{CreatedRange: &TimeRange{From: time.Now(), To: time.Now().Add(-time.Hour)}},
+		} {
+			_, err := filter.conditions(datastore.SQLite, testXPubID)
+			assert.ErrorIs(t, err, ErrInvalidTransactionFilter)
+		}
+	})
+}
+
+// TestClient_SearchTransactions will test the method SearchTransactions()
+func TestClient_SearchTransactions(t *testing.T) {
+	ctx, client, deferMe := CreateTestSQLiteClient(t, false, true, WithCustomTaskManager(&taskManagerMockBase{}))
+	t.Cleanup(deferMe)
+
+	testSearchTransactions(ctx, t, client)
+}
+
+// TestClient_SearchTransactions will test the method SearchTransactions() on the embedded databases
+func (ts *EmbeddedDBTestSuite) TestClient_SearchTransactions() {
+	for _, testCase := range dbTestCases {
+		ts.T().Run(testCase.name, func(t *testing.T) {
+			tc := ts.genericDBClient(t, testCase.database, false)
+			t.Cleanup(func() { tc.Close(tc.ctx) })
+
+			testSearchTransactions(tc.ctx, t, tc.client)
+		})
+	}
+}
+
+// testSearchTransactions will search an incoming (mined, external) and an outgoing (draft) transaction
+func testSearchTransactions(ctx context.Context, t *testing.T, client ClientInterface) {
+	fixtures := NewFixtures(t, client).WithXpub(0).WithUtxos(100000).WithDraft(&TransactionConfig{
+		Outputs: []*TransactionOutput{{To: testExternalAddress, Satoshis: 10000}},
+	})
+	signedHex, err := fixtures.Drafts[0].SignInputs(fixtures.HDKey)
+	require.NoError(t, err)
+	var outgoing *Transaction
+	outgoing, err = client.RecordTransaction(ctx, fixtures.RawXpub, signedHex, fixtures.Drafts[0].ID)
+	require.NoError(t, err)
+
+	// The funding is mined
+	var incoming *Transaction
+	incoming, err = client.GetTransaction(ctx, fixtures.Xpub.ID, fixtures.Transactions[0].ID)
+	require.NoError(t, err)
+	incoming.BlockHeight = 800000
+	incoming.BlockHash = testBlockHash
+	require.NoError(t, incoming.Save(ctx))
+
+	search := func(filter *TransactionFilter) []string {
+		transactions, searchErr := client.SearchTransactions(ctx, fixtures.Xpub.ID, filter, nil)
+		require.NoError(t, searchErr)
+		ids := make([]string, 0, len(transactions))
+		for _, transaction := range transactions {
+			ids = append(ids, transaction.ID)
+		}
+		return ids
+	}
+	confirmed, unconfirmed := true, false
+
+	assert.ElementsMatch(t, []string{incoming.ID, outgoing.ID}, search(nil))
+	assert.Equal(t, []string{incoming.ID}, search(&TransactionFilter{Direction: TransactionDirectionIn}))
+	assert.Equal(t, []string{outgoing.ID}, search(&TransactionFilter{Direction: TransactionDirectionOut}))
+	assert.Empty(t, search(&TransactionFilter{Direction: TransactionDirectionReconcile}))
+	assert.Equal(t, []string{incoming.ID}, search(&TransactionFilter{Confirmed: &confirmed}))
+	assert.Equal(t, []string{outgoing.ID}, search(&TransactionFilter{Confirmed: &unconfirmed}))
+	assert.Equal(t, []string{incoming.ID}, search(&TransactionFilter{MinSatoshis: 50000}))
+	assert.Equal(t, []string{outgoing.ID}, search(&TransactionFilter{MaxSatoshis: 50000}))
+	assert.Equal(t, []string{incoming.ID}, search(&TransactionFilter{BlockHeightRange: &BlockHeightRange{From: 799999, To: 800001}}))
+	assert.Empty(t, search(&TransactionFilter{BlockHeightRange: &BlockHeightRange{From: 800001}}))
+	assert.Equal(t, []string{outgoing.ID}, search(&TransactionFilter{HasDraft: &confirmed}))
+	assert.Equal(t, []string{incoming.ID}, search(&TransactionFilter{HasDraft: &unconfirmed}))
+	assert.ElementsMatch(t, []string{incoming.ID, outgoing.ID}, search(&TransactionFilter{
+		CreatedRange: &TimeRange{From: time.Now().Add(-time.Hour), To: time.Now().Add(time.Hour)},
+	}))
+	assert.Empty(t, search(&TransactionFilter{CreatedRange: &TimeRange{To: time.Now().Add(-time.Hour)}}))
+
+	// Combined
+	assert.Equal(t, []string{outgoing.ID}, search(&TransactionFilter{
+		Direction: TransactionDirectionOut, Confirmed: &unconfirmed, HasDraft: &confirmed, MaxSatoshis: 50000,
+	}))
+	assert.Empty(t, search(&TransactionFilter{Direction: TransactionDirectionIn, HasDraft: &confirmed}))
+
+	// Other xPubs do not see the transactions
+	other := NewFixtures(t, client).WithXpub(0)
+	transactions, err := client.SearchTransactions(ctx, other.Xpub.ID, &TransactionFilter{}, nil)
+	require.NoError(t, err)
+	assert.Empty(t, transactions)
+}
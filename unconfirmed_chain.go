@@ -0,0 +1,88 @@
+package bux
+
+import (
+	"context"
+
+	"github.com/libsv/go-bt/v2"
+)
+
+// getParentIDs will return the ids of the transactions spent by the inputs
+func getParentIDs(tx *bt.Tx) []string {
+	parentIDs := make([]string, 0, len(tx.Inputs))
+	for _, input := range tx.Inputs {
+		parentIDs = append(parentIDs, input.PreviousTxIDStr())
+	}
+	return parentIDs
+}
+
+// getUnconfirmedDepth will return the depth of the chain of unconfirmed ancestors of a transaction spending the parents
+//
+// Parents that are mined (or not handled by Bux) end the chain, a transaction spending only
+// confirmed outputs has a depth of 0. The depth recorded on the parents (UnconfirmedDepth) is used, it overstates
+// the depth once ancestors are mined (and misses the ancestors recorded after the parent). With a maxDepth
+// (0 = no limit) the ancestors of the parents that seem too deep are walked (at most maxDepth levels), any depth
+// above maxDepth is returned as maxDepth + 1
+func getUnconfirmedDepth(ctx context.Context, parentIDs []string, maxDepth uint32, opts ...ModelOps) (uint32, error) {
+	return walkUnconfirmedDepth(ctx, parentIDs, maxDepth, maxDepth > 0, make(map[string]uint32), opts...)
+}
+
+// walkUnconfirmedDepth will get the depth of the unconfirmed parents (the exact depths are memoized, parents can
+// be shared)
+func walkUnconfirmedDepth(ctx context.Context, parentIDs []string, limit uint32, bounded bool,
+	depths map[string]uint32, opts ...ModelOps,
+) (uint32, error) {
+	var depth uint32
+	for _, parentID := range parentIDs {
+		parentDepth, ok := depths[parentID]
+		if !ok {
+			parent, err := getTransactionByID(ctx, "", parentID, opts...)
+			if err != nil {
+				return 0, err
+			}
+			exact := true
+			if parent != nil && parent.BlockHeight == 0 {
+				parentDepth = parent.UnconfirmedDepth + 1
+				exact = parent.UnconfirmedDepth == 0
+				if bounded && parentDepth > limit {
+					// The recorded depth is above the limit, check the ancestors are still unconfirmed
+					if parentDepth, exact, err = walkParentDepth(ctx, parent, limit, depths, opts...); err != nil {
+						return 0, err
+					}
+				}
+			}
+			if exact {
+				depths[parentID] = parentDepth
+			}
+		}
+		if parentDepth > depth {
+			depth = parentDepth
+		}
+		if bounded && depth > limit {
+			return depth, nil
+		}
+	}
+	return depth, nil
+}
+
+// walkParentDepth will walk the ancestors of the unconfirmed parent (up to the limit), returns false if the depth
+// is above the limit (not exact)
+func walkParentDepth(ctx context.Context, parent *Transaction, limit uint32, depths map[string]uint32,
+	opts ...ModelOps,
+) (uint32, bool, error) {
+	if limit == 0 {
+		return 1, false, nil
+	}
+
+	parentTx, err := bt.NewTxFromString(parent.Hex)
+	if err != nil {
+		return 0, false, err
+	}
+
+	var depth uint32
+	if depth, err = walkUnconfirmedDepth(
+		ctx, getParentIDs(parentTx), limit-1, true, depths, opts...,
+	); err != nil {
+		return 0, false, err
+	}
+	return depth + 1, depth < limit, nil
+}
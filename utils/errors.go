@@ -18,3 +18,9 @@ var ErrDeriveFailed = errors.New("derive addresses failed, missing addresses")
 
 // ErrCouldNotDetermineDestinationOutput error when token output could not be determined
 var ErrCouldNotDetermineDestinationOutput = errors.New("could not determine token output destination")
+
+// ErrAddressNetworkMismatch is when the address does not belong to the network
+var ErrAddressNetworkMismatch = errors.New("address does not belong to the network")
+
+// ErrInvalidXpubReference is when the input is neither a valid xPub key nor an xPub ID (hash)
+var ErrInvalidXpubReference = errors.New("invalid xpub reference, expected an xpub key or xpub id")
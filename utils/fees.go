@@ -29,7 +29,8 @@ func GetOutputSize(lockingScript string) uint64 {
 	if lockingScript != "" {
 		size, _ := hex.DecodeString(lockingScript)
 		if size != nil {
-			return uint64(len(size)) + 9 // 9 bytes = 8 bytes value, 1 byte length
+			// 8 bytes value + script length (varint, 1 byte for standard scripts) + script
+			return 8 + uint64(bt.VarInt(len(size)).Length()) + uint64(len(size))
 		}
 	}
 
@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -30,4 +31,9 @@ func TestGetOutputSizeForType(t *testing.T) {
 	t.Run("unknown input type", func(t *testing.T) {
 		assert.Equal(t, uint64(500), GetOutputSize(""))
 	})
+
+	t.Run("large script", func(t *testing.T) {
+		// 1000 bytes script: 8 bytes value + 3 bytes length
+		assert.Equal(t, uint64(1011), GetOutputSize(strings.Repeat("51", 1000)))
+	})
 }
@@ -1,6 +1,10 @@
 package utils
 
 import (
+	"encoding/hex"
+	"strconv"
+	"strings"
+
 	"github.com/bitcoinschema/go-bitcoin/v2"
 	"github.com/libsv/go-bk/bec"
 	"github.com/libsv/go-bk/bip32"
@@ -58,6 +62,25 @@ func ValidateXPub(rawKey string) (*bip32.ExtendedKey, error) {
 	return hdKey, nil
 }
 
+// ResolveXpubID will return the xPub ID (hash) of the given reference, either a raw xPub key or an xPub ID
+//
+// The raw xPub key is validated, an xPub ID must be a 64 character hex string
+func ResolveXpubID(input string) (string, error) {
+	switch len(input) {
+	case XpubKeyLength:
+		if _, err := ValidateXPub(input); err != nil {
+			return "", ErrInvalidXpubReference
+		}
+		return Hash(input), nil
+	case XpubIDLength:
+		if _, err := hex.DecodeString(input); err != nil {
+			return "", ErrInvalidXpubReference
+		}
+		return strings.ToLower(input), nil
+	}
+	return "", ErrInvalidXpubReference
+}
+
 // DeriveAddress will derive the given address from a key
 func DeriveAddress(hdKey *bip32.ExtendedKey, chain uint32, num uint32) (address string, err error) {
 
@@ -86,6 +109,17 @@ func DeriveAddress(hdKey *bip32.ExtendedKey, chain uint32, num uint32) (address
 	return addressScript.AddressString, nil
 }
 
+// GetDerivationPath will return the full BIP32 derivation path (prefix/chain/num)
+//
+// The prefix is the path of the xPub (IE: m/44'/236'/0'), an empty prefix defaults to "m"
+func GetDerivationPath(prefix string, chain, num uint32) string {
+	prefix = strings.TrimSuffix(strings.TrimSpace(prefix), "/")
+	if len(prefix) == 0 {
+		prefix = "m"
+	}
+	return prefix + "/" + strconv.FormatUint(uint64(chain), 10) + "/" + strconv.FormatUint(uint64(num), 10)
+}
+
 // DeriveAddresses will derive the internal and external address from a key
 func DeriveAddresses(hdKey *bip32.ExtendedKey, num uint32) (external, internal string, err error) {
 
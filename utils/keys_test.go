@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/libsv/go-bk/bip32"
@@ -60,6 +61,49 @@ func Test_DeriveAddress(t *testing.T) {
 	})
 }
 
+// Test_GetDerivationPath will test the method GetDerivationPath()
+func Test_GetDerivationPath(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, "m/0/12", GetDerivationPath("", ChainExternal, 12))
+	assert.Equal(t, "m/1/0", GetDerivationPath("m", ChainInternal, 0))
+	assert.Equal(t, "m/44'/236'/0'/0/12", GetDerivationPath("m/44'/236'/0'", ChainExternal, 12))
+	assert.Equal(t, "m/44'/236'/0'/0/12", GetDerivationPath(" m/44'/236'/0'/ ", ChainExternal, 12))
+}
+
+// Test_ResolveXpubID will test the method ResolveXpubID()
+func Test_ResolveXpubID(t *testing.T) {
+	t.Parallel()
+
+	xPubID := Hash(testXPub)
+	tests := []struct {
+		name  string
+		input string
+		id    string
+		err   error
+	}{
+		{"xpub key", testXPub, xPubID, nil},
+		{"xpub id", xPubID, xPubID, nil},
+		{"upper case xpub id", strings.ToUpper(xPubID), xPubID, nil},
+		{"empty", "", "", ErrInvalidXpubReference},
+		{"garbage", "bad-xpub-id", "", ErrInvalidXpubReference},
+		{"invalid xpub key", testXPub[:110] + "x", "", ErrInvalidXpubReference},
+		{"invalid xpub id", strings.Repeat("z", XpubIDLength), "", ErrInvalidXpubReference},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			id, err := ResolveXpubID(test.input)
+			if test.err != nil {
+				assert.ErrorIs(t, err, test.err)
+				assert.Empty(t, id)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.id, id)
+		})
+	}
+}
+
 // Benchmark_DeriveAddresses will benchmark the method DeriveAddresses()
 func Benchmark_DeriveAddresses(b *testing.B) {
 
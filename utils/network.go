@@ -0,0 +1,67 @@
+package utils
+
+import (
+	"encoding/hex"
+
+	"github.com/libsv/go-bk/base58"
+	"github.com/libsv/go-bk/bip32"
+	"github.com/libsv/go-bk/chaincfg"
+	"github.com/libsv/go-bt/v2/bscript"
+)
+
+// DeriveAddressForNetwork will derive the given address from a key for the given network (mainnet, testnet)
+func DeriveAddressForNetwork(hdKey *bip32.ExtendedKey, network *chaincfg.Params,
+	chain uint32, num uint32) (string, error) {
+
+	// Derive the (mainnet) address
+	address, err := DeriveAddress(hdKey, chain, num)
+	if err != nil {
+		return "", err
+	}
+
+	return GetAddressForNetwork(address, network)
+}
+
+// GetAddressForNetwork will convert a (P2PKH) address into the address for the given network
+//
+// A nil network is mainnet
+func GetAddressForNetwork(address string, network *chaincfg.Params) (string, error) {
+	if network == nil {
+		network = &chaincfg.MainNet
+	}
+
+	// Get the public key hash (same on all networks)
+	addr, err := bscript.NewAddressFromString(address)
+	if err != nil {
+		return "", err
+	}
+
+	var hash []byte
+	if hash, err = hex.DecodeString(addr.PublicKeyHash); err != nil {
+		return "", err
+	}
+
+	return bscript.Base58EncodeMissingChecksum(
+		append([]byte{network.LegacyPubKeyHashAddrID}, hash...),
+	), nil
+}
+
+// ValidateAddressNetwork will make sure the (P2PKH) address belongs to the given network
+//
+// A nil network is mainnet
+func ValidateAddressNetwork(address string, network *chaincfg.Params) error {
+	if network == nil {
+		network = &chaincfg.MainNet
+	}
+
+	// Make sure it's a valid address
+	if _, err := bscript.NewAddressFromString(address); err != nil {
+		return err
+	}
+
+	// The first byte is the network (version)
+	if base58.Decode(address)[0] != network.LegacyPubKeyHashAddrID {
+		return ErrAddressNetworkMismatch
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/libsv/go-bk/chaincfg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestDeriveAddressForNetwork will test the method DeriveAddressForNetwork()
+func TestDeriveAddressForNetwork(t *testing.T) {
+	t.Parallel()
+
+	hdKey, err := ValidateXPub(testXpub)
+	require.NoError(t, err)
+
+	t.Run("mainnet", func(t *testing.T) {
+		var address, mainAddress string
+		address, err = DeriveAddressForNetwork(hdKey, &chaincfg.MainNet, ChainExternal, 0)
+		require.NoError(t, err)
+		mainAddress, err = DeriveAddress(hdKey, ChainExternal, 0)
+		require.NoError(t, err)
+		assert.Equal(t, mainAddress, address)
+		assert.NoError(t, ValidateAddressNetwork(address, &chaincfg.MainNet))
+	})
+
+	t.Run("testnet", func(t *testing.T) {
+		var address string
+		address, err = DeriveAddressForNetwork(hdKey, &chaincfg.TestNet, ChainExternal, 0)
+		require.NoError(t, err)
+		assert.Contains(t, []string{"m", "n"}, address[:1])
+		assert.NoError(t, ValidateAddressNetwork(address, &chaincfg.TestNet))
+		assert.ErrorIs(t, ValidateAddressNetwork(address, &chaincfg.MainNet), ErrAddressNetworkMismatch)
+	})
+}
+
+// TestGetAddressForNetwork will test the method GetAddressForNetwork()
+func TestGetAddressForNetwork(t *testing.T) {
+	t.Parallel()
+
+	const mainAddress = "1CfaQw9udYNPccssFJFZ94DN8MqNZm9nGt"
+
+	testAddress, err := GetAddressForNetwork(mainAddress, &chaincfg.TestNet)
+	require.NoError(t, err)
+	assert.NotEqual(t, mainAddress, testAddress)
+
+	var address string
+	address, err = GetAddressForNetwork(testAddress, nil)
+	require.NoError(t, err)
+	assert.Equal(t, mainAddress, address)
+
+	_, err = GetAddressForNetwork("invalid-address", &chaincfg.TestNet)
+	assert.Error(t, err)
+}
@@ -7,9 +7,14 @@ import (
 	"github.com/libsv/go-bt/v2/sighash"
 )
 
-// GetUnlockingScript will generate an unlocking script
+// GetUnlockingScript will generate an unlocking script (SIGHASH_ALL|FORKID)
 func GetUnlockingScript(tx *bt.Tx, inputIndex uint32, privateKey *bec.PrivateKey) (*bscript.Script, error) {
-	sigHashFlags := sighash.AllForkID
+	return GetUnlockingScriptWithSigHash(tx, inputIndex, privateKey, sighash.AllForkID)
+}
+
+// GetUnlockingScriptWithSigHash will generate an unlocking script using the given sighash flags
+func GetUnlockingScriptWithSigHash(tx *bt.Tx, inputIndex uint32, privateKey *bec.PrivateKey,
+	sigHashFlags sighash.Flag) (*bscript.Script, error) {
 
 	sigHash, err := tx.CalcInputSignatureHash(inputIndex, sigHashFlags)
 	if err != nil {
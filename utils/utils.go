@@ -18,6 +18,9 @@ const (
 	// XpubKeyLength is the length of an xPub string key
 	XpubKeyLength = 111
 
+	// XpubIDLength is the length of an xPub ID (hex encoded hash of the xPub key)
+	XpubIDLength = 64
+
 	// ChainInternal internal chain num
 	ChainInternal = uint32(1)
 